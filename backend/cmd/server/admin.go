@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"github.com/abcdefak87/cctv/internal/service"
+)
+
+// runCreateAdmin handles `server create-admin` and returns the exit code
+func runCreateAdmin(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	username := flags.String("username", "admin", "login name")
+	password := flags.String("password", "", "password (generated when empty)")
+	email := flags.String("email", "", "email address")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = randomPassword()
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	users := service.NewUserService(repository.NewUserRepository(db))
+	_, err = users.Create(context.Background(), service.UserInput{
+		Username: *username,
+		Email:    *email,
+		Password: *password,
+		Role:     "admin",
+	})
+	if err != nil {
+		var invalid *service.ValidationError
+		if errors.As(err, &invalid) {
+			fmt.Fprintf(os.Stderr, "%s; use reset-password to change its password\n", invalid.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "Failed to create admin: %v\n", err)
+		}
+		return 1
+	}
+
+	fmt.Println("✅ Admin user created successfully!")
+	fmt.Println("   Username:", *username)
+	if generated {
+		fmt.Println("   Password:", *password)
+		fmt.Println("")
+		fmt.Println("⚠️  Store this password now; it is not shown again.")
+	}
+	return 0
+}
+
+// runResetPassword handles `server reset-password <username>`
+func runResetPassword(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	password := flags.String("password", "", "new password (generated when empty)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server reset-password [-password new] <username>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	username := flags.Arg(0)
+
+	generated := *password == ""
+	if generated {
+		*password = randomPassword()
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	users := service.NewUserService(repository.NewUserRepository(db))
+	if err := users.ResetPassword(context.Background(), username, *password); err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "User %q not found\n", username)
+		} else {
+			fmt.Fprintf(os.Stderr, "Failed to reset password: %v\n", err)
+		}
+		return 1
+	}
+
+	fmt.Printf("✅ Password for %s has been reset\n", username)
+	if generated {
+		fmt.Println("   New password:", *password)
+	}
+	return 0
+}
+
+// randomPassword returns 16 hex characters from crypto/rand
+func randomPassword() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
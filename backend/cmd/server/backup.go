@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database"
+)
+
+// runBackup handles `server backup [path]`. Without a path the copy goes
+// to a timestamped file in a backups directory next to the database.
+func runBackup(cfg *config.Config, args []string) int {
+	if len(args) > 1 || (len(args) == 1 && args[0] == "-h") {
+		fmt.Fprintln(os.Stderr, "Usage: server backup [path]")
+		return 2
+	}
+
+	path := filepath.Join(filepath.Dir(cfg.Database.Path), "backups",
+		"cctv-"+time.Now().Format("20060102-150405")+".db")
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := database.Backup(context.Background(), db, path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println("Backup written to", path)
+	return 0
+}
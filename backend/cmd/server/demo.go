@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/demo"
+	"github.com/abcdefak87/cctv/internal/tenant"
+)
+
+// runSeedDemo handles `server seed-demo`: sample areas, cameras on public
+// test streams, a user of each role and past viewer sessions, for trying
+// the dashboard without cameras of one's own
+func runSeedDemo(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("seed-demo", flag.ContinueOnError)
+	org := flags.Int("org", tenant.DefaultOrgID, "organization ID to fill")
+	days := flags.Int("days", demo.DefaultDays, "days of viewer sessions to make up")
+	password := flags.String("password", "", "password of every demo user (generated per user when empty)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server seed-demo [-org id] [-days n] [-password pw]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 || *days < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := tenant.WithOrg(context.Background(), *org)
+	result, err := demo.Seed(ctx, db, demo.Options{Days: *days, Password: *password}, time.Now())
+	if errors.Is(err, demo.ErrNotEmpty) {
+		fmt.Fprintln(os.Stderr, "Demo data is only added to an organization without cameras")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to add demo data: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("✅ Added %d areas, %d cameras, %d settings and %d viewer sessions\n",
+		result.Areas, result.Cameras, result.Settings, result.Sessions)
+	printDemoUsers(os.Stdout, result.Users)
+	return 0
+}
+
+// printDemoUsers lists the demo users with their passwords, which are
+// not shown again
+func printDemoUsers(w io.Writer, users []demo.User) {
+	for _, u := range users {
+		fmt.Fprintf(w, "   %-9s %s / %s\n", u.Role, u.Username, u.Password)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "⚠️  The demo users are for trying things out; delete them before real use.")
+}
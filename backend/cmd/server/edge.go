@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/edge"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// runEdgeAgent handles `server edge-agent`: run at a remote site, it
+// registers the site's cameras with the local go2rtc and relays their
+// streams to the central server named by EDGE_SERVER_URL
+func runEdgeAgent(cfg *config.Config, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: server edge-agent")
+		return 2
+	}
+	if cfg.Edge.ServerURL == "" || cfg.Edge.Token == "" {
+		fmt.Fprintln(os.Stderr, "EDGE_SERVER_URL and EDGE_TOKEN must be set")
+		return 2
+	}
+	if cfg.Edge.Tunnels < 1 {
+		fmt.Fprintln(os.Stderr, "EDGE_TUNNELS must be at least 1")
+		return 2
+	}
+
+	logger.Init(cfg.Server.Env, cfg.Server.LogLevel)
+
+	client, err := httpclient.New(cfg.HTTP.Options())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create HTTP client: %v\n", err)
+		return 1
+	}
+	httpclient.SetShared(client)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	agent := &edge.Agent{
+		ServerURL: cfg.Edge.ServerURL,
+		Token:     cfg.Edge.Token,
+		Go2RTCURL: cfg.Edge.Go2RTCURL,
+		Tunnels:   cfg.Edge.Tunnels,
+		Interval:  cfg.Edge.HeartbeatInterval,
+	}
+	logger.Info("Edge agent started", "server", cfg.Edge.ServerURL, "go2rtc", cfg.Edge.Go2RTCURL)
+	if err := agent.Run(ctx); err != nil {
+		if errors.Is(err, edge.ErrUnauthorized) {
+			fmt.Fprintln(os.Stderr, "The server refused EDGE_TOKEN; create a new token for this node")
+		} else {
+			fmt.Fprintf(os.Stderr, "Edge agent failed: %v\n", err)
+		}
+		return 1
+	}
+	logger.Info("Edge agent stopped")
+	return 0
+}
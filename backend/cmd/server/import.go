@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"github.com/abcdefak87/cctv/internal/service"
+	"github.com/abcdefak87/cctv/internal/tenant"
+)
+
+// cameraRecord is one camera in an import file. Fields use the same
+// names as the POST /api/cameras body; enabled defaults to true.
+type cameraRecord struct {
+	Name           string   `json:"name"`
+	PrivateRTSPURL string   `json:"private_rtsp_url"`
+	Description    string   `json:"description"`
+	Location       string   `json:"location"`
+	GroupName      string   `json:"group_name"`
+	AreaID         *int     `json:"area_id"`
+	Latitude       *float64 `json:"latitude"`
+	Longitude      *float64 `json:"longitude"`
+	Enabled        *bool    `json:"enabled"`
+}
+
+func (r cameraRecord) input() service.CameraInput {
+	return service.CameraInput{
+		Name:           r.Name,
+		PrivateRTSPURL: r.PrivateRTSPURL,
+		Description:    r.Description,
+		Location:       r.Location,
+		GroupName:      r.GroupName,
+		AreaID:         r.AreaID,
+		Latitude:       r.Latitude,
+		Longitude:      r.Longitude,
+		Enabled:        r.Enabled == nil || *r.Enabled,
+	}
+}
+
+// runImportCameras handles `server import-cameras <file>`. Each camera is
+// created on its own, so one bad row does not stop the rest.
+func runImportCameras(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("import-cameras", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file without writing")
+	org := flags.Int("org", tenant.DefaultOrgID, "organization ID to import into")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server import-cameras [-dry-run] [-org id] <file.json|file.csv>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	records, err := readCameraFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *dryRun {
+		fmt.Printf("%d camera(s) read, nothing written\n", len(records))
+		return 0
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	cameras := service.NewCameraService(repository.NewCameraRepository(db), repository.NewAreaRepository(db))
+	ctx := tenant.WithOrg(context.Background(), *org)
+
+	failed := 0
+	for i, record := range records {
+		camera, err := cameras.Create(ctx, record.input())
+		if err != nil {
+			failed++
+			var invalid *service.ValidationError
+			if errors.As(err, &invalid) {
+				err = errors.New(invalid.Message)
+			}
+			fmt.Fprintf(os.Stderr, "Camera %d (%s): %v\n", i+1, record.Name, err)
+			continue
+		}
+		fmt.Printf("Created %s (id %d, stream key %s)\n", camera.Name, camera.ID, camera.StreamKey)
+	}
+
+	fmt.Printf("Imported %d of %d camera(s)\n", len(records)-failed, len(records))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readCameraFile parses a JSON array or, for .csv files, a CSV file with
+// a header row naming the columns
+func readCameraFile(path string) ([]cameraRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return parseCameraCSV(f)
+	}
+
+	var records []cameraRecord
+	if err := json.NewDecoder(f).Decode(&records); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	return records, nil
+}
+
+func parseCameraCSV(r io.Reader) ([]cameraRecord, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	var records []cameraRecord
+	for line, row := range rows[1:] {
+		var record cameraRecord
+		for i, column := range header {
+			value := strings.TrimSpace(row[i])
+			if value == "" {
+				continue
+			}
+
+			if err := record.set(strings.TrimSpace(column), value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line+2, err)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// set assigns a CSV cell to the field named by its column
+func (r *cameraRecord) set(column, value string) error {
+	switch column {
+	case "name":
+		r.Name = value
+	case "private_rtsp_url":
+		r.PrivateRTSPURL = value
+	case "description":
+		r.Description = value
+	case "location":
+		r.Location = value
+	case "group_name":
+		r.GroupName = value
+	case "area_id":
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid area_id %q", value)
+		}
+		r.AreaID = &id
+	case "latitude", "longitude":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", column, value)
+		}
+		if column == "latitude" {
+			r.Latitude = &f
+		} else {
+			r.Longitude = &f
+		}
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled %q", value)
+		}
+		r.Enabled = &b
+	default:
+		return fmt.Errorf("unknown column %q", column)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCameraCSV(t *testing.T) {
+	t.Run("Reads columns by header", func(t *testing.T) {
+		records, err := parseCameraCSV(strings.NewReader(
+			"name,private_rtsp_url,area_id,latitude,longitude,enabled\n" +
+				"Gate,rtsp://10.0.0.2/stream,3,-7.25,112.75,false\n" +
+				"Lobby,rtsp://10.0.0.3/stream,,,,\n",
+		))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("Expected 2 records, got %d", len(records))
+		}
+
+		gate := records[0].input()
+		if gate.Name != "Gate" || gate.AreaID == nil || *gate.AreaID != 3 {
+			t.Errorf("Expected Gate in area 3, got %+v", gate)
+		}
+		if gate.Latitude == nil || *gate.Latitude != -7.25 || gate.Enabled {
+			t.Errorf("Expected coordinates and enabled=false, got %+v", gate)
+		}
+
+		lobby := records[1].input()
+		if lobby.AreaID != nil || lobby.Latitude != nil || !lobby.Enabled {
+			t.Errorf("Expected empty cells to use defaults, got %+v", lobby)
+		}
+	})
+
+	t.Run("Rejects unknown columns", func(t *testing.T) {
+		_, err := parseCameraCSV(strings.NewReader("name,rtsp\nGate,rtsp://x\n"))
+		if err == nil || !strings.Contains(err.Error(), `unknown column "rtsp"`) {
+			t.Errorf("Expected unknown column error, got %v", err)
+		}
+	})
+
+	t.Run("Reports the line of a bad value", func(t *testing.T) {
+		_, err := parseCameraCSV(strings.NewReader("name,latitude\nGate,north\n"))
+		if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+			t.Errorf("Expected line 2 error, got %v", err)
+		}
+	})
+}
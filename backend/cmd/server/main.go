@@ -1,94 +1,101 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 
 	"github.com/abcdefak87/cctv/internal/config"
 	"github.com/abcdefak87/cctv/internal/database"
-	"github.com/abcdefak87/cctv/internal/routes"
-	"github.com/abcdefak87/cctv/pkg/logger"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/recover"
 )
 
+// command is a subcommand of the server binary. run gets the arguments
+// after the command name and returns the exit code.
+type command struct {
+	summary string
+	run     func(cfg *config.Config, args []string) int
+}
+
+var commands = map[string]command{
+	"serve":              {"Start the HTTP server (default)", runServe},
+	"migrate":            {"Apply, roll back or list database migrations", runMigrate},
+	"create-admin":       {"Create an admin user", runCreateAdmin},
+	"reset-password":     {"Set a new password for a user", runResetPassword},
+	"backup":             {"Write a consistent copy of the SQLite database", runBackup},
+	"import-cameras":     {"Add cameras from a JSON or CSV file", runImportCameras},
+	"sync-from-streamer": {"Add cameras for the streams of a go2rtc or MediaMTX setup", runSyncFromStreamer},
+	"seed-demo":          {"Fill an empty database with demo cameras, users and sessions", runSeedDemo},
+	"check-config":       {"Validate the configuration and print a report", runCheckConfig},
+	"edge-agent":         {"Relay a remote site's cameras to the central server", runEdgeAgent},
+}
+
+// commandOrder lists commands in the order usage shows them
+var commandOrder = []string{"serve", "migrate", "create-admin", "reset-password", "backup", "import-cameras", "sync-from-streamer", "seed-demo", "check-config", "edge-agent"}
+
 func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "--help":
+			usage()
+			return
+		}
+		if !strings.HasPrefix(args[0], "-") {
+			name, args = args[0], args[1:]
+		}
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
 	// Load configuration
 	cfg := config.Load()
-	
-	// Initialize logger
-	logger.Init(cfg.Server.Env)
-	
-	// Initialize database
-	db, err := database.Connect(cfg.Database.Path)
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+
+	os.Exit(cmd.run(cfg, args))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: server [command] [arguments]\n\nCommands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", name, commands[name].summary)
 	}
-	defer db.Close()
-	
-	// Run migrations
-	if err := database.RunMigrations(db); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	fmt.Fprintln(os.Stderr, "\nRun 'server <command> -h' for the arguments of a command.")
+}
+
+// runCheckConfig prints the startup checks; the exit code is 1 when the
+// server would refuse to start
+func runCheckConfig(cfg *config.Config, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: server check-config")
+		return 2
 	}
-	
-	// Create Fiber app
-	app := fiber.New(fiber.Config{
-		ErrorHandler: customErrorHandler,
-		BodyLimit:    1 * 1024 * 1024, // 1MB
-	})
-	
-	// Global middleware
-	app.Use(recover.New())
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     cfg.Security.AllowedOrigins,
-		AllowCredentials: true,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-API-Key, X-CSRF-Token",
-		AllowMethods:     "GET, POST, PUT, DELETE, PATCH, OPTIONS",
-	}))
-	
-	// Health check
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status": "ok",
-			"env":    cfg.Server.Env,
-		})
-	})
-	
-	// Setup routes
-	routes.Setup(app, db, cfg)
-	
-	// Graceful shutdown
-	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-		<-sigChan
-		
-		logger.Info("Shutting down gracefully...")
-		app.Shutdown()
-	}()
-	
-	// Start server
-	addr := cfg.Server.Host + ":" + cfg.Server.Port
-	logger.Info("Server starting on " + addr)
-	
-	if err := app.Listen(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+
+	report := config.Validate(context.Background(), cfg)
+	fmt.Print(report)
+	if report.Err() != nil {
+		return 1
 	}
+	return 0
 }
 
-func customErrorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
-	
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
+// openDatabase connects with the configured driver and brings the
+// schema up to date, as every command that reads or writes rows needs
+func openDatabase(cfg *config.Config) (*sql.DB, error) {
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		return nil, err
 	}
-	
-	return c.Status(code).JSON(fiber.Map{
-		"success": false,
-		"message": err.Error(),
-	})
+
+	if err := database.RunMigrations(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	return db, nil
 }
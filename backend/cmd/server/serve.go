@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/accesslog"
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database"
+	"github.com/abcdefak87/cctv/internal/demo"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/internal/routes"
+	"github.com/abcdefak87/cctv/internal/shutdown"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// runServe starts the HTTP server and blocks until it has shut down
+func runServe(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	seedDemo := flags.Bool("seed-demo", false, "add demo data first when the database has no cameras; see seed-demo")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server serve [-seed-demo]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	
+	// Initialize logger
+	logger.Init(cfg.Server.Env, cfg.Server.LogLevel)
+	if cfg.Cluster.Enabled {
+		logger.Tag("instance", cfg.Cluster.InstanceID)
+	}
+	
+	// Refuse to start on a configuration that cannot work
+	report := config.Validate(context.Background(), cfg)
+	logReport(report)
+	if err := report.Err(); err != nil {
+		logger.Fatal("Configuration check failed", "error", err)
+	}
+	
+	// Outbound requests (go2rtc, webhooks, Telegram) share one client;
+	// Validate has already rejected a malformed proxy URL
+	client, err := httpclient.New(cfg.HTTP.Options())
+	if err != nil {
+		logger.Fatal("Failed to create HTTP client", "error", err)
+	}
+	httpclient.SetShared(client)
+	
+	// Caches, rate limits and revoked tokens are kept in Redis when
+	// REDIS_URL is set, shared by every instance, and in memory otherwise
+	store, err := cache.Open(cfg.Redis)
+	if err != nil {
+		logger.Fatal("Failed to open cache", "error", err)
+	}
+	cache.SetShared(store)
+	
+	// Initialize database and run migrations
+	db, err := openDatabase(cfg)
+	if err != nil {
+		logger.Fatal("Failed to open database", "error", err)
+	}
+	if err := database.SetAutoVacuum(context.Background(), db, cfg.Database.AutoVacuum); err != nil {
+		logger.Fatal("Failed to set auto-vacuum", "error", err)
+	}
+	if *seedDemo {
+		seedDemoData(db)
+	}
+	
+	// Create Fiber app
+	app := fiber.New(fiber.Config{
+		ErrorHandler: customErrorHandler,
+		BodyLimit:    1 * 1024 * 1024, // 1MB
+		// The banner would break JSON log parsing
+		DisableStartupMessage: cfg.Server.Env == "production",
+	})
+	
+	// Requests are recorded for later queries when ACCESS_LOG_SINK is set
+	accessLog, err := accesslog.New(cfg.AccessLog, db)
+	if err != nil {
+		logger.Fatal("Failed to open access log", "error", err)
+	}
+	
+	// Public routes, streams and the rest each allow their own origins,
+	// read per request so a config reload applies new origins
+	corsHandler := middleware.CORS(cors.Config{
+		AllowCredentials: true,
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-API-Key, X-CSRF-Token, X-Request-ID, X-Player-Token",
+		ExposeHeaders:    "X-Request-ID, X-Quota-Limit, X-Quota-Remaining",
+		AllowMethods:     "GET, POST, PUT, DELETE, PATCH, OPTIONS",
+	}, func(c *fiber.Ctx) []string {
+		return cfg.CORSOrigins(routes.CORSGroup(c))
+	})
+	
+	// Global middleware
+	app.Use(middleware.RequestID())
+	if cfg.Cluster.Enabled {
+		app.Use(middleware.InstanceID(cfg.Cluster.InstanceID))
+	}
+	// Preflights are answered here, before the access log and the rest,
+	// and cached by browsers for CORS_<GROUP>_MAX_AGE seconds
+	app.Use(middleware.Preflight(corsHandler, routes.CORSGroup, cfg.CORSMaxAge, middleware.Preflights()))
+	app.Use(middleware.AccessLog(accessLog))
+	app.Use(recover.New())
+	if cfg.TLS.Enabled() {
+		app.Use(middleware.HSTS(cfg.TLS.HSTSMaxAge))
+	}
+	if cfg.Security.Headers {
+		app.Use(middleware.SecurityHeaders(
+			cfg.Security.ContentSecurityPolicy,
+			cfg.Security.CSPReportOnly,
+			cfg.Security.EmbedFrameAncestors,
+		))
+	}
+	app.Use(middleware.Compress(cfg.Server.Compression))
+	app.Use(corsHandler)
+	
+	// Event consumers; producers publish on the default bus
+	events.Subscribe("*", "audit log", events.AuditLog(db))
+	
+	// Shutdown runs these steps in order: stop accepting connections and
+	// drain in-flight requests, wait for background workers, deliver
+	// queued events and access log entries, then flush and close the
+	// database
+	lifecycle := shutdown.New(cfg.Server.ShutdownTimeout)
+	lifecycle.OnShutdown("http server", app.ShutdownWithContext)
+	lifecycle.OnShutdown("workers", lifecycle.Wait)
+	lifecycle.OnShutdown("events", events.Close)
+	if accessLog != nil {
+		lifecycle.OnShutdown("access log", accessLog.Close)
+	}
+	lifecycle.OnShutdown("database", func(ctx context.Context) error {
+		return database.Close(ctx, db)
+	})
+	
+	// Setup routes
+	routes.Setup(app, db, cfg, lifecycle)
+	
+	// SIGHUP reloads the settings that can change without a restart;
+	// POST /api/admin/config/reload does the same
+	cfg.OnReload(func(c *config.Config) {
+		logger.SetLevel(c.Server.Env, c.LogLevel())
+	})
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			changed, err := cfg.Reload()
+			if err != nil {
+				logger.Error("Configuration reload failed", "error", err)
+				continue
+			}
+			logger.Info("Configuration reloaded", "changed", changed)
+		}
+	}()
+	
+	// Graceful shutdown
+	stopped := make(chan struct{})
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		<-sigChan
+		
+		logger.Info("Shutting down gracefully...", "timeout", cfg.Server.ShutdownTimeout.String())
+		if err := lifecycle.Shutdown(); err != nil {
+			logger.Error("Shutdown incomplete", "error", err)
+		}
+		close(stopped)
+	}()
+	
+	// Start server
+	addr := cfg.Server.Host + ":" + cfg.Server.Port
+	logger.Info("Server starting", "addr", addr, "env", cfg.Server.Env, "tls", cfg.TLS.Enabled())
+	
+	if err := listen(app, addr, cfg.TLS, lifecycle); err != nil {
+		logger.Fatal("Failed to start server", "error", err)
+	}
+	
+	// Listen returns as soon as the listener closes; wait for draining
+	<-stopped
+	logger.Info("Server stopped")
+	return 0
+}
+
+// logReport writes one log line per startup check
+func logReport(report *config.Report) {
+	for _, check := range report.Checks {
+		switch check.Severity {
+		case config.Fail:
+			logger.Error("Config check failed", "check", check.Name, "detail", check.Detail)
+		case config.Warn:
+			logger.Warn("Config check", "check", check.Name, "detail", check.Detail)
+		default:
+			logger.Debug("Config check", "check", check.Name, "detail", check.Detail)
+		}
+	}
+}
+
+// seedDemoData adds the demo data of `serve -seed-demo` to the default
+// organization and prints the demo users to stderr. A database with
+// cameras is left alone, so the flag can stay on across restarts; the
+// server starts either way.
+func seedDemoData(db *sql.DB) {
+	ctx := tenant.WithOrg(context.Background(), tenant.DefaultOrgID)
+	result, err := demo.Seed(ctx, db, demo.Options{}, time.Now())
+	switch {
+	case errors.Is(err, demo.ErrNotEmpty):
+		logger.Info("Demo data skipped; the database already has cameras")
+		return
+	case err != nil:
+		logger.Error("Failed to add demo data", "error", err)
+		return
+	}
+	logger.Info("Demo data added", "areas", result.Areas, "cameras", result.Cameras, "sessions", result.Sessions, "users", len(result.Users))
+	// Passwords go to the terminal once, never to the logs
+	printDemoUsers(os.Stderr, result.Users)
+}
+
+func customErrorHandler(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	
+	if e, ok := err.(*fiber.Error); ok {
+		code = e.Code
+	}
+	
+	if code >= 500 {
+		logger.FromContext(c.UserContext()).Error("Unhandled error", "error", err)
+	}
+	
+	return response.Fail(c, code, err.Error())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/streamsync"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+)
+
+// runSyncFromStreamer handles `server sync-from-streamer [source]`. The
+// source is a config file or the API URL of a running streamer; without
+// one the streams of GO2RTC_API_URL are read.
+func runSyncFromStreamer(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("sync-from-streamer", flag.ContinueOnError)
+	kind := flags.String("kind", streamsync.KindGo2RTC, "streamer to read: go2rtc or mediamtx")
+	dryRun := flags.Bool("dry-run", false, "report what would be created without writing")
+	org := flags.Int("org", tenant.DefaultOrgID, "organization ID to create the cameras in")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server sync-from-streamer [-kind go2rtc|mediamtx] [-dry-run] [-org id] [go2rtc.yaml|mediamtx.yml|http://api]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 || (*kind != streamsync.KindGo2RTC && *kind != streamsync.KindMediaMTX) {
+		flags.Usage()
+		return 2
+	}
+
+	source := flags.Arg(0)
+	if source == "" {
+		if *kind != streamsync.KindGo2RTC {
+			fmt.Fprintln(os.Stderr, "A config file or API URL is required for mediamtx")
+			return 2
+		}
+		source = cfg.Go2RTC.APIURL
+	}
+
+	ctx := tenant.WithOrg(context.Background(), *org)
+	var streams []streamsync.Stream
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		streams, err = streamsync.Fetch(ctx, httpclient.Shared(), *kind, source)
+	} else {
+		var f *os.File
+		if f, err = os.Open(source); err == nil {
+			streams, err = streamsync.ParseConfig(*kind, f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read streams from %s: %v\n", source, err)
+		return 1
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	result, err := streamsync.Sync(ctx, db, streams, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create cameras: %v\n", err)
+		return 1
+	}
+
+	verb := "Created"
+	if *dryRun {
+		verb = "Would create"
+	}
+	for _, c := range result.Created {
+		fmt.Printf("%s %s (stream key %s)\n", verb, c.Name, c.StreamKey)
+	}
+	for _, c := range result.Conflicts {
+		fmt.Fprintf(os.Stderr, "Skipped %s: %s\n", c.Stream, c.Reason)
+	}
+	fmt.Printf("%d stream(s) read: %d new, %d already cameras, %d conflict(s)\n",
+		len(streams), len(result.Created), len(result.Unchanged), len(result.Conflicts))
+	if *dryRun {
+		fmt.Println("Dry run: nothing written")
+	}
+	if len(result.Conflicts) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/server"
+	"github.com/abcdefak87/cctv/internal/shutdown"
+	"github.com/abcdefak87/cctv/pkg/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// listen serves app on addr, terminating TLS itself when configured.
+// With TLS_REDIRECT_ADDR set, a plain-HTTP listener redirects to HTTPS
+// and answers ACME challenges.
+func listen(app *fiber.App, addr string, cfg config.TLSConfig, lifecycle *shutdown.Coordinator) error {
+	tlsConfig, wrap, err := server.TLS(cfg)
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		return app.Listen(addr)
+	}
+
+	if cfg.RedirectAddr != "" {
+		_, port, _ := net.SplitHostPort(addr)
+		startRedirect(cfg.RedirectAddr, wrap(server.RedirectHandler(port)), lifecycle)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return app.Listener(tls.NewListener(ln, tlsConfig))
+}
+
+func startRedirect(addr string, handler http.Handler, lifecycle *shutdown.Coordinator) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	lifecycle.OnShutdown("redirect server", srv.Shutdown)
+
+	go func() {
+		logger.Info("HTTPS redirect listening", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTPS redirect failed", "error", err)
+		}
+	}()
+}
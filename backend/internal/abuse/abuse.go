@@ -0,0 +1,214 @@
+// Package abuse bans client IPs that abuse the streams: fetching
+// playlists far faster than players do, or scraping every camera in
+// turn. Each instance counts what the clients it serves fetch within a
+// window; a client over a limit is banned for a while. Bans are in the
+// database, so every instance of a cluster refuses the client; each
+// reads them at most every refreshInterval.
+package abuse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// refreshInterval bounds how long an instance takes to follow a ban or
+// unban made on another
+const refreshInterval = 5 * time.Second
+
+// Limits are what one client IP may fetch within Window before it is
+// banned for Ban. A limit of 0 turns its check off.
+type Limits struct {
+	Window    time.Duration
+	Playlists int // playlist requests
+	Cameras   int // distinct cameras
+	Ban       time.Duration
+}
+
+// Ban is a client IP refused the streams until ExpiresAt
+type Ban struct {
+	ID        int64     `json:"id"`
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Guard counts stream requests per client IP and keeps the bans
+type Guard struct {
+	db     *sql.DB
+	limits func() Limits
+	now    func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*client
+	sweptAt time.Time
+	bans    map[string]time.Time // expiry of the active bans, by IP
+	readAt  time.Time
+}
+
+// client is what an IP fetched in its current window
+type client struct {
+	start     time.Time
+	playlists int
+	cameras   map[string]bool
+}
+
+// New returns a guard that reads its limits from limits on every
+// request, so they can change while the server runs
+func New(db *sql.DB, limits func() Limits) *Guard {
+	return &Guard{db: db, limits: limits, now: time.Now, clients: map[string]*client{}, bans: map[string]time.Time{}}
+}
+
+// Banned reports whether ip is banned and until when. When the bans
+// cannot be read the ones read last apply.
+func (g *Guard) Banned(ctx context.Context, ip string) (time.Time, bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var err error
+	if now := g.now(); g.readAt.IsZero() || now.Sub(g.readAt) >= refreshInterval {
+		var bans map[string]time.Time
+		if bans, err = g.read(ctx, now); err == nil {
+			g.bans, g.readAt = bans, now
+		}
+	}
+	until, ok := g.bans[ip]
+	return until, ok && until.After(g.now()), err
+}
+
+// Observe counts a request of ip for the stream streamKey, a playlist
+// or not, and bans ip once it is over a limit. It returns the ban, or
+// nil while ip is within its limits.
+func (g *Guard) Observe(ctx context.Context, ip, streamKey string, playlist bool) (*Ban, error) {
+	limits := g.limits()
+	if (limits.Playlists <= 0 && limits.Cameras <= 0) || limits.Window <= 0 {
+		return nil, nil
+	}
+
+	g.mu.Lock()
+	now := g.now()
+	if now.Sub(g.sweptAt) >= limits.Window {
+		for key, c := range g.clients {
+			if now.Sub(c.start) >= limits.Window {
+				delete(g.clients, key)
+			}
+		}
+		g.sweptAt = now
+	}
+	c := g.clients[ip]
+	if c == nil || now.Sub(c.start) >= limits.Window {
+		c = &client{start: now, cameras: map[string]bool{}}
+		g.clients[ip] = c
+	}
+	if playlist {
+		c.playlists++
+	}
+	if limits.Cameras > 0 && len(c.cameras) <= limits.Cameras {
+		c.cameras[streamKey] = true
+	}
+
+	reason := ""
+	switch {
+	case limits.Playlists > 0 && c.playlists > limits.Playlists:
+		reason = fmt.Sprintf("more than %d playlist requests in %s", limits.Playlists, limits.Window)
+	case limits.Cameras > 0 && len(c.cameras) > limits.Cameras:
+		reason = fmt.Sprintf("more than %d cameras in %s", limits.Cameras, limits.Window)
+	}
+	if reason == "" {
+		g.mu.Unlock()
+		return nil, nil
+	}
+	delete(g.clients, ip)
+	g.mu.Unlock()
+
+	ban, err := g.Ban(ctx, ip, reason, limits.Ban)
+	if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+// Ban refuses ip the streams for d
+func (g *Guard) Ban(ctx context.Context, ip, reason string, d time.Duration) (Ban, error) {
+	now := g.now().UTC()
+	ban := Ban{IP: ip, Reason: reason, ExpiresAt: now.Add(d), CreatedAt: now}
+	err := g.db.QueryRowContext(ctx, `
+		INSERT INTO ip_bans (ip, reason, expires_at, created_at) VALUES (?, ?, ?, ?) RETURNING id
+	`, ban.IP, ban.Reason, ban.ExpiresAt, ban.CreatedAt).Scan(&ban.ID)
+	if err != nil {
+		return Ban{}, err
+	}
+
+	g.mu.Lock()
+	if ban.ExpiresAt.After(g.bans[ip]) {
+		g.bans[ip] = ban.ExpiresAt
+	}
+	g.mu.Unlock()
+	return ban, nil
+}
+
+// Active lists the bans in force, newest first
+func (g *Guard) Active(ctx context.Context) ([]Ban, error) {
+	rows, err := g.db.QueryContext(ctx, `
+		SELECT id, ip, reason, expires_at, created_at FROM ip_bans
+		WHERE expires_at > ? ORDER BY created_at DESC, id DESC
+	`, g.now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []Ban{}
+	for rows.Next() {
+		var b Ban
+		if err := rows.Scan(&b.ID, &b.IP, &b.Reason, &b.ExpiresAt, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+// Lift ends the ban with id before it expires. It returns the ban, or
+// sql.ErrNoRows when there is none.
+func (g *Guard) Lift(ctx context.Context, id int64) (Ban, error) {
+	var b Ban
+	err := g.db.QueryRowContext(ctx, `
+		DELETE FROM ip_bans WHERE id = ? RETURNING id, ip, reason, expires_at, created_at
+	`, id).Scan(&b.ID, &b.IP, &b.Reason, &b.ExpiresAt, &b.CreatedAt)
+	if err != nil {
+		return Ban{}, err
+	}
+
+	// The IP may have other bans; read them again on the next check
+	g.mu.Lock()
+	delete(g.bans, b.IP)
+	g.readAt = time.Time{}
+	g.mu.Unlock()
+	return b, nil
+}
+
+// read returns the expiry of the bans in force, by IP
+func (g *Guard) read(ctx context.Context, now time.Time) (map[string]time.Time, error) {
+	rows, err := g.db.QueryContext(ctx, "SELECT ip, expires_at FROM ip_bans WHERE expires_at > ?", now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := map[string]time.Time{}
+	for rows.Next() {
+		var ip string
+		var expires time.Time
+		if err := rows.Scan(&ip, &expires); err != nil {
+			return nil, err
+		}
+		if expires.After(bans[ip]) {
+			bans[ip] = expires
+		}
+	}
+	return bans, rows.Err()
+}
@@ -0,0 +1,103 @@
+package abuse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestGuard(t *testing.T) {
+	db := dbtest.Open(t)
+
+	ctx := context.Background()
+	limits := Limits{Window: time.Minute, Playlists: 5, Cameras: 3, Ban: time.Hour}
+	g := New(db, func() Limits { return limits })
+	now := time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+
+	banned := func(ip string) bool {
+		t.Helper()
+		_, ok, err := g.Banned(ctx, ip)
+		if err != nil {
+			t.Fatalf("Banned failed: %v", err)
+		}
+		return ok
+	}
+
+	t.Run("Playlists", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			if ban, err := g.Observe(ctx, "10.0.0.1", "gate", true); ban != nil || err != nil {
+				t.Fatalf("Request %d: expected no ban, got %+v %v", i+1, ban, err)
+			}
+		}
+		// A new window starts over
+		now = now.Add(time.Minute)
+		for i := 0; i < 5; i++ {
+			g.Observe(ctx, "10.0.0.1", "gate", true)
+		}
+		ban, err := g.Observe(ctx, "10.0.0.1", "gate", true)
+		if err != nil || ban == nil || ban.Reason != "more than 5 playlist requests in 1m0s" || !ban.ExpiresAt.Equal(now.Add(time.Hour)) {
+			t.Fatalf("Expected a ban for an hour, got %+v %v", ban, err)
+		}
+		if !banned("10.0.0.1") || banned("10.0.0.2") {
+			t.Error("Expected only the client over the limit banned")
+		}
+	})
+
+	t.Run("Cameras", func(t *testing.T) {
+		var ban *Ban
+		for i := 0; i < 4; i++ {
+			// Segments and other requests count cameras but not playlists
+			ban, _ = g.Observe(ctx, "10.0.0.3", "cam-"+strconv.Itoa(i), false)
+		}
+		if ban == nil || ban.Reason != "more than 3 cameras in 1m0s" {
+			t.Fatalf("Expected a ban for scraping cameras, got %+v", ban)
+		}
+	})
+
+	t.Run("Other instances", func(t *testing.T) {
+		other := New(db, func() Limits { return limits })
+		other.now = g.now
+		if _, ok, _ := other.Banned(ctx, "10.0.0.3"); !ok {
+			t.Error("Expected the ban read from the database")
+		}
+	})
+
+	t.Run("Lift and expire", func(t *testing.T) {
+		bans, err := g.Active(ctx)
+		if err != nil || len(bans) != 2 || bans[0].IP != "10.0.0.3" {
+			t.Fatalf("Expected the two bans, newest first, got %+v %v", bans, err)
+		}
+		if _, err := g.Lift(ctx, bans[0].ID); err != nil {
+			t.Fatalf("Lift failed: %v", err)
+		}
+		if banned("10.0.0.3") {
+			t.Error("Expected the lifted ban to end at once")
+		}
+		if _, err := g.Lift(ctx, bans[0].ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows for a lifted ban, got %v", err)
+		}
+
+		now = now.Add(time.Hour + refreshInterval)
+		if banned("10.0.0.1") {
+			t.Error("Expected the ban over after an hour")
+		}
+		if bans, _ := g.Active(ctx); len(bans) != 0 {
+			t.Errorf("Expected no active bans, got %+v", bans)
+		}
+	})
+
+	t.Run("Off", func(t *testing.T) {
+		limits = Limits{}
+		for i := 0; i < 10; i++ {
+			if ban, _ := g.Observe(ctx, "10.0.0.4", "cam-"+strconv.Itoa(i), true); ban != nil {
+				t.Fatal("Expected no ban with the checks off")
+			}
+		}
+	})
+}
@@ -0,0 +1,54 @@
+// Package accesslog keeps a record of HTTP requests for abuse
+// investigations, in the access_logs table or a rotated JSON lines file.
+// The console access log (middleware.AccessLog) is separate and always
+// on; these sinks are opt-in with ACCESS_LOG_SINK.
+package accesslog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+)
+
+// Sinks
+const (
+	SinkOff      = "off"
+	SinkDatabase = "database"
+	SinkFile     = "file"
+)
+
+// Entry is one request
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	LatencyMs int64     `json:"latency_ms"`
+	UserID    *int      `json:"user_id,omitempty"`
+	IP        string    `json:"ip"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// Sink stores entries. Write must not block the request; Close flushes
+// what is buffered.
+type Sink interface {
+	Write(e Entry)
+	Close(ctx context.Context) error
+}
+
+// New returns the sink chosen by cfg.Sink, or nil when it is off
+func New(cfg config.AccessLogConfig, db *sql.DB) (Sink, error) {
+	switch strings.ToLower(cfg.Sink) {
+	case "", SinkOff:
+		return nil, nil
+	case SinkDatabase:
+		return NewDBSink(db, time.Duration(cfg.RetentionDays)*24*time.Hour), nil
+	case SinkFile:
+		return NewFileSink(cfg.Path, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+	}
+	return nil, fmt.Errorf("unknown access log sink %q", cfg.Sink)
+}
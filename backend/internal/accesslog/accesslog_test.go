@@ -0,0 +1,124 @@
+package accesslog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestNew(t *testing.T) {
+	if sink, err := New(config.AccessLogConfig{Sink: "off"}, nil); sink != nil || err != nil {
+		t.Errorf("Expected no sink when off, got %v (%v)", sink, err)
+	}
+	if _, err := New(config.AccessLogConfig{Sink: "syslog"}, nil); err == nil {
+		t.Error("Expected an error for an unknown sink")
+	}
+}
+
+func TestDBSink(t *testing.T) {
+	t.Run("Writes queued entries on close", func(t *testing.T) {
+		db := dbtest.Open(t)
+		sink := NewDBSink(db, 0)
+
+		userID := 7
+		sink.Write(Entry{Time: time.Now(), Method: "GET", Path: "/api/stream/a", Status: 200, LatencyMs: 3, IP: "10.0.0.1"})
+		sink.Write(Entry{Time: time.Now(), Method: "POST", Path: "/api/cameras", Status: 201, UserID: &userID, IP: "10.0.0.2", RequestID: "req-1"})
+
+		if err := sink.Close(context.Background()); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM access_logs`).Scan(&count)
+		if count != 2 {
+			t.Fatalf("Expected 2 rows, got %d", count)
+		}
+
+		var gotUser *int
+		var requestID string
+		db.QueryRow(`SELECT user_id, request_id FROM access_logs WHERE method = 'POST'`).Scan(&gotUser, &requestID)
+		if gotUser == nil || *gotUser != 7 || requestID != "req-1" {
+			t.Errorf("Expected user 7 and req-1, got %v and '%s'", gotUser, requestID)
+		}
+	})
+
+	t.Run("Prunes rows past the retention", func(t *testing.T) {
+		db := dbtest.Open(t)
+		old := time.Now().UTC().Add(-48 * time.Hour)
+		db.Exec(`INSERT INTO access_logs (method, path, status, created_at) VALUES ('GET', '/old', 200, ?)`, old)
+
+		sink := NewDBSink(db, 24*time.Hour)
+		sink.Write(Entry{Time: time.Now(), Method: "GET", Path: "/new", Status: 200})
+		sink.Close(context.Background())
+
+		var paths []string
+		rows, _ := db.Query(`SELECT path FROM access_logs`)
+		for rows.Next() {
+			var p string
+			rows.Scan(&p)
+			paths = append(paths, p)
+		}
+		rows.Close()
+
+		if len(paths) != 1 || paths[0] != "/new" {
+			t.Errorf("Expected only /new to remain, got %v", paths)
+		}
+	})
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+	entry := Entry{Time: time.Now(), Method: "GET", Path: "/api/stream/hls/key/index.m3u8", Status: 200, IP: "10.0.0.1"}
+	line, _ := json.Marshal(entry)
+
+	// Room for two lines per file
+	sink, err := NewFileSink(path, int64(len(line)+1)*2, 2)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	for i := 0; i < 7; i++ {
+		sink.Write(entry)
+	}
+	sink.Close(context.Background())
+
+	countLines := func(p string) int {
+		f, err := os.Open(p)
+		if err != nil {
+			return -1
+		}
+		defer f.Close()
+
+		n := 0
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e Entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Path != entry.Path {
+				t.Errorf("Expected a JSON entry in %s, got %q", p, scanner.Text())
+			}
+			n++
+		}
+		return n
+	}
+
+	// 7 writes: .2 and .1 hold two each, the current file the last one
+	// and the oldest two were deleted
+	if n := countLines(path); n != 1 {
+		t.Errorf("Expected 1 line in the current file, got %d", n)
+	}
+	if n := countLines(path + ".1"); n != 2 {
+		t.Errorf("Expected 2 lines in .1, got %d", n)
+	}
+	if n := countLines(path + ".2"); n != 2 {
+		t.Errorf("Expected 2 lines in .2, got %d", n)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected no third backup, got %v", err)
+	}
+}
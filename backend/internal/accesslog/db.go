@@ -0,0 +1,159 @@
+package accesslog
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+const (
+	// queueSize entries may wait for the writer before new ones are
+	// dropped; a request never waits on the database
+	queueSize = 4096
+
+	// batchSize and flushInterval bound how long an entry waits to be
+	// written
+	batchSize     = 200
+	flushInterval = time.Second
+
+	pruneInterval = time.Hour
+	writeTimeout  = 10 * time.Second
+)
+
+// DBSink writes entries to access_logs in batches from one goroutine and
+// deletes rows older than the retention
+type DBSink struct {
+	db        *sql.DB
+	retention time.Duration
+
+	queue   chan Entry
+	done    chan struct{}
+	close   sync.Once
+	dropped atomic.Int64
+}
+
+// NewDBSink starts the writer. A retention of zero keeps rows forever.
+func NewDBSink(db *sql.DB, retention time.Duration) *DBSink {
+	s := &DBSink{
+		db:        db,
+		retention: retention,
+		queue:     make(chan Entry, queueSize),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues e. It must not be called after Close.
+func (s *DBSink) Write(e Entry) {
+	select {
+	case s.queue <- e:
+	default:
+		// Reported by the writer, so a flood does not flood the log too
+		s.dropped.Add(1)
+	}
+}
+
+// Close writes the queued entries and stops the writer
+func (s *DBSink) Close(ctx context.Context) error {
+	s.close.Do(func() { close(s.queue) })
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *DBSink) run() {
+	defer close(s.done)
+
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+
+	s.prune()
+
+	batch := make([]Entry, 0, batchSize)
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				s.insert(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				s.insert(batch)
+				batch = batch[:0]
+			}
+		case <-flush.C:
+			s.insert(batch)
+			batch = batch[:0]
+			if n := s.dropped.Swap(0); n > 0 {
+				logger.Warn("Access log queue full, entries dropped", "count", n)
+			}
+		case <-prune.C:
+			s.prune()
+		}
+	}
+}
+
+func (s *DBSink) insert(batch []Entry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	err := func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		stmt, err := tx.PrepareContext(ctx, `
+			INSERT INTO access_logs (method, path, status, latency_ms, user_id, ip, request_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, e := range batch {
+			if _, err := stmt.ExecContext(ctx, e.Method, e.Path, e.Status, e.LatencyMs, e.UserID, e.IP, e.RequestID, e.Time.UTC()); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		logger.Error("Failed to write access log", "entries", len(batch), "error", err)
+	}
+}
+
+func (s *DBSink) prune() {
+	if s.retention <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM access_logs WHERE created_at < ?`, time.Now().UTC().Add(-s.retention))
+	if err != nil {
+		logger.Error("Failed to prune access log", "error", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		logger.Info("Pruned access log", "rows", n)
+	}
+}
@@ -0,0 +1,772 @@
+// Package alerting tells operators when cameras go offline without a
+// message for every blip. The Alerter polls camera_health and follows,
+// for each camera that is offline, the escalation steps of its policy:
+// by default Telegram, ntfy and Gotify at once, email after 15 minutes
+// and SMS and WhatsApp after an hour. Cameras that come back are
+// announced on the channels that were told of the outage.
+//
+// A dedup window keeps a channel from being told of more than one
+// outage of a camera per window; a later outage that lasts past the
+// window is sent then. A camera that changes status FlapChanges times
+// within the flap window is flapping: one notice goes out, then nothing
+// until it has held one status for a whole window.
+//
+// Policies are set per camera, per area (covering its sub-areas) or for
+// the whole organization; the most specific one applies, and Default
+// when there is none.
+package alerting
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/reports"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Camera statuses as the alerter sees them; a camera is online unless
+// its last health check found it offline
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+const (
+	DefaultDedupSeconds      = 300
+	DefaultFlapChanges       = 4
+	DefaultFlapWindowSeconds = 900
+
+	defaultInterval = 30 * time.Second
+
+	// checkTimeout bounds the queries of one check
+	checkTimeout = 10 * time.Second
+
+	// sendTimeout bounds one notification
+	sendTimeout = 15 * time.Second
+)
+
+// Step sends an outage on Channel once the camera has been offline
+// AfterMinutes
+type Step struct {
+	AfterMinutes int    `json:"after_minutes"`
+	Channel      string `json:"channel"`
+	To           string `json:"to,omitempty"` // empty uses the channel's default recipient
+}
+
+// Policy is how alerts of the cameras it covers are sent. With neither
+// CameraID nor AreaID it is the organization's default. A muted policy
+// sends nothing for its cameras, such as an area under maintenance.
+type Policy struct {
+	ID                int64     `json:"id"`
+	CameraID          *int      `json:"camera_id"`
+	AreaID            *int      `json:"area_id"`
+	DedupSeconds      int       `json:"dedup_seconds"`
+	FlapChanges       int       `json:"flap_changes"` // 0 turns flap detection off
+	FlapWindowSeconds int       `json:"flap_window_seconds"`
+	Steps             []Step    `json:"steps"`
+	Muted             bool      `json:"muted"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// DefaultSteps escalate when no policy sets steps
+func DefaultSteps() []Step {
+	return []Step{
+		{AfterMinutes: 0, Channel: Telegram},
+		{AfterMinutes: 0, Channel: Ntfy},
+		{AfterMinutes: 0, Channel: Gotify},
+		{AfterMinutes: 15, Channel: Email},
+		{AfterMinutes: 60, Channel: SMS},
+		{AfterMinutes: 60, Channel: WhatsApp},
+	}
+}
+
+// Default is the policy of cameras no policy covers
+func Default() Policy {
+	return Policy{
+		DedupSeconds:      DefaultDedupSeconds,
+		FlapChanges:       DefaultFlapChanges,
+		FlapWindowSeconds: DefaultFlapWindowSeconds,
+		Steps:             DefaultSteps(),
+	}
+}
+
+func (p Policy) dedup() time.Duration {
+	return time.Duration(p.DedupSeconds) * time.Second
+}
+
+func (p Policy) flapWindow() time.Duration {
+	return time.Duration(p.FlapWindowSeconds) * time.Second
+}
+
+// State is what the alerter last saw of a camera
+type State struct {
+	CameraID    int                  `json:"camera_id"`
+	Status      string               `json:"status"`
+	Since       time.Time            `json:"since"`
+	Changes     int                  `json:"changes"` // status changes since WindowStart
+	WindowStart time.Time            `json:"window_start"`
+	Flapping    bool                 `json:"flapping"`
+	StepsSent   int                  `json:"steps_sent"`
+	Notified    map[string]time.Time `json:"notified"` // last outage sent, by channel
+}
+
+// Policies returns the policies of an organization
+func Policies(ctx context.Context, db *sql.DB, orgID int) ([]Policy, error) {
+	list, _, err := loadPolicies(ctx, db, "WHERE organization_id = ?", orgID)
+	return list, err
+}
+
+// loadPolicies returns the policies matching where and the organization
+// of each
+func loadPolicies(ctx context.Context, db *sql.DB, where string, args ...interface{}) ([]Policy, []int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, organization_id, camera_id, area_id, dedup_seconds, flap_changes, flap_window_seconds,
+		       steps, muted, created_at, updated_at
+		FROM alert_policies `+where+`
+		ORDER BY id ASC
+	`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	list, orgs := []Policy{}, []int{}
+	for rows.Next() {
+		var p Policy
+		var orgID int
+		var cameraID, areaID sql.NullInt64
+		var steps string
+		if err := rows.Scan(&p.ID, &orgID, &cameraID, &areaID, &p.DedupSeconds, &p.FlapChanges,
+			&p.FlapWindowSeconds, &steps, &p.Muted, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, nil, err
+		}
+		if cameraID.Valid {
+			id := int(cameraID.Int64)
+			p.CameraID = &id
+		}
+		if areaID.Valid {
+			id := int(areaID.Int64)
+			p.AreaID = &id
+		}
+		if err := json.Unmarshal([]byte(steps), &p.Steps); err != nil {
+			return nil, nil, fmt.Errorf("policy %d: invalid steps: %w", p.ID, err)
+		}
+		list = append(list, p)
+		orgs = append(orgs, orgID)
+	}
+	return list, orgs, rows.Err()
+}
+
+// policySet holds the policies of one organization
+type policySet struct {
+	cameras map[int]Policy
+	areas   map[int]Policy
+	org     *Policy
+}
+
+func (s *policySet) add(p Policy) {
+	// The oldest policy wins when two cover the same thing
+	switch {
+	case p.CameraID != nil:
+		if _, ok := s.cameras[*p.CameraID]; !ok {
+			s.cameras[*p.CameraID] = p
+		}
+	case p.AreaID != nil:
+		if _, ok := s.areas[*p.AreaID]; !ok {
+			s.areas[*p.AreaID] = p
+		}
+	case s.org == nil:
+		s.org = &p
+	}
+}
+
+// resolve returns the policy of a camera: its own, that of its area or
+// the nearest parent area with one, the organization's, or Default.
+// parents maps each area to its parent.
+func (s *policySet) resolve(cameraID int, areaID *int, parents map[int]*int) Policy {
+	if s == nil {
+		return Default()
+	}
+	if p, ok := s.cameras[cameraID]; ok {
+		return p
+	}
+	// Bounded by the number of areas in case parents form a cycle
+	for i := 0; areaID != nil && i <= len(parents); i++ {
+		if p, ok := s.areas[*areaID]; ok {
+			return p
+		}
+		areaID = parents[*areaID]
+	}
+	if s.org != nil {
+		return *s.org
+	}
+	return Default()
+}
+
+// Alerter checks camera health and sends alerts. Run it on one instance
+// only; see cluster.Node.Lead.
+type Alerter struct {
+	db       *sql.DB
+	channels map[string]Channel
+	interval time.Duration
+	now      func() time.Time
+}
+
+// New returns an alerter sending on channels, by name, that checks
+// every interval; 0 uses the default
+func New(db *sql.DB, channels map[string]Channel, interval time.Duration) *Alerter {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Alerter{db: db, channels: channels, interval: interval, now: time.Now}
+}
+
+// Run checks every interval until ctx is cancelled. Start it with
+// shutdown.Coordinator.Go.
+func (a *Alerter) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Check(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to check camera alerts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// camera is an enabled camera and its health
+type camera struct {
+	id       int
+	name     string
+	orgID    int
+	areaID   *int
+	area     string // name of the area, empty without one
+	status   string
+	errorMsg string
+}
+
+// Check looks at every enabled camera once, sending what is due
+func (a *Alerter) Check(ctx context.Context) error {
+	now := a.now().UTC()
+	cameras, policies, parents, states, err := a.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Alerts go out in the default wording when templates cannot be read
+	templates, err := a.allTemplates(ctx)
+	if err != nil {
+		logger.Warn("Failed to load notification templates", "error", err)
+	}
+
+	for _, cam := range cameras {
+		st, seen := states[cam.id]
+		p := policies[cam.orgID].resolve(cam.id, cam.areaID, parents)
+		if !a.observe(ctx, &st, seen, cam, p, templates[cam.orgID], now) {
+			continue
+		}
+		if err := a.save(ctx, st, now); err != nil {
+			logger.Error("Failed to save camera alert state", "camera_id", cam.id, "error", err)
+		}
+	}
+	return nil
+}
+
+// load reads the cameras, the policies by organization, the area tree
+// and the alert states by camera
+func (a *Alerter) load(ctx context.Context) ([]camera, map[int]*policySet, map[int]*int, map[int]State, error) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT c.id, c.name, c.organization_id, c.area_id, COALESCE(a.name, ''), COALESCE(h.status, ''),
+		       COALESCE(h.error_message, '')
+		FROM cameras c
+		LEFT JOIN areas a ON a.id = c.area_id
+		LEFT JOIN camera_health h ON h.camera_id = c.id
+		WHERE c.enabled = TRUE
+		ORDER BY c.id ASC
+	`)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	defer rows.Close()
+	var cameras []camera
+	for rows.Next() {
+		var cam camera
+		var areaID sql.NullInt64
+		if err := rows.Scan(&cam.id, &cam.name, &cam.orgID, &areaID, &cam.area, &cam.status, &cam.errorMsg); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if areaID.Valid {
+			id := int(areaID.Int64)
+			cam.areaID = &id
+		}
+		cameras = append(cameras, cam)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	rows.Close()
+
+	list, orgs, err := loadPolicies(ctx, a.db, "")
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	policies := map[int]*policySet{}
+	for i, p := range list {
+		set := policies[orgs[i]]
+		if set == nil {
+			set = &policySet{cameras: map[int]Policy{}, areas: map[int]Policy{}}
+			policies[orgs[i]] = set
+		}
+		set.add(p)
+	}
+
+	parents, err := a.areaParents(ctx)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	states, err := a.states(ctx)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return cameras, policies, parents, states, nil
+}
+
+func (a *Alerter) areaParents(ctx context.Context) (map[int]*int, error) {
+	rows, err := a.db.QueryContext(ctx, `SELECT id, parent_id FROM areas`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	parents := map[int]*int{}
+	for rows.Next() {
+		var id int
+		var parentID sql.NullInt64
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			parent := int(parentID.Int64)
+			parents[id] = &parent
+		} else {
+			parents[id] = nil
+		}
+	}
+	return parents, rows.Err()
+}
+
+func (a *Alerter) states(ctx context.Context) (map[int]State, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT camera_id, status, since, changes, window_start, flapping, steps_sent, notified FROM camera_alerts
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	states := map[int]State{}
+	for rows.Next() {
+		var st State
+		var notified string
+		if err := rows.Scan(&st.CameraID, &st.Status, &st.Since, &st.Changes, &st.WindowStart,
+			&st.Flapping, &st.StepsSent, &notified); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(notified), &st.Notified); err != nil || st.Notified == nil {
+			st.Notified = map[string]time.Time{}
+		}
+		states[st.CameraID] = st
+	}
+	return states, rows.Err()
+}
+
+func (a *Alerter) save(ctx context.Context, st State, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	notified, err := json.Marshal(st.Notified)
+	if err != nil {
+		return err
+	}
+	// A camera deleted since the check is skipped rather than failing on
+	// the foreign key
+	_, err = a.db.ExecContext(ctx, `
+		INSERT INTO camera_alerts (camera_id, status, since, changes, window_start, flapping, steps_sent, notified, updated_at)
+		SELECT id, ?, ?, ?, ?, ?, ?, ?, ? FROM cameras WHERE id = ?
+		ON CONFLICT (camera_id) DO UPDATE SET
+			status = excluded.status, since = excluded.since, changes = excluded.changes,
+			window_start = excluded.window_start, flapping = excluded.flapping,
+			steps_sent = excluded.steps_sent, notified = excluded.notified, updated_at = excluded.updated_at
+	`, st.Status, st.Since, st.Changes, st.WindowStart, st.Flapping, st.StepsSent, string(notified), now, st.CameraID)
+	return err
+}
+
+// observe moves st on to the camera's current health, sending what the
+// change or the time passed calls for. It reports whether st changed.
+func (a *Alerter) observe(ctx context.Context, st *State, seen bool, cam camera, p Policy, ts Templates, now time.Time) bool {
+	status := Online
+	if cam.status == Offline {
+		status = Offline
+	}
+
+	changed := false
+	switch {
+	case !seen:
+		// A camera first seen offline is escalated like any outage
+		*st = State{CameraID: cam.id, Status: status, Since: now, WindowStart: now, Notified: map[string]time.Time{}}
+		changed = true
+
+	case st.Status != status:
+		if now.Sub(st.WindowStart) >= p.flapWindow() {
+			st.Changes, st.WindowStart = 0, now
+		}
+		st.Changes++
+		downSince := st.Since
+		st.Status, st.Since, st.StepsSent = status, now, 0
+		changed = true
+
+		switch {
+		case st.Flapping:
+		case p.FlapChanges > 0 && st.Changes >= p.FlapChanges:
+			st.Flapping = true
+			a.publish(events.CameraFlapping, cam, map[string]interface{}{"changes": st.Changes})
+			vars := cam.vars(status, 0)
+			vars["changes"], vars["window"] = strconv.Itoa(st.Changes), formatDuration(p.flapWindow())
+			a.notifyFirst(ctx, p, ts, AlertFlapping, vars)
+		case status == Offline:
+			a.publish(events.CameraOffline, cam, nil)
+		default:
+			a.publish(events.CameraOnline, cam, nil)
+			a.recovered(ctx, st, p, ts, cam, downSince, now)
+		}
+
+	case st.Flapping && now.Sub(st.Since) >= p.flapWindow():
+		st.Flapping, st.Changes, st.WindowStart = false, 0, now
+		changed = true
+		a.notifyFirst(ctx, p, ts, AlertStable, cam.vars(st.Status, now.Sub(st.Since)))
+	}
+
+	if st.Status == Offline && !st.Flapping && a.escalate(ctx, st, p, ts, cam, now) {
+		changed = true
+	}
+	return changed
+}
+
+// escalate sends the steps that are due for an offline camera. A step
+// on a channel told of an outage within the dedup window waits, as do
+// the steps after it; one whose channel is not configured is skipped.
+func (a *Alerter) escalate(ctx context.Context, st *State, p Policy, ts Templates, cam camera, now time.Time) bool {
+	if p.Muted {
+		return false
+	}
+	changed := false
+	offline := now.Sub(st.Since)
+	for st.StepsSent < len(p.Steps) {
+		step := p.Steps[st.StepsSent]
+		if offline < time.Duration(step.AfterMinutes)*time.Minute {
+			break
+		}
+		ch, ok := a.channels[step.Channel]
+		if !ok {
+			st.StepsSent++
+			changed = true
+			continue
+		}
+		if last, ok := st.Notified[step.Channel]; ok && now.Sub(last) < p.dedup() {
+			break
+		}
+
+		m := ts.Render(AlertOffline, step.Channel, cam.vars(Offline, offline))
+		if err := a.send(ctx, ch, step, m); err != nil {
+			// Retried on the next check
+			logger.Warn("Failed to send camera alert", "camera_id", cam.id, "channel", step.Channel, "error", err)
+			break
+		}
+		st.Notified[step.Channel] = now
+		st.StepsSent++
+		changed = true
+	}
+	return changed
+}
+
+// recovered tells the channels that were sent the outage starting at
+// downSince that the camera is back
+func (a *Alerter) recovered(ctx context.Context, st *State, p Policy, ts Templates, cam camera, downSince, now time.Time) {
+	if p.Muted {
+		return
+	}
+	vars := cam.vars(Online, now.Sub(downSince))
+	told := map[string]bool{}
+	for _, step := range p.Steps {
+		last, ok := st.Notified[step.Channel]
+		ch, configured := a.channels[step.Channel]
+		if !ok || !configured || last.Before(downSince) || told[step.Channel] {
+			continue
+		}
+		told[step.Channel] = true
+		if err := a.send(ctx, ch, step, ts.Render(AlertOnline, step.Channel, vars)); err != nil {
+			logger.Warn("Failed to send camera alert", "camera_id", cam.id, "channel", step.Channel, "error", err)
+		}
+	}
+}
+
+// notifyFirst sends an alert of alertType on the first configured
+// channel of the policy
+func (a *Alerter) notifyFirst(ctx context.Context, p Policy, ts Templates, alertType string, vars map[string]string) {
+	if p.Muted {
+		return
+	}
+	for _, step := range p.Steps {
+		if ch, ok := a.channels[step.Channel]; ok {
+			if err := a.send(ctx, ch, step, ts.Render(alertType, step.Channel, vars)); err != nil {
+				logger.Warn("Failed to send camera alert", "channel", step.Channel, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// OnBan tells operators of a client IP banned from the streams, on the
+// first configured channel of the default steps. Subscribe it to
+// events.StreamIPBanned.
+func (a *Alerter) OnBan(e events.Event) {
+	reason, _ := e.Data["reason"].(string)
+	vars := map[string]string{"ip": e.IP, "reason": reason, "duration": "an unknown time"}
+	if until, ok := e.Data["expires_at"].(time.Time); ok {
+		vars["duration"] = formatDuration(until.Sub(a.now()))
+	}
+	a.notifyDefault(AlertBanned, vars)
+}
+
+// OnDatabaseGrown tells operators that the database or its WAL went
+// over its alert size, on the first configured channel of the default
+// steps. Subscribe it to events.DatabaseGrown.
+func (a *Alerter) OnDatabaseGrown(e events.Event) {
+	file, _ := e.Data["file"].(string)
+	size, _ := e.Data["bytes"].(int64)
+	limit, _ := e.Data["limit"].(int64)
+	alertType := AlertDatabase
+	if file == "wal" {
+		alertType = AlertWAL
+	}
+	a.notifyDefault(alertType, map[string]string{"size": formatBytes(size), "limit": formatBytes(limit)})
+}
+
+// OnStreamStartSlow tells operators that a camera's streams take long
+// to start, often the first sign of a failing uplink, on the first
+// configured channel of the default steps. Subscribe it to
+// events.StreamStartSlow.
+func (a *Alerter) OnStreamStartSlow(e events.Event) {
+	name, _ := e.Data["camera"].(string)
+	p95, _ := e.Data["p95_ms"].(int64)
+	threshold, _ := e.Data["threshold_ms"].(int64)
+	samples, _ := e.Data["samples"].(int)
+	a.notifyDefault(AlertSlowStart, map[string]string{
+		"camera":    name,
+		"p95":       fmt.Sprintf("%.1fs", float64(p95)/1000),
+		"threshold": fmt.Sprintf("%.1fs", float64(threshold)/1000),
+		"samples":   strconv.Itoa(samples),
+	})
+}
+
+// OnStreamTraffic tells operators that a camera's streams served far
+// more than usual in an hour, or nothing, on the first configured
+// channel of the default steps. Subscribe it to
+// events.StreamTrafficSpike and events.StreamTrafficDropped.
+func (a *Alerter) OnStreamTraffic(e events.Event) {
+	name, _ := e.Data["camera"].(string)
+	hour, _ := e.Data["hour"].(time.Time)
+	bytes, _ := e.Data["bytes"].(int64)
+	baseline, _ := e.Data["baseline_bytes"].(int64)
+	alertType := AlertSpike
+	if e.Type == events.StreamTrafficDropped {
+		alertType = AlertDrop
+	}
+	a.notifyDefault(alertType, map[string]string{
+		"camera":   name,
+		"hour":     hour.UTC().Format("2006-01-02 15:04 UTC"),
+		"traffic":  formatBytes(bytes),
+		"baseline": formatBytes(baseline),
+	})
+}
+
+// OnInfraAlert tells operators of an infrastructure alert from
+// Alertmanager that started firing or is resolved, on the first
+// configured channel of the default steps. Subscribe it to
+// events.InfraAlertFiring and events.InfraAlertResolved.
+func (a *Alerter) OnInfraAlert(e events.Event) {
+	vars := map[string]string{}
+	for _, name := range []string{"alert", "severity", "instance", "summary"} {
+		vars[name], _ = e.Data[name].(string)
+	}
+	alertType := AlertInfra
+	if e.Type == events.InfraAlertResolved {
+		alertType = AlertInfraOK
+	}
+	a.notifyDefault(alertType, vars)
+}
+
+// maxReportCameras is how many offline cameras a sent report names
+const maxReportCameras = 10
+
+// OnDailyReport sends the nightly summary report on each of channels
+// that is configured, worded by the default organization's templates.
+// Subscribe it to events.ReportDaily.
+func (a *Alerter) OnDailyReport(channels []string) events.Handler {
+	return func(e events.Event) {
+		r, ok := e.Data["report"].(reports.Report)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		ts, err := LoadTemplates(ctx, a.db, tenant.DefaultOrgID)
+		cancel()
+		if err != nil {
+			logger.Warn("Failed to load notification templates", "error", err)
+		}
+		vars := reportVars(r)
+		for _, name := range channels {
+			ch, ok := a.channels[name]
+			if !ok {
+				continue
+			}
+			if err := a.send(context.Background(), ch, Step{Channel: name}, ts.Render(AlertReport, name, vars)); err != nil {
+				logger.Warn("Failed to send the daily report", "channel", name, "error", err)
+			}
+		}
+	}
+}
+
+// reportVars are the template variables of a daily report
+func reportVars(r reports.Report) map[string]string {
+	var offline []string
+	for i, cam := range r.Offline {
+		if i == maxReportCameras {
+			offline = append(offline, fmt.Sprintf("and %d more", len(r.Offline)-i))
+			break
+		}
+		line := cam.Camera + ": " + formatDuration(time.Duration(cam.Downtime)*time.Second)
+		if cam.Ongoing {
+			line += ", still offline"
+		}
+		offline = append(offline, line)
+	}
+	top := make([]string, 0, len(r.TopCameras))
+	for _, cam := range r.TopCameras {
+		top = append(top, fmt.Sprintf("%s (%d)", cam.Camera, cam.Viewers))
+	}
+	if len(top) == 0 {
+		top = append(top, "none")
+	}
+	var disks []string
+	for _, d := range r.Storage.Disks {
+		if d.Error == "" {
+			disks = append(disks, fmt.Sprintf("%s disk: %.0f%% used, %s free", d.Name, d.UsedPercent, formatBytes(int64(d.FreeBytes))))
+		}
+	}
+	return map[string]string{
+		"date":            r.Date,
+		"cameras":         strconv.Itoa(r.Cameras.Total),
+		"offline":         strconv.Itoa(r.Cameras.Offline),
+		"offline_cameras": strings.Join(offline, "\n"),
+		"sessions":        strconv.Itoa(r.Viewers.Sessions),
+		"viewers":         strconv.Itoa(r.Viewers.Unique),
+		"top_cameras":     strings.Join(top, ", "),
+		"feedback":        fmt.Sprintf("%d (%d unread)", r.Feedback.New, r.Feedback.Unread),
+		"recorded":        fmt.Sprintf("%d recordings, %s", r.Storage.Recordings, formatBytes(r.Storage.RecordedBytes)),
+		"storage":         strings.Join(disks, "\n"),
+	}
+}
+
+// notifyDefault sends an alert that concerns the whole server on the
+// first configured channel of the default steps, worded by the default
+// organization's templates
+func (a *Alerter) notifyDefault(alertType string, vars map[string]string) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	ts, err := LoadTemplates(ctx, a.db, tenant.DefaultOrgID)
+	cancel()
+	if err != nil {
+		logger.Warn("Failed to load notification templates", "error", err)
+	}
+	a.notifyFirst(context.Background(), Default(), ts, alertType, vars)
+}
+
+// allTemplates returns the notification templates of every
+// organization that has any
+func (a *Alerter) allTemplates(ctx context.Context) (map[int]Templates, error) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	return allTemplates(ctx, a.db)
+}
+
+func (a *Alerter) send(ctx context.Context, ch Channel, step Step, m Message) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	to := step.To
+	if to == "" {
+		to = ch.To
+	}
+	return ch.Sender.Send(ctx, to, m)
+}
+
+// vars are the template variables of an alert about cam, which has
+// been status for d
+func (cam camera) vars(status string, d time.Duration) map[string]string {
+	return map[string]string{
+		"camera":    cam.name,
+		"camera_id": strconv.Itoa(cam.id),
+		"area":      cam.area,
+		"status":    status,
+		"duration":  formatDuration(d),
+		"error":     cam.errorMsg,
+	}
+}
+
+func (a *Alerter) publish(eventType string, cam camera, data map[string]interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["camera_id"] = cam.id
+	data["camera"] = cam.name
+	events.Publish(events.Event{Type: eventType, Time: a.now().UTC(), Resource: "camera", Data: data})
+}
+
+// formatDuration is d in hours and minutes, such as 1h5m or 15m
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	default:
+		return fmt.Sprintf("%dh%dm", h, m)
+	}
+}
+
+// formatBytes is n in MB, or GB from 1 GB on, such as 512 MB or 2.5 GB
+func formatBytes(n int64) string {
+	const mb = 1 << 20
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	}
+	return fmt.Sprintf("%d MB", (n+mb/2)/mb)
+}
@@ -0,0 +1,447 @@
+package alerting
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/reports"
+	"github.com/abcdefak87/cctv/internal/sysmon"
+)
+
+// openSeededDB is dbtest.Open with the areas and cameras the tests alert on
+func openSeededDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := dbtest.Open(t)
+	for _, q := range []string{
+		`INSERT INTO areas (id, name) VALUES (1, 'City')`,
+		`INSERT INTO areas (id, name, parent_id) VALUES (2, 'Market', 1)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, area_id) VALUES (1, 'Gate', 'rtsp://gate', 'gate', NULL)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, area_id) VALUES (2, 'Stalls', 'rtsp://stalls', 'stalls', 2)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+	return db
+}
+
+// sent is a message as a fake channel received it
+type sent struct {
+	channel, to, text string
+}
+
+type recorder struct {
+	mu   sync.Mutex
+	sent []sent
+}
+
+type fakeSender struct {
+	r       *recorder
+	channel string
+}
+
+func (f fakeSender) Send(ctx context.Context, to string, m Message) error {
+	f.r.mu.Lock()
+	defer f.r.mu.Unlock()
+	f.r.sent = append(f.r.sent, sent{f.channel, to, m.Text})
+	return nil
+}
+
+// take returns the messages sent since the last call
+func (r *recorder) take() []sent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := r.sent
+	r.sent = nil
+	return list
+}
+
+func channelsOf(list []sent) string {
+	var names []string
+	for _, s := range list {
+		names = append(names, s.channel)
+	}
+	return strings.Join(names, ",")
+}
+
+type harness struct {
+	t   *testing.T
+	db  *sql.DB
+	a   *Alerter
+	r   *recorder
+	now time.Time
+}
+
+func newHarness(t *testing.T) *harness {
+	db := openSeededDB(t)
+	r := &recorder{}
+	h := &harness{t: t, db: db, r: r, now: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	// WhatsApp is not configured, so its step is skipped
+	h.a = New(db, map[string]Channel{
+		Telegram: {Sender: fakeSender{r, Telegram}, To: "chat"},
+		Email:    {Sender: fakeSender{r, Email}, To: "ops@example.com"},
+		SMS:      {Sender: fakeSender{r, SMS}, To: "+6281"},
+	}, time.Minute)
+	h.a.now = func() time.Time { return h.now }
+	return h
+}
+
+// health sets the camera's status and runs a check after d
+func (h *harness) health(cameraID int, status string, d time.Duration) []sent {
+	h.t.Helper()
+	h.now = h.now.Add(d)
+	_, err := h.db.Exec(`
+		INSERT INTO camera_health (camera_id, status, last_check) VALUES (?, ?, ?)
+		ON CONFLICT (camera_id) DO UPDATE SET status = excluded.status, last_check = excluded.last_check
+	`, cameraID, status, h.now)
+	if err != nil {
+		h.t.Fatalf("Failed to set health: %v", err)
+	}
+	if err := h.a.Check(context.Background()); err != nil {
+		h.t.Fatalf("Check failed: %v", err)
+	}
+	return h.r.take()
+}
+
+func TestEscalation(t *testing.T) {
+	h := newHarness(t)
+
+	if got := h.health(1, Online, 0); len(got) != 0 {
+		t.Fatalf("Expected nothing for an online camera, got %v", got)
+	}
+	if got := channelsOf(h.health(1, Offline, time.Minute)); got != "telegram" {
+		t.Errorf("Expected Telegram at once, got %q", got)
+	}
+	if got := h.health(1, Offline, 14*time.Minute); len(got) != 0 {
+		t.Errorf("Expected nothing before 15 minutes, got %v", got)
+	}
+	got := h.health(1, Offline, time.Minute)
+	if channelsOf(got) != "email" || got[0].to != "ops@example.com" {
+		t.Errorf("Expected email after 15 minutes, got %v", got)
+	}
+	if got := channelsOf(h.health(1, Offline, 45*time.Minute)); got != "sms" {
+		t.Errorf("Expected SMS after an hour and WhatsApp skipped, got %q", got)
+	}
+	if got := h.health(1, Offline, time.Hour); len(got) != 0 {
+		t.Errorf("Expected nothing after the last step, got %v", got)
+	}
+
+	got = h.health(1, Online, time.Minute)
+	if channelsOf(got) != "telegram,email,sms" || !strings.Contains(got[0].text, "back online after 2h1m") {
+		t.Errorf("Expected the recovery on every channel told, got %v", got)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+	if err := SaveTemplate(ctx, h.db, 1, AlertOffline, &Template{
+		Text:     "{{camera}} ({{area}}) down {{duration}}",
+		Channels: map[string]string{Email: "Mail: {{camera}} #{{camera_id}}"},
+	}); err != nil {
+		t.Fatalf("Failed to save template: %v", err)
+	}
+
+	h.health(2, Online, 0)
+	got := h.health(2, Offline, time.Minute)
+	if len(got) != 1 || got[0].text != "Stalls (Market) down less than a minute" {
+		t.Errorf("Expected the organization's wording, got %v", got)
+	}
+	got = h.health(2, Offline, 15*time.Minute)
+	if len(got) != 1 || got[0].text != "Mail: Stalls #2" {
+		t.Errorf("Expected the email's own text, got %v", got)
+	}
+	got = h.health(2, Online, time.Minute)
+	if len(got) != 2 || got[0].text != "🟢 Camera Stalls is back online after 16m." {
+		t.Errorf("Expected the default wording of types without a template, got %v", got)
+	}
+
+	// A setting that does not parse leaves the default wording
+	if _, err := h.db.Exec(`UPDATE settings SET value = 'nope' WHERE key = ?`, TemplatesKey); err != nil {
+		t.Fatalf("Failed to break setting: %v", err)
+	}
+	got = h.health(2, Offline, time.Hour)
+	if len(got) != 1 || !strings.Contains(got[0].text, "🔴 Camera Stalls has been offline") {
+		t.Errorf("Expected the default wording, got %v", got)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	h := newHarness(t)
+
+	h.health(1, Offline, 0)
+	if got := channelsOf(h.health(1, Online, time.Minute)); got != "telegram" {
+		t.Fatalf("Expected the recovery, got %q", got)
+	}
+	if got := h.health(1, Offline, time.Minute); len(got) != 0 {
+		t.Errorf("Expected a second outage within the window held back, got %v", got)
+	}
+	if got := h.health(1, Offline, 3*time.Minute); len(got) != 1 || !strings.Contains(got[0].text, "offline for 3m") {
+		t.Errorf("Expected the outage sent once the window passed, got %v", got)
+	}
+}
+
+func TestFlapping(t *testing.T) {
+	h := newHarness(t)
+
+	h.health(1, Online, 0)
+	var got []sent
+	for i, status := range []string{Offline, Online, Offline, Online} {
+		got = append(got, h.health(1, status, time.Second)...)
+		if i == 0 && len(got) != 1 {
+			t.Fatalf("Expected the first outage sent, got %v", got)
+		}
+	}
+	if n := len(got); n != 3 || !strings.Contains(got[2].text, "changed status 4 times") {
+		t.Fatalf("Expected outage, recovery and one flapping notice, got %v", got)
+	}
+
+	for _, status := range []string{Offline, Online, Offline} {
+		if got := h.health(1, status, time.Minute); len(got) != 0 {
+			t.Errorf("Expected nothing while flapping, got %v", got)
+		}
+	}
+	if got := h.health(1, Offline, 10*time.Minute); len(got) != 0 {
+		t.Errorf("Expected nothing before the flap window passed, got %v", got)
+	}
+
+	// The outage started 15 minutes ago, so the email is due too
+	got = h.health(1, Offline, 5*time.Minute)
+	if channelsOf(got) != "telegram,telegram,email" || !strings.Contains(got[0].text, "no longer flapping") {
+		t.Errorf("Expected the stable notice then the outage, got %v", got)
+	}
+	if got := channelsOf(h.health(1, Offline, 45*time.Minute)); got != "sms" {
+		t.Errorf("Expected escalation to go on, got %q", got)
+	}
+}
+
+func TestBanAlerts(t *testing.T) {
+	h := newHarness(t)
+	h.a.OnBan(events.Event{
+		Type: events.StreamIPBanned,
+		IP:   "203.0.113.9",
+		Data: map[string]interface{}{"reason": "more than 40 cameras in 1m0s", "expires_at": h.now.Add(time.Hour)},
+	})
+
+	got := h.r.take()
+	if len(got) != 1 || got[0].channel != Telegram || got[0].text != "🚫 203.0.113.9 is banned from the streams for 1h: more than 40 cameras in 1m0s." {
+		t.Errorf("Expected one Telegram message, got %+v", got)
+	}
+}
+
+func TestDatabaseGrownAlerts(t *testing.T) {
+	h := newHarness(t)
+	h.a.OnDatabaseGrown(events.Event{
+		Type: events.DatabaseGrown,
+		Data: map[string]interface{}{"file": "wal", "bytes": int64(3 << 29), "limit": int64(512 << 20)},
+	})
+
+	got := h.r.take()
+	want := "🗄️ The database WAL is 1.5 GB after a checkpoint, over 512 MB: a long transaction or reader keeps it from being truncated."
+	if len(got) != 1 || got[0].text != want {
+		t.Errorf("Expected one message about the WAL, got %+v", got)
+	}
+}
+
+func TestStreamStartSlowAlert(t *testing.T) {
+	h := newHarness(t)
+	h.a.OnStreamStartSlow(events.Event{
+		Type: events.StreamStartSlow,
+		Data: map[string]interface{}{"camera_id": 1, "camera": "Gate", "p95_ms": int64(7300), "threshold_ms": int64(5000), "samples": 40},
+	})
+
+	got := h.r.take()
+	want := "🐢 Gate takes 7.3s to start a stream at the 95th percentile of its last 40 starts, over 5.0s. Check its uplink."
+	if len(got) != 1 || got[0].text != want {
+		t.Errorf("Expected one message about the camera, got %+v", got)
+	}
+}
+
+func TestStreamTrafficAlerts(t *testing.T) {
+	h := newHarness(t)
+	hour := time.Date(2026, 3, 9, 19, 0, 0, 0, time.UTC)
+	h.a.OnStreamTraffic(events.Event{
+		Type: events.StreamTrafficSpike,
+		Data: map[string]interface{}{"camera_id": 1, "camera": "Gate", "hour": hour, "bytes": int64(3 << 30), "baseline_bytes": int64(200 << 20)},
+	})
+	h.a.OnStreamTraffic(events.Event{
+		Type: events.StreamTrafficDropped,
+		Data: map[string]interface{}{"camera_id": 1, "camera": "Gate", "hour": hour, "bytes": int64(0), "baseline_bytes": int64(200 << 20)},
+	})
+
+	got := h.r.take()
+	if len(got) != 2 ||
+		got[0].text != "📈 Gate served 3.0 GB from 2026-03-09 19:00 UTC, against 200 MB usually. Another site may be embedding its stream." ||
+		got[1].text != "📉 Gate served nothing from 2026-03-09 19:00 UTC, against 200 MB usually. Check that its player still works." {
+		t.Errorf("Expected a spike and a drop message, got %+v", got)
+	}
+}
+
+func TestInfraAlerts(t *testing.T) {
+	h := newHarness(t)
+	h.a.OnInfraAlert(events.Event{
+		Type: events.InfraAlertFiring,
+		Data: map[string]interface{}{"alert_id": int64(1), "alert": "NodeDown", "severity": "critical", "instance": "nvr-01:9100", "summary": ""},
+	})
+	h.a.OnInfraAlert(events.Event{
+		Type: events.InfraAlertResolved,
+		Data: map[string]interface{}{"alert_id": int64(1), "alert": "NodeDown", "summary": "nvr-01 is unreachable"},
+	})
+
+	got := h.r.take()
+	if len(got) != 2 || got[0].text != "🔥 NodeDown is firing.\nnvr-01:9100" || got[1].text != "✅ NodeDown is resolved.\nnvr-01 is unreachable" {
+		t.Errorf("Expected a firing and a resolved message, got %+v", got)
+	}
+}
+
+func TestDailyReport(t *testing.T) {
+	h := newHarness(t)
+	r := reports.Report{
+		Date:       "2026-03-09",
+		Cameras:    reports.Cameras{Total: 12, Offline: 1},
+		Offline:    []reports.OfflineCamera{{Camera: "Main Gate", Outages: 2, Downtime: 3900, Ongoing: true}},
+		Viewers:    reports.Viewers{Sessions: 40, Unique: 25},
+		TopCameras: []reports.TopCamera{{Camera: "Harbour", Viewers: 20}, {Camera: "Main Gate", Viewers: 5}},
+		Feedback:   reports.Feedback{New: 2, Unread: 3},
+		Storage: reports.Storage{Recordings: 8, RecordedBytes: 3 << 30, Disks: []sysmon.Disk{
+			{Name: "recordings", UsedPercent: 71.2, FreeBytes: 512 << 30},
+			{Name: "database", Error: "no such file or directory"},
+		}},
+	}
+	// WhatsApp is not configured, so it is skipped
+	h.a.OnDailyReport([]string{Email, WhatsApp})(events.Event{Type: events.ReportDaily, Data: map[string]interface{}{"date": r.Date, "report": r}})
+
+	got := h.r.take()
+	want := "📊 Report for 2026-03-09\nCameras: 12, 1 offline during the day\nMain Gate: 1h5m, still offline\n" +
+		"Viewers: 25 in 40 sessions\nMost watched: Harbour (20), Main Gate (5)\nNew feedback: 2 (3 unread)\n" +
+		"Recorded: 8 recordings, 3.0 GB\nrecordings disk: 71% used, 512.0 GB free"
+	if channelsOf(got) != "email" || got[0].text != want {
+		t.Errorf("Expected the report by email, got %+v", got)
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	h := newHarness(t)
+	insert := func(cameraID, areaID interface{}, steps string, muted bool) {
+		t.Helper()
+		_, err := h.db.Exec(`
+			INSERT INTO alert_policies (camera_id, area_id, steps, muted) VALUES (?, ?, ?, ?)
+		`, cameraID, areaID, steps, muted)
+		if err != nil {
+			t.Fatalf("Failed to add policy: %v", err)
+		}
+	}
+
+	insert(nil, nil, `[{"after_minutes":0,"channel":"email"}]`, false)
+	insert(nil, 1, `[{"after_minutes":0,"channel":"sms","to":"+6299"}]`, false)
+
+	if got := channelsOf(h.health(1, Offline, 0)); got != "email" {
+		t.Errorf("Expected the organization's policy for a camera without an area, got %q", got)
+	}
+	got := h.health(2, Offline, 0)
+	if channelsOf(got) != "sms" || got[0].to != "+6299" {
+		t.Errorf("Expected the parent area's policy and recipient, got %v", got)
+	}
+
+	insert(2, nil, `[{"after_minutes":0,"channel":"telegram"}]`, true)
+	h.health(2, Online, time.Minute)
+	if got := h.health(2, Offline, time.Hour); len(got) != 0 {
+		t.Errorf("Expected a muted camera policy to silence the camera, got %v", got)
+	}
+}
+
+func TestSenders(t *testing.T) {
+	var paths []string
+	var bodies []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, body)
+		if body["to"] == "fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	channels := Channels(config.AlertingConfig{
+		TelegramAPIURL: server.URL, TelegramBotToken: "123:abc", TelegramChatID: "-100",
+		SMSURL: server.URL + "/sms", SMSTo: "+6281",
+	})
+	if len(channels) != 2 {
+		t.Fatalf("Expected Telegram and SMS configured, got %d channels", len(channels))
+	}
+
+	ctx := context.Background()
+	m := Message{Subject: "Camera Gate is offline", Text: "Gate is offline"}
+	if err := channels[Telegram].Sender.Send(ctx, "-100", m); err != nil {
+		t.Fatalf("Telegram failed: %v", err)
+	}
+	if paths[0] != "/bot123:abc/sendMessage" || bodies[0]["chat_id"] != "-100" || bodies[0]["text"] != m.Text {
+		t.Errorf("Unexpected Telegram request %s %v", paths[0], bodies[0])
+	}
+
+	if err := channels[SMS].Sender.Send(ctx, "+6281", m); err != nil {
+		t.Fatalf("SMS failed: %v", err)
+	}
+	if paths[1] != "/sms" || bodies[1]["to"] != "+6281" {
+		t.Errorf("Unexpected SMS request %s %v", paths[1], bodies[1])
+	}
+	if err := channels[SMS].Sender.Send(ctx, "fail", m); err == nil {
+		t.Error("Expected an error status to fail")
+	}
+}
+
+func TestPushSenders(t *testing.T) {
+	type request struct {
+		path, auth, gotifyKey string
+		body                  map[string]interface{}
+	}
+	var got []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{path: r.URL.Path, auth: r.Header.Get("Authorization"), gotifyKey: r.Header.Get("X-Gotify-Key")}
+		json.NewDecoder(r.Body).Decode(&req.body)
+		got = append(got, req)
+	}))
+	defer server.Close()
+
+	channels := Channels(config.AlertingConfig{
+		NtfyURL: server.URL + "/", NtfyTopic: "cctv-alerts", NtfyToken: "tk_secret",
+		GotifyURL: server.URL + "/gotify", GotifyToken: "app-token",
+	})
+	if len(channels) != 2 || channels[Ntfy].To != "cctv-alerts" {
+		t.Fatalf("Expected ntfy and Gotify configured, got %+v", channels)
+	}
+
+	ctx := context.Background()
+	m := Message{Subject: "Camera Gate is offline", Text: "Gate is offline"}
+	if err := channels[Ntfy].Sender.Send(ctx, "ops", m); err != nil {
+		t.Fatalf("ntfy failed: %v", err)
+	}
+	if r := got[0]; r.path != "/" || r.auth != "Bearer tk_secret" || r.body["topic"] != "ops" || r.body["title"] != m.Subject || r.body["message"] != m.Text {
+		t.Errorf("Unexpected ntfy request %+v", r)
+	}
+
+	if err := channels[Gotify].Sender.Send(ctx, "", m); err != nil {
+		t.Fatalf("Gotify failed: %v", err)
+	}
+	if r := got[1]; r.path != "/gotify/message" || r.gotifyKey != "app-token" || r.body["message"] != m.Text || r.body["priority"] != float64(5) {
+		t.Errorf("Unexpected Gotify request %+v", r)
+	}
+
+	// Without a topic, or a token, the channel is off
+	if channels := Channels(config.AlertingConfig{NtfyURL: server.URL, GotifyURL: server.URL}); len(channels) != 0 {
+		t.Errorf("Expected no channels, got %+v", channels)
+	}
+}
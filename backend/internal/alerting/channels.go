@@ -0,0 +1,238 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+)
+
+// Channel names used in policy steps
+const (
+	Telegram = "telegram"
+	Email    = "email"
+	SMS      = "sms"
+	WhatsApp = "whatsapp"
+	Ntfy     = "ntfy"
+	Gotify   = "gotify"
+)
+
+// gotifyPriority is the priority of Gotify messages; 4 and up make a
+// sound on the Android app
+const gotifyPriority = 5
+
+// channelNames are the channels a step may name, in the order they are
+// listed
+var channelNames = []string{Telegram, Email, SMS, WhatsApp, Ntfy, Gotify}
+
+// ValidChannel reports whether name is a channel steps may use
+func ValidChannel(name string) bool {
+	for _, n := range channelNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelList is the channels steps may use, comma separated, for
+// validation messages
+func ChannelList() string {
+	return strings.Join(channelNames, ", ")
+}
+
+// Message is one notification
+type Message struct {
+	Subject string // email subject and push title; the other channels send Text only
+	Text    string
+}
+
+// Sender delivers messages over one channel. to is the step's
+// recipient, or the channel's default.
+type Sender interface {
+	Send(ctx context.Context, to string, m Message) error
+}
+
+// Channel is a Sender with the recipient steps use by default
+type Channel struct {
+	Sender Sender
+	To     string
+}
+
+// Channels returns the channels cfg configures, by name
+func Channels(cfg config.AlertingConfig) map[string]Channel {
+	channels := map[string]Channel{}
+	if cfg.TelegramBotToken != "" && cfg.TelegramChatID != "" {
+		channels[Telegram] = Channel{
+			Sender: &TelegramSender{APIURL: cfg.TelegramAPIURL, Token: cfg.TelegramBotToken},
+			To:     cfg.TelegramChatID,
+		}
+	}
+	if cfg.SMTPHost != "" && cfg.SMTPFrom != "" && cfg.EmailTo != "" {
+		channels[Email] = Channel{
+			Sender: &EmailSender{
+				Addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+				Username: cfg.SMTPUsername,
+				Password: cfg.SMTPPassword,
+				From:     cfg.SMTPFrom,
+			},
+			To: cfg.EmailTo,
+		}
+	}
+	if cfg.SMSURL != "" {
+		channels[SMS] = Channel{Sender: &WebhookSender{URL: cfg.SMSURL}, To: cfg.SMSTo}
+	}
+	if cfg.WhatsAppURL != "" {
+		channels[WhatsApp] = Channel{Sender: &WebhookSender{URL: cfg.WhatsAppURL}, To: cfg.WhatsAppTo}
+	}
+	if cfg.NtfyTopic != "" {
+		channels[Ntfy] = Channel{Sender: &NtfySender{URL: cfg.NtfyURL, Token: cfg.NtfyToken}, To: cfg.NtfyTopic}
+	}
+	if cfg.GotifyURL != "" && cfg.GotifyToken != "" {
+		channels[Gotify] = Channel{Sender: &GotifySender{URL: cfg.GotifyURL, Token: cfg.GotifyToken}}
+	}
+	return channels
+}
+
+// TelegramSender sends through the Bot API; to is a chat ID
+type TelegramSender struct {
+	APIURL string
+	Token  string
+}
+
+func (t *TelegramSender) Send(ctx context.Context, to string, m Message) error {
+	endpoint := strings.TrimRight(t.APIURL, "/") + "/bot" + t.Token + "/sendMessage"
+	return postJSON(ctx, endpoint, map[string]string{"chat_id": to, "text": m.Text})
+}
+
+// WebhookSender posts {"to", "text"} to an SMS or WhatsApp gateway
+type WebhookSender struct {
+	URL string
+}
+
+func (w *WebhookSender) Send(ctx context.Context, to string, m Message) error {
+	return postJSON(ctx, w.URL, map[string]string{"to": to, "text": m.Text})
+}
+
+// NtfySender publishes to an ntfy server, such as https://ntfy.sh; to
+// is the topic. Token is an access token for a server or topic that
+// needs one.
+type NtfySender struct {
+	URL   string
+	Token string
+}
+
+func (n *NtfySender) Send(ctx context.Context, to string, m Message) error {
+	header := http.Header{}
+	if n.Token != "" {
+		header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return postJSONWith(ctx, strings.TrimRight(n.URL, "/"), header, map[string]string{"topic": to, "title": m.Subject, "message": m.Text})
+}
+
+// GotifySender posts to a Gotify server with an application token,
+// which decides who gets the message; to is not used
+type GotifySender struct {
+	URL   string
+	Token string
+}
+
+func (g *GotifySender) Send(ctx context.Context, to string, m Message) error {
+	header := http.Header{"X-Gotify-Key": {g.Token}}
+	return postJSONWith(ctx, strings.TrimRight(g.URL, "/")+"/message", header, map[string]interface{}{
+		"title":    m.Subject,
+		"message":  m.Text,
+		"priority": gotifyPriority,
+	})
+}
+
+// postJSON fails on anything but a 2xx response
+func postJSON(ctx context.Context, endpoint string, body interface{}) error {
+	return postJSONWith(ctx, endpoint, nil, body)
+}
+
+// postJSONWith is postJSON sending header too
+func postJSONWith(ctx context.Context, endpoint string, header http.Header, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpclient.Shared().Do(req)
+	if err != nil {
+		// A *url.Error names the URL, which for Telegram holds the token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// EmailSender sends plain text mail over SMTP, with STARTTLS when the
+// server offers it; to is a comma-separated list of addresses
+type EmailSender struct {
+	Addr     string // host:port
+	Username string // empty sends without authentication
+	Password string
+	From     string
+}
+
+func (e *EmailSender) Send(ctx context.Context, to string, m Message) error {
+	var recipients []string
+	for _, addr := range strings.Split(to, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			recipients = append(recipients, addr)
+		}
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := net.SplitHostPort(e.Addr)
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", e.From, strings.Join(recipients, ", "), m.Subject)
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Text, "\n", "\r\n"))
+
+	// net/smtp takes no context; run it aside so a hung server does not
+	// hold up the other notifications
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(e.Addr, auth, e.From, recipients, msg.Bytes()) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,417 @@
+package alerting
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Alert types a notification template can be set for
+const (
+	AlertOffline   = "camera_offline"
+	AlertOnline    = "camera_online"
+	AlertFlapping  = "camera_flapping"
+	AlertStable    = "camera_stable"
+	AlertBanned    = "ip_banned"
+	AlertDatabase  = "database_size"
+	AlertWAL       = "database_wal"
+	AlertSlowStart = "stream_start_slow"
+	AlertSpike     = "stream_traffic_spike"
+	AlertDrop      = "stream_traffic_drop"
+	AlertInfra     = "infra_firing"
+	AlertInfraOK   = "infra_resolved"
+	AlertReport    = "daily_report"
+)
+
+// TemplatesKey is the setting holding an organization's templates, a
+// JSON object of Template by alert type
+const TemplatesKey = "notification_templates"
+
+// Template words the notifications of one alert type. {{variable}} is
+// replaced by the variable's value; empty fields fall back to the
+// default template.
+type Template struct {
+	Subject  string            `json:"subject,omitempty"`  // email subject
+	Text     string            `json:"text,omitempty"`     // every channel's text
+	Channels map[string]string `json:"channels,omitempty"` // text of one channel, in place of Text
+}
+
+// AlertType describes an alert type to the operators wording it
+type AlertType struct {
+	Type        string            `json:"type"`
+	Description string            `json:"description"`
+	Variables   []string          `json:"variables"`
+	Default     Template          `json:"default"`
+	Sample      map[string]string `json:"sample"` // variables the preview renders with
+}
+
+// cameraVariables are those of every camera alert
+var cameraVariables = []string{"camera", "camera_id", "area", "status", "duration", "error"}
+
+// trafficVariables are those of the stream traffic alerts
+var trafficVariables = []string{"camera", "hour", "traffic", "baseline"}
+
+// infraVariables are those of the alerts Alertmanager sends
+var infraVariables = []string{"alert", "severity", "instance", "summary"}
+
+var alertTypes = []AlertType{
+	{
+		Type:        AlertOffline,
+		Description: "A camera went offline; sent at each escalation step",
+		Variables:   cameraVariables,
+		Default: Template{
+			Subject: "Camera {{camera}} is offline",
+			Text:    "🔴 Camera {{camera}} has been offline for {{duration}}.\n{{error}}",
+		},
+	},
+	{
+		Type:        AlertOnline,
+		Description: "A camera is back online; sent to the channels told of the outage",
+		Variables:   cameraVariables,
+		Default: Template{
+			Subject: "Camera {{camera}} is back online",
+			Text:    "🟢 Camera {{camera}} is back online after {{duration}}.",
+		},
+	},
+	{
+		Type:        AlertFlapping,
+		Description: "A camera keeps changing status; its alerts are paused",
+		Variables:   append([]string{"changes", "window"}, cameraVariables...),
+		Default: Template{
+			Subject: "Camera {{camera}} is flapping",
+			Text:    "⚠️ Camera {{camera}} changed status {{changes}} times in {{window}}. Alerts are paused until it holds one status for {{window}}.",
+		},
+	},
+	{
+		Type:        AlertStable,
+		Description: "A flapping camera held one status for the flap window",
+		Variables:   cameraVariables,
+		Default: Template{
+			Subject: "Camera {{camera}} is stable, {{status}}",
+			Text:    "Camera {{camera}} has been {{status}} for {{duration}} and is no longer flapping.",
+		},
+	},
+	{
+		Type:        AlertBanned,
+		Description: "A client IP was banned from the streams",
+		Variables:   []string{"ip", "reason", "duration"},
+		Default: Template{
+			Subject: "{{ip}} banned from the streams",
+			Text:    "🚫 {{ip}} is banned from the streams for {{duration}}: {{reason}}.",
+		},
+	},
+	{
+		Type:        AlertDatabase,
+		Description: "The database file went over its alert size",
+		Variables:   []string{"size", "limit"},
+		Default: Template{
+			Subject: "Database file over {{limit}}",
+			Text:    "🗄️ The database file is {{size}}, over {{limit}}. Check the retention settings and free disk space.",
+		},
+	},
+	{
+		Type:        AlertWAL,
+		Description: "The database WAL stayed over its alert size after a checkpoint",
+		Variables:   []string{"size", "limit"},
+		Default: Template{
+			Subject: "Database WAL over {{limit}}",
+			Text:    "🗄️ The database WAL is {{size}} after a checkpoint, over {{limit}}: a long transaction or reader keeps it from being truncated.",
+		},
+	},
+	{
+		Type:        AlertSlowStart,
+		Description: "A camera's streams are slow to start",
+		Variables:   []string{"camera", "p95", "threshold", "samples"},
+		Default: Template{
+			Subject: "{{camera}} is slow to start streaming",
+			Text:    "🐢 {{camera}} takes {{p95}} to start a stream at the 95th percentile of its last {{samples}} starts, over {{threshold}}. Check its uplink.",
+		},
+	},
+	{
+		Type:        AlertSpike,
+		Description: "A camera's streams served far more than usual in an hour, possibly hotlinked by another site",
+		Variables:   trafficVariables,
+		Default: Template{
+			Subject: "Unusual traffic on {{camera}}",
+			Text:    "📈 {{camera}} served {{traffic}} from {{hour}}, against {{baseline}} usually. Another site may be embedding its stream.",
+		},
+	},
+	{
+		Type:        AlertDrop,
+		Description: "A camera that usually has viewers served nothing in an hour, possibly a broken player",
+		Variables:   trafficVariables,
+		Default: Template{
+			Subject: "No traffic on {{camera}}",
+			Text:    "📉 {{camera}} served nothing from {{hour}}, against {{baseline}} usually. Check that its player still works.",
+		},
+	},
+	{
+		Type:        AlertInfra,
+		Description: "Alertmanager sent an infrastructure alert that started firing",
+		Variables:   infraVariables,
+		Default: Template{
+			Subject: "{{alert}} is firing",
+			Text:    "🔥 {{alert}} is firing.\n{{summary}}\n{{instance}}",
+		},
+	},
+	{
+		Type:        AlertInfraOK,
+		Description: "An infrastructure alert Alertmanager sent is resolved",
+		Variables:   infraVariables,
+		Default: Template{
+			Subject: "{{alert}} is resolved",
+			Text:    "✅ {{alert}} is resolved.\n{{summary}}\n{{instance}}",
+		},
+	},
+	{
+		Type:        AlertReport,
+		Description: "The nightly summary report of the day before; sent on REPORT_CHANNELS",
+		Variables:   []string{"date", "cameras", "offline", "offline_cameras", "sessions", "viewers", "top_cameras", "feedback", "recorded", "storage"},
+		Default: Template{
+			Subject: "CCTV report for {{date}}",
+			Text: "📊 Report for {{date}}\n" +
+				"Cameras: {{cameras}}, {{offline}} offline during the day\n{{offline_cameras}}\n" +
+				"Viewers: {{viewers}} in {{sessions}} sessions\nMost watched: {{top_cameras}}\n" +
+				"New feedback: {{feedback}}\nRecorded: {{recorded}}\n{{storage}}",
+		},
+	},
+}
+
+// samples are the variables previews render with
+var samples = map[string]string{
+	"camera":    "Main Gate",
+	"camera_id": "12",
+	"area":      "Market",
+	"status":    Offline,
+	"duration":  "1h5m",
+	"error":     "dial tcp 10.0.0.12:554: i/o timeout",
+	"changes":   "4",
+	"window":    "15m",
+	"ip":        "203.0.113.7",
+	"reason":    "too many playlist requests",
+	"size":      "2.5 GB",
+	"limit":     "2.0 GB",
+	"p95":       "6.2s",
+	"threshold": "5.0s",
+	"samples":   "20",
+	"hour":      "2025-01-14 19:00 UTC",
+	"traffic":   "4.2 GB",
+	"baseline":  "310 MB",
+	"alert":     "NodeFilesystemAlmostFull",
+	"severity":  "warning",
+	"instance":  "nvr-01:9100",
+	"summary":   "Filesystem /recordings has 4% space left",
+
+	"date":            "2025-01-14",
+	"cameras":         "24",
+	"offline":         "2",
+	"offline_cameras": "Main Gate: 1h5m, still offline\nMarket Square: 12m",
+	"sessions":        "1830",
+	"viewers":         "642",
+	"top_cameras":     "Main Gate (210), Market Square (158), Harbour (97)",
+	"feedback":        "3 (5 unread)",
+	"recorded":        "412 recordings, 86.4 GB",
+	"storage":         "recordings disk: 71% used, 512.0 GB free",
+}
+
+func init() {
+	for i, t := range alertTypes {
+		alertTypes[i].Sample = map[string]string{}
+		for _, v := range t.Variables {
+			alertTypes[i].Sample[v] = samples[v]
+		}
+	}
+}
+
+// AlertTypes lists the alert types templates can be set for
+func AlertTypes() []AlertType {
+	return alertTypes
+}
+
+// LookupAlertType returns the alert type named name
+func LookupAlertType(name string) (AlertType, bool) {
+	for _, t := range alertTypes {
+		if t.Type == name {
+			return t, true
+		}
+	}
+	return AlertType{}, false
+}
+
+// variablePattern matches {{name}}, spaces allowed inside the braces
+var variablePattern = regexp.MustCompile(`\{\{\s*([a-z0-9_]+)\s*\}\}`)
+
+// Validate returns the problems of a template for alertType by field,
+// such as a variable the type does not have; nil when there are none
+func (t Template) Validate(alertType string) map[string]string {
+	at, ok := LookupAlertType(alertType)
+	if !ok {
+		return map[string]string{"type": "is not an alert type"}
+	}
+	known := map[string]bool{}
+	for _, v := range at.Variables {
+		known[v] = true
+	}
+	problems := map[string]string{}
+	check := func(field, text string, max int) {
+		if len(text) > max {
+			problems[field] = fmt.Sprintf("must be at most %d characters", max)
+			return
+		}
+		for _, m := range variablePattern.FindAllStringSubmatch(text, -1) {
+			if !known[m[1]] {
+				problems[field] = fmt.Sprintf("unknown variable %s; %s has %s", m[1], alertType, strings.Join(at.Variables, ", "))
+				return
+			}
+		}
+	}
+	check("subject", t.Subject, 200)
+	check("text", t.Text, 2000)
+	for channel, text := range t.Channels {
+		if !ValidChannel(channel) {
+			problems["channels."+channel] = "must be one of " + ChannelList()
+			continue
+		}
+		check("channels."+channel, text, 2000)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// Templates are an organization's templates by alert type
+type Templates map[string]Template
+
+// Render returns the message of alertType sent on channel: the
+// organization's template where set, else the default, with vars
+// substituted. Blank lines left by empty variables are dropped.
+func (ts Templates) Render(alertType, channel string, vars map[string]string) Message {
+	at, _ := LookupAlertType(alertType)
+	t := ts[alertType]
+	subject, text := at.Default.Subject, at.Default.Text
+	if t.Subject != "" {
+		subject = t.Subject
+	}
+	if t.Text != "" {
+		text = t.Text
+	}
+	if t.Channels[channel] != "" {
+		text = t.Channels[channel]
+	}
+	return Message{Subject: substitute(subject, vars), Text: substitute(text, vars)}
+}
+
+func substitute(text string, vars map[string]string) string {
+	text = variablePattern.ReplaceAllStringFunc(text, func(m string) string {
+		return vars[variablePattern.FindStringSubmatch(m)[1]]
+	})
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, strings.TrimRight(line, " \t"))
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// LoadTemplates returns the templates of an organization
+func LoadTemplates(ctx context.Context, db *sql.DB, orgID int) (Templates, error) {
+	var value string
+	err := db.QueryRowContext(ctx, `SELECT value FROM settings WHERE organization_id = ? AND key = ?`,
+		orgID, TemplatesKey).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Templates{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseTemplates(value)
+}
+
+// allTemplates returns the templates of every organization that has
+// any; those of an unreadable setting are left out
+func allTemplates(ctx context.Context, db *sql.DB) (map[int]Templates, error) {
+	rows, err := db.QueryContext(ctx, `SELECT organization_id, value FROM settings WHERE key = ?`, TemplatesKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byOrg := map[int]Templates{}
+	for rows.Next() {
+		var orgID int
+		var value string
+		if err := rows.Scan(&orgID, &value); err != nil {
+			return nil, err
+		}
+		ts, err := parseTemplates(value)
+		if err != nil {
+			// The organization's alerts go out in the default wording
+			logger.Warn("Failed to load notification templates", "organization_id", orgID, "error", err)
+			continue
+		}
+		byOrg[orgID] = ts
+	}
+	return byOrg, rows.Err()
+}
+
+func parseTemplates(value string) (Templates, error) {
+	ts := Templates{}
+	if value == "" {
+		return ts, nil
+	}
+	if err := json.Unmarshal([]byte(value), &ts); err != nil {
+		return nil, fmt.Errorf("invalid %s setting: %w", TemplatesKey, err)
+	}
+	return ts, nil
+}
+
+// SaveTemplate sets the organization's template of alertType, or with
+// nil goes back to the default. The template is trusted to be valid.
+func SaveTemplate(ctx context.Context, db *sql.DB, orgID int, alertType string, t *Template) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var value string
+	err = tx.QueryRowContext(ctx, `SELECT value FROM settings WHERE organization_id = ? AND key = ?`,
+		orgID, TemplatesKey).Scan(&value)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	ts, err := parseTemplates(value)
+	if err != nil {
+		// A hand-edited setting that no longer parses is replaced
+		ts = Templates{}
+	}
+	if t == nil {
+		delete(ts, alertType)
+	} else {
+		ts[alertType] = *t
+	}
+
+	encoded, err := json.Marshal(ts)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO settings (key, value, category, description, organization_id, updated_at)
+		VALUES (?, ?, 'notifications', 'Wording of alert notifications by alert type', ?, ?)
+		ON CONFLICT(organization_id, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, TemplatesKey, string(encoded), orgID, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,131 @@
+// Package anpr stores licence plate reads from traffic cameras. Reads
+// come from ANPR cameras or boxes posting to the ingest endpoint, and
+// from the object detection service when it returns a plate with its
+// text. Only cameras marked as traffic keep reads, and reads are deleted
+// after the retention period.
+package anpr
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Sources of a read
+const (
+	SourceIngest    = "ingest"
+	SourceDetection = "detection"
+)
+
+// ErrNotTraffic is returned for a camera that does not exist or is not
+// marked as traffic
+var ErrNotTraffic = errors.New("camera is not a traffic camera")
+
+// Event is one plate read
+type Event struct {
+	ID          int64     `json:"id"`
+	CameraID    int       `json:"camera_id"`
+	Plate       string    `json:"plate"`
+	Confidence  float64   `json:"confidence"` // 0-1
+	SnapshotURL string    `json:"snapshot_url"`
+	DetectionID *int64    `json:"detection_id"`
+	Source      string    `json:"source"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Normalize reduces a plate to upper case letters and digits, so
+// "B 1234-XYZ" and "b1234xyz" are the same plate
+func Normalize(plate string) string {
+	var b strings.Builder
+	for _, r := range plate {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// Record stores e for a traffic camera and publishes anpr.plate_read.
+// e.ID is set; a zero CreatedAt is now.
+func Record(ctx context.Context, db *sql.DB, e *Event) error {
+	var traffic bool
+	err := db.QueryRowContext(ctx, `SELECT traffic FROM cameras WHERE id = ?`, e.CameraID).Scan(&traffic)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !traffic) {
+		return ErrNotTraffic
+	}
+	if err != nil {
+		return err
+	}
+
+	e.Plate = strings.TrimSpace(e.Plate)
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.CreatedAt = e.CreatedAt.UTC()
+
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO anpr_events (camera_id, plate, plate_normalized, confidence, snapshot_url, detection_id, source, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, e.CameraID, e.Plate, Normalize(e.Plate), e.Confidence, e.SnapshotURL, e.DetectionID, e.Source, e.CreatedAt).Scan(&e.ID)
+	if err != nil {
+		return err
+	}
+
+	events.Publish(events.Event{
+		Type:     events.ANPRPlateRead,
+		Time:     e.CreatedAt,
+		Resource: "camera",
+		Data: map[string]interface{}{
+			"camera_id":  e.CameraID,
+			"event_id":   e.ID,
+			"plate":      e.Plate,
+			"confidence": e.Confidence,
+			"source":     e.Source,
+		},
+	})
+	return nil
+}
+
+// pruneInterval is how often Retention deletes expired reads
+const pruneInterval = time.Hour
+
+// Retention deletes reads older than keep every hour until ctx is
+// cancelled. Start it with shutdown.Coordinator.Go.
+func Retention(db *sql.DB, keep time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for {
+			if n, err := Prune(ctx, db, time.Now().Add(-keep)); err != nil {
+				if ctx.Err() == nil {
+					logger.Error("Failed to prune ANPR events", "error", err)
+				}
+			} else if n > 0 {
+				logger.Info("Pruned ANPR events", "rows", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// Prune deletes reads made before cutoff and returns how many
+func Prune(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM anpr_events WHERE created_at < ?`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
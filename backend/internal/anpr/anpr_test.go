@@ -0,0 +1,61 @@
+package anpr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"B 1234 XYZ": "B1234XYZ",
+		"b-1234-xyz": "B1234XYZ",
+		" ad1x ":     "AD1X",
+		"--":         "",
+	} {
+		if got := Normalize(in); got != want {
+			t.Errorf("Expected %q for %q, got %q", want, in, got)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url, traffic) VALUES (1, 'Junction', 'rtsp://a', TRUE), (2, 'Gate', 'rtsp://b', FALSE)`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	t.Run("Traffic camera", func(t *testing.T) {
+		e := &Event{CameraID: 1, Plate: " B 1234 XYZ ", Confidence: 0.9, Source: SourceIngest}
+		if err := Record(ctx, db, e); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+		var plate, normalized string
+		db.QueryRow(`SELECT plate, plate_normalized FROM anpr_events WHERE id = ?`, e.ID).Scan(&plate, &normalized)
+		if plate != "B 1234 XYZ" || normalized != "B1234XYZ" {
+			t.Errorf("Expected the plate as read and normalised, got %q and %q", plate, normalized)
+		}
+	})
+
+	t.Run("Other cameras", func(t *testing.T) {
+		for _, id := range []int{2, 9} {
+			if err := Record(ctx, db, &Event{CameraID: id, Plate: "B1", Source: SourceIngest}); err != ErrNotTraffic {
+				t.Errorf("Expected ErrNotTraffic for camera %d, got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+		old := &Event{CameraID: 1, Plate: "D 1 AB", Source: SourceIngest, CreatedAt: time.Now().AddDate(0, 0, -100)}
+		if err := Record(ctx, db, old); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+		n, err := Prune(ctx, db, time.Now().AddDate(0, 0, -90))
+		if err != nil || n != 1 {
+			t.Errorf("Expected 1 read pruned, got %d (%v)", n, err)
+		}
+	})
+}
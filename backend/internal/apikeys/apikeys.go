@@ -0,0 +1,97 @@
+// Package apikeys checks the keys third parties send as X-API-Key and
+// counts what each key uses per UTC day in api_key_usage. The counts are
+// in the database, so every instance of a cluster sees the same quota.
+package apikeys
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// dayFormat names a UTC day in api_key_usage
+const dayFormat = "2006-01-02"
+
+// Key is an API key as requests made with it need it
+type Key struct {
+	ID             int
+	OrganizationID int
+	RequestsPerDay int
+	MaxStreams     int
+}
+
+// Store looks keys up and counts their usage
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func New(db *sql.DB) *Store {
+	return &Store{db: db, now: time.Now}
+}
+
+// Hash is what api_keys stores of a key
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Day names the UTC day t falls in
+func Day(t time.Time) string {
+	return t.UTC().Format(dayFormat)
+}
+
+// Lookup returns the key whose hash matches key
+func (s *Store) Lookup(ctx context.Context, key string) (Key, bool, error) {
+	var k Key
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, organization_id, requests_per_day, max_streams FROM api_keys WHERE key_hash = ?
+	`, Hash(key)).Scan(&k.ID, &k.OrganizationID, &k.RequestsPerDay, &k.MaxStreams)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, false, nil
+	}
+	if err != nil {
+		return Key{}, false, err
+	}
+	return k, true, nil
+}
+
+// Hit counts a request made with k today. It returns the requests made
+// today including this one, whether that is within the key's quota, and
+// the time until the quota starts over at midnight UTC. A request over
+// the quota is counted as refused as well.
+func (s *Store) Hit(ctx context.Context, k Key) (used int, ok bool, reset time.Duration, err error) {
+	now := s.now().UTC()
+	day := Day(now)
+	reset = now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO api_key_usage (api_key_id, day, requests) VALUES (?, ?, 1)
+		ON CONFLICT (api_key_id, day) DO UPDATE SET requests = api_key_usage.requests + 1
+		RETURNING requests
+	`, k.ID, day).Scan(&used)
+	if err != nil {
+		return 0, false, 0, err
+	}
+	if k.RequestsPerDay <= 0 || used <= k.RequestsPerDay {
+		return used, true, reset, nil
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE api_key_usage SET refused = refused + 1 WHERE api_key_id = ? AND day = ?
+	`, k.ID, day)
+	return used, false, reset, err
+}
+
+// StreamRefused counts a stream refused today for k having MaxStreams
+// open already
+func (s *Store) StreamRefused(ctx context.Context, k Key) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_key_usage (api_key_id, day, streams_refused) VALUES (?, ?, 1)
+		ON CONFLICT (api_key_id, day) DO UPDATE SET streams_refused = api_key_usage.streams_refused + 1
+	`, k.ID, Day(s.now()))
+	return err
+}
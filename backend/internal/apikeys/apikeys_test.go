@@ -0,0 +1,77 @@
+package apikeys
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestStore(t *testing.T) {
+	db := dbtest.Open(t)
+	_, err := db.Exec(`INSERT INTO api_keys (id, organization_id, name, key_hash, requests_per_day, max_streams)
+		VALUES (1, 1, 'Partner', ?, 2, 1), (2, 1, 'Unlimited', ?, 0, 0)`, Hash("partner-key"), Hash("unlimited-key"))
+	if err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	ctx := context.Background()
+	s := New(db)
+	now := time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	if _, ok, err := s.Lookup(ctx, "wrong"); ok || err != nil {
+		t.Fatalf("Expected an unknown key not found, got %v %v", ok, err)
+	}
+	key, ok, err := s.Lookup(ctx, "partner-key")
+	if !ok || err != nil || key.ID != 1 || key.RequestsPerDay != 2 || key.MaxStreams != 1 {
+		t.Fatalf("Expected the partner key, got %+v %v %v", key, ok, err)
+	}
+
+	t.Run("Quota", func(t *testing.T) {
+		for i := 1; i <= 2; i++ {
+			if used, ok, _, err := s.Hit(ctx, key); !ok || used != i || err != nil {
+				t.Fatalf("Expected request %d within the quota, got %d %v %v", i, used, ok, err)
+			}
+		}
+		used, ok, reset, err := s.Hit(ctx, key)
+		if ok || used != 3 || err != nil {
+			t.Fatalf("Expected the third request refused, got %d %v %v", used, ok, err)
+		}
+		if reset != 6*time.Hour {
+			t.Errorf("Expected the quota to start over at midnight UTC, got %s", reset)
+		}
+
+		now = now.Add(6 * time.Hour)
+		if used, ok, _, _ := s.Hit(ctx, key); !ok || used != 1 {
+			t.Errorf("Expected a new quota the next day, got %d %v", used, ok)
+		}
+	})
+
+	t.Run("No limit", func(t *testing.T) {
+		unlimited, _, _ := s.Lookup(ctx, "unlimited-key")
+		for i := 0; i < 5; i++ {
+			if _, ok, _, _ := s.Hit(ctx, unlimited); !ok {
+				t.Fatal("Expected no limit with a zero quota")
+			}
+		}
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		if err := s.StreamRefused(ctx, key); err != nil {
+			t.Fatalf("StreamRefused failed: %v", err)
+		}
+		var requests, refused, streams int
+		db.QueryRow(`SELECT requests, refused, streams_refused FROM api_key_usage WHERE api_key_id = 1 AND day = '2026-05-01'`).
+			Scan(&requests, &refused, &streams)
+		if requests != 3 || refused != 1 || streams != 0 {
+			t.Errorf("Expected 3 requests and 1 refused on the first day, got %d %d %d", requests, refused, streams)
+		}
+		db.QueryRow(`SELECT requests, streams_refused FROM api_key_usage WHERE api_key_id = 1 AND day = '2026-05-02'`).
+			Scan(&requests, &streams)
+		if requests != 1 || streams != 1 {
+			t.Errorf("Expected 1 request and 1 refused stream on the second day, got %d %d", requests, streams)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+// Package cache keeps hot reads out of the database: public branding
+// settings, stream key lookups on every HLS segment, rate limit counts
+// and the list of revoked login tokens.
+//
+// Without REDIS_URL entries live in this process, which is all a
+// single instance needs. Instances behind a load balancer point
+// REDIS_URL at one Redis so they share counts and revocations, and a
+// change made through one instance invalidates the cached reads of all.
+// A Redis that fails is treated as a miss: requests fall back to the
+// database, rate limits and revocation checks let the request through,
+// and a warning is logged.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/redis"
+)
+
+// ErrMiss is returned by Get for a key that is not cached
+var ErrMiss = errors.New("cache miss")
+
+// Store holds byte values by key until their TTL passes
+type Store interface {
+	// Get returns the value of key, or ErrMiss
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores value under key for ttl; zero keeps it until deleted
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes keys; missing keys are not an error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Open returns the store cfg asks for: Redis when REDIS_URL is set,
+// otherwise memory. It does not connect; Validate has already checked
+// the server answers.
+func Open(cfg config.RedisConfig) (Store, error) {
+	if cfg.URL == "" {
+		return NewMemory(), nil
+	}
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedis(redis.New(opts), cfg.Prefix), nil
+}
+
+var shared atomic.Pointer[Store]
+
+// Shared returns the process-wide store, memory until SetShared
+func Shared() Store {
+	if s := shared.Load(); s != nil {
+		return *s
+	}
+	var s Store = NewMemory()
+	if shared.CompareAndSwap(nil, &s) {
+		return s
+	}
+	return *shared.Load()
+}
+
+// SetShared replaces the process-wide store; call it at startup
+func SetShared(s Store) {
+	shared.Store(&s)
+}
+
+// GetJSON reads key into v
+func GetJSON(ctx context.Context, s Store, key string, v interface{}) error {
+	data, err := s.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// SetJSON stores v under key for ttl
+func SetJSON(ctx context.Context, s Store, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Set(ctx, key, data, ttl)
+}
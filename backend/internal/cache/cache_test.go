@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/redis/redistest"
+)
+
+// useStore makes s the shared store for the test
+func useStore(t *testing.T, s Store) {
+	prev := Shared()
+	SetShared(s)
+	t.Cleanup(func() { SetShared(prev) })
+}
+
+func openRedis(t *testing.T, server *redistest.Server) *Redis {
+	t.Helper()
+	s, err := Open(config.RedisConfig{URL: server.URL(), Prefix: "test:"})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	r := s.(*Redis)
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	server := redistest.NewServer(t)
+
+	for name, s := range map[string]Store{"memory": NewMemory(), "redis": openRedis(t, server)} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Get(ctx, "greeting"); err != ErrMiss {
+				t.Errorf("Expected a miss, got %v", err)
+			}
+			s.Set(ctx, "greeting", []byte("hello"), time.Minute)
+			if v, err := s.Get(ctx, "greeting"); err != nil || string(v) != "hello" {
+				t.Errorf("Expected hello, got %q (%v)", v, err)
+			}
+			s.Delete(ctx, "greeting", "missing")
+			if _, err := s.Get(ctx, "greeting"); err != ErrMiss {
+				t.Errorf("Expected a deleted key to miss, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Redis keys are prefixed", func(t *testing.T) {
+		openRedis(t, server).Set(ctx, "greeting", []byte("hello"), time.Minute)
+		if keys := server.Keys(); len(keys) != 1 || keys[0] != "test:greeting" {
+			t.Errorf("Expected the key under the prefix, got %v", keys)
+		}
+	})
+
+	t.Run("Memory entries expire", func(t *testing.T) {
+		m := NewMemory()
+		now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+		m.now = func() time.Time { return now }
+		m.Set(ctx, "greeting", []byte("hello"), time.Minute)
+		now = now.Add(time.Minute)
+		if _, err := m.Get(ctx, "greeting"); err != ErrMiss {
+			t.Errorf("Expected an expired key to miss, got %v", err)
+		}
+	})
+}
+
+func TestGroup(t *testing.T) {
+	ctx := context.Background()
+	server := redistest.NewServer(t)
+	useStore(t, openRedis(t, server))
+
+	group := NewGroup("cameras", time.Minute)
+	db := map[string]string{"gate": "Gate"}
+	loads := 0
+	lookup := func(key string) string {
+		var name string
+		err := group.Load(ctx, key, &name, func() error {
+			loads++
+			name = db[key]
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		return name
+	}
+
+	lookup("gate")
+	if name := lookup("gate"); name != "Gate" || loads != 1 {
+		t.Errorf("Expected one load for two lookups, got %q after %d", name, loads)
+	}
+
+	db["gate"] = "North gate"
+	group.Invalidate(ctx)
+	if name := lookup("gate"); name != "North gate" {
+		t.Errorf("Expected the change after invalidating, got %q", name)
+	}
+
+	t.Run("Failed loads are not cached", func(t *testing.T) {
+		var name string
+		failed := errors.New("no such camera")
+		if err := group.Load(ctx, "market", &name, func() error { return failed }); err != failed {
+			t.Fatalf("Expected the load error, got %v", err)
+		}
+		if err := group.Load(ctx, "market", &name, func() error { name = "Market"; return nil }); err != nil || name != "Market" {
+			t.Errorf("Expected a second load, got %q (%v)", name, err)
+		}
+	})
+
+	t.Run("An unavailable store falls back to loading", func(t *testing.T) {
+		server.SetDown(true)
+		defer server.SetDown(false)
+		before := loads
+		if name := lookup("gate"); name != "North gate" || loads != before+1 {
+			t.Errorf("Expected a load, got %q after %d", name, loads-before)
+		}
+	})
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory()
+
+	if revoked, _ := Revoked(ctx, s, "token"); revoked {
+		t.Error("Expected a token not to start revoked")
+	}
+	Revoke(ctx, s, "token", time.Now().Add(time.Hour))
+	if revoked, _ := Revoked(ctx, s, "token"); !revoked {
+		t.Error("Expected the token revoked")
+	}
+	if revoked, _ := Revoked(ctx, s, "other"); revoked {
+		t.Error("Expected other tokens unaffected")
+	}
+
+	Revoke(ctx, s, "expired", time.Now().Add(-time.Hour))
+	if len(s.entries) != 1 {
+		t.Errorf("Expected an expired token not stored, got %d entries", len(s.entries))
+	}
+}
+
+func TestRateCounter(t *testing.T) {
+	ctx := context.Background()
+	r := openRedis(t, redistest.NewServer(t))
+	now := time.Date(2026, 3, 10, 12, 0, 10, 0, time.UTC)
+	public, auth := r.RateCounter("public"), r.RateCounter("auth")
+	public.now = func() time.Time { return now }
+	auth.now = public.now
+
+	for i := 1; i <= 3; i++ {
+		count, reset, err := public.Hit(ctx, "10.0.0.1", time.Minute)
+		if err != nil {
+			t.Fatalf("Hit failed: %v", err)
+		}
+		if count != i || reset != 50*time.Second {
+			t.Errorf("Expected hit %d with 50s left, got %d and %v", i, count, reset)
+		}
+	}
+	if count, _, _ := auth.Hit(ctx, "10.0.0.1", time.Minute); count != 1 {
+		t.Errorf("Expected limiters counted apart, got %d", count)
+	}
+	if count, _, _ := public.Hit(ctx, "10.0.0.2", time.Minute); count != 1 {
+		t.Errorf("Expected clients counted apart, got %d", count)
+	}
+
+	now = now.Add(time.Minute)
+	if count, _, _ := public.Hit(ctx, "10.0.0.1", time.Minute); count != 1 {
+		t.Errorf("Expected a new window to start over, got %d", count)
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Group caches entries that are invalidated together, such as lookups
+// by stream key that any camera change may affect. Entries are stored
+// under the group's current version; Invalidate drops the version, so
+// the old entries are no longer read and expire on their own.
+type Group struct {
+	name string
+	ttl  time.Duration
+}
+
+// NewGroup returns a group whose entries are kept at most ttl
+func NewGroup(name string, ttl time.Duration) *Group {
+	return &Group{name: name, ttl: ttl}
+}
+
+// Load reads key of the group into v, or on a miss calls load to fill
+// v and caches the result. When the store fails load is called and the
+// result not cached.
+func (g *Group) Load(ctx context.Context, key string, v interface{}, load func() error) error {
+	// The entry is stored under the version read before load ran: a
+	// change committed meanwhile invalidates it along with the rest
+	version, err := g.version(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("Cache unavailable", "group", g.name, "error", err)
+		return load()
+	}
+	key = g.name + ":" + version + ":" + key
+
+	err = GetJSON(ctx, Shared(), key, v)
+	if err == nil {
+		return nil
+	}
+	if err != ErrMiss {
+		logger.FromContext(ctx).Warn("Cache unavailable", "group", g.name, "error", err)
+		return load()
+	}
+
+	if err := load(); err != nil {
+		return err
+	}
+	if err := SetJSON(ctx, Shared(), key, v, g.ttl); err != nil {
+		logger.FromContext(ctx).Warn("Failed to cache", "group", g.name, "error", err)
+	}
+	return nil
+}
+
+// Invalidate drops every entry of the group. Call it after the change
+// is committed, so no read of the old data is cached under the new
+// version.
+func (g *Group) Invalidate(ctx context.Context) error {
+	return Shared().Delete(ctx, g.name+":version")
+}
+
+// version returns the group's current version, starting a new one when
+// there is none. Two instances starting one at once just cache a few
+// entries twice.
+func (g *Group) version(ctx context.Context) (string, error) {
+	s := Shared()
+	key := g.name + ":version"
+	value, err := s.Get(ctx, key)
+	if err == nil {
+		return string(value), nil
+	}
+	if err != ErrMiss {
+		return "", err
+	}
+
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	value = []byte(hex.EncodeToString(buf))
+	if err := s.Set(ctx, key, value, 0); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
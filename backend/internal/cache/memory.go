@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryPurgeEvery is how many writes pass between sweeps for expired
+// entries that were never read again
+const memoryPurgeEvery = 1024
+
+// Memory is a Store in this process
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	writes  int
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time // zero for no expiry
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]memoryEntry{}, now: time.Now}
+}
+
+func (m *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	if !e.expires.IsZero() && !m.now().Before(e.expires) {
+		delete(m.entries, key)
+		return nil, ErrMiss
+	}
+	return e.value, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	e := memoryEntry{value: value}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	m.entries[key] = e
+
+	m.writes++
+	if m.writes%memoryPurgeEvery == 0 {
+		for k, e := range m.entries {
+			if !e.expires.IsZero() && !now.Before(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/redis"
+)
+
+// Redis is a Store on a Redis server, shared by every instance using
+// the same server and prefix
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+// Close closes the idle connections to the server
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.client.Bytes(ctx, "GET", r.prefix+key)
+	if err == redis.ErrNil {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []interface{}{"SET", r.prefix + key, value}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	_, err := r.client.Do(ctx, args...)
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := []interface{}{"DEL"}
+	for _, key := range keys {
+		args = append(args, r.prefix+key)
+	}
+	_, err := r.client.Do(ctx, args...)
+	return err
+}
+
+// RateCounter counts requests per client in Redis, so a client gets one
+// limit however the load balancer spreads its requests. It satisfies
+// middleware.Counter.
+func (r *Redis) RateCounter(name string) *RateCounter {
+	return &RateCounter{redis: r, name: name, now: time.Now}
+}
+
+// RateCounter counts in fixed windows, one key per client and window
+// that expires with the window
+type RateCounter struct {
+	redis *Redis
+	name  string // keeps the counts of different limiters apart
+	now   func() time.Time
+}
+
+// Hit counts a request from client in the window it falls in, and
+// returns the count so far and the time until the window ends
+func (rc *RateCounter) Hit(ctx context.Context, client string, window time.Duration) (int, time.Duration, error) {
+	now := rc.now()
+	start := now.Truncate(window)
+	key := rc.redis.prefix + "rate:" + rc.name + ":" + strconv.FormatInt(start.Unix(), 10) + ":" + client
+
+	// Creating the key with its expiry first means an INCR never leaves
+	// a key that outlives its window
+	if _, err := rc.redis.client.Do(ctx, "SET", key, "0", "PX", window.Milliseconds(), "NX"); err != nil && err != redis.ErrNil {
+		return 0, 0, err
+	}
+	hits, err := rc.redis.client.Int(ctx, "INCR", key)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(hits), start.Add(window).Sub(now), nil
+}
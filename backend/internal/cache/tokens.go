@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Revoke marks a login token as logged out until it expires, after
+// which it is refused anyway. Only a hash of the token is stored.
+func Revoke(ctx context.Context, s Store, token string, expires time.Time) error {
+	ttl := time.Until(expires)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.Set(ctx, revokedKey(token), []byte{1}, ttl)
+}
+
+// Revoked reports whether token was logged out
+func Revoked(ctx context.Context, s Store, token string) (bool, error) {
+	_, err := s.Get(ctx, revokedKey(token))
+	switch err {
+	case nil:
+		return true, nil
+	case ErrMiss:
+		return false, nil
+	}
+	return false, err
+}
+
+func revokedKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "revoked:" + hex.EncodeToString(sum[:])
+}
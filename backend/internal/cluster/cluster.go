@@ -0,0 +1,280 @@
+// Package cluster lets several server instances run behind a load
+// balancer on one database. State a single process used to keep in
+// memory (rate limit counts, open streams per client) lives in shared
+// tables instead, and one instance at a time, the leader, runs the
+// periodic workers such as motion polling and retention cleanup.
+//
+// Leadership is a lease row in cluster_leases. Every instance
+// heartbeats its cluster_instances row and tries to take or renew the
+// lease each LeaseTTL/3; a leader that dies loses it after LeaseTTL. On
+// each renewal the leader also acts as the cluster's watchdog: it
+// forgets instances that stopped heartbeating, hands their running
+// jobs back to the queue and removes expired shared state.
+//
+// Without CLUSTER_MODE the node is a standalone leader and touches none
+// of these tables.
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// backgroundLease is held by the instance running the periodic workers
+const backgroundLease = "background"
+
+// rateLimitKeep is how long rate limit windows are kept; longer than
+// any limiter's window
+const rateLimitKeep = time.Hour
+
+// Sweeper is a cleanup the leader runs on every renewal. alive lists the
+// instances that heartbeated within the lease TTL, this one included.
+type Sweeper func(ctx context.Context, alive []string) error
+
+// Node is this instance's membership in the cluster
+type Node struct {
+	db        *sql.DB
+	id        string
+	ttl       time.Duration
+	clustered bool
+	now       func() time.Time
+
+	mu       sync.Mutex
+	leading  bool
+	changed  chan struct{} // closed and replaced when leading changes
+	sweepers []sweeper
+}
+
+type sweeper struct {
+	name string
+	fn   Sweeper
+}
+
+func New(db *sql.DB, cfg config.ClusterConfig) *Node {
+	return &Node{
+		db:        db,
+		id:        cfg.InstanceID,
+		ttl:       cfg.LeaseTTL,
+		clustered: cfg.Enabled,
+		now:       time.Now,
+		leading:   !cfg.Enabled,
+		changed:   make(chan struct{}),
+	}
+}
+
+// ID names this instance
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Clustered reports whether CLUSTER_MODE is on
+func (n *Node) Clustered() bool {
+	return n.clustered
+}
+
+// Leader reports whether this instance runs the periodic workers
+func (n *Node) Leader() bool {
+	leading, _ := n.state()
+	return leading
+}
+
+func (n *Node) state() (bool, <-chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leading, n.changed
+}
+
+func (n *Node) setLeading(leading bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.leading == leading {
+		return
+	}
+	n.leading = leading
+	close(n.changed)
+	n.changed = make(chan struct{})
+	if leading {
+		logger.Info("Became cluster leader", "instance", n.id)
+	} else {
+		logger.Warn("No longer cluster leader", "instance", n.id)
+	}
+}
+
+// Sweep registers a cleanup for the leader to run; register before Run
+func (n *Node) Sweep(name string, fn Sweeper) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sweepers = append(n.sweepers, sweeper{name: name, fn: fn})
+}
+
+// Join registers this instance and takes the lease if it is free. Call
+// it before starting the job queue, so the leader never takes this
+// instance's first jobs for those of a dead one.
+func (n *Node) Join(ctx context.Context) {
+	if n.clustered {
+		n.tick(ctx, n.ttl/3)
+	}
+}
+
+// Run heartbeats and competes for the lease until ctx is cancelled,
+// then gives the lease up so another instance takes over at once.
+// Start it with shutdown.Coordinator.Go; standalone it returns at once.
+func (n *Node) Run(ctx context.Context) {
+	if !n.clustered {
+		return
+	}
+
+	interval := n.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n.tick(ctx, interval)
+		select {
+		case <-ctx.Done():
+			n.setLeading(false)
+			n.leave()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick runs one round. A round that cannot confirm the lease steps
+// down: the lease may already be someone else's by the next one.
+func (n *Node) tick(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	now := n.now().UTC()
+	if _, err := n.db.ExecContext(ctx, `
+		INSERT INTO cluster_instances (id, started_at, last_seen_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET last_seen_at = excluded.last_seen_at
+	`, n.id, now, now); err != nil {
+		logger.Warn("Cluster heartbeat failed", "error", err)
+	}
+
+	leading, err := n.acquire(ctx, now)
+	if err != nil {
+		logger.Warn("Failed to renew cluster lease", "error", err)
+	}
+	n.setLeading(leading)
+	if leading {
+		n.sweep(ctx, now)
+	}
+}
+
+// acquire takes the lease when it is free or expired, or renews it
+func (n *Node) acquire(ctx context.Context, now time.Time) (bool, error) {
+	expires := now.Add(n.ttl)
+	if _, err := n.db.ExecContext(ctx, `
+		INSERT INTO cluster_leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO NOTHING
+	`, backgroundLease, n.id, expires); err != nil {
+		return false, err
+	}
+	result, err := n.db.ExecContext(ctx, `
+		UPDATE cluster_leases SET holder = ?, expires_at = ?
+		WHERE name = ? AND (holder = ? OR expires_at < ?)
+	`, n.id, expires, backgroundLease, n.id, now)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// sweep is the watchdog round of the leader
+func (n *Node) sweep(ctx context.Context, now time.Time) {
+	alive, err := n.alive(ctx, now)
+	if err != nil {
+		logger.Warn("Failed to list cluster instances", "error", err)
+		return
+	}
+
+	for _, q := range []struct {
+		name  string
+		query string
+		arg   interface{}
+	}{
+		{"instances", `DELETE FROM cluster_instances WHERE last_seen_at < ?`, now.Add(-n.ttl)},
+		{"stream sessions", `DELETE FROM stream_sessions WHERE expires_at < ?`, now},
+		{"rate limits", `DELETE FROM rate_limit_hits WHERE bucket < ?`, now.Add(-rateLimitKeep).Unix()},
+	} {
+		if _, err := n.db.ExecContext(ctx, q.query, q.arg); err != nil {
+			logger.Warn("Cluster cleanup failed", "table", q.name, "error", err)
+		}
+	}
+
+	n.mu.Lock()
+	sweepers := n.sweepers
+	n.mu.Unlock()
+	for _, s := range sweepers {
+		if err := s.fn(ctx, alive); err != nil {
+			logger.Warn("Cluster cleanup failed", "sweeper", s.name, "error", err)
+		}
+	}
+}
+
+func (n *Node) alive(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := n.db.QueryContext(ctx, `SELECT id FROM cluster_instances WHERE last_seen_at >= ?`, now.Add(-n.ttl))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// leave gives up the lease and the membership row on shutdown
+func (n *Node) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), n.ttl/3)
+	defer cancel()
+	if _, err := n.db.ExecContext(ctx, `DELETE FROM cluster_leases WHERE name = ? AND holder = ?`, backgroundLease, n.id); err != nil {
+		logger.Warn("Failed to release cluster lease", "error", err)
+	}
+	if _, err := n.db.ExecContext(ctx, `DELETE FROM cluster_instances WHERE id = ?`, n.id); err != nil {
+		logger.Warn("Failed to leave cluster", "error", err)
+	}
+}
+
+// Lead wraps a background worker for shutdown.Coordinator.Go so it only
+// runs on the leader: it is started when this instance takes the lease
+// and its context cancelled when the lease is lost. Standalone, the
+// worker simply runs.
+func (n *Node) Lead(run func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		for ctx.Err() == nil {
+			leading, changed := n.state()
+			if leading {
+				runCtx, cancel := context.WithCancel(ctx)
+				go func() {
+					select {
+					case <-changed:
+						cancel()
+					case <-runCtx.Done():
+					}
+				}()
+				run(runCtx)
+				cancel()
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-changed:
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+// clock is a shared fake time for the nodes of a test
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newNode(db *sql.DB, id string, c *clock) *Node {
+	n := New(db, config.ClusterConfig{Enabled: true, InstanceID: id, LeaseTTL: 30 * time.Second})
+	n.now = c.now
+	return n
+}
+
+func TestLeadership(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	c := &clock{time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	a, b := newNode(db, "web-1", c), newNode(db, "web-2", c)
+
+	t.Run("First instance leads", func(t *testing.T) {
+		a.Join(ctx)
+		b.Join(ctx)
+		if !a.Leader() || b.Leader() {
+			t.Fatalf("Expected web-1 alone to lead, got %v and %v", a.Leader(), b.Leader())
+		}
+	})
+
+	t.Run("Leader keeps the lease", func(t *testing.T) {
+		c.t = c.t.Add(10 * time.Second)
+		a.tick(ctx, time.Second)
+		b.tick(ctx, time.Second)
+		if !a.Leader() || b.Leader() {
+			t.Error("Expected web-1 to renew the lease")
+		}
+	})
+
+	t.Run("Lease expires with a dead leader", func(t *testing.T) {
+		c.t = c.t.Add(31 * time.Second)
+		b.tick(ctx, time.Second)
+		if !b.Leader() {
+			t.Fatal("Expected web-2 to take the expired lease")
+		}
+		a.tick(ctx, time.Second)
+		if a.Leader() {
+			t.Error("Expected web-1 to step down")
+		}
+	})
+
+	t.Run("Leaving hands the lease over", func(t *testing.T) {
+		b.leave()
+		a.tick(ctx, time.Second)
+		if !a.Leader() {
+			t.Error("Expected web-1 to lead once web-2 left")
+		}
+	})
+
+	t.Run("Standalone always leads", func(t *testing.T) {
+		n := New(db, config.ClusterConfig{InstanceID: "solo"})
+		n.Join(ctx)
+		if !n.Leader() {
+			t.Error("Expected a standalone node to lead")
+		}
+	})
+}
+
+func TestSweep(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	c := &clock{time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	leader, peer := newNode(db, "web-1", c), newNode(db, "web-2", c)
+	leader.Join(ctx)
+	peer.Join(ctx)
+	db.Exec(`INSERT INTO stream_sessions (id, client, instance_id, expires_at) VALUES ('hls 10.0.0.1 gate', '10.0.0.1', 'web-2', ?)`,
+		c.t.Add(time.Second))
+
+	var alive []string
+	leader.Sweep("test", func(ctx context.Context, ids []string) error {
+		alive = ids
+		return nil
+	})
+
+	// web-2 stops heartbeating
+	c.t = c.t.Add(31 * time.Second)
+	leader.tick(ctx, time.Second)
+
+	if len(alive) != 1 || alive[0] != "web-1" {
+		t.Errorf("Expected only web-1 alive, got %v", alive)
+	}
+	var instances, sessions int
+	db.QueryRow(`SELECT COUNT(*) FROM cluster_instances`).Scan(&instances)
+	db.QueryRow(`SELECT COUNT(*) FROM stream_sessions`).Scan(&sessions)
+	if instances != 1 || sessions != 0 {
+		t.Errorf("Expected the stopped instance and expired stream removed, got %d instances and %d streams", instances, sessions)
+	}
+}
+
+func TestLead(t *testing.T) {
+	db := dbtest.Open(t)
+	c := &clock{time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	a, b := newNode(db, "web-1", c), newNode(db, "web-2", c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.Join(ctx)
+
+	started := make(chan string, 4)
+	stopped := make(chan string, 4)
+	worker := func(name string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			started <- name
+			<-ctx.Done()
+			stopped <- name
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		a.Lead(worker("web-1"))(ctx)
+		close(done)
+	}()
+	go b.Lead(worker("web-2"))(ctx)
+
+	expect := func(ch chan string, want, what string) {
+		t.Helper()
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Errorf("Expected %s %s, got %s", want, what, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s %s", want, what)
+		}
+	}
+
+	expect(started, "web-2", "to start")
+	b.leave()
+	b.setLeading(false)
+	expect(stopped, "web-2", "to stop")
+
+	a.Join(ctx)
+	expect(started, "web-1", "to start")
+
+	cancel()
+	expect(stopped, "web-1", "to stop on shutdown")
+	<-done
+}
+
+func TestRateCounter(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 10, 12, 0, 10, 0, time.UTC)
+	public, auth := NewRateCounter(db, "public"), NewRateCounter(db, "auth")
+	public.now = func() time.Time { return now }
+	auth.now = public.now
+
+	for i := 1; i <= 3; i++ {
+		count, reset, err := public.Hit(ctx, "10.0.0.1", time.Minute)
+		if err != nil {
+			t.Fatalf("Hit failed: %v", err)
+		}
+		if count != i || reset != 50*time.Second {
+			t.Errorf("Expected hit %d with 50s left, got %d and %v", i, count, reset)
+		}
+	}
+	if count, _, _ := auth.Hit(ctx, "10.0.0.1", time.Minute); count != 1 {
+		t.Errorf("Expected limiters counted apart, got %d", count)
+	}
+	if count, _, _ := public.Hit(ctx, "10.0.0.2", time.Minute); count != 1 {
+		t.Errorf("Expected clients counted apart, got %d", count)
+	}
+
+	now = now.Add(time.Minute)
+	if count, _, _ := public.Hit(ctx, "10.0.0.1", time.Minute); count != 1 {
+		t.Errorf("Expected a new window to start over, got %d", count)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	a := NewSessions(ctx, db, "web-1", 30*time.Second)
+	b := NewSessions(ctx, db, "web-2", 30*time.Second)
+	a.now = func() time.Time { return now }
+	b.now = a.now
+
+	if !a.Watch("10.0.0.1", "gate", 3) || !b.Watch("10.0.0.1", "market", 3) {
+		t.Fatal("Expected the first streams to pass")
+	}
+	release, ok := b.Open("10.0.0.1", 3)
+	if !ok {
+		t.Fatal("Expected the third stream to pass")
+	}
+	if a.Watch("10.0.0.1", "square", 3) {
+		t.Error("Expected a fourth stream on another instance to be refused")
+	}
+	if !a.Watch("10.0.0.1", "market", 3) {
+		t.Error("Expected a stream already open to pass on any instance")
+	}
+	if !a.Watch("10.0.0.2", "square", 3) {
+		t.Error("Expected another address to have its own limit")
+	}
+
+	release()
+	release()
+	if !a.Watch("10.0.0.1", "square", 3) {
+		t.Error("Expected a released stream to free its slot")
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, ok := a.Open("10.0.0.1", 1); !ok {
+		t.Error("Expected idle HLS streams to expire")
+	}
+}
@@ -0,0 +1,39 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// RateCounter counts requests per client in rate_limit_hits, so a
+// client gets one limit however the load balancer spreads its requests.
+// It satisfies middleware.Counter.
+type RateCounter struct {
+	db   *sql.DB
+	name string // keeps the counts of different limiters apart
+	now  func() time.Time
+}
+
+func NewRateCounter(db *sql.DB, name string) *RateCounter {
+	return &RateCounter{db: db, name: name, now: time.Now}
+}
+
+// Hit counts a request from client in the fixed window it falls in, and
+// returns the count so far and the time until the window ends
+func (r *RateCounter) Hit(ctx context.Context, client string, window time.Duration) (int, time.Duration, error) {
+	now := r.now()
+	start := now.Truncate(window)
+
+	var hits int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_hits (key, bucket, hits) VALUES (?, ?, 1)
+		ON CONFLICT (key, bucket) DO UPDATE SET hits = rate_limit_hits.hits + 1
+		RETURNING hits
+	`, r.name+" "+strconv.FormatInt(int64(window/time.Second), 10)+" "+client, start.Unix()).Scan(&hits)
+	if err != nil {
+		return 0, 0, err
+	}
+	return hits, start.Add(window).Sub(now), nil
+}
@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// sessionTimeout bounds each stream_sessions query; a slow database
+// lets the stream through rather than holding the player up
+const sessionTimeout = 2 * time.Second
+
+// Sessions counts the streams each client IP has open across the
+// cluster, in stream_sessions. A stream is a row that expires idle
+// after it was last seen: HLS rows are refreshed by each request for
+// the stream, open MSE rows by this instance until they are released.
+// The count and the insert are separate queries, so clients racing
+// several instances can briefly exceed the cap by a stream or two.
+type Sessions struct {
+	db       *sql.DB
+	instance string
+	idle     time.Duration
+	now      func() time.Time
+}
+
+// NewSessions returns the shared stream count for instance. Open MSE
+// streams are kept alive until stopping is cancelled.
+func NewSessions(stopping context.Context, db *sql.DB, instance string, idle time.Duration) *Sessions {
+	s := &Sessions{db: db, instance: instance, idle: idle, now: time.Now}
+	go s.keepAlive(stopping)
+	return s
+}
+
+// Watch counts a request for HLS stream key from client. It returns
+// false when the stream is new and client already has max streams;
+// max 0 means no limit.
+func (s *Sessions) Watch(client, key string, max int) bool {
+	if max <= 0 {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sessionTimeout)
+	defer cancel()
+
+	id := "hls " + client + " " + key
+	now := s.now().UTC()
+	var open bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) > 0 FROM stream_sessions WHERE id = ? AND expires_at > ?
+	`, id, now).Scan(&open)
+	if err != nil {
+		logger.Warn("Failed to count streams", "error", err)
+		return true
+	}
+	if !open && !s.below(ctx, client, max, now) {
+		return false
+	}
+	s.touch(ctx, id, client, now)
+	return true
+}
+
+// Open counts an MSE stream from client until the returned release is
+// called. ok is false when client already has max streams.
+func (s *Sessions) Open(client string, max int) (release func(), ok bool) {
+	if max <= 0 {
+		return func() {}, true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sessionTimeout)
+	defer cancel()
+
+	now := s.now().UTC()
+	if !s.below(ctx, client, max, now) {
+		return nil, false
+	}
+
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	id := "mse " + hex.EncodeToString(buf)
+	s.touch(ctx, id, client, now)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), sessionTimeout)
+			defer cancel()
+			if _, err := s.db.ExecContext(ctx, `DELETE FROM stream_sessions WHERE id = ?`, id); err != nil {
+				logger.Warn("Failed to release stream", "error", err)
+			}
+		})
+	}, true
+}
+
+// below reports whether client has fewer than max streams open
+func (s *Sessions) below(ctx context.Context, client string, max int, now time.Time) bool {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM stream_sessions WHERE client = ? AND expires_at > ?
+	`, client, now).Scan(&n)
+	if err != nil {
+		logger.Warn("Failed to count streams", "error", err)
+		return true
+	}
+	return n < max
+}
+
+func (s *Sessions) touch(ctx context.Context, id, client string, now time.Time) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO stream_sessions (id, client, instance_id, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET instance_id = excluded.instance_id, expires_at = excluded.expires_at
+	`, id, client, s.instance, now.Add(s.idle))
+	if err != nil {
+		logger.Warn("Failed to record stream", "error", err)
+	}
+}
+
+// keepAlive pushes back the expiry of this instance's open MSE streams.
+// If the instance dies they expire on their own.
+func (s *Sessions) keepAlive(stopping context.Context) {
+	ticker := time.NewTicker(s.idle / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopping.Done():
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(stopping, sessionTimeout)
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE stream_sessions SET expires_at = ? WHERE instance_id = ? AND id LIKE 'mse %'
+		`, s.now().UTC().Add(s.idle), s.instance)
+		cancel()
+		if err != nil && stopping.Err() == nil {
+			logger.Warn("Failed to refresh open streams", "error", err)
+		}
+	}
+}
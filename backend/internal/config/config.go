@@ -1,29 +1,79 @@
 package config
 
 import (
-	"log"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Security SecurityConfig
-	Go2RTC Go2RTCConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Security  SecurityConfig
+	Go2RTC    Go2RTCConfig
+	TLS       TLSConfig
+	Recording RecordingConfig
+	Webhooks  WebhookConfig
+	Jobs      JobsConfig
+	HTTP      HTTPClientConfig
+	AccessLog AccessLogConfig
+	Motion    MotionConfig
+	Health    HealthConfig
+	Detection DetectionConfig
+	ANPR      ANPRConfig
+	Share     ShareConfig
+	Weather   WeatherConfig
+	Privacy   PrivacyConfig
+	Edge      EdgeConfig
+	Cluster   ClusterConfig
+	Redis     RedisConfig
+	Viewers   ViewersConfig
+	Alerting  AlertingConfig
+	Uploads   UploadConfig
+	Monitor   MonitorConfig
+	Tickets   TicketConfig
+	Reports   ReportConfig
+
+	// malformed lists variables that were set but did not parse, so
+	// Validate can report them instead of silently using the default
+	malformed []string
+
+	// mu guards the reloadable settings; see reload.go
+	mu       sync.RWMutex
+	onReload []func(*Config)
 }
 
 type ServerConfig struct {
-	Host string
-	Port string
-	Env  string
+	Host            string
+	Port            string
+	Env             string
+	LogLevel        string
+	ShutdownTimeout time.Duration // drain deadline for in-flight work
+	Compression     string        // off, speed, default or best
+	MetricsToken    string        // bearer token of /metrics; empty turns it off
 }
 
 type DatabaseConfig struct {
-	Path string
+	Driver       string // sqlite or postgres
+	Path         string // SQLite file
+	URL          string // Postgres DSN
+	QueryTimeout time.Duration
+	BusyTimeout  time.Duration // how long SQLite waits on a locked database
+
+	// SQLite file growth; see database.Housekeeping
+	CheckpointInterval time.Duration // between WAL checkpoints; 0: off
+	AutoVacuum         string        // none, full or incremental; empty keeps the file's
+	WALAlertMB         int           // alert when the WAL stays larger; 0: off
+	SizeAlertMB        int           // alert when the database file is larger; 0: off
+
+	// Pruned audit and activity logs are archived here; see
+	// internal/logretention
+	LogArchivePath string
 }
 
 type JWTConfig struct {
@@ -33,12 +83,287 @@ type JWTConfig struct {
 
 type SecurityConfig struct {
 	AllowedOrigins       string
+	// Origins per route group, in place of AllowedOrigins when set;
+	// see Config.CORSOrigins
+	CORSPublicOrigins    string
+	CORSStreamOrigins    string
+	CORSAdminOrigins     string
+	// Seconds browsers may cache a CORS preflight; the per group values
+	// replace CORSMaxAge when not -1, see Config.CORSMaxAge
+	CORSMaxAge           int
+	CORSPublicMaxAge     int
+	CORSStreamMaxAge     int
+	CORSAdminMaxAge      int
 	APIKeySecret         string
 	CSRFSecret           string
 	RateLimitPublic      int
 	RateLimitAuth        int
+	RateLimitSearch      int // GET /api/cameras/search, on top of RateLimitPublic
 	MaxLoginAttempts     int
 	LockoutDurationMins  int
+
+	// Response headers; see middleware.SecurityHeaders
+	Headers               bool
+	ContentSecurityPolicy string
+	CSPReportOnly         bool
+	EmbedFrameAncestors   string
+
+	// Lifetime of the tokens admins take to act as another user
+	ImpersonationTTL time.Duration
+}
+
+// TLSConfig enables HTTPS on the main listener, from certificate files
+// or certificates issued automatically through ACME (Let's Encrypt)
+type TLSConfig struct {
+	CertFile         string
+	KeyFile          string
+	AutocertDomains  []string
+	AutocertEmail    string
+	AutocertCacheDir string
+	RedirectAddr     string // plain-HTTP listener that redirects to HTTPS
+	HSTSMaxAge       int    // seconds; 0 disables the header
+}
+
+// Enabled reports whether the server should terminate TLS itself
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || len(t.AutocertDomains) > 0
+}
+
+type RecordingConfig struct {
+	Path       string // directory recordings are written to
+	FFmpegPath string // ffmpeg binary, for stills taken from recordings
+}
+
+// WebhookConfig POSTs finished recordings and saved event clips to a
+// video management or evidence system; an empty URL turns it off
+type WebhookConfig struct {
+	URL     string
+	Secret  string        // signs each request body
+	BaseURL string        // this API as the receiver reaches it, for download links
+	LinkTTL time.Duration // download links expire after this
+}
+
+type JobsConfig struct {
+	Workers int // background jobs run at once
+}
+
+// MotionConfig runs the motion detector, which compares go2rtc
+// snapshots of the cameras with motion detection turned on
+type MotionConfig struct {
+	Enabled     bool
+	Interval    time.Duration // between snapshots of a camera
+	Concurrency int           // snapshots fetched at once
+}
+
+// HealthConfig runs the camera health watchdog, which probes the cameras
+// not behind an edge node; see the watchdog package. The stream start
+// alerts are separate and stay on when the watchdog is off.
+type HealthConfig struct {
+	Enabled     bool
+	Interval    time.Duration // of probes that set none
+	Timeout     time.Duration // of probes that set none
+	Concurrency int           // probes run at once
+
+	StartAlert      time.Duration // p95 stream start latency that alerts; 0 turns it off
+	StartMinSamples int           // stream starts in the last hour before a camera is judged
+
+	TrafficSpikeFactor  float64 // times its usual hourly stream traffic that alerts; 0 turns it off
+	TrafficDropAlert    bool    // alert on a camera serving nothing in an hour when it usually does
+	TrafficMinMB        int     // hourly traffic, or usual traffic for drops, before either alert
+	TrafficBaselineDays int     // days whose same hour make a camera's usual traffic
+}
+
+// DetectionConfig sends frames where motion was detected to an external
+// object detection service; an empty URL turns it off
+type DetectionConfig struct {
+	URL           string
+	APIKey        string        // sent as a bearer token
+	Mode          string        // image (POST the JPEG) or url (POST a frame URL)
+	Timeout       time.Duration // per inference request
+	MinConfidence float64       // detections below this are dropped
+}
+
+// ANPRConfig controls licence plate reads from traffic cameras
+type ANPRConfig struct {
+	IngestKey     string // X-API-Key for POST /api/anpr/events; empty refuses ingest
+	RetentionDays int    // reads kept this long; 0 keeps them forever
+}
+
+// ShareConfig controls camera share links
+type ShareConfig struct {
+	SiteURL string // public site share links open; empty uses this server's address
+}
+
+// WeatherConfig fetches current conditions from OpenWeatherMap for the
+// public map; an empty APIKey turns it off
+type WeatherConfig struct {
+	APIKey       string
+	URL          string        // current weather endpoint
+	CacheTTL     time.Duration // conditions are reused this long
+	MaxLocations int           // looked up per request, map center first
+}
+
+// PrivacyConfig limits how long viewers' personal data is kept. Each is
+// a number of days; 0 keeps the data as it is.
+type PrivacyConfig struct {
+	ViewerSessionDays int // viewer_sessions rows deleted after this
+	FeedbackEmailDays int // feedback email addresses cleared after this
+	AnonymizeIPDays   int // stored IP addresses hashed after this
+
+	// ViewerMode is what viewer sessions keep of the client: off keeps
+	// the IP address and user agent, hash only a keyed hash of the
+	// address, drop neither
+	ViewerMode string
+}
+
+// EdgeConfig is read by the server for HeartbeatInterval and by
+// "server edge-agent" for the rest
+type EdgeConfig struct {
+	ServerURL         string // central server the agent connects to
+	Token             string // the agent's token from POST /api/admin/edge-nodes
+	Go2RTCURL         string // go2rtc at the agent's site
+	Tunnels           int    // idle tunnels the agent keeps open
+	HeartbeatInterval time.Duration
+}
+
+// ClusterConfig lets several instances run behind a load balancer on
+// one Postgres database; see internal/cluster
+type ClusterConfig struct {
+	Enabled    bool
+	InstanceID string        // names this instance in logs and cluster tables
+	LeaseTTL   time.Duration // how long the background lease outlives a dead leader
+}
+
+// RedisConfig points the shared caches at Redis; without a URL they
+// are kept in each process. See internal/cache.
+type RedisConfig struct {
+	URL    string // redis://[[user]:password@]host[:port][/db], rediss:// for TLS
+	Prefix string // put before every key, so deployments can share a server
+}
+
+// ViewersConfig batches the viewer session writes of
+// /api/stream/:streamKey/start, heartbeat and stop
+type ViewersConfig struct {
+	FlushInterval time.Duration // how often buffered session changes are written
+	MaxPending    int           // sessions buffered before a flush is started early
+}
+
+// MonitorConfig samples the resources of this instance for the admin
+// dashboard; see internal/sysmon
+type MonitorConfig struct {
+	Interval time.Duration // between samples
+	History  int           // samples kept for charts
+}
+
+// UploadConfig is where uploaded images are kept: a directory, or an
+// S3-compatible bucket; see internal/uploads
+type UploadConfig struct {
+	Storage     string // dir or s3
+	Path        string // directory of the dir storage
+	PublicURL   string // base URL the files are linked at; empty serves them from /api/public/uploads
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+// AlertingConfig configures camera health notifications (see
+// internal/alerting). A channel without its settings is not used.
+type AlertingConfig struct {
+	Interval time.Duration // how often camera health is checked
+
+	TelegramAPIURL   string
+	TelegramBotToken string
+	TelegramChatID   string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	EmailTo      string // comma-separated
+
+	// SMS and WhatsApp go through a gateway that takes a JSON POST of
+	// {"to", "text"}
+	SMSURL      string
+	SMSTo       string
+	WhatsAppURL string
+	WhatsAppTo  string
+
+	// ntfy and Gotify are push notifications to a phone app, without a
+	// mail server or bot to set up
+	NtfyURL     string
+	NtfyTopic   string
+	NtfyToken   string // access token, for a server or topic that needs one
+	GotifyURL   string
+	GotifyToken string // application token
+
+	// AlertmanagerToken is the bearer token Alertmanager sends to
+	// /api/integrations/alertmanager; empty turns the receiver off
+	AlertmanagerToken string
+}
+
+// ReportConfig schedules the nightly summary report of the day before
+// (see internal/reports). It is built once Hour has passed in Timezone
+// and sent on Channels, those of the alert channels that are
+// configured; with none it is only archived.
+type ReportConfig struct {
+	Hour     int
+	Timezone string
+	Channels []string
+}
+
+// TicketConfig opens a maintenance ticket for a camera offline longer
+// than After and closes it when the camera is back (see
+// internal/ticketing). Provider is webhook, jira or email; empty turns
+// tickets off.
+type TicketConfig struct {
+	Provider string
+	After    time.Duration
+
+	// webhook: a JSON POST signed like the recording webhooks
+	WebhookURL    string
+	WebhookSecret string
+
+	// jira: issues created through the REST API with an API token
+	JiraURL            string
+	JiraEmail          string
+	JiraToken          string
+	JiraProject        string // project key
+	JiraIssueType      string
+	JiraDoneTransition string // the transition that closes an issue
+
+	// email: sent with the SMTP settings of the alerts
+	EmailTo string // comma-separated
+}
+
+// AccessLogConfig selects where requests are recorded for later
+// queries; the console access log is always on
+type AccessLogConfig struct {
+	Sink          string // off, database or file
+	Path          string // file sink
+	MaxSizeMB     int    // file sink: rotate past this size
+	MaxBackups    int    // file sink: rotated files kept
+	RetentionDays int    // database sink: rows kept this long
+}
+
+// HTTPClientConfig configures outbound requests (go2rtc, webhooks,
+// Telegram)
+type HTTPClientConfig struct {
+	Timeout            time.Duration // connect and wait for response headers
+	MaxIdleConns       int
+	Proxy              string // empty uses HTTP_PROXY/HTTPS_PROXY
+	InsecureSkipVerify bool   // accept self-signed certificates
+}
+
+func (c HTTPClientConfig) Options() httpclient.Options {
+	return httpclient.Options{
+		Timeout:            c.Timeout,
+		MaxIdleConns:       c.MaxIdleConns,
+		Proxy:              c.Proxy,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
 }
 
 type Go2RTCConfig struct {
@@ -46,45 +371,314 @@ type Go2RTCConfig struct {
 	HLSURLInternal      string
 	HLSURLPublic        string
 	PublicStreamBaseURL string
+	ProxyTimeout        time.Duration
+
+	// The circuit breaker opens after BreakerFailures consecutive
+	// failed upstream calls and probes again after BreakerCooldown
+	BreakerFailures int
+	BreakerCooldown time.Duration
+
+	// Stream URLs from POST /api/stream/multiview are signed and stop
+	// working after SignedURLTTL; one call takes up to MultiviewMax
+	// stream keys. With SignedURLsRequired the stream routes refuse
+	// unsigned URLs, and GET /api/stream/:streamKey signs its URLs too.
+	SignedURLTTL       time.Duration
+	MultiviewMax       int
+	SignedURLsRequired bool
+
+	// MaxSessionsPerIP caps the streams one client IP has open across
+	// all cameras; 0 or less disables the cap
+	MaxSessionsPerIP int
+
+	// Public players fetch an anonymous token that works for
+	// PlayerTokenTTL. With PlayerTokenRequired the stream routes refuse
+	// requests without one. A token may make PlayerTokenRequests
+	// requests a minute; 0 or less disables the cap
+	PlayerTokenRequired bool
+	PlayerTokenTTL      time.Duration
+	PlayerTokenRequests int
+
+	// A client IP that fetches more than AbusePlaylists playlists, or
+	// plays more than AbuseCameras cameras, within AbuseWindow is banned
+	// from the streams for AbuseBan; 0 turns a check off
+	AbuseWindow    time.Duration
+	AbusePlaylists int
+	AbuseCameras   int
+	AbuseBan       time.Duration
+
+	// Nodes are secondary go2rtc instances, on other boxes; a camera
+	// whose stream_node names one is played and provisioned there
+	// instead of at APIURL
+	Nodes []StreamNode
+}
+
+// StreamNode is a secondary go2rtc from STREAM_NODES. Username and
+// Password, when set, are sent as basic auth on every request to it.
+type StreamNode struct {
+	Name     string
+	APIURL   string
+	Username string
+	Password string
+}
+
+// Node returns the stream node called name
+func (g Go2RTCConfig) Node(name string) (StreamNode, bool) {
+	for _, node := range g.Nodes {
+		if node.Name == name {
+			return node, true
+		}
+	}
+	return StreamNode{}, false
 }
 
 func Load() *Config {
 	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+	loadEnvFile()
+	
+	env := getEnv("NODE_ENV", "development")
+	
+	// Development favours readable responses and a CSP that reports
+	// instead of breaking the Vite dev server
+	compression := "default"
+	if env == "development" {
+		compression = "off"
 	}
 	
-	return &Config{
+	malformedEnv = nil
+	
+	cfg := &Config{
 		Server: ServerConfig{
-			Host: getEnv("HOST", "0.0.0.0"),
-			Port: getEnv("PORT", "3000"),
-			Env:  getEnv("NODE_ENV", "development"),
+			Host:            getEnv("HOST", "0.0.0.0"),
+			Port:            getEnv("PORT", "3000"),
+			Env:             env,
+			LogLevel:        getEnv("LOG_LEVEL", ""),
+			ShutdownTimeout: time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30)) * time.Second,
+			Compression:     getEnv("COMPRESSION", compression),
+			MetricsToken:    getEnv("METRICS_TOKEN", ""),
 		},
 		Database: DatabaseConfig{
-			Path: getEnv("DATABASE_PATH", "./data/cctv.db"),
+			Driver:             getEnv("DATABASE_DRIVER", "sqlite"),
+			Path:               getEnv("DATABASE_PATH", "./data/cctv.db"),
+			URL:                getEnv("DATABASE_URL", ""),
+			QueryTimeout:       time.Duration(getEnvInt("DB_QUERY_TIMEOUT_SECONDS", 10)) * time.Second,
+			BusyTimeout:        time.Duration(getEnvInt("DB_BUSY_TIMEOUT_MS", 5000)) * time.Millisecond,
+			CheckpointInterval: time.Duration(getEnvInt("DB_CHECKPOINT_INTERVAL_MINUTES", 5)) * time.Minute,
+			AutoVacuum:         getEnv("DB_AUTO_VACUUM", ""),
+			WALAlertMB:         getEnvInt("DB_WAL_ALERT_MB", 512),
+			SizeAlertMB:        getEnvInt("DB_SIZE_ALERT_MB", 0),
+			LogArchivePath:     getEnv("LOG_ARCHIVE_PATH", "./data/log-archive"),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "change-this-secret"),
+			Secret:     getEnv("JWT_SECRET", defaultJWTSecret),
 			Expiration: getEnv("JWT_EXPIRATION", "1h"),
 		},
 		Security: SecurityConfig{
-			AllowedOrigins:      getEnv("ALLOWED_ORIGINS", "http://localhost:5173"),
-			APIKeySecret:        getEnv("API_KEY_SECRET", ""),
-			CSRFSecret:          getEnv("CSRF_SECRET", ""),
-			RateLimitPublic:     getEnvInt("RATE_LIMIT_PUBLIC", 100),
-			RateLimitAuth:       getEnvInt("RATE_LIMIT_AUTH", 30),
-			MaxLoginAttempts:    getEnvInt("MAX_LOGIN_ATTEMPTS", 5),
-			LockoutDurationMins: getEnvInt("LOCKOUT_DURATION_MINUTES", 30),
+			AllowedOrigins:        getEnv("ALLOWED_ORIGINS", "http://localhost:5173"),
+			CORSPublicOrigins:     getEnv("CORS_PUBLIC_ORIGINS", ""),
+			CORSStreamOrigins:     getEnv("CORS_STREAM_ORIGINS", ""),
+			CORSAdminOrigins:      getEnv("CORS_ADMIN_ORIGINS", ""),
+			CORSMaxAge:            getEnvInt("CORS_MAX_AGE", 600),
+			CORSPublicMaxAge:      getEnvInt("CORS_PUBLIC_MAX_AGE", -1),
+			CORSStreamMaxAge:      getEnvInt("CORS_STREAM_MAX_AGE", -1),
+			CORSAdminMaxAge:       getEnvInt("CORS_ADMIN_MAX_AGE", -1),
+			APIKeySecret:          getEnv("API_KEY_SECRET", ""),
+			CSRFSecret:            getEnv("CSRF_SECRET", ""),
+			RateLimitPublic:       getEnvInt("RATE_LIMIT_PUBLIC", 100),
+			RateLimitAuth:         getEnvInt("RATE_LIMIT_AUTH", 30),
+			RateLimitSearch:       getEnvInt("RATE_LIMIT_SEARCH", 20),
+			MaxLoginAttempts:      getEnvInt("MAX_LOGIN_ATTEMPTS", 5),
+			LockoutDurationMins:   getEnvInt("LOCKOUT_DURATION_MINUTES", 30),
+			Headers:               getEnvBool("SECURITY_HEADERS", true),
+			ContentSecurityPolicy: getEnv("CONTENT_SECURITY_POLICY", ""),
+			CSPReportOnly:         getEnvBool("CSP_REPORT_ONLY", env == "development"),
+			EmbedFrameAncestors:   getEnv("EMBED_FRAME_ANCESTORS", "*"),
+			ImpersonationTTL:      time.Duration(getEnvInt("IMPERSONATION_TTL_MINUTES", 15)) * time.Minute,
 		},
 		Go2RTC: Go2RTCConfig{
 			APIURL:              getEnv("GO2RTC_API_URL", "http://localhost:1984"),
 			HLSURLInternal:      getEnv("GO2RTC_HLS_URL_INTERNAL", "http://localhost:8888"),
 			HLSURLPublic:        getEnv("PUBLIC_HLS_PATH", "/hls"),
 			PublicStreamBaseURL: getEnv("PUBLIC_STREAM_BASE_URL", "http://localhost:8090"),
+			ProxyTimeout:        time.Duration(getEnvInt("GO2RTC_PROXY_TIMEOUT_SECONDS", 15)) * time.Second,
+			BreakerFailures:     getEnvInt("GO2RTC_BREAKER_FAILURES", 5),
+			BreakerCooldown:     time.Duration(getEnvInt("GO2RTC_BREAKER_COOLDOWN_SECONDS", 10)) * time.Second,
+			SignedURLTTL:        time.Duration(getEnvInt("STREAM_URL_TTL_MINUTES", 60)) * time.Minute,
+			MultiviewMax:        getEnvInt("STREAM_MULTIVIEW_MAX", 16),
+			SignedURLsRequired:  getEnvBool("STREAM_SIGNED_URLS_REQUIRED", false),
+			MaxSessionsPerIP:    getEnvInt("STREAM_MAX_SESSIONS_PER_IP", 20),
+			PlayerTokenRequired: getEnvBool("STREAM_TOKEN_REQUIRED", false),
+			PlayerTokenTTL:      time.Duration(getEnvInt("STREAM_TOKEN_TTL_MINUTES", 15)) * time.Minute,
+			PlayerTokenRequests: getEnvInt("STREAM_TOKEN_REQUESTS_PER_MINUTE", 1200),
+			AbuseWindow:         time.Duration(getEnvInt("STREAM_ABUSE_WINDOW_SECONDS", 60)) * time.Second,
+			AbusePlaylists:      getEnvInt("STREAM_ABUSE_PLAYLISTS", 1500),
+			AbuseCameras:        getEnvInt("STREAM_ABUSE_CAMERAS", 40),
+			AbuseBan:            time.Duration(getEnvInt("STREAM_ABUSE_BAN_MINUTES", 60)) * time.Minute,
+			Nodes:               getStreamNodes(),
+		},
+		TLS: TLSConfig{
+			CertFile:         getEnv("TLS_CERT_FILE", ""),
+			KeyFile:          getEnv("TLS_KEY_FILE", ""),
+			AutocertDomains:  getEnvList("TLS_AUTOCERT_DOMAINS"),
+			AutocertEmail:    getEnv("TLS_AUTOCERT_EMAIL", ""),
+			AutocertCacheDir: getEnv("TLS_AUTOCERT_CACHE_DIR", "./data/certs"),
+			RedirectAddr:     getEnv("TLS_REDIRECT_ADDR", ""),
+			HSTSMaxAge:       getEnvInt("HSTS_MAX_AGE_SECONDS", 31536000),
+		},
+		Recording: RecordingConfig{
+			Path:       getEnv("RECORDINGS_PATH", "./recordings"),
+			FFmpegPath: getEnv("FFMPEG_PATH", "ffmpeg"),
+		},
+		Webhooks: WebhookConfig{
+			URL:     getEnv("RECORDING_WEBHOOK_URL", ""),
+			Secret:  getEnv("RECORDING_WEBHOOK_SECRET", ""),
+			BaseURL: strings.TrimSuffix(getEnv("RECORDING_WEBHOOK_BASE_URL", ""), "/"),
+			LinkTTL: time.Duration(getEnvInt("RECORDING_WEBHOOK_LINK_HOURS", 24)) * time.Hour,
+		},
+		Jobs: JobsConfig{
+			Workers: getEnvInt("JOB_WORKERS", 4),
+		},
+		Motion: MotionConfig{
+			Enabled:     getEnvBool("MOTION_ENABLED", false),
+			Interval:    time.Duration(getEnvInt("MOTION_INTERVAL_SECONDS", 5)) * time.Second,
+			Concurrency: getEnvInt("MOTION_CONCURRENCY", 4),
+		},
+		Health: HealthConfig{
+			Enabled:     getEnvBool("HEALTH_CHECK_ENABLED", true),
+			Interval:    time.Duration(getEnvInt("HEALTH_CHECK_INTERVAL_SECONDS", 30)) * time.Second,
+			Timeout:     time.Duration(getEnvInt("HEALTH_CHECK_TIMEOUT_SECONDS", 5)) * time.Second,
+			Concurrency: getEnvInt("HEALTH_CHECK_CONCURRENCY", 8),
+
+			StartAlert:      time.Duration(getEnvInt("STREAM_START_ALERT_MS", 5000)) * time.Millisecond,
+			StartMinSamples: getEnvInt("STREAM_START_MIN_SAMPLES", 10),
+
+			TrafficSpikeFactor:  getEnvFloat("STREAM_TRAFFIC_SPIKE_FACTOR", 5),
+			TrafficDropAlert:    getEnvBool("STREAM_TRAFFIC_DROP_ALERT", true),
+			TrafficMinMB:        getEnvInt("STREAM_TRAFFIC_ALERT_MIN_MB", 100),
+			TrafficBaselineDays: getEnvInt("STREAM_TRAFFIC_BASELINE_DAYS", 7),
+		},
+		Detection: DetectionConfig{
+			URL:           getEnv("DETECTION_URL", ""),
+			APIKey:        getEnv("DETECTION_API_KEY", ""),
+			Mode:          getEnv("DETECTION_MODE", "image"),
+			Timeout:       time.Duration(getEnvInt("DETECTION_TIMEOUT_SECONDS", 15)) * time.Second,
+			MinConfidence: getEnvFloat("DETECTION_MIN_CONFIDENCE", 0.5),
+		},
+		ANPR: ANPRConfig{
+			IngestKey:     getEnv("ANPR_INGEST_KEY", ""),
+			RetentionDays: getEnvInt("ANPR_RETENTION_DAYS", 90),
+		},
+		Share: ShareConfig{
+			SiteURL: strings.TrimSuffix(getEnv("SHARE_SITE_URL", ""), "/"),
+		},
+		Weather: WeatherConfig{
+			APIKey:       getEnv("WEATHER_API_KEY", ""),
+			URL:          getEnv("WEATHER_URL", "https://api.openweathermap.org/data/2.5/weather"),
+			CacheTTL:     time.Duration(getEnvInt("WEATHER_CACHE_MINUTES", 10)) * time.Minute,
+			MaxLocations: getEnvInt("WEATHER_MAX_LOCATIONS", 20),
+		},
+		Privacy: PrivacyConfig{
+			ViewerSessionDays: getEnvInt("VIEWER_SESSION_RETENTION_DAYS", 90),
+			FeedbackEmailDays: getEnvInt("FEEDBACK_EMAIL_RETENTION_DAYS", 365),
+			AnonymizeIPDays:   getEnvInt("ANONYMIZE_IP_AFTER_DAYS", 30),
+			ViewerMode:        strings.ToLower(getEnv("VIEWER_PRIVACY_MODE", "off")),
+		},
+		Edge: EdgeConfig{
+			ServerURL:         getEnv("EDGE_SERVER_URL", ""),
+			Token:             getEnv("EDGE_TOKEN", ""),
+			Go2RTCURL:         getEnv("EDGE_GO2RTC_URL", "http://localhost:1984"),
+			Tunnels:           getEnvInt("EDGE_TUNNELS", 4),
+			HeartbeatInterval: time.Duration(getEnvInt("EDGE_HEARTBEAT_SECONDS", 30)) * time.Second,
+		},
+		Cluster: ClusterConfig{
+			Enabled:    getEnvBool("CLUSTER_MODE", false),
+			InstanceID: getEnv("INSTANCE_ID", hostname()),
+			LeaseTTL:   time.Duration(getEnvInt("CLUSTER_LEASE_SECONDS", 30)) * time.Second,
+		},
+		Redis: RedisConfig{
+			URL:    getEnv("REDIS_URL", ""),
+			Prefix: getEnv("REDIS_PREFIX", "cctv:"),
+		},
+		Viewers: ViewersConfig{
+			FlushInterval: time.Duration(getEnvInt("VIEWER_FLUSH_SECONDS", 5)) * time.Second,
+			MaxPending:    getEnvInt("VIEWER_FLUSH_MAX_PENDING", 1000),
+		},
+		Alerting: AlertingConfig{
+			Interval:         time.Duration(getEnvInt("ALERT_CHECK_SECONDS", 30)) * time.Second,
+			TelegramAPIURL:   getEnv("TELEGRAM_API_URL", "https://api.telegram.org"),
+			TelegramBotToken: getEnv("TELEGRAM_BOT_TOKEN", ""),
+			TelegramChatID:   getEnv("TELEGRAM_CHAT_ID", ""),
+			SMTPHost:         getEnv("SMTP_HOST", ""),
+			SMTPPort:         getEnvInt("SMTP_PORT", 587),
+			SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+			SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+			SMTPFrom:         getEnv("SMTP_FROM", ""),
+			EmailTo:          getEnv("ALERT_EMAIL_TO", ""),
+			SMSURL:           getEnv("ALERT_SMS_URL", ""),
+			SMSTo:            getEnv("ALERT_SMS_TO", ""),
+			WhatsAppURL:      getEnv("ALERT_WHATSAPP_URL", ""),
+			WhatsAppTo:       getEnv("ALERT_WHATSAPP_TO", ""),
+			NtfyURL:          getEnv("NTFY_URL", "https://ntfy.sh"),
+			NtfyTopic:        getEnv("NTFY_TOPIC", ""),
+			NtfyToken:        getEnv("NTFY_TOKEN", ""),
+			GotifyURL:        getEnv("GOTIFY_URL", ""),
+			GotifyToken:      getEnv("GOTIFY_TOKEN", ""),
+			AlertmanagerToken: getEnv("ALERTMANAGER_TOKEN", ""),
+		},
+		Tickets: TicketConfig{
+			Provider:           strings.ToLower(getEnv("TICKET_PROVIDER", "")),
+			After:              time.Duration(getEnvInt("TICKET_AFTER_MINUTES", 30)) * time.Minute,
+			WebhookURL:         getEnv("TICKET_WEBHOOK_URL", ""),
+			WebhookSecret:      getEnv("TICKET_WEBHOOK_SECRET", ""),
+			JiraURL:            strings.TrimSuffix(getEnv("JIRA_URL", ""), "/"),
+			JiraEmail:          getEnv("JIRA_EMAIL", ""),
+			JiraToken:          getEnv("JIRA_API_TOKEN", ""),
+			JiraProject:        getEnv("JIRA_PROJECT", ""),
+			JiraIssueType:      getEnv("JIRA_ISSUE_TYPE", "Task"),
+			JiraDoneTransition: getEnv("JIRA_DONE_TRANSITION", "Done"),
+			EmailTo:            getEnv("TICKET_EMAIL_TO", ""),
+		},
+		Reports: ReportConfig{
+			Hour:     getEnvInt("REPORT_HOUR", 1),
+			Timezone: getEnv("REPORT_TIMEZONE", "Asia/Jakarta"),
+			Channels: getReportChannels(),
+		},
+		Monitor: MonitorConfig{
+			Interval: time.Duration(getEnvInt("SYSTEM_MONITOR_SECONDS", 5)) * time.Second,
+			History:  getEnvInt("SYSTEM_MONITOR_HISTORY", 120),
+		},
+		Uploads: UploadConfig{
+			Storage:     getEnv("UPLOAD_STORAGE", "dir"),
+			Path:        getEnv("UPLOAD_PATH", "./data/uploads"),
+			PublicURL:   getEnv("UPLOAD_PUBLIC_URL", ""),
+			S3Endpoint:  getEnv("UPLOAD_S3_ENDPOINT", ""),
+			S3Region:    getEnv("UPLOAD_S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("UPLOAD_S3_BUCKET", ""),
+			S3AccessKey: getEnv("UPLOAD_S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("UPLOAD_S3_SECRET_KEY", ""),
+		},
+		AccessLog: AccessLogConfig{
+			Sink:          getEnv("ACCESS_LOG_SINK", "off"),
+			Path:          getEnv("ACCESS_LOG_PATH", "./logs/access.log"),
+			MaxSizeMB:     getEnvInt("ACCESS_LOG_MAX_SIZE_MB", 100),
+			MaxBackups:    getEnvInt("ACCESS_LOG_MAX_BACKUPS", 5),
+			RetentionDays: getEnvInt("ACCESS_LOG_RETENTION_DAYS", 14),
+		},
+		HTTP: HTTPClientConfig{
+			Timeout:            time.Duration(getEnvInt("HTTP_CLIENT_TIMEOUT_SECONDS", 10)) * time.Second,
+			MaxIdleConns:       getEnvInt("HTTP_CLIENT_MAX_IDLE_CONNS", 100),
+			Proxy:              getEnv("OUTBOUND_PROXY", ""),
+			InsecureSkipVerify: getEnvBool("HTTP_CLIENT_INSECURE_SKIP_VERIFY", false),
 		},
 	}
+	cfg.malformed = malformedEnv
+	
+	return cfg
 }
 
+// malformedEnv collects keys getEnvInt and getEnvBool could not parse
+// while Load runs
+var malformedEnv []string
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -92,11 +686,82 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// hostname is the default instance ID; containers get a unique one
+func hostname() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "cctv"
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getReportChannels reads REPORT_CHANNELS, telegram and email when it
+// is not set; "none" sends no reports
+func getReportChannels() []string {
+	if os.Getenv("REPORT_CHANNELS") == "" {
+		return []string{"telegram", "email"}
+	}
+	var channels []string
+	for _, name := range getEnvList("REPORT_CHANNELS") {
+		if name = strings.ToLower(name); name != "none" {
+			channels = append(channels, name)
+		}
+	}
+	return channels
+}
+
+// getStreamNodes reads STREAM_NODES, name=url pairs separated by
+// commas, and each node's STREAM_NODE_<NAME>_USERNAME and _PASSWORD. An
+// entry without a URL is kept for Validate to report.
+func getStreamNodes() []StreamNode {
+	var nodes []StreamNode
+	for _, entry := range getEnvList("STREAM_NODES") {
+		name, apiURL, _ := strings.Cut(entry, "=")
+		node := StreamNode{Name: strings.TrimSpace(name), APIURL: strings.TrimSpace(apiURL)}
+		prefix := "STREAM_NODE_" + strings.ToUpper(strings.ReplaceAll(node.Name, "-", "_"))
+		node.Username = os.Getenv(prefix + "_USERNAME")
+		node.Password = os.Getenv(prefix + "_PASSWORD")
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+		malformedEnv = append(malformedEnv, key)
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+		malformedEnv = append(malformedEnv, key)
+	}
+	return defaultValue
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intVal, err := strconv.Atoi(value); err == nil {
 			return intVal
 		}
+		malformedEnv = append(malformedEnv, key)
 	}
 	return defaultValue
 }
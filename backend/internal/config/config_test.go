@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -23,6 +24,10 @@ func TestLoadConfig(t *testing.T) {
 		if cfg.Server.Env != "development" {
 			t.Errorf("Expected default env 'development', got '%s'", cfg.Server.Env)
 		}
+
+		if cfg.Database.QueryTimeout != 10*time.Second {
+			t.Errorf("Expected default query timeout 10s, got %s", cfg.Database.QueryTimeout)
+		}
 	})
 
 	t.Run("Load with environment variables", func(t *testing.T) {
@@ -108,6 +113,30 @@ func TestLoadConfig(t *testing.T) {
 		// Cleanup
 		os.Clearenv()
 	})
+
+	t.Run("Stream nodes", func(t *testing.T) {
+		os.Setenv("STREAM_NODES", "north=http://10.0.2.5:1984, east-2=http://10.0.3.5:1984")
+		os.Setenv("STREAM_NODE_EAST_2_USERNAME", "admin")
+		os.Setenv("STREAM_NODE_EAST_2_PASSWORD", "secret")
+
+		cfg := Load()
+
+		if len(cfg.Go2RTC.Nodes) != 2 {
+			t.Fatalf("Expected 2 stream nodes, got %+v", cfg.Go2RTC.Nodes)
+		}
+		if node, ok := cfg.Go2RTC.Node("north"); !ok || node.APIURL != "http://10.0.2.5:1984" || node.Username != "" {
+			t.Errorf("Expected node north without credentials, got %+v", node)
+		}
+		if node, ok := cfg.Go2RTC.Node("east-2"); !ok || node.Username != "admin" || node.Password != "secret" {
+			t.Errorf("Expected node east-2 with its credentials, got %+v", node)
+		}
+		if _, ok := cfg.Go2RTC.Node("west"); ok {
+			t.Error("Expected no node west")
+		}
+
+		// Cleanup
+		os.Clearenv()
+	})
 }
 
 func TestGetEnv(t *testing.T) {
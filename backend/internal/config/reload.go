@@ -0,0 +1,228 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+// Settings that can change while the server runs live in the Config
+// fields below and are guarded by Config.mu. Code that runs per request
+// reads them through the accessors; everything else in Config is fixed
+// at startup.
+//
+//	Server.LogLevel
+//	Security.AllowedOrigins, CORS*Origins, CORS*MaxAge, RateLimitPublic,
+//	RateLimitAuth, RateLimitSearch
+//	Go2RTC.APIURL, HLSURLInternal, HLSURLPublic, PublicStreamBaseURL,
+//	MaxSessionsPerIP, AbusePlaylists, AbuseCameras, PlayerTokenRequests
+
+// startupEnv records which variables the process was started with, so a
+// reload lets .env change everything else but never overrides them
+var startupEnv map[string]bool
+
+// reloadMu serializes reloads; Load writes package state and the
+// process environment
+var reloadMu sync.Mutex
+
+// loadEnvFile copies .env into the environment without replacing
+// variables set by the process environment, like godotenv.Load, but can
+// run again to pick up edits
+func loadEnvFile() {
+	if startupEnv == nil {
+		startupEnv = map[string]bool{}
+		for _, kv := range os.Environ() {
+			key, _, _ := strings.Cut(kv, "=")
+			startupEnv[key] = true
+		}
+	}
+
+	values, err := godotenv.Read()
+	if err != nil {
+		log.Println("No .env file found, using environment variables")
+		return
+	}
+	for key, value := range values {
+		if !startupEnv[key] {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+// Stream returns the current go2rtc settings
+func (c *Config) Stream() Go2RTCConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Go2RTC
+}
+
+// Route groups with their own CORS origins
+const (
+	CORSPublic = "public" // Unauthenticated pages such as the camera list
+	CORSStream = "stream" // Players and viewer sessions
+	CORSAdmin  = "admin"  // Everything else, including the dashboard APIs
+)
+
+// AllowedOrigins returns the current CORS origins
+func (c *Config) AllowedOrigins() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return splitOrigins(c.Security.AllowedOrigins)
+}
+
+// CORSOrigins returns the current CORS origins of a route group: its
+// CORS_<GROUP>_ORIGINS when set, else ALLOWED_ORIGINS
+func (c *Config) CORSOrigins(group string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var origins string
+	switch group {
+	case CORSPublic:
+		origins = c.Security.CORSPublicOrigins
+	case CORSStream:
+		origins = c.Security.CORSStreamOrigins
+	case CORSAdmin:
+		origins = c.Security.CORSAdminOrigins
+	}
+	if strings.TrimSpace(origins) == "" {
+		origins = c.Security.AllowedOrigins
+	}
+	return splitOrigins(origins)
+}
+
+// CORSMaxAge returns how many seconds browsers may cache the preflights
+// of a route group: its CORS_<GROUP>_MAX_AGE when set, else CORS_MAX_AGE
+func (c *Config) CORSMaxAge(group string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	maxAge := -1
+	switch group {
+	case CORSPublic:
+		maxAge = c.Security.CORSPublicMaxAge
+	case CORSStream:
+		maxAge = c.Security.CORSStreamMaxAge
+	case CORSAdmin:
+		maxAge = c.Security.CORSAdminMaxAge
+	}
+	if maxAge < 0 {
+		maxAge = c.Security.CORSMaxAge
+	}
+	return maxAge
+}
+
+func splitOrigins(list string) []string {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// RateLimits returns the current per-minute limits for public and auth
+// endpoints
+func (c *Config) RateLimits() (public, auth int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Security.RateLimitPublic, c.Security.RateLimitAuth
+}
+
+// SearchRateLimit returns the current per-minute limit of the public
+// camera search
+func (c *Config) SearchRateLimit() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Security.RateLimitSearch
+}
+
+// LogLevel returns the current LOG_LEVEL value
+func (c *Config) LogLevel() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Server.LogLevel
+}
+
+// OnReload registers fn to run after a reload changed something
+func (c *Config) OnReload(fn func(*Config)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onReload = append(c.onReload, fn)
+}
+
+// Reload re-reads .env and the environment and applies the reloadable
+// settings. Everything else needs a restart and is left as it is. It
+// returns the variables that changed; a value that does not parse fails
+// the whole reload.
+func (c *Config) Reload() ([]string, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	fresh := Load()
+
+	report := &Report{}
+	for _, key := range fresh.malformed {
+		report.add(key, Fail, "%q is not a valid value", os.Getenv(key))
+	}
+	stream := fresh.Go2RTC
+	if !isHTTPURL(stream.APIURL) {
+		report.add("GO2RTC_API_URL", Fail, "%q is not an http(s) URL", stream.APIURL)
+	}
+	if !isHTTPURL(stream.HLSURLInternal) {
+		report.add("GO2RTC_HLS_URL_INTERNAL", Fail, "%q is not an http(s) URL", stream.HLSURLInternal)
+	}
+	if err := report.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	var changed []string
+	set := func(key string, dst *string, value string) {
+		if *dst != value {
+			*dst = value
+			changed = append(changed, key)
+		}
+	}
+	setInt := func(key string, dst *int, value int) {
+		if *dst != value {
+			*dst = value
+			changed = append(changed, key)
+		}
+	}
+
+	set("LOG_LEVEL", &c.Server.LogLevel, fresh.Server.LogLevel)
+	set("ALLOWED_ORIGINS", &c.Security.AllowedOrigins, fresh.Security.AllowedOrigins)
+	set("CORS_PUBLIC_ORIGINS", &c.Security.CORSPublicOrigins, fresh.Security.CORSPublicOrigins)
+	set("CORS_STREAM_ORIGINS", &c.Security.CORSStreamOrigins, fresh.Security.CORSStreamOrigins)
+	set("CORS_ADMIN_ORIGINS", &c.Security.CORSAdminOrigins, fresh.Security.CORSAdminOrigins)
+	setInt("CORS_MAX_AGE", &c.Security.CORSMaxAge, fresh.Security.CORSMaxAge)
+	setInt("CORS_PUBLIC_MAX_AGE", &c.Security.CORSPublicMaxAge, fresh.Security.CORSPublicMaxAge)
+	setInt("CORS_STREAM_MAX_AGE", &c.Security.CORSStreamMaxAge, fresh.Security.CORSStreamMaxAge)
+	setInt("CORS_ADMIN_MAX_AGE", &c.Security.CORSAdminMaxAge, fresh.Security.CORSAdminMaxAge)
+	setInt("RATE_LIMIT_PUBLIC", &c.Security.RateLimitPublic, fresh.Security.RateLimitPublic)
+	setInt("RATE_LIMIT_AUTH", &c.Security.RateLimitAuth, fresh.Security.RateLimitAuth)
+	setInt("RATE_LIMIT_SEARCH", &c.Security.RateLimitSearch, fresh.Security.RateLimitSearch)
+	set("GO2RTC_API_URL", &c.Go2RTC.APIURL, stream.APIURL)
+	set("GO2RTC_HLS_URL_INTERNAL", &c.Go2RTC.HLSURLInternal, stream.HLSURLInternal)
+	set("PUBLIC_HLS_PATH", &c.Go2RTC.HLSURLPublic, stream.HLSURLPublic)
+	set("PUBLIC_STREAM_BASE_URL", &c.Go2RTC.PublicStreamBaseURL, stream.PublicStreamBaseURL)
+	setInt("STREAM_MAX_SESSIONS_PER_IP", &c.Go2RTC.MaxSessionsPerIP, stream.MaxSessionsPerIP)
+	setInt("STREAM_ABUSE_PLAYLISTS", &c.Go2RTC.AbusePlaylists, stream.AbusePlaylists)
+	setInt("STREAM_ABUSE_CAMERAS", &c.Go2RTC.AbuseCameras, stream.AbuseCameras)
+	setInt("STREAM_TOKEN_REQUESTS_PER_MINUTE", &c.Go2RTC.PlayerTokenRequests, stream.PlayerTokenRequests)
+
+	hooks := c.onReload
+	c.mu.Unlock()
+
+	if len(changed) > 0 {
+		for _, fn := range hooks {
+			fn(c)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("PORT", "3000")
+	os.Setenv("RATE_LIMIT_PUBLIC", "100")
+	cfg := Load()
+
+	var hookLevel string
+	cfg.OnReload(func(c *Config) {
+		hookLevel = c.LogLevel()
+	})
+
+	t.Run("Applies reloadable settings", func(t *testing.T) {
+		os.Setenv("PORT", "4000")
+		os.Setenv("RATE_LIMIT_PUBLIC", "20")
+		os.Setenv("LOG_LEVEL", "warn")
+		os.Setenv("ALLOWED_ORIGINS", "https://a.example, https://b.example")
+		os.Setenv("GO2RTC_API_URL", "http://go2rtc:1984")
+
+		changed, err := cfg.Reload()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := []string{"LOG_LEVEL", "ALLOWED_ORIGINS", "RATE_LIMIT_PUBLIC", "GO2RTC_API_URL"}
+		if !reflect.DeepEqual(changed, expected) {
+			t.Errorf("Expected changed %v, got %v", expected, changed)
+		}
+
+		if public, _ := cfg.RateLimits(); public != 20 {
+			t.Errorf("Expected public rate limit 20, got %d", public)
+		}
+		if origins := cfg.AllowedOrigins(); !reflect.DeepEqual(origins, []string{"https://a.example", "https://b.example"}) {
+			t.Errorf("Expected two origins, got %v", origins)
+		}
+		if cfg.Stream().APIURL != "http://go2rtc:1984" {
+			t.Errorf("Expected new go2rtc URL, got '%s'", cfg.Stream().APIURL)
+		}
+		if hookLevel != "warn" {
+			t.Errorf("Expected reload hook to see level 'warn', got '%s'", hookLevel)
+		}
+	})
+
+	t.Run("Leaves other settings alone", func(t *testing.T) {
+		if cfg.Server.Port != "3000" {
+			t.Errorf("Expected port to need a restart, got '%s'", cfg.Server.Port)
+		}
+	})
+
+	t.Run("Nothing changed", func(t *testing.T) {
+		hookLevel = ""
+		changed, err := cfg.Reload()
+		if err != nil || len(changed) != 0 {
+			t.Errorf("Expected no changes, got %v (%v)", changed, err)
+		}
+		if hookLevel != "" {
+			t.Error("Expected hooks to be skipped when nothing changed")
+		}
+	})
+
+	t.Run("CORS origins per group", func(t *testing.T) {
+		os.Setenv("CORS_PUBLIC_ORIGINS", "*")
+		defer os.Unsetenv("CORS_PUBLIC_ORIGINS")
+
+		changed, err := cfg.Reload()
+		if err != nil || !reflect.DeepEqual(changed, []string{"CORS_PUBLIC_ORIGINS"}) {
+			t.Fatalf("Expected CORS_PUBLIC_ORIGINS changed, got %v (%v)", changed, err)
+		}
+		if origins := cfg.CORSOrigins(CORSPublic); !reflect.DeepEqual(origins, []string{"*"}) {
+			t.Errorf("Expected any origin for public routes, got %v", origins)
+		}
+		if origins := cfg.CORSOrigins(CORSAdmin); !reflect.DeepEqual(origins, cfg.AllowedOrigins()) {
+			t.Errorf("Expected admin routes to fall back to ALLOWED_ORIGINS, got %v", origins)
+		}
+	})
+
+	t.Run("CORS max age per group", func(t *testing.T) {
+		os.Setenv("CORS_PUBLIC_MAX_AGE", "7200")
+		defer os.Unsetenv("CORS_PUBLIC_MAX_AGE")
+
+		// CORS_PUBLIC_ORIGINS goes back to unset too
+		changed, err := cfg.Reload()
+		if err != nil || !reflect.DeepEqual(changed, []string{"CORS_PUBLIC_ORIGINS", "CORS_PUBLIC_MAX_AGE"}) {
+			t.Fatalf("Expected CORS_PUBLIC_MAX_AGE changed, got %v (%v)", changed, err)
+		}
+		if maxAge := cfg.CORSMaxAge(CORSPublic); maxAge != 7200 {
+			t.Errorf("Expected public preflights cached for 7200s, got %d", maxAge)
+		}
+		if maxAge := cfg.CORSMaxAge(CORSStream); maxAge != 600 {
+			t.Errorf("Expected streams to fall back to CORS_MAX_AGE, got %d", maxAge)
+		}
+	})
+
+	t.Run("Rejects invalid values", func(t *testing.T) {
+		os.Setenv("RATE_LIMIT_AUTH", "lots")
+		defer os.Unsetenv("RATE_LIMIT_AUTH")
+
+		if _, err := cfg.Reload(); err == nil {
+			t.Error("Expected an error for a malformed rate limit")
+		}
+		if _, auth := cfg.RateLimits(); auth != 30 {
+			t.Errorf("Expected auth rate limit to stay 30, got %d", auth)
+		}
+	})
+}
@@ -0,0 +1,561 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+	"github.com/abcdefak87/cctv/pkg/redis"
+)
+
+// Severity of a startup check
+type Severity int
+
+const (
+	Pass Severity = iota
+	Warn
+	Fail
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warn:
+		return "WARN"
+	case Fail:
+		return "FAIL"
+	}
+	return "OK"
+}
+
+// Check is one line of the startup report
+type Check struct {
+	Name     string
+	Severity Severity
+	Detail   string
+}
+
+// Report is the outcome of Validate
+type Report struct {
+	Checks []Check
+}
+
+func (r *Report) add(name string, severity Severity, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Severity: severity, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Err lists the failed checks, or returns nil when the server can start
+func (r *Report) Err() error {
+	var failed []string
+	for _, c := range r.Checks {
+		if c.Severity == Fail {
+			failed = append(failed, c.Name+": "+c.Detail)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration: " + strings.Join(failed, "; "))
+}
+
+// String formats the report one check per line
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, c := range r.Checks {
+		fmt.Fprintf(&b, "[%-4s] %-24s %s\n", c.Severity, c.Name, c.Detail)
+	}
+	return b.String()
+}
+
+// defaultJWTSecret is the placeholder Load falls back to
+const defaultJWTSecret = "change-this-secret"
+
+// streamNodeName is what a STREAM_NODES name may be; cameras store it
+var streamNodeName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// probeTimeout bounds each reachability check
+var probeTimeout = 3 * time.Second
+
+// Validate checks the loaded configuration before the server starts:
+// values that did not parse, secrets, writable paths and whether the
+// stream backend answers. Problems that only matter in production are
+// warnings elsewhere, so a developer can start the API without go2rtc.
+func Validate(ctx context.Context, cfg *Config) *Report {
+	r := &Report{}
+	production := cfg.Server.Env == "production"
+
+	for _, key := range cfg.malformed {
+		r.add(key, Fail, "%q is not a valid value", os.Getenv(key))
+	}
+
+	switch {
+	case cfg.JWT.Secret == "" || cfg.JWT.Secret == defaultJWTSecret:
+		r.add("JWT_SECRET", severity(production), "not set; tokens can be forged with the default secret")
+	case len(cfg.JWT.Secret) < 32:
+		r.add("JWT_SECRET", Warn, "shorter than 32 characters")
+	default:
+		r.add("JWT_SECRET", Pass, "set")
+	}
+
+	if _, err := time.ParseDuration(cfg.JWT.Expiration); err != nil {
+		r.add("JWT_EXPIRATION", Fail, "%q is not a duration such as 24h", cfg.JWT.Expiration)
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"SHUTDOWN_TIMEOUT_SECONDS", cfg.Server.ShutdownTimeout},
+		{"DB_QUERY_TIMEOUT_SECONDS", cfg.Database.QueryTimeout},
+		{"GO2RTC_PROXY_TIMEOUT_SECONDS", cfg.Go2RTC.ProxyTimeout},
+		{"HTTP_CLIENT_TIMEOUT_SECONDS", cfg.HTTP.Timeout},
+		{"EDGE_HEARTBEAT_SECONDS", cfg.Edge.HeartbeatInterval},
+	} {
+		if d.value <= 0 {
+			r.add(d.key, Fail, "must be a positive number of seconds")
+		}
+	}
+
+	if cfg.Jobs.Workers <= 0 {
+		r.add("JOB_WORKERS", Fail, "must be at least 1")
+	}
+
+	if cfg.Security.ImpersonationTTL <= 0 {
+		r.add("IMPERSONATION_TTL_MINUTES", Fail, "must be a positive number of minutes")
+	}
+	if cfg.Security.CORSMaxAge < 0 {
+		r.add("CORS_MAX_AGE", Fail, "must be zero or a positive number of seconds")
+	}
+	for _, d := range []struct {
+		key   string
+		value int
+	}{
+		{"CORS_PUBLIC_MAX_AGE", cfg.Security.CORSPublicMaxAge},
+		{"CORS_STREAM_MAX_AGE", cfg.Security.CORSStreamMaxAge},
+		{"CORS_ADMIN_MAX_AGE", cfg.Security.CORSAdminMaxAge},
+	} {
+		if d.value < -1 {
+			r.add(d.key, Fail, "must be zero or a positive number of seconds")
+		}
+	}
+	for _, origin := range cfg.CORSOrigins(CORSAdmin) {
+		if origin == "*" {
+			r.add("CORS_ADMIN_ORIGINS", Warn, "any site can call the admin APIs, though without cookies")
+		}
+	}
+
+	if cfg.Go2RTC.SignedURLTTL <= 0 {
+		r.add("STREAM_URL_TTL_MINUTES", Fail, "must be a positive number of minutes")
+	}
+	if cfg.Go2RTC.MultiviewMax <= 0 {
+		r.add("STREAM_MULTIVIEW_MAX", Fail, "must be at least 1")
+	}
+	if max := cfg.Go2RTC.MaxSessionsPerIP; max > 0 && max < cfg.Go2RTC.MultiviewMax {
+		r.add("STREAM_MAX_SESSIONS_PER_IP", Warn, "is below STREAM_MULTIVIEW_MAX (%d); a full multi-view grid will be refused streams",
+			cfg.Go2RTC.MultiviewMax)
+	}
+	if max := cfg.Go2RTC.AbuseCameras; max > 0 && max < cfg.Go2RTC.MultiviewMax {
+		r.add("STREAM_ABUSE_CAMERAS", Warn, "is below STREAM_MULTIVIEW_MAX (%d); a full multi-view grid will get its viewer banned",
+			cfg.Go2RTC.MultiviewMax)
+	}
+	if (cfg.Go2RTC.AbusePlaylists > 0 || cfg.Go2RTC.AbuseCameras > 0) && (cfg.Go2RTC.AbuseWindow <= 0 || cfg.Go2RTC.AbuseBan <= 0) {
+		r.add("STREAM_ABUSE_WINDOW_SECONDS", Fail, "and STREAM_ABUSE_BAN_MINUTES must be positive while abuse checks are on")
+	}
+	if cfg.Go2RTC.PlayerTokenTTL <= 0 {
+		r.add("STREAM_TOKEN_TTL_MINUTES", Fail, "must be a positive number of minutes")
+	}
+	names := map[string]bool{}
+	for _, node := range cfg.Go2RTC.Nodes {
+		switch {
+		case !streamNodeName.MatchString(node.Name):
+			r.add("STREAM_NODES", Fail, "%q is not a node name: up to 50 lowercase letters, digits, '-' or '_'", node.Name)
+		case names[node.Name]:
+			r.add("STREAM_NODES", Fail, "node %q is listed twice", node.Name)
+		case node.Password != "" && node.Username == "":
+			r.add("STREAM_NODES", Fail, "node %q has a password but no username", node.Name)
+		}
+		names[node.Name] = true
+	}
+
+	if cfg.Motion.Enabled {
+		if cfg.Motion.Interval <= 0 {
+			r.add("MOTION_INTERVAL_SECONDS", Fail, "must be a positive number of seconds")
+		}
+		if cfg.Motion.Concurrency <= 0 {
+			r.add("MOTION_CONCURRENCY", Fail, "must be at least 1")
+		}
+	}
+
+	if h := cfg.Health; h.Enabled {
+		if h.Interval <= 0 {
+			r.add("HEALTH_CHECK_INTERVAL_SECONDS", Fail, "must be a positive number of seconds")
+		}
+		if h.Timeout <= 0 {
+			r.add("HEALTH_CHECK_TIMEOUT_SECONDS", Fail, "must be a positive number of seconds")
+		} else if h.Timeout > h.Interval {
+			r.add("HEALTH_CHECK_TIMEOUT_SECONDS", Warn, "is longer than HEALTH_CHECK_INTERVAL_SECONDS; probes will overlap their next run")
+		}
+		if h.Concurrency <= 0 {
+			r.add("HEALTH_CHECK_CONCURRENCY", Fail, "must be at least 1")
+		}
+	}
+
+	if cfg.Health.StartAlert < 0 {
+		r.add("STREAM_START_ALERT_MS", Fail, "must be 0 (off) or a positive number of milliseconds")
+	} else if cfg.Health.StartAlert > 0 && cfg.Health.StartMinSamples <= 0 {
+		r.add("STREAM_START_MIN_SAMPLES", Fail, "must be at least 1")
+	}
+	if h := cfg.Health; h.TrafficSpikeFactor < 0 {
+		r.add("STREAM_TRAFFIC_SPIKE_FACTOR", Fail, "must be 0 (off) or a positive factor")
+	} else if h.TrafficSpikeFactor > 0 && h.TrafficSpikeFactor <= 1 {
+		r.add("STREAM_TRAFFIC_SPIKE_FACTOR", Warn, "is at most 1; any traffic over the usual alerts")
+	}
+	if h := cfg.Health; h.TrafficSpikeFactor > 0 || h.TrafficDropAlert {
+		if h.TrafficMinMB < 0 {
+			r.add("STREAM_TRAFFIC_ALERT_MIN_MB", Fail, "must be 0 or more")
+		}
+		if h.TrafficBaselineDays < 1 {
+			r.add("STREAM_TRAFFIC_BASELINE_DAYS", Fail, "must be at least 1")
+		}
+	}
+
+	if w := cfg.Webhooks; w.URL != "" {
+		if !isHTTPURL(w.URL) {
+			r.add("RECORDING_WEBHOOK_URL", Fail, "%q is not an http(s) URL", w.URL)
+		}
+		if w.Secret == "" {
+			r.add("RECORDING_WEBHOOK_SECRET", Fail, "must be set so receivers can verify the requests")
+		}
+		if !isHTTPURL(w.BaseURL) {
+			r.add("RECORDING_WEBHOOK_BASE_URL", Fail, "must be the http(s) address receivers download recordings from")
+		}
+		if w.LinkTTL <= 0 {
+			r.add("RECORDING_WEBHOOK_LINK_HOURS", Fail, "must be a positive number of hours")
+		}
+	}
+
+	if d := cfg.Detection; d.URL != "" {
+		if !isHTTPURL(d.URL) {
+			r.add("DETECTION_URL", Fail, "%q is not an http(s) URL", d.URL)
+		}
+		if d.Mode != "image" && d.Mode != "url" {
+			r.add("DETECTION_MODE", Fail, "unsupported mode %q, expected image or url", d.Mode)
+		}
+		if d.Timeout <= 0 {
+			r.add("DETECTION_TIMEOUT_SECONDS", Fail, "must be a positive number of seconds")
+		}
+		if d.MinConfidence < 0 || d.MinConfidence > 1 {
+			r.add("DETECTION_MIN_CONFIDENCE", Fail, "must be between 0 and 1")
+		}
+		if !cfg.Motion.Enabled {
+			r.add("DETECTION_URL", Warn, "detection runs on motion events, but MOTION_ENABLED is off")
+		}
+	}
+
+	if cfg.ANPR.RetentionDays < 0 {
+		r.add("ANPR_RETENTION_DAYS", Fail, "must be 0 (keep forever) or a positive number of days")
+	}
+	if key := cfg.ANPR.IngestKey; key != "" && len(key) < 16 {
+		r.add("ANPR_INGEST_KEY", Warn, "shorter than 16 characters")
+	}
+	if token := cfg.Alerting.AlertmanagerToken; token != "" && len(token) < 16 {
+		r.add("ALERTMANAGER_TOKEN", Warn, "shorter than 16 characters")
+	}
+
+	for _, d := range []struct {
+		key  string
+		days int
+	}{
+		{"VIEWER_SESSION_RETENTION_DAYS", cfg.Privacy.ViewerSessionDays},
+		{"FEEDBACK_EMAIL_RETENTION_DAYS", cfg.Privacy.FeedbackEmailDays},
+		{"ANONYMIZE_IP_AFTER_DAYS", cfg.Privacy.AnonymizeIPDays},
+	} {
+		if d.days < 0 {
+			r.add(d.key, Fail, "must be 0 (keep as is) or a positive number of days")
+		}
+	}
+	switch cfg.Privacy.ViewerMode {
+	case "", "off", "hash", "drop":
+	default:
+		r.add("VIEWER_PRIVACY_MODE", Fail, "%q is not off, hash or drop", cfg.Privacy.ViewerMode)
+	}
+
+	if w := cfg.Weather; w.APIKey != "" {
+		if !isHTTPURL(w.URL) {
+			r.add("WEATHER_URL", Fail, "%q is not an http(s) URL", w.URL)
+		}
+		if w.CacheTTL <= 0 {
+			r.add("WEATHER_CACHE_MINUTES", Fail, "must be a positive number of minutes")
+		}
+		if w.MaxLocations <= 0 {
+			r.add("WEATHER_MAX_LOCATIONS", Fail, "must be at least 1")
+		}
+	}
+
+	if c := cfg.Cluster; c.Enabled {
+		if c.LeaseTTL <= 0 {
+			r.add("CLUSTER_LEASE_SECONDS", Fail, "must be a positive number of seconds")
+		}
+		if c.InstanceID == "" {
+			r.add("INSTANCE_ID", Fail, "must be set in cluster mode")
+		}
+		if d := strings.ToLower(cfg.Database.Driver); d != "postgres" && d != "postgresql" {
+			r.add("CLUSTER_MODE", Warn, "instances only share state through a common database; use the postgres driver")
+		}
+	}
+
+	if cfg.Viewers.FlushInterval <= 0 {
+		r.add("VIEWER_FLUSH_SECONDS", Fail, "must be a positive number of seconds")
+	}
+	if cfg.Viewers.MaxPending <= 0 {
+		r.add("VIEWER_FLUSH_MAX_PENDING", Fail, "must be at least 1")
+	}
+	if cfg.Monitor.Interval <= 0 {
+		r.add("SYSTEM_MONITOR_SECONDS", Fail, "must be a positive number of seconds")
+	}
+	if cfg.Monitor.History <= 0 {
+		r.add("SYSTEM_MONITOR_HISTORY", Fail, "must be at least 1")
+	}
+
+	a := cfg.Alerting
+	if a.Interval <= 0 {
+		r.add("ALERT_CHECK_SECONDS", Fail, "must be a positive number of seconds")
+	}
+	if (a.TelegramBotToken == "") != (a.TelegramChatID == "") {
+		r.add("TELEGRAM_BOT_TOKEN", Warn, "TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID must be set together; Telegram alerts are off")
+	} else if a.TelegramBotToken != "" && !isHTTPURL(a.TelegramAPIURL) {
+		r.add("TELEGRAM_API_URL", Fail, "%q is not an http(s) URL", a.TelegramAPIURL)
+	}
+	if a.SMTPHost != "" && (a.SMTPFrom == "" || a.EmailTo == "") {
+		r.add("SMTP_HOST", Warn, "SMTP_FROM and ALERT_EMAIL_TO must be set too; email alerts are off")
+	}
+	for _, u := range []struct{ key, value string }{{"ALERT_SMS_URL", a.SMSURL}, {"ALERT_WHATSAPP_URL", a.WhatsAppURL}} {
+		if u.value != "" && !isHTTPURL(u.value) {
+			r.add(u.key, Fail, "%q is not an http(s) URL", u.value)
+		}
+	}
+	if a.NtfyTopic != "" && !isHTTPURL(a.NtfyURL) {
+		r.add("NTFY_URL", Fail, "%q is not an http(s) URL", a.NtfyURL)
+	}
+	if (a.GotifyURL == "") != (a.GotifyToken == "") {
+		r.add("GOTIFY_URL", Warn, "GOTIFY_URL and GOTIFY_TOKEN must be set together; Gotify alerts are off")
+	} else if a.GotifyURL != "" && !isHTTPURL(a.GotifyURL) {
+		r.add("GOTIFY_URL", Fail, "%q is not an http(s) URL", a.GotifyURL)
+	}
+
+	if h := cfg.Reports.Hour; h < 0 || h > 23 {
+		r.add("REPORT_HOUR", Fail, "must be an hour between 0 and 23")
+	}
+	if _, err := time.LoadLocation(cfg.Reports.Timezone); err != nil {
+		r.add("REPORT_TIMEZONE", Fail, "%q is not an IANA time zone such as Asia/Jakarta", cfg.Reports.Timezone)
+	}
+	for _, name := range cfg.Reports.Channels {
+		switch name {
+		case "telegram", "email", "sms", "whatsapp", "ntfy", "gotify":
+		default:
+			r.add("REPORT_CHANNELS", Fail, "unknown channel %q, expected telegram, email, sms, whatsapp, ntfy, gotify or none", name)
+		}
+	}
+
+	t := cfg.Tickets
+	switch t.Provider {
+	case "":
+	case "webhook":
+		if !isHTTPURL(t.WebhookURL) {
+			r.add("TICKET_WEBHOOK_URL", Fail, "%q is not an http(s) URL", t.WebhookURL)
+		}
+		if t.WebhookSecret == "" {
+			r.add("TICKET_WEBHOOK_SECRET", Fail, "must be set so receivers can verify the requests")
+		}
+	case "jira":
+		if !isHTTPURL(t.JiraURL) {
+			r.add("JIRA_URL", Fail, "%q is not an http(s) URL", t.JiraURL)
+		}
+		if t.JiraEmail == "" || t.JiraToken == "" || t.JiraProject == "" {
+			r.add("JIRA_API_TOKEN", Fail, "JIRA_EMAIL, JIRA_API_TOKEN and JIRA_PROJECT must be set for jira tickets")
+		}
+	case "email":
+		if a.SMTPHost == "" || a.SMTPFrom == "" || t.EmailTo == "" {
+			r.add("TICKET_EMAIL_TO", Fail, "TICKET_EMAIL_TO, SMTP_HOST and SMTP_FROM must be set for email tickets")
+		}
+	default:
+		r.add("TICKET_PROVIDER", Fail, "unsupported provider %q, expected webhook, jira or email", t.Provider)
+	}
+	if t.Provider != "" && t.After <= 0 {
+		r.add("TICKET_AFTER_MINUTES", Fail, "must be a positive number of minutes")
+	}
+
+	if cfg.Redis.URL != "" {
+		checkRedis(ctx, r, cfg.Redis.URL, severity(production))
+	}
+
+	switch strings.ToLower(cfg.Database.Driver) {
+	case "postgres", "postgresql":
+		if cfg.Database.URL == "" {
+			r.add("DATABASE_URL", Fail, "required for the postgres driver")
+		} else {
+			r.add("DATABASE_URL", Pass, "postgres")
+		}
+	case "", "sqlite", "sqlite3":
+		checkWritable(r, "DATABASE_PATH", filepath.Dir(cfg.Database.Path), Fail)
+		switch strings.ToLower(cfg.Database.AutoVacuum) {
+		case "", "none", "full", "incremental":
+		default:
+			r.add("DB_AUTO_VACUUM", Fail, "unknown mode %q, expected none, full or incremental", cfg.Database.AutoVacuum)
+		}
+		if cfg.Database.CheckpointInterval < 0 {
+			r.add("DB_CHECKPOINT_INTERVAL_MINUTES", Fail, "must not be negative")
+		} else if cfg.Database.CheckpointInterval == 0 && cfg.Database.WALAlertMB > 0 {
+			r.add("DB_WAL_ALERT_MB", Warn, "WAL size is only checked with DB_CHECKPOINT_INTERVAL_MINUTES set")
+		}
+	default:
+		r.add("DATABASE_DRIVER", Fail, "unsupported driver %q", cfg.Database.Driver)
+	}
+
+	checkWritable(r, "RECORDINGS_PATH", cfg.Recording.Path, severity(production))
+	if _, err := exec.LookPath(cfg.Recording.FFmpegPath); err != nil {
+		r.add("FFMPEG_PATH", Warn, "%v; stills cannot be taken from recordings", err)
+	}
+
+	switch cfg.Uploads.Storage {
+	case "dir":
+		checkWritable(r, "UPLOAD_PATH", cfg.Uploads.Path, severity(production))
+	case "s3":
+		if cfg.Uploads.S3Endpoint == "" || cfg.Uploads.S3Bucket == "" {
+			r.add("UPLOAD_S3_BUCKET", Fail, "UPLOAD_S3_ENDPOINT and UPLOAD_S3_BUCKET must be set for s3 storage")
+		}
+		if cfg.Uploads.S3AccessKey == "" || cfg.Uploads.S3SecretKey == "" {
+			r.add("UPLOAD_S3_ACCESS_KEY", Fail, "UPLOAD_S3_ACCESS_KEY and UPLOAD_S3_SECRET_KEY must be set for s3 storage")
+		}
+	default:
+		r.add("UPLOAD_STORAGE", Fail, "unsupported storage %q, expected dir or s3", cfg.Uploads.Storage)
+	}
+
+	switch strings.ToLower(cfg.AccessLog.Sink) {
+	case "", "off", "database":
+	case "file":
+		checkWritable(r, "ACCESS_LOG_PATH", filepath.Dir(cfg.AccessLog.Path), Fail)
+	default:
+		r.add("ACCESS_LOG_SINK", Fail, "unsupported sink %q, expected off, database or file", cfg.AccessLog.Sink)
+	}
+
+	// go2rtc is probed through the client the server will use, so a
+	// proxy that cannot reach it shows up here
+	client, err := httpclient.New(cfg.HTTP.Options())
+	if err != nil {
+		r.add("OUTBOUND_PROXY", Fail, "%v", err)
+		client = http.DefaultClient
+	}
+	if cfg.HTTP.InsecureSkipVerify {
+		r.add("HTTP_CLIENT_INSECURE_SKIP_VERIFY", Warn, "outbound TLS certificates are not verified")
+	}
+
+	checkReachable(ctx, r, client, "GO2RTC_API_URL", cfg.Go2RTC.APIURL, severity(production))
+	checkReachable(ctx, r, client, "GO2RTC_HLS_URL_INTERNAL", cfg.Go2RTC.HLSURLInternal, severity(production))
+	// A secondary node being down only affects its own cameras
+	for _, node := range cfg.Go2RTC.Nodes {
+		checkReachable(ctx, r, client, "STREAM_NODES["+node.Name+"]", node.APIURL, Warn)
+	}
+
+	if cfg.TLS.Enabled() && len(cfg.TLS.AutocertDomains) == 0 {
+		if cfg.TLS.CertFile == "" || cfg.TLS.KeyFile == "" {
+			r.add("TLS_CERT_FILE", Fail, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		} else {
+			if _, err := os.Stat(cfg.TLS.CertFile); err != nil {
+				r.add("TLS_CERT_FILE", Fail, "%v", err)
+			}
+			if _, err := os.Stat(cfg.TLS.KeyFile); err != nil {
+				r.add("TLS_KEY_FILE", Fail, "%v", err)
+			}
+		}
+	}
+
+	return r
+}
+
+// severity is Fail in production and Warn elsewhere
+func severity(production bool) Severity {
+	if production {
+		return Fail
+	}
+	return Warn
+}
+
+// checkWritable creates dir if needed and proves a file can be written
+func checkWritable(r *Report, name, dir string, onError Severity) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		r.add(name, onError, "cannot create %s: %v", dir, err)
+		return
+	}
+
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		r.add(name, onError, "%s is not writable: %v", dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	r.add(name, Pass, "%s is writable", dir)
+}
+
+// checkReachable treats any HTTP response as reachable; only a malformed
+// URL or a failed connection counts against it
+func checkReachable(ctx context.Context, r *Report, client *http.Client, name, rawURL string, onError Severity) {
+	if !isHTTPURL(rawURL) {
+		r.add(name, Fail, "%q is not an http(s) URL", rawURL)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		r.add(name, Fail, "%v", err)
+		return
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		r.add(name, onError, "%s is unreachable: %v", rawURL, err)
+		return
+	}
+	resp.Body.Close()
+
+	r.add(name, Pass, "%s is reachable", rawURL)
+}
+
+// checkRedis connects to REDIS_URL; the report names the server but not
+// the password in the URL
+func checkRedis(ctx context.Context, r *Report, rawURL string, onError Severity) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		r.add("REDIS_URL", Fail, "%v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	client := redis.New(opts)
+	defer client.Close()
+	if err := client.Ping(ctx); err != nil {
+		r.add("REDIS_URL", onError, "%s is unreachable: %v", opts.Addr, err)
+		return
+	}
+	r.add("REDIS_URL", Pass, "%s is reachable", opts.Addr)
+}
+
+func isHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
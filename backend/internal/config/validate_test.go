@@ -0,0 +1,390 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/redis/redistest"
+)
+
+// checkFor returns the first check with name, or fails the test
+func checkFor(t *testing.T, r *Report, name string) Check {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("Expected a %s check, got:\n%s", name, r)
+	return Check{}
+}
+
+func TestValidate(t *testing.T) {
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer go2rtc.Close()
+
+	// A listener that was closed leaves a port nothing answers on
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	probeTimeout = time.Second
+	ctx := context.Background()
+
+	valid := func(t *testing.T) *Config {
+		dir := t.TempDir()
+		return &Config{
+			Server:    ServerConfig{Env: "production", ShutdownTimeout: time.Second},
+			Database:  DatabaseConfig{Driver: "sqlite", Path: filepath.Join(dir, "data", "cctv.db"), QueryTimeout: time.Second},
+			JWT:       JWTConfig{Secret: strings.Repeat("s", 32), Expiration: "24h"},
+			Go2RTC:    Go2RTCConfig{APIURL: go2rtc.URL, HLSURLInternal: go2rtc.URL, ProxyTimeout: time.Second, SignedURLTTL: time.Hour, MultiviewMax: 16, PlayerTokenTTL: 15 * time.Minute},
+			Recording: RecordingConfig{Path: filepath.Join(dir, "recordings")},
+			Jobs:      JobsConfig{Workers: 4},
+			HTTP:      HTTPClientConfig{Timeout: time.Second},
+			Edge:      EdgeConfig{HeartbeatInterval: time.Second},
+			Viewers:   ViewersConfig{FlushInterval: time.Second, MaxPending: 100},
+			Monitor:   MonitorConfig{Interval: time.Second, History: 10},
+			Alerting:  AlertingConfig{Interval: time.Second},
+			Security:  SecurityConfig{ImpersonationTTL: time.Minute},
+			Uploads:   UploadConfig{Storage: "dir", Path: filepath.Join(dir, "uploads")},
+		}
+	}
+
+	t.Run("Valid configuration", func(t *testing.T) {
+		report := Validate(ctx, valid(t))
+		if err := report.Err(); err != nil {
+			t.Errorf("Expected no error, got %v\n%s", err, report)
+		}
+	})
+
+	t.Run("Default JWT secret fails in production only", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.JWT.Secret = defaultJWTSecret
+
+		if c := checkFor(t, Validate(ctx, cfg), "JWT_SECRET"); c.Severity != Fail {
+			t.Errorf("Expected FAIL in production, got %s", c.Severity)
+		}
+
+		cfg.Server.Env = "development"
+		if c := checkFor(t, Validate(ctx, cfg), "JWT_SECRET"); c.Severity != Warn {
+			t.Errorf("Expected WARN in development, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Unreachable stream backend", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Go2RTC.APIURL = closed.URL
+
+		report := Validate(ctx, cfg)
+		if c := checkFor(t, report, "GO2RTC_API_URL"); c.Severity != Fail || !strings.Contains(c.Detail, "unreachable") {
+			t.Errorf("Expected unreachable FAIL, got %s %s", c.Severity, c.Detail)
+		}
+		if err := report.Err(); err == nil || !strings.Contains(err.Error(), "GO2RTC_API_URL") {
+			t.Errorf("Expected error naming GO2RTC_API_URL, got %v", err)
+		}
+	})
+
+	t.Run("Malformed URL", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Server.Env = "development"
+		cfg.Go2RTC.HLSURLInternal = "localhost:8888"
+
+		if c := checkFor(t, Validate(ctx, cfg), "GO2RTC_HLS_URL_INTERNAL"); c.Severity != Fail {
+			t.Errorf("Expected FAIL for a URL without scheme, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Unwritable database directory", func(t *testing.T) {
+		cfg := valid(t)
+		blocker := filepath.Join(t.TempDir(), "file")
+		os.WriteFile(blocker, nil, 0644)
+		cfg.Database.Path = filepath.Join(blocker, "cctv.db")
+
+		if c := checkFor(t, Validate(ctx, cfg), "DATABASE_PATH"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s %s", c.Severity, c.Detail)
+		}
+	})
+
+	t.Run("Malformed durations", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.JWT.Expiration = "1 day"
+		cfg.Database.QueryTimeout = 0
+
+		report := Validate(ctx, cfg)
+		if c := checkFor(t, report, "JWT_EXPIRATION"); c.Severity != Fail {
+			t.Errorf("Expected FAIL for JWT_EXPIRATION, got %s", c.Severity)
+		}
+		if c := checkFor(t, report, "DB_QUERY_TIMEOUT_SECONDS"); c.Severity != Fail {
+			t.Errorf("Expected FAIL for DB_QUERY_TIMEOUT_SECONDS, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Malformed outbound proxy", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.HTTP.Proxy = "proxy.local:3128"
+
+		if c := checkFor(t, Validate(ctx, cfg), "OUTBOUND_PROXY"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Unknown access log sink", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.AccessLog.Sink = "syslog"
+
+		if c := checkFor(t, Validate(ctx, cfg), "ACCESS_LOG_SINK"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("S3 uploads without credentials", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Uploads = UploadConfig{Storage: "s3", S3Endpoint: "https://s3.example.com", S3Bucket: "cctv"}
+
+		r := Validate(ctx, cfg)
+		if c := checkFor(t, r, "UPLOAD_S3_ACCESS_KEY"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+		for _, c := range r.Checks {
+			if c.Name == "UPLOAD_S3_BUCKET" {
+				t.Errorf("Expected the bucket accepted, got %s", c.Detail)
+			}
+		}
+	})
+
+	t.Run("No job workers", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Jobs.Workers = 0
+
+		if c := checkFor(t, Validate(ctx, cfg), "JOB_WORKERS"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Negative privacy retention", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Privacy.AnonymizeIPDays = -1
+
+		if c := checkFor(t, Validate(ctx, cfg), "ANONYMIZE_IP_AFTER_DAYS"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Viewer privacy mode", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Privacy.ViewerMode = "anonymous"
+
+		if c := checkFor(t, Validate(ctx, cfg), "VIEWER_PRIVACY_MODE"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Daily report", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Reports.Hour = 24
+		cfg.Reports.Timezone = "Mars/Olympus"
+		cfg.Reports.Channels = []string{"telegram", "pager"}
+
+		report := Validate(ctx, cfg)
+		for _, key := range []string{"REPORT_HOUR", "REPORT_TIMEZONE", "REPORT_CHANNELS"} {
+			if c := checkFor(t, report, key); c.Severity != Fail {
+				t.Errorf("Expected FAIL for %s, got %s", key, c.Severity)
+			}
+		}
+	})
+
+	t.Run("Multiview limits", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Go2RTC.SignedURLTTL = 0
+		cfg.Go2RTC.MultiviewMax = 0
+		cfg.Go2RTC.PlayerTokenTTL = 0
+
+		report := Validate(ctx, cfg)
+		for _, key := range []string{"STREAM_URL_TTL_MINUTES", "STREAM_MULTIVIEW_MAX", "STREAM_TOKEN_TTL_MINUTES"} {
+			if c := checkFor(t, report, key); c.Severity != Fail {
+				t.Errorf("Expected FAIL for %s, got %s", key, c.Severity)
+			}
+		}
+	})
+
+	t.Run("Stream nodes", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Go2RTC.Nodes = []StreamNode{{Name: "north", APIURL: cfg.Go2RTC.APIURL}, {Name: "south", APIURL: closed.URL}}
+
+		report := Validate(ctx, cfg)
+		if err := report.Err(); err != nil {
+			t.Errorf("Expected an unreachable node not to stop the server, got %v", err)
+		}
+		if c := checkFor(t, report, "STREAM_NODES[north]"); c.Severity != Pass {
+			t.Errorf("Expected node north reachable, got %s %s", c.Severity, c.Detail)
+		}
+		if c := checkFor(t, report, "STREAM_NODES[south]"); c.Severity != Warn {
+			t.Errorf("Expected WARN for node south, got %s", c.Severity)
+		}
+
+		cfg.Go2RTC.Nodes = append(cfg.Go2RTC.Nodes, StreamNode{Name: "north", APIURL: cfg.Go2RTC.APIURL})
+		if c := checkFor(t, Validate(ctx, cfg), "STREAM_NODES"); c.Severity != Fail || !strings.Contains(c.Detail, "twice") {
+			t.Errorf("Expected FAIL for a repeated node, got %s %s", c.Severity, c.Detail)
+		}
+	})
+
+	t.Run("Stream cap below multiview grid", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Go2RTC.MaxSessionsPerIP = 4
+
+		if c := checkFor(t, Validate(ctx, cfg), "STREAM_MAX_SESSIONS_PER_IP"); c.Severity != Warn {
+			t.Errorf("Expected WARN, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Abuse camera limit below multi-view", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Go2RTC.AbuseCameras = 4
+
+		if c := checkFor(t, Validate(ctx, cfg), "STREAM_ABUSE_CAMERAS"); c.Severity != Warn {
+			t.Errorf("Expected WARN, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Admin APIs open to any origin", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Security.AllowedOrigins = "*"
+
+		if c := checkFor(t, Validate(ctx, cfg), "CORS_ADMIN_ORIGINS"); c.Severity != Warn {
+			t.Errorf("Expected WARN, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Cluster mode on SQLite", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Cluster = ClusterConfig{Enabled: true, InstanceID: "web-1"}
+		report := Validate(ctx, cfg)
+
+		if c := checkFor(t, report, "CLUSTER_MODE"); c.Severity != Warn {
+			t.Errorf("Expected WARN for CLUSTER_MODE, got %s", c.Severity)
+		}
+		if c := checkFor(t, report, "CLUSTER_LEASE_SECONDS"); c.Severity != Fail {
+			t.Errorf("Expected FAIL for CLUSTER_LEASE_SECONDS, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Redis URL", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Redis.URL = "http://cache:6379"
+		if c := checkFor(t, Validate(ctx, cfg), "REDIS_URL"); c.Severity != Fail {
+			t.Errorf("Expected FAIL for a non-redis URL, got %s", c.Severity)
+		}
+
+		server := redistest.NewServer(t)
+		cfg.Redis.URL = server.URL()
+		if c := checkFor(t, Validate(ctx, cfg), "REDIS_URL"); c.Severity != Pass {
+			t.Errorf("Expected PASS, got %s: %s", c.Severity, c.Detail)
+		}
+	})
+
+	t.Run("Telegram token without a chat", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Alerting.TelegramBotToken = "123:abc"
+		if c := checkFor(t, Validate(ctx, cfg), "TELEGRAM_BOT_TOKEN"); c.Severity != Warn {
+			t.Errorf("Expected WARN, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Unknown auto-vacuum mode", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Database.AutoVacuum = "weekly"
+
+		if c := checkFor(t, Validate(ctx, cfg), "DB_AUTO_VACUUM"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Health check timeout over the interval", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Health = HealthConfig{Enabled: true, Interval: 5 * time.Second, Timeout: 10 * time.Second, Concurrency: 8}
+
+		if c := checkFor(t, Validate(ctx, cfg), "HEALTH_CHECK_TIMEOUT_SECONDS"); c.Severity != Warn {
+			t.Errorf("Expected WARN, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Recording webhook without a base URL", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Webhooks = WebhookConfig{URL: "https://vms.example/hooks/cctv", Secret: "s3cret", LinkTTL: time.Hour}
+
+		if c := checkFor(t, Validate(ctx, cfg), "RECORDING_WEBHOOK_BASE_URL"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Gotify without a token", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Alerting.GotifyURL = "https://gotify.example"
+
+		if c := checkFor(t, Validate(ctx, cfg), "GOTIFY_URL"); c.Severity != Warn {
+			t.Errorf("Expected WARN, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Stream start alert without samples", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Health.StartAlert = 5 * time.Second
+		cfg.Health.StartMinSamples = 0
+
+		if c := checkFor(t, Validate(ctx, cfg), "STREAM_START_MIN_SAMPLES"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Stream traffic alerts without a baseline", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Health.TrafficDropAlert = true
+		cfg.Health.TrafficBaselineDays = 0
+
+		if c := checkFor(t, Validate(ctx, cfg), "STREAM_TRAFFIC_BASELINE_DAYS"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Detection confidence out of range", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Detection = DetectionConfig{URL: "http://yolo:8000/detect", Mode: "image", Timeout: time.Second, MinConfidence: 1.5}
+
+		if c := checkFor(t, Validate(ctx, cfg), "DETECTION_MIN_CONFIDENCE"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Weather without a cache", func(t *testing.T) {
+		cfg := valid(t)
+		cfg.Weather = WeatherConfig{APIKey: "key", URL: "https://api.openweathermap.org/data/2.5/weather", MaxLocations: 20}
+
+		if c := checkFor(t, Validate(ctx, cfg), "WEATHER_CACHE_MINUTES"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+
+	t.Run("Values Load could not parse", func(t *testing.T) {
+		os.Clearenv()
+		os.Setenv("SHUTDOWN_TIMEOUT_SECONDS", "30s")
+		os.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "cctv.db"))
+		os.Setenv("RECORDINGS_PATH", t.TempDir())
+		defer os.Clearenv()
+
+		cfg := Load()
+		if cfg.Server.ShutdownTimeout != 30*time.Second {
+			t.Errorf("Expected the default to be kept, got %s", cfg.Server.ShutdownTimeout)
+		}
+
+		if c := checkFor(t, Validate(ctx, cfg), "SHUTDOWN_TIMEOUT_SECONDS"); c.Severity != Fail {
+			t.Errorf("Expected FAIL, got %s", c.Severity)
+		}
+	})
+}
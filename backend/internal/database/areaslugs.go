@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/abcdefak87/cctv/internal/models"
+)
+
+// Area slugs (0029) give each area a clean URL for its public page,
+// unique within its organization. Existing areas get one made from their
+// name, which takes Go, so this is a Go migration.
+
+const areaSlugIndex = "CREATE UNIQUE INDEX IF NOT EXISTS idx_areas_organization_slug ON areas (organization_id, slug)"
+
+func upAreaSlugs(tx *sql.Tx, dialect *Dialect) error {
+	if err := execAll(tx, dialect, []string{"ALTER TABLE areas ADD COLUMN slug TEXT"}); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, organization_id, name FROM areas ORDER BY id ASC")
+	if err != nil {
+		return err
+	}
+	type area struct {
+		id, orgID int
+		name      string
+	}
+	var areas []area
+	for rows.Next() {
+		var a area
+		if err := rows.Scan(&a.id, &a.orgID, &a.name); err != nil {
+			rows.Close()
+			return err
+		}
+		areas = append(areas, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	taken := map[string]bool{}
+	for _, a := range areas {
+		base := models.AreaSlug(a.name)
+		slug := base
+		for n := 2; taken[fmt.Sprintf("%d/%s", a.orgID, slug)]; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[fmt.Sprintf("%d/%s", a.orgID, slug)] = true
+		if _, err := tx.Exec("UPDATE areas SET slug = ? WHERE id = ?", slug, a.id); err != nil {
+			return err
+		}
+	}
+	return execAll(tx, dialect, []string{areaSlugIndex})
+}
+
+func downAreaSlugs(tx *sql.Tx, dialect *Dialect) error {
+	return execAll(tx, dialect, []string{
+		"DROP INDEX IF EXISTS idx_areas_organization_slug",
+		"ALTER TABLE areas DROP COLUMN slug",
+	})
+}
@@ -1,105 +1,223 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/abcdefak87/cctv/internal/config"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func Connect(dbPath string) (*sql.DB, error) {
-	// Ensure directory exists
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
+// defaultBusyTimeout applies when DB_BUSY_TIMEOUT_MS is unset
+const defaultBusyTimeout = 5 * time.Second
+
+// Connect opens the configured database. SQLite is the default; set
+// DATABASE_DRIVER=postgres and DATABASE_URL for PostgreSQL.
+func Connect(cfg config.DatabaseConfig) (*sql.DB, error) {
+	dialect, err := DialectFor(cfg.Driver)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Open database
-	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_journal_mode=WAL")
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	var db *sql.DB
+	if dialect == Postgres {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("DATABASE_URL is required for the postgres driver")
+		}
+		connector, err := newPostgresConnector(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		db = sql.OpenDB(connector)
+	} else {
+		// Ensure directory exists
+		dir := filepath.Dir(cfg.Path)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+		
+		// Open database. WAL lets viewers read while a write is in
+		// progress; busy_timeout makes concurrent writers wait for the
+		// lock instead of failing with SQLITE_BUSY, and synchronous=NORMAL
+		// is safe under WAL and avoids an fsync per commit.
+		busyTimeout := cfg.BusyTimeout
+		if busyTimeout <= 0 {
+			busyTimeout = defaultBusyTimeout
+		}
+		dsn := fmt.Sprintf("%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d&_synchronous=NORMAL",
+			cfg.Path, busyTimeout.Milliseconds())
+		db, err = sql.Open("sqlite3", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
 	}
 	
 	// Test connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 	
 	return db, nil
 }
 
+// Close checkpoints the SQLite write-ahead log into the main database
+// file, so a stopped server leaves no -wal file behind, then closes db.
+func Close(ctx context.Context, db *sql.DB) error {
+	if dialectOf(db) == SQLite {
+		if _, err := db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			db.Close()
+			return fmt.Errorf("wal checkpoint failed: %w", err)
+		}
+	}
+	return db.Close()
+}
+
+// Backup writes a consistent copy of a SQLite database to path while it
+// stays online. path must not exist yet. PostgreSQL deployments should
+// use pg_dump instead.
+func Backup(ctx context.Context, db *sql.DB, path string) error {
+	if dialectOf(db) != SQLite {
+		return fmt.Errorf("backup only supports sqlite; use pg_dump for postgres")
+	}
+	
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file %s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	return nil
+}
+
+// RunMigrations brings the schema up to date; see migrate.go
 func RunMigrations(db *sql.DB) error {
-	// Create tables if not exists
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			role TEXT DEFAULT 'admin',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS areas (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT UNIQUE NOT NULL,
-			description TEXT,
-			rt TEXT,
-			rw TEXT,
-			kelurahan TEXT,
-			kecamatan TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS cameras (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			private_rtsp_url TEXT NOT NULL,
-			description TEXT,
-			location TEXT,
-			group_name TEXT,
-			area_id INTEGER,
-			enabled INTEGER DEFAULT 1,
-			stream_key TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (area_id) REFERENCES areas(id) ON DELETE SET NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS viewer_sessions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			camera_id INTEGER NOT NULL,
-			session_id TEXT NOT NULL,
-			ip_address TEXT,
-			user_agent TEXT,
-			started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			ended_at DATETIME,
-			FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE,
-			UNIQUE(camera_id, session_id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS audit_logs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER,
-			action TEXT NOT NULL,
-			details TEXT,
-			ip_address TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS feedbacks (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT,
-			email TEXT,
-			message TEXT NOT NULL,
-			status TEXT DEFAULT 'unread',
-			ip_address TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
+	return Migrate(db)
+}
+
+// upgradeLegacySchema adopts databases created before versioned
+// migrations, whose tables predate columns now in the baseline.
+func upgradeLegacySchema(tx *sql.Tx, dialect *Dialect) error {
+	if err := applyColumnUpgrades(tx, dialect); err != nil {
+		return fmt.Errorf("column upgrade failed: %w", err)
+	}
+	
+	if err := reconcileFeedback(tx, dialect); err != nil {
+		return fmt.Errorf("feedback migration failed: %w", err)
 	}
 	
-	for _, migration := range migrations {
-		if _, err := db.Exec(migration); err != nil {
-			return fmt.Errorf("migration failed: %w", err)
+	return nil
+}
+
+// columnUpgrades lists columns added after their table was first created.
+// SQLite only accepts constant defaults in ADD COLUMN, so timestamps are
+// backfilled separately. Definitions use the same type tokens as the
+// CREATE statements.
+var columnUpgrades = []struct {
+	table      string
+	column     string
+	definition string
+	backfill   string
+}{
+	{"areas", "parent_id", "INTEGER REFERENCES areas(id) ON DELETE SET NULL", ""},
+	{"areas", "level", "TEXT", ""},
+	{"areas", "updated_at", "{{timestamp}}", "UPDATE areas SET updated_at = created_at"},
+	{"areas", "boundary", "TEXT", ""},
+	{"cameras", "latitude", "{{float}}", ""},
+	{"cameras", "longitude", "{{float}}", ""},
+	{"cameras", "updated_at", "{{timestamp}}", "UPDATE cameras SET updated_at = created_at"},
+	{"users", "email", "TEXT", ""},
+	{"users", "updated_at", "{{timestamp}}", "UPDATE users SET updated_at = created_at"},
+}
+
+func applyColumnUpgrades(tx *sql.Tx, dialect *Dialect) error {
+	for _, upgrade := range columnUpgrades {
+		exists, err := dialect.columnExists(tx, upgrade.table, upgrade.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		
+		if _, err := tx.Exec(dialect.DDL("ALTER TABLE " + upgrade.table + " ADD COLUMN " + upgrade.column + " " + upgrade.definition)); err != nil {
+			return fmt.Errorf("%s.%s: %w", upgrade.table, upgrade.column, err)
+		}
+		if upgrade.backfill != "" {
+			if _, err := tx.Exec(upgrade.backfill); err != nil {
+				return fmt.Errorf("%s.%s backfill: %w", upgrade.table, upgrade.column, err)
+			}
+		}
+	}
+	
+	return nil
+}
+
+// reconcileFeedback moves rows from the legacy `feedbacks` table into
+// `feedback`, adds columns missing on older databases and normalizes
+// statuses to the unread/read/resolved set used by the admin panel.
+func reconcileFeedback(tx *sql.Tx, dialect *Dialect) error {
+	hasUpdatedAt, err := dialect.columnExists(tx, "feedback", "updated_at")
+	if err != nil {
+		return err
+	}
+	if !hasUpdatedAt {
+		// SQLite only accepts constant defaults in ADD COLUMN
+		if _, err := tx.Exec(dialect.DDL(`ALTER TABLE feedback ADD COLUMN updated_at {{timestamp}}`)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE feedback SET updated_at = created_at`); err != nil {
+			return err
 		}
 	}
 	
+	hasIPAddress, err := dialect.columnExists(tx, "feedback", "ip_address")
+	if err != nil {
+		return err
+	}
+	if !hasIPAddress {
+		if _, err := tx.Exec(`ALTER TABLE feedback ADD COLUMN ip_address TEXT`); err != nil {
+			return err
+		}
+	}
+	
+	legacy, err := dialect.tableExists(tx, "feedbacks")
+	if err != nil {
+		return err
+	}
+	if legacy {
+		if _, err := tx.Exec(`
+			INSERT INTO feedback (name, email, message, status, ip_address, created_at, updated_at)
+			SELECT name, email, message, status, ip_address, created_at, created_at
+			FROM feedbacks
+		`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DROP TABLE feedbacks`); err != nil {
+			return err
+		}
+	}
+	
+	// Statuses written by earlier handler versions
+	if _, err := tx.Exec(`
+		UPDATE feedback SET status = CASE status
+			WHEN 'pending' THEN 'unread'
+			WHEN 'reviewed' THEN 'read'
+			WHEN 'dismissed' THEN 'resolved'
+			ELSE 'unread'
+		END
+		WHERE status IS NULL OR status NOT IN ('unread', 'read', 'resolved')
+	`); err != nil {
+		return err
+	}
+	
 	return nil
 }
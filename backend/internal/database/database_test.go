@@ -0,0 +1,445 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	// Every pooled connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestRunMigrations(t *testing.T) {
+	t.Run("Fresh database", func(t *testing.T) {
+		db := openTestDB(t)
+		defer db.Close()
+
+		if err := RunMigrations(db); err != nil {
+			t.Fatalf("Migrations failed: %v", err)
+		}
+
+		_, err := db.Exec(`INSERT INTO feedback (name, message, updated_at) VALUES ('a', 'b', CURRENT_TIMESTAMP)`)
+		if err != nil {
+			t.Errorf("Expected feedback table to accept inserts, got: %v", err)
+		}
+	})
+
+	t.Run("Legacy feedbacks table is migrated", func(t *testing.T) {
+		db := openTestDB(t)
+		defer db.Close()
+
+		_, err := db.Exec(`
+			CREATE TABLE feedbacks (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT,
+				email TEXT,
+				message TEXT NOT NULL,
+				status TEXT DEFAULT 'unread',
+				ip_address TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)
+		`)
+		if err != nil {
+			t.Fatalf("Failed to create legacy table: %v", err)
+		}
+		db.Exec(`INSERT INTO feedbacks (name, message, status) VALUES ('Budi', 'Kamera mati', 'read')`)
+		db.Exec(`INSERT INTO feedbacks (name, message, status) VALUES ('Sari', 'Terima kasih', 'pending')`)
+
+		if err := RunMigrations(db); err != nil {
+			t.Fatalf("Migrations failed: %v", err)
+		}
+
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM feedback`).Scan(&count)
+		if count != 2 {
+			t.Errorf("Expected 2 migrated rows, got %d", count)
+		}
+
+		var status string
+		db.QueryRow(`SELECT status FROM feedback WHERE name = 'Sari'`).Scan(&status)
+		if status != "unread" {
+			t.Errorf("Expected status 'unread', got '%s'", status)
+		}
+
+		var legacy int
+		db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'feedbacks'`).Scan(&legacy)
+		if legacy != 0 {
+			t.Error("Legacy feedbacks table should be dropped")
+		}
+	})
+
+	t.Run("Migrations are idempotent", func(t *testing.T) {
+		db := openTestDB(t)
+		defer db.Close()
+
+		for i := 0; i < 2; i++ {
+			if err := RunMigrations(db); err != nil {
+				t.Fatalf("Run %d failed: %v", i+1, err)
+			}
+		}
+	})
+}
+
+func TestMigrationFiles(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Expected version %d, got %d (%s)", i+1, m.Version, m.Name)
+		}
+	}
+
+	if _, _, _, err := parseMigrationName("0001_initial_schema.up.sql"); err != nil {
+		t.Errorf("Expected valid name, got %v", err)
+	}
+	for _, name := range []string{"initial.up.sql", "0001_initial.sql", "0001_initial.sideways.sql"} {
+		if _, _, _, err := parseMigrationName(name); err == nil {
+			t.Errorf("Expected error for %q", name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts := splitStatements(`-- comment
+CREATE TABLE a (
+	id INTEGER
+);
+
+CREATE INDEX idx ON a (id);
+`)
+	if len(stmts) != 2 {
+		t.Fatalf("Expected 2 statements, got %d: %q", len(stmts), stmts)
+	}
+	if stmts[1] != "CREATE INDEX idx ON a (id);" {
+		t.Errorf("Unexpected statement: %q", stmts[1])
+	}
+}
+
+func TestMigrateStatusAndRollback(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	count, err := MigrateTo(db, 1)
+	if err != nil || count != 1 {
+		t.Fatalf("Expected 1 migration applied, got %d (%v)", count, err)
+	}
+
+	states, err := Status(db)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if states[0].AppliedAt == nil {
+		t.Error("Expected first migration to be applied")
+	}
+	for _, s := range states[1:] {
+		if s.AppliedAt != nil {
+			t.Errorf("Expected migration %d to be pending", s.Version)
+		}
+	}
+
+	count, err = Rollback(db, 1)
+	if err != nil || count != 1 {
+		t.Fatalf("Expected 1 migration rolled back, got %d (%v)", count, err)
+	}
+
+	exists, _ := SQLite.tableExists(db, "cameras")
+	if exists {
+		t.Error("Expected cameras table to be dropped")
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	count, err = Rollback(db, len(states)+1)
+	if err != nil || count != len(states) {
+		t.Fatalf("Expected %d migrations rolled back, got %d (%v)", len(states), count, err)
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	// Tables as created before email/updated_at columns existed
+	_, err := db.Exec(`
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT UNIQUE NOT NULL,
+			password_hash TEXT NOT NULL,
+			role TEXT DEFAULT 'admin',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+	db.Exec(`INSERT INTO users (username, password_hash) VALUES ('admin', 'x')`)
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+
+	for _, column := range []string{"email", "updated_at"} {
+		if ok, _ := SQLite.columnExists(db, "users", column); !ok {
+			t.Errorf("Expected users.%s to be added", column)
+		}
+	}
+
+	var missing int
+	db.QueryRow(`SELECT COUNT(*) FROM users WHERE updated_at IS NULL`).Scan(&missing)
+	if missing != 0 {
+		t.Errorf("Expected updated_at to be backfilled, got %d empty rows", missing)
+	}
+}
+
+func TestDashboardTables(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+
+	queries := []string{
+		"SELECT key, value, category, description, updated_at FROM settings",
+		"SELECT COUNT(*), COALESCE(SUM(file_size), 0) FROM recordings",
+		"SELECT camera_id, status, last_check FROM camera_health",
+		"SELECT id, user_id, action, resource, details, ip_address, created_at FROM activity_logs",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Errorf("Expected %q to succeed, got %v", query, err)
+		}
+	}
+
+	var category string
+	db.Exec(`INSERT INTO settings (key, value) VALUES ('map_default_center', '[]')`)
+	db.QueryRow(`SELECT category FROM settings WHERE key = 'map_default_center'`).Scan(&category)
+	if category != "general" {
+		t.Errorf("Expected default category 'general', got '%s'", category)
+	}
+}
+
+func TestOrganizationsMigration(t *testing.T) {
+	// Foreign keys on, as Connect opens the database
+	db, err := Connect(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "cctv.db")})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := MigrateTo(db, 9); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	seed := []string{
+		`INSERT INTO areas (id, name) VALUES (1, 'Dander')`,
+		`INSERT INTO areas (id, name, parent_id) VALUES (2, 'RT 01', 1)`,
+		`INSERT INTO cameras (name, private_rtsp_url, area_id) VALUES ('Gate', 'rtsp://gate', 2)`,
+		`INSERT INTO settings (key, value) VALUES ('company_name', '"RAF NET"')`,
+	}
+	for _, stmt := range seed {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	t.Run("References survive the rebuild", func(t *testing.T) {
+		var areaID, parentID sql.NullInt64
+		db.QueryRow(`SELECT area_id FROM cameras`).Scan(&areaID)
+		db.QueryRow(`SELECT parent_id FROM areas WHERE id = 2`).Scan(&parentID)
+		if areaID.Int64 != 2 || parentID.Int64 != 1 {
+			t.Errorf("Expected area 2 under area 1, got camera area %v and parent %v", areaID, parentID)
+		}
+	})
+
+	t.Run("Existing rows join the default organization", func(t *testing.T) {
+		var cameras, settings int
+		db.QueryRow(`SELECT COUNT(*) FROM cameras WHERE organization_id = 1`).Scan(&cameras)
+		db.QueryRow(`SELECT COUNT(*) FROM settings WHERE organization_id = 1`).Scan(&settings)
+		if cameras != 1 || settings != 1 {
+			t.Errorf("Expected 1 camera and 1 setting in org 1, got %d and %d", cameras, settings)
+		}
+	})
+
+	t.Run("Names are unique per organization", func(t *testing.T) {
+		if _, err := db.Exec(`INSERT INTO organizations (name, slug) VALUES ('Tanjungharjo', 'tanjungharjo')`); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO areas (name, organization_id) VALUES ('Dander', 2)`); err != nil {
+			t.Errorf("Expected another organization to reuse an area name, got %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO areas (name) VALUES ('Dander')`); err == nil {
+			t.Error("Expected a duplicate area name in one organization to fail")
+		}
+		if _, err := db.Exec(`INSERT INTO settings (key, value, organization_id) VALUES ('company_name', '"Desa"', 2)`); err != nil {
+			t.Errorf("Expected another organization to reuse a setting key, got %v", err)
+		}
+	})
+}
+
+func TestViewerSessionTokensMigration(t *testing.T) {
+	db, err := Connect(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "cctv.db")})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := MigrateTo(db, 25); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	seed := []string{
+		`INSERT INTO cameras (id, name, private_rtsp_url) VALUES (1, 'Gate', 'rtsp://gate')`,
+		`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, transport, ended_at) VALUES (1, 'alice', '10.0.0.1', 'hls', CURRENT_TIMESTAMP)`,
+	}
+	for _, stmt := range seed {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+	if _, err := MigrateTo(db, 26); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+
+	var ip, transport string
+	db.QueryRow(`SELECT ip_address, transport FROM viewer_sessions WHERE session_id = 'alice'`).Scan(&ip, &transport)
+	if ip != "10.0.0.1" || transport != "hls" {
+		t.Errorf("Expected the session kept through the rebuild, got %q %q", ip, transport)
+	}
+
+	if _, err := db.Exec(`INSERT INTO viewer_sessions (camera_id, session_id) VALUES (1, 'alice')`); err != nil {
+		t.Errorf("Expected a new visit next to the stopped one, got %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO viewer_sessions (camera_id, session_id) VALUES (1, 'alice')`); err == nil {
+		t.Error("Expected a second open session of one viewer and camera to fail")
+	}
+
+	if _, err := Rollback(db, 1); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	var rows int
+	db.QueryRow(`SELECT COUNT(*) FROM viewer_sessions`).Scan(&rows)
+	if rows != 1 {
+		t.Errorf("Expected only the latest visit kept, got %d rows", rows)
+	}
+}
+
+func TestAreaSlugsMigration(t *testing.T) {
+	db, err := Connect(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "cctv.db")})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := MigrateTo(db, 28); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	seed := []string{
+		`INSERT INTO organizations (id, name, slug) VALUES (2, 'Dander', 'dander')`,
+		`INSERT INTO areas (id, name, organization_id) VALUES (1, 'Kelurahan Cempaka Putih', 1), (2, 'kelurahan cempaka-putih', 1),
+			(3, 'Kelurahan Cempaka Putih', 2), (4, 'RT 01 / RW 05', 1), (5, '***', 1)`,
+	}
+	for _, stmt := range seed {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+	if _, err := MigrateTo(db, 29); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+
+	want := map[int]string{1: "kelurahan-cempaka-putih", 2: "kelurahan-cempaka-putih-2", 3: "kelurahan-cempaka-putih", 4: "rt-01-rw-05", 5: "area"}
+	for id, slug := range want {
+		var got string
+		db.QueryRow(`SELECT slug FROM areas WHERE id = ?`, id).Scan(&got)
+		if got != slug {
+			t.Errorf("Area %d: expected slug %q, got %q", id, slug, got)
+		}
+	}
+	if _, err := db.Exec(`UPDATE areas SET slug = 'rt-01-rw-05' WHERE id = 5`); err == nil {
+		t.Error("Expected a slug taken in the organization to fail")
+	}
+
+	if _, err := Rollback(db, 1); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cctv.db")
+	db, err := Connect(config.DatabaseConfig{Path: path})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	db.Exec(`INSERT INTO areas (name) VALUES ('RT 01')`)
+
+	if err := Close(context.Background(), db); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() > 0 {
+		t.Errorf("Expected WAL to be checkpointed, %d bytes left", info.Size())
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Connect(config.DatabaseConfig{Path: filepath.Join(dir, "cctv.db")})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer db.Close()
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	db.Exec(`INSERT INTO areas (name) VALUES ('RT 01')`)
+
+	path := filepath.Join(dir, "backups", "copy.db")
+	if err := Backup(context.Background(), db, path); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	t.Run("Copy has the data", func(t *testing.T) {
+		copied, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatalf("Failed to open backup: %v", err)
+		}
+		defer copied.Close()
+
+		var count int
+		if err := copied.QueryRow(`SELECT COUNT(*) FROM areas`).Scan(&count); err != nil || count != 1 {
+			t.Errorf("Expected 1 area in the backup, got %d (%v)", count, err)
+		}
+	})
+
+	t.Run("Refuses to overwrite", func(t *testing.T) {
+		if err := Backup(context.Background(), db, path); err == nil {
+			t.Error("Expected an error for an existing file")
+		}
+	})
+}
@@ -0,0 +1,29 @@
+// Package dbtest opens a migrated SQLite database for tests of the
+// packages that store to it.
+package dbtest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database"
+)
+
+// Open connects to a new database file under the test's temporary
+// directory and runs the migrations on it. It is closed with the test.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+
+	db, err := database.Connect(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "cctv.db")})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	return db
+}
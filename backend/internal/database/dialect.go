@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Dialect captures the schema differences between the supported
+// databases. Queries are written once; DDL uses {{tokens}} for the
+// column types that differ.
+type Dialect struct {
+	Name  string
+	types *strings.Replacer
+
+	// tableQuery and columnQuery report whether a table/column exists
+	tableQuery  string
+	columnQuery string
+}
+
+var (
+	SQLite = &Dialect{
+		Name: "sqlite",
+		types: strings.NewReplacer(
+			"{{id}}", "INTEGER PRIMARY KEY AUTOINCREMENT",
+			"{{timestamp}}", "DATETIME",
+			"{{float}}", "REAL",
+			"{{bool}}", "INTEGER",
+			"{{blob}}", "BLOB",
+		),
+		tableQuery:  `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+		columnQuery: `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`,
+	}
+
+	Postgres = &Dialect{
+		Name: "postgres",
+		types: strings.NewReplacer(
+			"{{id}}", "SERIAL PRIMARY KEY",
+			"{{timestamp}}", "TIMESTAMPTZ",
+			"{{float}}", "DOUBLE PRECISION",
+			"{{bool}}", "BOOLEAN",
+			"{{blob}}", "BYTEA",
+		),
+		tableQuery: `SELECT COUNT(*) FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name = ?`,
+		columnQuery: `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+	}
+)
+
+// DialectFor returns the dialect for a DATABASE_DRIVER value
+func DialectFor(driver string) (*Dialect, error) {
+	switch strings.ToLower(driver) {
+	case "", "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "postgresql":
+		return Postgres, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", driver)
+}
+
+// dialectOf picks the dialect from the driver behind db
+func dialectOf(db *sql.DB) *Dialect {
+	if _, ok := db.Driver().(postgresDriver); ok {
+		return Postgres
+	}
+	return SQLite
+}
+
+// DDL expands the column type tokens in a schema statement
+func (d *Dialect) DDL(stmt string) string {
+	return d.types.Replace(stmt)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (d *Dialect) tableExists(q queryRower, table string) (bool, error) {
+	var count int
+	err := q.QueryRow(d.tableQuery, table).Scan(&count)
+	return count > 0, err
+}
+
+func (d *Dialect) columnExists(q queryRower, table, column string) (bool, error) {
+	var count int
+	err := q.QueryRow(d.columnQuery, table, column).Scan(&count)
+	return count > 0, err
+}
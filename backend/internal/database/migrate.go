@@ -0,0 +1,316 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/ as NNNN_name.up.sql / NNNN_name.down.sql
+// and are applied in version order. Applied versions are recorded in
+// schema_migrations so each runs once. Column types use the {{tokens}}
+// expanded by Dialect.DDL.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one schema version. SQL migrations come from the embedded
+// files; a few upgrades that must inspect the existing schema are Go.
+type Migration struct {
+	Version int
+	Name    string
+
+	up, down     string
+	upFn, downFn func(tx *sql.Tx, dialect *Dialect) error
+}
+
+// Reversible reports whether the migration can be rolled back
+func (m Migration) Reversible() bool {
+	return m.down != "" || m.downFn != nil
+}
+
+// goMigrations are registered alongside the SQL files
+var goMigrations = []Migration{
+	// Only adds columns the baseline already has; nothing to undo
+	{Version: 2, Name: "upgrade_legacy_schema", upFn: upgradeLegacySchema, downFn: noopMigration},
+	// Rebuilds areas and settings on SQLite; see organizations.go
+	{Version: 10, Name: "organizations", upFn: upOrganizations, downFn: downOrganizations},
+	// Rebuilds viewer_sessions on SQLite; see viewersessions.go
+	{Version: 26, Name: "viewer_session_tokens", upFn: upViewerSessionTokens, downFn: downViewerSessionTokens},
+	// Fills in slugs made from the area names; see areaslugs.go
+	{Version: 29, Name: "area_slugs", upFn: upAreaSlugs, downFn: downAreaSlugs},
+}
+
+// MigrationState is a migration and when it was applied, if at all
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns every known migration in version order
+func Migrations() ([]Migration, error) {
+	byVersion := map[int]*Migration{}
+	for i := range goMigrations {
+		m := goMigrations[i]
+		byVersion[m.Version] = &m
+	}
+
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		version, name, direction, err := parseMigrationName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %04d has two names: %s and %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" && m.upFn == nil {
+			return nil, fmt.Errorf("migration %04d_%s has no up step", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// parseMigrationName splits "0001_initial_schema.up.sql"
+func parseMigrationName(file string) (int, string, string, error) {
+	base := strings.TrimSuffix(file, ".sql")
+	direction := path.Ext(base)
+	base = strings.TrimSuffix(base, direction)
+	direction = strings.TrimPrefix(direction, ".")
+
+	prefix, name, ok := strings.Cut(base, "_")
+	version, err := strconv.Atoi(prefix)
+	if !ok || err != nil || (direction != "up" && direction != "down") {
+		return 0, "", "", fmt.Errorf("invalid migration file name %q", file)
+	}
+
+	return version, name, direction, nil
+}
+
+// Migrate applies every pending migration
+func Migrate(db *sql.DB) error {
+	_, err := MigrateTo(db, -1)
+	return err
+}
+
+// MigrateTo applies pending migrations up to and including target
+// (-1 for all) and returns how many ran.
+func MigrateTo(db *sql.DB, target int) (int, error) {
+	dialect := dialectOf(db)
+
+	applied, err := appliedVersions(db, dialect)
+	if err != nil {
+		return 0, err
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if target >= 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err := inTx(db, func(tx *sql.Tx) error {
+			if err := m.apply(tx, dialect, m.up, m.upFn); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.Version, m.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Rollback reverts the most recently applied migrations, newest first
+func Rollback(db *sql.DB, steps int) (int, error) {
+	dialect := dialectOf(db)
+
+	applied, err := appliedVersions(db, dialect)
+	if err != nil {
+		return 0, err
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if !m.Reversible() {
+			return count, fmt.Errorf("migration %04d_%s cannot be rolled back", m.Version, m.Name)
+		}
+
+		err := inTx(db, func(tx *sql.Tx) error {
+			if err := m.apply(tx, dialect, m.down, m.downFn); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("rollback %04d_%s: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Status lists every migration with its applied time
+func Status(db *sql.DB) ([]MigrationState, error) {
+	applied, err := appliedVersions(db, dialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			at := at
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+func noopMigration(*sql.Tx, *Dialect) error { return nil }
+
+func (m Migration) apply(tx *sql.Tx, dialect *Dialect, script string, fn func(*sql.Tx, *Dialect) error) error {
+	if fn != nil {
+		return fn(tx, dialect)
+	}
+	for _, stmt := range splitStatements(dialect.DDL(script)) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appliedVersions(db *sql.DB, dialect *Dialect) (map[int]time.Time, error) {
+	_, err := db.Exec(dialect.DDL(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at {{timestamp}} NOT NULL
+	)`))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitStatements breaks a script on statement-ending semicolons and
+// drops comment-only lines
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
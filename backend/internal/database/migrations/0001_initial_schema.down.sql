@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS feedback;
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS viewer_sessions;
+DROP TABLE IF EXISTS cameras;
+DROP TABLE IF EXISTS areas;
+DROP TABLE IF EXISTS users;
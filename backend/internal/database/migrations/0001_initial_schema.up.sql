@@ -0,0 +1,77 @@
+-- Baseline schema. IF NOT EXISTS lets databases created before
+-- versioned migrations adopt this version without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+	id {{id}},
+	username TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	email TEXT,
+	role TEXT DEFAULT 'admin',
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS areas (
+	id {{id}},
+	name TEXT UNIQUE NOT NULL,
+	description TEXT,
+	rt TEXT,
+	rw TEXT,
+	kelurahan TEXT,
+	kecamatan TEXT,
+	parent_id INTEGER REFERENCES areas(id) ON DELETE SET NULL,
+	level TEXT,
+	boundary TEXT,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS cameras (
+	id {{id}},
+	name TEXT NOT NULL,
+	private_rtsp_url TEXT NOT NULL,
+	description TEXT,
+	location TEXT,
+	group_name TEXT,
+	area_id INTEGER,
+	latitude {{float}},
+	longitude {{float}},
+	enabled {{bool}} DEFAULT TRUE,
+	stream_key TEXT,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (area_id) REFERENCES areas(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS viewer_sessions (
+	id {{id}},
+	camera_id INTEGER NOT NULL,
+	session_id TEXT NOT NULL,
+	ip_address TEXT,
+	user_agent TEXT,
+	started_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	ended_at {{timestamp}},
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE,
+	UNIQUE(camera_id, session_id)
+);
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+	id {{id}},
+	user_id INTEGER,
+	action TEXT NOT NULL,
+	details TEXT,
+	ip_address TEXT,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS feedback (
+	id {{id}},
+	name TEXT,
+	email TEXT,
+	message TEXT NOT NULL,
+	status TEXT DEFAULT 'unread',
+	ip_address TEXT,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_viewer_sessions_active;
+DROP INDEX IF EXISTS idx_viewer_sessions_started;
+DROP TABLE IF EXISTS activity_logs;
+DROP TABLE IF EXISTS camera_health;
+DROP TABLE IF EXISTS recordings;
+DROP TABLE IF EXISTS settings;
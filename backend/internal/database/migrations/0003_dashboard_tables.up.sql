@@ -0,0 +1,52 @@
+-- Tables the settings and admin dashboards query, plus indexes for the
+-- viewer_sessions lookups done on every dashboard load. Text columns the
+-- handlers scan into strings default to '' rather than NULL.
+
+CREATE TABLE IF NOT EXISTS settings (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL DEFAULT '',
+	category TEXT NOT NULL DEFAULT 'general',
+	description TEXT NOT NULL DEFAULT '',
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_settings_category ON settings (category);
+
+CREATE TABLE IF NOT EXISTS recordings (
+	id {{id}},
+	camera_id INTEGER NOT NULL,
+	file_path TEXT NOT NULL,
+	file_size BIGINT NOT NULL DEFAULT 0,
+	duration INTEGER NOT NULL DEFAULT 0,
+	started_at {{timestamp}},
+	ended_at {{timestamp}},
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_recordings_camera ON recordings (camera_id, started_at);
+
+CREATE TABLE IF NOT EXISTS camera_health (
+	camera_id INTEGER PRIMARY KEY,
+	status TEXT NOT NULL DEFAULT 'unknown',
+	last_check {{timestamp}},
+	error_message TEXT,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS activity_logs (
+	id {{id}},
+	user_id INTEGER,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL DEFAULT '',
+	details TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_activity_logs_created ON activity_logs (created_at);
+
+CREATE INDEX IF NOT EXISTS idx_viewer_sessions_started ON viewer_sessions (started_at);
+CREATE INDEX IF NOT EXISTS idx_viewer_sessions_active ON viewer_sessions (camera_id, ended_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_viewer_sessions_camera_started;
+DROP INDEX IF EXISTS idx_cameras_stream_key;
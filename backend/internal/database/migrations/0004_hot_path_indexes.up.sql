@@ -0,0 +1,5 @@
+-- Stream key lookups run on every HLS segment and viewer heartbeat
+CREATE INDEX IF NOT EXISTS idx_cameras_stream_key ON cameras (stream_key);
+
+-- Per-camera viewer history (area stats, dashboard charts)
+CREATE INDEX IF NOT EXISTS idx_viewer_sessions_camera_started ON viewer_sessions (camera_id, started_at);
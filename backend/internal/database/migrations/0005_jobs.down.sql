@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_jobs_claim;
+DROP TABLE IF EXISTS jobs;
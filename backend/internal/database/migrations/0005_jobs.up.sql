@@ -0,0 +1,17 @@
+-- Background job queue (internal/jobs). Finished jobs are deleted;
+-- failed ones stay for inspection.
+CREATE TABLE IF NOT EXISTS jobs (
+	id {{id}},
+	type TEXT NOT NULL,
+	payload TEXT NOT NULL DEFAULT '',
+	priority INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL DEFAULT 5,
+	last_error TEXT NOT NULL DEFAULT '',
+	run_at {{timestamp}} NOT NULL,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_claim ON jobs (status, priority, run_at);
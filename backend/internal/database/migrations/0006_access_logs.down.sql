@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_access_logs_ip_created;
+DROP INDEX IF EXISTS idx_access_logs_created;
+DROP TABLE IF EXISTS access_logs;
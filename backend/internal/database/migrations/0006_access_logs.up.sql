@@ -0,0 +1,16 @@
+-- HTTP access log (ACCESS_LOG_SINK=database), pruned after
+-- ACCESS_LOG_RETENTION_DAYS
+CREATE TABLE IF NOT EXISTS access_logs (
+	id {{id}},
+	method TEXT NOT NULL,
+	path TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	latency_ms INTEGER NOT NULL DEFAULT 0,
+	user_id INTEGER,
+	ip TEXT NOT NULL DEFAULT '',
+	request_id TEXT NOT NULL DEFAULT '',
+	created_at {{timestamp}} NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_logs_created ON access_logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_access_logs_ip_created ON access_logs (ip, created_at);
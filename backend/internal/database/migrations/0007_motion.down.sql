@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_motion_events_camera;
+DROP TABLE IF EXISTS motion_events;
+DROP TABLE IF EXISTS motion_settings;
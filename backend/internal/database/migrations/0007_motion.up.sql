@@ -0,0 +1,23 @@
+-- Per-camera motion detection settings; zones is a JSON array of
+-- rectangles in frame fractions
+CREATE TABLE IF NOT EXISTS motion_settings (
+	camera_id INTEGER PRIMARY KEY,
+	enabled {{bool}} NOT NULL DEFAULT FALSE,
+	sensitivity INTEGER NOT NULL DEFAULT 50,
+	zones TEXT NOT NULL DEFAULT '[]',
+	cooldown_seconds INTEGER NOT NULL DEFAULT 30,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE
+);
+
+-- Motion detected by the MOTION_ENABLED worker
+CREATE TABLE IF NOT EXISTS motion_events (
+	id {{id}},
+	camera_id INTEGER NOT NULL,
+	score {{float}} NOT NULL,
+	zone TEXT NOT NULL DEFAULT '',
+	created_at {{timestamp}} NOT NULL,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_motion_events_camera ON motion_events (camera_id, id);
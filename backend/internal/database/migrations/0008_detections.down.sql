@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS detection_rules;
+DROP INDEX IF EXISTS idx_detections_camera;
+DROP INDEX IF EXISTS idx_detections_label;
+DROP TABLE IF EXISTS detections;
@@ -0,0 +1,33 @@
+-- Objects found by the detection service (DETECTION_URL); the box is in
+-- fractions of the frame from the top-left corner
+CREATE TABLE IF NOT EXISTS detections (
+	id {{id}},
+	camera_id INTEGER NOT NULL,
+	motion_event_id INTEGER,
+	label TEXT NOT NULL,
+	confidence {{float}} NOT NULL,
+	box_x {{float}} NOT NULL DEFAULT 0,
+	box_y {{float}} NOT NULL DEFAULT 0,
+	box_w {{float}} NOT NULL DEFAULT 0,
+	box_h {{float}} NOT NULL DEFAULT 0,
+	created_at {{timestamp}} NOT NULL,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE,
+	FOREIGN KEY (motion_event_id) REFERENCES motion_events(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_detections_label ON detections (label, id);
+CREATE INDEX IF NOT EXISTS idx_detections_camera ON detections (camera_id, id);
+
+-- Alert when a class is detected; camera_id NULL matches every camera
+CREATE TABLE IF NOT EXISTS detection_rules (
+	id {{id}},
+	name TEXT NOT NULL,
+	camera_id INTEGER,
+	label TEXT NOT NULL,
+	min_confidence {{float}} NOT NULL DEFAULT 0.5,
+	cooldown_seconds INTEGER NOT NULL DEFAULT 300,
+	enabled {{bool}} NOT NULL DEFAULT TRUE,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE
+);
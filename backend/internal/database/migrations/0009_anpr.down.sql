@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_anpr_events_created;
+DROP INDEX IF EXISTS idx_anpr_events_camera;
+DROP INDEX IF EXISTS idx_anpr_events_plate;
+DROP TABLE IF EXISTS anpr_events;
+ALTER TABLE users DROP COLUMN permissions;
+ALTER TABLE cameras DROP COLUMN traffic;
@@ -0,0 +1,26 @@
+-- Traffic cameras read licence plates; only their plates are stored
+ALTER TABLE cameras ADD COLUMN traffic {{bool}} NOT NULL DEFAULT FALSE;
+
+-- Comma separated grants beyond the role, e.g. "anpr"; admins have all
+ALTER TABLE users ADD COLUMN permissions TEXT NOT NULL DEFAULT '';
+
+-- Plate reads, from an ANPR camera or box (POST /api/anpr/events) or
+-- from the detection service. plate_normalized is upper case letters and
+-- digits only, for search. Rows past ANPR_RETENTION_DAYS are deleted.
+CREATE TABLE IF NOT EXISTS anpr_events (
+	id {{id}},
+	camera_id INTEGER NOT NULL,
+	plate TEXT NOT NULL,
+	plate_normalized TEXT NOT NULL,
+	confidence {{float}} NOT NULL,
+	snapshot_url TEXT NOT NULL DEFAULT '',
+	detection_id INTEGER,
+	source TEXT NOT NULL,
+	created_at {{timestamp}} NOT NULL,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE,
+	FOREIGN KEY (detection_id) REFERENCES detections(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_anpr_events_plate ON anpr_events (plate_normalized, id);
+CREATE INDEX IF NOT EXISTS idx_anpr_events_camera ON anpr_events (camera_id, id);
+CREATE INDEX IF NOT EXISTS idx_anpr_events_created ON anpr_events (created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_camera_uptime_day;
+DROP TABLE IF EXISTS camera_uptime;
@@ -0,0 +1,14 @@
+-- Daily uptime per camera for the public status page. The status
+-- sampler adds a sample for every enabled camera every few minutes and
+-- counts it online unless its last health check found it offline. day
+-- is YYYY-MM-DD in UTC; rows older than 90 days are deleted.
+CREATE TABLE IF NOT EXISTS camera_uptime (
+	camera_id INTEGER NOT NULL,
+	day TEXT NOT NULL,
+	samples INTEGER NOT NULL DEFAULT 0,
+	online_samples INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (camera_id, day),
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_camera_uptime_day ON camera_uptime (day);
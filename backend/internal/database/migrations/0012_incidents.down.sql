@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_incident_updates_incident;
+DROP TABLE IF EXISTS incident_updates;
+DROP INDEX IF EXISTS idx_incident_cameras_camera;
+DROP TABLE IF EXISTS incident_cameras;
+DROP INDEX IF EXISTS idx_incidents_organization;
+DROP TABLE IF EXISTS incidents;
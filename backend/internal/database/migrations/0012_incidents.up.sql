@@ -0,0 +1,50 @@
+-- Incidents admins open (by hand or from an alert), acknowledge and
+-- resolve. Published incidents appear on the public status page with
+-- their public updates.
+CREATE TABLE IF NOT EXISTS incidents (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	title TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'open',
+	severity TEXT NOT NULL DEFAULT 'minor',
+	published {{bool}} NOT NULL DEFAULT FALSE,
+	detection_id INTEGER,
+	created_by INTEGER,
+	opened_at {{timestamp}} NOT NULL,
+	acknowledged_at {{timestamp}},
+	resolved_at {{timestamp}},
+	updated_at {{timestamp}} NOT NULL,
+	FOREIGN KEY (detection_id) REFERENCES detections(id) ON DELETE SET NULL,
+	FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_incidents_organization ON incidents (organization_id, id);
+
+CREATE TABLE IF NOT EXISTS incident_cameras (
+	incident_id INTEGER NOT NULL,
+	camera_id INTEGER NOT NULL,
+	PRIMARY KEY (incident_id, camera_id),
+	FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_incident_cameras_camera ON incident_cameras (camera_id);
+
+-- Timeline of an incident: notes, status changes, and alerts raised on
+-- its cameras while it was unresolved (kind note, status or alert)
+CREATE TABLE IF NOT EXISTS incident_updates (
+	id {{id}},
+	incident_id INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL DEFAULT '',
+	public {{bool}} NOT NULL DEFAULT FALSE,
+	user_id INTEGER,
+	detection_id INTEGER,
+	created_at {{timestamp}} NOT NULL,
+	FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+	FOREIGN KEY (detection_id) REFERENCES detections(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_incident_updates_incident ON incident_updates (incident_id, id);
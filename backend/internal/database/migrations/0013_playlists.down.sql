@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS playlist_cameras;
+DROP INDEX IF EXISTS idx_playlists_organization;
+DROP TABLE IF EXISTS playlists;
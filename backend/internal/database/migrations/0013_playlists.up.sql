@@ -0,0 +1,26 @@
+-- Rotating camera playlists for kiosk screens (lobby TVs, command
+-- centres). A screen fetches its playlist with the playlist's token
+-- instead of logging in; only the token's SHA-256 is stored.
+CREATE TABLE IF NOT EXISTS playlists (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	name TEXT NOT NULL,
+	layout TEXT NOT NULL DEFAULT '1x1',
+	dwell_seconds INTEGER NOT NULL DEFAULT 15,
+	token_hash TEXT UNIQUE NOT NULL,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_playlists_organization ON playlists (organization_id);
+
+-- Cameras of a playlist in the order they are shown; a camera may
+-- appear more than once
+CREATE TABLE IF NOT EXISTS playlist_cameras (
+	playlist_id INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	camera_id INTEGER NOT NULL,
+	PRIMARY KEY (playlist_id, position),
+	FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE
+);
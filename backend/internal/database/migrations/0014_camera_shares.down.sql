@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_camera_shares_camera;
+DROP TABLE IF EXISTS camera_shares;
@@ -0,0 +1,18 @@
+-- Short links to a camera's public player, e.g. for QR codes on signs
+-- near the camera. A link stops working after expires_at or once it has
+-- been opened max_views times; NULL means no limit.
+CREATE TABLE IF NOT EXISTS camera_shares (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	camera_id INTEGER NOT NULL,
+	slug TEXT UNIQUE NOT NULL,
+	expires_at {{timestamp}},
+	max_views INTEGER,
+	views INTEGER NOT NULL DEFAULT 0,
+	created_by INTEGER,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE,
+	FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_camera_shares_camera ON camera_shares (camera_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS announcement_areas;
+DROP INDEX IF EXISTS idx_announcements_organization_starts;
+DROP TABLE IF EXISTS announcements;
@@ -0,0 +1,27 @@
+-- Notices shown on the landing page between starts_at and ends_at (NULL
+-- runs until removed). An announcement with no areas is for everyone;
+-- otherwise it is for the listed areas and the areas inside them.
+CREATE TABLE IF NOT EXISTS announcements (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	title TEXT NOT NULL,
+	body TEXT NOT NULL DEFAULT '',
+	severity TEXT NOT NULL DEFAULT 'info',
+	starts_at {{timestamp}} NOT NULL,
+	ends_at {{timestamp}},
+	created_by INTEGER,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_announcements_organization_starts ON announcements (organization_id, starts_at);
+
+-- area_id has no foreign key: deleting an area must not turn an
+-- announcement for that area into one for everyone
+CREATE TABLE IF NOT EXISTS announcement_areas (
+	announcement_id INTEGER NOT NULL,
+	area_id INTEGER NOT NULL,
+	PRIMARY KEY (announcement_id, area_id),
+	FOREIGN KEY (announcement_id) REFERENCES announcements(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- Watermarked cameras are served with the company name and the time
+-- drawn over the picture
+ALTER TABLE cameras ADD COLUMN watermark {{bool}} NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_cameras_edge_node;
+ALTER TABLE cameras DROP COLUMN edge_node_id;
+DROP INDEX IF EXISTS idx_edge_nodes_organization;
+DROP TABLE IF EXISTS edge_nodes;
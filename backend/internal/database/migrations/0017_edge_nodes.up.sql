@@ -0,0 +1,22 @@
+-- Agents at remote sites that relay their cameras through tunnels to
+-- this server (see internal/edge). An agent logs in with its token; only
+-- the token's SHA-256 is stored.
+CREATE TABLE IF NOT EXISTS edge_nodes (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	name TEXT NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	version TEXT NOT NULL DEFAULT '',
+	remote_addr TEXT NOT NULL DEFAULT '',
+	last_seen_at {{timestamp}},
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_edge_nodes_organization ON edge_nodes (organization_id);
+
+-- Cameras with a node are played through its tunnels instead of the
+-- local go2rtc
+ALTER TABLE cameras ADD COLUMN edge_node_id INTEGER REFERENCES edge_nodes(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_cameras_edge_node ON cameras (edge_node_id);
@@ -0,0 +1,6 @@
+ALTER TABLE jobs DROP COLUMN claimed_by;
+DROP INDEX IF EXISTS idx_stream_sessions_client;
+DROP TABLE IF EXISTS stream_sessions;
+DROP TABLE IF EXISTS rate_limit_hits;
+DROP TABLE IF EXISTS cluster_leases;
+DROP TABLE IF EXISTS cluster_instances;
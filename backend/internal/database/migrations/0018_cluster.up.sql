@@ -0,0 +1,39 @@
+-- State shared by server instances running behind a load balancer
+-- (CLUSTER_MODE, see internal/cluster). Each instance heartbeats its row
+-- in cluster_instances; the one holding the background lease runs the
+-- periodic workers.
+CREATE TABLE IF NOT EXISTS cluster_instances (
+	id TEXT PRIMARY KEY,
+	started_at {{timestamp}} NOT NULL,
+	last_seen_at {{timestamp}} NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cluster_leases (
+	name TEXT PRIMARY KEY,
+	holder TEXT NOT NULL,
+	expires_at {{timestamp}} NOT NULL
+);
+
+-- Requests per rate limit key (limiter, window and client IP) in each
+-- fixed window; bucket is the window's start in Unix seconds
+CREATE TABLE IF NOT EXISTS rate_limit_hits (
+	key TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	hits INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (key, bucket)
+);
+
+-- Streams open per client IP, for STREAM_MAX_SESSIONS_PER_IP. Rows are
+-- refreshed while the stream plays and ignored once they expire.
+CREATE TABLE IF NOT EXISTS stream_sessions (
+	id TEXT PRIMARY KEY,
+	client TEXT NOT NULL,
+	instance_id TEXT NOT NULL,
+	expires_at {{timestamp}} NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_sessions_client ON stream_sessions (client, expires_at);
+
+-- The instance running a job, so a restarted instance only requeues its
+-- own and the leader can requeue those of an instance that died
+ALTER TABLE jobs ADD COLUMN claimed_by TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE viewer_sessions DROP COLUMN last_seen_at;
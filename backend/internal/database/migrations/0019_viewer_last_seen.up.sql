@@ -0,0 +1,2 @@
+-- Viewer heartbeats record when a session was last seen
+ALTER TABLE viewer_sessions ADD COLUMN last_seen_at {{timestamp}};
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS camera_alerts;
+DROP INDEX IF EXISTS idx_alert_policies_organization;
+DROP TABLE IF EXISTS alert_policies;
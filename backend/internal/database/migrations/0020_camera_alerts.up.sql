@@ -0,0 +1,34 @@
+-- How camera health alerts are sent (see internal/alerting). A policy
+-- applies to one camera, to the cameras of an area and its sub-areas,
+-- or with neither to every camera of the organization. steps is a JSON
+-- list of {after_minutes, channel, to}; a muted policy sends nothing.
+CREATE TABLE IF NOT EXISTS alert_policies (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	camera_id INTEGER REFERENCES cameras(id) ON DELETE CASCADE,
+	area_id INTEGER REFERENCES areas(id) ON DELETE CASCADE,
+	dedup_seconds INTEGER NOT NULL DEFAULT 300,
+	flap_changes INTEGER NOT NULL DEFAULT 4,
+	flap_window_seconds INTEGER NOT NULL DEFAULT 900,
+	steps TEXT NOT NULL DEFAULT '[]',
+	muted {{bool}} NOT NULL DEFAULT FALSE,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_policies_organization ON alert_policies (organization_id);
+
+-- What the alerter last saw of each camera: the status and since when,
+-- status changes in the flap window, how many escalation steps went out
+-- and, as a JSON object, when each channel was last sent an outage
+CREATE TABLE IF NOT EXISTS camera_alerts (
+	camera_id INTEGER PRIMARY KEY REFERENCES cameras(id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	since {{timestamp}} NOT NULL,
+	changes INTEGER NOT NULL DEFAULT 0,
+	window_start {{timestamp}} NOT NULL,
+	flapping {{bool}} NOT NULL DEFAULT FALSE,
+	steps_sent INTEGER NOT NULL DEFAULT 0,
+	notified TEXT NOT NULL DEFAULT '{}',
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS api_key_usage;
+DROP INDEX IF EXISTS idx_api_keys_organization;
+DROP TABLE IF EXISTS api_keys;
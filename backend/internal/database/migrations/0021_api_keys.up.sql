@@ -0,0 +1,26 @@
+-- Keys that third parties send as X-API-Key to read the public camera
+-- lists, stream stats and streams within a quota (see internal/apikeys).
+-- Only the key's SHA-256 is stored. Zero quotas mean no limit.
+CREATE TABLE IF NOT EXISTS api_keys (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	name TEXT NOT NULL,
+	key_hash TEXT UNIQUE NOT NULL,
+	requests_per_day INTEGER NOT NULL DEFAULT 10000,
+	max_streams INTEGER NOT NULL DEFAULT 4,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_organization ON api_keys (organization_id);
+
+-- Requests made with each key per UTC day (YYYY-MM-DD), including those
+-- refused once the quota ran out
+CREATE TABLE IF NOT EXISTS api_key_usage (
+	api_key_id INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+	day TEXT NOT NULL,
+	requests INTEGER NOT NULL DEFAULT 0,
+	refused INTEGER NOT NULL DEFAULT 0,
+	streams_refused INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (api_key_id, day)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE viewer_sessions DROP COLUMN transport;
+ALTER TABLE viewer_sessions DROP COLUMN referrer_host;
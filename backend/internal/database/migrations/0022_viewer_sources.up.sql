@@ -0,0 +1,5 @@
+-- Where viewers watch from: the host of the page the player is on, and
+-- the transport it plays with (hls, mse or webrtc). Empty when the
+-- player did not say.
+ALTER TABLE viewer_sessions ADD COLUMN referrer_host TEXT NOT NULL DEFAULT '';
+ALTER TABLE viewer_sessions ADD COLUMN transport TEXT NOT NULL DEFAULT '';
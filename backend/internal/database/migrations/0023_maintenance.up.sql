@@ -0,0 +1,12 @@
+-- The global maintenance mode (see internal/maintenance). It holds at
+-- most the one row with id 1, written by POST /api/admin/maintenance;
+-- without it the mode is off.
+CREATE TABLE IF NOT EXISTS maintenance (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	enabled {{bool}} NOT NULL DEFAULT FALSE,
+	message TEXT NOT NULL DEFAULT '',
+	eta {{timestamp}},
+	stop_streams {{bool}} NOT NULL DEFAULT FALSE,
+	started_at {{timestamp}},
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
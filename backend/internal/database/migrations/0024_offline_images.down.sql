@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_offline_images_default;
+DROP TABLE IF EXISTS offline_images;
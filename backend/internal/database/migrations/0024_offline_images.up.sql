@@ -0,0 +1,13 @@
+-- Placeholder images served instead of a camera's snapshot while it is
+-- offline (see handlers/offlineimage.go). An image belongs to one
+-- camera or, with no camera, is the organization's default.
+CREATE TABLE IF NOT EXISTS offline_images (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	camera_id INTEGER UNIQUE REFERENCES cameras(id) ON DELETE CASCADE,
+	content_type TEXT NOT NULL,
+	data {{blob}} NOT NULL,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offline_images_default ON offline_images (organization_id) WHERE camera_id IS NULL;
@@ -0,0 +1,12 @@
+-- Client IPs banned from the streams (see internal/abuse) for fetching
+-- playlists too fast or scraping every camera. A ban ends at expires_at,
+-- or earlier when an admin lifts it, which deletes the row.
+CREATE TABLE IF NOT EXISTS ip_bans (
+	id {{id}},
+	ip TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	expires_at {{timestamp}} NOT NULL,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ip_bans_expires ON ip_bans (expires_at);
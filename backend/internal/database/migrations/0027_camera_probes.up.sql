@@ -0,0 +1,18 @@
+-- Health probes of a camera (see internal/watchdog), each with its own
+-- interval and timeout; 0 uses HEALTH_CHECK_INTERVAL_SECONDS and
+-- HEALTH_CHECK_TIMEOUT_SECONDS. target overrides what the probe checks,
+-- derived from the RTSP URL when empty. A camera without probes gets a
+-- TCP connect. The last_* columns hold the latest result.
+CREATE TABLE IF NOT EXISTS camera_probes (
+	id {{id}},
+	camera_id INTEGER NOT NULL REFERENCES cameras(id) ON DELETE CASCADE,
+	type TEXT NOT NULL,
+	interval_seconds INTEGER NOT NULL DEFAULT 0,
+	timeout_seconds INTEGER NOT NULL DEFAULT 0,
+	target TEXT NOT NULL DEFAULT '',
+	last_ok {{bool}},
+	last_error TEXT NOT NULL DEFAULT '',
+	last_checked_at {{timestamp}},
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (camera_id, type)
+);
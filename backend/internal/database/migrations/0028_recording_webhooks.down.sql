@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_recordings_unnotified;
+ALTER TABLE recordings DROP COLUMN notified_at;
+ALTER TABLE recordings DROP COLUMN kind;
@@ -0,0 +1,8 @@
+-- Recordings are a continuous segment or an event clip; the external
+-- recorder sets kind. notified_at is when the recording webhook was
+-- queued for a finished recording (see internal/recordings); recordings
+-- made before webhooks existed count as notified.
+ALTER TABLE recordings ADD COLUMN kind TEXT NOT NULL DEFAULT 'segment';
+ALTER TABLE recordings ADD COLUMN notified_at {{timestamp}};
+UPDATE recordings SET notified_at = CURRENT_TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_recordings_unnotified ON recordings (id) WHERE notified_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_audit_logs_created;
+DROP TABLE IF EXISTS log_retention;
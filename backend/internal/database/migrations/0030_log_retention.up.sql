@@ -0,0 +1,14 @@
+-- How long the audit and activity logs are kept, set by admins under
+-- /api/admin/log-retention (see internal/logretention). A log type
+-- without a row is kept forever. last_* describe the latest prune.
+CREATE TABLE IF NOT EXISTS log_retention (
+	log_type TEXT PRIMARY KEY,
+	retention_days INTEGER NOT NULL DEFAULT 0,
+	archive {{bool}} NOT NULL DEFAULT FALSE,
+	last_run_at {{timestamp}},
+	last_deleted INTEGER NOT NULL DEFAULT 0,
+	last_archive TEXT NOT NULL DEFAULT '',
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created ON audit_logs (created_at);
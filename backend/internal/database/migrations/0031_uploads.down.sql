@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN avatar;
+DROP INDEX IF EXISTS idx_uploads_created;
+DROP TABLE IF EXISTS uploads;
@@ -0,0 +1,18 @@
+-- Uploaded images (see internal/uploads). key names the file in the
+-- upload storage; rows nothing refers to are collected after a day.
+CREATE TABLE IF NOT EXISTS uploads (
+	key TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size INTEGER NOT NULL DEFAULT 0,
+	width INTEGER NOT NULL DEFAULT 0,
+	height INTEGER NOT NULL DEFAULT 0,
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_created ON uploads (created_at);
+
+-- The upload key of the user's avatar, empty for none
+ALTER TABLE users ADD COLUMN avatar TEXT NOT NULL DEFAULT '';
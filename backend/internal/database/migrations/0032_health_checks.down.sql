@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS health_check_results;
+DROP INDEX IF EXISTS idx_health_checks_created;
+DROP TABLE IF EXISTS health_checks;
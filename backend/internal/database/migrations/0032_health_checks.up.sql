@@ -0,0 +1,28 @@
+-- Health checks run on demand (see internal/watchdog): an admin asks to
+-- probe some cameras, or all of an organization's, and a job runs the
+-- probes at once. camera_ids is the JSON list of the cameras asked for.
+-- Checks are kept a day.
+CREATE TABLE IF NOT EXISTS health_checks (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	camera_ids TEXT NOT NULL DEFAULT '[]',
+	status TEXT NOT NULL DEFAULT 'pending',
+	job_id INTEGER NOT NULL DEFAULT 0,
+	requested_by INTEGER,
+	error_message TEXT NOT NULL DEFAULT '',
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	finished_at {{timestamp}}
+);
+
+CREATE INDEX IF NOT EXISTS idx_health_checks_created ON health_checks (created_at);
+
+-- The outcome of each camera of a check; status is online, offline or
+-- skipped, for cameras the watchdog does not probe
+CREATE TABLE IF NOT EXISTS health_check_results (
+	check_id INTEGER NOT NULL REFERENCES health_checks(id) ON DELETE CASCADE,
+	camera_id INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	error_message TEXT NOT NULL DEFAULT '',
+	checked_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (check_id, camera_id)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_viewer_sessions_viewer;
+ALTER TABLE viewer_sessions DROP COLUMN transport_switches;
+ALTER TABLE viewer_sessions DROP COLUMN viewer_id;
@@ -0,0 +1,8 @@
+-- The viewer ID a player generates and keeps, so a session that falls
+-- back from one transport to another (WebRTC to MSE, say) carries on as
+-- one session rather than two; see internal/viewers. Empty for players
+-- that do not send one. transport_switches counts the fallbacks.
+ALTER TABLE viewer_sessions ADD COLUMN viewer_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE viewer_sessions ADD COLUMN transport_switches INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_viewer_sessions_viewer ON viewer_sessions (camera_id, viewer_id);
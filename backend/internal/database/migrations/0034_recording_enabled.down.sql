@@ -0,0 +1 @@
+ALTER TABLE cameras DROP COLUMN recording_enabled;
@@ -0,0 +1,4 @@
+-- The recorder keeps footage of cameras with recording_enabled; cameras
+-- that already have recordings start out enabled
+ALTER TABLE cameras ADD COLUMN recording_enabled {{bool}} NOT NULL DEFAULT FALSE;
+UPDATE cameras SET recording_enabled = TRUE WHERE id IN (SELECT camera_id FROM recordings);
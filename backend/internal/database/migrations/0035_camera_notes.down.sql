@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_camera_attachments_upload;
+DROP INDEX IF EXISTS idx_camera_attachments_camera;
+DROP TABLE IF EXISTS camera_attachments;
+DROP INDEX IF EXISTS idx_camera_notes_camera;
+DROP TABLE IF EXISTS camera_notes;
@@ -0,0 +1,24 @@
+-- Field maintenance records of a camera: free-text notes, such as ISP
+-- circuit IDs and pole numbers, and attached photos, stored as uploads
+CREATE TABLE IF NOT EXISTS camera_notes (
+	id {{id}},
+	camera_id INTEGER NOT NULL REFERENCES cameras(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_camera_notes_camera ON camera_notes (camera_id, created_at);
+
+CREATE TABLE IF NOT EXISTS camera_attachments (
+	id {{id}},
+	camera_id INTEGER NOT NULL REFERENCES cameras(id) ON DELETE CASCADE,
+	upload_key TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_camera_attachments_camera ON camera_attachments (camera_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_camera_attachments_upload ON camera_attachments (upload_key);
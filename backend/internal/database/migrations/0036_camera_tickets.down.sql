@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_camera_tickets_status;
+DROP INDEX IF EXISTS idx_camera_tickets_camera;
+DROP TABLE IF EXISTS camera_tickets;
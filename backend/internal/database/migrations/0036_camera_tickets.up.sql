@@ -0,0 +1,25 @@
+-- Maintenance tickets opened in an external system for cameras that
+-- stayed offline (see internal/ticketing). A ticket is pending until the
+-- system accepts it, then open until the camera is back and the ticket
+-- is closed there. camera_id is cleared when the camera is deleted,
+-- which closes its ticket too; camera_name keeps what it was called.
+CREATE TABLE IF NOT EXISTS camera_tickets (
+	id {{id}},
+	organization_id INTEGER NOT NULL DEFAULT 1,
+	camera_id INTEGER REFERENCES cameras(id) ON DELETE SET NULL,
+	camera_name TEXT NOT NULL DEFAULT '',
+	provider TEXT NOT NULL,
+	external_id TEXT NOT NULL DEFAULT '',
+	url TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending',
+	offline_since {{timestamp}} NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	error_message TEXT NOT NULL DEFAULT '',
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	opened_at {{timestamp}},
+	closed_at {{timestamp}},
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_camera_tickets_camera ON camera_tickets (camera_id, status);
+CREATE INDEX IF NOT EXISTS idx_camera_tickets_status ON camera_tickets (status, organization_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_feedback_moderation;
+ALTER TABLE feedback DROP COLUMN moderated_at;
+ALTER TABLE feedback DROP COLUMN moderated_by;
+ALTER TABLE feedback DROP COLUMN anonymize;
+ALTER TABLE feedback DROP COLUMN public_message;
+ALTER TABLE feedback DROP COLUMN moderation;
@@ -0,0 +1,12 @@
+-- Feedback shown publicly as testimonials. moderation is none until an
+-- admin queues the feedback for review, then pending, approved or
+-- rejected; only approved feedback is public. public_message is the
+-- sanitized text shown, and anonymize shows the name as a first name
+-- and initial.
+ALTER TABLE feedback ADD COLUMN moderation TEXT NOT NULL DEFAULT 'none';
+ALTER TABLE feedback ADD COLUMN public_message TEXT NOT NULL DEFAULT '';
+ALTER TABLE feedback ADD COLUMN anonymize {{bool}} NOT NULL DEFAULT TRUE;
+ALTER TABLE feedback ADD COLUMN moderated_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE feedback ADD COLUMN moderated_at {{timestamp}};
+
+CREATE INDEX IF NOT EXISTS idx_feedback_moderation ON feedback (moderation, moderated_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_outages_open;
+DROP INDEX IF EXISTS idx_outages_camera;
+DROP TABLE IF EXISTS outages;
@@ -0,0 +1,13 @@
+-- Each time a camera went offline, as the watchdog or its edge agent saw
+-- it (see internal/outages): when, why, and when it was back. ended_at
+-- is NULL while the outage goes on; a camera has at most one such row.
+CREATE TABLE IF NOT EXISTS outages (
+	id {{id}},
+	camera_id INTEGER NOT NULL REFERENCES cameras(id) ON DELETE CASCADE,
+	started_at {{timestamp}} NOT NULL,
+	ended_at {{timestamp}},
+	cause TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_outages_camera ON outages (camera_id, started_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outages_open ON outages (camera_id) WHERE ended_at IS NULL;
@@ -0,0 +1,3 @@
+-- Cameras served by a secondary go2rtc name it here, from STREAM_NODES;
+-- NULL is the local go2rtc (GO2RTC_API_URL)
+ALTER TABLE cameras ADD COLUMN stream_node TEXT;
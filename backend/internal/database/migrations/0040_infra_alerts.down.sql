@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_infra_alerts_status;
+DROP INDEX IF EXISTS idx_infra_alerts_fingerprint;
+DROP TABLE IF EXISTS infra_alerts;
@@ -0,0 +1,24 @@
+-- Alerts about the hosts and services around the cameras, posted by a
+-- Prometheus Alertmanager (see internal/infraalerts). One row per time
+-- an alert fired: Alertmanager names an alert by the fingerprint of its
+-- labels, and it fires again with a new starts_at. ends_at is set once
+-- it is resolved.
+CREATE TABLE IF NOT EXISTS infra_alerts (
+	id {{id}},
+	fingerprint TEXT NOT NULL,
+	name TEXT NOT NULL,
+	status TEXT NOT NULL,
+	severity TEXT NOT NULL DEFAULT '',
+	instance TEXT NOT NULL DEFAULT '',
+	summary TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	labels TEXT NOT NULL DEFAULT '{}',
+	annotations TEXT NOT NULL DEFAULT '{}',
+	generator_url TEXT NOT NULL DEFAULT '',
+	starts_at {{timestamp}} NOT NULL,
+	ends_at {{timestamp}},
+	updated_at {{timestamp}} NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_infra_alerts_fingerprint ON infra_alerts (fingerprint, starts_at);
+CREATE INDEX IF NOT EXISTS idx_infra_alerts_status ON infra_alerts (status, starts_at);
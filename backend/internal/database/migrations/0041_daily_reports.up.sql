@@ -0,0 +1,8 @@
+-- The nightly summary report of each day, a day being midnight to
+-- midnight in REPORT_TIMEZONE (see internal/reports). data is the
+-- report as JSON.
+CREATE TABLE IF NOT EXISTS daily_reports (
+	report_date TEXT PRIMARY KEY,
+	data TEXT NOT NULL,
+	created_at {{timestamp}} NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_viewer_sessions_user;
+ALTER TABLE viewer_sessions DROP COLUMN user_id;
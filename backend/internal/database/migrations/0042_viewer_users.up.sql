@@ -0,0 +1,6 @@
+-- The user watching, when the player sent a valid login token with the
+-- start; NULL for the public. Lets analytics split staff from public
+-- viewers and shows which operator watched a camera when.
+ALTER TABLE viewer_sessions ADD COLUMN user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_viewer_sessions_user ON viewer_sessions (user_id, started_at);
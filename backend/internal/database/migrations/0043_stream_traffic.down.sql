@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_stream_traffic_hour;
+DROP TABLE IF EXISTS stream_traffic;
@@ -0,0 +1,15 @@
+-- What the stream proxy served, per camera, hour and kind of request
+-- (hls, mse, audio); see internal/traffic. Every instance adds its own
+-- counts to the same row. duration_ms is the time spent serving the
+-- requests, counted in the hour they ended.
+CREATE TABLE IF NOT EXISTS stream_traffic (
+	camera_id INTEGER NOT NULL REFERENCES cameras(id) ON DELETE CASCADE,
+	hour {{timestamp}} NOT NULL,
+	kind TEXT NOT NULL,
+	requests BIGINT NOT NULL DEFAULT 0,
+	bytes BIGINT NOT NULL DEFAULT 0,
+	duration_ms BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (camera_id, hour, kind)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_traffic_hour ON stream_traffic (hour);
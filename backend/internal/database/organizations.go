@@ -0,0 +1,187 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Organizations (0010) scope cameras, areas, users and settings so one
+// instance can serve several deployments. Existing rows go to the
+// default organization, id 1. Area names and setting keys become unique
+// per organization, which SQLite can only do by rebuilding the tables, so
+// this is a Go migration.
+
+const organizationsTable = `CREATE TABLE IF NOT EXISTS organizations (
+	id {{id}},
+	name TEXT NOT NULL,
+	slug TEXT UNIQUE NOT NULL,
+	domain TEXT UNIQUE,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+)`
+
+// orgColumn is added to every scoped table. It has no REFERENCES clause:
+// SQLite rejects ADD COLUMN with both a foreign key and a non-NULL
+// default, and the organization handler refuses to delete one in use.
+const orgColumn = "organization_id INTEGER NOT NULL DEFAULT 1"
+
+const areaColumns = "id, name, description, rt, rw, kelurahan, kecamatan, parent_id, level, boundary, created_at, updated_at"
+
+const settingColumns = "key, value, category, description, updated_at"
+
+func areasTable(unique string) string {
+	return `CREATE TABLE areas_new (
+	id {{id}},
+	name TEXT NOT NULL,
+	description TEXT,
+	rt TEXT,
+	rw TEXT,
+	kelurahan TEXT,
+	kecamatan TEXT,
+	parent_id INTEGER REFERENCES areas(id) ON DELETE SET NULL,
+	level TEXT,
+	boundary TEXT,
+	created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	` + unique + `
+)`
+}
+
+func settingsTable(primaryKey string) string {
+	return `CREATE TABLE settings_new (
+	key TEXT NOT NULL,
+	value TEXT NOT NULL DEFAULT '',
+	category TEXT NOT NULL DEFAULT 'general',
+	description TEXT NOT NULL DEFAULT '',
+	updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	` + primaryKey + `
+)`
+}
+
+// areaReferences point at areas.id with ON DELETE SET NULL
+var areaReferences = []reference{{"cameras", "area_id"}, {"areas", "parent_id"}}
+
+func upOrganizations(tx *sql.Tx, dialect *Dialect) error {
+	statements := []string{
+		organizationsTable,
+		`INSERT INTO organizations (name, slug) VALUES ('Default', 'default')`,
+		"ALTER TABLE cameras ADD COLUMN " + orgColumn,
+		"ALTER TABLE users ADD COLUMN " + orgColumn,
+		"CREATE INDEX IF NOT EXISTS idx_cameras_organization ON cameras (organization_id)",
+		"CREATE INDEX IF NOT EXISTS idx_users_organization ON users (organization_id)",
+	}
+	if err := execAll(tx, dialect, statements); err != nil {
+		return err
+	}
+
+	if dialect == Postgres {
+		return execAll(tx, dialect, []string{
+			"ALTER TABLE areas ADD COLUMN " + orgColumn,
+			"ALTER TABLE areas DROP CONSTRAINT IF EXISTS areas_name_key",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_areas_organization_name ON areas (organization_id, name)",
+			"ALTER TABLE settings ADD COLUMN " + orgColumn,
+			"ALTER TABLE settings DROP CONSTRAINT IF EXISTS settings_pkey",
+			"ALTER TABLE settings ADD PRIMARY KEY (organization_id, key)",
+		})
+	}
+
+	err := sqliteRebuild(tx, "areas",
+		areasTable("organization_id INTEGER NOT NULL DEFAULT 1,\n\tUNIQUE (organization_id, name)"),
+		areaColumns, areaReferences)
+	if err != nil {
+		return err
+	}
+	err = sqliteRebuild(tx, "settings",
+		settingsTable("organization_id INTEGER NOT NULL DEFAULT 1,\n\tPRIMARY KEY (organization_id, key)"),
+		settingColumns, nil)
+	if err != nil {
+		return err
+	}
+	return execAll(tx, dialect, []string{
+		"CREATE INDEX IF NOT EXISTS idx_settings_category ON settings (category)",
+	})
+}
+
+// downOrganizations fails if two organizations share an area name; the
+// settings of every organization but the default are dropped
+func downOrganizations(tx *sql.Tx, dialect *Dialect) error {
+	statements := []string{
+		"DELETE FROM settings WHERE organization_id <> 1",
+		"DROP INDEX IF EXISTS idx_users_organization",
+		"DROP INDEX IF EXISTS idx_cameras_organization",
+		"ALTER TABLE users DROP COLUMN organization_id",
+		"ALTER TABLE cameras DROP COLUMN organization_id",
+	}
+	if err := execAll(tx, dialect, statements); err != nil {
+		return err
+	}
+
+	if dialect == Postgres {
+		return execAll(tx, dialect, []string{
+			"DROP INDEX IF EXISTS idx_areas_organization_name",
+			"ALTER TABLE areas DROP COLUMN organization_id",
+			"ALTER TABLE areas ADD CONSTRAINT areas_name_key UNIQUE (name)",
+			"ALTER TABLE settings DROP CONSTRAINT IF EXISTS settings_pkey",
+			"ALTER TABLE settings DROP COLUMN organization_id",
+			"ALTER TABLE settings ADD PRIMARY KEY (key)",
+			"DROP TABLE IF EXISTS organizations",
+		})
+	}
+
+	if err := sqliteRebuild(tx, "areas", areasTable("UNIQUE (name)"), areaColumns, areaReferences); err != nil {
+		return err
+	}
+	if err := sqliteRebuild(tx, "settings", settingsTable("PRIMARY KEY (key)"), settingColumns, nil); err != nil {
+		return err
+	}
+	return execAll(tx, dialect, []string{
+		"CREATE INDEX IF NOT EXISTS idx_settings_category ON settings (category)",
+		"DROP TABLE IF EXISTS organizations",
+	})
+}
+
+// reference is a nullable column pointing at a rebuilt table's id
+type reference struct {
+	table, column string
+}
+
+// sqliteRebuild replaces table with the one ddl creates as <table>_new,
+// copying columns across. With foreign keys on, dropping the old table
+// fires ON DELETE SET NULL on every reference to it, and the pragma
+// cannot be turned off inside the migration's transaction, so the
+// references are saved first and written back once the new table has
+// taken the old name.
+func sqliteRebuild(tx *sql.Tx, table, ddl, columns string, refs []reference) error {
+	var statements []string
+	for i, ref := range refs {
+		statements = append(statements, fmt.Sprintf(
+			"CREATE TEMP TABLE rebuild_ref_%d AS SELECT id, %s AS value FROM %s WHERE %s IS NOT NULL",
+			i, ref.column, ref.table, ref.column))
+	}
+	statements = append(statements,
+		ddl,
+		fmt.Sprintf("INSERT INTO %s_new (%s) SELECT %s FROM %s", table, columns, columns, table),
+		"DROP TABLE "+table,
+		fmt.Sprintf("ALTER TABLE %s_new RENAME TO %s", table, table),
+	)
+	for i, ref := range refs {
+		statements = append(statements,
+			fmt.Sprintf(`UPDATE %[1]s SET %[2]s = (SELECT value FROM rebuild_ref_%[3]d r WHERE r.id = %[1]s.id)
+				WHERE id IN (SELECT id FROM rebuild_ref_%[3]d)`, ref.table, ref.column, i),
+			fmt.Sprintf("DROP TABLE rebuild_ref_%d", i))
+	}
+	if err := execAll(tx, SQLite, statements); err != nil {
+		return fmt.Errorf("rebuilding %s: %w", table, err)
+	}
+	return nil
+}
+
+func execAll(tx *sql.Tx, dialect *Dialect, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := tx.Exec(dialect.DDL(stmt)); err != nil {
+			return fmt.Errorf("%s: %w", strings.SplitN(strings.TrimSpace(stmt), "\n", 2)[0], err)
+		}
+	}
+	return nil
+}
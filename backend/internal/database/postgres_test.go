@@ -0,0 +1,104 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"No placeholders", "SELECT 1", "SELECT 1"},
+		{"Numbered in order", "SELECT * FROM cameras WHERE id = ? AND enabled = ?",
+			"SELECT * FROM cameras WHERE id = $1 AND enabled = $2"},
+		{"Skips string literals", "SELECT '?' , name FROM areas WHERE id = ?",
+			"SELECT '?' , name FROM areas WHERE id = $1"},
+		{"Skips quoted identifiers", `SELECT "what?" FROM t WHERE a = ?`,
+			`SELECT "what?" FROM t WHERE a = $1`},
+		{"Escaped quotes", "SELECT 'it''s?' WHERE a = ? AND b = ?",
+			"SELECT 'it''s?' WHERE a = $1 AND b = $2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Rebind(tt.query); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	for _, name := range []string{"", "sqlite", "SQLite3"} {
+		if d, err := DialectFor(name); err != nil || d != SQLite {
+			t.Errorf("Expected sqlite dialect for %q, got %v (%v)", name, d, err)
+		}
+	}
+
+	for _, name := range []string{"postgres", "postgresql"} {
+		if d, err := DialectFor(name); err != nil || d != Postgres {
+			t.Errorf("Expected postgres dialect for %q, got %v (%v)", name, d, err)
+		}
+	}
+
+	if _, err := DialectFor("mysql"); err == nil {
+		t.Error("Expected error for unsupported driver")
+	}
+}
+
+func TestDialectDDL(t *testing.T) {
+	stmt := "CREATE TABLE t (id {{id}}, at {{timestamp}}, lat {{float}}, on {{bool}}, raw {{blob}})"
+
+	if got := Postgres.DDL(stmt); got != "CREATE TABLE t (id SERIAL PRIMARY KEY, at TIMESTAMPTZ, lat DOUBLE PRECISION, on BOOLEAN, raw BYTEA)" {
+		t.Errorf("Unexpected postgres DDL: %s", got)
+	}
+	if got := SQLite.DDL(stmt); got != "CREATE TABLE t (id INTEGER PRIMARY KEY AUTOINCREMENT, at DATETIME, lat REAL, on INTEGER, raw BLOB)" {
+		t.Errorf("Unexpected sqlite DDL: %s", got)
+	}
+}
+
+// TestPostgresMigrations runs against a real server when
+// TEST_POSTGRES_URL points at a disposable database.
+func TestPostgresMigrations(t *testing.T) {
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+
+	db, err := Connect(config.DatabaseConfig{Driver: "postgres", URL: url})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer db.Close()
+
+	if dialectOf(db) != Postgres {
+		t.Fatal("Expected postgres dialect")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := RunMigrations(db); err != nil {
+			t.Fatalf("Migration run %d failed: %v", i+1, err)
+		}
+	}
+
+	var id int64
+	err = db.QueryRow(`INSERT INTO areas (name) VALUES (?) RETURNING id`, "pg-test").Scan(&id)
+	if err != nil {
+		t.Fatalf("Failed to insert area: %v", err)
+	}
+	defer db.Exec("DELETE FROM areas WHERE id = ?", id)
+
+	var enabled bool
+	err = db.QueryRow(`
+		INSERT INTO cameras (name, private_rtsp_url, area_id, enabled) VALUES (?, ?, ?, ?)
+		RETURNING enabled
+	`, "pg-cam", "rtsp://cam", id, true).Scan(&enabled)
+	if err != nil || !enabled {
+		t.Fatalf("Failed to insert camera: %v", err)
+	}
+}
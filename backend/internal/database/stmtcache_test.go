@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+)
+
+// openStreamDB returns a migrated SQLite file with cameras stream keys
+// and sessions viewer sessions spread across them
+func openStreamDB(tb testing.TB, cameras, sessions int) *sql.DB {
+	tb.Helper()
+
+	db, err := Connect(config.DatabaseConfig{Path: filepath.Join(tb.TempDir(), "cctv.db")})
+	if err != nil {
+		tb.Fatalf("Failed to connect: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	if err := RunMigrations(db); err != nil {
+		tb.Fatalf("Migrations failed: %v", err)
+	}
+
+	err = inTx(db, func(tx *sql.Tx) error {
+		for i := 0; i < cameras; i++ {
+			_, err := tx.Exec(`INSERT INTO cameras (name, private_rtsp_url, stream_key, enabled) VALUES (?, ?, ?, 1)`,
+				fmt.Sprintf("Camera %d", i), "rtsp://example/"+fmt.Sprint(i), fmt.Sprintf("key-%d", i))
+			if err != nil {
+				return err
+			}
+		}
+		for i := 0; i < sessions; i++ {
+			_, err := tx.Exec(`INSERT INTO viewer_sessions (camera_id, session_id, started_at) VALUES (?, ?, CURRENT_TIMESTAMP)`,
+				i%cameras+1, fmt.Sprintf("seed-%d", i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatalf("Failed to seed: %v", err)
+	}
+	return db
+}
+
+func TestStmtCache(t *testing.T) {
+	db := openStreamDB(t, 10, 0)
+	cache := NewStmtCache(db)
+	defer cache.Close()
+
+	ctx := context.Background()
+	const query = `SELECT id FROM cameras WHERE stream_key = ?`
+
+	t.Run("Reuses the prepared statement", func(t *testing.T) {
+		first, err := cache.Prepare(ctx, query)
+		if err != nil {
+			t.Fatalf("Prepare failed: %v", err)
+		}
+		second, _ := cache.Prepare(ctx, query)
+		if first != second {
+			t.Error("Expected the same statement for the same query")
+		}
+	})
+
+	t.Run("Concurrent lookups", func(t *testing.T) {
+		var wg sync.WaitGroup
+		var failures int32
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var id int
+				if err := cache.QueryRowContext(ctx, query, fmt.Sprintf("key-%d", i%10)).Scan(&id); err != nil || id != i%10+1 {
+					atomic.AddInt32(&failures, 1)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if failures > 0 {
+			t.Errorf("Expected every lookup to succeed, %d failed", failures)
+		}
+	})
+
+	t.Run("Prepare errors surface on Scan", func(t *testing.T) {
+		var id int
+		if err := cache.QueryRowContext(ctx, `SELECT id FROM no_such_table`).Scan(&id); err == nil {
+			t.Error("Expected an error for an invalid query")
+		}
+	})
+}
+
+// BenchmarkStreamKeyLookup runs the per-segment camera lookup from many
+// concurrent viewers. Compare prepare-per-call against the cache, with
+// and without the stream_key index.
+func BenchmarkStreamKeyLookup(b *testing.B) {
+	const cameras = 500
+	const query = `SELECT enabled FROM cameras WHERE stream_key = ?`
+
+	for _, bc := range []struct {
+		name    string
+		indexed bool
+		cached  bool
+	}{
+		{"unindexed/prepare-per-call", false, false},
+		{"indexed/prepare-per-call", true, false},
+		{"indexed/cached", true, true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			db := openStreamDB(b, cameras, 0)
+			if !bc.indexed {
+				db.Exec(`DROP INDEX idx_cameras_stream_key`)
+			}
+			cache := NewStmtCache(db)
+			defer cache.Close()
+
+			ctx := context.Background()
+			var n int64
+
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var enabled bool
+				for pb.Next() {
+					key := fmt.Sprintf("key-%d", atomic.AddInt64(&n, 1)%cameras)
+					var err error
+					if bc.cached {
+						err = cache.QueryRowContext(ctx, query, key).Scan(&enabled)
+					} else {
+						err = db.QueryRowContext(ctx, query, key).Scan(&enabled)
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkViewerUpsert runs the StartViewing session upsert from many
+// concurrent viewers; busy_timeout keeps writers from failing with
+// SQLITE_BUSY while they queue for the lock.
+func BenchmarkViewerUpsert(b *testing.B) {
+	const cameras = 50
+	const query = `
+		INSERT INTO viewer_sessions (camera_id, session_id, ip_address, user_agent, started_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(camera_id, session_id) WHERE ended_at IS NULL DO UPDATE SET started_at = CURRENT_TIMESTAMP
+	`
+
+	for _, bc := range []struct {
+		name   string
+		cached bool
+	}{
+		{"prepare-per-call", false},
+		{"cached", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			db := openStreamDB(b, cameras, 10000)
+			cache := NewStmtCache(db)
+			defer cache.Close()
+
+			ctx := context.Background()
+			var n int64
+
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := atomic.AddInt64(&n, 1)
+					args := []interface{}{i%cameras + 1, fmt.Sprintf("viewer-%d", i%2000), "10.0.0.1", "bench"}
+					var err error
+					if bc.cached {
+						_, err = cache.ExecContext(ctx, query, args...)
+					} else {
+						_, err = db.ExecContext(ctx, query, args...)
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Auto-vacuum modes of DB_AUTO_VACUUM, as SQLite numbers them
+var autoVacuumModes = []string{"none", "full", "incremental"}
+
+// incrementalVacuumPages bounds the free pages each housekeeping run
+// returns to the file system, so one run never holds the write lock long
+const incrementalVacuumPages = 10000
+
+// Storage is what the database takes on disk. The WAL, free space and
+// checkpoint fields are SQLite's; PostgreSQL reports its size only.
+type Storage struct {
+	Driver         string      `json:"driver"`
+	DatabaseBytes  int64       `json:"database_bytes"`
+	WALBytes       int64       `json:"wal_bytes"`
+	FreeBytes      int64       `json:"free_bytes"` // pages on the freelist
+	AutoVacuum     string      `json:"auto_vacuum,omitempty"`
+	LastCheckpoint *Checkpoint `json:"last_checkpoint"`
+}
+
+// Checkpoint is the result of a wal_checkpoint(TRUNCATE). Busy means a
+// reader or writer kept it from finishing, so the WAL was not truncated.
+type Checkpoint struct {
+	At           time.Time `json:"at"`
+	Busy         bool      `json:"busy"`
+	LogPages     int       `json:"log_pages"`
+	Checkpointed int       `json:"checkpointed_pages"`
+}
+
+// checkpoints holds the last checkpoint of each open database
+var checkpoints sync.Map // *sql.DB -> Checkpoint
+
+// CheckpointWAL copies the SQLite write-ahead log into the database file
+// and truncates it. SQLite's own checkpoints after every 1000 pages
+// never shrink the file, so a WAL that once grew stays that size.
+func CheckpointWAL(ctx context.Context, db *sql.DB) (Checkpoint, error) {
+	if dialectOf(db) != SQLite {
+		return Checkpoint{}, fmt.Errorf("checkpoints only apply to sqlite")
+	}
+	var busy int
+	cp := Checkpoint{At: time.Now().UTC()}
+	if err := db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &cp.LogPages, &cp.Checkpointed); err != nil {
+		return Checkpoint{}, fmt.Errorf("wal checkpoint failed: %w", err)
+	}
+	cp.Busy = busy != 0
+	checkpoints.Store(db, cp)
+	return cp, nil
+}
+
+// StorageOf reports the size of the database; path is the SQLite file
+func StorageOf(ctx context.Context, db *sql.DB, path string) (Storage, error) {
+	if dialectOf(db) == Postgres {
+		s := Storage{Driver: Postgres.Name}
+		err := db.QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&s.DatabaseBytes)
+		return s, err
+	}
+
+	s := Storage{Driver: SQLite.Name}
+	if info, err := os.Stat(path); err == nil {
+		s.DatabaseBytes = info.Size()
+	}
+	if info, err := os.Stat(path + "-wal"); err == nil {
+		s.WALBytes = info.Size()
+	}
+
+	var pageSize, free, mode int
+	if err := db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+		return s, err
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&free); err != nil {
+		return s, err
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return s, err
+	}
+	s.FreeBytes = int64(pageSize) * int64(free)
+	if mode >= 0 && mode < len(autoVacuumModes) {
+		s.AutoVacuum = autoVacuumModes[mode]
+	}
+	if cp, ok := checkpoints.Load(db); ok {
+		cp := cp.(Checkpoint)
+		s.LastCheckpoint = &cp
+	}
+	return s, nil
+}
+
+// SetAutoVacuum switches a SQLite database to an auto-vacuum mode: none,
+// full or incremental. An empty mode keeps the current one. Changing
+// between none and the others rewrites the whole file with VACUUM, once.
+func SetAutoVacuum(ctx context.Context, db *sql.DB, mode string) error {
+	if mode == "" || dialectOf(db) != SQLite {
+		return nil
+	}
+	want := -1
+	for i, m := range autoVacuumModes {
+		if strings.EqualFold(mode, m) {
+			want = i
+		}
+	}
+	if want < 0 {
+		return fmt.Errorf("unknown auto-vacuum mode %q", mode)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&current); err != nil {
+		return err
+	}
+	if current == want {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA auto_vacuum = %d", want)); err != nil {
+		return err
+	}
+	logger.Info("Rewriting the database for the new auto-vacuum mode", "from", autoVacuumModes[current], "to", autoVacuumModes[want])
+	if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("vacuum failed: %w", err)
+	}
+	return nil
+}
+
+// HousekeepingOptions tune Housekeeping. A zero alert size turns its
+// alert off.
+type HousekeepingOptions struct {
+	Path     string        // the SQLite file
+	Interval time.Duration // between checkpoints
+	WALAlert int64         // bytes of WAL after a checkpoint
+	DBAlert  int64         // bytes of database file
+
+	// Grew is called once when the WAL or the database file goes over
+	// its alert size, and again only after it has been back under
+	Grew func(file string, size, limit int64)
+}
+
+// Housekeeping checkpoints and truncates the SQLite WAL every interval,
+// hands the free pages of an incremental auto-vacuum database back to
+// the file system, and reports sizes over the alert thresholds. Start
+// it with shutdown.Coordinator.Go; on PostgreSQL it returns at once.
+func Housekeeping(db *sql.DB, opts HousekeepingOptions) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		if dialectOf(db) != SQLite || opts.Interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+
+		over := map[string]bool{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := housekeep(ctx, db, opts, over); err != nil && ctx.Err() == nil {
+				logger.Error("Database housekeeping failed", "error", err)
+			}
+		}
+	}
+}
+
+// housekeep runs once; over tracks the files already reported as over
+// their alert size
+func housekeep(ctx context.Context, db *sql.DB, opts HousekeepingOptions, over map[string]bool) error {
+	cp, err := CheckpointWAL(ctx, db)
+	if err != nil {
+		return err
+	}
+	if cp.Busy {
+		logger.Warn("WAL checkpoint blocked by an open transaction", "log_pages", cp.LogPages, "checkpointed_pages", cp.Checkpointed)
+	}
+
+	s, err := StorageOf(ctx, db, opts.Path)
+	if err != nil {
+		return err
+	}
+	if s.AutoVacuum == "incremental" && s.FreeBytes > 0 {
+		// It frees one page per step, so its rows are read to the end
+		rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA incremental_vacuum(%d)", incrementalVacuumPages))
+		if err != nil {
+			return fmt.Errorf("incremental vacuum failed: %w", err)
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("incremental vacuum failed: %w", err)
+		}
+	}
+
+	for _, f := range []struct {
+		file  string
+		size  int64
+		limit int64
+	}{
+		{"wal", s.WALBytes, opts.WALAlert},
+		{"database", s.DatabaseBytes, opts.DBAlert},
+	} {
+		if f.limit <= 0 {
+			continue
+		}
+		if f.size <= f.limit {
+			over[f.file] = false
+			continue
+		}
+		if !over[f.file] {
+			over[f.file] = true
+			logger.Warn("Database file over its alert size", "file", f.file, "bytes", f.size, "limit", f.limit)
+			if opts.Grew != nil {
+				opts.Grew(f.file, f.size, f.limit)
+			}
+		}
+	}
+	return nil
+}
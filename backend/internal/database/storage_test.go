@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+)
+
+func TestHousekeeping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cctv.db")
+	db, err := Connect(config.DatabaseConfig{Path: path})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer db.Close()
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := SetAutoVacuum(ctx, db, "incremental"); err != nil {
+		t.Fatalf("SetAutoVacuum failed: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		if _, err := db.Exec(`INSERT INTO activity_logs (action, details) VALUES ('test', ?)`, string(make([]byte, 2000))); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+	if _, err := db.Exec(`DELETE FROM activity_logs`); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	before, err := StorageOf(ctx, db, path)
+	if err != nil {
+		t.Fatalf("StorageOf failed: %v", err)
+	}
+	if before.AutoVacuum != "incremental" || before.WALBytes == 0 || before.FreeBytes == 0 || before.LastCheckpoint != nil {
+		t.Fatalf("Expected a WAL and free pages before housekeeping, got %+v", before)
+	}
+
+	var grew []string
+	opts := HousekeepingOptions{Path: path, WALAlert: 1, DBAlert: 1, Grew: func(file string, size, limit int64) {
+		grew = append(grew, file)
+	}}
+	over := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		if err := housekeep(ctx, db, opts, over); err != nil {
+			t.Fatalf("housekeep failed: %v", err)
+		}
+	}
+
+	after, err := StorageOf(ctx, db, path)
+	if err != nil {
+		t.Fatalf("StorageOf failed: %v", err)
+	}
+	if after.LastCheckpoint == nil || after.LastCheckpoint.Busy {
+		t.Errorf("Expected a finished checkpoint, got %+v", after.LastCheckpoint)
+	}
+	if after.FreeBytes != 0 {
+		t.Errorf("Expected the free pages returned, got %d bytes", after.FreeBytes)
+	}
+	if len(grew) != 1 || grew[0] != "database" {
+		t.Errorf("Expected one alert for the database file and none for the truncated WAL, got %v", grew)
+	}
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// Viewer session tokens (0026) are issued by the server and kept by the
+// browser, so one viewer comes back to a camera with the same session
+// ID. Only an open session of a camera is unique: starting again after
+// stopping adds a row rather than overwriting the earlier visit. SQLite
+// can only drop the table's UNIQUE constraint by rebuilding it, so this
+// is a Go migration.
+
+const viewerSessionColumns = "id, camera_id, session_id, ip_address, user_agent, started_at, ended_at, last_seen_at, referrer_host, transport"
+
+func viewerSessionsTable(unique string) string {
+	return `CREATE TABLE viewer_sessions_new (
+	id {{id}},
+	camera_id INTEGER NOT NULL,
+	session_id TEXT NOT NULL,
+	ip_address TEXT,
+	user_agent TEXT,
+	started_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+	ended_at {{timestamp}},
+	last_seen_at {{timestamp}},
+	referrer_host TEXT NOT NULL DEFAULT '',
+	transport TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (camera_id) REFERENCES cameras(id) ON DELETE CASCADE` + unique + `
+)`
+}
+
+// viewerSessionIndexes are dropped with the table on SQLite
+var viewerSessionIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_viewer_sessions_started ON viewer_sessions (started_at)",
+	"CREATE INDEX IF NOT EXISTS idx_viewer_sessions_active ON viewer_sessions (camera_id, ended_at)",
+	"CREATE INDEX IF NOT EXISTS idx_viewer_sessions_camera_started ON viewer_sessions (camera_id, started_at)",
+}
+
+const openViewerSessionIndex = `CREATE UNIQUE INDEX IF NOT EXISTS idx_viewer_sessions_open
+	ON viewer_sessions (camera_id, session_id) WHERE ended_at IS NULL`
+
+func upViewerSessionTokens(tx *sql.Tx, dialect *Dialect) error {
+	if dialect == Postgres {
+		return execAll(tx, dialect, []string{
+			"ALTER TABLE viewer_sessions DROP CONSTRAINT IF EXISTS viewer_sessions_camera_id_session_id_key",
+			openViewerSessionIndex,
+		})
+	}
+
+	if err := sqliteRebuild(tx, "viewer_sessions", viewerSessionsTable(""), viewerSessionColumns, nil); err != nil {
+		return err
+	}
+	return execAll(tx, dialect, append(viewerSessionIndexes, openViewerSessionIndex))
+}
+
+// downViewerSessionTokens keeps only the latest row of each camera and
+// session ID
+func downViewerSessionTokens(tx *sql.Tx, dialect *Dialect) error {
+	statements := []string{
+		`DELETE FROM viewer_sessions WHERE id NOT IN (
+			SELECT MAX(id) FROM viewer_sessions GROUP BY camera_id, session_id
+		)`,
+		"DROP INDEX IF EXISTS idx_viewer_sessions_open",
+	}
+	if err := execAll(tx, dialect, statements); err != nil {
+		return err
+	}
+
+	if dialect == Postgres {
+		return execAll(tx, dialect, []string{
+			"ALTER TABLE viewer_sessions ADD CONSTRAINT viewer_sessions_camera_id_session_id_key UNIQUE (camera_id, session_id)",
+		})
+	}
+
+	err := sqliteRebuild(tx, "viewer_sessions", viewerSessionsTable(",\n\tUNIQUE (camera_id, session_id)"), viewerSessionColumns, nil)
+	if err != nil {
+		return err
+	}
+	return execAll(tx, dialect, viewerSessionIndexes)
+}
@@ -0,0 +1,279 @@
+// Package demo fills an empty organization with sample data, so the
+// dashboard can be tried without real cameras: an area tree, cameras
+// playing public test RTSP streams, a user of each role, branding, and
+// a few weeks of viewer sessions for the analytics pages.
+//
+// The test streams are run by third parties and come and go; a camera
+// whose source is down shows as offline, as a real one would.
+package demo
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultDays is how many days of viewer sessions Seed makes up
+const DefaultDays = 14
+
+// ErrNotEmpty is returned when the organization already has cameras;
+// demo data is only added to a fresh setup
+var ErrNotEmpty = errors.New("the organization already has cameras")
+
+// Options tune the demo data. Zero values use the defaults.
+type Options struct {
+	Days     int    // of viewer sessions, up to today
+	Password string // of every demo user; generated per user when empty
+}
+
+// User is a demo user and the password it logs in with
+type User struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Password string `json:"password"`
+}
+
+// Result counts what Seed added
+type Result struct {
+	Areas    int    `json:"areas"`
+	Cameras  int    `json:"cameras"`
+	Settings int    `json:"settings"`
+	Sessions int    `json:"sessions"`
+	Users    []User `json:"users"`
+}
+
+// Public RTSP test streams
+const (
+	bigBuckBunny = "rtsp://wowzaec2demo.streamlock.net/vod/mp4:BigBuckBunny_115k.mp4"
+	testPattern  = "rtsp://rtsp.stream/pattern"
+	testMovie    = "rtsp://rtsp.stream/movie"
+)
+
+type area struct {
+	name, slug, level, parent string
+}
+
+// areas lists parents before their children
+var areas = []area{
+	{"Kecamatan Dander", "kecamatan-dander", "kecamatan", ""},
+	{"Desa Dander", "desa-dander", "kelurahan", "Kecamatan Dander"},
+	{"Desa Ngumpakdalem", "desa-ngumpakdalem", "kelurahan", "Kecamatan Dander"},
+	{"Kecamatan Bojonegoro", "kecamatan-bojonegoro", "kecamatan", ""},
+	{"Kelurahan Kadipaten", "kelurahan-kadipaten", "kelurahan", "Kecamatan Bojonegoro"},
+}
+
+type camera struct {
+	name, key, source, location, group, area string
+	latitude, longitude                      float64
+	health                                   string
+}
+
+var cameras = []camera{
+	{"Simpang Tiga Dander", "demo-simpang-dander", bigBuckBunny, "Jl. Raya Dander", "Persimpangan", "Desa Dander", -7.2286, 111.8547, "online"},
+	{"Pasar Dander", "demo-pasar-dander", testMovie, "Pasar Dander", "Pasar", "Desa Dander", -7.2301, 111.8562, "online"},
+	{"Balai Desa Ngumpakdalem", "demo-balai-ngumpakdalem", testPattern, "Balai Desa", "Fasilitas Umum", "Desa Ngumpakdalem", -7.2412, 111.8433, "online"},
+	{"Alun-Alun Bojonegoro", "demo-alun-alun", bigBuckBunny, "Alun-Alun", "Taman", "Kelurahan Kadipaten", -7.1502, 111.8817, "online"},
+	{"Jembatan Kali Ketek", "demo-kali-ketek", testMovie, "Jembatan Kali Ketek", "Persimpangan", "Kelurahan Kadipaten", -7.1448, 111.8795, "online"},
+	{"Gudang Kecamatan", "demo-gudang", testPattern, "Belakang kantor kecamatan", "Fasilitas Umum", "Kecamatan Dander", -7.2350, 111.8501, "offline"},
+}
+
+var roles = []string{models.RoleAdmin, models.RoleOperator, models.RoleViewer}
+
+var settings = map[string]interface{}{
+	"company_name":       "Demo CCTV",
+	"company_tagline":    "Contoh pemantauan CCTV publik",
+	"primary_color":      "#0ea5e9",
+	"logo_text":          "DC",
+	"map_default_center": map[string]interface{}{"latitude": -7.19, "longitude": 111.87, "zoom": 12, "name": "Bojonegoro"},
+}
+
+var settingCategories = map[string]string{"map_default_center": "map"}
+
+// Where the made-up viewers watch from
+var (
+	referrers  = []string{"", "", "", "berita.example", "desa-dander.example"}
+	transports = []string{"hls", "hls", "mse", "webrtc"}
+	agents     = []string{
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 Chrome/126.0 Mobile Safari/537.36",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/126.0 Safari/537.36",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148 Safari/604.1",
+	}
+)
+
+// Seed adds the demo data to the organization of ctx in one
+// transaction, at now. It fails with ErrNotEmpty when the organization
+// has cameras, and when a demo username is taken.
+func Seed(ctx context.Context, db *sql.DB, opts Options, now time.Time) (*Result, error) {
+	if opts.Days <= 0 {
+		opts.Days = DefaultDays
+	}
+	now = now.UTC()
+	orgID := tenant.OrgID(ctx)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM cameras WHERE organization_id = ?", orgID).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrNotEmpty
+	}
+
+	result := &Result{}
+	areaIDs := map[string]int64{}
+	for _, a := range areas {
+		var parent interface{}
+		if a.parent != "" {
+			parent = areaIDs[a.parent]
+		}
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO areas (name, slug, description, parent_id, level, organization_id, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, a.name, a.slug, "Demo area", parent, a.level, orgID, now).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("area %s: %w", a.name, err)
+		}
+		areaIDs[a.name] = id
+		result.Areas++
+	}
+
+	cameraIDs := make([]int64, 0, len(cameras))
+	for _, c := range cameras {
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO cameras (name, private_rtsp_url, description, location, group_name, area_id, latitude, longitude,
+			                     enabled, stream_key, organization_id, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, c.name, c.source, "Demo camera playing a public test stream", c.location, c.group, areaIDs[c.area],
+			c.latitude, c.longitude, true, c.key, orgID, now).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("camera %s: %w", c.name, err)
+		}
+		var message interface{}
+		if c.health == "offline" {
+			message = "Demo: the camera does not answer"
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO camera_health (camera_id, status, last_check, error_message, updated_at) VALUES (?, ?, ?, ?, ?)
+		`, id, c.health, now, message, now); err != nil {
+			return nil, err
+		}
+		cameraIDs = append(cameraIDs, id)
+		result.Cameras++
+	}
+
+	userIDs := map[string]int64{}
+	for _, role := range roles {
+		u := User{Username: "demo-" + role, Role: role, Password: opts.Password}
+		if u.Password == "" {
+			if u.Password, err = randomPassword(); err != nil {
+				return nil, err
+			}
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		var id int64
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO users (username, email, password_hash, role, organization_id, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, u.Username, u.Username+"@demo.example", string(hash), role, orgID, now).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Username, err)
+		}
+		userIDs[role] = id
+		result.Users = append(result.Users, u)
+	}
+
+	for key, value := range settings {
+		raw, _ := json.Marshal(value)
+		category := settingCategories[key]
+		if category == "" {
+			category = "branding"
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO settings (key, value, category, organization_id, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(organization_id, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+		`, key, string(raw), category, orgID, now); err != nil {
+			return nil, err
+		}
+		result.Settings++
+	}
+
+	if result.Sessions, err = seedSessions(ctx, tx, cameraIDs, userIDs[models.RoleOperator], opts.Days, now); err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+// seedSessions makes up the viewer sessions of the last days: more by
+// day than at night, a few of them the operator watching. The numbers
+// are the same on every run.
+func seedSessions(ctx context.Context, tx *sql.Tx, cameraIDs []int64, operatorID int64, days int, now time.Time) (int, error) {
+	rnd := mathrand.New(mathrand.NewSource(1))
+	count := 0
+	for day := days - 1; day >= 0; day-- {
+		midnight := now.Truncate(24*time.Hour).AddDate(0, 0, -day)
+		for _, cameraID := range cameraIDs {
+			for i, n := 0, 5+rnd.Intn(20); i < n; i++ {
+				// Two dice favour the middle of the day
+				hour := (rnd.Intn(13) + rnd.Intn(12)) % 24
+				started := midnight.Add(time.Duration(hour)*time.Hour + time.Duration(rnd.Intn(3600))*time.Second)
+				if !started.Before(now) {
+					continue
+				}
+				ended := started.Add(time.Duration(30+rnd.Intn(1800)) * time.Second)
+				var endedAt interface{} = ended
+				if ended.After(now) {
+					ended, endedAt = now, nil
+				}
+				var user interface{}
+				if rnd.Intn(10) == 0 {
+					user = operatorID
+				}
+				viewer := fmt.Sprintf("demo-viewer-%d", rnd.Intn(400))
+				_, err := tx.ExecContext(ctx, `
+					INSERT INTO viewer_sessions (camera_id, session_id, viewer_id, ip_address, user_agent, referrer_host, transport,
+						user_id, started_at, ended_at, last_seen_at)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				`, cameraID, fmt.Sprintf("demo-%d-%d", cameraID, count), viewer, fmt.Sprintf("203.0.113.%d", 1+rnd.Intn(254)),
+					agents[rnd.Intn(len(agents))], referrers[rnd.Intn(len(referrers))], transports[rnd.Intn(len(transports))],
+					user, started, endedAt, ended)
+				if err != nil {
+					return count, err
+				}
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,66 @@
+package demo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSeed(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := tenant.WithOrg(context.Background(), tenant.DefaultOrgID)
+	now := time.Date(2026, 5, 1, 15, 30, 0, 0, time.UTC)
+
+	result, err := Seed(ctx, db, Options{Days: 3}, now)
+	if err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+	if result.Areas != len(areas) || result.Cameras != len(cameras) || len(result.Users) != 3 || result.Sessions == 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	var password string
+	db.QueryRow("SELECT password_hash FROM users WHERE username = 'demo-operator' AND role = 'operator'").Scan(&password)
+	if bcrypt.CompareHashAndPassword([]byte(password), []byte(result.Users[1].Password)) != nil {
+		t.Error("Expected the operator to log in with the password returned")
+	}
+
+	var children, offline, sessions, staff, open int
+	var oldest, newest time.Time
+	db.QueryRow("SELECT COUNT(*) FROM areas WHERE parent_id IS NOT NULL").Scan(&children)
+	db.QueryRow("SELECT COUNT(*) FROM camera_health WHERE status = 'offline'").Scan(&offline)
+	db.QueryRow("SELECT COUNT(*), COUNT(user_id), COUNT(*) - COUNT(ended_at) FROM viewer_sessions").Scan(&sessions, &staff, &open)
+	db.QueryRow("SELECT started_at FROM viewer_sessions ORDER BY started_at ASC LIMIT 1").Scan(&oldest)
+	db.QueryRow("SELECT started_at FROM viewer_sessions ORDER BY started_at DESC LIMIT 1").Scan(&newest)
+	if children != 3 || offline != 1 {
+		t.Errorf("Expected 3 child areas and 1 offline camera, got %d and %d", children, offline)
+	}
+	if sessions != result.Sessions || staff == 0 || staff == sessions {
+		t.Errorf("Expected staff and public sessions, got %d of %d", staff, sessions)
+	}
+	if oldest.Before(now.AddDate(0, 0, -3)) || newest.After(now) {
+		t.Errorf("Expected sessions of the last 3 days, got %v to %v", oldest, newest)
+	}
+
+	if _, err := Seed(ctx, db, Options{}, now); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("Expected ErrNotEmpty the second time, got %v", err)
+	}
+
+	// A taken username rolls everything back
+	other := tenant.WithOrg(context.Background(), 2)
+	db.Exec(`INSERT INTO organizations (id, name, slug) VALUES (2, 'Dander', 'dander')`)
+	db.Exec(`DELETE FROM areas`)
+	if _, err := Seed(other, db, Options{Password: "demo"}, now); err == nil {
+		t.Error("Expected an error for the taken demo usernames")
+	}
+	var cameras int
+	db.QueryRow("SELECT COUNT(*) FROM cameras WHERE organization_id = 2").Scan(&cameras)
+	if cameras != 0 {
+		t.Errorf("Expected nothing written, got %d cameras", cameras)
+	}
+}
@@ -0,0 +1,264 @@
+package detection
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/anpr"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/internal/snapshot"
+	"github.com/abcdefak87/cctv/internal/streamnode"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// JobType analyses the current frame of a camera
+const JobType = "detection.analyze"
+
+const (
+	// maxAttempts is low because a late answer describes a frame long
+	// gone; the next motion event brings a fresh one
+	maxAttempts = 3
+
+	// dbTimeout bounds each analyzer query
+	dbTimeout = 5 * time.Second
+)
+
+// Payload is the JobType payload
+type Payload struct {
+	CameraID      int    `json:"camera_id"`
+	MotionEventID *int64 `json:"motion_event_id,omitempty"`
+}
+
+// Options configure an Analyzer
+type Options struct {
+	Backend       Backend
+	SendImage     bool          // fetch the frame and send it, rather than its URL
+	MinConfidence float64       // objects below this are not stored
+	Timeout       time.Duration // bounds one Backend call
+	// Upstream returns the go2rtc of a stream node ("" is the local
+	// one); it is called per frame so a reload applies
+	Upstream func(node string) (streamnode.Upstream, error)
+}
+
+// Analyzer runs JobType jobs: it sends a frame to the Backend, stores the
+// objects and raises the alerts rules ask for
+type Analyzer struct {
+	db   *sql.DB
+	opts Options
+
+	mu        sync.Mutex
+	lastAlert map[alertKey]time.Time
+}
+
+type alertKey struct {
+	rule     int64
+	cameraID int
+}
+
+func NewAnalyzer(db *sql.DB, opts Options) *Analyzer {
+	return &Analyzer{db: db, opts: opts, lastAlert: map[alertKey]time.Time{}}
+}
+
+// OnMotion returns an events.Handler that queues an analysis for every
+// motion.detected event. Subscribe it to events.MotionDetected.
+func (a *Analyzer) OnMotion(queue *jobs.Queue) events.Handler {
+	return func(e events.Event) {
+		cameraID, ok := e.Data["camera_id"].(int)
+		if !ok {
+			return
+		}
+		p := Payload{CameraID: cameraID}
+		if id, ok := e.Data["event_id"].(int64); ok {
+			p.MotionEventID = &id
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+		defer cancel()
+		if _, err := queue.Enqueue(ctx, JobType, p, jobs.EnqueueOptions{Priority: jobs.PriorityHigh, MaxAttempts: maxAttempts}); err != nil {
+			logger.Error("Failed to queue object detection", "camera_id", cameraID, "error", err)
+		}
+	}
+}
+
+// Handle is the jobs.Handler for JobType
+func (a *Analyzer) Handle(ctx context.Context, raw json.RawMessage) error {
+	var p Payload
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	var streamKey string
+	var node sql.NullString
+	err := a.db.QueryRowContext(ctx, `
+		SELECT stream_key, stream_node FROM cameras
+		WHERE id = ? AND enabled = TRUE AND stream_key IS NOT NULL AND stream_key <> ''
+	`, p.CameraID).Scan(&streamKey, &node)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted or disabled since the motion event; nothing to look at
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	up, err := a.opts.Upstream(node.String)
+	if err != nil {
+		return jobs.Permanent(fmt.Errorf("stream node %q: %w", node.String, err))
+	}
+	frame := Frame{CameraID: p.CameraID, URL: snapshot.URL(up.APIURL, streamKey)}
+	if a.opts.SendImage {
+		if frame.JPEG, err = snapshot.Fetch(ctx, up.Client, up.APIURL, streamKey); err != nil {
+			return fmt.Errorf("snapshot failed: %w", err)
+		}
+	}
+
+	detectCtx := ctx
+	if a.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		detectCtx, cancel = context.WithTimeout(ctx, a.opts.Timeout)
+		defer cancel()
+	}
+	objects, err := a.opts.Backend.Detect(detectCtx, frame)
+	if err != nil {
+		return err
+	}
+
+	var kept []Object
+	for _, o := range objects {
+		if o.Label != "" && o.Confidence >= a.opts.MinConfidence {
+			kept = append(kept, o)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+
+	ids, err := a.store(ctx, p, kept)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Objects detected", "camera_id", p.CameraID, "count", len(kept))
+	a.plates(ctx, p.CameraID, kept, ids)
+	return a.alert(ctx, p.CameraID, kept, ids)
+}
+
+// plates records the plates the service read as ANPR events; cameras not
+// marked as traffic keep none. Failures are only logged: retrying the job
+// would store the detections twice.
+func (a *Analyzer) plates(ctx context.Context, cameraID int, objects []Object, ids []int64) {
+	for i, o := range objects {
+		if !plateLabels[o.Label] || o.Text == "" {
+			continue
+		}
+		err := anpr.Record(ctx, a.db, &anpr.Event{
+			CameraID:    cameraID,
+			Plate:       o.Text,
+			Confidence:  o.Confidence,
+			DetectionID: &ids[i],
+			Source:      anpr.SourceDetection,
+		})
+		if errors.Is(err, anpr.ErrNotTraffic) {
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to store plate read", "camera_id", cameraID, "error", err)
+		}
+	}
+}
+
+// store writes the objects in one transaction, so a retried job does not
+// leave half a frame behind
+func (a *Analyzer) store(ctx context.Context, p Payload, objects []Object) ([]int64, error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	ids := make([]int64, len(objects))
+	for i, o := range objects {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO detections (camera_id, motion_event_id, label, confidence, box_x, box_y, box_w, box_h, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, p.CameraID, p.MotionEventID, o.Label, o.Confidence, o.Box.X, o.Box.Y, o.Box.W, o.Box.H, now).Scan(&ids[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to store detection: %w", err)
+		}
+	}
+	return ids, tx.Commit()
+}
+
+// alert publishes a detection.alert for every enabled rule the objects
+// match, at most once per rule, camera and cooldown
+func (a *Analyzer) alert(ctx context.Context, cameraID int, objects []Object, ids []int64) error {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT id, name, label, min_confidence, cooldown_seconds
+		FROM detection_rules
+		WHERE enabled = TRUE AND (camera_id IS NULL OR camera_id = ?)
+	`, cameraID)
+	if err != nil {
+		return fmt.Errorf("failed to load detection rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var r Rule
+		if err := rows.Scan(&r.ID, &r.Name, &r.Label, &r.MinConfidence, &r.CooldownSeconds); err != nil {
+			return err
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, r := range rules {
+		// The most confident match stands for the frame
+		best := -1
+		for i, o := range objects {
+			if o.Label == r.Label && o.Confidence >= r.MinConfidence && (best < 0 || o.Confidence > objects[best].Confidence) {
+				best = i
+			}
+		}
+		if best < 0 || !a.due(alertKey{r.ID, cameraID}, time.Duration(r.CooldownSeconds)*time.Second, now) {
+			continue
+		}
+
+		events.Publish(events.Event{
+			Type:     events.DetectionAlert,
+			Time:     now,
+			Resource: "camera",
+			Data: map[string]interface{}{
+				"rule_id":      r.ID,
+				"rule":         r.Name,
+				"camera_id":    cameraID,
+				"detection_id": ids[best],
+				"label":        objects[best].Label,
+				"confidence":   objects[best].Confidence,
+			},
+		})
+	}
+	return nil
+}
+
+// due reports whether key is out of its cooldown and, if so, starts a
+// new one
+func (a *Analyzer) due(key alertKey, cooldown time.Duration, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.lastAlert[key]; ok && now.Sub(last) < cooldown {
+		return false
+	}
+	a.lastAlert[key] = now
+	return true
+}
@@ -0,0 +1,78 @@
+// Package detection sends camera frames to an external object detection
+// service (a YOLO microservice, Frigate behind an adapter, ...) and
+// stores the labelled boxes it returns. Frames are analysed when the
+// motion detector fires, through the job queue, so a slow or unreachable
+// service never holds up motion detection. Alert rules on detection
+// classes publish detection.alert events.
+package detection
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Box is a bounding box in fractions of the frame from the top-left
+// corner
+type Box struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	W float64 `json:"w"`
+	H float64 `json:"h"`
+}
+
+// Object is one thing the service found in a frame
+type Object struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"` // 0-1
+	Box        Box     `json:"box"`
+	Text       string  `json:"text,omitempty"` // read from a licence plate
+}
+
+// Detection is a stored Object, as listed by the search API
+type Detection struct {
+	ID            int64     `json:"id"`
+	CameraID      int       `json:"camera_id"`
+	MotionEventID *int64    `json:"motion_event_id"`
+	Label         string    `json:"label"`
+	Confidence    float64   `json:"confidence"`
+	Box           Box       `json:"box"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Rule alerts when Label is detected with at least MinConfidence, on one
+// camera or, with a nil CameraID, on any
+type Rule struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	CameraID        *int      `json:"camera_id"`
+	Label           string    `json:"label"`
+	MinConfidence   float64   `json:"min_confidence"`
+	CooldownSeconds int       `json:"cooldown_seconds"` // between alerts per camera
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Frame is what a Backend analyses. URL always points at the frame in
+// go2rtc; JPEG holds the frame itself when the backend wants the image.
+type Frame struct {
+	CameraID int
+	URL      string
+	JPEG     []byte
+}
+
+// Backend is an inference service. Implementations return objects with
+// normalised labels; errors wrapped with jobs.Permanent are not retried.
+type Backend interface {
+	Detect(ctx context.Context, frame Frame) ([]Object, error)
+}
+
+// plateLabels are the classes models use for licence plates
+var plateLabels = map[string]bool{"license_plate": true, "licence_plate": true, "plate": true}
+
+// NormalizeLabel makes labels from different models and rules compare
+// equal: "Person " and "person" are the same class
+func NormalizeLabel(label string) string {
+	return strings.ToLower(strings.TrimSpace(label))
+}
@@ -0,0 +1,188 @@
+package detection
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/internal/streamnode"
+)
+
+type fakeBackend struct {
+	objects []Object
+	frames  []Frame
+}
+
+func (b *fakeBackend) Detect(ctx context.Context, frame Frame) ([]Object, error) {
+	b.frames = append(b.frames, frame)
+	return b.objects, nil
+}
+
+func TestHTTPBackend(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"detections":[{"label":" Person","confidence":0.9,"box":{"x":0.1,"y":0.2,"w":0.3,"h":0.4}}]}`))
+	}))
+	defer srv.Close()
+
+	b := &HTTPBackend{URL: srv.URL, APIKey: "secret"}
+	ctx := context.Background()
+
+	t.Run("Image", func(t *testing.T) {
+		objects, err := b.Detect(ctx, Frame{CameraID: 3, JPEG: []byte("jpeg")})
+		if err != nil {
+			t.Fatalf("Detect failed: %v", err)
+		}
+		if got.Header.Get("Content-Type") != "image/jpeg" || string(body) != "jpeg" {
+			t.Errorf("Expected the JPEG body, got %q (%s)", body, got.Header.Get("Content-Type"))
+		}
+		if got.Header.Get("Authorization") != "Bearer secret" || got.Header.Get("X-Camera-ID") != "3" {
+			t.Errorf("Expected auth and camera headers, got %v", got.Header)
+		}
+		want := Object{Label: "person", Confidence: 0.9, Box: Box{X: 0.1, Y: 0.2, W: 0.3, H: 0.4}}
+		if len(objects) != 1 || objects[0] != want {
+			t.Errorf("Expected %+v, got %+v", want, objects)
+		}
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		if _, err := b.Detect(ctx, Frame{CameraID: 3, URL: "http://go2rtc/frame"}); err != nil {
+			t.Fatalf("Detect failed: %v", err)
+		}
+		var req inferenceRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.ImageURL != "http://go2rtc/frame" || req.CameraID != 3 {
+			t.Errorf("Expected the frame URL as JSON, got %s", body)
+		}
+	})
+
+	t.Run("Rejected requests are permanent", func(t *testing.T) {
+		status = http.StatusBadRequest
+		_, err := b.Detect(ctx, Frame{CameraID: 3})
+		if !jobs.IsPermanent(err) {
+			t.Errorf("Expected a permanent error, got %v", err)
+		}
+	})
+
+	t.Run("Server errors are retried", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		_, err := b.Detect(ctx, Frame{CameraID: 3})
+		if err == nil || jobs.IsPermanent(err) {
+			t.Errorf("Expected a retryable error, got %v", err)
+		}
+	})
+}
+
+func TestAnalyzer(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled) VALUES (1, 'Gate', 'rtsp://gate', 'gate', TRUE)`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO detection_rules (name, camera_id, label, min_confidence, cooldown_seconds, enabled) VALUES ('Gate person', 1, 'person', 0.8, 3600, TRUE)`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	alerts := make(chan events.Event, 4)
+	events.Subscribe(events.DetectionAlert, "test", func(e events.Event) { alerts <- e })
+
+	backend := &fakeBackend{objects: []Object{
+		{Label: "person", Confidence: 0.85},
+		{Label: "person", Confidence: 0.95},
+		{Label: "car", Confidence: 0.3},
+	}}
+	a := NewAnalyzer(db, Options{
+		Backend:       backend,
+		MinConfidence: 0.5,
+		Upstream: func(node string) (streamnode.Upstream, error) {
+			return streamnode.Upstream{APIURL: "http://go2rtc:1984", Client: http.DefaultClient}, nil
+		},
+	})
+
+	count := func() int {
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM detections`).Scan(&n)
+		return n
+	}
+	payload := func(cameraID int) json.RawMessage {
+		raw, _ := json.Marshal(Payload{CameraID: cameraID})
+		return raw
+	}
+
+	t.Run("Stores confident objects and alerts", func(t *testing.T) {
+		if err := a.Handle(ctx, payload(1)); err != nil {
+			t.Fatalf("Handle failed: %v", err)
+		}
+		if n := count(); n != 2 {
+			t.Errorf("Expected 2 stored detections, got %d", n)
+		}
+		if url := backend.frames[0].URL; url != "http://go2rtc:1984/api/frame.jpeg?src=gate" {
+			t.Errorf("Expected the go2rtc frame URL, got %q", url)
+		}
+
+		select {
+		case e := <-alerts:
+			if e.Data["confidence"] != 0.95 || e.Data["rule"] != "Gate person" {
+				t.Errorf("Expected an alert for the best match, got %v", e.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected a detection alert")
+		}
+	})
+
+	t.Run("Cooldown", func(t *testing.T) {
+		if err := a.Handle(ctx, payload(1)); err != nil {
+			t.Fatalf("Handle failed: %v", err)
+		}
+		select {
+		case e := <-alerts:
+			t.Errorf("Expected the cooldown to suppress the alert, got %v", e.Data)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("Plates on traffic cameras", func(t *testing.T) {
+		if _, err := db.Exec(`UPDATE cameras SET traffic = TRUE WHERE id = 1`); err != nil {
+			t.Fatalf("Failed to update: %v", err)
+		}
+		backend.objects = []Object{{Label: "license_plate", Confidence: 0.9, Text: "B 1234 XYZ"}}
+		if err := a.Handle(ctx, payload(1)); err != nil {
+			t.Fatalf("Handle failed: %v", err)
+		}
+
+		var plate string
+		var detectionID sql.NullInt64
+		db.QueryRow(`SELECT plate, detection_id FROM anpr_events`).Scan(&plate, &detectionID)
+		if plate != "B 1234 XYZ" || !detectionID.Valid {
+			t.Errorf("Expected a plate read linked to its detection, got %q (%v)", plate, detectionID)
+		}
+	})
+
+	t.Run("Unknown camera", func(t *testing.T) {
+		calls := len(backend.frames)
+		if err := a.Handle(ctx, payload(9)); err != nil {
+			t.Errorf("Expected a missing camera to be skipped, got %v", err)
+		}
+		if len(backend.frames) != calls {
+			t.Error("Expected no inference for a missing camera")
+		}
+	})
+
+	t.Run("Invalid payload", func(t *testing.T) {
+		if err := a.Handle(ctx, json.RawMessage(`[]`)); !jobs.IsPermanent(err) {
+			t.Errorf("Expected a permanent error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package detection
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+)
+
+// HTTPBackend calls an inference endpoint over HTTP.
+//
+// A frame with JPEG data is POSTed as image/jpeg; otherwise as JSON
+// {"camera_id": 1, "image_url": "..."} for services that fetch the frame
+// themselves. X-Camera-ID names the camera either way. The service
+// answers with
+//
+//	{"detections": [{"label": "person", "confidence": 0.91,
+//	  "box": {"x": 0.1, "y": 0.2, "w": 0.3, "h": 0.4}}]}
+//
+// with boxes in fractions of the frame.
+type HTTPBackend struct {
+	URL    string
+	APIKey string // sent as a bearer token when set
+}
+
+type inferenceRequest struct {
+	CameraID int    `json:"camera_id"`
+	ImageURL string `json:"image_url"`
+}
+
+type inferenceResponse struct {
+	Detections []Object `json:"detections"`
+}
+
+// maxResponse bounds the response read; a busy street yields a few KB
+const maxResponse = 1 << 20
+
+func (b *HTTPBackend) Detect(ctx context.Context, frame Frame) ([]Object, error) {
+	var body []byte
+	contentType := "image/jpeg"
+	if frame.JPEG != nil {
+		body = frame.JPEG
+	} else {
+		var err error
+		if body, err = json.Marshal(inferenceRequest{CameraID: frame.CameraID, ImageURL: frame.URL}); err != nil {
+			return nil, err
+		}
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Camera-ID", strconv.Itoa(frame.CameraID))
+	if b.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+
+	resp, err := httpclient.Shared().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("detection service returned %s", resp.Status)
+		// A rejected request fails the same way when retried
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, jobs.Permanent(err)
+		}
+		return nil, err
+	}
+
+	var result inferenceResponse
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("invalid detection response: %w", err))
+	}
+	for i := range result.Detections {
+		result.Detections[i].Label = NormalizeLabel(result.Detections[i].Label)
+	}
+	return result.Detections, nil
+}
@@ -0,0 +1,365 @@
+package edge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Report is what an agent sends with each heartbeat
+type Report struct {
+	Version string         `json:"version"`
+	Cameras []CameraStatus `json:"cameras" validate:"max=1000"`
+}
+
+// CameraStatus is whether an agent could reach one of its cameras
+type CameraStatus struct {
+	StreamKey string `json:"stream_key"`
+	Online    bool   `json:"online"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Assignment is the heartbeat answer: the cameras the agent serves
+type Assignment struct {
+	Cameras []AssignedCamera `json:"cameras"`
+}
+
+// AssignedCamera is a camera the agent registers with its go2rtc
+type AssignedCamera struct {
+	StreamKey string `json:"stream_key"`
+	RTSPURL   string `json:"rtsp_url"`
+}
+
+const (
+	handshakeTimeout = 10 * time.Second
+	maxBackoff       = 30 * time.Second
+	probeTimeout     = 5 * time.Second
+	probeWorkers     = 8
+)
+
+// ErrUnauthorized is returned when the server refuses the agent's token
+var ErrUnauthorized = errors.New("edge token refused by the server")
+
+// Agent runs at a remote site next to the cameras and its own go2rtc
+type Agent struct {
+	ServerURL string // central server, e.g. https://cctv.example.com
+	Token     string
+	Go2RTCURL string
+	Tunnels   int // idle tunnels kept open
+	Interval  time.Duration
+
+	// streams are the go2rtc streams registered so far: key -> source
+	streams map[string]string
+	status  []CameraStatus
+}
+
+// Run serves tunnels and sends heartbeats until ctx is cancelled. It
+// fails at once when the server refuses the token.
+func (a *Agent) Run(ctx context.Context) error {
+	a.streams = map[string]string{}
+	if err := a.heartbeat(ctx); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < a.Tunnels; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.keepTunnel(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-ticker.C:
+			if err := a.heartbeat(ctx); err != nil && ctx.Err() == nil {
+				logger.Warn("Edge heartbeat failed", "error", err)
+			}
+		}
+	}
+}
+
+// heartbeat reports the last camera checks, registers the cameras the
+// server assigns with go2rtc and checks them for the next report
+func (a *Agent) heartbeat(ctx context.Context) error {
+	body, _ := json.Marshal(Report{Version: version(), Cameras: a.status})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint("/api/edge/heartbeat"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpclient.Shared().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	var env struct {
+		Data Assignment `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return err
+	}
+
+	a.sync(ctx, env.Data.Cameras)
+	a.status = probe(ctx, env.Data.Cameras)
+	return nil
+}
+
+// sync adds new and changed cameras to go2rtc and removes the ones no
+// longer assigned. Unchanged streams are left alone, so viewers keep
+// playing.
+func (a *Agent) sync(ctx context.Context, cameras []AssignedCamera) {
+	assigned := map[string]bool{}
+	for _, cam := range cameras {
+		assigned[cam.StreamKey] = true
+		if a.streams[cam.StreamKey] == cam.RTSPURL {
+			continue
+		}
+		query := url.Values{"name": {cam.StreamKey}, "src": {cam.RTSPURL}}
+		if err := a.go2rtc(ctx, http.MethodPut, query); err != nil {
+			logger.Warn("Failed to add stream to go2rtc", "stream_key", cam.StreamKey, "error", err)
+			continue
+		}
+		a.streams[cam.StreamKey] = cam.RTSPURL
+	}
+	for key := range a.streams {
+		if assigned[key] {
+			continue
+		}
+		if err := a.go2rtc(ctx, http.MethodDelete, url.Values{"src": {key}}); err != nil {
+			logger.Warn("Failed to remove stream from go2rtc", "stream_key", key, "error", err)
+			continue
+		}
+		delete(a.streams, key)
+	}
+}
+
+func (a *Agent) go2rtc(ctx context.Context, method string, query url.Values) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(a.Go2RTCURL, "/")+"/api/streams?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpclient.Shared().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("go2rtc returned %s", resp.Status)
+	}
+	return nil
+}
+
+// probe checks that each camera's RTSP port answers. It is cheaper than
+// pulling a frame, and what fails behind a NAT is the network.
+func probe(ctx context.Context, cameras []AssignedCamera) []CameraStatus {
+	status := make([]CameraStatus, len(cameras))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < probeWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dialer := net.Dialer{Timeout: probeTimeout}
+			for i := range next {
+				s := CameraStatus{StreamKey: cameras[i].StreamKey}
+				if addr, err := rtspAddr(cameras[i].RTSPURL); err != nil {
+					s.Error = err.Error()
+				} else if conn, err := dialer.DialContext(ctx, "tcp", addr); err != nil {
+					s.Error = err.Error()
+				} else {
+					conn.Close()
+					s.Online = true
+				}
+				status[i] = s
+			}
+		}()
+	}
+	for i := range cameras {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return status
+}
+
+func rtspAddr(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", errors.New("invalid RTSP URL")
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	return net.JoinHostPort(u.Hostname(), "554"), nil
+}
+
+// keepTunnel keeps one idle tunnel open. Once a request arrives on it,
+// the request is served in the background and a new tunnel opened.
+func (a *Agent) keepTunnel(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		conn, br, err := a.openTunnel(ctx)
+		if err != nil {
+			logger.Warn("Failed to open edge tunnel", "error", err, "retry_in", backoff.String())
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		backoff = time.Second
+
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			stop()
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer stop()
+			defer conn.Close()
+			a.serve(ctx, conn, req)
+		}()
+	}
+}
+
+// openTunnel connects to the server and upgrades the connection
+func (a *Agent) openTunnel(ctx context.Context) (net.Conn, *bufio.Reader, error) {
+	u, err := url.Parse(a.endpoint("/api/edge/tunnel"))
+	if err != nil {
+		return nil, nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	dialer := &net.Dialer{Timeout: handshakeTimeout, KeepAlive: 30 * time.Second}
+	var conn net.Conn
+	if u.Scheme == "https" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: u.Hostname()}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", Protocol)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, nil, ErrUnauthorized
+		}
+		return nil, nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, br, nil
+}
+
+// hopHeaders are not forwarded to go2rtc
+var hopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// serve forwards req from the server to go2rtc and writes the answer
+// back, streaming it until either side hangs up. Only the go2rtc API
+// is reachable this way.
+func (a *Agent) serve(ctx context.Context, conn net.Conn, req *http.Request) {
+	resp := a.forward(ctx, req)
+	defer resp.Body.Close()
+	resp.Close = true
+	resp.Write(conn)
+}
+
+func (a *Agent) forward(ctx context.Context, req *http.Request) *http.Response {
+	if !strings.HasPrefix(req.URL.Path, "/api/") {
+		return textResponse(http.StatusNotFound, "Not found")
+	}
+	out, err := http.NewRequestWithContext(ctx, req.Method, strings.TrimRight(a.Go2RTCURL, "/")+req.URL.RequestURI(), req.Body)
+	if err != nil {
+		return textResponse(http.StatusBadRequest, err.Error())
+	}
+	out.Header = req.Header.Clone()
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	out.ContentLength = req.ContentLength
+
+	resp, err := httpclient.Shared().Do(out)
+	if err != nil {
+		return textResponse(http.StatusBadGateway, "Failed to reach go2rtc")
+	}
+	return resp
+}
+
+func textResponse(status int, text string) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(text)),
+		ContentLength: int64(len(text)),
+	}
+}
+
+func (a *Agent) endpoint(path string) string {
+	return strings.TrimRight(a.ServerURL, "/") + path
+}
+
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return ""
+}
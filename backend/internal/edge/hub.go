@@ -0,0 +1,222 @@
+// Package edge lets cameras at remote sites join the portal through an
+// agent running next to them. The agent only makes outbound
+// connections, so it works behind CGNAT without port forwarding: it
+// opens a few tunnels to the central server (an HTTP request upgraded
+// to a raw connection) and keeps them idle. When a viewer plays one of
+// its cameras, the server sends the go2rtc request down an idle tunnel,
+// the agent forwards it to its local go2rtc and streams the answer
+// back, and opens a fresh tunnel to replace the busy one. Every
+// heartbeat the agent reports camera health and gets the cameras it
+// should serve.
+package edge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol is the Upgrade token that turns a request into a tunnel
+const Protocol = "cctv-edge/1"
+
+// maxIdle tunnels are kept per node; more are closed
+const maxIdle = 32
+
+// dialWait is how long a request waits for an idle tunnel, which covers
+// an agent still replacing the ones just used
+const dialWait = 10 * time.Second
+
+// ErrOffline is returned when a node has no idle tunnel in time
+var ErrOffline = errors.New("edge node is not connected")
+
+// Hub holds the idle tunnels of every connected node
+type Hub struct {
+	stopping context.Context
+
+	mu    sync.Mutex
+	nodes map[int]*pool
+
+	client *http.Client
+}
+
+type pool struct {
+	idle  []*tunnel
+	ready chan struct{} // closed and replaced when a tunnel is added
+}
+
+// tunnel is one connection from an agent. While idle nothing is sent
+// on it, so a pending read only returns when the agent hangs up, or
+// when Dial cuts it short to take the tunnel.
+type tunnel struct {
+	net.Conn
+	taken    bool       // guarded by Hub.mu
+	released chan error // what the idle read returned, once taken
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (t *tunnel) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	return t.Conn.Close()
+}
+
+// NewHub returns an empty hub; tunnels still open are closed when
+// stopping is cancelled
+func NewHub(stopping context.Context) *Hub {
+	h := &Hub{stopping: stopping, nodes: map[int]*pool{}}
+	h.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			nodeID, ok := nodeFromHost(host)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an edge node address", addr)
+			}
+			return h.Dial(ctx, nodeID)
+		},
+		// The agent serves one request per tunnel
+		DisableKeepAlives: true,
+	}}
+	return h
+}
+
+// BaseURL is the go2rtc API of a node, reached with Client
+func BaseURL(nodeID int) string {
+	return "http://edge-" + strconv.Itoa(nodeID) + ".tunnel"
+}
+
+func nodeFromHost(host string) (int, bool) {
+	id, ok := strings.CutPrefix(host, "edge-")
+	if id, ok = strings.CutSuffix(id, ".tunnel"); !ok {
+		return 0, false
+	}
+	nodeID, err := strconv.Atoi(id)
+	return nodeID, err == nil
+}
+
+// Client sends requests for BaseURL addresses through the tunnels
+func (h *Hub) Client() *http.Client {
+	return h.client
+}
+
+func (h *Hub) pool(nodeID int) *pool {
+	p, ok := h.nodes[nodeID]
+	if !ok {
+		p = &pool{ready: make(chan struct{})}
+		h.nodes[nodeID] = p
+	}
+	return p
+}
+
+// Attach adds conn, freshly upgraded by nodeID's agent, to the idle
+// tunnels. It returns once the tunnel is closed: after serving a
+// request, when the agent hangs up, or on shutdown.
+func (h *Hub) Attach(nodeID int, conn net.Conn) {
+	conn.SetDeadline(time.Time{})
+	t := &tunnel{Conn: conn, released: make(chan error, 1), closed: make(chan struct{})}
+
+	h.mu.Lock()
+	p := h.pool(nodeID)
+	if len(p.idle) >= maxIdle {
+		h.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p.idle = append(p.idle, t)
+	close(p.ready)
+	p.ready = make(chan struct{})
+	h.mu.Unlock()
+
+	stop := context.AfterFunc(h.stopping, func() { t.Close() })
+	defer stop()
+
+	_, err := conn.Read(make([]byte, 1))
+
+	h.mu.Lock()
+	taken := t.taken
+	if !taken {
+		for i, idle := range p.idle {
+			if idle == t {
+				p.idle = append(p.idle[:i], p.idle[i+1:]...)
+				break
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	if !taken {
+		t.Close()
+		return
+	}
+	t.released <- err
+	<-t.closed
+}
+
+// Dial takes an idle tunnel to nodeID, waiting up to dialWait for one
+func (h *Hub) Dial(ctx context.Context, nodeID int) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialWait)
+	defer cancel()
+
+	for {
+		h.mu.Lock()
+		p := h.pool(nodeID)
+		if n := len(p.idle); n > 0 {
+			t := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			t.taken = true
+			h.mu.Unlock()
+
+			// End the idle read; anything but the deadline firing means
+			// the agent already hung up
+			t.SetReadDeadline(time.Now())
+			var ne net.Error
+			if err := <-t.released; errors.As(err, &ne) && ne.Timeout() {
+				t.SetReadDeadline(time.Time{})
+				return t, nil
+			}
+			t.Close()
+			continue
+		}
+		ready := p.ready
+		h.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ErrOffline
+		}
+	}
+}
+
+// Idle returns how many tunnels nodeID has waiting
+func (h *Hub) Idle(nodeID int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if p, ok := h.nodes[nodeID]; ok {
+		return len(p.idle)
+	}
+	return 0
+}
+
+// Disconnect closes the idle tunnels of nodeID, e.g. once it is deleted
+// or its token replaced
+func (h *Hub) Disconnect(nodeID int) {
+	h.mu.Lock()
+	var idle []*tunnel
+	if p, ok := h.nodes[nodeID]; ok {
+		idle = p.idle
+	}
+	h.mu.Unlock()
+
+	for _, t := range idle {
+		t.Close()
+	}
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// auditTimeout bounds each activity_logs insert
+const auditTimeout = 5 * time.Second
+
+// AuditLog records events in activity_logs, which the admin dashboard
+// lists as recent activity. Data is stored as JSON in details.
+func AuditLog(db *sql.DB) Handler {
+	return func(e Event) {
+		details := ""
+		if len(e.Data) > 0 {
+			if b, err := json.Marshal(e.Data); err == nil {
+				details = string(b)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+		defer cancel()
+
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO activity_logs (user_id, action, resource, details, ip_address, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, e.UserID, e.Type, e.Resource, details, e.IP, e.Time.UTC())
+		if err != nil {
+			logger.Error("Failed to write audit log", "event", e.Type, "error", err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Event types. Producers publish these instead of calling the modules
+// that care about them (audit log, notifications), so new consumers can
+// be added without touching the producer.
+const (
+	AuthLogin       = "auth.login"
+	AuthLoginFailed = "auth.login_failed"
+	AuthLogout      = "auth.logout"
+
+	// An admin took a token to act as another user; Data: user_id,
+	// username, read_only, reason, expires_at
+	AuthImpersonationStarted = "auth.impersonation_started"
+
+	// A request made with such a token, attributed to the user acted
+	// as; Data: impersonator_id, method, path, status
+	AuthImpersonatedRequest = "auth.impersonated_request"
+
+	// An admin turned the maintenance mode on, changed it or ended it;
+	// Data: enabled, message, eta, stop_streams
+	MaintenanceChanged = "maintenance.changed"
+
+	// An admin changed how long a log type is kept; Data: log_type,
+	// retention_days, archive
+	LogRetentionChanged = "log_retention.changed"
+
+	// A user set or removed their avatar; Data: avatar (the upload key,
+	// empty when removed)
+	UserAvatarChanged = "user.avatar_changed"
+
+	SettingsUpdated = "settings.updated"
+	SettingsDeleted = "settings.deleted"
+
+	// go2rtc circuit breaker opened or closed again; Data: route
+	StreamUpstreamDown = "stream.upstream_down"
+	StreamUpstreamUp   = "stream.upstream_up"
+
+	// A camera's p95 time to start a stream went over
+	// STREAM_START_ALERT_MS, or came back well under it; Data:
+	// camera_id, camera, p95_ms, threshold_ms, samples
+	StreamStartSlow      = "stream.start_slow"
+	StreamStartRecovered = "stream.start_recovered"
+
+	// An hour's stream traffic of a camera was far over its usual, or
+	// nothing when it usually has viewers; Data: camera_id, camera,
+	// hour, bytes, baseline_bytes
+	StreamTrafficSpike   = "stream.traffic_spike"
+	StreamTrafficDropped = "stream.traffic_dropped"
+
+	// A client IP was banned from the streams for abusing them, or an
+	// admin lifted its ban; Data: ban_id, ip, reason, expires_at
+	StreamIPBanned   = "stream.ip_banned"
+	StreamIPUnbanned = "stream.ip_unbanned"
+
+	// Data: camera_id, event_id, zone, score
+	MotionDetected = "motion.detected"
+
+	// The alerter saw a camera go offline or come back while it was not
+	// flapping; Data: camera_id, camera
+	CameraOffline = "camera.offline"
+	CameraOnline  = "camera.online"
+
+	// A camera changed status too often; its alerts pause until it
+	// settles. Data: camera_id, camera, changes
+	CameraFlapping = "camera.flapping"
+
+	// An object detection rule matched; Data: rule_id, rule, camera_id,
+	// detection_id, label, confidence
+	DetectionAlert = "detection.alert"
+
+	// A licence plate was read on a traffic camera; Data: camera_id,
+	// event_id, plate, confidence, source
+	ANPRPlateRead = "anpr.plate_read"
+
+	// An incident was opened or changed status; Data: incident_id,
+	// title, status
+	IncidentOpened        = "incident.opened"
+	IncidentStatusChanged = "incident.status_changed"
+
+	// The SQLite WAL or database file went over its alert size; Data:
+	// file (wal or database), bytes, limit
+	DatabaseGrown = "database.grown"
+
+	// Alertmanager posted an infrastructure alert that started firing,
+	// or one it had sent firing that is resolved; Data: alert_id, alert,
+	// severity, instance, summary
+	InfraAlertFiring   = "infra.alert_firing"
+	InfraAlertResolved = "infra.alert_resolved"
+
+	// The nightly summary report of a day was built; Data: date, report
+	// (a reports.Report)
+	ReportDaily = "report.daily"
+
+	// A configuration bundle was imported; Data: on_conflict, the
+	// created/updated/skipped counts of each kind and conflicts
+	ConfigImported = "config.imported"
+)
+
+// queueSize is how many events a subscriber may fall behind before new
+// ones are dropped for it
+const queueSize = 256
+
+// Event is something that happened, published by one module for any
+// number of others
+type Event struct {
+	Type     string                 `json:"type"`
+	Time     time.Time              `json:"time"`
+	UserID   *int                   `json:"user_id,omitempty"` // nil for system events
+	IP       string                 `json:"ip,omitempty"`
+	Resource string                 `json:"resource,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// Handler consumes events. Each subscription gets its own goroutine, so
+// a slow handler (a webhook, Telegram) only delays itself.
+type Handler func(Event)
+
+type subscription struct {
+	topic string
+	name  string
+	queue chan Event
+}
+
+// Bus delivers published events to matching subscribers asynchronously
+// and in publish order per subscriber.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   []*subscription
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func New() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls fn for every event whose type matches topic: an exact
+// type, a prefix such as "auth.*", or "*" for everything. name only
+// appears in logs.
+func (b *Bus) Subscribe(topic, name string, fn Handler) {
+	sub := &subscription{topic: topic, name: name, queue: make(chan Event, queueSize)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.subs = append(b.subs, sub)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for e := range sub.queue {
+			deliver(sub, fn, e)
+		}
+	}()
+}
+
+// Publish queues e for every matching subscriber and returns at once.
+// Events for a subscriber whose queue is full are dropped and logged.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+
+	for _, sub := range b.subs {
+		if !matches(sub.topic, e.Type) {
+			continue
+		}
+		select {
+		case sub.queue <- e:
+		default:
+			logger.Warn("Event dropped, subscriber is behind", "event", e.Type, "subscriber", sub.name)
+		}
+	}
+}
+
+// Close stops accepting events and waits for subscribers to finish the
+// ones already queued, or for ctx to expire
+func (b *Bus) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, sub := range b.subs {
+			close(sub.queue)
+		}
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("event subscribers still running: %w", ctx.Err())
+	}
+}
+
+// deliver runs one handler call, so a panicking subscriber loses only
+// that event
+func deliver(sub *subscription, fn Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Event subscriber panicked", "event", e.Type, "subscriber", sub.name, "panic", r)
+		}
+	}()
+	fn(e)
+}
+
+func matches(topic, eventType string) bool {
+	if topic == "*" || topic == eventType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(topic, "*"); ok {
+		return strings.HasPrefix(eventType, prefix)
+	}
+	return false
+}
+
+// Default is the process-wide bus used by the package functions
+var Default = New()
+
+// Publish sends e on the default bus
+func Publish(e Event) {
+	Default.Publish(e)
+}
+
+// Subscribe registers fn on the default bus
+func Subscribe(topic, name string, fn Handler) {
+	Default.Subscribe(topic, name, fn)
+}
+
+// Close drains the default bus; register it as a shutdown step
+func Close(ctx context.Context) error {
+	return Default.Close(ctx)
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestBus(t *testing.T) {
+	bus := New()
+
+	var mu sync.Mutex
+	got := map[string][]string{}
+	record := func(name string) Handler {
+		return func(e Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			got[name] = append(got[name], e.Type)
+		}
+	}
+
+	bus.Subscribe(AuthLogin, "exact", record("exact"))
+	bus.Subscribe("auth.*", "prefix", record("prefix"))
+	bus.Subscribe("*", "all", record("all"))
+	bus.Subscribe("*", "panics", func(Event) { panic("boom") })
+
+	bus.Publish(Event{Type: AuthLogin})
+	bus.Publish(Event{Type: AuthLoginFailed})
+	bus.Publish(Event{Type: SettingsUpdated})
+
+	if err := bus.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	t.Run("Topics match", func(t *testing.T) {
+		expected := map[string]int{"exact": 1, "prefix": 2, "all": 3}
+		for name, count := range expected {
+			if len(got[name]) != count {
+				t.Errorf("Expected %d events for %s, got %v", count, name, got[name])
+			}
+		}
+	})
+
+	t.Run("Order is kept per subscriber", func(t *testing.T) {
+		all := got["all"]
+		if len(all) != 3 || all[0] != AuthLogin || all[2] != SettingsUpdated {
+			t.Errorf("Expected publish order, got %v", all)
+		}
+	})
+
+	t.Run("Publish after Close is dropped", func(t *testing.T) {
+		bus.Publish(Event{Type: AuthLogin})
+		if len(got["exact"]) != 1 {
+			t.Errorf("Expected no delivery after Close, got %v", got["exact"])
+		}
+	})
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	bus := New()
+	release := make(chan struct{})
+
+	bus.Subscribe("*", "slow", func(Event) { <-release })
+
+	start := time.Now()
+	for i := 0; i < queueSize*2; i++ {
+		bus.Publish(Event{Type: AuthLogin})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Publish not to block on a slow subscriber, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bus.Close(ctx); err == nil {
+		t.Error("Expected Close to time out while the subscriber is stuck")
+	}
+	close(release)
+}
+
+func TestAuditLog(t *testing.T) {
+	db := dbtest.Open(t)
+
+	AuditLog(db)(Event{
+		Type:     SettingsUpdated,
+		Time:     time.Now(),
+		IP:       "10.0.0.1",
+		Resource: "settings",
+		Data:     map[string]interface{}{"keys": []string{"site_name"}},
+	})
+
+	var action, resource, details, ip string
+	var userID *int
+	err := db.QueryRow(`SELECT user_id, action, resource, details, ip_address FROM activity_logs`).
+		Scan(&userID, &action, &resource, &details, &ip)
+	if err != nil {
+		t.Fatalf("Expected an activity log row, got %v", err)
+	}
+
+	if action != SettingsUpdated || resource != "settings" || ip != "10.0.0.1" {
+		t.Errorf("Unexpected row: %s %s %s", action, resource, ip)
+	}
+	if details != `{"keys":["site_name"]}` {
+		t.Errorf("Expected keys as JSON details, got '%s'", details)
+	}
+	if userID != nil {
+		t.Errorf("Expected NULL user for a system event, got %d", *userID)
+	}
+}
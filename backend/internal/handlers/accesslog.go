@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/accesslog"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AccessLogHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewAccessLogHandler(db *sql.DB, cfg *config.Config) *AccessLogHandler {
+	return &AccessLogHandler{db: db, cfg: cfg}
+}
+
+// GetAccessLogs - Recorded requests, newest first. Filters: method,
+// path (prefix), status (404 or a class such as 5xx), user_id, ip, and
+// from/to as RFC 3339 times or YYYY-MM-DD dates. ?cursor= switches to
+// keyset pagination.
+func (h *AccessLogHandler) GetAccessLogs(c *fiber.Ctx) error {
+	if !strings.EqualFold(h.cfg.AccessLog.Sink, accesslog.SinkDatabase) {
+		return response.Fail(c, 409, "Access logs are only stored for queries with ACCESS_LOG_SINK=database")
+	}
+
+	where, args, msg := accessLogFilters(c)
+	if msg != "" {
+		return response.Fail(c, 400, msg)
+	}
+
+	page, err := response.ParseKeyset(c, 50)
+	if err != nil {
+		return response.Fail(c, 400, "Invalid cursor")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	const columns = `
+		SELECT id, method, path, status, latency_ms, user_id, ip, request_id, created_at
+		FROM access_logs`
+	query, pageArgs := paginate(columns+where+`
+		ORDER BY created_at DESC, id DESC
+	`, append([]interface{}{}, args...), page)
+	if page.Keyset {
+		query, pageArgs = keyset(columns, where, append([]interface{}{}, args...), "id", page)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, pageArgs...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch access logs")
+	}
+	defer rows.Close()
+
+	entries := []accesslog.Entry{}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var e accesslog.Entry
+		if err := rows.Scan(&id, &e.Method, &e.Path, &e.Status, &e.LatencyMs, &e.UserID, &e.IP, &e.RequestID, &e.Time); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read access log", "error", err)
+			continue
+		}
+		entries = append(entries, e)
+		ids = append(ids, id)
+	}
+
+	if page.Keyset {
+		n, meta := keysetMeta(page, ids)
+		return response.Paginated(c, entries[:n], meta)
+	}
+
+	total := countTotal(ctx, h.db, page, len(entries), "SELECT COUNT(*) FROM access_logs"+where, args...)
+
+	return response.Paginated(c, entries, page.Meta(total))
+}
+
+// accessLogFilters builds the WHERE clause from the query string. msg
+// describes the first malformed filter.
+func accessLogFilters(c *fiber.Ctx) (where string, args []interface{}, msg string) {
+	var conds []string
+	add := func(cond string, values ...interface{}) {
+		conds = append(conds, cond)
+		args = append(args, values...)
+	}
+
+	if method := c.Query("method"); method != "" {
+		add("method = ?", strings.ToUpper(method))
+	}
+	if path := c.Query("path"); path != "" {
+		add(`path LIKE ? ESCAPE '\'`, likePrefix(path))
+	}
+	if ip := c.Query("ip"); ip != "" {
+		add("ip = ?", ip)
+	}
+
+	if status := strings.ToLower(c.Query("status")); status != "" {
+		if len(status) == 3 && status[1:] == "xx" && status[0] >= '1' && status[0] <= '5' {
+			class := int(status[0]-'0') * 100
+			add("status >= ? AND status < ?", class, class+100)
+		} else if code, err := strconv.Atoi(status); err == nil && code >= 100 && code <= 599 {
+			add("status = ?", code)
+		} else {
+			return "", nil, "Invalid status, expected a code such as 404 or a class such as 5xx"
+		}
+	}
+
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return "", nil, "Invalid user_id"
+		}
+		add("user_id = ?", id)
+	}
+
+	timeConds, timeArgs, msg := timeRange(c, "created_at")
+	if msg != "" {
+		return "", nil, msg
+	}
+	conds = append(conds, timeConds...)
+	args = append(args, timeArgs...)
+
+	if len(conds) == 0 {
+		return "", nil, ""
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, ""
+}
+
+// timeRange reads the from/to filters on column as RFC 3339 times or
+// YYYY-MM-DD dates; a date in to includes that whole day. msg describes
+// a malformed bound.
+func timeRange(c *fiber.Ctx, column string) (conds []string, args []interface{}, msg string) {
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, dateOnly, ok := parseTimeFilter(raw)
+		if !ok {
+			return nil, nil, "Invalid " + bound.param + ", expected an RFC 3339 time or YYYY-MM-DD"
+		}
+		if dateOnly && bound.param == "to" {
+			t = t.AddDate(0, 0, 1)
+		}
+		conds = append(conds, column+" "+bound.op+" ?")
+		args = append(args, t.UTC())
+	}
+	return conds, args, ""
+}
+
+func parseTimeFilter(raw string) (t time.Time, dateOnly bool, ok bool) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, false, true
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, true, true
+	}
+	return time.Time{}, false, false
+}
+
+// likePrefix escapes LIKE wildcards in prefix and appends one
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
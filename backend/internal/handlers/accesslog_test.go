@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAccessLogHandler_GetAccessLogs(t *testing.T) {
+	db := dbtest.Open(t)
+
+	day := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	seed := []struct {
+		method, path string
+		status       int
+		userID       interface{}
+		ip           string
+		at           time.Time
+	}{
+		{"GET", "/api/stream/hls/abc/index.m3u8", 200, nil, "10.0.0.1", day},
+		{"GET", "/api/stream/hls/abc/seg1.ts", 404, nil, "10.0.0.1", day.Add(time.Minute)},
+		{"POST", "/api/cameras", 500, 3, "10.0.0.2", day.Add(2 * time.Minute)},
+		{"GET", "/api/stream_x", 200, nil, "10.0.0.3", day.AddDate(0, 0, 1)},
+	}
+	for _, s := range seed {
+		_, err := db.Exec(`INSERT INTO access_logs (method, path, status, user_id, ip, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			s.method, s.path, s.status, s.userID, s.ip, s.at)
+		if err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	cfg := &config.Config{AccessLog: config.AccessLogConfig{Sink: "database"}}
+	app := fiber.New()
+	app.Get("/access-logs", NewAccessLogHandler(db, cfg).GetAccessLogs)
+
+	get := func(query string) (int, response.Envelope) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/access-logs"+query, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"No filters", "", 4},
+		{"Path prefix", "?path=/api/stream/", 2},
+		{"Underscore is literal", "?path=/api/stream_", 1},
+		{"Status class", "?status=5xx", 1},
+		{"Exact status", "?status=404", 1},
+		{"IP and method", "?ip=10.0.0.1&method=get", 2},
+		{"User", "?user_id=3", 1},
+		{"Date range", "?from=2026-03-10&to=2026-03-10", 3},
+		{"Time range", "?from=2026-03-10T12:00:30Z", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, env := get(tt.query)
+			if status != 200 {
+				t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+			}
+			if got := len(env.Data.([]interface{})); got != tt.want {
+				t.Errorf("Expected %d entries, got %d", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Newest first", func(t *testing.T) {
+		_, env := get("?ip=10.0.0.1")
+		first := env.Data.([]interface{})[0].(map[string]interface{})
+		if first["status"] != float64(404) {
+			t.Errorf("Expected the later 404 first, got %v", first)
+		}
+	})
+
+	t.Run("Invalid filters", func(t *testing.T) {
+		for _, query := range []string{"?status=abc", "?status=6xx", "?user_id=x", "?from=yesterday"} {
+			if status, _ := get(query); status != 400 {
+				t.Errorf("%s: expected status 400, got %d", query, status)
+			}
+		}
+	})
+
+	t.Run("Cursor pages", func(t *testing.T) {
+		var paths []string
+		query := "?limit=3&cursor="
+		for pages := 0; pages < 3; pages++ {
+			status, env := get(query)
+			if status != 200 {
+				t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+			}
+			for _, e := range env.Data.([]interface{}) {
+				paths = append(paths, e.(map[string]interface{})["path"].(string))
+			}
+			if env.Meta.NextCursor == "" {
+				break
+			}
+			query = "?limit=3&cursor=" + env.Meta.NextCursor
+		}
+		if len(paths) != 4 || paths[0] != "/api/stream_x" || paths[3] != "/api/stream/hls/abc/index.m3u8" {
+			t.Errorf("Expected all 4 entries newest first over 2 pages, got %v", paths)
+		}
+
+		if status, _ := get("?cursor=bogus"); status != 400 {
+			t.Errorf("Expected status 400 for a bad cursor, got %d", status)
+		}
+	})
+
+	t.Run("Not stored in the database", func(t *testing.T) {
+		cfg.AccessLog.Sink = "file"
+		defer func() { cfg.AccessLog.Sink = "database" }()
+
+		if status, _ := get(""); status != 409 {
+			t.Errorf("Expected status 409, got %d", status)
+		}
+	})
+}
@@ -2,57 +2,49 @@ package handlers
 
 import (
 	"database/sql"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database"
+	"github.com/abcdefak87/cctv/internal/logretention"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/startlatency"
+	"github.com/abcdefak87/cctv/internal/sysmon"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
 	"github.com/gofiber/fiber/v2"
 )
 
 type AdminHandler struct {
-	db  *sql.DB
-	cfg *config.Config
+	db      *sql.DB
+	cfg     *config.Config
+	monitor *sysmon.Monitor
 }
 
-func NewAdminHandler(db *sql.DB, cfg *config.Config) *AdminHandler {
-	return &AdminHandler{db: db, cfg: cfg}
+func NewAdminHandler(db *sql.DB, cfg *config.Config, monitor *sysmon.Monitor) *AdminHandler {
+	return &AdminHandler{db: db, cfg: cfg, monitor: monitor}
 }
 
-// GetDashboardStats - Get dashboard statistics
+// GetDashboardStats - Get dashboard statistics over the cameras the
+// caller can access, those of their organization: its cameras, users
+// and areas, and the viewers and recordings of its cameras
 func (h *AdminHandler) GetDashboardStats(c *fiber.Ctx) error {
-	// Total cameras
-	var totalCameras, activeCameras, offlineCameras int
-	h.db.QueryRow("SELECT COUNT(*) FROM cameras").Scan(&totalCameras)
-	h.db.QueryRow("SELECT COUNT(*) FROM cameras WHERE enabled = 1").Scan(&activeCameras)
-	offlineCameras = totalCameras - activeCameras
-
-	// Total users
-	var totalUsers int
-	h.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&totalUsers)
-
-	// Total areas
-	var totalAreas int
-	h.db.QueryRow("SELECT COUNT(*) FROM areas").Scan(&totalAreas)
-
-	// Active viewers (last 5 minutes)
-	var activeViewers int
-	h.db.QueryRow(`
-		SELECT COUNT(DISTINCT session_id) 
-		FROM viewer_sessions 
-		WHERE started_at > datetime('now', '-5 minutes') AND ended_at IS NULL
-	`).Scan(&activeViewers)
-
-	// Total views today
-	var viewsToday int
-	h.db.QueryRow(`
-		SELECT COUNT(*) 
-		FROM viewer_sessions 
-		WHERE DATE(started_at) = DATE('now')
-	`).Scan(&viewsToday)
-
-	// Total recordings
-	var totalRecordings int
-	var totalRecordingSize int64
-	h.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(file_size), 0) FROM recordings").Scan(&totalRecordings, &totalRecordingSize)
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	counts, err := h.dashboardCounts(ctx, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch dashboard statistics")
+	}
+	totalCameras, activeCameras := counts.Cameras, counts.ActiveCameras
+	offlineCameras := totalCameras - activeCameras
+	totalUsers, totalAreas := counts.Users, counts.Areas
+	activeViewers, viewsToday := counts.ActiveViewers, counts.ViewsToday
+	totalRecordings, totalRecordingSize := counts.Recordings, counts.RecordingBytes
 
 	// Build response in format expected by frontend
 	stats := fiber.Map{
@@ -78,67 +70,100 @@ func (h *AdminHandler) GetDashboardStats(c *fiber.Ctx) error {
 			"count": totalRecordings,
 			"size":  totalRecordingSize,
 		},
-		"system": fiber.Map{
-			"totalMem": int64(8 * 1024 * 1024 * 1024), // 8GB placeholder
-			"freeMem":  int64(4 * 1024 * 1024 * 1024), // 4GB placeholder
-			"cpuLoad":  10, // 10% placeholder
-			"cpuModel": "Unknown CPU", // Placeholder
-		},
+		"system": h.systemFigures(),
 		"streams":     []interface{}{}, // Empty for now
 		"recentLogs":  []interface{}{}, // Empty for now
 		"mtxConnected": true, // Assume connected for now
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    stats,
-	})
+	// Size and retention of the audit and activity logs. The logs and
+	// their archives are those of the whole instance, so only admins
+	// running it get them.
+	if c.Locals("role") == models.RoleAdmin {
+		logs, err := logretention.New(h.db, h.cfg.Database.LogArchivePath).Status(ctx)
+		if err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read log volume", "error", err)
+			logs = []logretention.Status{}
+		}
+		stats["logs"] = logs
+	}
+
+	return response.OK(c, stats)
 }
 
 // GetSystemInfo - Get system information
 func (h *AdminHandler) GetSystemInfo(c *fiber.Ctx) error {
 	// Get basic system info
-	// Note: For production, use a proper system monitoring library
 	info := fiber.Map{
 		"version":    "1.0.0",
 		"go_version": "1.21",
 		"database":   "SQLite",
+		"instance":   h.cfg.Cluster.InstanceID,
 		"uptime":     time.Since(time.Now()).String(), // TODO: Track actual uptime
-		// Memory info (placeholder values for now)
-		"totalMem": int64(8 * 1024 * 1024 * 1024), // 8GB placeholder
-		"freeMem":  int64(4 * 1024 * 1024 * 1024), // 4GB placeholder
-		"cpuLoad":  10, // 10% placeholder
-		"cpuModel": "Unknown CPU", // Placeholder
+	}
+	for key, value := range h.systemFigures() {
+		info[key] = value
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    info,
-	})
+	return response.OK(c, info)
 }
 
-// GetRecentActivity - Get recent activity logs
+// systemFigures - Memory and CPU load of this instance from the latest
+// resource sample; figures the monitor has not sampled yet are left out
+func (h *AdminHandler) systemFigures() fiber.Map {
+	figures := fiber.Map{}
+	if h.monitor == nil {
+		return figures
+	}
+	sample, ok := h.monitor.Latest()
+	if !ok {
+		return figures
+	}
+	if sample.Memory != nil {
+		figures["totalMem"] = sample.Memory.TotalBytes
+		figures["freeMem"] = sample.Memory.AvailableBytes
+	}
+	if sample.CPU != nil {
+		figures["cpuLoad"] = math.Round(sample.CPU.Percent)
+		figures["cpuCores"] = sample.CPU.Cores
+	}
+	return figures
+}
+
+// GetRecentActivity - Get recent activity logs, which include every
+// published event of every organization, so only admins may read them.
+// ?cursor= switches to keyset pagination.
 func (h *AdminHandler) GetRecentActivity(c *fiber.Ctx) error {
-	limit := c.QueryInt("limit", 50)
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	page, err := response.ParseKeyset(c, 50)
+	if err != nil {
+		return response.Fail(c, 400, "Invalid cursor")
+	}
 
-	rows, err := h.db.Query(`
+	const columns = `
 		SELECT id, user_id, action, resource, details, ip_address, created_at
-		FROM activity_logs
-		ORDER BY created_at DESC
-		LIMIT ?
-	`, limit)
+		FROM activity_logs`
+	query, args := paginate(columns+`
+		ORDER BY created_at DESC, id DESC
+	`, nil, page)
+	if page.Keyset {
+		query, args = keyset(columns, "", nil, "id", page)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch activity logs",
-		})
+		return response.Fail(c, 500, "Failed to fetch activity logs")
 	}
 	defer rows.Close()
 
 	activities := []map[string]interface{}{}
+	var ids []int64
 	for rows.Next() {
-		var id, userID int
+		var id int
+		var userID *int // NULL for system actions and deleted users
 		var action, resource, details, ipAddress string
 		var createdAt time.Time
 
@@ -156,30 +181,37 @@ func (h *AdminHandler) GetRecentActivity(c *fiber.Ctx) error {
 			"ip_address": ipAddress,
 			"created_at": createdAt,
 		})
+		ids = append(ids, int64(id))
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    activities,
-	})
+	if page.Keyset {
+		n, meta := keysetMeta(page, ids)
+		return response.Paginated(c, activities[:n], meta)
+	}
+
+	total := countTotal(ctx, h.db, page, len(activities), "SELECT COUNT(*) FROM activity_logs")
+
+	return response.Paginated(c, activities, page.Meta(total))
 }
 
-// GetCameraHealth - Get camera health status
+// GetCameraHealth - Get camera health status, with the percentiles of
+// each camera's recent stream starts on this instance
 func (h *AdminHandler) GetCameraHealth(c *fiber.Ctx) error {
-	rows, err := h.db.Query(`
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, `
 		SELECT c.id, c.name, c.enabled, 
 		       COALESCE(h.status, 'unknown') as status,
-		       COALESCE(h.last_check, datetime('now', '-1 day')) as last_check
+		       h.last_check
 		FROM cameras c
 		LEFT JOIN camera_health h ON c.id = h.camera_id
+		WHERE c.organization_id = ?
 		ORDER BY c.id
-	`)
+	`, tenant.OrgID(ctx))
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch camera health",
-		})
+		return response.Fail(c, 500, "Failed to fetch camera health")
 	}
 	defer rows.Close()
 
@@ -188,67 +220,179 @@ func (h *AdminHandler) GetCameraHealth(c *fiber.Ctx) error {
 		var id int
 		var name, status string
 		var enabled bool
-		var lastCheck time.Time
+		var lastCheck sql.NullTime
 
 		err := rows.Scan(&id, &name, &enabled, &status, &lastCheck)
 		if err != nil {
 			continue
 		}
 
+		// Cameras never checked report a day-old check
+		if !lastCheck.Valid {
+			lastCheck.Time = time.Now().Add(-24 * time.Hour)
+		}
+
+		var starts *startlatency.Stats
+		if s, ok := startlatency.Shared().Stats(id); ok {
+			starts = &s
+		}
+
 		cameras = append(cameras, map[string]interface{}{
-			"id":         id,
-			"name":       name,
-			"enabled":    enabled,
-			"status":     status,
-			"last_check": lastCheck,
+			"id":            id,
+			"name":          name,
+			"enabled":       enabled,
+			"status":        status,
+			"last_check":    lastCheck.Time,
+			"start_latency": starts,
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    cameras,
-	})
+	return response.OK(c, cameras)
+}
+
+// GetViewerSessions - Viewer sessions of the organization's cameras,
+// newest first. Filters: camera_id, and active=true for sessions still
+// watching. ?cursor= switches to keyset pagination.
+func (h *AdminHandler) GetViewerSessions(c *fiber.Ctx) error {
+	conds := []string{"camera_id IN (SELECT id FROM cameras WHERE organization_id = ?)"}
+	args := []interface{}{tenant.OrgID(c.UserContext())}
+	if raw := c.Query("camera_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return response.Fail(c, 400, "Invalid camera_id")
+		}
+		conds = append(conds, "camera_id = ?")
+		args = append(args, id)
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return response.Fail(c, 400, "Invalid user_id")
+		}
+		conds = append(conds, "user_id = ?")
+		args = append(args, id)
+	}
+	if c.QueryBool("active") {
+		conds = append(conds, "ended_at IS NULL")
+	}
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	page, err := response.ParseKeyset(c, 50)
+	if err != nil {
+		return response.Fail(c, 400, "Invalid cursor")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	const columns = `
+		SELECT id, camera_id, session_id, viewer_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), referrer_host, transport,
+			transport_switches, started_at, ended_at, user_id,
+			COALESCE((SELECT u.username FROM users u WHERE u.id = viewer_sessions.user_id), '')
+		FROM viewer_sessions`
+	query, pageArgs := paginate(columns+where+`
+		ORDER BY started_at DESC, id DESC
+	`, append([]interface{}{}, args...), page)
+	if page.Keyset {
+		query, pageArgs = keyset(columns, where, append([]interface{}{}, args...), "id", page)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, pageArgs...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch viewer sessions")
+	}
+	defer rows.Close()
+
+	sessions := []models.ViewerSession{}
+	var ids []int64
+	for rows.Next() {
+		var s models.ViewerSession
+		if err := rows.Scan(&s.ID, &s.CameraID, &s.SessionID, &s.ViewerID, &s.IPAddress, &s.UserAgent, &s.Referrer, &s.Transport,
+			&s.TransportSwitches, &s.StartedAt, &s.EndedAt, &s.UserID, &s.Username); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read viewer session", "error", err)
+			continue
+		}
+		sessions = append(sessions, s)
+		ids = append(ids, s.ID)
+	}
+
+	if page.Keyset {
+		n, meta := keysetMeta(page, ids)
+		return response.Paginated(c, sessions[:n], meta)
+	}
+
+	total := countTotal(ctx, h.db, page, len(sessions), "SELECT COUNT(*) FROM viewer_sessions"+where, args...)
+
+	return response.Paginated(c, sessions, page.Meta(total))
 }
 
-// CleanupSessions - Cleanup old viewer sessions
+// CleanupSessions - Cleanup old viewer sessions of the organization's
+// cameras
 func (h *AdminHandler) CleanupSessions(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	days := c.QueryInt("days", 7)
 
-	result, err := h.db.Exec(`
+	result, err := h.db.ExecContext(ctx, `
 		DELETE FROM viewer_sessions 
-		WHERE started_at < datetime('now', '-' || ? || ' days')
-	`, days)
+		WHERE started_at < ? AND camera_id IN (SELECT id FROM cameras WHERE organization_id = ?)
+	`, time.Now().UTC().AddDate(0, 0, -days), tenant.OrgID(ctx))
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to cleanup sessions",
-		})
+		return response.Fail(c, 500, "Failed to cleanup sessions")
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Sessions cleaned up successfully",
-		"deleted": rowsAffected,
+	return c.JSON(response.Envelope{
+		Success: true,
+		Message: "Sessions cleaned up successfully",
+		Data:    fiber.Map{"deleted": rowsAffected},
 	})
 }
 
-// GetDatabaseStats - Get database statistics
+// ReloadConfig - Re-read .env and apply the settings that can change
+// without a restart (log level, CORS origins, rate limits, stream URLs)
+func (h *AdminHandler) ReloadConfig(c *fiber.Ctx) error {
+	changed, err := h.cfg.Reload()
+	if err != nil {
+		return response.Fail(c, 400, err.Error())
+	}
+
+	logger.FromContext(c.UserContext()).Info("Configuration reloaded", "changed", changed, "by", c.Locals("username"))
+
+	if changed == nil {
+		changed = []string{}
+	}
+	return c.JSON(response.Envelope{
+		Success: true,
+		Message: "Configuration reloaded",
+		Data:    fiber.Map{"changed": changed},
+	})
+}
+
+// GetDatabaseStats - Row counts per table and the size of the database:
+// its file, WAL and free pages, auto-vacuum mode and last checkpoint
 func (h *AdminHandler) GetDatabaseStats(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	stats := make(map[string]interface{})
 
 	tables := []string{"cameras", "users", "areas", "settings", "viewer_sessions", "recordings", "activity_logs"}
 
 	for _, table := range tables {
 		var count int
-		h.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count)
+		h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM " + table).Scan(&count)
 		stats[table] = count
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    stats,
-	})
+	storage, err := database.StorageOf(ctx, h.db, h.cfg.Database.Path)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch database size")
+	}
+	stats["storage"] = storage
+
+	return response.OK(c, stats)
 }
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestViewerSessionsOrganization(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://a', 'gate')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (2, 'Dander', 'rtsp://b', 'dander', 2)`,
+		`INSERT INTO viewer_sessions (camera_id, session_id, started_at) VALUES
+			(1, 'ours', '2026-01-01 10:00:00'), (2, 'theirs', '2026-01-01 10:00:00')`,
+	)
+
+	h := NewAdminHandler(db, &config.Config{}, nil)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(tenant.WithOrg(c.UserContext(), 1))
+		return c.Next()
+	})
+	app.Get("/admin/sessions", h.GetViewerSessions)
+	app.Post("/admin/cleanup-sessions", h.CleanupSessions)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/sessions", nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var list struct {
+		Data []models.ViewerSession `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	if len(list.Data) != 1 || list.Data[0].SessionID != "ours" {
+		t.Errorf("Expected the organization's session only, got %+v", list.Data)
+	}
+
+	if _, err := app.Test(httptest.NewRequest("POST", "/admin/cleanup-sessions?days=1", nil)); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var left []string
+	rows, _ := db.Query(`SELECT session_id FROM viewer_sessions`)
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		left = append(left, id)
+	}
+	rows.Close()
+	if len(left) != 1 || left[0] != "theirs" {
+		t.Errorf("Expected the other organization's session kept, got %v", left)
+	}
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/alerting"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AlertHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewAlertHandler(db *sql.DB, cfg *config.Config) *AlertHandler {
+	return &AlertHandler{db: db, cfg: cfg}
+}
+
+// AlertPolicyRequest is the create/update body for an alert policy. It
+// covers camera_id, area_id, or with neither the whole organization;
+// omitted settings fall back to the defaults.
+type AlertPolicyRequest struct {
+	CameraID          validate.FlexibleInt  `json:"camera_id" validate:"id"`
+	AreaID            validate.FlexibleInt  `json:"area_id" validate:"id"`
+	DedupSeconds      validate.FlexibleInt  `json:"dedup_seconds" validate:"min=0,max=86400"`
+	FlapChanges       validate.FlexibleInt  `json:"flap_changes" validate:"min=0,max=100"`
+	FlapWindowSeconds validate.FlexibleInt  `json:"flap_window_seconds" validate:"min=60,max=86400"`
+	Steps             []alerting.Step       `json:"steps" validate:"max=10"`
+	Muted             validate.FlexibleBool `json:"muted"`
+}
+
+// CameraAlert is the alert state of a camera as operators see it
+type CameraAlert struct {
+	alerting.State
+	Camera string `json:"camera"`
+}
+
+// GetAlertPolicies - Alert policies of the organization
+func (h *AlertHandler) GetAlertPolicies(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	list, err := alerting.Policies(ctx, h.db, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch alert policies")
+	}
+	return response.OK(c, list)
+}
+
+// CreateAlertPolicy - Add an alert policy for a camera, an area or the
+// organization
+func (h *AlertHandler) CreateAlertPolicy(c *fiber.Ctx) error {
+	var req AlertPolicyRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkPolicy(ctx, c, &req, 0); !ok {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var id int64
+	err := h.db.QueryRowContext(ctx, `
+		INSERT INTO alert_policies (camera_id, area_id, dedup_seconds, flap_changes, flap_window_seconds, steps, muted,
+			created_at, updated_at, organization_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, append(req.values(now, now), tenant.OrgID(ctx))...).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create alert policy")
+	}
+
+	return response.Created(c, "Alert policy created successfully", fiber.Map{
+		"id": id,
+	})
+}
+
+// UpdateAlertPolicy - Replace an alert policy
+func (h *AlertHandler) UpdateAlertPolicy(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Alert policy not found")
+	}
+
+	var req AlertPolicyRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkPolicy(ctx, c, &req, id); !ok {
+		return err
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE alert_policies
+		SET camera_id = ?, area_id = ?, dedup_seconds = ?, flap_changes = ?, flap_window_seconds = ?, steps = ?,
+			muted = ?, updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, append(req.values(time.Now().UTC()), id, tenant.OrgID(ctx))...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update alert policy")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Alert policy not found")
+	}
+
+	return response.Message(c, "Alert policy updated successfully")
+}
+
+// DeleteAlertPolicy - Delete an alert policy; its cameras fall back to
+// the next policy up
+func (h *AlertHandler) DeleteAlertPolicy(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Alert policy not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM alert_policies WHERE id = ? AND organization_id = ?",
+		id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete alert policy")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Alert policy not found")
+	}
+
+	return response.Message(c, "Alert policy deleted successfully")
+}
+
+// GetCameraAlerts - What the alerter last saw of each camera: offline
+// and flapping cameras first
+func (h *AlertHandler) GetCameraAlerts(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT a.camera_id, c.name, a.status, a.since, a.changes, a.window_start, a.flapping, a.steps_sent, a.notified
+		FROM camera_alerts a
+		JOIN cameras c ON c.id = a.camera_id
+		WHERE c.organization_id = ?
+		ORDER BY a.flapping DESC, a.status = 'offline' DESC, a.since DESC, a.camera_id ASC
+	`, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch camera alerts")
+	}
+	defer rows.Close()
+
+	list := []CameraAlert{}
+	for rows.Next() {
+		var a CameraAlert
+		var notified string
+		if err := rows.Scan(&a.CameraID, &a.Camera, &a.Status, &a.Since, &a.Changes, &a.WindowStart,
+			&a.Flapping, &a.StepsSent, &notified); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read camera alert", "error", err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(notified), &a.Notified); err != nil || a.Notified == nil {
+			a.Notified = map[string]time.Time{}
+		}
+		list = append(list, a)
+	}
+
+	return response.OK(c, list)
+}
+
+// checkPolicy rejects a policy for a camera or area that does not
+// exist, bad steps, and a second policy for the same camera, area or
+// organization. id is the policy being updated, 0 on create. When ok is
+// false the response has been written and the handler should return
+// err.
+func (h *AlertHandler) checkPolicy(ctx context.Context, c *fiber.Ctx, req *AlertPolicyRequest, id int) (ok bool, err error) {
+	cameraID, areaID := req.CameraID.ID(), req.AreaID.ID()
+	fields := map[string]string{}
+	if cameraID != nil && areaID != nil {
+		fields["area_id"] = "cannot be set with camera_id"
+	}
+	for i, step := range req.Steps {
+		switch {
+		case !alerting.ValidChannel(step.Channel):
+			fields[fmt.Sprintf("steps[%d].channel", i)] = "must be one of " + alerting.ChannelList()
+		case step.AfterMinutes < 0 || step.AfterMinutes > 7*24*60:
+			fields[fmt.Sprintf("steps[%d].after_minutes", i)] = "must be between 0 and 10080"
+		case len(step.To) > 200:
+			fields[fmt.Sprintf("steps[%d].to", i)] = "must be at most 200 characters"
+		}
+	}
+	if len(fields) > 0 {
+		return false, invalidFields(c, "", fields)
+	}
+
+	orgID := tenant.OrgID(ctx)
+	if cameraID != nil {
+		found, err := cameraExists(ctx, h.db, *cameraID)
+		if err != nil {
+			return false, serviceError(c, err, "", "Failed to save alert policy")
+		}
+		if !found {
+			return false, invalidFields(c, "", map[string]string{"camera_id": "Camera not found"})
+		}
+	}
+	if areaID != nil {
+		var found int
+		err := h.db.QueryRowContext(ctx, "SELECT 1 FROM areas WHERE id = ? AND organization_id = ?",
+			*areaID, orgID).Scan(&found)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, invalidFields(c, "", map[string]string{"area_id": "Area not found"})
+		}
+		if err != nil {
+			return false, serviceError(c, err, "", "Failed to save alert policy")
+		}
+	}
+
+	// Only one policy may cover the same thing
+	query, args, target := `SELECT id FROM alert_policies WHERE organization_id = ? AND id <> ? AND `, []interface{}{orgID, id}, "the organization"
+	switch {
+	case cameraID != nil:
+		query, target = query+"camera_id = ?", "this camera"
+		args = append(args, *cameraID)
+	case areaID != nil:
+		query, target = query+"area_id = ?", "this area"
+		args = append(args, *areaID)
+	default:
+		query += "camera_id IS NULL AND area_id IS NULL"
+	}
+	var other int
+	err = h.db.QueryRowContext(ctx, query, args...).Scan(&other)
+	if err == nil {
+		return false, response.Fail(c, 409, "An alert policy for "+target+" already exists")
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, serviceError(c, err, "", "Failed to save alert policy")
+	}
+	return true, nil
+}
+
+// values are the policy columns in insert/update order, followed by the
+// given timestamps
+func (r *AlertPolicyRequest) values(times ...time.Time) []interface{} {
+	p := alerting.Default()
+	if r.DedupSeconds.Set {
+		p.DedupSeconds = r.DedupSeconds.Int
+	}
+	if r.FlapChanges.Set {
+		p.FlapChanges = r.FlapChanges.Int
+	}
+	if r.FlapWindowSeconds.Set {
+		p.FlapWindowSeconds = r.FlapWindowSeconds.Int
+	}
+	if r.Steps != nil {
+		p.Steps = append([]alerting.Step{}, r.Steps...)
+		sort.SliceStable(p.Steps, func(i, j int) bool { return p.Steps[i].AfterMinutes < p.Steps[j].AfterMinutes })
+	}
+	steps, _ := json.Marshal(p.Steps)
+
+	values := []interface{}{r.CameraID.ID(), r.AreaID.ID(), p.DedupSeconds, p.FlapChanges, p.FlapWindowSeconds,
+		string(steps), r.Muted.Bool}
+	for _, t := range times {
+		values = append(values, t)
+	}
+	return values
+}
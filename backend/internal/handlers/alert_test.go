@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAlertPolicies(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO areas (id, name) VALUES (1, 'Market')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (2, 'Elsewhere', 'rtsp://x', 'x', 2)`,
+	)
+
+	h := NewAlertHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/admin/alert-policies", h.GetAlertPolicies)
+	app.Post("/admin/alert-policies", h.CreateAlertPolicy)
+	app.Put("/admin/alert-policies/:id", h.UpdateAlertPolicy)
+	app.Delete("/admin/alert-policies/:id", h.DeleteAlertPolicy)
+	app.Get("/admin/camera-alerts", h.GetCameraAlerts)
+
+	do := func(method, path, body string, org int) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		for _, body := range []string{
+			`{}`,
+			`{"area_id":1,"steps":[{"after_minutes":30,"channel":"sms"},{"after_minutes":0,"channel":"telegram","to":"-100"}]}`,
+			`{"camera_id":1,"muted":true}`,
+		} {
+			if status, env := do("POST", "/admin/alert-policies", body, 1); status != 201 {
+				t.Fatalf("Expected status 201 for %s, got %d (%+v)", body, status, env.Error)
+			}
+		}
+
+		_, env := do("GET", "/admin/alert-policies", "", 1)
+		list := env.Data.([]interface{})
+		if len(list) != 3 {
+			t.Fatalf("Expected 3 policies, got %d", len(list))
+		}
+		org := list[0].(map[string]interface{})
+		if org["dedup_seconds"] != float64(300) || len(org["steps"].([]interface{})) != 6 {
+			t.Errorf("Expected the defaults for an empty body, got %v", org)
+		}
+		steps := list[1].(map[string]interface{})["steps"].([]interface{})
+		if first := steps[0].(map[string]interface{}); first["channel"] != "telegram" {
+			t.Errorf("Expected steps sorted by delay, got %v", steps)
+		}
+		if muted := list[2].(map[string]interface{})["muted"]; muted != true {
+			t.Errorf("Expected the camera policy muted, got %v", muted)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"camera_id":1,"area_id":1}`,
+			`{"camera_id":2}`,
+			`{"area_id":9}`,
+			`{"steps":[{"after_minutes":0,"channel":"pager"}]}`,
+			`{"steps":[{"after_minutes":-5,"channel":"email"}]}`,
+			`{"flap_window_seconds":5}`,
+		} {
+			if status, env := do("POST", "/admin/alert-policies", body, 1); status != 422 {
+				t.Errorf("Expected status 422 for %s, got %d (%+v)", body, status, env.Error)
+			}
+		}
+	})
+
+	t.Run("One policy per target", func(t *testing.T) {
+		if status, _ := do("POST", "/admin/alert-policies", `{"area_id":1}`, 1); status != 409 {
+			t.Errorf("Expected status 409 for a second area policy, got %d", status)
+		}
+		if status, env := do("PUT", "/admin/alert-policies/2", `{"area_id":1,"dedup_seconds":60}`, 1); status != 200 {
+			t.Errorf("Expected a policy to be updated in place, got %d (%+v)", status, env.Error)
+		}
+		if status, _ := do("POST", "/admin/alert-policies", `{}`, 2); status != 201 {
+			t.Errorf("Expected another organization to have its own default, got %d", status)
+		}
+	})
+
+	t.Run("Other organizations", func(t *testing.T) {
+		if status, _ := do("PUT", "/admin/alert-policies/1", `{"camera_id":2}`, 2); status != 404 {
+			t.Errorf("Expected status 404, got %d", status)
+		}
+		if status, _ := do("DELETE", "/admin/alert-policies/1", "", 2); status != 404 {
+			t.Errorf("Expected status 404, got %d", status)
+		}
+	})
+
+	t.Run("Camera alerts", func(t *testing.T) {
+		db.Exec(`INSERT INTO camera_alerts (camera_id, status, since, window_start, notified) VALUES (1, 'offline', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, '{}')`)
+		_, env := do("GET", "/admin/camera-alerts", "", 1)
+		list := env.Data.([]interface{})
+		if len(list) != 1 || list[0].(map[string]interface{})["camera"] != "Gate" {
+			t.Errorf("Expected the offline camera, got %v", list)
+		}
+		_, env = do("GET", "/admin/camera-alerts", "", 2)
+		if list := env.Data.([]interface{}); len(list) != 0 {
+			t.Errorf("Expected no alerts of another organization, got %v", list)
+		}
+	})
+}
+
+func TestNotificationTemplates(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, otherOrg)
+
+	h := NewAlertHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/admin/notification-templates", h.GetNotificationTemplates)
+	app.Put("/admin/notification-templates/:type", h.UpdateNotificationTemplate)
+	app.Delete("/admin/notification-templates/:type", h.DeleteNotificationTemplate)
+	app.Post("/admin/notification-templates/:type/preview", h.PreviewNotificationTemplate)
+
+	do := func(method, path, body string, org int) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+	preview := func(body string, org int) map[string]interface{} {
+		t.Helper()
+		status, env := do("POST", "/admin/notification-templates/camera_offline/preview", body, org)
+		if status != 200 {
+			t.Fatalf("Expected status 200 for the preview of %s, got %d (%+v)", body, status, env.Error)
+		}
+		return env.Data.(map[string]interface{})
+	}
+
+	if got := preview("", 1); got["text"] != "🔴 Camera Main Gate has been offline for 1h5m.\ndial tcp 10.0.0.12:554: i/o timeout" {
+		t.Errorf("Expected the default wording with sample variables, got %q", got["text"])
+	}
+	got := preview(`{"text":"{{camera}} down in {{ area }}{{error}}","channel":"sms","variables":{"error":""}}`, 1)
+	if got["text"] != "Main Gate down in Market" || got["subject"] != "Camera Main Gate is offline" || got["channel"] != "sms" {
+		t.Errorf("Expected the body's template rendered, got %v", got)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"PUT", "/admin/notification-templates/camera_offline", `{"text":"{{camera}} is down for {{ip}}"}`, 422},
+		{"PUT", "/admin/notification-templates/camera_offline", `{"channels":{"pager":"x"}}`, 422},
+		{"PUT", "/admin/notification-templates/camera_exploded", `{"text":"boom"}`, 404},
+		{"POST", "/admin/notification-templates/camera_offline/preview", `{"channel":"pager"}`, 422},
+		{"PUT", "/admin/notification-templates/camera_offline", `{"subject":"[CCTV] {{camera}}","text":"{{camera}} down","channels":{"email":"{{camera}} in {{area}} is down: {{error}}"}}`, 200},
+		{"PUT", "/admin/notification-templates/ip_banned", `{"text":"ban {{ip}}"}`, 200},
+	} {
+		if status, env := do(tc.method, tc.path, tc.body, 1); status != tc.status {
+			t.Errorf("%s %s %s: expected status %d, got %d (%+v)", tc.method, tc.path, tc.body, tc.status, status, env.Error)
+		}
+	}
+
+	if got := preview(`{"channel":"email"}`, 1); got["subject"] != "[CCTV] Main Gate" || got["text"] != "Main Gate in Market is down: dial tcp 10.0.0.12:554: i/o timeout" {
+		t.Errorf("Expected the saved email template, got %v", got)
+	}
+	if got := preview(`{"channel":"telegram"}`, 1); got["text"] != "Main Gate down" {
+		t.Errorf("Expected the saved text on other channels, got %v", got)
+	}
+	if got := preview(`{"channel":"telegram"}`, 2); got["text"] == "Main Gate down" {
+		t.Errorf("Expected another organization to keep the default, got %v", got)
+	}
+
+	_, env := do("GET", "/admin/notification-templates", "", 1)
+	custom := map[string]bool{}
+	for _, item := range env.Data.([]interface{}) {
+		item := item.(map[string]interface{})
+		custom[item["type"].(string)] = item["template"] != nil
+	}
+	if len(custom) != 13 || !custom["camera_offline"] || !custom["ip_banned"] || custom["camera_online"] {
+		t.Errorf("Expected every alert type with the two saved templates, got %v", custom)
+	}
+
+	if status, _ := do("DELETE", "/admin/notification-templates/camera_offline", "", 1); status != 200 {
+		t.Fatalf("Expected the template deleted, got %d", status)
+	}
+	if got := preview(`{"channel":"email"}`, 1); got["subject"] != "Camera Main Gate is offline" {
+		t.Errorf("Expected the default wording back, got %v", got)
+	}
+	var value string
+	db.QueryRow(`SELECT value FROM settings WHERE key = 'notification_templates' AND organization_id = 1`).Scan(&value)
+	if value != `{"ip_banned":{"text":"ban {{ip}}"}}` {
+		t.Errorf("Expected the other template kept in the setting, got %s", value)
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"github.com/abcdefak87/cctv/internal/alerting"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// NotificationTemplateRequest words the notifications of an alert type;
+// {{variable}} is replaced by the variable's value and empty fields use
+// the default wording
+type NotificationTemplateRequest struct {
+	Subject  string            `json:"subject"`
+	Text     string            `json:"text"`
+	Channels map[string]string `json:"channels"` // text by channel, in place of text
+}
+
+// NotificationPreviewRequest renders a template as it would be sent on
+// channel. Without subject, text or channels it renders the saved
+// template; variables override the alert type's sample values.
+type NotificationPreviewRequest struct {
+	Subject   string            `json:"subject"`
+	Text      string            `json:"text"`
+	Channels  map[string]string `json:"channels"`
+	Channel   string            `json:"channel"`
+	Variables map[string]string `json:"variables" validate:"max=50"`
+}
+
+// NotificationTemplate is an alert type with the organization's
+// template, null while it uses the default
+type NotificationTemplate struct {
+	alerting.AlertType
+	Template *alerting.Template `json:"template"`
+}
+
+// NotificationPreview is a template rendered for one channel
+type NotificationPreview struct {
+	Channel string `json:"channel"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// GetNotificationTemplates - Every alert type with its variables, its
+// default wording and the organization's template
+func (h *AlertHandler) GetNotificationTemplates(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	templates, err := alerting.LoadTemplates(ctx, h.db, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch notification templates")
+	}
+	list := []NotificationTemplate{}
+	for _, at := range alerting.AlertTypes() {
+		item := NotificationTemplate{AlertType: at}
+		if t, ok := templates[at.Type]; ok {
+			item.Template = &t
+		}
+		list = append(list, item)
+	}
+	return response.OK(c, list)
+}
+
+// UpdateNotificationTemplate - Set the wording of an alert type's
+// notifications
+func (h *AlertHandler) UpdateNotificationTemplate(c *fiber.Ctx) error {
+	alertType := c.Params("type")
+	if _, ok := alerting.LookupAlertType(alertType); !ok {
+		return response.Fail(c, 404, "Alert type not found")
+	}
+	var req NotificationTemplateRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	t := alerting.Template{Subject: req.Subject, Text: req.Text, Channels: req.Channels}
+	if problems := t.Validate(alertType); problems != nil {
+		return invalidFields(c, "", problems)
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if err := alerting.SaveTemplate(ctx, h.db, tenant.OrgID(ctx), alertType, &t); err != nil {
+		return serviceError(c, err, "", "Failed to save notification template")
+	}
+	publish(c, events.Event{Type: events.SettingsUpdated, Resource: "settings", Data: map[string]interface{}{"keys": []string{alerting.TemplatesKey}}})
+	return response.Message(c, "Notification template saved")
+}
+
+// DeleteNotificationTemplate - Go back to the default wording of an
+// alert type
+func (h *AlertHandler) DeleteNotificationTemplate(c *fiber.Ctx) error {
+	alertType := c.Params("type")
+	if _, ok := alerting.LookupAlertType(alertType); !ok {
+		return response.Fail(c, 404, "Alert type not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if err := alerting.SaveTemplate(ctx, h.db, tenant.OrgID(ctx), alertType, nil); err != nil {
+		return serviceError(c, err, "", "Failed to delete notification template")
+	}
+	publish(c, events.Event{Type: events.SettingsUpdated, Resource: "settings", Data: map[string]interface{}{"keys": []string{alerting.TemplatesKey}}})
+	return response.Message(c, "Notification template deleted")
+}
+
+// PreviewNotificationTemplate - Render a template, the one in the body
+// or the saved one, with sample variables, without sending anything
+func (h *AlertHandler) PreviewNotificationTemplate(c *fiber.Ctx) error {
+	alertType := c.Params("type")
+	at, ok := alerting.LookupAlertType(alertType)
+	if !ok {
+		return response.Fail(c, 404, "Alert type not found")
+	}
+	var req NotificationPreviewRequest
+	if len(c.Body()) > 0 {
+		if ok, err := bind(c, &req); !ok {
+			return err
+		}
+	}
+	if req.Channel == "" {
+		req.Channel = alerting.Telegram
+	}
+
+	t := alerting.Template{Subject: req.Subject, Text: req.Text, Channels: req.Channels}
+	problems := t.Validate(alertType)
+	if !alerting.ValidChannel(req.Channel) {
+		if problems == nil {
+			problems = map[string]string{}
+		}
+		problems["channel"] = "must be one of " + alerting.ChannelList()
+	}
+	if problems != nil {
+		return invalidFields(c, "", problems)
+	}
+
+	templates := alerting.Templates{alertType: t}
+	if t.Subject == "" && t.Text == "" && len(t.Channels) == 0 {
+		ctx, cancel := dbContext(c, h.cfg)
+		defer cancel()
+		saved, err := alerting.LoadTemplates(ctx, h.db, tenant.OrgID(ctx))
+		if err != nil {
+			return serviceError(c, err, "", "Failed to fetch notification templates")
+		}
+		templates = saved
+	}
+
+	vars := map[string]string{}
+	for k, v := range at.Sample {
+		vars[k] = v
+	}
+	for k, v := range req.Variables {
+		vars[k] = v
+	}
+	m := templates.Render(alertType, req.Channel, vars)
+	return response.OK(c, NotificationPreview{Channel: req.Channel, Subject: m.Subject, Text: m.Text})
+}
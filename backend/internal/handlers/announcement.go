@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AnnouncementHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewAnnouncementHandler(db *sql.DB, cfg *config.Config) *AnnouncementHandler {
+	return &AnnouncementHandler{db: db, cfg: cfg}
+}
+
+// AnnouncementRequest is the create/update body for an announcement.
+// Times are RFC 3339; starts_at defaults to now and an empty ends_at
+// keeps it up until removed. An empty area_ids is for every area.
+type AnnouncementRequest struct {
+	Title    string `json:"title" validate:"required,max=200"`
+	Body     string `json:"body" validate:"max=2000"`
+	Severity string `json:"severity" validate:"oneof=info warning critical"`
+	StartsAt string `json:"starts_at"`
+	EndsAt   string `json:"ends_at"`
+	AreaIDs  []int  `json:"area_ids" validate:"max=100"`
+
+	startsAt time.Time
+	endsAt   *time.Time
+}
+
+const announcementColumns = `
+	SELECT id, title, body, severity, starts_at, ends_at, created_by, created_at, updated_at
+	FROM announcements`
+
+// GetAnnouncements - Announcements, latest start first. Filter: state
+// (scheduled, active or ended).
+func (h *AnnouncementHandler) GetAnnouncements(c *fiber.Ctx) error {
+	now := time.Now().UTC()
+	conds := []string{"organization_id = ?"}
+	args := []interface{}{tenant.OrgID(c.UserContext())}
+	switch c.Query("state") {
+	case "":
+	case "scheduled":
+		conds = append(conds, "starts_at > ?")
+		args = append(args, now)
+	case "active":
+		conds = append(conds, "starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)")
+		args = append(args, now, now)
+	case "ended":
+		conds = append(conds, "ends_at <= ?")
+		args = append(args, now)
+	default:
+		return response.Fail(c, 400, "Invalid state, expected scheduled, active or ended")
+	}
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	page := response.ParsePage(c, 50)
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	query, pageArgs := paginate(announcementColumns+where+`
+		ORDER BY starts_at DESC, id DESC
+	`, append([]interface{}{}, args...), page)
+	list, err := h.query(ctx, c, query, pageArgs...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch announcements")
+	}
+
+	total := countTotal(ctx, h.db, page, len(list), "SELECT COUNT(*) FROM announcements"+where, args...)
+
+	return response.Paginated(c, list, page.Meta(total))
+}
+
+// GetActiveAnnouncements - Announcements showing now, most severe first.
+// With ?area_id= only those for every area, that area or an area it is
+// in.
+func (h *AnnouncementHandler) GetActiveAnnouncements(c *fiber.Ctx) error {
+	var areaID *int
+	if raw := c.Query("area_id"); raw != "" {
+		id, err := validate.ID(raw)
+		if err != nil || id == nil {
+			return response.Fail(c, 400, "Invalid area_id")
+		}
+		areaID = id
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	list, err := h.activeAnnouncements(ctx, c, areaID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch announcements")
+	}
+
+	c.Set("Cache-Control", "public, max-age=30")
+	return response.OK(c, list)
+}
+
+// activeAnnouncements lists the announcements of the organization in ctx
+// that are up now, most severe first, without who created them. With an
+// areaID only those for every area or for the area and its parents.
+func (h *AnnouncementHandler) activeAnnouncements(ctx context.Context, c *fiber.Ctx, areaID *int) ([]models.Announcement, error) {
+	now := time.Now().UTC()
+	cond := ""
+	args := []interface{}{tenant.OrgID(ctx), now, now}
+	if areaID != nil {
+		// The area and its parents up to the kecamatan
+		cond = `
+			AND (NOT EXISTS (SELECT 1 FROM announcement_areas WHERE announcement_id = announcements.id)
+			     OR id IN (
+				WITH RECURSIVE lineage(id, parent_id) AS (
+					SELECT id, parent_id FROM areas WHERE id = ?
+					UNION ALL
+					SELECT a.id, a.parent_id FROM areas a JOIN lineage l ON a.id = l.parent_id
+				)
+				SELECT announcement_id FROM announcement_areas WHERE area_id IN (SELECT id FROM lineage)
+			))`
+		args = append(args, *areaID)
+	}
+
+	list, err := h.query(ctx, c, announcementColumns+`
+		WHERE organization_id = ? AND starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)`+cond+`
+		ORDER BY CASE severity WHEN 'critical' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END, starts_at DESC, id DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for n := range list {
+		list[n].CreatedBy = nil
+	}
+	return list, nil
+}
+
+// GetAnnouncement - An announcement with its areas
+func (h *AnnouncementHandler) GetAnnouncement(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Announcement not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	list, err := h.query(ctx, c, announcementColumns+` WHERE id = ? AND organization_id = ?`, id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch announcement")
+	}
+	if len(list) == 0 {
+		return response.Fail(c, 404, "Announcement not found")
+	}
+
+	return response.OK(c, list[0])
+}
+
+// CreateAnnouncement - Create an announcement
+func (h *AnnouncementHandler) CreateAnnouncement(c *fiber.Ctx) error {
+	var req AnnouncementRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRequest(ctx, c, &req); !ok {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create announcement")
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var userID *int
+	if id, ok := c.Locals("user_id").(int); ok {
+		userID = &id
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO announcements (organization_id, title, body, severity, starts_at, ends_at, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, tenant.OrgID(ctx), req.Title, req.Body, req.Severity, req.startsAt, req.endsAt, userID, now, now).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create announcement")
+	}
+	if err := setAnnouncementAreas(ctx, tx, id, req.AreaIDs); err != nil {
+		return serviceError(c, err, "", "Failed to create announcement")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to create announcement")
+	}
+
+	return response.Created(c, "Announcement created successfully", fiber.Map{
+		"id": id,
+	})
+}
+
+// UpdateAnnouncement - Replace an announcement
+func (h *AnnouncementHandler) UpdateAnnouncement(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Announcement not found")
+	}
+
+	var req AnnouncementRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRequest(ctx, c, &req); !ok {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update announcement")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE announcements SET title = ?, body = ?, severity = ?, starts_at = ?, ends_at = ?, updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, req.Title, req.Body, req.Severity, req.startsAt, req.endsAt, time.Now().UTC(), id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update announcement")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Announcement not found")
+	}
+	if err := setAnnouncementAreas(ctx, tx, int64(id), req.AreaIDs); err != nil {
+		return serviceError(c, err, "", "Failed to update announcement")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to update announcement")
+	}
+
+	return response.Message(c, "Announcement updated successfully")
+}
+
+// DeleteAnnouncement - Delete an announcement
+func (h *AnnouncementHandler) DeleteAnnouncement(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Announcement not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM announcements WHERE id = ? AND organization_id = ?", id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete announcement")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Announcement not found")
+	}
+
+	return response.Message(c, "Announcement deleted successfully")
+}
+
+// checkRequest normalises req, parses its times and rejects areas outside
+// the organization. When ok is false the response has been written and
+// the handler should return err.
+func (h *AnnouncementHandler) checkRequest(ctx context.Context, c *fiber.Ctx, req *AnnouncementRequest) (ok bool, err error) {
+	req.Title = strings.TrimSpace(req.Title)
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Severity == "" {
+		req.Severity = models.AnnouncementInfo
+	}
+
+	fields := map[string]string{}
+	req.startsAt = time.Now().UTC()
+	if req.StartsAt != "" {
+		t, err := time.Parse(time.RFC3339, req.StartsAt)
+		if err != nil {
+			fields["starts_at"] = "must be an RFC 3339 time"
+		}
+		req.startsAt = t.UTC()
+	}
+	req.endsAt = nil
+	if req.EndsAt != "" {
+		t, err := time.Parse(time.RFC3339, req.EndsAt)
+		switch {
+		case err != nil:
+			fields["ends_at"] = "must be an RFC 3339 time"
+		case !t.After(req.startsAt):
+			fields["ends_at"] = "must be after starts_at"
+		default:
+			t = t.UTC()
+			req.endsAt = &t
+		}
+	}
+	if len(fields) > 0 {
+		return false, invalidFields(c, "", fields)
+	}
+
+	seen := map[int]bool{}
+	ids := req.AreaIDs[:0]
+	for _, id := range req.AreaIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	req.AreaIDs = ids
+	sort.Ints(req.AreaIDs)
+
+	for _, id := range req.AreaIDs {
+		var found int
+		err := h.db.QueryRowContext(ctx, "SELECT 1 FROM areas WHERE id = ? AND organization_id = ?",
+			id, tenant.OrgID(ctx)).Scan(&found)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, invalidFields(c, "", map[string]string{"area_ids": "Area not found"})
+		}
+		if err != nil {
+			return false, serviceError(c, err, "", "Failed to save announcement")
+		}
+	}
+	return true, nil
+}
+
+// query runs an announcementColumns query and fills in the areas of the
+// announcements it returns
+func (h *AnnouncementHandler) query(ctx context.Context, c *fiber.Ctx, query string, args ...interface{}) ([]models.Announcement, error) {
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Announcement{}
+	for rows.Next() {
+		var a models.Announcement
+		if err := rows.Scan(&a.ID, &a.Title, &a.Body, &a.Severity, &a.StartsAt, &a.EndsAt, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read announcement", "error", err)
+			continue
+		}
+		a.AreaIDs = []int{}
+		list = append(list, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(list) == 0 {
+		return list, nil
+	}
+	byID := map[int]*models.Announcement{}
+	ids := make([]interface{}, len(list))
+	for n := range list {
+		byID[list[n].ID] = &list[n]
+		ids[n] = list[n].ID
+	}
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT announcement_id, area_id FROM announcement_areas
+		WHERE announcement_id IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")+`)
+		ORDER BY area_id ASC
+	`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var announcementID, areaID int
+		if err := rows.Scan(&announcementID, &areaID); err != nil {
+			return nil, err
+		}
+		byID[announcementID].AreaIDs = append(byID[announcementID].AreaIDs, areaID)
+	}
+	return list, rows.Err()
+}
+
+// setAnnouncementAreas replaces the areas announcement id is for
+func setAnnouncementAreas(ctx context.Context, tx *sql.Tx, id int64, areaIDs []int) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM announcement_areas WHERE announcement_id = ?", id); err != nil {
+		return err
+	}
+	for _, areaID := range areaIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO announcement_areas (announcement_id, area_id) VALUES (?, ?)", id, areaID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAnnouncements(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO areas (id, name, parent_id) VALUES (1, 'Dander', NULL), (2, 'RT 01', 1), (3, 'Tanjungharjo', NULL)`,
+		`INSERT INTO areas (id, name, organization_id) VALUES (4, 'Elsewhere', 2)`,
+	)
+
+	h := NewAnnouncementHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/announcements/active", h.GetActiveAnnouncements)
+	app.Get("/admin/announcements", h.GetAnnouncements)
+	app.Get("/admin/announcements/:id", h.GetAnnouncement)
+	app.Post("/admin/announcements", h.CreateAnnouncement)
+	app.Put("/admin/announcements/:id", h.UpdateAnnouncement)
+	app.Delete("/admin/announcements/:id", h.DeleteAnnouncement)
+
+	do := func(method, path, body string, org int) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+	titles := func(env response.Envelope) []string {
+		list := []string{}
+		for _, a := range env.Data.([]interface{}) {
+			list = append(list, a.(map[string]interface{})["title"].(string))
+		}
+		return list
+	}
+
+	now := time.Now().UTC()
+	later := now.Add(24 * time.Hour).Format(time.RFC3339)
+	earlier := now.Add(-24 * time.Hour).Format(time.RFC3339)
+
+	t.Run("Create", func(t *testing.T) {
+		for _, body := range []string{
+			`{"title":"Maintenance tonight"}`,
+			`{"title":"Dander cameras down due to fiber cut","severity":"critical","area_ids":[1]}`,
+			`{"title":"Tanjungharjo camera moved","severity":"warning","area_ids":[3]}`,
+			`{"title":"New cameras next week","starts_at":"` + later + `"}`,
+		} {
+			if status, env := do("POST", "/admin/announcements", body, 1); status != 201 {
+				t.Fatalf("Expected status 201 for %s, got %d (%+v)", body, status, env.Error)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"title":"Outage","area_ids":[4]}`,
+			`{"title":"Outage","severity":"urgent"}`,
+			`{"title":"Outage","starts_at":"tomorrow"}`,
+			`{"title":"Outage","starts_at":"` + later + `","ends_at":"` + earlier + `"}`,
+		} {
+			if status, env := do("POST", "/admin/announcements", body, 1); status != 422 {
+				t.Errorf("Expected status 422 for %s, got %d (%+v)", body, status, env.Error)
+			}
+		}
+	})
+
+	t.Run("Active", func(t *testing.T) {
+		_, env := do("GET", "/announcements/active", "", 1)
+		if got := titles(env); len(got) != 3 || got[0] != "Dander cameras down due to fiber cut" || got[2] != "Maintenance tonight" {
+			t.Errorf("Expected the 3 started announcements, most severe first, got %v", got)
+		}
+		if created := env.Data.([]interface{})[0].(map[string]interface{})["created_by"]; created != nil {
+			t.Errorf("Expected no author on the public endpoint, got %v", created)
+		}
+
+		// RT 01 is in Dander
+		_, env = do("GET", "/announcements/active?area_id=2", "", 1)
+		if got := titles(env); len(got) != 2 || got[0] != "Dander cameras down due to fiber cut" {
+			t.Errorf("Expected the Dander and general announcements for RT 01, got %v", got)
+		}
+
+		_, env = do("GET", "/announcements/active", "", 2)
+		if got := titles(env); len(got) != 0 {
+			t.Errorf("Expected no announcements in another organization, got %v", got)
+		}
+	})
+
+	t.Run("End", func(t *testing.T) {
+		body := `{"title":"Maintenance tonight","starts_at":"` + earlier + `","ends_at":"` + now.Add(-time.Minute).Format(time.RFC3339) + `"}`
+		if status, env := do("PUT", "/admin/announcements/1", body, 1); status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+
+		_, env := do("GET", "/admin/announcements?state=ended", "", 1)
+		if got := titles(env); len(got) != 1 || got[0] != "Maintenance tonight" {
+			t.Errorf("Expected the ended announcement, got %v", got)
+		}
+		_, env = do("GET", "/admin/announcements?state=scheduled", "", 1)
+		if got := titles(env); len(got) != 1 || got[0] != "New cameras next week" {
+			t.Errorf("Expected the scheduled announcement, got %v", got)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if status, _ := do("DELETE", "/admin/announcements/2", "", 2); status != 404 {
+			t.Errorf("Expected status 404 from another organization, got %d", status)
+		}
+		if status, _ := do("DELETE", "/admin/announcements/2", "", 1); status != 200 {
+			t.Errorf("Expected status 200, got %d", status)
+		}
+		if status, _ := do("GET", "/admin/announcements/2", "", 1); status != 404 {
+			t.Errorf("Expected the announcement to be gone, got %d", status)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/anpr"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ANPRHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewANPRHandler(db *sql.DB, cfg *config.Config) *ANPRHandler {
+	return &ANPRHandler{db: db, cfg: cfg}
+}
+
+// ANPREventRequest is a plate read posted by an ANPR camera or box
+type ANPREventRequest struct {
+	CameraID    validate.FlexibleInt   `json:"camera_id" validate:"required,id"`
+	Plate       string                 `json:"plate" validate:"required,max=20"`
+	Confidence  validate.FlexibleFloat `json:"confidence" validate:"required,min=0,max=1"`
+	SnapshotURL string                 `json:"snapshot_url" validate:"max=2048"`
+	CapturedAt  string                 `json:"captured_at"` // RFC 3339; defaults to now
+}
+
+// IngestANPREvent - Store a plate read; authenticated with X-API-Key
+// rather than a user token, as it is posted by devices
+func (h *ANPRHandler) IngestANPREvent(c *fiber.Ctx) error {
+	key := h.cfg.ANPR.IngestKey
+	if key == "" {
+		return response.Fail(c, fiber.StatusServiceUnavailable, "ANPR ingest is not configured")
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Get("X-API-Key")), []byte(key)) != 1 {
+		return response.Fail(c, fiber.StatusUnauthorized, "Invalid API key")
+	}
+
+	var req ANPREventRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	if anpr.Normalize(req.Plate) == "" {
+		return invalidFields(c, "", map[string]string{"plate": "must contain letters or digits"})
+	}
+	var capturedAt time.Time
+	if req.CapturedAt != "" {
+		t, err := time.Parse(time.RFC3339, req.CapturedAt)
+		if err != nil {
+			return invalidFields(c, "", map[string]string{"captured_at": "must be an RFC 3339 time"})
+		}
+		capturedAt = t
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	e := &anpr.Event{
+		CameraID:    req.CameraID.Int,
+		Plate:       req.Plate,
+		Confidence:  req.Confidence.Float,
+		SnapshotURL: req.SnapshotURL,
+		Source:      anpr.SourceIngest,
+		CreatedAt:   capturedAt,
+	}
+	err := anpr.Record(ctx, h.db, e)
+	if errors.Is(err, anpr.ErrNotTraffic) {
+		return invalidFields(c, "", map[string]string{"camera_id": "Camera not found or not a traffic camera"})
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to store plate read")
+	}
+
+	return response.Created(c, "Plate read stored", e)
+}
+
+// GetANPREvents - Plate reads, newest first. Filters: plate (partial,
+// ignoring case, spaces and dashes), camera_id, min_confidence, and
+// from/to as RFC 3339 times or YYYY-MM-DD dates. ?cursor= switches to
+// keyset pagination.
+func (h *ANPRHandler) GetANPREvents(c *fiber.Ctx) error {
+	conds, args, msg := timeRange(c, "created_at")
+	if msg != "" {
+		return response.Fail(c, 400, msg)
+	}
+	if raw := c.Query("plate"); raw != "" {
+		plate := anpr.Normalize(raw)
+		if plate == "" {
+			return response.Fail(c, 400, "Invalid plate")
+		}
+		// Normalised plates are letters and digits, so hold no wildcards
+		conds = append(conds, "plate_normalized LIKE ?")
+		args = append(args, "%"+plate+"%")
+	}
+	if raw := c.Query("camera_id"); raw != "" {
+		id, err := validate.ID(raw)
+		if err != nil || id == nil {
+			return response.Fail(c, 400, "Invalid camera_id")
+		}
+		conds = append(conds, "camera_id = ?")
+		args = append(args, *id)
+	}
+	if raw := c.Query("min_confidence"); raw != "" {
+		min, err := validate.Float(raw)
+		if err != nil || min == nil || *min < 0 || *min > 1 {
+			return response.Fail(c, 400, "Invalid min_confidence, expected a number from 0 to 1")
+		}
+		conds = append(conds, "confidence >= ?")
+		args = append(args, *min)
+	}
+	conds = append(conds, "camera_id IN (SELECT id FROM cameras WHERE organization_id = ?)")
+	args = append(args, tenant.OrgID(c.UserContext()))
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	page, err := response.ParseKeyset(c, 50)
+	if err != nil {
+		return response.Fail(c, 400, "Invalid cursor")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	const columns = `
+		SELECT id, camera_id, plate, confidence, snapshot_url, detection_id, source, created_at
+		FROM anpr_events`
+	query, pageArgs := paginate(columns+where+`
+		ORDER BY created_at DESC, id DESC
+	`, append([]interface{}{}, args...), page)
+	if page.Keyset {
+		query, pageArgs = keyset(columns, where, append([]interface{}{}, args...), "id", page)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, pageArgs...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch plate reads")
+	}
+	defer rows.Close()
+
+	list := []anpr.Event{}
+	var ids []int64
+	for rows.Next() {
+		var e anpr.Event
+		var detectionID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.CameraID, &e.Plate, &e.Confidence, &e.SnapshotURL,
+			&detectionID, &e.Source, &e.CreatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read plate read", "error", err)
+			continue
+		}
+		if detectionID.Valid {
+			e.DetectionID = &detectionID.Int64
+		}
+		list = append(list, e)
+		ids = append(ids, e.ID)
+	}
+
+	if page.Keyset {
+		n, meta := keysetMeta(page, ids)
+		return response.Paginated(c, list[:n], meta)
+	}
+
+	total := countTotal(ctx, h.db, page, len(list), "SELECT COUNT(*) FROM anpr_events"+where, args...)
+
+	return response.Paginated(c, list, page.Meta(total))
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestANPRHandler(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, traffic) VALUES (1, 'Junction', 'rtsp://a', TRUE), (2, 'Gate', 'rtsp://b', FALSE)`)
+
+	cfg := &config.Config{ANPR: config.ANPRConfig{IngestKey: "device-key-0123456789"}}
+	h := NewANPRHandler(db, cfg)
+	app := fiber.New()
+	app.Post("/anpr/events", h.IngestANPREvent)
+	app.Get("/anpr/events", h.GetANPREvents)
+
+	do := func(method, path, key, body string) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	t.Run("Wrong key", func(t *testing.T) {
+		if status, _ := do("POST", "/anpr/events", "guess", `{"camera_id":1,"plate":"B 1234 XYZ","confidence":0.9}`); status != 401 {
+			t.Errorf("Expected status 401, got %d", status)
+		}
+	})
+
+	t.Run("Not a traffic camera", func(t *testing.T) {
+		status, env := do("POST", "/anpr/events", cfg.ANPR.IngestKey, `{"camera_id":2,"plate":"B 1234 XYZ","confidence":0.9}`)
+		if status != 422 || env.Error.Fields["camera_id"] == "" {
+			t.Errorf("Expected a 422 for camera_id, got %d (%+v)", status, env.Error)
+		}
+	})
+
+	t.Run("Ingest", func(t *testing.T) {
+		for _, body := range []string{
+			`{"camera_id":1,"plate":"B 1234 XYZ","confidence":0.9,"snapshot_url":"https://anpr.local/1.jpg","captured_at":"2026-03-10T08:00:00Z"}`,
+			`{"camera_id":"1","plate":"D 55 AB","confidence":"0.7"}`,
+		} {
+			if status, env := do("POST", "/anpr/events", cfg.ANPR.IngestKey, body); status != 201 {
+				t.Fatalf("Expected status 201, got %d (%+v)", status, env.Error)
+			}
+		}
+	})
+
+	t.Run("Partial plate search", func(t *testing.T) {
+		status, env := do("GET", "/anpr/events?plate=1234-xy", "", "")
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		list := env.Data.([]interface{})
+		if len(list) != 1 || list[0].(map[string]interface{})["plate"] != "B 1234 XYZ" {
+			t.Errorf("Expected the matching read, got %v", list)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/apikeys"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Quotas of a key created without them
+const (
+	defaultRequestsPerDay = 10000
+	defaultMaxStreams     = 4
+)
+
+// maxUsageDays is how far back GET /api/admin/api-keys/:id/usage goes
+const maxUsageDays = 90
+
+type APIKeyHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewAPIKeyHandler(db *sql.DB, cfg *config.Config) *APIKeyHandler {
+	return &APIKeyHandler{db: db, cfg: cfg}
+}
+
+// APIKeyRequest is the create/update body for an API key. Zero quotas
+// mean no limit; omitted ones are the defaults on create and unchanged
+// on update.
+type APIKeyRequest struct {
+	Name           string               `json:"name" validate:"required,max=100"`
+	RequestsPerDay validate.FlexibleInt `json:"requests_per_day" validate:"min=0,max=100000000"`
+	MaxStreams     validate.FlexibleInt `json:"max_streams" validate:"min=0,max=1000"`
+}
+
+// GetAPIKeys - API keys of the organization with their quotas and what
+// they used today
+func (h *APIKeyHandler) GetAPIKeys(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	today := apikeys.Day(time.Now())
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT k.id, k.name, k.requests_per_day, k.max_streams, k.created_at, k.updated_at,
+			COALESCE(u.requests, 0), COALESCE(u.refused, 0), COALESCE(u.streams_refused, 0)
+		FROM api_keys k
+		LEFT JOIN api_key_usage u ON u.api_key_id = k.id AND u.day = ?
+		WHERE k.organization_id = ?
+		ORDER BY k.name ASC, k.id ASC
+	`, today, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch API keys")
+	}
+	defer rows.Close()
+
+	list := []models.APIKey{}
+	for rows.Next() {
+		k := models.APIKey{Today: models.APIKeyUsage{Day: today}}
+		if err := rows.Scan(&k.ID, &k.Name, &k.RequestsPerDay, &k.MaxStreams, &k.CreatedAt, &k.UpdatedAt,
+			&k.Today.Requests, &k.Today.Refused, &k.Today.StreamsRefused); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read API key", "error", err)
+			continue
+		}
+		list = append(list, k)
+	}
+
+	return response.OK(c, list)
+}
+
+// CreateAPIKey - Add an API key. The response holds the key, which is
+// not shown again.
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var req APIKeyRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	key, hash, err := newKioskToken()
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create API key")
+	}
+
+	requests, streams := defaultRequestsPerDay, defaultMaxStreams
+	if req.RequestsPerDay.Set {
+		requests = req.RequestsPerDay.Int
+	}
+	if req.MaxStreams.Set {
+		streams = req.MaxStreams.Int
+	}
+
+	now := time.Now().UTC()
+	var id int64
+	err = h.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (organization_id, name, key_hash, requests_per_day, max_streams, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, tenant.OrgID(ctx), strings.TrimSpace(req.Name), hash, requests, streams, now, now).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create API key")
+	}
+
+	return response.Created(c, "API key created successfully", fiber.Map{
+		"id":  id,
+		"key": key,
+	})
+}
+
+// UpdateAPIKey - Rename an API key or change its quotas, which apply to
+// its next request
+func (h *APIKeyHandler) UpdateAPIKey(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "API key not found")
+	}
+
+	var req APIKeyRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE api_keys
+		SET name = ?,
+			requests_per_day = CASE WHEN ? THEN ? ELSE requests_per_day END,
+			max_streams = CASE WHEN ? THEN ? ELSE max_streams END,
+			updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, strings.TrimSpace(req.Name), req.RequestsPerDay.Set, req.RequestsPerDay.Int, req.MaxStreams.Set, req.MaxStreams.Int,
+		time.Now().UTC(), id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update API key")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "API key not found")
+	}
+
+	return response.Message(c, "API key updated successfully")
+}
+
+// DeleteAPIKey - Delete an API key; requests made with it are refused
+// from then on
+func (h *APIKeyHandler) DeleteAPIKey(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "API key not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete API key")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM api_keys WHERE id = ? AND organization_id = ?`, id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete API key")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "API key not found")
+	}
+	// The foreign key does the same where it is enforced
+	if _, err := tx.ExecContext(ctx, `DELETE FROM api_key_usage WHERE api_key_id = ?`, id); err != nil {
+		return serviceError(c, err, "", "Failed to delete API key")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to delete API key")
+	}
+
+	return response.Message(c, "API key deleted successfully")
+}
+
+// GetAPIKeyUsage - What an API key used on each of the last ?days=30
+// days (at most 90), most recent first; days without requests are left
+// out
+func (h *APIKeyHandler) GetAPIKeyUsage(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "API key not found")
+	}
+	days := c.QueryInt("days", 30)
+	if days < 1 || days > maxUsageDays {
+		return invalidFields(c, "", map[string]string{"days": "must be between 1 and 90"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var found int
+	err := h.db.QueryRowContext(ctx, `SELECT 1 FROM api_keys WHERE id = ? AND organization_id = ?`,
+		id, tenant.OrgID(ctx)).Scan(&found)
+	if err == sql.ErrNoRows {
+		return response.Fail(c, 404, "API key not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch API key usage")
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT day, requests, refused, streams_refused
+		FROM api_key_usage
+		WHERE api_key_id = ? AND day > ?
+		ORDER BY day DESC
+	`, id, apikeys.Day(time.Now().AddDate(0, 0, -days)))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch API key usage")
+	}
+	defer rows.Close()
+
+	list := []models.APIKeyUsage{}
+	for rows.Next() {
+		var u models.APIKeyUsage
+		if err := rows.Scan(&u.Day, &u.Requests, &u.Refused, &u.StreamsRefused); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read API key usage", "error", err)
+			continue
+		}
+		list = append(list, u)
+	}
+
+	return response.OK(c, list)
+}
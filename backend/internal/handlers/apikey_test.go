@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/apikeys"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAPIKeys(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (name, private_rtsp_url, stream_key) VALUES ('Gate', 'rtsp://a', 'gate'), ('Market', 'rtsp://b', 'market')`,
+	)
+
+	upstream := httptest.NewServer(nil)
+	upstream.Close()
+	cfg := &config.Config{Go2RTC: config.Go2RTCConfig{APIURL: upstream.URL, BreakerFailures: 100}}
+
+	h := NewAPIKeyHandler(db, cfg)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Use(middleware.APIKey(apikeys.New(db), func(c *fiber.Ctx) bool { return !strings.HasPrefix(c.Path(), "/hls/") }))
+	app.Get("/admin/api-keys", h.GetAPIKeys)
+	app.Get("/admin/api-keys/:id/usage", h.GetAPIKeyUsage)
+	app.Post("/admin/api-keys", h.CreateAPIKey)
+	app.Put("/admin/api-keys/:id", h.UpdateAPIKey)
+	app.Delete("/admin/api-keys/:id", h.DeleteAPIKey)
+	app.Get("/hls/:streamKey/*", NewStreamHandler(db, cfg, nil, nil, context.Background()).ProxyHLS)
+
+	do := func(method, path, body string, org int, key string) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	status, env := do("POST", "/admin/api-keys", `{"name":"Partner","requests_per_day":3,"max_streams":1}`, 1, "")
+	if status != 201 {
+		t.Fatalf("Expected status 201, got %d (%+v)", status, env.Error)
+	}
+	key := env.Data.(map[string]interface{})["key"].(string)
+
+	t.Run("Defaults", func(t *testing.T) {
+		if status, _ := do("POST", "/admin/api-keys", `{"name":"Other"}`, 2, ""); status != 201 {
+			t.Fatalf("Expected status 201, got %d", status)
+		}
+		_, env := do("GET", "/admin/api-keys", "", 2, "")
+		list := env.Data.([]interface{})
+		if len(list) != 1 {
+			t.Fatalf("Expected only the organization's key, got %v", list)
+		}
+		if k := list[0].(map[string]interface{}); k["requests_per_day"] != float64(10000) || k["max_streams"] != float64(4) {
+			t.Errorf("Expected the default quotas, got %v", k)
+		}
+		if status, _ := do("POST", "/admin/api-keys", `{"name":"","max_streams":-1}`, 1, ""); status != 422 {
+			t.Errorf("Expected status 422, got %d", status)
+		}
+	})
+
+	t.Run("Streams", func(t *testing.T) {
+		if status, _ := do("GET", "/hls/gate/index.m3u8", "", 1, key); status != 502 {
+			t.Errorf("Expected the key's first stream to reach the stream server, got %d", status)
+		}
+		if status, _ := do("GET", "/hls/market/index.m3u8", "", 1, key); status != 429 {
+			t.Errorf("Expected a second stream over the key's limit refused, got %d", status)
+		}
+		if status, _ := do("GET", "/hls/market/index.m3u8", "", 1, ""); status != 502 {
+			t.Errorf("Expected the stream without the key to play, got %d", status)
+		}
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			do("GET", "/admin/api-keys/1/usage", "", 1, key)
+		}
+		_, env := do("GET", "/admin/api-keys", "", 1, "")
+		today := env.Data.([]interface{})[0].(map[string]interface{})["today"].(map[string]interface{})
+		if today["requests"] != float64(4) || today["refused"] != float64(1) || today["streams_refused"] != float64(1) {
+			t.Errorf("Expected 4 requests, 1 refused and 1 stream refused, got %v", today)
+		}
+		_, env = do("GET", "/admin/api-keys/1/usage", "", 1, "")
+		if days := env.Data.([]interface{}); len(days) != 1 {
+			t.Errorf("Expected one day of usage, got %v", days)
+		}
+		if status, _ := do("GET", "/admin/api-keys/1/usage?days=365", "", 1, ""); status != 422 {
+			t.Errorf("Expected status 422, got %d", status)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		if status, _ := do("PUT", "/admin/api-keys/1", `{"name":"Partner","requests_per_day":0}`, 1, ""); status != 200 {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		if status, _ := do("GET", "/admin/api-keys", "", 1, key); status != 200 {
+			t.Errorf("Expected no limit after the quota was lifted, got %d", status)
+		}
+		_, env := do("GET", "/admin/api-keys", "", 1, "")
+		if k := env.Data.([]interface{})[0].(map[string]interface{}); k["max_streams"] != float64(1) {
+			t.Errorf("Expected an omitted quota unchanged, got %v", k)
+		}
+	})
+
+	t.Run("Other organizations", func(t *testing.T) {
+		for _, method := range []string{"PUT", "DELETE"} {
+			if status, _ := do(method, "/admin/api-keys/1", `{"name":"Mine"}`, 2, ""); status != 404 {
+				t.Errorf("Expected status 404 for %s, got %d", method, status)
+			}
+		}
+		if status, _ := do("GET", "/admin/api-keys/1/usage", "", 2, ""); status != 404 {
+			t.Errorf("Expected status 404, got %d", status)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if status, _ := do("DELETE", "/admin/api-keys/1", "", 1, ""); status != 200 {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		if status, _ := do("GET", "/admin/api-keys", "", 1, key); status != 401 {
+			t.Errorf("Expected a deleted key refused, got %d", status)
+		}
+	})
+}
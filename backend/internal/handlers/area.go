@@ -1,10 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/geo"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -17,215 +26,632 @@ func NewAreaHandler(db *sql.DB, cfg *config.Config) *AreaHandler {
 	return &AreaHandler{db: db, cfg: cfg}
 }
 
+const areaSelect = `
+	SELECT a.id, a.name, COALESCE(a.slug, ''), COALESCE(a.description, ''), a.parent_id, COALESCE(a.level, ''),
+	       COALESCE(a.rt, ''), COALESCE(a.rw, ''), COALESCE(a.kelurahan, ''), COALESCE(a.kecamatan, ''),
+	       (SELECT COUNT(*) FROM cameras c WHERE c.area_id = a.id) AS camera_count,
+	       (SELECT COUNT(*) FROM cameras c WHERE c.area_id = a.id AND c.enabled = TRUE) AS active_camera_count,
+	       a.created_at, a.updated_at
+	FROM areas a
+`
+
+// AreaRequest is the create/update body for an area
+type AreaRequest struct {
+	Name        string               `json:"name" validate:"required,max=100"`
+	Slug        string               `json:"slug" validate:"max=100"` // made from the name when a new area has none; kept when an update has none
+	Description string               `json:"description" validate:"max=1000"`
+	ParentID    validate.FlexibleInt `json:"parent_id" validate:"id"`
+	Level       string               `json:"level"`
+	RT          string               `json:"rt"`
+	RW          string               `json:"rw"`
+	Kelurahan   string               `json:"kelurahan"`
+	Kecamatan   string               `json:"kecamatan"`
+
+	// Omitted keeps the current boundary, null clears it
+	Boundary json.RawMessage `json:"boundary"`
+}
+
+// parseBoundary validates the request boundary. set is false when the
+// field was omitted; value is nil when the boundary should be cleared.
+func (r *AreaRequest) parseBoundary() (value *string, set bool, err error) {
+	if len(r.Boundary) == 0 {
+		return nil, false, nil
+	}
+	if string(r.Boundary) == "null" {
+		return nil, true, nil
+	}
+
+	boundary, err := geo.ParseBoundary(r.Boundary)
+	if err != nil {
+		return nil, true, err
+	}
+
+	normalized, err := json.Marshal(boundary)
+	if err != nil {
+		return nil, true, err
+	}
+	str := string(normalized)
+	return &str, true, nil
+}
+
+func scanArea(scanner interface{ Scan(...any) error }) (*models.Area, error) {
+	var area models.Area
+	var parentID sql.NullInt64
+
+	err := scanner.Scan(
+		&area.ID, &area.Name, &area.Slug, &area.Description, &parentID, &area.Level,
+		&area.RT, &area.RW, &area.Kelurahan, &area.Kecamatan,
+		&area.CameraCount, &area.ActiveCameraCount, &area.CreatedAt, &area.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		area.ParentID = &id
+	}
+
+	return &area, nil
+}
+
+func (h *AreaHandler) listAreas(ctx context.Context, page response.Page) ([]*models.Area, error) {
+	query, args := paginate(areaSelect+" WHERE a.organization_id = ? ORDER BY a.name ASC",
+		[]interface{}{tenant.OrgID(ctx)}, page)
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	areas := []*models.Area{}
+	for rows.Next() {
+		area, err := scanArea(rows)
+		if err != nil {
+			continue
+		}
+		areas = append(areas, area)
+	}
+
+	return areas, nil
+}
+
 // GetAllAreas - Get all areas
 func (h *AreaHandler) GetAllAreas(c *fiber.Ctx) error {
-	rows, err := h.db.Query(`
-		SELECT id, name, description, rt, rw, kelurahan, kecamatan, created_at
-		FROM areas
-		ORDER BY name ASC
-	`)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch areas",
-		})
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	page := response.ParsePage(c, 0)
+	areas, err := h.listAreas(ctx, page)
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch areas")
+	}
+
+	total := countTotal(ctx, h.db, page, len(areas), "SELECT COUNT(*) FROM areas WHERE organization_id = ?",
+		tenant.OrgID(ctx))
+
+	return response.Paginated(c, areas, page.Meta(total))
+}
+
+// GetAreaTree - Get areas nested by parent with subtree camera counts
+func (h *AreaHandler) GetAreaTree(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	areas, err := h.listAreas(ctx, response.Page{})
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch areas")
+	}
+
+	return response.OK(c, models.BuildAreaTree(areas))
+}
+
+// GetAreasGeoJSON - Get area boundaries as a FeatureCollection (public)
+func (h *AreaHandler) GetAreasGeoJSON(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT a.id, a.name, a.parent_id, COALESCE(a.level, ''), a.boundary,
+		       (SELECT COUNT(*) FROM cameras c WHERE c.area_id = a.id) AS camera_count,
+		       (SELECT COUNT(*) FROM cameras c WHERE c.area_id = a.id AND c.enabled = TRUE) AS active_camera_count
+		FROM areas a
+		WHERE a.boundary IS NOT NULL AND a.boundary != '' AND a.organization_id = ?
+		ORDER BY a.name ASC
+	`, tenant.OrgID(ctx))
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch area boundaries")
 	}
 	defer rows.Close()
 
-	areas := []map[string]interface{}{}
+	features := []map[string]interface{}{}
 	for rows.Next() {
-		var id int
-		var name, description, rt, rw, kelurahan, kecamatan string
-		var createdAt time.Time
+		var id, cameraCount, activeCameraCount int
+		var name, level, boundary string
+		var parentID sql.NullInt64
 
-		err := rows.Scan(&id, &name, &description, &rt, &rw, &kelurahan, &kecamatan, &createdAt)
+		err := rows.Scan(&id, &name, &parentID, &level, &boundary, &cameraCount, &activeCameraCount)
 		if err != nil {
 			continue
 		}
 
-		areas = append(areas, map[string]interface{}{
-			"id":          id,
-			"name":        name,
-			"description": description,
-			"rt":          rt,
-			"rw":          rw,
-			"kelurahan":   kelurahan,
-			"kecamatan":   kecamatan,
-			"created_at":  createdAt,
+		properties := map[string]interface{}{
+			"id":                  id,
+			"name":                name,
+			"level":               level,
+			"camera_count":        cameraCount,
+			"active_camera_count": activeCameraCount,
+		}
+		if parentID.Valid {
+			properties["parent_id"] = parentID.Int64
+		}
+
+		features = append(features, map[string]interface{}{
+			"type":       "Feature",
+			"id":         id,
+			"geometry":   json.RawMessage(boundary),
+			"properties": properties,
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    areas,
-	})
+	return c.JSON(map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": features,
+	}, "application/geo+json")
 }
 
 // GetArea - Get single area by ID
 func (h *AreaHandler) GetArea(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	id := c.Params("id")
 
-	var areaID int
-	var name, description string
-	var createdAt, updatedAt time.Time
+	area, err := scanArea(h.db.QueryRowContext(ctx, areaSelect+" WHERE a.id = ? AND a.organization_id = ?",
+		id, tenant.OrgID(ctx)))
+
+	if err == sql.ErrNoRows {
+		return response.Fail(c, 404, "Area not found")
+	}
+
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch area")
+	}
+
+	var boundary sql.NullString
+	h.db.QueryRowContext(ctx, "SELECT boundary FROM areas WHERE id = ?", area.ID).Scan(&boundary)
+	if boundary.Valid && boundary.String != "" {
+		area.Boundary = json.RawMessage(boundary.String)
+	}
+
+	// Direct children for drill-down navigation
+	children := []*models.Area{}
+	rows, err := h.db.QueryContext(ctx, areaSelect+" WHERE a.parent_id = ? ORDER BY a.name ASC", area.ID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			child, err := scanArea(rows)
+			if err != nil {
+				continue
+			}
+			children = append(children, child)
+		}
+	}
+	area.Children = children
+
+	return response.OK(c, area)
+}
+
+// areaSubtree selects an area plus all descendants, so a kecamatan
+// includes its kelurahan and RTs
+const areaSubtree = `
+	WITH RECURSIVE subtree(id) AS (
+		SELECT id FROM areas WHERE id = ?
+		UNION ALL
+		SELECT a.id FROM areas a JOIN subtree s ON a.parent_id = s.id
+	)
+`
+
+// areaStatsRanges maps the accepted ?range= values to lookback windows
+var areaStatsRanges = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
 
-	err := h.db.QueryRow(`
-		SELECT id, name, description, created_at, updated_at
-		FROM areas WHERE id = ?
-	`, id).Scan(&areaID, &name, &description, &createdAt, &updatedAt)
+// GetAreaStats - Get camera and viewer statistics for an area and its
+// sub-areas. An enabled camera counts as online unless its last health
+// check failed, as on the status and area pages.
+func (h *AreaHandler) GetAreaStats(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.Fail(c, 400, "Invalid area ID")
+	}
 
+	rangeKey := c.Query("range", "7d")
+	window, ok := areaStatsRanges[rangeKey]
+	if !ok {
+		return response.Fail(c, 400, "Invalid range, expected one of 24h, 7d, 30d, 90d")
+	}
+	limit := c.QueryInt("limit", 5)
+	if limit < 1 || limit > 50 {
+		limit = 5
+	}
+
+	var name string
+	err = h.db.QueryRowContext(ctx, "SELECT name FROM areas WHERE id = ? AND organization_id = ?",
+		id, tenant.OrgID(ctx)).Scan(&name)
 	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Area not found",
-		})
+		return response.Fail(c, 404, "Area not found")
 	}
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch area")
+	}
+
+	since := time.Now().UTC().Add(-window)
 
+	var total, online int
+	err = h.db.QueryRowContext(ctx, areaSubtree+`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN c.enabled = TRUE AND COALESCE(hc.status, '') != 'offline' THEN 1 ELSE 0 END), 0)
+		FROM cameras c
+		LEFT JOIN camera_health hc ON hc.camera_id = c.id
+		WHERE c.area_id IN (SELECT id FROM subtree)
+	`, id).Scan(&total, &online)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch area",
-		})
+		return response.Fail(c, 500, "Failed to fetch area statistics")
+	}
+
+	var sessions, uniqueViewers, activeViewers int
+	err = h.db.QueryRowContext(ctx, areaSubtree+`
+		SELECT COUNT(*), COUNT(DISTINCT `+viewerKey("vs")+`),
+		       COALESCE(SUM(CASE WHEN vs.ended_at IS NULL THEN 1 ELSE 0 END), 0)
+		FROM viewer_sessions vs
+		JOIN cameras c ON c.id = vs.camera_id
+		WHERE c.area_id IN (SELECT id FROM subtree) AND vs.started_at >= ?
+	`, id, since).Scan(&sessions, &uniqueViewers, &activeViewers)
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch area statistics")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": map[string]interface{}{
-			"id":          areaID,
-			"name":        name,
-			"description": description,
-			"created_at":  createdAt,
-			"updated_at":  updatedAt,
+	topCameras := []map[string]interface{}{}
+	rows, err := h.db.QueryContext(ctx, areaSubtree+`
+		SELECT c.id, c.name, c.enabled, COUNT(vs.id) AS sessions,
+		       COUNT(DISTINCT `+viewerKey("vs")+`) AS unique_viewers
+		FROM cameras c
+		LEFT JOIN viewer_sessions vs ON vs.camera_id = c.id AND vs.started_at >= ?
+		WHERE c.area_id IN (SELECT id FROM subtree)
+		GROUP BY c.id, c.name, c.enabled
+		ORDER BY sessions DESC, c.name ASC
+		LIMIT ?
+	`, id, since, limit)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var cameraID, cameraSessions, cameraViewers int
+			var cameraName string
+			var enabled bool
+			if err := rows.Scan(&cameraID, &cameraName, &enabled, &cameraSessions, &cameraViewers); err != nil {
+				continue
+			}
+			topCameras = append(topCameras, map[string]interface{}{
+				"id":             cameraID,
+				"name":           cameraName,
+				"enabled":        enabled,
+				"sessions":       cameraSessions,
+				"unique_viewers": cameraViewers,
+			})
+		}
+	}
+
+	return response.OK(c, fiber.Map{
+		"area_id": id,
+		"name":    name,
+		"range":   rangeKey,
+		"cameras": fiber.Map{
+			"total":   total,
+			"online":  online,
+			"offline": total - online,
+		},
+		"viewers": fiber.Map{
+			"sessions":       sessions,
+			"unique_viewers": uniqueViewers,
+			"active_now":     activeViewers,
 		},
+		"top_cameras": topCameras,
 	})
 }
 
 // CreateArea - Create new area
 func (h *AreaHandler) CreateArea(c *fiber.Ctx) error {
-	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var req AreaRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
+	parentID := req.ParentID.ID()
+	if field, msg := h.validateAreaRequest(ctx, &req, parentID, 0); msg != "" {
+		return invalidFields(c, msg, map[string]string{field: msg})
 	}
 
-	if req.Name == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Area name is required",
-		})
+	boundary, _, err := req.parseBoundary()
+	if err != nil {
+		return response.Fail(c, 400, "Invalid boundary: "+err.Error())
 	}
 
-	result, err := h.db.Exec(`
-		INSERT INTO areas (name, description, updated_at)
-		VALUES (?, ?, ?)
-	`, req.Name, req.Description, time.Now())
+	if req.Slug == "" {
+		if req.Slug, err = h.freeSlug(ctx, models.AreaSlug(req.Name)); err != nil {
+			return response.Fail(c, 500, "Failed to create area")
+		}
+	}
+
+	var id int64
+	err = h.db.QueryRowContext(ctx, `
+		INSERT INTO areas (name, slug, description, parent_id, level, rt, rw, kelurahan, kecamatan, boundary,
+		                   organization_id, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, req.Name, req.Slug, req.Description, parentID, req.Level, req.RT, req.RW,
+		req.Kelurahan, req.Kecamatan, boundary, tenant.OrgID(ctx), time.Now()).Scan(&id)
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to create area",
-		})
+		return response.Fail(c, 500, "Failed to create area")
 	}
 
-	id, _ := result.LastInsertId()
-
-	return c.Status(201).JSON(fiber.Map{
-		"success": true,
-		"message": "Area created successfully",
-		"data": fiber.Map{
-			"id": id,
-		},
+	return response.Created(c, "Area created successfully", fiber.Map{
+		"id":   id,
+		"slug": req.Slug,
 	})
 }
 
 // UpdateArea - Update existing area
 func (h *AreaHandler) UpdateArea(c *fiber.Ctx) error {
-	id := c.Params("id")
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.Fail(c, 400, "Invalid area ID")
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
+	var req AreaRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
 	}
 
-	result, err := h.db.Exec(`
-		UPDATE areas 
-		SET name = ?, description = ?, updated_at = ?
-		WHERE id = ?
-	`, req.Name, req.Description, time.Now(), id)
+	parentID := req.ParentID.ID()
+	if field, msg := h.validateAreaRequest(ctx, &req, parentID, id); msg != "" {
+		return invalidFields(c, msg, map[string]string{field: msg})
+	}
 
+	boundary, boundarySet, err := req.parseBoundary()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to update area",
-		})
+		return response.Fail(c, 400, "Invalid boundary: "+err.Error())
+	}
+
+	query := `
+		UPDATE areas
+		SET name = ?, description = ?, parent_id = ?, level = ?, rt = ?, rw = ?,
+		    kelurahan = ?, kecamatan = ?, updated_at = ?`
+	args := []interface{}{req.Name, req.Description, parentID, req.Level, req.RT, req.RW,
+		req.Kelurahan, req.Kecamatan, time.Now()}
+	if boundarySet {
+		query += ", boundary = ?"
+		args = append(args, boundary)
+	}
+	if req.Slug != "" {
+		query += ", slug = ?"
+		args = append(args, req.Slug)
+	}
+	query += " WHERE id = ? AND organization_id = ?"
+	args = append(args, id, tenant.OrgID(ctx))
+
+	result, err := h.db.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return response.Fail(c, 500, "Failed to update area")
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Area not found",
-		})
+		return response.Fail(c, 404, "Area not found")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Area updated successfully",
-	})
+	return response.Message(c, "Area updated successfully")
 }
 
-// DeleteArea - Delete area
+// DeleteArea - Delete area. Cameras in the area block deletion unless
+// ?reassign_to=<areaId> moves them or ?mode=detach clears their area.
+// Child areas are moved up to the deleted area's parent.
 func (h *AreaHandler) DeleteArea(c *fiber.Ctx) error {
-	id := c.Params("id")
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return response.Fail(c, 400, "Invalid area ID")
+	}
+
+	mode := c.Query("mode", "")
+	var reassignTo *int
+	if raw := c.Query("reassign_to"); raw != "" {
+		reassignTo, err = validate.ID(raw)
+		if err != nil || reassignTo == nil {
+			return response.Fail(c, 400, "Invalid reassign_to area ID")
+		}
+		if *reassignTo == id {
+			return response.Fail(c, 400, "Cannot reassign cameras to the area being deleted")
+		}
+		mode = "reassign"
+	}
+	if mode != "" && mode != "reassign" && mode != "detach" {
+		return response.Fail(c, 400, "Invalid mode, expected detach or reassign_to=<areaId>")
+	}
+	if mode == "reassign" && reassignTo == nil {
+		return response.Fail(c, 400, "mode=reassign needs reassign_to=<areaId>")
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return response.Fail(c, 500, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT parent_id FROM areas WHERE id = ? AND organization_id = ?",
+		id, tenant.OrgID(ctx)).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		return response.Fail(c, 404, "Area not found")
+	}
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch area")
+	}
 
 	// Check if area has cameras
 	var count int
-	err := h.db.QueryRow("SELECT COUNT(*) FROM cameras WHERE area_id = ?", id).Scan(&count)
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM cameras WHERE area_id = ?", id).Scan(&count)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to check area usage",
+		return response.Fail(c, 500, "Failed to check area usage")
+	}
+
+	if count > 0 && mode == "" {
+		message := "Cannot delete area with associated cameras; use ?reassign_to=<areaId> or ?mode=detach"
+		return c.Status(400).JSON(response.Envelope{
+			Success: false,
+			Message: message,
+			Data:    fiber.Map{"camera_count": count},
+			Error:   response.NewError(400, message),
 		})
 	}
 
+	if reassignTo != nil {
+		var exists int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM areas WHERE id = ? AND organization_id = ?",
+			*reassignTo, tenant.OrgID(ctx)).Scan(&exists)
+		if err != nil {
+			return response.Fail(c, 500, "Failed to fetch target area")
+		}
+		if exists == 0 {
+			return response.Fail(c, 400, "Target area not found")
+		}
+	}
+
+	var movedCameras int64
 	if count > 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Cannot delete area with associated cameras",
-		})
+		result, err := tx.ExecContext(ctx, "UPDATE cameras SET area_id = ?, updated_at = ? WHERE area_id = ?",
+			reassignTo, time.Now(), id)
+		if err != nil {
+			return response.Fail(c, 500, "Failed to move cameras")
+		}
+		movedCameras, _ = result.RowsAffected()
 	}
 
-	result, err := h.db.Exec("DELETE FROM areas WHERE id = ?", id)
+	var newParent *int64
+	if parentID.Valid {
+		newParent = &parentID.Int64
+	}
+	result, err := tx.ExecContext(ctx, "UPDATE areas SET parent_id = ?, updated_at = ? WHERE parent_id = ?",
+		newParent, time.Now(), id)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to delete area",
-		})
+		return response.Fail(c, 500, "Failed to move child areas")
 	}
+	movedChildren, _ := result.RowsAffected()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Area not found",
-		})
+	if _, err := tx.ExecContext(ctx, "DELETE FROM areas WHERE id = ?", id); err != nil {
+		return response.Fail(c, 500, "Failed to delete area")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return response.Fail(c, 500, "Failed to commit transaction")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Area deleted successfully",
+	return c.JSON(response.Envelope{
+		Success: true,
+		Message: "Area deleted successfully",
+		Data: fiber.Map{
+			"cameras_moved":  movedCameras,
+			"cameras_target": reassignTo,
+			"children_moved": movedChildren,
+		},
 	})
 }
+
+// freeSlug returns base, or base numbered from 2 when another area of
+// the organization has it
+func (h *AreaHandler) freeSlug(ctx context.Context, base string) (string, error) {
+	slug := base
+	for n := 2; ; n++ {
+		var taken int
+		err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM areas WHERE slug = ? AND organization_id = ?",
+			slug, tenant.OrgID(ctx)).Scan(&taken)
+		if err != nil || taken == 0 {
+			return slug, err
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// validateAreaRequest checks the level, slug and parent of an area and
+// normalises the slug. areaID is 0 for new areas. Returns the invalid
+// field and a message, or "" when the request is valid.
+func (h *AreaHandler) validateAreaRequest(ctx context.Context, req *AreaRequest, parentID *int, areaID int) (string, string) {
+	if !models.IsValidAreaLevel(req.Level) {
+		return "level", fmt.Sprintf("Invalid level, expected one of %v", models.AreaLevels)
+	}
+
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if req.Slug != "" {
+		if !slugPattern.MatchString(req.Slug) {
+			return "slug", "Slug must be lower case letters, digits and dashes"
+		}
+		var taken int
+		err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM areas WHERE slug = ? AND organization_id = ? AND id <> ?",
+			req.Slug, tenant.OrgID(ctx), areaID).Scan(&taken)
+		if err != nil {
+			return "slug", "Failed to validate slug"
+		}
+		if taken > 0 {
+			return "slug", "Slug is already used by another area"
+		}
+	}
+
+	if parentID == nil {
+		return "", ""
+	}
+
+	if *parentID == areaID {
+		return "parent_id", "Area cannot be its own parent"
+	}
+
+	// Walk up from the new parent; reaching areaID would create a cycle
+	current := *parentID
+	for depth := 0; depth < 32; depth++ {
+		var next sql.NullInt64
+		err := h.db.QueryRowContext(ctx, "SELECT parent_id FROM areas WHERE id = ? AND organization_id = ?",
+			current, tenant.OrgID(ctx)).Scan(&next)
+		if err == sql.ErrNoRows {
+			if current == *parentID {
+				return "parent_id", "Parent area not found"
+			}
+			return "", ""
+		}
+		if err != nil {
+			return "parent_id", "Failed to validate parent area"
+		}
+		if !next.Valid {
+			return "", ""
+		}
+		current = int(next.Int64)
+		if areaID != 0 && current == areaID {
+			return "parent_id", "Parent area cannot be a descendant of this area"
+		}
+	}
+
+	return "parent_id", "Area hierarchy is too deep"
+}
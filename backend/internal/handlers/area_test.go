@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDeleteAreaReassign(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		`INSERT INTO areas (id, name) VALUES (1, 'RT 01'), (2, 'RT 02')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, area_id) VALUES (1, 'Gate', 'rtsp://a', 'gate', 1)`,
+	)
+
+	h := NewAreaHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Delete("/areas/:id", h.DeleteArea)
+	del := func(path string) int {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("DELETE", path, nil), -1)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+	areaOf := func() (area *int) {
+		db.QueryRow(`SELECT area_id FROM cameras WHERE id = 1`).Scan(&area)
+		return area
+	}
+
+	if status := del("/areas/1?mode=reassign"); status != 400 {
+		t.Errorf("Expected 400 for mode=reassign without reassign_to, got %d", status)
+	}
+	if status := del("/areas/1?reassign_to=9"); status != 400 {
+		t.Errorf("Expected 400 for a missing target area, got %d", status)
+	}
+	if area := areaOf(); area == nil || *area != 1 {
+		t.Fatalf("Expected the camera left in its area, got %v", area)
+	}
+
+	if status := del("/areas/1?reassign_to=2"); status != 200 {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if area := areaOf(); area == nil || *area != 2 {
+		t.Errorf("Expected the camera moved to area 2, got %v", area)
+	}
+}
+
+func TestAreaStatsOnline(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		`INSERT INTO areas (id, name) VALUES (1, 'RT 01')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, area_id, enabled) VALUES
+			(1, 'Gate', 'rtsp://a', 'gate', 1, TRUE), (2, 'Yard', 'rtsp://b', 'yard', 1, TRUE),
+			(3, 'Dock', 'rtsp://c', 'dock', 1, TRUE), (4, 'Shed', 'rtsp://d', 'shed', 1, FALSE)`,
+		`INSERT INTO camera_health (camera_id, status) VALUES (1, 'online'), (2, 'offline'), (4, 'online')`,
+	)
+
+	h := NewAreaHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Get("/areas/:id/stats", h.GetAreaStats)
+	resp, err := app.Test(httptest.NewRequest("GET", "/areas/1/stats", nil), -1)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var env struct {
+		Data struct {
+			Cameras struct{ Total, Online, Offline int } `json:"cameras"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&env)
+	// Camera 3 has not been checked yet; camera 4 is disabled
+	if got := env.Data.Cameras; got.Total != 4 || got.Online != 2 || got.Offline != 2 {
+		t.Errorf("Expected 2 of 4 cameras online, got %+v", got)
+	}
+}
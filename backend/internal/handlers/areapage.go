@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPublicArea - The public page of an area by its slug: description,
+// the enabled cameras in it and its sub-areas with thumbnails, how many
+// are online and watched now, and its active announcements
+func (h *AreaHandler) GetPublicArea(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	page := models.AreaPage{Children: []models.AreaLink{}}
+	var parentID sql.NullInt64
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id, slug, name, COALESCE(description, ''), COALESCE(level, ''), parent_id
+		FROM areas WHERE slug = ? AND organization_id = ?
+	`, strings.ToLower(c.Params("slug")), tenant.OrgID(ctx)).Scan(
+		&page.ID, &page.Slug, &page.Name, &page.Description, &page.Level, &parentID)
+	if err == sql.ErrNoRows {
+		return response.Fail(c, 404, "Area not found")
+	}
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch area")
+	}
+
+	if parentID.Valid {
+		var parent models.AreaLink
+		err := h.db.QueryRowContext(ctx, `SELECT id, COALESCE(slug, ''), name FROM areas WHERE id = ?`,
+			parentID.Int64).Scan(&parent.ID, &parent.Slug, &parent.Name)
+		if err != nil && err != sql.ErrNoRows {
+			return response.Fail(c, 500, "Failed to fetch area")
+		}
+		if err == nil {
+			page.Parent = &parent
+		}
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, COALESCE(slug, ''), name FROM areas WHERE parent_id = ? ORDER BY name ASC
+	`, page.ID)
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch area")
+	}
+	for rows.Next() {
+		var child models.AreaLink
+		if err := rows.Scan(&child.ID, &child.Slug, &child.Name); err != nil {
+			continue
+		}
+		page.Children = append(page.Children, child)
+	}
+	rows.Close()
+
+	page.Cameras, err = h.areaPageCameras(ctx, c, page.ID)
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch area cameras")
+	}
+	page.Online.Cameras = len(page.Cameras)
+	for _, camera := range page.Cameras {
+		if camera.Online {
+			page.Online.CamerasOnline++
+		}
+		page.Online.Viewers += camera.Viewers
+	}
+
+	page.Announcements, err = NewAnnouncementHandler(h.db, h.cfg).activeAnnouncements(ctx, c, &page.ID)
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch announcements")
+	}
+
+	return response.OK(c, page)
+}
+
+// areaPageCameras lists the enabled cameras in areaID and its sub-areas.
+// A camera counts as online unless its last health check failed.
+func (h *AreaHandler) areaPageCameras(ctx context.Context, c *fiber.Ctx, areaID int) ([]models.AreaPageCamera, error) {
+	rows, err := h.db.QueryContext(ctx, areaSubtree+`
+		SELECT c.id, c.name, COALESCE(c.description, ''), COALESCE(c.location, ''), COALESCE(c.group_name, ''),
+		       c.area_id, c.latitude, c.longitude, c.stream_key, a.name,
+		       COALESCE(hc.status, '') != 'offline',
+		       (SELECT COUNT(*) FROM viewer_sessions vs WHERE vs.camera_id = c.id AND vs.ended_at IS NULL)
+		FROM cameras c
+		LEFT JOIN areas a ON a.id = c.area_id
+		LEFT JOIN camera_health hc ON hc.camera_id = c.id
+		WHERE c.enabled = TRUE AND c.area_id IN (SELECT id FROM subtree)
+		ORDER BY c.name ASC, c.id ASC
+	`, areaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	baseURL := streamBaseURL(c, h.cfg)
+	cameras := []models.AreaPageCamera{}
+	for rows.Next() {
+		var camera models.AreaPageCamera
+		err := rows.Scan(&camera.ID, &camera.Name, &camera.Description, &camera.Location,
+			&camera.GroupName, &camera.AreaID, &camera.Latitude, &camera.Longitude,
+			&camera.StreamKey, &camera.AreaName, &camera.Online, &camera.Viewers)
+		if err != nil {
+			return nil, err
+		}
+		camera.ThumbnailURL = fmt.Sprintf("%s/api/stream/%s/snapshot", baseURL, camera.StreamKey)
+		cameras = append(cameras, camera)
+	}
+	return cameras, rows.Err()
+}
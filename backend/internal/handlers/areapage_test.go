@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPublicArea(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO areas (id, name, slug, description, level, parent_id) VALUES
+			(1, 'Bojonegoro', 'bojonegoro', '', '', NULL),
+			(2, 'Dander', 'dander', 'Kecamatan Dander', 'kecamatan', 1),
+			(3, 'Ngunut', 'ngunut', '', 'kelurahan', 2),
+			(4, 'Kalitidu', 'kalitidu', '', 'kecamatan', 1)`,
+		`INSERT INTO areas (id, name, slug, organization_id) VALUES (5, 'Elsewhere', 'elsewhere', 2)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled, area_id) VALUES
+			(1, 'Market', 'rtsp://a', 'market', TRUE, 2), (2, 'Bridge', 'rtsp://b', 'bridge', TRUE, 3),
+			(3, 'Spare', 'rtsp://c', 'spare', FALSE, 2), (4, 'Square', 'rtsp://d', 'square', TRUE, 4)`,
+		`INSERT INTO camera_health (camera_id, status) VALUES (1, 'online'), (2, 'offline')`,
+		`INSERT INTO viewer_sessions (camera_id, session_id, started_at, ended_at) VALUES
+			(1, 'a', '2026-05-01 10:00:00', NULL), (1, 'b', '2026-05-01 10:00:00', NULL),
+			(1, 'c', '2026-05-01 09:00:00', '2026-05-01 09:30:00'), (4, 'd', '2026-05-01 10:00:00', NULL)`,
+		`INSERT INTO announcements (id, organization_id, title, severity, starts_at) VALUES
+			(1, 1, 'Everywhere', 'info', '2020-01-01 00:00:00'),
+			(2, 1, 'Ngunut road works', 'warning', '2020-01-01 00:00:00'),
+			(3, 1, 'Kalitidu only', 'info', '2020-01-01 00:00:00')`,
+		`INSERT INTO announcement_areas (announcement_id, area_id) VALUES (2, 3), (3, 4)`,
+	)
+
+	cfg := &config.Config{Go2RTC: config.Go2RTCConfig{PublicStreamBaseURL: "https://stream.example"}}
+	h := NewAreaHandler(db, cfg)
+	app := fiber.New()
+	app.Get("/public/areas/:slug", h.GetPublicArea)
+
+	get := func(slug string) (int, models.AreaPage) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/public/areas/"+slug, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data models.AreaPage `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+
+	status, page := get("Dander")
+	if status != 200 {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if page.ID != 2 || page.Description != "Kecamatan Dander" || page.Level != "kecamatan" {
+		t.Errorf("Expected the Dander area, got %+v", page)
+	}
+	if page.Parent == nil || page.Parent.Slug != "bojonegoro" || len(page.Children) != 1 || page.Children[0].Slug != "ngunut" {
+		t.Errorf("Expected links to the parent and child, got %+v and %+v", page.Parent, page.Children)
+	}
+
+	// The enabled cameras of the area and its kelurahan, by name
+	if len(page.Cameras) != 2 || page.Cameras[0].Name != "Bridge" || page.Cameras[1].Name != "Market" {
+		t.Fatalf("Expected the two enabled cameras, got %+v", page.Cameras)
+	}
+	if market := page.Cameras[1]; !market.Online || market.Viewers != 2 ||
+		market.ThumbnailURL != "https://stream.example/api/stream/market/snapshot" {
+		t.Errorf("Expected the market camera online with two viewers, got %+v", market)
+	}
+	if page.Cameras[0].Online {
+		t.Error("Expected the bridge camera offline")
+	}
+	if want := (models.AreaOnline{Cameras: 2, CamerasOnline: 1, Viewers: 2}); page.Online != want {
+		t.Errorf("Expected counts %+v, got %+v", want, page.Online)
+	}
+
+	var titles []string
+	for _, a := range page.Announcements {
+		titles = append(titles, a.Title)
+	}
+	if strings.Join(titles, ",") != "Everywhere" {
+		t.Errorf("Expected the announcement for everyone, got %v", titles)
+	}
+	if _, page := get("ngunut"); len(page.Announcements) != 2 || page.Announcements[0].Title != "Ngunut road works" {
+		t.Errorf("Expected the kelurahan's announcement first, got %+v", page.Announcements)
+	}
+
+	// Another organization's area is not found
+	if status, _ := get("elsewhere"); status != 404 {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+	if status, _ := get("missing"); status != 404 {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+}
+
+func TestAreaSlugs(t *testing.T) {
+	db := dbtest.Open(t)
+
+	h := NewAreaHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Post("/areas", h.CreateArea)
+	app.Put("/areas/:id", h.UpdateArea)
+
+	send := func(method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+
+	if status, data := send("POST", "/areas", `{"name": "RT 01 / RW 05"}`); status != 201 || data["slug"] != "rt-01-rw-05" {
+		t.Errorf("Expected a slug from the name, got %d %v", status, data)
+	}
+	if _, data := send("POST", "/areas", `{"name": "RT 01 - RW 05"}`); data["slug"] != "rt-01-rw-05-2" {
+		t.Errorf("Expected the slug numbered, got %v", data)
+	}
+	if status, _ := send("POST", "/areas", `{"name": "Other", "slug": "Not a slug!"}`); status != 422 {
+		t.Errorf("Expected status 422 for an invalid slug, got %d", status)
+	}
+	if status, _ := send("PUT", "/areas/2", `{"name": "RT 01 - RW 05", "slug": "rt-01-rw-05"}`); status != 422 {
+		t.Errorf("Expected status 422 for a slug in use, got %d", status)
+	}
+	if status, _ := send("PUT", "/areas/2", `{"name": "RT 01 - RW 05", "slug": "RT-01-RW-05-B"}`); status != 200 {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+	var slug string
+	db.QueryRow(`SELECT slug FROM areas WHERE id = 2`).Scan(&slug)
+	if slug != "rt-01-rw-05-b" {
+		t.Errorf("Expected the slug lower cased, got %q", slug)
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/abcdefak87/cctv/internal/cache"
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
 	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -22,41 +27,34 @@ func NewAuthHandler(db *sql.DB, cfg *config.Config) *AuthHandler {
 }
 
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	var req models.LoginRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
+	if ok, err := bind(c, &req); !ok {
+		return err
 	}
 	
 	// Get user from database
 	var user models.User
-	err := h.db.QueryRow(
-		"SELECT id, username, password_hash, role FROM users WHERE username = ?",
+	err := h.db.QueryRowContext(ctx,
+		"SELECT id, username, password_hash, role, organization_id FROM users WHERE username = ?",
 		req.Username,
-	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role)
+	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.OrganizationID)
 	
 	if err == sql.ErrNoRows {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid credentials",
-		})
+		publish(c, events.Event{Type: events.AuthLoginFailed, Data: map[string]interface{}{"username": req.Username}})
+		return response.Fail(c, fiber.StatusUnauthorized, "Invalid credentials")
 	}
 	
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Database error",
-		})
+		return response.Fail(c, fiber.StatusInternalServerError, "Database error")
 	}
 	
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid credentials",
-		})
+		publish(c, events.Event{Type: events.AuthLoginFailed, Data: map[string]interface{}{"username": req.Username}})
+		return response.Fail(c, fiber.StatusUnauthorized, "Invalid credentials")
 	}
 	
 	// Generate JWT token
@@ -64,16 +62,14 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		"user_id":  user.ID,
 		"username": user.Username,
 		"role":     user.Role,
+		"org_id":   user.OrganizationID,
 		"exp":      time.Now().Add(time.Hour * 24).Unix(),
 	}
 	
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(h.cfg.JWT.Secret))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to generate token",
-		})
+		return response.Fail(c, fiber.StatusInternalServerError, "Failed to generate token")
 	}
 	
 	// Set cookie
@@ -86,20 +82,38 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		MaxAge:   86400, // 24 hours
 	})
 	
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": fiber.Map{
-			"token": tokenString,
-			"user": fiber.Map{
-				"id":       user.ID,
-				"username": user.Username,
-				"role":     user.Role,
+	publish(c, events.Event{Type: events.AuthLogin, UserID: &user.ID, Data: map[string]interface{}{"username": user.Username}})
+	
+	return c.JSON(models.LoginResponse{
+		Success: true,
+		Token:   tokenString,
+		Data: &models.LoginData{
+			Token: tokenString,
+			User: models.LoginUser{
+				ID:             user.ID,
+				Username:       user.Username,
+				Role:           user.Role,
+				OrganizationID: user.OrganizationID,
 			},
 		},
 	})
 }
 
+// Logout clears the cookie and revokes the token, so a copy of it kept
+// elsewhere stops working before it expires
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	if token := requestToken(c); token != "" {
+		claims := &jwt.RegisteredClaims{}
+		parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+			return []byte(h.cfg.JWT.Secret), nil
+		})
+		if err == nil && parsed.Valid && claims.ExpiresAt != nil {
+			if err := cache.Revoke(c.UserContext(), cache.Shared(), token, claims.ExpiresAt.Time); err != nil {
+				logger.FromContext(c.UserContext()).Warn("Failed to revoke token", "error", err)
+			}
+		}
+	}
+
 	c.Cookie(&fiber.Cookie{
 		Name:     "token",
 		Value:    "",
@@ -107,6 +121,8 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 		MaxAge:   -1,
 	})
 	
+	publish(c, events.Event{Type: events.AuthLogout})
+	
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Logged out successfully",
@@ -121,9 +137,11 @@ func (h *AuthHandler) Verify(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"success": true,
 		"user": fiber.Map{
-			"id":       userID,
-			"username": username,
-			"role":     role,
+			"id":              userID,
+			"username":        username,
+			"role":            role,
+			"organization_id": c.Locals("org_id"),
+			"impersonator_id": c.Locals("impersonator_id"),
 		},
 	})
 }
@@ -142,22 +160,9 @@ func (h *AuthHandler) GetCSRF(c *fiber.Ctx) error {
 
 // RefreshToken - Refresh JWT token
 func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
-	// Get token from header or cookie
-	token := c.Get("Authorization")
-	if token == "" {
-		token = c.Cookies("token")
-	}
-
+	token := requestToken(c)
 	if token == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"success": false,
-			"message": "No token provided",
-		})
-	}
-
-	// Remove "Bearer " prefix if present
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
+		return response.Fail(c, fiber.StatusUnauthorized, "No token provided")
 	}
 
 	// Parse token
@@ -167,31 +172,40 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 	})
 
 	if err != nil || !parsedToken.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid token",
-		})
+		return response.Fail(c, fiber.StatusUnauthorized, "Invalid token")
+	}
+
+	// A logged out token must not buy a fresh one
+	if revoked, _ := cache.Revoked(c.UserContext(), cache.Shared(), token); revoked {
+		return response.Fail(c, fiber.StatusUnauthorized, "Token has been revoked")
+	}
+
+	// Impersonation ends when its token expires
+	if _, ok := (*claims)["impersonator_id"]; ok {
+		return response.Fail(c, fiber.StatusForbidden, "Impersonation tokens cannot be refreshed")
 	}
 
 	// Extract user info
 	userID := int((*claims)["user_id"].(float64))
 	username := (*claims)["username"].(string)
 	role := (*claims)["role"].(string)
+	orgID := tenant.DefaultOrgID // tokens from before organizations
+	if id, ok := (*claims)["org_id"].(float64); ok && id > 0 {
+		orgID = int(id)
+	}
 
 	// Generate new token
 	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id":  userID,
 		"username": username,
 		"role":     role,
+		"org_id":   orgID,
 		"exp":      time.Now().Add(24 * time.Hour).Unix(),
 	})
 
 	tokenString, err := newToken.SignedString([]byte(h.cfg.JWT.Secret))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to generate token",
-		})
+		return response.Fail(c, fiber.StatusInternalServerError, "Failed to generate token")
 	}
 
 	return c.JSON(fiber.Map{
@@ -199,3 +213,17 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 		"token":   tokenString,
 	})
 }
+
+// requestToken is the login token from the Authorization header or the
+// cookie
+func requestToken(c *fiber.Ctx) string {
+	token := c.Get("Authorization")
+	if token == "" {
+		token = c.Cookies("token")
+	}
+	// Remove "Bearer " prefix if present
+	if len(token) > 7 && token[:7] == "Bearer " {
+		token = token[7:]
+	}
+	return token
+}
@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/middleware"
 	"github.com/abcdefak87/cctv/internal/models"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -28,6 +31,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 			username TEXT UNIQUE NOT NULL,
 			password_hash TEXT NOT NULL,
 			role TEXT DEFAULT 'admin',
+			organization_id INTEGER NOT NULL DEFAULT 1,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)
 	`)
@@ -57,8 +61,8 @@ func TestAuthHandler_Login(t *testing.T) {
 	t.Run("Successful login", func(t *testing.T) {
 		// Create test user
 		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), 10)
-		_, err := db.Exec("INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?)",
-			"testuser", string(hashedPassword), "admin")
+		_, err := db.Exec("INSERT INTO users (username, password_hash, role, organization_id) VALUES (?, ?, ?, ?)",
+			"testuser", string(hashedPassword), "admin", 2)
 		if err != nil {
 			t.Fatalf("Failed to create test user: %v", err)
 		}
@@ -95,6 +99,13 @@ func TestAuthHandler_Login(t *testing.T) {
 			t.Error("Expected token to be present")
 		}
 
+		claims := &middleware.JWTClaims{}
+		if _, err := jwt.ParseWithClaims(response.Token, claims, func(*jwt.Token) (interface{}, error) {
+			return []byte("test-secret"), nil
+		}); err != nil || claims.OrgID != 2 {
+			t.Errorf("Expected the token to carry org 2, got %d (%v)", claims.OrgID, err)
+		}
+
 		// Cleanup
 		db.Exec("DELETE FROM users WHERE username = ?", "testuser")
 	})
@@ -221,6 +232,44 @@ func TestAuthHandler_Logout(t *testing.T) {
 			t.Error("Expected success to be true")
 		}
 	})
+
+	t.Run("Logged out token is refused", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.JWTClaims{
+			UserID:   1,
+			Username: "admin",
+			Role:     "admin",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}).SignedString([]byte(cfg.JWT.Secret))
+
+		app := fiber.New()
+		app.Post("/logout", handler.Logout)
+		app.Post("/refresh", handler.RefreshToken)
+		app.Get("/verify", middleware.AuthMiddleware(cfg.JWT.Secret), handler.Verify)
+		send := func(method, path string) int {
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			return resp.StatusCode
+		}
+
+		if status := send("GET", "/verify"); status != 200 {
+			t.Fatalf("Expected status 200 before logout, got %d", status)
+		}
+		if status := send("POST", "/logout"); status != 200 {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		if status := send("GET", "/verify"); status != 401 {
+			t.Errorf("Expected status 401 after logout, got %d", status)
+		}
+		if status := send("POST", "/refresh"); status != 401 {
+			t.Errorf("Expected a logged out token not to refresh, got %d", status)
+		}
+	})
 }
 
 func TestAuthHandler_Verify(t *testing.T) {
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// bind parses the request body into req and checks its validate tags.
+// When ok is false the 400 (unparsable body) or 422 (invalid fields)
+// response has been written and the handler should return err.
+func bind(c *fiber.Ctx, req interface{}) (ok bool, err error) {
+	if err := c.BodyParser(req); err != nil {
+		return false, response.Fail(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if errs := validate.Struct(req); errs != nil {
+		return false, invalidFields(c, "", errs)
+	}
+	return true, nil
+}
+
+// invalidFields writes the 422 response listing invalid fields. An empty
+// message is built from the fields, so clients that only show the
+// top-level message still say what is wrong.
+func invalidFields(c *fiber.Ctx, message string, fields map[string]string) error {
+	if message == "" {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = name + " " + fields[name]
+		}
+		message = "Validation failed: " + strings.Join(parts, "; ")
+	}
+	return response.FailFields(c, fiber.StatusUnprocessableEntity, message, fields)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBind(t *testing.T) {
+	app := fiber.New()
+	app.Post("/cameras", func(c *fiber.Ctx) error {
+		var req CameraRequest
+		if ok, err := bind(c, &req); !ok {
+			return err
+		}
+		return response.OK(c, req.input())
+	})
+
+	post := func(body string) (int, response.Envelope) {
+		req := httptest.NewRequest("POST", "/cameras", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	t.Run("Unparsable body", func(t *testing.T) {
+		if status, _ := post("{"); status != 400 {
+			t.Errorf("Expected status 400, got %d", status)
+		}
+	})
+
+	t.Run("Invalid fields", func(t *testing.T) {
+		status, env := post(`{"name":"","private_rtsp_url":"rtsp://cam/1","area_id":"abc","latitude":"95","enabled":"maybe"}`)
+		if status != 422 {
+			t.Fatalf("Expected status 422, got %d", status)
+		}
+		if env.Error == nil || env.Error.Code != "validation_failed" {
+			t.Fatalf("Expected validation_failed error, got %+v", env.Error)
+		}
+		for _, field := range []string{"name", "area_id", "latitude", "enabled"} {
+			if env.Error.Fields[field] == "" {
+				t.Errorf("Expected an error for %s, got %v", field, env.Error.Fields)
+			}
+		}
+	})
+
+	t.Run("Loose values are coerced", func(t *testing.T) {
+		status, env := post(`{"name":"Gate","private_rtsp_url":"rtsp://cam/1","area_id":"3","latitude":"-6.2","longitude":106.8,"enabled":1}`)
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		data := env.Data.(map[string]interface{})
+		if data["AreaID"] != float64(3) || data["Latitude"] != -6.2 || data["Enabled"] != true {
+			t.Errorf("Expected coerced input, got %v", data)
+		}
+	})
+}
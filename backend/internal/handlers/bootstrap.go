@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// bootstrapTTL bounds how long a change to any part of the bootstrap
+// takes to show on the public page, the same as browsers may reuse it
+const bootstrapTTL = 30 * time.Second
+
+// bootstrapCache holds each organization's bootstrap, which every
+// visitor of the public page fetches first
+var bootstrapCache = cache.NewGroup("bootstrap", bootstrapTTL)
+
+type BootstrapHandler struct {
+	cfg           *config.Config
+	settings      *SettingsHandler
+	areas         *AreaHandler
+	announcements *AnnouncementHandler
+}
+
+func NewBootstrapHandler(cfg *config.Config, settings *SettingsHandler, areas *AreaHandler, announcements *AnnouncementHandler) *BootstrapHandler {
+	return &BootstrapHandler{cfg: cfg, settings: settings, areas: areas, announcements: announcements}
+}
+
+// GetBootstrap - Branding, landing page settings, map center, areas,
+// active announcements and feature flags in one response, for the
+// public page's first load
+func (h *BootstrapHandler) GetBootstrap(c *fiber.Ctx) error {
+	branding := h.settings.Branding(c)
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var b models.Bootstrap
+	key := strconv.Itoa(tenant.OrgID(ctx))
+	err := bootstrapCache.Load(ctx, key, &b, func() error {
+		mapCenter, err := h.settings.mapCenter(ctx)
+		if err != nil {
+			return err
+		}
+		areas, err := h.areas.listAreas(ctx, response.Page{})
+		if err != nil {
+			return err
+		}
+		announcements, err := h.announcements.activeAnnouncements(ctx, c, nil)
+		if err != nil {
+			return err
+		}
+
+		saweria := saweriaConfig()
+		enabled, _ := saweria["enabled"].(bool)
+		b = models.Bootstrap{
+			LandingPage:   landingPage(),
+			MapCenter:     mapCenter,
+			Saweria:       saweria,
+			Areas:         areas,
+			Announcements: announcements,
+			Features: models.Features{
+				Weather:      h.cfg.Weather.APIKey != "",
+				Saweria:      enabled,
+				MultiviewMax: h.cfg.Stream().MultiviewMax,
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return serviceError(c, err, "", "Failed to load the public page")
+	}
+	// Branding has its own cache, invalidated as soon as it changes
+	b.Branding = branding
+	return response.OK(c, b)
+}
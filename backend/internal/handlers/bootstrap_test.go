@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBootstrap(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO areas (id, name) VALUES (1, 'Dander'), (2, 'Tanjungharjo')`,
+		`INSERT INTO areas (id, name, organization_id) VALUES (3, 'Elsewhere', 2)`,
+		`INSERT INTO settings (organization_id, key, value) VALUES
+			(1, 'company_name', 'Kota Dander'),
+			(2, 'map_default_center', '{"latitude": -7.2, "longitude": 112.1, "zoom": 15, "name": "Dander"}')`,
+		`INSERT INTO announcements (organization_id, title, severity, starts_at) VALUES
+			(1, 'Gate camera down', 'warning', '2020-01-01 00:00:00'), (1, 'Later', 'info', '2999-01-01 00:00:00')`,
+	)
+
+	cfg := &config.Config{Weather: config.WeatherConfig{APIKey: "key"}, Go2RTC: config.Go2RTCConfig{MultiviewMax: 16}}
+	h := NewBootstrapHandler(cfg, NewSettingsHandler(db, cfg), NewAreaHandler(db, cfg), NewAnnouncementHandler(db, cfg))
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/public/bootstrap", h.GetBootstrap)
+
+	get := func(org int) models.Bootstrap {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/public/bootstrap", nil)
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var env struct {
+			Data models.Bootstrap `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		return env.Data
+	}
+
+	b := get(1)
+	if b.Branding["company_name"] != "Kota Dander" || b.Branding["primary_color"] != "#0ea5e9" {
+		t.Errorf("Expected the branding over the defaults, got %v", b.Branding)
+	}
+	if b.MapCenter["name"] != "Bojonegoro" || b.LandingPage["section_title"] == nil {
+		t.Errorf("Expected the default map center and landing page, got %v and %v", b.MapCenter, b.LandingPage)
+	}
+	if len(b.Areas) != 2 || b.Areas[0].Name != "Dander" {
+		t.Errorf("Expected the organization's two areas, got %+v", b.Areas)
+	}
+	if len(b.Announcements) != 1 || b.Announcements[0].Title != "Gate camera down" || b.Announcements[0].CreatedBy != nil {
+		t.Errorf("Expected the one announcement up now, got %+v", b.Announcements)
+	}
+	if want := (models.Features{Weather: true, MultiviewMax: 16}); b.Features != want {
+		t.Errorf("Expected features %+v, got %+v", want, b.Features)
+	}
+
+	other := get(2)
+	if other.MapCenter["name"] != "Dander" || len(other.Areas) != 1 || len(other.Announcements) != 0 {
+		t.Errorf("Expected the second organization's own data, got %+v", other)
+	}
+	if other.Branding["company_name"] != "RAF NET" {
+		t.Errorf("Expected the default branding, got %v", other.Branding)
+	}
+}
@@ -1,431 +1,245 @@
 package handlers
 
 import (
-	"database/sql"
-	"fmt"
-	"strconv"
-	"time"
+	"strings"
 
 	"github.com/abcdefak87/cctv/internal/config"
 	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/service"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
 	"github.com/gofiber/fiber/v2"
 )
 
 type CameraHandler struct {
-	db  *sql.DB
-	cfg *config.Config
+	cameras service.CameraService
+	cfg     *config.Config
 }
 
-func NewCameraHandler(db *sql.DB, cfg *config.Config) *CameraHandler {
-	return &CameraHandler{db: db, cfg: cfg}
+func NewCameraHandler(cameras service.CameraService, cfg *config.Config) *CameraHandler {
+	return &CameraHandler{cameras: cameras, cfg: cfg}
 }
 
-// GetAllCameras - Get all cameras (admin only)
-func (h *CameraHandler) GetAllCameras(c *fiber.Ctx) error {
-	rows, err := h.db.Query(`
-		SELECT c.id, c.name, c.private_rtsp_url, c.description, c.location, 
-		       c.group_name, c.area_id, c.enabled, c.stream_key, 
-		       c.created_at, c.updated_at, a.name as area_name
-		FROM cameras c
-		LEFT JOIN areas a ON c.area_id = a.id
-		ORDER BY c.id ASC
-	`)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch cameras",
-		})
-	}
-	defer rows.Close()
-
-	cameras := []map[string]interface{}{}
-	for rows.Next() {
-		var camera models.Camera
-		var areaName sql.NullString
-		
-		err := rows.Scan(
-			&camera.ID, &camera.Name, &camera.PrivateRTSPURL, &camera.Description,
-			&camera.Location, &camera.GroupName, &camera.AreaID, &camera.Enabled,
-			&camera.StreamKey, &camera.CreatedAt, &camera.UpdatedAt, &areaName,
-		)
-		if err != nil {
-			continue
-		}
-
-		cameraMap := map[string]interface{}{
-			"id":               camera.ID,
-			"name":             camera.Name,
-			"private_rtsp_url": camera.PrivateRTSPURL,
-			"description":      camera.Description,
-			"location":         camera.Location,
-			"group_name":       camera.GroupName,
-			"area_id":          camera.AreaID,
-			"enabled":          camera.Enabled,
-			"stream_key":       camera.StreamKey,
-			"created_at":       camera.CreatedAt,
-			"updated_at":       camera.UpdatedAt,
-		}
-
-		if areaName.Valid {
-			cameraMap["area_name"] = areaName.String
-		}
-
-		cameras = append(cameras, cameraMap)
+// CameraRequest is the create/update body. The Flexible fields accept
+// the strings, numbers and nulls the admin panel sends.
+type CameraRequest struct {
+	Name           string                 `json:"name" validate:"required,max=100"`
+	PrivateRTSPURL string                 `json:"private_rtsp_url" validate:"required,max=2048"`
+	Description    string                 `json:"description" validate:"max=1000"`
+	Location       string                 `json:"location" validate:"max=255"`
+	GroupName      string                 `json:"group_name" validate:"max=100"`
+	AreaID         validate.FlexibleInt   `json:"area_id" validate:"id"`
+	Latitude       validate.FlexibleFloat `json:"latitude" validate:"min=-90,max=90"`
+	Longitude      validate.FlexibleFloat `json:"longitude" validate:"min=-180,max=180"`
+	Enabled        validate.FlexibleBool  `json:"enabled"`
+	Traffic        validate.FlexibleBool  `json:"traffic"`   // licence plate reads are kept
+	Watermark      validate.FlexibleBool  `json:"watermark"` // branding burned into the stream
+	Recording      validate.FlexibleBool  `json:"recording_enabled"`
+	StreamNode     string                 `json:"stream_node" validate:"max=50"` // empty for the local go2rtc
+}
+
+func (r *CameraRequest) input() service.CameraInput {
+	return service.CameraInput{
+		Name:           r.Name,
+		PrivateRTSPURL: r.PrivateRTSPURL,
+		Description:    r.Description,
+		Location:       r.Location,
+		GroupName:      r.GroupName,
+		AreaID:         r.AreaID.ID(),
+		Latitude:       r.Latitude.Ptr(),
+		Longitude:      r.Longitude.Ptr(),
+		Enabled:        r.Enabled.Bool,
+		Traffic:        r.Traffic.Bool,
+		Watermark:      r.Watermark.Bool,
+		Recording:      r.Recording.Bool,
+		StreamNode:     r.streamNode(),
 	}
+}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    cameras,
-	})
+// streamNode is the column value: NULL for the local go2rtc
+func (r *CameraRequest) streamNode() *string {
+	if r.StreamNode == "" {
+		return nil
+	}
+	return &r.StreamNode
 }
 
-// GetActiveCameras - Get only enabled cameras (public)
-func (h *CameraHandler) GetActiveCameras(c *fiber.Ctx) error {
-	rows, err := h.db.Query(`
-		SELECT c.id, c.name, c.description, c.location, c.group_name, 
-		       c.area_id, c.stream_key, a.name as area_name
-		FROM cameras c
-		LEFT JOIN areas a ON c.area_id = a.id
-		WHERE c.enabled = 1
-		ORDER BY c.id ASC
-	`)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch cameras",
-		})
+// checkStreamNode answers 422 when the request names a stream node that
+// is not in STREAM_NODES. When ok is false the response has been
+// written and the handler should return err.
+func (h *CameraHandler) checkStreamNode(c *fiber.Ctx, req *CameraRequest) (ok bool, err error) {
+	if req.StreamNode == "" {
+		return true, nil
 	}
-	defer rows.Close()
-
-	cameras := []map[string]interface{}{}
-	for rows.Next() {
-		var id int
-		var name, description, location, groupName, streamKey string
-		var areaID sql.NullInt64
-		var areaName sql.NullString
-
-		err := rows.Scan(&id, &name, &description, &location, &groupName, 
-			&areaID, &streamKey, &areaName)
-		if err != nil {
-			continue
-		}
-
-		cameraMap := map[string]interface{}{
-			"id":          id,
-			"name":        name,
-			"description": description,
-			"location":    location,
-			"group_name":  groupName,
-			"stream_key":  streamKey,
-		}
-
-		if areaID.Valid {
-			cameraMap["area_id"] = areaID.Int64
-		}
-		if areaName.Valid {
-			cameraMap["area_name"] = areaName.String
-		}
-
-		cameras = append(cameras, cameraMap)
+	if _, known := h.cfg.Stream().Node(req.StreamNode); known {
+		return true, nil
 	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    cameras,
-	})
+	var names []string
+	for _, node := range h.cfg.Stream().Nodes {
+		names = append(names, node.Name)
+	}
+	problem := "no stream nodes are configured"
+	if len(names) > 0 {
+		problem = "must be one of " + strings.Join(names, ", ")
+	}
+	return false, invalidFields(c, "", map[string]string{"stream_node": problem})
 }
 
-// GetCamera - Get single camera by ID
-func (h *CameraHandler) GetCamera(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	var camera models.Camera
-	var areaName sql.NullString
-
-	err := h.db.QueryRow(`
-		SELECT c.id, c.name, c.private_rtsp_url, c.description, c.location,
-		       c.group_name, c.area_id, c.enabled, c.stream_key,
-		       c.created_at, c.updated_at, a.name as area_name
-		FROM cameras c
-		LEFT JOIN areas a ON c.area_id = a.id
-		WHERE c.id = ?
-	`, id).Scan(
-		&camera.ID, &camera.Name, &camera.PrivateRTSPURL, &camera.Description,
-		&camera.Location, &camera.GroupName, &camera.AreaID, &camera.Enabled,
-		&camera.StreamKey, &camera.CreatedAt, &camera.UpdatedAt, &areaName,
-	)
-
-	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera not found",
-		})
-	}
+// GetAllCameras - Get all cameras, as much of each as the caller's role
+// may see
+func (h *CameraHandler) GetAllCameras(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
+	view := cameraView(c)
+	page := response.ParsePage(c, 0)
+	fields, err := response.ParseFields(c, view.Sample())
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch camera",
-		})
-	}
-
-	cameraMap := map[string]interface{}{
-		"id":               camera.ID,
-		"name":             camera.Name,
-		"private_rtsp_url": camera.PrivateRTSPURL,
-		"description":      camera.Description,
-		"location":         camera.Location,
-		"group_name":       camera.GroupName,
-		"area_id":          camera.AreaID,
-		"enabled":          camera.Enabled,
-		"stream_key":       camera.StreamKey,
-		"created_at":       camera.CreatedAt,
-		"updated_at":       camera.UpdatedAt,
+		return response.Fail(c, 400, "Invalid fields: "+err.Error())
 	}
 
-	if areaName.Valid {
-		cameraMap["area_name"] = areaName.String
+	cameras, total, err := h.cameras.List(ctx, listOptions(page))
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch cameras")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    cameraMap,
-	})
+	return response.Paginated(c, fields.Select(view.List(cameras)), page.Meta(total))
 }
 
-// CreateCamera - Create new camera
-func (h *CameraHandler) CreateCamera(c *fiber.Ctx) error {
-	var req struct {
-		Name           string `json:"name"`
-		PrivateRTSPURL string `json:"private_rtsp_url"`
-		Description    string `json:"description"`
-		Location       string `json:"location"`
-		GroupName      string `json:"group_name"`
-		AreaID         any    `json:"area_id"` // Accept string, int, or null
-		Enabled        any    `json:"enabled"` // Accept bool or int
-	}
+// GetActiveCameras - Get only enabled cameras (public). The map asks
+// for ?fields=id,name,latitude,longitude,stream_key to keep the payload
+// small on mobile connections.
+func (h *CameraHandler) GetActiveCameras(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body: " + err.Error(),
-		})
+	page := response.ParsePage(c, 0)
+	fields, err := response.ParseFields(c, models.PublicCamera{})
+	if err != nil {
+		return response.Fail(c, 400, "Invalid fields: "+err.Error())
 	}
 
-	// Convert area_id to *int (handles string, int, or empty)
-	var areaID *int
-	switch v := req.AreaID.(type) {
-	case float64:
-		if v > 0 {
-			id := int(v)
-			areaID = &id
-		}
-	case string:
-		if v != "" {
-			var id int
-			if _, err := fmt.Sscanf(v, "%d", &id); err == nil && id > 0 {
-				areaID = &id
-			}
-		}
+	cameras, total, err := h.cameras.ListActive(ctx, listOptions(page))
+	if err != nil {
+		return response.Fail(c, 500, "Failed to fetch cameras")
 	}
 
-	// Convert enabled to bool (handles both bool and int)
-	enabled := false
-	switch v := req.Enabled.(type) {
-	case bool:
-		enabled = v
-	case float64:
-		enabled = v != 0
-	case int:
-		enabled = v != 0
-	}
+	return response.Paginated(c, fields.Select(cameras), page.Meta(total))
+}
 
-	// Validation
-	if req.Name == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera name is required",
-		})
+// GetCamera - Get single camera by ID, as much of it as the caller's
+// role may see
+func (h *CameraHandler) GetCamera(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
 	}
 
-	if req.PrivateRTSPURL == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "RTSP URL is required",
-		})
+	camera, err := h.cameras.Get(ctx, id)
+	if err != nil {
+		return serviceError(c, err, "Camera not found", "Failed to fetch camera")
 	}
 
-	// Generate stream key
-	streamKey := generateStreamKey(req.Name)
+	return response.OK(c, cameraView(c).One(*camera))
+}
 
-	result, err := h.db.Exec(`
-		INSERT INTO cameras (name, private_rtsp_url, description, location, 
-		                     group_name, area_id, enabled, stream_key, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, req.Name, req.PrivateRTSPURL, req.Description, req.Location,
-		req.GroupName, areaID, enabled, streamKey, time.Now())
+// CreateCamera - Create new camera
+func (h *CameraHandler) CreateCamera(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to create camera",
-		})
+	var req CameraRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	if ok, err := h.checkStreamNode(c, &req); !ok {
+		return err
 	}
 
-	id, _ := result.LastInsertId()
+	camera, err := h.cameras.Create(ctx, req.input())
+	if err != nil {
+		return serviceError(c, err, "Camera not found", "Failed to create camera")
+	}
 
-	return c.Status(201).JSON(fiber.Map{
-		"success": true,
-		"message": "Camera created successfully",
-		"data": fiber.Map{
-			"id":         id,
-			"stream_key": streamKey,
-		},
+	return response.Created(c, "Camera created successfully", fiber.Map{
+		"id":         camera.ID,
+		"stream_key": camera.StreamKey,
+		"area_id":    camera.AreaID,
 	})
 }
 
 // UpdateCamera - Update existing camera
 func (h *CameraHandler) UpdateCamera(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	var req struct {
-		Name           string `json:"name"`
-		PrivateRTSPURL string `json:"private_rtsp_url"`
-		Description    string `json:"description"`
-		Location       string `json:"location"`
-		GroupName      string `json:"group_name"`
-		AreaID         any    `json:"area_id"` // Accept string, int, or null
-		Enabled        any    `json:"enabled"` // Accept bool or int
-	}
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body: " + err.Error(),
-		})
-	}
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	// Convert area_id to *int
-	var areaID *int
-	switch v := req.AreaID.(type) {
-	case float64:
-		if v > 0 {
-			id := int(v)
-			areaID = &id
-		}
-	case string:
-		if v != "" {
-			var id int
-			if _, err := fmt.Sscanf(v, "%d", &id); err == nil && id > 0 {
-				areaID = &id
-			}
-		}
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
 	}
 
-	// Convert enabled to bool
-	enabled := false
-	switch v := req.Enabled.(type) {
-	case bool:
-		enabled = v
-	case float64:
-		enabled = v != 0
-	case int:
-		enabled = v != 0
+	var req CameraRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
 	}
-
-	result, err := h.db.Exec(`
-		UPDATE cameras 
-		SET name = ?, private_rtsp_url = ?, description = ?, location = ?,
-		    group_name = ?, area_id = ?, enabled = ?, updated_at = ?
-		WHERE id = ?
-	`, req.Name, req.PrivateRTSPURL, req.Description, req.Location,
-		req.GroupName, areaID, enabled, time.Now(), id)
-
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to update camera",
-		})
+	if ok, err := h.checkStreamNode(c, &req); !ok {
+		return err
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera not found",
-		})
+	if err := h.cameras.Update(ctx, id, req.input()); err != nil {
+		return serviceError(c, err, "Camera not found", "Failed to update camera")
 	}
+	forgetStreamCameras(ctx)
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Camera updated successfully",
-	})
+	return response.Message(c, "Camera updated successfully")
 }
 
 // DeleteCamera - Delete camera
 func (h *CameraHandler) DeleteCamera(c *fiber.Ctx) error {
-	id := c.Params("id")
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	result, err := h.db.Exec("DELETE FROM cameras WHERE id = ?", id)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to delete camera",
-		})
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera not found",
-		})
+	if err := h.cameras.Delete(ctx, id); err != nil {
+		return serviceError(c, err, "Camera not found", "Failed to delete camera")
 	}
+	forgetStreamCameras(ctx)
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Camera deleted successfully",
-	})
+	return response.Message(c, "Camera deleted successfully")
 }
 
 // ToggleCamera - Toggle camera enabled status
 func (h *CameraHandler) ToggleCamera(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	// Get current status
-	var enabled bool
-	err := h.db.QueryRow("SELECT enabled FROM cameras WHERE id = ?", id).Scan(&enabled)
-	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera not found",
-		})
-	}
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	// Toggle status
-	newStatus := !enabled
-	_, err = h.db.Exec("UPDATE cameras SET enabled = ?, updated_at = ? WHERE id = ?",
-		newStatus, time.Now(), id)
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
 
+	enabled, err := h.cameras.Toggle(ctx, id)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to toggle camera",
-		})
+		return serviceError(c, err, "Camera not found", "Failed to toggle camera")
 	}
+	forgetStreamCameras(ctx)
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Camera status updated",
-		"data": fiber.Map{
-			"enabled": newStatus,
-		},
+	return c.JSON(response.Envelope{
+		Success: true,
+		Message: "Camera status updated",
+		Data:    fiber.Map{"enabled": enabled},
 	})
 }
 
-// Helper function to generate stream key
-func generateStreamKey(name string) string {
-	// Simple implementation - in production use UUID or more sophisticated method
-	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
-	return name + "-" + timestamp
+// cameraView is how much of a camera the signed-in user's role may see
+func cameraView(c *fiber.Ctx) models.CameraView {
+	role, _ := c.Locals("role").(string)
+	return models.CameraViewFor(role)
 }
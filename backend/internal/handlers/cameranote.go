@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/uploads"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxCameraAttachments caps the photos of one camera
+const maxCameraAttachments = 50
+
+// CameraNoteHandler keeps the field maintenance records of cameras:
+// notes such as ISP circuit IDs and pole numbers, and photos of the
+// installation
+type CameraNoteHandler struct {
+	db    *sql.DB
+	files *UploadHandler
+	cfg   *config.Config
+}
+
+func NewCameraNoteHandler(db *sql.DB, store *uploads.Store, cfg *config.Config) *CameraNoteHandler {
+	return &CameraNoteHandler{db: db, files: NewUploadHandler(db, store, cfg), cfg: cfg}
+}
+
+// CameraNoteRequest is the text of a note
+type CameraNoteRequest struct {
+	Body string `json:"body" validate:"required,max=5000"`
+}
+
+const cameraNoteColumns = `
+	SELECT n.id, n.camera_id, n.body, n.created_by, COALESCE(u.username, ''), n.created_at, n.updated_at
+	FROM camera_notes n
+	LEFT JOIN users u ON u.id = n.created_by`
+
+// GetCameraNotes - The notes of a camera, newest first
+func (h *CameraNoteHandler) GetCameraNotes(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	rows, err := h.db.QueryContext(ctx, cameraNoteColumns+`
+		WHERE n.camera_id = ?
+		ORDER BY n.created_at DESC, n.id DESC
+	`, cameraID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch notes")
+	}
+	defer rows.Close()
+	notes := []models.CameraNote{}
+	for rows.Next() {
+		n, err := scanCameraNote(rows)
+		if err != nil {
+			return serviceError(c, err, "", "Failed to fetch notes")
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return serviceError(c, err, "", "Failed to fetch notes")
+	}
+	return response.OK(c, notes)
+}
+
+// CreateCameraNote - Add a note to a camera
+func (h *CameraNoteHandler) CreateCameraNote(c *fiber.Ctx) error {
+	var req CameraNoteRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return invalidFields(c, "", map[string]string{"body": "is required"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	var createdBy *int
+	if id, ok := c.Locals("user_id").(int); ok {
+		createdBy = &id
+	}
+	now := time.Now().UTC()
+	var id int64
+	err = h.db.QueryRowContext(ctx, `
+		INSERT INTO camera_notes (camera_id, body, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, cameraID, body, createdBy, now, now).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to add note")
+	}
+	n, err := h.note(ctx, cameraID, id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to add note")
+	}
+	return response.Created(c, "Note added", n)
+}
+
+// UpdateCameraNote - Change the text of a note
+func (h *CameraNoteHandler) UpdateCameraNote(c *fiber.Ctx) error {
+	noteID, err := strconv.ParseInt(c.Params("noteId"), 10, 64)
+	if err != nil {
+		return response.Fail(c, 404, "Note not found")
+	}
+	var req CameraNoteRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return invalidFields(c, "", map[string]string{"body": "is required"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	result, err := h.db.ExecContext(ctx, `UPDATE camera_notes SET body = ?, updated_at = ? WHERE id = ? AND camera_id = ?`,
+		body, time.Now().UTC(), noteID, cameraID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update note")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Note not found")
+	}
+	n, err := h.note(ctx, cameraID, noteID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update note")
+	}
+	return response.OK(c, n)
+}
+
+// DeleteCameraNote - Remove a note
+func (h *CameraNoteHandler) DeleteCameraNote(c *fiber.Ctx) error {
+	noteID, err := strconv.ParseInt(c.Params("noteId"), 10, 64)
+	if err != nil {
+		return response.Fail(c, 404, "Note not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	result, err := h.db.ExecContext(ctx, `DELETE FROM camera_notes WHERE id = ? AND camera_id = ?`, noteID, cameraID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete note")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Note not found")
+	}
+	return response.Message(c, "Note deleted")
+}
+
+const cameraAttachmentColumns = `
+	SELECT a.id, a.camera_id, a.name, a.upload_key, COALESCE(f.content_type, ''), COALESCE(f.size, 0),
+		COALESCE(f.width, 0), COALESCE(f.height, 0), a.created_by, COALESCE(u.username, ''), a.created_at
+	FROM camera_attachments a
+	LEFT JOIN uploads f ON f.key = a.upload_key
+	LEFT JOIN users u ON u.id = a.created_by`
+
+// GetCameraAttachments - The photos attached to a camera, newest first
+func (h *CameraNoteHandler) GetCameraAttachments(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	rows, err := h.db.QueryContext(ctx, cameraAttachmentColumns+`
+		WHERE a.camera_id = ?
+		ORDER BY a.created_at DESC, a.id DESC
+	`, cameraID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch attachments")
+	}
+	defer rows.Close()
+	attachments := []models.CameraAttachment{}
+	for rows.Next() {
+		a, err := h.scanAttachment(rows)
+		if err != nil {
+			return serviceError(c, err, "", "Failed to fetch attachments")
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return serviceError(c, err, "", "Failed to fetch attachments")
+	}
+	return response.OK(c, attachments)
+}
+
+// CreateCameraAttachment - Attach the "file" field of a multipart form
+// to a camera, with an optional "name" such as "Pole 14 from the east".
+// Files are JPEG or PNG photos of at most 768 KB; they are scaled to
+// 1920px and their metadata, GPS position included, is stripped.
+func (h *CameraNoteHandler) CreateCameraAttachment(c *fiber.Ctx) error {
+	name := strings.TrimSpace(c.FormValue("name"))
+	if len(name) > 200 {
+		return invalidFields(c, "", map[string]string{"name": "must be at most 200 characters"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	var count int
+	if err := h.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM camera_attachments WHERE camera_id = ?`,
+		cameraID).Scan(&count); err != nil {
+		return serviceError(c, err, "", "Failed to attach file")
+	}
+	if count >= maxCameraAttachments {
+		return response.Fail(c, fiber.StatusConflict,
+			"A camera has at most "+strconv.Itoa(maxCameraAttachments)+" attachments; delete one first")
+	}
+
+	u, ok, err := h.files.save(c, uploads.KindAttachment)
+	if !ok {
+		return err
+	}
+	var createdBy *int
+	if id, ok := c.Locals("user_id").(int); ok {
+		createdBy = &id
+	}
+	var id int64
+	err = h.db.QueryRowContext(ctx, `
+		INSERT INTO camera_attachments (camera_id, upload_key, name, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, cameraID, u.Key, name, createdBy, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to attach file")
+	}
+	row := h.db.QueryRowContext(ctx, cameraAttachmentColumns+` WHERE a.id = ?`, id)
+	a, err := h.scanAttachment(row)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to attach file")
+	}
+	return response.Created(c, "File attached", a)
+}
+
+// DeleteCameraAttachment - Remove an attachment; its file goes with the
+// next collection of orphaned uploads
+func (h *CameraNoteHandler) DeleteCameraAttachment(c *fiber.Ctx) error {
+	attachmentID, err := strconv.ParseInt(c.Params("attachmentId"), 10, 64)
+	if err != nil {
+		return response.Fail(c, 404, "Attachment not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	result, err := h.db.ExecContext(ctx, `DELETE FROM camera_attachments WHERE id = ? AND camera_id = ?`,
+		attachmentID, cameraID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete attachment")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Attachment not found")
+	}
+	return response.Message(c, "Attachment deleted")
+}
+
+// camera returns the camera of the request, which must be in the
+// organization. When ok is false the response has been written and the
+// handler should return err.
+func (h *CameraNoteHandler) camera(c *fiber.Ctx, ctx context.Context) (cameraID int, ok bool, err error) {
+	cameraID, ok = paramID(c)
+	if !ok {
+		return 0, false, response.Fail(c, 404, "Camera not found")
+	}
+	found, err := cameraExists(ctx, h.db, cameraID)
+	if err != nil {
+		return 0, false, serviceError(c, err, "", "Failed to fetch camera")
+	}
+	if !found {
+		return 0, false, response.Fail(c, 404, "Camera not found")
+	}
+	return cameraID, true, nil
+}
+
+// note returns a note of the camera
+func (h *CameraNoteHandler) note(ctx context.Context, cameraID int, id int64) (models.CameraNote, error) {
+	return scanCameraNote(h.db.QueryRowContext(ctx, cameraNoteColumns+` WHERE n.id = ? AND n.camera_id = ?`, id, cameraID))
+}
+
+func scanCameraNote(row interface{ Scan(...any) error }) (models.CameraNote, error) {
+	var n models.CameraNote
+	var createdBy sql.NullInt64
+	err := row.Scan(&n.ID, &n.CameraID, &n.Body, &createdBy, &n.Author, &n.CreatedAt, &n.UpdatedAt)
+	if createdBy.Valid {
+		by := int(createdBy.Int64)
+		n.CreatedBy = &by
+	}
+	return n, err
+}
+
+func (h *CameraNoteHandler) scanAttachment(row interface{ Scan(...any) error }) (models.CameraAttachment, error) {
+	var a models.CameraAttachment
+	var createdBy sql.NullInt64
+	err := row.Scan(&a.ID, &a.CameraID, &a.Name, &a.Key, &a.ContentType, &a.Size,
+		&a.Width, &a.Height, &createdBy, &a.Author, &a.CreatedAt)
+	if createdBy.Valid {
+		by := int(createdBy.Int64)
+		a.CreatedBy = &by
+	}
+	a.URL = h.files.store.URL(a.Key)
+	return a, err
+}
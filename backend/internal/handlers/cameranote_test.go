@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/internal/uploads"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCameraNotes(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'ana', 'x', 'admin')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (2, 'Elsewhere', 'rtsp://x', 'x', 2)`,
+	)
+
+	store := uploads.New(db, uploads.NewDirStorage(t.TempDir()), "")
+	h := NewCameraNoteHandler(db, store, &config.Config{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", 1)
+		c.SetUserContext(tenant.WithOrg(c.UserContext(), tenant.DefaultOrgID))
+		return c.Next()
+	})
+	app.Get("/cameras/:id/notes", h.GetCameraNotes)
+	app.Post("/cameras/:id/notes", h.CreateCameraNote)
+	app.Put("/cameras/:id/notes/:noteId", h.UpdateCameraNote)
+	app.Delete("/cameras/:id/notes/:noteId", h.DeleteCameraNote)
+	app.Get("/cameras/:id/attachments", h.GetCameraAttachments)
+	app.Post("/cameras/:id/attachments", h.CreateCameraAttachment)
+	app.Delete("/cameras/:id/attachments/:attachmentId", h.DeleteCameraAttachment)
+
+	do := func(t *testing.T, method, path, contentType string, body io.Reader, out interface{}) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if out != nil {
+			env := struct {
+				Data interface{} `json:"data"`
+			}{Data: out}
+			json.NewDecoder(resp.Body).Decode(&env)
+		}
+		return resp.StatusCode
+	}
+	doJSON := func(t *testing.T, method, path, body string, out interface{}) int {
+		t.Helper()
+		return do(t, method, path, "application/json", strings.NewReader(body), out)
+	}
+
+	t.Run("Notes", func(t *testing.T) {
+		var first, second models.CameraNote
+		if status := doJSON(t, "POST", "/cameras/1/notes", `{"body":" Circuit ID: IDN-4471 "}`, &first); status != 201 {
+			t.Fatalf("Create status = %d, want 201", status)
+		}
+		if first.Body != "Circuit ID: IDN-4471" || first.Author != "ana" || first.CreatedBy == nil || *first.CreatedBy != 1 {
+			t.Errorf("Created note = %+v", first)
+		}
+		doJSON(t, "POST", "/cameras/1/notes", `{"body":"Pole 14"}`, &second)
+
+		var notes []models.CameraNote
+		doJSON(t, "GET", "/cameras/1/notes", "", &notes)
+		if len(notes) != 2 || notes[0].ID != second.ID {
+			t.Fatalf("Notes = %+v, want the newest first", notes)
+		}
+
+		var updated models.CameraNote
+		path := "/cameras/1/notes/" + strconv.FormatInt(first.ID, 10)
+		if status := doJSON(t, "PUT", path, `{"body":"Circuit ID: IDN-4472"}`, &updated); status != 200 || updated.Body != "Circuit ID: IDN-4472" {
+			t.Errorf("Update = %d %+v", status, updated)
+		}
+		if status := doJSON(t, "PUT", path, `{"body":"  "}`, nil); status != 422 {
+			t.Errorf("Blank body status = %d, want 422", status)
+		}
+		if status := doJSON(t, "DELETE", path, "", nil); status != 200 {
+			t.Errorf("Delete status = %d, want 200", status)
+		}
+		if status := doJSON(t, "DELETE", path, "", nil); status != 404 {
+			t.Errorf("Second delete status = %d, want 404", status)
+		}
+	})
+
+	t.Run("Other organizations", func(t *testing.T) {
+		if status := doJSON(t, "GET", "/cameras/2/notes", "", nil); status != 404 {
+			t.Errorf("Notes of another organization's camera = %d, want 404", status)
+		}
+		if status := doJSON(t, "POST", "/cameras/2/notes", `{"body":"x"}`, nil); status != 404 {
+			t.Errorf("Note on another organization's camera = %d, want 404", status)
+		}
+	})
+
+	t.Run("Attachments", func(t *testing.T) {
+		var pic bytes.Buffer
+		png.Encode(&pic, image.NewRGBA(image.Rect(0, 0, 2400, 1200)))
+		var form bytes.Buffer
+		w := multipart.NewWriter(&form)
+		w.WriteField("name", "Pole 14 from the east")
+		part, _ := w.CreateFormFile("file", "pole.png")
+		part.Write(pic.Bytes())
+		w.Close()
+
+		var a models.CameraAttachment
+		if status := do(t, "POST", "/cameras/1/attachments", w.FormDataContentType(), &form, &a); status != 201 {
+			t.Fatalf("Attach status = %d, want 201", status)
+		}
+		if a.Name != "Pole 14 from the east" || a.Width != 1920 || a.Height != 960 || a.URL != "/api/public/uploads/"+a.Key {
+			t.Errorf("Attachment = %+v", a)
+		}
+
+		var list []models.CameraAttachment
+		do(t, "GET", "/cameras/1/attachments", "", nil, &list)
+		if len(list) != 1 || list[0].Key != a.Key || list[0].Author != "ana" {
+			t.Fatalf("Attachments = %+v", list)
+		}
+
+		if status := do(t, "DELETE", "/cameras/1/attachments/"+strconv.FormatInt(a.ID, 10), "", nil, nil); status != 200 {
+			t.Errorf("Delete status = %d, want 200", status)
+		}
+		var referenced int
+		db.QueryRow(`SELECT COUNT(*) FROM camera_attachments WHERE upload_key = ?`, a.Key).Scan(&referenced)
+		if referenced != 0 {
+			t.Errorf("Attachment still recorded after delete")
+		}
+	})
+}
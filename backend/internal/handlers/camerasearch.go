@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// searchCacheTTL is how long the results of a query are served before
+// the database is searched again. The search box queries as visitors
+// type, so the same prefixes come in over and over.
+const searchCacheTTL = 30 * time.Second
+
+// Bounds of a camera search
+const (
+	minSearchQuery     = 2
+	maxSearchQuery     = 100
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// likeEscaper escapes the wildcards of LIKE, with \ as the escape
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type CameraSearchHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewCameraSearchHandler(db *sql.DB, cfg *config.Config) *CameraSearchHandler {
+	return &CameraSearchHandler{db: db, cfg: cfg}
+}
+
+// SearchCameras - Enabled cameras whose name, location or area matches
+// ?q=, names starting with it first, with whether each is online; for
+// the landing page search box (public)
+func (h *CameraSearchHandler) SearchCameras(c *fiber.Ctx) error {
+	q := strings.ToLower(strings.Join(strings.Fields(c.Query("q")), " "))
+	if n := utf8.RuneCountInString(q); n < minSearchQuery || n > maxSearchQuery {
+		return invalidFields(c, "", map[string]string{"q": "must be 2 to 100 characters"})
+	}
+	limit := c.QueryInt("limit", defaultSearchLimit)
+	if limit < 1 || limit > maxSearchLimit {
+		return invalidFields(c, "", map[string]string{"limit": "must be between 1 and 50"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	results := []models.CameraSearchResult{}
+	group := cache.NewGroup("camera-search:"+strconv.Itoa(tenant.OrgID(ctx)), searchCacheTTL)
+	err := group.Load(ctx, strconv.Itoa(limit)+":"+q, &results, func() (err error) {
+		results, err = h.search(ctx, q, limit)
+		return err
+	})
+	if err != nil {
+		return serviceError(c, err, "", "Failed to search cameras")
+	}
+	return response.OK(c, results)
+}
+
+func (h *CameraSearchHandler) search(ctx context.Context, q string, limit int) ([]models.CameraSearchResult, error) {
+	contains := "%" + likeEscaper.Replace(q) + "%"
+	prefix := likeEscaper.Replace(q) + "%"
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT c.id, c.name, COALESCE(c.description, ''), COALESCE(c.location, ''), COALESCE(c.group_name, ''),
+		       COALESCE(c.stream_key, ''), c.area_id, a.name, c.latitude, c.longitude, h.status
+		FROM cameras c
+		LEFT JOIN areas a ON a.id = c.area_id
+		LEFT JOIN camera_health h ON h.camera_id = c.id
+		WHERE c.organization_id = ? AND c.enabled = TRUE
+		  AND (LOWER(c.name) LIKE ? ESCAPE '\' OR LOWER(COALESCE(c.location, '')) LIKE ? ESCAPE '\'
+		       OR LOWER(COALESCE(a.name, '')) LIKE ? ESCAPE '\')
+		ORDER BY CASE WHEN LOWER(c.name) LIKE ? ESCAPE '\' THEN 0 WHEN LOWER(c.name) LIKE ? ESCAPE '\' THEN 1 ELSE 2 END,
+		         c.name ASC, c.id ASC
+		LIMIT ?
+	`, tenant.OrgID(ctx), contains, contains, contains, prefix, contains, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.CameraSearchResult{}
+	for rows.Next() {
+		var r models.CameraSearchResult
+		var health sql.NullString
+		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.Location, &r.GroupName, &r.StreamKey,
+			&r.AreaID, &r.AreaName, &r.Latitude, &r.Longitude, &health); err != nil {
+			return nil, err
+		}
+		r.Online = health.String != "offline"
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSearchCameras(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO areas (id, name, slug) VALUES (1, 'Pasar Kota', 'pasar-kota')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, location, area_id, enabled) VALUES
+			(1, 'Simpang Pasar', 'rtsp://a', 'simpang', 'Jl. Veteran', NULL, TRUE),
+			(2, 'Pasar Besar', 'rtsp://b', 'pasar-besar', '', NULL, TRUE),
+			(3, 'Gerbang', 'rtsp://c', 'gerbang', 'Depan pasar', NULL, TRUE),
+			(4, 'Parkir', 'rtsp://d', 'parkir', '', 1, TRUE),
+			(5, 'Pasar Lama', 'rtsp://e', 'pasar-lama', '', NULL, FALSE),
+			(6, 'Diskon 50% Pasar', 'rtsp://f', 'diskon', '', NULL, TRUE)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (7, 'Pasar Dander', 'rtsp://g', 'dander', 2)`,
+		`INSERT INTO camera_health (camera_id, status) VALUES (2, 'offline'), (1, 'online')`,
+	)
+
+	h := NewCameraSearchHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Get("/cameras/search", h.SearchCameras)
+
+	search := func(query string) (int, []models.CameraSearchResult) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/cameras/search?"+query, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data []models.CameraSearchResult `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+	ids := func(results []models.CameraSearchResult) []int {
+		list := []int{}
+		for _, r := range results {
+			list = append(list, r.ID)
+		}
+		return list
+	}
+
+	// Names starting with the query come first, then other name matches,
+	// then location and area matches
+	status, results := search("q=" + url.QueryEscape("  PASAR "))
+	if status != 200 || len(results) != 5 {
+		t.Fatalf("Expected 5 cameras, got %d: %+v", status, results)
+	}
+	if got := ids(results); got[0] != 2 || got[1] != 6 || got[2] != 1 || got[3] != 3 || got[4] != 4 {
+		t.Errorf("Expected 2, 6, 1, 3, 4, got %v", got)
+	}
+	if results[0].Online || !results[2].Online || !results[3].Online {
+		t.Errorf("Expected only Pasar Besar offline, got %+v", results)
+	}
+	if results[4].AreaName == nil || *results[4].AreaName != "Pasar Kota" || results[0].StreamKey != "pasar-besar" {
+		t.Errorf("Expected public fields, got %+v", results[4])
+	}
+
+	if _, results := search("q=pasar&limit=1"); len(results) != 1 {
+		t.Errorf("Expected the limit to apply, got %d", len(results))
+	}
+	if _, results := search("q=" + url.QueryEscape("0%")); len(ids(results)) != 1 || results[0].ID != 6 {
+		t.Errorf("Expected %% to match itself only, got %v", ids(results))
+	}
+
+	// Results are cached for a while
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (8, 'Pasar Baru', 'rtsp://h', 'baru')`); err != nil {
+		t.Fatalf("Failed to add camera: %v", err)
+	}
+	if _, results := search("q=" + url.QueryEscape("pasar")); len(results) != 5 {
+		t.Errorf("Expected the cached results, got %v", ids(results))
+	}
+
+	for _, query := range []string{"", "q=p", "q=pasar&limit=0", "q=pasar&limit=51"} {
+		if status, _ := search(query); status != 422 {
+			t.Errorf("Expected 422 for %q, got %d", query, status)
+		}
+	}
+}
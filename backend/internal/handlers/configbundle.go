@@ -0,0 +1,1002 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"github.com/abcdefak87/cctv/internal/service"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// configBundleVersion is written into every export; imports of any other
+// version are refused
+const configBundleVersion = 1
+
+// maxBundleItems caps each list of an imported bundle
+const maxBundleItems = 10000
+
+// ConfigBundle is the configuration of one organization as exported by
+// GET /api/admin/export. Records refer to each other by natural key
+// rather than ID, so a bundle can be imported into another server:
+// areas and cameras name their area, playlists list stream keys.
+type ConfigBundle struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Areas      []BundleArea     `json:"areas"` // parents before their children
+	Cameras    []BundleCamera   `json:"cameras"`
+	Settings   []SettingEntry   `json:"settings"`
+	Playlists  []BundlePlaylist `json:"playlists"`
+	Users      []BundleUser     `json:"users,omitempty"` // only with ?users=true
+}
+
+type BundleArea struct {
+	Name        string          `json:"name"`
+	Slug        string          `json:"slug"`
+	Description string          `json:"description"`
+	Parent      string          `json:"parent,omitempty"` // name of the parent area
+	Level       string          `json:"level"`
+	RT          string          `json:"rt"`
+	RW          string          `json:"rw"`
+	Kelurahan   string          `json:"kelurahan"`
+	Kecamatan   string          `json:"kecamatan"`
+	Boundary    json.RawMessage `json:"boundary,omitempty"`
+}
+
+type BundleCamera struct {
+	Name           string   `json:"name"`
+	PrivateRTSPURL string   `json:"private_rtsp_url"`
+	Description    string   `json:"description"`
+	Location       string   `json:"location"`
+	GroupName      string   `json:"group_name"`
+	Area           string   `json:"area,omitempty"` // name of the area
+	Latitude       *float64 `json:"latitude"`
+	Longitude      *float64 `json:"longitude"`
+	Enabled        bool     `json:"enabled"`
+	Traffic        bool     `json:"traffic"`
+	Watermark      bool     `json:"watermark"`
+	Recording      bool     `json:"recording_enabled"`
+	StreamKey      string   `json:"stream_key"`
+	StreamNode     string   `json:"stream_node,omitempty"`
+}
+
+type BundlePlaylist struct {
+	Name         string   `json:"name"`
+	Layout       string   `json:"layout"`
+	DwellSeconds int      `json:"dwell_seconds"`
+	Cameras      []string `json:"cameras"`    // stream keys, in order
+	TokenHash    string   `json:"token_hash"` // keeps kiosk links working after a rebuild
+}
+
+type BundleUser struct {
+	Username     string   `json:"username"`
+	Email        string   `json:"email"`
+	Role         string   `json:"role"`
+	Permissions  []string `json:"permissions"`
+	PasswordHash string   `json:"password_hash,omitempty"` // only with ?password_hashes=true
+}
+
+// How an import treats records that already exist
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+// What an import did about a conflict
+const (
+	ResolutionSkipped     = "skipped"
+	ResolutionOverwritten = "overwritten"
+	ResolutionRenamed     = "renamed"   // the camera got another stream key
+	ResolutionCleared     = "cleared"   // an unknown stream node was dropped
+	ResolutionNewToken    = "new_token" // the playlist got a new kiosk token
+)
+
+// ImportCounts is what an import did with one kind of record
+type ImportCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// ImportConflict is a record of the bundle that clashed with the server
+type ImportConflict struct {
+	Kind       string `json:"kind"` // area, camera, setting, playlist or user
+	Key        string `json:"key"`
+	Resolution string `json:"resolution"`
+	Reason     string `json:"reason"`
+}
+
+type ImportResult struct {
+	DryRun    bool             `json:"dry_run"`
+	Areas     ImportCounts     `json:"areas"`
+	Cameras   ImportCounts     `json:"cameras"`
+	Settings  ImportCounts     `json:"settings"`
+	Playlists ImportCounts     `json:"playlists"`
+	Users     ImportCounts     `json:"users"`
+	Conflicts []ImportConflict `json:"conflicts"`
+
+	// Users imported without a password hash; they cannot log in until
+	// `server reset-password` gives them one
+	PasswordReset []string `json:"password_reset,omitempty"`
+}
+
+type ConfigBundleHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewConfigBundleHandler(db *sql.DB, cfg *config.Config) *ConfigBundleHandler {
+	return &ConfigBundleHandler{db: db, cfg: cfg}
+}
+
+// ExportConfig - Download the organization's areas, cameras, settings and
+// playlists as one JSON file. ?users=true adds the users, and
+// ?password_hashes=true their password hashes too. The file holds RTSP
+// credentials: keep it safe.
+func (h *ConfigBundleHandler) ExportConfig(c *fiber.Ctx) error {
+	withUsers := c.QueryBool("users")
+	withHashes := c.QueryBool("password_hashes")
+	if withHashes && !withUsers {
+		return invalidFields(c, "", map[string]string{"password_hashes": "requires users=true"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	bundle, err := h.export(ctx, withUsers, withHashes)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to export configuration")
+	}
+
+	c.Attachment("cctv-config-" + bundle.ExportedAt.Format("20060102-150405") + ".json")
+	c.Set("Cache-Control", "no-store")
+	return c.JSON(bundle)
+}
+
+// ImportConfig - Load a bundle from ExportConfig into the organization.
+// ?on_conflict= decides what happens to records that already exist: skip
+// (the default) keeps them, overwrite replaces them and fail imports
+// nothing when anything clashes (409). ?dry_run=true reports what would
+// happen without writing. The whole import is one transaction.
+func (h *ConfigBundleHandler) ImportConfig(c *fiber.Ctx) error {
+	mode := c.Query("on_conflict", ConflictSkip)
+	if mode != ConflictSkip && mode != ConflictOverwrite && mode != ConflictFail {
+		return invalidFields(c, "", map[string]string{"on_conflict": "must be one of skip, overwrite, fail"})
+	}
+
+	var bundle ConfigBundle
+	if err := json.Unmarshal(c.Body(), &bundle); err != nil {
+		return response.Fail(c, 400, "Invalid request body")
+	}
+	if fields := h.checkBundle(&bundle); len(fields) > 0 {
+		return invalidFields(c, "", fields)
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to import configuration")
+	}
+	defer tx.Rollback()
+
+	im := &importer{
+		ctx:    ctx,
+		tx:     tx,
+		cfg:    h.cfg,
+		orgID:  tenant.OrgID(ctx),
+		mode:   mode,
+		result: ImportResult{DryRun: c.QueryBool("dry_run"), Conflicts: []ImportConflict{}},
+	}
+	im.userID, _ = c.Locals("user_id").(int)
+	if err := im.run(&bundle); err != nil {
+		return serviceError(c, err, "", "Failed to import configuration")
+	}
+	result := im.result
+
+	if mode == ConflictFail && len(result.Conflicts) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(response.Envelope{
+			Success: false,
+			Message: "Nothing was imported: " + strconv.Itoa(len(result.Conflicts)) + " conflict(s) found",
+			Data:    result,
+			Error:   &response.Error{Code: response.CodeFor(fiber.StatusConflict), Message: "Import conflicts with existing configuration"},
+		})
+	}
+	if result.DryRun {
+		return response.OK(c, result)
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to import configuration")
+	}
+
+	forgetStreamCameras(ctx)
+	forgetBranding(ctx)
+	publish(c, events.Event{Type: events.ConfigImported, Resource: "config", Data: map[string]interface{}{
+		"on_conflict": mode,
+		"areas":       result.Areas,
+		"cameras":     result.Cameras,
+		"settings":    result.Settings,
+		"playlists":   result.Playlists,
+		"users":       result.Users,
+		"conflicts":   len(result.Conflicts),
+	}})
+
+	return c.JSON(response.Envelope{
+		Success: true,
+		Message: "Configuration imported successfully",
+		Data:    result,
+	})
+}
+
+func (h *ConfigBundleHandler) export(ctx context.Context, withUsers, withHashes bool) (*ConfigBundle, error) {
+	orgID := tenant.OrgID(ctx)
+	bundle := &ConfigBundle{
+		Version:    configBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Areas:      []BundleArea{},
+		Cameras:    []BundleCamera{},
+		Settings:   []SettingEntry{},
+		Playlists:  []BundlePlaylist{},
+	}
+	var err error
+	if bundle.Areas, err = h.exportAreas(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT c.name, COALESCE(c.private_rtsp_url, ''), COALESCE(c.description, ''), COALESCE(c.location, ''),
+		       COALESCE(c.group_name, ''), COALESCE(a.name, ''), c.latitude, c.longitude, COALESCE(c.enabled, TRUE),
+		       c.traffic, c.watermark, c.recording_enabled, COALESCE(c.stream_key, ''), COALESCE(c.stream_node, '')
+		FROM cameras c
+		LEFT JOIN areas a ON a.id = c.area_id
+		WHERE c.organization_id = ?
+		ORDER BY c.id ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cam BundleCamera
+		if err := rows.Scan(&cam.Name, &cam.PrivateRTSPURL, &cam.Description, &cam.Location, &cam.GroupName, &cam.Area,
+			&cam.Latitude, &cam.Longitude, &cam.Enabled, &cam.Traffic, &cam.Watermark, &cam.Recording,
+			&cam.StreamKey, &cam.StreamNode); err != nil {
+			return nil, err
+		}
+		bundle.Cameras = append(bundle.Cameras, cam)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT key, value, category, COALESCE(description, '') FROM settings WHERE organization_id = ? ORDER BY key ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry SettingEntry
+		var value string
+		if err := rows.Scan(&entry.Key, &value, &entry.Category, &entry.Description); err != nil {
+			return nil, err
+		}
+		if entry.Value = json.RawMessage(value); !json.Valid(entry.Value) {
+			entry.Value, _ = json.Marshal(value)
+		}
+		bundle.Settings = append(bundle.Settings, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if bundle.Playlists, err = h.exportPlaylists(ctx, orgID); err != nil {
+		return nil, err
+	}
+	if withUsers {
+		if bundle.Users, err = h.exportUsers(ctx, orgID, withHashes); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+// exportAreas lists the areas of orgID with every parent before its
+// children
+func (h *ConfigBundleHandler) exportAreas(ctx context.Context, orgID int) ([]BundleArea, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT a.id, a.parent_id, a.name, COALESCE(a.slug, ''), COALESCE(a.description, ''), COALESCE(p.name, ''),
+		       COALESCE(a.level, ''), COALESCE(a.rt, ''), COALESCE(a.rw, ''), COALESCE(a.kelurahan, ''),
+		       COALESCE(a.kecamatan, ''), a.boundary
+		FROM areas a
+		LEFT JOIN areas p ON p.id = a.parent_id
+		WHERE a.organization_id = ?
+		ORDER BY a.id ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type node struct {
+		id     int
+		parent sql.NullInt64
+		area   BundleArea
+	}
+	var nodes []node
+	for rows.Next() {
+		var n node
+		var boundary sql.NullString
+		if err := rows.Scan(&n.id, &n.parent, &n.area.Name, &n.area.Slug, &n.area.Description, &n.area.Parent,
+			&n.area.Level, &n.area.RT, &n.area.RW, &n.area.Kelurahan, &n.area.Kecamatan, &boundary); err != nil {
+			return nil, err
+		}
+		if boundary.Valid && json.Valid([]byte(boundary.String)) {
+			n.area.Boundary = json.RawMessage(boundary.String)
+		}
+		nodes = append(nodes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Repeated passes over the list place each area once its parent is
+	// placed; whatever is left over (a broken hierarchy) goes last
+	areas := []BundleArea{}
+	placed := map[int]bool{}
+	for progress := true; progress; {
+		progress = false
+		for _, n := range nodes {
+			if placed[n.id] || (n.parent.Valid && !placed[int(n.parent.Int64)]) {
+				continue
+			}
+			placed[n.id], progress = true, true
+			areas = append(areas, n.area)
+		}
+	}
+	for _, n := range nodes {
+		if !placed[n.id] {
+			areas = append(areas, n.area)
+		}
+	}
+	return areas, nil
+}
+
+func (h *ConfigBundleHandler) exportPlaylists(ctx context.Context, orgID int) ([]BundlePlaylist, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, layout, dwell_seconds, token_hash FROM playlists WHERE organization_id = ? ORDER BY id ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	playlists := []BundlePlaylist{}
+	for rows.Next() {
+		var id int
+		p := BundlePlaylist{Cameras: []string{}}
+		if err := rows.Scan(&id, &p.Name, &p.Layout, &p.DwellSeconds, &p.TokenHash); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		playlists = append(playlists, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i, id := range ids {
+		keys, err := h.db.QueryContext(ctx, `
+			SELECT COALESCE(c.stream_key, '') FROM playlist_cameras pc
+			JOIN cameras c ON c.id = pc.camera_id
+			WHERE pc.playlist_id = ?
+			ORDER BY pc.position ASC
+		`, id)
+		if err != nil {
+			return nil, err
+		}
+		for keys.Next() {
+			var key string
+			if err := keys.Scan(&key); err != nil {
+				keys.Close()
+				return nil, err
+			}
+			playlists[i].Cameras = append(playlists[i].Cameras, key)
+		}
+		keys.Close()
+		if err := keys.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return playlists, nil
+}
+
+func (h *ConfigBundleHandler) exportUsers(ctx context.Context, orgID int, withHashes bool) ([]BundleUser, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT username, COALESCE(email, ''), role, COALESCE(permissions, ''), password_hash
+		FROM users WHERE organization_id = ? ORDER BY id ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []BundleUser{}
+	for rows.Next() {
+		var u BundleUser
+		var permissions, hash string
+		if err := rows.Scan(&u.Username, &u.Email, &u.Role, &permissions, &hash); err != nil {
+			return nil, err
+		}
+		u.Permissions = repository.SplitPermissions(permissions)
+		if withHashes {
+			u.PasswordHash = hash
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// checkBundle validates a bundle before anything is written. Problems are
+// keyed by the record's place in the bundle, e.g. cameras.3.stream_key.
+func (h *ConfigBundleHandler) checkBundle(b *ConfigBundle) map[string]string {
+	fields := map[string]string{}
+	if b.Version != configBundleVersion {
+		fields["version"] = "must be " + strconv.Itoa(configBundleVersion)
+		return fields
+	}
+	for name, n := range map[string]int{"areas": len(b.Areas), "cameras": len(b.Cameras), "settings": len(b.Settings),
+		"playlists": len(b.Playlists), "users": len(b.Users)} {
+		if n > maxBundleItems {
+			fields[name] = "must have at most " + strconv.Itoa(maxBundleItems) + " items"
+		}
+	}
+	if len(fields) > 0 {
+		return fields
+	}
+
+	areas := map[string]bool{}
+	for i := range b.Areas {
+		a := &b.Areas[i]
+		at := fmt.Sprintf("areas.%d.", i)
+		a.Name, a.Parent = strings.TrimSpace(a.Name), strings.TrimSpace(a.Parent)
+		a.Slug = strings.ToLower(strings.TrimSpace(a.Slug))
+		switch {
+		case a.Name == "" || len(a.Name) > 100:
+			fields[at+"name"] = "must be 1 to 100 characters"
+		case areas[a.Name]:
+			fields[at+"name"] = "appears more than once"
+		}
+		areas[a.Name] = true
+		if a.Slug != "" && !slugPattern.MatchString(a.Slug) {
+			fields[at+"slug"] = "Slug must be lower case letters, digits and dashes"
+		}
+		if !models.IsValidAreaLevel(a.Level) {
+			fields[at+"level"] = fmt.Sprintf("Invalid level, expected one of %v", models.AreaLevels)
+		}
+		if _, _, err := (&AreaRequest{Boundary: a.Boundary}).parseBoundary(); err != nil {
+			fields[at+"boundary"] = err.Error()
+		}
+	}
+	for i, a := range b.Areas {
+		if a.Parent != "" && !areas[a.Parent] {
+			fields[fmt.Sprintf("areas.%d.parent", i)] = "is not an area of the bundle"
+		}
+	}
+
+	cameras := map[string]bool{}
+	for i := range b.Cameras {
+		cam := &b.Cameras[i]
+		at := fmt.Sprintf("cameras.%d.", i)
+		cam.Name, cam.StreamKey = strings.TrimSpace(cam.Name), strings.TrimSpace(cam.StreamKey)
+		if cam.Name == "" || len(cam.Name) > 100 {
+			fields[at+"name"] = "must be 1 to 100 characters"
+		}
+		if cam.PrivateRTSPURL == "" {
+			fields[at+"private_rtsp_url"] = "is required"
+		}
+		switch {
+		case cam.StreamKey == "":
+			fields[at+"stream_key"] = "is required"
+		case cameras[cam.StreamKey]:
+			fields[at+"stream_key"] = "appears more than once"
+		}
+		cameras[cam.StreamKey] = true
+		if cam.Area != "" && !areas[cam.Area] {
+			fields[at+"area"] = "is not an area of the bundle"
+		}
+	}
+
+	settings := map[string]bool{}
+	for i, entry := range b.Settings {
+		_, problems := checkSetting(entry)
+		// Settings kept by their own endpoint are restored as exported
+		if spec := settingSchema[entry.Key]; spec.managedBy != "" && settingKeyPattern.MatchString(entry.Key) {
+			delete(problems, "key")
+		}
+		if settings[entry.Key] {
+			problems["key"] = "appears more than once"
+		}
+		settings[entry.Key] = true
+		for field, problem := range problems {
+			fields[fmt.Sprintf("settings.%d.%s", i, field)] = problem
+		}
+	}
+
+	for i := range b.Playlists {
+		p := &b.Playlists[i]
+		at := fmt.Sprintf("playlists.%d.", i)
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" || len(p.Name) > 100 {
+			fields[at+"name"] = "must be 1 to 100 characters"
+		}
+		if p.Layout == "" {
+			p.Layout = defaultPlaylistLayout
+		}
+		if p.Layout != "1x1" && p.Layout != "2x2" && p.Layout != "3x3" && p.Layout != "4x4" {
+			fields[at+"layout"] = "must be one of 1x1, 2x2, 3x3, 4x4"
+		}
+		if p.DwellSeconds == 0 {
+			p.DwellSeconds = defaultDwellSeconds
+		}
+		if p.DwellSeconds < 5 || p.DwellSeconds > 3600 {
+			fields[at+"dwell_seconds"] = "must be between 5 and 3600"
+		}
+		if len(p.Cameras) > 100 {
+			fields[at+"cameras"] = "must have at most 100 items"
+		}
+		for _, key := range p.Cameras {
+			if !cameras[key] {
+				fields[at+"cameras"] = "Camera " + key + " is not a camera of the bundle"
+				break
+			}
+		}
+	}
+
+	users := map[string]bool{}
+	for i := range b.Users {
+		u := &b.Users[i]
+		at := fmt.Sprintf("users.%d.", i)
+		u.Username = strings.TrimSpace(u.Username)
+		switch {
+		case u.Username == "" || len(u.Username) > 50:
+			fields[at+"username"] = "must be 1 to 50 characters"
+		case users[u.Username]:
+			fields[at+"username"] = "appears more than once"
+		}
+		users[u.Username] = true
+		switch u.Role {
+		case models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator, models.RoleViewer, "user":
+		default:
+			fields[at+"role"] = "must be one of admin, org_admin, operator, viewer, user"
+		}
+		for _, p := range u.Permissions {
+			if !knownPermission(p) {
+				fields[at+"permissions"] = "unknown permission " + p
+			}
+		}
+		if u.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+				fields[at+"password_hash"] = "is not a bcrypt hash"
+			}
+		}
+	}
+	return fields
+}
+
+func knownPermission(p string) bool {
+	for _, known := range models.Permissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// importer writes one bundle inside tx
+type importer struct {
+	ctx    context.Context
+	tx     *sql.Tx
+	cfg    *config.Config
+	orgID  int
+	userID int // the importing user, never modified
+	mode   string
+	result ImportResult
+
+	areaIDs   map[string]int // area name to ID in the organization
+	cameraIDs map[string]int // stream key of the bundle to camera ID
+}
+
+func (im *importer) run(b *ConfigBundle) error {
+	im.areaIDs, im.cameraIDs = map[string]int{}, map[string]int{}
+	steps := []func(*ConfigBundle) error{im.areas, im.cameras, im.settings, im.playlists, im.users}
+	for _, step := range steps {
+		if err := step(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clash records a conflict and resolves it by the import mode: true
+// means the existing record is replaced
+func (im *importer) clash(kind, key, reason string) (overwrite bool) {
+	resolution := ResolutionSkipped
+	if im.mode == ConflictOverwrite {
+		resolution = ResolutionOverwritten
+	}
+	im.note(kind, key, resolution, reason)
+	return im.mode == ConflictOverwrite
+}
+
+func (im *importer) note(kind, key, resolution, reason string) {
+	im.result.Conflicts = append(im.result.Conflicts, ImportConflict{Kind: kind, Key: key, Resolution: resolution, Reason: reason})
+}
+
+func (im *importer) areas(b *ConfigBundle) error {
+	// Areas are written without parents first, so the order of the
+	// bundle does not matter; overwritten ones are then re-parented
+	var parented []BundleArea
+	for _, a := range b.Areas {
+		boundary, _, _ := (&AreaRequest{Boundary: a.Boundary}).parseBoundary()
+		var id int
+		err := im.tx.QueryRowContext(im.ctx, "SELECT id FROM areas WHERE name = ? AND organization_id = ?",
+			a.Name, im.orgID).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			slug, err := im.freeSlug(a.Slug, a.Name, 0)
+			if err != nil {
+				return err
+			}
+			err = im.tx.QueryRowContext(im.ctx, `
+				INSERT INTO areas (name, slug, description, level, rt, rw, kelurahan, kecamatan, boundary,
+				                   organization_id, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				RETURNING id
+			`, a.Name, slug, a.Description, a.Level, a.RT, a.RW, a.Kelurahan, a.Kecamatan, boundary,
+				im.orgID, time.Now()).Scan(&id)
+			if err != nil {
+				return err
+			}
+			im.result.Areas.Created++
+			parented = append(parented, a)
+		case err != nil:
+			return err
+		case im.clash("area", a.Name, "an area with this name exists"):
+			slug, err := im.freeSlug(a.Slug, a.Name, id)
+			if err != nil {
+				return err
+			}
+			if _, err := im.tx.ExecContext(im.ctx, `
+				UPDATE areas SET slug = ?, description = ?, parent_id = NULL, level = ?, rt = ?, rw = ?,
+				                 kelurahan = ?, kecamatan = ?, boundary = ?, updated_at = ?
+				WHERE id = ?
+			`, slug, a.Description, a.Level, a.RT, a.RW, a.Kelurahan, a.Kecamatan, boundary, time.Now(), id); err != nil {
+				return err
+			}
+			im.result.Areas.Updated++
+			parented = append(parented, a)
+		default:
+			im.result.Areas.Skipped++
+		}
+		im.areaIDs[a.Name] = id
+	}
+
+	for _, a := range parented {
+		if a.Parent == "" {
+			continue
+		}
+		if _, err := im.tx.ExecContext(im.ctx, "UPDATE areas SET parent_id = ? WHERE id = ?",
+			im.areaIDs[a.Parent], im.areaIDs[a.Name]); err != nil {
+			return err
+		}
+	}
+	for _, a := range parented {
+		if err := im.checkHierarchy(a.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// freeSlug returns the slug for an area: the bundle's, else one made from
+// the name, numbered from 2 when another area of the organization has it
+func (im *importer) freeSlug(slug, name string, areaID int) (string, error) {
+	base := slug
+	if base == "" {
+		base = models.AreaSlug(name)
+	}
+	slug = base
+	for n := 2; ; n++ {
+		var taken int
+		err := im.tx.QueryRowContext(im.ctx, "SELECT COUNT(*) FROM areas WHERE slug = ? AND organization_id = ? AND id <> ?",
+			slug, im.orgID, areaID).Scan(&taken)
+		if err != nil || taken == 0 {
+			return slug, err
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// checkHierarchy walks up from an imported area; coming back to it means
+// the bundle and the existing areas together form a cycle
+func (im *importer) checkHierarchy(name string) error {
+	id := im.areaIDs[name]
+	current := id
+	for depth := 0; depth < 32; depth++ {
+		var parent sql.NullInt64
+		if err := im.tx.QueryRowContext(im.ctx, "SELECT parent_id FROM areas WHERE id = ?", current).Scan(&parent); err != nil {
+			return err
+		}
+		if !parent.Valid {
+			return nil
+		}
+		if current = int(parent.Int64); current == id {
+			return &service.ValidationError{Field: "areas", Message: "Area " + name + " would be its own ancestor"}
+		}
+	}
+	return &service.ValidationError{Field: "areas", Message: "Area hierarchy is too deep"}
+}
+
+func (im *importer) cameras(b *ConfigBundle) error {
+	for _, cam := range b.Cameras {
+		var areaID *int
+		if cam.Area != "" {
+			id := im.areaIDs[cam.Area]
+			areaID = &id
+		}
+		var node *string
+		if cam.StreamNode != "" {
+			if _, known := im.cfg.Stream().Node(cam.StreamNode); known {
+				node = &cam.StreamNode
+			} else {
+				im.note("camera", cam.StreamKey, ResolutionCleared, "stream node "+cam.StreamNode+" is not configured; the local go2rtc serves it")
+			}
+		}
+
+		key := cam.StreamKey
+		var id, orgID int
+		err := im.tx.QueryRowContext(im.ctx, "SELECT id, organization_id FROM cameras WHERE stream_key = ? ORDER BY id ASC LIMIT 1",
+			key).Scan(&id, &orgID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		exists := err == nil
+
+		if exists && orgID != im.orgID {
+			if key, err = im.freeStreamKey(key); err != nil {
+				return err
+			}
+			im.note("camera", cam.StreamKey, ResolutionRenamed, "the stream key belongs to another organization; imported as "+key)
+			exists = false
+		}
+
+		switch {
+		case !exists:
+			err := im.tx.QueryRowContext(im.ctx, `
+				INSERT INTO cameras (name, private_rtsp_url, description, location,
+				                     group_name, area_id, latitude, longitude, enabled, traffic, watermark, recording_enabled,
+				                     stream_key, stream_node, organization_id, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				RETURNING id
+			`, cam.Name, cam.PrivateRTSPURL, cam.Description, cam.Location, cam.GroupName, areaID, cam.Latitude, cam.Longitude,
+				cam.Enabled, cam.Traffic, cam.Watermark, cam.Recording, key, node, im.orgID, time.Now()).Scan(&id)
+			if err != nil {
+				return err
+			}
+			im.result.Cameras.Created++
+		case im.clash("camera", key, "a camera with this stream key exists"):
+			if _, err := im.tx.ExecContext(im.ctx, `
+				UPDATE cameras
+				SET name = ?, private_rtsp_url = ?, description = ?, location = ?,
+				    group_name = ?, area_id = ?, latitude = ?, longitude = ?, enabled = ?, traffic = ?, watermark = ?,
+				    recording_enabled = ?, stream_node = ?, updated_at = ?
+				WHERE id = ?
+			`, cam.Name, cam.PrivateRTSPURL, cam.Description, cam.Location, cam.GroupName, areaID, cam.Latitude, cam.Longitude,
+				cam.Enabled, cam.Traffic, cam.Watermark, cam.Recording, node, time.Now(), id); err != nil {
+				return err
+			}
+			im.result.Cameras.Updated++
+		default:
+			im.result.Cameras.Skipped++
+		}
+		im.cameraIDs[cam.StreamKey] = id
+	}
+	return nil
+}
+
+// freeStreamKey returns key numbered from 2 so that no camera has it
+func (im *importer) freeStreamKey(key string) (string, error) {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d", key, n)
+		var taken int
+		err := im.tx.QueryRowContext(im.ctx, "SELECT COUNT(*) FROM cameras WHERE stream_key = ?", candidate).Scan(&taken)
+		if err != nil || taken == 0 {
+			return candidate, err
+		}
+	}
+}
+
+func (im *importer) settings(b *ConfigBundle) error {
+	for _, entry := range b.Settings {
+		value, _ := checkSetting(entry)
+		category, description := entry.Category, entry.Description
+		if spec, ok := settingSchema[entry.Key]; ok && category == "" {
+			category = spec.category
+		}
+		if category == "" {
+			category = "general"
+		}
+		if description == "" {
+			description = settingSchema[entry.Key].description
+		}
+
+		var stored string
+		err := im.tx.QueryRowContext(im.ctx, "SELECT value FROM settings WHERE organization_id = ? AND key = ?",
+			im.orgID, entry.Key).Scan(&stored)
+		switch {
+		case err == sql.ErrNoRows:
+			im.result.Settings.Created++
+		case err != nil:
+			return err
+		case stored == value:
+			// Already as exported: not a conflict
+			im.result.Settings.Skipped++
+			continue
+		case im.clash("setting", entry.Key, "the setting has another value"):
+			im.result.Settings.Updated++
+		default:
+			im.result.Settings.Skipped++
+			continue
+		}
+		if _, err := im.tx.ExecContext(im.ctx, `
+			INSERT INTO settings (key, value, category, description, organization_id, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(organization_id, key) DO UPDATE SET value = excluded.value, category = excluded.category,
+				description = excluded.description, updated_at = excluded.updated_at
+		`, entry.Key, value, category, description, im.orgID, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *importer) playlists(b *ConfigBundle) error {
+	for _, p := range b.Playlists {
+		cameraIDs := make([]int, len(p.Cameras))
+		for i, key := range p.Cameras {
+			cameraIDs[i] = im.cameraIDs[key]
+		}
+
+		var id int64
+		err := im.tx.QueryRowContext(im.ctx, "SELECT id FROM playlists WHERE name = ? AND organization_id = ? ORDER BY id ASC LIMIT 1",
+			p.Name, im.orgID).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			hash, err := im.tokenHash(p)
+			if err != nil {
+				return err
+			}
+			now := time.Now().UTC()
+			err = im.tx.QueryRowContext(im.ctx, `
+				INSERT INTO playlists (organization_id, name, layout, dwell_seconds, token_hash, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+				RETURNING id
+			`, im.orgID, p.Name, p.Layout, p.DwellSeconds, hash, now, now).Scan(&id)
+			if err != nil {
+				return err
+			}
+			im.result.Playlists.Created++
+		case err != nil:
+			return err
+		case im.clash("playlist", p.Name, "a playlist with this name exists; its kiosk token is kept"):
+			if _, err := im.tx.ExecContext(im.ctx, "UPDATE playlists SET layout = ?, dwell_seconds = ?, updated_at = ? WHERE id = ?",
+				p.Layout, p.DwellSeconds, time.Now().UTC(), id); err != nil {
+				return err
+			}
+			im.result.Playlists.Updated++
+		default:
+			im.result.Playlists.Skipped++
+			continue
+		}
+		if err := setPlaylistCameras(im.ctx, im.tx, id, cameraIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokenHash keeps the exported kiosk token of a new playlist unless
+// another playlist has it, then issues a new one to be rotated in
+func (im *importer) tokenHash(p BundlePlaylist) (string, error) {
+	if p.TokenHash != "" {
+		var taken int
+		if err := im.tx.QueryRowContext(im.ctx, "SELECT COUNT(*) FROM playlists WHERE token_hash = ?", p.TokenHash).Scan(&taken); err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return p.TokenHash, nil
+		}
+		im.note("playlist", p.Name, ResolutionNewToken, "the kiosk token belongs to another playlist; rotate the token to get a kiosk link")
+	}
+	_, hash, err := newKioskToken()
+	return hash, err
+}
+
+func (im *importer) users(b *ConfigBundle) error {
+	for _, u := range b.Users {
+		var id, orgID int
+		err := im.tx.QueryRowContext(im.ctx, "SELECT id, organization_id FROM users WHERE username = ?", u.Username).Scan(&id, &orgID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		permissions := strings.Join(u.Permissions, ",")
+
+		switch {
+		case err == sql.ErrNoRows:
+			hash := u.PasswordHash
+			if hash == "" {
+				if hash, err = unusablePasswordHash(); err != nil {
+					return err
+				}
+				im.result.PasswordReset = append(im.result.PasswordReset, u.Username)
+			}
+			if _, err := im.tx.ExecContext(im.ctx, `
+				INSERT INTO users (username, email, password_hash, role, permissions, organization_id, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, u.Username, u.Email, hash, u.Role, permissions, im.orgID, time.Now()); err != nil {
+				return err
+			}
+			im.result.Users.Created++
+		case orgID != im.orgID:
+			// Usernames are unique across organizations
+			im.note("user", u.Username, ResolutionSkipped, "the username belongs to another organization")
+			im.result.Users.Skipped++
+		case id == im.userID:
+			im.note("user", u.Username, ResolutionSkipped, "the importing user is never changed")
+			im.result.Users.Skipped++
+		case im.clash("user", u.Username, "a user with this username exists"):
+			if _, err := im.tx.ExecContext(im.ctx, `
+				UPDATE users SET email = ?, role = ?, permissions = ?, password_hash = COALESCE(NULLIF(?, ''), password_hash),
+				                 updated_at = ?
+				WHERE id = ?
+			`, u.Email, u.Role, permissions, u.PasswordHash, time.Now(), id); err != nil {
+				return err
+			}
+			im.result.Users.Updated++
+		default:
+			im.result.Users.Skipped++
+		}
+	}
+	return nil
+}
+
+// unusablePasswordHash hashes a random password nobody knows, for users
+// imported without their hash
+func unusablePasswordHash() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword(b, bcrypt.DefaultCost)
+	return string(hash), err
+}
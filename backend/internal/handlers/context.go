@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// dbContext derives the context for a request's database work, bounded
+// by the configured query timeout so a held SQLite lock or a long scan
+// cannot stall the request forever. Callers must defer cancel.
+func dbContext(c *fiber.Ctx, cfg *config.Config) (context.Context, context.CancelFunc) {
+	if cfg == nil || cfg.Database.QueryTimeout <= 0 {
+		return context.WithCancel(c.UserContext())
+	}
+	return context.WithTimeout(c.UserContext(), cfg.Database.QueryTimeout)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDBContext(t *testing.T) {
+	check := func(t *testing.T, cfg *config.Config, wantDeadline bool) {
+		t.Helper()
+
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			ctx, cancel := dbContext(c, cfg)
+			defer cancel()
+
+			_, ok := ctx.Deadline()
+			if ok != wantDeadline {
+				t.Errorf("Expected deadline %v, got %v", wantDeadline, ok)
+			}
+			return nil
+		})
+
+		if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+	}
+
+	t.Run("Configured timeout", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Database.QueryTimeout = 2 * time.Second
+		check(t, cfg, true)
+	})
+
+	t.Run("No timeout", func(t *testing.T) {
+		check(t, &config.Config{}, false)
+	})
+}
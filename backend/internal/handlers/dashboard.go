@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// systemStatsTTL is how long the figures of every organization are
+// cached; they scan every camera and session of the instance
+const systemStatsTTL = time.Minute
+
+var systemStatsCache = cache.NewGroup("system-stats", systemStatsTTL)
+
+// DashboardCounts are the figures of the dashboard
+type DashboardCounts struct {
+	Cameras        int   `json:"cameras"`
+	ActiveCameras  int   `json:"active_cameras"`
+	Users          int   `json:"users"`
+	Areas          int   `json:"areas"`
+	ActiveViewers  int   `json:"active_viewers"` // seen in the last 5 minutes
+	ViewsToday     int   `json:"views_today"`
+	Recordings     int   `json:"recordings"`
+	RecordingBytes int64 `json:"recording_bytes"`
+}
+
+// SystemStats are the dashboard figures of every organization together
+type SystemStats struct {
+	Organizations int             `json:"organizations"`
+	Totals        DashboardCounts `json:"totals"`
+	GeneratedAt   time.Time       `json:"generated_at"`
+}
+
+// dashboardCounts counts the cameras, users and areas of orgID, and the
+// viewers and recordings of its cameras; orgID 0 counts those of every
+// organization
+func (h *AdminHandler) dashboardCounts(ctx context.Context, orgID int) (DashboardCounts, error) {
+	var n DashboardCounts
+	scope, cameraScope := "", ""
+	var args []interface{}
+	if orgID != 0 {
+		scope = " WHERE organization_id = ?"
+		cameraScope = " AND camera_id IN (SELECT id FROM cameras WHERE organization_id = ?)"
+		args = []interface{}{orgID}
+	}
+	now := time.Now().UTC()
+
+	for _, q := range []struct {
+		query string
+		args  []interface{}
+		dest  []interface{}
+	}{
+		{"SELECT COUNT(*), COALESCE(SUM(CASE WHEN enabled = TRUE THEN 1 ELSE 0 END), 0) FROM cameras" + scope, args,
+			[]interface{}{&n.Cameras, &n.ActiveCameras}},
+		{"SELECT COUNT(*) FROM users" + scope, args, []interface{}{&n.Users}},
+		{"SELECT COUNT(*) FROM areas" + scope, args, []interface{}{&n.Areas}},
+		{`SELECT COUNT(DISTINCT ` + viewerKey("") + `) FROM viewer_sessions
+			WHERE COALESCE(last_seen_at, started_at) > ? AND ended_at IS NULL` + cameraScope,
+			append([]interface{}{now.Add(-5 * time.Minute)}, args...), []interface{}{&n.ActiveViewers}},
+		{"SELECT COUNT(*) FROM viewer_sessions WHERE started_at >= ?" + cameraScope,
+			append([]interface{}{now.Truncate(24 * time.Hour)}, args...), []interface{}{&n.ViewsToday}},
+		{"SELECT COUNT(*), COALESCE(SUM(file_size), 0) FROM recordings WHERE 1 = 1" + cameraScope, args,
+			[]interface{}{&n.Recordings, &n.RecordingBytes}},
+	} {
+		if err := h.db.QueryRowContext(ctx, q.query, q.args...).Scan(q.dest...); err != nil {
+			return DashboardCounts{}, err
+		}
+	}
+	return n, nil
+}
+
+// GetSystemStats - The dashboard figures of every organization
+// together, for admins running the instance. They are cached for a
+// minute; generated_at tells how old they are.
+func (h *AdminHandler) GetSystemStats(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var stats SystemStats
+	err := systemStatsCache.Load(ctx, "all", &stats, func() error {
+		var err error
+		if stats.Totals, err = h.dashboardCounts(ctx, 0); err != nil {
+			return err
+		}
+		stats.GeneratedAt = time.Now().UTC()
+		return h.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM organizations`).Scan(&stats.Organizations)
+	})
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch system statistics")
+	}
+	return response.OK(c, stats)
+}
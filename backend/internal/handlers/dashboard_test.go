@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/sysmon"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDashboardStats(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+
+	now := time.Now().UTC()
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled) VALUES (1, 'Gate', 'rtsp://a', 'gate', TRUE), (2, 'Yard', 'rtsp://b', 'yard', FALSE)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (3, 'Dander', 'rtsp://c', 'dander', 2)`,
+		`INSERT INTO recordings (camera_id, file_path, file_size) VALUES (1, 'gate.mp4', 100), (3, 'dander.mp4', 5000)`,
+	)
+	for i, camera := range []int{1, 1, 3} {
+		if _, err := db.Exec(`INSERT INTO viewer_sessions (camera_id, session_id, started_at, last_seen_at) VALUES (?, ?, ?, ?)`,
+			camera, "s"+strconv.Itoa(i), now, now); err != nil {
+			t.Fatalf("Failed to add session: %v", err)
+		}
+	}
+
+	monitor := sysmon.New(sysmon.Options{})
+	sample := monitor.Sample()
+	h := NewAdminHandler(db, &config.Config{}, monitor)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		c.Locals("role", c.Get("X-Role"))
+		return c.Next()
+	})
+	app.Get("/admin/dashboard", h.GetDashboardStats)
+	app.Get("/admin/stats/system", h.GetSystemStats)
+
+	get := func(path string, org int, role string, v interface{}) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		req.Header.Set("X-Role", role)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected status 200 for %s, got %d", path, resp.StatusCode)
+		}
+		env := struct {
+			Data interface{} `json:"data"`
+		}{v}
+		json.NewDecoder(resp.Body).Decode(&env)
+	}
+
+	type dashboard struct {
+		Summary struct {
+			TotalCameras    int `json:"totalCameras"`
+			OfflineCameras  int `json:"offlineCameras"`
+			ActiveViewers   int `json:"activeViewers"`
+			TotalRecordings int `json:"totalRecordings"`
+		} `json:"summary"`
+		Viewers struct {
+			Today int `json:"today"`
+		} `json:"viewers"`
+		Recordings struct {
+			Size int64 `json:"size"`
+		} `json:"recordings"`
+		System map[string]interface{}   `json:"system"`
+		Logs   []map[string]interface{} `json:"logs"`
+	}
+	var ours dashboard
+	get("/admin/dashboard", 1, models.RoleOrgAdmin, &ours)
+	if s := ours.Summary; s.TotalCameras != 2 || s.OfflineCameras != 1 || s.ActiveViewers != 2 || s.TotalRecordings != 1 ||
+		ours.Viewers.Today != 2 || ours.Recordings.Size != 100 {
+		t.Errorf("Expected the figures of the organization's cameras only, got %+v", ours)
+	}
+	// Memory and CPU load come from the monitor's latest sample
+	if sample.Memory != nil && ours.System["totalMem"] != float64(sample.Memory.TotalBytes) {
+		t.Errorf("Expected total memory %d from the monitor, got %v", sample.Memory.TotalBytes, ours.System["totalMem"])
+	}
+	if _, ok := ours.System["cpuModel"]; ok {
+		t.Errorf("Expected no placeholder CPU model, got %v", ours.System)
+	}
+	// The log volume is that of every organization, for admins only
+	if ours.Logs != nil {
+		t.Errorf("Expected no log figures for an org admin, got %v", ours.Logs)
+	}
+	var admins dashboard
+	get("/admin/dashboard", 1, models.RoleAdmin, &admins)
+	if len(admins.Logs) == 0 {
+		t.Errorf("Expected the log figures for an admin, got %+v", admins)
+	}
+	var theirs dashboard
+	get("/admin/dashboard", 2, models.RoleOrgAdmin, &theirs)
+	if s := theirs.Summary; s.TotalCameras != 1 || s.ActiveViewers != 1 || theirs.Recordings.Size != 5000 {
+		t.Errorf("Expected the other organization's figures, got %+v", theirs)
+	}
+
+	var system SystemStats
+	get("/admin/stats/system", 1, models.RoleAdmin, &system)
+	if system.Organizations != 2 || system.Totals.Cameras != 3 || system.Totals.ActiveViewers != 3 || system.Totals.RecordingBytes != 5100 {
+		t.Errorf("Expected the figures of every organization, got %+v", system)
+	}
+
+	// Served from the cache until it expires
+	db.Exec(`INSERT INTO cameras (name, private_rtsp_url, stream_key) VALUES ('Dock', 'rtsp://d', 'dock')`)
+	var cached SystemStats
+	get("/admin/stats/system", 1, models.RoleAdmin, &cached)
+	if cached.Totals.Cameras != 3 || !cached.GeneratedAt.Equal(system.GeneratedAt) {
+		t.Errorf("Expected the cached figures, got %+v", cached)
+	}
+}
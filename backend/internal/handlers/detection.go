@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/detection"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type DetectionHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewDetectionHandler(db *sql.DB, cfg *config.Config) *DetectionHandler {
+	return &DetectionHandler{db: db, cfg: cfg}
+}
+
+// DetectionRuleRequest is the create/update body for a detection rule;
+// an omitted min_confidence or cooldown falls back to the default
+type DetectionRuleRequest struct {
+	Name            string                 `json:"name" validate:"required,max=100"`
+	CameraID        validate.FlexibleInt   `json:"camera_id" validate:"id"`
+	Label           string                 `json:"label" validate:"required,max=50"`
+	MinConfidence   validate.FlexibleFloat `json:"min_confidence" validate:"min=0,max=1"`
+	CooldownSeconds validate.FlexibleInt   `json:"cooldown_seconds" validate:"min=0,max=86400"`
+	Enabled         validate.FlexibleBool  `json:"enabled"`
+}
+
+const (
+	defaultRuleConfidence = 0.5
+	defaultRuleCooldown   = 300
+)
+
+// GetDetections - Stored object detections, newest first. Filters:
+// label, camera_id, min_confidence, and from/to as RFC 3339 times or
+// YYYY-MM-DD dates. ?cursor= switches to keyset pagination.
+func (h *DetectionHandler) GetDetections(c *fiber.Ctx) error {
+	conds, args, msg := timeRange(c, "created_at")
+	if msg != "" {
+		return response.Fail(c, 400, msg)
+	}
+	if label := detection.NormalizeLabel(c.Query("label")); label != "" {
+		conds = append(conds, "label = ?")
+		args = append(args, label)
+	}
+	if raw := c.Query("camera_id"); raw != "" {
+		id, err := validate.ID(raw)
+		if err != nil || id == nil {
+			return response.Fail(c, 400, "Invalid camera_id")
+		}
+		conds = append(conds, "camera_id = ?")
+		args = append(args, *id)
+	}
+	if raw := c.Query("min_confidence"); raw != "" {
+		min, err := validate.Float(raw)
+		if err != nil || min == nil || *min < 0 || *min > 1 {
+			return response.Fail(c, 400, "Invalid min_confidence, expected a number from 0 to 1")
+		}
+		conds = append(conds, "confidence >= ?")
+		args = append(args, *min)
+	}
+	conds = append(conds, "camera_id IN (SELECT id FROM cameras WHERE organization_id = ?)")
+	args = append(args, tenant.OrgID(c.UserContext()))
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	page, err := response.ParseKeyset(c, 50)
+	if err != nil {
+		return response.Fail(c, 400, "Invalid cursor")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	const columns = `
+		SELECT id, camera_id, motion_event_id, label, confidence, box_x, box_y, box_w, box_h, created_at
+		FROM detections`
+	query, pageArgs := paginate(columns+where+`
+		ORDER BY created_at DESC, id DESC
+	`, append([]interface{}{}, args...), page)
+	if page.Keyset {
+		query, pageArgs = keyset(columns, where, append([]interface{}{}, args...), "id", page)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, pageArgs...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch detections")
+	}
+	defer rows.Close()
+
+	list := []detection.Detection{}
+	var ids []int64
+	for rows.Next() {
+		var d detection.Detection
+		var motionEventID sql.NullInt64
+		if err := rows.Scan(&d.ID, &d.CameraID, &motionEventID, &d.Label, &d.Confidence,
+			&d.Box.X, &d.Box.Y, &d.Box.W, &d.Box.H, &d.CreatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read detection", "error", err)
+			continue
+		}
+		if motionEventID.Valid {
+			d.MotionEventID = &motionEventID.Int64
+		}
+		list = append(list, d)
+		ids = append(ids, d.ID)
+	}
+
+	if page.Keyset {
+		n, meta := keysetMeta(page, ids)
+		return response.Paginated(c, list[:n], meta)
+	}
+
+	total := countTotal(ctx, h.db, page, len(list), "SELECT COUNT(*) FROM detections"+where, args...)
+
+	return response.Paginated(c, list, page.Meta(total))
+}
+
+// GetDetectionRules - All detection alert rules
+func (h *DetectionHandler) GetDetectionRules(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, camera_id, label, min_confidence, cooldown_seconds, enabled, created_at, updated_at
+		FROM detection_rules
+		ORDER BY name ASC, id ASC
+	`)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch detection rules")
+	}
+	defer rows.Close()
+
+	rules := []detection.Rule{}
+	for rows.Next() {
+		var r detection.Rule
+		var cameraID sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.Name, &cameraID, &r.Label, &r.MinConfidence,
+			&r.CooldownSeconds, &r.Enabled, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read detection rule", "error", err)
+			continue
+		}
+		if cameraID.Valid {
+			id := int(cameraID.Int64)
+			r.CameraID = &id
+		}
+		rules = append(rules, r)
+	}
+
+	return response.OK(c, rules)
+}
+
+// CreateDetectionRule - Create a detection alert rule
+func (h *DetectionHandler) CreateDetectionRule(c *fiber.Ctx) error {
+	var req DetectionRuleRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRuleCamera(ctx, c, &req); !ok {
+		return err
+	}
+
+	now := time.Now()
+	var id int64
+	err := h.db.QueryRowContext(ctx, `
+		INSERT INTO detection_rules (name, camera_id, label, min_confidence, cooldown_seconds, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, req.values(now, now)...).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create detection rule")
+	}
+
+	return response.Created(c, "Detection rule created successfully", fiber.Map{
+		"id": id,
+	})
+}
+
+// UpdateDetectionRule - Replace a detection alert rule
+func (h *DetectionHandler) UpdateDetectionRule(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Detection rule not found")
+	}
+
+	var req DetectionRuleRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRuleCamera(ctx, c, &req); !ok {
+		return err
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE detection_rules
+		SET name = ?, camera_id = ?, label = ?, min_confidence = ?, cooldown_seconds = ?, enabled = ?, updated_at = ?
+		WHERE id = ?
+	`, append(req.values(time.Now()), id)...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update detection rule")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Detection rule not found")
+	}
+
+	return response.Message(c, "Detection rule updated successfully")
+}
+
+// DeleteDetectionRule - Delete a detection alert rule
+func (h *DetectionHandler) DeleteDetectionRule(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Detection rule not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM detection_rules WHERE id = ?", id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete detection rule")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Detection rule not found")
+	}
+
+	return response.Message(c, "Detection rule deleted successfully")
+}
+
+// checkRuleCamera rejects a rule for a camera that does not exist. When
+// ok is false the response has been written and the handler should
+// return err.
+func (h *DetectionHandler) checkRuleCamera(ctx context.Context, c *fiber.Ctx, req *DetectionRuleRequest) (ok bool, err error) {
+	cameraID := req.CameraID.ID()
+	if cameraID == nil {
+		return true, nil
+	}
+	found, err := cameraExists(ctx, h.db, *cameraID)
+	if err != nil {
+		return false, serviceError(c, err, "", "Failed to save detection rule")
+	}
+	if !found {
+		return false, invalidFields(c, "", map[string]string{"camera_id": "Camera not found"})
+	}
+	return true, nil
+}
+
+// values are the rule columns in insert/update order, followed by the
+// given timestamps
+func (r *DetectionRuleRequest) values(times ...time.Time) []interface{} {
+	confidence := defaultRuleConfidence
+	if r.MinConfidence.Set {
+		confidence = r.MinConfidence.Float
+	}
+	cooldown := defaultRuleCooldown
+	if r.CooldownSeconds.Set {
+		cooldown = r.CooldownSeconds.Int
+	}
+
+	values := []interface{}{strings.TrimSpace(r.Name), r.CameraID.ID(), detection.NormalizeLabel(r.Label),
+		confidence, cooldown, r.Enabled.Bool}
+	for _, t := range times {
+		values = append(values, t)
+	}
+	return values
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDetectionHandler(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`)
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, d := range []struct {
+		label      string
+		confidence float64
+	}{{"person", 0.9}, {"person", 0.6}, {"car", 0.8}} {
+		if _, err := db.Exec(`INSERT INTO detections (camera_id, label, confidence, created_at) VALUES (1, ?, ?, ?)`, d.label, d.confidence, at); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	h := NewDetectionHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Get("/detections", h.GetDetections)
+	app.Get("/detections/rules", h.GetDetectionRules)
+	app.Post("/detections/rules", h.CreateDetectionRule)
+	app.Put("/detections/rules/:id", h.UpdateDetectionRule)
+	app.Delete("/detections/rules/:id", h.DeleteDetectionRule)
+
+	do := func(method, path, body string) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	t.Run("Search", func(t *testing.T) {
+		status, env := do("GET", "/detections?label=Person&min_confidence=0.7", "")
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		list := env.Data.([]interface{})
+		if len(list) != 1 || list[0].(map[string]interface{})["confidence"] != 0.9 {
+			t.Errorf("Expected the confident person, got %v", list)
+		}
+	})
+
+	t.Run("Invalid min_confidence", func(t *testing.T) {
+		if status, _ := do("GET", "/detections?min_confidence=2", ""); status != 400 {
+			t.Errorf("Expected status 400, got %d", status)
+		}
+	})
+
+	t.Run("Rule for a missing camera", func(t *testing.T) {
+		status, env := do("POST", "/detections/rules", `{"name":"Yard","camera_id":9,"label":"person"}`)
+		if status != 422 || env.Error.Fields["camera_id"] == "" {
+			t.Errorf("Expected a 422 for camera_id, got %d (%+v)", status, env.Error)
+		}
+	})
+
+	t.Run("Rule lifecycle", func(t *testing.T) {
+		status, env := do("POST", "/detections/rules", `{"name":"Gate person","camera_id":"1","label":"Person","enabled":true}`)
+		if status != 201 {
+			t.Fatalf("Expected status 201, got %d (%+v)", status, env.Error)
+		}
+
+		_, env = do("GET", "/detections/rules", "")
+		rules := env.Data.([]interface{})
+		if len(rules) != 1 {
+			t.Fatalf("Expected 1 rule, got %v", rules)
+		}
+		rule := rules[0].(map[string]interface{})
+		if rule["label"] != "person" || rule["min_confidence"] != 0.5 || rule["cooldown_seconds"] != float64(300) {
+			t.Errorf("Expected a normalised rule with defaults, got %v", rule)
+		}
+
+		if status, env := do("PUT", "/detections/rules/1", `{"name":"Any car","label":"car","min_confidence":0.7}`); status != 200 {
+			t.Errorf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		_, env = do("GET", "/detections/rules", "")
+		rule = env.Data.([]interface{})[0].(map[string]interface{})
+		if rule["camera_id"] != nil || rule["enabled"] != false {
+			t.Errorf("Expected the rule to be replaced, got %v", rule)
+		}
+
+		if status, _ := do("DELETE", "/detections/rules/1", ""); status != 200 {
+			t.Errorf("Expected status 200, got %d", status)
+		}
+		if status, _ := do("DELETE", "/detections/rules/1", ""); status != 404 {
+			t.Errorf("Expected status 404, got %d", status)
+		}
+	})
+}
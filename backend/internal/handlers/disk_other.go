@@ -0,0 +1,10 @@
+//go:build !unix
+
+package handlers
+
+import "errors"
+
+// freeBytes is not implemented on this platform
+func freeBytes(path string) (uint64, error) {
+	return 0, errors.New("free space is not available on this platform")
+}
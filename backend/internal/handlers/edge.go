@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/edge"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/outages"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type EdgeHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+	hub *edge.Hub
+}
+
+func NewEdgeHandler(db *sql.DB, cfg *config.Config, hub *edge.Hub) *EdgeHandler {
+	return &EdgeHandler{db: db, cfg: cfg, hub: hub}
+}
+
+// EdgeNodeRequest is the create body for an edge node
+type EdgeNodeRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// EdgeCamerasRequest lists the cameras an edge node relays
+type EdgeCamerasRequest struct {
+	CameraIDs []int `json:"camera_ids" validate:"max=500"`
+}
+
+// edgeOfflineAfter heartbeats missed mark a node offline
+const edgeOfflineAfter = 3
+
+// GetEdgeNodes - Edge nodes of the organization with their state
+func (h *EdgeHandler) GetEdgeNodes(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, version, remote_addr, last_seen_at, created_at, updated_at
+		FROM edge_nodes
+		WHERE organization_id = ?
+		ORDER BY name ASC, id ASC
+	`, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch edge nodes")
+	}
+	defer rows.Close()
+
+	list := []models.EdgeNode{}
+	for rows.Next() {
+		var n models.EdgeNode
+		if err := rows.Scan(&n.ID, &n.Name, &n.Version, &n.RemoteAddr, &n.LastSeenAt, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read edge node", "error", err)
+			continue
+		}
+		list = append(list, n)
+	}
+	rows.Close()
+
+	cutoff := time.Now().Add(-edgeOfflineAfter * h.cfg.Edge.HeartbeatInterval)
+	for i := range list {
+		n := &list[i]
+		n.Online = n.LastSeenAt != nil && n.LastSeenAt.After(cutoff)
+		n.Tunnels = h.hub.Idle(n.ID)
+		if n.CameraIDs, err = h.cameraIDs(ctx, n.ID); err != nil {
+			return serviceError(c, err, "", "Failed to fetch edge nodes")
+		}
+	}
+
+	return response.OK(c, list)
+}
+
+// CreateEdgeNode - Add an edge node. The response holds the agent's
+// token, which is not shown again.
+func (h *EdgeHandler) CreateEdgeNode(c *fiber.Ctx) error {
+	var req EdgeNodeRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	token, hash, err := newKioskToken()
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create edge node")
+	}
+
+	now := time.Now().UTC()
+	var id int64
+	err = h.db.QueryRowContext(ctx, `
+		INSERT INTO edge_nodes (organization_id, name, token_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, tenant.OrgID(ctx), strings.TrimSpace(req.Name), hash, now, now).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create edge node")
+	}
+
+	return response.Created(c, "Edge node created successfully", fiber.Map{
+		"id":    id,
+		"token": token,
+	})
+}
+
+// SetEdgeNodeCameras - Replace the cameras an edge node relays. Cameras
+// taken off the node are played from the local go2rtc again.
+func (h *EdgeHandler) SetEdgeNodeCameras(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Edge node not found")
+	}
+	var req EdgeCamerasRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if status, msg := h.checkNode(ctx, id); status != 0 {
+		return response.Fail(c, status, msg)
+	}
+	for _, cameraID := range req.CameraIDs {
+		found, err := cameraExists(ctx, h.db, cameraID)
+		if err != nil {
+			return serviceError(c, err, "", "Failed to update edge node")
+		}
+		if !found {
+			return invalidFields(c, "", map[string]string{"camera_ids": "Camera not found"})
+		}
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update edge node")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE cameras SET edge_node_id = NULL WHERE edge_node_id = ?`, id); err != nil {
+		return serviceError(c, err, "", "Failed to update edge node")
+	}
+	for _, cameraID := range req.CameraIDs {
+		if _, err := tx.ExecContext(ctx, `UPDATE cameras SET edge_node_id = ? WHERE id = ?`, id, cameraID); err != nil {
+			return serviceError(c, err, "", "Failed to update edge node")
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE edge_nodes SET updated_at = ? WHERE id = ?`, time.Now().UTC(), id); err != nil {
+		return serviceError(c, err, "", "Failed to update edge node")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to update edge node")
+	}
+	forgetStreamCameras(ctx)
+
+	return response.Message(c, "Edge node updated successfully")
+}
+
+// RotateEdgeNodeToken - Replace an edge node's token. The agent is
+// disconnected until it is given the new one.
+func (h *EdgeHandler) RotateEdgeNodeToken(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Edge node not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	token, hash, err := newKioskToken()
+	if err != nil {
+		return serviceError(c, err, "", "Failed to rotate token")
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE edge_nodes SET token_hash = ?, updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, hash, time.Now().UTC(), id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to rotate token")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Edge node not found")
+	}
+	h.hub.Disconnect(id)
+
+	return response.OK(c, fiber.Map{"token": token})
+}
+
+// DeleteEdgeNode - Delete an edge node; its cameras are played from the
+// local go2rtc again
+func (h *EdgeHandler) DeleteEdgeNode(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Edge node not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if status, msg := h.checkNode(ctx, id); status != 0 {
+		return response.Fail(c, status, msg)
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete edge node")
+	}
+	defer tx.Rollback()
+
+	// The foreign key does the same where it is enforced
+	if _, err := tx.ExecContext(ctx, `UPDATE cameras SET edge_node_id = NULL WHERE edge_node_id = ?`, id); err != nil {
+		return serviceError(c, err, "", "Failed to delete edge node")
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM edge_nodes WHERE id = ?`, id); err != nil {
+		return serviceError(c, err, "", "Failed to delete edge node")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to delete edge node")
+	}
+	forgetStreamCameras(ctx)
+	h.hub.Disconnect(id)
+
+	return response.Message(c, "Edge node deleted successfully")
+}
+
+// OpenTunnel - An agent opens a tunnel: the request is answered with 101
+// and the connection kept for the stream requests of its cameras
+func (h *EdgeHandler) OpenTunnel(c *fiber.Ctx) error {
+	nodeID, status, msg := h.agentNode(c)
+	if status != 0 {
+		return response.Fail(c, status, msg)
+	}
+	if !strings.EqualFold(c.Get(fiber.HeaderUpgrade), edge.Protocol) {
+		c.Set(fiber.HeaderUpgrade, edge.Protocol)
+		return response.Fail(c, fiber.StatusUpgradeRequired, "Upgrade to "+edge.Protocol+" required")
+	}
+
+	c.Set(fiber.HeaderUpgrade, edge.Protocol)
+	c.Set(fiber.HeaderConnection, "Upgrade")
+	c.Status(fiber.StatusSwitchingProtocols)
+	c.Context().Hijack(func(conn net.Conn) {
+		h.hub.Attach(nodeID, conn)
+	})
+	return nil
+}
+
+// Heartbeat - An agent reports the health of its cameras and gets the
+// cameras it relays, with their RTSP sources, in return
+func (h *EdgeHandler) Heartbeat(c *fiber.Ctx) error {
+	nodeID, status, msg := h.agentNode(c)
+	if status != 0 {
+		return response.Fail(c, status, msg)
+	}
+	var report edge.Report
+	if ok, err := bind(c, &report); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	now := time.Now().UTC()
+	if _, err := h.db.ExecContext(ctx, `
+		UPDATE edge_nodes SET version = ?, remote_addr = ?, last_seen_at = ? WHERE id = ?
+	`, report.Version, c.IP(), now, nodeID); err != nil {
+		return serviceError(c, err, "", "Failed to record heartbeat")
+	}
+
+	// Only the node's own cameras take its word for their health
+	for _, s := range report.Cameras {
+		health, errorMessage := "offline", s.Error
+		if s.Online {
+			health, errorMessage = "online", ""
+		}
+		var cameraID int
+		err := h.db.QueryRowContext(ctx, `SELECT id FROM cameras WHERE stream_key = ? AND edge_node_id = ?`,
+			s.StreamKey, nodeID).Scan(&cameraID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return serviceError(c, err, "", "Failed to record heartbeat")
+		}
+		if _, err := h.db.ExecContext(ctx, `
+			INSERT INTO camera_health (camera_id, status, last_check, error_message, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (camera_id) DO UPDATE SET status = excluded.status, last_check = excluded.last_check,
+				error_message = excluded.error_message, updated_at = excluded.updated_at
+		`, cameraID, health, now, errorMessage, now); err != nil {
+			return serviceError(c, err, "", "Failed to record heartbeat")
+		}
+		if err := outages.Record(ctx, h.db, cameraID, s.Online, errorMessage, now); err != nil {
+			return serviceError(c, err, "", "Failed to record heartbeat")
+		}
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT stream_key, private_rtsp_url FROM cameras
+		WHERE edge_node_id = ? AND enabled = TRUE
+		ORDER BY id ASC
+	`, nodeID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch cameras")
+	}
+	defer rows.Close()
+
+	assignment := edge.Assignment{Cameras: []edge.AssignedCamera{}}
+	for rows.Next() {
+		var cam edge.AssignedCamera
+		if err := rows.Scan(&cam.StreamKey, &cam.RTSPURL); err != nil {
+			return serviceError(c, err, "", "Failed to fetch cameras")
+		}
+		assignment.Cameras = append(assignment.Cameras, cam)
+	}
+	if err := rows.Err(); err != nil {
+		return serviceError(c, err, "", "Failed to fetch cameras")
+	}
+
+	return response.OK(c, assignment)
+}
+
+// agentNode returns the edge node whose token the request carries
+func (h *EdgeHandler) agentNode(c *fiber.Ctx) (int, int, string) {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		return 0, 401, "Edge token required"
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var id int
+	err := h.db.QueryRowContext(ctx, `SELECT id FROM edge_nodes WHERE token_hash = ?`, hashKioskToken(token)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 401, "Invalid edge token"
+	}
+	if err != nil {
+		logger.FromContext(c.UserContext()).Error("Failed to look up edge node", "error", err)
+		return 0, 500, "Failed to look up edge node"
+	}
+	return id, 0, ""
+}
+
+// checkNode returns a zero status when node id belongs to the
+// organization
+func (h *EdgeHandler) checkNode(ctx context.Context, id int) (int, string) {
+	var found int
+	err := h.db.QueryRowContext(ctx, `SELECT 1 FROM edge_nodes WHERE id = ? AND organization_id = ?`, id, tenant.OrgID(ctx)).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 404, "Edge node not found"
+	}
+	if err != nil {
+		return 500, "Failed to fetch edge node"
+	}
+	return 0, ""
+}
+
+// cameraIDs returns the cameras edge node id relays
+func (h *EdgeHandler) cameraIDs(ctx context.Context, id int) ([]int, error) {
+	rows, err := h.db.QueryContext(ctx, `SELECT id FROM cameras WHERE edge_node_id = ? ORDER BY id ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var cameraID int
+		if err := rows.Scan(&cameraID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, cameraID)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/edge"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func openEdgeTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES
+		(1, 'Gate', 'rtsp://192.0.2.10/live', 'gate'), (2, 'Market', 'rtsp://b', 'market')`)
+	return db
+}
+
+func TestEdgeNodes(t *testing.T) {
+	db := openEdgeTestDB(t)
+	cfg := &config.Config{Edge: config.EdgeConfig{HeartbeatInterval: 30 * time.Second}}
+	h := NewEdgeHandler(db, cfg, edge.NewHub(context.Background()))
+
+	app := fiber.New()
+	app.Get("/edge-nodes", h.GetEdgeNodes)
+	app.Post("/edge-nodes", h.CreateEdgeNode)
+	app.Put("/edge-nodes/:id/cameras", h.SetEdgeNodeCameras)
+	app.Post("/edge-nodes/:id/token", h.RotateEdgeNodeToken)
+	app.Delete("/edge-nodes/:id", h.DeleteEdgeNode)
+	app.Post("/edge/heartbeat", h.Heartbeat)
+	app.Get("/edge/tunnel", h.OpenTunnel)
+
+	do := func(method, path, body, token string) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	var token string
+
+	t.Run("Create", func(t *testing.T) {
+		status, env := do("POST", "/edge-nodes", `{"name":"Hamlet"}`, "")
+		if status != 201 {
+			t.Fatalf("Expected status 201, got %d (%+v)", status, env.Error)
+		}
+		token, _ = env.Data.(map[string]interface{})["token"].(string)
+		if token == "" {
+			t.Fatal("Expected a token")
+		}
+		if status, _ := do("POST", "/edge-nodes", `{"name":""}`, ""); status != 422 {
+			t.Errorf("Expected status 422 without a name, got %d", status)
+		}
+	})
+
+	t.Run("Assign cameras", func(t *testing.T) {
+		if status, env := do("PUT", "/edge-nodes/1/cameras", `{"camera_ids":[1]}`, ""); status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		if status, _ := do("PUT", "/edge-nodes/1/cameras", `{"camera_ids":[9]}`, ""); status != 422 {
+			t.Errorf("Expected status 422 for an unknown camera, got %d", status)
+		}
+		if status, _ := do("PUT", "/edge-nodes/9/cameras", `{"camera_ids":[1]}`, ""); status != 404 {
+			t.Errorf("Expected status 404 for an unknown node, got %d", status)
+		}
+	})
+
+	t.Run("Heartbeat", func(t *testing.T) {
+		if status, _ := do("POST", "/edge/heartbeat", `{}`, "wrong"); status != 401 {
+			t.Errorf("Expected status 401 for a bad token, got %d", status)
+		}
+
+		report := `{"version":"v1.2.0","cameras":[
+			{"stream_key":"gate","online":false,"error":"connection refused"},
+			{"stream_key":"market","online":false}]}`
+		status, env := do("POST", "/edge/heartbeat", report, token)
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		data, _ := json.Marshal(env.Data)
+		var assignment edge.Assignment
+		json.Unmarshal(data, &assignment)
+		if len(assignment.Cameras) != 1 || assignment.Cameras[0].StreamKey != "gate" ||
+			assignment.Cameras[0].RTSPURL != "rtsp://192.0.2.10/live" {
+			t.Errorf("Expected the gate camera assigned, got %+v", assignment.Cameras)
+		}
+
+		var health, message string
+		if err := db.QueryRow(`SELECT status, error_message FROM camera_health WHERE camera_id = 1`).Scan(&health, &message); err != nil {
+			t.Fatalf("Expected health recorded for the gate camera: %v", err)
+		}
+		if health != "offline" || message != "connection refused" {
+			t.Errorf("Expected offline with the agent's error, got %s %q", health, message)
+		}
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM camera_health WHERE camera_id = 2`).Scan(&n)
+		if n != 0 {
+			t.Error("Expected no health recorded for a camera the node does not relay")
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		status, env := do("GET", "/edge-nodes", "", "")
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		nodes, _ := env.Data.([]interface{})
+		if len(nodes) != 1 {
+			t.Fatalf("Expected one node, got %v", env.Data)
+		}
+		node := nodes[0].(map[string]interface{})
+		if node["online"] != true || node["version"] != "v1.2.0" {
+			t.Errorf("Expected the node online at v1.2.0, got %v", node)
+		}
+		if ids, _ := node["camera_ids"].([]interface{}); len(ids) != 1 || ids[0] != float64(1) {
+			t.Errorf("Expected camera 1, got %v", node["camera_ids"])
+		}
+	})
+
+	t.Run("Tunnel needs an upgrade", func(t *testing.T) {
+		if status, _ := do("GET", "/edge/tunnel", "", token); status != 426 {
+			t.Errorf("Expected status 426, got %d", status)
+		}
+	})
+
+	t.Run("Rotate token", func(t *testing.T) {
+		status, env := do("POST", "/edge-nodes/1/token", "", "")
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		if status, _ := do("POST", "/edge/heartbeat", `{}`, token); status != 401 {
+			t.Errorf("Expected the old token refused, got %d", status)
+		}
+		token = env.Data.(map[string]interface{})["token"].(string)
+		if status, _ := do("POST", "/edge/heartbeat", `{}`, token); status != 200 {
+			t.Errorf("Expected the new token accepted, got %d", status)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if status, _ := do("DELETE", "/edge-nodes/1", "", ""); status != 200 {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM cameras WHERE edge_node_id IS NOT NULL`).Scan(&n)
+		if n != 0 {
+			t.Error("Expected the cameras released")
+		}
+		if status, _ := do("POST", "/edge/heartbeat", `{}`, token); status != 401 {
+			t.Errorf("Expected the deleted node's token refused, got %d", status)
+		}
+	})
+}
+
+func TestEdgeTunnel(t *testing.T) {
+	useMemoryCache(t)
+	db := openEdgeTestDB(t)
+	token, hash, err := newKioskToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO edge_nodes (id, name, token_hash) VALUES (1, 'Hamlet', ?)`, hash); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE cameras SET edge_node_id = 1 WHERE id = 1`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	// The go2rtc at the remote site
+	var mu sync.Mutex
+	var registered []string
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/streams":
+			mu.Lock()
+			registered = append(registered, r.URL.Query().Get("name")+" "+r.URL.Query().Get("src"))
+			mu.Unlock()
+		case "/api/stream.mp4":
+			w.Write([]byte("site:" + r.URL.Query().Get("src")))
+		}
+	}))
+	defer site.Close()
+
+	// The local go2rtc must not be asked for edge cameras
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("local:" + r.URL.Query().Get("src")))
+	}))
+	defer local.Close()
+
+	stopping, stop := context.WithCancel(context.Background())
+	hub := edge.NewHub(stopping)
+	cfg := &config.Config{
+		Go2RTC: config.Go2RTCConfig{APIURL: local.URL, BreakerFailures: 100},
+		Edge:   config.EdgeConfig{HeartbeatInterval: time.Hour},
+	}
+	h := NewEdgeHandler(db, cfg, hub)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/api/edge/tunnel", h.OpenTunnel)
+	app.Post("/api/edge/heartbeat", h.Heartbeat)
+	app.Get("/mse/:streamKey", NewStreamHandler(db, cfg, hub, nil, context.Background()).ProxyMSE)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agent := &edge.Agent{
+		ServerURL: "http://" + ln.Addr().String(),
+		Token:     token,
+		Go2RTCURL: site.URL,
+		Tunnels:   2,
+		Interval:  time.Hour,
+	}
+	done := make(chan error, 1)
+	go func() { done <- agent.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.Idle(1) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the agent to open 2 tunnels, got %d", hub.Idle(1))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	if len(registered) != 1 || registered[0] != "gate rtsp://192.0.2.10/live" {
+		t.Errorf("Expected the agent to register its camera, got %q", registered)
+	}
+	mu.Unlock()
+
+	get := func(path string) string {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil), 10000)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			t.Errorf("Expected status 200 for %s, got %d", path, resp.StatusCode)
+		}
+		return string(body)
+	}
+
+	// More requests than tunnels: the agent replaces the ones used
+	for i := 0; i < 4; i++ {
+		if body := get("/mse/gate"); body != "site:gate" {
+			t.Errorf("Expected the stream from the site, got %q", body)
+		}
+	}
+	if body := get("/mse/market"); body != "local:market" {
+		t.Errorf("Expected other cameras from the local go2rtc, got %q", body)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected the agent to stop cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the agent to stop")
+	}
+}
+
+func TestEdgeAgent_BadToken(t *testing.T) {
+	db := openEdgeTestDB(t)
+	h := NewEdgeHandler(db, &config.Config{}, edge.NewHub(context.Background()))
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Post("/api/edge/heartbeat", h.Heartbeat)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	agent := &edge.Agent{ServerURL: "http://" + ln.Addr().String(), Token: "wrong", Tunnels: 1, Interval: time.Hour}
+	if err := agent.Run(context.Background()); err != edge.ErrUnauthorized {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/abcdefak87/cctv/internal/service"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// paramID reads the :id route parameter. Non-numeric IDs cannot match a
+// row, so callers treat ok == false as not found.
+func paramID(c *fiber.Ctx) (int, bool) {
+	id, err := strconv.Atoi(c.Params("id"))
+	return id, err == nil && id > 0
+}
+
+// serviceError maps a service error to a response: validation errors
+// are shown to the client (422 when tied to a field, otherwise 400), a
+// missing row is 404, a query that ran past its timeout is 503, anything
+// else is 500 with the generic failure message.
+func serviceError(c *fiber.Ctx, err error, notFound, failed string) error {
+	var invalid *service.ValidationError
+	switch {
+	case errors.As(err, &invalid) && invalid.Field != "":
+		return invalidFields(c, invalid.Message, map[string]string{invalid.Field: invalid.Message})
+	case errors.As(err, &invalid):
+		return response.Fail(c, 400, invalid.Message)
+	case errors.Is(err, service.ErrNotFound):
+		return response.Fail(c, 404, notFound)
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.FromContext(c.UserContext()).Warn("Query timed out", "error", err)
+		return response.Fail(c, 503, "Database is busy, please retry")
+	default:
+		logger.FromContext(c.UserContext()).Error(failed, "error", err)
+		return response.Fail(c, 500, failed)
+	}
+}
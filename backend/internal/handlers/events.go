@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/gofiber/fiber/v2"
+)
+
+// publish sends e on the event bus, attributed to the signed-in user and
+// client IP unless the caller already set them. Events of an admin
+// acting as another user name the admin as impersonator_id.
+func publish(c *fiber.Ctx, e events.Event) {
+	if e.UserID == nil {
+		if id, ok := c.Locals("user_id").(int); ok {
+			e.UserID = &id
+		}
+	}
+	if e.IP == "" {
+		e.IP = c.IP()
+	}
+	if id, ok := c.Locals("impersonator_id").(int); ok {
+		data := map[string]interface{}{"impersonator_id": id}
+		for k, v := range e.Data {
+			data[k] = v
+		}
+		e.Data = data
+	}
+	events.Publish(e)
+}
@@ -2,12 +2,22 @@ package handlers
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/response"
 	"github.com/gofiber/fiber/v2"
 )
 
+// validFeedbackStatuses mirrors the statuses shown in the admin panel;
+// keep the oneof rule in UpdateFeedbackStatus in step
+var validFeedbackStatuses = map[string]bool{
+	"unread":   true,
+	"read":     true,
+	"resolved": true,
+}
+
 type FeedbackHandler struct {
 	db  *sql.DB
 	cfg *config.Config
@@ -19,238 +29,212 @@ func NewFeedbackHandler(db *sql.DB, cfg *config.Config) *FeedbackHandler {
 
 // GetAllFeedback - Get all feedback (admin only)
 func (h *FeedbackHandler) GetAllFeedback(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	status := c.Query("status", "")
+	moderation := c.Query("moderation", "")
+	page := response.ParsePage(c, 20)
 	
 	query := `
-		SELECT id, name, email, message, status, created_at, updated_at
+		SELECT id, COALESCE(name, ''), COALESCE(email, ''), message, status,
+		       moderation, public_message, anonymize, created_at, updated_at
 		FROM feedback
 	`
 	
+	countQuery := "SELECT COUNT(*) FROM feedback"
+	var conditions []string
 	args := []interface{}{}
 	if status != "" {
-		query += " WHERE status = ?"
+		conditions = append(conditions, "status = ?")
 		args = append(args, status)
 	}
+	if moderation != "" {
+		conditions = append(conditions, "moderation = ?")
+		args = append(args, moderation)
+	}
+	if len(conditions) > 0 {
+		where := " WHERE " + strings.Join(conditions, " AND ")
+		query += where
+		countQuery += where
+	}
 	
 	query += " ORDER BY created_at DESC"
+	total := countTotal(ctx, h.db, page, 0, countQuery, args...)
+	query, pageArgs := paginate(query, append([]interface{}{}, args...), page)
 
-	rows, err := h.db.Query(query, args...)
+	rows, err := h.db.QueryContext(ctx, query, pageArgs...)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch feedback",
-		})
+		return response.Fail(c, 500, "Failed to fetch feedback")
 	}
 	defer rows.Close()
 
 	feedbacks := []map[string]interface{}{}
 	for rows.Next() {
 		var id int
-		var name, email, message, status string
+		var name, email, message, status, moderation, publicMessage string
+		var anonymize bool
 		var createdAt, updatedAt time.Time
 
-		err := rows.Scan(&id, &name, &email, &message, &status, &createdAt, &updatedAt)
+		err := rows.Scan(&id, &name, &email, &message, &status, &moderation, &publicMessage, &anonymize, &createdAt, &updatedAt)
 		if err != nil {
 			continue
 		}
 
 		feedbacks = append(feedbacks, map[string]interface{}{
-			"id":         id,
-			"name":       name,
-			"email":      email,
-			"message":    message,
-			"status":     status,
-			"created_at": createdAt,
-			"updated_at": updatedAt,
+			"id":             id,
+			"name":           name,
+			"email":          email,
+			"message":        message,
+			"status":         status,
+			"moderation":     moderation,
+			"public_message": publicMessage,
+			"anonymize":      anonymize,
+			"created_at":     createdAt,
+			"updated_at":     updatedAt,
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    feedbacks,
-	})
+	return response.Paginated(c, feedbacks, page.Meta(total))
 }
 
 // GetFeedback - Get single feedback by ID
 func (h *FeedbackHandler) GetFeedback(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	id := c.Params("id")
 
 	var feedbackID int
-	var name, email, message, status string
+	var name, email, message, status, moderation, publicMessage string
+	var anonymize bool
 	var createdAt, updatedAt time.Time
 
-	err := h.db.QueryRow(`
-		SELECT id, name, email, message, status, created_at, updated_at
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id, COALESCE(name, ''), COALESCE(email, ''), message, status,
+		       moderation, public_message, anonymize, created_at, updated_at
 		FROM feedback WHERE id = ?
-	`, id).Scan(&feedbackID, &name, &email, &message, &status, &createdAt, &updatedAt)
+	`, id).Scan(&feedbackID, &name, &email, &message, &status, &moderation, &publicMessage, &anonymize, &createdAt, &updatedAt)
 
 	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Feedback not found",
-		})
+		return response.Fail(c, 404, "Feedback not found")
 	}
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch feedback",
-		})
+		return response.Fail(c, 500, "Failed to fetch feedback")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": map[string]interface{}{
-			"id":         feedbackID,
-			"name":       name,
-			"email":      email,
-			"message":    message,
-			"status":     status,
-			"created_at": createdAt,
-			"updated_at": updatedAt,
-		},
+	return response.OK(c, map[string]interface{}{
+		"id":             feedbackID,
+		"name":           name,
+		"email":          email,
+		"message":        message,
+		"status":         status,
+		"moderation":     moderation,
+		"public_message": publicMessage,
+		"anonymize":      anonymize,
+		"created_at":     createdAt,
+		"updated_at":     updatedAt,
 	})
 }
 
 // CreateFeedback - Submit new feedback (public)
 func (h *FeedbackHandler) CreateFeedback(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	var req struct {
-		Name    string `json:"name"`
-		Email   string `json:"email"`
-		Message string `json:"message"`
+		Name    string `json:"name" validate:"required,max=100"`
+		Email   string `json:"email" validate:"email,max=255"`
+		Message string `json:"message" validate:"required,max=5000"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
+	if ok, err := bind(c, &req); !ok {
+		return err
 	}
 
-	// Validation
-	if req.Name == "" || req.Message == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Name and message are required",
-		})
-	}
-
-	result, err := h.db.Exec(`
-		INSERT INTO feedback (name, email, message, status, updated_at)
-		VALUES (?, ?, ?, 'pending', ?)
-	`, req.Name, req.Email, req.Message, time.Now())
+	var id int64
+	err := h.db.QueryRowContext(ctx, `
+		INSERT INTO feedback (name, email, message, status, ip_address, updated_at)
+		VALUES (?, ?, ?, 'unread', ?, ?)
+		RETURNING id
+	`, req.Name, req.Email, req.Message, c.IP(), time.Now()).Scan(&id)
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to submit feedback",
-		})
+		return response.Fail(c, 500, "Failed to submit feedback")
 	}
 
-	id, _ := result.LastInsertId()
-
-	return c.Status(201).JSON(fiber.Map{
-		"success": true,
-		"message": "Feedback submitted successfully",
-		"data": fiber.Map{
-			"id": id,
-		},
+	return response.Created(c, "Feedback submitted successfully", fiber.Map{
+		"id": id,
 	})
 }
 
 // UpdateFeedbackStatus - Update feedback status (admin only)
 func (h *FeedbackHandler) UpdateFeedbackStatus(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	id := c.Params("id")
 
 	var req struct {
-		Status string `json:"status"`
+		Status string `json:"status" validate:"required,oneof=unread read resolved"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
-	}
-
-	// Validate status
-	validStatuses := map[string]bool{
-		"pending":   true,
-		"reviewed":  true,
-		"resolved":  true,
-		"dismissed": true,
+	if ok, err := bind(c, &req); !ok {
+		return err
 	}
 
-	if !validStatuses[req.Status] {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid status",
-		})
-	}
-
-	result, err := h.db.Exec(`
+	result, err := h.db.ExecContext(ctx, `
 		UPDATE feedback 
 		SET status = ?, updated_at = ?
 		WHERE id = ?
 	`, req.Status, time.Now(), id)
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to update feedback",
-		})
+		return response.Fail(c, 500, "Failed to update feedback")
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Feedback not found",
-		})
+		return response.Fail(c, 404, "Feedback not found")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Feedback status updated successfully",
-	})
+	return response.Message(c, "Feedback status updated successfully")
 }
 
 // DeleteFeedback - Delete feedback (admin only)
 func (h *FeedbackHandler) DeleteFeedback(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	id := c.Params("id")
 
-	result, err := h.db.Exec("DELETE FROM feedback WHERE id = ?", id)
+	result, err := h.db.ExecContext(ctx, "DELETE FROM feedback WHERE id = ?", id)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to delete feedback",
-		})
+		return response.Fail(c, 500, "Failed to delete feedback")
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Feedback not found",
-		})
+		return response.Fail(c, 404, "Feedback not found")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Feedback deleted successfully",
-	})
+	return response.Message(c, "Feedback deleted successfully")
 }
 
 // GetFeedbackStats - Get feedback statistics
 func (h *FeedbackHandler) GetFeedbackStats(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	stats := make(map[string]interface{})
 
 	// Total feedback
 	var total int
-	h.db.QueryRow("SELECT COUNT(*) FROM feedback").Scan(&total)
+	h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM feedback").Scan(&total)
 
 	// By status
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(ctx, `
 		SELECT status, COUNT(*) as count
 		FROM feedback
 		GROUP BY status
@@ -258,6 +242,9 @@ func (h *FeedbackHandler) GetFeedbackStats(c *fiber.Ctx) error {
 	if err == nil {
 		defer rows.Close()
 		byStatus := make(map[string]int)
+		for status := range validFeedbackStatuses {
+			byStatus[status] = 0
+		}
 		for rows.Next() {
 			var status string
 			var count int
@@ -265,12 +252,14 @@ func (h *FeedbackHandler) GetFeedbackStats(c *fiber.Ctx) error {
 			byStatus[status] = count
 		}
 		stats["by_status"] = byStatus
+
+		// Flat counters consumed by the feedback management page
+		for status, count := range byStatus {
+			stats[status] = count
+		}
 	}
 
 	stats["total"] = total
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    stats,
-	})
+	return response.OK(c, stats)
 }
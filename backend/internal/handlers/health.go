@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database"
+	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/internal/startlatency"
+	"github.com/abcdefak87/cctv/internal/streamnode"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// minFreeRecordingBytes is the free space below which recordings are
+// reported as degraded
+const minFreeRecordingBytes = 1 << 30
+
+// readyTimeout bounds the whole readiness check
+const readyTimeout = 3 * time.Second
+
+// DependencyStatus is the result of one readiness check
+type DependencyStatus struct {
+	Status    string `json:"status"` // ok, degraded or down
+	Critical  bool   `json:"critical"`
+	Detail    string `json:"detail,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// Readiness is the /health/ready body
+type Readiness struct {
+	Status string                      `json:"status"` // ready or not_ready
+	Checks map[string]DependencyStatus `json:"checks"`
+}
+
+type HealthHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewHealthHandler(db *sql.DB, cfg *config.Config) *HealthHandler {
+	return &HealthHandler{db: db, cfg: cfg}
+}
+
+// Live - Liveness probe: the process is up and serving requests
+func (h *HealthHandler) Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":   "ok",
+		"env":      h.cfg.Server.Env,
+		"instance": h.cfg.Cluster.InstanceID,
+	})
+}
+
+// readyCheck is one dependency Ready checks
+type readyCheck struct {
+	critical bool
+	run      func(ctx context.Context) (status, detail string)
+}
+
+// Ready - Readiness probe: checks the database, schema, go2rtc, each
+// stream node and the recordings disk. Any critical dependency that is
+// down makes it 503; a stream node only serves some cameras, so is not
+// critical.
+func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]readyCheck{
+		"database":   {true, h.checkDatabase},
+		"migrations": {true, h.checkMigrations},
+		"go2rtc":     {true, h.checkGo2RTC("")},
+		"recordings": {false, h.checkRecordings},
+	}
+	for _, node := range h.cfg.Stream().Nodes {
+		checks["go2rtc:"+node.Name] = readyCheck{false, h.checkGo2RTC(node.Name)}
+	}
+
+	result := Readiness{Status: "ready", Checks: map[string]DependencyStatus{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, critical bool, run func(ctx context.Context) (string, string)) {
+			defer wg.Done()
+
+			start := time.Now()
+			status, detail := run(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Checks[name] = DependencyStatus{
+				Status:    status,
+				Critical:  critical,
+				Detail:    detail,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if critical && status == "down" {
+				result.Status = "not_ready"
+			}
+		}(name, check.critical, check.run)
+	}
+	wg.Wait()
+
+	if result.Status != "ready" {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(result)
+	}
+	return c.JSON(result)
+}
+
+// Metrics - Prometheus metrics of this instance, in the text format;
+// scrapers send METRICS_TOKEN as a bearer token
+func (h *HealthHandler) Metrics(c *fiber.Ctx) error {
+	token := h.cfg.Server.MetricsToken
+	if token == "" {
+		return response.Fail(c, fiber.StatusServiceUnavailable, "Metrics are not configured")
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Get(fiber.HeaderAuthorization)), []byte("Bearer "+token)) != 1 {
+		return response.Fail(c, fiber.StatusUnauthorized, "Invalid metrics token")
+	}
+
+	var buf bytes.Buffer
+	if err := startlatency.Shared().WritePrometheus(&buf); err != nil {
+		return err
+	}
+	if err := middleware.Preflights().WritePrometheus(&buf); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(buf.Bytes())
+}
+
+// failure hides error details in production, where the endpoint is
+// reachable from outside
+func (h *HealthHandler) failure(summary string, err error) (string, string) {
+	if h.cfg.Server.Env == "production" || err == nil {
+		return "down", summary
+	}
+	return "down", summary + ": " + err.Error()
+}
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) (string, string) {
+	if err := h.db.PingContext(ctx); err != nil {
+		return h.failure("unreachable", err)
+	}
+	return "ok", ""
+}
+
+func (h *HealthHandler) checkMigrations(ctx context.Context) (string, string) {
+	states, err := database.Status(h.db)
+	if err != nil {
+		return h.failure("cannot read schema_migrations", err)
+	}
+
+	pending := 0
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return "down", fmt.Sprintf("%d migration(s) pending", pending)
+	}
+	return "ok", fmt.Sprintf("%d applied", len(states))
+}
+
+// checkGo2RTC checks the go2rtc of a stream node; "" is the local one
+func (h *HealthHandler) checkGo2RTC(node string) func(ctx context.Context) (string, string) {
+	return func(ctx context.Context) (string, string) {
+		up, err := streamnode.Lookup(h.cfg.Stream(), node)
+		if err != nil {
+			return h.failure("not configured", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, up.APIURL+"/api", nil)
+		if err != nil {
+			return h.failure("invalid URL", err)
+		}
+
+		resp, err := up.Client.Do(req)
+		if err != nil {
+			return h.failure("unreachable", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 500 {
+			return "down", fmt.Sprintf("responded %d", resp.StatusCode)
+		}
+		return "ok", ""
+	}
+}
+
+func (h *HealthHandler) checkRecordings(ctx context.Context) (string, string) {
+	path := h.cfg.Recording.Path
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return h.failure("recordings directory missing", err)
+	}
+
+	free, err := freeBytes(path)
+	if err != nil {
+		// Free space is unknown on this platform; the directory exists
+		return "ok", ""
+	}
+	if free < minFreeRecordingBytes {
+		return "degraded", fmt.Sprintf("%d MB free", free>>20)
+	}
+	return "ok", fmt.Sprintf("%d MB free", free>>20)
+}
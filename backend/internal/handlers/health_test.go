@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database"
+	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/internal/startlatency"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHealthHandler_Ready(t *testing.T) {
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":"1.9"}`))
+	}))
+	defer go2rtc.Close()
+
+	openDB := func(t *testing.T, migrate bool) *sql.DB {
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatalf("Failed to open test database: %v", err)
+		}
+		db.SetMaxOpenConns(1)
+		if migrate {
+			if err := database.RunMigrations(db); err != nil {
+				t.Fatalf("Migrations failed: %v", err)
+			}
+		}
+		return db
+	}
+
+	ready := func(t *testing.T, db *sql.DB, apiURL string) (int, Readiness) {
+		cfg := &config.Config{
+			Server:    config.ServerConfig{Env: "test"},
+			Go2RTC:    config.Go2RTCConfig{APIURL: apiURL},
+			Recording: config.RecordingConfig{Path: t.TempDir()},
+		}
+
+		app := fiber.New()
+		app.Get("/health/ready", NewHealthHandler(db, cfg).Ready)
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/health/ready", nil), 5000)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+
+		var body Readiness
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	t.Run("All dependencies up", func(t *testing.T) {
+		db := openDB(t, true)
+		defer db.Close()
+
+		status, body := ready(t, db, go2rtc.URL)
+		if status != 200 || body.Status != "ready" {
+			t.Errorf("Expected 200 ready, got %d %s: %+v", status, body.Status, body.Checks)
+		}
+		for _, name := range []string{"database", "migrations", "go2rtc", "recordings"} {
+			if _, ok := body.Checks[name]; !ok {
+				t.Errorf("Expected a %s check", name)
+			}
+		}
+	})
+
+	t.Run("Pending migrations", func(t *testing.T) {
+		db := openDB(t, false)
+		defer db.Close()
+
+		status, body := ready(t, db, go2rtc.URL)
+		if status != 503 {
+			t.Errorf("Expected status 503, got %d", status)
+		}
+		if check := body.Checks["migrations"]; check.Status != "down" {
+			t.Errorf("Expected migrations down, got %+v", check)
+		}
+	})
+
+	t.Run("go2rtc unreachable", func(t *testing.T) {
+		db := openDB(t, true)
+		defer db.Close()
+
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+
+		status, body := ready(t, db, down.URL)
+		if status != 503 {
+			t.Errorf("Expected status 503, got %d", status)
+		}
+		if check := body.Checks["go2rtc"]; check.Status != "down" || !check.Critical {
+			t.Errorf("Expected go2rtc down and critical, got %+v", check)
+		}
+	})
+}
+
+func TestHealthHandler_Metrics(t *testing.T) {
+	startlatency.Shared().Record(41, 1200*time.Millisecond)
+	middleware.Preflights().Record(config.CORSPublic, true)
+
+	metrics := func(token, header string) (int, string) {
+		cfg := &config.Config{Server: config.ServerConfig{MetricsToken: token}}
+		app := fiber.New()
+		app.Get("/metrics", NewHealthHandler(nil, cfg).Metrics)
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, _ := metrics("", "Bearer "); status != 503 {
+		t.Errorf("Expected status 503 without a token configured, got %d", status)
+	}
+	if status, _ := metrics("s3cret", "Bearer wrong"); status != 401 {
+		t.Errorf("Expected status 401 for a wrong token, got %d", status)
+	}
+	status, body := metrics("s3cret", "Bearer s3cret")
+	if status != 200 || !strings.Contains(body, `cctv_stream_start_seconds{camera_id="41",quantile="0.95"} 1.2`) {
+		t.Errorf("Expected the camera's start latency, got %d %s", status, body)
+	}
+	if !strings.Contains(body, `cctv_cors_preflights_total{group="public",result="allowed"}`) {
+		t.Errorf("Expected the preflight count, got %s", body)
+	}
+}
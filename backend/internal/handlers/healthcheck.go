@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/internal/watchdog"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type HealthCheckHandler struct {
+	db    *sql.DB
+	queue *jobs.Queue
+	cfg   *config.Config
+}
+
+func NewHealthCheckHandler(db *sql.DB, queue *jobs.Queue, cfg *config.Config) *HealthCheckHandler {
+	return &HealthCheckHandler{db: db, queue: queue, cfg: cfg}
+}
+
+// HealthCheckRequest lists the cameras to probe; empty probes every
+// camera of the organization
+type HealthCheckRequest struct {
+	CameraIDs []int `json:"camera_ids" validate:"max=500"`
+}
+
+// CreateHealthCheck - Probe cameras now rather than at their next
+// scheduled check, such as after fixing one. The probes run as a job;
+// the check's results URL reports them once it is done.
+func (h *HealthCheckHandler) CreateHealthCheck(c *fiber.Ctx) error {
+	var req HealthCheckRequest
+	if len(c.Body()) > 0 {
+		if ok, err := bind(c, &req); !ok {
+			return err
+		}
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraIDs, ok, err := h.cameras(c, ctx, req.CameraIDs)
+	if !ok {
+		return err
+	}
+	if len(cameraIDs) == 0 {
+		return response.Fail(c, 404, "No cameras to check")
+	}
+
+	var requestedBy *int
+	if id, ok := c.Locals("user_id").(int); ok {
+		requestedBy = &id
+	}
+	check, err := watchdog.Enqueue(ctx, h.db, h.queue, tenant.OrgID(ctx), cameraIDs, requestedBy)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to queue health check")
+	}
+	return response.Created(c, "Health check queued", fiber.Map{
+		"check":       check,
+		"results_url": "/api/admin/camera-health/checks/" + strconv.FormatInt(check.ID, 10),
+	})
+}
+
+// GetHealthCheck - A health check queued by CreateHealthCheck, with the
+// health of each camera once its status is done
+func (h *HealthCheckHandler) GetHealthCheck(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Health check not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	check, err := watchdog.GetCheck(ctx, h.db, tenant.OrgID(ctx), int64(id))
+	if errors.Is(err, watchdog.ErrCheckNotFound) {
+		return response.Fail(c, 404, "Health check not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch health check")
+	}
+	return response.OK(c, check)
+}
+
+// cameras returns the sorted, distinct cameras of a check, every camera
+// of the organization when ids is empty. When ok is false the response
+// has been written and the handler should return err.
+func (h *HealthCheckHandler) cameras(c *fiber.Ctx, ctx context.Context, ids []int) (cameraIDs []int, ok bool, err error) {
+	rows, err := h.db.QueryContext(ctx, `SELECT id FROM cameras WHERE organization_id = ? ORDER BY id`, tenant.OrgID(ctx))
+	if err != nil {
+		return nil, false, serviceError(c, err, "", "Failed to fetch cameras")
+	}
+	defer rows.Close()
+	known := map[int]bool{}
+	var all []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, false, serviceError(c, err, "", "Failed to fetch cameras")
+		}
+		known[id] = true
+		all = append(all, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, serviceError(c, err, "", "Failed to fetch cameras")
+	}
+	if len(ids) == 0 {
+		return all, true, nil
+	}
+
+	fields := map[string]string{}
+	seen := map[int]bool{}
+	for i, id := range ids {
+		if !known[id] {
+			fields[fmt.Sprintf("camera_ids[%d]", i)] = "is not a camera"
+		} else if !seen[id] {
+			seen[id] = true
+			cameraIDs = append(cameraIDs, id)
+		}
+	}
+	if len(fields) > 0 {
+		return nil, false, invalidFields(c, "", fields)
+	}
+	sort.Ints(cameraIDs)
+	return cameraIDs, true, nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHealthCheckHandler(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES
+		(1, 'Gate', 'rtsp://a', 'gate'), (2, 'Yard', 'rtsp://b', 'yard')`)
+
+	h := NewHealthCheckHandler(db, jobs.New(db, jobs.Options{}), &config.Config{})
+	app := fiber.New()
+	app.Post("/camera-health/check", h.CreateHealthCheck)
+	app.Get("/camera-health/checks/:id", h.GetHealthCheck)
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+
+	if status, _ := do("POST", "/camera-health/check", `{"camera_ids":[1,9]}`); status != 422 {
+		t.Errorf("Expected status 422 for an unknown camera, got %d", status)
+	}
+
+	status, data := do("POST", "/camera-health/check", `{"camera_ids":[2,1,2]}`)
+	check, _ := data["check"].(map[string]interface{})
+	if status != 201 || check == nil || data["results_url"] != "/api/admin/camera-health/checks/1" {
+		t.Fatalf("Expected the check queued, got %d %v", status, data)
+	}
+	if ids, _ := json.Marshal(check["camera_ids"]); string(ids) != "[1,2]" || check["job_id"] == float64(0) {
+		t.Errorf("Expected the distinct cameras in order with a job, got %v", check)
+	}
+
+	status, data = do("POST", "/camera-health/check", "")
+	if check, _ := data["check"].(map[string]interface{}); status != 201 || check == nil || len(check["camera_ids"].([]interface{})) != 2 {
+		t.Errorf("Expected every camera checked without a body, got %d %v", status, data)
+	}
+
+	if status, data := do("GET", "/camera-health/checks/1", ""); status != 200 || data["status"] != "pending" {
+		t.Errorf("Expected the pending check, got %d %v", status, data)
+	}
+	if status, _ := do("GET", "/camera-health/checks/9", ""); status != 404 {
+		t.Errorf("Expected status 404 for an unknown check, got %d", status)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultImpersonationTTL applies when the configuration sets none
+const defaultImpersonationTTL = 15 * time.Minute
+
+// ImpersonateRequest is the body for impersonating a user. A read-only
+// token may only make GET requests.
+type ImpersonateRequest struct {
+	Reason   string                `json:"reason" validate:"max=500"`
+	ReadOnly validate.FlexibleBool `json:"read_only"`
+}
+
+// ImpersonationToken lets an admin act as User until ExpiresAt
+type ImpersonationToken struct {
+	Token     string           `json:"token"`
+	ExpiresAt time.Time        `json:"expires_at"`
+	ReadOnly  bool             `json:"read_only"`
+	User      models.LoginUser `json:"user"`
+}
+
+// Impersonate - Issue a short-lived token to act as another user, to
+// see what their role and permissions allow. Admins cannot be
+// impersonated; the token cannot be refreshed or used to impersonate
+// again, and every request made with it is audited.
+func (h *AuthHandler) Impersonate(c *fiber.Ctx) error {
+	if _, ok := c.Locals("impersonator_id").(int); ok {
+		return response.Fail(c, fiber.StatusForbidden, "Cannot impersonate while impersonating")
+	}
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, fiber.StatusNotFound, "User not found")
+	}
+	var req ImpersonateRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	adminID, _ := c.Locals("user_id").(int)
+	if id == adminID {
+		return response.Fail(c, fiber.StatusUnprocessableEntity, "Cannot impersonate yourself")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var user models.LoginUser
+	err := h.db.QueryRowContext(ctx, "SELECT id, username, role, organization_id FROM users WHERE id = ?", id).
+		Scan(&user.ID, &user.Username, &user.Role, &user.OrganizationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, fiber.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch user")
+	}
+	if user.Role == models.RoleAdmin {
+		return response.Fail(c, fiber.StatusForbidden, "Admins cannot be impersonated")
+	}
+
+	ttl := h.cfg.Security.ImpersonationTTL
+	if ttl <= 0 {
+		ttl = defaultImpersonationTTL
+	}
+	now := time.Now()
+	expires := now.Add(ttl).Truncate(time.Second)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.JWTClaims{
+		UserID:         user.ID,
+		Username:       user.Username,
+		Role:           user.Role,
+		OrgID:          user.OrganizationID,
+		ImpersonatorID: adminID,
+		ReadOnly:       req.ReadOnly.Bool,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}).SignedString([]byte(h.cfg.JWT.Secret))
+	if err != nil {
+		return response.Fail(c, fiber.StatusInternalServerError, "Failed to generate token")
+	}
+
+	publish(c, events.Event{
+		Type:     events.AuthImpersonationStarted,
+		Resource: "user",
+		Data: map[string]interface{}{
+			"user_id":    user.ID,
+			"username":   user.Username,
+			"read_only":  req.ReadOnly.Bool,
+			"reason":     req.Reason,
+			"expires_at": expires.UTC(),
+		},
+	})
+
+	return response.OK(c, ImpersonationToken{
+		Token:     token,
+		ExpiresAt: expires.UTC(),
+		ReadOnly:  req.ReadOnly.Bool,
+		User:      user,
+	})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestImpersonate(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	seedDB(t, db,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin')`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (2, 'operator', 'x', 'operator')`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (3, 'root', 'x', 'admin')`,
+	)
+
+	cfg := &config.Config{
+		JWT:      config.JWTConfig{Secret: "test-secret"},
+		Security: config.SecurityConfig{ImpersonationTTL: 10 * time.Minute},
+	}
+	handler := NewAuthHandler(db, cfg)
+
+	audited := make(chan events.Event, 16)
+	events.Subscribe(events.AuthImpersonatedRequest, "test", func(e events.Event) { audited <- e })
+
+	app := fiber.New()
+	app.Post("/refresh", handler.RefreshToken)
+	app.Use(middleware.AuthMiddleware(cfg.JWT.Secret))
+	app.Get("/verify", handler.Verify)
+	app.Post("/users/:id/impersonate", handler.Impersonate)
+	app.Post("/cameras", func(c *fiber.Ctx) error { return response.Message(c, "created") })
+
+	adminToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.JWTClaims{
+		UserID:   1,
+		Username: "admin",
+		Role:     "admin",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "impersonation-test",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte(cfg.JWT.Secret))
+
+	do := func(method, path, token, body string) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+	impersonate := func(t *testing.T, body string) ImpersonationToken {
+		t.Helper()
+		status, env := do("POST", "/users/2/impersonate", adminToken, body)
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		raw, _ := json.Marshal(env.Data)
+		var token ImpersonationToken
+		json.Unmarshal(raw, &token)
+		return token
+	}
+
+	t.Run("Acts as the user", func(t *testing.T) {
+		token := impersonate(t, `{"reason":"Cannot see the market cameras"}`)
+		if token.User.Username != "operator" || token.ReadOnly {
+			t.Errorf("Unexpected token %+v", token)
+		}
+		if left := time.Until(token.ExpiresAt); left <= 0 || left > 10*time.Minute {
+			t.Errorf("Expected the token to expire within the configured TTL, got %s", left)
+		}
+
+		req := httptest.NewRequest("GET", "/verify", nil)
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var verified struct {
+			User map[string]interface{} `json:"user"`
+		}
+		json.NewDecoder(resp.Body).Decode(&verified)
+		if user := verified.User; resp.StatusCode != 200 || user["username"] != "operator" || user["impersonator_id"] != float64(1) {
+			t.Errorf("Expected the operator impersonated by the admin, got %d %v", resp.StatusCode, user)
+		}
+		if status, _ := do("POST", "/cameras", token.Token, ""); status != 200 {
+			t.Errorf("Expected a full impersonation to write, got %d", status)
+		}
+
+		select {
+		case e := <-audited:
+			if *e.UserID != 2 || e.Data["impersonator_id"] != 1 || e.Data["path"] != "/verify" {
+				t.Errorf("Unexpected audit event %+v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the impersonated request to be audited")
+		}
+	})
+
+	t.Run("Read only", func(t *testing.T) {
+		token := impersonate(t, `{"read_only":true}`)
+		if status, _ := do("GET", "/verify", token.Token, ""); status != 200 {
+			t.Errorf("Expected a read-only token to read, got %d", status)
+		}
+		if status, _ := do("POST", "/cameras", token.Token, ""); status != 403 {
+			t.Errorf("Expected a read-only token not to write, got %d", status)
+		}
+	})
+
+	t.Run("Refused", func(t *testing.T) {
+		token := impersonate(t, `{}`)
+		if status, _ := do("POST", "/refresh", token.Token, ""); status != 403 {
+			t.Errorf("Expected an impersonation token not to refresh, got %d", status)
+		}
+		if status, _ := do("POST", "/users/3/impersonate", token.Token, `{}`); status != 403 {
+			t.Errorf("Expected no impersonation while impersonating, got %d", status)
+		}
+		for path, want := range map[string]int{
+			"/users/1/impersonate": 422,
+			"/users/3/impersonate": 403,
+			"/users/9/impersonate": 404,
+		} {
+			if status, _ := do("POST", path, adminToken, `{}`); status != want {
+				t.Errorf("Expected status %d for %s, got %d", want, path, status)
+			}
+		}
+	})
+}
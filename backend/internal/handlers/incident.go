@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/incidents"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type IncidentHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewIncidentHandler(db *sql.DB, cfg *config.Config) *IncidentHandler {
+	return &IncidentHandler{db: db, cfg: cfg}
+}
+
+// IncidentRequest is the create/update body for an incident. An incident
+// opened from an alert names its detection_id; the detection's camera is
+// affected when camera_ids is empty. Published incidents appear on the
+// public status page.
+type IncidentRequest struct {
+	Title       string                `json:"title" validate:"required,max=200"`
+	Severity    string                `json:"severity" validate:"oneof=minor major critical"`
+	Published   validate.FlexibleBool `json:"published"`
+	CameraIDs   []int                 `json:"camera_ids" validate:"max=100"`
+	DetectionID validate.FlexibleInt  `json:"detection_id" validate:"id"`
+}
+
+// IncidentUpdateRequest adds to an incident's timeline: a note, a status
+// change, or both. Public updates appear on the status page while the
+// incident is published.
+type IncidentUpdateRequest struct {
+	Body   string                `json:"body" validate:"max=2000"`
+	Status string                `json:"status" validate:"oneof=open acknowledged resolved"`
+	Public validate.FlexibleBool `json:"public"`
+}
+
+const incidentColumns = `
+	SELECT id, title, status, severity, published, detection_id, created_by,
+	       opened_at, acknowledged_at, resolved_at, updated_at
+	FROM incidents`
+
+// GetIncidents - Incidents, newest first. Filters: status and camera_id.
+func (h *IncidentHandler) GetIncidents(c *fiber.Ctx) error {
+	conds := []string{"organization_id = ?"}
+	args := []interface{}{tenant.OrgID(c.UserContext())}
+	if status := c.Query("status"); status != "" {
+		if status != incidents.StatusOpen && status != incidents.StatusAcknowledged && status != incidents.StatusResolved {
+			return response.Fail(c, 400, "Invalid status, expected open, acknowledged or resolved")
+		}
+		conds = append(conds, "status = ?")
+		args = append(args, status)
+	}
+	if raw := c.Query("camera_id"); raw != "" {
+		id, err := validate.ID(raw)
+		if err != nil || id == nil {
+			return response.Fail(c, 400, "Invalid camera_id")
+		}
+		conds = append(conds, "id IN (SELECT incident_id FROM incident_cameras WHERE camera_id = ?)")
+		args = append(args, *id)
+	}
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	page := response.ParsePage(c, 50)
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	query, pageArgs := paginate(incidentColumns+where+`
+		ORDER BY opened_at DESC, id DESC
+	`, append([]interface{}{}, args...), page)
+	rows, err := h.db.QueryContext(ctx, query, pageArgs...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch incidents")
+	}
+	defer rows.Close()
+
+	list := []incidents.Incident{}
+	for rows.Next() {
+		i, err := scanIncident(rows)
+		if err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read incident", "error", err)
+			continue
+		}
+		list = append(list, i)
+	}
+	rows.Close()
+
+	if err := h.loadCameras(ctx, list); err != nil {
+		return serviceError(c, err, "", "Failed to fetch incidents")
+	}
+
+	total := countTotal(ctx, h.db, page, len(list), "SELECT COUNT(*) FROM incidents"+where, args...)
+
+	return response.Paginated(c, list, page.Meta(total))
+}
+
+// GetIncident - An incident with its timeline
+func (h *IncidentHandler) GetIncident(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Incident not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	i, err := h.load(ctx, int64(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, 404, "Incident not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch incident")
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, kind, status, body, public, user_id, detection_id, created_at
+		FROM incident_updates
+		WHERE incident_id = ?
+		ORDER BY created_at ASC, id ASC
+	`, i.ID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch incident")
+	}
+	defer rows.Close()
+
+	i.Updates = []incidents.Update{}
+	for rows.Next() {
+		var u incidents.Update
+		var userID, detectionID sql.NullInt64
+		if err := rows.Scan(&u.ID, &u.Kind, &u.Status, &u.Body, &u.Public, &userID, &detectionID, &u.CreatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read incident update", "error", err)
+			continue
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			u.UserID = &id
+		}
+		if detectionID.Valid {
+			u.DetectionID = &detectionID.Int64
+		}
+		i.Updates = append(i.Updates, u)
+	}
+
+	return response.OK(c, i)
+}
+
+// CreateIncident - Open an incident
+func (h *IncidentHandler) CreateIncident(c *fiber.Ctx) error {
+	var req IncidentRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRequest(ctx, c, &req); !ok {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create incident")
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var userID *int
+	if id, ok := c.Locals("user_id").(int); ok {
+		userID = &id
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO incidents (organization_id, title, status, severity, published, detection_id, created_by, opened_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, tenant.OrgID(ctx), req.Title, incidents.StatusOpen, req.Severity, req.Published.Bool,
+		req.DetectionID.ID(), userID, now, now).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create incident")
+	}
+	if err := setIncidentCameras(ctx, tx, id, req.CameraIDs); err != nil {
+		return serviceError(c, err, "", "Failed to create incident")
+	}
+	opened := &incidents.Update{Kind: incidents.KindStatus, Status: incidents.StatusOpen, Public: true, UserID: userID, CreatedAt: now}
+	if err := incidents.AddUpdate(ctx, tx, id, opened); err != nil {
+		return serviceError(c, err, "", "Failed to create incident")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to create incident")
+	}
+
+	publish(c, events.Event{Type: events.IncidentOpened, Time: now, Resource: "incident", Data: map[string]interface{}{
+		"incident_id": id,
+		"title":       req.Title,
+		"status":      incidents.StatusOpen,
+	}})
+
+	return response.Created(c, "Incident created successfully", fiber.Map{
+		"id": id,
+	})
+}
+
+// UpdateIncident - Replace an incident's title, severity, publication,
+// cameras and alert; the status changes through its updates
+func (h *IncidentHandler) UpdateIncident(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Incident not found")
+	}
+
+	var req IncidentRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRequest(ctx, c, &req); !ok {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE incidents SET title = ?, severity = ?, published = ?, detection_id = ?, updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, req.Title, req.Severity, req.Published.Bool, req.DetectionID.ID(), time.Now().UTC(), id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Incident not found")
+	}
+	if err := setIncidentCameras(ctx, tx, int64(id), req.CameraIDs); err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+
+	return response.Message(c, "Incident updated successfully")
+}
+
+// AddIncidentUpdate - Add a note to an incident's timeline and/or change
+// its status: acknowledge or resolve it, or reopen a resolved one
+func (h *IncidentHandler) AddIncidentUpdate(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Incident not found")
+	}
+
+	var req IncidentUpdateRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" && req.Status == "" {
+		return invalidFields(c, "", map[string]string{"body": "is required without a status"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+	defer tx.Rollback()
+
+	var title, current string
+	err = tx.QueryRowContext(ctx, `SELECT title, status FROM incidents WHERE id = ? AND organization_id = ?`,
+		id, tenant.OrgID(ctx)).Scan(&title, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, 404, "Incident not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+
+	now := time.Now().UTC()
+	u := &incidents.Update{Kind: incidents.KindNote, Body: req.Body, Public: req.Public.Bool, CreatedAt: now}
+	if userID, ok := c.Locals("user_id").(int); ok {
+		u.UserID = &userID
+	}
+
+	if req.Status != "" {
+		if !incidents.CanTransition(current, req.Status) {
+			return invalidFields(c, "", map[string]string{"status": "cannot change from " + current + " to " + req.Status})
+		}
+		u.Kind, u.Status = incidents.KindStatus, req.Status
+
+		// Reopening starts the acknowledge/resolve cycle again
+		acknowledged, resolved := "NULL", "NULL"
+		switch req.Status {
+		case incidents.StatusAcknowledged:
+			acknowledged, resolved = "?", "resolved_at"
+		case incidents.StatusResolved:
+			acknowledged, resolved = "acknowledged_at", "?"
+		}
+		args := []interface{}{req.Status, now}
+		if req.Status != incidents.StatusOpen {
+			args = append(args, now)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE incidents SET status = ?, updated_at = ?, acknowledged_at = `+acknowledged+`, resolved_at = `+resolved+`
+			WHERE id = ?
+		`, append(args, id)...)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE incidents SET updated_at = ? WHERE id = ?`, now, id)
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+	if err := incidents.AddUpdate(ctx, tx, int64(id), u); err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to update incident")
+	}
+
+	if req.Status != "" {
+		publish(c, events.Event{Type: events.IncidentStatusChanged, Time: now, Resource: "incident", Data: map[string]interface{}{
+			"incident_id": id,
+			"title":       title,
+			"status":      req.Status,
+		}})
+	}
+
+	return response.Created(c, "Incident updated successfully", u)
+}
+
+// DeleteIncident - Delete an incident and its timeline
+func (h *IncidentHandler) DeleteIncident(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Incident not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM incidents WHERE id = ? AND organization_id = ?", id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete incident")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Incident not found")
+	}
+
+	return response.Message(c, "Incident deleted successfully")
+}
+
+// checkRequest normalises req and rejects cameras and detections outside
+// the organization. When ok is false the response has been written and
+// the handler should return err.
+func (h *IncidentHandler) checkRequest(ctx context.Context, c *fiber.Ctx, req *IncidentRequest) (ok bool, err error) {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Severity == "" {
+		req.Severity = incidents.SeverityMinor
+	}
+
+	if id := req.DetectionID.ID(); id != nil {
+		var cameraID int
+		err := h.db.QueryRowContext(ctx, `
+			SELECT d.camera_id FROM detections d
+			JOIN cameras c ON c.id = d.camera_id
+			WHERE d.id = ? AND c.organization_id = ?
+		`, *id, tenant.OrgID(ctx)).Scan(&cameraID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, invalidFields(c, "", map[string]string{"detection_id": "Detection not found"})
+		}
+		if err != nil {
+			return false, serviceError(c, err, "", "Failed to save incident")
+		}
+		if len(req.CameraIDs) == 0 {
+			req.CameraIDs = []int{cameraID}
+		}
+	}
+
+	seen := map[int]bool{}
+	ids := req.CameraIDs[:0]
+	for _, id := range req.CameraIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	req.CameraIDs = ids
+	sort.Ints(req.CameraIDs)
+
+	for _, id := range req.CameraIDs {
+		found, err := cameraExists(ctx, h.db, id)
+		if err != nil {
+			return false, serviceError(c, err, "", "Failed to save incident")
+		}
+		if !found {
+			return false, invalidFields(c, "", map[string]string{"camera_ids": "Camera not found"})
+		}
+	}
+	return true, nil
+}
+
+// load returns incident id of the organization in ctx with its cameras,
+// or sql.ErrNoRows
+func (h *IncidentHandler) load(ctx context.Context, id int64) (incidents.Incident, error) {
+	row := h.db.QueryRowContext(ctx, incidentColumns+` WHERE id = ? AND organization_id = ?`, id, tenant.OrgID(ctx))
+	i, err := scanIncident(row)
+	if err != nil {
+		return i, err
+	}
+	list := []incidents.Incident{i}
+	err = h.loadCameras(ctx, list)
+	return list[0], err
+}
+
+// loadCameras fills in the CameraIDs of list
+func (h *IncidentHandler) loadCameras(ctx context.Context, list []incidents.Incident) error {
+	if len(list) == 0 {
+		return nil
+	}
+	byID := map[int64]*incidents.Incident{}
+	ids := make([]interface{}, len(list))
+	for n := range list {
+		list[n].CameraIDs = []int{}
+		byID[list[n].ID] = &list[n]
+		ids[n] = list[n].ID
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT incident_id, camera_id FROM incident_cameras
+		WHERE incident_id IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")+`)
+		ORDER BY camera_id ASC
+	`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var incidentID int64
+		var cameraID int
+		if err := rows.Scan(&incidentID, &cameraID); err != nil {
+			return err
+		}
+		byID[incidentID].CameraIDs = append(byID[incidentID].CameraIDs, cameraID)
+	}
+	return rows.Err()
+}
+
+// setIncidentCameras replaces the cameras incident id affects
+func setIncidentCameras(ctx context.Context, tx *sql.Tx, id int64, cameraIDs []int) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM incident_cameras WHERE incident_id = ?", id); err != nil {
+		return err
+	}
+	for _, cameraID := range cameraIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO incident_cameras (incident_id, camera_id) VALUES (?, ?)", id, cameraID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanIncident(row interface{ Scan(...any) error }) (incidents.Incident, error) {
+	var i incidents.Incident
+	var detectionID, createdBy sql.NullInt64
+	var acknowledged, resolved sql.NullTime
+	err := row.Scan(&i.ID, &i.Title, &i.Status, &i.Severity, &i.Published, &detectionID, &createdBy,
+		&i.OpenedAt, &acknowledged, &resolved, &i.UpdatedAt)
+	if err != nil {
+		return i, err
+	}
+	if detectionID.Valid {
+		i.DetectionID = &detectionID.Int64
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		i.CreatedBy = &id
+	}
+	if acknowledged.Valid {
+		i.AcknowledgedAt = &acknowledged.Time
+	}
+	if resolved.Valid {
+		i.ResolvedAt = &resolved.Time
+	}
+	return i, nil
+}
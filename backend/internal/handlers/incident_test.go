@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIncidents(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url) VALUES (1, 'Gate', 'rtsp://a'), (2, 'Market', 'rtsp://b')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, organization_id) VALUES (3, 'Elsewhere', 'rtsp://c', 2)`,
+		`INSERT INTO detections (id, camera_id, label, confidence, created_at) VALUES (7, 2, 'person', 0.9, CURRENT_TIMESTAMP)`,
+	)
+
+	h := NewIncidentHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/incidents", h.GetIncidents)
+	app.Get("/incidents/:id", h.GetIncident)
+	app.Post("/incidents", h.CreateIncident)
+	app.Put("/incidents/:id", h.UpdateIncident)
+	app.Post("/incidents/:id/updates", h.AddIncidentUpdate)
+	app.Delete("/incidents/:id", h.DeleteIncident)
+
+	do := func(method, path, body string, org int) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	t.Run("Create from an alert", func(t *testing.T) {
+		status, env := do("POST", "/incidents", `{"title":"Intruder at the market","detection_id":7,"published":true}`, 1)
+		if status != 201 {
+			t.Fatalf("Expected status 201, got %d (%+v)", status, env.Error)
+		}
+		_, env = do("GET", "/incidents/1", "", 1)
+		incident := env.Data.(map[string]interface{})
+		if cameras := incident["camera_ids"].([]interface{}); len(cameras) != 1 || cameras[0] != float64(2) {
+			t.Errorf("Expected the detection's camera, got %v", cameras)
+		}
+		if incident["severity"] != "minor" || len(incident["updates"].([]interface{})) != 1 {
+			t.Errorf("Expected a minor incident with an open update, got %+v", incident)
+		}
+	})
+
+	t.Run("Cameras of other organizations", func(t *testing.T) {
+		for _, body := range []string{`{"title":"Outage","camera_ids":[3]}`, `{"title":"Outage","detection_id":9}`} {
+			if status, env := do("POST", "/incidents", body, 1); status != 422 {
+				t.Errorf("Expected status 422 for %s, got %d (%+v)", body, status, env.Error)
+			}
+		}
+	})
+
+	t.Run("Acknowledge and resolve", func(t *testing.T) {
+		if status, env := do("POST", "/incidents/1/updates", `{"status":"acknowledged","body":"Patrol sent"}`, 1); status != 201 {
+			t.Fatalf("Expected status 201, got %d (%+v)", status, env.Error)
+		}
+		if status, _ := do("POST", "/incidents/1/updates", `{"status":"open"}`, 1); status != 422 {
+			t.Errorf("Expected acknowledged to open to be refused, got %d", status)
+		}
+		if status, _ := do("POST", "/incidents/1/updates", `{}`, 1); status != 422 {
+			t.Errorf("Expected an empty update to be refused, got %d", status)
+		}
+		do("POST", "/incidents/1/updates", `{"status":"resolved","public":true,"body":"All clear"}`, 1)
+
+		var status string
+		var acknowledged, resolved sql.NullTime
+		db.QueryRow(`SELECT status, acknowledged_at, resolved_at FROM incidents WHERE id = 1`).Scan(&status, &acknowledged, &resolved)
+		if status != "resolved" || !acknowledged.Valid || !resolved.Valid {
+			t.Errorf("Expected a resolved incident with both times, got %s %v %v", status, acknowledged, resolved)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		do("POST", "/incidents", `{"title":"Gate offline","camera_ids":[1],"severity":"major"}`, 1)
+
+		_, env := do("GET", "/incidents?status=open", "", 1)
+		if list := env.Data.([]interface{}); len(list) != 1 || list[0].(map[string]interface{})["title"] != "Gate offline" {
+			t.Errorf("Expected the open incident, got %v", list)
+		}
+		_, env = do("GET", "/incidents?camera_id=2", "", 1)
+		if list := env.Data.([]interface{}); len(list) != 1 {
+			t.Errorf("Expected 1 incident on camera 2, got %v", list)
+		}
+		_, env = do("GET", "/incidents", "", 2)
+		if list := env.Data.([]interface{}); len(list) != 0 {
+			t.Errorf("Expected no incidents in another organization, got %v", list)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if status, _ := do("DELETE", "/incidents/1", "", 2); status != 404 {
+			t.Errorf("Expected status 404 from another organization, got %d", status)
+		}
+		if status, _ := do("DELETE", "/incidents/1", "", 1); status != 200 {
+			t.Errorf("Expected status 200, got %d", status)
+		}
+		var updates int
+		db.QueryRow(`SELECT COUNT(*) FROM incident_updates WHERE incident_id = 1`).Scan(&updates)
+		if updates != 0 {
+			t.Errorf("Expected the timeline to be deleted, got %d updates", updates)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/infraalerts"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultInfraAlertLimit = 100
+	maxInfraAlertLimit     = 500
+
+	// maxAlertmanagerAlerts bounds the alerts of one webhook; set
+	// max_alerts in the receiver to stay under it
+	maxAlertmanagerAlerts = 1000
+)
+
+type InfraAlertHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewInfraAlertHandler(db *sql.DB, cfg *config.Config) *InfraAlertHandler {
+	return &InfraAlertHandler{db: db, cfg: cfg}
+}
+
+// ReceiveAlertmanager - Webhook receiver for Prometheus Alertmanager,
+// authenticated by ALERTMANAGER_TOKEN as a bearer token. Alerts that
+// start firing or are resolved publish infra.alert_firing and
+// infra.alert_resolved.
+func (h *InfraAlertHandler) ReceiveAlertmanager(c *fiber.Ctx) error {
+	token := h.cfg.Alerting.AlertmanagerToken
+	if token == "" {
+		return response.Fail(c, fiber.StatusServiceUnavailable, "Alertmanager receiver is not configured")
+	}
+	sent, _ := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		return response.Fail(c, fiber.StatusUnauthorized, "Invalid token")
+	}
+
+	var req infraalerts.Payload
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	if len(req.Alerts) > maxAlertmanagerAlerts {
+		return invalidFields(c, "", map[string]string{"alerts": fmt.Sprintf("must have at most %d alerts", maxAlertmanagerAlerts)})
+	}
+	problems := map[string]string{}
+	for i, a := range req.Alerts {
+		for field, problem := range a.Problems() {
+			problems[fmt.Sprintf("alerts.%d.%s", i, field)] = problem
+		}
+	}
+	if len(problems) > 0 {
+		return invalidFields(c, "", problems)
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	changed, err := infraalerts.Receive(ctx, h.db, req, time.Now())
+	if err != nil {
+		return serviceError(c, err, "", "Failed to store alerts")
+	}
+	for _, a := range changed {
+		eventType := events.InfraAlertFiring
+		if a.Status == infraalerts.StatusResolved {
+			eventType = events.InfraAlertResolved
+		}
+		publish(c, events.Event{Type: eventType, Resource: "infra_alert", Data: map[string]interface{}{
+			"alert_id": a.ID,
+			"alert":    a.Name,
+			"severity": a.Severity,
+			"instance": a.Instance,
+			"summary":  a.Summary,
+		}})
+	}
+
+	return response.Message(c, fmt.Sprintf("%d alerts received", len(req.Alerts)))
+}
+
+// GetInfraAlerts - Infrastructure alerts from Alertmanager, firing ones
+// first: ?status=firing or resolved filters them, ?limit= (100, at most
+// 500) caps them
+func (h *InfraAlertHandler) GetInfraAlerts(c *fiber.Ctx) error {
+	status := c.Query("status")
+	switch status {
+	case "", infraalerts.StatusFiring, infraalerts.StatusResolved:
+	default:
+		return invalidFields(c, "", map[string]string{"status": "must be firing or resolved"})
+	}
+	limit := c.QueryInt("limit", defaultInfraAlertLimit)
+	if limit < 1 || limit > maxInfraAlertLimit {
+		return invalidFields(c, "", map[string]string{"limit": "must be between 1 and 500"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	list, err := infraalerts.List(ctx, h.db, status, limit)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch infrastructure alerts")
+	}
+	return response.OK(c, list)
+}
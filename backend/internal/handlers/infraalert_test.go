@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/infraalerts"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAlertmanagerReceiver(t *testing.T) {
+	db := dbtest.Open(t)
+
+	cfg := &config.Config{Alerting: config.AlertingConfig{AlertmanagerToken: "s3cret-alertmanager-token"}}
+	h := NewInfraAlertHandler(db, cfg)
+	app := fiber.New()
+	app.Post("/integrations/alertmanager", h.ReceiveAlertmanager)
+	app.Get("/infra-alerts", h.GetInfraAlerts)
+
+	post := func(token, body string) (int, map[string]string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/integrations/alertmanager", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Error struct {
+				Fields map[string]string `json:"fields"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Error.Fields
+	}
+	list := func(query string) (int, []infraalerts.Alert) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/infra-alerts"+query, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data []infraalerts.Alert `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+
+	// Resolved alerts older than the retention are pruned, so the times
+	// are recent
+	start := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	times := strings.NewReplacer(
+		"{{start}}", start.Format(time.RFC3339),
+		"{{later}}", start.Add(time.Hour).Format(time.RFC3339),
+		"{{end}}", start.Add(20*time.Minute).Format(time.RFC3339),
+	)
+
+	firing := times.Replace(`{"version": "4", "status": "firing", "receiver": "cctv", "alerts": [
+		{"status": "firing", "labels": {"alertname": "NodeDown", "instance": "nvr-01:9100", "severity": "critical"},
+		 "annotations": {"summary": "nvr-01 is unreachable"}, "startsAt": "{{start}}",
+		 "endsAt": "0001-01-01T00:00:00Z", "fingerprint": "a1b2c3d4e5f60718"},
+		{"status": "firing", "labels": {"alertname": "DiskPressure", "instance": "nvr-02:9100"},
+		 "startsAt": "{{later}}"}
+	]}`)
+
+	if status, _ := post("", firing); status != 401 {
+		t.Errorf("Expected 401 without a token, got %d", status)
+	}
+	if status, _ := post("wrong", firing); status != 401 {
+		t.Errorf("Expected 401 for a wrong token, got %d", status)
+	}
+	if status, fields := post(cfg.Alerting.AlertmanagerToken, `{"alerts": [{"status": "pending", "labels": {}}]}`); status != 422 ||
+		fields["alerts.0.status"] == "" || fields["alerts.0.labels"] == "" || fields["alerts.0.startsAt"] == "" {
+		t.Errorf("Expected 422 for a bad alert, got %d: %v", status, fields)
+	}
+
+	// Alertmanager sends firing alerts again on every repeat interval
+	for i := 0; i < 2; i++ {
+		if status, _ := post(cfg.Alerting.AlertmanagerToken, firing); status != 200 {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+	}
+	status, alerts := list("")
+	if status != 200 || len(alerts) != 2 {
+		t.Fatalf("Expected 2 alerts, got %d: %+v", status, alerts)
+	}
+	if a := alerts[1]; a.Name != "NodeDown" || a.Status != infraalerts.StatusFiring || a.Severity != "critical" ||
+		a.Instance != "nvr-01:9100" || a.Summary != "nvr-01 is unreachable" || a.EndsAt != nil {
+		t.Errorf("NodeDown = %+v", a)
+	}
+	if alerts[0].Fingerprint == "" {
+		t.Error("Expected a fingerprint from the labels when none is sent")
+	}
+
+	resolved := times.Replace(`{"alerts": [{"status": "resolved", "labels": {"alertname": "NodeDown", "instance": "nvr-01:9100", "severity": "critical"},
+		"startsAt": "{{start}}", "endsAt": "{{end}}", "fingerprint": "a1b2c3d4e5f60718"}]}`)
+	if status, _ := post(cfg.Alerting.AlertmanagerToken, resolved); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	_, alerts = list("?status=resolved")
+	if len(alerts) != 1 || alerts[0].Name != "NodeDown" || alerts[0].EndsAt == nil || !alerts[0].EndsAt.Equal(start.Add(20*time.Minute)) {
+		t.Errorf("Expected NodeDown resolved after 20 minutes, got %+v", alerts)
+	}
+	if _, alerts := list("?status=firing"); len(alerts) != 1 || alerts[0].Name != "DiskPressure" {
+		t.Errorf("Expected DiskPressure still firing, got %+v", alerts)
+	}
+	if status, _ := list("?status=pending"); status != 422 {
+		t.Errorf("Expected 422 for an unknown status, got %d", status)
+	}
+
+	h.cfg = &config.Config{}
+	if status, _ := post("", firing); status != 503 {
+		t.Errorf("Expected 503 without ALERTMANAGER_TOKEN, got %d", status)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/abcdefak87/cctv/internal/abuse"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type IPBanHandler struct {
+	guard *abuse.Guard
+	cfg   *config.Config
+}
+
+func NewIPBanHandler(guard *abuse.Guard, cfg *config.Config) *IPBanHandler {
+	return &IPBanHandler{guard: guard, cfg: cfg}
+}
+
+// GetIPBans - Client IPs banned from the streams for abusing them, with
+// why and until when, newest first
+func (h *IPBanHandler) GetIPBans(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	bans, err := h.guard.Active(ctx)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch IP bans")
+	}
+	return response.OK(c, bans)
+}
+
+// DeleteIPBan - Lift a ban before it expires
+func (h *IPBanHandler) DeleteIPBan(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, fiber.StatusNotFound, "Ban not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	ban, err := h.guard.Lift(ctx, int64(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, fiber.StatusNotFound, "Ban not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to lift ban")
+	}
+
+	publish(c, events.Event{
+		Type:     events.StreamIPUnbanned,
+		Resource: "ip_ban",
+		Data: map[string]interface{}{
+			"ban_id":     ban.ID,
+			"ip":         ban.IP,
+			"reason":     ban.Reason,
+			"expires_at": ban.ExpiresAt,
+		},
+	})
+
+	return response.Message(c, "Ban lifted")
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type JobsHandler struct {
+	queue *jobs.Queue
+	cfg   *config.Config
+}
+
+func NewJobsHandler(queue *jobs.Queue, cfg *config.Config) *JobsHandler {
+	return &JobsHandler{queue: queue, cfg: cfg}
+}
+
+// GetQueue - Worker pool usage, job counts by status and the most
+// urgent queued jobs
+func (h *JobsHandler) GetQueue(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	snap, err := h.queue.Status(ctx)
+	if err != nil {
+		logger.FromContext(c.UserContext()).Error("Failed to read job queue", "error", err)
+		return response.Fail(c, 500, "Failed to read job queue")
+	}
+	return response.OK(c, snap)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/logretention"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type LogRetentionHandler struct {
+	store *logretention.Store
+	cfg   *config.Config
+}
+
+func NewLogRetentionHandler(store *logretention.Store, cfg *config.Config) *LogRetentionHandler {
+	return &LogRetentionHandler{store: store, cfg: cfg}
+}
+
+// LogRetentionRequest sets how long a log type is kept; 0 keeps it
+// forever. With archive, pruned rows are written to a file first.
+type LogRetentionRequest struct {
+	RetentionDays validate.FlexibleInt  `json:"retention_days" validate:"min=0,max=3650"`
+	Archive       validate.FlexibleBool `json:"archive"`
+}
+
+// GetLogRetention - The retention of each log type with its row count,
+// oldest row, rows due for pruning and archives
+func (h *LogRetentionHandler) GetLogRetention(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	status, err := h.store.Status(ctx)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch log retention")
+	}
+	return response.OK(c, status)
+}
+
+// SetLogRetention - Change how long a log type is kept and whether it
+// is archived before deletion; the next hourly prune applies it
+func (h *LogRetentionHandler) SetLogRetention(c *fiber.Ctx) error {
+	var req LogRetentionRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	p, err := h.store.Set(ctx, logretention.Policy{
+		Type:          c.Params("type"),
+		RetentionDays: req.RetentionDays.Int,
+		Archive:       req.Archive.Bool,
+	})
+	if errors.Is(err, logretention.ErrUnknownType) {
+		return response.Fail(c, 404, "Log type not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to change log retention")
+	}
+
+	publish(c, events.Event{
+		Type:     events.LogRetentionChanged,
+		Resource: "log_retention",
+		Data: map[string]interface{}{
+			"log_type":       p.Type,
+			"retention_days": p.RetentionDays,
+			"archive":        p.Archive,
+		},
+	})
+
+	return response.OK(c, p)
+}
+
+// PruneLogs - Apply the retention now instead of at the next hourly run
+func (h *LogRetentionHandler) PruneLogs(c *fiber.Ctx) error {
+	policies, err := h.store.Prune(c.UserContext())
+	if err != nil {
+		return serviceError(c, err, "", "Failed to prune logs")
+	}
+	return response.OK(c, policies)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/logretention"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLogRetentionHandler(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO audit_logs (action, created_at) VALUES
+		('login', '2020-01-01 00:00:00'), ('login', '2999-01-01 00:00:00')`)
+
+	h := NewLogRetentionHandler(logretention.New(db, t.TempDir()), &config.Config{})
+	app := fiber.New()
+	app.Get("/admin/log-retention", h.GetLogRetention)
+	app.Put("/admin/log-retention/:type", h.SetLogRetention)
+	app.Post("/admin/log-retention/prune", h.PruneLogs)
+
+	do := func(method, path, body string, out interface{}) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		raw, _ := json.Marshal(env.Data)
+		json.Unmarshal(raw, out)
+		return resp.StatusCode
+	}
+
+	var p logretention.Policy
+	if status := do("PUT", "/admin/log-retention/audit_logs", `{"retention_days": "30"}`, &p); status != 200 || p.RetentionDays != 30 || p.Archive {
+		t.Fatalf("Expected the retention set, got %d %+v", status, p)
+	}
+	if status := do("PUT", "/admin/log-retention/access_logs", `{"retention_days": 30}`, &p); status != 404 {
+		t.Errorf("Expected status 404 for an unknown log type, got %d", status)
+	}
+	if status := do("PUT", "/admin/log-retention/audit_logs", `{"retention_days": -1}`, &p); status != 422 {
+		t.Errorf("Expected status 422 for a negative retention, got %d", status)
+	}
+
+	var list []logretention.Status
+	if status := do("GET", "/admin/log-retention", "", &list); status != 200 || len(list) != 2 ||
+		list[1].Type != "audit_logs" || list[1].Rows != 2 || list[1].Pending != 1 {
+		t.Fatalf("Expected the audit log with one row due, got %d %+v", status, list)
+	}
+
+	var pruned []logretention.Policy
+	if status := do("POST", "/admin/log-retention/prune", "", &pruned); status != 200 || len(pruned) != 2 || pruned[1].LastDeleted != 1 {
+		t.Errorf("Expected the old audit log deleted, got %d %+v", status, pruned)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/maintenance"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type MaintenanceHandler struct {
+	store *maintenance.Store
+	cfg   *config.Config
+}
+
+func NewMaintenanceHandler(store *maintenance.Store, cfg *config.Config) *MaintenanceHandler {
+	return &MaintenanceHandler{store: store, cfg: cfg}
+}
+
+// MaintenanceRequest turns the maintenance mode on or off. The ETA is an
+// RFC 3339 time; message and ETA are shown on the public 503.
+type MaintenanceRequest struct {
+	Enabled     validate.FlexibleBool `json:"enabled" validate:"required"`
+	Message     string                `json:"message" validate:"max=500"`
+	ETA         string                `json:"eta"`
+	StopStreams validate.FlexibleBool `json:"stop_streams"`
+}
+
+// GetMaintenance - Whether the maintenance mode is on, with its message
+// and ETA
+func (h *MaintenanceHandler) GetMaintenance(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	state, err := h.store.Current(ctx)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch maintenance mode")
+	}
+	return response.OK(c, state)
+}
+
+// SetMaintenance - Turn the maintenance mode on, update it or end it.
+// While it is on public endpoints answer 503, and streams too with
+// stop_streams; the admin APIs stay available.
+func (h *MaintenanceHandler) SetMaintenance(c *fiber.Ctx) error {
+	var req MaintenanceRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	state := maintenance.State{Enabled: req.Enabled.Bool}
+	if state.Enabled {
+		state.Message = strings.TrimSpace(req.Message)
+		state.StopStreams = req.StopStreams.Bool
+		if req.ETA != "" {
+			eta, err := time.Parse(time.RFC3339, req.ETA)
+			switch {
+			case err != nil:
+				return invalidFields(c, "", map[string]string{"eta": "must be an RFC 3339 time"})
+			case !eta.After(time.Now()):
+				return invalidFields(c, "", map[string]string{"eta": "must be in the future"})
+			}
+			eta = eta.UTC()
+			state.ETA = &eta
+		}
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	state, err := h.store.Set(ctx, state)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to change maintenance mode")
+	}
+
+	publish(c, events.Event{
+		Type:     events.MaintenanceChanged,
+		Resource: "maintenance",
+		Data: map[string]interface{}{
+			"enabled":      state.Enabled,
+			"message":      state.Message,
+			"eta":          state.ETA,
+			"stop_streams": state.StopStreams,
+		},
+	})
+
+	return response.OK(c, state)
+}
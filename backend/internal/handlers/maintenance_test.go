@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/maintenance"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMaintenanceHandler(t *testing.T) {
+	db := dbtest.Open(t)
+
+	h := NewMaintenanceHandler(maintenance.New(db), &config.Config{})
+	app := fiber.New()
+	app.Get("/admin/maintenance", h.GetMaintenance)
+	app.Post("/admin/maintenance", h.SetMaintenance)
+
+	do := func(method, body string) (int, maintenance.State) {
+		req := httptest.NewRequest(method, "/admin/maintenance", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		raw, _ := json.Marshal(env.Data)
+		var state maintenance.State
+		json.Unmarshal(raw, &state)
+		return resp.StatusCode, state
+	}
+
+	eta := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	status, state := do("POST", `{"enabled":true,"message":" Upgrading go2rtc ","eta":"`+eta.Format(time.RFC3339)+`"}`)
+	if status != 200 || !state.Enabled || state.Message != "Upgrading go2rtc" || state.ETA == nil || !state.ETA.Equal(eta) {
+		t.Fatalf("Expected maintenance on until the ETA, got %d %+v", status, state)
+	}
+	if status, state := do("GET", ""); status != 200 || !state.Enabled || state.StartedAt == nil || state.StopStreams {
+		t.Errorf("Expected the mode on with streams playing, got %d %+v", status, state)
+	}
+
+	for _, body := range []string{
+		`{}`,
+		`{"enabled":true,"eta":"tomorrow"}`,
+		`{"enabled":true,"eta":"2020-01-01T00:00:00Z"}`,
+	} {
+		if status, _ := do("POST", body); status != 422 {
+			t.Errorf("Expected status 422 for %s, got %d", body, status)
+		}
+	}
+
+	if status, state := do("POST", `{"enabled":false,"message":"ignored"}`); status != 200 || state.Enabled || state.Message != "" || state.StartedAt != nil {
+		t.Errorf("Expected maintenance over, got %d %+v", status, state)
+	}
+}
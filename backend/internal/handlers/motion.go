@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/motion"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type MotionHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewMotionHandler(db *sql.DB, cfg *config.Config) *MotionHandler {
+	return &MotionHandler{db: db, cfg: cfg}
+}
+
+// MotionSettingsRequest replaces a camera's motion settings; omitted
+// sensitivity and cooldown fall back to the defaults
+type MotionSettingsRequest struct {
+	Enabled         validate.FlexibleBool `json:"enabled"`
+	Sensitivity     validate.FlexibleInt  `json:"sensitivity" validate:"min=1,max=100"`
+	Zones           []motion.Zone         `json:"zones" validate:"max=20"`
+	CooldownSeconds validate.FlexibleInt  `json:"cooldown_seconds" validate:"min=0,max=86400"`
+}
+
+// GetMotionEvents - Motion detected on a camera, newest first. Filters:
+// from/to as RFC 3339 times or YYYY-MM-DD dates. ?cursor= switches to
+// keyset pagination.
+func (h *MotionHandler) GetMotionEvents(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	conds, args, msg := timeRange(c, "created_at")
+	if msg != "" {
+		return response.Fail(c, 400, msg)
+	}
+	where := " WHERE " + strings.Join(append([]string{"camera_id = ?"}, conds...), " AND ")
+	args = append([]interface{}{id}, args...)
+
+	page, err := response.ParseKeyset(c, 50)
+	if err != nil {
+		return response.Fail(c, 400, "Invalid cursor")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if found, err := cameraExists(ctx, h.db, id); err != nil {
+		return serviceError(c, err, "", "Failed to fetch motion events")
+	} else if !found {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	const columns = `
+		SELECT id, camera_id, score, zone, created_at
+		FROM motion_events`
+	query, pageArgs := paginate(columns+where+`
+		ORDER BY created_at DESC, id DESC
+	`, append([]interface{}{}, args...), page)
+	if page.Keyset {
+		query, pageArgs = keyset(columns, where, append([]interface{}{}, args...), "id", page)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, pageArgs...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch motion events")
+	}
+	defer rows.Close()
+
+	list := []motion.Event{}
+	var ids []int64
+	for rows.Next() {
+		var e motion.Event
+		if err := rows.Scan(&e.ID, &e.CameraID, &e.Score, &e.Zone, &e.CreatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read motion event", "error", err)
+			continue
+		}
+		list = append(list, e)
+		ids = append(ids, e.ID)
+	}
+
+	if page.Keyset {
+		n, meta := keysetMeta(page, ids)
+		return response.Paginated(c, list[:n], meta)
+	}
+
+	total := countTotal(ctx, h.db, page, len(list), "SELECT COUNT(*) FROM motion_events"+where, args...)
+
+	return response.Paginated(c, list, page.Meta(total))
+}
+
+// GetMotionSettings - A camera's motion detection settings
+func (h *MotionHandler) GetMotionSettings(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if found, err := cameraExists(ctx, h.db, id); err != nil {
+		return serviceError(c, err, "", "Failed to fetch motion settings")
+	} else if !found {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	settings, err := motion.GetSettings(ctx, h.db, id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch motion settings")
+	}
+	return response.OK(c, settings)
+}
+
+// UpdateMotionSettings - Replace a camera's motion detection settings
+func (h *MotionHandler) UpdateMotionSettings(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	var req MotionSettingsRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	if msg := motion.ValidateZones(req.Zones); msg != "" {
+		return invalidFields(c, "", map[string]string{"zones": msg})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if found, err := cameraExists(ctx, h.db, id); err != nil {
+		return serviceError(c, err, "", "Failed to update motion settings")
+	} else if !found {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	settings := &motion.Settings{
+		CameraID:        id,
+		Enabled:         req.Enabled.Bool,
+		Sensitivity:     motion.DefaultSensitivity,
+		Zones:           req.Zones,
+		CooldownSeconds: int(motion.DefaultCooldown / time.Second),
+	}
+	if req.Sensitivity.Set {
+		settings.Sensitivity = req.Sensitivity.Int
+	}
+	if req.CooldownSeconds.Set {
+		settings.CooldownSeconds = req.CooldownSeconds.Int
+	}
+	if err := motion.SaveSettings(ctx, h.db, settings); err != nil {
+		return serviceError(c, err, "", "Failed to update motion settings")
+	}
+
+	return c.JSON(response.Envelope{
+		Success: true,
+		Message: "Motion settings updated",
+		Data:    settings,
+	})
+}
+
+// cameraExists reports whether camera id belongs to the ctx organization
+func cameraExists(ctx context.Context, db *sql.DB, id int) (bool, error) {
+	var found int
+	err := db.QueryRowContext(ctx, `SELECT 1 FROM cameras WHERE id = ? AND organization_id = ?`,
+		id, tenant.OrgID(ctx)).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMotionHandler(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`)
+	day := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for i, at := range []time.Time{day, day.Add(time.Hour), day.AddDate(0, 0, 1)} {
+		if _, err := db.Exec(`INSERT INTO motion_events (camera_id, score, zone, created_at) VALUES (1, ?, 'door', ?)`, 0.1*float64(i+1), at); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	h := NewMotionHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Get("/cameras/:id/motion-events", h.GetMotionEvents)
+	app.Get("/cameras/:id/motion-settings", h.GetMotionSettings)
+	app.Put("/cameras/:id/motion-settings", h.UpdateMotionSettings)
+
+	do := func(method, path, body string) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	t.Run("Events", func(t *testing.T) {
+		status, env := do("GET", "/cameras/1/motion-events?from=2026-03-10&to=2026-03-10", "")
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		if got := len(env.Data.([]interface{})); got != 2 {
+			t.Errorf("Expected 2 events on the day, got %d", got)
+		}
+	})
+
+	t.Run("Events for a missing camera", func(t *testing.T) {
+		if status, _ := do("GET", "/cameras/9/motion-events", ""); status != 404 {
+			t.Errorf("Expected status 404, got %d", status)
+		}
+	})
+
+	t.Run("Invalid zone", func(t *testing.T) {
+		status, env := do("PUT", "/cameras/1/motion-settings", `{"zones":[{"name":"door","x":0.8,"y":0,"w":0.5,"h":0.5}]}`)
+		if status != 422 || env.Error.Fields["zones"] == "" {
+			t.Errorf("Expected a 422 for zones, got %d (%+v)", status, env.Error)
+		}
+	})
+
+	t.Run("Invalid sensitivity", func(t *testing.T) {
+		if status, _ := do("PUT", "/cameras/1/motion-settings", `{"sensitivity":"150"}`); status != 422 {
+			t.Errorf("Expected status 422, got %d", status)
+		}
+	})
+
+	t.Run("Update and read back", func(t *testing.T) {
+		status, env := do("PUT", "/cameras/1/motion-settings", `{"enabled":"true","sensitivity":70,"zones":[{"name":"door","x":0,"y":0,"w":0.5,"h":0.5}]}`)
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+
+		_, env = do("GET", "/cameras/1/motion-settings", "")
+		settings := env.Data.(map[string]interface{})
+		if settings["enabled"] != true || settings["sensitivity"] != float64(70) || settings["cooldown_seconds"] != float64(30) {
+			t.Errorf("Expected the saved settings, got %v", settings)
+		}
+		if zones := settings["zones"].([]interface{}); len(zones) != 1 {
+			t.Errorf("Expected 1 zone, got %v", zones)
+		}
+	})
+}
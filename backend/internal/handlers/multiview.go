@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// MultiviewRequest lists the stream keys a grid view is about to open
+type MultiviewRequest struct {
+	StreamKeys []string `json:"stream_keys" validate:"required"`
+}
+
+// GetMultiviewURLs - Signed stream URLs for several cameras at once, so
+// a grid view needs one request instead of one per tile. Every key gets
+// an entry, in the order given; unknown and disabled cameras get an
+// error instead of URLs.
+func (h *StreamHandler) GetMultiviewURLs(c *fiber.Ctx) error {
+	var req MultiviewRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	keys := make([]string, 0, len(req.StreamKeys))
+	seen := map[string]bool{}
+	for _, key := range req.StreamKeys {
+		if key = strings.TrimSpace(key); key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return invalidFields(c, "", map[string]string{"stream_keys": "is required"})
+	}
+	stream := h.cfg.Stream()
+	if len(keys) > stream.MultiviewMax {
+		return invalidFields(c, "", map[string]string{
+			"stream_keys": "must have at most " + strconv.Itoa(stream.MultiviewMax) + " items",
+		})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, stream_key, enabled
+		FROM cameras
+		WHERE stream_key IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")+`)
+	`, args...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch cameras")
+	}
+	defer rows.Close()
+
+	type camera struct {
+		id      int
+		name    string
+		enabled bool
+	}
+	found := map[string]camera{}
+	for rows.Next() {
+		var cam camera
+		var key string
+		if err := rows.Scan(&cam.id, &cam.name, &key, &cam.enabled); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read camera", "error", err)
+			continue
+		}
+		found[key] = cam
+	}
+	if err := rows.Err(); err != nil {
+		return serviceError(c, err, "", "Failed to fetch cameras")
+	}
+
+	baseURL := streamBaseURL(c, h.cfg)
+	expires := time.Now().Add(stream.SignedURLTTL).Truncate(time.Second)
+	list := make([]models.MultiviewStream, 0, len(keys))
+	for _, key := range keys {
+		s := models.MultiviewStream{StreamKey: key}
+		cam, ok := found[key]
+		switch {
+		case !ok:
+			s.Error = "Camera not found"
+		case !cam.enabled:
+			s.CameraID, s.Name = &cam.id, cam.name
+			s.Error = "Camera is disabled"
+		default:
+			s.CameraID, s.Name = &cam.id, cam.name
+			s.HLSURL = baseURL + "/api/stream/mse/" + key + "?" + signStream(h.cfg.JWT.Secret, key, expires)
+			s.WebRTCURL = baseURL + "/api/stream/webrtc/" + key
+			s.ExpiresAt = &expires
+		}
+		list = append(list, s)
+	}
+
+	c.Set("Cache-Control", "no-store")
+	return response.OK(c, list)
+}
+
+// signStream returns the query that signs streamKey until expires:
+// expires=<unix seconds>&sig=<HMAC-SHA256 of both under secret>
+func signStream(secret, streamKey string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return "expires=" + exp + "&sig=" + streamSignature(secret, streamKey, exp)
+}
+
+func streamSignature(secret, streamKey, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(streamKey + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkStreamSignature rejects a signed stream URL that was altered or
+// has expired. Unsigned URLs pass unless required is set.
+func checkStreamSignature(c *fiber.Ctx, secret, streamKey string, required bool) (int, string) {
+	sig, exp := c.Query("sig"), c.Query("expires")
+	if sig == "" && exp == "" {
+		if required {
+			return 403, "Stream URL must be signed"
+		}
+		return 0, ""
+	}
+	if !hmac.Equal([]byte(sig), []byte(streamSignature(secret, streamKey, exp))) {
+		return 403, "Invalid stream signature"
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || !time.Now().Before(time.Unix(unix, 0)) {
+		return 403, "Stream URL has expired"
+	}
+	return 0, ""
+}
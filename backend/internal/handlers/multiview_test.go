@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMultiview(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled) VALUES
+		(1, 'Gate', 'rtsp://a', 'gate', TRUE), (2, 'Market', 'rtsp://b', 'market', TRUE), (3, 'Spare', 'rtsp://c', 'spare', FALSE)`)
+
+	// A closed server refuses connections, so a stream request that gets
+	// past the checks answers 502
+	upstream := httptest.NewServer(nil)
+	upstream.Close()
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{Secret: "secret"},
+		Go2RTC: config.Go2RTCConfig{
+			APIURL:              upstream.URL,
+			PublicStreamBaseURL: "https://stream.example",
+			BreakerFailures:     100,
+			SignedURLTTL:        time.Hour,
+			MultiviewMax:        4,
+		},
+	}
+	h := NewStreamHandler(db, cfg, nil, nil, context.Background())
+	app := fiber.New()
+	app.Post("/multiview", h.GetMultiviewURLs)
+	app.Get("/mse/:streamKey", h.ProxyMSE)
+	app.Get("/:streamKey", h.GetStreamURL)
+
+	post := func(body string) (int, []models.MultiviewStream) {
+		req := httptest.NewRequest("POST", "/multiview", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data []models.MultiviewStream `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+	play := func(rawURL string) int {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("Invalid URL %q: %v", rawURL, err)
+		}
+		resp, err := app.Test(httptest.NewRequest("GET", strings.TrimPrefix(u.Path, "/api/stream")+"?"+u.RawQuery, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	t.Run("Bundle", func(t *testing.T) {
+		status, list := post(`{"stream_keys":["market","spare","gone","gate","market"]}`)
+		if status != 200 || len(list) != 4 {
+			t.Fatalf("Expected 4 entries, got %d %+v", status, list)
+		}
+		if list[0].StreamKey != "market" || list[3].StreamKey != "gate" {
+			t.Errorf("Expected the order of the request, got %+v", list)
+		}
+		if list[1].Error != "Camera is disabled" || list[1].HLSURL != "" || list[2].Error != "Camera not found" {
+			t.Errorf("Expected errors for the disabled and unknown cameras, got %+v %+v", list[1], list[2])
+		}
+		if !strings.HasPrefix(list[0].HLSURL, "https://stream.example/api/stream/mse/market?expires=") || list[0].ExpiresAt == nil {
+			t.Errorf("Expected a signed MSE URL, got %+v", list[0])
+		}
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		for _, body := range []string{
+			`{"stream_keys":[]}`,
+			`{"stream_keys":[" "]}`,
+			`{"stream_keys":["a","b","c","d","e"]}`,
+		} {
+			if status, _ := post(body); status != 422 {
+				t.Errorf("Expected status 422 for %s, got %d", body, status)
+			}
+		}
+	})
+
+	t.Run("Signatures", func(t *testing.T) {
+		_, list := post(`{"stream_keys":["gate"]}`)
+		signed := list[0].HLSURL
+		if status := play(signed); status != 502 {
+			t.Errorf("Expected a signed URL to reach the stream server, got %d", status)
+		}
+		if status := play(strings.Replace(signed, "/gate?", "/market?", 1)); status != 403 {
+			t.Errorf("Expected status 403 for another camera's signature, got %d", status)
+		}
+		expired := "https://stream.example/api/stream/mse/gate?" + signStream("secret", "gate", time.Now().Add(-time.Minute))
+		if status := play(expired); status != 403 {
+			t.Errorf("Expected status 403 once expired, got %d", status)
+		}
+		if status := play("https://stream.example/api/stream/mse/gate"); status != 502 {
+			t.Errorf("Expected an unsigned URL to still work, got %d", status)
+		}
+	})
+
+	t.Run("Required", func(t *testing.T) {
+		cfg.Go2RTC.SignedURLsRequired = true
+		defer func() { cfg.Go2RTC.SignedURLsRequired = false }()
+
+		if status := play("https://stream.example/api/stream/mse/gate"); status != 403 {
+			t.Errorf("Expected status 403 for an unsigned URL, got %d", status)
+		}
+		if status := play("https://stream.example/api/stream/mse/gate?expires=1773147600"); status != 403 {
+			t.Errorf("Expected status 403 without sig, got %d", status)
+		}
+		_, list := post(`{"stream_keys":["gate"]}`)
+		if status := play(list[0].HLSURL); status != 502 {
+			t.Errorf("Expected a signed URL to reach the stream server, got %d", status)
+		}
+
+		// A single player's URL is signed too
+		resp, err := app.Test(httptest.NewRequest("GET", "/gate", nil), -1)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data struct {
+				HLSURL    string     `json:"hls_url"`
+				ExpiresAt *time.Time `json:"expires_at"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		if env.Data.ExpiresAt == nil || !strings.Contains(env.Data.HLSURL, "&sig=") {
+			t.Fatalf("Expected a signed stream URL, got %+v", env.Data)
+		}
+		if status := play(env.Data.HLSURL); status != 502 {
+			t.Errorf("Expected the signed stream URL to reach the stream server, got %d", status)
+		}
+	})
+}
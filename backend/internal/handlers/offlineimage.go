@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxOfflineImageSize bounds an uploaded offline image; the whole
+// request must also fit in the server's body limit
+const maxOfflineImageSize = 768 << 10
+
+// offlineImageTypes are the image formats accepted as offline images
+var offlineImageTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/webp": true}
+
+// offlineImages caches the offline image of each camera, including
+// cameras without one, since snapshots of offline cameras ask for it on
+// every request
+var offlineImages = cache.NewGroup("offline-images", time.Hour)
+
+// offlineImage is a placeholder image; an empty ContentType means none
+type offlineImage struct {
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+type OfflineImageHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewOfflineImageHandler(db *sql.DB, cfg *config.Config) *OfflineImageHandler {
+	return &OfflineImageHandler{db: db, cfg: cfg}
+}
+
+// GetOfflineImage - The offline image of the camera in :id, or without
+// one the organization's default
+func (h *OfflineImageHandler) GetOfflineImage(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	query := "SELECT content_type, data FROM offline_images WHERE organization_id = ? AND camera_id IS NULL"
+	args := []interface{}{tenant.OrgID(ctx)}
+	if cameraID != nil {
+		query = "SELECT content_type, data FROM offline_images WHERE organization_id = ? AND camera_id = ?"
+		args = append(args, *cameraID)
+	}
+
+	var image offlineImage
+	err = h.db.QueryRowContext(ctx, query, args...).Scan(&image.ContentType, &image.Data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, fiber.StatusNotFound, "No offline image set")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch offline image")
+	}
+	return sendOfflineImage(c, image)
+}
+
+// PutOfflineImage - Upload the offline image of the camera in :id, or
+// without one the organization's default, as the "image" field of a
+// multipart form: a JPEG, PNG or WebP of at most 768 KB
+func (h *OfflineImageHandler) PutOfflineImage(c *fiber.Ctx) error {
+	file, err := c.FormFile("image")
+	if err != nil {
+		return invalidFields(c, "", map[string]string{"image": "is required"})
+	}
+	f, err := file.Open()
+	if err != nil {
+		return response.Fail(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxOfflineImageSize+1))
+	f.Close()
+	if err != nil {
+		return response.Fail(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(data) > maxOfflineImageSize {
+		return invalidFields(c, "", map[string]string{"image": "must be at most 768 KB"})
+	}
+	contentType := http.DetectContentType(data)
+	if !offlineImageTypes[contentType] {
+		return invalidFields(c, "", map[string]string{"image": "must be a JPEG, PNG or WebP image"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	conflict := "(organization_id) WHERE camera_id IS NULL"
+	if cameraID != nil {
+		conflict = "(camera_id)"
+	}
+	_, err = h.db.ExecContext(ctx, `
+		INSERT INTO offline_images (organization_id, camera_id, content_type, data, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT `+conflict+` DO UPDATE SET content_type = excluded.content_type,
+			data = excluded.data, updated_at = excluded.updated_at
+	`, tenant.OrgID(ctx), cameraID, contentType, data, time.Now().UTC())
+	if err != nil {
+		return serviceError(c, err, "", "Failed to save offline image")
+	}
+	forgetOfflineImages(ctx)
+
+	return response.OK(c, fiber.Map{"content_type": contentType, "size": len(data)})
+}
+
+// DeleteOfflineImage - Remove the offline image of the camera in :id, or
+// without one the organization's default
+func (h *OfflineImageHandler) DeleteOfflineImage(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cameraID, ok, err := h.camera(c, ctx)
+	if !ok {
+		return err
+	}
+	query := "DELETE FROM offline_images WHERE organization_id = ? AND camera_id IS NULL"
+	args := []interface{}{tenant.OrgID(ctx)}
+	if cameraID != nil {
+		query = "DELETE FROM offline_images WHERE organization_id = ? AND camera_id = ?"
+		args = append(args, *cameraID)
+	}
+
+	result, err := h.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete offline image")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, fiber.StatusNotFound, "No offline image set")
+	}
+	forgetOfflineImages(ctx)
+
+	return response.Message(c, "Offline image deleted")
+}
+
+// camera returns the camera in the :id param, checked to belong to the
+// organization, or nil on the routes of the organization's default.
+// When ok is false the response has been written and the handler
+// should return err.
+func (h *OfflineImageHandler) camera(c *fiber.Ctx, ctx context.Context) (cameraID *int, ok bool, err error) {
+	if c.Params("id") == "" {
+		return nil, true, nil
+	}
+	id, valid := paramID(c)
+	if !valid {
+		return nil, false, response.Fail(c, fiber.StatusNotFound, "Camera not found")
+	}
+	var exists bool
+	err = h.db.QueryRowContext(ctx, "SELECT TRUE FROM cameras WHERE id = ? AND organization_id = ?",
+		id, tenant.OrgID(ctx)).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, response.Fail(c, fiber.StatusNotFound, "Camera not found")
+	}
+	if err != nil {
+		return nil, false, serviceError(c, err, "", "Failed to fetch camera")
+	}
+	return &id, true, nil
+}
+
+// loadOfflineImage returns the image shown for a camera of orgID while
+// it is offline: its own, else the organization's default. The
+// ContentType is empty when there is neither.
+func loadOfflineImage(ctx context.Context, db *sql.DB, orgID, cameraID int) (offlineImage, error) {
+	var image offlineImage
+	key := strconv.Itoa(orgID) + ":" + strconv.Itoa(cameraID)
+	err := offlineImages.Load(ctx, key, &image, func() error {
+		err := db.QueryRowContext(ctx, `
+			SELECT content_type, data FROM offline_images
+			WHERE organization_id = ? AND (camera_id = ? OR camera_id IS NULL)
+			ORDER BY camera_id IS NULL LIMIT 1
+		`, orgID, cameraID).Scan(&image.ContentType, &image.Data)
+		if errors.Is(err, sql.ErrNoRows) {
+			image = offlineImage{}
+			return nil
+		}
+		return err
+	})
+	return image, err
+}
+
+// forgetOfflineImages drops the cached offline images after one changed
+func forgetOfflineImages(ctx context.Context) {
+	if err := offlineImages.Invalidate(ctx); err != nil {
+		logger.FromContext(ctx).Warn("Failed to invalidate cached offline images", "error", err)
+	}
+}
+
+func sendOfflineImage(c *fiber.Ctx, image offlineImage) error {
+	c.Set(fiber.HeaderContentType, image.ContentType)
+	c.Set("Cache-Control", "no-cache")
+	return c.Send(image.Data)
+}
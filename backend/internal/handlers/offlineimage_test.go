@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestOfflineImages(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled) VALUES
+			(1, 'Gate', 'rtsp://a', 'gate', TRUE), (2, 'Market', 'rtsp://b', 'market', TRUE),
+			(3, 'Yard', 'rtsp://c', 'yard', TRUE)`,
+		`INSERT INTO camera_health (camera_id, status) VALUES (1, 'online'), (2, 'offline')`,
+	)
+
+	// go2rtc has a frame of the gate camera only
+	frame := []byte("\xff\xd8\xff\xe0live")
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("src") != "gate" {
+			http.Error(w, "no stream", http.StatusNotFound)
+			return
+		}
+		w.Write(frame)
+	}))
+	defer go2rtc.Close()
+
+	cfg := &config.Config{Go2RTC: config.Go2RTCConfig{APIURL: go2rtc.URL, PublicStreamBaseURL: "https://stream.example", BreakerFailures: 100}}
+	h := NewOfflineImageHandler(db, cfg)
+	streams := NewStreamHandler(db, cfg, nil, nil, context.Background())
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	for _, path := range []string{"/offline-image", "/cameras/:id/offline-image"} {
+		app.Get(path, h.GetOfflineImage)
+		app.Put(path, h.PutOfflineImage)
+		app.Delete(path, h.DeleteOfflineImage)
+	}
+	app.Get("/stream/:streamKey", streams.GetStreamURL)
+	app.Get("/stream/:streamKey/snapshot", streams.GetSnapshot)
+
+	do := func(method, path string, org int, image []byte) (int, http.Header, []byte) {
+		t.Helper()
+		var body io.Reader
+		contentType := ""
+		if image != nil {
+			var form bytes.Buffer
+			w := multipart.NewWriter(&form)
+			part, _ := w.CreateFormFile("image", "offline")
+			part.Write(image)
+			w.Close()
+			body, contentType = &form, w.FormDataContentType()
+		}
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header, data
+	}
+
+	fallback := []byte("\x89PNG\r\n\x1a\nfallback")
+	own := []byte("\xff\xd8\xff\xe0market")
+	if status, _, body := do("PUT", "/offline-image", 1, fallback); status != 200 {
+		t.Fatalf("Expected the default to be saved, got %d: %s", status, body)
+	}
+	if status, _, body := do("PUT", "/cameras/2/offline-image", 1, own); status != 200 {
+		t.Fatalf("Expected the camera's image to be saved, got %d: %s", status, body)
+	}
+
+	t.Run("Snapshot", func(t *testing.T) {
+		for key, want := range map[string][]byte{"gate": frame, "market": own, "yard": fallback} {
+			status, header, body := do("GET", "/stream/"+key+"/snapshot", 1, nil)
+			if status != 200 || !bytes.Equal(body, want) {
+				t.Errorf("%s: expected %q, got %d %q", key, want, status, body)
+			}
+			if offline := header.Get("X-Camera-Status") == "offline"; offline != (key != "gate") {
+				t.Errorf("%s: unexpected X-Camera-Status %q", key, header.Get("X-Camera-Status"))
+			}
+		}
+	})
+
+	t.Run("Stream URL", func(t *testing.T) {
+		for key, want := range map[string]string{"gate": "online", "market": "offline"} {
+			_, _, body := do("GET", "/stream/"+key, 1, nil)
+			var env struct {
+				Data struct {
+					Status      string `json:"status"`
+					SnapshotURL string `json:"snapshot_url"`
+				} `json:"data"`
+			}
+			json.Unmarshal(body, &env)
+			if env.Data.Status != want || env.Data.SnapshotURL != "https://stream.example/api/stream/"+key+"/snapshot" {
+				t.Errorf("%s: expected status %s with a snapshot URL, got %+v", key, want, env.Data)
+			}
+		}
+	})
+
+	t.Run("Replace and delete", func(t *testing.T) {
+		replaced := []byte("\x89PNG\r\n\x1a\nreplaced")
+		do("PUT", "/offline-image", 1, replaced)
+		if _, header, body := do("GET", "/offline-image", 1, nil); !bytes.Equal(body, replaced) || header.Get("Content-Type") != "image/png" {
+			t.Errorf("Expected the replaced default, got %s %q", header.Get("Content-Type"), body)
+		}
+		if status, _, _ := do("DELETE", "/cameras/2/offline-image", 1, nil); status != 200 {
+			t.Errorf("Expected status 200, got %d", status)
+		}
+		if _, _, body := do("GET", "/stream/market/snapshot", 1, nil); !bytes.Equal(body, replaced) {
+			t.Errorf("Expected the default once the camera's image is gone, got %q", body)
+		}
+		if status, _, _ := do("DELETE", "/cameras/2/offline-image", 1, nil); status != 404 {
+			t.Errorf("Expected status 404, got %d", status)
+		}
+		do("DELETE", "/offline-image", 1, nil)
+		if status, _, _ := do("GET", "/stream/market/snapshot", 1, nil); status != 503 {
+			t.Errorf("Expected status 503 without any offline image, got %d", status)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if status, _, _ := do("PUT", "/offline-image", 1, []byte("GIF89a")); status != 422 {
+			t.Errorf("Expected status 422 for a GIF, got %d", status)
+		}
+		if status, _, _ := do("PUT", "/offline-image", 1, append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, maxOfflineImageSize)...)); status != 422 {
+			t.Errorf("Expected status 422 for a large image, got %d", status)
+		}
+		if status, _, _ := do("PUT", "/cameras/1/offline-image", 2, fallback); status != 404 {
+			t.Errorf("Expected status 404 for another organization's camera, got %d", status)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type OrganizationHandler struct {
+	db       *sql.DB
+	cfg      *config.Config
+	resolver *tenant.Resolver
+}
+
+func NewOrganizationHandler(db *sql.DB, cfg *config.Config, resolver *tenant.Resolver) *OrganizationHandler {
+	return &OrganizationHandler{db: db, cfg: cfg, resolver: resolver}
+}
+
+// OrganizationRequest is the create/update body for an organization.
+// The slug selects it on public pages with ?org=; the optional domain
+// selects it by host name.
+type OrganizationRequest struct {
+	Name   string `json:"name" validate:"required,max=100"`
+	Slug   string `json:"slug" validate:"required,max=50"`
+	Domain string `json:"domain" validate:"max=253"`
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// GetOrganizations - All organizations (admin only)
+func (h *OrganizationHandler) GetOrganizations(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, slug, domain, created_at, updated_at
+		FROM organizations
+		ORDER BY id ASC
+	`)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch organizations")
+	}
+	defer rows.Close()
+
+	list := []models.Organization{}
+	for rows.Next() {
+		var o models.Organization
+		if err := rows.Scan(&o.ID, &o.Name, &o.Slug, &o.Domain, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read organization", "error", err)
+			continue
+		}
+		list = append(list, o)
+	}
+
+	return response.OK(c, list)
+}
+
+// CreateOrganization - Create an organization (admin only)
+func (h *OrganizationHandler) CreateOrganization(c *fiber.Ctx) error {
+	var req OrganizationRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRequest(ctx, c, &req, 0); !ok {
+		return err
+	}
+
+	now := time.Now()
+	var id int64
+	err := h.db.QueryRowContext(ctx, `
+		INSERT INTO organizations (name, slug, domain, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, req.Name, req.Slug, req.domain(), now, now).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create organization")
+	}
+	h.resolver.Invalidate()
+
+	return response.Created(c, "Organization created successfully", fiber.Map{
+		"id": id,
+	})
+}
+
+// UpdateOrganization - Replace an organization's name, slug and domain
+// (admin only)
+func (h *OrganizationHandler) UpdateOrganization(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Organization not found")
+	}
+
+	var req OrganizationRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRequest(ctx, c, &req, id); !ok {
+		return err
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE organizations SET name = ?, slug = ?, domain = ?, updated_at = ?
+		WHERE id = ?
+	`, req.Name, req.Slug, req.domain(), time.Now(), id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update organization")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Organization not found")
+	}
+	h.resolver.Invalidate()
+
+	return response.Message(c, "Organization updated successfully")
+}
+
+// orgTables hold the rows deleted with their organization. Their
+// organization_id has no foreign key, so a row left behind would outlive
+// it; API keys and edge node tokens would keep working.
+var orgTables = []string{
+	"settings", "incidents", "playlists", "announcements", "api_keys", "edge_nodes",
+	"alert_policies", "offline_images", "uploads", "camera_tickets", "camera_shares", "health_checks",
+}
+
+// DeleteOrganization - Delete an organization with the rows of
+// orgTables: its settings, API keys, edge nodes and so on (admin only).
+// The default organization cannot be deleted, nor one that still has
+// cameras, areas or users.
+func (h *OrganizationHandler) DeleteOrganization(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Organization not found")
+	}
+	if id == tenant.DefaultOrgID {
+		return response.Fail(c, 400, "Cannot delete the default organization")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete organization")
+	}
+	defer tx.Rollback()
+
+	var cameras, areas, users int
+	err = tx.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM cameras WHERE organization_id = ?),
+		       (SELECT COUNT(*) FROM areas WHERE organization_id = ?),
+		       (SELECT COUNT(*) FROM users WHERE organization_id = ?)
+	`, id, id, id).Scan(&cameras, &areas, &users)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete organization")
+	}
+	if cameras+areas+users > 0 {
+		message := "Cannot delete an organization that still has cameras, areas or users"
+		return c.Status(400).JSON(response.Envelope{
+			Success: false,
+			Message: message,
+			Data:    fiber.Map{"cameras": cameras, "areas": areas, "users": users},
+			Error:   response.NewError(400, message),
+		})
+	}
+
+	for _, table := range orgTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE organization_id = ?", id); err != nil {
+			return serviceError(c, err, "", "Failed to delete organization")
+		}
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM organizations WHERE id = ?", id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete organization")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Organization not found")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to delete organization")
+	}
+	h.resolver.Invalidate()
+
+	return response.Message(c, "Organization deleted successfully")
+}
+
+// checkRequest normalises the slug and domain and rejects ones another
+// organization uses. id is 0 for a new organization. When ok is false the
+// response has been written and the handler should return err.
+func (h *OrganizationHandler) checkRequest(ctx context.Context, c *fiber.Ctx, req *OrganizationRequest, id int) (ok bool, err error) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	req.Domain = strings.ToLower(strings.TrimSpace(req.Domain))
+
+	if !slugPattern.MatchString(req.Slug) {
+		return false, invalidFields(c, "", map[string]string{"slug": "must be lower case letters, digits and dashes"})
+	}
+	if strings.ContainsAny(req.Domain, "/: ") {
+		return false, invalidFields(c, "", map[string]string{"domain": "must be a host name without scheme or port"})
+	}
+
+	var taken int
+	err = h.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM organizations WHERE slug = ? AND id <> ?
+	`, req.Slug, id).Scan(&taken)
+	if err != nil {
+		return false, serviceError(c, err, "", "Failed to save organization")
+	}
+	if taken > 0 {
+		return false, invalidFields(c, "", map[string]string{"slug": "already in use"})
+	}
+
+	if req.Domain != "" {
+		err = h.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM organizations WHERE domain = ? AND id <> ?
+		`, req.Domain, id).Scan(&taken)
+		if err != nil {
+			return false, serviceError(c, err, "", "Failed to save organization")
+		}
+		if taken > 0 {
+			return false, invalidFields(c, "", map[string]string{"domain": "already in use"})
+		}
+	}
+	return true, nil
+}
+
+// domain is the column value: NULL when no domain is set, as several
+// organizations may have none
+func (r *OrganizationRequest) domain() *string {
+	if r.Domain == "" {
+		return nil
+	}
+	return &r.Domain
+}
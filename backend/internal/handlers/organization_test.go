@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/apikeys"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestOrganizations(t *testing.T) {
+	db := dbtest.Open(t)
+
+	cfg := &config.Config{}
+	orgs := NewOrganizationHandler(db, cfg, tenant.NewResolver(db))
+	areas := NewAreaHandler(db, cfg)
+	settings := NewSettingsHandler(db, cfg)
+
+	app := fiber.New()
+	// Stands in for AuthMiddleware: the test picks the organization
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/organizations", orgs.GetOrganizations)
+	app.Post("/organizations", orgs.CreateOrganization)
+	app.Put("/organizations/:id", orgs.UpdateOrganization)
+	app.Delete("/organizations/:id", orgs.DeleteOrganization)
+	app.Get("/areas", areas.GetAllAreas)
+	app.Post("/areas", areas.CreateArea)
+	app.Put("/settings/:key", settings.UpdateSetting)
+	app.Get("/branding", settings.GetPublicBranding)
+
+	do := func(method, path, body string, org int) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		status, env := do("POST", "/organizations", `{"name":"Tanjungharjo","slug":" Tanjungharjo ","domain":"CCTV.Tanjungharjo.id"}`, 1)
+		if status != 201 {
+			t.Fatalf("Expected status 201, got %d (%+v)", status, env.Error)
+		}
+		var slug, domain string
+		db.QueryRow(`SELECT slug, domain FROM organizations WHERE id = 2`).Scan(&slug, &domain)
+		if slug != "tanjungharjo" || domain != "cctv.tanjungharjo.id" {
+			t.Errorf("Expected a lower case slug and domain, got %q and %q", slug, domain)
+		}
+	})
+
+	t.Run("Invalid and duplicate slugs", func(t *testing.T) {
+		for _, body := range []string{`{"name":"Dander","slug":"desa dander"}`, `{"name":"Other","slug":"default"}`} {
+			status, env := do("POST", "/organizations", body, 1)
+			if status != 422 || env.Error.Fields["slug"] == "" {
+				t.Errorf("Expected a 422 for slug, got %d (%+v)", status, env.Error)
+			}
+		}
+	})
+
+	t.Run("Areas are isolated", func(t *testing.T) {
+		for _, org := range []int{1, 2} {
+			if status, env := do("POST", "/areas", `{"name":"RT 01"}`, org); status != 201 {
+				t.Fatalf("Expected status 201 in org %d, got %d (%+v)", org, status, env.Error)
+			}
+		}
+		do("POST", "/areas", `{"name":"RT 02"}`, 2)
+
+		_, env := do("GET", "/areas", "", 1)
+		if list := env.Data.([]interface{}); len(list) != 1 {
+			t.Errorf("Expected 1 area in the default organization, got %v", list)
+		}
+	})
+
+	t.Run("Branding per organization", func(t *testing.T) {
+		if status, env := do("PUT", "/settings/company_name", `{"value":"Desa Tanjungharjo","category":"branding"}`, 2); status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		_, env := do("GET", "/branding", "", 2)
+		if name := env.Data.(map[string]interface{})["company_name"]; name != "Desa Tanjungharjo" {
+			t.Errorf("Expected the organization's name, got %v", name)
+		}
+		_, env = do("GET", "/branding", "", 1)
+		if name := env.Data.(map[string]interface{})["company_name"]; name != "RAF NET" {
+			t.Errorf("Expected the default name, got %v", name)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if status, _ := do("DELETE", "/organizations/1", "", 1); status != 400 {
+			t.Errorf("Expected the default organization to be kept, got %d", status)
+		}
+		if status, _ := do("DELETE", "/organizations/2", "", 1); status != 400 {
+			t.Errorf("Expected an organization with areas to be kept, got %d", status)
+		}
+
+		db.Exec(`DELETE FROM areas WHERE organization_id = 2`)
+		db.Exec(`INSERT INTO api_keys (organization_id, name, key_hash) VALUES (2, 'Partner', ?)`, apikeys.Hash("partner-key"))
+		if _, err := db.Exec(`INSERT INTO edge_nodes (organization_id, name, token_hash) VALUES (2, 'Balai desa', 'edge-hash')`); err != nil {
+			t.Fatalf("Failed to add edge node: %v", err)
+		}
+		if status, env := do("DELETE", "/organizations/2", "", 1); status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		for _, table := range orgTables {
+			var left int
+			db.QueryRow(`SELECT COUNT(*) FROM ` + table + ` WHERE organization_id = 2`).Scan(&left)
+			if left != 0 {
+				t.Errorf("Expected the organization's %s to be deleted, got %d", table, left)
+			}
+		}
+		if _, ok, err := apikeys.New(db).Lookup(context.Background(), "partner-key"); ok || err != nil {
+			t.Errorf("Expected the organization's API key to stop working, got %v %v", ok, err)
+		}
+	})
+}
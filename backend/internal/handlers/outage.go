@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/outages"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type OutageHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewOutageHandler(db *sql.DB, cfg *config.Config) *OutageHandler {
+	return &OutageHandler{db: db, cfg: cfg}
+}
+
+// OutageTimeline is a camera's outages over a range, with the share of
+// it the camera was up
+type OutageTimeline struct {
+	CameraID        int              `json:"camera_id"`
+	Range           string           `json:"range"`
+	From            time.Time        `json:"from"`
+	To              time.Time        `json:"to"`
+	Outages         []outages.Outage `json:"outages"` // oldest first
+	DowntimeSeconds int64            `json:"downtime_seconds"`
+	UptimePercent   float64          `json:"uptime_percent"`
+}
+
+// GetCameraOutages - The intervals a camera was offline, with their
+// durations and causes, over ?range= (24h, 7d, 30d or 90d; 30d by
+// default). Outages that began before the range are listed whole, but
+// only their part within it counts as downtime.
+func (h *OutageHandler) GetCameraOutages(c *fiber.Ctx) error {
+	cameraID, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+	rangeKey := c.Query("range", "30d")
+	window, ok := areaStatsRanges[rangeKey]
+	if !ok {
+		return invalidFields(c, "", map[string]string{"range": "must be 24h, 7d, 30d or 90d"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	found, err := cameraExists(ctx, h.db, cameraID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch outages")
+	}
+	if !found {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	from := now.Add(-window)
+	list, err := outages.List(ctx, h.db, cameraID, from, now, now)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch outages")
+	}
+	downtime := outages.Downtime(list, from, now)
+	return response.OK(c, OutageTimeline{
+		CameraID:        cameraID,
+		Range:           rangeKey,
+		From:            from,
+		To:              now,
+		Outages:         list,
+		DowntimeSeconds: int64(downtime / time.Second),
+		UptimePercent:   math.Round((1-float64(downtime)/float64(window))*10000) / 100,
+	})
+}
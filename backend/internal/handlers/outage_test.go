@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/outages"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGetCameraOutages(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url) VALUES (1, 'Gate', 'rtsp://a'), (2, 'Yard', 'rtsp://b')`)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, o := range []struct {
+		online bool
+		cause  string
+		at     time.Time
+	}{
+		{false, "tcp: connection refused", now.Add(-25 * time.Hour)}, // half an hour within the last day
+		{true, "", now.Add(-23*time.Hour - 30*time.Minute)},
+		{false, "rtsp: 401 Unauthorized", now.Add(-2 * time.Hour)},
+		{false, "rtsp: timeout", now.Add(-time.Hour)}, // still the same outage
+	} {
+		if err := outages.Record(ctx, db, 1, o.online, o.cause, o.at); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	app := fiber.New()
+	app.Get("/cameras/:id/outages", NewOutageHandler(db, &config.Config{}).GetCameraOutages)
+	get := func(path string) (int, OutageTimeline) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data OutageTimeline `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+
+	status, timeline := get("/cameras/1/outages?range=24h")
+	if status != 200 || len(timeline.Outages) != 2 {
+		t.Fatalf("Expected 2 outages, got %d: %+v", status, timeline)
+	}
+	first, last := timeline.Outages[0], timeline.Outages[1]
+	if first.Duration != 90*60 || first.Cause != "tcp: connection refused" || first.Ongoing {
+		t.Errorf("First outage = %+v", first)
+	}
+	if !last.Ongoing || last.EndedAt != nil || last.Cause != "rtsp: 401 Unauthorized" {
+		t.Errorf("Last outage = %+v", last)
+	}
+	// Half an hour of the first and two hours of the last
+	if timeline.DowntimeSeconds < 150*60 || timeline.DowntimeSeconds > 150*60+2 || timeline.UptimePercent != 89.58 {
+		t.Errorf("Downtime = %ds, uptime %v%%", timeline.DowntimeSeconds, timeline.UptimePercent)
+	}
+
+	if _, timeline := get("/cameras/2/outages"); timeline.Range != "30d" || len(timeline.Outages) != 0 || timeline.UptimePercent != 100 {
+		t.Errorf("Expected no outages in 30 days, got %+v", timeline)
+	}
+	if status, _ := get("/cameras/1/outages?range=1y"); status != 422 {
+		t.Errorf("Expected 422 for an unknown range, got %d", status)
+	}
+	if status, _ := get("/cameras/9/outages"); status != 404 {
+		t.Errorf("Expected 404 for an unknown camera, got %d", status)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/abcdefak87/cctv/internal/repository"
+	"github.com/abcdefak87/cctv/pkg/response"
+)
+
+// paginate appends LIMIT/OFFSET for paged requests
+func paginate(query string, args []interface{}, page response.Page) (string, []interface{}) {
+	if !page.Paged() {
+		return query, args
+	}
+	return query + " LIMIT ? OFFSET ?", append(args, page.Limit, page.Offset())
+}
+
+// countTotal returns the total for the list meta. Unpaged requests already
+// hold every row, so the extra COUNT query is skipped.
+func countTotal(ctx context.Context, db *sql.DB, page response.Page, fetched int, query string, args ...interface{}) int {
+	if !page.Paged() {
+		return fetched
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return fetched
+	}
+	return total
+}
+
+// listOptions converts a parsed page into repository list options
+func listOptions(page response.Page) repository.ListOptions {
+	return repository.ListOptions{Limit: page.Limit, Offset: page.Offset()}
+}
+
+// keyset appends the cursor condition, ordering and LIMIT for a keyset
+// page to a query ending in where (empty or a WHERE clause). Rows come
+// newest first by id: the insert order of these append-only tables,
+// indexed as the primary key, so deep pages cost no more than the first.
+// One row past the limit is fetched to tell whether another page follows.
+func keyset(query, where string, args []interface{}, idColumn string, page response.Page) (string, []interface{}) {
+	if page.After > 0 {
+		if where == "" {
+			where = " WHERE "
+		} else {
+			where += " AND "
+		}
+		where += idColumn + " < ?"
+		args = append(args, page.After)
+	}
+	return query + where + " ORDER BY " + idColumn + " DESC LIMIT ?", append(args, page.Limit+1)
+}
+
+// keysetMeta takes the ids of the rows fetched by keyset, in order, and
+// returns how many of them to send and the page meta
+func keysetMeta(page response.Page, ids []int64) (int, *response.Meta) {
+	if len(ids) <= page.Limit {
+		return len(ids), page.CursorMeta(0)
+	}
+	return page.Limit, page.CursorMeta(ids[page.Limit-1])
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/internal/playback"
+	"github.com/abcdefak87/cctv/internal/recordings"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxPlaybackRange bounds the time range of one playback playlist
+const maxPlaybackRange = 24 * time.Hour
+
+// hlsContentType is the media type of HLS playlists
+const hlsContentType = "application/vnd.apple.mpegurl"
+
+// keyframeCache holds the keyframes found in each recording. Finished
+// recordings do not change, so entries are only keyed by id and size.
+var keyframeCache = cache.NewGroup("keyframes", 24*time.Hour)
+
+// GetPlaybackPlaylist - HLS master playlist over a camera's recordings
+// between ?from= and ?to= (RFC 3339, at most a day apart), listing the
+// full playlist and keyframe-only ones for 1x, 2x and 4x fast forward
+func (h *RecordingHandler) GetPlaybackPlaylist(c *fiber.Ctx) error {
+	segments, ok, err := h.playbackSegments(c, true)
+	if !ok {
+		return err
+	}
+
+	query := url.Values{"from": {c.Query("from")}, "to": {c.Query("to")}}
+	media := playback.Variant{URI: "vod.m3u8?" + query.Encode(), Bandwidth: playback.MediaBandwidth(segments)}
+	var iframes []playback.Variant
+	for _, speed := range playback.Speeds {
+		query.Set("speed", strconv.Itoa(speed))
+		iframes = append(iframes, playback.Variant{
+			URI:       "iframes.m3u8?" + query.Encode(),
+			Bandwidth: playback.IFrameBandwidth(segments, speed),
+		})
+	}
+	return sendPlaylist(c, playback.Master(media, iframes))
+}
+
+// GetPlaybackMedia - HLS VOD playlist of a camera's recordings between
+// ?from= and ?to=, one segment per recording, so players can seek
+// across the whole range
+func (h *RecordingHandler) GetPlaybackMedia(c *fiber.Ctx) error {
+	segments, ok, err := h.playbackSegments(c, false)
+	if !ok {
+		return err
+	}
+	return sendPlaylist(c, playback.Media(segments))
+}
+
+// GetPlaybackIFrames - Keyframe-only HLS playlist of a camera's
+// recordings between ?from= and ?to=, for fast forward and scrubbing.
+// ?speed=2 or 4 keeps every second or fourth keyframe.
+func (h *RecordingHandler) GetPlaybackIFrames(c *fiber.Ctx) error {
+	speed := c.QueryInt("speed", 1)
+	valid := false
+	for _, s := range playback.Speeds {
+		valid = valid || s == speed
+	}
+	if !valid {
+		return invalidFields(c, "", map[string]string{"speed": "must be 1, 2 or 4"})
+	}
+
+	segments, ok, err := h.playbackSegments(c, true)
+	if !ok {
+		return err
+	}
+	return sendPlaylist(c, playback.IFrames(segments, speed))
+}
+
+// GetRecordingSegment - A recording file of the camera, with range
+// requests for players that fetch keyframes or seek
+func (h *RecordingHandler) GetRecordingSegment(c *fiber.Ctx) error {
+	cameraID, err := strconv.Atoi(c.Params("cameraId"))
+	if err != nil {
+		return response.Fail(c, fiber.StatusNotFound, "Recording not found")
+	}
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, fiber.StatusNotFound, "Recording not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var path string
+	err = h.db.QueryRowContext(ctx, `
+		SELECT r.file_path FROM recordings r
+		JOIN cameras c ON c.id = r.camera_id
+		WHERE r.id = ? AND r.camera_id = ? AND c.organization_id = ?
+	`, id, cameraID, tenant.OrgID(ctx)).Scan(&path)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, fiber.StatusNotFound, "Recording not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch recording")
+	}
+
+	path = h.recordingFile(path)
+	if _, err := os.Stat(path); err != nil {
+		logger.FromContext(ctx).Warn("Recording file missing", "recording_id", id, "error", err)
+		return response.Fail(c, fiber.StatusNotFound, "Recording file not found")
+	}
+	if err := c.SendFile(path); err != nil {
+		return err
+	}
+	if isTS(path) {
+		c.Set(fiber.HeaderContentType, "video/mp2t")
+	}
+	c.Set("Cache-Control", "private, max-age=86400")
+	return nil
+}
+
+// DownloadRecording - A recording's file by the signed link of a
+// recording webhook; the link is the credential, so it needs no account
+func (h *RecordingHandler) DownloadRecording(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, fiber.StatusNotFound, "Recording not found")
+	}
+	switch err := recordings.CheckDownload(h.cfg.JWT.Secret, int64(id), c.Query("expires"), c.Query("sig"), time.Now()); err {
+	case nil:
+	case recordings.ErrLinkExpired:
+		return response.Fail(c, fiber.StatusForbidden, "Download link has expired")
+	default:
+		return response.Fail(c, fiber.StatusForbidden, "Invalid download link")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var path string
+	var cameraID int
+	err := h.db.QueryRowContext(ctx, `SELECT file_path, camera_id FROM recordings WHERE id = ?`, id).Scan(&path, &cameraID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, fiber.StatusNotFound, "Recording not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch recording")
+	}
+
+	path = h.recordingFile(path)
+	if _, err := os.Stat(path); err != nil {
+		logger.FromContext(ctx).Warn("Recording file missing", "recording_id", id, "error", err)
+		return response.Fail(c, fiber.StatusNotFound, "Recording file not found")
+	}
+	c.Attachment(fmt.Sprintf("camera-%d-recording-%d%s", cameraID, id, filepath.Ext(path)))
+	if err := c.SendFile(path); err != nil {
+		return err
+	}
+	c.Set("Cache-Control", "private, no-store")
+	return nil
+}
+
+// playbackSegments reads the camera and time range of a playback
+// request and returns the finished MPEG-TS recordings in it, oldest
+// first, with their keyframes when asked for. When ok is false the
+// response has been written and the handler should return err.
+func (h *RecordingHandler) playbackSegments(c *fiber.Ctx, keyframes bool) (segments []playback.Segment, ok bool, err error) {
+	cameraID, err := strconv.Atoi(c.Params("cameraId"))
+	if err != nil || cameraID <= 0 {
+		return nil, false, response.Fail(c, fiber.StatusNotFound, "Camera not found")
+	}
+	fields := map[string]string{}
+	from, fromErr := time.Parse(time.RFC3339, c.Query("from"))
+	if fromErr != nil {
+		fields["from"] = "must be an RFC 3339 time"
+	}
+	to, toErr := time.Parse(time.RFC3339, c.Query("to"))
+	switch {
+	case toErr != nil:
+		fields["to"] = "must be an RFC 3339 time"
+	case fromErr == nil && !to.After(from):
+		fields["to"] = "must be after from"
+	case fromErr == nil && to.Sub(from) > maxPlaybackRange:
+		fields["to"] = "must be at most a day after from"
+	}
+	if len(fields) > 0 {
+		return nil, false, invalidFields(c, "", fields)
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var exists bool
+	err = h.db.QueryRowContext(ctx, "SELECT TRUE FROM cameras WHERE id = ? AND organization_id = ?",
+		cameraID, tenant.OrgID(ctx)).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, response.Fail(c, fiber.StatusNotFound, "Camera not found")
+	}
+	if err != nil {
+		return nil, false, serviceError(c, err, "", "Failed to fetch camera")
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, file_path, file_size, duration, started_at, ended_at FROM recordings
+		WHERE camera_id = ? AND ended_at IS NOT NULL AND started_at < ? AND ended_at > ?
+		ORDER BY started_at ASC, id ASC
+	`, cameraID, to.UTC(), from.UTC())
+	if err != nil {
+		return nil, false, serviceError(c, err, "", "Failed to fetch recordings")
+	}
+	defer rows.Close()
+
+	type recording struct {
+		id   int64
+		path string
+		size int64
+	}
+	var found []recording
+	for rows.Next() {
+		var r recording
+		var duration int
+		var started, ended time.Time
+		if err := rows.Scan(&r.id, &r.path, &r.size, &duration, &started, &ended); err != nil {
+			logger.FromContext(ctx).Error("Failed to read recording", "error", err)
+			continue
+		}
+		if !isTS(r.path) {
+			continue
+		}
+		seconds := float64(duration)
+		if seconds <= 0 {
+			seconds = ended.Sub(started).Seconds()
+		}
+		found = append(found, r)
+		segments = append(segments, playback.Segment{
+			URI:      "segments/" + strconv.FormatInt(r.id, 10),
+			Start:    started,
+			Duration: seconds,
+			Size:     r.size,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, serviceError(c, err, "", "Failed to fetch recordings")
+	}
+	if len(segments) == 0 {
+		return nil, false, response.Fail(c, fiber.StatusNotFound, "No recordings in this range")
+	}
+
+	if keyframes {
+		// Scanning reads whole files, so it is not bound by the query
+		// timeout, only by the client staying connected
+		for i, r := range found {
+			segments[i].Keyframes = h.keyframes(c.UserContext(), r.id, r.size, h.recordingFile(r.path))
+		}
+	}
+	return segments, true, nil
+}
+
+// keyframes returns the keyframes of a recording file, scanning it on
+// the first request. A file that is missing or cannot be scanned has
+// none, so it is left out of keyframe playlists.
+func (h *RecordingHandler) keyframes(ctx context.Context, id, size int64, path string) []playback.Keyframe {
+	frames := []playback.Keyframe{}
+	key := strconv.FormatInt(id, 10) + ":" + strconv.FormatInt(size, 10)
+	err := keyframeCache.Load(ctx, key, &frames, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		found, err := playback.ScanKeyframes(f)
+		if err != nil && !errors.Is(err, playback.ErrNotTS) {
+			return err
+		}
+		frames = append(frames[:0], found...)
+		return nil
+	})
+	if err != nil {
+		logger.FromContext(ctx).Warn("Failed to scan recording for keyframes", "recording_id", id, "error", err)
+		return nil
+	}
+	return frames
+}
+
+// recordingFile resolves the file_path of a recording; relative paths
+// are under RECORDINGS_PATH
+func (h *RecordingHandler) recordingFile(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(h.cfg.Recording.Path, path)
+}
+
+// isTS reports whether a recording is MPEG-TS, which HLS players can
+// play as segments; MP4 recordings are only served as whole files
+func isTS(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ts")
+}
+
+func sendPlaylist(c *fiber.Ctx, playlist string) error {
+	c.Set(fiber.HeaderContentType, hlsContentType)
+	c.Set("Cache-Control", "private, max-age=60")
+	return c.SendString(playlist)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/recordings"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPlayback(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+
+	dir := t.TempDir()
+	for name, body := range map[string]string{"gate-1.ts": "0123456789", "gate-2.ts": "abcdefghij", "gate-3.mp4": "mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("Failed to write recording: %v", err)
+		}
+	}
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://a', 'gate')`,
+		`INSERT INTO recordings (id, camera_id, file_path, file_size, duration, started_at, ended_at) VALUES
+			(1, 1, 'gate-1.ts', 10, 600, '2026-05-01 10:00:00', '2026-05-01 10:10:00'),
+			(2, 1, 'gate-2.ts', 10, 0, '2026-05-01 10:20:00', '2026-05-01 10:25:00'),
+			(3, 1, 'gate-3.mp4', 3, 600, '2026-05-01 10:30:00', '2026-05-01 10:40:00'),
+			(4, 1, 'gate-4.ts', 0, 0, '2026-05-01 10:40:00', NULL),
+			(5, 1, 'gate-0.ts', 10, 600, '2026-05-01 09:00:00', '2026-05-01 09:10:00')`,
+	)
+
+	h := NewRecordingHandler(db, &config.Config{Recording: config.RecordingConfig{Path: dir}, JWT: config.JWTConfig{Secret: "secret"}})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/recordings/:cameraId/playlist.m3u8", h.GetPlaybackPlaylist)
+	app.Get("/recordings/:cameraId/vod.m3u8", h.GetPlaybackMedia)
+	app.Get("/recordings/:cameraId/iframes.m3u8", h.GetPlaybackIFrames)
+	app.Get("/recordings/:cameraId/segments/:id", h.GetRecordingSegment)
+	app.Get("/recording-downloads/:id", h.DownloadRecording)
+
+	get := func(path string, org int, header ...string) (int, string, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+	const span = "?from=2026-05-01T09:30:00Z&to=2026-05-01T11:00:00Z"
+
+	t.Run("Media", func(t *testing.T) {
+		status, contentType, body := get("/recordings/1/vod.m3u8"+span, 1)
+		if status != 200 || contentType != hlsContentType {
+			t.Fatalf("Expected a playlist, got %d %s: %s", status, contentType, body)
+		}
+		want := "#EXTINF:600.000,\nsegments/1\n#EXT-X-DISCONTINUITY\n" +
+			"#EXT-X-PROGRAM-DATE-TIME:2026-05-01T10:20:00.000Z\n#EXTINF:300.000,\nsegments/2\n#EXT-X-ENDLIST\n"
+		if !strings.HasSuffix(body, want) {
+			t.Errorf("Expected the two finished MPEG-TS recordings in range, got:\n%s", body)
+		}
+	})
+
+	t.Run("Master", func(t *testing.T) {
+		_, _, body := get("/recordings/1/playlist.m3u8"+span, 1)
+		for _, want := range []string{
+			"#EXT-X-STREAM-INF:BANDWIDTH=1\nvod.m3u8?from=2026-05-01T09%3A30%3A00Z&to=2026-05-01T11%3A00%3A00Z\n",
+			`URI="iframes.m3u8?from=2026-05-01T09%3A30%3A00Z&speed=4&to=2026-05-01T11%3A00%3A00Z"`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected the master playlist to contain %q, got:\n%s", want, body)
+			}
+		}
+		if status, _, _ := get("/recordings/1/iframes.m3u8"+span+"&speed=4", 1); status != 200 {
+			t.Errorf("Expected status 200 for the 4x keyframes, got %d", status)
+		}
+	})
+
+	t.Run("Segment", func(t *testing.T) {
+		status, contentType, body := get("/recordings/1/segments/2", 1, "Range", "bytes=2-4")
+		if status != 206 || contentType != "video/mp2t" || body != "cde" {
+			t.Errorf("Expected bytes 2-4 of the recording, got %d %s %q", status, contentType, body)
+		}
+		if status, _, _ := get("/recordings/1/segments/4", 1); status != 404 {
+			t.Errorf("Expected status 404 for a missing file, got %d", status)
+		}
+	})
+
+	t.Run("Download link", func(t *testing.T) {
+		link := func(id int64, expires time.Time) string {
+			return strings.TrimPrefix(recordings.DownloadURL("", "secret", id, expires), "/api")
+		}
+		later := time.Now().Add(time.Hour)
+		status, _, body := get(link(1, later), 2)
+		if status != 200 || body != "0123456789" {
+			t.Errorf("Expected the recording from any organization, got %d %q", status, body)
+		}
+		if status, _, _ := get(link(1, time.Now().Add(-time.Minute)), 1); status != 403 {
+			t.Errorf("Expected status 403 for an expired link, got %d", status)
+		}
+		if status, _, _ := get(strings.Replace(link(1, later), "/1?", "/3?", 1), 1); status != 403 {
+			t.Errorf("Expected status 403 for another recording, got %d", status)
+		}
+		if status, _, _ := get(link(4, later), 1); status != 404 {
+			t.Errorf("Expected status 404 for a missing file, got %d", status)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for path, want := range map[string]int{
+			"/recordings/1/vod.m3u8": 422,
+			"/recordings/1/vod.m3u8?from=2026-05-01T11:00:00Z&to=2026-05-01T10:00:00Z": 422,
+			"/recordings/1/vod.m3u8?from=2026-05-01T00:00:00Z&to=2026-05-03T00:00:00Z": 422,
+			"/recordings/1/iframes.m3u8" + span + "&speed=3":                           422,
+			"/recordings/1/vod.m3u8?from=2026-05-02T00:00:00Z&to=2026-05-02T01:00:00Z": 404,
+			"/recordings/9/vod.m3u8" + span:                                            404,
+		} {
+			if status, _, _ := get(path, 1); status != want {
+				t.Errorf("%s: expected status %d, got %d", path, want, status)
+			}
+		}
+	})
+
+	t.Run("Other organizations", func(t *testing.T) {
+		for _, path := range []string{"/recordings/1/vod.m3u8" + span, "/recordings/1/segments/1"} {
+			if status, _, _ := get(path, 2); status != 404 {
+				t.Errorf("%s: expected status 404, got %d", path, status)
+			}
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/playertoken"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PlayerToken is an anonymous token for a public player window
+type PlayerToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ExpiresIn int       `json:"expires_in"` // seconds
+}
+
+// IssuePlayerToken - An anonymous token for the stream routes, fetched
+// when the public page loads and again before it expires. A player that
+// sends its current token, or one expired within a day, keeps its viewer
+// ID. The token is also set as a cookie for the stream routes.
+func (h *StreamHandler) IssuePlayerToken(c *fiber.Ctx) error {
+	now := time.Now()
+	id := ""
+	for _, token := range []string{c.Get(playertoken.Header), c.Cookies(playertoken.Cookie)} {
+		previous, expires, err := playertoken.Parse(h.cfg.JWT.Secret, token, now)
+		if err == nil || errors.Is(err, playertoken.ErrExpired) && now.Sub(expires) < playertoken.RefreshWindow {
+			id = previous
+			break
+		}
+	}
+
+	ttl := h.cfg.Stream().PlayerTokenTTL
+	expires := now.Add(ttl).Truncate(time.Second)
+	token, err := playertoken.Issue(h.cfg.JWT.Secret, id, expires)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to issue player token")
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     playertoken.Cookie,
+		Value:    token,
+		Path:     "/api/stream",
+		HTTPOnly: true,
+		Secure:   h.cfg.Server.Env == "production",
+		SameSite: "Lax",
+		MaxAge:   int(ttl.Seconds()),
+	})
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return response.OK(c, PlayerToken{Token: token, ExpiresAt: expires, ExpiresIn: int(ttl.Seconds())})
+}
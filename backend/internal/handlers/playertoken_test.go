@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/playertoken"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIssuePlayerToken(t *testing.T) {
+	cfg := &config.Config{
+		JWT:    config.JWTConfig{Secret: "s3cret"},
+		Go2RTC: config.Go2RTCConfig{PlayerTokenTTL: 15 * time.Minute},
+	}
+	app := fiber.New()
+	app.Post("/stream/token", NewStreamHandler(nil, cfg, nil, nil, context.Background()).IssuePlayerToken)
+
+	issue := func(current string) (PlayerToken, string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/stream/token", nil)
+		if current != "" {
+			req.Header.Set(playertoken.Header, current)
+		}
+		resp, err := app.Test(req)
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("Request failed: %v, %v", resp, err)
+		}
+		var env struct {
+			Data PlayerToken `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return env.Data, resp.Header.Get("Set-Cookie")
+	}
+
+	first, cookie := issue("")
+	id, expires, err := playertoken.Parse("s3cret", first.Token, time.Now())
+	if err != nil || first.ExpiresIn != 900 || !expires.Equal(first.ExpiresAt) {
+		t.Fatalf("Token = %+v, %v", first, err)
+	}
+	if !strings.Contains(cookie, playertoken.Cookie+"="+first.Token) || !strings.Contains(cookie, "path=/api/stream") {
+		t.Errorf("Cookie = %q", cookie)
+	}
+
+	refreshed, _ := issue(first.Token)
+	if again, _, _ := playertoken.Parse("s3cret", refreshed.Token, time.Now()); again != id {
+		t.Errorf("Refreshing changed the viewer ID from %q to %q", id, again)
+	}
+	stale, _ := playertoken.Issue("s3cret", id, time.Now().Add(-2*playertoken.RefreshWindow))
+	fresh, _ := issue(stale)
+	if again, _, _ := playertoken.Parse("s3cret", fresh.Token, time.Now()); again == id {
+		t.Error("A token expired for two days kept its viewer ID")
+	}
+}
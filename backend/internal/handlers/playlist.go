@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PlaylistHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewPlaylistHandler(db *sql.DB, cfg *config.Config) *PlaylistHandler {
+	return &PlaylistHandler{db: db, cfg: cfg}
+}
+
+// PlaylistRequest is the create/update body for a playlist. Cameras are
+// shown in the order of camera_ids.
+type PlaylistRequest struct {
+	Name         string               `json:"name" validate:"required,max=100"`
+	Layout       string               `json:"layout" validate:"oneof=1x1 2x2 3x3 4x4"`
+	DwellSeconds validate.FlexibleInt `json:"dwell_seconds" validate:"min=5,max=3600"`
+	CameraIDs    []int                `json:"camera_ids" validate:"required,max=100"`
+}
+
+// Defaults for playlists that leave out their layout or dwell time
+const (
+	defaultPlaylistLayout = "1x1"
+	defaultDwellSeconds   = 15
+)
+
+const playlistColumns = `
+	SELECT id, name, layout, dwell_seconds, created_at, updated_at
+	FROM playlists`
+
+// GetPlaylists - Playlists of the organization, by name
+func (h *PlaylistHandler) GetPlaylists(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, playlistColumns+`
+		WHERE organization_id = ?
+		ORDER BY name ASC, id ASC
+	`, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch playlists")
+	}
+	defer rows.Close()
+
+	list := []models.Playlist{}
+	for rows.Next() {
+		p, err := scanPlaylist(rows)
+		if err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read playlist", "error", err)
+			continue
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+
+	for n := range list {
+		if list[n].CameraIDs, err = h.cameraIDs(ctx, list[n].ID); err != nil {
+			return serviceError(c, err, "", "Failed to fetch playlists")
+		}
+	}
+
+	return response.OK(c, list)
+}
+
+// GetPlaylist - A playlist with its cameras
+func (h *PlaylistHandler) GetPlaylist(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	p, err := scanPlaylist(h.db.QueryRowContext(ctx, playlistColumns+` WHERE id = ? AND organization_id = ?`, id, tenant.OrgID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch playlist")
+	}
+	if p.CameraIDs, err = h.cameraIDs(ctx, p.ID); err != nil {
+		return serviceError(c, err, "", "Failed to fetch playlist")
+	}
+
+	return response.OK(c, p)
+}
+
+// CreatePlaylist - Create a playlist. The response holds the kiosk token,
+// which is not shown again.
+func (h *PlaylistHandler) CreatePlaylist(c *fiber.Ctx) error {
+	var req PlaylistRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRequest(ctx, c, &req); !ok {
+		return err
+	}
+
+	token, hash, err := newKioskToken()
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create playlist")
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create playlist")
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO playlists (organization_id, name, layout, dwell_seconds, token_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, tenant.OrgID(ctx), req.Name, req.Layout, req.DwellSeconds.Int, hash, now, now).Scan(&id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create playlist")
+	}
+	if err := setPlaylistCameras(ctx, tx, id, req.CameraIDs); err != nil {
+		return serviceError(c, err, "", "Failed to create playlist")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to create playlist")
+	}
+
+	return response.Created(c, "Playlist created successfully", fiber.Map{
+		"id":    id,
+		"token": token,
+	})
+}
+
+// UpdatePlaylist - Replace a playlist's name, layout, dwell time and
+// cameras; its kiosk token stays the same
+func (h *PlaylistHandler) UpdatePlaylist(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+
+	var req PlaylistRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if ok, err := h.checkRequest(ctx, c, &req); !ok {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update playlist")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE playlists SET name = ?, layout = ?, dwell_seconds = ?, updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, req.Name, req.Layout, req.DwellSeconds.Int, time.Now().UTC(), id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to update playlist")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+	if err := setPlaylistCameras(ctx, tx, int64(id), req.CameraIDs); err != nil {
+		return serviceError(c, err, "", "Failed to update playlist")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to update playlist")
+	}
+
+	return response.Message(c, "Playlist updated successfully")
+}
+
+// RotatePlaylistToken - Replace a playlist's kiosk token, signing out the
+// screens that use the old one
+func (h *PlaylistHandler) RotatePlaylistToken(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	token, hash, err := newKioskToken()
+	if err != nil {
+		return serviceError(c, err, "", "Failed to rotate token")
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE playlists SET token_hash = ?, updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, hash, time.Now().UTC(), id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to rotate token")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+
+	return response.OK(c, fiber.Map{"token": token})
+}
+
+// DeletePlaylist - Delete a playlist; screens using its token get a 404
+func (h *PlaylistHandler) DeletePlaylist(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM playlists WHERE id = ? AND organization_id = ?", id, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete playlist")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+
+	return response.Message(c, "Playlist deleted successfully")
+}
+
+// GetKioskPlaylist - The playlist a kiosk token opens, with stream URLs
+// for its enabled cameras. The token stands in for a login.
+func (h *PlaylistHandler) GetKioskPlaylist(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if token == "" {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var id int
+	p := models.KioskPlaylist{Cameras: []models.KioskCamera{}}
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id, name, layout, dwell_seconds FROM playlists WHERE token_hash = ?
+	`, hashKioskToken(token)).Scan(&id, &p.Name, &p.Layout, &p.DwellSeconds)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, 404, "Playlist not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch playlist")
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT c.id, c.name, c.stream_key
+		FROM playlist_cameras pc
+		JOIN cameras c ON c.id = pc.camera_id
+		WHERE pc.playlist_id = ? AND c.enabled = TRUE
+		ORDER BY pc.position ASC
+	`, id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch playlist")
+	}
+	defer rows.Close()
+
+	baseURL := streamBaseURL(c, h.cfg)
+	for rows.Next() {
+		var cam models.KioskCamera
+		if err := rows.Scan(&cam.ID, &cam.Name, &cam.StreamKey); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read playlist camera", "error", err)
+			continue
+		}
+		cam.HLSURL = baseURL + "/api/stream/mse/" + cam.StreamKey
+		cam.WebRTCURL = baseURL + "/api/stream/webrtc/" + cam.StreamKey
+		p.Cameras = append(p.Cameras, cam)
+	}
+
+	c.Set("Cache-Control", "no-store")
+	return response.OK(c, p)
+}
+
+// checkRequest normalises req and rejects cameras outside the
+// organization. When ok is false the response has been written and the
+// handler should return err.
+func (h *PlaylistHandler) checkRequest(ctx context.Context, c *fiber.Ctx, req *PlaylistRequest) (ok bool, err error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Layout == "" {
+		req.Layout = defaultPlaylistLayout
+	}
+	if !req.DwellSeconds.Set {
+		req.DwellSeconds = validate.FlexibleInt{Int: defaultDwellSeconds, Set: true}
+	}
+
+	checked := map[int]bool{}
+	for _, id := range req.CameraIDs {
+		if checked[id] {
+			continue
+		}
+		found, err := cameraExists(ctx, h.db, id)
+		if err != nil {
+			return false, serviceError(c, err, "", "Failed to save playlist")
+		}
+		if !found {
+			return false, invalidFields(c, "", map[string]string{"camera_ids": "Camera not found"})
+		}
+		checked[id] = true
+	}
+	return true, nil
+}
+
+// cameraIDs returns the cameras of playlist id in order
+func (h *PlaylistHandler) cameraIDs(ctx context.Context, id int) ([]int, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT camera_id FROM playlist_cameras WHERE playlist_id = ? ORDER BY position ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var cameraID int
+		if err := rows.Scan(&cameraID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, cameraID)
+	}
+	return ids, rows.Err()
+}
+
+// setPlaylistCameras replaces the cameras of playlist id
+func setPlaylistCameras(ctx context.Context, tx *sql.Tx, id int64, cameraIDs []int) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM playlist_cameras WHERE playlist_id = ?", id); err != nil {
+		return err
+	}
+	for position, cameraID := range cameraIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO playlist_cameras (playlist_id, position, camera_id) VALUES (?, ?, ?)",
+			id, position, cameraID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newKioskToken returns a random kiosk token and the hash that is stored
+// in its place
+func newKioskToken() (token, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashKioskToken(token), nil
+}
+
+func hashKioskToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func scanPlaylist(row interface{ Scan(...any) error }) (models.Playlist, error) {
+	var p models.Playlist
+	err := row.Scan(&p.ID, &p.Name, &p.Layout, &p.DwellSeconds, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPlaylists(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled) VALUES
+			(1, 'Gate', 'rtsp://a', 'gate', TRUE),
+			(2, 'Market', 'rtsp://b', 'market', TRUE),
+			(3, 'Spare', 'rtsp://c', 'spare', FALSE)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (4, 'Elsewhere', 'rtsp://d', 'elsewhere', 2)`,
+	)
+
+	cfg := &config.Config{}
+	cfg.Go2RTC.PublicStreamBaseURL = "https://cctv.example"
+	h := NewPlaylistHandler(db, cfg)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/playlists", h.GetPlaylists)
+	app.Get("/playlists/:id", h.GetPlaylist)
+	app.Post("/playlists", h.CreatePlaylist)
+	app.Put("/playlists/:id", h.UpdatePlaylist)
+	app.Post("/playlists/:id/token", h.RotatePlaylistToken)
+	app.Delete("/playlists/:id", h.DeletePlaylist)
+	app.Get("/kiosk/:token/playlist", h.GetKioskPlaylist)
+
+	do := func(method, path, body string, org int) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	var token string
+
+	t.Run("Create", func(t *testing.T) {
+		status, env := do("POST", "/playlists", `{"name":"Lobby","layout":"2x2","camera_ids":[2,3,1,2]}`, 1)
+		if status != 201 {
+			t.Fatalf("Expected status 201, got %d (%+v)", status, env.Error)
+		}
+		token, _ = env.Data.(map[string]interface{})["token"].(string)
+		if token == "" {
+			t.Fatalf("Expected a token, got %+v", env.Data)
+		}
+
+		var stored string
+		db.QueryRow(`SELECT token_hash FROM playlists WHERE id = 1`).Scan(&stored)
+		if stored == token || stored != hashKioskToken(token) {
+			t.Errorf("Expected only the token's hash to be stored, got %q", stored)
+		}
+
+		_, env = do("GET", "/playlists/1", "", 1)
+		p := env.Data.(map[string]interface{})
+		if p["dwell_seconds"] != float64(15) || len(p["camera_ids"].([]interface{})) != 4 {
+			t.Errorf("Expected the default dwell time and 4 cameras in order, got %+v", p)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`{"name":"Lobby","camera_ids":[4]}`,
+			`{"name":"Lobby","layout":"5x5","camera_ids":[1]}`,
+			`{"name":"Lobby","dwell_seconds":1,"camera_ids":[1]}`,
+			`{"name":"Lobby"}`,
+		} {
+			if status, env := do("POST", "/playlists", body, 1); status != 422 {
+				t.Errorf("Expected status 422 for %s, got %d (%+v)", body, status, env.Error)
+			}
+		}
+	})
+
+	t.Run("Kiosk", func(t *testing.T) {
+		status, env := do("GET", "/kiosk/"+token+"/playlist", "", 0)
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		p := env.Data.(map[string]interface{})
+		cameras := p["cameras"].([]interface{})
+		if p["layout"] != "2x2" || len(cameras) != 3 {
+			t.Fatalf("Expected the 3 enabled entries, got %+v", p)
+		}
+		first := cameras[0].(map[string]interface{})
+		if first["name"] != "Market" || first["hls_url"] != "https://cctv.example/api/stream/mse/market" {
+			t.Errorf("Expected the market camera first with its stream URL, got %+v", first)
+		}
+		if status, _ := do("GET", "/kiosk/wrong/playlist", "", 0); status != 404 {
+			t.Errorf("Expected status 404 for an unknown token, got %d", status)
+		}
+	})
+
+	t.Run("Rotate token", func(t *testing.T) {
+		if status, _ := do("POST", "/playlists/1/token", "", 2); status != 404 {
+			t.Errorf("Expected status 404 from another organization, got %d", status)
+		}
+		_, env := do("POST", "/playlists/1/token", "", 1)
+		rotated := env.Data.(map[string]interface{})["token"].(string)
+		if status, _ := do("GET", "/kiosk/"+token+"/playlist", "", 0); status != 404 {
+			t.Errorf("Expected the old token to stop working, got %d", status)
+		}
+		if status, _ := do("GET", "/kiosk/"+rotated+"/playlist", "", 0); status != 200 {
+			t.Errorf("Expected the new token to work, got %d", status)
+		}
+		token = rotated
+	})
+
+	t.Run("Update and delete", func(t *testing.T) {
+		if status, env := do("PUT", "/playlists/1", `{"name":"Lobby","dwell_seconds":30,"camera_ids":[1]}`, 1); status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+		_, env := do("GET", "/playlists", "", 1)
+		if list := env.Data.([]interface{}); len(list) != 1 || len(list[0].(map[string]interface{})["camera_ids"].([]interface{})) != 1 {
+			t.Errorf("Expected the updated playlist, got %v", list)
+		}
+		_, env = do("GET", "/playlists", "", 2)
+		if list := env.Data.([]interface{}); len(list) != 0 {
+			t.Errorf("Expected no playlists in another organization, got %v", list)
+		}
+
+		if status, _ := do("DELETE", "/playlists/1", "", 1); status != 200 {
+			t.Errorf("Expected status 200, got %d", status)
+		}
+		var cameras int
+		db.QueryRow(`SELECT COUNT(*) FROM playlist_cameras`).Scan(&cameras)
+		if cameras != 0 {
+			t.Errorf("Expected the playlist's cameras to be deleted, got %d", cameras)
+		}
+		if status, _ := do("GET", "/kiosk/"+token+"/playlist", "", 0); status != 404 {
+			t.Errorf("Expected the token to stop working, got %d", status)
+		}
+	})
+}
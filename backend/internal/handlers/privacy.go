@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/privacy"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PrivacyHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewPrivacyHandler(db *sql.DB, cfg *config.Config) *PrivacyHandler {
+	return &PrivacyHandler{db: db, cfg: cfg}
+}
+
+// GetPolicyStatus - What personal data is stored, how much, and how long
+// the retention policy keeps it
+func (h *PrivacyHandler) GetPolicyStatus(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	s, err := privacy.Report(ctx, h.db, privacy.FromConfig(h.cfg), time.Now())
+	if err != nil {
+		return serviceError(c, err, "", "Failed to build privacy report")
+	}
+	return response.OK(c, s)
+}
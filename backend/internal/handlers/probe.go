@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/watchdog"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ProbeHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewProbeHandler(db *sql.DB, cfg *config.Config) *ProbeHandler {
+	return &ProbeHandler{db: db, cfg: cfg}
+}
+
+// CameraProbesRequest replaces a camera's health probes; an empty list
+// goes back to the default TCP connect
+type CameraProbesRequest struct {
+	Probes []watchdog.Probe `json:"probes" validate:"max=5"`
+}
+
+// GetCameraProbes - A camera's health probes and their latest results
+func (h *ProbeHandler) GetCameraProbes(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if found, err := cameraExists(ctx, h.db, id); err != nil {
+		return serviceError(c, err, "", "Failed to fetch health probes")
+	} else if !found {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	probes, err := watchdog.Probes(ctx, h.db, id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch health probes")
+	}
+	return response.OK(c, probes)
+}
+
+// UpdateCameraProbes - Replace a camera's health probes, one per type
+func (h *ProbeHandler) UpdateCameraProbes(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	var req CameraProbesRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	fields := map[string]string{}
+	seen := map[string]bool{}
+	for i, p := range req.Probes {
+		if field, msg := watchdog.Check(p); field != "" {
+			fields[fmt.Sprintf("probes[%d].%s", i, field)] = msg
+		} else if seen[p.Type] {
+			fields[fmt.Sprintf("probes[%d].type", i)] = "is already probed"
+		}
+		seen[p.Type] = true
+	}
+	if len(fields) > 0 {
+		return invalidFields(c, "", fields)
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	if found, err := cameraExists(ctx, h.db, id); err != nil {
+		return serviceError(c, err, "", "Failed to update health probes")
+	} else if !found {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	if err := watchdog.SaveProbes(ctx, h.db, id, req.Probes); err != nil {
+		return serviceError(c, err, "", "Failed to update health probes")
+	}
+	probes, err := watchdog.Probes(ctx, h.db, id)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch health probes")
+	}
+
+	return c.JSON(response.Envelope{
+		Success: true,
+		Message: "Health probes updated",
+		Data:    probes,
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestProbeHandler(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`)
+
+	h := NewProbeHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Get("/cameras/:id/health-probes", h.GetCameraProbes)
+	app.Put("/cameras/:id/health-probes", h.UpdateCameraProbes)
+
+	do := func(method, path, body string) (int, response.Envelope) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env
+	}
+
+	t.Run("No probes by default", func(t *testing.T) {
+		status, env := do("GET", "/cameras/1/health-probes", "")
+		if status != 200 || len(env.Data.([]interface{})) != 0 {
+			t.Errorf("Expected an empty list, got %d %v", status, env.Data)
+		}
+	})
+
+	t.Run("Missing camera", func(t *testing.T) {
+		if status, _ := do("PUT", "/cameras/9/health-probes", `{"probes":[]}`); status != 404 {
+			t.Errorf("Expected status 404, got %d", status)
+		}
+	})
+
+	t.Run("Invalid probes", func(t *testing.T) {
+		status, env := do("PUT", "/cameras/1/health-probes", `{"probes":[{"type":"http"},{"type":"rtsp"},{"type":"rtsp"}]}`)
+		if status != 422 {
+			t.Fatalf("Expected status 422, got %d", status)
+		}
+		if env.Error.Fields["probes[0].target"] == "" || env.Error.Fields["probes[2].type"] == "" {
+			t.Errorf("Expected errors on the HTTP target and the duplicate, got %v", env.Error.Fields)
+		}
+	})
+
+	t.Run("Update and read back", func(t *testing.T) {
+		status, env := do("PUT", "/cameras/1/health-probes",
+			`{"probes":[{"type":"ping","interval_seconds":10},{"type":"http","target":"http://10.0.0.5/snapshot.jpg"}]}`)
+		if status != 200 {
+			t.Fatalf("Expected status 200, got %d (%+v)", status, env.Error)
+		}
+
+		_, env = do("GET", "/cameras/1/health-probes", "")
+		probes := env.Data.([]interface{})
+		if len(probes) != 2 {
+			t.Fatalf("Expected 2 probes, got %v", probes)
+		}
+		first := probes[0].(map[string]interface{})
+		if first["type"] != "ping" || first["interval_seconds"] != float64(10) || first["last_ok"] != nil {
+			t.Errorf("Expected the unchecked ping probe, got %v", first)
+		}
+	})
+}
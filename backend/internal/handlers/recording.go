@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"math"
+	"strconv"
+	"time"
 
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -16,39 +25,306 @@ func NewRecordingHandler(db *sql.DB, cfg *config.Config) *RecordingHandler {
 	return &RecordingHandler{db: db, cfg: cfg}
 }
 
-// GetRecordingsOverview - Get recordings overview for dashboard
+// GetRecordings - Recorded files, newest first, optionally for one
+// camera_id. ?cursor= switches to keyset pagination and ?fields= trims
+// each recording to the listed fields.
+func (h *RecordingHandler) GetRecordings(c *fiber.Ctx) error {
+	where := ""
+	var args []interface{}
+	if raw := c.Query("camera_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return response.Fail(c, 400, "Invalid camera_id")
+		}
+		where = " WHERE camera_id = ?"
+		args = append(args, id)
+	}
+
+	page, err := response.ParseKeyset(c, 50)
+	if err != nil {
+		return response.Fail(c, 400, "Invalid cursor")
+	}
+	fields, err := response.ParseFields(c, models.Recording{})
+	if err != nil {
+		return response.Fail(c, 400, "Invalid fields: "+err.Error())
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	const columns = `
+		SELECT id, camera_id, kind, file_path, file_size, duration, started_at, ended_at, created_at
+		FROM recordings`
+	query, pageArgs := paginate(columns+where+`
+		ORDER BY created_at DESC, id DESC
+	`, append([]interface{}{}, args...), page)
+	if page.Keyset {
+		query, pageArgs = keyset(columns, where, append([]interface{}{}, args...), "id", page)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, pageArgs...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch recordings")
+	}
+	defer rows.Close()
+
+	recordings := []models.Recording{}
+	var ids []int64
+	for rows.Next() {
+		var r models.Recording
+		if err := rows.Scan(&r.ID, &r.CameraID, &r.Kind, &r.FilePath, &r.FileSize, &r.Duration, &r.StartedAt, &r.EndedAt, &r.CreatedAt); err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read recording", "error", err)
+			continue
+		}
+		recordings = append(recordings, r)
+		ids = append(ids, r.ID)
+	}
+
+	if page.Keyset {
+		n, meta := keysetMeta(page, ids)
+		return response.Paginated(c, fields.Select(recordings[:n]), meta)
+	}
+
+	total := countTotal(ctx, h.db, page, len(recordings), "SELECT COUNT(*) FROM recordings"+where, args...)
+
+	return response.Paginated(c, fields.Select(recordings), page.Meta(total))
+}
+
+// Recorder states of a camera in the recordings overview
+const (
+	RecorderRecording = "recording"
+	RecorderStopped   = "stopped"
+	RecorderError     = "error"
+)
+
+// recorderStall is how long a camera with recording enabled may go
+// without new footage before its recorder is reported as failing
+const recorderStall = 10 * time.Minute
+
+// CameraRecordings is a camera's footage in the recordings overview
+type CameraRecordings struct {
+	CameraID         int        `json:"camera_id"`
+	Name             string     `json:"name"`
+	Location         string     `json:"location"`
+	RecordingEnabled bool       `json:"recording_enabled"`
+	RecordingStatus  string     `json:"recording_status"` // recording, stopped or error
+	Error            string     `json:"error,omitempty"`  // why the status is error
+	SegmentCount     int        `json:"segment_count"`
+	TotalSize        int64      `json:"total_size"`
+	OldestSegment    *time.Time `json:"oldest_segment"`
+	NewestSegment    *time.Time `json:"newest_segment"` // end of the newest footage
+	BytesPerDay      int64      `json:"bytes_per_day"`  // written over the last day
+}
+
+// RecordingDisk is the space left for recordings
+type RecordingDisk struct {
+	FreeBytes    *uint64  `json:"free_bytes"`    // null where the platform cannot tell
+	BytesPerDay  int64    `json:"bytes_per_day"` // every camera on the server, as they share the disk
+	HeadroomDays *float64 `json:"headroom_days"` // null when nothing is being written
+}
+
+// RecordingsOverview sums up the recordings of the organization
+type RecordingsOverview struct {
+	TotalRecordings int                `json:"total_recordings"`
+	TotalSize       int64              `json:"total_size"`
+	Cameras         []CameraRecordings `json:"cameras"`
+	Disk            RecordingDisk      `json:"disk"`
+}
+
+// GetRecordingsOverview - Footage of each camera of the organization,
+// whether its recorder is running, and how many days the recordings
+// disk lasts at the current write rate
 func (h *RecordingHandler) GetRecordingsOverview(c *fiber.Ctx) error {
-	// Return empty overview for now
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": map[string]interface{}{
-			"total_recordings": 0,
-			"total_size":       0,
-			"cameras":          []interface{}{},
-		},
-	})
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	now := time.Now().UTC()
+	dayAgo := now.Add(-24 * time.Hour)
+	orgID := tenant.OrgID(ctx)
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT c.id, c.name, COALESCE(c.location, ''), c.enabled, c.recording_enabled,
+		       COALESCE(h.status, ''), COALESCE(h.error_message, ''),
+		       COUNT(r.id), COALESCE(SUM(r.file_size), 0),
+		       COALESCE(SUM(CASE WHEN r.started_at >= ? THEN r.file_size ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN r.id IS NOT NULL AND r.ended_at IS NULL THEN 1 ELSE 0 END), 0)
+		FROM cameras c
+		LEFT JOIN recordings r ON r.camera_id = c.id
+		LEFT JOIN camera_health h ON h.camera_id = c.id
+		WHERE c.organization_id = ?
+		GROUP BY c.id, c.name, c.location, c.enabled, c.recording_enabled, h.status, h.error_message
+		ORDER BY c.name ASC, c.id ASC
+	`, dayAgo, orgID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch recordings overview")
+	}
+	defer rows.Close()
+
+	overview := RecordingsOverview{Cameras: []CameraRecordings{}}
+	open := map[int]bool{}
+	offline := map[int]string{} // health check error by camera
+	for rows.Next() {
+		var cam CameraRecordings
+		var enabled bool
+		var status, message string
+		var openCount int
+		if err := rows.Scan(&cam.CameraID, &cam.Name, &cam.Location, &enabled, &cam.RecordingEnabled,
+			&status, &message, &cam.SegmentCount, &cam.TotalSize, &cam.BytesPerDay, &openCount); err != nil {
+			return serviceError(c, err, "", "Failed to fetch recordings overview")
+		}
+		// A disabled camera has no stream to record
+		cam.RecordingEnabled = cam.RecordingEnabled && enabled
+		open[cam.CameraID] = openCount > 0
+		if status == "offline" {
+			offline[cam.CameraID] = message
+		}
+		overview.TotalRecordings += cam.SegmentCount
+		overview.TotalSize += cam.TotalSize
+		overview.Cameras = append(overview.Cameras, cam)
+	}
+	if err := rows.Err(); err != nil {
+		return serviceError(c, err, "", "Failed to fetch recordings overview")
+	}
+	rows.Close()
+
+	if err := h.footageSpan(ctx, orgID, overview.Cameras); err != nil {
+		return serviceError(c, err, "", "Failed to fetch recordings overview")
+	}
+	for i := range overview.Cameras {
+		cam := &overview.Cameras[i]
+		healthError, down := offline[cam.CameraID]
+		cam.RecordingStatus, cam.Error = recorderState(cam, open[cam.CameraID], down, healthError, now)
+	}
+
+	overview.Disk, err = h.recordingDisk(ctx, now)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch recordings overview")
+	}
+	return response.OK(c, overview)
+}
+
+// footageSpan sets the oldest and newest footage of each camera. The
+// rows are read rather than MIN and MAX taken, which SQLite returns as
+// text.
+func (h *RecordingHandler) footageSpan(ctx context.Context, orgID int, cameras []CameraRecordings) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT r.camera_id, r.started_at, r.ended_at
+		FROM recordings r
+		JOIN cameras c ON c.id = r.camera_id
+		WHERE c.organization_id = ?
+		  AND (r.started_at = (SELECT MIN(started_at) FROM recordings WHERE camera_id = r.camera_id)
+		    OR r.started_at = (SELECT MAX(started_at) FROM recordings WHERE camera_id = r.camera_id))
+	`, orgID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := map[int]*CameraRecordings{}
+	for i := range cameras {
+		byID[cameras[i].CameraID] = &cameras[i]
+	}
+	for rows.Next() {
+		var cameraID int
+		var started time.Time
+		var ended sql.NullTime
+		if err := rows.Scan(&cameraID, &started, &ended); err != nil {
+			return err
+		}
+		cam := byID[cameraID]
+		if cam == nil {
+			continue
+		}
+		if cam.OldestSegment == nil || started.Before(*cam.OldestSegment) {
+			oldest := started
+			cam.OldestSegment = &oldest
+		}
+		newest := started
+		if ended.Valid {
+			newest = ended.Time
+		}
+		if cam.NewestSegment == nil || newest.After(*cam.NewestSegment) {
+			cam.NewestSegment = &newest
+		}
+	}
+	return rows.Err()
+}
+
+// recorderState tells whether the recorder is keeping a camera's
+// footage; open is whether a recording is being written. One with
+// recording enabled is failing when its camera is offline or no footage
+// has been written for a while.
+func recorderState(cam *CameraRecordings, open, offline bool, healthError string, now time.Time) (status, reason string) {
+	switch {
+	case !cam.RecordingEnabled:
+		return RecorderStopped, ""
+	case offline && healthError == "":
+		return RecorderError, "Camera is offline"
+	case offline:
+		return RecorderError, "Camera is offline: " + healthError
+	case open || (cam.NewestSegment != nil && now.Sub(*cam.NewestSegment) < recorderStall):
+		return RecorderRecording, ""
+	case cam.NewestSegment == nil:
+		return RecorderError, "No footage written yet"
+	default:
+		return RecorderError, "No footage written since " + cam.NewestSegment.UTC().Format(time.RFC3339)
+	}
+}
+
+// recordingDisk estimates how long the recordings disk lasts. The write
+// rate is taken over the last day, or over the time since the first
+// recording of that day when that is shorter, so a recorder started an
+// hour ago is not taken to write a day's worth an hour.
+func (h *RecordingHandler) recordingDisk(ctx context.Context, now time.Time) (RecordingDisk, error) {
+	var disk RecordingDisk
+	dayAgo := now.Add(-24 * time.Hour)
+	var written int64
+	if err := h.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(file_size), 0) FROM recordings WHERE started_at >= ?`,
+		dayAgo).Scan(&written); err != nil {
+		return disk, err
+	}
+	var first time.Time
+	err := h.db.QueryRowContext(ctx, `SELECT started_at FROM recordings WHERE started_at >= ? ORDER BY started_at ASC LIMIT 1`,
+		dayAgo).Scan(&first)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return disk, err
+	}
+	if written > 0 {
+		span := now.Sub(first)
+		if span < time.Hour {
+			span = time.Hour
+		}
+		disk.BytesPerDay = int64(float64(written) * float64(24*time.Hour) / float64(span))
+	}
+
+	if free, err := freeBytes(h.cfg.Recording.Path); err == nil {
+		disk.FreeBytes = &free
+		if disk.BytesPerDay > 0 {
+			days := math.Round(float64(free)/float64(disk.BytesPerDay)*10) / 10
+			disk.HeadroomDays = &days
+		}
+	}
+	return disk, nil
 }
 
 // GetRestartLogs - Get recording restart logs
 func (h *RecordingHandler) GetRestartLogs(c *fiber.Ctx) error {
-	// Return empty logs for now
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": map[string]interface{}{
-			"restarts": []interface{}{},
-			"total":    0,
-		},
-	})
+	return emptyRestartLogs(c)
 }
 
 // GetCameraRestartLogs - Get restart logs for specific camera
 func (h *RecordingHandler) GetCameraRestartLogs(c *fiber.Ctx) error {
-	// Return empty logs for now
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": map[string]interface{}{
-			"restarts": []interface{}{},
-			"total":    0,
-		},
-	})
+	return emptyRestartLogs(c)
+}
+
+// emptyRestartLogs answers the restart log endpoints until the recorder
+// keeps a log, in whichever page style the client asked for
+func emptyRestartLogs(c *fiber.Ctx) error {
+	page, err := response.ParseKeyset(c, 50)
+	if err != nil {
+		return response.Fail(c, 400, "Invalid cursor")
+	}
+	if page.Keyset {
+		return response.Paginated(c, []interface{}{}, page.CursorMeta(0))
+	}
+	return response.Paginated(c, []interface{}{}, page.Meta(0))
 }
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRecordingsOverview(t *testing.T) {
+	db := dbtest.Open(t)
+
+	now := time.Now().UTC()
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	for _, seed := range []struct {
+		stmt string
+		args []interface{}
+	}{
+		{otherOrg, nil},
+		{`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, recording_enabled) VALUES
+			(1, 'Gate', 'rtsp://a', 'gate', TRUE),
+			(2, 'Lobby', 'rtsp://b', 'lobby', TRUE),
+			(3, 'Park', 'rtsp://c', 'park', FALSE),
+			(4, 'Yard', 'rtsp://d', 'yard', TRUE)`, nil},
+		{`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, recording_enabled, organization_id) VALUES (5, 'Other', 'rtsp://e', 'other', TRUE, 2)`, nil},
+		{`INSERT INTO camera_health (camera_id, status, error_message) VALUES (4, 'offline', 'connection refused')`, nil},
+		// Gate: an old segment, one from this morning and one being written
+		{`INSERT INTO recordings (camera_id, file_path, file_size, duration, started_at, ended_at) VALUES
+			(1, 'gate-0.ts', 5000, 600, ?, ?),
+			(1, 'gate-1.ts', 3000, 600, ?, ?),
+			(1, 'gate-2.ts', 1000, 0, ?, NULL)`,
+			[]interface{}{ago(72 * time.Hour), ago(72*time.Hour - 10*time.Minute), ago(12 * time.Hour), ago(12*time.Hour - 10*time.Minute), ago(5 * time.Minute)}},
+		// Lobby stopped writing an hour ago
+		{`INSERT INTO recordings (camera_id, file_path, file_size, duration, started_at, ended_at) VALUES (2, 'lobby-0.ts', 2000, 600, ?, ?)`,
+			[]interface{}{ago(70 * time.Minute), ago(60 * time.Minute)}},
+		{`INSERT INTO recordings (camera_id, file_path, file_size, duration, started_at, ended_at) VALUES (5, 'other-0.ts', 7000, 600, ?, ?)`,
+			[]interface{}{ago(2 * time.Hour), ago(110 * time.Minute)}},
+	} {
+		if _, err := db.Exec(seed.stmt, seed.args...); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	h := NewRecordingHandler(db, &config.Config{Recording: config.RecordingConfig{Path: t.TempDir()}})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/recordings/overview", h.GetRecordingsOverview)
+
+	req := httptest.NewRequest("GET", "/recordings/overview", nil)
+	req.Header.Set("X-Org", "1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var body struct {
+		Data RecordingsOverview `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("Expected the overview, got %d %v", resp.StatusCode, err)
+	}
+	o := body.Data
+
+	if o.TotalRecordings != 4 || o.TotalSize != 11000 || len(o.Cameras) != 4 {
+		t.Fatalf("Expected 4 recordings of 11000 bytes over 4 cameras, got %d, %d, %d", o.TotalRecordings, o.TotalSize, len(o.Cameras))
+	}
+	byName := map[string]CameraRecordings{}
+	for _, cam := range o.Cameras {
+		byName[cam.Name] = cam
+	}
+
+	gate := byName["Gate"]
+	if gate.RecordingStatus != RecorderRecording || gate.SegmentCount != 3 || gate.TotalSize != 9000 || gate.BytesPerDay != 4000 {
+		t.Errorf("Expected Gate recording 3 segments, 9000 bytes, 4000 today, got %+v", gate)
+	}
+	if gate.OldestSegment == nil || gate.OldestSegment.Sub(ago(72*time.Hour)).Abs() > time.Second ||
+		gate.NewestSegment == nil || gate.NewestSegment.Sub(ago(5*time.Minute)).Abs() > time.Second {
+		t.Errorf("Expected Gate's footage from 3 days to 5 minutes ago, got %v to %v", gate.OldestSegment, gate.NewestSegment)
+	}
+	if lobby := byName["Lobby"]; lobby.RecordingStatus != RecorderError || lobby.Error == "" {
+		t.Errorf("Expected Lobby's stalled recorder reported, got %+v", lobby)
+	}
+	if park := byName["Park"]; park.RecordingStatus != RecorderStopped || park.OldestSegment != nil {
+		t.Errorf("Expected Park stopped without footage, got %+v", park)
+	}
+	if yard := byName["Yard"]; yard.RecordingStatus != RecorderError || yard.Error != "Camera is offline: connection refused" {
+		t.Errorf("Expected Yard failing while offline, got %+v", yard)
+	}
+
+	// Every camera on the server shares the disk: 13000 bytes since
+	// 12 hours ago is 26000 a day
+	if o.Disk.BytesPerDay < 25900 || o.Disk.BytesPerDay > 26100 {
+		t.Errorf("Expected about 26000 bytes a day, got %d", o.Disk.BytesPerDay)
+	}
+	if o.Disk.FreeBytes != nil && (o.Disk.HeadroomDays == nil || *o.Disk.HeadroomDays <= 0) {
+		t.Errorf("Expected the headroom in days, got %v", o.Disk.HeadroomDays)
+	}
+}
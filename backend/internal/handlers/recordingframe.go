@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/playback"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// frameTimeout bounds one ffmpeg run taking a still from a recording
+const frameTimeout = 15 * time.Second
+
+// maxCachedFrames is how many stills frameCache keeps, about 10 MB of
+// JPEGs
+const maxCachedFrames = 64
+
+// frameCache holds the stills taken last, keyed by recording and offset
+// to the millisecond. They stay in the process rather than the shared
+// cache, which would hold every offset asked for as JSON.
+var frameCache = newFrameLRU(maxCachedFrames)
+
+// frameKey is a recording and an offset into it, in milliseconds
+type frameKey struct {
+	recording int64
+	offset    int64
+}
+
+type cachedFrame struct {
+	key   frameKey
+	frame []byte
+}
+
+// frameLRU is a cache of stills that drops the least recently used once
+// it holds size
+type frameLRU struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front is the most recently used
+	items map[frameKey]*list.Element
+}
+
+func newFrameLRU(size int) *frameLRU {
+	return &frameLRU{size: size, order: list.New(), items: map[frameKey]*list.Element{}}
+}
+
+func (l *frameLRU) get(key frameKey) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(e)
+	return e.Value.(*cachedFrame).frame, true
+}
+
+func (l *frameLRU) add(key frameKey, frame []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		e.Value.(*cachedFrame).frame = frame
+		l.order.MoveToFront(e)
+		return
+	}
+	l.items[key] = l.order.PushFront(&cachedFrame{key: key, frame: frame})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*cachedFrame).key)
+	}
+}
+
+// frameSlots bounds how many ffmpeg processes take stills at once, as
+// each decodes video on the server
+var frameSlots = make(chan struct{}, 2)
+
+// GetRecordingFrame - The frame a camera recorded at ?at= (RFC 3339,
+// fractional seconds allowed), as a JPEG, for incident reports
+func (h *RecordingHandler) GetRecordingFrame(c *fiber.Ctx) error {
+	cameraID, err := strconv.Atoi(c.Params("cameraId"))
+	if err != nil || cameraID <= 0 {
+		return response.Fail(c, fiber.StatusNotFound, "Camera not found")
+	}
+	at, err := time.Parse(time.RFC3339Nano, c.Query("at"))
+	if err != nil {
+		return invalidFields(c, "", map[string]string{"at": "must be an RFC 3339 time"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var exists bool
+	err = h.db.QueryRowContext(ctx, "SELECT TRUE FROM cameras WHERE id = ? AND organization_id = ?",
+		cameraID, tenant.OrgID(ctx)).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, fiber.StatusNotFound, "Camera not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch camera")
+	}
+
+	var id int64
+	var path string
+	var started time.Time
+	err = h.db.QueryRowContext(ctx, `
+		SELECT id, file_path, started_at FROM recordings
+		WHERE camera_id = ? AND started_at <= ? AND (ended_at IS NULL OR ended_at > ?)
+		ORDER BY started_at DESC, id DESC LIMIT 1
+	`, cameraID, at.UTC(), at.UTC()).Scan(&id, &path, &started)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, fiber.StatusNotFound, "No recording at this time")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch recordings")
+	}
+
+	path = h.recordingFile(path)
+	if _, err := os.Stat(path); err != nil {
+		logger.FromContext(ctx).Warn("Recording file missing", "recording_id", id, "error", err)
+		return response.Fail(c, fiber.StatusNotFound, "Recording file not found")
+	}
+
+	// Decoding is not bound by the query timeout, only by its own and
+	// the client staying connected
+	offset := at.Sub(started).Truncate(time.Millisecond)
+	key := frameKey{recording: id, offset: offset.Milliseconds()}
+	frame, ok := frameCache.get(key)
+	if !ok {
+		frame, err = h.extractFrame(c.UserContext(), path, offset)
+		if err == nil {
+			frameCache.add(key, frame)
+		}
+	}
+	if errors.Is(err, playback.ErrNoFrame) {
+		return response.Fail(c, fiber.StatusNotFound, "No frame at this time")
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to take frame from recording", "recording_id", id, "error", err)
+		return response.Fail(c, fiber.StatusInternalServerError, "Failed to take frame from recording")
+	}
+
+	c.Set(fiber.HeaderContentType, "image/jpeg")
+	c.Set("Cache-Control", "private, max-age=86400")
+	return c.Send(frame)
+}
+
+// extractFrame takes the still at offset from the recording at path,
+// waiting for a free slot
+func (h *RecordingHandler) extractFrame(ctx context.Context, path string, offset time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, frameTimeout)
+	defer cancel()
+	select {
+	case frameSlots <- struct{}{}:
+		defer func() { <-frameSlots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return playback.ExtractFrame(ctx, h.cfg.Recording.FFmpegPath, path, offset)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeFFmpeg writes a script standing in for ffmpeg that prints the
+// offset and file it was asked for, or nothing for files named empty,
+// and logs each run to runs
+func fakeFFmpeg(t *testing.T, dir string) (path, runs string) {
+	t.Helper()
+	path = filepath.Join(dir, "ffmpeg")
+	runs = filepath.Join(dir, "runs")
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-ss) offset=$2; shift ;;
+	-i) file=$2; shift ;;
+	esac
+	shift
+done
+echo run >> '` + runs + `'
+case "$file" in
+*empty*) exit 0 ;;
+*broken*) echo "invalid data" >&2; exit 1 ;;
+esac
+printf 'jpeg %s %s' "$offset" "$(basename "$file")"
+`
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write ffmpeg: %v", err)
+	}
+	return path, runs
+}
+
+func TestRecordingFrame(t *testing.T) {
+	db := dbtest.Open(t)
+
+	dir := t.TempDir()
+	for _, name := range []string{"gate-1.ts", "gate-empty.ts", "gate-broken.ts"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("ts"), 0o644); err != nil {
+			t.Fatalf("Failed to write recording: %v", err)
+		}
+	}
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://a', 'gate')`,
+		`INSERT INTO recordings (id, camera_id, file_path, file_size, duration, started_at, ended_at) VALUES
+			(1, 1, 'gate-1.ts', 2, 600, '2026-05-01 10:00:00', '2026-05-01 10:10:00'),
+			(2, 1, 'gate-empty.ts', 2, 600, '2026-05-01 10:10:00', '2026-05-01 10:20:00'),
+			(3, 1, 'gate-broken.ts', 2, 600, '2026-05-01 10:20:00', '2026-05-01 10:30:00'),
+			(4, 1, 'gate-missing.ts', 0, 0, '2026-05-01 10:30:00', NULL)`,
+	)
+
+	ffmpeg, runs := fakeFFmpeg(t, dir)
+	h := NewRecordingHandler(db, &config.Config{Recording: config.RecordingConfig{Path: dir, FFmpegPath: ffmpeg}})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/recordings/:cameraId/frame", h.GetRecordingFrame)
+
+	get := func(path string, org int) (int, string, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	for i := 0; i < 2; i++ {
+		status, contentType, body := get("/recordings/1/frame?at=2026-05-01T10:05:30.250Z", 1)
+		if status != 200 || contentType != "image/jpeg" || body != "jpeg 330.250 gate-1.ts" {
+			t.Errorf("Expected the frame 330.25s into the recording, got %d %s %q", status, contentType, body)
+		}
+	}
+	if got, _ := os.ReadFile(runs); strings.Count(string(got), "run") != 1 {
+		t.Errorf("Expected the frame cached after one run, got %d runs", strings.Count(string(got), "run"))
+	}
+
+	for _, tc := range []struct {
+		path   string
+		org    int
+		status int
+	}{
+		{"/recordings/1/frame?at=yesterday", 1, 422},
+		{"/recordings/1/frame", 1, 422},
+		{"/recordings/1/frame?at=2026-05-01T09:00:00Z", 1, 404},
+		{"/recordings/1/frame?at=2026-05-01T10:15:00Z", 1, 404},
+		{"/recordings/1/frame?at=2026-05-01T10:25:00Z", 1, 500},
+		{"/recordings/1/frame?at=2026-05-01T10:45:00Z", 1, 404},
+		{"/recordings/1/frame?at=2026-05-01T10:05:00Z", 2, 404},
+		{"/recordings/9/frame?at=2026-05-01T10:05:00Z", 1, 404},
+	} {
+		if status, _, body := get(tc.path, tc.org); status != tc.status {
+			t.Errorf("%s (org %d): expected status %d, got %d %s", tc.path, tc.org, tc.status, status, body)
+		}
+	}
+}
+
+func TestFrameLRU(t *testing.T) {
+	l := newFrameLRU(2)
+	l.add(frameKey{1, 10}, []byte("a"))
+	l.add(frameKey{1, 20}, []byte("b"))
+	l.get(frameKey{1, 10})
+	l.add(frameKey{2, 10}, []byte("c"))
+
+	if _, ok := l.get(frameKey{1, 20}); ok {
+		t.Error("Expected the least recently used frame dropped")
+	}
+	for _, key := range []frameKey{{1, 10}, {2, 10}} {
+		if _, ok := l.get(key); !ok {
+			t.Errorf("Expected %+v kept", key)
+		}
+	}
+}
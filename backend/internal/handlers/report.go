@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/reports"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultReportLimit = 30
+	maxReportLimit     = 366
+)
+
+type ReportHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewReportHandler(db *sql.DB, cfg *config.Config) *ReportHandler {
+	return &ReportHandler{db: db, cfg: cfg}
+}
+
+// GetDailyReports - Days with a nightly summary report, newest first;
+// ?limit= (30, at most 366) caps them
+func (h *ReportHandler) GetDailyReports(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultReportLimit)
+	if limit < 1 || limit > maxReportLimit {
+		return invalidFields(c, "", map[string]string{"limit": "must be between 1 and 366"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	list, err := reports.List(ctx, h.db, limit)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch reports")
+	}
+	return response.OK(c, list)
+}
+
+// GetDailyReport - The nightly summary report of :date (YYYY-MM-DD, in
+// REPORT_TIMEZONE), built the night after
+func (h *ReportHandler) GetDailyReport(c *fiber.Ctx) error {
+	date := c.Params("date")
+	if _, err := time.Parse(reports.DateLayout, date); err != nil {
+		return invalidFields(c, "", map[string]string{"date": "must be a date such as 2025-01-14"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	report, err := reports.Get(ctx, h.db, date)
+	if errors.Is(err, reports.ErrNotFound) {
+		return response.Fail(c, fiber.StatusNotFound, "Report not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch report")
+	}
+	return response.OK(c, report)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/reports"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDailyReports(t *testing.T) {
+	db := dbtest.Open(t)
+
+	ctx := context.Background()
+	for _, date := range []string{"2026-03-08", "2026-03-09"} {
+		r, err := reports.Build(ctx, db, date, time.UTC, nil, time.Now())
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		if _, err := reports.Save(ctx, db, r); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	h := NewReportHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Get("/reports/daily", h.GetDailyReports)
+	app.Get("/reports/daily/:date", h.GetDailyReport)
+
+	get := func(path string, data interface{}) int {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		json.NewDecoder(resp.Body).Decode(&struct {
+			Data interface{} `json:"data"`
+		}{data})
+		return resp.StatusCode
+	}
+
+	var list []reports.Summary
+	if status := get("/reports/daily", &list); status != 200 || len(list) != 2 || list[0].Date != "2026-03-09" {
+		t.Errorf("Expected both days, newest first, got %d: %+v", status, list)
+	}
+	var report reports.Report
+	if status := get("/reports/daily/2026-03-08", &report); status != 200 || report.Date != "2026-03-08" || report.Timezone != "UTC" {
+		t.Errorf("Expected the report of 2026-03-08, got %d: %+v", status, report)
+	}
+	if status := get("/reports/daily/2026-03-10", nil); status != 404 {
+		t.Errorf("Expected 404 for a day without a report, got %d", status)
+	}
+	if status := get("/reports/daily/yesterday", nil); status != 422 {
+		t.Errorf("Expected 422 for a malformed date, got %d", status)
+	}
+	if status := get("/reports/daily?limit=0", nil); status != 422 {
+		t.Errorf("Expected 422 for a limit of 0, got %d", status)
+	}
+}
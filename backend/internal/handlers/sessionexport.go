@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// sessionExportHeader names the columns of a viewer session export
+var sessionExportHeader = []string{
+	"id", "camera_id", "camera", "session_id", "ip_address", "user_agent", "referrer_host", "transport",
+	"started_at", "ended_at", "last_seen_at", "duration_seconds", "viewer_id", "transport_switches", "user_id", "username",
+}
+
+// ExportViewerSessions - Viewer sessions of the organization's cameras
+// as CSV, oldest first, with how long each lasted. Filters: from/to on
+// started_at as RFC 3339 times or YYYY-MM-DD dates, camera_id and
+// user_id. Rows are written as they are read, so an export of any size
+// takes no more memory than one row.
+func (h *AdminHandler) ExportViewerSessions(c *fiber.Ctx) error {
+	conds, args, msg := timeRange(c, "s.started_at")
+	if msg != "" {
+		return response.Fail(c, 400, msg)
+	}
+	conds = append(conds, "c.organization_id = ?")
+	args = append(args, tenant.OrgID(c.UserContext()))
+	if raw := c.Query("camera_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return response.Fail(c, 400, "Invalid camera_id")
+		}
+		conds = append(conds, "s.camera_id = ?")
+		args = append(args, id)
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return response.Fail(c, 400, "Invalid user_id")
+		}
+		conds = append(conds, "s.user_id = ?")
+		args = append(args, id)
+	}
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	// The query outlives the handler, and an export takes longer than
+	// DB_QUERY_TIMEOUT_SECONDS; it ends with the response instead
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT s.id, s.camera_id, COALESCE(c.name, ''), s.session_id, COALESCE(s.ip_address, ''), COALESCE(s.user_agent, ''),
+			s.referrer_host, s.transport, s.started_at, s.ended_at, s.last_seen_at, s.viewer_id, s.transport_switches,
+			s.user_id, COALESCE(u.username, '')
+		FROM viewer_sessions s
+		JOIN cameras c ON c.id = s.camera_id
+		LEFT JOIN users u ON u.id = s.user_id`+where+`
+		ORDER BY s.started_at ASC, s.id ASC
+	`, args...)
+	if err != nil {
+		cancel()
+		return serviceError(c, err, "", "Failed to export viewer sessions")
+	}
+
+	log := logger.FromContext(c.UserContext())
+	c.Attachment("viewer-sessions.csv")
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		defer rows.Close()
+
+		out := csv.NewWriter(w)
+		out.Write(sessionExportHeader)
+		n := 0
+		for rows.Next() {
+			var id int64
+			var cameraID int
+			var camera, sessionID, ip, userAgent, referrer, transport, viewerID, username string
+			var switches int
+			var userID sql.NullInt64
+			var started time.Time
+			var ended, lastSeen sql.NullTime
+			if err := rows.Scan(&id, &cameraID, &camera, &sessionID, &ip, &userAgent, &referrer, &transport,
+				&started, &ended, &lastSeen, &viewerID, &switches, &userID, &username); err != nil {
+				log.Error("Failed to read viewer session", "error", err)
+				return
+			}
+
+			// Open sessions last until their latest heartbeat so far
+			duration := ""
+			if end := ended; end.Valid || lastSeen.Valid {
+				if !end.Valid {
+					end = lastSeen
+				}
+				duration = strconv.FormatInt(int64(end.Time.Sub(started).Seconds()), 10)
+			}
+			user := ""
+			if userID.Valid {
+				user = strconv.FormatInt(userID.Int64, 10)
+			}
+			out.Write([]string{
+				strconv.FormatInt(id, 10), strconv.Itoa(cameraID), csvCell(camera), csvCell(sessionID), ip,
+				csvCell(userAgent), csvCell(referrer), transport,
+				started.UTC().Format(time.RFC3339), csvTime(ended), csvTime(lastSeen), duration,
+				csvCell(viewerID), strconv.Itoa(switches), user, csvCell(username),
+			})
+
+			// Flush now and then, so a client that went away ends the query
+			if n++; n%500 == 0 {
+				if out.Flush(); out.Error() != nil {
+					return
+				}
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			log.Error("Failed to export viewer sessions", "error", err)
+		}
+		out.Flush()
+	})
+	return nil
+}
+
+// csvCell keeps a value a viewer controls, such as a user agent, from
+// being read as a formula by spreadsheets
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func csvTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestExportViewerSessions(t *testing.T) {
+	db := dbtest.Open(t)
+	seed := []string{
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate'), (2, 'Yard', 'rtsp://yard', 'yard')`,
+		`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, user_agent, transport, started_at, ended_at)
+			VALUES (1, 'a', '10.0.0.1', '=HYPERLINK("x")', 'hls', '2026-03-10 12:00:00', '2026-03-10 12:05:30')`,
+		`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, transport, started_at, last_seen_at)
+			VALUES (1, 'b', '10.0.0.2', 'mse', '2026-03-10 13:00:00', '2026-03-10 13:01:00')`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (5, 'operator', 'x', 'operator')`,
+		`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, transport, started_at, user_id)
+			VALUES (2, 'c', '10.0.0.3', 'hls', '2026-03-11 09:00:00', 5)`,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (3, 'Dander', 'rtsp://dander', 'dander', 2)`,
+		`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, transport, started_at)
+			VALUES (3, 'd', '10.0.0.4', 'hls', '2026-03-10 12:30:00')`,
+	}
+	for _, stmt := range seed {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	h := NewAdminHandler(db, &config.Config{}, nil)
+	app := fiber.New()
+	app.Get("/sessions/export", h.ExportViewerSessions)
+
+	export := func(query string) (int, [][]string) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/sessions/export"+query, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			return resp.StatusCode, nil
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+			t.Errorf("Expected a CSV content type, got %q", ct)
+		}
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Invalid CSV: %v", err)
+		}
+		return resp.StatusCode, records
+	}
+
+	t.Run("Date range", func(t *testing.T) {
+		_, records := export("?from=2026-03-10&to=2026-03-10")
+		if len(records) != 3 {
+			t.Fatalf("Expected a header and 2 sessions, got %v", records)
+		}
+		first, second := records[1], records[2]
+		if first[2] != "Gate" || first[3] != "a" || first[8] != "2026-03-10T12:00:00Z" || first[11] != "330" {
+			t.Errorf("Expected the first session with its duration, got %v", first)
+		}
+		if first[5] != `'=HYPERLINK("x")` {
+			t.Errorf("Expected the formula escaped, got %q", first[5])
+		}
+		if second[3] != "b" || second[9] != "" || second[11] != "60" {
+			t.Errorf("Expected the open session to last until it was last seen, got %v", second)
+		}
+	})
+
+	t.Run("Camera", func(t *testing.T) {
+		_, records := export("?camera_id=2")
+		if len(records) != 2 || records[1][3] != "c" || records[1][11] != "" {
+			t.Errorf("Expected camera 2's session without a duration, got %v", records)
+		}
+	})
+
+	t.Run("User", func(t *testing.T) {
+		_, records := export("?user_id=5")
+		if len(records) != 2 || records[1][3] != "c" || records[1][14] != "5" || records[1][15] != "operator" {
+			t.Errorf("Expected the operator's session, got %v", records)
+		}
+	})
+
+	t.Run("Other organizations", func(t *testing.T) {
+		_, records := export("")
+		if len(records) != 4 {
+			t.Fatalf("Expected a header and the organization's 3 sessions, got %v", records)
+		}
+		for _, record := range records[1:] {
+			if record[3] == "d" {
+				t.Errorf("Expected no session of another organization, got %v", record)
+			}
+		}
+		if _, records := export("?camera_id=3"); len(records) != 1 {
+			t.Errorf("Expected another organization's camera to export nothing, got %v", records)
+		}
+	})
+
+	t.Run("Invalid range", func(t *testing.T) {
+		if status, _ := export("?from=yesterday"); status != 400 {
+			t.Errorf("Expected status 400, got %d", status)
+		}
+	})
+}
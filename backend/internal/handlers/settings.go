@@ -1,11 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/abcdefak87/cctv/internal/cache"
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -20,16 +29,17 @@ func NewSettingsHandler(db *sql.DB, cfg *config.Config) *SettingsHandler {
 
 // GetSettings - Get all settings
 func (h *SettingsHandler) GetSettings(c *fiber.Ctx) error {
-	rows, err := h.db.Query(`
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, `
 		SELECT key, value, category, description, updated_at
 		FROM settings
+		WHERE organization_id = ?
 		ORDER BY category, key
-	`)
+	`, tenant.OrgID(ctx))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch settings",
-		})
+		return response.Fail(c, 500, "Failed to fetch settings")
 	}
 	defer rows.Close()
 
@@ -68,19 +78,19 @@ func (h *SettingsHandler) GetSettings(c *fiber.Ctx) error {
 
 // GetSettingsByCategory - Get settings by category
 func (h *SettingsHandler) GetSettingsByCategory(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	category := c.Params("category")
 
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(ctx, `
 		SELECT key, value, description, updated_at
 		FROM settings
-		WHERE category = ?
+		WHERE category = ? AND organization_id = ?
 		ORDER BY key
-	`, category)
+	`, category, tenant.OrgID(ctx))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch settings",
-		})
+		return response.Fail(c, 500, "Failed to fetch settings")
 	}
 	defer rows.Close()
 
@@ -115,28 +125,25 @@ func (h *SettingsHandler) GetSettingsByCategory(c *fiber.Ctx) error {
 
 // GetSetting - Get single setting
 func (h *SettingsHandler) GetSetting(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	key := c.Params("key")
 
 	var value, category, description string
 	var updatedAt time.Time
 
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(ctx, `
 		SELECT value, category, description, updated_at
-		FROM settings WHERE key = ?
-	`, key).Scan(&value, &category, &description, &updatedAt)
+		FROM settings WHERE key = ? AND organization_id = ?
+	`, key, tenant.OrgID(ctx)).Scan(&value, &category, &description, &updatedAt)
 
 	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Setting not found",
-		})
+		return response.Fail(c, 404, "Setting not found")
 	}
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch setting",
-		})
+		return response.Fail(c, 500, "Failed to fetch setting")
 	}
 
 	// Try to parse JSON value
@@ -159,6 +166,9 @@ func (h *SettingsHandler) GetSetting(c *fiber.Ctx) error {
 
 // UpdateSetting - Update or create setting
 func (h *SettingsHandler) UpdateSetting(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	key := c.Params("key")
 
 	var req struct {
@@ -168,53 +178,47 @@ func (h *SettingsHandler) UpdateSetting(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
+		return response.Fail(c, 400, "Invalid request body")
 	}
 
 	// Convert value to JSON string
 	valueJSON, err := json.Marshal(req.Value)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid value format",
-		})
+		return response.Fail(c, 400, "Invalid value format")
 	}
 
 	// Check if setting exists
 	var exists int
-	err = h.db.QueryRow("SELECT COUNT(*) FROM settings WHERE key = ?", key).Scan(&exists)
+	err = h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM settings WHERE key = ? AND organization_id = ?",
+		key, tenant.OrgID(ctx)).Scan(&exists)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to check setting",
-		})
+		return response.Fail(c, 500, "Failed to check setting")
 	}
 
 	if exists > 0 {
 		// Update existing
-		_, err = h.db.Exec(`
+		_, err = h.db.ExecContext(ctx, `
 			UPDATE settings 
 			SET value = ?, category = ?, description = ?, updated_at = ?
-			WHERE key = ?
-		`, string(valueJSON), req.Category, req.Description, time.Now(), key)
+			WHERE key = ? AND organization_id = ?
+		`, string(valueJSON), req.Category, req.Description, time.Now(), key, tenant.OrgID(ctx))
 	} else {
 		// Insert new
-		_, err = h.db.Exec(`
-			INSERT INTO settings (key, value, category, description, updated_at)
-			VALUES (?, ?, ?, ?, ?)
-		`, key, string(valueJSON), req.Category, req.Description, time.Now())
+		_, err = h.db.ExecContext(ctx, `
+			INSERT INTO settings (key, value, category, description, organization_id, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, key, string(valueJSON), req.Category, req.Description, tenant.OrgID(ctx), time.Now())
 	}
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to update setting",
-		})
+		return response.Fail(c, 500, "Failed to update setting")
 	}
 
+	forgetBranding(ctx)
+
+	// Only keys are published: values may hold tokens
+	publish(c, events.Event{Type: events.SettingsUpdated, Resource: "settings", Data: map[string]interface{}{"keys": []string{key}}})
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Setting updated successfully",
@@ -223,166 +227,317 @@ func (h *SettingsHandler) UpdateSetting(c *fiber.Ctx) error {
 
 // DeleteSetting - Delete setting
 func (h *SettingsHandler) DeleteSetting(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	key := c.Params("key")
 
-	result, err := h.db.Exec("DELETE FROM settings WHERE key = ?", key)
+	result, err := h.db.ExecContext(ctx, "DELETE FROM settings WHERE key = ? AND organization_id = ?",
+		key, tenant.OrgID(ctx))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to delete setting",
-		})
+		return response.Fail(c, 500, "Failed to delete setting")
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Setting not found",
-		})
+		return response.Fail(c, 404, "Setting not found")
 	}
 
+	forgetBranding(ctx)
+
+	publish(c, events.Event{Type: events.SettingsDeleted, Resource: "settings", Data: map[string]interface{}{"keys": []string{key}}})
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Setting deleted successfully",
 	})
 }
 
-// BulkUpdateSettings - Update multiple settings at once
+// BulkUpdateSettings - Write several settings at once. Every entry is
+// validated against the settings schema before anything is written, and
+// then all are written in one transaction: either every setting is
+// applied or none is. The response reports each setting's outcome.
 func (h *SettingsHandler) BulkUpdateSettings(c *fiber.Ctx) error {
-	var req map[string]interface{}
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
+	entries, err := parseBulkSettings(c.Body())
+	if err != nil {
+		return response.Fail(c, 400, "Invalid request body")
+	}
+	if len(entries) == 0 {
+		return invalidFields(c, "", map[string]string{"settings": "is required"})
+	}
+	if len(entries) > maxBulkSettings {
+		return invalidFields(c, "", map[string]string{"settings": "must have at most " + strconv.Itoa(maxBulkSettings) + " items"})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	results := make([]SettingResult, len(entries))
+	values := make([]string, len(entries))
+	fields := map[string]string{}
+	seen := map[string]bool{}
+	for i, entry := range entries {
+		value, problems := checkSetting(entry)
+		if seen[entry.Key] {
+			problems["key"] = "appears more than once"
+		}
+		seen[entry.Key] = true
+		results[i] = SettingResult{Key: entry.Key, Status: SettingValid, Category: entry.Category}
+		values[i] = value
+		if len(problems) > 0 {
+			results[i].Status, results[i].Errors = SettingInvalid, problems
+			for field, problem := range problems {
+				fields["settings."+entry.Key+"."+field] = problem
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response.Envelope{
+			Success: false,
+			Message: "No settings were saved: " + strconv.Itoa(len(fields)) + " problem(s) found",
+			Data:    results,
+			Error:   &response.Error{Code: response.CodeFor(fiber.StatusUnprocessableEntity), Message: "Validation failed", Fields: fields},
 		})
 	}
 
-	tx, err := h.db.Begin()
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to start transaction",
-		})
+		return serviceError(c, err, "", "Failed to update settings")
 	}
 	defer tx.Rollback()
 
-	for key, value := range req {
-		valueJSON, err := json.Marshal(value)
-		if err != nil {
-			continue
+	orgID := tenant.OrgID(ctx)
+	now := time.Now()
+	var changed []string
+	for i, entry := range entries {
+		var stored, category, description string
+		err := tx.QueryRowContext(ctx, `SELECT value, category, description FROM settings WHERE organization_id = ? AND key = ?`,
+			orgID, entry.Key).Scan(&stored, &category, &description)
+		exists := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			return serviceError(c, err, "", "Failed to update settings")
 		}
+		if !exists {
+			category, description = "general", ""
+			if spec, ok := settingSchema[entry.Key]; ok {
+				category, description = spec.category, spec.description
+			}
+		}
+		if entry.Category != "" {
+			category = entry.Category
+		}
+		if entry.Description != "" {
+			description = entry.Description
+		}
+		results[i].Category = category
 
-		// Upsert
-		_, err = tx.Exec(`
-			INSERT INTO settings (key, value, updated_at)
-			VALUES (?, ?, ?)
-			ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = ?
-		`, key, string(valueJSON), time.Now(), string(valueJSON), time.Now())
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"success": false,
-				"message": "Failed to update settings",
-			})
+		switch {
+		case !exists:
+			results[i].Status = SettingCreated
+		case stored == values[i] && entry.Category == "" && entry.Description == "":
+			results[i].Status = SettingUnchanged
+			continue
+		default:
+			results[i].Status = SettingUpdated
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO settings (key, value, category, description, organization_id, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(organization_id, key) DO UPDATE SET value = excluded.value, category = excluded.category,
+				description = excluded.description, updated_at = excluded.updated_at
+		`, entry.Key, values[i], category, description, orgID, now); err != nil {
+			return serviceError(c, err, "", "Failed to update settings")
 		}
+		changed = append(changed, entry.Key)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to commit transaction",
-		})
+		return serviceError(c, err, "", "Failed to update settings")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Settings updated successfully",
+	if len(changed) > 0 {
+		forgetBranding(ctx)
+		publish(c, events.Event{Type: events.SettingsUpdated, Resource: "settings", Data: map[string]interface{}{"keys": changed}})
+	}
+
+	return c.JSON(response.Envelope{
+		Success: true,
+		Message: "Settings updated successfully",
+		Data:    results,
 	})
 }
 
 // GetMapCenter - Get map default center (public)
 func (h *SettingsHandler) GetMapCenter(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	mapCenter, err := h.mapCenter(ctx)
+	if err != nil {
+		return response.Fail(c, 500, "Failed to parse map center")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    mapCenter,
+	})
+}
+
+// mapCenter returns where the organization's public map opens, or the
+// default when it has not set one
+func (h *SettingsHandler) mapCenter(ctx context.Context) (map[string]interface{}, error) {
 	var value string
-	err := h.db.QueryRow(`SELECT value FROM settings WHERE key = 'map_default_center'`).Scan(&value)
+	err := h.db.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = 'map_default_center' AND organization_id = ?`,
+		tenant.OrgID(ctx)).Scan(&value)
 	
 	if err != nil {
 		// Return default if not found
-		return c.JSON(fiber.Map{
-			"success": true,
-			"data": map[string]interface{}{
-				"latitude":  -7.150370,
-				"longitude": 112.034990,
-				"zoom":      13,
-				"name":      "Bojonegoro",
-			},
-		})
+		return map[string]interface{}{
+			"latitude":  -7.150370,
+			"longitude": 112.034990,
+			"zoom":      13,
+			"name":      "Bojonegoro",
+		}, nil
 	}
 
 	var mapCenter map[string]interface{}
 	if err := json.Unmarshal([]byte(value), &mapCenter); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to parse map center",
-		})
+		return nil, err
 	}
+	return mapCenter, nil
+}
 
+// GetLandingPageSettings - Get landing page settings (public)
+func (h *SettingsHandler) GetLandingPageSettings(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"success": true,
-		"data":    mapCenter,
+		"data":    landingPage(),
 	})
 }
 
-// GetLandingPageSettings - Get landing page settings (public)
-func (h *SettingsHandler) GetLandingPageSettings(c *fiber.Ctx) error {
+// landingPage returns the landing page settings
+func landingPage() map[string]interface{} {
 	// Return default landing page settings
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": map[string]interface{}{
-			"hero_badge":     "LIVE STREAMING 24 JAM",
-			"section_title":  "CCTV Publik",
-			"area_coverage":  "Saat ini area coverage kami baru mencakup <strong>Dander</strong> dan <strong>Tanjungharjo</strong>",
-		},
+	return map[string]interface{}{
+		"hero_badge":     "LIVE STREAMING 24 JAM",
+		"section_title":  "CCTV Publik",
+		"area_coverage":  "Saat ini area coverage kami baru mencakup <strong>Dander</strong> dan <strong>Tanjungharjo</strong>",
+	}
+}
+
+// brandingDefaults are shown for the keys an organization has not set
+var brandingDefaults = []struct {
+	key, value, description string
+}{
+	{"company_name", "RAF NET", "Company name"},
+	{"company_tagline", "CCTV Monitoring System", "Company tagline"},
+	{"primary_color", "#0ea5e9", "Primary color"},
+	{"logo_text", "RN", "Logo text (inisial)"},
+}
+
+// brandingTTL bounds how long a branding change made without
+// invalidating the cache, such as one on another instance without a
+// shared Redis, takes to show
+const brandingTTL = 5 * time.Minute
+
+// brandingCache holds an organization's branding, which the public pages
+// read on every load
+func brandingCache(orgID int) *cache.Group {
+	return cache.NewGroup("branding:"+strconv.Itoa(orgID), brandingTTL)
+}
+
+// forgetBranding drops the cached branding of the organization of ctx
+// after its settings changed
+func forgetBranding(ctx context.Context) {
+	if err := brandingCache(tenant.OrgID(ctx)).Invalidate(ctx); err != nil {
+		logger.FromContext(ctx).Warn("Failed to invalidate cached branding", "error", err)
+	}
+}
+
+// Branding returns the organization's branding settings over the
+// defaults. A failed read falls back to the defaults: the page still
+// renders, just unbranded.
+func (h *SettingsHandler) Branding(c *fiber.Ctx) map[string]interface{} {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	values := map[string]interface{}{}
+	orgID := tenant.OrgID(ctx)
+	brandingCache(orgID).Load(ctx, "values", &values, func() error {
+		return h.loadBranding(ctx, orgID, values)
 	})
+	return values
+}
+
+// loadBranding reads the organization's branding settings into values,
+// which it first fills with the defaults
+func (h *SettingsHandler) loadBranding(ctx context.Context, orgID int, values map[string]interface{}) error {
+	args := []interface{}{orgID}
+	for _, d := range brandingDefaults {
+		values[d.key] = d.value
+		args = append(args, d.key)
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT key, value FROM settings
+		WHERE organization_id = ? AND key IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(brandingDefaults)), ", ")+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		if rows.Scan(&key, &value) != nil {
+			continue
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		values[key] = parsed
+	}
+	return rows.Err()
 }
 
 // GetPublicBranding - Get public branding settings
 func (h *SettingsHandler) GetPublicBranding(c *fiber.Ctx) error {
-	// Return default branding
 	return c.JSON(fiber.Map{
 		"success": true,
-		"data": map[string]interface{}{
-			"company_name":    "RAF NET",
-			"company_tagline": "CCTV Monitoring System",
-			"primary_color":   "#0ea5e9",
-			"logo_text":       "RN",
-		},
+		"data":    h.Branding(c),
 	})
 }
 
 // GetSaweriaConfig - Get Saweria configuration (public)
 func (h *SettingsHandler) GetSaweriaConfig(c *fiber.Ctx) error {
-	// Return empty config for now
 	return c.JSON(fiber.Map{
 		"success": true,
-		"data": map[string]interface{}{
-			"enabled": false,
-			"link":    "",
-		},
+		"data":    saweriaConfig(),
 	})
 }
 
+// saweriaConfig returns the public Saweria donation settings
+func saweriaConfig() map[string]interface{} {
+	// Return empty config for now
+	return map[string]interface{}{
+		"enabled": false,
+		"link":    "",
+	}
+}
+
 // GetAdminBranding - Get admin branding settings
 func (h *SettingsHandler) GetAdminBranding(c *fiber.Ctx) error {
+	values := h.Branding(c)
+
 	// Return settings in array format expected by frontend
+	list := make([]map[string]interface{}, 0, len(brandingDefaults))
+	for _, d := range brandingDefaults {
+		list = append(list, map[string]interface{}{"key": d.key, "value": values[d.key], "description": d.description})
+	}
 	return c.JSON(fiber.Map{
 		"success": true,
-		"data": []map[string]interface{}{
-			{"key": "company_name", "value": "RAF NET", "description": "Company name"},
-			{"key": "company_tagline", "value": "CCTV Monitoring System", "description": "Company tagline"},
-			{"key": "primary_color", "value": "#0ea5e9", "description": "Primary color"},
-			{"key": "logo_text", "value": "RN", "description": "Logo text (inisial)"},
-		},
+		"data":    list,
 	})
 }
 
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abcdefak87/cctv/internal/alerting"
+)
+
+// maxBulkSettings caps the entries of one bulk update
+const maxBulkSettings = 100
+
+// settingSpec describes a setting the server reads itself. Settings
+// outside settingSchema belong to the dashboard and are stored as sent.
+type settingSpec struct {
+	category    string
+	description string
+	check       func(value interface{}) string // what is wrong with value, "" when valid
+	managedBy   string                         // the endpoint that writes it, when not this API
+}
+
+// settingSchema is every setting the server reads, by key
+var settingSchema = map[string]settingSpec{
+	"company_name":        {category: "branding", description: "Company name", check: textSetting(100)},
+	"company_tagline":     {category: "branding", description: "Company tagline", check: textSetting(200)},
+	"primary_color":       {category: "branding", description: "Primary color", check: colorSetting},
+	"logo_text":           {category: "branding", description: "Logo text (inisial)", check: textSetting(10)},
+	"map_default_center":  {category: "map", description: "Where the public map opens", check: mapCenterSetting},
+	alerting.TemplatesKey: {category: "notifications", managedBy: "/api/admin/notification-templates"},
+}
+
+var (
+	settingKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+	colorPattern      = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+)
+
+// SettingEntry is one setting of a bulk update. An empty category or
+// description keeps the stored one, or takes the schema's for a new
+// setting.
+type SettingEntry struct {
+	Key         string          `json:"key"`
+	Value       json.RawMessage `json:"value"`
+	Category    string          `json:"category"`
+	Description string          `json:"description"`
+}
+
+// BulkSettingsRequest lists the settings to write together
+type BulkSettingsRequest struct {
+	Settings []SettingEntry `json:"settings"`
+}
+
+// Outcomes of one setting of a bulk update
+const (
+	SettingCreated   = "created"
+	SettingUpdated   = "updated"
+	SettingUnchanged = "unchanged"
+	SettingValid     = "valid"   // would have been written, had the others been valid
+	SettingInvalid   = "invalid" // see Errors
+)
+
+// SettingResult reports what a bulk update did with one setting
+type SettingResult struct {
+	Key      string            `json:"key"`
+	Status   string            `json:"status"`
+	Category string            `json:"category,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"` // by field: key, value, category or description
+}
+
+// parseBulkSettings reads a bulk update: {"settings": [entries]}, or
+// the older {"key": value, ...} object, whose settings keep their
+// category and description
+func parseBulkSettings(body []byte) ([]SettingEntry, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	if raw, ok := fields["settings"]; ok && len(fields) == 1 && bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		var req BulkSettingsRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return req.Settings, nil
+	}
+
+	entries := make([]SettingEntry, 0, len(fields))
+	for key, value := range fields {
+		entries = append(entries, SettingEntry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+// checkSetting validates entry against the schema. It returns the value
+// as it is stored, compact JSON, and what is wrong by field.
+func checkSetting(entry SettingEntry) (string, map[string]string) {
+	problems := map[string]string{}
+	spec, known := settingSchema[entry.Key]
+
+	switch {
+	case !settingKeyPattern.MatchString(entry.Key):
+		problems["key"] = "must be 1 to 100 letters, digits, '_', '.' or '-'"
+	case spec.managedBy != "":
+		problems["key"] = "is managed through " + spec.managedBy
+	}
+	if entry.Category != "" {
+		if !settingKeyPattern.MatchString(entry.Category) || len(entry.Category) > 50 {
+			problems["category"] = "must be 1 to 50 letters, digits, '_', '.' or '-'"
+		} else if known && entry.Category != spec.category {
+			problems["category"] = "must be " + spec.category
+		}
+	}
+	if utf8.RuneCountInString(entry.Description) > 500 {
+		problems["description"] = "must be at most 500 characters"
+	}
+
+	var value interface{}
+	if len(bytes.TrimSpace(entry.Value)) == 0 || json.Unmarshal(entry.Value, &value) != nil || value == nil {
+		problems["value"] = "is required"
+		return "", problems
+	}
+	if known && spec.check != nil {
+		if problem := spec.check(value); problem != "" {
+			problems["value"] = problem
+		}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		problems["value"] = "is not valid JSON"
+	}
+	return string(encoded), problems
+}
+
+// textSetting accepts a string of at most max characters
+func textSetting(max int) func(interface{}) string {
+	return func(value interface{}) string {
+		s, ok := value.(string)
+		switch {
+		case !ok:
+			return "must be a string"
+		case strings.TrimSpace(s) == "":
+			return "must not be empty"
+		case utf8.RuneCountInString(s) > max:
+			return fmt.Sprintf("must be at most %d characters", max)
+		}
+		return ""
+	}
+}
+
+// colorSetting accepts a CSS hex color such as #0ea5e9
+func colorSetting(value interface{}) string {
+	if s, ok := value.(string); !ok || !colorPattern.MatchString(s) {
+		return "must be a hex color such as #0ea5e9"
+	}
+	return ""
+}
+
+// mapCenterSetting accepts {"latitude", "longitude", "zoom", "name"}, as
+// GET /api/settings/map-center returns it
+func mapCenterSetting(value interface{}) string {
+	center, ok := value.(map[string]interface{})
+	if !ok {
+		return "must be an object with latitude, longitude, zoom and name"
+	}
+	lat, latOK := center["latitude"].(float64)
+	lng, lngOK := center["longitude"].(float64)
+	switch {
+	case !latOK || lat < -90 || lat > 90:
+		return "latitude must be a number between -90 and 90"
+	case !lngOK || lng < -180 || lng > 180:
+		return "longitude must be a number between -180 and 180"
+	}
+	if zoom, ok := center["zoom"]; ok {
+		if z, isNumber := zoom.(float64); !isNumber || z < 1 || z > 22 || z != float64(int(z)) {
+			return "zoom must be a whole number between 1 and 22"
+		}
+	}
+	if name, ok := center["name"]; ok {
+		if _, isString := name.(string); !isString {
+			return "name must be a string"
+		}
+	}
+	return ""
+}
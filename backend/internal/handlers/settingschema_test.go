@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBulkUpdateSettings(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO settings (key, value, category, description, organization_id)
+		VALUES ('company_name', '"Old Name"', 'branding', 'Company name', 1),
+			('footer_note', '"Hi"', 'landing', 'Footer text', 1)`)
+
+	app := fiber.New()
+	app.Post("/settings/bulk", NewSettingsHandler(db, &config.Config{}).BulkUpdateSettings)
+	bulk := func(body string) (int, []SettingResult, map[string]string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/settings/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data  []SettingResult `json:"data"`
+			Error struct {
+				Fields map[string]string `json:"fields"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data, env.Error.Fields
+	}
+	stored := func(key string) (value, category, description string) {
+		t.Helper()
+		db.QueryRow(`SELECT value, category, description FROM settings WHERE key = ?`, key).Scan(&value, &category, &description)
+		return
+	}
+
+	t.Run("Rejected as a whole", func(t *testing.T) {
+		status, results, fields := bulk(`{"settings": [
+			{"key": "company_name", "value": "New Name"},
+			{"key": "primary_color", "value": "blue"},
+			{"key": "map_default_center", "value": {"latitude": 120, "longitude": 106.8}},
+			{"key": "notification_templates", "value": {}}
+		]}`)
+		if status != 422 || len(results) != 4 {
+			t.Fatalf("Expected 422 with 4 results, got %d: %+v", status, results)
+		}
+		if results[0].Key != "company_name" || results[0].Status != SettingValid || results[1].Status != SettingInvalid {
+			t.Errorf("Results = %+v", results)
+		}
+		for _, field := range []string{"settings.primary_color.value", "settings.map_default_center.value", "settings.notification_templates.key"} {
+			if fields[field] == "" {
+				t.Errorf("Expected a problem with %s, got %v", field, fields)
+			}
+		}
+		if value, _, _ := stored("company_name"); value != `"Old Name"` {
+			t.Errorf("company_name = %s, want it untouched", value)
+		}
+	})
+
+	t.Run("Applied with categories", func(t *testing.T) {
+		status, results, _ := bulk(`{"settings": [
+			{"key": "company_name", "value": "New Name"},
+			{"key": "footer_note", "value": "Hi"},
+			{"key": "hero_title", "value": {"text": "Welcome"}, "category": "landing", "description": "Hero heading"},
+			{"key": "primary_color", "value": "#0ea5e9"}
+		]}`)
+		if status != 200 {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+		want := map[string]string{"company_name": SettingUpdated, "footer_note": SettingUnchanged, "hero_title": SettingCreated, "primary_color": SettingCreated}
+		for _, r := range results {
+			if want[r.Key] != r.Status {
+				t.Errorf("%s = %s, want %s", r.Key, r.Status, want[r.Key])
+			}
+		}
+		if value, category, description := stored("hero_title"); value != `{"text":"Welcome"}` || category != "landing" || description != "Hero heading" {
+			t.Errorf("hero_title = %s, %s, %s", value, category, description)
+		}
+		if _, category, description := stored("primary_color"); category != "branding" || description != "Primary color" {
+			t.Errorf("primary_color took %s, %s, want the schema's", category, description)
+		}
+	})
+
+	t.Run("Older object keeps category", func(t *testing.T) {
+		status, _, _ := bulk(`{"footer_note": "Bye", "company_name": "Newer Name"}`)
+		if status != 200 {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+		if value, category, description := stored("footer_note"); value != `"Bye"` || category != "landing" || description != "Footer text" {
+			t.Errorf("footer_note = %s, %s, %s", value, category, description)
+		}
+		if status, _, fields := bulk(`{"primary_color": 42}`); status != 422 || fields["settings.primary_color.value"] == "" {
+			t.Errorf("Expected 422 for a numeric color, got %d: %v", status, fields)
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/abcdefak87/cctv/pkg/validate"
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+type ShareHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewShareHandler(db *sql.DB, cfg *config.Config) *ShareHandler {
+	return &ShareHandler{db: db, cfg: cfg}
+}
+
+// ShareRequest limits a new share link. Both limits are optional.
+type ShareRequest struct {
+	ExpiresInHours validate.FlexibleInt `json:"expires_in_hours" validate:"min=1,max=8760"`
+	MaxViews       validate.FlexibleInt `json:"max_views" validate:"min=1,max=1000000"`
+}
+
+// Share slugs are typed in from signs, so they leave out characters that
+// are easily confused (0/o, 1/l/i)
+const (
+	shareSlugLength   = 8
+	shareSlugAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+)
+
+// QR code sizes in pixels
+const (
+	defaultQRSize = 512
+	minQRSize     = 128
+	maxQRSize     = 1024
+)
+
+const shareColumns = `
+	SELECT slug, camera_id, expires_at, max_views, views, created_by, created_at
+	FROM camera_shares`
+
+// CreateShare - Create a short link to a camera's public player
+func (h *ShareHandler) CreateShare(c *fiber.Ctx) error {
+	cameraID, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	var req ShareRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	found, err := cameraExists(ctx, h.db, cameraID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create share link")
+	}
+	if !found {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	slug, err := newShareSlug()
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create share link")
+	}
+
+	now := time.Now().UTC()
+	share := models.CameraShare{Slug: slug, CameraID: cameraID, MaxViews: req.MaxViews.ID(), CreatedAt: now}
+	if req.ExpiresInHours.Set {
+		expires := now.Add(time.Duration(req.ExpiresInHours.Int) * time.Hour)
+		share.ExpiresAt = &expires
+	}
+	if userID, ok := c.Locals("user_id").(int); ok {
+		share.CreatedBy = &userID
+	}
+
+	_, err = h.db.ExecContext(ctx, `
+		INSERT INTO camera_shares (organization_id, camera_id, slug, expires_at, max_views, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, tenant.OrgID(ctx), cameraID, slug, share.ExpiresAt, share.MaxViews, share.CreatedBy, now)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create share link")
+	}
+
+	h.setURLs(c, &share)
+	return response.Created(c, "Share link created successfully", share)
+}
+
+// GetShares - Share links of a camera, newest first
+func (h *ShareHandler) GetShares(c *fiber.Ctx) error {
+	cameraID, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, shareColumns+`
+		WHERE camera_id = ? AND organization_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, cameraID, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch share links")
+	}
+	defer rows.Close()
+
+	list := []models.CameraShare{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to read share link", "error", err)
+			continue
+		}
+		h.setURLs(c, &share)
+		list = append(list, share)
+	}
+
+	return response.OK(c, list)
+}
+
+// DeleteShare - Revoke a share link
+func (h *ShareHandler) DeleteShare(c *fiber.Ctx) error {
+	cameraID, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Share link not found")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := h.db.ExecContext(ctx, `
+		DELETE FROM camera_shares WHERE slug = ? AND camera_id = ? AND organization_id = ?
+	`, c.Params("slug"), cameraID, tenant.OrgID(ctx))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to delete share link")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 404, "Share link not found")
+	}
+
+	return response.Message(c, "Share link deleted successfully")
+}
+
+// OpenShare - Count a view of a share link and redirect to the camera's
+// public player. Expired and used-up links get a 410.
+func (h *ShareHandler) OpenShare(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	share, status, message := h.lookup(c, c.Params("slug"))
+	if status != 0 {
+		return response.Fail(c, status, message)
+	}
+
+	// The views check is repeated here so concurrent opens cannot go
+	// past max_views
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE camera_shares SET views = views + 1
+		WHERE slug = ? AND (max_views IS NULL OR views < max_views)
+	`, share.Slug)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to open share link")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return response.Fail(c, 410, "Share link has expired")
+	}
+
+	c.Set("Cache-Control", "no-store")
+	return c.Redirect(h.siteURL(c)+"/?camera="+strconv.Itoa(share.CameraID), fiber.StatusFound)
+}
+
+// GetShareQR - A PNG QR code of a share link. ?size= sets its width in
+// pixels, 128 to 1024 (default 512). Showing the code is not a view.
+func (h *ShareHandler) GetShareQR(c *fiber.Ctx) error {
+	size := defaultQRSize
+	if raw := c.Query("size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			return response.Fail(c, 400, "Invalid size, expected 128 to 1024")
+		}
+		size = n
+	}
+
+	share, status, message := h.lookup(c, c.Params("slug"))
+	if status != 0 {
+		return response.Fail(c, status, message)
+	}
+	h.setURLs(c, &share)
+
+	png, err := qrcode.Encode(share.URL, qrcode.Medium, size)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create QR code")
+	}
+
+	c.Set(fiber.HeaderContentType, "image/png")
+	c.Set("Cache-Control", "public, max-age=3600")
+	return c.Send(png)
+}
+
+// lookup returns the share link slug while it can still be opened. It
+// returns a non-zero status when it cannot.
+func (h *ShareHandler) lookup(c *fiber.Ctx, slug string) (models.CameraShare, int, string) {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var share models.CameraShare
+	var enabled bool
+	err := h.db.QueryRowContext(ctx, `
+		SELECT s.slug, s.camera_id, s.expires_at, s.max_views, s.views, c.enabled
+		FROM camera_shares s
+		JOIN cameras c ON c.id = s.camera_id
+		WHERE s.slug = ?
+	`, slug).Scan(&share.Slug, &share.CameraID, &share.ExpiresAt, &share.MaxViews, &share.Views, &enabled)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !enabled) {
+		return share, 404, "Share link not found"
+	}
+	if err != nil {
+		logger.FromContext(c.UserContext()).Error("Failed to fetch share link", "error", err)
+		return share, 500, "Failed to fetch share link"
+	}
+	if shareExpired(share, time.Now()) {
+		return share, 410, "Share link has expired"
+	}
+	return share, 0, ""
+}
+
+// expired reports whether share can no longer be opened at now
+func shareExpired(share models.CameraShare, now time.Time) bool {
+	if share.ExpiresAt != nil && !now.Before(*share.ExpiresAt) {
+		return true
+	}
+	return share.MaxViews != nil && share.Views >= *share.MaxViews
+}
+
+// setURLs fills in the link and QR code URLs of share
+func (h *ShareHandler) setURLs(c *fiber.Ctx, share *models.CameraShare) {
+	share.URL = c.BaseURL() + "/api/s/" + share.Slug
+	share.QRURL = share.URL + "/qr.png"
+}
+
+// siteURL is where the public player is served
+func (h *ShareHandler) siteURL(c *fiber.Ctx) string {
+	if h.cfg.Share.SiteURL != "" {
+		return h.cfg.Share.SiteURL
+	}
+	return c.BaseURL()
+}
+
+// newShareSlug returns a random slug of shareSlugLength characters
+func newShareSlug() (string, error) {
+	b := make([]byte, shareSlugLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for n := range b {
+		b[n] = shareSlugAlphabet[int(b[n])%len(shareSlugAlphabet)]
+	}
+	return string(b), nil
+}
+
+func scanShare(row interface{ Scan(...any) error }) (models.CameraShare, error) {
+	var s models.CameraShare
+	err := row.Scan(&s.Slug, &s.CameraID, &s.ExpiresAt, &s.MaxViews, &s.Views, &s.CreatedBy, &s.CreatedAt)
+	return s, err
+}
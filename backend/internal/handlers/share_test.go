@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestShares(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, enabled) VALUES (1, 'Gate', 'rtsp://a', TRUE), (2, 'Spare', 'rtsp://b', FALSE)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, organization_id) VALUES (3, 'Elsewhere', 'rtsp://c', 2)`,
+	)
+
+	cfg := &config.Config{}
+	cfg.Share.SiteURL = "https://cctv.example"
+	h := NewShareHandler(db, cfg)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/cameras/:id/shares", h.GetShares)
+	app.Post("/cameras/:id/share", h.CreateShare)
+	app.Delete("/cameras/:id/shares/:slug", h.DeleteShare)
+	app.Get("/s/:slug", h.OpenShare)
+	app.Get("/s/:slug/qr.png", h.GetShareQR)
+
+	request := func(method, path, body string, org int) (*http.Response, []byte) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+	create := func(body string) (int, map[string]interface{}) {
+		resp, data := request("POST", "/cameras/1/share", body, 1)
+		var env response.Envelope
+		json.Unmarshal(data, &env)
+		share, _ := env.Data.(map[string]interface{})
+		return resp.StatusCode, share
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		status, share := create(`{"expires_in_hours":24,"max_views":2}`)
+		if status != 201 {
+			t.Fatalf("Expected status 201, got %d", status)
+		}
+		slug := share["slug"].(string)
+		if len(slug) != shareSlugLength || share["url"] != "http://example.com/api/s/"+slug || share["expires_at"] == nil {
+			t.Errorf("Expected a short link that expires, got %+v", share)
+		}
+
+		if resp, _ := request("POST", "/cameras/3/share", `{}`, 1); resp.StatusCode != 404 {
+			t.Errorf("Expected status 404 for another organization's camera, got %d", resp.StatusCode)
+		}
+		if resp, _ := request("POST", "/cameras/1/share", `{"max_views":0}`, 1); resp.StatusCode != 422 {
+			t.Errorf("Expected status 422 for no views, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		_, share := create(`{"max_views":2}`)
+		slug := share["slug"].(string)
+		for n := 0; n < 2; n++ {
+			resp, _ := request("GET", "/s/"+slug, "", 0)
+			if resp.StatusCode != 302 || resp.Header.Get("Location") != "https://cctv.example/?camera=1" {
+				t.Fatalf("Expected a redirect to the player, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+			}
+		}
+		if resp, _ := request("GET", "/s/"+slug, "", 0); resp.StatusCode != 410 {
+			t.Errorf("Expected status 410 once used up, got %d", resp.StatusCode)
+		}
+		if resp, _ := request("GET", "/s/unknown", "", 0); resp.StatusCode != 404 {
+			t.Errorf("Expected status 404 for an unknown link, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		_, share := create(`{}`)
+		slug := share["slug"].(string)
+		db.Exec(`UPDATE camera_shares SET expires_at = ? WHERE slug = ?`, time.Now().Add(-time.Minute), slug)
+		if resp, _ := request("GET", "/s/"+slug, "", 0); resp.StatusCode != 410 {
+			t.Errorf("Expected status 410 after expiry, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("QR code", func(t *testing.T) {
+		_, share := create(`{}`)
+		slug := share["slug"].(string)
+		resp, png := request("GET", "/s/"+slug+"/qr.png?size=256", "", 0)
+		if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "image/png" || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+			t.Fatalf("Expected a PNG, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		if resp, _ := request("GET", "/s/"+slug+"/qr.png?size=5000", "", 0); resp.StatusCode != 400 {
+			t.Errorf("Expected status 400 for an oversized code, got %d", resp.StatusCode)
+		}
+		var views int
+		db.QueryRow(`SELECT views FROM camera_shares WHERE slug = ?`, slug).Scan(&views)
+		if views != 0 {
+			t.Errorf("Expected the QR code not to count as a view, got %d", views)
+		}
+	})
+
+	t.Run("List and delete", func(t *testing.T) {
+		_, data := request("GET", "/cameras/1/shares", "", 1)
+		var env response.Envelope
+		json.Unmarshal(data, &env)
+		list := env.Data.([]interface{})
+		if len(list) != 4 {
+			t.Fatalf("Expected 4 share links, got %d", len(list))
+		}
+		slug := list[0].(map[string]interface{})["slug"].(string)
+
+		if resp, _ := request("DELETE", "/cameras/1/shares/"+slug, "", 2); resp.StatusCode != 404 {
+			t.Errorf("Expected status 404 from another organization, got %d", resp.StatusCode)
+		}
+		if resp, _ := request("DELETE", "/cameras/1/shares/"+slug, "", 1); resp.StatusCode != 200 {
+			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		}
+		if resp, _ := request("GET", "/s/"+slug, "", 0); resp.StatusCode != 404 {
+			t.Errorf("Expected a revoked link to stop working, got %d", resp.StatusCode)
+		}
+	})
+}
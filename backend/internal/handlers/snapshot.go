@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/snapshot"
+	"github.com/abcdefak87/cctv/internal/streamnode"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// snapshotTimeout bounds fetching a frame from go2rtc for a snapshot
+const snapshotTimeout = 5 * time.Second
+
+// GetSnapshot - The current frame of a camera as JPEG. While the health
+// checks report the camera offline, or go2rtc has no frame of it, the
+// camera's offline image is served instead, marked X-Camera-Status:
+// offline.
+func (h *StreamHandler) GetSnapshot(c *fiber.Ctx) error {
+	streamKey := c.Params("streamKey")
+	if status, msg := h.checkStream(c, streamKey); status != 0 {
+		return c.Status(status).SendString(msg)
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+	cam, err := h.streamCamera(ctx, streamKey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to fetch camera")
+	}
+
+	if !h.cameraOffline(ctx, cam.ID) {
+		frameCtx, cancelFrame := context.WithTimeout(c.UserContext(), snapshotTimeout)
+		var frame []byte
+		up, err := streamnode.Lookup(h.cfg.Stream(), cam.StreamNode)
+		if err == nil {
+			frame, err = snapshot.Fetch(frameCtx, up.Client, up.APIURL, streamKey)
+		}
+		cancelFrame()
+		if err == nil {
+			c.Set(fiber.HeaderContentType, "image/jpeg")
+			c.Set("Cache-Control", "no-cache")
+			return c.Send(frame)
+		}
+		logger.FromContext(ctx).Warn("Failed to fetch snapshot", "stream_key", streamKey, "error", err)
+	}
+
+	image, err := loadOfflineImage(ctx, h.db, cam.OrgID, cam.ID)
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to fetch offline image", "camera_id", cam.ID, "error", err)
+	}
+	if image.ContentType == "" {
+		return c.Status(fiber.StatusServiceUnavailable).SendString("Camera is offline")
+	}
+	c.Set("X-Camera-Status", "offline")
+	return sendOfflineImage(c, image)
+}
+
+// cameraOffline reports whether the health checks last found the camera
+// offline; a camera never checked is not
+func (h *StreamHandler) cameraOffline(ctx context.Context, cameraID int) bool {
+	var status string
+	err := h.stmts.QueryRowContext(ctx, "SELECT status FROM camera_health WHERE camera_id = ?", cameraID).Scan(&status)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger.FromContext(ctx).Warn("Failed to fetch camera health", "camera_id", cameraID, "error", err)
+	}
+	return status == "offline"
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/status"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// statusCacheTTL is how long a status report is served before it is
+// built again; the page is public, so this bounds the queries it costs
+const statusCacheTTL = time.Minute
+
+type StatusHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+
+	mu    sync.Mutex
+	cache map[int]cachedStatus // by organization
+}
+
+type cachedStatus struct {
+	title  string
+	report status.Report
+	built  time.Time
+}
+
+func NewStatusHandler(db *sql.DB, cfg *config.Config) *StatusHandler {
+	return &StatusHandler{db: db, cfg: cfg, cache: map[int]cachedStatus{}}
+}
+
+// GetPublicStatus - Cameras online and offline per area, ongoing
+// incidents and uptime over the last 90 days (public)
+func (h *StatusHandler) GetPublicStatus(c *fiber.Ctx) error {
+	s, err := h.status(c)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to build status")
+	}
+	h.setCacheControl(c, s)
+	return response.OK(c, s.report)
+}
+
+// GetStatusPage - The public status as an HTML page
+func (h *StatusHandler) GetStatusPage(c *fiber.Ctx) error {
+	s, err := h.status(c)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to build status")
+	}
+	h.setCacheControl(c, s)
+	c.Type("html")
+	return status.Render(c, s.title, s.report)
+}
+
+// status returns the organization's report, built at most once per
+// statusCacheTTL
+func (h *StatusHandler) status(c *fiber.Ctx) (cachedStatus, error) {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+	orgID := tenant.OrgID(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if s, ok := h.cache[orgID]; ok && now.Sub(s.built) < statusCacheTTL {
+		return s, nil
+	}
+
+	report, err := status.Build(ctx, h.db, now)
+	if err != nil {
+		return cachedStatus{}, err
+	}
+	s := cachedStatus{title: h.title(c), report: report, built: now}
+	h.cache[orgID] = s
+	return s, nil
+}
+
+// title is the organization's company name, as on its branding
+func (h *StatusHandler) title(c *fiber.Ctx) string {
+	branding := NewSettingsHandler(h.db, h.cfg).Branding(c)
+	return fmt.Sprint(branding["company_name"])
+}
+
+// setCacheControl lets browsers and proxies keep the response until the
+// cached report expires
+func (h *StatusHandler) setCacheControl(c *fiber.Ctx, s cachedStatus) {
+	left := statusCacheTTL - time.Since(s.built)
+	if left < 0 {
+		left = 0
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(int(left.Seconds())))
+}
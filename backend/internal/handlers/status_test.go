@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/status"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPublicStatus(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (name, private_rtsp_url, enabled) VALUES ('Gate', 'rtsp://a', TRUE)`)
+
+	h := NewStatusHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Get("/status/public", h.GetPublicStatus)
+	app.Get("/status/page", h.GetStatusPage)
+
+	t.Run("JSON", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/status/public", nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var body struct {
+			Data status.Report `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != 200 || body.Data.Status != status.Operational || body.Data.Cameras.Online != 1 {
+			t.Errorf("Expected 1 camera online, got %d %+v", resp.StatusCode, body.Data)
+		}
+		if cc := resp.Header.Get("Cache-Control"); !strings.HasPrefix(cc, "public, max-age=") {
+			t.Errorf("Expected a public Cache-Control, got %q", cc)
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		db.Exec(`INSERT INTO camera_health (camera_id, status) VALUES (1, 'offline')`)
+		resp, _ := app.Test(httptest.NewRequest("GET", "/status/public", nil))
+		var body struct {
+			Data status.Report `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if body.Data.Cameras.Online != 1 {
+			t.Errorf("Expected the cached report, got %+v", body.Data.Cameras)
+		}
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/status/page", nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		page, _ := io.ReadAll(resp.Body)
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !strings.Contains(string(page), "RAF NET") {
+			t.Errorf("Expected an HTML page with the company name, got %q: %s", resp.Header.Get("Content-Type"), page)
+		}
+	})
+}
@@ -1,113 +1,256 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/abcdefak87/cctv/internal/apikeys"
+	"github.com/abcdefak87/cctv/internal/cluster"
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database"
+	"github.com/abcdefak87/cctv/internal/edge"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/internal/startlatency"
+	"github.com/abcdefak87/cctv/internal/traffic"
+	"github.com/abcdefak87/cctv/internal/privacy"
+	"github.com/abcdefak87/cctv/internal/viewers"
+	"github.com/abcdefak87/cctv/internal/watermark"
+	"github.com/abcdefak87/cctv/pkg/breaker"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
 type StreamHandler struct {
 	db  *sql.DB
 	cfg *config.Config
+
+	// stmts holds the per-request lookups, which run on every HLS
+	// segment and viewer heartbeat
+	stmts *database.StmtCache
+
+	// stopping is cancelled when the server shuts down, ending open
+	// stream proxies so connections can drain
+	stopping context.Context
+
+	// hls and mse fail requests fast while go2rtc is unreachable instead
+	// of each one waiting out the dial timeout
+	hls *breaker.Breaker
+	mse *breaker.Breaker
+
+	// sessions caps the streams one client IP or API key has open at once
+	sessions streamLimiter
+
+	// copies registers the watermarked and audio-only copies of streams
+	// with go2rtc
+	copies *watermark.Registrar
+
+	// edges reaches the cameras of edge nodes; nil serves only local ones
+	edges *edge.Hub
+
+	// viewers batches the viewer session writes
+	viewers *viewers.Recorder
+
+	// keys counts the streams refused to API keys
+	keys *apikeys.Store
+
+	// starts times how long go2rtc takes to start each stream
+	starts *startlatency.Tracker
+
+	// traffic counts what the streams of each camera serve
+	traffic *traffic.Meter
+}
+
+func NewStreamHandler(db *sql.DB, cfg *config.Config, edges *edge.Hub, recorder *viewers.Recorder, stopping context.Context) *StreamHandler {
+	opts := breaker.Options{
+		Failures:      cfg.Go2RTC.BreakerFailures,
+		Cooldown:      cfg.Go2RTC.BreakerCooldown,
+		OnStateChange: upstreamStateChanged,
+	}
+	h := &StreamHandler{
+		db:       db,
+		cfg:      cfg,
+		stmts:    database.NewStmtCache(db),
+		stopping: stopping,
+		hls:      breaker.New("hls", opts),
+		mse:      breaker.New("mse", opts),
+		sessions: newStreamSessions(),
+
+		copies:  watermark.NewRegistrar(),
+		edges:   edges,
+		viewers: recorder,
+		keys:    apikeys.New(db),
+		starts:  startlatency.Shared(),
+		traffic: traffic.Shared(),
+	}
+	// Behind a load balancer a client's streams land on several
+	// instances, so they are counted in the database
+	if cfg.Cluster.Enabled {
+		h.sessions = sharedSessions{cluster.NewSessions(stopping, db, cfg.Cluster.InstanceID, streamIdle)}
+	}
+	return h
+}
+
+// upstreamStateChanged records go2rtc outages and recoveries as events
+func upstreamStateChanged(route string, from, to breaker.State) {
+	data := map[string]interface{}{"route": route}
+	switch to {
+	case breaker.Open:
+		if from == breaker.Closed {
+			logger.Warn("Stream server unreachable, failing requests fast", "route", route)
+			events.Publish(events.Event{Type: events.StreamUpstreamDown, Resource: "go2rtc", Data: data})
+		}
+	case breaker.Closed:
+		logger.Info("Stream server recovered", "route", route)
+		events.Publish(events.Event{Type: events.StreamUpstreamUp, Resource: "go2rtc", Data: data})
+	}
 }
 
-func NewStreamHandler(db *sql.DB, cfg *config.Config) *StreamHandler {
-	return &StreamHandler{db: db, cfg: cfg}
+// upstreamOK reports whether a go2rtc call counts as a success for the
+// breaker. A request cancelled by the viewer leaving or by shutdown says
+// nothing about go2rtc; error statuses come from a server that is up.
+func upstreamOK(err error) bool {
+	return err == nil || errors.Is(err, context.Canceled)
+}
+
+// upstreamUnavailable answers while a breaker is open
+func upstreamUnavailable(c *fiber.Ctx, b *breaker.Breaker) error {
+	if wait := b.RetryAfter(); wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	return response.Fail(c, 503, "Stream server unavailable")
+}
+
+// streamBaseURL is where players reach the stream proxy: the configured
+// public stream URL, or this server
+func streamBaseURL(c *fiber.Ctx, cfg *config.Config) string {
+	if baseURL := cfg.Stream().PublicStreamBaseURL; baseURL != "" {
+		return baseURL
+	}
+	return c.BaseURL()
 }
 
 // GetStreamURL - Get stream URL for a camera
 func (h *StreamHandler) GetStreamURL(c *fiber.Ctx) error {
-	streamKey := c.Params("streamKey")
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	var cameraID int
-	var name string
-	var enabled bool
+	streamKey := c.Params("streamKey")
 
-	err := h.db.QueryRow(`
-		SELECT id, name, enabled
-		FROM cameras
-		WHERE stream_key = ?
-	`, streamKey).Scan(&cameraID, &name, &enabled)
+	cam, err := h.streamCamera(ctx, streamKey)
 
 	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera not found",
-		})
+		return response.Fail(c, 404, "Camera not found")
 	}
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch camera",
-		})
+		return response.Fail(c, 500, "Failed to fetch camera")
 	}
 
-	if !enabled {
-		return c.Status(403).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera is disabled",
-		})
+	if !cam.Enabled {
+		return response.Fail(c, 403, "Camera is disabled")
 	}
 
 	// Build stream URLs - prioritize MSE (works without HLS module)
-	baseURL := h.cfg.Go2RTC.PublicStreamBaseURL
-	if baseURL == "" {
-		baseURL = c.BaseURL()
-	}
+	baseURL := streamBaseURL(c, h.cfg)
 	
 	// Use MSE as HLS URL (frontend expects hls_url field)
 	// MSE works with native HTML5 video, no HLS.js needed
 	hlsURL := fmt.Sprintf("%s/api/stream/mse/%s", baseURL, streamKey)
 	webrtcURL := fmt.Sprintf("%s/api/stream/webrtc/%s", baseURL, streamKey)
+	audioURL := fmt.Sprintf("%s/api/stream/audio/%s", baseURL, streamKey)
+	snapshotURL := fmt.Sprintf("%s/api/stream/%s/snapshot", baseURL, streamKey)
+	var expiresAt *time.Time
+	if stream := h.cfg.Stream(); stream.SignedURLsRequired {
+		expires := time.Now().Add(stream.SignedURLTTL).Truncate(time.Second)
+		query := "?" + signStream(h.cfg.JWT.Secret, streamKey, expires)
+		hlsURL, audioURL, snapshotURL = hlsURL+query, audioURL+query, snapshotURL+query
+		expiresAt = &expires
+	}
+
+	// Players show the snapshot, the camera's offline image, right away
+	// instead of waiting for a stream that will not start
+	status := "online"
+	if h.cameraOffline(ctx, cam.ID) {
+		status = "offline"
+	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data": map[string]interface{}{
-			"camera_id":  cameraID,
-			"name":       name,
+			"camera_id":  cam.ID,
+			"name":       cam.Name,
 			"stream_key": streamKey,
 			"hls_url":    hlsURL,  // Actually MSE, but frontend expects this field
 			"webrtc_url": webrtcURL,
+			"audio_url":  audioURL, // Sound alone, for slow connections
+			"snapshot_url": snapshotURL,
+			"status":     status,
+			"expires_at": expiresAt, // When the signed URLs stop working; null when unsigned
 		},
 	})
 }
 
 // ProxyHLS - Proxy HLS stream from go2rtc
 func (h *StreamHandler) ProxyHLS(c *fiber.Ctx) error {
+	began := time.Now()
 	streamKey := c.Params("streamKey")
 	file := c.Params("*")
 
 	// Verify camera exists and is enabled
-	var enabled bool
-	err := h.db.QueryRow(`
-		SELECT enabled FROM cameras WHERE stream_key = ?
-	`, streamKey).Scan(&enabled)
-
-	if err == sql.ErrNoRows {
-		return c.Status(404).SendString("Camera not found")
-	}
-
-	if !enabled {
-		return c.Status(403).SendString("Camera is disabled")
+	if status, msg := h.checkStream(c, streamKey); status != 0 {
+		return c.Status(status).SendString(msg)
 	}
 
 	// Proxy request to go2rtc API
+	stream := h.cfg.Stream()
+	if ok, err := h.apiKeyHLS(c, streamKey); !ok {
+		return err
+	}
+	if !h.sessions.watchHLS(c.IP(), streamKey, stream.MaxSessionsPerIP) {
+		return tooManyStreams(c, stream.MaxSessionsPerIP)
+	}
+	// Master playlist; sub-playlists and segments follow from it
+	up, status, msg := h.upstream(c, streamKey, file == "index.m3u8")
+	if status != 0 {
+		return c.Status(status).SendString(msg)
+	}
 	var go2rtcURL string
 	if file == "index.m3u8" {
-		// Master playlist
-		go2rtcURL = fmt.Sprintf("http://localhost:1984/api/stream.m3u8?src=%s", streamKey)
+		go2rtcURL = fmt.Sprintf("%s/api/stream.m3u8?src=%s", up.apiURL, up.src)
 	} else {
 		// Sub-playlists and segments - go2rtc uses /api/hls/... format
-		go2rtcURL = fmt.Sprintf("http://localhost:1984/api/%s", file)
+		go2rtcURL = fmt.Sprintf("%s/api/%s", up.apiURL, file)
+	}
+
+	// Playlists and segments are small, so the whole fetch is bounded
+	ctx, cancel := context.WithCancel(c.UserContext())
+	if stream.ProxyTimeout > 0 {
+		ctx, cancel = context.WithTimeout(c.UserContext(), stream.ProxyTimeout)
 	}
+	defer cancel()
 
-	resp, err := http.Get(go2rtcURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, go2rtcURL, nil)
+	if err != nil {
+		return c.Status(502).SendString("Failed to connect to stream server")
+	}
+
+	sent := time.Now()
+	resp, err := up.do(req, h.hls)
+	if errors.Is(err, breaker.ErrOpen) {
+		return upstreamUnavailable(c, h.hls)
+	}
 	if err != nil {
 		return c.Status(502).SendString("Failed to connect to stream server")
 	}
@@ -118,12 +261,16 @@ func (h *StreamHandler) ProxyHLS(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(502).SendString("Failed to read stream")
 	}
+	// go2rtc answers the master playlist once the camera is streaming
+	if file == "index.m3u8" && resp.StatusCode == http.StatusOK {
+		h.starts.Record(up.cameraID, time.Since(sent))
+	}
 
 	// For master playlist, rewrite relative URLs to absolute
 	if file == "index.m3u8" {
 		content := string(body)
 		// Replace relative path with absolute URL
-		baseURL := h.cfg.Go2RTC.PublicStreamBaseURL
+		baseURL := stream.PublicStreamBaseURL
 		if baseURL == "" {
 			baseURL = c.BaseURL()
 		}
@@ -137,6 +284,7 @@ func (h *StreamHandler) ProxyHLS(c *fiber.Ctx) error {
 	c.Set("Cache-Control", "no-cache")
 	c.Status(resp.StatusCode)
 
+	h.traffic.Record(up.cameraID, traffic.HLS, int64(len(body)), time.Since(began))
 	return c.Send(body)
 }
 
@@ -145,67 +293,191 @@ func (h *StreamHandler) ProxyMSE(c *fiber.Ctx) error {
 	streamKey := c.Params("streamKey")
 
 	// Verify camera exists and is enabled
-	var enabled bool
-	err := h.db.QueryRow(`
-		SELECT enabled FROM cameras WHERE stream_key = ?
-	`, streamKey).Scan(&enabled)
+	if status, msg := h.checkStream(c, streamKey); status != 0 {
+		return c.Status(status).SendString(msg)
+	}
 
-	if err == sql.ErrNoRows {
-		return c.Status(404).SendString("Camera not found")
+	// Proxy to go2rtc MSE endpoint
+	up, status, msg := h.upstream(c, streamKey, true)
+	if status != 0 {
+		return c.Status(status).SendString(msg)
 	}
+	return h.proxyLive(c, up, "/api/stream.mp4", "video/mp4", traffic.MSE, true)
+}
 
-	if !enabled {
-		return c.Status(403).SendString("Camera is disabled")
+// proxyLive streams path of go2rtc (stream.mp4, stream.aac) for the
+// stream of up to the client, as one of its open sessions, counted as
+// traffic of kind. With record set, the first bytes record how long the
+// stream took to start.
+//
+// A live stream cannot be seeked: go2rtc ignores Range and answers 200
+// with the stream from now, which tells a client that asked for a range
+// (some smart TVs do) that it gets the whole body, and Accept-Ranges:
+// none says so up front. Range is still passed on, and a 206 or 416
+// answered by an upstream that serves ranges is passed back with its
+// Content-Range. A HEAD request gets the headers without opening the
+// stream.
+func (h *StreamHandler) proxyLive(c *fiber.Ctx, up streamUpstream, path, contentType, kind string, record bool) error {
+	stream := h.cfg.Stream()
+	go2rtcURL := fmt.Sprintf("%s%s?src=%s", up.apiURL, path, up.src)
+
+	if c.Method() == fiber.MethodHead {
+		c.Set("Content-Type", contentType)
+		c.Set("Cache-Control", "no-cache")
+		c.Set(fiber.HeaderAcceptRanges, "none")
+		// The length of a live stream is not known
+		c.Context().Response.Header.SetContentLength(-1)
+		return nil
 	}
 
-	// Proxy to go2rtc MSE endpoint
-	go2rtcURL := fmt.Sprintf("http://localhost:1984/api/stream.mp4?src=%s", streamKey)
+	// The session lasts as long as the connection
+	release, ok := h.sessions.openMSE(c.IP(), stream.MaxSessionsPerIP)
+	if !ok {
+		return tooManyStreams(c, stream.MaxSessionsPerIP)
+	}
+	release, ok, err := h.apiKeyMSE(c, release)
+	if !ok {
+		return err
+	}
+
+	// The stream runs until the viewer leaves, so there is no deadline;
+	// the upstream request is cancelled once the client stops reading
+	// or the server starts shutting down.
+	ctx, cancel := context.WithCancel(c.UserContext())
+	stopOnShutdown := context.AfterFunc(h.stopping, cancel)
 
-	resp, err := http.Get(go2rtcURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, go2rtcURL, nil)
 	if err != nil {
+		stopOnShutdown()
+		cancel()
+		release()
 		return c.Status(502).SendString("Failed to connect to stream server")
 	}
-	defer resp.Body.Close()
+	for _, header := range []string{fiber.HeaderRange, fiber.HeaderIfRange} {
+		if value := c.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
 
-	// Set headers for MSE streaming
-	c.Set("Content-Type", "video/mp4")
+	sent := time.Now()
+	resp, err := up.do(req, h.mse)
+	if errors.Is(err, breaker.ErrOpen) {
+		stopOnShutdown()
+		cancel()
+		release()
+		return upstreamUnavailable(c, h.mse)
+	}
+	if err != nil {
+		stopOnShutdown()
+		cancel()
+		release()
+		return c.Status(502).SendString("Failed to connect to stream server")
+	}
+
+	c.Set("Content-Type", contentType)
 	c.Set("Cache-Control", "no-cache")
+	ranges := resp.Header.Get(fiber.HeaderAcceptRanges)
+	if contentRange := resp.Header.Get(fiber.HeaderContentRange); contentRange != "" {
+		c.Set(fiber.HeaderContentRange, contentRange)
+		if ranges == "" {
+			ranges = "bytes"
+		}
+	}
+	if ranges == "" {
+		ranges = "none"
+	}
+	c.Set(fiber.HeaderAcceptRanges, ranges)
 	c.Status(resp.StatusCode)
 
-	// Stream the response
-	_, err = io.Copy(c.Response().BodyWriter(), resp.Body)
+	// Stream the response, flushing each chunk so a write error (client
+	// gone) stops the copy and closes the go2rtc connection
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		defer stopOnShutdown()
+		defer release()
+		defer resp.Body.Close()
+		defer func() { h.traffic.Record(up.cameraID, kind, 0, time.Since(sent)) }()
+
+		buf := make([]byte, 32*1024)
+		// The first bytes of a stream time how long it took to start
+		timed := !record || resp.StatusCode != http.StatusOK
+		for {
+			n, err := resp.Body.Read(buf)
+			if n > 0 {
+				if !timed {
+					timed = true
+					h.starts.Record(up.cameraID, time.Since(sent))
+				}
+				if _, werr := w.Write(buf[:n]); werr != nil {
+					return
+				}
+				if werr := w.Flush(); werr != nil {
+					return
+				}
+				h.traffic.Sent(up.cameraID, kind, int64(n))
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// checkStream verifies the stream key belongs to an enabled camera and,
+// for a signed URL, that the signature holds. It returns a zero status
+// when the stream may be served.
+func (h *StreamHandler) checkStream(c *fiber.Ctx, streamKey string) (int, string) {
+	// HLS sub-playlists and segments follow from a signed master
+	// playlist, so they carry no signature of their own
+	file := c.Params("*")
+	required := h.cfg.Stream().SignedURLsRequired && (file == "" || file == "index.m3u8")
+	if status, msg := checkStreamSignature(c, h.cfg.JWT.Secret, streamKey, required); status != 0 {
+		return status, msg
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cam, err := h.streamCamera(ctx, streamKey)
+
+	if err == sql.ErrNoRows {
+		return 404, "Camera not found"
+	}
+
 	if err != nil {
-		return err
+		return 500, "Failed to fetch camera"
 	}
 
-	return nil
+	if !cam.Enabled {
+		return 403, "Camera is disabled"
+	}
+
+	return 0, ""
 }
 
 // GetStreamStats - Get stream statistics
 func (h *StreamHandler) GetStreamStats(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	streamKey := c.Params("streamKey")
 
 	// Verify camera exists
-	var cameraID int
-	var name string
-	err := h.db.QueryRow(`
-		SELECT id, name FROM cameras WHERE stream_key = ?
-	`, streamKey).Scan(&cameraID, &name)
+	cam, err := h.streamCamera(ctx, streamKey)
 
 	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera not found",
-		})
+		return response.Fail(c, 404, "Camera not found")
 	}
 
 	// Get viewer count from database (if tracked)
 	var viewerCount int
-	err = h.db.QueryRow(`
-		SELECT COUNT(DISTINCT session_id) 
-		FROM viewer_sessions 
+	err = h.stmts.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT `+viewerKey("")+`)
+		FROM viewer_sessions
 		WHERE camera_id = ? AND ended_at IS NULL
-	`, cameraID).Scan(&viewerCount)
+	`, cam.ID).Scan(&viewerCount)
 
 	if err != nil {
 		viewerCount = 0
@@ -214,8 +486,8 @@ func (h *StreamHandler) GetStreamStats(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data": map[string]interface{}{
-			"camera_id":    cameraID,
-			"name":         name,
+			"camera_id":    cam.ID,
+			"name":         cam.Name,
 			"stream_key":   streamKey,
 			"viewer_count": viewerCount,
 			"status":       "online",
@@ -223,42 +495,61 @@ func (h *StreamHandler) GetStreamStats(c *fiber.Ctx) error {
 	})
 }
 
-// StartViewing - Track viewer session start
+// StartViewing - Track viewer session start, with the page the player
+// is on and its transport when the body says
 func (h *StreamHandler) StartViewing(c *fiber.Ctx) error {
+	// Older players send no body
+	var req ViewingRequest
+	if len(c.Body()) > 0 {
+		if ok, err := bind(c, &req); !ok {
+			return err
+		}
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	streamKey := c.Params("streamKey")
 
-	var cameraID int
-	err := h.db.QueryRow(`
-		SELECT id FROM cameras WHERE stream_key = ?
-	`, streamKey).Scan(&cameraID)
+	cam, err := h.streamCamera(ctx, streamKey)
 
 	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera not found",
-		})
+		return response.Fail(c, 404, "Camera not found")
 	}
 
-	// Get or create session ID
-	sessionID := c.Get("X-Session-ID")
-	if sessionID == "" {
-		sessionID = c.IP() + "-" + c.Get("User-Agent")
+	if err != nil {
+		return response.Fail(c, 500, "Failed to track viewing session")
 	}
 
-	// Insert or update viewer session
-	_, err = h.db.Exec(`
-		INSERT INTO viewer_sessions (camera_id, session_id, ip_address, user_agent, started_at)
-		VALUES (?, ?, ?, ?, datetime('now'))
-		ON CONFLICT(camera_id, session_id) DO UPDATE SET started_at = datetime('now'), ended_at = NULL
-	`, cameraID, sessionID, c.IP(), c.Get("User-Agent"))
+	// A viewer keeps its token across cameras and visits
+	sessionID := viewerToken(c, h.cfg.JWT.Secret)
+	if sessionID == "" {
+		if sessionID, err = newViewerToken(h.cfg.JWT.Secret); err != nil {
+			return response.Fail(c, 500, "Failed to track viewing session")
+		}
+	}
+	setViewerCookie(c, sessionID, h.cfg.Server.Env == "production")
 
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to track viewing session",
-		})
+	// A player without an ID of its own is known by its player token
+	if req.ViewerID == "" {
+		req.ViewerID, _ = c.Locals("player_token").(string)
 	}
 
+	// Staff watching while logged in are told apart from the public
+	userID := middleware.OptionalUserID(c, h.cfg.JWT.Secret)
+
+	// Written with the next batch; see internal/viewers. The privacy
+	// mode may keep only a hash of the address, or nothing.
+	ip, agent := privacy.FromConfig(h.cfg).ViewerClient(c.IP(), utils.CopyString(c.Get(fiber.HeaderUserAgent)))
+	h.viewers.Start(cam.ID, sessionID, viewers.Viewer{
+		IP:        ip,
+		Agent:     agent,
+		Referrer:  referrerHost(req.Referrer, c.Get(fiber.HeaderReferer)),
+		Transport: req.Transport,
+		ID:        req.ViewerID,
+		UserID:    userID,
+	})
+
 	return c.JSON(fiber.Map{
 		"success":    true,
 		"session_id": sessionID,
@@ -267,64 +558,78 @@ func (h *StreamHandler) StartViewing(c *fiber.Ctx) error {
 
 // StopViewing - Track viewer session end
 func (h *StreamHandler) StopViewing(c *fiber.Ctx) error {
-	streamKey := c.Params("streamKey")
-	sessionID := c.Get("X-Session-ID")
-
+	sessionID := viewerToken(c, h.cfg.JWT.Secret)
 	if sessionID == "" {
-		sessionID = c.IP() + "-" + c.Get("User-Agent")
+		return response.Fail(c, 400, "Missing viewer session")
 	}
 
-	var cameraID int
-	err := h.db.QueryRow(`
-		SELECT id FROM cameras WHERE stream_key = ?
-	`, streamKey).Scan(&cameraID)
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	streamKey := c.Params("streamKey")
+
+	cam, err := h.streamCamera(ctx, streamKey)
 
 	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "Camera not found",
-		})
+		return response.Fail(c, 404, "Camera not found")
 	}
 
-	// Update viewer session end time
-	_, err = h.db.Exec(`
-		UPDATE viewer_sessions 
-		SET ended_at = datetime('now')
-		WHERE camera_id = ? AND session_id = ? AND ended_at IS NULL
-	`, cameraID, sessionID)
-
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to update viewing session",
-		})
+		return response.Fail(c, 500, "Failed to update viewing session")
 	}
 
+	h.viewers.Stop(cam.ID, sessionID)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Viewing session ended",
 	})
 }
 
+// ViewingHeartbeat - Track that a viewer session is still watching
+func (h *StreamHandler) ViewingHeartbeat(c *fiber.Ctx) error {
+	sessionID := viewerToken(c, h.cfg.JWT.Secret)
+	if sessionID == "" {
+		return response.Fail(c, 400, "Missing viewer session")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cam, err := h.streamCamera(ctx, c.Params("streamKey"))
+
+	if err == sql.ErrNoRows {
+		return response.Fail(c, 404, "Camera not found")
+	}
+
+	if err != nil {
+		return response.Fail(c, 500, "Failed to update viewing session")
+	}
+
+	h.viewers.Heartbeat(cam.ID, sessionID)
+
+	return response.Message(c, "Viewing session updated")
+}
+
 // GetAllStreams - Get all active streams
 func (h *StreamHandler) GetAllStreams(c *fiber.Ctx) error {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
 	// Get all enabled cameras
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(ctx, `
 		SELECT id, name, stream_key, enabled
 		FROM cameras
-		WHERE enabled = 1
+		WHERE enabled = TRUE
 		ORDER BY id ASC
 	`)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch streams",
-		})
+		return response.Fail(c, 500, "Failed to fetch streams")
 	}
 	defer rows.Close()
 
 	streams := []map[string]interface{}{}
-	baseURL := h.cfg.Go2RTC.PublicStreamBaseURL
+	baseURL := h.cfg.Stream().PublicStreamBaseURL
 	if baseURL == "" {
 		baseURL = c.BaseURL()
 	}
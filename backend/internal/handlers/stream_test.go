@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/startlatency"
+	"github.com/abcdefak87/cctv/internal/traffic"
+	"github.com/abcdefak87/cctv/internal/viewers"
+	"github.com/gofiber/fiber/v2"
+)
+
+// useMemoryCache gives the test a cache of its own, so it does not see
+// the cameras other tests' databases cached under the same stream keys
+func useMemoryCache(t *testing.T) {
+	prev := cache.Shared()
+	cache.SetShared(cache.NewMemory())
+	t.Cleanup(func() { cache.SetShared(prev) })
+}
+
+func TestStreamHandler_Breaker(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (name, private_rtsp_url, stream_key) VALUES ('Gate', 'rtsp://gate', 'gate')`)
+
+	// A closed server refuses connections, like go2rtc when it is down
+	upstream := httptest.NewServer(nil)
+	upstream.Close()
+
+	cfg := &config.Config{Go2RTC: config.Go2RTCConfig{
+		APIURL:          upstream.URL,
+		BreakerFailures: 2,
+		BreakerCooldown: time.Minute,
+	}}
+	app := fiber.New()
+	app.Get("/hls/:streamKey/*", NewStreamHandler(db, cfg, nil, nil, context.Background()).ProxyHLS)
+
+	get := func() (int, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/hls/gate/index.m3u8", nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp.StatusCode, resp.Header.Get("Retry-After")
+	}
+
+	t.Run("Failures reach go2rtc", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if status, _ := get(); status != 502 {
+				t.Errorf("Expected status 502, got %d", status)
+			}
+		}
+	})
+
+	t.Run("Open breaker fails fast", func(t *testing.T) {
+		status, retryAfter := get()
+		if status != 503 {
+			t.Errorf("Expected status 503, got %d", status)
+		}
+		if retryAfter != "60" {
+			t.Errorf("Expected Retry-After 60, got %q", retryAfter)
+		}
+	})
+}
+
+func TestStreamHandler_StartLatency(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (3, 'Gate', 'rtsp://gate', 'gate')`)
+
+	// go2rtc holds the master playlist until the camera streams
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/stream.m3u8" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Write([]byte("#EXTM3U\n"))
+	}))
+	defer upstream.Close()
+
+	h := NewStreamHandler(db, &config.Config{Go2RTC: config.Go2RTCConfig{APIURL: upstream.URL}}, nil, nil, context.Background())
+	h.starts = startlatency.New()
+	h.traffic = traffic.New()
+	app := fiber.New()
+	app.Get("/hls/:streamKey/*", h.ProxyHLS)
+
+	for _, path := range []string{"/hls/gate/index.m3u8", "/hls/gate/hls/playlist.m3u8"} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("%s: request failed: %v", path, err)
+		}
+	}
+
+	s, ok := h.starts.Stats(3)
+	if !ok || s.Samples != 1 || s.LastMs < 50 {
+		t.Errorf("Expected the master playlist timed as one start, got %+v", s)
+	}
+
+	// Both requests count as stream traffic
+	if err := h.traffic.Flush(context.Background(), db); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	now := time.Now()
+	hours, err := traffic.Hours(context.Background(), db, traffic.Filter{From: now.Add(-time.Hour), To: now.Add(time.Hour), Limit: 10})
+	if err != nil || len(hours) != 1 || hours[0].Kind != traffic.HLS || hours[0].Requests != 2 || hours[0].Bytes == 0 {
+		t.Errorf("Expected the playlists counted, got %+v (%v)", hours, err)
+	}
+}
+
+func TestStreamHandler_ViewerSessions(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES
+		(1, 'Gate', 'rtsp://gate', 'gate'), (2, 'Market', 'rtsp://market', 'market')`)
+
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "secret"}}
+	recorder := viewers.New(db, config.ViewersConfig{FlushInterval: time.Hour})
+	h := NewStreamHandler(db, cfg, nil, recorder, context.Background())
+	app := fiber.New()
+	app.Post("/stream/:streamKey/start", h.StartViewing)
+	app.Post("/stream/:streamKey/heartbeat", h.ViewingHeartbeat)
+	app.Post("/stream/:streamKey/stop", h.StopViewing)
+
+	// post returns the status, the session ID in the response and the
+	// cookie set
+	post := func(path, header, cookie string) (int, string, string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, nil)
+		if header != "" {
+			req.Header.Set("X-Session-ID", header)
+		}
+		if cookie != "" {
+			req.Header.Set("Cookie", viewerCookie+"="+cookie)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var body struct {
+			SessionID string `json:"session_id"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		for _, c := range resp.Cookies() {
+			if c.Name == viewerCookie {
+				cookie = c.Value
+			}
+		}
+		return resp.StatusCode, body.SessionID, cookie
+	}
+
+	status, alice, cookie := post("/stream/gate/start", "", "")
+	if status != 200 || alice == "" || cookie != alice {
+		t.Fatalf("Expected a token issued in the response and a cookie, got %d %q %q", status, alice, cookie)
+	}
+	if _, id, _ := post("/stream/market/start", alice, ""); id != alice {
+		t.Errorf("Expected the viewer's token kept for another camera, got %q", id)
+	}
+	if _, id, _ := post("/stream/gate/start", "", alice); id != alice {
+		t.Errorf("Expected the token read from the cookie, got %q", id)
+	}
+
+	// A neighbour behind the same address, and one making up an ID
+	_, bob, _ := post("/stream/gate/start", "", "")
+	_, made, _ := post("/stream/gate/start", "192.0.2.1-Firefox", "")
+	if bob == alice || made == "192.0.2.1-Firefox" || made == bob {
+		t.Errorf("Expected new tokens for other viewers, got %q and %q", bob, made)
+	}
+
+	if status, _, _ := post("/stream/gate/heartbeat", "", ""); status != 400 {
+		t.Errorf("Expected status 400 for a heartbeat without a token, got %d", status)
+	}
+	if status, _, _ := post("/stream/gate/heartbeat", "", alice); status != 200 {
+		t.Errorf("Expected status 200 for a heartbeat with the cookie, got %d", status)
+	}
+	if status, _, _ := post("/stream/market/stop", alice, ""); status != 200 {
+		t.Errorf("Expected status 200 for a stop, got %d", status)
+	}
+	recorder.Flush(context.Background())
+
+	var gate, market int
+	db.QueryRow(`SELECT COUNT(DISTINCT session_id) FROM viewer_sessions WHERE camera_id = 1 AND ended_at IS NULL`).Scan(&gate)
+	db.QueryRow(`SELECT COUNT(*) FROM viewer_sessions WHERE camera_id = 2 AND ended_at IS NULL`).Scan(&market)
+	if gate != 3 || market != 0 {
+		t.Errorf("Expected 3 viewers of the gate and none of the market, got %d and %d", gate, market)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"github.com/abcdefak87/cctv/internal/traffic"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// audioSuffix names the audio-only copy of a stream in go2rtc
+const audioSuffix = "_audio"
+
+// audioSource is the go2rtc source that transcodes the sound of
+// streamKey to AAC and drops the picture
+func audioSource(streamKey string) string {
+	return "ffmpeg:" + streamKey + "#audio=aac"
+}
+
+// ProxyAudio - Proxy the sound of a stream alone, as AAC (ADTS), for
+// listeners on slow connections, such as to the speakers of a mosque.
+// The checks and session limits are those of the MSE stream.
+func (h *StreamHandler) ProxyAudio(c *fiber.Ctx) error {
+	streamKey := c.Params("streamKey")
+
+	if status, msg := h.checkStream(c, streamKey); status != 0 {
+		return c.Status(status).SendString(msg)
+	}
+
+	// The watermark is drawn on the picture, so the clean feed is used
+	up, status, msg := h.upstream(c, streamKey, false)
+	if status != 0 {
+		return c.Status(status).SendString(msg)
+	}
+	src, err := h.copies.Register(c.UserContext(), up.client, up.apiURL, streamKey+audioSuffix, audioSource(streamKey))
+	if err != nil {
+		logger.FromContext(c.UserContext()).Error("Failed to set up audio stream", "stream_key", streamKey, "error", err)
+		return c.Status(502).SendString("Failed to connect to stream server")
+	}
+	up.src = src
+
+	return h.proxyLive(c, up, "/api/stream.aac", "audio/aac", traffic.Audio, false)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStreamHandler_Audio(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (name, private_rtsp_url, stream_key, watermark, enabled) VALUES
+		('Mosque', 'rtsp://a', 'mosque', TRUE, TRUE), ('Market', 'rtsp://b', 'market', FALSE, FALSE)`)
+
+	var mu sync.Mutex
+	var registered, played []string
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/streams":
+			registered = append(registered, r.URL.Query().Get("name")+" "+r.URL.Query().Get("src"))
+		case "/api/stream.aac":
+			played = append(played, r.URL.Query().Get("src"))
+			w.Write([]byte("\xff\xf1adts"))
+		}
+	}))
+	defer go2rtc.Close()
+
+	cfg := &config.Config{Go2RTC: config.Go2RTCConfig{APIURL: go2rtc.URL, BreakerFailures: 100}}
+	app := fiber.New()
+	app.Get("/audio/:streamKey", NewStreamHandler(db, cfg, nil, nil, context.Background()).ProxyAudio)
+
+	get := func(key string) (int, string, string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/audio/"+key, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	for i := 0; i < 2; i++ {
+		if status, contentType, body := get("mosque"); status != 200 || contentType != "audio/aac" || body != "\xff\xf1adts" {
+			t.Errorf("Expected the AAC stream, got %d %s %q", status, contentType, body)
+		}
+	}
+	if status, _, _ := get("market"); status != 403 {
+		t.Errorf("Expected status 403 for a disabled camera, got %d", status)
+	}
+	if status, _, _ := get("nowhere"); status != 404 {
+		t.Errorf("Expected status 404 for an unknown camera, got %d", status)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(registered) != 1 || registered[0] != "mosque_audio ffmpeg:mosque#audio=aac" {
+		t.Errorf("Expected the audio copy registered once, got %q", registered)
+	}
+	if len(played) != 2 || played[0] != "mosque_audio" {
+		t.Errorf("Expected the audio copy played, without the watermark, got %q", played)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// streamCameraTTL bounds how long a camera change made without
+// invalidating the cache, such as one on another instance without a
+// shared Redis, takes to reach the stream routes
+const streamCameraTTL = 30 * time.Second
+
+// streamCameras caches the camera behind each stream key: players look
+// it up for every playlist and segment they fetch
+var streamCameras = cache.NewGroup("stream-cameras", streamCameraTTL)
+
+// streamCamera is what the stream routes need to know of a camera
+type streamCamera struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+	Watermark  bool   `json:"watermark"`
+	OrgID      int    `json:"org_id"`
+	EdgeNodeID *int   `json:"edge_node_id,omitempty"`
+	StreamNode string `json:"stream_node,omitempty"` // "" is the local go2rtc
+}
+
+// streamCamera looks up the camera with streamKey, across
+// organizations; sql.ErrNoRows when there is none
+func (h *StreamHandler) streamCamera(ctx context.Context, streamKey string) (streamCamera, error) {
+	var cam streamCamera
+	err := streamCameras.Load(ctx, streamKey, &cam, func() error {
+		var edgeNodeID sql.NullInt64
+		var streamNode sql.NullString
+		err := h.stmts.QueryRowContext(ctx, `
+			SELECT id, name, enabled, watermark, organization_id, edge_node_id, stream_node FROM cameras WHERE stream_key = ?
+		`, streamKey).Scan(&cam.ID, &cam.Name, &cam.Enabled, &cam.Watermark, &cam.OrgID, &edgeNodeID, &streamNode)
+		cam.StreamNode = streamNode.String
+		if edgeNodeID.Valid {
+			id := int(edgeNodeID.Int64)
+			cam.EdgeNodeID = &id
+		}
+		return err
+	})
+	return cam, err
+}
+
+// forgetStreamCameras drops the cached stream key lookups after cameras
+// changed
+func forgetStreamCameras(ctx context.Context) {
+	if err := streamCameras.Invalidate(ctx); err != nil {
+		logger.FromContext(ctx).Warn("Failed to invalidate cached cameras", "error", err)
+	}
+}
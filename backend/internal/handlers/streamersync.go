@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/streamnode"
+	"github.com/abcdefak87/cctv/internal/streamsync"
+	"github.com/abcdefak87/cctv/internal/watchdog"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// streamerFetchTimeout bounds reading the streams of a streamer's API
+	streamerFetchTimeout = 15 * time.Second
+
+	// importProbeTimeout bounds the probe of each imported RTSP URL, and
+	// importProbeWorkers is how many run at once
+	importProbeTimeout = 5 * time.Second
+	importProbeWorkers = 16
+)
+
+type StreamerSyncHandler struct {
+	db     *sql.DB
+	cfg    *config.Config
+	client *http.Client
+}
+
+func NewStreamerSyncHandler(db *sql.DB, cfg *config.Config) *StreamerSyncHandler {
+	return &StreamerSyncHandler{db: db, cfg: cfg, client: httpclient.Shared()}
+}
+
+// StreamerSyncRequest names the streamer to read cameras from: the
+// contents of its config file, or the URL of its API. With neither, the
+// streams of the local go2rtc are read.
+type StreamerSyncRequest struct {
+	Kind   string `json:"kind" validate:"oneof=go2rtc mediamtx"` // go2rtc when empty
+	URL    string `json:"url" validate:"max=2048"`
+	Config string `json:"config" validate:"max=1048576"` // go2rtc.yaml or mediamtx.yml
+}
+
+// SyncFromStreamer - Create a camera for each stream of a go2rtc or
+// MediaMTX setup that is not one yet, keeping the stream name as the
+// stream key. Streams that clash with existing cameras are listed as
+// conflicts. ?dry_run=true only reports.
+func (h *StreamerSyncHandler) SyncFromStreamer(c *fiber.Ctx) error {
+	var req StreamerSyncRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	if req.Kind == "" {
+		req.Kind = streamsync.KindGo2RTC
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	switch {
+	case req.URL != "" && req.Config != "":
+		return invalidFields(c, "", map[string]string{"config": "cannot be combined with url"})
+	case req.URL != "" && !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://"):
+		return invalidFields(c, "", map[string]string{"url": "must be an http or https URL"})
+	case req.URL == "" && req.Config == "" && req.Kind != streamsync.KindGo2RTC:
+		return invalidFields(c, "", map[string]string{"url": "url or config is required for mediamtx"})
+	}
+
+	var streams []streamsync.Stream
+	var err error
+	if req.Config != "" {
+		if streams, err = streamsync.ParseConfig(req.Kind, strings.NewReader(req.Config)); err != nil {
+			return invalidFields(c, "", map[string]string{"config": err.Error()})
+		}
+	} else {
+		apiURL := req.URL
+		if apiURL == "" {
+			apiURL = h.cfg.Go2RTC.APIURL
+		}
+		fetchCtx, cancel := context.WithTimeout(c.UserContext(), streamerFetchTimeout)
+		streams, err = streamsync.Fetch(fetchCtx, h.client, req.Kind, apiURL)
+		cancel()
+		if err != nil {
+			return response.Fail(c, fiber.StatusBadGateway, "Failed to read streams: "+err.Error())
+		}
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := streamsync.Sync(ctx, h.db, streams, c.QueryBool("dry_run"))
+	if err != nil {
+		return serviceError(c, err, "", "Failed to create cameras")
+	}
+	if !result.DryRun && len(result.Created) > 0 {
+		forgetStreamCameras(ctx)
+	}
+	return response.OK(c, result)
+}
+
+// URLImportResult is what ImportURLs did with each line of the list
+type URLImportResult struct {
+	Created     int                  `json:"created"`
+	Provisioned int                  `json:"provisioned"`
+	Skipped     int                  `json:"skipped"` // existing cameras and repeated lines
+	Failed      int                  `json:"failed"`  // invalid or unreachable URLs
+	Cameras     []*streamsync.Import `json:"cameras"`
+}
+
+// ImportURLs - Create a camera for each RTSP URL of a plain text body,
+// one per line. Each URL no camera pulls yet is probed with an RTSP
+// DESCRIBE first; those that answer become enabled cameras named after
+// their address, all created together or none at all, and
+// their streams are added to go2rtc (or to the ?stream_node= given).
+// The response lists what became of every line.
+func (h *StreamerSyncHandler) ImportURLs(c *fiber.Ctx) error {
+	list := streamsync.ParseURLs(string(c.Body()))
+	switch {
+	case len(list) == 0:
+		return invalidFields(c, "", map[string]string{"body": "must list RTSP URLs, one per line"})
+	case len(list) > streamsync.MaxURLs:
+		return invalidFields(c, "", map[string]string{"body": "must list at most " + strconv.Itoa(streamsync.MaxURLs) + " URLs"})
+	}
+	name := c.Query("stream_node")
+	up, err := streamnode.Lookup(h.cfg.Stream(), name)
+	if err != nil {
+		return invalidFields(c, "", map[string]string{"stream_node": "is not in STREAM_NODES"})
+	}
+	var node *string
+	if name != "" {
+		node = &name
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	err = streamsync.MarkExisting(ctx, h.db, list)
+	cancel()
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch cameras")
+	}
+
+	probeImports(c.UserContext(), list)
+
+	ctx, cancel = dbContext(c, h.cfg)
+	defer cancel()
+	if err := streamsync.ImportURLs(ctx, h.db, list, node); err != nil {
+		return serviceError(c, err, "", "Failed to create cameras")
+	}
+
+	result := URLImportResult{Cameras: list}
+	for _, imp := range list {
+		switch imp.Status {
+		case streamsync.StatusCreated:
+			result.Created++
+		case streamsync.StatusExists, streamsync.StatusDuplicate:
+			result.Skipped++
+		default:
+			result.Failed++
+		}
+	}
+	if result.Created > 0 {
+		forgetStreamCameras(ctx)
+		provisionCtx, cancel := context.WithTimeout(c.UserContext(), streamerFetchTimeout)
+		streamsync.Provision(provisionCtx, up.Client, up.APIURL, list)
+		cancel()
+		for _, imp := range list {
+			if imp.Provisioned {
+				result.Provisioned++
+			}
+		}
+	}
+	return response.OK(c, result)
+}
+
+// probeImports marks the pending imports whose camera does not answer an
+// RTSP DESCRIBE as unreachable
+func probeImports(ctx context.Context, list []*streamsync.Import) {
+	next := make(chan *streamsync.Import)
+	var wg sync.WaitGroup
+	for w := 0; w < importProbeWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for imp := range next {
+				probeCtx, cancel := context.WithTimeout(ctx, importProbeTimeout)
+				err := watchdog.RunProbe(probeCtx, watchdog.RTSP, watchdog.Target{RTSPURL: imp.URL})
+				cancel()
+				if err != nil {
+					imp.Status, imp.Error = streamsync.StatusUnreachable, err.Error()
+				}
+			}
+		}()
+	}
+	for _, imp := range list {
+		if imp.Status == streamsync.StatusPending {
+			next <- imp
+		}
+	}
+	close(next)
+	wg.Wait()
+}
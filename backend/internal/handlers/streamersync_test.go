@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/streamsync"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSyncFromStreamer(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"gate": {"producers": [{"url": "rtsp://10.0.0.1/live"}]}}`))
+	}))
+	defer go2rtc.Close()
+
+	cfg := &config.Config{}
+	cfg.Go2RTC.APIURL = go2rtc.URL
+	h := NewStreamerSyncHandler(db, cfg)
+	app := fiber.New()
+	app.Post("/sync", h.SyncFromStreamer)
+
+	post := func(path, body string) (int, streamsync.Result) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data streamsync.Result `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+
+	mediamtx, _ := json.Marshal(map[string]string{"kind": "mediamtx", "config": "paths:\n  yard:\n    source: rtsp://10.0.0.3/live\n"})
+	status, result := post("/sync?dry_run=true", string(mediamtx))
+	if status != 200 || !result.DryRun || len(result.Created) != 1 {
+		t.Errorf("Expected a dry run creating yard, got %d: %+v", status, result)
+	}
+	status, result = post("/sync", string(mediamtx))
+	if status != 200 || len(result.Created) != 1 || result.Created[0].StreamKey != "yard" {
+		t.Errorf("Expected yard created, got %d: %+v", status, result)
+	}
+
+	// Without a source the local go2rtc is read
+	status, result = post("/sync", `{}`)
+	if status != 200 || len(result.Created) != 1 || result.Created[0].StreamKey != "gate" {
+		t.Errorf("Expected gate created from go2rtc, got %d: %+v", status, result)
+	}
+	status, result = post("/sync", `{}`)
+	if status != 200 || len(result.Created) != 0 || len(result.Unchanged) != 1 {
+		t.Errorf("Expected gate unchanged the second time, got %d: %+v", status, result)
+	}
+
+	for _, body := range []string{
+		`{"kind": "wowza"}`,
+		`{"kind": "mediamtx"}`,
+		`{"url": "file:///etc/passwd"}`,
+		`{"url": "http://x", "config": "streams:"}`,
+		`{"config": "streams:\n  gate rtsp://x\n"}`,
+	} {
+		if status, _ := post("/sync", body); status != 422 {
+			t.Errorf("Expected 422 for %s, got %d", body, status)
+		}
+	}
+}
+
+func TestImportURLs(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+
+	// A camera that plays /live and nothing else
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	var probes int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&probes, 1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := textproto.NewReader(bufio.NewReader(conn))
+				line, _ := r.ReadLine()
+				header, _ := r.ReadMIMEHeader()
+				status := "404 Not Found"
+				if fields := strings.Fields(line); len(fields) > 1 && strings.HasSuffix(fields[1], "/live") {
+					status = "200 OK"
+				}
+				fmt.Fprintf(conn, "RTSP/1.0 %s\r\nCSeq: %s\r\n\r\n", status, header.Get("Cseq"))
+			}(conn)
+		}
+	}()
+	camera := ln.Addr().String()
+
+	var added []string
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		added = append(added, r.URL.Query().Get("name"))
+	}))
+	defer go2rtc.Close()
+
+	cfg := &config.Config{}
+	cfg.Go2RTC.APIURL = go2rtc.URL
+	h := NewStreamerSyncHandler(db, cfg)
+	app := fiber.New()
+	app.Post("/cameras/import-urls", h.ImportURLs)
+
+	post := func(path, body string) (int, URLImportResult) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := app.Test(req, 10000)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data URLImportResult `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+
+	status, result := post("/cameras/import-urls", "rtsp://"+camera+"/live\nrtsp://"+camera+"/other\nftp://x\n")
+	if status != 200 || result.Created != 1 || result.Provisioned != 1 || result.Failed != 2 {
+		t.Fatalf("Expected one camera created and two lines failed, got %d: %+v", status, result)
+	}
+	if imp := result.Cameras[1]; imp.Status != streamsync.StatusUnreachable || !strings.Contains(imp.Error, "404") {
+		t.Errorf("Expected the wrong path unreachable, got %+v", imp)
+	}
+	key := result.Cameras[0].StreamKey
+	if len(added) != 1 || added[0] != key || result.Cameras[0].Name != camera {
+		t.Errorf("Expected %s added to go2rtc and named after its address, got %v and %+v", key, added, result.Cameras[0])
+	}
+
+	atomic.StoreInt32(&probes, 0)
+	status, result = post("/cameras/import-urls", "rtsp://"+camera+"/live\n")
+	if status != 200 || result.Created != 0 || result.Skipped != 1 || result.Cameras[0].StreamKey != key {
+		t.Errorf("Expected the camera found again, got %d: %+v", status, result)
+	}
+	if n := atomic.LoadInt32(&probes); n != 0 {
+		t.Errorf("Expected the existing camera not probed, got %d probes", n)
+	}
+
+	if status, _ := post("/cameras/import-urls", "\n# nothing\n"); status != 422 {
+		t.Errorf("Expected 422 for a list without URLs, got %d", status)
+	}
+	if status, _ := post("/cameras/import-urls?stream_node=nope", "rtsp://"+camera+"/live\n"); status != 422 {
+		t.Errorf("Expected 422 for an unknown stream node, got %d", status)
+	}
+}
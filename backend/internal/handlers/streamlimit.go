@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/apikeys"
+	"github.com/abcdefak87/cctv/internal/cluster"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// streamIdle is how long an HLS stream counts as watched after its last
+// playlist or segment request
+const streamIdle = 30 * time.Second
+
+// streamLimiter caps the streams one client IP or API key has open at
+// once: in memory, or with CLUSTER_MODE in the database shared by all
+// instances
+type streamLimiter interface {
+	watchHLS(ip, streamKey string, max int) bool
+	openMSE(ip string, max int) (func(), bool)
+}
+
+// sharedSessions adapts cluster.Sessions to streamLimiter
+type sharedSessions struct {
+	*cluster.Sessions
+}
+
+func (s sharedSessions) watchHLS(ip, streamKey string, max int) bool {
+	return s.Watch(ip, streamKey, max)
+}
+
+func (s sharedSessions) openMSE(ip string, max int) (func(), bool) {
+	return s.Open(ip, max)
+}
+
+// streamSessions counts the streams each client IP is watching across
+// all cameras: every open MSE connection, plus every HLS stream
+// requested within streamIdle. HLS players poll, so that is the closest
+// there is to an open connection for them.
+type streamSessions struct {
+	mu      sync.Mutex
+	clients map[string]*streamClient
+	swept   time.Time
+	now     func() time.Time
+}
+
+type streamClient struct {
+	mse int
+	hls map[string]time.Time // stream key -> last request
+}
+
+func newStreamSessions() *streamSessions {
+	return &streamSessions{clients: map[string]*streamClient{}, now: time.Now}
+}
+
+// active returns the sessions of cl at now, forgetting idle HLS streams
+func (cl *streamClient) active(now time.Time) int {
+	for key, seen := range cl.hls {
+		if now.Sub(seen) >= streamIdle {
+			delete(cl.hls, key)
+		}
+	}
+	return cl.mse + len(cl.hls)
+}
+
+// client returns the sessions of ip. Once per streamIdle it also drops
+// clients that stopped watching, so the map does not grow with every
+// address ever seen. Callers hold s.mu.
+func (s *streamSessions) client(ip string, now time.Time) *streamClient {
+	if now.Sub(s.swept) >= streamIdle {
+		s.swept = now
+		for other, cl := range s.clients {
+			if cl.active(now) == 0 {
+				delete(s.clients, other)
+			}
+		}
+	}
+	cl, ok := s.clients[ip]
+	if !ok {
+		cl = &streamClient{hls: map[string]time.Time{}}
+		s.clients[ip] = cl
+	}
+	return cl
+}
+
+// watchHLS records an HLS request for streamKey from ip. Requests for a
+// stream ip is already watching always pass; a new stream is refused
+// when ip already has max sessions. max of zero or less means no limit.
+func (s *streamSessions) watchHLS(ip, streamKey string, max int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	cl := s.client(ip, now)
+	n := cl.active(now)
+	if _, watching := cl.hls[streamKey]; !watching && max > 0 && n >= max {
+		return false
+	}
+	cl.hls[streamKey] = now
+	return true
+}
+
+// openMSE starts an MSE session for ip and returns the func that ends
+// it, or false when ip already has max sessions
+func (s *streamSessions) openMSE(ip string, max int) (func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cl := s.client(ip, s.now())
+	if max > 0 && cl.active(s.now()) >= max {
+		return nil, false
+	}
+	cl.mse++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			cl.mse--
+			s.mu.Unlock()
+		})
+	}, true
+}
+
+// tooManyStreams answers a stream request over the per-IP limit
+func tooManyStreams(c *fiber.Ctx, max int) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(streamIdle.Seconds())))
+	return c.Status(fiber.StatusTooManyRequests).SendString("Too many streams open from your network (limit " +
+		strconv.Itoa(max) + "); close another stream and try again")
+}
+
+// apiKeyClient is who the streams of an API key are counted as, next to
+// the client IPs
+func apiKeyClient(key apikeys.Key) string {
+	return "api-key " + strconv.Itoa(key.ID)
+}
+
+// apiKeyHLS counts an HLS request for streamKey against the streams of
+// the request's API key, if it has one. When the key has MaxStreams
+// open already the response has been written and ok is false.
+func (h *StreamHandler) apiKeyHLS(c *fiber.Ctx, streamKey string) (ok bool, err error) {
+	key, keyed := c.Locals("api_key").(apikeys.Key)
+	if !keyed || h.sessions.watchHLS(apiKeyClient(key), streamKey, key.MaxStreams) {
+		return true, nil
+	}
+	return false, h.tooManyKeyStreams(c, key)
+}
+
+// apiKeyMSE opens an MSE session for the request's API key, if it has
+// one, and returns release extended to end it too. When the key has
+// MaxStreams open already, release is called, the response has been
+// written and ok is false.
+func (h *StreamHandler) apiKeyMSE(c *fiber.Ctx, release func()) (func(), bool, error) {
+	key, keyed := c.Locals("api_key").(apikeys.Key)
+	if !keyed {
+		return release, true, nil
+	}
+	releaseKey, ok := h.sessions.openMSE(apiKeyClient(key), key.MaxStreams)
+	if !ok {
+		release()
+		return nil, false, h.tooManyKeyStreams(c, key)
+	}
+	return func() {
+		releaseKey()
+		release()
+	}, true, nil
+}
+
+// tooManyKeyStreams answers a stream request over the limit of its API
+// key, and counts it in the key's usage
+func (h *StreamHandler) tooManyKeyStreams(c *fiber.Ctx, key apikeys.Key) error {
+	if err := h.keys.StreamRefused(c.UserContext(), key); err != nil {
+		logger.FromContext(c.UserContext()).Warn("Failed to count refused stream", "api_key_id", key.ID, "error", err)
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(streamIdle.Seconds())))
+	return c.Status(fiber.StatusTooManyRequests).SendString("Too many streams open with this API key (limit " +
+		strconv.Itoa(key.MaxStreams) + "); close another stream and try again")
+}
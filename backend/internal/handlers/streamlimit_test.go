@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStreamSessions(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	s := newStreamSessions()
+	s.now = func() time.Time { return now }
+
+	t.Run("Counts HLS and MSE together", func(t *testing.T) {
+		if !s.watchHLS("10.0.0.1", "gate", 3) || !s.watchHLS("10.0.0.1", "market", 3) {
+			t.Fatal("Expected the first streams to pass")
+		}
+		release, ok := s.openMSE("10.0.0.1", 3)
+		if !ok {
+			t.Fatal("Expected the third stream to pass")
+		}
+		if _, ok := s.openMSE("10.0.0.1", 3); ok {
+			t.Error("Expected a fourth MSE stream to be refused")
+		}
+		if s.watchHLS("10.0.0.1", "square", 3) {
+			t.Error("Expected a fourth HLS stream to be refused")
+		}
+		if !s.watchHLS("10.0.0.1", "gate", 3) {
+			t.Error("Expected segments of a stream already open to pass")
+		}
+		if !s.watchHLS("10.0.0.2", "square", 3) {
+			t.Error("Expected another address to have its own limit")
+		}
+
+		release()
+		release()
+		if !s.watchHLS("10.0.0.1", "square", 3) {
+			t.Error("Expected a closed MSE stream to free its slot")
+		}
+		if s.watchHLS("10.0.0.1", "park", 3) {
+			t.Error("Expected a second release to change nothing")
+		}
+	})
+
+	t.Run("Idle HLS streams expire", func(t *testing.T) {
+		now = now.Add(streamIdle)
+		for _, key := range []string{"park", "river", "school"} {
+			if !s.watchHLS("10.0.0.1", key, 3) {
+				t.Errorf("Expected %s to pass once the old streams went idle", key)
+			}
+		}
+		if _, ok := s.clients["10.0.0.2"]; ok {
+			t.Error("Expected idle clients to be forgotten")
+		}
+	})
+
+	t.Run("No limit", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			if _, ok := s.openMSE("10.0.0.3", 0); !ok {
+				t.Fatal("Expected no limit with max 0")
+			}
+		}
+	})
+}
+
+func TestStreamHandler_SessionCap(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (name, private_rtsp_url, stream_key) VALUES
+		('Gate', 'rtsp://a', 'gate'), ('Market', 'rtsp://b', 'market')`)
+
+	upstream := httptest.NewServer(nil)
+	upstream.Close()
+
+	cfg := &config.Config{Go2RTC: config.Go2RTCConfig{
+		APIURL:           upstream.URL,
+		BreakerFailures:  100,
+		MaxSessionsPerIP: 1,
+	}}
+	app := fiber.New()
+	app.Get("/hls/:streamKey/*", NewStreamHandler(db, cfg, nil, nil, context.Background()).ProxyHLS)
+
+	get := func(path string) (int, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp.StatusCode, resp.Header.Get("Retry-After")
+	}
+
+	if status, _ := get("/hls/gate/index.m3u8"); status != 502 {
+		t.Errorf("Expected the first stream to reach the stream server, got %d", status)
+	}
+	if status, _ := get("/hls/gate/hls/playlist.m3u8"); status != 502 {
+		t.Errorf("Expected the same stream to keep playing, got %d", status)
+	}
+	if status, retryAfter := get("/hls/market/index.m3u8"); status != 429 || retryAfter != "30" {
+		t.Errorf("Expected status 429 with Retry-After 30, got %d %q", status, retryAfter)
+	}
+}
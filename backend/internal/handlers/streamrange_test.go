@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStreamHandler_MSERange(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (name, private_rtsp_url, stream_key, watermark) VALUES
+		('Gate', 'rtsp://a', 'gate', FALSE), ('Dock', 'rtsp://b', 'dock', FALSE)`)
+
+	// gate is live, as go2rtc serves it; dock is served by an upstream
+	// that answers ranges
+	var mu sync.Mutex
+	var requests []string
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/stream.mp4" {
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r.URL.Query().Get("src")+" "+r.Header.Get("Range"))
+		mu.Unlock()
+		if r.URL.Query().Get("src") == "dock" && r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", "bytes 0-3/1000")
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.Write([]byte("ftyp"))
+	}))
+	defer go2rtc.Close()
+
+	cfg := &config.Config{Go2RTC: config.Go2RTCConfig{APIURL: go2rtc.URL, BreakerFailures: 100}}
+	app := fiber.New()
+	app.Get("/mse/:streamKey", NewStreamHandler(db, cfg, nil, nil, context.Background()).ProxyMSE)
+
+	do := func(method, key, ranges string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, "/mse/"+key, nil)
+		if ranges != "" {
+			req.Header.Set("Range", ranges)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := do("GET", "gate", "bytes=0-")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || resp.Header.Get("Accept-Ranges") != "none" || resp.Header.Get("Content-Range") != "" || string(body) != "ftyp" {
+		t.Errorf("Expected the whole live stream without ranges, got %d %v %q", resp.StatusCode, resp.Header, body)
+	}
+
+	resp = do("GET", "dock", "bytes=0-3")
+	if resp.StatusCode != 206 || resp.Header.Get("Content-Range") != "bytes 0-3/1000" || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Expected the upstream's partial content, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	resp = do("HEAD", "gate", "")
+	if resp.StatusCode != 200 || resp.Header.Get("Accept-Ranges") != "none" || resp.Header.Get("Content-Type") != "video/mp4" {
+		t.Errorf("Expected the stream's headers, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 || requests[0] != "gate bytes=0-" || requests[1] != "dock bytes=0-3" {
+		t.Errorf("Expected Range passed on and no stream opened for HEAD, got %q", requests)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/traffic"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// defaultTrafficRange is the hours GetStreamTraffic covers without
+	// from
+	defaultTrafficRange = 24 * time.Hour
+
+	// maxTrafficHours caps the rows of one request
+	maxTrafficHours = 5000
+)
+
+type StreamTrafficHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewStreamTrafficHandler(db *sql.DB, cfg *config.Config) *StreamTrafficHandler {
+	return &StreamTrafficHandler{db: db, cfg: cfg}
+}
+
+// GetStreamTraffic - What the stream proxy served per camera, hour and
+// kind (hls, mse, audio), oldest first: ?camera_id= and ?kind= filter
+// it, ?from= and ?to= (RFC 3339 or YYYY-MM-DD) bound it, the last 24
+// hours by default. Counts lag by up to a minute.
+func (h *StreamTrafficHandler) GetStreamTraffic(c *fiber.Ctx) error {
+	fields := map[string]string{}
+	f := traffic.Filter{CameraID: c.QueryInt("camera_id"), Kind: c.Query("kind"), Limit: maxTrafficHours}
+	switch f.Kind {
+	case "", traffic.HLS, traffic.MSE, traffic.Audio:
+	default:
+		fields["kind"] = "must be hls, mse or audio"
+	}
+
+	f.To = time.Now().Add(time.Hour).Truncate(time.Hour)
+	if raw := c.Query("to"); raw != "" {
+		t, dateOnly, ok := parseTimeFilter(raw)
+		if !ok {
+			fields["to"] = "must be an RFC 3339 time or YYYY-MM-DD"
+		}
+		if dateOnly {
+			// A date includes that whole day
+			t = t.AddDate(0, 0, 1)
+		}
+		f.To = t
+	}
+	f.From = f.To.Add(-defaultTrafficRange)
+	if raw := c.Query("from"); raw != "" {
+		t, _, ok := parseTimeFilter(raw)
+		if !ok {
+			fields["from"] = "must be an RFC 3339 time or YYYY-MM-DD"
+		}
+		f.From = t
+	}
+	if len(fields) == 0 && !f.From.Before(f.To) {
+		fields["from"] = "must be before to"
+	}
+	if len(fields) > 0 {
+		return invalidFields(c, "", fields)
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	list, err := traffic.Hours(ctx, h.db, f)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch stream traffic")
+	}
+	return response.OK(c, list)
+}
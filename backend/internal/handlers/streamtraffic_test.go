@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/traffic"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGetStreamTraffic(t *testing.T) {
+	db := dbtest.Open(t)
+
+	hour := time.Now().UTC().Truncate(time.Hour)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://a', 'gate'), (2, 'Market', 'rtsp://b', 'market')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (3, 'Dander', 'rtsp://c', 'dander', 2)`,
+	)
+	for _, row := range []struct {
+		camera int
+		at     time.Time
+		kind   string
+	}{
+		{1, hour, traffic.HLS}, {1, hour, traffic.MSE}, {2, hour.Add(-time.Hour), traffic.HLS},
+		{1, hour.Add(-48 * time.Hour), traffic.HLS}, {3, hour, traffic.HLS},
+	} {
+		if _, err := db.Exec(`INSERT INTO stream_traffic (camera_id, hour, kind, requests, bytes, duration_ms) VALUES (?, ?, ?, 3, 4096, 1500)`,
+			row.camera, row.at, row.kind); err != nil {
+			t.Fatalf("Failed to add traffic: %v", err)
+		}
+	}
+
+	h := NewStreamTrafficHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Get("/admin/stream-traffic", h.GetStreamTraffic)
+
+	get := func(query string) (int, []traffic.Hour) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/admin/stream-traffic?"+query, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data []traffic.Hour `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+
+	// The last 24 hours of the organization's cameras, oldest first
+	status, list := get("")
+	if status != 200 || len(list) != 3 {
+		t.Fatalf("Expected 3 hours, got %d: %+v", status, list)
+	}
+	if list[0].CameraID != 2 || list[1].Kind != traffic.HLS || list[2].Kind != traffic.MSE || list[2].Bytes != 4096 {
+		t.Errorf("Expected Market's hour first, then Gate's by kind, got %+v", list)
+	}
+
+	if _, list := get("camera_id=1&kind=hls"); len(list) != 1 || list[0].Camera != "Gate" {
+		t.Errorf("Expected Gate's hls traffic, got %+v", list)
+	}
+	if _, list := get("from=" + hour.AddDate(0, 0, -3).Format("2006-01-02")); len(list) != 4 {
+		t.Errorf("Expected the older hour too, got %+v", list)
+	}
+
+	for _, query := range []string{"kind=webrtc", "from=yesterday", "to=2026-13-01", "from=2026-03-10&to=2026-03-09"} {
+		if status, _ := get(query); status != 422 {
+			t.Errorf("Expected 422 for %q, got %d", query, status)
+		}
+	}
+}
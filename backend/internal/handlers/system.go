@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/sysmon"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type SystemHandler struct {
+	monitor *sysmon.Monitor
+	cfg     *config.Config
+}
+
+func NewSystemHandler(monitor *sysmon.Monitor, cfg *config.Config) *SystemHandler {
+	return &SystemHandler{monitor: monitor, cfg: cfg}
+}
+
+// GetSystemResources - CPU, memory, disk and network usage of the
+// instance serving the request, with the recent samples for sparklines.
+// Every instance samples itself, so behind a load balancer successive
+// calls may report different hosts.
+func (h *SystemHandler) GetSystemResources(c *fiber.Ctx) error {
+	current, ok := h.monitor.Latest()
+	if !ok {
+		return response.Fail(c, fiber.StatusServiceUnavailable, "No resource sample yet")
+	}
+	return response.OK(c, fiber.Map{
+		"instance":         h.cfg.Cluster.InstanceID,
+		"interval_seconds": h.monitor.Interval().Seconds(),
+		"current":          current,
+		"history":          h.monitor.History(),
+	})
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// otherOrg adds a second organization, Dander (id 2), for tests that
+// check nothing leaks across organizations
+const otherOrg = `INSERT INTO organizations (id, name, slug) VALUES (2, 'Dander', 'dander')`
+
+// seedDB runs the statements that set up a test's data
+func seedDB(t *testing.T, db *sql.DB, stmts ...string) {
+	t.Helper()
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Moderation states of feedback shown as a testimonial
+const (
+	ModerationNone     = "none"
+	ModerationPending  = "pending"
+	ModerationApproved = "approved"
+	ModerationRejected = "rejected"
+)
+
+// moderationTransitions are the states each state may move to: feedback
+// is queued for review, then approved or rejected; approved feedback is
+// taken down by rejecting it or sending it back to the queue
+var moderationTransitions = map[string][]string{
+	ModerationNone:     {ModerationPending},
+	ModerationPending:  {ModerationApproved, ModerationRejected, ModerationNone},
+	ModerationApproved: {ModerationRejected, ModerationPending},
+	ModerationRejected: {ModerationPending, ModerationNone},
+}
+
+func canModerate(from, to string) bool {
+	for _, s := range moderationTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	maxTestimonialLength = 1000
+	defaultTestimonials  = 10
+	maxTestimonials      = 50
+)
+
+// FeedbackModerationRequest moves feedback through moderation. Approving
+// publishes PublicMessage, or the sanitized message when it is empty.
+type FeedbackModerationRequest struct {
+	State         string `json:"state" validate:"required,oneof=none pending approved rejected"`
+	PublicMessage string `json:"public_message" validate:"max=5000"`
+	Anonymize     *bool  `json:"anonymize"` // unchanged when null
+}
+
+// FeedbackModeration is the moderation of one feedback
+type FeedbackModeration struct {
+	ID            int        `json:"id"`
+	State         string     `json:"state"`
+	PublicMessage string     `json:"public_message"`
+	PublicName    string     `json:"public_name"` // as it is shown
+	Anonymize     bool       `json:"anonymize"`
+	ModeratedBy   *int       `json:"moderated_by"`
+	ModeratedAt   *time.Time `json:"moderated_at"`
+}
+
+// Testimonial is approved feedback as residents see it
+type Testimonial struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetPublicFeedback - Approved feedback for a "what residents say"
+// section, most recently approved first. Names are shown as a first
+// name and initial where the admin chose so, or for all with
+// ?anonymize=true; ?limit caps the list (10 by default).
+func (h *FeedbackHandler) GetPublicFeedback(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultTestimonials)
+	if limit < 1 || limit > maxTestimonials {
+		return invalidFields(c, "", map[string]string{"limit": "must be between 1 and 50"})
+	}
+	anonymizeAll := c.QueryBool("anonymize", false)
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, COALESCE(name, ''), public_message, anonymize, created_at
+		FROM feedback
+		WHERE moderation = ?
+		ORDER BY moderated_at DESC, id DESC
+		LIMIT ?
+	`, ModerationApproved, limit)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch testimonials")
+	}
+	defer rows.Close()
+
+	list := []Testimonial{}
+	for rows.Next() {
+		var t Testimonial
+		var anonymize bool
+		if err := rows.Scan(&t.ID, &t.Name, &t.Message, &anonymize, &t.CreatedAt); err != nil {
+			return serviceError(c, err, "", "Failed to fetch testimonials")
+		}
+		t.Name = publicName(t.Name, anonymize || anonymizeAll)
+		list = append(list, t)
+	}
+	if err := rows.Err(); err != nil {
+		return serviceError(c, err, "", "Failed to fetch testimonials")
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return response.OK(c, list)
+}
+
+// ModerateFeedback - Move feedback through moderation: queue it for
+// review, approve it as a public testimonial or reject it (admin only)
+func (h *FeedbackHandler) ModerateFeedback(c *fiber.Ctx) error {
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Feedback not found")
+	}
+	var req FeedbackModerationRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to moderate feedback")
+	}
+	defer tx.Rollback()
+
+	var m FeedbackModeration
+	var name, message string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, COALESCE(name, ''), message, moderation, public_message, anonymize FROM feedback WHERE id = ?
+	`, id).Scan(&m.ID, &name, &message, &m.State, &m.PublicMessage, &m.Anonymize)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response.Fail(c, 404, "Feedback not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to moderate feedback")
+	}
+	if req.State != m.State && !canModerate(m.State, req.State) {
+		return invalidFields(c, "", map[string]string{
+			"state": "cannot move from " + m.State + " to " + req.State + "; allowed: " + strings.Join(moderationTransitions[m.State], ", "),
+		})
+	}
+
+	if req.PublicMessage != "" {
+		m.PublicMessage = sanitizeTestimonial(req.PublicMessage)
+	} else if m.PublicMessage == "" {
+		m.PublicMessage = sanitizeTestimonial(message)
+	}
+	if req.State == ModerationApproved && m.PublicMessage == "" {
+		return invalidFields(c, "", map[string]string{"public_message": "is empty once sanitized; write the text to show"})
+	}
+	if req.Anonymize != nil {
+		m.Anonymize = *req.Anonymize
+	}
+
+	m.State = req.State
+	now := time.Now().UTC()
+	m.ModeratedAt = &now
+	if userID, ok := c.Locals("user_id").(int); ok {
+		m.ModeratedBy = &userID
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE feedback SET moderation = ?, public_message = ?, anonymize = ?, moderated_by = ?, moderated_at = ?, updated_at = ?
+		WHERE id = ?
+	`, m.State, m.PublicMessage, m.Anonymize, m.ModeratedBy, now, now, id); err != nil {
+		return serviceError(c, err, "", "Failed to moderate feedback")
+	}
+	if err := tx.Commit(); err != nil {
+		return serviceError(c, err, "", "Failed to moderate feedback")
+	}
+
+	m.PublicName = publicName(name, m.Anonymize)
+	return response.OK(c, m)
+}
+
+var (
+	tagPattern   = regexp.MustCompile(`<[^>]*>`)
+	emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)
+	urlPattern   = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`)
+	spacePattern = regexp.MustCompile(`[ \t]+`)
+	blankLines   = regexp.MustCompile(`\n{3,}`)
+)
+
+// sanitizeTestimonial makes feedback fit to publish: markup and control
+// characters are removed, email addresses, links and phone numbers are
+// redacted, whitespace is tidied and the text is cut to 1000 characters
+// at a word boundary. The result is plain text for the client to escape.
+func sanitizeTestimonial(s string) string {
+	s = html.UnescapeString(tagPattern.ReplaceAllString(s, " "))
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || r == '<' || r == '>' {
+			return -1
+		}
+		return r
+	}, strings.ReplaceAll(s, "\r\n", "\n"))
+	s = emailPattern.ReplaceAllString(s, "[email removed]")
+	s = urlPattern.ReplaceAllString(s, "[link removed]")
+	s = phonePattern.ReplaceAllStringFunc(s, func(m string) string {
+		// Dates and amounts have fewer digits than a phone number
+		if countDigits(m) >= 9 {
+			return "[phone removed]"
+		}
+		return m
+	})
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spacePattern.ReplaceAllString(line, " "))
+	}
+	s = strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+
+	if runes := []rune(s); len(runes) > maxTestimonialLength {
+		cut := string(runes[:maxTestimonialLength])
+		if i := strings.LastIndexAny(cut, " \n"); i > maxTestimonialLength/2 {
+			cut = cut[:i]
+		}
+		s = strings.TrimSpace(cut) + "…"
+	}
+	return s
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// publicName is the name shown with a testimonial: the first name and
+// the initial of the last when anonymized, "Anonymous" without a name
+func publicName(name string, anonymize bool) string {
+	words := strings.Fields(sanitizeTestimonial(name))
+	if len(words) == 0 {
+		return "Anonymous"
+	}
+	if !anonymize {
+		return strings.Join(words, " ")
+	}
+	first := words[0]
+	if len(words) == 1 {
+		return first
+	}
+	last := []rune(words[len(words)-1])
+	return first + " " + string(unicode.ToUpper(last[0])) + "."
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestFeedbackModeration(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'ana', 'x', 'admin')`,
+		`INSERT INTO feedback (id, name, email, message) VALUES
+			(1, 'Siti Rahayu', 'siti@example.com', 'The gate camera helped find my bike! Call me on 0812 3456 7890.'),
+			(2, 'Budi Santoso', '', 'Great service'),
+			(3, '', '', '<p> </p>')`,
+	)
+
+	h := NewFeedbackHandler(db, &config.Config{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", 1)
+		return c.Next()
+	})
+	app.Get("/feedback/public", h.GetPublicFeedback)
+	app.Patch("/feedback/:id/moderation", h.ModerateFeedback)
+
+	moderate := func(id, body string) (int, FeedbackModeration) {
+		t.Helper()
+		req := httptest.NewRequest("PATCH", "/feedback/"+id+"/moderation", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data FeedbackModeration `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, env.Data
+	}
+	public := func(query string) []Testimonial {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/feedback/public"+query, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env struct {
+			Data []Testimonial `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return env.Data
+	}
+
+	if code, _ := moderate("1", `{"state":"approved"}`); code != 422 {
+		t.Errorf("Approving unqueued feedback = %d, want 422", code)
+	}
+	if code, _ := moderate("9", `{"state":"pending"}`); code != 404 {
+		t.Errorf("Moderating missing feedback = %d, want 404", code)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		if code, _ := moderate(id, `{"state":"pending"}`); code != 200 {
+			t.Fatalf("Queueing %s = %d", id, code)
+		}
+	}
+	if list := public(""); len(list) != 0 {
+		t.Errorf("Queued feedback is public: %+v", list)
+	}
+
+	code, m := moderate("1", `{"state":"approved"}`)
+	if code != 200 || m.State != ModerationApproved || m.ModeratedBy == nil || *m.ModeratedBy != 1 {
+		t.Fatalf("Approve = %d, %+v", code, m)
+	}
+	if strings.Contains(m.PublicMessage, "0812") || !strings.Contains(m.PublicMessage, "[phone removed]") || m.PublicName != "Siti R." {
+		t.Errorf("Approved = %+v", m)
+	}
+	if code, _ := moderate("2", `{"state":"approved","public_message":"Great service, thank you","anonymize":false}`); code != 200 {
+		t.Fatalf("Approve with text = %d", code)
+	}
+	if code, _ := moderate("3", `{"state":"approved"}`); code != 422 {
+		t.Errorf("Approving feedback empty once sanitized = %d, want 422", code)
+	}
+
+	list := public("")
+	if len(list) != 2 || list[0].Name != "Budi Santoso" || list[0].Message != "Great service, thank you" || list[1].Name != "Siti R." {
+		t.Fatalf("Public = %+v", list)
+	}
+	if list := public("?anonymize=true&limit=1"); len(list) != 1 || list[0].Name != "Budi S." {
+		t.Errorf("Anonymized = %+v", list)
+	}
+
+	if code, _ := moderate("2", `{"state":"rejected"}`); code != 200 {
+		t.Fatalf("Reject = %d", code)
+	}
+	if list := public(""); len(list) != 1 || list[0].ID != 1 {
+		t.Errorf("Public after rejecting = %+v", list)
+	}
+}
+
+func TestSanitizeTestimonial(t *testing.T) {
+	for in, want := range map[string]string{
+		"<b>Great</b>   work &amp; thanks\r\n\r\n\r\n\r\nBye": "Great work & thanks\n\nBye",
+		"Mail me at a.b+c@example.co.id":                      "Mail me at [email removed]",
+		"See https://x.example/y?z=1 or www.example.com":      "See [link removed] or [link removed]",
+		"Call +62 812-3456-7890 today":                        "Call [phone removed] today",
+		"Fixed on 2026-05-01 for Rp 150.000":                  "Fixed on 2026-05-01 for Rp 150.000",
+		"bell\x07 rang":                                       "bell rang",
+	} {
+		if got := sanitizeTestimonial(in); got != want {
+			t.Errorf("sanitizeTestimonial(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	long := strings.Repeat("word ", 300)
+	if got := []rune(sanitizeTestimonial(long)); len(got) > maxTestimonialLength+1 || got[len(got)-1] != '…' {
+		t.Errorf("Long text was cut to %d runes", len(got))
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/internal/ticketing"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultTicketLimit = 50
+	maxTicketLimit     = 500
+)
+
+type TicketHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewTicketHandler(db *sql.DB, cfg *config.Config) *TicketHandler {
+	return &TicketHandler{db: db, cfg: cfg}
+}
+
+// GetTickets - Maintenance tickets opened for offline cameras, newest
+// first; ?status=pending, open or closed filters them and ?limit caps
+// them (50 by default)
+func (h *TicketHandler) GetTickets(c *fiber.Ctx) error {
+	status, limit, ok, err := ticketFilter(c)
+	if !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	list, err := ticketing.List(ctx, h.db, tenant.OrgID(ctx), 0, status, limit)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch tickets")
+	}
+	return response.OK(c, list)
+}
+
+// GetCameraTickets - The maintenance tickets of a camera, newest first,
+// filtered as GetTickets
+func (h *TicketHandler) GetCameraTickets(c *fiber.Ctx) error {
+	cameraID, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "Camera not found")
+	}
+	status, limit, ok, err := ticketFilter(c)
+	if !ok {
+		return err
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	found, err := cameraExists(ctx, h.db, cameraID)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch tickets")
+	}
+	if !found {
+		return response.Fail(c, 404, "Camera not found")
+	}
+	list, err := ticketing.List(ctx, h.db, tenant.OrgID(ctx), cameraID, status, limit)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch tickets")
+	}
+	return response.OK(c, list)
+}
+
+// ticketFilter reads ?status and ?limit. When ok is false the response
+// has been written and the handler should return err.
+func ticketFilter(c *fiber.Ctx) (status string, limit int, ok bool, err error) {
+	status = c.Query("status")
+	switch status {
+	case "", ticketing.StatusPending, ticketing.StatusOpen, ticketing.StatusClosed:
+	default:
+		return "", 0, false, invalidFields(c, "", map[string]string{"status": "must be pending, open or closed"})
+	}
+	limit = c.QueryInt("limit", defaultTicketLimit)
+	if limit < 1 || limit > maxTicketLimit {
+		return "", 0, false, invalidFields(c, "", map[string]string{"limit": "must be between 1 and 500"})
+	}
+	return status, limit, true, nil
+}
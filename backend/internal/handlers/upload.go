@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/internal/uploads"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type UploadHandler struct {
+	db    *sql.DB
+	store *uploads.Store
+	cfg   *config.Config
+}
+
+func NewUploadHandler(db *sql.DB, store *uploads.Store, cfg *config.Config) *UploadHandler {
+	return &UploadHandler{db: db, store: store, cfg: cfg}
+}
+
+// CreateUpload - Upload an image as the "file" field of a multipart
+// form, with "kind" saying what it is for: avatar, sponsor_logo or
+// branding. Sponsor logos and branding are for admins; the returned
+// URL is what settings should refer to, which keeps the file from
+// being collected.
+func (h *UploadHandler) CreateUpload(c *fiber.Ctx) error {
+	kind := c.FormValue("kind")
+	if _, ok := uploads.Specs[kind]; !ok || kind == uploads.KindAttachment {
+		return invalidFields(c, "", map[string]string{"kind": "must be avatar, sponsor_logo or branding"})
+	}
+	if role, _ := c.Locals("role").(string); kind != uploads.KindAvatar &&
+		role != models.RoleAdmin && role != models.RoleOrgAdmin {
+		return response.Fail(c, fiber.StatusForbidden, "Insufficient permissions")
+	}
+
+	u, ok, err := h.save(c, kind)
+	if !ok {
+		return err
+	}
+	return response.Created(c, "Upload stored", u)
+}
+
+// SetAvatar - Upload the "file" field of a multipart form as the
+// signed-in user's avatar; it is cropped square and scaled to 256px
+func (h *UploadHandler) SetAvatar(c *fiber.Ctx) error {
+	u, ok, err := h.save(c, uploads.KindAvatar)
+	if !ok {
+		return err
+	}
+	if ok, err := h.setAvatar(c, u.Key); !ok {
+		return err
+	}
+	return response.OK(c, fiber.Map{"avatar": u.Key, "url": u.URL})
+}
+
+// DeleteAvatar - Remove the signed-in user's avatar; its file goes with
+// the next collection of orphaned uploads
+func (h *UploadHandler) DeleteAvatar(c *fiber.Ctx) error {
+	if ok, err := h.setAvatar(c, ""); !ok {
+		return err
+	}
+	return response.Message(c, "Avatar removed")
+}
+
+// GetUpload - Serve an uploaded file. Keys name their content, so the
+// response may be cached for good.
+func (h *UploadHandler) GetUpload(c *fiber.Ctx) error {
+	key := c.Params("key")
+	etag := `"` + key + `"`
+	if c.Get(fiber.HeaderIfNoneMatch) == etag && uploads.ValidKey(key) {
+		c.Set(fiber.HeaderCacheControl, uploads.CacheControl)
+		c.Set(fiber.HeaderETag, etag)
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	f, contentType, err := h.store.Open(c.UserContext(), key)
+	if errors.Is(err, uploads.ErrNotFound) {
+		return response.Fail(c, fiber.StatusNotFound, "Upload not found")
+	}
+	if err != nil {
+		return serviceError(c, err, "", "Failed to read upload")
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, uploads.CacheControl)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.SendStream(f)
+}
+
+// CollectUploads - Remove the orphaned uploads now instead of at the
+// next hourly run
+func (h *UploadHandler) CollectUploads(c *fiber.Ctx) error {
+	n, err := h.store.Collect(c.UserContext())
+	if err != nil {
+		return serviceError(c, err, "", "Failed to collect uploads")
+	}
+	return response.OK(c, fiber.Map{"removed": n})
+}
+
+// save reads the "file" field of the form and stores it as kind. When
+// ok is false the response has been written and the handler should
+// return err.
+func (h *UploadHandler) save(c *fiber.Ctx, kind string) (u uploads.Upload, ok bool, err error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return u, false, invalidFields(c, "", map[string]string{"file": "is required"})
+	}
+	f, err := file.Open()
+	if err != nil {
+		return u, false, response.Fail(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	data, err := io.ReadAll(io.LimitReader(f, uploads.MaxSize+1))
+	f.Close()
+	if err != nil {
+		return u, false, response.Fail(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	var userID *int
+	if id, ok := c.Locals("user_id").(int); ok {
+		userID = &id
+	}
+	u, err = h.store.Save(ctx, kind, tenant.OrgID(ctx), userID, data)
+	switch {
+	case errors.Is(err, uploads.ErrTooLarge), errors.Is(err, uploads.ErrUnsupported),
+		errors.Is(err, uploads.ErrCorrupt), errors.Is(err, uploads.ErrTooManyPx):
+		return u, false, invalidFields(c, "", map[string]string{"file": err.Error()})
+	case err != nil:
+		return u, false, serviceError(c, err, "", "Failed to store upload")
+	}
+	return u, true, nil
+}
+
+// setAvatar points the signed-in user's avatar at key. When ok is false
+// the response has been written and the handler should return err.
+func (h *UploadHandler) setAvatar(c *fiber.Ctx, key string) (ok bool, err error) {
+	userID, _ := c.Locals("user_id").(int)
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	result, err := h.db.ExecContext(ctx, "UPDATE users SET avatar = ?, updated_at = ? WHERE id = ?",
+		key, time.Now().UTC(), userID)
+	if err != nil {
+		return false, serviceError(c, err, "", "Failed to change avatar")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, response.Fail(c, fiber.StatusNotFound, "User not found")
+	}
+
+	publish(c, events.Event{
+		Type:     events.UserAvatarChanged,
+		Resource: "user",
+		Data:     map[string]interface{}{"avatar": key},
+	})
+	return true, nil
+}
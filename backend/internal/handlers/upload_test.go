@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/uploads"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUploads(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO users (id, username, password_hash, role) VALUES (1, 'ana', 'x', 'operator')`)
+
+	store := uploads.New(db, uploads.NewDirStorage(t.TempDir()), "")
+	h := NewUploadHandler(db, store, &config.Config{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", 1)
+		c.Locals("role", c.Get("X-Role", "operator"))
+		return c.Next()
+	})
+	app.Post("/uploads", h.CreateUpload)
+	app.Put("/uploads/avatar", h.SetAvatar)
+	app.Delete("/uploads/avatar", h.DeleteAvatar)
+	app.Get("/public/uploads/:key", h.GetUpload)
+
+	var pic bytes.Buffer
+	png.Encode(&pic, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+
+	do := func(method, path, role, kind string, file []byte, header http.Header) (int, http.Header, []byte) {
+		t.Helper()
+		var body io.Reader
+		contentType := ""
+		if file != nil {
+			var form bytes.Buffer
+			w := multipart.NewWriter(&form)
+			if kind != "" {
+				w.WriteField("kind", kind)
+			}
+			part, _ := w.CreateFormFile("file", "pic.png")
+			part.Write(file)
+			w.Close()
+			body, contentType = &form, w.FormDataContentType()
+		}
+		req := httptest.NewRequest(method, path, body)
+		for k := range header {
+			req.Header.Set(k, header.Get(k))
+		}
+		req.Header.Set("X-Role", role)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header, data
+	}
+
+	t.Run("Avatar", func(t *testing.T) {
+		status, _, body := do("PUT", "/uploads/avatar", "operator", "", pic.Bytes(), nil)
+		var env struct {
+			Data struct {
+				Avatar string `json:"avatar"`
+				URL    string `json:"url"`
+			} `json:"data"`
+		}
+		json.Unmarshal(body, &env)
+		if status != 200 || env.Data.URL != "/api/public/uploads/"+env.Data.Avatar {
+			t.Fatalf("Expected the avatar set, got %d: %s", status, body)
+		}
+		var avatar string
+		db.QueryRow(`SELECT avatar FROM users WHERE id = 1`).Scan(&avatar)
+		if avatar != env.Data.Avatar {
+			t.Errorf("Expected the user's avatar to be %q, got %q", env.Data.Avatar, avatar)
+		}
+
+		status, header, data := do("GET", "/public/uploads/"+avatar, "", "", nil, nil)
+		img, err := png.Decode(bytes.NewReader(data))
+		if status != 200 || err != nil || img.Bounds().Dx() != 256 || img.Bounds().Dy() != 256 {
+			t.Fatalf("Expected the 256px avatar, got %d, %v", status, err)
+		}
+		if header.Get("Cache-Control") != uploads.CacheControl || header.Get("Content-Type") != "image/png" {
+			t.Errorf("Expected a cacheable PNG, got %v", header)
+		}
+		if status, _, _ := do("GET", "/public/uploads/"+avatar, "", "", nil, http.Header{"If-None-Match": {header.Get("ETag")}}); status != 304 {
+			t.Errorf("Expected status 304 for the same ETag, got %d", status)
+		}
+
+		if status, _, _ := do("DELETE", "/uploads/avatar", "operator", "", nil, nil); status != 200 {
+			t.Errorf("Expected status 200, got %d", status)
+		}
+		db.QueryRow(`SELECT avatar FROM users WHERE id = 1`).Scan(&avatar)
+		if avatar != "" {
+			t.Errorf("Expected the avatar removed, got %q", avatar)
+		}
+	})
+
+	t.Run("Kinds", func(t *testing.T) {
+		if status, _, body := do("POST", "/uploads", "operator", "branding", pic.Bytes(), nil); status != 403 {
+			t.Errorf("Expected status 403 for branding by an operator, got %d: %s", status, body)
+		}
+		if status, _, body := do("POST", "/uploads", models.RoleAdmin, "branding", pic.Bytes(), nil); status != 201 {
+			t.Errorf("Expected status 201 for branding by an admin, got %d: %s", status, body)
+		}
+		if status, _, _ := do("POST", "/uploads", models.RoleAdmin, "banner", pic.Bytes(), nil); status != 422 {
+			t.Errorf("Expected status 422 for an unknown kind, got %d", status)
+		}
+		if status, _, _ := do("POST", "/uploads", models.RoleAdmin, "avatar", []byte("GIF89a"), nil); status != 422 {
+			t.Errorf("Expected status 422 for a GIF, got %d", status)
+		}
+		if status, _, _ := do("GET", "/public/uploads/..%2Fcctv.db", "", "", nil, nil); status != 404 {
+			t.Errorf("Expected status 404 for an invalid key, got %d", status)
+		}
+	})
+}
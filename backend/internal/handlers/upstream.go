@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/abcdefak87/cctv/internal/edge"
+	"github.com/abcdefak87/cctv/internal/streamnode"
+	"github.com/abcdefak87/cctv/pkg/breaker"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// streamUpstream is the go2rtc that serves a camera: the local one, a
+// secondary stream node, or the one at an edge node's site, reached
+// through its tunnels
+type streamUpstream struct {
+	apiURL   string
+	client   *http.Client
+	src      string // go2rtc stream to play; only set when starting playback
+	edge     bool
+	node     string // the stream node; "" for the local go2rtc
+	cameraID int
+}
+
+// do sends req upstream. Requests to the local go2rtc go through b; an
+// edge site or a stream node being unreachable says nothing about the
+// local go2rtc, so those bypass it.
+func (up streamUpstream) do(req *http.Request, b *breaker.Breaker) (*http.Response, error) {
+	if up.edge || up.node != "" {
+		return up.client.Do(req)
+	}
+	done, err := b.Allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := up.client.Do(req)
+	done(upstreamOK(err))
+	return resp, err
+}
+
+// upstream returns where streamKey is played from. With start set, as
+// for a master playlist or an MSE stream, it also picks the stream to
+// play: the watermarked copy when the camera has the watermark on. A
+// watermark that cannot be set up fails the request instead of serving
+// the clean feed.
+func (h *StreamHandler) upstream(c *fiber.Ctx, streamKey string, start bool) (streamUpstream, int, string) {
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	cam, err := h.streamCamera(ctx, streamKey)
+	if err != nil {
+		return streamUpstream{}, 500, "Failed to fetch camera"
+	}
+
+	node, err := streamnode.Lookup(h.cfg.Stream(), cam.StreamNode)
+	if err != nil {
+		logger.FromContext(c.UserContext()).Error("Camera names an unknown stream node", "stream_key", streamKey, "stream_node", cam.StreamNode)
+		return streamUpstream{}, 502, "Failed to connect to stream server"
+	}
+	up := streamUpstream{
+		apiURL:   node.APIURL,
+		client:   node.Client,
+		src:      streamKey,
+		node:     node.Node,
+		cameraID: cam.ID,
+	}
+	// An edge node relays the camera whatever its stream node
+	if cam.EdgeNodeID != nil {
+		if h.edges == nil {
+			return streamUpstream{}, 502, "Failed to connect to stream server"
+		}
+		up.apiURL, up.client, up.edge, up.node = edge.BaseURL(*cam.EdgeNodeID), h.edges.Client(), true, ""
+	}
+	if !start || !cam.Watermark {
+		return up, 0, ""
+	}
+
+	text := companyName(ctx, h.db, cam.OrgID)
+	up.src, err = h.copies.Ensure(c.UserContext(), up.client, up.apiURL, streamKey, text)
+	if err != nil {
+		logger.FromContext(c.UserContext()).Error("Failed to set up watermarked stream", "stream_key", streamKey, "error", err)
+		return streamUpstream{}, 502, "Failed to connect to stream server"
+	}
+	return up, 0, ""
+}
@@ -1,355 +1,195 @@
 package handlers
 
 import (
-	"database/sql"
-	"time"
+	"context"
+	"errors"
 
 	"github.com/abcdefak87/cctv/internal/config"
 	"github.com/abcdefak87/cctv/internal/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/abcdefak87/cctv/internal/service"
+	"github.com/abcdefak87/cctv/pkg/response"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type UserHandler struct {
-	db  *sql.DB
-	cfg *config.Config
+	users service.UserService
+	cfg   *config.Config
 }
 
-func NewUserHandler(db *sql.DB, cfg *config.Config) *UserHandler {
-	return &UserHandler{db: db, cfg: cfg}
+func NewUserHandler(users service.UserService, cfg *config.Config) *UserHandler {
+	return &UserHandler{users: users, cfg: cfg}
+}
+
+// UserRequest is the create/update body; an empty password on update
+// keeps the current one
+type UserRequest struct {
+	Username string `json:"username" validate:"required,max=50"`
+	Email    string `json:"email" validate:"email,max=255"`
+	Password string `json:"password" validate:"max=72"` // bcrypt ignores anything longer
+	Role     string `json:"role" validate:"oneof=admin org_admin operator viewer user"`
+
+	// Grants on top of the role, e.g. ["anpr"]; replaced on update
+	Permissions []string `json:"permissions" validate:"max=10"`
+}
+
+func (r *UserRequest) input() service.UserInput {
+	return service.UserInput{
+		Username:    r.Username,
+		Email:       r.Email,
+		Password:    r.Password,
+		Role:        r.Role,
+		Permissions: r.Permissions,
+	}
+}
+
+// checkTarget answers 403 when the user with id is an admin and the
+// caller is not: admins run the instance, so an org admin may not
+// change or delete them. When ok is false the response has been written
+// and the handler should return err.
+func (h *UserHandler) checkTarget(c *fiber.Ctx, ctx context.Context, id int) (ok bool, err error) {
+	target, err := h.users.Get(ctx, id)
+	if err != nil {
+		return false, serviceError(c, err, "User not found", "Failed to fetch user")
+	}
+	if target.Role == models.RoleAdmin && c.Locals("role") != models.RoleAdmin {
+		return false, response.Fail(c, fiber.StatusForbidden, "Only admins can change an admin")
+	}
+	return true, nil
 }
 
 // GetAllUsers - Get all users (admin only)
 func (h *UserHandler) GetAllUsers(c *fiber.Ctx) error {
-	rows, err := h.db.Query(`
-		SELECT id, username, email, role, created_at, updated_at
-		FROM users
-		ORDER BY id ASC
-	`)
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	page := response.ParsePage(c, 0)
+
+	users, total, err := h.users.List(ctx, listOptions(page))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch users",
-		})
-	}
-	defer rows.Close()
-
-	users := []map[string]interface{}{}
-	for rows.Next() {
-		var user models.User
-
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			continue
-		}
-
-		users = append(users, map[string]interface{}{
-			"id":         user.ID,
-			"username":   user.Username,
-			"email":      user.Email,
-			"role":       user.Role,
-			"created_at": user.CreatedAt,
-			"updated_at": user.UpdatedAt,
-		})
+		return response.Fail(c, 500, "Failed to fetch users")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    users,
-	})
+	return response.Paginated(c, users, page.Meta(total))
 }
 
 // GetUser - Get single user by ID
 func (h *UserHandler) GetUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	var user models.User
-	err := h.db.QueryRow(`
-		SELECT id, username, email, role, created_at, updated_at
-		FROM users WHERE id = ?
-	`, id).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
-
-	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "User not found",
-		})
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "User not found")
 	}
 
+	user, err := h.users.Get(ctx, id)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to fetch user",
-		})
+		return serviceError(c, err, "User not found", "Failed to fetch user")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": map[string]interface{}{
-			"id":         user.ID,
-			"username":   user.Username,
-			"email":      user.Email,
-			"role":       user.Role,
-			"created_at": user.CreatedAt,
-			"updated_at": user.UpdatedAt,
-		},
-	})
+	return response.OK(c, user)
 }
 
 // CreateUser - Create new user
 func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
-	var req struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		Role     string `json:"role"`
-	}
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
-	}
-
-	// Validation
-	if req.Username == "" || req.Password == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Username and password are required",
-		})
-	}
-
-	if req.Role == "" {
-		req.Role = "user"
-	}
-
-	// Check if username exists
-	var exists int
-	err := h.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", req.Username).Scan(&exists)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to check username",
-		})
-	}
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	if exists > 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Username already exists",
-		})
+	var req UserRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
 	}
-
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to hash password",
-		})
+	// Admins see every organization, so only they may make more
+	if req.Role == models.RoleAdmin && c.Locals("role") != models.RoleAdmin {
+		return response.Fail(c, fiber.StatusForbidden, "Only admins can grant the admin role")
 	}
 
-	result, err := h.db.Exec(`
-		INSERT INTO users (username, email, password, role, updated_at)
-		VALUES (?, ?, ?, ?, ?)
-	`, req.Username, req.Email, string(hashedPassword), req.Role, time.Now())
-
+	id, err := h.users.Create(ctx, req.input())
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to create user",
-		})
+		return serviceError(c, err, "User not found", "Failed to create user")
 	}
 
-	id, _ := result.LastInsertId()
-
-	return c.Status(201).JSON(fiber.Map{
-		"success": true,
-		"message": "User created successfully",
-		"data": fiber.Map{
-			"id": id,
-		},
+	return response.Created(c, "User created successfully", fiber.Map{
+		"id": id,
 	})
 }
 
 // UpdateUser - Update existing user
 func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
-	id := c.Params("id")
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	var req struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		Role     string `json:"role"`
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "User not found")
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
+	var req UserRequest
+	if ok, err := bind(c, &req); !ok {
+		return err
+	}
+	if req.Role == models.RoleAdmin && c.Locals("role") != models.RoleAdmin {
+		return response.Fail(c, fiber.StatusForbidden, "Only admins can grant the admin role")
+	}
+	if ok, err := h.checkTarget(c, ctx, id); !ok {
+		return err
 	}
 
-	// If password is provided, hash it
-	if req.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"success": false,
-				"message": "Failed to hash password",
-			})
-		}
-
-		_, err = h.db.Exec(`
-			UPDATE users 
-			SET username = ?, email = ?, password = ?, role = ?, updated_at = ?
-			WHERE id = ?
-		`, req.Username, req.Email, string(hashedPassword), req.Role, time.Now(), id)
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"success": false,
-				"message": "Failed to update user",
-			})
-		}
-	} else {
-		_, err := h.db.Exec(`
-			UPDATE users 
-			SET username = ?, email = ?, role = ?, updated_at = ?
-			WHERE id = ?
-		`, req.Username, req.Email, req.Role, time.Now(), id)
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"success": false,
-				"message": "Failed to update user",
-			})
-		}
+	if err := h.users.Update(ctx, id, req.input()); err != nil {
+		return serviceError(c, err, "User not found", "Failed to update user")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "User updated successfully",
-	})
+	return response.Message(c, "User updated successfully")
 }
 
 // DeleteUser - Delete user
 func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
-	id := c.Params("id")
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	// Prevent deleting the last admin
-	var adminCount int
-	err := h.db.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&adminCount)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to check admin count",
-		})
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "User not found")
 	}
 
-	var role string
-	err = h.db.QueryRow("SELECT role FROM users WHERE id = ?", id).Scan(&role)
-	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "User not found",
-		})
+	if ok, err := h.checkTarget(c, ctx, id); !ok {
+		return err
 	}
 
-	if role == "admin" && adminCount <= 1 {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Cannot delete the last admin user",
-		})
+	if err := h.users.Delete(ctx, id); err != nil {
+		return serviceError(c, err, "User not found", "Failed to delete user")
 	}
 
-	result, err := h.db.Exec("DELETE FROM users WHERE id = ?", id)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to delete user",
-		})
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "User not found",
-		})
-	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "User deleted successfully",
-	})
+	return response.Message(c, "User deleted successfully")
 }
 
 // ChangePassword - Change user password
 func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	var req struct {
-		OldPassword string `json:"old_password"`
-		NewPassword string `json:"new_password"`
-	}
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
-	}
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
 
-	if req.OldPassword == "" || req.NewPassword == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"success": false,
-			"message": "Old and new passwords are required",
-		})
+	id, ok := paramID(c)
+	if !ok {
+		return response.Fail(c, 404, "User not found")
 	}
 
-	// Get current password
-	var currentPassword string
-	err := h.db.QueryRow("SELECT password FROM users WHERE id = ?", id).Scan(&currentPassword)
-	if err == sql.ErrNoRows {
-		return c.Status(404).JSON(fiber.Map{
-			"success": false,
-			"message": "User not found",
-		})
+	var req struct {
+		OldPassword string `json:"old_password" validate:"required"`
+		NewPassword string `json:"new_password" validate:"required,max=72"`
 	}
 
-	// Verify old password
-	err = bcrypt.CompareHashAndPassword([]byte(currentPassword), []byte(req.OldPassword))
-	if err != nil {
-		return c.Status(401).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid old password",
-		})
+	if ok, err := bind(c, &req); !ok {
+		return err
 	}
 
-	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to hash password",
-		})
+	err := h.users.ChangePassword(ctx, id, req.OldPassword, req.NewPassword)
+	if errors.Is(err, service.ErrInvalidPassword) {
+		return response.Fail(c, 401, "Invalid old password")
 	}
-
-	_, err = h.db.Exec("UPDATE users SET password = ?, updated_at = ? WHERE id = ?",
-		string(hashedPassword), time.Now(), id)
-
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to update password",
-		})
+		return serviceError(c, err, "User not found", "Failed to update password")
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Password changed successfully",
-	})
+	return response.Message(c, "Password changed successfully")
 }
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"github.com/abcdefak87/cctv/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUserHandler_AdminTargets(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO users (id, username, email, password_hash, role) VALUES
+		(1, 'root', 'root@x.id', 'x', 'admin'), (2, 'backup', 'backup@x.id', 'x', 'admin'),
+		(3, 'lurah', 'lurah@x.id', 'x', 'org_admin'), (4, 'staff', 'staff@x.id', 'x', 'viewer')`)
+
+	h := NewUserHandler(service.NewUserService(repository.NewUserRepository(db)), &config.Config{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("role", c.Get("X-Role"))
+		return c.Next()
+	})
+	app.Put("/users/:id", h.UpdateUser)
+	app.Delete("/users/:id", h.DeleteUser)
+
+	do := func(method, path, role, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Role", role)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	demote := `{"username":"root","password":"taken-over","role":"viewer"}`
+	if status := do("PUT", "/users/1", "org_admin", demote); status != 403 {
+		t.Errorf("Expected an org admin refused changing an admin, got %d", status)
+	}
+	if status := do("DELETE", "/users/2", "org_admin", ""); status != 403 {
+		t.Errorf("Expected an org admin refused deleting an admin, got %d", status)
+	}
+	var role string
+	db.QueryRow(`SELECT role FROM users WHERE id = 1`).Scan(&role)
+	if role != "admin" {
+		t.Errorf("Expected the admin left alone, got role %q", role)
+	}
+
+	if status := do("PUT", "/users/4", "org_admin", `{"username":"staff","role":"operator"}`); status != 200 {
+		t.Errorf("Expected an org admin to change a viewer, got %d", status)
+	}
+	if status := do("DELETE", "/users/2", "admin", ""); status != 200 {
+		t.Errorf("Expected an admin to delete another admin, got %d", status)
+	}
+	if status := do("DELETE", "/users/9", "org_admin", ""); status != 404 {
+		t.Errorf("Expected 404 for a missing user, got %d", status)
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	// Zone data for ?tz, since the runtime image carries none
+	_ "time/tzdata"
+
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultHeatmapDays = 28
+	maxHeatmapDays     = 90
+
+	// defaultHeatmapZone matches the timezone setting
+	defaultHeatmapZone = "Asia/Jakarta"
+
+	// maxSessionSpan bounds how long one session counts as watched, so a
+	// player that never stopped does not fill the map
+	maxSessionSpan = 24 * time.Hour
+
+	// quietSlots is how many of the quietest hours a heat map lists
+	quietSlots = 5
+)
+
+// ViewerHeatmap is viewership by weekday and hour of the day, in
+// Timezone, over the sessions started from Since until Until
+type ViewerHeatmap struct {
+	Since    time.Time       `json:"since"`
+	Until    time.Time       `json:"until"`
+	Timezone string          `json:"timezone"`
+	Overall  Heatmap         `json:"overall"`
+	Cameras  []CameraHeatmap `json:"cameras"`
+}
+
+// CameraHeatmap is the heat map of one camera
+type CameraHeatmap struct {
+	CameraID int    `json:"camera_id"`
+	Name     string `json:"name"`
+	Heatmap
+}
+
+// Heatmap holds a cell for every hour of the week: Cells[0] is Sunday
+// and Cells[d][h] the hour starting at h o'clock. Quietest lists the
+// hours with the fewest viewers on average, for maintenance windows.
+type Heatmap struct {
+	Sessions int                `json:"sessions"`
+	Cells    [7][24]HeatmapCell `json:"cells"`
+	Quietest []HeatmapSlot      `json:"quietest"`
+}
+
+// HeatmapCell is one hour of the week. AvgViewers is the watched
+// minutes over the minutes that hour occurred in the range, the number
+// of viewers watching at an average moment of it.
+type HeatmapCell struct {
+	Sessions      int     `json:"sessions"` // started in the hour
+	ViewerMinutes float64 `json:"viewer_minutes"`
+	AvgViewers    float64 `json:"avg_viewers"`
+}
+
+// HeatmapSlot names one hour of the week
+type HeatmapSlot struct {
+	Weekday    int     `json:"weekday"` // 0 is Sunday
+	Hour       int     `json:"hour"`
+	AvgViewers float64 `json:"avg_viewers"`
+}
+
+// GetViewerHeatmap - Viewership by weekday and hour over the last
+// ?days=28 (at most 90) in the ?tz time zone (Asia/Jakarta by default),
+// overall and per camera, optionally for one ?camera_id=
+func (h *AdminHandler) GetViewerHeatmap(c *fiber.Ctx) error {
+	days := c.QueryInt("days", defaultHeatmapDays)
+	if days < 1 || days > maxHeatmapDays {
+		return invalidFields(c, "", map[string]string{"days": "must be between 1 and 90"})
+	}
+	loc, err := time.LoadLocation(c.Query("tz", defaultHeatmapZone))
+	if err != nil {
+		return invalidFields(c, "", map[string]string{"tz": "must be an IANA time zone such as Asia/Jakarta"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	// Whole days in the zone, so every hour of the week is counted alike
+	until := time.Now().In(loc)
+	y, m, d := until.Date()
+	since := time.Date(y, m, d-days+1, 0, 0, 0, 0, loc)
+
+	query := `
+		SELECT v.camera_id, c.name, v.started_at, v.ended_at, v.last_seen_at
+		FROM viewer_sessions v
+		JOIN cameras c ON c.id = v.camera_id
+		WHERE c.organization_id = ? AND v.started_at >= ?`
+	args := []interface{}{tenant.OrgID(ctx), since.UTC()}
+	if raw := c.Query("camera_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return response.Fail(c, 400, "Invalid camera_id")
+		}
+		query += " AND v.camera_id = ?"
+		args = append(args, id)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query+" ORDER BY v.camera_id", args...)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch viewer heat map")
+	}
+	defer rows.Close()
+
+	result := ViewerHeatmap{Since: since, Until: until, Timezone: loc.String(), Cameras: []CameraHeatmap{}}
+	for rows.Next() {
+		var cameraID int
+		var name string
+		var started time.Time
+		var ended, lastSeen sql.NullTime
+		if err := rows.Scan(&cameraID, &name, &started, &ended, &lastSeen); err != nil {
+			return serviceError(c, err, "", "Failed to fetch viewer heat map")
+		}
+		if n := len(result.Cameras); n == 0 || result.Cameras[n-1].CameraID != cameraID {
+			result.Cameras = append(result.Cameras, CameraHeatmap{CameraID: cameraID, Name: name})
+		}
+		camera := &result.Cameras[len(result.Cameras)-1].Heatmap
+
+		// An open session has been watched until its last heartbeat
+		end := started
+		if ended.Valid {
+			end = ended.Time
+		} else if lastSeen.Valid {
+			end = lastSeen.Time
+		}
+		end = minTime(minTime(end, started.Add(maxSessionSpan)), until)
+
+		for _, hm := range []*Heatmap{&result.Overall, camera} {
+			local := started.In(loc)
+			hm.Sessions++
+			hm.Cells[local.Weekday()][local.Hour()].Sessions++
+			spreadHours(started, end, loc, func(wd time.Weekday, hour int, minutes float64) {
+				hm.Cells[wd][hour].ViewerMinutes += minutes
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return serviceError(c, err, "", "Failed to fetch viewer heat map")
+	}
+
+	// Minutes each hour of the week occurred in the range
+	var span [7][24]float64
+	spreadHours(since, until, loc, func(wd time.Weekday, hour int, minutes float64) {
+		span[wd][hour] += minutes
+	})
+	result.Overall.finish(&span)
+	for i := range result.Cameras {
+		result.Cameras[i].finish(&span)
+	}
+	return response.OK(c, result)
+}
+
+// finish works out the average viewers and the quietest hours
+func (hm *Heatmap) finish(span *[7][24]float64) {
+	slots := []HeatmapSlot{}
+	for wd := range hm.Cells {
+		for hour := range hm.Cells[wd] {
+			cell := &hm.Cells[wd][hour]
+			cell.ViewerMinutes = math.Round(cell.ViewerMinutes*10) / 10
+			if span[wd][hour] == 0 {
+				continue
+			}
+			cell.AvgViewers = math.Round(cell.ViewerMinutes/span[wd][hour]*100) / 100
+			slots = append(slots, HeatmapSlot{Weekday: wd, Hour: hour, AvgViewers: cell.AvgViewers})
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].AvgViewers < slots[j].AvgViewers })
+	hm.Quietest = slots[:min(quietSlots, len(slots))]
+}
+
+// spreadHours calls fn with the minutes of from to to falling in each
+// local hour they cross
+func spreadHours(from, to time.Time, loc *time.Location, fn func(wd time.Weekday, hour int, minutes float64)) {
+	for t := from.In(loc); t.Before(to); {
+		next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		if !next.After(t) {
+			// The hour a clock change repeats
+			next = t.Truncate(time.Hour).Add(time.Hour)
+		}
+		next = minTime(next, to)
+		fn(t.Weekday(), t.Hour(), next.Sub(t).Minutes())
+		t = next.In(loc)
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
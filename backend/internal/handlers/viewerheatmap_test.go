@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestViewerHeatmap(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://a', 'gate'), (2, 'Market', 'rtsp://b', 'market')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (3, 'Elsewhere', 'rtsp://c', 'elsewhere', 2)`,
+	)
+
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+	y, m, d := time.Now().In(jakarta).Date()
+	yesterday := func(hour, minute int) time.Time {
+		return time.Date(y, m, d-1, hour, minute, 0, 0, jakarta).UTC()
+	}
+	for _, s := range []struct {
+		camera          int
+		id              string
+		started         time.Time
+		ended, lastSeen interface{}
+	}{
+		{1, "a", yesterday(10, 0), yesterday(11, 30), nil},
+		{1, "b", yesterday(10, 30), nil, yesterday(10, 50)},
+		{2, "c", yesterday(10, 15), yesterday(10, 45), nil},
+		{2, "d", yesterday(20, 0), nil, nil},
+		{3, "e", yesterday(10, 0), yesterday(12, 0), nil},
+		{1, "old", yesterday(10, 0).AddDate(0, 0, -40), yesterday(11, 0).AddDate(0, 0, -40), nil},
+	} {
+		if _, err := db.Exec(`INSERT INTO viewer_sessions (camera_id, session_id, started_at, ended_at, last_seen_at) VALUES (?, ?, ?, ?, ?)`,
+			s.camera, s.id, s.started, s.ended, s.lastSeen); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/admin/analytics/heatmap", NewAdminHandler(db, &config.Config{}, nil).GetViewerHeatmap)
+
+	get := func(query string) (int, ViewerHeatmap) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/admin/analytics/heatmap"+query, nil)
+		req.Header.Set("X-Org", "1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		raw, _ := json.Marshal(env.Data)
+		var hm ViewerHeatmap
+		json.Unmarshal(raw, &hm)
+		return resp.StatusCode, hm
+	}
+
+	status, hm := get("?days=7")
+	if status != 200 || hm.Timezone != "Asia/Jakarta" || hm.Overall.Sessions != 4 || len(hm.Cameras) != 2 {
+		t.Fatalf("Heat map = %d, %+v", status, hm)
+	}
+	wd := time.Date(y, m, d-1, 0, 0, 0, 0, jakarta).Weekday()
+	ten, eleven := hm.Overall.Cells[wd][10], hm.Overall.Cells[wd][11]
+	// Gate: 60 + 20 minutes, Market: 30; the last 30 of Gate's first session fall after 11:00
+	if ten.Sessions != 3 || ten.ViewerMinutes != 110 || eleven.ViewerMinutes != 30 || eleven.Sessions != 0 {
+		t.Errorf("10:00 = %+v, 11:00 = %+v", ten, eleven)
+	}
+	// That hour occurred once in the last 7 days
+	if ten.AvgViewers != 1.83 {
+		t.Errorf("Average viewers at 10:00 = %v, want 1.83", ten.AvgViewers)
+	}
+	if hm.Overall.Cells[wd][20].Sessions != 1 || hm.Overall.Cells[wd][20].ViewerMinutes != 0 {
+		t.Errorf("A session without heartbeats = %+v", hm.Overall.Cells[wd][20])
+	}
+	if q := hm.Overall.Quietest; len(q) != 5 || q[0].AvgViewers != 0 {
+		t.Errorf("Quietest = %+v", q)
+	}
+	if gate := hm.Cameras[0]; gate.Name != "Gate" || gate.Sessions != 2 || gate.Cells[wd][10].ViewerMinutes != 80 {
+		t.Errorf("Gate = %+v", gate.Cells[wd][10])
+	}
+
+	if _, hm := get("?days=7&camera_id=2&tz=UTC"); hm.Overall.Sessions != 2 || len(hm.Cameras) != 1 ||
+		hm.Overall.Cells[time.Date(y, m, d-1, 10, 15, 0, 0, jakarta).UTC().Weekday()][3].Sessions != 1 {
+		t.Errorf("Market in UTC = %+v", hm.Overall)
+	}
+	if status, _ := get("?tz=Mars/Olympus"); status != 422 {
+		t.Errorf("Unknown time zone = %d, want 422", status)
+	}
+	if status, _ := get("?days=91"); status != 422 {
+		t.Errorf("91 days = %d, want 422", status)
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxReferrers is how many referring sites GetViewerSources lists
+const maxReferrers = 20
+
+// audience names whether a session of viewer_sessions v was watched by
+// a logged-in user
+const audience = "CASE WHEN v.user_id IS NULL THEN 'public' ELSE 'staff' END"
+
+// ViewingRequest is the optional body of a viewer session start. An
+// embedded player reports its embedding page as referrer, since the
+// Referer header of its requests names the embed page itself. ViewerID
+// is an ID the player generates and keeps, such as a UUID in local
+// storage; a player that falls back to another transport sends it again
+// to carry on its session.
+type ViewingRequest struct {
+	Referrer  string `json:"referrer" validate:"max=2048"`
+	Transport string `json:"transport" validate:"oneof=hls mse webrtc"`
+	ViewerID  string `json:"viewer_id" validate:"max=64"`
+}
+
+// ViewerSources breaks the viewer sessions started since Since down by
+// the site the player was on, by transport, and into staff watching
+// while logged in and the public
+type ViewerSources struct {
+	Since      time.Time      `json:"since"`
+	Sessions   int            `json:"sessions"`
+	Referrers  []ViewerSource `json:"referrers"`
+	Transports []ViewerSource `json:"transports"`
+	Audiences  []ViewerSource `json:"audiences"` // staff and public
+}
+
+// ViewerSource is one referring host or transport. Name is empty for
+// sessions whose player did not say, such as direct visits and older
+// players.
+type ViewerSource struct {
+	Name     string  `json:"name"`
+	Sessions int     `json:"sessions"`
+	Viewers  int     `json:"viewers"` // distinct viewers; see viewerKey
+	Percent  float64 `json:"percent"` // of all sessions
+}
+
+// viewerKey is the SQL expression telling the viewers of viewer_sessions
+// aliased as alias apart for unique viewer counts: the viewer ID the
+// player generated, else its session token. A player that loses its
+// token when it falls back to another transport is still one viewer.
+func viewerKey(alias string) string {
+	if alias != "" {
+		alias += "."
+	}
+	return "COALESCE(NULLIF(" + alias + "viewer_id, ''), " + alias + "session_id)"
+}
+
+// referrerHost is the host of the page a player is on: the referrer it
+// reported, else the Referer header. Paths are dropped so the sessions
+// of one site group together and no page URLs are kept.
+func referrerHost(reported, header string) string {
+	raw := reported
+	if raw == "" {
+		raw = header
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	// Copied, since header points into the request buffer
+	return strings.ToLower(strings.Clone(u.Hostname()))
+}
+
+// GetViewerSources - Which sites viewers watch from, which transport
+// their players use and how many are staff, over the last ?days=7 (at most 90), optionally for
+// one ?camera_id=
+func (h *AdminHandler) GetViewerSources(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 7)
+	if days < 1 || days > 90 {
+		return invalidFields(c, "", map[string]string{"days": "must be between 1 and 90"})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	where := " WHERE c.organization_id = ? AND v.started_at >= ?"
+	args := []interface{}{tenant.OrgID(ctx), since}
+	if raw := c.Query("camera_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return response.Fail(c, 400, "Invalid camera_id")
+		}
+		where += " AND v.camera_id = ?"
+		args = append(args, id)
+	}
+
+	sources := ViewerSources{Since: since}
+	var err error
+	if sources.Transports, err = h.viewerSources(ctx, "v.transport", where, args, 0); err != nil {
+		return serviceError(c, err, "", "Failed to fetch viewer sources")
+	}
+	if sources.Referrers, err = h.viewerSources(ctx, "v.referrer_host", where, args, maxReferrers); err != nil {
+		return serviceError(c, err, "", "Failed to fetch viewer sources")
+	}
+	if sources.Audiences, err = h.viewerSources(ctx, audience, where, args, 0); err != nil {
+		return serviceError(c, err, "", "Failed to fetch viewer sources")
+	}
+
+	// Every session has one transport, so they add up to the total
+	for _, t := range sources.Transports {
+		sources.Sessions += t.Sessions
+	}
+	for _, list := range [][]ViewerSource{sources.Transports, sources.Referrers, sources.Audiences} {
+		for i := range list {
+			list[i].Percent = math.Round(float64(list[i].Sessions)*1000/float64(sources.Sessions)) / 10
+		}
+	}
+
+	return response.OK(c, sources)
+}
+
+// viewerSources counts the sessions matching where by column, most
+// sessions first; limit of zero lists every value
+func (h *AdminHandler) viewerSources(ctx context.Context, column, where string, args []interface{}, limit int) ([]ViewerSource, error) {
+	query := `
+		SELECT ` + column + `, COUNT(*), COUNT(DISTINCT ` + viewerKey("v") + `)
+		FROM viewer_sessions v
+		JOIN cameras c ON c.id = v.camera_id` + where + `
+		GROUP BY ` + column + `
+		ORDER BY COUNT(*) DESC, ` + column + ` ASC`
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []ViewerSource{}
+	for rows.Next() {
+		var s ViewerSource
+		if err := rows.Scan(&s.Name, &s.Sessions, &s.Viewers); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
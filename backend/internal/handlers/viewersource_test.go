@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/internal/viewers"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestReferrerHost(t *testing.T) {
+	for _, tc := range []struct{ reported, header, want string }{
+		{"https://News.Example/live/gate?x=1", "https://cctv.example/embed/gate", "news.example"},
+		{"", "https://cctv.example:8443/embed/gate", "cctv.example"},
+		{"", "", ""},
+		{"not a url", "", ""},
+	} {
+		if got := referrerHost(tc.reported, tc.header); got != tc.want {
+			t.Errorf("referrerHost(%q, %q) = %q, want %q", tc.reported, tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestViewerSources(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://a', 'gate'), (2, 'Market', 'rtsp://b', 'market')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, organization_id) VALUES (3, 'Elsewhere', 'rtsp://c', 'elsewhere', 2)`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (5, 'operator', 'x', 'operator')`,
+	)
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	recorder := viewers.New(db, config.ViewersConfig{FlushInterval: time.Hour})
+	st := NewStreamHandler(db, cfg, nil, recorder, context.Background())
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Post("/stream/:streamKey/start", st.StartViewing)
+	app.Get("/admin/analytics/sources", NewAdminHandler(db, cfg, nil).GetViewerSources)
+
+	operator, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.JWTClaims{
+		UserID:           5,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString([]byte(cfg.JWT.Secret))
+
+	start := func(streamKey, referer, body string) int {
+		req := httptest.NewRequest("POST", "/stream/"+streamKey+"/start", strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if referer != "" {
+			req.Header.Set("Referer", referer)
+		}
+		// The control room watches the market while logged in
+		if streamKey == "market" && body == "" {
+			req.Header.Set("Authorization", "Bearer "+operator)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, s := range []struct{ key, session, referer, body string }{
+		{"gate", "a", "", `{"referrer":"https://news.example/live","transport":"hls"}`},
+		{"gate", "b", "", `{"referrer":"https://news.example/other","transport":"hls"}`},
+		{"market", "c", "https://cctv.example/", `{"transport":"webrtc"}`},
+		{"market", "d", "", ""},
+		{"elsewhere", "e", "", `{"referrer":"https://news.example/","transport":"mse"}`},
+	} {
+		if status := start(s.key, s.referer, s.body); status != 200 {
+			t.Fatalf("Expected status 200 for session %s, got %d", s.session, status)
+		}
+	}
+	if status := start("gate", "", `{"transport":"rtmp"}`); status != 422 {
+		t.Errorf("Expected status 422 for an unknown transport, got %d", status)
+	}
+	recorder.Flush(context.Background())
+
+	get := func(query string, org int) ViewerSources {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/admin/analytics/sources"+query, nil)
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		raw, _ := json.Marshal(env.Data)
+		var sources ViewerSources
+		json.Unmarshal(raw, &sources)
+		return sources
+	}
+
+	got := get("", 1)
+	if got.Sessions != 4 {
+		t.Fatalf("Expected the organization's 4 sessions, got %+v", got)
+	}
+	if r := got.Referrers; len(r) != 3 || r[0].Name != "news.example" || r[0].Sessions != 2 || r[0].Percent != 50 {
+		t.Errorf("Expected news.example first with half the sessions, got %+v", r)
+	}
+	if tr := got.Transports; len(tr) != 3 || tr[0].Name != "hls" || tr[0].Viewers != 2 {
+		t.Errorf("Expected HLS first from two viewers, got %+v", tr)
+	}
+	if a := got.Audiences; len(a) != 2 || a[0].Name != "public" || a[0].Sessions != 3 || a[1].Name != "staff" || a[1].Percent != 25 {
+		t.Errorf("Expected one staff session in four, got %+v", a)
+	}
+
+	got = get("?camera_id=2", 1)
+	if got.Sessions != 2 || got.Referrers[0].Name != "" || got.Referrers[1].Name != "cctv.example" {
+		t.Errorf("Expected the market's direct and cctv.example sessions, got %+v", got)
+	}
+	if got := get("", 2); got.Sessions != 1 || got.Transports[0].Name != "mse" {
+		t.Errorf("Expected only the other organization's session, got %+v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// viewerCookie keeps a browser's viewer token, so the cameras it watches
+// and its visits within viewerTokenTTL count as one viewer. Players that
+// cannot rely on the cookie send the token back in X-Session-ID.
+const viewerCookie = "viewer_session"
+
+const viewerTokenTTL = 24 * time.Hour
+
+// newViewerToken returns an opaque token for a new viewer: a random ID
+// and its HMAC-SHA256 under secret
+func newViewerToken(secret string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(id)
+	return encoded + "." + viewerTokenSignature(secret, encoded), nil
+}
+
+func viewerTokenSignature(secret, id string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("viewer\n" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// viewerToken returns the token the client sent in X-Session-ID or its
+// cookie, or "" when it sent none this server issued. Clients behind one
+// address are told apart by their tokens, and cannot make up their own.
+func viewerToken(c *fiber.Ctx, secret string) string {
+	for _, token := range []string{c.Get("X-Session-ID"), c.Cookies(viewerCookie)} {
+		id, sig, ok := strings.Cut(token, ".")
+		if ok && hmac.Equal([]byte(sig), []byte(viewerTokenSignature(secret, id))) {
+			return utils.CopyString(token)
+		}
+	}
+	return ""
+}
+
+// setViewerCookie keeps token for viewerTokenTTL from now
+func setViewerCookie(c *fiber.Ctx, token string, secure bool) {
+	c.Cookie(&fiber.Cookie{
+		Name:     viewerCookie,
+		Value:    token,
+		Path:     "/api/stream",
+		HTTPOnly: true,
+		Secure:   secure,
+		SameSite: "Lax",
+		MaxAge:   int(viewerTokenTTL.Seconds()),
+	})
+}
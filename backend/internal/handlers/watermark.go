@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// companyName is the organization's company name from its branding, or
+// the default when it has not set one
+func companyName(ctx context.Context, db *sql.DB, orgID int) string {
+	name := ""
+	for _, d := range brandingDefaults {
+		if d.key == "company_name" {
+			name = d.value
+		}
+	}
+
+	var value string
+	err := db.QueryRowContext(ctx, `
+		SELECT value FROM settings WHERE organization_id = ? AND key = 'company_name'
+	`, orgID).Scan(&value)
+	if err != nil {
+		return name
+	}
+	// Settings are stored as JSON, though older rows hold bare strings
+	if json.Unmarshal([]byte(value), &name) != nil {
+		name = value
+	}
+	return name
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStreamHandler_Watermark(t *testing.T) {
+	useMemoryCache(t)
+	db := dbtest.Open(t)
+	seedDB(t, db, `INSERT INTO cameras (name, private_rtsp_url, stream_key, watermark) VALUES
+		('Gate', 'rtsp://a', 'gate', TRUE), ('Market', 'rtsp://b', 'market', FALSE)`)
+	db.Exec(`DELETE FROM settings WHERE key = 'company_name'`)
+	seedDB(t, db, `INSERT INTO settings (key, value, organization_id) VALUES ('company_name', '"Desa Dander"', 1)`)
+
+	var mu sync.Mutex
+	var registered, played []string
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/streams":
+			registered = append(registered, r.URL.Query().Get("src"))
+		case "/api/stream.mp4":
+			played = append(played, r.URL.Query().Get("src"))
+		}
+	}))
+	defer go2rtc.Close()
+
+	cfg := &config.Config{Go2RTC: config.Go2RTCConfig{APIURL: go2rtc.URL, BreakerFailures: 100}}
+	app := fiber.New()
+	app.Get("/mse/:streamKey", NewStreamHandler(db, cfg, nil, nil, context.Background()).ProxyMSE)
+
+	for _, key := range []string{"gate", "market", "gate"} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/mse/"+key, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Errorf("Expected status 200 for %s, got %d", key, resp.StatusCode)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(played) != 3 || played[0] != "gate_watermarked" || played[1] != "market" {
+		t.Errorf("Expected the watermarked copy for gate only, got %q", played)
+	}
+	if len(registered) != 1 {
+		t.Fatalf("Expected the watermarked stream registered once, got %q", registered)
+	}
+	if want := "text='Desa Dander  %{localtime"; !strings.Contains(registered[0], want) {
+		t.Errorf("Expected the company name in %q", registered[0])
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/weather"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+type WeatherHandler struct {
+	db    *sql.DB
+	cfg   *config.Config
+	cache *weather.Cache // nil when no WEATHER_API_KEY is set
+}
+
+func NewWeatherHandler(db *sql.DB, cfg *config.Config) *WeatherHandler {
+	h := &WeatherHandler{db: db, cfg: cfg}
+	if cfg.Weather.APIKey != "" {
+		h.cache = weather.NewCache(&weather.OpenWeatherMap{URL: cfg.Weather.URL, APIKey: cfg.Weather.APIKey}, cfg.Weather.CacheTTL)
+	}
+	return h
+}
+
+// GetWeather - Current weather at the map center and each area, for the
+// public map overlay. Without a weather API key it reports enabled false.
+func (h *WeatherHandler) GetWeather(c *fiber.Ctx) error {
+	if h.cache == nil {
+		return response.OK(c, weather.Report{Locations: []weather.Location{}})
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+
+	locations, err := weather.Locations(ctx, h.db)
+	if err != nil {
+		return serviceError(c, err, "", "Failed to fetch weather")
+	}
+	weather.Fill(c.UserContext(), h.cache, locations, h.cfg.Weather.MaxLocations)
+
+	c.Set("Cache-Control", "public, max-age=60")
+	return response.OK(c, weather.Report{Enabled: true, Locations: locations})
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// widgetCacheTTL is how long a camera's viewer count is served before it
+// is counted again. Widgets sit on partner pages with their own traffic,
+// so every request must not reach the database.
+const widgetCacheTTL = 30 * time.Second
+
+// maxBadgeLabel is the longest camera name shown on a badge, in runes
+const maxBadgeLabel = 24
+
+type WidgetHandler struct {
+	db  *sql.DB
+	cfg *config.Config
+
+	mu    sync.Mutex
+	cache map[widgetKey]cachedViewerCount
+	now   func() time.Time
+}
+
+type widgetKey struct{ orgID, cameraID int }
+
+type cachedViewerCount struct {
+	count   models.ViewerCount
+	counted time.Time
+}
+
+func NewWidgetHandler(db *sql.DB, cfg *config.Config) *WidgetHandler {
+	return &WidgetHandler{db: db, cfg: cfg, cache: map[widgetKey]cachedViewerCount{}, now: time.Now}
+}
+
+// GetViewerCount - Current viewers and online status of ?camera=, for
+// embedding on other sites (public)
+func (h *WidgetHandler) GetViewerCount(c *fiber.Ctx) error {
+	count, status, message := h.viewerCount(c)
+	if status != 0 {
+		return response.Fail(c, status, message)
+	}
+	return response.OK(c, count)
+}
+
+// GetViewerCountBadge - The same as an SVG badge (public)
+func (h *WidgetHandler) GetViewerCountBadge(c *fiber.Ctx) error {
+	count, status, message := h.viewerCount(c)
+	if status != 0 {
+		return response.Fail(c, status, message)
+	}
+	c.Set(fiber.HeaderContentType, "image/svg+xml")
+	return c.SendString(viewerCountBadge(count))
+}
+
+// viewerCount looks up the camera in ?camera=, at most once per
+// widgetCacheTTL, and sets Cache-Control to match. It returns a non-zero
+// status when it cannot.
+func (h *WidgetHandler) viewerCount(c *fiber.Ctx) (models.ViewerCount, int, string) {
+	id, err := strconv.Atoi(c.Query("camera"))
+	if err != nil || id <= 0 {
+		return models.ViewerCount{}, 400, "Invalid camera, expected ?camera=<id>"
+	}
+
+	ctx, cancel := dbContext(c, h.cfg)
+	defer cancel()
+	key := widgetKey{orgID: tenant.OrgID(ctx), cameraID: id}
+
+	h.mu.Lock()
+	cached, ok := h.cache[key]
+	h.mu.Unlock()
+	now := h.now()
+	if ok && now.Sub(cached.counted) < widgetCacheTTL {
+		h.setCacheControl(c, now.Sub(cached.counted))
+		return cached.count, 0, ""
+	}
+
+	count := models.ViewerCount{CameraID: id}
+	var health sql.NullString
+	err = h.db.QueryRowContext(ctx, `
+		SELECT c.name, h.status,
+		       (SELECT COUNT(DISTINCT `+viewerKey("v")+`) FROM viewer_sessions v
+		        WHERE v.camera_id = c.id AND v.ended_at IS NULL)
+		FROM cameras c
+		LEFT JOIN camera_health h ON h.camera_id = c.id
+		WHERE c.id = ? AND c.enabled = TRUE AND c.organization_id = ?
+	`, id, key.orgID).Scan(&count.Name, &health, &count.Viewers)
+	if errors.Is(err, sql.ErrNoRows) {
+		return count, 404, "Camera not found"
+	}
+	if err != nil {
+		logger.FromContext(c.UserContext()).Error("Failed to fetch viewer count", "error", err)
+		return count, 500, "Failed to fetch viewer count"
+	}
+	count.Online = health.String != "offline"
+
+	h.mu.Lock()
+	for k, e := range h.cache {
+		if now.Sub(e.counted) >= widgetCacheTTL {
+			delete(h.cache, k)
+		}
+	}
+	h.cache[key] = cachedViewerCount{count: count, counted: now}
+	h.mu.Unlock()
+
+	h.setCacheControl(c, 0)
+	return count, 0, ""
+}
+
+// setCacheControl lets browsers and proxies keep the response until the
+// cached count, age old, expires
+func (h *WidgetHandler) setCacheControl(c *fiber.Ctx, age time.Duration) {
+	left := widgetCacheTTL - age
+	if left < 0 {
+		left = 0
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(int(left.Seconds())))
+}
+
+// viewerCountBadge draws count as a two-part badge: the camera name, and
+// the viewers on green or "offline" on grey
+func viewerCountBadge(count models.ViewerCount) string {
+	label := count.Name
+	if utf8.RuneCountInString(label) > maxBadgeLabel {
+		label = string([]rune(label)[:maxBadgeLabel-1]) + "…"
+	}
+	value, colour := "offline", "#9f9f9f"
+	if count.Online {
+		value, colour = fmt.Sprintf("%d watching", count.Viewers), "#4c1"
+	}
+
+	// Verdana 11px averages about 7px per character
+	labelWidth := 10 + 7*utf8.RuneCountInString(label)
+	valueWidth := 10 + 7*utf8.RuneCountInString(value)
+	width := labelWidth + valueWidth
+	label, value = html.EscapeString(label), html.EscapeString(value)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">`+
+		`<title>%[4]s: %[5]s</title>`+
+		`<rect width="%[2]d" height="20" rx="3" fill="#555"/>`+
+		`<rect x="%[2]d" width="%[3]d" height="20" rx="3" fill="%[6]s"/>`+
+		`<g fill="#fff" font-family="Verdana,DejaVu Sans,sans-serif" font-size="11" text-anchor="middle">`+
+		`<text x="%[7]d" y="14">%[4]s</text>`+
+		`<text x="%[8]d" y="14">%[5]s</text>`+
+		`</g></svg>`,
+		width, labelWidth, valueWidth, label, value, colour, labelWidth/2, labelWidth+valueWidth/2)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestViewerCountWidget(t *testing.T) {
+	db := dbtest.Open(t)
+	seedDB(t, db,
+		otherOrg,
+		`INSERT INTO cameras (id, name, private_rtsp_url, enabled) VALUES
+			(1, 'Gate', 'rtsp://a', TRUE), (2, 'Market <North>', 'rtsp://b', TRUE), (3, 'Spare', 'rtsp://c', FALSE)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, organization_id) VALUES (4, 'Elsewhere', 'rtsp://d', 2)`,
+		`INSERT INTO camera_health (camera_id, status) VALUES (1, 'online'), (2, 'offline')`,
+		`INSERT INTO viewer_sessions (camera_id, session_id) VALUES (1, 'a'), (1, 'b')`,
+		`INSERT INTO viewer_sessions (camera_id, session_id, ended_at) VALUES (1, 'c', CURRENT_TIMESTAMP)`,
+	)
+
+	h := NewWidgetHandler(db, &config.Config{})
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-Org")); err == nil {
+			c.SetUserContext(tenant.WithOrg(c.UserContext(), id))
+		}
+		return c.Next()
+	})
+	app.Get("/widgets/viewer-count", h.GetViewerCount)
+	app.Get("/widgets/viewer-count.svg", h.GetViewerCountBadge)
+
+	request := func(path string, org int) (*http.Response, []byte) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Org", strconv.Itoa(org))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+	count := func(data []byte) models.ViewerCount {
+		var env struct {
+			Data models.ViewerCount `json:"data"`
+		}
+		json.Unmarshal(data, &env)
+		return env.Data
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		resp, data := request("/widgets/viewer-count?camera=1", 1)
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		if got := count(data); got.Viewers != 2 || !got.Online || got.Name != "Gate" {
+			t.Errorf("Expected Gate online with 2 viewers, got %+v", got)
+		}
+		if h := resp.Header.Get("Cache-Control"); h != "public, max-age=30" {
+			t.Errorf("Expected a 30 second max-age, got '%s'", h)
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		db.Exec(`INSERT INTO viewer_sessions (camera_id, session_id) VALUES (1, 'd')`)
+		now = now.Add(10 * time.Second)
+		resp, data := request("/widgets/viewer-count?camera=1", 1)
+		if got := count(data); got.Viewers != 2 {
+			t.Errorf("Expected the cached count, got %d", got.Viewers)
+		}
+		if h := resp.Header.Get("Cache-Control"); h != "public, max-age=20" {
+			t.Errorf("Expected the rest of the TTL as max-age, got '%s'", h)
+		}
+
+		now = now.Add(widgetCacheTTL)
+		_, data = request("/widgets/viewer-count?camera=1", 1)
+		if got := count(data); got.Viewers != 3 {
+			t.Errorf("Expected a fresh count once the TTL passed, got %d", got.Viewers)
+		}
+	})
+
+	t.Run("Badge", func(t *testing.T) {
+		resp, data := request("/widgets/viewer-count.svg?camera=2", 1)
+		svg := string(data)
+		if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "image/svg+xml" {
+			t.Fatalf("Expected an SVG, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		if !strings.Contains(svg, "Market &lt;North&gt;") || !strings.Contains(svg, "offline") {
+			t.Errorf("Expected an escaped name and offline, got %s", svg)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		for _, tc := range []struct {
+			path   string
+			status int
+		}{
+			{"/widgets/viewer-count", 400},
+			{"/widgets/viewer-count?camera=abc", 400},
+			{"/widgets/viewer-count?camera=3", 404}, // disabled
+			{"/widgets/viewer-count?camera=4", 404}, // another organization
+			{"/widgets/viewer-count.svg?camera=9", 404},
+		} {
+			if resp, _ := request(tc.path, 1); resp.StatusCode != tc.status {
+				t.Errorf("Expected status %d for %s, got %d", tc.status, tc.path, resp.StatusCode)
+			}
+		}
+	})
+}
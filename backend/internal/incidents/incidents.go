@@ -0,0 +1,273 @@
+// Package incidents records problems with the camera network that
+// admins work through: an incident is opened by hand or from an alert,
+// acknowledged and resolved, lists the cameras it affects and keeps a
+// timeline of updates. Alerts raised on an affected camera while an
+// incident is unresolved are added to its timeline. Published incidents
+// and their public updates appear on the public status page.
+package incidents
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Statuses, in the order an incident usually goes through them
+const (
+	StatusOpen         = "open"
+	StatusAcknowledged = "acknowledged"
+	StatusResolved     = "resolved"
+)
+
+// Severities
+const (
+	SeverityMinor    = "minor"
+	SeverityMajor    = "major"
+	SeverityCritical = "critical"
+)
+
+// Kinds of timeline update
+const (
+	KindNote   = "note"
+	KindStatus = "status"
+	KindAlert  = "alert"
+)
+
+// RecentlyResolved is how long a resolved incident stays on the status
+// page
+const RecentlyResolved = 7 * 24 * time.Hour
+
+// dbTimeout bounds the queries of an alert handler
+const dbTimeout = 5 * time.Second
+
+// Incident is an incident as admins see it. DetectionID is the alert it
+// was opened from.
+type Incident struct {
+	ID             int64      `json:"id"`
+	Title          string     `json:"title"`
+	Status         string     `json:"status"`
+	Severity       string     `json:"severity"`
+	Published      bool       `json:"published"`
+	DetectionID    *int64     `json:"detection_id"`
+	CreatedBy      *int       `json:"created_by"`
+	CameraIDs      []int      `json:"camera_ids"`
+	OpenedAt       time.Time  `json:"opened_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Updates        []Update   `json:"updates,omitempty"` // oldest first
+}
+
+// Update is one timeline entry. Status is the new status of a status
+// update; DetectionID the detection behind an alert.
+type Update struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"`
+	Status      string    `json:"status,omitempty"`
+	Body        string    `json:"body"`
+	Public      bool      `json:"public"`
+	UserID      *int      `json:"user_id"`
+	DetectionID *int64    `json:"detection_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PublicIncident is a published incident as the status page shows it:
+// camera names instead of IDs and only the public updates
+type PublicIncident struct {
+	ID         int64          `json:"id"`
+	Title      string         `json:"title"`
+	Status     string         `json:"status"`
+	Severity   string         `json:"severity"`
+	Cameras    []string       `json:"cameras"`
+	OpenedAt   time.Time      `json:"opened_at"`
+	ResolvedAt *time.Time     `json:"resolved_at"`
+	Updates    []PublicUpdate `json:"updates"` // newest first
+}
+
+// PublicUpdate is a public timeline entry
+type PublicUpdate struct {
+	Status    string    `json:"status,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// transitions are the status changes allowed from each status. A
+// resolved incident can be reopened.
+var transitions = map[string][]string{
+	StatusOpen:         {StatusAcknowledged, StatusResolved},
+	StatusAcknowledged: {StatusResolved},
+	StatusResolved:     {StatusOpen},
+}
+
+// CanTransition reports whether an incident may go from one status to
+// another
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Execer is a *sql.DB or *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// AddUpdate appends u to the timeline of incident id and sets u.ID; a
+// zero CreatedAt is now
+func AddUpdate(ctx context.Context, db Execer, id int64, u *Update) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	u.CreatedAt = u.CreatedAt.UTC()
+	return db.QueryRowContext(ctx, `
+		INSERT INTO incident_updates (incident_id, kind, status, body, public, user_id, detection_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, id, u.Kind, u.Status, u.Body, u.Public, u.UserID, u.DetectionID, u.CreatedAt).Scan(&u.ID)
+}
+
+// OnAlert returns an events.Handler that adds a private alert update to
+// every unresolved incident affecting the alert's camera. Subscribe it
+// to events.DetectionAlert.
+func OnAlert(db *sql.DB) events.Handler {
+	return func(e events.Event) {
+		cameraID, ok := e.Data["camera_id"].(int)
+		if !ok {
+			return
+		}
+		var detectionID *int64
+		if id, ok := e.Data["detection_id"].(int64); ok {
+			detectionID = &id
+		}
+		body := fmt.Sprintf("%v detected", e.Data["label"])
+		if rule, ok := e.Data["rule"].(string); ok && rule != "" {
+			body = rule + ": " + body
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+		defer cancel()
+
+		rows, err := db.QueryContext(ctx, `
+			SELECT i.id FROM incidents i
+			JOIN incident_cameras ic ON ic.incident_id = i.id
+			WHERE ic.camera_id = ? AND i.status <> ?
+		`, cameraID, StatusResolved)
+		if err != nil {
+			logger.Error("Failed to find incidents for alert", "camera_id", cameraID, "error", err)
+			return
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if rows.Scan(&id) == nil {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+
+		for _, id := range ids {
+			u := &Update{Kind: KindAlert, Body: body, DetectionID: detectionID, CreatedAt: e.Time}
+			if err := AddUpdate(ctx, db, id, u); err != nil {
+				logger.Error("Failed to add alert to incident", "incident_id", id, "error", err)
+			}
+		}
+	}
+}
+
+// Published returns the published incidents of the organization in ctx
+// that are unresolved or were resolved within RecentlyResolved, newest
+// first
+func Published(ctx context.Context, db *sql.DB, now time.Time) ([]PublicIncident, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, title, status, severity, opened_at, resolved_at
+		FROM incidents
+		WHERE organization_id = ? AND published = TRUE AND (resolved_at IS NULL OR resolved_at >= ?)
+		ORDER BY opened_at DESC, id DESC
+	`, tenant.OrgID(ctx), now.Add(-RecentlyResolved).UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	list := []PublicIncident{}
+	byID := map[int64]*PublicIncident{}
+	for rows.Next() {
+		i := PublicIncident{Cameras: []string{}, Updates: []PublicUpdate{}}
+		var resolved sql.NullTime
+		if err := rows.Scan(&i.ID, &i.Title, &i.Status, &i.Severity, &i.OpenedAt, &resolved); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if resolved.Valid {
+			i.ResolvedAt = &resolved.Time
+		}
+		list = append(list, i)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	ids := make([]interface{}, len(list))
+	for n := range list {
+		byID[list[n].ID] = &list[n]
+		ids[n] = list[n].ID
+	}
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT ic.incident_id, c.name FROM incident_cameras ic
+		JOIN cameras c ON c.id = ic.camera_id
+		WHERE ic.incident_id IN (`+in+`) AND c.enabled = TRUE
+		ORDER BY c.name ASC
+	`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byID[id].Cameras = append(byID[id].Cameras, name)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT incident_id, status, body, created_at FROM incident_updates
+		WHERE incident_id IN (`+in+`) AND public = TRUE
+		ORDER BY created_at DESC, id DESC
+	`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var u PublicUpdate
+		if err := rows.Scan(&id, &u.Status, &u.Body, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		byID[id].Updates = append(byID[id].Updates, u)
+	}
+	return list, rows.Err()
+}
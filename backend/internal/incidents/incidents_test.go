@@ -0,0 +1,84 @@
+package incidents
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/events"
+)
+
+func TestCanTransition(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusOpen, StatusAcknowledged, true},
+		{StatusOpen, StatusResolved, true},
+		{StatusAcknowledged, StatusResolved, true},
+		{StatusResolved, StatusOpen, true},
+		{StatusAcknowledged, StatusOpen, false},
+		{StatusResolved, StatusAcknowledged, false},
+		{StatusOpen, StatusOpen, false},
+	} {
+		if got := CanTransition(tc.from, tc.to); got != tc.want {
+			t.Errorf("Expected %s to %s to be %v, got %v", tc.from, tc.to, tc.want, got)
+		}
+	}
+}
+
+func TestIncidents(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, seed := range []struct {
+		stmt string
+		args []interface{}
+	}{
+		{`INSERT INTO cameras (id, name, private_rtsp_url) VALUES (1, 'Gate', 'rtsp://a'), (2, 'Market', 'rtsp://b')`, nil},
+		{`INSERT INTO incidents (id, title, status, published, opened_at, resolved_at, updated_at) VALUES
+			(1, 'Gate camera vandalised', 'open', TRUE, ?, NULL, ?),
+			(2, 'Old outage', 'resolved', TRUE, ?, ?, ?),
+			(3, 'Internal check', 'open', FALSE, ?, NULL, ?)`,
+			[]interface{}{now, now, now.AddDate(0, 0, -30), now.AddDate(0, 0, -20), now, now, now}},
+		{`INSERT INTO incident_cameras (incident_id, camera_id) VALUES (1, 1), (2, 2), (3, 1)`, nil},
+	} {
+		if _, err := db.Exec(seed.stmt, seed.args...); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	t.Run("Alert", func(t *testing.T) {
+		OnAlert(db)(events.Event{Type: events.DetectionAlert, Time: now, Data: map[string]interface{}{
+			"rule": "Night watch", "camera_id": 1, "label": "person",
+		}})
+
+		var count int
+		var body string
+		db.QueryRow(`SELECT COUNT(*), MAX(body) FROM incident_updates WHERE kind = 'alert'`).Scan(&count, &body)
+		if count != 2 || body != "Night watch: person detected" {
+			t.Errorf("Expected the alert on both open incidents of the camera, got %d %q", count, body)
+		}
+	})
+
+	t.Run("Published", func(t *testing.T) {
+		AddUpdate(ctx, db, 1, &Update{Kind: KindNote, Body: "Technician on the way", Public: true})
+		AddUpdate(ctx, db, 1, &Update{Kind: KindNote, Body: "Suspect seen on camera 2"})
+
+		list, err := Published(ctx, db, now)
+		if err != nil {
+			t.Fatalf("Published failed: %v", err)
+		}
+		if len(list) != 1 || list[0].Title != "Gate camera vandalised" {
+			t.Fatalf("Expected only the ongoing published incident, got %+v", list)
+		}
+		if len(list[0].Cameras) != 1 || list[0].Cameras[0] != "Gate" {
+			t.Errorf("Expected the gate camera, got %v", list[0].Cameras)
+		}
+		if len(list[0].Updates) != 1 || list[0].Updates[0].Body != "Technician on the way" {
+			t.Errorf("Expected only the public note, got %+v", list[0].Updates)
+		}
+	})
+}
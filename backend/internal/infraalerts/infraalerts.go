@@ -0,0 +1,254 @@
+// Package infraalerts keeps the alerts a Prometheus Alertmanager posts
+// about the hosts and services around the cameras, such as a node down
+// or disk pressure, so admins see them next to the camera alerts.
+// Alertmanager names an alert by the fingerprint of its labels and
+// sends it again on every group or repeat interval; each time it fires
+// is one row, updated until it is resolved.
+package infraalerts
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Statuses, as Alertmanager sends them
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Retention is how long a resolved alert is kept
+const Retention = 90 * 24 * time.Hour
+
+// Payload is the body of an Alertmanager webhook (version 4). Only
+// Alerts is used; the group fields are for reference.
+type Payload struct {
+	Version     string         `json:"version"`
+	GroupKey    string         `json:"groupKey"`
+	Status      string         `json:"status"`
+	Receiver    string         `json:"receiver"`
+	ExternalURL string         `json:"externalURL"`
+	Alerts      []PayloadAlert `json:"alerts"`
+}
+
+// PayloadAlert is one alert of a webhook. EndsAt is the zero time, or
+// a time in the future, while it fires.
+type PayloadAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Problems returns what is wrong with the alert by field; nil when
+// nothing is
+func (a PayloadAlert) Problems() map[string]string {
+	problems := map[string]string{}
+	if a.Status != StatusFiring && a.Status != StatusResolved {
+		problems["status"] = "must be firing or resolved"
+	}
+	if a.Labels["alertname"] == "" {
+		problems["labels"] = "must have an alertname"
+	}
+	if a.StartsAt.IsZero() {
+		problems["startsAt"] = "is required"
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// fingerprint is the alert's own, or a hash of its labels for senders
+// that leave it out
+func (a PayloadAlert) fingerprint() string {
+	if a.Fingerprint != "" {
+		return a.Fingerprint
+	}
+	names := make([]string, 0, len(a.Labels))
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name + "\xff" + a.Labels[name] + "\xff"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Alert is an infrastructure alert as admins see it. Severity and
+// Instance come from the labels of the same name, Summary and
+// Description from the annotations.
+type Alert struct {
+	ID           int64             `json:"id"`
+	Fingerprint  string            `json:"fingerprint"`
+	Name         string            `json:"name"`
+	Status       string            `json:"status"`
+	Severity     string            `json:"severity"`
+	Instance     string            `json:"instance"`
+	Summary      string            `json:"summary"`
+	Description  string            `json:"description"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	GeneratorURL string            `json:"generator_url"`
+	StartsAt     time.Time         `json:"starts_at"`
+	EndsAt       *time.Time        `json:"ends_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// Receive stores the alerts of a webhook and returns those that changed
+// status: alerts seen firing for the first time, and firing alerts now
+// resolved. An alert first seen resolved is stored but not returned.
+// Resolved alerts past Retention are removed.
+func Receive(ctx context.Context, db *sql.DB, p Payload, now time.Time) ([]Alert, error) {
+	now = now.UTC()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var changed []Alert
+	for _, pa := range p.Alerts {
+		a, change, err := upsert(ctx, tx, pa, now)
+		if err != nil {
+			return nil, err
+		}
+		if change {
+			changed = append(changed, a)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM infra_alerts WHERE status = ? AND ends_at < ?
+	`, StatusResolved, now.Add(-Retention)); err != nil {
+		return nil, err
+	}
+	return changed, tx.Commit()
+}
+
+func upsert(ctx context.Context, tx *sql.Tx, pa PayloadAlert, now time.Time) (Alert, bool, error) {
+	a := Alert{
+		Fingerprint:  pa.fingerprint(),
+		Name:         pa.Labels["alertname"],
+		Status:       pa.Status,
+		Severity:     pa.Labels["severity"],
+		Instance:     pa.Labels["instance"],
+		Summary:      pa.Annotations["summary"],
+		Description:  pa.Annotations["description"],
+		Labels:       pa.Labels,
+		Annotations:  pa.Annotations,
+		GeneratorURL: pa.GeneratorURL,
+		StartsAt:     pa.StartsAt.UTC(),
+		UpdatedAt:    now,
+	}
+	if a.Annotations == nil {
+		a.Annotations = map[string]string{}
+	}
+	if a.Status == StatusResolved {
+		ended := pa.EndsAt.UTC()
+		if pa.EndsAt.IsZero() || ended.After(now) {
+			ended = now
+		}
+		a.EndsAt = &ended
+	}
+	labels, err := json.Marshal(a.Labels)
+	if err != nil {
+		return a, false, err
+	}
+	annotations, err := json.Marshal(a.Annotations)
+	if err != nil {
+		return a, false, err
+	}
+
+	if a.Status == StatusFiring {
+		// An alert only fires again once it ended, so an older time it
+		// fired whose resolve was missed is over
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE infra_alerts SET status = ?, ends_at = ?, updated_at = ?
+			WHERE fingerprint = ? AND status = ? AND starts_at < ?
+		`, StatusResolved, a.StartsAt, now, a.Fingerprint, StatusFiring, a.StartsAt); err != nil {
+			return a, false, err
+		}
+	}
+
+	var was string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, status FROM infra_alerts WHERE fingerprint = ? AND starts_at = ?
+	`, a.Fingerprint, a.StartsAt).Scan(&a.ID, &was)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO infra_alerts (fingerprint, name, status, severity, instance, summary, description,
+				labels, annotations, generator_url, starts_at, ends_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, a.Fingerprint, a.Name, a.Status, a.Severity, a.Instance, a.Summary, a.Description,
+			string(labels), string(annotations), a.GeneratorURL, a.StartsAt, a.EndsAt, now).Scan(&a.ID)
+		return a, err == nil && a.Status == StatusFiring, err
+	}
+	if err != nil {
+		return a, false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE infra_alerts SET name = ?, status = ?, severity = ?, instance = ?, summary = ?, description = ?,
+			labels = ?, annotations = ?, generator_url = ?, ends_at = ?, updated_at = ?
+		WHERE id = ?
+	`, a.Name, a.Status, a.Severity, a.Instance, a.Summary, a.Description,
+		string(labels), string(annotations), a.GeneratorURL, a.EndsAt, now, a.ID)
+	return a, err == nil && was != a.Status, err
+}
+
+// List returns the infrastructure alerts, firing ones first and then
+// the newest: only those with status when it is not empty, at most
+// limit
+func List(ctx context.Context, db *sql.DB, status string, limit int) ([]Alert, error) {
+	where, args := "", []interface{}{}
+	if status != "" {
+		where = `WHERE status = ?`
+		args = append(args, status)
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, fingerprint, name, status, severity, instance, summary, description,
+			labels, annotations, generator_url, starts_at, ends_at, updated_at
+		FROM infra_alerts `+where+`
+		ORDER BY status = ? DESC, starts_at DESC, id DESC
+		LIMIT ?
+	`, append(args, StatusFiring, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Alert{}
+	for rows.Next() {
+		var a Alert
+		var labels, annotations string
+		var ended sql.NullTime
+		if err := rows.Scan(&a.ID, &a.Fingerprint, &a.Name, &a.Status, &a.Severity, &a.Instance, &a.Summary,
+			&a.Description, &labels, &annotations, &a.GeneratorURL, &a.StartsAt, &ended, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if ended.Valid {
+			a.EndsAt = &ended.Time
+		}
+		if json.Unmarshal([]byte(labels), &a.Labels) != nil || a.Labels == nil {
+			a.Labels = map[string]string{}
+		}
+		if json.Unmarshal([]byte(annotations), &a.Annotations) != nil || a.Annotations == nil {
+			a.Annotations = map[string]string{}
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
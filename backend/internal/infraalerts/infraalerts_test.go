@@ -0,0 +1,65 @@
+package infraalerts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestReceive(t *testing.T) {
+	db := dbtest.Open(t)
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	alert := func(status string, startsAt time.Time) PayloadAlert {
+		return PayloadAlert{
+			Status:   status,
+			Labels:   map[string]string{"alertname": "NodeDown", "instance": "nvr-01:9100"},
+			StartsAt: startsAt,
+		}
+	}
+	receive := func(alerts ...PayloadAlert) []Alert {
+		t.Helper()
+		changed, err := Receive(ctx, db, Payload{Alerts: alerts}, now)
+		if err != nil {
+			t.Fatalf("Receive failed: %v", err)
+		}
+		return changed
+	}
+
+	first := now.Add(-time.Hour)
+	if changed := receive(alert(StatusFiring, first)); len(changed) != 1 || changed[0].Status != StatusFiring {
+		t.Errorf("Expected the new alert firing, got %+v", changed)
+	}
+	if changed := receive(alert(StatusFiring, first)); len(changed) != 0 {
+		t.Errorf("Expected nothing new on a repeat, got %+v", changed)
+	}
+
+	// It fires again without its resolve having come
+	again := now.Add(-10 * time.Minute)
+	if changed := receive(alert(StatusFiring, again)); len(changed) != 1 {
+		t.Errorf("Expected the alert firing again, got %+v", changed)
+	}
+	list, err := List(ctx, db, StatusResolved, 10)
+	if err != nil || len(list) != 1 || !list[0].StartsAt.Equal(first) || list[0].EndsAt == nil || !list[0].EndsAt.Equal(again) {
+		t.Errorf("Expected the first time it fired ended when it fired again, got %+v, %v", list, err)
+	}
+
+	if changed := receive(alert(StatusResolved, again)); len(changed) != 1 || changed[0].EndsAt == nil || !changed[0].EndsAt.Equal(now) {
+		t.Errorf("Expected the alert resolved now, got %+v", changed)
+	}
+	if changed := receive(alert(StatusResolved, now.Add(-5*time.Minute))); len(changed) != 0 {
+		t.Errorf("Expected no change for an alert first seen resolved, got %+v", changed)
+	}
+
+	old := now.Add(-Retention - 24*time.Hour)
+	if _, err := db.Exec(`UPDATE infra_alerts SET ends_at = ? WHERE starts_at = ?`, old, first); err != nil {
+		t.Fatalf("Failed to age the alert: %v", err)
+	}
+	receive()
+	if list, _ := List(ctx, db, "", 10); len(list) != 2 {
+		t.Errorf("Expected the old resolved alert pruned, got %+v", list)
+	}
+}
@@ -0,0 +1,438 @@
+// Package jobs runs background work (health probes, thumbnails, webhook
+// delivery, exports) on a bounded pool of workers. Jobs are stored in
+// the jobs table, so pending work survives a restart; failures are
+// retried with exponential backoff.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Priorities; higher runs first
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// Job states
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusFailed  = "failed"
+)
+
+const (
+	defaultWorkers     = 4
+	defaultMaxAttempts = 5
+	defaultPoll        = 2 * time.Second
+)
+
+var (
+	// retryBase and retryCap bound the backoff between attempts
+	retryBase = 10 * time.Second
+	retryCap  = 15 * time.Minute
+
+	// dbTimeout bounds each queue query
+	dbTimeout = 5 * time.Second
+)
+
+// Handler runs one job. ctx is cancelled when the server shuts down; a
+// job interrupted that way is run again later without counting the
+// attempt.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying; the job fails at once
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	return errors.As(err, new(permanentError))
+}
+
+// Job is a queued job as listed by Status
+type Job struct {
+	ID          int64     `json:"id"`
+	Type        string    `json:"type"`
+	Priority    int       `json:"priority"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	RunAt       time.Time `json:"run_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Options tune a Queue; zero values use the defaults
+type Options struct {
+	Workers      int
+	PollInterval time.Duration
+
+	// Instance names this server when several share the queue. Each
+	// claimed job records it, and a restart only requeues the jobs of
+	// its own instance. Empty, a restart requeues every running job.
+	Instance string
+}
+
+// EnqueueOptions tune one job; zero values use the defaults
+type EnqueueOptions struct {
+	Priority    int
+	MaxAttempts int
+	Delay       time.Duration
+}
+
+// Queue stores jobs in the database and runs them on Workers goroutines
+type Queue struct {
+	db       *sql.DB
+	workers  int
+	poll     time.Duration
+	instance string
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	// wake nudges an idle worker when a job is enqueued
+	wake chan struct{}
+	busy int32
+}
+
+func New(db *sql.DB, opts Options) *Queue {
+	if opts.Workers <= 0 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPoll
+	}
+	return &Queue{
+		db:       db,
+		workers:  opts.Workers,
+		poll:     opts.PollInterval,
+		instance: opts.Instance,
+		handlers: map[string]Handler{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register sets the handler for a job type. Register every type before
+// Run so jobs left over from the last run find their handler.
+func (q *Queue) Register(jobType string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = h
+}
+
+// Enqueue stores a job; payload is marshalled to JSON
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts EnqueueOptions) (int64, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s payload: %w", jobType, err)
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+
+	now := time.Now().UTC()
+	var id int64
+	err = q.db.QueryRowContext(ctx, `
+		INSERT INTO jobs (type, payload, priority, status, max_attempts, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, jobType, string(body), opts.Priority, StatusPending, opts.MaxAttempts, now.Add(opts.Delay), now, now).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue %s: %w", jobType, err)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// Run works the queue until ctx is cancelled, then waits for running
+// jobs to return. Start it with shutdown.Coordinator.Go.
+func (q *Queue) Run(ctx context.Context) {
+	if err := q.requeueInterrupted(); err != nil {
+		logger.Error("Failed to requeue interrupted jobs", "error", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.claim()
+		if err != nil {
+			logger.Warn("Failed to claim job", "error", err)
+		}
+		if job != nil {
+			q.execute(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-time.After(q.poll):
+		}
+	}
+}
+
+type claimed struct {
+	id          int64
+	jobType     string
+	payload     string
+	attempts    int
+	maxAttempts int
+}
+
+// claim takes the most urgent due job, or returns nil when none is due.
+// The status guard on the UPDATE keeps two workers from taking the same
+// job.
+func (q *Queue) claim() (*claimed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	for tries := 0; tries < 3; tries++ {
+		var job claimed
+		err := q.db.QueryRowContext(ctx, `
+			SELECT id, type, payload, attempts, max_attempts FROM jobs
+			WHERE status = ? AND run_at <= ?
+			ORDER BY priority DESC, run_at, id
+			LIMIT 1
+		`, StatusPending, time.Now().UTC()).Scan(&job.id, &job.jobType, &job.payload, &job.attempts, &job.maxAttempts)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := q.db.ExecContext(ctx, `
+			UPDATE jobs SET status = ?, attempts = attempts + 1, claimed_by = ?, updated_at = ?
+			WHERE id = ? AND status = ?
+		`, StatusRunning, q.instance, time.Now().UTC(), job.id, StatusPending)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			job.attempts++
+			return &job, nil
+		}
+		// Another worker won the race; look again
+	}
+	return nil, nil
+}
+
+func (q *Queue) execute(ctx context.Context, job *claimed) {
+	atomic.AddInt32(&q.busy, 1)
+	defer atomic.AddInt32(&q.busy, -1)
+
+	start := time.Now()
+	err := q.handle(ctx, job)
+	log := logger.L().With("job_id", job.id, "job_type", job.jobType, "attempt", job.attempts)
+
+	switch {
+	case err == nil:
+		log.Debug("Job finished", "duration_ms", time.Since(start).Milliseconds())
+		q.finish(job.id)
+	case ctx.Err() != nil:
+		log.Info("Job interrupted by shutdown, will run again")
+		q.release(job.id)
+	case job.attempts >= job.maxAttempts || IsPermanent(err):
+		log.Error("Job failed", "error", err)
+		q.fail(job.id, err)
+	default:
+		delay := backoff(job.attempts)
+		log.Warn("Job failed, retrying", "error", err, "retry_in", delay.String())
+		q.retry(job.id, err, delay)
+	}
+}
+
+// handle runs the job's handler, turning a panic into an error
+func (q *Queue) handle(ctx context.Context, job *claimed) (err error) {
+	q.mu.RLock()
+	h, ok := q.handlers[job.jobType]
+	q.mu.RUnlock()
+	if !ok {
+		return Permanent(fmt.Errorf("no handler registered for %s", job.jobType))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, json.RawMessage(job.payload))
+}
+
+// backoff doubles the wait after each failed attempt, up to retryCap
+func backoff(attempt int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempt && delay < retryCap; i++ {
+		delay *= 2
+	}
+	if delay > retryCap {
+		delay = retryCap
+	}
+	return delay
+}
+
+// The state updates below run after the job, possibly during shutdown,
+// so they use their own context rather than the cancelled run context.
+
+func (q *Queue) update(query string, args ...interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	if _, err := q.db.ExecContext(ctx, query, args...); err != nil {
+		logger.Error("Failed to update job", "error", err)
+	}
+}
+
+func (q *Queue) finish(id int64) {
+	q.update(`DELETE FROM jobs WHERE id = ?`, id)
+}
+
+func (q *Queue) release(id int64) {
+	q.update(`UPDATE jobs SET status = ?, attempts = attempts - 1, updated_at = ? WHERE id = ?`,
+		StatusPending, time.Now().UTC(), id)
+}
+
+func (q *Queue) fail(id int64, err error) {
+	q.update(`UPDATE jobs SET status = ?, last_error = ?, updated_at = ? WHERE id = ?`,
+		StatusFailed, err.Error(), time.Now().UTC(), id)
+}
+
+func (q *Queue) retry(id int64, err error, delay time.Duration) {
+	now := time.Now().UTC()
+	q.update(`UPDATE jobs SET status = ?, last_error = ?, run_at = ?, updated_at = ? WHERE id = ?`,
+		StatusPending, err.Error(), now.Add(delay), now, id)
+}
+
+// requeueInterrupted returns jobs left running by a crash to the queue.
+// Their attempt stays counted, so a job that kills the process cannot
+// loop forever.
+func (q *Queue) requeueInterrupted() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE jobs SET status = ?, claimed_by = '', updated_at = ? WHERE status = ?`
+	args := []interface{}{StatusPending, time.Now().UTC(), StatusRunning}
+	if q.instance != "" {
+		query += ` AND claimed_by = ?`
+		args = append(args, q.instance)
+	}
+	result, err := q.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		logger.Info("Requeued interrupted jobs", "count", n)
+	}
+	return nil
+}
+
+// RequeueAbandoned returns the running jobs of instances not in alive to
+// the queue, as for an instance that died without restarting. It is a
+// cluster.Sweeper.
+func (q *Queue) RequeueAbandoned(ctx context.Context, alive []string) error {
+	query := `UPDATE jobs SET status = ?, claimed_by = '', updated_at = ? WHERE status = ?`
+	args := []interface{}{StatusPending, time.Now().UTC(), StatusRunning}
+	if len(alive) > 0 {
+		query += ` AND claimed_by NOT IN (?` + strings.Repeat(", ?", len(alive)-1) + `)`
+		for _, id := range alive {
+			args = append(args, id)
+		}
+	}
+	result, err := q.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		logger.Warn("Requeued jobs of stopped instances", "count", n)
+	}
+	return nil
+}
+
+// Snapshot is the queue state served by /api/admin/jobs/queue
+type Snapshot struct {
+	Workers int            `json:"workers"`
+	Busy    int            `json:"busy"`
+	Counts  map[string]int `json:"counts"`
+	Jobs    []Job          `json:"jobs"`
+}
+
+// statusLimit caps the jobs listed by Status
+const statusLimit = 50
+
+// Status reports the worker pool and the queued jobs, most urgent first
+func (q *Queue) Status(ctx context.Context) (*Snapshot, error) {
+	snap := &Snapshot{
+		Workers: q.workers,
+		Busy:    int(atomic.LoadInt32(&q.busy)),
+		Counts:  map[string]int{StatusPending: 0, StatusRunning: 0, StatusFailed: 0},
+		Jobs:    []Job{},
+	}
+
+	rows, err := q.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		snap.Counts[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.db.QueryContext(ctx, `
+		SELECT id, type, priority, status, attempts, max_attempts, last_error, run_at, created_at
+		FROM jobs
+		ORDER BY CASE status WHEN 'running' THEN 0 WHEN 'pending' THEN 1 ELSE 2 END, priority DESC, run_at, id
+		LIMIT ?
+	`, statusLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var job Job
+		if err := rows.Scan(&job.ID, &job.Type, &job.Priority, &job.Status, &job.Attempts,
+			&job.MaxAttempts, &job.LastError, &job.RunAt, &job.CreatedAt); err != nil {
+			return nil, err
+		}
+		snap.Jobs = append(snap.Jobs, job)
+	}
+	return snap, rows.Err()
+}
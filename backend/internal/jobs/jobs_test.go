@@ -0,0 +1,343 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+// start runs q until the test ends
+func start(t *testing.T, q *Queue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func jobStatus(t *testing.T, db *sql.DB, id int64) (status string, attempts int, lastError string) {
+	t.Helper()
+	err := db.QueryRow(`SELECT status, attempts, last_error FROM jobs WHERE id = ?`, id).Scan(&status, &attempts, &lastError)
+	if err == sql.ErrNoRows {
+		return "", 0, ""
+	}
+	if err != nil {
+		t.Fatalf("Failed to read job %d: %v", id, err)
+	}
+	return status, attempts, lastError
+}
+
+func TestQueue(t *testing.T) {
+	oldBase := retryBase
+	retryBase = 10 * time.Millisecond
+	t.Cleanup(func() { retryBase = oldBase })
+
+	ctx := context.Background()
+
+	t.Run("Runs by priority", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 1, PollInterval: 10 * time.Millisecond})
+
+		var mu sync.Mutex
+		var order []string
+		q.Register("probe", func(ctx context.Context, payload json.RawMessage) error {
+			var name string
+			json.Unmarshal(payload, &name)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		})
+
+		q.Enqueue(ctx, "probe", "low", EnqueueOptions{Priority: PriorityLow})
+		q.Enqueue(ctx, "probe", "normal", EnqueueOptions{})
+		q.Enqueue(ctx, "probe", "high", EnqueueOptions{Priority: PriorityHigh})
+		start(t, q)
+
+		waitFor(t, "all jobs", func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(order) == 3
+		})
+		if order[0] != "high" || order[1] != "normal" || order[2] != "low" {
+			t.Errorf("Expected high, normal, low, got %v", order)
+		}
+
+		var remaining int
+		db.QueryRow(`SELECT COUNT(*) FROM jobs`).Scan(&remaining)
+		if remaining != 0 {
+			t.Errorf("Expected finished jobs to be deleted, got %d left", remaining)
+		}
+	})
+
+	t.Run("Bounded concurrency", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 2, PollInterval: 10 * time.Millisecond})
+
+		var mu sync.Mutex
+		running, peak, done := 0, 0, 0
+		q.Register("thumbnail", func(ctx context.Context, payload json.RawMessage) error {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			done++
+			mu.Unlock()
+			return nil
+		})
+
+		for i := 0; i < 6; i++ {
+			q.Enqueue(ctx, "thumbnail", i, EnqueueOptions{})
+		}
+		start(t, q)
+
+		waitFor(t, "all jobs", func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return done == 6
+		})
+		if peak > 2 {
+			t.Errorf("Expected at most 2 jobs at once, got %d", peak)
+		}
+	})
+
+	t.Run("Retries then succeeds", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 1, PollInterval: 5 * time.Millisecond})
+
+		var mu sync.Mutex
+		calls := 0
+		q.Register("webhook", func(ctx context.Context, payload json.RawMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			if calls < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		})
+
+		id, err := q.Enqueue(ctx, "webhook", nil, EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+		start(t, q)
+
+		waitFor(t, "job to finish", func() bool {
+			status, _, _ := jobStatus(t, db, id)
+			return status == ""
+		})
+		if calls != 3 {
+			t.Errorf("Expected 3 attempts, got %d", calls)
+		}
+	})
+
+	t.Run("Fails after max attempts", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 1, PollInterval: 5 * time.Millisecond})
+		q.Register("export", func(ctx context.Context, payload json.RawMessage) error {
+			return errors.New("disk full")
+		})
+
+		id, _ := q.Enqueue(ctx, "export", nil, EnqueueOptions{MaxAttempts: 2})
+		start(t, q)
+
+		waitFor(t, "job to fail", func() bool {
+			status, _, _ := jobStatus(t, db, id)
+			return status == StatusFailed
+		})
+		if _, attempts, lastError := jobStatus(t, db, id); attempts != 2 || lastError != "disk full" {
+			t.Errorf("Expected 2 attempts ending in 'disk full', got %d and '%s'", attempts, lastError)
+		}
+	})
+
+	t.Run("Permanent errors and unknown types fail at once", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 1, PollInterval: 5 * time.Millisecond})
+		q.Register("export", func(ctx context.Context, payload json.RawMessage) error {
+			return Permanent(errors.New("camera deleted"))
+		})
+
+		permanent, _ := q.Enqueue(ctx, "export", nil, EnqueueOptions{})
+		unknown, _ := q.Enqueue(ctx, "nope", nil, EnqueueOptions{})
+		start(t, q)
+
+		for _, id := range []int64{permanent, unknown} {
+			waitFor(t, "job to fail", func() bool {
+				status, _, _ := jobStatus(t, db, id)
+				return status == StatusFailed
+			})
+			if _, attempts, _ := jobStatus(t, db, id); attempts != 1 {
+				t.Errorf("Expected job %d to fail after 1 attempt, got %d", id, attempts)
+			}
+		}
+	})
+
+	t.Run("Panics are caught", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 1, PollInterval: 5 * time.Millisecond})
+		q.Register("probe", func(ctx context.Context, payload json.RawMessage) error {
+			panic("boom")
+		})
+
+		id, _ := q.Enqueue(ctx, "probe", nil, EnqueueOptions{MaxAttempts: 1})
+		start(t, q)
+
+		waitFor(t, "job to fail", func() bool {
+			status, _, _ := jobStatus(t, db, id)
+			return status == StatusFailed
+		})
+		if _, _, lastError := jobStatus(t, db, id); lastError != "panic: boom" {
+			t.Errorf("Expected 'panic: boom', got '%s'", lastError)
+		}
+	})
+
+	t.Run("Pending jobs survive a restart", func(t *testing.T) {
+		db := dbtest.Open(t)
+
+		// A job left running by a crash and one not yet started
+		first := New(db, Options{Workers: 1})
+		crashed, _ := first.Enqueue(ctx, "probe", nil, EnqueueOptions{})
+		waiting, _ := first.Enqueue(ctx, "probe", nil, EnqueueOptions{})
+		db.Exec(`UPDATE jobs SET status = ?, attempts = 1 WHERE id = ?`, StatusRunning, crashed)
+
+		ran := make(chan struct{}, 2)
+		second := New(db, Options{Workers: 1, PollInterval: 5 * time.Millisecond})
+		second.Register("probe", func(ctx context.Context, payload json.RawMessage) error {
+			ran <- struct{}{}
+			return nil
+		})
+		start(t, second)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-ran:
+			case <-time.After(time.Second):
+				t.Fatalf("Expected both jobs to run after restart, got %d", i)
+			}
+		}
+		waitFor(t, "jobs to finish", func() bool {
+			a, _, _ := jobStatus(t, db, crashed)
+			b, _, _ := jobStatus(t, db, waiting)
+			return a == "" && b == ""
+		})
+	})
+
+	t.Run("Instances requeue only their own jobs", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 1, Instance: "web-1"})
+		mine, _ := q.Enqueue(ctx, "probe", nil, EnqueueOptions{})
+		peer, _ := q.Enqueue(ctx, "probe", nil, EnqueueOptions{})
+		dead, _ := q.Enqueue(ctx, "probe", nil, EnqueueOptions{})
+		for id, instance := range map[int64]string{mine: "web-1", peer: "web-2", dead: "web-3"} {
+			db.Exec(`UPDATE jobs SET status = ?, claimed_by = ? WHERE id = ?`, StatusRunning, instance, id)
+		}
+
+		if err := q.requeueInterrupted(); err != nil {
+			t.Fatalf("Requeue failed: %v", err)
+		}
+		if status, _, _ := jobStatus(t, db, mine); status != StatusPending {
+			t.Errorf("Expected the restarted instance's job pending, got %s", status)
+		}
+		if status, _, _ := jobStatus(t, db, peer); status != StatusRunning {
+			t.Errorf("Expected another instance's job left running, got %s", status)
+		}
+
+		if err := q.RequeueAbandoned(ctx, []string{"web-1", "web-2"}); err != nil {
+			t.Fatalf("RequeueAbandoned failed: %v", err)
+		}
+		if status, _, _ := jobStatus(t, db, peer); status != StatusRunning {
+			t.Errorf("Expected a live instance's job left running, got %s", status)
+		}
+		if status, _, _ := jobStatus(t, db, dead); status != StatusPending {
+			t.Errorf("Expected a stopped instance's job pending, got %s", status)
+		}
+	})
+
+	t.Run("Shutdown releases the running job", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 1, PollInterval: 5 * time.Millisecond})
+
+		started := make(chan struct{})
+		q.Register("export", func(ctx context.Context, payload json.RawMessage) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		id, _ := q.Enqueue(ctx, "export", nil, EnqueueOptions{})
+
+		runCtx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			q.Run(runCtx)
+			close(done)
+		}()
+		<-started
+		cancel()
+		<-done
+
+		if status, attempts, _ := jobStatus(t, db, id); status != StatusPending || attempts != 0 {
+			t.Errorf("Expected pending with no attempts counted, got %s and %d", status, attempts)
+		}
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		db := dbtest.Open(t)
+		q := New(db, Options{Workers: 3})
+		q.Enqueue(ctx, "probe", nil, EnqueueOptions{})
+		q.Enqueue(ctx, "export", nil, EnqueueOptions{Priority: PriorityHigh})
+
+		snap, err := q.Status(ctx)
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		if snap.Workers != 3 || snap.Counts[StatusPending] != 2 || snap.Counts[StatusFailed] != 0 {
+			t.Errorf("Expected 3 workers and 2 pending, got %+v", snap)
+		}
+		if len(snap.Jobs) != 2 || snap.Jobs[0].Type != "export" {
+			t.Errorf("Expected the high priority job first, got %+v", snap.Jobs)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, retryBase}, {2, 2 * retryBase}, {4, 8 * retryBase}, {20, retryCap},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d): expected %v, got %v", tt.attempt, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+// Package logretention keeps the audit and activity logs from growing
+// without bound. Admins set a retention for each log type under
+// /api/admin/log-retention; Store.Run deletes rows older than it every
+// hour, first writing them to a gzipped JSON Lines file in the archive
+// directory when the type is set to be archived.
+//
+// Access logs are not covered: they keep ACCESS_LOG_RETENTION_DAYS.
+package logretention
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Types are the log tables a retention can be set for
+var Types = []string{"activity_logs", "audit_logs"}
+
+const (
+	pruneInterval = time.Hour
+
+	// batchSize rows are archived and deleted at a time, so a large
+	// backlog does not hold a write lock for long
+	batchSize = 1000
+)
+
+// ErrUnknownType is returned for a log type not in Types
+var ErrUnknownType = errors.New("unknown log type")
+
+// Policy is the retention of one log type and the outcome of its latest
+// prune
+type Policy struct {
+	Type          string     `json:"type"`
+	RetentionDays int        `json:"retention_days"` // 0 keeps the logs forever
+	Archive       bool       `json:"archive"`        // write rows to a file before deleting them
+	LastRunAt     *time.Time `json:"last_run_at"`
+	LastDeleted   int64      `json:"last_deleted"`
+	LastArchive   string     `json:"last_archive"` // file name of the latest archive
+}
+
+// Status is a policy with the volume of its log
+type Status struct {
+	Policy
+	Rows         int        `json:"rows"`
+	Oldest       *time.Time `json:"oldest"`
+	Pending      int        `json:"pending"` // rows past the retention the next prune deletes
+	ArchiveFiles int        `json:"archive_files"`
+	ArchiveBytes int64      `json:"archive_bytes"`
+}
+
+// Store reads and changes the policies and applies them
+type Store struct {
+	db  *sql.DB
+	dir string
+	now func() time.Time
+}
+
+// New returns a store writing archives to dir
+func New(db *sql.DB, dir string) *Store {
+	return &Store{db: db, dir: dir, now: time.Now}
+}
+
+// Policies returns the policy of every log type; types never set keep
+// their logs forever
+func (s *Store) Policies(ctx context.Context) ([]Policy, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT log_type, retention_days, archive, last_run_at, last_deleted, last_archive FROM log_retention
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	set := map[string]Policy{}
+	for rows.Next() {
+		var p Policy
+		var lastRun sql.NullTime
+		if err := rows.Scan(&p.Type, &p.RetentionDays, &p.Archive, &lastRun, &p.LastDeleted, &p.LastArchive); err != nil {
+			return nil, err
+		}
+		if lastRun.Valid {
+			p.LastRunAt = &lastRun.Time
+		}
+		set[p.Type] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	policies := make([]Policy, 0, len(Types))
+	for _, t := range Types {
+		p, ok := set[t]
+		if !ok {
+			p = Policy{Type: t}
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// Set changes the retention and archiving of p.Type and returns the
+// policy as stored
+func (s *Store) Set(ctx context.Context, p Policy) (Policy, error) {
+	if !known(p.Type) {
+		return Policy{}, ErrUnknownType
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO log_retention (log_type, retention_days, archive, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (log_type) DO UPDATE SET retention_days = excluded.retention_days,
+			archive = excluded.archive, updated_at = excluded.updated_at
+	`, p.Type, p.RetentionDays, p.Archive, s.now().UTC())
+	if err != nil {
+		return Policy{}, err
+	}
+
+	policies, err := s.Policies(ctx)
+	if err != nil {
+		return Policy{}, err
+	}
+	for _, stored := range policies {
+		if stored.Type == p.Type {
+			return stored, nil
+		}
+	}
+	return p, nil
+}
+
+// Status returns every policy with the size of its log, its oldest row,
+// the rows the next prune deletes and the archives written so far
+func (s *Store) Status(ctx context.Context) ([]Status, error) {
+	policies, err := s.Policies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+
+	list := make([]Status, 0, len(policies))
+	for _, p := range policies {
+		st := Status{Policy: p}
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+p.Type).Scan(&st.Rows); err != nil {
+			return nil, err
+		}
+		// Not MIN(created_at), which SQLite returns as text
+		var oldest time.Time
+		err := s.db.QueryRowContext(ctx, `SELECT created_at FROM `+p.Type+` WHERE created_at IS NOT NULL ORDER BY created_at ASC LIMIT 1`).Scan(&oldest)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			st.Oldest = &oldest
+		}
+		if p.RetentionDays > 0 {
+			err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+p.Type+` WHERE created_at < ?`,
+				now.AddDate(0, 0, -p.RetentionDays)).Scan(&st.Pending)
+			if err != nil {
+				return nil, err
+			}
+		}
+		st.ArchiveFiles, st.ArchiveBytes = s.archives(p.Type)
+		list = append(list, st)
+	}
+	return list, nil
+}
+
+// archives counts the archive files of logType and their size
+func (s *Store) archives(logType string) (files int, size int64) {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, logType+"-*.jsonl.gz"))
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil {
+			files++
+			size += info.Size()
+		}
+	}
+	return files, size
+}
+
+// Run prunes every hour until ctx is cancelled. Run it on one instance
+// only; see cluster.Node.Lead.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Prune(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to prune logs", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune applies every policy with a retention and returns them with the
+// outcome recorded
+func (s *Store) Prune(ctx context.Context) ([]Policy, error) {
+	policies, err := s.Policies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for n, p := range policies {
+		if p.RetentionDays <= 0 {
+			continue
+		}
+		now := s.now().UTC()
+		deleted, archive, err := s.prune(ctx, p, now)
+		if deleted > 0 {
+			logger.Info("Pruned logs", "log_type", p.Type, "deleted", deleted, "archive", archive)
+		}
+		if err != nil {
+			return policies, fmt.Errorf("%s: %w", p.Type, err)
+		}
+		if archive == "" {
+			archive = p.LastArchive
+		}
+		if _, err := s.db.ExecContext(ctx, `
+			UPDATE log_retention SET last_run_at = ?, last_deleted = ?, last_archive = ? WHERE log_type = ?
+		`, now, deleted, archive, p.Type); err != nil {
+			return policies, err
+		}
+		policies[n].LastRunAt, policies[n].LastDeleted, policies[n].LastArchive = &now, deleted, archive
+	}
+	return policies, nil
+}
+
+// prune deletes the rows of p.Type older than its retention at now,
+// archiving each batch first when p.Archive is set. It returns the rows
+// deleted and the archive file written, if any.
+func (s *Store) prune(ctx context.Context, p Policy, now time.Time) (int64, string, error) {
+	cutoff := now.AddDate(0, 0, -p.RetentionDays)
+
+	var a *archive
+	if p.Archive {
+		defer func() {
+			if a != nil {
+				a.abort()
+			}
+		}()
+	}
+
+	var deleted int64
+	for {
+		rows, maxID, err := s.batch(ctx, p.Type, cutoff)
+		if err != nil {
+			return deleted, "", err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		if p.Archive {
+			if a == nil {
+				if a, err = s.openArchive(p.Type, now); err != nil {
+					return deleted, "", err
+				}
+			}
+			// On disk before the rows go
+			if err := a.write(rows); err != nil {
+				return deleted, "", err
+			}
+		}
+
+		result, err := s.db.ExecContext(ctx, `DELETE FROM `+p.Type+` WHERE created_at < ? AND id <= ?`, cutoff, maxID)
+		if err != nil {
+			return deleted, "", err
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+		if len(rows) < batchSize {
+			break
+		}
+	}
+
+	if a == nil {
+		return deleted, "", nil
+	}
+	name, err := a.close()
+	a = nil
+	return deleted, name, err
+}
+
+// batch reads the oldest rows of table before cutoff, by id, as column
+// maps, and the largest id among them
+func (s *Store) batch(ctx context.Context, table string, cutoff time.Time) ([]map[string]interface{}, int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT * FROM `+table+` WHERE created_at < ? ORDER BY id ASC LIMIT ?`,
+		cutoff, batchSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, 0, err
+	}
+	var list []map[string]interface{}
+	var maxID int64
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, 0, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[col] = values[i]
+		}
+		if id, ok := row["id"].(int64); ok && id > maxID {
+			maxID = id
+		}
+		list = append(list, row)
+	}
+	return list, maxID, rows.Err()
+}
+
+// archive is a gzipped JSON Lines file being written. It is written
+// under a temporary name and renamed when complete.
+type archive struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+func (s *Store) openArchive(logType string, now time.Time) (*archive, error) {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.dir, logType+"-"+now.Format("20060102T150405Z")+".jsonl.gz")
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &archive{path: path, file: file, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// write appends rows and flushes them to disk
+func (a *archive) write(rows []map[string]interface{}) error {
+	for _, row := range rows {
+		if err := a.enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// close completes the file and returns its name
+func (a *archive) close() (string, error) {
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return "", err
+	}
+	if err := a.file.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(a.path+".tmp", a.path); err != nil {
+		return "", err
+	}
+	return filepath.Base(a.path), nil
+}
+
+// abort keeps what was written when a prune fails part way, since the
+// rows in it are already deleted
+func (a *archive) abort() {
+	if _, err := a.close(); err != nil {
+		logger.Error("Failed to complete log archive", "file", a.path, "error", err)
+	}
+}
+
+func known(logType string) bool {
+	for _, t := range Types {
+		if t == logType {
+			return true
+		}
+	}
+	return false
+}
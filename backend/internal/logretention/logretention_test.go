@@ -0,0 +1,118 @@
+package logretention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestPolicies(t *testing.T) {
+	s := New(dbtest.Open(t), t.TempDir())
+	ctx := context.Background()
+
+	policies, err := s.Policies(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read policies: %v", err)
+	}
+	if len(policies) != 2 || policies[0] != (Policy{Type: "activity_logs"}) || policies[1] != (Policy{Type: "audit_logs"}) {
+		t.Errorf("Expected every log type kept forever, got %+v", policies)
+	}
+
+	p, err := s.Set(ctx, Policy{Type: "audit_logs", RetentionDays: 30, Archive: true})
+	if err != nil || p.RetentionDays != 30 || !p.Archive {
+		t.Fatalf("Expected the policy stored, got %+v, %v", p, err)
+	}
+	if p, _ = s.Set(ctx, Policy{Type: "audit_logs", RetentionDays: 7}); p.RetentionDays != 7 || p.Archive {
+		t.Errorf("Expected the policy replaced, got %+v", p)
+	}
+	if _, err := s.Set(ctx, Policy{Type: "access_logs", RetentionDays: 7}); err != ErrUnknownType {
+		t.Errorf("Expected ErrUnknownType, got %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	db := dbtest.Open(t)
+	dir := t.TempDir()
+	for _, stmt := range []string{
+		`INSERT INTO activity_logs (id, action, resource, details, created_at) VALUES
+			(1, 'auth.login', 'user', '{"username":"admin"}', '2026-03-01 10:00:00'),
+			(2, 'camera.created', 'camera', '', '2026-03-20 10:00:00'),
+			(3, 'camera.updated', 'camera', '', '2026-04-30 10:00:00')`,
+		`INSERT INTO audit_logs (id, action, created_at) VALUES
+			(1, 'login', '2026-01-01 10:00:00'), (2, 'login', '2026-04-30 10:00:00')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := New(db, dir)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	s.Set(ctx, Policy{Type: "activity_logs", RetentionDays: 30, Archive: true})
+	s.Set(ctx, Policy{Type: "audit_logs", RetentionDays: 90})
+
+	status, err := s.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read status: %v", err)
+	}
+	if status[0].Rows != 3 || status[0].Pending != 2 || status[0].Oldest == nil || status[1].Pending != 1 {
+		t.Errorf("Expected two activity logs and one audit log due, got %+v", status)
+	}
+
+	policies, err := s.Prune(ctx)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	want := "activity_logs-20260501T120000Z.jsonl.gz"
+	if p := policies[0]; p.LastDeleted != 2 || p.LastArchive != want || p.LastRunAt == nil {
+		t.Errorf("Expected two activity logs archived to %s, got %+v", want, p)
+	}
+	if p := policies[1]; p.LastDeleted != 1 || p.LastArchive != "" {
+		t.Errorf("Expected one audit log deleted without an archive, got %+v", p)
+	}
+
+	var left int
+	db.QueryRow(`SELECT COUNT(*) FROM activity_logs`).Scan(&left)
+	if left != 1 {
+		t.Errorf("Expected the recent activity log kept, got %d rows", left)
+	}
+
+	f, err := os.Open(filepath.Join(dir, want))
+	if err != nil {
+		t.Fatalf("Expected the archive written: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Invalid archive: %v", err)
+	}
+	var archived []map[string]interface{}
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var row map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("Invalid archive line: %v", err)
+		}
+		archived = append(archived, row)
+	}
+	if len(archived) != 2 || archived[0]["action"] != "auth.login" || archived[0]["details"] != `{"username":"admin"}` {
+		t.Errorf("Expected the two old activity logs archived, got %v", archived)
+	}
+
+	// Nothing left to prune; the last archive is still reported
+	if policies, _ = s.Prune(ctx); policies[0].LastDeleted != 0 || policies[0].LastArchive != want {
+		t.Errorf("Expected nothing deleted, got %+v", policies[0])
+	}
+	if status, _ := s.Status(ctx); status[0].ArchiveFiles != 1 || status[0].ArchiveBytes == 0 || status[0].Pending != 0 {
+		t.Errorf("Expected one archive and nothing due, got %+v", status[0])
+	}
+}
@@ -0,0 +1,114 @@
+// Package maintenance keeps the global maintenance mode, during which
+// public endpoints answer 503 while the admin APIs stay available. The
+// mode is in the database, so every instance of a cluster follows it;
+// each reads it at most every refreshInterval.
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// refreshInterval bounds how long an instance takes to follow a change
+// made on another
+const refreshInterval = 5 * time.Second
+
+// State is the maintenance mode as admins set it
+type State struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+	// When the operator expects to be done; nil when unknown
+	ETA *time.Time `json:"eta"`
+	// Whether players stop too; by default streams keep playing
+	StopStreams bool       `json:"stop_streams"`
+	StartedAt   *time.Time `json:"started_at"`
+}
+
+// Store reads and changes the mode
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+
+	mu     sync.Mutex
+	state  State
+	readAt time.Time
+}
+
+func New(db *sql.DB) *Store {
+	return &Store{db: db, now: time.Now}
+}
+
+// Current returns the mode, as read from the database within the last
+// refreshInterval
+func (s *Store) Current(ctx context.Context) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.readAt.IsZero() && s.now().Sub(s.readAt) < refreshInterval {
+		return s.state, nil
+	}
+	state, err := s.read(ctx)
+	if err != nil {
+		return State{}, err
+	}
+	s.state, s.readAt = state, s.now()
+	return state, nil
+}
+
+// Set changes the mode and returns it as stored. StartedAt is kept while
+// the mode stays on, so updating the message or ETA does not restart it.
+func (s *Store) Set(ctx context.Context, state State) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.read(ctx)
+	if err != nil {
+		return State{}, err
+	}
+	switch {
+	case !state.Enabled:
+		state.StartedAt = nil
+	case current.Enabled:
+		state.StartedAt = current.StartedAt
+	default:
+		now := s.now().UTC()
+		state.StartedAt = &now
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO maintenance (id, enabled, message, eta, stop_streams, started_at, updated_at)
+		VALUES (1, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET enabled = excluded.enabled, message = excluded.message,
+			eta = excluded.eta, stop_streams = excluded.stop_streams,
+			started_at = excluded.started_at, updated_at = excluded.updated_at
+	`, state.Enabled, state.Message, state.ETA, state.StopStreams, state.StartedAt, s.now().UTC())
+	if err != nil {
+		return State{}, err
+	}
+	s.state, s.readAt = state, s.now()
+	return state, nil
+}
+
+func (s *Store) read(ctx context.Context) (State, error) {
+	var state State
+	var eta, started sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT enabled, message, eta, stop_streams, started_at FROM maintenance WHERE id = 1
+	`).Scan(&state.Enabled, &state.Message, &eta, &state.StopStreams, &started)
+	if errors.Is(err, sql.ErrNoRows) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+	if eta.Valid {
+		state.ETA = &eta.Time
+	}
+	if started.Valid {
+		state.StartedAt = &started.Time
+	}
+	return state, nil
+}
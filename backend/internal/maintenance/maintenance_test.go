@@ -0,0 +1,54 @@
+package maintenance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestStore(t *testing.T) {
+	db := dbtest.Open(t)
+
+	ctx := context.Background()
+	s := New(db)
+	now := time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	if state, err := s.Current(ctx); err != nil || state.Enabled || state.StartedAt != nil {
+		t.Fatalf("Expected the mode off, got %+v %v", state, err)
+	}
+
+	eta := now.Add(time.Hour)
+	state, err := s.Set(ctx, State{Enabled: true, Message: "Upgrading", ETA: &eta})
+	if err != nil || state.StartedAt == nil || !state.StartedAt.Equal(now) {
+		t.Fatalf("Expected the mode started now, got %+v %v", state, err)
+	}
+
+	t.Run("Update keeps the start", func(t *testing.T) {
+		now = now.Add(10 * time.Minute)
+		state, err := s.Set(ctx, State{Enabled: true, Message: "Almost done", StopStreams: true})
+		if err != nil || !state.StartedAt.Equal(now.Add(-10*time.Minute)) {
+			t.Errorf("Expected the first start kept, got %+v %v", state, err)
+		}
+	})
+
+	t.Run("Other instances", func(t *testing.T) {
+		other := New(db)
+		other.now = s.now
+		state, err := other.Current(ctx)
+		if err != nil || !state.Enabled || state.Message != "Almost done" || state.ETA != nil || !state.StopStreams {
+			t.Fatalf("Expected the stored mode, got %+v %v", state, err)
+		}
+
+		s.Set(ctx, State{})
+		if state, _ := other.Current(ctx); !state.Enabled {
+			t.Error("Expected the mode read within the refresh interval to be kept")
+		}
+		now = now.Add(refreshInterval)
+		if state, _ := other.Current(ctx); state.Enabled || state.StartedAt != nil {
+			t.Errorf("Expected the mode off after the refresh interval, got %+v", state)
+		}
+	})
+}
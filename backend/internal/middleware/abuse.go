@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/abuse"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// StreamGuard refuses banned client IPs with a 403 and counts the
+// stream requests of the others, banning those that go over the
+// guard's limits. stream names the camera a request is for and whether
+// it is a playlist; requests for no camera are only checked for a ban.
+// Requests made with an API key are left to its own limits.
+func StreamGuard(guard *abuse.Guard, stream func(c *fiber.Ctx) (streamKey string, playlist bool)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Locals("api_key") != nil {
+			return c.Next()
+		}
+		ctx := c.UserContext()
+		ip := c.IP()
+
+		until, banned, err := guard.Banned(ctx, ip)
+		if err != nil {
+			logger.FromContext(ctx).Warn("Failed to read IP bans", "error", err)
+		}
+		if banned {
+			return refuseBanned(c, until)
+		}
+
+		streamKey, playlist := stream(c)
+		if streamKey == "" {
+			return c.Next()
+		}
+		ban, err := guard.Observe(ctx, utils.CopyString(ip), utils.CopyString(streamKey), playlist)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to ban client", "ip", ip, "error", err)
+			return c.Next()
+		}
+		if ban == nil {
+			return c.Next()
+		}
+
+		logger.FromContext(ctx).Warn("Client banned from streams", "ip", ban.IP, "reason", ban.Reason, "until", ban.ExpiresAt)
+		events.Publish(events.Event{
+			Type:     events.StreamIPBanned,
+			IP:       ban.IP,
+			Resource: "ip_ban",
+			Data: map[string]interface{}{
+				"ban_id":     ban.ID,
+				"ip":         ban.IP,
+				"reason":     ban.Reason,
+				"expires_at": ban.ExpiresAt,
+			},
+		})
+		return refuseBanned(c, ban.ExpiresAt)
+	}
+}
+
+func refuseBanned(c *fiber.Ctx, until time.Time) error {
+	if wait := time.Until(until); wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+	}
+	message := "Too many stream requests from your network; try again later"
+	return c.Status(fiber.StatusForbidden).JSON(response.Envelope{
+		Success: false,
+		Message: message,
+		Error:   &response.Error{Code: "banned", Message: message},
+	})
+}
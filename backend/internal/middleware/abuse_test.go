@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/abuse"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStreamGuard(t *testing.T) {
+	db := dbtest.Open(t)
+
+	guard := abuse.New(db, func() abuse.Limits {
+		return abuse.Limits{Window: time.Minute, Playlists: 3, Ban: time.Hour}
+	})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-API-Key") != "" {
+			c.Locals("api_key", c.Get("X-API-Key"))
+		}
+		return c.Next()
+	})
+	app.Use(StreamGuard(guard, func(c *fiber.Ctx) (string, bool) {
+		key := strings.TrimPrefix(c.Path(), "/stream/")
+		return key, strings.HasSuffix(key, ".m3u8")
+	}))
+	app.Get("/stream/*", func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+
+	get := func(path, apiKey string) (int, string, response.Envelope) {
+		req := httptest.NewRequest("GET", path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, resp.Header.Get("Retry-After"), env
+	}
+
+	for i := 0; i < 3; i++ {
+		if status, _, _ := get("/stream/gate.m3u8", ""); status != 200 {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, status)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if status, _, _ := get("/stream/gate.m3u8", "partner"); status != 200 {
+			t.Fatalf("Expected API key requests left alone, got %d", status)
+		}
+	}
+
+	status, retry, env := get("/stream/gate.m3u8", "")
+	if status != 403 || env.Error == nil || env.Error.Code != "banned" || retry == "" {
+		t.Fatalf("Expected a 403 ban with Retry-After, got %d %q %+v", status, retry, env)
+	}
+	if status, _, _ := get("/stream/segment.ts", ""); status != 403 {
+		t.Errorf("Expected the banned client refused every stream request, got %d", status)
+	}
+
+	bans, err := guard.Active(context.Background())
+	if err != nil || len(bans) != 1 {
+		t.Fatalf("Expected one ban, got %+v %v", bans, err)
+	}
+	guard.Lift(context.Background(), bans[0].ID)
+	if status, _, _ := get("/stream/gate.m3u8", ""); status != 200 {
+		t.Errorf("Expected the client let through once unbanned, got %d", status)
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/abcdefak87/cctv/internal/apikeys"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKey identifies third parties by the key in the X-API-Key header,
+// or the api_key query parameter for players that cannot set headers.
+// Requests without a key pass as before. A key scopes the request to
+// its organization and is stored in Locals("api_key") for the stream
+// limits. Requests for which metered returns true count against the
+// key's daily quota, and are refused once it is used up; when counting
+// fails the request is let through.
+func APIKey(keys *apikeys.Store, metered func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Get("X-API-Key")
+		if token == "" {
+			token = c.Query("api_key")
+		}
+		if token == "" {
+			return c.Next()
+		}
+
+		ctx := c.UserContext()
+		key, ok, err := keys.Lookup(ctx, token)
+		if err != nil {
+			logger.FromContext(ctx).Error("Failed to check API key", "error", err)
+			return response.Fail(c, fiber.StatusInternalServerError, "Failed to check API key")
+		}
+		if !ok {
+			return response.Fail(c, fiber.StatusUnauthorized, "Invalid API key")
+		}
+
+		c.Locals("api_key", key)
+		c.Locals("org_id", key.OrganizationID)
+		c.SetUserContext(tenant.WithOrg(ctx, key.OrganizationID))
+
+		if !metered(c) {
+			return c.Next()
+		}
+		used, ok, reset, err := keys.Hit(ctx, key)
+		if err != nil {
+			logger.FromContext(ctx).Warn("API key quota unavailable", "api_key_id", key.ID, "error", err)
+			return c.Next()
+		}
+		if key.RequestsPerDay > 0 {
+			c.Set("X-Quota-Limit", strconv.Itoa(key.RequestsPerDay))
+			c.Set("X-Quota-Remaining", strconv.Itoa(max(key.RequestsPerDay-used, 0)))
+		}
+		if !ok {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(reset.Seconds())+1))
+			return response.Fail(c, fiber.StatusTooManyRequests, "Daily request quota of this API key is used up")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/apikeys"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAPIKey(t *testing.T) {
+	db := dbtest.Open(t)
+	_, err := db.Exec(`INSERT INTO organizations (id, name, slug) VALUES (2, 'Dander', 'dander')`)
+	if err == nil {
+		_, err = db.Exec(`INSERT INTO api_keys (organization_id, name, key_hash, requests_per_day) VALUES (2, 'Partner', ?, 2)`,
+			apikeys.Hash("partner-key"))
+	}
+	if err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(APIKey(apikeys.New(db), func(c *fiber.Ctx) bool { return !strings.HasPrefix(c.Path(), "/stream") }))
+	handler := func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(tenant.OrgID(c.UserContext())))
+	}
+	app.Get("/cameras", handler)
+	app.Get("/stream", handler)
+
+	// get returns the status and the quota left, then the organization
+	get := func(path, key string) (int, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			body = nil
+		}
+		return resp.StatusCode, resp.Header.Get("X-Quota-Remaining") + "|" + string(body)
+	}
+
+	if status, got := get("/cameras", ""); status != 200 || got != "|1" {
+		t.Errorf("Expected a request without a key to pass unchanged, got %d %q", status, got)
+	}
+	if status, _ := get("/cameras", "wrong"); status != 401 {
+		t.Errorf("Expected status 401 for an unknown key, got %d", status)
+	}
+	if status, got := get("/cameras", "partner-key"); status != 200 || got != "1|2" {
+		t.Errorf("Expected the key's organization and 1 request left, got %d %q", status, got)
+	}
+	if status, got := get("/cameras?api_key=partner-key", ""); status != 200 || got != "0|2" {
+		t.Errorf("Expected the key in the query to count too, got %d %q", status, got)
+	}
+	if status, _ := get("/stream", "partner-key"); status != 200 {
+		t.Errorf("Expected unmetered requests to pass once the quota is used up, got %d", status)
+	}
+
+	if status, got := get("/cameras", "partner-key"); status != 429 || got != "0|" {
+		t.Errorf("Expected status 429 over the quota, got %d %q", status, got)
+	}
+}
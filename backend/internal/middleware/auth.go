@@ -1,9 +1,18 @@
 package middleware
 
 import (
+	"errors"
+	"strconv"
 	"strings"
 
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -11,55 +20,142 @@ type JWTClaims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+
+	// OrgID is the user's organization; tokens issued before
+	// organizations existed have none and mean the default one
+	OrgID int `json:"org_id"`
+
+	// ImpersonatorID is the admin acting as this user, with a token from
+	// POST /api/admin/users/:id/impersonate; ReadOnly tokens may only read
+	ImpersonatorID int  `json:"impersonator_id,omitempty"`
+	ReadOnly       bool `json:"read_only,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// OrganizationHeader lets an admin work in another organization
+const OrganizationHeader = "X-Organization-ID"
+
+// AuthMiddleware verifies the token and scopes the request to the user's
+// organization; admins may pick another with OrganizationHeader. Tokens
+// revoked by logging out are refused, unless the cache holding the
+// revocations is unreachable.
 func AuthMiddleware(secret string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get token from header
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			// Try cookie
-			token := c.Cookies("token")
-			if token == "" {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"success": false,
-					"message": "Unauthorized - No token provided",
-				})
-			}
-			authHeader = "Bearer " + token
+		claims, msg := authenticate(c, secret)
+		if msg != "" {
+			return response.Fail(c, fiber.StatusUnauthorized, msg)
 		}
 		
-		// Extract token
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"message": "Invalid authorization header",
-			})
+		// Store claims in context
+		c.Locals("user_id", claims.UserID)
+		c.Locals("username", claims.Username)
+		c.Locals("role", claims.Role)
+
+		orgID := claims.OrgID
+		if raw := c.Get(OrganizationHeader); raw != "" && claims.Role == models.RoleAdmin {
+			id, err := strconv.Atoi(raw)
+			if err != nil || id < 1 {
+				return response.Fail(c, fiber.StatusBadRequest, "Invalid "+OrganizationHeader)
+			}
+			orgID = id
 		}
-		
-		tokenString := parts[1]
-		
-		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-		
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"message": "Invalid or expired token",
-			})
+		if orgID < 1 {
+			orgID = tenant.DefaultOrgID
 		}
-		
-		// Store claims in context
-		if claims, ok := token.Claims.(*JWTClaims); ok {
-			c.Locals("user_id", claims.UserID)
-			c.Locals("username", claims.Username)
-			c.Locals("role", claims.Role)
+		c.Locals("org_id", orgID)
+		c.SetUserContext(tenant.WithOrg(c.UserContext(), orgID))
+
+		if claims.ImpersonatorID > 0 {
+			return impersonated(c, claims)
 		}
 		
 		return c.Next()
 	}
 }
+
+// authenticate reads the login token of c from the Authorization header
+// or the token cookie. msg says why it is refused, when it is.
+func authenticate(c *fiber.Ctx, secret string) (*JWTClaims, string) {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		token := c.Cookies("token")
+		if token == "" {
+			return nil, "Unauthorized - No token provided"
+		}
+		authHeader = "Bearer " + token
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, "Invalid authorization header"
+	}
+	tokenString := parts[1]
+
+	claims := &JWTClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, "Invalid or expired token"
+	}
+
+	revoked, err := cache.Revoked(c.UserContext(), cache.Shared(), tokenString)
+	if err != nil {
+		logger.FromContext(c.UserContext()).Warn("Token revocation check unavailable", "error", err)
+	}
+	if revoked {
+		return nil, "Token has been revoked"
+	}
+	return claims, ""
+}
+
+// OptionalUserID returns the user c is made by when it carries a valid
+// login token, and 0 otherwise, for public routes that note who is
+// there without requiring a login. An admin acting as another user
+// counts as no user, so they are not taken for that user.
+func OptionalUserID(c *fiber.Ctx, secret string) int {
+	if c.Get("Authorization") == "" && c.Cookies("token") == "" {
+		return 0
+	}
+	claims, msg := authenticate(c, secret)
+	if msg != "" || claims.ImpersonatorID > 0 {
+		return 0
+	}
+	return claims.UserID
+}
+
+// impersonated serves a request made with an impersonation token. A
+// read-only token may only read; every request, refused or not, goes
+// to the audit log under the user acted as, naming the admin.
+func impersonated(c *fiber.Ctx, claims *JWTClaims) error {
+	c.Locals("impersonator_id", claims.ImpersonatorID)
+
+	method := c.Method()
+	reads := method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+	var err error
+	if claims.ReadOnly && !reads {
+		err = response.Fail(c, fiber.StatusForbidden, "Forbidden - read-only impersonation")
+	} else {
+		err = c.Next()
+	}
+
+	status := c.Response().StatusCode()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	}
+	userID := claims.UserID
+	events.Publish(events.Event{
+		Type:     events.AuthImpersonatedRequest,
+		UserID:   &userID,
+		IP:       utils.CopyString(c.IP()),
+		Resource: "user",
+		Data: map[string]interface{}{
+			"impersonator_id": claims.ImpersonatorID,
+			"method":          utils.CopyString(method),
+			"path":            utils.CopyString(c.Path()),
+			"status":          status,
+		},
+	})
+	return err
+}
@@ -200,3 +200,48 @@ func TestJWTClaims(t *testing.T) {
 		}
 	})
 }
+
+func TestOptionalUserID(t *testing.T) {
+	secret := "test-secret"
+	sign := func(claims JWTClaims, key string) string {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		return token
+	}
+
+	var userID int
+	app := fiber.New()
+	app.Get("/watch", func(c *fiber.Ctx) error {
+		userID = OptionalUserID(c, secret)
+		return c.SendString("OK")
+	})
+
+	for _, tc := range []struct {
+		name, header, cookie string
+		want                 int
+	}{
+		{"No token", "", "", 0},
+		{"Header", "Bearer " + sign(JWTClaims{UserID: 7}, secret), "", 7},
+		{"Cookie", "", sign(JWTClaims{UserID: 8}, secret), 8},
+		{"Wrong secret", "Bearer " + sign(JWTClaims{UserID: 7}, "wrong-secret"), "", 0},
+		{"Impersonation", "Bearer " + sign(JWTClaims{UserID: 7, ImpersonatorID: 1}, secret), "", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/watch", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			if tc.cookie != "" {
+				req.Header.Set("Cookie", "token="+tc.cookie)
+			}
+			userID = -1
+			resp, err := app.Test(req)
+			if err != nil || resp.StatusCode != 200 {
+				t.Fatalf("Expected the request to pass either way, got %v (%v)", resp, err)
+			}
+			if userID != tc.want {
+				t.Errorf("Expected user %d, got %d", tc.want, userID)
+			}
+		})
+	}
+}
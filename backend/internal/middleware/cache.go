@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Freshness records when each cacheable resource (cameras, areas,
+// settings) last changed in this process. Resources that were never
+// touched count as changed at startup.
+type Freshness struct {
+	mu       sync.RWMutex
+	start    time.Time
+	modified map[string]time.Time
+}
+
+func NewFreshness() *Freshness {
+	return &Freshness{
+		start:    time.Now().Truncate(time.Second),
+		modified: map[string]time.Time{},
+	}
+}
+
+// Touch marks resources as changed now
+func (f *Freshness) Touch(resources ...string) {
+	now := time.Now().Truncate(time.Second)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range resources {
+		f.modified[r] = now
+	}
+}
+
+// Modified returns the latest change time across resources
+func (f *Freshness) Modified(resources ...string) time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	latest := f.start
+	for _, r := range resources {
+		if t := f.modified[r]; t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// Conditional adds ETag, Last-Modified and a short public max-age to
+// successful GET responses and answers 304 Not Modified when the client
+// copy is current. The ETag is a hash of the body, so it is always right
+// even when the data was changed outside this process (e.g. by the
+// import-cameras command); Last-Modified comes from f and is only used
+// by clients that send no If-None-Match.
+func Conditional(f *Freshness, maxAge time.Duration, resources ...string) fiber.Handler {
+	cacheControl := "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+			return c.Next()
+		}
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() != fiber.StatusOK {
+			return nil
+		}
+
+		sum := sha1.Sum(c.Response().Body())
+		etag := `W/"` + hex.EncodeToString(sum[:8]) + `"`
+		modified := f.Modified(resources...)
+
+		c.Set(fiber.HeaderETag, etag)
+		c.Set(fiber.HeaderLastModified, modified.UTC().Format(http.TimeFormat))
+		c.Set(fiber.HeaderCacheControl, cacheControl)
+
+		if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+			if etagMatches(match, etag) {
+				return notModified(c)
+			}
+			return nil
+		}
+		if since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince)); err == nil && !modified.After(since) {
+			return notModified(c)
+		}
+		return nil
+	}
+}
+
+// Invalidates touches resources after every successful write that passes
+// through it, so Last-Modified moves forward on the public endpoints
+func Invalidates(f *Freshness, resources ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return err
+		}
+		if err == nil && c.Response().StatusCode() < 400 {
+			f.Touch(resources...)
+		}
+		return err
+	}
+}
+
+// etagMatches compares weakly, as If-None-Match requires
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func notModified(c *fiber.Ctx) error {
+	c.Context().ResetBody()
+	c.Status(fiber.StatusNotModified)
+	return nil
+}
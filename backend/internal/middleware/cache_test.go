@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestConditional(t *testing.T) {
+	fresh := NewFreshness()
+	body := `{"cameras":[1]}`
+
+	app := fiber.New()
+	cameras := app.Group("/cameras", Invalidates(fresh, "cameras"))
+	cameras.Get("/active", Conditional(fresh, 30*time.Second, "cameras"), func(c *fiber.Ctx) error {
+		return c.SendString(body)
+	})
+	cameras.Post("/", func(c *fiber.Ctx) error {
+		body = `{"cameras":[1,2]}`
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	get := func(header, value string) *http.Response {
+		req := httptest.NewRequest("GET", "/cameras/active", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	first := get("", "")
+	etag := first.Header.Get("ETag")
+	lastModified := first.Header.Get("Last-Modified")
+
+	t.Run("Sets validators and max-age", func(t *testing.T) {
+		if etag == "" || lastModified == "" {
+			t.Errorf("Expected ETag and Last-Modified, got '%s' and '%s'", etag, lastModified)
+		}
+		if cc := first.Header.Get("Cache-Control"); cc != "public, max-age=30" {
+			t.Errorf("Expected 'public, max-age=30', got '%s'", cc)
+		}
+	})
+
+	t.Run("Matching ETag returns 304", func(t *testing.T) {
+		resp := get("If-None-Match", etag)
+		if resp.StatusCode != 304 {
+			t.Errorf("Expected status 304, got %d", resp.StatusCode)
+		}
+		if b, _ := io.ReadAll(resp.Body); len(b) != 0 {
+			t.Errorf("Expected empty body, got '%s'", b)
+		}
+	})
+
+	t.Run("Unchanged since Last-Modified returns 304", func(t *testing.T) {
+		if resp := get("If-Modified-Since", lastModified); resp.StatusCode != 304 {
+			t.Errorf("Expected status 304, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Write invalidates", func(t *testing.T) {
+		time.Sleep(time.Second) // Last-Modified has one-second resolution
+		app.Test(httptest.NewRequest("POST", "/cameras/", nil))
+
+		resp := get("If-None-Match", etag)
+		if resp.StatusCode != 200 {
+			t.Errorf("Expected status 200 after a change, got %d", resp.StatusCode)
+		}
+		if resp.Header.Get("ETag") == etag {
+			t.Error("Expected a new ETag after a change")
+		}
+		if resp := get("If-Modified-Since", lastModified); resp.StatusCode != 200 {
+			t.Errorf("Expected status 200 for a stale If-Modified-Since, got %d", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// CORS answers cross-origin requests for the origins allowed returns
+// for each request, so route groups can allow different sites and a
+// config reload applies at once. Listed origins are echoed back with
+// credentials; "*" lets any other site read responses, but without
+// credentials, since browsers refuse a wildcard combined with them.
+func CORS(config cors.Config, allowed func(c *fiber.Ctx) []string) fiber.Handler {
+	config.AllowOrigins = ""
+	config.AllowOriginsFunc = func(string) bool { return true }
+	listed := cors.New(config)
+
+	config.AllowOriginsFunc = func(string) bool { return false }
+	refused := cors.New(config)
+
+	config.AllowOrigins, config.AllowOriginsFunc, config.AllowCredentials = "*", nil, false
+	open := cors.New(config)
+
+	return func(c *fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		handler := refused
+		for _, o := range allowed(c) {
+			if o == origin {
+				return listed(c)
+			}
+			if o == "*" {
+				handler = open
+			}
+		}
+		return handler(c)
+	}
+}
+
+// AnyOrigin lets pages on any site read the responses of a public,
+// credential-free endpoint, such as the embeddable widgets. It replaces
+// what the global CORS middleware set for allowed origins, since a
+// wildcard origin cannot be combined with credentials. Only simple GET
+// requests are covered; they need no preflight.
+func AnyOrigin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+		c.Response().Header.Del(fiber.HeaderAccessControlAllowCredentials)
+		return err
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+func TestAnyOrigin(t *testing.T) {
+	app := fiber.New()
+	app.Use(cors.New(cors.Config{AllowOrigins: "https://cctv.example", AllowCredentials: true}))
+	app.Get("/widget", AnyOrigin(), func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+
+	for _, origin := range []string{"https://partner.example", "https://cctv.example"} {
+		t.Run(origin, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/widget", nil)
+			req.Header.Set("Origin", origin)
+			resp, _ := app.Test(req)
+
+			if h := resp.Header.Get("Access-Control-Allow-Origin"); h != "*" {
+				t.Errorf("Expected any origin to be allowed, got '%s'", h)
+			}
+			if h := resp.Header.Get("Access-Control-Allow-Credentials"); h != "" {
+				t.Errorf("Expected no credentials header, got '%s'", h)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	groups := map[string][]string{
+		"/public": {"https://cctv.example", "*"},
+		"/admin":  {"https://cctv.example"},
+	}
+	app := fiber.New()
+	app.Use(CORS(cors.Config{AllowCredentials: true}, func(c *fiber.Ctx) []string {
+		return groups[c.Path()]
+	}))
+	for path := range groups {
+		app.Get(path, func(c *fiber.Ctx) error {
+			return c.SendString("OK")
+		})
+	}
+
+	for _, tc := range []struct {
+		path, origin, allow, credentials string
+	}{
+		{"/public", "https://cctv.example", "https://cctv.example", "true"},
+		{"/public", "https://partner.example", "*", ""},
+		{"/admin", "https://cctv.example", "https://cctv.example", "true"},
+		{"/admin", "https://partner.example", "", "true"},
+	} {
+		t.Run(tc.path+" from "+tc.origin, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req.Header.Set("Origin", tc.origin)
+			resp, _ := app.Test(req)
+
+			if h := resp.Header.Get("Access-Control-Allow-Origin"); h != tc.allow {
+				t.Errorf("Expected allowed origin '%s', got '%s'", tc.allow, h)
+			}
+			if h := resp.Header.Get("Access-Control-Allow-Credentials"); h != tc.credentials {
+				t.Errorf("Expected credentials header '%s', got '%s'", tc.credentials, h)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HSTS tells browsers to use HTTPS for the next maxAge seconds. It only
+// applies to requests that arrived over TLS; a header on plain HTTP
+// would be ignored anyway.
+func HSTS(maxAge int) fiber.Handler {
+	value := "max-age=" + strconv.Itoa(maxAge) + "; includeSubDomains"
+
+	return func(c *fiber.Ctx) error {
+		if maxAge > 0 && c.Protocol() == "https" {
+			c.Set(fiber.HeaderStrictTransportSecurity, value)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHSTS(t *testing.T) {
+	app := fiber.New()
+	app.Use(HSTS(3600))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+
+	t.Run("Plain HTTP gets no header", func(t *testing.T) {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/test", nil))
+		if h := resp.Header.Get("Strict-Transport-Security"); h != "" {
+			t.Errorf("Expected no HSTS header over HTTP, got '%s'", h)
+		}
+	})
+
+	t.Run("HTTPS gets the header", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		resp, _ := app.Test(req)
+
+		if h := resp.Header.Get("Strict-Transport-Security"); h != "max-age=3600; includeSubDomains" {
+			t.Errorf("Expected HSTS header, got '%s'", h)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/maintenance"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaintenanceNotice is the data of the 503 sent during maintenance, with
+// the organization's branding so the page can still look like its own
+type MaintenanceNotice struct {
+	Message   string                 `json:"message"`
+	ETA       *time.Time             `json:"eta"`
+	StartedAt *time.Time             `json:"started_at"`
+	Branding  map[string]interface{} `json:"branding"`
+}
+
+// Maintenance answers the requests blocked returns true for with a 503
+// while the maintenance mode is on, and sets Retry-After when the ETA is
+// known. When the mode cannot be read the request is let through.
+func Maintenance(store *maintenance.Store, blocked func(c *fiber.Ctx, state maintenance.State) bool,
+	branding func(c *fiber.Ctx) map[string]interface{}) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		state, err := store.Current(ctx)
+		if err != nil {
+			logger.FromContext(ctx).Warn("Maintenance mode unavailable", "error", err)
+			return c.Next()
+		}
+		if !state.Enabled || !blocked(c, state) {
+			return c.Next()
+		}
+
+		message := state.Message
+		if message == "" {
+			message = "Down for maintenance"
+		}
+		if state.ETA != nil {
+			if wait := time.Until(*state.ETA); wait > 0 {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+			}
+		}
+		return c.Status(fiber.StatusServiceUnavailable).JSON(response.Envelope{
+			Success: false,
+			Message: message,
+			Data: MaintenanceNotice{
+				Message:   message,
+				ETA:       state.ETA,
+				StartedAt: state.StartedAt,
+				Branding:  branding(c),
+			},
+			Error: &response.Error{Code: "maintenance", Message: message},
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/maintenance"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMaintenance(t *testing.T) {
+	db := dbtest.Open(t)
+
+	store := maintenance.New(db)
+	app := fiber.New()
+	app.Use(Maintenance(store, func(c *fiber.Ctx, state maintenance.State) bool {
+		return c.Path() == "/cameras" || c.Path() == "/stream" && state.StopStreams
+	}, func(c *fiber.Ctx) map[string]interface{} {
+		return map[string]interface{}{"company_name": "RAF NET"}
+	}))
+	for _, path := range []string{"/cameras", "/stream", "/admin"} {
+		app.Get(path, func(c *fiber.Ctx) error {
+			return c.SendString("OK")
+		})
+	}
+
+	get := func(path string) (int, string, response.Envelope) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var env response.Envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return resp.StatusCode, resp.Header.Get("Retry-After"), env
+	}
+
+	if status, _, _ := get("/cameras"); status != 200 {
+		t.Fatalf("Expected status 200 while the mode is off, got %d", status)
+	}
+
+	eta := time.Now().Add(time.Hour)
+	if _, err := store.Set(context.Background(), maintenance.State{Enabled: true, Message: "Upgrading", ETA: &eta}); err != nil {
+		t.Fatalf("Failed to start maintenance: %v", err)
+	}
+	status, retry, env := get("/cameras")
+	if status != 503 || env.Error == nil || env.Error.Code != "maintenance" || env.Message != "Upgrading" {
+		t.Fatalf("Expected the maintenance notice, got %d %+v", status, env)
+	}
+	if retry != "3600" && retry != "3601" {
+		t.Errorf("Expected Retry-After until the ETA, got %q", retry)
+	}
+	if data := env.Data.(map[string]interface{}); data["branding"].(map[string]interface{})["company_name"] != "RAF NET" {
+		t.Errorf("Expected the branding in the notice, got %v", data)
+	}
+	for _, path := range []string{"/stream", "/admin"} {
+		if status, _, _ := get(path); status != 200 {
+			t.Errorf("Expected %s to stay available, got %d", path, status)
+		}
+	}
+
+	store.Set(context.Background(), maintenance.State{Enabled: true, StopStreams: true})
+	if status, retry, env := get("/stream"); status != 503 || retry != "" || env.Message != "Down for maintenance" {
+		t.Errorf("Expected streams stopped with the default message and no ETA, got %d %q %q", status, retry, env.Message)
+	}
+}
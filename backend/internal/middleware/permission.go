@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// permissionTimeout bounds the user lookup
+const permissionTimeout = 5 * time.Second
+
+// RequirePermission lets through users granted permission, and admins.
+// Grants are read from the database on every request rather than from
+// the token, so revoking one applies at once. Use it after
+// AuthMiddleware.
+func RequirePermission(db *sql.DB, permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(int)
+		if !ok {
+			return response.Fail(c, fiber.StatusUnauthorized, "Unauthorized - No token provided")
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), permissionTimeout)
+		defer cancel()
+
+		user := models.User{ID: userID}
+		var permissions string
+		err := db.QueryRowContext(ctx, "SELECT role, permissions FROM users WHERE id = ?", userID).
+			Scan(&user.Role, &permissions)
+		if err == sql.ErrNoRows {
+			return response.Fail(c, fiber.StatusUnauthorized, "Unauthorized - User no longer exists")
+		}
+		if err != nil {
+			logger.FromContext(c.UserContext()).Error("Failed to check permission", "error", err)
+			return response.Fail(c, fiber.StatusInternalServerError, "Failed to check permission")
+		}
+		user.Permissions = repository.SplitPermissions(permissions)
+
+		if !user.HasPermission(permission) {
+			return response.Fail(c, fiber.StatusForbidden, "Forbidden - requires the "+permission+" permission")
+		}
+		return c.Next()
+	}
+}
+
+// RequireRole lets through users whose token carries one of roles. Use it
+// after AuthMiddleware.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		for _, r := range roles {
+			if role == r {
+				return c.Next()
+			}
+		}
+		return response.Fail(c, fiber.StatusForbidden, "Forbidden - requires the "+strings.Join(roles, " or ")+" role")
+	}
+}
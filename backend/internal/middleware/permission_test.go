@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequirePermission(t *testing.T) {
+	db := dbtest.Open(t)
+	if _, err := db.Exec(`INSERT INTO users (id, username, password_hash, role, permissions) VALUES
+		(1, 'admin', 'x', 'admin', ''), (2, 'operator', 'x', 'user', 'anpr'), (3, 'viewer', 'x', 'viewer', '')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	status := func(userID int) int {
+		app := fiber.New()
+		app.Get("/test", func(c *fiber.Ctx) error {
+			c.Locals("user_id", userID)
+			return c.Next()
+		}, RequirePermission(db, "anpr"), func(c *fiber.Ctx) error {
+			return c.SendString("OK")
+		})
+		resp, err := app.Test(httptest.NewRequest("GET", "/test", nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, tc := range []struct {
+		name   string
+		userID int
+		want   int
+	}{
+		{"Admin", 1, 200},
+		{"Granted", 2, 200},
+		{"Not granted", 3, 403},
+		{"Deleted user", 9, 401},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := status(tc.userID); got != tc.want {
+				t.Errorf("Expected status %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/playertoken"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// PlayerToken checks the anonymous player token of stream requests,
+// sent in X-Player-Token, ?player_token= or the player_token cookie. A
+// valid token's viewer ID is stored in Locals("player_token") and its
+// requests are counted by counter, or in memory when it is nil; past
+// limit() a minute they get 429. Without a valid token a request gets
+// 401 when required, and goes through otherwise. skip exempts requests
+// such as fetching a token; requests made with an API key are left to
+// the key's own limits.
+func PlayerToken(secret string, required bool, limit func() int, counter Counter, skip func(c *fiber.Ctx) bool) fiber.Handler {
+	if counter == nil {
+		counter = newMemoryCounter()
+	}
+	return func(c *fiber.Ctx) error {
+		if skip(c) || c.Locals("api_key") != nil {
+			return c.Next()
+		}
+
+		token := c.Get(playertoken.Header)
+		if token == "" {
+			token = c.Query(playertoken.Query)
+		}
+		if token == "" {
+			token = c.Cookies(playertoken.Cookie)
+		}
+		id, _, err := playertoken.Parse(secret, token, time.Now())
+		if err != nil {
+			if !required {
+				return c.Next()
+			}
+			code, message := "player_token_required", "A player token is required; fetch one from POST /api/stream/token"
+			if errors.Is(err, playertoken.ErrExpired) {
+				code, message = "player_token_expired", "The player token has expired; fetch a new one from POST /api/stream/token"
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(response.Envelope{
+				Success: false,
+				Message: message,
+				Error:   &response.Error{Code: code, Message: message},
+			})
+		}
+		id = utils.CopyString(id)
+		c.Locals("player_token", id)
+
+		max := limit()
+		if max <= 0 {
+			return c.Next()
+		}
+		count, reset, err := counter.Hit(c.UserContext(), id, time.Minute)
+		if err != nil {
+			logger.FromContext(c.UserContext()).Warn("Player token limit unavailable", "error", err)
+			return c.Next()
+		}
+		if count > max {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(reset.Seconds())+1))
+			return response.Fail(c, fiber.StatusTooManyRequests, "Too many stream requests from this player, please try again later")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/playertoken"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPlayerToken(t *testing.T) {
+	const secret = "s3cret"
+	limit := 3
+	newApp := func(required bool) *fiber.App {
+		app := fiber.New()
+		app.Use(PlayerToken(secret, required, func() int { return limit }, nil, func(c *fiber.Ctx) bool {
+			return c.Path() == "/stream/token"
+		}))
+		app.All("/*", func(c *fiber.Ctx) error {
+			id, _ := c.Locals("player_token").(string)
+			return c.SendString(id)
+		})
+		return app
+	}
+	get := func(app *fiber.App, path, header, cookie string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		if header != "" {
+			req.Header.Set(playertoken.Header, header)
+		}
+		if cookie != "" {
+			req.Header.Set("Cookie", playertoken.Cookie+"="+cookie)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	valid, _ := playertoken.Issue(secret, "viewer1", time.Now().Add(time.Minute))
+	expired, _ := playertoken.Issue(secret, "viewer1", time.Now().Add(-time.Minute))
+	forged, _ := playertoken.Issue("other", "viewer1", time.Now().Add(time.Minute))
+
+	t.Run("Required", func(t *testing.T) {
+		app := newApp(true)
+		for name, token := range map[string]string{"none": "", "expired": expired, "forged": forged} {
+			if status := get(app, "/stream/gate", token, ""); status != 401 {
+				t.Errorf("Expected 401 with %s token, got %d", name, status)
+			}
+		}
+		if status := get(app, "/stream/token", "", ""); status != 200 {
+			t.Errorf("Expected fetching a token to pass, got %d", status)
+		}
+		if status := get(app, "/stream/gate?player_token="+valid, "", ""); status != 200 {
+			t.Errorf("Expected a token in the query to pass, got %d", status)
+		}
+		if status := get(app, "/stream/gate", "", valid); status != 200 {
+			t.Errorf("Expected a token in the cookie to pass, got %d", status)
+		}
+	})
+
+	t.Run("Throttled per token", func(t *testing.T) {
+		app := newApp(false)
+		other, _ := playertoken.Issue(secret, "viewer2", time.Now().Add(time.Minute))
+		for i := 0; i < limit; i++ {
+			if status := get(app, "/stream/gate", other, ""); status != 200 {
+				t.Fatalf("Expected request %d to pass, got %d", i+1, status)
+			}
+		}
+		if status := get(app, "/stream/gate", other, ""); status != 429 {
+			t.Errorf("Expected 429 past the limit, got %d", status)
+		}
+		if status := get(app, "/stream/gate", valid, ""); status != 200 {
+			t.Errorf("Expected another token to pass, got %d", status)
+		}
+		if status := get(app, "/stream/gate", "", ""); status != 200 {
+			t.Errorf("Expected no token to pass while optional, got %d", status)
+		}
+	})
+}
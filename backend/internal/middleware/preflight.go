@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Preflight answers CORS preflights with cors ahead of the rest of the
+// middleware, so the access log, security headers and compression are
+// skipped for them, and lets browsers cache the answer for the seconds
+// maxAge returns for the route group of the request. Each preflight is
+// counted in stats.
+func Preflight(cors fiber.Handler, group func(c *fiber.Ctx) string, maxAge func(group string) int, stats *PreflightStats) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodOptions || c.Get(fiber.HeaderOrigin) == "" ||
+			c.Get(fiber.HeaderAccessControlRequestMethod) == "" {
+			return c.Next()
+		}
+		g := group(c)
+		if err := cors(c); err != nil {
+			return err
+		}
+		// Refusals are not cached, so a newly allowed origin works at once
+		allowed := len(c.Response().Header.Peek(fiber.HeaderAccessControlAllowOrigin)) > 0
+		if allowed {
+			c.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(maxAge(g)))
+		}
+		stats.Record(g, allowed)
+		return nil
+	}
+}
+
+type preflightKey struct {
+	group   string
+	allowed bool
+}
+
+// PreflightStats counts CORS preflights per route group and whether
+// their origin was allowed
+type PreflightStats struct {
+	mu     sync.Mutex
+	counts map[preflightKey]uint64
+}
+
+func NewPreflightStats() *PreflightStats {
+	return &PreflightStats{counts: map[preflightKey]uint64{}}
+}
+
+var sharedPreflights = NewPreflightStats()
+
+// Preflights returns the process-wide preflight counts that /metrics
+// reports
+func Preflights() *PreflightStats {
+	return sharedPreflights
+}
+
+// Record counts a preflight of group
+func (s *PreflightStats) Record(group string, allowed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[preflightKey{group, allowed}]++
+}
+
+// Count returns the preflights of group counted so far
+func (s *PreflightStats) Count(group string, allowed bool) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[preflightKey{group, allowed}]
+}
+
+// WritePrometheus writes the counts as the counter
+// cctv_cors_preflights_total in the Prometheus text format
+func (s *PreflightStats) WritePrometheus(w io.Writer) error {
+	s.mu.Lock()
+	keys := make([]preflightKey, 0, len(s.counts))
+	counts := make(map[preflightKey]uint64, len(s.counts))
+	for k, n := range s.counts {
+		keys = append(keys, k)
+		counts[k] = n
+	}
+	s.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].allowed && !keys[j].allowed
+	})
+
+	if _, err := io.WriteString(w, "# HELP cctv_cors_preflights_total CORS preflight requests answered, by route group and result.\n"+
+		"# TYPE cctv_cors_preflights_total counter\n"); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		result := "refused"
+		if k.allowed {
+			result = "allowed"
+		}
+		if _, err := fmt.Fprintf(w, "cctv_cors_preflights_total{group=%q,result=%q} %d\n", k.group, result, counts[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+func TestPreflight(t *testing.T) {
+	groups := map[string]string{"/public": "public", "/admin": "admin"}
+	group := func(c *fiber.Ctx) string { return groups[c.Path()] }
+	stats := NewPreflightStats()
+	reached := 0
+
+	app := fiber.New()
+	app.Use(Preflight(CORS(cors.Config{AllowCredentials: true}, func(c *fiber.Ctx) []string {
+		return []string{"https://cctv.example"}
+	}), group, func(group string) int {
+		if group == "public" {
+			return 7200
+		}
+		return 600
+	}, stats))
+	app.Use(func(c *fiber.Ctx) error {
+		reached++
+		return c.Next()
+	})
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+
+	preflight := func(path, origin, method string) *http.Response {
+		req := httptest.NewRequest("OPTIONS", path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method != "" {
+			req.Header.Set("Access-Control-Request-Method", method)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	for _, tc := range []struct {
+		path, origin, maxAge string
+	}{
+		{"/public", "https://cctv.example", "7200"},
+		{"/admin", "https://cctv.example", "600"},
+		{"/admin", "https://partner.example", ""},
+	} {
+		resp := preflight(tc.path, tc.origin, "GET")
+		if resp.StatusCode != 204 {
+			t.Errorf("%s from %s: expected 204, got %d", tc.path, tc.origin, resp.StatusCode)
+		}
+		if h := resp.Header.Get("Access-Control-Max-Age"); h != tc.maxAge {
+			t.Errorf("%s from %s: expected max age '%s', got '%s'", tc.path, tc.origin, tc.maxAge, h)
+		}
+	}
+	if reached != 0 {
+		t.Errorf("Expected preflights to skip later middleware, %d reached it", reached)
+	}
+
+	// Plain OPTIONS requests are not preflights
+	preflight("/public", "", "GET")
+	preflight("/public", "https://cctv.example", "")
+	if reached != 2 {
+		t.Errorf("Expected other OPTIONS requests to go on, %d reached later middleware", reached)
+	}
+
+	if stats.Count("public", true) != 1 || stats.Count("admin", true) != 1 || stats.Count("admin", false) != 1 {
+		t.Errorf("Expected one preflight of each, got %+v", stats.counts)
+	}
+	var buf bytes.Buffer
+	if err := stats.WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `cctv_cors_preflights_total{group="admin",result="refused"} 1`) {
+		t.Errorf("Expected the refused admin preflight, got:\n%s", buf.String())
+	}
+}
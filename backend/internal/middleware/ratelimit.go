@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Counter counts a client's requests in the current window. It returns
+// the count including this request and the time until the window ends.
+type Counter interface {
+	Hit(ctx context.Context, client string, window time.Duration) (int, time.Duration, error)
+}
+
+// RateLimit allows each client IP limit() requests per window, counted
+// in fixed windows in this process. limit is read on every request so a
+// config reload takes effect immediately; zero or less disables the
+// limit.
+func RateLimit(limit func() int, window time.Duration) fiber.Handler {
+	return RateLimitWith(newMemoryCounter(), limit, window)
+}
+
+// RateLimitWith is RateLimit with the counts kept by counter, such as
+// one shared by every instance behind a load balancer. When the counter
+// fails the request is let through.
+func RateLimitWith(counter Counter, limit func() int, window time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		max := limit()
+		if max <= 0 {
+			return c.Next()
+		}
+
+		count, reset, err := counter.Hit(c.UserContext(), c.IP(), window)
+		if err != nil {
+			logger.FromContext(c.UserContext()).Warn("Rate limit unavailable", "error", err)
+			return c.Next()
+		}
+
+		if count > max {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(reset.Seconds())+1))
+			return response.Fail(c, fiber.StatusTooManyRequests, "Too many requests, please try again later")
+		}
+		return c.Next()
+	}
+}
+
+// memoryCounter forgets every client at once when a window ends
+type memoryCounter struct {
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+func newMemoryCounter() *memoryCounter {
+	return &memoryCounter{start: time.Now(), counts: map[string]int{}}
+}
+
+func (m *memoryCounter) Hit(_ context.Context, client string, window time.Duration) (int, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.start) >= window {
+		m.start = now
+		m.counts = map[string]int{}
+	}
+	m.counts[client]++
+	return m.counts[client], m.start.Add(window).Sub(now), nil
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRateLimit(t *testing.T) {
+	limit := 2
+
+	app := fiber.New()
+	app.Use(RateLimit(func() int { return limit }, time.Minute))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+
+	get := func() int {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/test", nil))
+		return resp.StatusCode
+	}
+
+	t.Run("Blocks after the limit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if status := get(); status != 200 {
+				t.Fatalf("Expected request %d to pass, got %d", i+1, status)
+			}
+		}
+
+		resp, _ := app.Test(httptest.NewRequest("GET", "/test", nil))
+		if resp.StatusCode != 429 {
+			t.Errorf("Expected status 429, got %d", resp.StatusCode)
+		}
+		if resp.Header.Get("Retry-After") == "" {
+			t.Error("Expected a Retry-After header")
+		}
+	})
+
+	t.Run("Raised limit applies at once", func(t *testing.T) {
+		limit = 10
+		if status := get(); status != 200 {
+			t.Errorf("Expected status 200 after raising the limit, got %d", status)
+		}
+	})
+
+	t.Run("Zero disables the limit", func(t *testing.T) {
+		limit = 0
+		for i := 0; i < 20; i++ {
+			if status := get(); status != 200 {
+				t.Fatalf("Expected status 200, got %d", status)
+			}
+		}
+	})
+}
+
+type failingCounter struct{}
+
+func (failingCounter) Hit(context.Context, string, time.Duration) (int, time.Duration, error) {
+	return 0, 0, errors.New("database is down")
+}
+
+func TestRateLimitWith(t *testing.T) {
+	t.Run("Instances share a counter", func(t *testing.T) {
+		counter := newMemoryCounter()
+		var apps []*fiber.App
+		for i := 0; i < 2; i++ {
+			app := fiber.New()
+			app.Use(RateLimitWith(counter, func() int { return 3 }, time.Minute))
+			app.Get("/test", func(c *fiber.Ctx) error { return c.SendString("OK") })
+			apps = append(apps, app)
+		}
+
+		var statuses []int
+		for i := 0; i < 4; i++ {
+			resp, _ := apps[i%2].Test(httptest.NewRequest("GET", "/test", nil))
+			statuses = append(statuses, resp.StatusCode)
+		}
+		if statuses[2] != 200 || statuses[3] != 429 {
+			t.Errorf("Expected the fourth request across both apps refused, got %v", statuses)
+		}
+	})
+
+	t.Run("Failing counter lets requests through", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(RateLimitWith(failingCounter{}, func() int { return 1 }, time.Minute))
+		app.Get("/test", func(c *fiber.Ctx) error { return c.SendString("OK") })
+
+		for i := 0; i < 3; i++ {
+			resp, _ := app.Test(httptest.NewRequest("GET", "/test", nil))
+			if resp.StatusCode != 200 {
+				t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+			}
+		}
+	})
+}
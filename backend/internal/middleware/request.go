@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/accesslog"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// RequestIDHeader carries the correlation ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID tags each request with an ID, reusing the caller's
+// X-Request-ID when it looks sane. The ID is echoed in the response and
+// attached to the request logger, which handlers reach through
+// logger.FromContext(c.UserContext()).
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = utils.UUIDv4()
+		}
+
+		c.Locals("request_id", id)
+		c.Set(RequestIDHeader, id)
+
+		l := logger.L().With("request_id", id)
+		c.SetUserContext(logger.WithContext(c.UserContext(), l))
+
+		return c.Next()
+	}
+}
+
+// InstanceIDHeader names the instance that served a response in cluster
+// mode, to tell instances apart behind the load balancer
+const InstanceIDHeader = "X-Instance-ID"
+
+// InstanceID sets InstanceIDHeader on every response
+func InstanceID(id string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(InstanceIDHeader, id)
+		return c.Next()
+	}
+}
+
+// AccessLog writes one line per request with status and latency, and
+// hands the request to each sink for later queries. Errors are passed to
+// the app's error handler first so the logged status is the one the
+// client receives.
+func AccessLog(sinks ...accesslog.Sink) fiber.Handler {
+	// A disabled sink is nil
+	var active []accesslog.Sink
+	for _, sink := range sinks {
+		if sink != nil {
+			active = append(active, sink)
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		if err := c.Next(); err != nil {
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		latency := time.Since(start)
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		logger.FromContext(c.UserContext()).Log(c.UserContext(), level, "request",
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"latency_ms", latency.Milliseconds(),
+			"ip", c.IP(),
+		)
+
+		if len(active) > 0 {
+			// Copy the strings: Fiber reuses their memory once the
+			// handler returns
+			e := accesslog.Entry{
+				Time:      start,
+				Method:    c.Method(),
+				Path:      utils.CopyString(c.Path()),
+				Status:    status,
+				LatencyMs: latency.Milliseconds(),
+				IP:        utils.CopyString(c.IP()),
+			}
+			if id, ok := c.Locals("user_id").(int); ok {
+				e.UserID = &id
+			}
+			if id, ok := c.Locals("request_id").(string); ok {
+				e.RequestID = utils.CopyString(id)
+			}
+			for _, sink := range active {
+				sink.Write(e)
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/accesslog"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequestID(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("request_id").(string))
+	})
+
+	t.Run("Generates an ID", func(t *testing.T) {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/test", nil))
+
+		id := resp.Header.Get(RequestIDHeader)
+		if len(id) != 36 {
+			t.Errorf("Expected generated UUID, got '%s'", id)
+		}
+	})
+
+	t.Run("Reuses the caller's ID", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set(RequestIDHeader, "trace-123")
+
+		resp, _ := app.Test(req)
+		if id := resp.Header.Get(RequestIDHeader); id != "trace-123" {
+			t.Errorf("Expected 'trace-123', got '%s'", id)
+		}
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	restore := logger.L()
+	defer logger.Set(restore)
+	logger.Set(logger.New(&buf, "production", ""))
+
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Use(AccessLog())
+	app.Get("/missing", func(c *fiber.Ctx) error {
+		return fiber.ErrNotFound
+	})
+
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set(RequestIDHeader, "trace-456")
+	resp, _ := app.Test(req)
+
+	if resp.StatusCode != 404 {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &line); err != nil {
+		t.Fatalf("Expected one JSON access log line, got: %s", buf.String())
+	}
+	if line["request_id"] != "trace-456" {
+		t.Errorf("Expected request_id 'trace-456', got %v", line["request_id"])
+	}
+	if line["status"] != float64(404) {
+		t.Errorf("Expected status 404, got %v", line["status"])
+	}
+	if line["level"] != "WARN" {
+		t.Errorf("Expected level WARN, got %v", line["level"])
+	}
+	if _, ok := line["latency_ms"]; !ok || !strings.Contains(buf.String(), `"path":"/missing"`) {
+		t.Errorf("Expected latency and path in log line, got: %s", buf.String())
+	}
+}
+
+type recordingSink struct {
+	entries []accesslog.Entry
+}
+
+func (s *recordingSink) Write(e accesslog.Entry)         { s.entries = append(s.entries, e) }
+func (s *recordingSink) Close(ctx context.Context) error { return nil }
+
+func TestAccessLogSinks(t *testing.T) {
+	sink := &recordingSink{}
+
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Use(AccessLog(nil, sink))
+	app.Get("/api/cameras", func(c *fiber.Ctx) error {
+		c.Locals("user_id", 42)
+		return fiber.ErrForbidden
+	})
+
+	req := httptest.NewRequest("GET", "/api/cameras", nil)
+	req.Header.Set(RequestIDHeader, "trace-789")
+	app.Test(req)
+
+	if len(sink.entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(sink.entries))
+	}
+	e := sink.entries[0]
+	if e.Method != "GET" || e.Path != "/api/cameras" || e.Status != 403 || e.RequestID != "trace-789" {
+		t.Errorf("Expected GET /api/cameras 403 trace-789, got %+v", e)
+	}
+	if e.UserID == nil || *e.UserID != 42 {
+		t.Errorf("Expected user 42, got %v", e.UserID)
+	}
+	if e.IP == "" || e.Time.IsZero() {
+		t.Errorf("Expected IP and time, got %+v", e)
+	}
+}
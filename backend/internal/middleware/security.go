@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+)
+
+// DefaultContentSecurityPolicy lets the player work: hls.js and MSE play
+// from blob: URLs and run blob: workers, and snapshots or streams may be
+// served from another HTTPS origin. frame-ancestors is appended per
+// request by SecurityHeaders.
+const DefaultContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: blob: https:; " +
+	"media-src 'self' blob: https:; " +
+	"connect-src 'self' https: wss:; " +
+	"worker-src 'self' blob:; " +
+	"object-src 'none'; " +
+	"base-uri 'self'"
+
+// EmbedPrefix marks pages meant to be framed by other sites
+const EmbedPrefix = "/embed"
+
+// SecurityHeaders sets the helmet-style response headers. csp replaces
+// DefaultContentSecurityPolicy when set; reportOnly sends it as
+// Content-Security-Policy-Report-Only so violations are logged by the
+// browser instead of blocked. Paths under /embed skip X-Frame-Options and
+// may be framed by embedAncestors (a CSP source list such as "*" or
+// "https://example.com"); everything else is same-origin only.
+func SecurityHeaders(csp string, reportOnly bool, embedAncestors string) fiber.Handler {
+	if csp == "" {
+		csp = DefaultContentSecurityPolicy
+	}
+	csp = strings.TrimRight(strings.TrimSpace(csp), ";")
+
+	cspHeader := fiber.HeaderContentSecurityPolicy
+	if reportOnly {
+		cspHeader = fiber.HeaderContentSecurityPolicyReportOnly
+	}
+
+	if embedAncestors == "" {
+		embedAncestors = "'self'"
+	}
+	framedPolicy := csp + "; frame-ancestors " + embedAncestors
+	policy := csp + "; frame-ancestors 'self'"
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		c.Set(fiber.HeaderReferrerPolicy, "strict-origin-when-cross-origin")
+
+		if isEmbed(c.Path()) {
+			c.Set(cspHeader, framedPolicy)
+		} else {
+			c.Set(cspHeader, policy)
+			c.Set(fiber.HeaderXFrameOptions, "SAMEORIGIN")
+		}
+
+		return c.Next()
+	}
+}
+
+func isEmbed(path string) bool {
+	return path == EmbedPrefix || strings.HasPrefix(path, EmbedPrefix+"/")
+}
+
+// Compress gzips or brotli-encodes responses, whichever the client
+// prefers. level is off, speed, default or best. Only text and
+// application/* bodies are compressed, which covers JSON and HLS
+// playlists; video segments and the MSE stream are sent as they are.
+func Compress(level string) fiber.Handler {
+	return compress.New(compress.Config{Level: compressionLevel(level)})
+}
+
+func compressionLevel(level string) compress.Level {
+	switch strings.ToLower(level) {
+	case "speed":
+		return compress.LevelBestSpeed
+	case "default":
+		return compress.LevelDefault
+	case "best":
+		return compress.LevelBestCompression
+	}
+	return compress.LevelDisabled
+}
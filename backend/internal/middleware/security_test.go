@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	app := fiber.New()
+	app.Use(SecurityHeaders("", false, "https://partner.example"))
+	app.Get("/*", func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+
+	t.Run("Regular pages are same-origin only", func(t *testing.T) {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/api/cameras/active", nil))
+
+		if h := resp.Header.Get("X-Frame-Options"); h != "SAMEORIGIN" {
+			t.Errorf("Expected X-Frame-Options SAMEORIGIN, got '%s'", h)
+		}
+		if h := resp.Header.Get("X-Content-Type-Options"); h != "nosniff" {
+			t.Errorf("Expected nosniff, got '%s'", h)
+		}
+		if h := resp.Header.Get("Referrer-Policy"); h != "strict-origin-when-cross-origin" {
+			t.Errorf("Expected Referrer-Policy, got '%s'", h)
+		}
+
+		csp := resp.Header.Get("Content-Security-Policy")
+		if !strings.Contains(csp, "media-src 'self' blob:") {
+			t.Errorf("Expected CSP to allow blob: media for the player, got '%s'", csp)
+		}
+		if !strings.HasSuffix(csp, "frame-ancestors 'self'") {
+			t.Errorf("Expected frame-ancestors 'self', got '%s'", csp)
+		}
+	})
+
+	t.Run("Embed pages can be framed", func(t *testing.T) {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/embed/cam-1", nil))
+
+		if h := resp.Header.Get("X-Frame-Options"); h != "" {
+			t.Errorf("Expected no X-Frame-Options on /embed, got '%s'", h)
+		}
+		if csp := resp.Header.Get("Content-Security-Policy"); !strings.HasSuffix(csp, "frame-ancestors https://partner.example") {
+			t.Errorf("Expected embed frame-ancestors, got '%s'", csp)
+		}
+	})
+
+	t.Run("Prefix match is per path segment", func(t *testing.T) {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/embedded", nil))
+		if h := resp.Header.Get("X-Frame-Options"); h != "SAMEORIGIN" {
+			t.Errorf("Expected X-Frame-Options SAMEORIGIN, got '%s'", h)
+		}
+	})
+
+	t.Run("Report-only mode", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(SecurityHeaders("default-src 'self';", true, ""))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendString("OK")
+		})
+
+		resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+		if h := resp.Header.Get("Content-Security-Policy"); h != "" {
+			t.Errorf("Expected no enforced CSP, got '%s'", h)
+		}
+		if h := resp.Header.Get("Content-Security-Policy-Report-Only"); h != "default-src 'self'; frame-ancestors 'self'" {
+			t.Errorf("Expected report-only CSP, got '%s'", h)
+		}
+	})
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat(`{"name":"camera"},`, 200)
+
+	app := fiber.New()
+	app.Use(Compress("speed"))
+	app.Get("/json", func(c *fiber.Ctx) error {
+		c.Type("json")
+		return c.SendString(body)
+	})
+	app.Get("/playlist.m3u8", func(c *fiber.Ctx) error {
+		c.Set("Content-Type", "application/vnd.apple.mpegurl")
+		return c.SendString(body)
+	})
+	app.Get("/segment.ts", func(c *fiber.Ctx) error {
+		c.Set("Content-Type", "video/mp2t")
+		return c.SendString(body)
+	})
+
+	tests := []struct {
+		path     string
+		encoding string
+		want     string
+	}{
+		{"/json", "gzip", "gzip"},
+		{"/json", "br", "br"},
+		{"/playlist.m3u8", "gzip", "gzip"},
+		{"/segment.ts", "gzip", ""},
+		{"/json", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.encoding, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.encoding != "" {
+				req.Header.Set("Accept-Encoding", tt.encoding)
+			}
+			resp, _ := app.Test(req)
+
+			if h := resp.Header.Get("Content-Encoding"); h != tt.want {
+				t.Errorf("Expected Content-Encoding '%s', got '%s'", tt.want, h)
+			}
+			if tt.want == "" {
+				got, _ := io.ReadAll(resp.Body)
+				if string(got) != body {
+					t.Error("Expected the body to pass through unchanged")
+				}
+			}
+		})
+	}
+
+	t.Run("Off disables compression", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(Compress("off"))
+		app.Get("/", func(c *fiber.Ctx) error {
+			c.Type("json")
+			return c.SendString(body)
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, _ := app.Test(req)
+
+		if h := resp.Header.Get("Content-Encoding"); h != "" {
+			t.Errorf("Expected no compression, got '%s'", h)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+	"github.com/abcdefak87/cctv/pkg/response"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Organization scopes requests made without a token, such as the public
+// camera list, to an organization: the one named by ?org=<slug>, else the
+// one whose domain is the request host, else the default. AuthMiddleware
+// replaces it with the user's organization on protected routes.
+func Organization(resolver *tenant.Resolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+
+		var id int
+		var ok bool
+		if slug := c.Query("org"); slug != "" {
+			var err error
+			id, ok, err = resolver.Slug(ctx, slug)
+			if err != nil {
+				logger.FromContext(ctx).Error("Failed to resolve organization", "error", err)
+				return response.Fail(c, fiber.StatusInternalServerError, "Failed to resolve organization")
+			}
+			if !ok {
+				return response.Fail(c, fiber.StatusNotFound, "Organization not found")
+			}
+		} else {
+			// Most hosts are not an organization's domain, so a failed
+			// lookup only costs the default organization
+			var err error
+			id, ok, err = resolver.Domain(ctx, c.Hostname())
+			if err != nil {
+				logger.FromContext(ctx).Warn("Failed to resolve organization domain", "error", err)
+			}
+		}
+
+		if ok {
+			c.Locals("org_id", id)
+			c.SetUserContext(tenant.WithOrg(ctx, id))
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOrganization(t *testing.T) {
+	db := dbtest.Open(t)
+	if _, err := db.Exec(`INSERT INTO organizations (name, slug, domain) VALUES ('Dander', 'dander', 'cctv.dander.desa.id')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(Organization(tenant.NewResolver(db)))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(tenant.OrgID(c.UserContext())))
+	})
+
+	get := func(url, host string) (int, string) {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Host = host
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body := make([]byte, 16)
+		n, _ := resp.Body.Read(body)
+		return resp.StatusCode, string(body[:n])
+	}
+
+	for _, tc := range []struct {
+		name, url, host string
+		want            string
+	}{
+		{"Slug", "/test?org=Dander", "example.com", "2"},
+		{"Domain", "/test", "cctv.dander.desa.id:8080", "2"},
+		{"Default", "/test", "example.com", "1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := get(tc.url, tc.host)
+			if status != 200 || body != tc.want {
+				t.Errorf("Expected org %s, got %s (status %d)", tc.want, body, status)
+			}
+		})
+	}
+
+	t.Run("Unknown slug", func(t *testing.T) {
+		if status, _ := get("/test?org=nowhere", "example.com"); status != 404 {
+			t.Errorf("Expected status 404, got %d", status)
+		}
+	})
+}
+
+func TestAuthMiddlewareOrganization(t *testing.T) {
+	secret := "test-secret"
+
+	app := fiber.New()
+	app.Use(AuthMiddleware(secret))
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return c.SendString(strconv.Itoa(tenant.OrgID(c.UserContext())))
+	})
+
+	get := func(claims jwt.MapClaims, header string) (int, string) {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if header != "" {
+			req.Header.Set(OrganizationHeader, header)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body := make([]byte, 16)
+		n, _ := resp.Body.Read(body)
+		return resp.StatusCode, string(body[:n])
+	}
+
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		header string
+		want   string
+	}{
+		{"Claim", jwt.MapClaims{"user_id": 2, "role": "org_admin", "org_id": 3}, "", "3"},
+		{"Token without org", jwt.MapClaims{"user_id": 2, "role": "user"}, "", "1"},
+		{"Admin picks an org", jwt.MapClaims{"user_id": 1, "role": "admin", "org_id": 1}, "4", "4"},
+		{"Header ignored for others", jwt.MapClaims{"user_id": 2, "role": "org_admin", "org_id": 3}, "4", "3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := get(tc.claims, tc.header)
+			if status != 200 || body != tc.want {
+				t.Errorf("Expected org %s, got %s (status %d)", tc.want, body, status)
+			}
+		})
+	}
+
+	t.Run("Invalid header", func(t *testing.T) {
+		if status, _ := get(jwt.MapClaims{"user_id": 1, "role": "admin"}, "abc"); status != 400 {
+			t.Errorf("Expected status 400, got %d", status)
+		}
+	})
+}
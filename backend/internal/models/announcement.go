@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Announcement severities, least urgent first
+const (
+	AnnouncementInfo     = "info"
+	AnnouncementWarning  = "warning"
+	AnnouncementCritical = "critical"
+)
+
+// Announcement is a notice for the landing page, such as an outage. It
+// shows from StartsAt until EndsAt, or until removed when EndsAt is nil.
+// An empty AreaIDs targets every area.
+type Announcement struct {
+	ID        int        `json:"id" db:"id"`
+	Title     string     `json:"title" db:"title"`
+	Body      string     `json:"body" db:"body"`
+	Severity  string     `json:"severity" db:"severity"`
+	StartsAt  time.Time  `json:"starts_at" db:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at" db:"ends_at"`
+	AreaIDs   []int      `json:"area_ids" db:"-"`
+	CreatedBy *int       `json:"created_by,omitempty" db:"created_by"` // admin responses only
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// APIKey lets a third party read the public camera lists, stream stats
+// and streams. It may make RequestsPerDay requests per UTC day and have
+// MaxStreams streams open at once; zero means no limit. Today holds the
+// day's usage so far.
+type APIKey struct {
+	ID             int         `json:"id" db:"id"`
+	Name           string      `json:"name" db:"name"`
+	RequestsPerDay int         `json:"requests_per_day" db:"requests_per_day"`
+	MaxStreams     int         `json:"max_streams" db:"max_streams"`
+	Today          APIKeyUsage `json:"today" db:"-"`
+	CreatedAt      time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// APIKeyUsage is what a key used on one UTC day. Requests includes
+// those Refused for being over the quota; StreamsRefused counts streams
+// refused for being over MaxStreams.
+type APIKeyUsage struct {
+	Day            string `json:"day" db:"day"`
+	Requests       int    `json:"requests" db:"requests"`
+	Refused        int    `json:"refused" db:"refused"`
+	StreamsRefused int    `json:"streams_refused" db:"streams_refused"`
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Area levels from the widest administrative unit to the narrowest
+var AreaLevels = []string{"kecamatan", "kelurahan", "rw", "rt"}
+
+type Area struct {
+	ID                int       `json:"id" db:"id"`
+	Name              string    `json:"name" db:"name"`
+	Slug              string    `json:"slug" db:"slug"` // of its public page
+	Description       string    `json:"description" db:"description"`
+	ParentID          *int      `json:"parent_id" db:"parent_id"`
+	Level             string    `json:"level" db:"level"`
+	RT                string    `json:"rt" db:"rt"`
+	RW                string    `json:"rw" db:"rw"`
+	Kelurahan         string    `json:"kelurahan" db:"kelurahan"`
+	Kecamatan         string    `json:"kecamatan" db:"kecamatan"`
+	CameraCount       int       `json:"camera_count"`
+	ActiveCameraCount int       `json:"active_camera_count"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+
+	// GeoJSON Polygon/MultiPolygon, only loaded for single-area responses
+	Boundary json.RawMessage `json:"boundary,omitempty" db:"boundary"`
+
+	// Tree responses only
+	TotalCameraCount       int     `json:"total_camera_count,omitempty"`
+	TotalActiveCameraCount int     `json:"total_active_camera_count,omitempty"`
+	Children               []*Area `json:"children,omitempty"`
+}
+
+// IsValidAreaLevel reports whether level is empty or one of AreaLevels
+func IsValidAreaLevel(level string) bool {
+	if level == "" {
+		return true
+	}
+	for _, l := range AreaLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// AreaSlug makes the slug of an area's public page from its name: lower
+// case letters and digits, with a dash for each run of anything else,
+// such as kelurahan-cempaka-putih or rt-01-rw-05
+func AreaSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+		if b.Len() >= maxAreaSlug {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "area"
+	}
+	return b.String()
+}
+
+// maxAreaSlug bounds the slugs made from names
+const maxAreaSlug = 80
+
+// BuildAreaTree nests areas under their parents and sums camera counts
+// over each subtree. Areas whose parent is missing become roots.
+func BuildAreaTree(areas []*Area) []*Area {
+	byID := make(map[int]*Area, len(areas))
+	for _, a := range areas {
+		a.Children = nil
+		byID[a.ID] = a
+	}
+
+	roots := []*Area{}
+	for _, a := range areas {
+		if a.ParentID != nil {
+			if parent, ok := byID[*a.ParentID]; ok && parent != a {
+				parent.Children = append(parent.Children, a)
+				continue
+			}
+		}
+		roots = append(roots, a)
+	}
+
+	for _, root := range roots {
+		sumAreaCounts(root, map[int]bool{})
+	}
+
+	return roots
+}
+
+func sumAreaCounts(a *Area, visited map[int]bool) {
+	visited[a.ID] = true
+	a.TotalCameraCount = a.CameraCount
+	a.TotalActiveCameraCount = a.ActiveCameraCount
+	for _, child := range a.Children {
+		if visited[child.ID] {
+			continue
+		}
+		sumAreaCounts(child, visited)
+		a.TotalCameraCount += child.TotalCameraCount
+		a.TotalActiveCameraCount += child.TotalActiveCameraCount
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestBuildAreaTree(t *testing.T) {
+	t.Run("Nests children and sums counts", func(t *testing.T) {
+		kecamatan := 1
+		kelurahan := 2
+		areas := []*Area{
+			{ID: 1, Name: "Dander", Level: "kecamatan", CameraCount: 1, ActiveCameraCount: 1},
+			{ID: 2, Name: "Ngumpakdalem", Level: "kelurahan", ParentID: &kecamatan, CameraCount: 2, ActiveCameraCount: 1},
+			{ID: 3, Name: "RT 01", Level: "rt", ParentID: &kelurahan, CameraCount: 3, ActiveCameraCount: 3},
+			{ID: 4, Name: "Tanjungharjo", Level: "kelurahan", CameraCount: 4},
+		}
+
+		roots := BuildAreaTree(areas)
+
+		if len(roots) != 2 {
+			t.Fatalf("Expected 2 roots, got %d", len(roots))
+		}
+
+		dander := roots[0]
+		if len(dander.Children) != 1 || dander.Children[0].ID != 2 {
+			t.Errorf("Expected Dander to have child 2, got %+v", dander.Children)
+		}
+
+		if dander.TotalCameraCount != 6 {
+			t.Errorf("Expected total camera count 6, got %d", dander.TotalCameraCount)
+		}
+
+		if dander.TotalActiveCameraCount != 5 {
+			t.Errorf("Expected total active camera count 5, got %d", dander.TotalActiveCameraCount)
+		}
+	})
+
+	t.Run("Missing parent becomes root", func(t *testing.T) {
+		missing := 99
+		roots := BuildAreaTree([]*Area{{ID: 1, Name: "Orphan", ParentID: &missing}})
+
+		if len(roots) != 1 {
+			t.Errorf("Expected orphan to be a root, got %d roots", len(roots))
+		}
+	})
+}
+
+func TestIsValidAreaLevel(t *testing.T) {
+	for _, level := range []string{"", "kecamatan", "kelurahan", "rw", "rt"} {
+		if !IsValidAreaLevel(level) {
+			t.Errorf("Expected level '%s' to be valid", level)
+		}
+	}
+
+	if IsValidAreaLevel("provinsi") {
+		t.Error("Expected level 'provinsi' to be invalid")
+	}
+}
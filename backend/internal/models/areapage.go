@@ -0,0 +1,39 @@
+package models
+
+// AreaPage is what the public page of one area shows: its cameras and
+// those of the areas inside it, how many are online and watched, and
+// the announcements for it
+type AreaPage struct {
+	ID            int              `json:"id"`
+	Slug          string           `json:"slug"`
+	Name          string           `json:"name"`
+	Description   string           `json:"description"`
+	Level         string           `json:"level"`
+	Parent        *AreaLink        `json:"parent"`
+	Children      []AreaLink       `json:"children"`
+	Cameras       []AreaPageCamera `json:"cameras"`
+	Online        AreaOnline       `json:"online"`
+	Announcements []Announcement   `json:"announcements"`
+}
+
+// AreaLink points to the page of another area
+type AreaLink struct {
+	ID   int    `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// AreaPageCamera is a camera on an area page with its latest snapshot
+type AreaPageCamera struct {
+	PublicCamera
+	ThumbnailURL string `json:"thumbnail_url"`
+	Online       bool   `json:"online"`
+	Viewers      int    `json:"viewers"` // watching now
+}
+
+// AreaOnline counts the cameras online and the viewers watching now
+type AreaOnline struct {
+	Cameras       int `json:"cameras"`
+	CamerasOnline int `json:"cameras_online"`
+	Viewers       int `json:"viewers"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// Bootstrap is everything the public page reads on load, in one
+// response instead of a request each
+type Bootstrap struct {
+	Branding      map[string]interface{} `json:"branding"`
+	LandingPage   map[string]interface{} `json:"landing_page"`
+	MapCenter     map[string]interface{} `json:"map_center"`
+	Saweria       map[string]interface{} `json:"saweria"`
+	Areas         []*Area                `json:"areas"`
+	Announcements []Announcement         `json:"announcements"`
+	Features      Features               `json:"features"`
+}
+
+// Features are the optional parts of the public page this server has
+// turned on
+type Features struct {
+	Weather      bool `json:"weather"`
+	Saweria      bool `json:"saweria"`
+	MultiviewMax int  `json:"multiview_max"` // cameras one grid view may show
+}
@@ -10,8 +10,30 @@ type Camera struct {
 	Location       string    `json:"location" db:"location"`
 	GroupName      string    `json:"group_name" db:"group_name"`
 	AreaID         *int      `json:"area_id" db:"area_id"`
+	Latitude       *float64  `json:"latitude" db:"latitude"`
+	Longitude      *float64  `json:"longitude" db:"longitude"`
 	Enabled        bool      `json:"enabled" db:"enabled"`
+	Traffic        bool      `json:"traffic" db:"traffic"`                     // reads licence plates
+	Watermark      bool      `json:"watermark" db:"watermark"`                 // branding burned into the stream
+	Recording      bool      `json:"recording_enabled" db:"recording_enabled"` // footage is kept by the recorder
 	StreamKey      string    `json:"stream_key" db:"stream_key"`
+	StreamNode     *string   `json:"stream_node" db:"stream_node"` // secondary go2rtc from STREAM_NODES; nil is the local one
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+	AreaName       *string   `json:"area_name,omitempty" db:"area_name"`
+}
+
+// PublicCamera is the camera view served to anonymous viewers; it leaves
+// out the RTSP source and admin fields.
+type PublicCamera struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Location    string   `json:"location"`
+	GroupName   string   `json:"group_name"`
+	StreamKey   string   `json:"stream_key"`
+	AreaID      *int     `json:"area_id,omitempty"`
+	AreaName    *string  `json:"area_name,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// CameraNote is a free-text maintenance note on a camera, such as its
+// ISP circuit ID or pole number
+type CameraNote struct {
+	ID        int64     `json:"id" db:"id"`
+	CameraID  int       `json:"camera_id" db:"camera_id"`
+	Body      string    `json:"body" db:"body"`
+	CreatedBy *int      `json:"created_by" db:"created_by"` // nil once the user is deleted
+	Author    string    `json:"author" db:"-"`              // username of CreatedBy
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CameraAttachment is a file attached to a camera, such as a photo of
+// its installation. The file is an upload; URL is where it is served.
+type CameraAttachment struct {
+	ID          int64     `json:"id" db:"id"`
+	CameraID    int       `json:"camera_id" db:"camera_id"`
+	Name        string    `json:"name" db:"name"`
+	Key         string    `json:"key" db:"upload_key"`
+	URL         string    `json:"url" db:"-"`
+	ContentType string    `json:"content_type" db:"-"`
+	Size        int       `json:"size" db:"-"`
+	Width       int       `json:"width" db:"-"`
+	Height      int       `json:"height" db:"-"`
+	CreatedBy   *int      `json:"created_by" db:"created_by"`
+	Author      string    `json:"author" db:"-"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import "net/url"
+
+// CameraView is how much of a camera a role may see. Every response
+// carrying cameras to signed-in users goes through one, so a field
+// added to Camera is only shown to admins until a view lets it out.
+type CameraView int
+
+const (
+	// CameraViewFull is the camera as stored, for admins and org admins
+	CameraViewFull CameraView = iota
+	// CameraViewOperator leaves out credentials: the RTSP URL keeps its
+	// host and path but loses its user, password and query
+	CameraViewOperator
+	// CameraViewPublic is the PublicCamera anonymous viewers get; a
+	// disabled camera's stream key is left out, as the public never
+	// sees those
+	CameraViewPublic
+)
+
+// CameraViewFor returns the view of role. Roles it does not know, such
+// as the older "user", get the public view.
+func CameraViewFor(role string) CameraView {
+	switch role {
+	case RoleAdmin, RoleOrgAdmin:
+		return CameraViewFull
+	case RoleOperator:
+		return CameraViewOperator
+	}
+	return CameraViewPublic
+}
+
+// Sample is a zero value of the type the view returns, for reflecting
+// on its fields
+func (v CameraView) Sample() interface{} {
+	if v == CameraViewPublic {
+		return PublicCamera{}
+	}
+	return Camera{}
+}
+
+// One returns camera as the view shows it
+func (v CameraView) One(camera Camera) interface{} {
+	switch v {
+	case CameraViewFull:
+		return camera
+	case CameraViewOperator:
+		camera.PrivateRTSPURL = redactURL(camera.PrivateRTSPURL)
+		return camera
+	}
+	public := PublicCamera{
+		ID:          camera.ID,
+		Name:        camera.Name,
+		Description: camera.Description,
+		Location:    camera.Location,
+		GroupName:   camera.GroupName,
+		AreaID:      camera.AreaID,
+		AreaName:    camera.AreaName,
+		Latitude:    camera.Latitude,
+		Longitude:   camera.Longitude,
+	}
+	if camera.Enabled {
+		public.StreamKey = camera.StreamKey
+	}
+	return public
+}
+
+// List returns cameras as the view shows them, as a slice of the type
+// Sample returns
+func (v CameraView) List(cameras []Camera) interface{} {
+	switch v {
+	case CameraViewFull:
+		return cameras
+	case CameraViewOperator:
+		out := make([]Camera, len(cameras))
+		for i, camera := range cameras {
+			out[i] = v.One(camera).(Camera)
+		}
+		return out
+	}
+	out := make([]PublicCamera, len(cameras))
+	for i, camera := range cameras {
+		out[i] = v.One(camera).(PublicCamera)
+	}
+	return out
+}
+
+// redactURL drops the user, password and query of a stream URL, where
+// cameras keep their credentials. A URL that does not parse is dropped
+// whole.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EdgeNode is an agent at a remote site relaying the cameras in
+// CameraIDs. It is online while its heartbeats arrive, and Tunnels is
+// how many idle connections it has open for streams right now.
+type EdgeNode struct {
+	ID         int        `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	Version    string     `json:"version" db:"version"`
+	RemoteAddr string     `json:"remote_addr" db:"remote_addr"`
+	LastSeenAt *time.Time `json:"last_seen_at" db:"last_seen_at"`
+	Online     bool       `json:"online" db:"-"`
+	Tunnels    int        `json:"tunnels" db:"-"`
+	CameraIDs  []int      `json:"camera_ids" db:"-"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Organization is one desa or kecamatan deployment; its cameras, areas,
+// users and settings are invisible to the others
+type Organization struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Slug      string    `json:"slug" db:"slug"`
+	Domain    *string   `json:"domain" db:"domain"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Playlist is a rotating list of cameras for kiosk screens. The screen
+// shows as many cameras as Layout has tiles and moves on to the next
+// ones every DwellSeconds.
+type Playlist struct {
+	ID           int       `json:"id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	Layout       string    `json:"layout" db:"layout"` // 1x1, 2x2, 3x3 or 4x4
+	DwellSeconds int       `json:"dwell_seconds" db:"dwell_seconds"`
+	CameraIDs    []int     `json:"camera_ids" db:"-"` // in order
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// KioskPlaylist is the playlist a kiosk screen fetches with its token.
+// Disabled cameras are left out.
+type KioskPlaylist struct {
+	Name         string        `json:"name"`
+	Layout       string        `json:"layout"`
+	DwellSeconds int           `json:"dwell_seconds"`
+	Cameras      []KioskCamera `json:"cameras"`
+}
+
+// KioskCamera is one camera of a kiosk playlist with its stream URLs
+type KioskCamera struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	StreamKey string `json:"stream_key"`
+	HLSURL    string `json:"hls_url"`
+	WebRTCURL string `json:"webrtc_url"`
+}
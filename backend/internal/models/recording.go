@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Recording is a recorded segment file
+type Recording struct {
+	ID        int64      `json:"id" db:"id"`
+	CameraID  int        `json:"camera_id" db:"camera_id"`
+	Kind      string     `json:"kind" db:"kind"` // segment or clip
+	FilePath  string     `json:"file_path" db:"file_path"`
+	FileSize  int64      `json:"file_size" db:"file_size"`
+	Duration  int        `json:"duration" db:"duration"` // seconds
+	StartedAt *time.Time `json:"started_at" db:"started_at"`
+	EndedAt   *time.Time `json:"ended_at" db:"ended_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
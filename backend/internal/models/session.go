@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ViewerSession is one viewer watching one camera
+type ViewerSession struct {
+	ID                int64      `json:"id" db:"id"`
+	CameraID          int        `json:"camera_id" db:"camera_id"`
+	SessionID         string     `json:"session_id" db:"session_id"`
+	ViewerID          string     `json:"viewer_id" db:"viewer_id"` // generated by the player, when it sends one
+	IPAddress         string     `json:"ip_address" db:"ip_address"`
+	UserAgent         string     `json:"user_agent" db:"user_agent"`
+	Referrer          string     `json:"referrer" db:"referrer_host"`                // host of the page the player is on
+	Transport         string     `json:"transport" db:"transport"`                   // hls, mse or webrtc; the latest after a switch
+	TransportSwitches int        `json:"transport_switches" db:"transport_switches"` // fallbacks to another transport
+	StartedAt         time.Time  `json:"started_at" db:"started_at"`
+	EndedAt           *time.Time `json:"ended_at" db:"ended_at"` // nil while watching
+	UserID            *int       `json:"user_id" db:"user_id"`   // the logged-in user watching; nil for the public
+	Username          string     `json:"username,omitempty" db:"-"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// CameraShare is a short link to a camera's public player. URL is the
+// link itself and QRURL a PNG QR code of it, for printing on signs.
+type CameraShare struct {
+	Slug      string     `json:"slug" db:"slug"`
+	CameraID  int        `json:"camera_id" db:"camera_id"`
+	URL       string     `json:"url" db:"-"`
+	QRURL     string     `json:"qr_url" db:"-"`
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"` // nil never expires
+	MaxViews  *int       `json:"max_views" db:"max_views"`   // nil is unlimited
+	Views     int        `json:"views" db:"views"`
+	CreatedBy *int       `json:"created_by" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// MultiviewStream is one tile of a grid view. The URLs and ExpiresAt are
+// set only for enabled cameras; otherwise Error says why not.
+type MultiviewStream struct {
+	StreamKey string     `json:"stream_key"`
+	CameraID  *int       `json:"camera_id"`
+	Name      string     `json:"name,omitempty"`
+	HLSURL    string     `json:"hls_url,omitempty"` // MSE, as from GET /api/stream/:streamKey, signed
+	WebRTCURL string     `json:"webrtc_url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // when HLSURL stops working
+	Error     string     `json:"error,omitempty"`
+}
@@ -2,14 +2,48 @@ package models
 
 import "time"
 
+// Roles. Admins run the instance and see every organization; org admins
+// manage their own organization's users. Operators run cameras day to
+// day without seeing their credentials, and viewers are read-only staff
+// who see cameras as the public does; see CameraViewFor.
+const (
+	RoleAdmin    = "admin"
+	RoleOrgAdmin = "org_admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// PermissionANPR allows searching licence plate reads
+const PermissionANPR = "anpr"
+
+// Permissions lists what can be granted on top of a role
+var Permissions = []string{PermissionANPR}
+
 type User struct {
-	ID           int       `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username"`
-	Email        string    `json:"email" db:"email"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	Role         string    `json:"role" db:"role"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID             int       `json:"id" db:"id"`
+	Username       string    `json:"username" db:"username"`
+	Email          string    `json:"email" db:"email"`
+	PasswordHash   string    `json:"-" db:"password_hash"`
+	Role           string    `json:"role" db:"role"`
+	Permissions    []string  `json:"permissions" db:"permissions"`
+	OrganizationID int       `json:"organization_id" db:"organization_id"`
+	Avatar         string    `json:"avatar" db:"avatar"` // upload key, served at /api/public/uploads/<key>
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// HasPermission reports whether the user was granted permission; admins
+// have every permission
+func (u *User) HasPermission(permission string) bool {
+	if u.Role == RoleAdmin {
+		return true
+	}
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
 }
 
 type LoginRequest struct {
@@ -17,8 +51,24 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+// LoginResponse is the /api/auth/login body. The token is sent at the
+// top level, as /api/auth/refresh does, and again under data with the
+// user for the admin panel.
 type LoginResponse struct {
-	Success bool   `json:"success"`
-	Token   string `json:"token,omitempty"`
-	Message string `json:"message,omitempty"`
+	Success bool       `json:"success"`
+	Token   string     `json:"token,omitempty"`
+	Message string     `json:"message,omitempty"`
+	Data    *LoginData `json:"data,omitempty"`
+}
+
+type LoginData struct {
+	Token string    `json:"token"`
+	User  LoginUser `json:"user"`
+}
+
+type LoginUser struct {
+	ID             int    `json:"id"`
+	Username       string `json:"username"`
+	Role           string `json:"role"`
+	OrganizationID int    `json:"organization_id"`
 }
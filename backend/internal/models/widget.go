@@ -0,0 +1,17 @@
+package models
+
+// ViewerCount is the live status of one camera, as shown by the
+// embeddable viewer count widget
+type ViewerCount struct {
+	CameraID int    `json:"camera_id"`
+	Name     string `json:"name"`
+	Viewers  int    `json:"viewers"` // open viewer sessions
+	Online   bool   `json:"online"`  // false when the last health check found it offline
+}
+
+// CameraSearchResult is a camera found by the public search: the public
+// camera fields and whether it is online
+type CameraSearchResult struct {
+	PublicCamera
+	Online bool `json:"online"` // false when the last health check found it offline
+}
@@ -0,0 +1,255 @@
+package motion
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"image"
+	_ "image/jpeg" // go2rtc snapshots
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/internal/snapshot"
+	"github.com/abcdefak87/cctv/internal/streamnode"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+const (
+	defaultInterval    = 5 * time.Second
+	defaultConcurrency = 4
+
+	// snapshotTimeout bounds one snapshot fetch
+	snapshotTimeout = 10 * time.Second
+
+	// dbTimeout bounds each detector query
+	dbTimeout = 5 * time.Second
+)
+
+// SnapshotFunc returns the current frame of a stream
+type SnapshotFunc func(ctx context.Context, streamKey string) (image.Image, error)
+
+// Go2RTC fetches snapshots from the frame API of the go2rtc upstream
+// returns for a stream. It is called for every snapshot so a
+// configuration reload applies at once.
+func Go2RTC(upstream func(ctx context.Context, streamKey string) (streamnode.Upstream, error)) SnapshotFunc {
+	return func(ctx context.Context, streamKey string) (image.Image, error) {
+		up, err := upstream(ctx, streamKey)
+		if err != nil {
+			return nil, err
+		}
+		frame, err := snapshot.Fetch(ctx, up.Client, up.APIURL, streamKey)
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(bytes.NewReader(frame))
+		return img, err
+	}
+}
+
+// Options tune a Detector; zero values use the defaults
+type Options struct {
+	Interval    time.Duration // between snapshots of a camera
+	Concurrency int           // snapshots fetched at once
+	Snapshot    SnapshotFunc
+}
+
+// Detector compares each enabled camera's snapshot with the previous one
+// every Interval
+type Detector struct {
+	db   *sql.DB
+	opts Options
+
+	mu    sync.Mutex
+	state map[int]*cameraState
+}
+
+type cameraState struct {
+	prev      *grid
+	lastEvent time.Time
+	failing   bool // the last snapshot failed; logged once per outage
+}
+
+// target is a camera to check, with its settings
+type target struct {
+	cameraID    int
+	streamKey   string
+	sensitivity int
+	zones       []Zone
+	cooldown    time.Duration
+}
+
+func New(db *sql.DB, opts Options) *Detector {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	return &Detector{db: db, opts: opts, state: map[int]*cameraState{}}
+}
+
+// Run checks the cameras every Interval until ctx is cancelled. Start it
+// with shutdown.Coordinator.Go.
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick checks every enabled camera once, Concurrency at a time
+func (d *Detector) tick(ctx context.Context) {
+	targets, err := d.targets(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to load motion settings", "error", err)
+		}
+		return
+	}
+	d.forget(targets)
+
+	sem := make(chan struct{}, d.opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d.check(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (d *Detector) targets(ctx context.Context) ([]target, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT m.camera_id, c.stream_key, m.sensitivity, m.zones, m.cooldown_seconds
+		FROM motion_settings m
+		JOIN cameras c ON c.id = m.camera_id
+		WHERE m.enabled = TRUE AND c.enabled = TRUE AND c.stream_key IS NOT NULL AND c.stream_key <> ''
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []target
+	for rows.Next() {
+		var t target
+		var zones string
+		var cooldown int
+		if err := rows.Scan(&t.cameraID, &t.streamKey, &t.sensitivity, &zones, &cooldown); err != nil {
+			return nil, err
+		}
+		if t.zones, err = decodeZones(zones); err != nil {
+			logger.Warn("Skipping camera with invalid motion zones", "camera_id", t.cameraID, "error", err)
+			continue
+		}
+		t.cooldown = time.Duration(cooldown) * time.Second
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// forget drops the state of cameras no longer watched, so re-enabling
+// one does not compare against a stale frame
+func (d *Detector) forget(targets []target) {
+	watched := make(map[int]bool, len(targets))
+	for _, t := range targets {
+		watched[t.cameraID] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id := range d.state {
+		if !watched[id] {
+			delete(d.state, id)
+		}
+	}
+}
+
+func (d *Detector) check(ctx context.Context, t target) {
+	d.mu.Lock()
+	st := d.state[t.cameraID]
+	if st == nil {
+		st = &cameraState{}
+		d.state[t.cameraID] = st
+	}
+	d.mu.Unlock()
+
+	snapCtx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	img, err := d.opts.Snapshot(snapCtx, t.streamKey)
+	cancel()
+	if err != nil {
+		if ctx.Err() == nil && !st.failing {
+			logger.Warn("Motion snapshot failed", "camera_id", t.cameraID, "error", err)
+		}
+		// The next good frame starts a new comparison
+		st.failing, st.prev = true, nil
+		return
+	}
+	st.failing = false
+
+	cur := newGrid(img)
+	prev := st.prev
+	st.prev = cur
+	if prev == nil {
+		return
+	}
+
+	zone, score, moved := compare(prev, cur, t.zones, t.sensitivity)
+	now := time.Now().UTC()
+	if !moved || now.Sub(st.lastEvent) < t.cooldown {
+		return
+	}
+	st.lastEvent = now
+	d.record(t.cameraID, zone, score, now)
+}
+
+// record stores an event and publishes it. It uses its own context so an
+// event detected just before shutdown is still written.
+func (d *Detector) record(cameraID int, zone string, score float64, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var id int64
+	err := d.db.QueryRowContext(ctx, `
+		INSERT INTO motion_events (camera_id, score, zone, created_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, cameraID, score, zone, at).Scan(&id)
+	if err != nil {
+		logger.Error("Failed to store motion event", "camera_id", cameraID, "error", err)
+		return
+	}
+
+	logger.Debug("Motion detected", "camera_id", cameraID, "zone", zone, "score", score)
+	events.Publish(events.Event{
+		Type:     events.MotionDetected,
+		Time:     at,
+		Resource: "camera",
+		Data: map[string]interface{}{
+			"camera_id": cameraID,
+			"event_id":  id,
+			"zone":      zone,
+			"score":     score,
+		},
+	})
+}
@@ -0,0 +1,118 @@
+package motion
+
+import (
+	"image"
+)
+
+// Frames are compared on a coarse grid of average brightness, which
+// ignores sensor noise and compression artefacts and keeps the work per
+// snapshot small regardless of the camera's resolution.
+const (
+	gridWidth  = 64
+	gridHeight = 36
+)
+
+// grid holds the average luma (0-255) of each cell, row by row
+type grid [gridWidth * gridHeight]float64
+
+// newGrid reduces img to a brightness grid
+func newGrid(img image.Image) *grid {
+	var g grid
+	var counts [gridWidth * gridHeight]int
+
+	b := img.Bounds()
+	if b.Empty() {
+		return &g
+	}
+	// Sample at most every step-th pixel; a 4K frame has 8M of them
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > 640*360 {
+		step++
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		row := (y - b.Min.Y) * gridHeight / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x += step {
+			col := (x - b.Min.X) * gridWidth / b.Dx()
+			r, gr, bl, _ := img.At(x, y).RGBA()
+			// ITU-R BT.601 luma, from 16-bit channels to 0-255
+			luma := (0.299*float64(r) + 0.587*float64(gr) + 0.114*float64(bl)) / 257
+			g[row*gridWidth+col] += luma
+			counts[row*gridWidth+col]++
+		}
+	}
+	for i := range g {
+		if counts[i] > 0 {
+			g[i] /= float64(counts[i])
+		}
+	}
+	return &g
+}
+
+// thresholds maps a sensitivity of 1-100 to how much a cell's brightness
+// must change to count, and what fraction of a zone's cells must change
+// for motion. At the default of 50 that is 24 levels over 5% of the zone.
+func thresholds(sensitivity int) (cellDelta, minArea float64) {
+	if sensitivity < 1 {
+		sensitivity = 1
+	}
+	if sensitivity > 100 {
+		sensitivity = 100
+	}
+	less := float64(100 - sensitivity)
+	return 8 + less*0.32, 0.002 + less*0.001
+}
+
+// compare scores the change between two frames in each zone (the whole
+// frame when there are none). It returns the zone with the highest share
+// of changed cells, and whether that share reaches the threshold.
+func compare(prev, cur *grid, zones []Zone, sensitivity int) (zone string, score float64, moved bool) {
+	cellDelta, minArea := thresholds(sensitivity)
+	if len(zones) == 0 {
+		zones = []Zone{{X: 0, Y: 0, W: 1, H: 1}}
+	}
+
+	for _, z := range zones {
+		x0, x1 := span(z.X, z.W, gridWidth)
+		y0, y1 := span(z.Y, z.H, gridHeight)
+
+		var changed, total int
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				i := y*gridWidth + x
+				delta := cur[i] - prev[i]
+				if delta < 0 {
+					delta = -delta
+				}
+				if delta >= cellDelta {
+					changed++
+				}
+				total++
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		if s := float64(changed) / float64(total); s > score {
+			zone, score = z.Name, s
+		}
+	}
+	return zone, score, score > 0 && score >= minArea
+}
+
+// span converts a fractional offset and size to a cell range, covering
+// at least one cell
+func span(offset, size float64, cells int) (from, to int) {
+	from = int(offset * float64(cells))
+	to = int((offset + size) * float64(cells))
+	if from < 0 {
+		from = 0
+	}
+	if to > cells {
+		to = cells
+	}
+	if to <= from && from < cells {
+		to = from + 1
+	}
+	return from, to
+}
@@ -0,0 +1,123 @@
+// Package motion watches cameras for movement by comparing successive
+// snapshots from go2rtc. Each camera's sensitivity, zones and cooldown
+// are stored in motion_settings; detected motion is stored in
+// motion_events and published as a motion.detected event, which alerts
+// and recording triggers subscribe to.
+package motion
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Defaults for a camera without stored settings
+const (
+	DefaultSensitivity = 50
+	DefaultCooldown    = 30 * time.Second
+)
+
+// Zone is a rectangle of the frame, in fractions of its width and height
+// from the top-left corner. Motion outside every zone is ignored.
+type Zone struct {
+	Name string  `json:"name"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	W    float64 `json:"w"`
+	H    float64 `json:"h"`
+}
+
+// Settings configure detection for one camera
+type Settings struct {
+	CameraID        int       `json:"camera_id"`
+	Enabled         bool      `json:"enabled"`
+	Sensitivity     int       `json:"sensitivity"` // 1-100
+	Zones           []Zone    `json:"zones"`
+	CooldownSeconds int       `json:"cooldown_seconds"` // between events
+	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+}
+
+// Event is detected motion, as listed by the motion events API
+type Event struct {
+	ID        int64     `json:"id"`
+	CameraID  int       `json:"camera_id"`
+	Score     float64   `json:"score"` // share of the zone that changed, 0-1
+	Zone      string    `json:"zone"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidateZones returns a message for the first zone outside the frame
+func ValidateZones(zones []Zone) string {
+	for i, z := range zones {
+		switch {
+		case len(z.Name) > 50:
+			return fmt.Sprintf("zone %d: name must be at most 50 characters", i+1)
+		case z.X < 0 || z.Y < 0 || z.W <= 0 || z.H <= 0:
+			return fmt.Sprintf("zone %d: x and y must be at least 0, w and h above 0", i+1)
+		case z.X+z.W > 1 || z.Y+z.H > 1:
+			return fmt.Sprintf("zone %d: must fit in the frame (x+w and y+h at most 1)", i+1)
+		}
+	}
+	return ""
+}
+
+// GetSettings returns a camera's settings, or the defaults (disabled)
+// when none are stored
+func GetSettings(ctx context.Context, db *sql.DB, cameraID int) (*Settings, error) {
+	s := &Settings{CameraID: cameraID}
+	var zones string
+	err := db.QueryRowContext(ctx, `
+		SELECT enabled, sensitivity, zones, cooldown_seconds, updated_at
+		FROM motion_settings WHERE camera_id = ?
+	`, cameraID).Scan(&s.Enabled, &s.Sensitivity, &zones, &s.CooldownSeconds, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.Sensitivity = DefaultSensitivity
+		s.Zones = []Zone{}
+		s.CooldownSeconds = int(DefaultCooldown / time.Second)
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Zones, err = decodeZones(zones); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveSettings stores s, replacing the camera's previous settings
+func SaveSettings(ctx context.Context, db *sql.DB, s *Settings) error {
+	if s.Zones == nil {
+		s.Zones = []Zone{}
+	}
+	zones, err := json.Marshal(s.Zones)
+	if err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now().UTC()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO motion_settings (camera_id, enabled, sensitivity, zones, cooldown_seconds, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(camera_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			sensitivity = excluded.sensitivity,
+			zones = excluded.zones,
+			cooldown_seconds = excluded.cooldown_seconds,
+			updated_at = excluded.updated_at
+	`, s.CameraID, s.Enabled, s.Sensitivity, string(zones), s.CooldownSeconds, s.UpdatedAt)
+	return err
+}
+
+func decodeZones(raw string) ([]Zone, error) {
+	zones := []Zone{}
+	if raw == "" {
+		return zones, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &zones); err != nil {
+		return nil, fmt.Errorf("invalid motion zones: %w", err)
+	}
+	return zones, nil
+}
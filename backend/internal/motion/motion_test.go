@@ -0,0 +1,163 @@
+package motion
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+// frame is a dark 320x180 image with a bright rectangle over the given
+// fraction of the frame, or none when w is 0
+func frame(x, y, w, h float64) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 320, 180))
+	for py := 0; py < 180; py++ {
+		for px := 0; px < 320; px++ {
+			fx, fy := float64(px)/320, float64(py)/180
+			if fx >= x && fx < x+w && fy >= y && fy < y+h {
+				img.SetGray(px, py, color.Gray{Y: 220})
+			} else {
+				img.SetGray(px, py, color.Gray{Y: 30})
+			}
+		}
+	}
+	return img
+}
+
+func TestCompare(t *testing.T) {
+	still := newGrid(frame(0, 0, 0, 0))
+
+	t.Run("No change", func(t *testing.T) {
+		if _, score, moved := compare(still, newGrid(frame(0, 0, 0, 0)), nil, 100); moved || score != 0 {
+			t.Errorf("Expected no motion, got score %v", score)
+		}
+	})
+
+	t.Run("Change", func(t *testing.T) {
+		_, score, moved := compare(still, newGrid(frame(0.5, 0.5, 0.25, 0.25)), nil, DefaultSensitivity)
+		if !moved {
+			t.Errorf("Expected motion, got score %v", score)
+		}
+		if score < 0.05 || score > 0.08 {
+			t.Errorf("Expected about 1/16 of the frame to change, got %v", score)
+		}
+	})
+
+	t.Run("Small change below sensitivity", func(t *testing.T) {
+		cur := newGrid(frame(0.5, 0.5, 0.1, 0.1))
+		if _, score, moved := compare(still, cur, nil, 1); moved {
+			t.Errorf("Expected no motion at sensitivity 1, got score %v", score)
+		}
+		if _, score, moved := compare(still, cur, nil, 100); !moved {
+			t.Errorf("Expected motion at sensitivity 100, got score %v", score)
+		}
+	})
+
+	t.Run("Outside the zones", func(t *testing.T) {
+		zones := []Zone{{Name: "door", X: 0, Y: 0, W: 0.25, H: 0.25}}
+		if _, _, moved := compare(still, newGrid(frame(0.5, 0.5, 0.25, 0.25)), zones, 100); moved {
+			t.Error("Expected motion outside the zone to be ignored")
+		}
+	})
+
+	t.Run("Names the zone", func(t *testing.T) {
+		zones := []Zone{{Name: "door", X: 0, Y: 0, W: 0.5, H: 0.5}, {Name: "yard", X: 0.5, Y: 0.5, W: 0.5, H: 0.5}}
+		zone, _, moved := compare(still, newGrid(frame(0.5, 0.5, 0.25, 0.25)), zones, DefaultSensitivity)
+		if !moved || zone != "yard" {
+			t.Errorf("Expected motion in yard, got %q (moved %v)", zone, moved)
+		}
+	})
+}
+
+func TestValidateZones(t *testing.T) {
+	valid := []Zone{{Name: "door", X: 0.1, Y: 0.1, W: 0.9, H: 0.5}}
+	if msg := ValidateZones(valid); msg != "" {
+		t.Errorf("Expected a valid zone, got %q", msg)
+	}
+
+	for _, z := range []Zone{{X: -0.1, W: 0.5, H: 0.5}, {W: 0, H: 0.5}, {X: 0.6, W: 0.5, H: 0.5}} {
+		if msg := ValidateZones([]Zone{z}); msg == "" {
+			t.Errorf("Expected %+v to be rejected", z)
+		}
+	}
+}
+
+func TestDetector(t *testing.T) {
+	db := dbtest.Open(t)
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled) VALUES (1, 'Gate', 'rtsp://gate', 'gate', TRUE)`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	ctx := context.Background()
+	if err := SaveSettings(ctx, db, &Settings{CameraID: 1, Enabled: true, Sensitivity: 50, CooldownSeconds: 3600}); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+
+	frames := []image.Image{
+		frame(0, 0, 0, 0),
+		frame(0.5, 0.5, 0.25, 0.25),
+		frame(0, 0, 0.25, 0.25),
+	}
+	var served int
+	d := New(db, Options{Snapshot: func(ctx context.Context, streamKey string) (image.Image, error) {
+		img := frames[served]
+		served++
+		return img, nil
+	}})
+
+	count := func() int {
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM motion_events WHERE camera_id = 1`).Scan(&n)
+		return n
+	}
+
+	t.Run("First frame is the baseline", func(t *testing.T) {
+		d.tick(ctx)
+		if n := count(); n != 0 {
+			t.Errorf("Expected no events, got %d", n)
+		}
+	})
+
+	t.Run("Motion is stored", func(t *testing.T) {
+		d.tick(ctx)
+		if n := count(); n != 1 {
+			t.Errorf("Expected 1 event, got %d", n)
+		}
+	})
+
+	t.Run("Cooldown", func(t *testing.T) {
+		d.tick(ctx)
+		if n := count(); n != 1 {
+			t.Errorf("Expected the cooldown to suppress a second event, got %d", n)
+		}
+	})
+
+	t.Run("Disabled cameras are skipped", func(t *testing.T) {
+		if err := SaveSettings(ctx, db, &Settings{CameraID: 1, Sensitivity: 50}); err != nil {
+			t.Fatalf("SaveSettings failed: %v", err)
+		}
+		d.tick(ctx)
+		if served != 3 {
+			t.Errorf("Expected no snapshot for a disabled camera, got %d snapshots", served)
+		}
+		if len(d.state) != 0 {
+			t.Errorf("Expected the camera's state to be dropped, got %d", len(d.state))
+		}
+	})
+}
+
+func TestGetSettings(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	s, err := GetSettings(ctx, db, 42)
+	if err != nil {
+		t.Fatalf("GetSettings failed: %v", err)
+	}
+	if s.Enabled || s.Sensitivity != DefaultSensitivity || s.Zones == nil || s.CooldownSeconds != 30 {
+		t.Errorf("Expected disabled defaults, got %+v", s)
+	}
+}
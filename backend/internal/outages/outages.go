@@ -0,0 +1,103 @@
+// Package outages keeps the timeline of each camera's outages: when it
+// went offline, why, and when it was back. The watchdog, and the edge
+// agents for the cameras behind them, record each change of a camera's
+// health here; camera_health only holds the latest.
+package outages
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Outage is one interval a camera was offline. EndedAt is nil while it
+// goes on; Duration then runs to now.
+type Outage struct {
+	ID        int64      `json:"id"`
+	CameraID  int        `json:"camera_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Duration  int64      `json:"duration_seconds"`
+	Cause     string     `json:"cause"`
+	Ongoing   bool       `json:"ongoing"`
+}
+
+// Record notes the health of a camera at at: offline opens an outage
+// with cause unless one is open already, online ends the open one.
+// Recording the same health again changes nothing.
+func Record(ctx context.Context, db *sql.DB, cameraID int, online bool, cause string, at time.Time) error {
+	at = at.UTC()
+	if online {
+		_, err := db.ExecContext(ctx, `
+			UPDATE outages SET ended_at = ? WHERE camera_id = ? AND ended_at IS NULL
+		`, at, cameraID)
+		return err
+	}
+
+	// A camera deleted since is skipped
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO outages (camera_id, started_at, cause)
+		SELECT id, ?, ? FROM cameras
+		WHERE id = ? AND NOT EXISTS (SELECT 1 FROM outages WHERE camera_id = ? AND ended_at IS NULL)
+		ON CONFLICT DO NOTHING
+	`, at, cause, cameraID, cameraID)
+	return err
+}
+
+// List returns the outages of a camera that overlap [from, to), oldest
+// first
+func List(ctx context.Context, db *sql.DB, cameraID int, from, to, now time.Time) ([]Outage, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, camera_id, started_at, ended_at, cause
+		FROM outages
+		WHERE camera_id = ? AND started_at < ? AND (ended_at IS NULL OR ended_at > ?)
+		ORDER BY started_at ASC, id ASC
+	`, cameraID, to.UTC(), from.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Outage{}
+	for rows.Next() {
+		var o Outage
+		var ended sql.NullTime
+		if err := rows.Scan(&o.ID, &o.CameraID, &o.StartedAt, &ended, &o.Cause); err != nil {
+			return nil, err
+		}
+		end := now
+		if ended.Valid {
+			o.EndedAt, end = &ended.Time, ended.Time
+		} else {
+			o.Ongoing = true
+		}
+		o.Duration = int64(end.Sub(o.StartedAt) / time.Second)
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// Downtime is how much of [from, to) the outages cover; outages of one
+// camera never overlap
+func Downtime(list []Outage, from, to time.Time) time.Duration {
+	var total time.Duration
+	for _, o := range list {
+		start, end := o.StartedAt, to
+		if o.EndedAt != nil && o.EndedAt.Before(to) {
+			end = *o.EndedAt
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return total
+}
+
+// Prune deletes the outages that ended before cutoff
+func Prune(ctx context.Context, db *sql.DB, cutoff time.Time) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM outages WHERE ended_at < ?`, cutoff.UTC())
+	return err
+}
@@ -0,0 +1,49 @@
+package playback
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoFrame is returned when a recording has no frame at the offset,
+// such as past the end of a file that was cut short
+var ErrNoFrame = errors.New("no frame at this time")
+
+// ExtractFrame decodes the frame of file shown offset after its start
+// and returns it as a JPEG. Seeking before the input makes ffmpeg
+// decode from the keyframe before offset up to the exact frame, rather
+// than stopping at the keyframe.
+func ExtractFrame(ctx context.Context, ffmpeg, file string, offset time.Duration) ([]byte, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	cmd := exec.CommandContext(ctx, ffmpeg,
+		"-hide_banner", "-loglevel", "error", "-nostdin",
+		"-ss", strconv.FormatFloat(offset.Seconds(), 'f', 3, 64),
+		"-i", file,
+		"-frames:v", "1", "-an", "-f", "image2", "-c:v", "mjpeg", "-q:v", "3",
+		"pipe:1",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("ffmpeg: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+	if stdout.Len() == 0 {
+		return nil, ErrNoFrame
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,181 @@
+package playback
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// packetSize is the size of an MPEG-TS packet
+const packetSize = 188
+
+// ptsClock is the rate of MPEG-TS timestamps
+const ptsClock = 90000
+
+// ErrNotTS is returned for a file that is not an MPEG-TS stream
+var ErrNotTS = errors.New("not an MPEG-TS stream")
+
+// videoStreamTypes are the PMT stream types of the video codecs players
+// can decode from a keyframe: MPEG-1/2, H.264 and H.265
+var videoStreamTypes = map[byte]bool{0x01: true, 0x02: true, 0x1b: true, 0x24: true}
+
+// Keyframe is one keyframe of a recording, as a byte range of the file
+type Keyframe struct {
+	Offset int64   `json:"o"`
+	Size   int64   `json:"s"`
+	Time   float64 `json:"t"` // seconds from the file's first frame
+}
+
+// ScanKeyframes finds the keyframes of the video stream of an MPEG-TS
+// file: the video PES packets marked as random access points in their
+// adaptation field. Each range starts at the PAT and PMT sent just
+// before the keyframe, when there are any, so it can be decoded on its
+// own, and ends where the next video PES starts.
+func ScanKeyframes(r io.Reader) ([]Keyframe, error) {
+	br := bufio.NewReaderSize(r, 64*packetSize)
+	var (
+		pkt      [packetSize]byte
+		offset   int64
+		pmtPID   = -1
+		videoPID = -1
+		// Offset of the first PAT since the last video PES, or -1
+		tablesAt int64 = -1
+		firstPTS int64 = -1
+		// Index of the keyframe whose end is not known yet, or -1
+		open   = -1
+		frames []Keyframe
+	)
+	for ; ; offset += packetSize {
+		if _, err := io.ReadFull(br, pkt[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		if pkt[0] != 0x47 {
+			return nil, ErrNotTS
+		}
+		pid := int(pkt[1]&0x1f)<<8 | int(pkt[2])
+		start := pkt[1]&0x40 != 0
+		if !start {
+			continue
+		}
+		payload, randomAccess := packetPayload(pkt[:])
+
+		switch pid {
+		case 0:
+			if tablesAt < 0 {
+				tablesAt = offset
+			}
+			if pmtPID < 0 {
+				pmtPID = patProgram(payload)
+			}
+		case pmtPID:
+			if videoPID < 0 {
+				videoPID = pmtVideo(payload)
+			}
+		case videoPID:
+			boundary := offset
+			if tablesAt >= 0 {
+				boundary = tablesAt
+			}
+			if open >= 0 {
+				frames[open].Size = boundary - frames[open].Offset
+				open = -1
+			}
+			if pts, ok := pesPTS(payload); ok {
+				if firstPTS < 0 {
+					firstPTS = pts
+				}
+				if randomAccess {
+					frames = append(frames, Keyframe{Offset: boundary, Time: ptsSeconds(pts - firstPTS)})
+					open = len(frames) - 1
+				}
+			}
+			tablesAt = -1
+		}
+	}
+	if open >= 0 {
+		frames[open].Size = offset - frames[open].Offset
+	}
+	return frames, nil
+}
+
+// packetPayload returns the payload of a packet and whether its
+// adaptation field marks a random access point
+func packetPayload(pkt []byte) (payload []byte, randomAccess bool) {
+	control := pkt[3] >> 4 & 0x03
+	start := 4
+	if control&0x02 != 0 {
+		length := int(pkt[4])
+		if length > 0 {
+			randomAccess = pkt[5]&0x40 != 0
+		}
+		start += 1 + length
+	}
+	if control&0x01 == 0 || start >= len(pkt) {
+		return nil, randomAccess
+	}
+	return pkt[start:], randomAccess
+}
+
+// section returns the PSI section at the start of payload, without its
+// CRC, when it has the table id
+func section(payload []byte, table byte) []byte {
+	if len(payload) < 1 {
+		return nil
+	}
+	s := payload[1+int(payload[0]):]
+	if len(s) < 3 || s[0] != table {
+		return nil
+	}
+	end := 3 + (int(s[1]&0x0f)<<8 | int(s[2])) - 4
+	if end > len(s) || end < 8 {
+		return nil
+	}
+	return s[:end]
+}
+
+// patProgram returns the PMT PID of the first program of a PAT, or -1
+func patProgram(payload []byte) int {
+	s := section(payload, 0x00)
+	for i := 8; i+4 <= len(s); i += 4 {
+		if s[i] != 0 || s[i+1] != 0 { // program 0 is the network PID
+			return int(s[i+2]&0x1f)<<8 | int(s[i+3])
+		}
+	}
+	return -1
+}
+
+// pmtVideo returns the PID of the first video stream of a PMT, or -1
+func pmtVideo(payload []byte) int {
+	s := section(payload, 0x02)
+	if len(s) < 12 {
+		return -1
+	}
+	for i := 12 + (int(s[10]&0x0f)<<8 | int(s[11])); i+5 <= len(s); {
+		if videoStreamTypes[s[i]] {
+			return int(s[i+1]&0x1f)<<8 | int(s[i+2])
+		}
+		i += 5 + (int(s[i+3]&0x0f)<<8 | int(s[i+4]))
+	}
+	return -1
+}
+
+// pesPTS reads the presentation timestamp of a PES header
+func pesPTS(payload []byte) (int64, bool) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 || payload[7]&0x80 == 0 {
+		return 0, false
+	}
+	p := payload[9:14]
+	return int64(p[0]>>1&0x07)<<30 | int64(p[1])<<22 | int64(p[2]>>1)<<15 | int64(p[3])<<7 | int64(p[4]>>1), true
+}
+
+// ptsSeconds converts a PTS difference to seconds, allowing for the
+// 33-bit counter wrapping around
+func ptsSeconds(d int64) float64 {
+	if d < 0 {
+		d += 1 << 33
+	}
+	return float64(d) / ptsClock
+}
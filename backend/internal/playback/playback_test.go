@@ -0,0 +1,127 @@
+package playback
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tsPacket builds a packet of pid; a packet that starts a unit carries
+// header at the start of its payload
+func tsPacket(pid int, start, randomAccess bool, header []byte) []byte {
+	pkt := bytes.Repeat([]byte{0xff}, packetSize)
+	pkt[0] = 0x47
+	pkt[1] = byte(pid >> 8 & 0x1f)
+	if start {
+		pkt[1] |= 0x40
+	}
+	pkt[2] = byte(pid)
+	pkt[3] = 0x10 // payload only
+	payload := pkt[4:]
+	if randomAccess {
+		pkt[3] = 0x30
+		pkt[4], pkt[5] = 1, 0x40
+		payload = pkt[6:]
+	}
+	copy(payload, header)
+	return pkt
+}
+
+// tables are a PAT naming PMT PID 0x100 and a PMT with an AAC stream on
+// 0x102 and an H.264 stream on 0x101
+func tables() []byte {
+	pat := []byte{0, 0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xe1, 0x00, 0, 0, 0, 0}
+	pmt := []byte{0, 0x02, 0xb0, 23, 0, 1, 0xc1, 0, 0, 0xe1, 0x01, 0xf0, 0,
+		0x0f, 0xe1, 0x02, 0xf0, 0,
+		0x1b, 0xe1, 0x01, 0xf0, 0,
+		0, 0, 0, 0}
+	return append(tsPacket(0, true, false, pat), tsPacket(0x100, true, false, pmt)...)
+}
+
+// pes starts a video PES with a PTS of seconds
+func pes(seconds float64, key bool) []byte {
+	pts := int64(seconds * ptsClock)
+	header := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | pts>>29&0x0e), byte(pts >> 22), byte(pts>>14 | 1), byte(pts >> 7), byte(pts<<1 | 1)}
+	return tsPacket(0x101, true, key, header)
+}
+
+func TestScanKeyframes(t *testing.T) {
+	var ts []byte
+	ts = append(ts, tables()...)      // packets 0-1
+	ts = append(ts, pes(10, true)...) // 2
+	ts = append(ts, tsPacket(0x101, false, false, nil)...)
+	ts = append(ts, tsPacket(0x102, true, false, nil)...)
+	ts = append(ts, pes(10.04, false)...) // 5
+	ts = append(ts, tables()...)          // 6-7
+	ts = append(ts, pes(12, true)...)     // 8
+	ts = append(ts, tsPacket(0x101, false, false, nil)...)
+
+	frames, err := ScanKeyframes(bytes.NewReader(ts))
+	if err != nil {
+		t.Fatalf("ScanKeyframes failed: %v", err)
+	}
+	want := []Keyframe{
+		{Offset: 0, Size: 5 * packetSize, Time: 0},
+		{Offset: 6 * packetSize, Size: 4 * packetSize, Time: 2},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("Expected %d keyframes, got %+v", len(want), frames)
+	}
+	for i := range want {
+		if frames[i] != want[i] {
+			t.Errorf("Keyframe %d: expected %+v, got %+v", i, want[i], frames[i])
+		}
+	}
+
+	if _, err := ScanKeyframes(strings.NewReader(strings.Repeat("x", packetSize))); err != ErrNotTS {
+		t.Errorf("Expected ErrNotTS, got %v", err)
+	}
+}
+
+func TestPlaylists(t *testing.T) {
+	start := time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)
+	frames := []Keyframe{{0, 100, 0}, {1000, 100, 2}, {2000, 100, 4}, {3000, 100, 6}}
+	segments := []Segment{
+		{URI: "segments/1", Start: start, Duration: 8, Size: 8000, Keyframes: frames},
+		{URI: "segments/2", Start: start.Add(time.Minute), Duration: 10.5, Size: 10500},
+	}
+
+	media := Media(segments)
+	for _, want := range []string{
+		"#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-TARGETDURATION:11\n",
+		"#EXT-X-PROGRAM-DATE-TIME:2026-05-01T18:00:00.000Z\n#EXTINF:8.000,\nsegments/1\n#EXT-X-DISCONTINUITY\n",
+		"#EXTINF:10.500,\nsegments/2\n#EXT-X-ENDLIST\n",
+	} {
+		if !strings.Contains(media, want) {
+			t.Errorf("Expected the media playlist to contain %q, got:\n%s", want, media)
+		}
+	}
+
+	iframes := IFrames(segments, 2)
+	for _, want := range []string{
+		"#EXT-X-TARGETDURATION:4\n",
+		"#EXT-X-I-FRAMES-ONLY\n",
+		"#EXTINF:4.000,\n#EXT-X-BYTERANGE:100@0\nsegments/1\n#EXTINF:4.000,\n#EXT-X-BYTERANGE:100@2000\nsegments/1\n#EXT-X-ENDLIST",
+	} {
+		if !strings.Contains(iframes, want) {
+			t.Errorf("Expected the keyframe playlist to contain %q, got:\n%s", want, iframes)
+		}
+	}
+	if strings.Contains(iframes, "DISCONTINUITY") {
+		t.Error("Expected segments without keyframes left out")
+	}
+
+	if bw := MediaBandwidth(segments); bw != 8000 {
+		t.Errorf("Expected 8000 bit/s, got %d", bw)
+	}
+	if one, four := IFrameBandwidth(segments, 1), IFrameBandwidth(segments, 4); one != 172 || four != 172 {
+		t.Errorf("Expected every speed to need about the same bandwidth, got %d and %d", one, four)
+	}
+
+	master := Master(Variant{"vod.m3u8", 8000}, []Variant{{"iframes.m3u8?speed=2", 100}})
+	if !strings.Contains(master, "#EXT-X-STREAM-INF:BANDWIDTH=8000\nvod.m3u8\n#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100,URI=\"iframes.m3u8?speed=2\"\n") {
+		t.Errorf("Unexpected master playlist:\n%s", master)
+	}
+}
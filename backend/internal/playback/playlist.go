@@ -0,0 +1,144 @@
+// Package playback builds HLS VOD playlists over recordings, so players
+// can seek and scrub across a time range natively, and keyframe-only
+// playlists for fast forward. Keyframes are found by scanning MPEG-TS
+// recordings; see ScanKeyframes.
+package playback
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Speeds are the fast-forward rates with their own keyframe-only
+// variant
+var Speeds = []int{1, 2, 4}
+
+// Segment is one recording in a playlist
+type Segment struct {
+	URI       string
+	Start     time.Time
+	Duration  float64 // seconds
+	Size      int64   // bytes
+	Keyframes []Keyframe
+}
+
+// Variant is a playlist listed in a master playlist
+type Variant struct {
+	URI       string
+	Bandwidth int // bits per second
+}
+
+// Master lists the full media playlist and the keyframe-only ones, which
+// players pick from for fast forward and scrubbing
+func Master(media Variant, iframes []Variant) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:4\n")
+	fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s\n", max(media.Bandwidth, 1), media.URI)
+	for _, v := range iframes {
+		fmt.Fprintf(&b, "#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=%d,URI=%q\n", max(v.Bandwidth, 1), v.URI)
+	}
+	return b.String()
+}
+
+// Media is the VOD playlist of segments, one recording each. Recordings
+// restart their timestamps, so each follows a discontinuity; gaps
+// between them are skipped, and the program date times tell players
+// where each one starts.
+func Media(segments []Segment) string {
+	var body strings.Builder
+	target := 1.0
+	for i, s := range segments {
+		if i > 0 {
+			body.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&body, "#EXT-X-PROGRAM-DATE-TIME:%s\n#EXTINF:%.3f,\n%s\n",
+			s.Start.UTC().Format("2006-01-02T15:04:05.000Z"), s.Duration, s.URI)
+		target = math.Max(target, s.Duration)
+	}
+	return header(target, false) + body.String() + "#EXT-X-ENDLIST\n"
+}
+
+// IFrames is the keyframe-only playlist of segments at speed: every
+// speed-th keyframe of each segment, so faster playback fetches about as
+// many bytes per second as playing every keyframe at normal speed
+func IFrames(segments []Segment, speed int) string {
+	var body strings.Builder
+	target := 1.0
+	first := true
+	for _, s := range segments {
+		frames := thin(s.Keyframes, speed)
+		if len(frames) == 0 {
+			continue
+		}
+		if !first {
+			body.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		first = false
+		fmt.Fprintf(&body, "#EXT-X-PROGRAM-DATE-TIME:%s\n", s.Start.UTC().Format("2006-01-02T15:04:05.000Z"))
+		for i, f := range frames {
+			next := s.Duration
+			if i+1 < len(frames) {
+				next = frames[i+1].Time
+			}
+			d := math.Max(next-f.Time, 0)
+			fmt.Fprintf(&body, "#EXTINF:%.3f,\n#EXT-X-BYTERANGE:%d@%d\n%s\n", d, f.Size, f.Offset, s.URI)
+			target = math.Max(target, d)
+		}
+	}
+	return header(target, true) + body.String() + "#EXT-X-ENDLIST\n"
+}
+
+// MediaBandwidth is the average bit rate of segments
+func MediaBandwidth(segments []Segment) int {
+	var bytes int64
+	var seconds float64
+	for _, s := range segments {
+		bytes += s.Size
+		seconds += s.Duration
+	}
+	return rate(bytes, seconds)
+}
+
+// IFrameBandwidth is the average bit rate of the keyframe-only playlist
+// at speed, played at that speed
+func IFrameBandwidth(segments []Segment, speed int) int {
+	var bytes int64
+	var seconds float64
+	for _, s := range segments {
+		for _, f := range thin(s.Keyframes, speed) {
+			bytes += f.Size
+		}
+		seconds += s.Duration
+	}
+	return rate(bytes, seconds/float64(speed))
+}
+
+func header(target float64, iframes bool) string {
+	h := fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:4\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n",
+		int(math.Ceil(target)))
+	if iframes {
+		h += "#EXT-X-I-FRAMES-ONLY\n"
+	}
+	return h
+}
+
+// thin keeps every speed-th keyframe
+func thin(frames []Keyframe, speed int) []Keyframe {
+	if speed <= 1 {
+		return frames
+	}
+	kept := make([]Keyframe, 0, len(frames)/speed+1)
+	for i := 0; i < len(frames); i += speed {
+		kept = append(kept, frames[i])
+	}
+	return kept
+}
+
+func rate(bytes int64, seconds float64) int {
+	if seconds <= 0 {
+		return 0
+	}
+	return int(float64(bytes) * 8 / seconds)
+}
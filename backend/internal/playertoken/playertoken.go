@@ -0,0 +1,78 @@
+// Package playertoken issues the anonymous tokens public players fetch
+// when the page loads and send with their stream requests. A token is a
+// random viewer ID, its expiry and an HMAC-SHA256 of both, so the server
+// checks it without storing anything and a scraper cannot make one up.
+// Refreshing a token keeps its ID, so the requests of one player window
+// are throttled and counted together for as long as it stays open.
+package playertoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Where players send their token: the header, the query parameter for
+// URLs handed to a media element, or the cookie set when it was issued
+const (
+	Header = "X-Player-Token"
+	Query  = "player_token"
+	Cookie = "player_token"
+)
+
+// RefreshWindow is how long after expiring a token can still be
+// refreshed under its ID, such as by a laptop waking from sleep
+const RefreshWindow = 24 * time.Hour
+
+var (
+	ErrInvalid = errors.New("invalid player token")
+	ErrExpired = errors.New("player token has expired")
+)
+
+// Issue returns a token for id that works until expires; an empty id
+// starts a new viewer
+func Issue(secret, id string, expires time.Time) (string, error) {
+	if id == "" {
+		raw := make([]byte, 12)
+		if _, err := rand.Read(raw); err != nil {
+			return "", err
+		}
+		id = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return id + "." + exp + "." + signature(secret, id, exp), nil
+}
+
+// Parse checks token and returns its viewer ID and expiry. A token that
+// has expired returns them with ErrExpired; one that was altered or not
+// issued under secret returns ErrInvalid.
+func Parse(secret, token string, now time.Time) (string, time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", time.Time{}, ErrInvalid
+	}
+	id, exp, sig := parts[0], parts[1], parts[2]
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, id, exp))) {
+		return "", time.Time{}, ErrInvalid
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return "", time.Time{}, ErrInvalid
+	}
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) {
+		return id, expires, ErrExpired
+	}
+	return id, expires, nil
+}
+
+func signature(secret, id, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("player\n" + id + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
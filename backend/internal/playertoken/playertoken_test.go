@@ -0,0 +1,50 @@
+package playertoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Now()
+	token, err := Issue("s3cret", "", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	id, expires, err := Parse("s3cret", token, now)
+	if err != nil || id == "" || expires.Unix() != now.Add(time.Minute).Unix() {
+		t.Fatalf("Parse = %q, %v, %v", id, expires, err)
+	}
+
+	refreshed, _ := Issue("s3cret", id, now.Add(time.Hour))
+	if again, _, err := Parse("s3cret", refreshed, now); err != nil || again != id {
+		t.Errorf("Refreshed token = %q, %v, want %q", again, err, id)
+	}
+	if again, _, err := Parse("s3cret", token, now.Add(2*time.Minute)); !errors.Is(err, ErrExpired) || again != id {
+		t.Errorf("Expired token = %q, %v", again, err)
+	}
+
+	parts := strings.Split(token, ".")
+	for name, bad := range map[string]string{
+		"empty":          "",
+		"other secret":   mustIssue(t, "other", id, now.Add(time.Minute)),
+		"later expiry":   parts[0] + ".9999999999." + parts[2],
+		"another viewer": "someone." + parts[1] + "." + parts[2],
+		"truncated":      parts[0] + "." + parts[1],
+	} {
+		if _, _, err := Parse("s3cret", bad, now); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse of %s token = %v, want ErrInvalid", name, err)
+		}
+	}
+}
+
+func mustIssue(t *testing.T, secret, id string, expires time.Time) string {
+	t.Helper()
+	token, err := Issue(secret, id, expires)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	return token
+}
@@ -0,0 +1,250 @@
+// Package privacy keeps viewers' personal data no longer than the
+// configured policy allows. Viewer sessions are deleted after a while,
+// feedback email addresses cleared, and stored IP addresses replaced
+// with a keyed hash: the same address still hashes to the same value,
+// so unique viewer counts keep working, but the address itself is gone.
+// Access logs and plate reads are deleted by their own retention jobs;
+// Status reports on them too.
+//
+// Where that is not enough, the viewer privacy mode keeps viewer
+// sessions from holding addresses and user agents at all: only the
+// hash of the address, or nothing. Sessions are counted by their token
+// and viewer ID, so the analytics do not change; the addresses already
+// stored are hashed or cleared by the next cleanup.
+package privacy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// AnonymizedPrefix marks an IP address that was replaced by its hash
+const AnonymizedPrefix = "anon:"
+
+// Viewer privacy modes: what viewer sessions keep of the client
+const (
+	ViewerOff  = "off"  // the address and user agent, until AnonymizeIPDays
+	ViewerHash = "hash" // the hash of the address
+	ViewerDrop = "drop" // neither
+)
+
+// cleanupInterval is how often Cleanup applies the policy
+const cleanupInterval = time.Hour
+
+// batchSize addresses are hashed per query, so a large backlog does not
+// hold a write lock for long
+const batchSize = 500
+
+// Policy says how long each kind of personal data is kept, in days; 0
+// keeps it as it is
+type Policy struct {
+	ViewerSessionDays int
+	FeedbackEmailDays int
+	AnonymizeIPDays   int
+	ViewerMode        string // ViewerOff, ViewerHash or ViewerDrop
+	AccessLogDays     int    // only with ACCESS_LOG_SINK=database
+	ANPRDays          int
+
+	AccessLogStored bool
+	Secret          string // keys the IP hashes
+}
+
+// FromConfig collects the policy spread over cfg
+func FromConfig(cfg *config.Config) Policy {
+	return Policy{
+		ViewerSessionDays: cfg.Privacy.ViewerSessionDays,
+		FeedbackEmailDays: cfg.Privacy.FeedbackEmailDays,
+		AnonymizeIPDays:   cfg.Privacy.AnonymizeIPDays,
+		ViewerMode:        cfg.Privacy.ViewerMode,
+		AccessLogDays:     cfg.AccessLog.RetentionDays,
+		ANPRDays:          cfg.ANPR.RetentionDays,
+		AccessLogStored:   strings.EqualFold(cfg.AccessLog.Sink, "database"),
+		Secret:            cfg.JWT.Secret,
+	}
+}
+
+// Enabled reports whether Cleanup has anything to do
+func (p Policy) Enabled() bool {
+	return p.ViewerSessionDays > 0 || p.FeedbackEmailDays > 0 || p.AnonymizeIPDays > 0 || p.viewerPrivate()
+}
+
+// viewerPrivate reports whether the viewer privacy mode keeps addresses
+// and user agents out of viewer sessions
+func (p Policy) viewerPrivate() bool {
+	return p.ViewerMode == ViewerHash || p.ViewerMode == ViewerDrop
+}
+
+// ViewerClient returns what a viewer session started by a client at ip
+// with agent keeps of it under the viewer privacy mode
+func (p Policy) ViewerClient(ip, agent string) (string, string) {
+	switch p.ViewerMode {
+	case ViewerHash:
+		return HashIP(p.Secret, ip), ""
+	case ViewerDrop:
+		return "", ""
+	}
+	return ip, agent
+}
+
+// ipColumn is a table that stores client IP addresses
+type ipColumn struct {
+	table, column, timeColumn string
+}
+
+var ipColumns = []ipColumn{
+	{"viewer_sessions", "ip_address", "started_at"},
+	{"feedback", "ip_address", "created_at"},
+	{"access_logs", "ip", "created_at"},
+}
+
+// HashIP returns the anonymized form of ip
+func HashIP(secret, ip string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ip))
+	return AnonymizedPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Result counts what one Apply changed
+type Result struct {
+	SessionsDeleted int64
+	EmailsCleared   int64
+	IPsAnonymized   int64
+	IPsCleared      int64 // viewer session addresses dropped
+}
+
+// Apply enforces p on data older than its limits at now
+func Apply(ctx context.Context, db *sql.DB, p Policy, now time.Time) (Result, error) {
+	var r Result
+	now = now.UTC()
+
+	if p.ViewerSessionDays > 0 {
+		result, err := db.ExecContext(ctx, `DELETE FROM viewer_sessions WHERE started_at < ?`,
+			now.AddDate(0, 0, -p.ViewerSessionDays))
+		if err != nil {
+			return r, err
+		}
+		r.SessionsDeleted, _ = result.RowsAffected()
+	}
+
+	if p.FeedbackEmailDays > 0 {
+		result, err := db.ExecContext(ctx, `UPDATE feedback SET email = NULL WHERE email IS NOT NULL AND created_at < ?`,
+			now.AddDate(0, 0, -p.FeedbackEmailDays))
+		if err != nil {
+			return r, err
+		}
+		r.EmailsCleared, _ = result.RowsAffected()
+	}
+
+	if p.AnonymizeIPDays > 0 {
+		cutoff := now.AddDate(0, 0, -p.AnonymizeIPDays)
+
+		// User agents cannot be hashed usefully, so they go with the IP
+		if _, err := db.ExecContext(ctx, `UPDATE viewer_sessions SET user_agent = NULL WHERE user_agent IS NOT NULL AND started_at < ?`,
+			cutoff); err != nil {
+			return r, err
+		}
+		for _, col := range ipColumns {
+			n, err := anonymize(ctx, db, col, p.Secret, cutoff)
+			r.IPsAnonymized += n
+			if err != nil {
+				return r, err
+			}
+		}
+	}
+
+	// Sessions from before the viewer privacy mode was turned on
+	if p.viewerPrivate() {
+		if _, err := db.ExecContext(ctx, `UPDATE viewer_sessions SET user_agent = NULL WHERE user_agent IS NOT NULL`); err != nil {
+			return r, err
+		}
+		if p.ViewerMode == ViewerHash {
+			n, err := anonymize(ctx, db, ipColumn{"viewer_sessions", "ip_address", "started_at"}, p.Secret, now)
+			r.IPsAnonymized += n
+			if err != nil {
+				return r, err
+			}
+		} else {
+			result, err := db.ExecContext(ctx, `UPDATE viewer_sessions SET ip_address = NULL WHERE ip_address <> ''`)
+			if err != nil {
+				return r, err
+			}
+			r.IPsCleared, _ = result.RowsAffected()
+		}
+	}
+	return r, nil
+}
+
+// anonymize hashes the addresses in col stored before cutoff
+func anonymize(ctx context.Context, db *sql.DB, col ipColumn, secret string, cutoff time.Time) (int64, error) {
+	pending := col.column + ` <> '' AND ` + col.column + ` NOT LIKE '` + AnonymizedPrefix + `%' AND ` + col.timeColumn + ` < ?`
+
+	var total int64
+	for {
+		rows, err := db.QueryContext(ctx, `SELECT DISTINCT `+col.column+` FROM `+col.table+` WHERE `+pending+
+			` LIMIT `+strconv.Itoa(batchSize), cutoff)
+		if err != nil {
+			return total, err
+		}
+		var ips []string
+		for rows.Next() {
+			var ip string
+			if err := rows.Scan(&ip); err != nil {
+				rows.Close()
+				return total, err
+			}
+			ips = append(ips, ip)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, err
+		}
+
+		for _, ip := range ips {
+			result, err := db.ExecContext(ctx, `UPDATE `+col.table+` SET `+col.column+` = ? WHERE `+col.column+` = ? AND `+
+				col.timeColumn+` < ?`, HashIP(secret, ip), ip, cutoff)
+			if err != nil {
+				return total, err
+			}
+			n, _ := result.RowsAffected()
+			total += n
+		}
+		if len(ips) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// Cleanup applies p every hour until ctx is cancelled. Start it with
+// shutdown.Coordinator.Go.
+func Cleanup(db *sql.DB, p Policy) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			if r, err := Apply(ctx, db, p, time.Now()); err != nil {
+				if ctx.Err() == nil {
+					logger.Error("Failed to apply privacy policy", "error", err)
+				}
+			} else if r != (Result{}) {
+				logger.Info("Applied privacy policy", "sessions_deleted", r.SessionsDeleted,
+					"emails_cleared", r.EmailsCleared, "ips_anonymized", r.IPsAnonymized, "ips_cleared", r.IPsCleared)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestApply(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	old, older, recent := now.AddDate(0, 0, -40), now.AddDate(0, 0, -100), now.AddDate(0, 0, -1)
+
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url) VALUES (1, 'Gate', 'rtsp://a')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	for _, s := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, user_agent, started_at) VALUES (1, 'a', '10.0.0.1', 'Firefox', ?)`, []interface{}{older}},
+		{`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, user_agent, started_at) VALUES (1, 'b', '10.0.0.1', 'Firefox', ?)`, []interface{}{old}},
+		{`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, user_agent, started_at) VALUES (1, 'c', '10.0.0.2', 'Chrome', ?)`, []interface{}{old}},
+		{`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, user_agent, started_at) VALUES (1, 'd', '10.0.0.1', 'Firefox', ?)`, []interface{}{recent}},
+		{`INSERT INTO feedback (email, message, ip_address, created_at) VALUES ('warga@example.com', 'Camera down', '10.0.0.3', ?)`, []interface{}{older}},
+		{`INSERT INTO feedback (email, message, ip_address, created_at) VALUES ('rt01@example.com', 'Thanks', '10.0.0.4', ?)`, []interface{}{recent}},
+		{`INSERT INTO access_logs (method, path, status, ip, created_at) VALUES ('GET', '/api/areas', 200, '10.0.0.1', ?)`, []interface{}{old}},
+	} {
+		if _, err := db.Exec(s.query, s.args...); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	p := Policy{ViewerSessionDays: 90, FeedbackEmailDays: 60, AnonymizeIPDays: 30, Secret: "secret"}
+
+	t.Run("Report before", func(t *testing.T) {
+		s, err := Report(ctx, db, p, now)
+		if err != nil {
+			t.Fatalf("Report failed: %v", err)
+		}
+		sessions := s.DataSets[0]
+		if sessions.Table != "viewer_sessions" || sessions.Rows != 4 || sessions.Pending != 3 {
+			t.Errorf("Expected 4 sessions, 3 past the policy, got %+v", sessions)
+		}
+		if sessions.Oldest == nil || !sessions.Oldest.Equal(older) {
+			t.Errorf("Expected the oldest session at %v, got %v", older, sessions.Oldest)
+		}
+		if feedback := s.DataSets[1]; feedback.Pending != 1 || len(feedback.Rules) != 2 {
+			t.Errorf("Expected 1 feedback row past the policy, got %+v", feedback)
+		}
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		r, err := Apply(ctx, db, p, now)
+		if err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		// Sessions b and c, feedback 10.0.0.3 and the access log entry
+		if r.SessionsDeleted != 1 || r.EmailsCleared != 1 || r.IPsAnonymized != 4 {
+			t.Errorf("Expected 1 session deleted, 1 email cleared and 4 IPs hashed, got %+v", r)
+		}
+
+		var ipB, ipD, agentB string
+		db.QueryRow(`SELECT ip_address, COALESCE(user_agent, '') FROM viewer_sessions WHERE session_id = 'b'`).Scan(&ipB, &agentB)
+		db.QueryRow(`SELECT ip_address FROM viewer_sessions WHERE session_id = 'd'`).Scan(&ipD)
+		if ipB != HashIP("secret", "10.0.0.1") || agentB != "" {
+			t.Errorf("Expected the old session anonymized, got %q %q", ipB, agentB)
+		}
+		if ipD != "10.0.0.1" {
+			t.Errorf("Expected the recent session untouched, got %q", ipD)
+		}
+
+		var logIP string
+		db.QueryRow(`SELECT ip FROM access_logs`).Scan(&logIP)
+		if logIP != ipB {
+			t.Errorf("Expected the same address to hash the same everywhere, got %q and %q", logIP, ipB)
+		}
+
+		var emails int
+		db.QueryRow(`SELECT COUNT(*) FROM feedback WHERE email IS NOT NULL`).Scan(&emails)
+		if emails != 1 {
+			t.Errorf("Expected only the recent email kept, got %d", emails)
+		}
+	})
+
+	t.Run("Report after", func(t *testing.T) {
+		s, err := Report(ctx, db, p, now)
+		if err != nil {
+			t.Fatalf("Report failed: %v", err)
+		}
+		for _, d := range s.DataSets {
+			if d.Pending != 0 {
+				t.Errorf("Expected nothing left for %s, got %d", d.Table, d.Pending)
+			}
+		}
+
+		r, _ := Apply(ctx, db, p, now)
+		if r != (Result{}) {
+			t.Errorf("Expected a second run to change nothing, got %+v", r)
+		}
+	})
+}
+
+func TestViewerPrivacyMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode      string
+		ip, agent string
+	}{
+		{ViewerOff, "10.0.0.1", "Firefox"},
+		{ViewerHash, HashIP("secret", "10.0.0.1"), ""},
+		{ViewerDrop, "", ""},
+	} {
+		ip, agent := Policy{ViewerMode: tc.mode, Secret: "secret"}.ViewerClient("10.0.0.1", "Firefox")
+		if ip != tc.ip || agent != tc.agent {
+			t.Errorf("%s: expected %q %q, got %q %q", tc.mode, tc.ip, tc.agent, ip, agent)
+		}
+	}
+
+	ctx := context.Background()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, mode := range []string{ViewerHash, ViewerDrop} {
+		t.Run(mode, func(t *testing.T) {
+			db := dbtest.Open(t)
+			if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url) VALUES (1, 'Gate', 'rtsp://a')`); err != nil {
+				t.Fatalf("Failed to seed: %v", err)
+			}
+			// Sessions recorded before the mode was turned on
+			if _, err := db.Exec(`INSERT INTO viewer_sessions (camera_id, session_id, ip_address, user_agent, started_at)
+				VALUES (1, 'a', '10.0.0.1', 'Firefox', ?), (1, 'b', '10.0.0.2', 'Chrome', ?)`, now.Add(-time.Hour), now.Add(-time.Minute)); err != nil {
+				t.Fatalf("Failed to seed: %v", err)
+			}
+
+			p := Policy{ViewerMode: mode, Secret: "secret"}
+			if !p.Enabled() {
+				t.Fatal("Expected the cleanup to run for the viewer privacy mode")
+			}
+			if s, _ := Report(ctx, db, p, now); s.DataSets[0].Pending != 2 || len(s.DataSets[0].Rules) != 1 {
+				t.Errorf("Expected both sessions pending under one rule, got %+v", s.DataSets[0])
+			}
+			if _, err := Apply(ctx, db, p, now); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+
+			var ip, agent sql.NullString
+			db.QueryRow(`SELECT ip_address, user_agent FROM viewer_sessions WHERE session_id = 'b'`).Scan(&ip, &agent)
+			want := HashIP("secret", "10.0.0.2")
+			if mode == ViewerDrop {
+				want = ""
+			}
+			if ip.String != want || agent.Valid {
+				t.Errorf("Expected %q and no user agent, got %v %v", want, ip, agent)
+			}
+			if s, _ := Report(ctx, db, p, now); s.DataSets[0].Pending != 0 {
+				t.Errorf("Expected nothing left, got %d", s.DataSets[0].Pending)
+			}
+		})
+	}
+}
+
+func TestHashIP(t *testing.T) {
+	hash := HashIP("secret", "10.0.0.1")
+	if !strings.HasPrefix(hash, AnonymizedPrefix) || strings.Contains(hash, "10.0.0.1") {
+		t.Errorf("Expected an anonymized address, got %q", hash)
+	}
+	if HashIP("other", "10.0.0.1") == hash {
+		t.Error("Expected the hash to depend on the secret")
+	}
+}
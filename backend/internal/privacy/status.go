@@ -0,0 +1,152 @@
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DataSet is one table holding personal data and what the policy does
+// with it
+type DataSet struct {
+	Table         string     `json:"table"`
+	PersonalData  []string   `json:"personal_data"` // columns
+	Stored        bool       `json:"stored"`        // false when nothing is written to it
+	Rows          int        `json:"rows"`
+	Oldest        *time.Time `json:"oldest"`
+	RetentionDays int        `json:"retention_days"` // rows deleted after this; 0 keeps them
+	Rules         []string   `json:"rules"`          // what happens to personal data before that
+	Pending       int        `json:"pending"`        // rows past a limit the next cleanup will handle
+}
+
+// Status is what personal data is stored and for how long
+type Status struct {
+	DataSets    []DataSet `json:"data_sets"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// Report describes the personal data in db under p at now
+func Report(ctx context.Context, db *sql.DB, p Policy, now time.Time) (Status, error) {
+	now = now.UTC()
+	s := Status{GeneratedAt: now}
+	anonCutoff := now.AddDate(0, 0, -p.AnonymizeIPDays)
+	rawIP := func(column string) string {
+		return column + ` <> '' AND ` + column + ` NOT LIKE '` + AnonymizedPrefix + `%'`
+	}
+
+	sessions := DataSet{
+		Table: "viewer_sessions", PersonalData: []string{"ip_address", "user_agent", "user_id"},
+		Stored: true, RetentionDays: p.ViewerSessionDays, Rules: []string{},
+	}
+	var pending []string
+	var args []interface{}
+	if p.ViewerSessionDays > 0 {
+		pending = append(pending, `started_at < ?`)
+		args = append(args, now.AddDate(0, 0, -p.ViewerSessionDays))
+	}
+	if p.AnonymizeIPDays > 0 {
+		sessions.Rules = append(sessions.Rules, days("ip_address hashed and user_agent cleared after", p.AnonymizeIPDays))
+		pending = append(pending, `((`+rawIP("ip_address")+` OR user_agent IS NOT NULL) AND started_at < ?)`)
+		args = append(args, anonCutoff)
+	}
+	switch p.ViewerMode {
+	case ViewerHash:
+		sessions.Rules = append(sessions.Rules, "only a hash of ip_address kept and user_agent not collected (VIEWER_PRIVACY_MODE=hash)")
+		pending = append(pending, `(`+rawIP("ip_address")+` OR user_agent IS NOT NULL)`)
+	case ViewerDrop:
+		sessions.Rules = append(sessions.Rules, "ip_address and user_agent not collected (VIEWER_PRIVACY_MODE=drop)")
+		pending = append(pending, `(ip_address <> '' OR user_agent IS NOT NULL)`)
+	}
+	if err := describe(ctx, db, &sessions, "started_at", pending, args); err != nil {
+		return s, err
+	}
+
+	feedback := DataSet{
+		Table: "feedback", PersonalData: []string{"name", "email", "ip_address"},
+		Stored: true, Rules: []string{},
+	}
+	pending, args = nil, nil
+	if p.FeedbackEmailDays > 0 {
+		feedback.Rules = append(feedback.Rules, days("email cleared after", p.FeedbackEmailDays))
+		pending = append(pending, `(email IS NOT NULL AND created_at < ?)`)
+		args = append(args, now.AddDate(0, 0, -p.FeedbackEmailDays))
+	}
+	if p.AnonymizeIPDays > 0 {
+		feedback.Rules = append(feedback.Rules, days("ip_address hashed after", p.AnonymizeIPDays))
+		pending = append(pending, `(`+rawIP("ip_address")+` AND created_at < ?)`)
+		args = append(args, anonCutoff)
+	}
+	if err := describe(ctx, db, &feedback, "created_at", pending, args); err != nil {
+		return s, err
+	}
+
+	accessLogs := DataSet{
+		Table: "access_logs", PersonalData: []string{"ip", "user_id"},
+		Stored: p.AccessLogStored, RetentionDays: p.AccessLogDays, Rules: []string{},
+	}
+	pending, args = nil, nil
+	if p.AccessLogStored && p.AccessLogDays > 0 {
+		pending = append(pending, `created_at < ?`)
+		args = append(args, now.AddDate(0, 0, -p.AccessLogDays))
+	}
+	if p.AnonymizeIPDays > 0 {
+		accessLogs.Rules = append(accessLogs.Rules, days("ip hashed after", p.AnonymizeIPDays))
+		pending = append(pending, `(`+rawIP("ip")+` AND created_at < ?)`)
+		args = append(args, anonCutoff)
+	}
+	if err := describe(ctx, db, &accessLogs, "created_at", pending, args); err != nil {
+		return s, err
+	}
+
+	plates := DataSet{
+		Table: "anpr_events", PersonalData: []string{"plate", "snapshot_url"},
+		Stored: true, RetentionDays: p.ANPRDays, Rules: []string{},
+	}
+	pending, args = nil, nil
+	if p.ANPRDays > 0 {
+		pending = append(pending, `created_at < ?`)
+		args = append(args, now.AddDate(0, 0, -p.ANPRDays))
+	}
+	if err := describe(ctx, db, &plates, "created_at", pending, args); err != nil {
+		return s, err
+	}
+
+	s.DataSets = []DataSet{sessions, feedback, accessLogs, plates}
+	return s, nil
+}
+
+// describe fills in the size of d, its oldest row by timeColumn, and the
+// rows matching any of the pending conditions
+func describe(ctx context.Context, db *sql.DB, d *DataSet, timeColumn string, pending []string, args []interface{}) error {
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+d.Table).Scan(&d.Rows); err != nil {
+		return err
+	}
+
+	var oldest time.Time
+	err := db.QueryRowContext(ctx, `SELECT `+timeColumn+` FROM `+d.Table+` WHERE `+timeColumn+` IS NOT NULL ORDER BY `+
+		timeColumn+` ASC LIMIT 1`).Scan(&oldest)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil {
+		d.Oldest = &oldest
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+	where := pending[0]
+	for _, cond := range pending[1:] {
+		where += ` OR ` + cond
+	}
+	return db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+d.Table+` WHERE `+where, args...).Scan(&d.Pending)
+}
+
+func days(rule string, n int) string {
+	if n == 1 {
+		return rule + " 1 day"
+	}
+	return fmt.Sprintf("%s %d days", rule, n)
+}
@@ -0,0 +1,281 @@
+// Package recordings tells video management and evidence systems of new
+// footage. When the recorder finishes a segment or saves an event clip,
+// a signed webhook carries the camera, the time range and a download
+// link that works without an account until it expires.
+//
+// The recorder writes the recordings table; Notifier polls it for
+// finished recordings not yet notified and queues a delivery job for
+// each, so deliveries are retried with the jobs' backoff and survive a
+// restart. Delivery is at least once: receivers should ignore a
+// X-CCTV-Delivery they have already seen.
+package recordings
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Recording kinds, set by the recorder
+const (
+	KindSegment = "segment"
+	KindClip    = "clip"
+)
+
+// Webhook events, by recording kind
+const (
+	EventCompleted = "recording.completed"
+	EventClipSaved = "recording.clip_saved"
+)
+
+// JobType delivers one webhook
+const JobType = "recording_webhook"
+
+const (
+	pollInterval = 10 * time.Second
+	batchSize    = 100
+	maxAttempts  = 10
+
+	// maxAge is how old a finished recording may be and still be
+	// notified, so turning webhooks on does not replay the archive
+	maxAge = 24 * time.Hour
+
+	// dbTimeout bounds each poll query
+	dbTimeout = 5 * time.Second
+)
+
+// Options configure a Notifier
+type Options struct {
+	URL        string        // the receiver
+	Secret     string        // signs the request bodies
+	BaseURL    string        // this API as the receiver reaches it
+	LinkSecret string        // signs the download links
+	LinkTTL    time.Duration // download links expire after this
+}
+
+// Payload is the body of a webhook
+type Payload struct {
+	Event           string     `json:"event"`
+	RecordingID     int64      `json:"recording_id"`
+	Kind            string     `json:"kind"`
+	CameraID        int        `json:"camera_id"`
+	Camera          string     `json:"camera"`
+	StartedAt       *time.Time `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+	DurationSeconds int        `json:"duration_seconds"`
+	FileSize        int64      `json:"file_size"`
+	DownloadURL     string     `json:"download_url"`
+	DownloadExpires time.Time  `json:"download_expires_at"`
+}
+
+// job is the payload of a JobType job
+type job struct {
+	RecordingID int64 `json:"recording_id"`
+}
+
+// Notifier queues and delivers the webhooks of finished recordings
+type Notifier struct {
+	db    *sql.DB
+	queue *jobs.Queue
+	opts  Options
+	now   func() time.Time
+}
+
+func New(db *sql.DB, queue *jobs.Queue, opts Options) *Notifier {
+	return &Notifier{db: db, queue: queue, opts: opts, now: time.Now}
+}
+
+// Run queues the webhooks of recordings finished since the last poll,
+// every 10 seconds until ctx is cancelled. Run it on one instance only;
+// see cluster.Node.Lead.
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := n.poll(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to queue recording webhooks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll queues a delivery for each finished recording not yet notified,
+// and marks those finished too long ago as notified without one
+func (n *Notifier) poll(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	now := n.now().UTC()
+	cutoff := now.Add(-maxAge)
+	if res, err := n.db.ExecContext(ctx, `
+		UPDATE recordings SET notified_at = ? WHERE notified_at IS NULL AND ended_at < ?
+	`, now, cutoff); err != nil {
+		return err
+	} else if skipped, _ := res.RowsAffected(); skipped > 0 {
+		logger.Warn("Skipped webhooks of old recordings", "recordings", skipped, "finished_before", cutoff)
+	}
+
+	rows, err := n.db.QueryContext(ctx, `
+		SELECT id FROM recordings
+		WHERE notified_at IS NULL AND ended_at IS NOT NULL
+		ORDER BY id ASC
+		LIMIT ?
+	`, batchSize)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := n.queue.Enqueue(ctx, JobType, job{RecordingID: id}, jobs.EnqueueOptions{MaxAttempts: maxAttempts}); err != nil {
+			return err
+		}
+		if _, err := n.db.ExecContext(ctx, `UPDATE recordings SET notified_at = ? WHERE id = ?`, now, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deliver is the jobs.Handler for JobType. The download link is made
+// when the webhook is sent, so a retry carries a fresh one.
+func (n *Notifier) Deliver(ctx context.Context, raw json.RawMessage) error {
+	var j job
+	if err := json.Unmarshal(raw, &j); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+
+	p := Payload{RecordingID: j.RecordingID}
+	var started, ended sql.NullTime
+	err := n.db.QueryRowContext(ctx, `
+		SELECT r.kind, r.camera_id, COALESCE(c.name, ''), r.started_at, r.ended_at, r.duration, r.file_size
+		FROM recordings r
+		LEFT JOIN cameras c ON c.id = r.camera_id
+		WHERE r.id = ?
+	`, j.RecordingID).Scan(&p.Kind, &p.CameraID, &p.Camera, &started, &ended, &p.DurationSeconds, &p.FileSize)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted since; there is nothing to download
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if started.Valid {
+		p.StartedAt = &started.Time
+	}
+	if ended.Valid {
+		p.EndedAt = &ended.Time
+	}
+	p.Event = EventCompleted
+	if p.Kind == KindClip {
+		p.Event = EventClipSaved
+	}
+	p.DownloadExpires = n.now().UTC().Add(n.opts.LinkTTL).Truncate(time.Second)
+	p.DownloadURL = DownloadURL(n.opts.BaseURL, n.opts.LinkSecret, p.RecordingID, p.DownloadExpires)
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	timestamp := strconv.FormatInt(n.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CCTV-Event", p.Event)
+	req.Header.Set("X-CCTV-Delivery", p.Event+"-"+strconv.FormatInt(p.RecordingID, 10))
+	req.Header.Set("X-CCTV-Timestamp", timestamp)
+	req.Header.Set("X-CCTV-Signature", Signature(n.opts.Secret, timestamp, body))
+
+	resp, err := httpclient.Shared().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("webhook receiver returned %s", resp.Status)
+		// A rejected request fails the same way when retried
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Signature signs a webhook: sha256= and the hex HMAC-SHA256 under
+// secret of the X-CCTV-Timestamp value, a dot and the body. Receivers
+// recompute it and should reject old timestamps.
+func Signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadURL is a link to a recording's file that needs no account
+// until expires: /api/recording-downloads/:id?expires=<unix>&sig=
+func DownloadURL(baseURL, secret string, id int64, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return fmt.Sprintf("%s/api/recording-downloads/%d?expires=%s&sig=%s", baseURL, id, exp, downloadSignature(secret, id, exp))
+}
+
+// Errors of CheckDownload
+var (
+	ErrBadSignature = errors.New("invalid download signature")
+	ErrLinkExpired  = errors.New("download link has expired")
+)
+
+// CheckDownload verifies the expires and sig of a download link
+func CheckDownload(secret string, id int64, expires, sig string, now time.Time) error {
+	if !hmac.Equal([]byte(sig), []byte(downloadSignature(secret, id, expires))) {
+		return ErrBadSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !now.Before(time.Unix(unix, 0)) {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+func downloadSignature(secret string, id int64, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("recording:" + strconv.FormatInt(id, 10) + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
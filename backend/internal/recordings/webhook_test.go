@@ -0,0 +1,186 @@
+package recordings
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/jobs"
+)
+
+func TestPoll(t *testing.T) {
+	db := dbtest.Open(t)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, stmt := range []string{
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`,
+		`INSERT INTO recordings (id, camera_id, file_path, started_at, ended_at) VALUES
+			(1, 1, 'gate-1.ts', '2026-05-01 11:50:00', '2026-05-01 11:55:00'),
+			(2, 1, 'gate-2.ts', '2026-05-01 11:55:00', NULL),
+			(3, 1, 'gate-3.ts', '2026-04-29 10:00:00', '2026-04-29 10:05:00')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	n := New(db, jobs.New(db, jobs.Options{}), Options{})
+	n.now = func() time.Time { return now }
+	if err := n.poll(context.Background()); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+
+	var payloads []string
+	rows, err := db.Query(`SELECT payload FROM jobs WHERE type = ?`, JobType)
+	if err != nil {
+		t.Fatalf("Failed to read jobs: %v", err)
+	}
+	for rows.Next() {
+		var p string
+		rows.Scan(&p)
+		payloads = append(payloads, p)
+	}
+	rows.Close()
+	if len(payloads) != 1 || payloads[0] != `{"recording_id":1}` {
+		t.Fatalf("Expected one job for the new recording, got %v", payloads)
+	}
+
+	notified := map[int]bool{}
+	rows, err = db.Query(`SELECT id, notified_at IS NOT NULL FROM recordings`)
+	if err != nil {
+		t.Fatalf("Failed to read recordings: %v", err)
+	}
+	for rows.Next() {
+		var id int
+		var ok bool
+		rows.Scan(&id, &ok)
+		notified[id] = ok
+	}
+	rows.Close()
+	if !notified[1] || notified[2] || !notified[3] {
+		t.Errorf("Expected the new and the old recording marked, not the open one, got %v", notified)
+	}
+
+	// A second poll finds nothing new
+	if err := n.poll(context.Background()); err != nil {
+		t.Fatalf("Poll failed: %v", err)
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM jobs`).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected no more jobs, got %d", count)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	db := dbtest.Open(t)
+	for _, stmt := range []string{
+		`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`,
+		`INSERT INTO recordings (id, camera_id, file_path, file_size, duration, kind, started_at, ended_at) VALUES
+			(7, 1, 'gate-7.mp4', 2048, 30, 'clip', '2026-05-01 11:50:00', '2026-05-01 11:50:30')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	var status int
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	n := New(db, nil, Options{
+		URL:        server.URL,
+		Secret:     "hook-secret",
+		BaseURL:    "https://cctv.example.com",
+		LinkSecret: "link-secret",
+		LinkTTL:    time.Hour,
+	})
+	n.now = func() time.Time { return now }
+
+	t.Run("Clip", func(t *testing.T) {
+		status = 204
+		if err := n.Deliver(context.Background(), json.RawMessage(`{"recording_id":7}`)); err != nil {
+			t.Fatalf("Deliver failed: %v", err)
+		}
+		if header.Get("X-CCTV-Event") != EventClipSaved || header.Get("X-CCTV-Delivery") != "recording.clip_saved-7" {
+			t.Errorf("Expected the clip event headers, got %v", header)
+		}
+		if want := Signature("hook-secret", header.Get("X-CCTV-Timestamp"), body); header.Get("X-CCTV-Signature") != want {
+			t.Errorf("Expected signature %s, got %s", want, header.Get("X-CCTV-Signature"))
+		}
+
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Fatalf("Invalid payload: %v", err)
+		}
+		if p.Event != EventClipSaved || p.Kind != KindClip || p.Camera != "Gate" || p.DurationSeconds != 30 || p.FileSize != 2048 {
+			t.Errorf("Expected the clip's details, got %+v", p)
+		}
+		if !p.DownloadExpires.Equal(now.Add(time.Hour)) {
+			t.Errorf("Expected the link to expire in an hour, got %v", p.DownloadExpires)
+		}
+
+		u, err := url.Parse(p.DownloadURL)
+		if err != nil || !strings.HasPrefix(p.DownloadURL, "https://cctv.example.com/api/recording-downloads/7?") {
+			t.Fatalf("Expected a download link, got %q", p.DownloadURL)
+		}
+		q := u.Query()
+		if err := CheckDownload("link-secret", 7, q.Get("expires"), q.Get("sig"), now); err != nil {
+			t.Errorf("Expected a valid link, got %v", err)
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		status = 400
+		if err := n.Deliver(context.Background(), json.RawMessage(`{"recording_id":7}`)); !jobs.IsPermanent(err) {
+			t.Errorf("Expected a permanent failure, got %v", err)
+		}
+		status = 503
+		if err := n.Deliver(context.Background(), json.RawMessage(`{"recording_id":7}`)); err == nil || jobs.IsPermanent(err) {
+			t.Errorf("Expected a failure to retry, got %v", err)
+		}
+	})
+
+	t.Run("Deleted recording", func(t *testing.T) {
+		header = nil
+		if err := n.Deliver(context.Background(), json.RawMessage(`{"recording_id":8}`)); err != nil || header != nil {
+			t.Errorf("Expected nothing sent, got %v", err)
+		}
+	})
+}
+
+func TestCheckDownload(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	u, _ := url.Parse(DownloadURL("https://cctv.example.com", "secret", 3, now.Add(time.Minute)))
+	expires, sig := u.Query().Get("expires"), u.Query().Get("sig")
+
+	for name, tc := range map[string]struct {
+		secret, expires, sig string
+		id                   int64
+		now                  time.Time
+		want                 error
+	}{
+		"Valid":           {"secret", expires, sig, 3, now, nil},
+		"Expired":         {"secret", expires, sig, 3, now.Add(time.Minute), ErrLinkExpired},
+		"Other recording": {"secret", expires, sig, 4, now, ErrBadSignature},
+		"Later expiry":    {"secret", "9999999999", sig, 3, now, ErrBadSignature},
+		"Other secret":    {"other", expires, sig, 3, now, ErrBadSignature},
+	} {
+		if err := CheckDownload(tc.secret, tc.id, tc.expires, tc.sig, tc.now); err != tc.want {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+}
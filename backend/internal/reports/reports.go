@@ -0,0 +1,390 @@
+// Package reports builds the nightly summary of the day before: the
+// cameras that went offline, how many watched and which cameras most,
+// the feedback that came in and how full the storage is. Each day's
+// report is kept in daily_reports, where admins read it under
+// /api/admin/reports/daily/:date, and is announced once as it is built
+// so the alerter can send it on the notification channels.
+//
+// A day runs midnight to midnight in REPORT_TIMEZONE; the report of a
+// day is built once REPORT_HOUR has passed on the next.
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+	// Zone data for REPORT_TIMEZONE, since the runtime image carries none
+	_ "time/tzdata"
+
+	"github.com/abcdefak87/cctv/internal/outages"
+	"github.com/abcdefak87/cctv/internal/sysmon"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// DateLayout is how a report's date is written
+const DateLayout = "2006-01-02"
+
+const (
+	checkInterval = 5 * time.Minute
+
+	// buildTimeout bounds the queries of one report
+	buildTimeout = 30 * time.Second
+
+	// topCameras is how many of the most watched cameras a report lists
+	topCameras = 5
+)
+
+// ErrNotFound is returned for a day without a report
+var ErrNotFound = errors.New("report not found")
+
+// Report is the summary of one day, From until To
+type Report struct {
+	Date        string          `json:"date"`
+	Timezone    string          `json:"timezone"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Cameras     Cameras         `json:"cameras"`
+	Offline     []OfflineCamera `json:"offline_cameras"` // longest downtime first
+	Viewers     Viewers         `json:"viewers"`
+	TopCameras  []TopCamera     `json:"top_cameras"`
+	Feedback    Feedback        `json:"feedback"`
+	Storage     Storage         `json:"storage"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// Cameras counts the cameras when the report was built; Offline those
+// with an outage during the day
+type Cameras struct {
+	Total   int `json:"total"`
+	Enabled int `json:"enabled"`
+	Offline int `json:"offline"`
+}
+
+// OfflineCamera is a camera that was offline during the day. Ongoing is
+// set when it was still offline when the report was built.
+type OfflineCamera struct {
+	CameraID int    `json:"camera_id"`
+	Camera   string `json:"camera"`
+	Outages  int    `json:"outages"`
+	Downtime int64  `json:"downtime_seconds"`
+	Ongoing  bool   `json:"ongoing"`
+}
+
+// Viewers counts the viewer sessions started during the day, and the
+// viewers who started them
+type Viewers struct {
+	Sessions int `json:"sessions"`
+	Unique   int `json:"unique"`
+}
+
+// TopCamera is one of the cameras the most viewers watched
+type TopCamera struct {
+	CameraID int    `json:"camera_id"`
+	Camera   string `json:"camera"`
+	Viewers  int    `json:"viewers"`
+	Sessions int    `json:"sessions"`
+}
+
+// Feedback counts the feedback sent during the day, and all that was
+// still unread when the report was built
+type Feedback struct {
+	New    int `json:"new"`
+	Unread int `json:"unread"`
+}
+
+// Storage is what was recorded during the day, what all recordings take
+// and how full the disks of the instance that built the report were
+type Storage struct {
+	Recordings    int           `json:"recordings"`
+	RecordedBytes int64         `json:"recorded_bytes"`
+	TotalBytes    int64         `json:"total_bytes"`
+	Disks         []sysmon.Disk `json:"disks"`
+}
+
+// Summary lists a kept report
+type Summary struct {
+	Date        string    `json:"date"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// Day returns the bounds of date, written as DateLayout, in loc
+func Day(date string, loc *time.Location) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation(DateLayout, date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return from, from.AddDate(0, 0, 1), nil
+}
+
+// Build returns the report of date in loc as of now, disks being the
+// latest sample of this instance's disks
+func Build(ctx context.Context, db *sql.DB, date string, loc *time.Location, disks []sysmon.Disk, now time.Time) (Report, error) {
+	from, to, err := Day(date, loc)
+	if err != nil {
+		return Report{}, err
+	}
+	r := Report{
+		Date:        date,
+		Timezone:    loc.String(),
+		From:        from.UTC(),
+		To:          to.UTC(),
+		Offline:     []OfflineCamera{},
+		TopCameras:  []TopCamera{},
+		Storage:     Storage{Disks: disks},
+		GeneratedAt: now.UTC(),
+	}
+	if r.Storage.Disks == nil {
+		r.Storage.Disks = []sysmon.Disk{}
+	}
+	for _, step := range []func(context.Context, *sql.DB, *Report) error{
+		buildCameras, buildOffline, buildViewers, buildFeedback, buildStorage,
+	} {
+		if err := step(ctx, db, &r); err != nil {
+			return Report{}, err
+		}
+	}
+	return r, nil
+}
+
+func buildCameras(ctx context.Context, db *sql.DB, r *Report) error {
+	return db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN enabled THEN 1 ELSE 0 END), 0) FROM cameras
+	`).Scan(&r.Cameras.Total, &r.Cameras.Enabled)
+}
+
+func buildOffline(ctx context.Context, db *sql.DB, r *Report) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT o.camera_id, c.name, o.started_at, o.ended_at
+		FROM outages o
+		JOIN cameras c ON c.id = o.camera_id
+		WHERE o.started_at < ? AND (o.ended_at IS NULL OR o.ended_at > ?)
+		ORDER BY o.camera_id, o.started_at
+	`, r.To, r.From)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byCamera := map[int][]outages.Outage{}
+	names := map[int]string{}
+	var ids []int
+	for rows.Next() {
+		var o outages.Outage
+		var name string
+		var ended sql.NullTime
+		if err := rows.Scan(&o.CameraID, &name, &o.StartedAt, &ended); err != nil {
+			return err
+		}
+		if ended.Valid {
+			o.EndedAt = &ended.Time
+		}
+		if _, ok := names[o.CameraID]; !ok {
+			ids = append(ids, o.CameraID)
+			names[o.CameraID] = name
+		}
+		byCamera[o.CameraID] = append(byCamera[o.CameraID], o)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		list := byCamera[id]
+		r.Offline = append(r.Offline, OfflineCamera{
+			CameraID: id,
+			Camera:   names[id],
+			Outages:  len(list),
+			Downtime: int64(outages.Downtime(list, r.From, r.To) / time.Second),
+			Ongoing:  list[len(list)-1].EndedAt == nil,
+		})
+	}
+	sort.SliceStable(r.Offline, func(i, j int) bool { return r.Offline[i].Downtime > r.Offline[j].Downtime })
+	r.Cameras.Offline = len(r.Offline)
+	return nil
+}
+
+// viewerKey names a viewer as the analytics do: by the player's viewer
+// ID, or the session for players that send none
+const viewerKey = `COALESCE(NULLIF(s.viewer_id, ''), s.session_id)`
+
+func buildViewers(ctx context.Context, db *sql.DB, r *Report) error {
+	if err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT `+viewerKey+`)
+		FROM viewer_sessions s
+		WHERE s.started_at >= ? AND s.started_at < ?
+	`, r.From, r.To).Scan(&r.Viewers.Sessions, &r.Viewers.Unique); err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.camera_id, c.name, COUNT(DISTINCT `+viewerKey+`) AS viewers, COUNT(*) AS sessions
+		FROM viewer_sessions s
+		JOIN cameras c ON c.id = s.camera_id
+		WHERE s.started_at >= ? AND s.started_at < ?
+		GROUP BY s.camera_id, c.name
+		ORDER BY viewers DESC, sessions DESC, s.camera_id
+		LIMIT ?
+	`, r.From, r.To, topCameras)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TopCamera
+		if err := rows.Scan(&t.CameraID, &t.Camera, &t.Viewers, &t.Sessions); err != nil {
+			return err
+		}
+		r.TopCameras = append(r.TopCameras, t)
+	}
+	return rows.Err()
+}
+
+func buildFeedback(ctx context.Context, db *sql.DB, r *Report) error {
+	return db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(CASE WHEN created_at >= ? AND created_at < ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'unread' THEN 1 ELSE 0 END), 0)
+		FROM feedback
+	`, r.From, r.To).Scan(&r.Feedback.New, &r.Feedback.Unread)
+}
+
+func buildStorage(ctx context.Context, db *sql.DB, r *Report) error {
+	return db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(CASE WHEN started_at >= ? AND started_at < ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN started_at >= ? AND started_at < ? THEN file_size ELSE 0 END), 0),
+			COALESCE(SUM(file_size), 0)
+		FROM recordings
+	`, r.From, r.To, r.From, r.To).Scan(&r.Storage.Recordings, &r.Storage.RecordedBytes, &r.Storage.TotalBytes)
+}
+
+// Save keeps r unless its day has a report already, and reports whether
+// it did; of instances building the same day only one saves it
+func Save(ctx context.Context, db *sql.DB, r Report) (bool, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return false, err
+	}
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO daily_reports (report_date, data, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (report_date) DO NOTHING
+	`, r.Date, string(data), r.GeneratedAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Get returns the report of date, or ErrNotFound
+func Get(ctx context.Context, db *sql.DB, date string) (Report, error) {
+	var data string
+	err := db.QueryRowContext(ctx, `SELECT data FROM daily_reports WHERE report_date = ?`, date).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrNotFound
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	var r Report
+	return r, json.Unmarshal([]byte(data), &r)
+}
+
+// List returns the kept reports, newest first, at most limit
+func List(ctx context.Context, db *sql.DB, limit int) ([]Summary, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT report_date, created_at FROM daily_reports ORDER BY report_date DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Summary{}
+	for rows.Next() {
+		var s Summary
+		if err := rows.Scan(&s.Date, &s.GeneratedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// Options configure a Generator
+type Options struct {
+	Hour     int // of the next day, in Location, after which a day's report is built
+	Location *time.Location
+	Disks    func() []sysmon.Disk // the latest sample of this instance's disks
+	Built    func(Report)         // called once for each report saved
+}
+
+// Generator builds the report of each day once Hour has passed on the
+// next. A report missed while the server was down is built when it
+// starts, as long as it is still the next day.
+type Generator struct {
+	db   *sql.DB
+	opts Options
+	now  func() time.Time
+}
+
+// New returns a generator; run it on one instance
+func New(db *sql.DB, opts Options) *Generator {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	return &Generator{db: db, opts: opts, now: time.Now}
+}
+
+// Run builds reports until ctx is done
+func (g *Generator) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.Check(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to build the daily report", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check builds and saves the report of yesterday once it is time and it
+// has none yet
+func (g *Generator) Check(ctx context.Context) error {
+	now := g.now().In(g.opts.Location)
+	if now.Hour() < g.opts.Hour {
+		return nil
+	}
+	date := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, g.opts.Location).Format(DateLayout)
+
+	ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+
+	if _, err := Get(ctx, g.db, date); !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	var disks []sysmon.Disk
+	if g.opts.Disks != nil {
+		disks = g.opts.Disks()
+	}
+	r, err := Build(ctx, g.db, date, g.opts.Location, disks, now)
+	if err != nil {
+		return err
+	}
+	saved, err := Save(ctx, g.db, r)
+	if err != nil || !saved {
+		return err
+	}
+	logger.Info("Built the daily report", "date", date, "offline_cameras", r.Cameras.Offline, "sessions", r.Viewers.Sessions)
+	if g.opts.Built != nil {
+		g.opts.Built(r)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/sysmon"
+)
+
+func TestGenerator(t *testing.T) {
+	db := dbtest.Open(t)
+
+	// 2026-03-09 in Jakarta is 17:00 UTC on the 8th until 17:00 on the 9th
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+	from := time.Date(2026, 3, 8, 17, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return from.Add(d) }
+	seed := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO cameras (name, private_rtsp_url, stream_key, enabled) VALUES
+			('Gate', 'rtsp://a', 'gate', TRUE), ('Yard', 'rtsp://b', 'yard', TRUE), ('Dock', 'rtsp://c', 'dock', FALSE)`, nil},
+		// Gate: one outage from the day before and one still going on;
+		// Dock: one over before the day began
+		{`INSERT INTO outages (camera_id, started_at, ended_at) VALUES (1, ?, ?), (1, ?, NULL), (3, ?, ?)`,
+			[]interface{}{at(-time.Hour), at(time.Hour), at(23 * time.Hour), at(-3 * time.Hour), at(-2 * time.Hour)}},
+		{`INSERT INTO viewer_sessions (camera_id, session_id, viewer_id, started_at) VALUES
+			(2, 's1', 'v1', ?), (2, 's2', 'v1', ?), (2, 's3', 'v2', ?), (1, 's4', '', ?), (1, 's5', 'v9', ?)`,
+			[]interface{}{at(time.Hour), at(2 * time.Hour), at(3 * time.Hour), at(4 * time.Hour), at(-time.Minute)}},
+		{`INSERT INTO feedback (message, status, created_at) VALUES ('a', 'unread', ?), ('b', 'read', ?), ('c', 'unread', ?)`,
+			[]interface{}{at(time.Hour), at(2 * time.Hour), at(-time.Hour)}},
+		{`INSERT INTO recordings (camera_id, file_path, file_size, started_at) VALUES (1, 'a.mp4', 100, ?), (2, 'b.mp4', 50, ?)`,
+			[]interface{}{at(time.Hour), at(-time.Hour)}},
+	}
+	for _, s := range seed {
+		if _, err := db.Exec(s.query, s.args...); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	var built []Report
+	disks := []sysmon.Disk{{Name: "recordings", UsedPercent: 40}}
+	g := New(db, Options{
+		Hour:     1,
+		Location: jakarta,
+		Disks:    func() []sysmon.Disk { return disks },
+		Built:    func(r Report) { built = append(built, r) },
+	})
+	ctx := context.Background()
+
+	// 00:30 on the 10th in Jakarta, before REPORT_HOUR
+	g.now = func() time.Time { return at(24*time.Hour + 30*time.Minute) }
+	if err := g.Check(ctx); err != nil || len(built) != 0 {
+		t.Fatalf("Expected no report before the hour, got %v, %v", built, err)
+	}
+
+	g.now = func() time.Time { return at(25*time.Hour + 30*time.Minute) }
+	for i := 0; i < 2; i++ {
+		if err := g.Check(ctx); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+	if len(built) != 1 {
+		t.Fatalf("Expected one report built, got %d", len(built))
+	}
+
+	r, err := Get(ctx, db, "2026-03-09")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !r.From.Equal(from) || !r.To.Equal(at(24*time.Hour)) || r.Timezone != "Asia/Jakarta" {
+		t.Errorf("Expected the Jakarta day, got %s to %s in %s", r.From, r.To, r.Timezone)
+	}
+	if r.Cameras != (Cameras{Total: 3, Enabled: 2, Offline: 1}) {
+		t.Errorf("Cameras = %+v", r.Cameras)
+	}
+	if len(r.Offline) != 1 || r.Offline[0] != (OfflineCamera{CameraID: 1, Camera: "Gate", Outages: 2, Downtime: 7200, Ongoing: true}) {
+		t.Errorf("Offline = %+v", r.Offline)
+	}
+	if r.Viewers != (Viewers{Sessions: 4, Unique: 3}) {
+		t.Errorf("Viewers = %+v", r.Viewers)
+	}
+	if len(r.TopCameras) != 2 || r.TopCameras[0] != (TopCamera{CameraID: 2, Camera: "Yard", Viewers: 2, Sessions: 3}) {
+		t.Errorf("TopCameras = %+v", r.TopCameras)
+	}
+	if r.Feedback != (Feedback{New: 2, Unread: 2}) {
+		t.Errorf("Feedback = %+v", r.Feedback)
+	}
+	if s := r.Storage; s.Recordings != 1 || s.RecordedBytes != 100 || s.TotalBytes != 150 || len(s.Disks) != 1 {
+		t.Errorf("Storage = %+v", s)
+	}
+
+	if list, err := List(ctx, db, 10); err != nil || len(list) != 1 || list[0].Date != "2026-03-09" {
+		t.Errorf("List = %+v, %v", list, err)
+	}
+	if _, err := Get(ctx, db, "2026-03-08"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a day without a report, got %v", err)
+	}
+}
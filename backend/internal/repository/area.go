@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/geo"
+)
+
+// AreaRepository looks up areas for camera placement
+type AreaRepository interface {
+	FindContaining(ctx context.Context, lat, lng float64) (*int, error)
+	Exists(ctx context.Context, id int) (bool, error)
+}
+
+type sqlAreaRepository struct {
+	db *sql.DB
+}
+
+func NewAreaRepository(db *sql.DB) AreaRepository {
+	return &sqlAreaRepository{db: db}
+}
+
+// FindContaining returns the smallest area whose boundary contains the
+// point, so a camera lands in its RT rather than the whole kecamatan.
+// Only areas of the ctx organization are considered. Returns nil when no
+// boundary matches.
+func (r *sqlAreaRepository) FindContaining(ctx context.Context, lat, lng float64) (*int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, boundary FROM areas
+		WHERE boundary IS NOT NULL AND boundary != '' AND organization_id = ?
+	`, tenant.OrgID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var match *int
+	smallest := 0.0
+	for rows.Next() {
+		var id int
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			continue
+		}
+
+		boundary, err := geo.ParseBoundary([]byte(raw))
+		if err != nil || !boundary.Contains(lat, lng) {
+			continue
+		}
+
+		if size := boundary.Area(); match == nil || size < smallest {
+			areaID := id
+			match = &areaID
+			smallest = size
+		}
+	}
+
+	return match, rows.Err()
+}
+
+// Exists reports whether area id belongs to the ctx organization
+func (r *sqlAreaRepository) Exists(ctx context.Context, id int) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM areas WHERE id = ? AND organization_id = ?",
+		id, tenant.OrgID(ctx)).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+)
+
+// CameraRepository stores cameras. Every method works in the
+// organization of ctx; see tenant.OrgID.
+type CameraRepository interface {
+	List(ctx context.Context, opts ListOptions) ([]models.Camera, error)
+	Count(ctx context.Context) (int, error)
+	ListActive(ctx context.Context, opts ListOptions) ([]models.PublicCamera, error)
+	CountActive(ctx context.Context) (int, error)
+	Get(ctx context.Context, id int) (*models.Camera, error)
+	Create(ctx context.Context, camera *models.Camera) (int64, error)
+	Update(ctx context.Context, camera *models.Camera) error
+	Delete(ctx context.Context, id int) error
+	SetEnabled(ctx context.Context, id int, enabled bool) error
+}
+
+type sqlCameraRepository struct {
+	db *sql.DB
+}
+
+func NewCameraRepository(db *sql.DB) CameraRepository {
+	return &sqlCameraRepository{db: db}
+}
+
+const cameraSelect = `
+	SELECT c.id, c.name, c.private_rtsp_url, c.description, c.location,
+	       c.group_name, c.area_id, c.latitude, c.longitude, c.enabled, c.traffic, c.watermark, c.recording_enabled, c.stream_key,
+	       c.stream_node, c.created_at, c.updated_at, a.name as area_name
+	FROM cameras c
+	LEFT JOIN areas a ON c.area_id = a.id
+`
+
+func scanCamera(scanner interface{ Scan(...interface{}) error }) (*models.Camera, error) {
+	var camera models.Camera
+	err := scanner.Scan(
+		&camera.ID, &camera.Name, &camera.PrivateRTSPURL, &camera.Description,
+		&camera.Location, &camera.GroupName, &camera.AreaID, &camera.Latitude,
+		&camera.Longitude, &camera.Enabled, &camera.Traffic, &camera.Watermark, &camera.Recording,
+		&camera.StreamKey, &camera.StreamNode, &camera.CreatedAt, &camera.UpdatedAt, &camera.AreaName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &camera, nil
+}
+
+func (r *sqlCameraRepository) List(ctx context.Context, opts ListOptions) ([]models.Camera, error) {
+	query, args := opts.apply(cameraSelect+" WHERE c.organization_id = ? ORDER BY c.id ASC",
+		[]interface{}{tenant.OrgID(ctx)})
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cameras := []models.Camera{}
+	for rows.Next() {
+		camera, err := scanCamera(rows)
+		if err != nil {
+			continue
+		}
+		cameras = append(cameras, *camera)
+	}
+
+	return cameras, rows.Err()
+}
+
+func (r *sqlCameraRepository) Count(ctx context.Context) (int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM cameras WHERE organization_id = ?",
+		tenant.OrgID(ctx)).Scan(&total)
+	return total, err
+}
+
+func (r *sqlCameraRepository) ListActive(ctx context.Context, opts ListOptions) ([]models.PublicCamera, error) {
+	query, args := opts.apply(`
+		SELECT c.id, c.name, c.description, c.location, c.group_name,
+		       c.area_id, c.latitude, c.longitude, c.stream_key, a.name as area_name
+		FROM cameras c
+		LEFT JOIN areas a ON c.area_id = a.id
+		WHERE c.enabled = TRUE AND c.organization_id = ?
+		ORDER BY c.id ASC
+	`, []interface{}{tenant.OrgID(ctx)})
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cameras := []models.PublicCamera{}
+	for rows.Next() {
+		var camera models.PublicCamera
+		err := rows.Scan(&camera.ID, &camera.Name, &camera.Description, &camera.Location,
+			&camera.GroupName, &camera.AreaID, &camera.Latitude, &camera.Longitude,
+			&camera.StreamKey, &camera.AreaName)
+		if err != nil {
+			continue
+		}
+		cameras = append(cameras, camera)
+	}
+
+	return cameras, rows.Err()
+}
+
+func (r *sqlCameraRepository) CountActive(ctx context.Context) (int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM cameras WHERE enabled = TRUE AND organization_id = ?",
+		tenant.OrgID(ctx)).Scan(&total)
+	return total, err
+}
+
+func (r *sqlCameraRepository) Get(ctx context.Context, id int) (*models.Camera, error) {
+	camera, err := scanCamera(r.db.QueryRowContext(ctx, cameraSelect+" WHERE c.id = ? AND c.organization_id = ?",
+		id, tenant.OrgID(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return camera, err
+}
+
+func (r *sqlCameraRepository) Create(ctx context.Context, camera *models.Camera) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO cameras (name, private_rtsp_url, description, location,
+		                     group_name, area_id, latitude, longitude, enabled, traffic, watermark, recording_enabled,
+		                     stream_key, stream_node, organization_id, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, camera.Name, camera.PrivateRTSPURL, camera.Description, camera.Location,
+		camera.GroupName, camera.AreaID, camera.Latitude, camera.Longitude,
+		camera.Enabled, camera.Traffic, camera.Watermark, camera.Recording, camera.StreamKey, camera.StreamNode, tenant.OrgID(ctx), time.Now()).Scan(&id)
+	return id, err
+}
+
+func (r *sqlCameraRepository) Update(ctx context.Context, camera *models.Camera) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE cameras
+		SET name = ?, private_rtsp_url = ?, description = ?, location = ?,
+		    group_name = ?, area_id = ?, latitude = ?, longitude = ?, enabled = ?, traffic = ?, watermark = ?,
+		    recording_enabled = ?, stream_node = ?, updated_at = ?
+		WHERE id = ? AND organization_id = ?
+	`, camera.Name, camera.PrivateRTSPURL, camera.Description, camera.Location,
+		camera.GroupName, camera.AreaID, camera.Latitude, camera.Longitude,
+		camera.Enabled, camera.Traffic, camera.Watermark, camera.Recording, camera.StreamNode, time.Now(), camera.ID, tenant.OrgID(ctx))
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (r *sqlCameraRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM cameras WHERE id = ? AND organization_id = ?",
+		id, tenant.OrgID(ctx))
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (r *sqlCameraRepository) SetEnabled(ctx context.Context, id int, enabled bool) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE cameras SET enabled = ?, updated_at = ? WHERE id = ? AND organization_id = ?",
+		enabled, time.Now(), id, tenant.OrgID(ctx))
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
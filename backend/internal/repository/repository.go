@@ -0,0 +1,43 @@
+// Package repository holds the SQL behind the HTTP handlers. Each
+// repository is an interface with a database/sql implementation so
+// services can be tested against fakes.
+package repository
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrNotFound is returned when the requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// ListOptions limits a list query. Limit 0 returns every row.
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+// Paged reports whether a LIMIT should be applied
+func (o ListOptions) Paged() bool {
+	return o.Limit > 0
+}
+
+// apply appends LIMIT/OFFSET for paged queries
+func (o ListOptions) apply(query string, args []interface{}) (string, []interface{}) {
+	if !o.Paged() {
+		return query, args
+	}
+	return query + " LIMIT ? OFFSET ?", append(args, o.Limit, o.Offset)
+}
+
+// requireRow maps an UPDATE/DELETE that touched nothing to ErrNotFound
+func requireRow(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
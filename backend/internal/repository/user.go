@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/tenant"
+)
+
+// UserRepository stores admin users. Users are listed, read and changed
+// within the organization of ctx; usernames are unique across all of
+// them, as login does not know the organization yet.
+type UserRepository interface {
+	List(ctx context.Context, opts ListOptions) ([]models.User, error)
+	Count(ctx context.Context) (int, error)
+	Get(ctx context.Context, id int) (*models.User, error)
+	UsernameExists(ctx context.Context, username string) (bool, error)
+	IDByUsername(ctx context.Context, username string) (int, error)
+	CountByRole(ctx context.Context, role string) (int, error)
+	Create(ctx context.Context, user *models.User) (int64, error)
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id int) error
+	PasswordHash(ctx context.Context, id int) (string, error)
+	SetPasswordHash(ctx context.Context, id int, hash string) error
+}
+
+type sqlUserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) UserRepository {
+	return &sqlUserRepository{db: db}
+}
+
+func (r *sqlUserRepository) List(ctx context.Context, opts ListOptions) ([]models.User, error) {
+	query, args := opts.apply(`
+		SELECT id, username, email, role, permissions, organization_id, avatar, created_at, updated_at
+		FROM users
+		WHERE organization_id = ?
+		ORDER BY id ASC
+	`, []interface{}{tenant.OrgID(ctx)})
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		var permissions string
+		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &permissions,
+			&user.OrganizationID, &user.Avatar, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			continue
+		}
+		user.Permissions = SplitPermissions(permissions)
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *sqlUserRepository) Count(ctx context.Context) (int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE organization_id = ?",
+		tenant.OrgID(ctx)).Scan(&total)
+	return total, err
+}
+
+func (r *sqlUserRepository) Get(ctx context.Context, id int) (*models.User, error) {
+	var user models.User
+	var permissions string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, username, email, role, permissions, organization_id, avatar, created_at, updated_at
+		FROM users WHERE id = ? AND organization_id = ?
+	`, id, tenant.OrgID(ctx)).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &permissions,
+		&user.OrganizationID, &user.Avatar, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.Permissions = SplitPermissions(permissions)
+	return &user, nil
+}
+
+func (r *sqlUserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+	var exists int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&exists)
+	return exists > 0, err
+}
+
+func (r *sqlUserRepository) IDByUsername(ctx context.Context, username string) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", username).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+func (r *sqlUserRepository) CountByRole(ctx context.Context, role string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE role = ?", role).Scan(&count)
+	return count, err
+}
+
+// Create inserts the user with user.PasswordHash already hashed
+func (r *sqlUserRepository) Create(ctx context.Context, user *models.User) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO users (username, email, password_hash, role, permissions, organization_id, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, user.Username, user.Email, user.PasswordHash, user.Role, strings.Join(user.Permissions, ","),
+		tenant.OrgID(ctx), time.Now()).Scan(&id)
+	return id, err
+}
+
+// Update saves the profile fields; the password is only changed when
+// user.PasswordHash is set
+func (r *sqlUserRepository) Update(ctx context.Context, user *models.User) error {
+	var result sql.Result
+	var err error
+	if user.PasswordHash != "" {
+		result, err = r.db.ExecContext(ctx, `
+			UPDATE users
+			SET username = ?, email = ?, password_hash = ?, role = ?, permissions = ?, updated_at = ?
+			WHERE id = ? AND organization_id = ?
+		`, user.Username, user.Email, user.PasswordHash, user.Role, strings.Join(user.Permissions, ","), time.Now(),
+			user.ID, tenant.OrgID(ctx))
+	} else {
+		result, err = r.db.ExecContext(ctx, `
+			UPDATE users
+			SET username = ?, email = ?, role = ?, permissions = ?, updated_at = ?
+			WHERE id = ? AND organization_id = ?
+		`, user.Username, user.Email, user.Role, strings.Join(user.Permissions, ","), time.Now(),
+			user.ID, tenant.OrgID(ctx))
+	}
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (r *sqlUserRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = ? AND organization_id = ?",
+		id, tenant.OrgID(ctx))
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (r *sqlUserRepository) PasswordHash(ctx context.Context, id int) (string, error) {
+	var hash string
+	err := r.db.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = ? AND organization_id = ?",
+		id, tenant.OrgID(ctx)).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return hash, err
+}
+
+// SetPasswordHash is not scoped, so reset-password works for any
+// organization; callers check the user first
+func (r *sqlUserRepository) SetPasswordHash(ctx context.Context, id int, hash string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
+		hash, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+// SplitPermissions reads the comma separated permissions column
+func SplitPermissions(column string) []string {
+	permissions := []string{}
+	for _, p := range strings.Split(column, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
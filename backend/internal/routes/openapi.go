@@ -0,0 +1,679 @@
+package routes
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/abuse"
+	"github.com/abcdefak87/cctv/internal/accesslog"
+	"github.com/abcdefak87/cctv/internal/alerting"
+	"github.com/abcdefak87/cctv/internal/anpr"
+	"github.com/abcdefak87/cctv/internal/detection"
+	"github.com/abcdefak87/cctv/internal/edge"
+	"github.com/abcdefak87/cctv/internal/handlers"
+	"github.com/abcdefak87/cctv/internal/incidents"
+	"github.com/abcdefak87/cctv/internal/infraalerts"
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/internal/logretention"
+	"github.com/abcdefak87/cctv/internal/maintenance"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/motion"
+	"github.com/abcdefak87/cctv/internal/privacy"
+	"github.com/abcdefak87/cctv/internal/reports"
+	"github.com/abcdefak87/cctv/internal/status"
+	"github.com/abcdefak87/cctv/internal/streamsync"
+	"github.com/abcdefak87/cctv/internal/sysmon"
+	"github.com/abcdefak87/cctv/internal/ticketing"
+	"github.com/abcdefak87/cctv/internal/traffic"
+	"github.com/abcdefak87/cctv/internal/uploads"
+	"github.com/abcdefak87/cctv/internal/watchdog"
+	"github.com/abcdefak87/cctv/internal/weather"
+	"github.com/abcdefak87/cctv/pkg/openapi"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var liveness = struct {
+	Status string `json:"status"`
+	Env    string `json:"env"`
+}{}
+
+// apiDocs documents every route, keyed "METHOD /path" with Fiber path
+// syntax and no trailing slash. TestAPIDocsCoverRoutes fails when a
+// route is added without an entry here or an entry outlives its route.
+var apiDocs = map[string]openapi.Route{
+	"GET /health":           {Summary: "Liveness check", Tag: "System", Raw: liveness},
+	"GET /health/live":      {Summary: "Liveness check", Tag: "System", Raw: liveness},
+	"GET /metrics":          {Summary: "Prometheus metrics of this instance, such as stream start latency; needs METRICS_TOKEN as a bearer token", Tag: "System", ContentType: "text/plain"},
+	"GET /health/ready":     {Summary: "Readiness check; 503 when a critical dependency is down", Tag: "System", Raw: handlers.Readiness{}},
+	"GET /api/openapi.json": {Summary: "This OpenAPI document", Tag: "System", Raw: anyObject},
+	"GET /api/docs":         {Summary: "Swagger UI (development only)", Tag: "System", ContentType: "text/html"},
+
+	// Auth
+	"POST /api/auth/login":  {Summary: "Log in and receive a JWT", Tag: "Auth", Body: models.LoginRequest{}, Raw: models.LoginResponse{}},
+	"POST /api/auth/logout": {Summary: "Clear the auth cookie", Tag: "Auth"},
+	"GET /api/auth/csrf": {Summary: "Get a CSRF token", Tag: "Auth", Data: struct {
+		Token string `json:"token"`
+	}{}},
+	"POST /api/auth/refresh": {Summary: "Exchange a valid token for a fresh one", Tag: "Auth", Raw: struct {
+		Success bool   `json:"success"`
+		Token   string `json:"token"`
+	}{}},
+	"GET /api/auth/verify": {Summary: "Return the user behind the token", Tag: "Auth", Auth: true, Raw: struct {
+		Success bool          `json:"success"`
+		User    userReference `json:"user"`
+	}{}},
+
+	// Cameras
+	"GET /api/cameras/search": {Summary: "Enabled cameras whose name, location or area contains q, names starting with it first, with their online status; rate limited by RATE_LIMIT_SEARCH", Tag: "Cameras", Data: []models.CameraSearchResult{},
+		Query: []openapi.Query{
+			{Name: "q", Type: "string", Description: "2 to 100 characters, case-insensitive"},
+			{Name: "limit", Type: "integer", Description: "Cameras returned, 1 to 50 (default 10)"},
+		}},
+	"GET /api/cameras/active": {Summary: "List enabled cameras for the public map", Tag: "Cameras", Paginated: true, Data: []models.PublicCamera{},
+		Query: []openapi.Query{fieldsQuery}},
+	"GET /api/cameras": {Summary: "List all cameras; operators get them without credentials, viewers as the public does", Tag: "Cameras", Auth: true, Paginated: true, Data: []models.Camera{},
+		Query: []openapi.Query{fieldsQuery}},
+	"GET /api/cameras/:id": {Summary: "Get a camera, redacted for the role as the list is", Tag: "Cameras", Auth: true, Data: models.Camera{}},
+	"POST /api/cameras":    {Summary: "Create a camera (admins and org admins)", Tag: "Cameras", Auth: true, Created: true, Body: handlers.CameraRequest{}, Data: createdID{}},
+	"POST /api/cameras/import-urls": {Summary: "Create a camera for each RTSP URL of a text/plain body, one per line: each is probed, named after its address and added to go2rtc; returns what became of every line (admin only)", Tag: "Cameras", Auth: true, Data: handlers.URLImportResult{},
+		Query: []openapi.Query{{Name: "stream_node", Type: "string", Description: "Stream node from STREAM_NODES to add the streams to instead of the local go2rtc"}}},
+	"PUT /api/cameras/:id":    {Summary: "Update a camera (admins and org admins)", Tag: "Cameras", Auth: true, Body: handlers.CameraRequest{}},
+	"DELETE /api/cameras/:id": {Summary: "Delete a camera (admins and org admins)", Tag: "Cameras", Auth: true},
+	"PATCH /api/cameras/:id/toggle": {Summary: "Enable or disable a camera (admins and org admins)", Tag: "Cameras", Auth: true, Data: struct {
+		Enabled bool `json:"enabled"`
+	}{}},
+	"GET /api/cameras/:id/motion-events": {Summary: "Motion detected on a camera, newest first", Tag: "Cameras", Auth: true, Paginated: true, Cursor: true, Data: []motion.Event{},
+		Query: []openapi.Query{
+			{Name: "from", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (inclusive)"},
+		}},
+	"GET /api/cameras/:id/motion-settings": {Summary: "Motion detection settings for a camera", Tag: "Cameras", Auth: true, Data: motion.Settings{}},
+	"PUT /api/cameras/:id/motion-settings": {Summary: "Replace motion detection settings for a camera (admins and org admins)", Tag: "Cameras", Auth: true, Body: handlers.MotionSettingsRequest{}, Data: motion.Settings{}},
+	"GET /api/cameras/:id/health-probes":   {Summary: "Health probes of a camera with their latest results", Tag: "Cameras", Auth: true, Data: []watchdog.Probe{}},
+	"PUT /api/cameras/:id/health-probes":   {Summary: "Replace the health probes of a camera (ping, tcp, rtsp, onvif, http) (admins and org admins)", Tag: "Cameras", Auth: true, Body: handlers.CameraProbesRequest{}, Data: []watchdog.Probe{}},
+
+	// Areas
+	"GET /api/areas":        {Summary: "List areas", Tag: "Areas", Paginated: true, Data: []models.Area{}},
+	"GET /api/areas/public": {Summary: "List areas (public alias)", Tag: "Areas", Paginated: true, Data: []models.Area{}},
+	"GET /api/areas/tree":   {Summary: "Areas nested by parent", Tag: "Areas", Data: []models.Area{}},
+	"GET /api/areas/geojson": {Summary: "Area boundaries as a GeoJSON FeatureCollection", Tag: "Areas",
+		ContentType: "application/geo+json", Raw: struct {
+			Type     string        `json:"type"`
+			Features []interface{} `json:"features"`
+		}{}},
+	"GET /api/public/areas/:slug": {Summary: "The public page of an area: its cameras and those of its sub-areas with thumbnails, online and viewer counts, and active announcements", Tag: "Areas", Data: models.AreaPage{}},
+	"GET /api/areas/:id":          {Summary: "Get an area", Tag: "Areas", Auth: true, Data: models.Area{}},
+	"GET /api/areas/:id/stats": {Summary: "Camera and viewer statistics for an area and its children", Tag: "Areas", Auth: true,
+		Query: []openapi.Query{{Name: "range", Type: "string", Description: "24h, 7d or 30d"}, {Name: "limit", Type: "integer", Description: "Top cameras to return"}},
+		Data:  anyObject},
+	"POST /api/areas": {Summary: "Create an area (admins and org admins)", Tag: "Areas", Auth: true, Created: true, Body: handlers.AreaRequest{}, Data: struct {
+		ID   int64  `json:"id"`
+		Slug string `json:"slug"`
+	}{}},
+	"PUT /api/areas/:id": {Summary: "Update an area (admins and org admins)", Tag: "Areas", Auth: true, Body: handlers.AreaRequest{}},
+	"DELETE /api/areas/:id": {Summary: "Delete an area (admins and org admins)", Tag: "Areas", Auth: true,
+		Query: []openapi.Query{
+			{Name: "mode", Type: "string", Description: "reassign or detach, required when the area has cameras"},
+			{Name: "reassign_to", Type: "integer", Description: "Area that receives the cameras when mode=reassign"},
+		},
+		Data: struct {
+			CamerasMoved  int  `json:"cameras_moved"`
+			CamerasTarget *int `json:"cameras_target"`
+			ChildrenMoved int  `json:"children_moved"`
+		}{}},
+
+	// Users
+	"GET /api/users":        {Summary: "List users", Tag: "Users", Auth: true, Paginated: true, Data: []models.User{}},
+	"GET /api/users/:id":    {Summary: "Get a user", Tag: "Users", Auth: true, Data: models.User{}},
+	"POST /api/users":       {Summary: "Create a user", Tag: "Users", Auth: true, Created: true, Body: handlers.UserRequest{}, Data: createdID{}},
+	"PUT /api/users/:id":    {Summary: "Update a user", Tag: "Users", Auth: true, Body: handlers.UserRequest{}},
+	"DELETE /api/users/:id": {Summary: "Delete a user", Tag: "Users", Auth: true},
+	"POST /api/users/:id/change-password": {Summary: "Change a user's password", Tag: "Users", Auth: true, Body: struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}{}},
+
+	// Organizations
+	"GET /api/organizations":        {Summary: "List organizations; admins only", Tag: "Organizations", Auth: true, Data: []models.Organization{}},
+	"POST /api/organizations":       {Summary: "Create an organization; admins only", Tag: "Organizations", Auth: true, Created: true, Body: handlers.OrganizationRequest{}, Data: createdID{}},
+	"PUT /api/organizations/:id":    {Summary: "Replace an organization's name, slug and domain; admins only", Tag: "Organizations", Auth: true, Body: handlers.OrganizationRequest{}},
+	"DELETE /api/organizations/:id": {Summary: "Delete an empty organization; admins only", Tag: "Organizations", Auth: true},
+
+	// Settings
+	"GET /api/settings/landing-page":       {Summary: "Landing page settings", Tag: "Settings", Data: anyObject},
+	"GET /api/settings/map-center":         {Summary: "Default map center", Tag: "Settings", Data: anyObject},
+	"GET /api/settings":                    {Summary: "All settings grouped by category", Tag: "Settings", Auth: true, Data: map[string]map[string]setting{}},
+	"GET /api/settings/category/:category": {Summary: "Settings in one category", Tag: "Settings", Auth: true, Data: map[string]setting{}},
+	"GET /api/settings/:key":               {Summary: "Get a setting", Tag: "Settings", Auth: true, Data: setting{}},
+	"PUT /api/settings/:key":               {Summary: "Create or update a setting (admins and org admins)", Tag: "Settings", Auth: true, Body: settingRequest{}},
+	"DELETE /api/settings/:key":            {Summary: "Delete a setting (admins and org admins)", Tag: "Settings", Auth: true},
+	"POST /api/settings/bulk":              {Summary: "Validate several settings against the settings schema and write them in one transaction: all or none. Also takes the older {key: value} object (admins and org admins)", Tag: "Settings", Auth: true, Body: bulkSettingsRequest{}, Data: []handlers.SettingResult{}},
+	"GET /api/public/bootstrap":            {Summary: "Branding, landing page settings, map center, areas, active announcements and feature flags in one response, for the public page's first load", Tag: "Settings", Data: models.Bootstrap{}},
+	"GET /api/branding/public":             {Summary: "Public branding", Tag: "Settings", Data: anyObject},
+	"GET /api/branding/admin":              {Summary: "Branding settings for the admin panel", Tag: "Settings", Data: []map[string]interface{}{}},
+	"GET /api/saweria/config":              {Summary: "Public Saweria configuration", Tag: "Settings", Data: anyObject},
+	"GET /api/saweria/settings":            {Summary: "Saweria settings", Tag: "Settings", Data: anyObject},
+	"GET /api/admin/settings/timezone":     {Summary: "Server timezone", Tag: "Settings", Auth: true, Data: anyObject},
+
+	// Incidents
+	"GET /api/admin/incidents": {Summary: "Incidents, newest first", Tag: "Incidents", Auth: true, Paginated: true, Data: []incidents.Incident{},
+		Query: []openapi.Query{
+			{Name: "status", Type: "string", Description: "open, acknowledged or resolved"},
+			{Name: "camera_id", Type: "integer", Description: "Incidents affecting this camera"},
+		}},
+	"GET /api/admin/incidents/:id":          {Summary: "Get an incident with its timeline", Tag: "Incidents", Auth: true, Data: incidents.Incident{}},
+	"POST /api/admin/incidents":             {Summary: "Open an incident, optionally from an alert's detection (operators and above)", Tag: "Incidents", Auth: true, Created: true, Body: handlers.IncidentRequest{}, Data: createdID{}},
+	"PUT /api/admin/incidents/:id":          {Summary: "Replace an incident's title, severity, publication and cameras (operators and above)", Tag: "Incidents", Auth: true, Body: handlers.IncidentRequest{}},
+	"POST /api/admin/incidents/:id/updates": {Summary: "Add a note and/or acknowledge, resolve or reopen an incident (operators and above)", Tag: "Incidents", Auth: true, Created: true, Body: handlers.IncidentUpdateRequest{}, Data: incidents.Update{}},
+	"DELETE /api/admin/incidents/:id":       {Summary: "Delete an incident (operators and above)", Tag: "Incidents", Auth: true},
+
+	// Playlists
+	"GET /api/admin/playlists":            {Summary: "Kiosk playlists, by name", Tag: "Playlists", Auth: true, Data: []models.Playlist{}},
+	"GET /api/admin/playlists/:id":        {Summary: "Get a kiosk playlist", Tag: "Playlists", Auth: true, Data: models.Playlist{}},
+	"POST /api/admin/playlists":           {Summary: "Create a kiosk playlist; the response holds its token, shown only once (admins and org admins)", Tag: "Playlists", Auth: true, Created: true, Body: handlers.PlaylistRequest{}, Data: kioskToken{}},
+	"PUT /api/admin/playlists/:id":        {Summary: "Replace a playlist's name, layout, dwell time and cameras (admins and org admins)", Tag: "Playlists", Auth: true, Body: handlers.PlaylistRequest{}},
+	"POST /api/admin/playlists/:id/token": {Summary: "Replace a playlist's kiosk token (admins and org admins)", Tag: "Playlists", Auth: true, Data: kioskToken{}},
+	"DELETE /api/admin/playlists/:id":     {Summary: "Delete a kiosk playlist (admins and org admins)", Tag: "Playlists", Auth: true},
+	"GET /api/kiosk/:token/playlist":      {Summary: "The playlist a kiosk token opens, with stream URLs of its enabled cameras", Tag: "Playlists", Data: models.KioskPlaylist{}},
+
+	// Share links
+	"GET /api/cameras/:id/shares":          {Summary: "Share links of a camera, newest first", Tag: "Share links", Auth: true, Data: []models.CameraShare{}},
+	"POST /api/cameras/:id/share":          {Summary: "Create a short link to a camera's public player, optionally expiring or limited to a number of views (admins and org admins)", Tag: "Share links", Auth: true, Created: true, Body: handlers.ShareRequest{}, Data: models.CameraShare{}},
+	"DELETE /api/cameras/:id/shares/:slug": {Summary: "Revoke a share link (admins and org admins)", Tag: "Share links", Auth: true},
+
+	// Offline images
+	"GET /api/cameras/:id/offline-image":    {Summary: "The image shown instead of a camera's snapshot while it is offline", Tag: "Offline images", Auth: true, ContentType: "image/jpeg"},
+	"PUT /api/cameras/:id/offline-image":    {Summary: "Upload a camera's offline image: a JPEG, PNG or WebP of at most 768 KB (admins and org admins)", Tag: "Offline images", Auth: true, Upload: "image", Data: anyObject},
+	"DELETE /api/cameras/:id/offline-image": {Summary: "Remove a camera's offline image; the organization's default applies again (admins and org admins)", Tag: "Offline images", Auth: true},
+	"GET /api/admin/offline-image":          {Summary: "The organization's default offline image, for cameras without their own", Tag: "Offline images", Auth: true, ContentType: "image/jpeg"},
+	"PUT /api/admin/offline-image":          {Summary: "Upload the organization's default offline image (admin only)", Tag: "Offline images", Auth: true, Upload: "image", Data: anyObject},
+	"DELETE /api/admin/offline-image":       {Summary: "Remove the organization's default offline image (admin only)", Tag: "Offline images", Auth: true},
+
+	// Camera notes
+	"GET /api/cameras/:id/notes":                        {Summary: "Maintenance notes of a camera, such as ISP circuit IDs and pole numbers, newest first (admins and operators)", Tag: "Camera notes", Auth: true, Data: []models.CameraNote{}},
+	"POST /api/cameras/:id/notes":                       {Summary: "Add a note to a camera (admin only)", Tag: "Camera notes", Auth: true, Created: true, Body: handlers.CameraNoteRequest{}, Data: models.CameraNote{}},
+	"PUT /api/cameras/:id/notes/:noteId":                {Summary: "Change the text of a note (admin only)", Tag: "Camera notes", Auth: true, Body: handlers.CameraNoteRequest{}, Data: models.CameraNote{}},
+	"DELETE /api/cameras/:id/notes/:noteId":             {Summary: "Remove a note (admin only)", Tag: "Camera notes", Auth: true},
+	"GET /api/cameras/:id/attachments":                  {Summary: "Photos attached to a camera, newest first (admins and operators)", Tag: "Camera notes", Auth: true, Data: []models.CameraAttachment{}},
+	"POST /api/cameras/:id/attachments":                 {Summary: "Attach a JPEG or PNG of at most 768 KB to a camera, with an optional name form field; scaled to 1920px with its metadata stripped (admin only)", Tag: "Camera notes", Auth: true, Created: true, Upload: "file", Data: models.CameraAttachment{}},
+	"DELETE /api/cameras/:id/attachments/:attachmentId": {Summary: "Remove an attachment (admin only)", Tag: "Camera notes", Auth: true},
+	"GET /api/cameras/:id/tickets": {Summary: "Maintenance tickets of a camera, with their ID in the external system, newest first (admins and operators)", Tag: "Alerts", Auth: true, Data: []ticketing.Ticket{},
+		Query: ticketQueries},
+	"GET /api/cameras/:id/outages": {Summary: "When a camera was offline over a range, with each outage's duration and cause, its downtime and its uptime (admins and operators)", Tag: "Alerts", Auth: true, Data: handlers.OutageTimeline{},
+		Query: []openapi.Query{{Name: "range", Type: "string", Description: "24h, 7d, 30d (default) or 90d"}}},
+	"POST /api/uploads": {Summary: "Upload a JPEG or PNG of at most 768 KB, resized for its kind; sponsor_logo and branding need an admin", Tag: "Uploads", Auth: true, Upload: "file", Data: uploads.Upload{},
+		Query: []openapi.Query{
+			{Name: "kind", Type: "string", Description: "avatar, sponsor_logo or branding; may also be a form field"},
+		}},
+	"PUT /api/uploads/avatar":      {Summary: "Upload the signed-in user's avatar, cropped square and scaled to 256px", Tag: "Uploads", Auth: true, Upload: "file", Data: anyObject},
+	"DELETE /api/uploads/avatar":   {Summary: "Remove the signed-in user's avatar", Tag: "Uploads", Auth: true},
+	"GET /api/public/uploads/:key": {Summary: "An uploaded image; cached for good, since a key names its content", Tag: "Uploads", ContentType: "image/jpeg"},
+	"POST /api/admin/uploads/gc":   {Summary: "Remove the uploads nothing refers to now instead of at the next hourly run (admin only)", Tag: "Uploads", Auth: true, Data: anyObject},
+	"GET /api/s/:slug":             {Summary: "Open a share link: counts a view and redirects to the public player; 410 once expired or used up", Tag: "Share links"},
+	"GET /api/s/:slug/qr.png": {Summary: "A QR code of a share link", Tag: "Share links", ContentType: "image/png",
+		Query: []openapi.Query{
+			{Name: "size", Type: "integer", Description: "Width in pixels, 128 to 1024 (default 512)"},
+		}},
+
+	// Weather
+	"GET /api/weather": {Summary: "Current weather at the map center and each area, for the map overlay", Tag: "Weather", Data: weather.Report{}},
+
+	// Announcements
+	"GET /api/announcements/active": {Summary: "Announcements showing now, most severe first", Tag: "Announcements", Data: []models.Announcement{},
+		Query: []openapi.Query{
+			{Name: "area_id", Type: "integer", Description: "Only announcements for every area, this area or an area it is in"},
+		}},
+	"GET /api/admin/announcements": {Summary: "Announcements, latest start first", Tag: "Announcements", Auth: true, Paginated: true, Data: []models.Announcement{},
+		Query: []openapi.Query{
+			{Name: "state", Type: "string", Description: "scheduled, active or ended"},
+		}},
+	"GET /api/admin/announcements/:id":    {Summary: "Get an announcement", Tag: "Announcements", Auth: true, Data: models.Announcement{}},
+	"POST /api/admin/announcements":       {Summary: "Create an announcement (admins and org admins)", Tag: "Announcements", Auth: true, Created: true, Body: handlers.AnnouncementRequest{}, Data: createdID{}},
+	"PUT /api/admin/announcements/:id":    {Summary: "Replace an announcement (admins and org admins)", Tag: "Announcements", Auth: true, Body: handlers.AnnouncementRequest{}},
+	"DELETE /api/admin/announcements/:id": {Summary: "Delete an announcement (admins and org admins)", Tag: "Announcements", Auth: true},
+
+	// Edge nodes
+	"GET /api/admin/edge-nodes":             {Summary: "Edge nodes, by name, with their cameras, last heartbeat and open tunnels", Tag: "Edge nodes", Auth: true, Data: []models.EdgeNode{}},
+	"POST /api/admin/edge-nodes":            {Summary: "Add an edge node; the response holds the agent's token, shown only once (admin only)", Tag: "Edge nodes", Auth: true, Created: true, Body: handlers.EdgeNodeRequest{}, Data: kioskToken{}},
+	"PUT /api/admin/edge-nodes/:id/cameras": {Summary: "Replace the cameras an edge node relays (admin only)", Tag: "Edge nodes", Auth: true, Body: handlers.EdgeCamerasRequest{}},
+	"POST /api/admin/edge-nodes/:id/token":  {Summary: "Replace an edge node's token, disconnecting its agent (admin only)", Tag: "Edge nodes", Auth: true, Data: kioskToken{}},
+	"DELETE /api/admin/edge-nodes/:id":      {Summary: "Delete an edge node; its cameras play from the local go2rtc again (admin only)", Tag: "Edge nodes", Auth: true},
+	"GET /api/admin/alert-policies":         {Summary: "Camera health alert policies of the organization", Tag: "Alerts", Auth: true, Data: []alerting.Policy{}},
+	"POST /api/admin/alert-policies":        {Summary: "Add an alert policy for a camera, an area and its sub-areas, or the organization (admin only)", Tag: "Alerts", Auth: true, Created: true, Body: handlers.AlertPolicyRequest{}, Data: createdID{}},
+	"PUT /api/admin/alert-policies/:id":     {Summary: "Replace an alert policy (admin only)", Tag: "Alerts", Auth: true, Body: handlers.AlertPolicyRequest{}},
+	"DELETE /api/admin/alert-policies/:id":  {Summary: "Delete an alert policy; its cameras fall back to the next policy up (admin only)", Tag: "Alerts", Auth: true},
+	"GET /api/admin/camera-alerts":          {Summary: "Alert state of each camera: status, flapping and escalation steps sent", Tag: "Alerts", Auth: true, Data: []handlers.CameraAlert{}},
+	"GET /api/admin/stream-traffic": {Summary: "What the stream proxy served per camera, hour and kind, oldest first; lags by up to a minute", Tag: "Alerts", Auth: true, Data: []traffic.Hour{},
+		Query: []openapi.Query{
+			{Name: "camera_id", Type: "integer", Description: "Only this camera"},
+			{Name: "kind", Type: "string", Description: "hls, mse or audio; all when omitted"},
+			{Name: "from", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD; 24 hours before to by default"},
+			{Name: "to", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (whole day), exclusive; the end of the current hour by default"},
+		}},
+	"GET /api/admin/infra-alerts": {Summary: "Infrastructure alerts posted by Alertmanager, firing ones first (admin only)", Tag: "Alerts", Auth: true, Data: []infraalerts.Alert{},
+		Query: []openapi.Query{
+			{Name: "status", Type: "string", Description: "firing or resolved; both when omitted"},
+			{Name: "limit", Type: "integer", Description: "Alerts returned, 1 to 500 (default 100)"},
+		}},
+	"GET /api/admin/reports/daily": {Summary: "Days with a nightly summary report, newest first (admin only)", Tag: "Alerts", Auth: true, Data: []reports.Summary{},
+		Query: []openapi.Query{{Name: "limit", Type: "integer", Description: "Reports returned, 1 to 366 (default 30)"}}},
+	"GET /api/admin/reports/daily/:date":  {Summary: "Nightly summary report of a day, YYYY-MM-DD in REPORT_TIMEZONE: offline cameras, viewers, top cameras, new feedback and storage (admin only)", Tag: "Alerts", Auth: true, Data: reports.Report{}},
+	"POST /api/integrations/alertmanager": {Summary: "Alertmanager webhook receiver; authenticated with ALERTMANAGER_TOKEN as bearer", Tag: "Alerts", Body: infraalerts.Payload{}},
+	"GET /api/admin/camera-tickets": {Summary: "Maintenance tickets opened in the external system for cameras that stayed offline, newest first", Tag: "Alerts", Auth: true, Data: []ticketing.Ticket{},
+		Query: ticketQueries},
+	"GET /api/admin/notification-templates":                {Summary: "Alert types with their template variables, default wording and the organization's template", Tag: "Alerts", Auth: true, Data: []handlers.NotificationTemplate{}},
+	"PUT /api/admin/notification-templates/:type":          {Summary: "Set the wording of an alert type's notifications, with {{variable}} placeholders and optional text per channel (admin only)", Tag: "Alerts", Auth: true, Body: handlers.NotificationTemplateRequest{}},
+	"DELETE /api/admin/notification-templates/:type":       {Summary: "Go back to the default wording of an alert type (admin only)", Tag: "Alerts", Auth: true},
+	"POST /api/admin/notification-templates/:type/preview": {Summary: "Render a template, the one in the body or the saved one, with sample variables as it would be sent on a channel; nothing is sent", Tag: "Alerts", Auth: true, Body: handlers.NotificationPreviewRequest{}, Data: handlers.NotificationPreview{}},
+	"GET /api/admin/api-keys":                              {Summary: "API keys of the organization with their quotas and today's usage", Tag: "API keys", Auth: true, Data: []models.APIKey{}},
+	"GET /api/admin/api-keys/:id/usage": {Summary: "Daily usage of an API key, most recent first", Tag: "API keys", Auth: true, Data: []models.APIKeyUsage{},
+		Query: []openapi.Query{{Name: "days", Type: "integer", Description: "Days back, 1 to 90 (default 30)"}}},
+	"POST /api/admin/api-keys":              {Summary: "Add an API key for a third party; the key is only shown in this response (admin only)", Tag: "API keys", Auth: true, Created: true, Body: handlers.APIKeyRequest{}, Data: apiKeyCreated{}},
+	"PUT /api/admin/api-keys/:id":           {Summary: "Rename an API key or change its quotas (admin only)", Tag: "API keys", Auth: true, Body: handlers.APIKeyRequest{}},
+	"DELETE /api/admin/api-keys/:id":        {Summary: "Delete an API key (admin only)", Tag: "API keys", Auth: true},
+	"POST /api/admin/users/:id/impersonate": {Summary: "Issue a short-lived token to act as a non-admin user; every request made with it is audited (admin only)", Tag: "Users", Auth: true, Body: handlers.ImpersonateRequest{}, Data: handlers.ImpersonationToken{}},
+	"GET /api/edge/tunnel":                  {Summary: "Agent only, with its token as bearer: upgrades to " + edge.Protocol + " and holds the connection for stream requests", Tag: "Edge nodes"},
+	"POST /api/edge/heartbeat":              {Summary: "Agent only, with its token as bearer: report camera health, get the cameras to relay", Tag: "Edge nodes", Body: edge.Report{}, Data: edge.Assignment{}},
+
+	// Privacy
+	"GET /api/admin/log-retention": {Summary: "Retention of each log type with its rows, oldest row, rows due for pruning and archives (admin only)", Tag: "Admin", Auth: true, Data: []logretention.Status{}},
+	"PUT /api/admin/log-retention/:type": {Summary: "Set how long activity_logs or audit_logs are kept and whether pruned rows are archived (admin only)", Tag: "Admin", Auth: true,
+		Body: handlers.LogRetentionRequest{}, Data: logretention.Policy{}},
+	"POST /api/admin/log-retention/prune":  {Summary: "Prune the logs now instead of at the next hourly run (admin only)", Tag: "Admin", Auth: true, Data: []logretention.Policy{}},
+	"GET /api/admin/privacy/policy-status": {Summary: "Personal data stored per table, its age and retention, and rows the next cleanup will handle (admin only)", Tag: "Admin", Auth: true, Data: privacy.Status{}},
+
+	// Widgets
+	"GET /api/public/widgets/viewer-count": {Summary: "Current viewers and online status of a camera, for partner sites; any origin, cached for 30 seconds", Tag: "Widgets", Data: models.ViewerCount{},
+		Query: []openapi.Query{cameraQuery}},
+	"GET /api/public/widgets/viewer-count.svg": {Summary: "The same as an SVG badge", Tag: "Widgets", ContentType: "image/svg+xml",
+		Query: []openapi.Query{cameraQuery}},
+
+	// Status
+	"GET /api/status/public": {Summary: "Cameras online per area, offline cameras, published incidents and 90-day uptime; cached for a minute", Tag: "Status", Data: status.Report{}},
+	"GET /api/status/page":   {Summary: "The public status as an HTML page", Tag: "Status", ContentType: "text/html"},
+
+	// Streams
+	"GET /api/stream":                       {Summary: "List streams of enabled cameras", Tag: "Streams", Data: []map[string]interface{}{}},
+	"POST /api/stream/token":                {Summary: "An anonymous player token for the stream routes, also set as the player_token cookie; send the current one in X-Player-Token to refresh it under the same viewer ID. Required by every other stream route when STREAM_TOKEN_REQUIRED is on", Tag: "Streams", Data: handlers.PlayerToken{}},
+	"POST /api/stream/multiview":            {Summary: "Signed stream URLs for up to STREAM_MULTIVIEW_MAX cameras in one call; unknown or disabled cameras get an error entry", Tag: "Streams", Body: handlers.MultiviewRequest{}, Data: []models.MultiviewStream{}},
+	"GET /api/stream/:streamKey":            {Summary: "Playback URLs for a stream, signed when STREAM_SIGNED_URLS_REQUIRED is on", Tag: "Streams", Data: streamURL{}},
+	"GET /api/stream/hls/:streamKey/*":      {Summary: "Proxy HLS playlists and segments", Tag: "Streams", ContentType: "application/vnd.apple.mpegurl"},
+	"GET /api/stream/mse/:streamKey":        {Summary: "Proxy the fragmented MP4 stream", Tag: "Streams", ContentType: "video/mp4"},
+	"GET /api/stream/audio/:streamKey":      {Summary: "Proxy the stream's sound alone, transcoded to AAC, for slow connections", Tag: "Streams", ContentType: "audio/aac"},
+	"GET /api/stream/:streamKey/stats":      {Summary: "Viewer count for a stream", Tag: "Streams", Data: anyObject},
+	"GET /api/stream/:streamKey/snapshot":   {Summary: "The current frame of a stream, or the camera's offline image while it is offline (X-Camera-Status: offline)", Tag: "Streams", ContentType: "image/jpeg"},
+	"POST /api/stream/:streamKey/start":     {Summary: "Record that a viewer started watching, optionally with the embedding page, transport and a player-generated viewer_id that carries a session across transport fallbacks; returns the viewer's session token, also set as the viewer_session cookie, or keeps the one sent in X-Session-ID; counts update within VIEWER_FLUSH_SECONDS", Tag: "Streams", Body: handlers.ViewingRequest{}, Raw: viewingSession{}},
+	"POST /api/stream/:streamKey/heartbeat": {Summary: "Record that a viewer is still watching; send every few seconds while playing, with the session token in X-Session-ID or the cookie", Tag: "Streams"},
+	"POST /api/stream/:streamKey/stop":      {Summary: "Record that a viewer stopped watching, with the session token in X-Session-ID or the cookie", Tag: "Streams"},
+
+	// Admin
+	"GET /api/admin/dashboard":        {Summary: "Dashboard statistics over the cameras, users and areas of the caller's organization, and the viewers and recordings of its cameras; the log volume for admins only", Tag: "Admin", Auth: true, Data: anyObject},
+	"GET /api/admin/stats":            {Summary: "Dashboard statistics (alias)", Tag: "Admin", Auth: true, Data: anyObject},
+	"GET /api/admin/stats/system":     {Summary: "Dashboard figures of every organization together, cached for a minute (admin only)", Tag: "Admin", Auth: true, Data: handlers.SystemStats{}},
+	"GET /api/admin/stats/today":      {Summary: "Today's viewer statistics", Tag: "Admin", Auth: true, Data: anyObject},
+	"GET /api/admin/system":           {Summary: "Host and runtime information", Tag: "Admin", Auth: true, Data: anyObject},
+	"GET /api/admin/system/resources": {Summary: "CPU, memory, disk and network usage of the instance serving the request, sampled every SYSTEM_MONITOR_SECONDS, with recent samples for sparklines (admin only)", Tag: "Admin", Auth: true, Data: systemResources{}},
+	"GET /api/admin/activity":         {Summary: "Recent activity log of every organization, including published events (admin only)", Tag: "Admin", Auth: true, Paginated: true, Cursor: true, Data: []activity{}},
+	"GET /api/admin/camera-health":    {Summary: "Last health check per camera", Tag: "Admin", Auth: true, Data: []cameraHealth{}},
+	"POST /api/admin/camera-health/check": {Summary: "Probe cameras now, all or those listed, as a job (admin only)", Tag: "Admin", Auth: true, Created: true,
+		Body: handlers.HealthCheckRequest{}, Data: queuedHealthCheck{}},
+	"GET /api/admin/camera-health/checks/:id": {Summary: "A queued health check, with each camera's health once done", Tag: "Admin", Auth: true, Data: watchdog.HealthCheck{}},
+	"GET /api/admin/sessions": {Summary: "Viewer sessions of the organization's cameras, newest first", Tag: "Admin", Auth: true, Paginated: true, Cursor: true, Data: []models.ViewerSession{},
+		Query: []openapi.Query{
+			{Name: "camera_id", Type: "integer"},
+			{Name: "user_id", Type: "integer", Description: "Only sessions watched by this logged-in user"},
+			{Name: "active", Type: "boolean", Description: "Only sessions still watching"},
+		}},
+	"GET /api/admin/sessions/export": {Summary: "Viewer sessions of the organization's cameras as CSV, oldest first, with their duration in seconds (admins and org admins)", Tag: "Admin", Auth: true, ContentType: "text/csv",
+		Query: []openapi.Query{
+			{Name: "from", Type: "string", Description: "Started at or after; RFC 3339 time or YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "Started before; RFC 3339 time or YYYY-MM-DD (inclusive)"},
+			{Name: "camera_id", Type: "integer"},
+			{Name: "user_id", Type: "integer", Description: "Only sessions watched by this logged-in user"},
+		}},
+	"GET /api/admin/export": {Summary: "The organization's areas, cameras, settings and playlists as one JSON file for POST /api/admin/import; holds RTSP credentials (admin only)", Tag: "Admin", Auth: true,
+		ContentType: "application/json", Raw: handlers.ConfigBundle{},
+		Query: []openapi.Query{
+			{Name: "users", Type: "boolean", Description: "Include the users, without password hashes"},
+			{Name: "password_hashes", Type: "boolean", Description: "Include password hashes too; needs users=true"},
+		}},
+	"POST /api/admin/import": {Summary: "Import a bundle from GET /api/admin/export in one transaction; areas match by name, cameras by stream key, playlists by name and users by username (admin only)", Tag: "Admin", Auth: true,
+		Body: handlers.ConfigBundle{}, Data: handlers.ImportResult{},
+		Query: []openapi.Query{
+			{Name: "on_conflict", Type: "string", Description: "skip (default) keeps existing records, overwrite replaces them, fail imports nothing when anything clashes (409)"},
+			{Name: "dry_run", Type: "boolean", Description: "Report what would be imported without writing"},
+		}},
+	"POST /api/admin/cameras/sync-from-streamer": {Summary: "Create a camera for each stream of a go2rtc or MediaMTX config file or API (the local go2rtc by default) that is not one yet; clashes are listed as conflicts (admin only)", Tag: "Admin", Auth: true,
+		Body: handlers.StreamerSyncRequest{}, Data: streamsync.Result{},
+		Query: []openapi.Query{{Name: "dry_run", Type: "boolean", Description: "Report what would be created without writing"}}},
+	"POST /api/admin/cleanup-sessions": {Summary: "Delete old viewer sessions of the organization's cameras (admins and org admins)", Tag: "Admin", Auth: true,
+		Query: []openapi.Query{{Name: "days", Type: "integer", Description: "Keep sessions newer than this (default 7)"}},
+		Data: struct {
+			Deleted int64 `json:"deleted"`
+		}{}},
+	"POST /api/admin/config/reload": {Summary: "Reload log level, CORS origins, rate limits and stream URLs (admin only)", Tag: "Admin", Auth: true, Data: map[string][]string{}},
+	"GET /api/admin/database-stats": {Summary: "Row counts per table, and under storage the database, WAL and free sizes, auto-vacuum mode and last checkpoint", Tag: "Admin", Auth: true, Data: map[string]interface{}{}},
+	"GET /api/admin/access-logs": {Summary: "Recorded requests of the whole instance, newest first (ACCESS_LOG_SINK=database; admin only)", Tag: "Admin", Auth: true, Paginated: true, Cursor: true, Data: []accesslog.Entry{},
+		Query: []openapi.Query{
+			{Name: "method", Type: "string"},
+			{Name: "path", Type: "string", Description: "Path prefix"},
+			{Name: "status", Type: "string", Description: "A code such as 404 or a class such as 5xx"},
+			{Name: "user_id", Type: "integer"},
+			{Name: "ip", Type: "string"},
+			{Name: "from", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (inclusive)"},
+		}},
+	"GET /api/admin/jobs/queue":         {Summary: "Background job workers, counts by status and queued jobs", Tag: "Admin", Auth: true, Data: jobs.Snapshot{}},
+	"GET /api/admin/maintenance":        {Summary: "Whether the maintenance mode is on, with its message and ETA", Tag: "Admin", Auth: true, Data: maintenance.State{}},
+	"POST /api/admin/maintenance":       {Summary: "Turn the maintenance mode on, update it or end it; public endpoints answer 503 meanwhile (admin only)", Tag: "Admin", Auth: true, Body: handlers.MaintenanceRequest{}, Data: maintenance.State{}},
+	"GET /api/admin/ip-bans":            {Summary: "Client IPs banned from the streams for abusing them, with why and until when, newest first (admin only)", Tag: "Admin", Auth: true, Data: []abuse.Ban{}},
+	"DELETE /api/admin/ip-bans/:id":     {Summary: "Lift a ban before it expires (admin only)", Tag: "Admin", Auth: true},
+	"GET /api/admin/analytics/viewers":  {Summary: "Viewer analytics (placeholder)", Tag: "Admin", Auth: true, Data: anyObject},
+	"GET /api/admin/analytics/realtime": {Summary: "Realtime analytics (placeholder)", Tag: "Admin", Auth: true, Data: anyObject},
+	"GET /api/admin/analytics/sources": {Summary: "Viewer sessions by referring site, player transport and staff or public", Tag: "Admin", Auth: true, Data: handlers.ViewerSources{},
+		Query: []openapi.Query{{Name: "days", Type: "integer", Description: "Days back, 1 to 90 (default 7)"}, {Name: "camera_id", Type: "integer", Description: "Only this camera"}}},
+	"GET /api/admin/analytics/heatmap": {Summary: "Viewers by weekday and hour, overall and per camera, with the quietest hours for maintenance windows", Tag: "Admin", Auth: true, Data: handlers.ViewerHeatmap{},
+		Query: []openapi.Query{
+			{Name: "days", Type: "integer", Description: "Whole days back, today included, 1 to 90 (default 28)"},
+			{Name: "tz", Type: "string", Description: "IANA time zone of the hours (default Asia/Jakarta)"},
+			{Name: "camera_id", Type: "integer", Description: "Only this camera"},
+		}},
+	"GET /api/admin/telegram/status": {Summary: "Telegram bot status (placeholder)", Tag: "Admin", Auth: true, Data: anyObject},
+	"PUT /api/admin/telegram/config": {Summary: "Update Telegram config (placeholder)", Tag: "Admin", Auth: true, Body: anyObject},
+	"POST /api/admin/telegram/test":  {Summary: "Send a Telegram test message (placeholder)", Tag: "Admin", Auth: true},
+
+	// Feedback
+	"POST /api/feedback": {Summary: "Submit feedback", Tag: "Feedback", Created: true, Body: struct {
+		Name    string `json:"name"`
+		Email   string `json:"email"`
+		Message string `json:"message"`
+	}{}, Data: createdID{}},
+	"GET /api/feedback": {Summary: "List feedback", Tag: "Feedback", Auth: true, Paginated: true, Data: []feedback{},
+		Query: []openapi.Query{
+			{Name: "status", Type: "string", Description: "unread, read or resolved"},
+			{Name: "moderation", Type: "string", Description: "none, pending, approved or rejected; pending is the moderation queue"},
+		}},
+	"GET /api/feedback/public": {Summary: "Approved feedback as testimonials for a \"what residents say\" section, most recently approved first", Tag: "Feedback", Data: []handlers.Testimonial{},
+		Query: []openapi.Query{
+			{Name: "anonymize", Type: "boolean", Description: "Show every name as a first name and initial"},
+			{Name: "limit", Type: "integer", Description: "Testimonials returned, 1 to 50 (default 10)"},
+		}},
+	"PATCH /api/feedback/:id/moderation": {Summary: "Queue feedback for review, approve it as a public testimonial with sanitized text, or reject it (admin only)", Tag: "Feedback", Auth: true, Body: handlers.FeedbackModerationRequest{}, Data: handlers.FeedbackModeration{}},
+	"GET /api/feedback/stats":            {Summary: "Feedback totals and counts by status", Tag: "Feedback", Auth: true, Data: anyObject},
+	"GET /api/feedback/:id":              {Summary: "Get feedback", Tag: "Feedback", Auth: true, Data: feedback{}},
+	"PATCH /api/feedback/:id/status": {Summary: "Change feedback status (admins and org admins)", Tag: "Feedback", Auth: true, Body: struct {
+		Status string `json:"status"`
+	}{}},
+	"DELETE /api/feedback/:id": {Summary: "Delete feedback (admins and org admins)", Tag: "Feedback", Auth: true},
+
+	// Recordings
+	"GET /api/recording-downloads/:id": {Summary: "A recording's file by the signed link of a recording webhook; needs no account", Tag: "Recordings", ContentType: "video/mp2t",
+		Query: []openapi.Query{
+			{Name: "expires", Type: "integer", Description: "Unix time the link expires"},
+			{Name: "sig", Type: "string", Description: "Signature of the link"},
+		}},
+	"GET /api/recordings/overview": {Summary: "Footage and recorder state of each camera, with the days the recordings disk lasts at the current write rate", Tag: "Recordings", Auth: true, Data: handlers.RecordingsOverview{}},
+	"GET /api/recordings": {Summary: "Recorded files, newest first", Tag: "Recordings", Auth: true, Paginated: true, Cursor: true, Data: []models.Recording{},
+		Query: []openapi.Query{{Name: "camera_id", Type: "integer"}, fieldsQuery}},
+	"GET /api/recordings/restarts":           {Summary: "Recorder restart log", Tag: "Recordings", Auth: true, Paginated: true, Cursor: true, Data: []interface{}{}},
+	"GET /api/recordings/:cameraId/restarts": {Summary: "Recorder restart log for a camera", Tag: "Recordings", Auth: true, Paginated: true, Cursor: true, Data: []interface{}{}},
+	"GET /api/recordings/:cameraId/playlist.m3u8": {Summary: "HLS master playlist over the camera's MPEG-TS recordings in a time range, with keyframe-only variants for fast forward", Tag: "Recordings", Auth: true, ContentType: "application/vnd.apple.mpegurl",
+		Query: playbackQuery},
+	"GET /api/recordings/:cameraId/vod.m3u8": {Summary: "HLS VOD playlist of the recordings in a time range, one segment per recording", Tag: "Recordings", Auth: true, ContentType: "application/vnd.apple.mpegurl",
+		Query: playbackQuery},
+	"GET /api/recordings/:cameraId/iframes.m3u8": {Summary: "Keyframe-only HLS playlist of the recordings in a time range", Tag: "Recordings", Auth: true, ContentType: "application/vnd.apple.mpegurl",
+		Query: append([]openapi.Query{{Name: "speed", Type: "integer", Description: "1, 2 or 4: keep every keyframe, every second or every fourth"}}, playbackQuery...)},
+	"GET /api/recordings/:cameraId/segments/:id": {Summary: "A recording file; supports range requests", Tag: "Recordings", Auth: true, ContentType: "video/mp2t"},
+	"GET /api/recordings/:cameraId/frame": {Summary: "The frame recorded at a time, as a JPEG", Tag: "Recordings", Auth: true, ContentType: "image/jpeg",
+		Query: []openapi.Query{{Name: "at", Type: "string", Description: "RFC 3339 time, fractional seconds allowed"}}},
+
+	// Object detection
+	"GET /api/detections": {Summary: "Objects found by the detection service, newest first", Tag: "Detections", Auth: true, Paginated: true, Cursor: true, Data: []detection.Detection{},
+		Query: []openapi.Query{
+			{Name: "label", Type: "string", Description: "Object class, e.g. person or car"},
+			{Name: "camera_id", Type: "integer"},
+			{Name: "min_confidence", Type: "number", Description: "0 to 1"},
+			{Name: "from", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (inclusive)"},
+		}},
+	"GET /api/detections/rules":        {Summary: "Detection alert rules", Tag: "Detections", Auth: true, Data: []detection.Rule{}},
+	"POST /api/detections/rules":       {Summary: "Create a detection alert rule (admins and org admins)", Tag: "Detections", Auth: true, Created: true, Body: handlers.DetectionRuleRequest{}, Data: createdID{}},
+	"PUT /api/detections/rules/:id":    {Summary: "Replace a detection alert rule (admins and org admins)", Tag: "Detections", Auth: true, Body: handlers.DetectionRuleRequest{}},
+	"DELETE /api/detections/rules/:id": {Summary: "Delete a detection alert rule (admins and org admins)", Tag: "Detections", Auth: true},
+
+	// Licence plate recognition
+	"POST /api/anpr/events": {Summary: "Store a plate read from an ANPR device; authenticated with X-API-Key (ANPR_INGEST_KEY)", Tag: "ANPR", Created: true, Body: handlers.ANPREventRequest{}, Data: anpr.Event{}},
+	"GET /api/anpr/events": {Summary: "Search plate reads, newest first; needs the anpr permission", Tag: "ANPR", Auth: true, Paginated: true, Cursor: true, Data: []anpr.Event{},
+		Query: []openapi.Query{
+			{Name: "plate", Type: "string", Description: "Whole or partial plate; case, spaces and dashes are ignored"},
+			{Name: "camera_id", Type: "integer"},
+			{Name: "min_confidence", Type: "number", Description: "0 to 1"},
+			{Name: "from", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (inclusive)"},
+		}},
+
+	// Sponsors (placeholders)
+	"GET /api/sponsors":        {Summary: "List sponsors", Tag: "Sponsors", Auth: true, Data: []interface{}{}},
+	"GET /api/sponsors/stats":  {Summary: "Sponsor counts", Tag: "Sponsors", Auth: true, Data: anyObject},
+	"POST /api/sponsors":       {Summary: "Create a sponsor", Tag: "Sponsors", Auth: true, Body: anyObject},
+	"PUT /api/sponsors/:id":    {Summary: "Update a sponsor", Tag: "Sponsors", Auth: true, Body: anyObject},
+	"DELETE /api/sponsors/:id": {Summary: "Delete a sponsor", Tag: "Sponsors", Auth: true},
+}
+
+// fieldsQuery documents sparse fieldsets on list endpoints
+var fieldsQuery = openapi.Query{Name: "fields", Type: "string", Description: "Comma separated fields to return, e.g. id,name,latitude,longitude,stream_key"}
+
+// ticketQueries filter maintenance tickets
+var ticketQueries = []openapi.Query{
+	{Name: "status", Type: "string", Description: "pending, open or closed"},
+	{Name: "limit", Type: "integer", Description: "Tickets returned, 1 to 500 (default 50)"},
+}
+
+// playbackQuery is the time range of recording playlists
+var playbackQuery = []openapi.Query{
+	{Name: "from", Type: "string", Description: "Start of the range, RFC 3339 (required)"},
+	{Name: "to", Type: "string", Description: "End of the range, RFC 3339, at most a day after from (required)"},
+}
+
+// cameraQuery picks the camera a widget shows
+var cameraQuery = openapi.Query{Name: "camera", Type: "integer", Description: "Camera ID (required)"}
+
+// Response shapes the handlers build as maps
+
+var anyObject = map[string]interface{}{}
+
+type createdID struct {
+	ID int `json:"id"`
+}
+
+// kioskToken is a playlist's kiosk token; the id is only on create
+type kioskToken struct {
+	ID    int    `json:"id,omitempty"`
+	Token string `json:"token"`
+}
+
+// apiKeyCreated is a new API key
+type apiKeyCreated struct {
+	ID  int    `json:"id"`
+	Key string `json:"key"`
+}
+
+type userReference struct {
+	ID             int    `json:"id"`
+	Username       string `json:"username"`
+	Role           string `json:"role"`
+	OrganizationID int    `json:"organization_id"`
+}
+
+type setting struct {
+	Value       interface{} `json:"value"`
+	Category    string      `json:"category,omitempty"`
+	Description string      `json:"description"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+type settingRequest struct {
+	Value       interface{} `json:"value"`
+	Category    string      `json:"category"`
+	Description string      `json:"description"`
+}
+
+type bulkSettingsRequest struct {
+	Settings []settingEntry `json:"settings"`
+}
+
+type settingEntry struct {
+	Key         string      `json:"key"`
+	Value       interface{} `json:"value"`
+	Category    string      `json:"category"`
+	Description string      `json:"description"`
+}
+
+type streamURL struct {
+	CameraID  int        `json:"camera_id"`
+	Name      string     `json:"name"`
+	StreamKey string     `json:"stream_key"`
+	HLSURL    string     `json:"hls_url"`
+	WebRTCURL string     `json:"webrtc_url"`
+	ExpiresAt *time.Time `json:"expires_at"` // of the signed URLs; null when unsigned
+}
+
+type viewingSession struct {
+	Success   bool   `json:"success"`
+	SessionID string `json:"session_id"`
+}
+
+type activity struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user_id"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Details   string    `json:"details"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type cameraHealth struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	Status    string    `json:"status"`
+	LastCheck time.Time `json:"last_check"`
+}
+
+type queuedHealthCheck struct {
+	Check      watchdog.HealthCheck `json:"check"`
+	ResultsURL string               `json:"results_url"`
+}
+
+type systemResources struct {
+	Instance        string          `json:"instance"`
+	IntervalSeconds float64         `json:"interval_seconds"`
+	Current         sysmon.Sample   `json:"current"`
+	History         []sysmon.Sample `json:"history"`
+}
+
+type feedback struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	Message       string    `json:"message"`
+	Status        string    `json:"status"`
+	Moderation    string    `json:"moderation"`
+	PublicMessage string    `json:"public_message"`
+	Anonymize     bool      `json:"anonymize"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// routeKey is the apiDocs key for a registered route
+func routeKey(method, path string) string {
+	if len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+	}
+	return method + " " + path
+}
+
+// documentedRoutes lists the app's routes, skipping the HEAD twins Fiber
+// registers for every GET
+func documentedRoutes(app *fiber.App) []fiber.Route {
+	var routes []fiber.Route
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routeKey(routes[i].Method, routes[i].Path) < routeKey(routes[j].Method, routes[j].Path)
+	})
+	return routes
+}
+
+// buildSpec documents the routes registered on app
+func buildSpec(app *fiber.App) *openapi.Document {
+	b := openapi.New(openapi.Info{
+		Title:       "CCTV API",
+		Version:     "1.0.0",
+		Description: "Camera, area and stream management for the RT/RW CCTV network.",
+	})
+
+	for _, route := range documentedRoutes(app) {
+		doc, ok := apiDocs[routeKey(route.Method, route.Path)]
+		if !ok {
+			doc = openapi.Route{Summary: "Undocumented"}
+		}
+		b.Add(route.Method, route.Path, doc)
+	}
+
+	return b.Document()
+}
+
+// serveSpec returns the document, built on first request so it covers
+// every route registered by then
+func serveSpec(app *fiber.App) fiber.Handler {
+	var once sync.Once
+	var spec *openapi.Document
+
+	return func(c *fiber.Ctx) error {
+		once.Do(func() {
+			spec = buildSpec(app)
+		})
+		return c.JSON(spec)
+	}
+}
+
+// swaggerUI loads Swagger UI from a CDN and points it at the spec
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>CCTV API</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+	<script>
+		window.ui = SwaggerUIBundle({ url: '/api/openapi.json', dom_id: '#swagger-ui' })
+	</script>
+</body>
+</html>`
+
+// swaggerUICSP relaxes the global policy for the CDN assets and the
+// inline bootstrap script
+const swaggerUICSP = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://unpkg.com; " +
+	"style-src 'self' 'unsafe-inline' https://unpkg.com; " +
+	"img-src 'self' data: https:; " +
+	"frame-ancestors 'self'"
+
+func serveSwaggerUI(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentSecurityPolicy, swaggerUICSP)
+	c.Response().Header.Del(fiber.HeaderContentSecurityPolicyReportOnly)
+	c.Type("html")
+	return c.SendString(swaggerUI)
+}
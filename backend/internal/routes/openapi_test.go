@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/shutdown"
+	"github.com/abcdefak87/cctv/pkg/openapi"
+
+	"github.com/gofiber/fiber/v2"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupApp(t *testing.T, env string) *fiber.App {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	app := fiber.New()
+	Setup(app, db, &config.Config{Server: config.ServerConfig{Env: env}}, shutdown.New(time.Second))
+	return app
+}
+
+func TestAPIDocsCoverRoutes(t *testing.T) {
+	app := setupApp(t, "development")
+
+	registered := map[string]bool{}
+	for _, route := range documentedRoutes(app) {
+		key := routeKey(route.Method, route.Path)
+		registered[key] = true
+		if _, ok := apiDocs[key]; !ok {
+			t.Errorf("Route %s has no apiDocs entry", key)
+		}
+	}
+
+	for key := range apiDocs {
+		if !registered[key] {
+			t.Errorf("apiDocs entry %s has no route", key)
+		}
+	}
+}
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	app := setupApp(t, "production")
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var doc openapi.Document
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("Expected JSON document, got %v", err)
+	}
+
+	if doc.OpenAPI != openapi.Version {
+		t.Errorf("Expected openapi %s, got %s", openapi.Version, doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/api/cameras/{id}"]["put"]; !ok {
+		t.Error("Expected PUT /api/cameras/{id} to be documented")
+	}
+	if _, ok := doc.Paths["/api/docs"]; ok {
+		t.Error("Expected Swagger UI to be disabled in production")
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/api/docs", nil))
+	if resp.StatusCode != 404 {
+		t.Errorf("Expected /api/docs to 404 in production, got %d", resp.StatusCode)
+	}
+}
@@ -1,38 +1,421 @@
 package routes
 
 import (
+	"context"
 	"database/sql"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/abcdefak87/cctv/internal/abuse"
+	"github.com/abcdefak87/cctv/internal/alerting"
+	"github.com/abcdefak87/cctv/internal/apikeys"
+	"github.com/abcdefak87/cctv/internal/anpr"
+	"github.com/abcdefak87/cctv/internal/cache"
+	"github.com/abcdefak87/cctv/internal/cluster"
 	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database"
+	"github.com/abcdefak87/cctv/internal/detection"
+	"github.com/abcdefak87/cctv/internal/edge"
+	"github.com/abcdefak87/cctv/internal/events"
 	"github.com/abcdefak87/cctv/internal/handlers"
+	"github.com/abcdefak87/cctv/internal/incidents"
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/internal/logretention"
+	"github.com/abcdefak87/cctv/internal/maintenance"
 	"github.com/abcdefak87/cctv/internal/middleware"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/motion"
+	"github.com/abcdefak87/cctv/internal/privacy"
+	"github.com/abcdefak87/cctv/internal/recordings"
+	"github.com/abcdefak87/cctv/internal/reports"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"github.com/abcdefak87/cctv/internal/service"
+	"github.com/abcdefak87/cctv/internal/startlatency"
+	"github.com/abcdefak87/cctv/internal/shutdown"
+	"github.com/abcdefak87/cctv/internal/status"
+	"github.com/abcdefak87/cctv/internal/streamnode"
+	"github.com/abcdefak87/cctv/internal/sysmon"
+	"github.com/abcdefak87/cctv/internal/ticketing"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/internal/traffic"
+	"github.com/abcdefak87/cctv/internal/uploads"
+	"github.com/abcdefak87/cctv/internal/viewers"
+	"github.com/abcdefak87/cctv/internal/watchdog"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func Setup(app *fiber.App, db *sql.DB, cfg *config.Config) {
+// publicMaxAge is how long browsers may reuse public JSON (cameras,
+// areas, branding) before revalidating
+const publicMaxAge = 30 * time.Second
+
+func Setup(app *fiber.App, db *sql.DB, cfg *config.Config, lifecycle *shutdown.Coordinator) {
+	// Initialize repositories and services
+	cameraRepo := repository.NewCameraRepository(db)
+	areaRepo := repository.NewAreaRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	cameraService := service.NewCameraService(cameraRepo, areaRepo)
+	userService := service.NewUserService(userRepo)
+
+	// With CLUSTER_MODE several instances share the database; the
+	// periodic workers below run on whichever holds the lease
+	node := cluster.New(db, cfg.Cluster)
+	node.Join(lifecycle.Context())
+	lifecycle.Go("cluster", node.Run)
+
+	// Background jobs run until shutdown; subsystems register their job
+	// types on the queue before it starts. Every instance works the
+	// queue; the leader hands back jobs of instances that died.
+	jobOpts := jobs.Options{Workers: cfg.Jobs.Workers}
+	if node.Clustered() {
+		jobOpts.Instance = node.ID()
+	}
+	queue := jobs.New(db, jobOpts)
+	node.Sweep("jobs", queue.RequeueAbandoned)
+
+	// Object detection analyses a frame whenever motion is detected
+	if cfg.Detection.URL != "" {
+		analyzer := detection.NewAnalyzer(db, detection.Options{
+			Backend:       &detection.HTTPBackend{URL: cfg.Detection.URL, APIKey: cfg.Detection.APIKey},
+			SendImage:     cfg.Detection.Mode == "image",
+			MinConfidence: cfg.Detection.MinConfidence,
+			Timeout:       cfg.Detection.Timeout,
+			Upstream:      func(node string) (streamnode.Upstream, error) { return streamnode.Lookup(cfg.Stream(), node) },
+		})
+		queue.Register(detection.JobType, analyzer.Handle)
+		events.Subscribe(events.MotionDetected, "object detection", analyzer.OnMotion(queue))
+	}
+
+	// Finished recordings and event clips are posted to a video
+	// management system, with a signed link to download them
+	if cfg.Webhooks.URL != "" {
+		notifier := recordings.New(db, queue, recordings.Options{
+			URL:        cfg.Webhooks.URL,
+			Secret:     cfg.Webhooks.Secret,
+			BaseURL:    cfg.Webhooks.BaseURL,
+			LinkSecret: cfg.JWT.Secret,
+			LinkTTL:    cfg.Webhooks.LinkTTL,
+		})
+		queue.Register(recordings.JobType, notifier.Deliver)
+		lifecycle.Go("recording webhooks", node.Lead(notifier.Run))
+	}
+	// Admins can probe cameras at once, through a job on any instance,
+	// even when scheduled checks are off
+	wd := watchdog.New(db, watchdog.Options{
+		Interval:    cfg.Health.Interval,
+		Timeout:     cfg.Health.Timeout,
+		Concurrency: cfg.Health.Concurrency,
+	})
+	queue.Register(watchdog.JobType, wd.RunCheck)
+	lifecycle.Go("jobs", queue.Run)
+
+	// Alerts on a camera join the timeline of its unresolved incidents
+	events.Subscribe(events.DetectionAlert, "incidents", incidents.OnAlert(db))
+
+	// Motion detection polls go2rtc snapshots, so it is opt-in
+	if cfg.Motion.Enabled {
+		detector := motion.New(db, motion.Options{
+			Interval:    cfg.Motion.Interval,
+			Concurrency: cfg.Motion.Concurrency,
+			Snapshot: motion.Go2RTC(func(ctx context.Context, streamKey string) (streamnode.Upstream, error) {
+				return streamnode.ForStream(ctx, db, cfg.Stream(), streamKey)
+			}),
+		})
+		lifecycle.Go("motion", node.Lead(detector.Run))
+	}
+
+	// The watchdog probes the cameras edge agents do not check
+	if cfg.Health.Enabled {
+		lifecycle.Go("camera health", node.Lead(wd.Run))
+	}
+
+	// Plate reads are personal data; keep them no longer than configured
+	if cfg.ANPR.RetentionDays > 0 {
+		lifecycle.Go("anpr retention", node.Lead(anpr.Retention(db, time.Duration(cfg.ANPR.RetentionDays)*24*time.Hour)))
+	}
+
+	// Viewer sessions, feedback emails and IP addresses are personal
+	// data too; see internal/privacy
+	if policy := privacy.FromConfig(cfg); policy.Enabled() {
+		lifecycle.Go("privacy cleanup", node.Lead(privacy.Cleanup(db, policy)))
+	}
+
+	// Audit and activity logs are pruned as admins set under
+	// /api/admin/log-retention; see internal/logretention
+	logRetention := logretention.New(db, cfg.Database.LogArchivePath)
+	lifecycle.Go("log retention", node.Lead(logRetention.Run))
+
+	// Uploaded images nothing refers to any more are removed; see
+	// internal/uploads
+	uploadStore := uploads.FromConfig(db, cfg)
+	lifecycle.Go("upload gc", node.Lead(uploadStore.Run))
+
+	// Uptime on the public status page comes from these samples
+	lifecycle.Go("status sampler", node.Lead(status.Sampler(db)))
+
+	// Operators are told of cameras going offline on the channels that
+	// are configured, escalating the longer an outage lasts
+	alerter := alerting.New(db, alerting.Channels(cfg.Alerting), cfg.Alerting.Interval)
+	lifecycle.Go("camera alerts", node.Lead(alerter.Run))
+
+	// Cameras offline past TICKET_AFTER_MINUTES get a maintenance ticket
+	// in the configured system, closed when they are back
+	if tracker := ticketing.FromConfig(cfg); tracker != nil {
+		tickets := ticketing.New(db, tracker, cfg.Tickets.Provider, cfg.Tickets.After)
+		lifecycle.Go("camera tickets", node.Lead(tickets.Run))
+	}
+
+	// Operators are told of cameras whose streams start slowly. Each
+	// instance times the streams it proxies, so each one watches its own.
+	if cfg.Health.StartAlert > 0 {
+		starts := startlatency.NewWatcher(db, startlatency.Shared(), startlatency.WatchOptions{
+			Threshold:  cfg.Health.StartAlert,
+			MinSamples: cfg.Health.StartMinSamples,
+		})
+		lifecycle.Go("stream start alerts", starts.Run)
+		events.Subscribe(events.StreamStartSlow, "stream start alerts", alerter.OnStreamStartSlow)
+	}
+
+	// What each instance's stream proxy serves is added up per camera
+	// and hour; the leader alerts on traffic far from the usual
+	lifecycle.Go("stream traffic", traffic.Writer(db, traffic.Shared()))
+	if h := cfg.Health; h.TrafficSpikeFactor > 0 || h.TrafficDropAlert {
+		events.Subscribe("stream.traffic_*", "stream traffic alerts", alerter.OnStreamTraffic)
+	}
+	lifecycle.Go("stream traffic alerts", node.Lead(traffic.NewWatcher(db, traffic.WatchOptions{
+		SpikeFactor:  cfg.Health.TrafficSpikeFactor,
+		Drops:        cfg.Health.TrafficDropAlert,
+		MinBytes:     int64(cfg.Health.TrafficMinMB) << 20,
+		BaselineDays: cfg.Health.TrafficBaselineDays,
+	}).Run))
+
+	// Client IPs that hammer or scrape the streams are banned for a
+	// while, on every instance, and operators are told
+	abuseGuard := abuse.New(db, func() abuse.Limits {
+		s := cfg.Stream()
+		return abuse.Limits{Window: s.AbuseWindow, Playlists: s.AbusePlaylists, Cameras: s.AbuseCameras, Ban: s.AbuseBan}
+	})
+	events.Subscribe(events.StreamIPBanned, "ban alerts", alerter.OnBan)
+
+	// The SQLite WAL is checkpointed and truncated on a schedule, and
+	// operators are told when it or the database file grows too large
+	lifecycle.Go("database housekeeping", database.Housekeeping(db, database.HousekeepingOptions{
+		Path:     cfg.Database.Path,
+		Interval: cfg.Database.CheckpointInterval,
+		WALAlert: int64(cfg.Database.WALAlertMB) << 20,
+		DBAlert:  int64(cfg.Database.SizeAlertMB) << 20,
+		Grew: func(file string, size, limit int64) {
+			events.Publish(events.Event{Type: events.DatabaseGrown, Time: time.Now().UTC(), Resource: "database",
+				Data: map[string]interface{}{"file": file, "bytes": size, "limit": limit}})
+		},
+	}))
+	events.Subscribe(events.DatabaseGrown, "database alerts", alerter.OnDatabaseGrown)
+
+	// Alerts Alertmanager posts about the hosts go out as the camera
+	// alerts do
+	events.Subscribe("infra.*", "infrastructure alerts", alerter.OnInfraAlert)
+
+	// Each instance samples its own resources for the admin dashboard.
+	// A Postgres database is on another host, so only SQLite's disk is.
+	disks := []sysmon.DiskPath{{Name: "recordings", Path: cfg.Recording.Path}}
+	if cfg.Database.Driver == "sqlite" {
+		disks = append([]sysmon.DiskPath{{Name: "database", Path: filepath.Dir(cfg.Database.Path)}}, disks...)
+	}
+	monitor := sysmon.New(sysmon.Options{
+		Interval:  cfg.Monitor.Interval,
+		History:   cfg.Monitor.History,
+		Disks:     disks,
+		Go2RTCURL: func() string { return cfg.Stream().APIURL },
+	})
+	lifecycle.Go("system monitor", monitor.Run)
+
+	// The day before is summed up every night for admins and sent on
+	// REPORT_CHANNELS; see internal/reports. REPORT_TIMEZONE is checked
+	// at startup.
+	reportZone, _ := time.LoadLocation(cfg.Reports.Timezone)
+	dailyReports := reports.New(db, reports.Options{
+		Hour:     cfg.Reports.Hour,
+		Location: reportZone,
+		Disks: func() []sysmon.Disk {
+			sample, _ := monitor.Latest()
+			return sample.Disks
+		},
+		Built: func(r reports.Report) {
+			events.Publish(events.Event{Type: events.ReportDaily, Time: time.Now().UTC(), Resource: "report",
+				Data: map[string]interface{}{"date": r.Date, "report": r}})
+		},
+	})
+	lifecycle.Go("daily reports", node.Lead(dailyReports.Run))
+	events.Subscribe(events.ReportDaily, "daily report", alerter.OnDailyReport(cfg.Reports.Channels))
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db, cfg)
-	cameraHandler := handlers.NewCameraHandler(db, cfg)
+	cameraHandler := handlers.NewCameraHandler(cameraService, cfg)
 	areaHandler := handlers.NewAreaHandler(db, cfg)
-	userHandler := handlers.NewUserHandler(db, cfg)
+	userHandler := handlers.NewUserHandler(userService, cfg)
 	settingsHandler := handlers.NewSettingsHandler(db, cfg)
-	streamHandler := handlers.NewStreamHandler(db, cfg)
-	adminHandler := handlers.NewAdminHandler(db, cfg)
+	edges := edge.NewHub(lifecycle.Context())
+	// Viewer session changes are written in batches; the last batch on
+	// shutdown
+	recorder := viewers.New(db, cfg.Viewers)
+	lifecycle.Go("viewer sessions", recorder.Run)
+	streamHandler := handlers.NewStreamHandler(db, cfg, edges, recorder, lifecycle.Context())
+	adminHandler := handlers.NewAdminHandler(db, cfg, monitor)
 	feedbackHandler := handlers.NewFeedbackHandler(db, cfg)
 	recordingHandler := handlers.NewRecordingHandler(db, cfg)
+	healthHandler := handlers.NewHealthHandler(db, cfg)
+	jobsHandler := handlers.NewJobsHandler(queue, cfg)
+	accessLogHandler := handlers.NewAccessLogHandler(db, cfg)
+	motionHandler := handlers.NewMotionHandler(db, cfg)
+	probeHandler := handlers.NewProbeHandler(db, cfg)
+	healthCheckHandler := handlers.NewHealthCheckHandler(db, queue, cfg)
+	systemHandler := handlers.NewSystemHandler(monitor, cfg)
+	detectionHandler := handlers.NewDetectionHandler(db, cfg)
+	anprHandler := handlers.NewANPRHandler(db, cfg)
+	organizations := tenant.NewResolver(db)
+	organizationHandler := handlers.NewOrganizationHandler(db, cfg, organizations)
+	statusHandler := handlers.NewStatusHandler(db, cfg)
+	incidentHandler := handlers.NewIncidentHandler(db, cfg)
+	playlistHandler := handlers.NewPlaylistHandler(db, cfg)
+	shareHandler := handlers.NewShareHandler(db, cfg)
+	weatherHandler := handlers.NewWeatherHandler(db, cfg)
+	announcementHandler := handlers.NewAnnouncementHandler(db, cfg)
+	widgetHandler := handlers.NewWidgetHandler(db, cfg)
+	privacyHandler := handlers.NewPrivacyHandler(db, cfg)
+	edgeHandler := handlers.NewEdgeHandler(db, cfg, edges)
+	alertHandler := handlers.NewAlertHandler(db, cfg)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db, cfg)
+	maintenanceMode := maintenance.New(db)
+	maintenanceHandler := handlers.NewMaintenanceHandler(maintenanceMode, cfg)
+	offlineImageHandler := handlers.NewOfflineImageHandler(db, cfg)
+	cameraNoteHandler := handlers.NewCameraNoteHandler(db, uploadStore, cfg)
+	ticketHandler := handlers.NewTicketHandler(db, cfg)
+	outageHandler := handlers.NewOutageHandler(db, cfg)
+	infraAlertHandler := handlers.NewInfraAlertHandler(db, cfg)
+	streamTrafficHandler := handlers.NewStreamTrafficHandler(db, cfg)
+	reportHandler := handlers.NewReportHandler(db, cfg)
+	configBundleHandler := handlers.NewConfigBundleHandler(db, cfg)
+	streamerSyncHandler := handlers.NewStreamerSyncHandler(db, cfg)
+	cameraSearchHandler := handlers.NewCameraSearchHandler(db, cfg)
+	bootstrapHandler := handlers.NewBootstrapHandler(cfg, settingsHandler, areaHandler, announcementHandler)
+	ipBanHandler := handlers.NewIPBanHandler(abuseGuard, cfg)
+	logRetentionHandler := handlers.NewLogRetentionHandler(logRetention, cfg)
+	uploadHandler := handlers.NewUploadHandler(db, uploadStore, cfg)
+	
+	// Health check
+	app.Get("/health", healthHandler.Live)
+	app.Get("/health/live", healthHandler.Live)
+	app.Get("/health/ready", healthHandler.Ready)
+	app.Get("/metrics", healthHandler.Metrics)
 	
 	// API routes
 	api := app.Group("/api")
 	
+	// Rate limits are per client IP and minute, read from the config on
+	// every request so a reload applies them at once; they are counted
+	// in Redis when it is configured, else in the database in cluster
+	// mode. Players fetch playlists and
+	// segments every few seconds, so streams are exempt, as are plate
+	// reads posted by ANPR devices with their API key, edge agents
+	// opening tunnels and Alertmanager posting alerts.
+	var publicCounter, authCounter, searchCounter, playerCounter middleware.Counter
+	if r, ok := cache.Shared().(*cache.Redis); ok {
+		publicCounter, authCounter = r.RateCounter("public"), r.RateCounter("auth")
+		searchCounter, playerCounter = r.RateCounter("search"), r.RateCounter("player")
+	} else if node.Clustered() {
+		publicCounter, authCounter = cluster.NewRateCounter(db, "public"), cluster.NewRateCounter(db, "auth")
+		searchCounter = cluster.NewRateCounter(db, "search")
+	}
+	publicLimit := rateLimit(publicCounter, func() int {
+		limit, _ := cfg.RateLimits()
+		return limit
+	})
+	authLimit := rateLimit(authCounter, func() int {
+		_, limit := cfg.RateLimits()
+		return limit
+	})
+	// The search box queries as visitors type, and each query reaches
+	// the database unless cached, so it gets a tighter limit of its own
+	searchLimit := rateLimit(searchCounter, cfg.SearchRateLimit)
+	api.Use(func(c *fiber.Ctx) error {
+		if streaming(c) {
+			return c.Next()
+		}
+		if c.Method() == fiber.MethodPost && c.Path() == "/api/anpr/events" {
+			return c.Next()
+		}
+		if strings.HasPrefix(c.Path(), "/api/edge/") {
+			return c.Next()
+		}
+		if c.Method() == fiber.MethodPost && c.Path() == "/api/integrations/alertmanager" {
+			return c.Next()
+		}
+		return publicLimit(c)
+	})
+	
+	// Requests without a token see the organization picked by ?org= or
+	// the host name; AuthMiddleware switches to the user's own
+	api.Use(middleware.Organization(organizations))
+	
+	// Third parties send an API key, which picks its organization and
+	// counts their requests against its daily quota; streams count
+	// against its stream limit instead
+	api.Use(middleware.APIKey(apikeys.New(db), func(c *fiber.Ctx) bool { return !streaming(c) }))
+	
+	// During maintenance the public routes answer 503 with the
+	// organization's branding, and streams too when asked to stop; the
+	// admin APIs stay available
+	api.Use(middleware.Maintenance(maintenanceMode, underMaintenance, settingsHandler.Branding))
+	
+	// API documentation
+	api.Get("/openapi.json", serveSpec(app))
+	if cfg.Server.Env != "production" {
+		api.Get("/docs", serveSwaggerUI)
+	}
+	
+	// Public JSON fetched on every page load: cacheable for a short
+	// while and revalidated with ETag/Last-Modified after that
+	fresh := middleware.NewFreshness()
+	cacheSettings := middleware.Conditional(fresh, publicMaxAge, "settings")
+	cacheCameras := middleware.Conditional(fresh, publicMaxAge, "cameras", "areas")
+	cacheAreas := middleware.Conditional(fresh, publicMaxAge, "areas", "cameras")
+	cacheBootstrap := middleware.Conditional(fresh, publicMaxAge, "settings", "areas", "cameras")
+
 	// Public routes (no auth required)
-	api.Get("/branding/public", settingsHandler.GetPublicBranding)
+	api.Get("/public/bootstrap", cacheBootstrap, bootstrapHandler.GetBootstrap) // Everything the public page loads first
+	api.Get("/public/areas/:slug", cacheAreas, areaHandler.GetPublicArea) // Per-area page
+	api.Get("/branding/public", cacheSettings, settingsHandler.GetPublicBranding)
 	api.Get("/branding/admin", settingsHandler.GetAdminBranding)
 	api.Get("/saweria/config", settingsHandler.GetSaweriaConfig)
 	api.Get("/saweria/settings", settingsHandler.GetSaweriaSettings)
+	api.Get("/status/public", statusHandler.GetPublicStatus) // Cached for a minute
+	api.Get("/status/page", statusHandler.GetStatusPage) // Same, as HTML
+	api.Get("/kiosk/:token/playlist", playlistHandler.GetKioskPlaylist) // The token is the login
+	api.Get("/s/:slug", shareHandler.OpenShare) // Share link, redirects to the player
+	api.Get("/s/:slug/qr.png", shareHandler.GetShareQR)
+	api.Get("/weather", weatherHandler.GetWeather) // Map overlay
+	api.Get("/announcements/active", announcementHandler.GetActiveAnnouncements) // Landing page notices
+	
+	// Edge agents log in with their node's token; a tunnel request is
+	// upgraded and held open for stream requests
+	api.Get("/edge/tunnel", edgeHandler.OpenTunnel)
+	api.Post("/edge/heartbeat", edgeHandler.Heartbeat)
+
+	// Alertmanager posts with ALERTMANAGER_TOKEN as a bearer token
+	api.Post("/integrations/alertmanager", infraAlertHandler.ReceiveAlertmanager)
+	
+	// Widgets embedded on partner sites: readable from any origin and
+	// cached for half a minute
+	widgets := api.Group("/public/widgets", middleware.AnyOrigin())
+	widgets.Get("/viewer-count", widgetHandler.GetViewerCount)
+	widgets.Get("/viewer-count.svg", widgetHandler.GetViewerCountBadge)
+	
+	// Uploaded images; keys name their content, so they are cached for good
+	api.Get("/public/uploads/:key", uploadHandler.GetUpload)
 	
 	// Auth routes (public)
-	auth := api.Group("/auth")
+	auth := api.Group("/auth", authLimit)
 	auth.Post("/login", authHandler.Login)
 	auth.Post("/logout", authHandler.Logout)
 	auth.Get("/csrf", authHandler.GetCSRF) // CSRF token
@@ -43,26 +426,51 @@ func Setup(app *fiber.App, db *sql.DB, cfg *config.Config) {
 	auth.Get("/verify", authMiddleware, authHandler.Verify)
 	
 	// Camera routes
-	cameras := api.Group("/cameras")
-	cameras.Get("/active", cameraHandler.GetActiveCameras) // Public
+	cameras := api.Group("/cameras", middleware.Invalidates(fresh, "cameras"))
+	cameras.Get("/active", cacheCameras, cameraHandler.GetActiveCameras) // Public
+	cameras.Get("/search", searchLimit, cacheCameras, cameraSearchHandler.SearchCameras) // Public
 	cameras.Get("/", authMiddleware, cameraHandler.GetAllCameras) // Admin
 	cameras.Get("/:id", authMiddleware, cameraHandler.GetCamera)
-	cameras.Post("/", authMiddleware, cameraHandler.CreateCamera)
-	cameras.Put("/:id", authMiddleware, cameraHandler.UpdateCamera)
-	cameras.Delete("/:id", authMiddleware, cameraHandler.DeleteCamera)
-	cameras.Patch("/:id/toggle", authMiddleware, cameraHandler.ToggleCamera)
+	cameras.Post("/", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraHandler.CreateCamera)
+	cameras.Post("/import-urls", authMiddleware, middleware.RequireRole(models.RoleAdmin), streamerSyncHandler.ImportURLs)
+	cameras.Put("/:id", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraHandler.UpdateCamera)
+	cameras.Delete("/:id", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraHandler.DeleteCamera)
+	cameras.Patch("/:id/toggle", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraHandler.ToggleCamera)
+	cameras.Get("/:id/motion-events", authMiddleware, motionHandler.GetMotionEvents)
+	cameras.Get("/:id/motion-settings", authMiddleware, motionHandler.GetMotionSettings)
+	cameras.Put("/:id/motion-settings", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), motionHandler.UpdateMotionSettings)
+	cameras.Get("/:id/health-probes", authMiddleware, probeHandler.GetCameraProbes)
+	cameras.Put("/:id/health-probes", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), probeHandler.UpdateCameraProbes)
+	cameras.Get("/:id/shares", authMiddleware, shareHandler.GetShares)
+	cameras.Post("/:id/share", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), shareHandler.CreateShare)
+	cameras.Delete("/:id/shares/:slug", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), shareHandler.DeleteShare)
+	cameras.Get("/:id/offline-image", authMiddleware, offlineImageHandler.GetOfflineImage)
+	cameras.Put("/:id/offline-image", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), offlineImageHandler.PutOfflineImage)
+	cameras.Delete("/:id/offline-image", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), offlineImageHandler.DeleteOfflineImage)
+	cameras.Get("/:id/notes", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator), cameraNoteHandler.GetCameraNotes)
+	cameras.Post("/:id/notes", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraNoteHandler.CreateCameraNote)
+	cameras.Put("/:id/notes/:noteId", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraNoteHandler.UpdateCameraNote)
+	cameras.Delete("/:id/notes/:noteId", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraNoteHandler.DeleteCameraNote)
+	cameras.Get("/:id/attachments", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator), cameraNoteHandler.GetCameraAttachments)
+	cameras.Post("/:id/attachments", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraNoteHandler.CreateCameraAttachment)
+	cameras.Delete("/:id/attachments/:attachmentId", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), cameraNoteHandler.DeleteCameraAttachment)
+	cameras.Get("/:id/tickets", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator), ticketHandler.GetCameraTickets)
+	cameras.Get("/:id/outages", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator), outageHandler.GetCameraOutages)
 	
 	// Area routes
-	areas := api.Group("/areas")
-	areas.Get("/", areaHandler.GetAllAreas) // Public - also accessible as /public
-	areas.Get("/public", areaHandler.GetAllAreas) // Public alias
+	areas := api.Group("/areas", middleware.Invalidates(fresh, "areas"))
+	areas.Get("/", cacheAreas, areaHandler.GetAllAreas) // Public - also accessible as /public
+	areas.Get("/public", cacheAreas, areaHandler.GetAllAreas) // Public alias
+	areas.Get("/tree", cacheAreas, areaHandler.GetAreaTree) // Public - nested by parent
+	areas.Get("/geojson", cacheAreas, areaHandler.GetAreasGeoJSON) // Public - boundaries for map overlays
 	areas.Get("/:id", authMiddleware, areaHandler.GetArea)
-	areas.Post("/", authMiddleware, areaHandler.CreateArea)
-	areas.Put("/:id", authMiddleware, areaHandler.UpdateArea)
-	areas.Delete("/:id", authMiddleware, areaHandler.DeleteArea)
+	areas.Get("/:id/stats", authMiddleware, areaHandler.GetAreaStats)
+	areas.Post("/", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), areaHandler.CreateArea)
+	areas.Put("/:id", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), areaHandler.UpdateArea)
+	areas.Delete("/:id", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), areaHandler.DeleteArea)
 	
-	// User routes (admin only)
-	users := api.Group("/users", authMiddleware)
+	// User routes (admins, and org admins for their organization)
+	users := api.Group("/users", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin))
 	users.Get("/", userHandler.GetAllUsers)
 	users.Get("/:id", userHandler.GetUser)
 	users.Post("/", userHandler.CreateUser)
@@ -70,33 +478,56 @@ func Setup(app *fiber.App, db *sql.DB, cfg *config.Config) {
 	users.Delete("/:id", userHandler.DeleteUser)
 	users.Post("/:id/change-password", userHandler.ChangePassword)
 	
+	// Organization routes (admins only; they see every organization)
+	orgs := api.Group("/organizations", authMiddleware, middleware.RequireRole(models.RoleAdmin))
+	orgs.Get("/", organizationHandler.GetOrganizations)
+	orgs.Post("/", organizationHandler.CreateOrganization)
+	orgs.Put("/:id", organizationHandler.UpdateOrganization)
+	orgs.Delete("/:id", organizationHandler.DeleteOrganization)
+	
 	// Public settings routes (MUST be before protected settings group)
-	api.Get("/settings/landing-page", settingsHandler.GetLandingPageSettings)
-	api.Get("/settings/map-center", settingsHandler.GetMapCenter)
+	api.Get("/settings/landing-page", cacheSettings, settingsHandler.GetLandingPageSettings)
+	api.Get("/settings/map-center", cacheSettings, settingsHandler.GetMapCenter)
 	
-	// Settings routes (admin only)
-	settings := api.Group("/settings", authMiddleware)
+	// Image uploads: avatars for everyone, sponsor logos and branding
+	// for admins
+	uploadRoutes := api.Group("/uploads", authMiddleware)
+	uploadRoutes.Post("/", uploadHandler.CreateUpload)
+	uploadRoutes.Put("/avatar", uploadHandler.SetAvatar)
+	uploadRoutes.Delete("/avatar", uploadHandler.DeleteAvatar)
+	
+	// Settings routes: every signed-in user reads them, admins and org
+	// admins change them
+	settings := api.Group("/settings", authMiddleware, middleware.Invalidates(fresh, "settings"))
 	settings.Get("/", settingsHandler.GetSettings)
 	settings.Get("/category/:category", settingsHandler.GetSettingsByCategory)
 	settings.Get("/:key", settingsHandler.GetSetting)
-	settings.Put("/:key", settingsHandler.UpdateSetting)
-	settings.Delete("/:key", settingsHandler.DeleteSetting)
-	settings.Post("/bulk", settingsHandler.BulkUpdateSettings)
+	settings.Put("/:key", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), settingsHandler.UpdateSetting)
+	settings.Delete("/:key", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), settingsHandler.DeleteSetting)
+	settings.Post("/bulk", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), settingsHandler.BulkUpdateSettings)
 	
 	// Stream routes
-	stream := api.Group("/stream")
+	stream := api.Group("/stream", middleware.StreamGuard(abuseGuard, streamRequest),
+		middleware.PlayerToken(cfg.JWT.Secret, cfg.Go2RTC.PlayerTokenRequired, func() int { return cfg.Stream().PlayerTokenRequests }, playerCounter,
+			func(c *fiber.Ctx) bool { return c.Path() == "/api/stream/token" }))
+	stream.Post("/token", streamHandler.IssuePlayerToken) // Public - anonymous player token
 	stream.Get("/", streamHandler.GetAllStreams) // List all active streams
+	stream.Post("/multiview", streamHandler.GetMultiviewURLs) // Public - signed URLs for a grid view
 	stream.Get("/:streamKey", streamHandler.GetStreamURL) // Public
 	stream.Get("/hls/:streamKey/*", streamHandler.ProxyHLS) // Public - HLS proxy
 	stream.Get("/mse/:streamKey", streamHandler.ProxyMSE) // Public - MSE/MP4 proxy
+	stream.Get("/audio/:streamKey", streamHandler.ProxyAudio) // Public - AAC audio only
 	stream.Get("/:streamKey/stats", streamHandler.GetStreamStats) // Public
+	stream.Get("/:streamKey/snapshot", streamHandler.GetSnapshot) // Public - current frame, or the offline image
 	stream.Post("/:streamKey/start", streamHandler.StartViewing) // Public
+	stream.Post("/:streamKey/heartbeat", streamHandler.ViewingHeartbeat) // Public
 	stream.Post("/:streamKey/stop", streamHandler.StopViewing) // Public
 	
 	// Admin routes (admin only)
 	admin := api.Group("/admin", authMiddleware)
 	admin.Get("/dashboard", adminHandler.GetDashboardStats)
 	admin.Get("/stats", adminHandler.GetDashboardStats) // Alias for dashboard stats
+	admin.Get("/stats/system", middleware.RequireRole(models.RoleAdmin), adminHandler.GetSystemStats) // Every organization, cached
 	admin.Get("/settings/timezone", settingsHandler.GetTimezone)
 	admin.Get("/stats/today", func(c *fiber.Ctx) error {
 		// Return today's stats in format expected by QuickStatsCards
@@ -123,10 +554,75 @@ func Setup(app *fiber.App, db *sql.DB, cfg *config.Config) {
 		})
 	})
 	admin.Get("/system", adminHandler.GetSystemInfo)
-	admin.Get("/activity", adminHandler.GetRecentActivity)
+	admin.Get("/system/resources", middleware.RequireRole(models.RoleAdmin), systemHandler.GetSystemResources)
+	admin.Get("/activity", middleware.RequireRole(models.RoleAdmin), adminHandler.GetRecentActivity)
 	admin.Get("/camera-health", adminHandler.GetCameraHealth)
-	admin.Post("/cleanup-sessions", adminHandler.CleanupSessions)
+	admin.Post("/camera-health/check", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), healthCheckHandler.CreateHealthCheck)
+	admin.Get("/camera-health/checks/:id", healthCheckHandler.GetHealthCheck)
+	admin.Get("/sessions", adminHandler.GetViewerSessions)
+	admin.Get("/sessions/export", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), adminHandler.ExportViewerSessions)
+	admin.Get("/export", middleware.RequireRole(models.RoleAdmin), configBundleHandler.ExportConfig)
+	admin.Post("/import", middleware.RequireRole(models.RoleAdmin), configBundleHandler.ImportConfig)
+	admin.Post("/cameras/sync-from-streamer", middleware.RequireRole(models.RoleAdmin), streamerSyncHandler.SyncFromStreamer)
+	admin.Post("/cleanup-sessions", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), adminHandler.CleanupSessions)
 	admin.Get("/database-stats", adminHandler.GetDatabaseStats)
+	admin.Post("/config/reload", middleware.RequireRole(models.RoleAdmin), adminHandler.ReloadConfig)
+	admin.Get("/jobs/queue", jobsHandler.GetQueue)
+	admin.Get("/maintenance", maintenanceHandler.GetMaintenance)
+	admin.Post("/maintenance", middleware.RequireRole(models.RoleAdmin), maintenanceHandler.SetMaintenance)
+	admin.Get("/ip-bans", middleware.RequireRole(models.RoleAdmin), ipBanHandler.GetIPBans)
+	admin.Delete("/ip-bans/:id", middleware.RequireRole(models.RoleAdmin), ipBanHandler.DeleteIPBan)
+	admin.Get("/offline-image", offlineImageHandler.GetOfflineImage)
+	admin.Put("/offline-image", middleware.RequireRole(models.RoleAdmin), offlineImageHandler.PutOfflineImage)
+	admin.Delete("/offline-image", middleware.RequireRole(models.RoleAdmin), offlineImageHandler.DeleteOfflineImage)
+	admin.Get("/access-logs", middleware.RequireRole(models.RoleAdmin), accessLogHandler.GetAccessLogs)
+	admin.Get("/privacy/policy-status", middleware.RequireRole(models.RoleAdmin), privacyHandler.GetPolicyStatus)
+	admin.Get("/log-retention", middleware.RequireRole(models.RoleAdmin), logRetentionHandler.GetLogRetention)
+	admin.Put("/log-retention/:type", middleware.RequireRole(models.RoleAdmin), logRetentionHandler.SetLogRetention)
+	admin.Post("/log-retention/prune", middleware.RequireRole(models.RoleAdmin), logRetentionHandler.PruneLogs)
+	admin.Post("/uploads/gc", middleware.RequireRole(models.RoleAdmin), uploadHandler.CollectUploads)
+	admin.Get("/incidents", incidentHandler.GetIncidents)
+	admin.Get("/incidents/:id", incidentHandler.GetIncident)
+	admin.Post("/incidents", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator), incidentHandler.CreateIncident)
+	admin.Put("/incidents/:id", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator), incidentHandler.UpdateIncident)
+	admin.Post("/incidents/:id/updates", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator), incidentHandler.AddIncidentUpdate)
+	admin.Delete("/incidents/:id", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin, models.RoleOperator), incidentHandler.DeleteIncident)
+	admin.Get("/playlists", playlistHandler.GetPlaylists)
+	admin.Get("/playlists/:id", playlistHandler.GetPlaylist)
+	admin.Post("/playlists", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), playlistHandler.CreatePlaylist)
+	admin.Put("/playlists/:id", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), playlistHandler.UpdatePlaylist)
+	admin.Post("/playlists/:id/token", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), playlistHandler.RotatePlaylistToken)
+	admin.Delete("/playlists/:id", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), playlistHandler.DeletePlaylist)
+	admin.Get("/announcements", announcementHandler.GetAnnouncements)
+	admin.Get("/announcements/:id", announcementHandler.GetAnnouncement)
+	admin.Post("/announcements", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), announcementHandler.CreateAnnouncement)
+	admin.Put("/announcements/:id", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), announcementHandler.UpdateAnnouncement)
+	admin.Delete("/announcements/:id", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), announcementHandler.DeleteAnnouncement)
+	admin.Get("/edge-nodes", edgeHandler.GetEdgeNodes)
+	admin.Post("/edge-nodes", middleware.RequireRole(models.RoleAdmin), edgeHandler.CreateEdgeNode)
+	admin.Put("/edge-nodes/:id/cameras", middleware.RequireRole(models.RoleAdmin), edgeHandler.SetEdgeNodeCameras)
+	admin.Post("/edge-nodes/:id/token", middleware.RequireRole(models.RoleAdmin), edgeHandler.RotateEdgeNodeToken)
+	admin.Delete("/edge-nodes/:id", middleware.RequireRole(models.RoleAdmin), edgeHandler.DeleteEdgeNode)
+	admin.Get("/alert-policies", alertHandler.GetAlertPolicies)
+	admin.Post("/alert-policies", middleware.RequireRole(models.RoleAdmin), alertHandler.CreateAlertPolicy)
+	admin.Put("/alert-policies/:id", middleware.RequireRole(models.RoleAdmin), alertHandler.UpdateAlertPolicy)
+	admin.Delete("/alert-policies/:id", middleware.RequireRole(models.RoleAdmin), alertHandler.DeleteAlertPolicy)
+	admin.Get("/camera-alerts", alertHandler.GetCameraAlerts)
+	admin.Get("/infra-alerts", middleware.RequireRole(models.RoleAdmin), infraAlertHandler.GetInfraAlerts)
+	admin.Get("/stream-traffic", streamTrafficHandler.GetStreamTraffic)
+	admin.Get("/reports/daily", middleware.RequireRole(models.RoleAdmin), reportHandler.GetDailyReports)
+	admin.Get("/reports/daily/:date", middleware.RequireRole(models.RoleAdmin), reportHandler.GetDailyReport)
+	admin.Get("/camera-tickets", ticketHandler.GetTickets)
+	admin.Get("/notification-templates", alertHandler.GetNotificationTemplates)
+	admin.Put("/notification-templates/:type", middleware.RequireRole(models.RoleAdmin), alertHandler.UpdateNotificationTemplate)
+	admin.Delete("/notification-templates/:type", middleware.RequireRole(models.RoleAdmin), alertHandler.DeleteNotificationTemplate)
+	admin.Post("/notification-templates/:type/preview", alertHandler.PreviewNotificationTemplate)
+	admin.Get("/api-keys", apiKeyHandler.GetAPIKeys)
+	admin.Get("/api-keys/:id/usage", apiKeyHandler.GetAPIKeyUsage)
+	admin.Post("/api-keys", middleware.RequireRole(models.RoleAdmin), apiKeyHandler.CreateAPIKey)
+	admin.Put("/api-keys/:id", middleware.RequireRole(models.RoleAdmin), apiKeyHandler.UpdateAPIKey)
+	admin.Delete("/api-keys/:id", middleware.RequireRole(models.RoleAdmin), apiKeyHandler.DeleteAPIKey)
+	admin.Post("/users/:id/impersonate", middleware.RequireRole(models.RoleAdmin), authHandler.Impersonate)
 	
 	// Analytics routes (placeholders - return empty data for now)
 	admin.Get("/analytics/viewers", func(c *fiber.Ctx) error {
@@ -147,6 +643,8 @@ func Setup(app *fiber.App, db *sql.DB, cfg *config.Config) {
 			},
 		})
 	})
+	admin.Get("/analytics/sources", adminHandler.GetViewerSources)
+	admin.Get("/analytics/heatmap", adminHandler.GetViewerHeatmap)
 	
 	// Telegram routes (placeholders)
 	admin.Get("/telegram/status", func(c *fiber.Ctx) error {
@@ -176,15 +674,40 @@ func Setup(app *fiber.App, db *sql.DB, cfg *config.Config) {
 	feedback.Post("/", feedbackHandler.CreateFeedback) // Public
 	feedback.Get("/", authMiddleware, feedbackHandler.GetAllFeedback) // Admin
 	feedback.Get("/stats", authMiddleware, feedbackHandler.GetFeedbackStats) // Admin
+	feedback.Get("/public", feedbackHandler.GetPublicFeedback) // Public - approved testimonials
 	feedback.Get("/:id", authMiddleware, feedbackHandler.GetFeedback) // Admin
-	feedback.Patch("/:id/status", authMiddleware, feedbackHandler.UpdateFeedbackStatus) // Admin
-	feedback.Delete("/:id", authMiddleware, feedbackHandler.DeleteFeedback) // Admin
+	feedback.Patch("/:id/status", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), feedbackHandler.UpdateFeedbackStatus)
+	feedback.Patch("/:id/moderation", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), feedbackHandler.ModerateFeedback)
+	feedback.Delete("/:id", authMiddleware, middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), feedbackHandler.DeleteFeedback)
 	
+	// Download links of recording webhooks carry their own signature
+	api.Get("/recording-downloads/:id", recordingHandler.DownloadRecording)
+
 	// Recording routes (admin only)
 	recordings := api.Group("/recordings", authMiddleware)
+	recordings.Get("/", recordingHandler.GetRecordings)
 	recordings.Get("/overview", recordingHandler.GetRecordingsOverview)
 	recordings.Get("/restarts", recordingHandler.GetRestartLogs)
 	recordings.Get("/:cameraId/restarts", recordingHandler.GetCameraRestartLogs)
+	recordings.Get("/:cameraId/playlist.m3u8", recordingHandler.GetPlaybackPlaylist) // HLS VOD over ?from=&to=
+	recordings.Get("/:cameraId/vod.m3u8", recordingHandler.GetPlaybackMedia)
+	recordings.Get("/:cameraId/iframes.m3u8", recordingHandler.GetPlaybackIFrames) // Keyframes only, ?speed=1|2|4
+	recordings.Get("/:cameraId/segments/:id", recordingHandler.GetRecordingSegment)
+	recordings.Get("/:cameraId/frame", recordingHandler.GetRecordingFrame) // JPEG still at ?at=
+	
+	// Object detection routes (admin only)
+	detections := api.Group("/detections", authMiddleware)
+	detections.Get("/", detectionHandler.GetDetections)
+	detections.Get("/rules", detectionHandler.GetDetectionRules)
+	detections.Post("/rules", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), detectionHandler.CreateDetectionRule)
+	detections.Put("/rules/:id", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), detectionHandler.UpdateDetectionRule)
+	detections.Delete("/rules/:id", middleware.RequireRole(models.RoleAdmin, models.RoleOrgAdmin), detectionHandler.DeleteDetectionRule)
+	
+	// Licence plate routes: devices post reads with the ingest key, and
+	// searching them needs the anpr permission
+	anprRoutes := api.Group("/anpr")
+	anprRoutes.Post("/events", anprHandler.IngestANPREvent)
+	anprRoutes.Get("/events", authMiddleware, middleware.RequirePermission(db, models.PermissionANPR), anprHandler.GetANPREvents)
 	
 	// Sponsor routes (placeholders for future implementation)
 	sponsors := api.Group("/sponsors", authMiddleware)
@@ -222,3 +745,89 @@ func Setup(app *fiber.App, db *sql.DB, cfg *config.Config) {
 		})
 	})
 }
+
+// streaming reports whether c is a player fetching stream playlists,
+// segments, MSE data or audio
+func streaming(c *fiber.Ctx) bool {
+	return strings.HasPrefix(c.Path(), "/api/stream/hls/") || strings.HasPrefix(c.Path(), "/api/stream/mse/") ||
+		strings.HasPrefix(c.Path(), "/api/stream/audio/")
+}
+
+// streamRequest names the camera a stream request is for and whether
+// it fetches a playlist, for the abuse checks. Listing streams, multi-view
+// URLs, stats and viewer sessions name none.
+func streamRequest(c *fiber.Ctx) (string, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(c.Path(), "/api/stream"), "/"), "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "hls":
+		return parts[1], strings.HasSuffix(parts[len(parts)-1], ".m3u8")
+	case len(parts) == 2 && (parts[0] == "mse" || parts[0] == "audio"):
+		return parts[1], true
+	case len(parts) == 1 && parts[0] != "" && parts[0] != "multiview":
+		return parts[0], true
+	case len(parts) == 2 && parts[1] == "snapshot":
+		return parts[0], false
+	}
+	return "", false
+}
+
+// publicPaths are the routes anyone may read without logging in; paths
+// ending in / cover everything below them
+var publicPaths = []string{
+	"/api/cameras/active", "/api/cameras/search",
+	"/api/areas", "/api/areas/public", "/api/areas/tree", "/api/areas/geojson",
+	"/api/branding/public",
+	"/api/saweria/",
+	"/api/status/",
+	"/api/kiosk/",
+	"/api/s/",
+	"/api/weather",
+	"/api/announcements/active",
+	"/api/public/",
+	"/api/openapi.json",
+}
+
+// CORSGroup picks the route group whose CORS origins apply to c: stream
+// routes, reads of the public routes, or admin for everything else. A
+// preflight is classed by the method it asks about.
+func CORSGroup(c *fiber.Ctx) string {
+	path := strings.TrimSuffix(c.Path(), "/")
+	if path == "/api/stream" || strings.HasPrefix(path, "/api/stream/") {
+		return config.CORSStream
+	}
+
+	method := c.Method()
+	if method == fiber.MethodOptions {
+		method = c.Get(fiber.HeaderAccessControlRequestMethod)
+	}
+	if method != fiber.MethodGet && method != fiber.MethodHead {
+		return config.CORSAdmin
+	}
+	for _, p := range publicPaths {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return config.CORSPublic
+		}
+	}
+	return config.CORSAdmin
+}
+
+// underMaintenance reports whether c is refused while the maintenance
+// mode is on: reads of the public routes, and streams when they stop too
+func underMaintenance(c *fiber.Ctx, state maintenance.State) bool {
+	switch CORSGroup(c) {
+	case config.CORSPublic:
+		return true
+	case config.CORSStream:
+		return state.StopStreams
+	}
+	return false
+}
+
+// rateLimit limits requests per client IP and minute, counted by
+// counter when it is set and in memory otherwise
+func rateLimit(counter middleware.Counter, limit func() int) fiber.Handler {
+	if counter == nil {
+		return middleware.RateLimit(limit, time.Minute)
+	}
+	return middleware.RateLimitWith(counter, limit, time.Minute)
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/shutdown"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCORSGroup(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		return c.SendString(CORSGroup(c))
+	})
+
+	for _, tc := range []struct {
+		method, path, preflight, want string
+	}{
+		{"GET", "/api/cameras/active", "", config.CORSPublic},
+		{"GET", "/api/areas/", "", config.CORSPublic},
+		{"GET", "/api/status/page", "", config.CORSPublic},
+		{"OPTIONS", "/api/cameras/active", "GET", config.CORSPublic},
+		{"GET", "/api/cameras/", "", config.CORSAdmin},
+		{"GET", "/api/areas/3", "", config.CORSAdmin},
+		{"GET", "/api/admin/dashboard", "", config.CORSAdmin},
+		{"OPTIONS", "/api/announcements/active", "DELETE", config.CORSAdmin},
+		{"POST", "/api/auth/login", "", config.CORSAdmin},
+		{"GET", "/api/stream/hls/gate/index.m3u8", "", config.CORSStream},
+		{"POST", "/api/stream/gate/start", "", config.CORSStream},
+		{"GET", "/api/streamers", "", config.CORSAdmin},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.preflight != "" {
+			req.Header.Set("Access-Control-Request-Method", tc.preflight)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if got := string(body); got != tc.want {
+			t.Errorf("%s %s: expected %s, got %s", tc.method, tc.path, tc.want, got)
+		}
+	}
+}
+
+func TestStreamRequest(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		key, playlist := streamRequest(c)
+		if playlist {
+			key += " playlist"
+		}
+		return c.SendString(key)
+	})
+
+	for _, tc := range []struct {
+		method, path, want string
+	}{
+		{"GET", "/api/stream/hls/gate/index.m3u8", "gate playlist"},
+		{"GET", "/api/stream/hls/gate/segment.ts", "gate"},
+		{"GET", "/api/stream/mse/gate", "gate playlist"},
+		{"GET", "/api/stream/audio/gate", "gate playlist"},
+		{"GET", "/api/stream/gate", "gate playlist"},
+		{"GET", "/api/stream/gate/snapshot", "gate"},
+		{"GET", "/api/stream/gate/stats", ""},
+		{"POST", "/api/stream/gate/heartbeat", ""},
+		{"POST", "/api/stream/multiview", ""},
+		{"GET", "/api/stream/", ""},
+	} {
+		resp, err := app.Test(httptest.NewRequest(tc.method, tc.path, nil))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if got := string(body); got != tc.want {
+			t.Errorf("%s %s: expected %q, got %q", tc.method, tc.path, tc.want, got)
+		}
+	}
+}
+
+func TestViewerWrites(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+	cfg := &config.Config{Server: config.ServerConfig{Env: "development"}, JWT: config.JWTConfig{Secret: "test-secret"}}
+	app := fiber.New()
+	Setup(app, db, cfg, shutdown.New(time.Second))
+
+	for _, tc := range []struct{ method, path, body string }{
+		{"POST", "/api/cameras/", `{"name":"Gate","private_rtsp_url":"rtsp://a"}`},
+		{"PUT", "/api/settings/company_name", `{"value":"Dander"}`},
+	} {
+		for _, role := range []string{models.RoleViewer, models.RoleOperator} {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"user_id": 2, "username": role, "role": role, "exp": time.Now().Add(time.Hour).Unix(),
+			}).SignedString([]byte(cfg.JWT.Secret))
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			if resp.StatusCode != 403 {
+				t.Errorf("%s %s as %s: expected 403, got %d", tc.method, tc.path, role, resp.StatusCode)
+			}
+		}
+	}
+}
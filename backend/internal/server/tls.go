@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS builds the listener config for cfg. It returns a nil config when
+// TLS is off. wrap decorates the plain-HTTP handler so ACME HTTP-01
+// challenges are answered there; it is a pass-through for certificate
+// files.
+func TLS(cfg config.TLSConfig) (tlsConfig *tls.Config, wrap func(http.Handler) http.Handler, err error) {
+	passThrough := func(h http.Handler) http.Handler { return h }
+
+	hasFiles := cfg.CertFile != "" || cfg.KeyFile != ""
+	switch {
+	case hasFiles && len(cfg.AutocertDomains) > 0:
+		return nil, nil, errors.New("set either TLS_CERT_FILE/TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS, not both")
+
+	case hasFiles:
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}, passThrough, nil
+
+	case len(cfg.AutocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, manager.HTTPHandler, nil
+	}
+
+	return nil, passThrough, nil
+}
+
+// RedirectHandler sends plain-HTTP requests to the same host and path
+// over HTTPS on httpsPort
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
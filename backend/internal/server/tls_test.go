@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+)
+
+// writeCert writes a self-signed certificate and key into dir
+func writeCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	t.Run("Disabled without settings", func(t *testing.T) {
+		cfg, _, err := TLS(config.TLSConfig{})
+		if err != nil || cfg != nil {
+			t.Errorf("Expected TLS off, got %v (%v)", cfg, err)
+		}
+	})
+
+	t.Run("Certificate files", func(t *testing.T) {
+		certFile, keyFile := writeCert(t, t.TempDir())
+
+		cfg, wrap, err := TLS(config.TLSConfig{CertFile: certFile, KeyFile: keyFile})
+		if err != nil {
+			t.Fatalf("Expected certificate to load, got %v", err)
+		}
+		if len(cfg.Certificates) != 1 || wrap == nil {
+			t.Error("Expected one certificate and a handler wrapper")
+		}
+	})
+
+	t.Run("Autocert", func(t *testing.T) {
+		cfg, _, err := TLS(config.TLSConfig{AutocertDomains: []string{"cctv.example.com"}, AutocertCacheDir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("Expected autocert config, got %v", err)
+		}
+		if cfg.GetCertificate == nil {
+			t.Error("Expected certificates to be fetched on demand")
+		}
+	})
+
+	t.Run("Invalid combinations", func(t *testing.T) {
+		invalid := []config.TLSConfig{
+			{CertFile: "cert.pem"},
+			{CertFile: "cert.pem", KeyFile: "key.pem", AutocertDomains: []string{"cctv.example.com"}},
+			{CertFile: "missing.pem", KeyFile: "missing.pem"},
+		}
+		for _, cfg := range invalid {
+			if _, _, err := TLS(cfg); err == nil {
+				t.Errorf("Expected error for %+v", cfg)
+			}
+		}
+	})
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		port string
+		host string
+		want string
+	}{
+		{"443", "cctv.example.com", "https://cctv.example.com/api/cameras?page=2"},
+		{"443", "cctv.example.com:80", "https://cctv.example.com/api/cameras?page=2"},
+		{"8443", "cctv.example.com", "https://cctv.example.com:8443/api/cameras?page=2"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://"+tt.host+"/api/cameras?page=2", nil)
+		rec := httptest.NewRecorder()
+		RedirectHandler(tt.port).ServeHTTP(rec, req)
+
+		if rec.Code != 301 {
+			t.Errorf("Expected 301, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/repository"
+)
+
+// CameraInput is a create/update request after type coercion
+type CameraInput struct {
+	Name           string
+	PrivateRTSPURL string
+	Description    string
+	Location       string
+	GroupName      string
+	AreaID         *int
+	Latitude       *float64
+	Longitude      *float64
+	Enabled        bool
+	Traffic        bool
+	Watermark      bool
+	Recording      bool
+	StreamNode     *string // checked against STREAM_NODES by the caller
+}
+
+// CameraService manages cameras
+type CameraService interface {
+	List(ctx context.Context, opts repository.ListOptions) ([]models.Camera, int, error)
+	ListActive(ctx context.Context, opts repository.ListOptions) ([]models.PublicCamera, int, error)
+	Get(ctx context.Context, id int) (*models.Camera, error)
+	Create(ctx context.Context, input CameraInput) (*models.Camera, error)
+	Update(ctx context.Context, id int, input CameraInput) error
+	Delete(ctx context.Context, id int) error
+	Toggle(ctx context.Context, id int) (bool, error)
+}
+
+type cameraService struct {
+	cameras repository.CameraRepository
+	areas   repository.AreaRepository
+}
+
+func NewCameraService(cameras repository.CameraRepository, areas repository.AreaRepository) CameraService {
+	return &cameraService{cameras: cameras, areas: areas}
+}
+
+func (s *cameraService) List(ctx context.Context, opts repository.ListOptions) ([]models.Camera, int, error) {
+	cameras, err := s.cameras.List(ctx, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return cameras, listTotal(ctx, opts, len(cameras), s.cameras.Count), nil
+}
+
+func (s *cameraService) ListActive(ctx context.Context, opts repository.ListOptions) ([]models.PublicCamera, int, error) {
+	cameras, err := s.cameras.ListActive(ctx, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Only publish a map position when both coordinates are known
+	for i := range cameras {
+		if cameras[i].Latitude == nil || cameras[i].Longitude == nil {
+			cameras[i].Latitude = nil
+			cameras[i].Longitude = nil
+		}
+	}
+
+	return cameras, listTotal(ctx, opts, len(cameras), s.cameras.CountActive), nil
+}
+
+func (s *cameraService) Get(ctx context.Context, id int) (*models.Camera, error) {
+	return s.cameras.Get(ctx, id)
+}
+
+func (s *cameraService) Create(ctx context.Context, input CameraInput) (*models.Camera, error) {
+	if input.Name == "" {
+		return nil, invalidField("name", "Camera name is required")
+	}
+	if input.PrivateRTSPURL == "" {
+		return nil, invalidField("private_rtsp_url", "RTSP URL is required")
+	}
+
+	camera, err := s.build(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	camera.StreamKey = generateStreamKey(input.Name)
+
+	id, err := s.cameras.Create(ctx, camera)
+	if err != nil {
+		return nil, err
+	}
+	camera.ID = int(id)
+
+	return camera, nil
+}
+
+func (s *cameraService) Update(ctx context.Context, id int, input CameraInput) error {
+	camera, err := s.build(ctx, input)
+	if err != nil {
+		return err
+	}
+	camera.ID = id
+
+	return s.cameras.Update(ctx, camera)
+}
+
+func (s *cameraService) Delete(ctx context.Context, id int) error {
+	return s.cameras.Delete(ctx, id)
+}
+
+// Toggle flips the enabled flag and returns the new value
+func (s *cameraService) Toggle(ctx context.Context, id int) (bool, error) {
+	camera, err := s.cameras.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	enabled := !camera.Enabled
+	if err := s.cameras.SetEnabled(ctx, id, enabled); err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+// build validates coordinates and the area, and fills in the area from
+// the coordinates when the request did not pick one
+func (s *cameraService) build(ctx context.Context, input CameraInput) (*models.Camera, error) {
+	latitude, longitude := input.Latitude, input.Longitude
+
+	// Both must be present for either to be stored
+	if latitude == nil || longitude == nil {
+		latitude, longitude = nil, nil
+	} else if *latitude < -90 || *latitude > 90 || *longitude < -180 || *longitude > 180 {
+		return nil, invalid("Coordinates out of range")
+	}
+
+	areaID := input.AreaID
+	if areaID != nil && s.areas != nil {
+		// The foreign key would accept another organization's area
+		exists, err := s.areas.Exists(ctx, *areaID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, invalidField("area_id", "Area not found")
+		}
+	}
+	if areaID == nil && latitude != nil && s.areas != nil {
+		areaID, _ = s.areas.FindContaining(ctx, *latitude, *longitude)
+	}
+
+	return &models.Camera{
+		Name:           input.Name,
+		PrivateRTSPURL: input.PrivateRTSPURL,
+		Description:    input.Description,
+		Location:       input.Location,
+		GroupName:      input.GroupName,
+		AreaID:         areaID,
+		Latitude:       latitude,
+		Longitude:      longitude,
+		Enabled:        input.Enabled,
+		Traffic:        input.Traffic,
+		Watermark:      input.Watermark,
+		Recording:      input.Recording,
+		StreamNode:     input.StreamNode,
+	}, nil
+}
+
+// generateStreamKey derives a stream key from the camera name
+func generateStreamKey(name string) string {
+	// Simple implementation - in production use UUID or more sophisticated method
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return name + "-" + timestamp
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/repository"
+)
+
+// fakeCameraRepo keeps cameras in memory
+type fakeCameraRepo struct {
+	cameras map[int]*models.Camera
+	nextID  int
+	counted int
+}
+
+func newFakeCameraRepo(cameras ...models.Camera) *fakeCameraRepo {
+	repo := &fakeCameraRepo{cameras: map[int]*models.Camera{}, nextID: 1}
+	for i := range cameras {
+		camera := cameras[i]
+		repo.cameras[camera.ID] = &camera
+		if camera.ID >= repo.nextID {
+			repo.nextID = camera.ID + 1
+		}
+	}
+	return repo
+}
+
+func (r *fakeCameraRepo) List(ctx context.Context, opts repository.ListOptions) ([]models.Camera, error) {
+	cameras := []models.Camera{}
+	for id := 1; id < r.nextID; id++ {
+		if camera, ok := r.cameras[id]; ok {
+			cameras = append(cameras, *camera)
+		}
+	}
+	if opts.Paged() && len(cameras) > opts.Limit {
+		cameras = cameras[:opts.Limit]
+	}
+	return cameras, nil
+}
+
+func (r *fakeCameraRepo) Count(ctx context.Context) (int, error) {
+	r.counted++
+	return len(r.cameras), nil
+}
+
+func (r *fakeCameraRepo) ListActive(ctx context.Context, opts repository.ListOptions) ([]models.PublicCamera, error) {
+	cameras := []models.PublicCamera{}
+	for id := 1; id < r.nextID; id++ {
+		if camera, ok := r.cameras[id]; ok && camera.Enabled {
+			cameras = append(cameras, models.PublicCamera{
+				ID:        camera.ID,
+				Name:      camera.Name,
+				Latitude:  camera.Latitude,
+				Longitude: camera.Longitude,
+			})
+		}
+	}
+	return cameras, nil
+}
+
+func (r *fakeCameraRepo) CountActive(ctx context.Context) (int, error) {
+	cameras, _ := r.ListActive(ctx, repository.ListOptions{})
+	return len(cameras), nil
+}
+
+func (r *fakeCameraRepo) Get(ctx context.Context, id int) (*models.Camera, error) {
+	camera, ok := r.cameras[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *camera
+	return &copied, nil
+}
+
+func (r *fakeCameraRepo) Create(ctx context.Context, camera *models.Camera) (int64, error) {
+	camera.ID = r.nextID
+	r.nextID++
+	copied := *camera
+	r.cameras[camera.ID] = &copied
+	return int64(camera.ID), nil
+}
+
+func (r *fakeCameraRepo) Update(ctx context.Context, camera *models.Camera) error {
+	if _, ok := r.cameras[camera.ID]; !ok {
+		return repository.ErrNotFound
+	}
+	copied := *camera
+	r.cameras[camera.ID] = &copied
+	return nil
+}
+
+func (r *fakeCameraRepo) Delete(ctx context.Context, id int) error {
+	if _, ok := r.cameras[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.cameras, id)
+	return nil
+}
+
+func (r *fakeCameraRepo) SetEnabled(ctx context.Context, id int, enabled bool) error {
+	camera, ok := r.cameras[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	camera.Enabled = enabled
+	return nil
+}
+
+// fakeAreaRepo places every point in the same area. Every area exists
+// unless missing lists it.
+type fakeAreaRepo struct {
+	areaID  *int
+	missing []int
+}
+
+func (r *fakeAreaRepo) FindContaining(ctx context.Context, lat, lng float64) (*int, error) {
+	return r.areaID, nil
+}
+
+func (r *fakeAreaRepo) Exists(ctx context.Context, id int) (bool, error) {
+	for _, m := range r.missing {
+		if m == id {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestCameraService_Create(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Requires name and RTSP URL", func(t *testing.T) {
+		svc := NewCameraService(newFakeCameraRepo(), nil)
+
+		_, err := svc.Create(ctx, CameraInput{PrivateRTSPURL: "rtsp://cam"})
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) || invalid.Message != "Camera name is required" {
+			t.Errorf("Expected name validation error, got %v", err)
+		}
+
+		_, err = svc.Create(ctx, CameraInput{Name: "Gate"})
+		if !errors.As(err, &invalid) || invalid.Message != "RTSP URL is required" {
+			t.Errorf("Expected RTSP validation error, got %v", err)
+		}
+	})
+
+	t.Run("Generates stream key", func(t *testing.T) {
+		repo := newFakeCameraRepo()
+		svc := NewCameraService(repo, nil)
+
+		camera, err := svc.Create(ctx, CameraInput{Name: "Gate", PrivateRTSPURL: "rtsp://cam"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if camera.ID != 1 {
+			t.Errorf("Expected ID 1, got %d", camera.ID)
+		}
+		if camera.StreamKey == "" {
+			t.Error("Expected stream key to be generated")
+		}
+		if len(repo.cameras) != 1 {
+			t.Errorf("Expected 1 stored camera, got %d", len(repo.cameras))
+		}
+	})
+
+	t.Run("Rejects out of range coordinates", func(t *testing.T) {
+		svc := NewCameraService(newFakeCameraRepo(), nil)
+
+		_, err := svc.Create(ctx, CameraInput{
+			Name: "Gate", PrivateRTSPURL: "rtsp://cam",
+			Latitude: floatPtr(91), Longitude: floatPtr(106),
+		})
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			t.Errorf("Expected validation error, got %v", err)
+		}
+	})
+
+	t.Run("Drops a lone coordinate", func(t *testing.T) {
+		svc := NewCameraService(newFakeCameraRepo(), nil)
+
+		camera, err := svc.Create(ctx, CameraInput{
+			Name: "Gate", PrivateRTSPURL: "rtsp://cam", Latitude: floatPtr(-6.2),
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if camera.Latitude != nil {
+			t.Errorf("Expected latitude to be dropped, got %v", *camera.Latitude)
+		}
+	})
+
+	t.Run("Assigns area from coordinates", func(t *testing.T) {
+		svc := NewCameraService(newFakeCameraRepo(), &fakeAreaRepo{areaID: intPtr(7)})
+
+		camera, err := svc.Create(ctx, CameraInput{
+			Name: "Gate", PrivateRTSPURL: "rtsp://cam",
+			Latitude: floatPtr(-6.2), Longitude: floatPtr(106.8),
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if camera.AreaID == nil || *camera.AreaID != 7 {
+			t.Errorf("Expected area 7, got %v", camera.AreaID)
+		}
+	})
+
+	t.Run("Explicit area wins", func(t *testing.T) {
+		svc := NewCameraService(newFakeCameraRepo(), &fakeAreaRepo{areaID: intPtr(7)})
+
+		camera, err := svc.Create(ctx, CameraInput{
+			Name: "Gate", PrivateRTSPURL: "rtsp://cam", AreaID: intPtr(3),
+			Latitude: floatPtr(-6.2), Longitude: floatPtr(106.8),
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if camera.AreaID == nil || *camera.AreaID != 3 {
+			t.Errorf("Expected area 3, got %v", camera.AreaID)
+		}
+	})
+
+	t.Run("Area outside the organization", func(t *testing.T) {
+		svc := NewCameraService(newFakeCameraRepo(), &fakeAreaRepo{missing: []int{3}})
+
+		_, err := svc.Create(ctx, CameraInput{Name: "Gate", PrivateRTSPURL: "rtsp://cam", AreaID: intPtr(3)})
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) || invalid.Field != "area_id" {
+			t.Errorf("Expected an area_id validation error, got %v", err)
+		}
+	})
+}
+
+func TestCameraService_List(t *testing.T) {
+	ctx := context.Background()
+
+	repo := newFakeCameraRepo(
+		models.Camera{ID: 1, Name: "Gate", Enabled: true, Latitude: floatPtr(-6.2)},
+		models.Camera{ID: 2, Name: "Market", Enabled: false},
+		models.Camera{ID: 3, Name: "Park", Enabled: true},
+	)
+	svc := NewCameraService(repo, nil)
+
+	t.Run("Unpaged skips count", func(t *testing.T) {
+		cameras, total, err := svc.List(ctx, repository.ListOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(cameras) != 3 || total != 3 {
+			t.Errorf("Expected 3 cameras and total 3, got %d and %d", len(cameras), total)
+		}
+		if repo.counted != 0 {
+			t.Errorf("Expected no count query, got %d", repo.counted)
+		}
+	})
+
+	t.Run("Paged counts", func(t *testing.T) {
+		cameras, total, err := svc.List(ctx, repository.ListOptions{Limit: 2})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(cameras) != 2 || total != 3 {
+			t.Errorf("Expected 2 cameras and total 3, got %d and %d", len(cameras), total)
+		}
+	})
+
+	t.Run("Active hides partial coordinates", func(t *testing.T) {
+		cameras, total, err := svc.ListActive(ctx, repository.ListOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if total != 2 {
+			t.Errorf("Expected 2 active cameras, got %d", total)
+		}
+		if cameras[0].Latitude != nil {
+			t.Error("Expected latitude to be hidden without longitude")
+		}
+	})
+}
+
+func TestCameraService_Toggle(t *testing.T) {
+	ctx := context.Background()
+
+	repo := newFakeCameraRepo(models.Camera{ID: 1, Name: "Gate", Enabled: true})
+	svc := NewCameraService(repo, nil)
+
+	enabled, err := svc.Toggle(ctx, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if enabled {
+		t.Error("Expected camera to be disabled")
+	}
+	if repo.cameras[1].Enabled {
+		t.Error("Expected stored camera to be disabled")
+	}
+
+	if _, err := svc.Toggle(ctx, 99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Package service holds the business rules between handlers and
+// repositories: validation, defaults, and cross-entity lookups.
+package service
+
+import (
+	"context"
+
+	"github.com/abcdefak87/cctv/internal/repository"
+)
+
+// ErrNotFound is returned when the target entity does not exist
+var ErrNotFound = repository.ErrNotFound
+
+// ValidationError is a client error whose message is safe to show.
+// Field names the request field at fault, when there is one.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func invalid(message string) error {
+	return &ValidationError{Message: message}
+}
+
+func invalidField(field, message string) error {
+	return &ValidationError{Field: field, Message: message}
+}
+
+// listTotal returns the total for a list. Unpaged lists already hold
+// every row, so the count query is skipped.
+func listTotal(ctx context.Context, opts repository.ListOptions, fetched int, count func(context.Context) (int, error)) int {
+	if !opts.Paged() {
+		return fetched
+	}
+	total, err := count(ctx)
+	if err != nil {
+		return fetched
+	}
+	return total
+}
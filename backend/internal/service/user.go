@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidPassword is returned when the old password does not match
+var ErrInvalidPassword = errors.New("invalid old password")
+
+// UserInput is a create/update request. An empty Password on update
+// leaves the current password unchanged.
+type UserInput struct {
+	Username string
+	Email    string
+	Password string
+	Role     string
+
+	// Permissions replace the user's grants; see models.Permissions
+	Permissions []string
+}
+
+// UserService manages admin users
+type UserService interface {
+	List(ctx context.Context, opts repository.ListOptions) ([]models.User, int, error)
+	Get(ctx context.Context, id int) (*models.User, error)
+	Create(ctx context.Context, input UserInput) (int64, error)
+	Update(ctx context.Context, id int, input UserInput) error
+	Delete(ctx context.Context, id int) error
+	ChangePassword(ctx context.Context, id int, oldPassword, newPassword string) error
+	ResetPassword(ctx context.Context, username, newPassword string) error
+}
+
+type userService struct {
+	users repository.UserRepository
+}
+
+func NewUserService(users repository.UserRepository) UserService {
+	return &userService{users: users}
+}
+
+func (s *userService) List(ctx context.Context, opts repository.ListOptions) ([]models.User, int, error) {
+	users, err := s.users.List(ctx, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, listTotal(ctx, opts, len(users), s.users.Count), nil
+}
+
+func (s *userService) Get(ctx context.Context, id int) (*models.User, error) {
+	return s.users.Get(ctx, id)
+}
+
+func (s *userService) Create(ctx context.Context, input UserInput) (int64, error) {
+	if input.Username == "" {
+		return 0, invalidField("username", "Username is required")
+	}
+	if input.Password == "" {
+		return 0, invalidField("password", "Password is required")
+	}
+
+	if input.Role == "" {
+		input.Role = "user"
+	}
+	if err := checkPermissions(input.Permissions); err != nil {
+		return 0, err
+	}
+
+	exists, err := s.users.UsernameExists(ctx, input.Username)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, invalidField("username", "Username already exists")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.users.Create(ctx, &models.User{
+		Username:     input.Username,
+		Email:        input.Email,
+		PasswordHash: string(hash),
+		Role:         input.Role,
+		Permissions:  input.Permissions,
+	})
+}
+
+func (s *userService) Update(ctx context.Context, id int, input UserInput) error {
+	if err := checkPermissions(input.Permissions); err != nil {
+		return err
+	}
+	user := &models.User{
+		ID:          id,
+		Username:    input.Username,
+		Email:       input.Email,
+		Role:        input.Role,
+		Permissions: input.Permissions,
+	}
+
+	if input.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = string(hash)
+	}
+
+	return s.users.Update(ctx, user)
+}
+
+// Delete removes a user, refusing to remove the last admin
+func (s *userService) Delete(ctx context.Context, id int) error {
+	user, err := s.users.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if user.Role == "admin" {
+		admins, err := s.users.CountByRole(ctx, "admin")
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return invalid("Cannot delete the last admin user")
+		}
+	}
+
+	return s.users.Delete(ctx, id)
+}
+
+func (s *userService) ChangePassword(ctx context.Context, id int, oldPassword, newPassword string) error {
+	if oldPassword == "" || newPassword == "" {
+		return invalid("Old and new passwords are required")
+	}
+
+	current, err := s.users.PasswordHash(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(current), []byte(oldPassword)) != nil {
+		return ErrInvalidPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return s.users.SetPasswordHash(ctx, id, string(hash))
+}
+
+// ResetPassword sets a new password without checking the old one. It is
+// meant for operators locked out of the admin UI.
+func (s *userService) ResetPassword(ctx context.Context, username, newPassword string) error {
+	if username == "" || newPassword == "" {
+		return invalid("Username and new password are required")
+	}
+
+	id, err := s.users.IDByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return s.users.SetPasswordHash(ctx, id, string(hash))
+}
+
+// checkPermissions rejects permissions that do not exist, so a typo is
+// not silently stored as a grant nothing checks
+func checkPermissions(permissions []string) error {
+	for _, p := range permissions {
+		known := false
+		for _, k := range models.Permissions {
+			known = known || p == k
+		}
+		if !known {
+			return invalidField("permissions", "Unknown permission "+p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeUserRepo keeps users in memory
+type fakeUserRepo struct {
+	users  map[int]*models.User
+	nextID int
+}
+
+func newFakeUserRepo(users ...models.User) *fakeUserRepo {
+	repo := &fakeUserRepo{users: map[int]*models.User{}, nextID: 1}
+	for i := range users {
+		user := users[i]
+		repo.users[user.ID] = &user
+		if user.ID >= repo.nextID {
+			repo.nextID = user.ID + 1
+		}
+	}
+	return repo
+}
+
+func (r *fakeUserRepo) List(ctx context.Context, opts repository.ListOptions) ([]models.User, error) {
+	users := []models.User{}
+	for id := 1; id < r.nextID; id++ {
+		if user, ok := r.users[id]; ok {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) Count(ctx context.Context) (int, error) {
+	return len(r.users), nil
+}
+
+func (r *fakeUserRepo) Get(ctx context.Context, id int) (*models.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepo) UsernameExists(ctx context.Context, username string) (bool, error) {
+	for _, user := range r.users {
+		if user.Username == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeUserRepo) IDByUsername(ctx context.Context, username string) (int, error) {
+	for id, user := range r.users {
+		if user.Username == username {
+			return id, nil
+		}
+	}
+	return 0, repository.ErrNotFound
+}
+
+func (r *fakeUserRepo) CountByRole(ctx context.Context, role string) (int, error) {
+	count := 0
+	for _, user := range r.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeUserRepo) Create(ctx context.Context, user *models.User) (int64, error) {
+	user.ID = r.nextID
+	r.nextID++
+	copied := *user
+	r.users[user.ID] = &copied
+	return int64(user.ID), nil
+}
+
+func (r *fakeUserRepo) Update(ctx context.Context, user *models.User) error {
+	current, ok := r.users[user.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if user.PasswordHash == "" {
+		user.PasswordHash = current.PasswordHash
+	}
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *fakeUserRepo) Delete(ctx context.Context, id int) error {
+	if _, ok := r.users[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+func (r *fakeUserRepo) PasswordHash(ctx context.Context, id int) (string, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	return user.PasswordHash, nil
+}
+
+func (r *fakeUserRepo) SetPasswordHash(ctx context.Context, id int, hash string) error {
+	user, ok := r.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	user.PasswordHash = hash
+	return nil
+}
+
+func hashPassword(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	return string(hash)
+}
+
+func TestUserService_Create(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Requires username and password", func(t *testing.T) {
+		svc := NewUserService(newFakeUserRepo())
+
+		_, err := svc.Create(ctx, UserInput{Username: "operator"})
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			t.Errorf("Expected validation error, got %v", err)
+		}
+	})
+
+	t.Run("Defaults role and hashes password", func(t *testing.T) {
+		repo := newFakeUserRepo()
+		svc := NewUserService(repo)
+
+		id, err := svc.Create(ctx, UserInput{Username: "operator", Password: "secret123"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		user := repo.users[int(id)]
+		if user.Role != "user" {
+			t.Errorf("Expected role 'user', got '%s'", user.Role)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("secret123")) != nil {
+			t.Error("Expected stored password to be a bcrypt hash")
+		}
+	})
+
+	t.Run("Rejects duplicate username", func(t *testing.T) {
+		svc := NewUserService(newFakeUserRepo(models.User{ID: 1, Username: "admin", Role: "admin"}))
+
+		_, err := svc.Create(ctx, UserInput{Username: "admin", Password: "secret123"})
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) || invalid.Message != "Username already exists" {
+			t.Errorf("Expected duplicate username error, got %v", err)
+		}
+	})
+
+	t.Run("Rejects unknown permissions", func(t *testing.T) {
+		svc := NewUserService(newFakeUserRepo())
+
+		_, err := svc.Create(ctx, UserInput{Username: "operator", Password: "secret123", Permissions: []string{"anpr", "radar"}})
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) || invalid.Field != "permissions" {
+			t.Errorf("Expected a permissions error, got %v", err)
+		}
+	})
+}
+
+func TestUserService_Delete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Keeps the last admin", func(t *testing.T) {
+		svc := NewUserService(newFakeUserRepo(models.User{ID: 1, Username: "admin", Role: "admin"}))
+
+		var invalid *ValidationError
+		if err := svc.Delete(ctx, 1); !errors.As(err, &invalid) {
+			t.Errorf("Expected validation error, got %v", err)
+		}
+	})
+
+	t.Run("Deletes a second admin", func(t *testing.T) {
+		repo := newFakeUserRepo(
+			models.User{ID: 1, Username: "admin", Role: "admin"},
+			models.User{ID: 2, Username: "backup", Role: "admin"},
+		)
+		svc := NewUserService(repo)
+
+		if err := svc.Delete(ctx, 2); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(repo.users) != 1 {
+			t.Errorf("Expected 1 user left, got %d", len(repo.users))
+		}
+	})
+
+	t.Run("Missing user", func(t *testing.T) {
+		svc := NewUserService(newFakeUserRepo())
+
+		if err := svc.Delete(ctx, 5); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+
+	repo := newFakeUserRepo(models.User{
+		ID: 1, Username: "admin", Role: "admin", PasswordHash: hashPassword(t, "old-pass"),
+	})
+	svc := NewUserService(repo)
+
+	t.Run("Wrong old password", func(t *testing.T) {
+		if err := svc.ChangePassword(ctx, 1, "nope", "new-pass"); !errors.Is(err, ErrInvalidPassword) {
+			t.Errorf("Expected ErrInvalidPassword, got %v", err)
+		}
+	})
+
+	t.Run("Successful change", func(t *testing.T) {
+		if err := svc.ChangePassword(ctx, 1, "old-pass", "new-pass"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(repo.users[1].PasswordHash), []byte("new-pass")) != nil {
+			t.Error("Expected new password to be stored")
+		}
+	})
+}
+
+func TestUserService_ResetPassword(t *testing.T) {
+	ctx := context.Background()
+
+	repo := newFakeUserRepo(models.User{
+		ID: 1, Username: "admin", Role: "admin", PasswordHash: hashPassword(t, "forgotten"),
+	})
+	svc := NewUserService(repo)
+
+	t.Run("Unknown user", func(t *testing.T) {
+		if err := svc.ResetPassword(ctx, "ghost", "new-pass"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Requires a password", func(t *testing.T) {
+		var invalid *ValidationError
+		if err := svc.ResetPassword(ctx, "admin", ""); !errors.As(err, &invalid) {
+			t.Errorf("Expected validation error, got %v", err)
+		}
+	})
+
+	t.Run("Successful reset", func(t *testing.T) {
+		if err := svc.ResetPassword(ctx, "admin", "new-pass"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(repo.users[1].PasswordHash), []byte("new-pass")) != nil {
+			t.Error("Expected new password to be stored")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Coordinator owns the process lifetime. Background workers and
+// long-lived requests watch Context, which is cancelled as soon as
+// shutdown starts; hooks then run in registration order, sharing one
+// drain deadline.
+type Coordinator struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	workers sync.WaitGroup
+
+	mu    sync.Mutex
+	hooks []hook
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// New creates a coordinator whose hooks must finish within timeout
+func New(timeout time.Duration) *Coordinator {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Coordinator{ctx: ctx, cancel: cancel, timeout: timeout}
+}
+
+// Context is cancelled when shutdown begins
+func (c *Coordinator) Context() context.Context {
+	return c.ctx
+}
+
+// Go runs a background worker. fn must return once ctx is cancelled;
+// Wait blocks until it has.
+func (c *Coordinator) Go(name string, fn func(ctx context.Context)) {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		fn(c.ctx)
+		logger.Debug("Worker stopped", "worker", name)
+	}()
+}
+
+// Wait blocks until every worker started with Go has returned or ctx
+// expires. Register it as a hook to order it against other steps.
+func (c *Coordinator) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers still running: %w", ctx.Err())
+	}
+}
+
+// OnShutdown registers a step to run during shutdown
+func (c *Coordinator) OnShutdown(name string, fn func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, hook{name: name, fn: fn})
+}
+
+// Shutdown cancels Context and runs the hooks in order. A failing hook
+// does not stop the ones after it; all errors are returned together.
+func (c *Coordinator) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	c.cancel()
+
+	c.mu.Lock()
+	hooks := append([]hook(nil), c.hooks...)
+	c.mu.Unlock()
+
+	var errs []error
+	for _, h := range hooks {
+		start := time.Now()
+		if err := h.fn(ctx); err != nil {
+			logger.Error("Shutdown step failed", "step", h.name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		logger.Info("Shutdown step finished", "step", h.name, "duration_ms", time.Since(start).Milliseconds())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,80 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	t.Run("Stops workers and runs hooks in order", func(t *testing.T) {
+		c := New(time.Second)
+
+		var order []string
+		stopped := false
+		c.Go("ticker", func(ctx context.Context) {
+			<-ctx.Done()
+			stopped = true
+		})
+
+		c.OnShutdown("server", func(ctx context.Context) error {
+			order = append(order, "server")
+			return nil
+		})
+		c.OnShutdown("workers", c.Wait)
+		c.OnShutdown("database", func(ctx context.Context) error {
+			if !stopped {
+				t.Error("Expected workers to stop before the database closes")
+			}
+			order = append(order, "database")
+			return nil
+		})
+
+		if err := c.Shutdown(); err != nil {
+			t.Fatalf("Expected clean shutdown, got %v", err)
+		}
+		if len(order) != 2 || order[0] != "server" || order[1] != "database" {
+			t.Errorf("Expected [server database], got %v", order)
+		}
+		if c.Context().Err() == nil {
+			t.Error("Expected context to be cancelled")
+		}
+	})
+
+	t.Run("Stuck worker hits the drain timeout", func(t *testing.T) {
+		c := New(20 * time.Millisecond)
+		release := make(chan struct{})
+		defer close(release)
+
+		c.Go("stuck", func(ctx context.Context) {
+			<-release
+		})
+		c.OnShutdown("workers", c.Wait)
+
+		err := c.Shutdown()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, got %v", err)
+		}
+	})
+
+	t.Run("Failing hook does not skip later hooks", func(t *testing.T) {
+		c := New(time.Second)
+		ran := false
+
+		c.OnShutdown("broken", func(ctx context.Context) error {
+			return errors.New("boom")
+		})
+		c.OnShutdown("after", func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+
+		if err := c.Shutdown(); err == nil {
+			t.Error("Expected error from broken hook")
+		}
+		if !ran {
+			t.Error("Expected later hook to run")
+		}
+	})
+}
@@ -0,0 +1,46 @@
+// Package snapshot fetches still frames of a stream from go2rtc, for the
+// motion detector and object detection.
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxSize bounds a frame read into memory; a 4K JPEG is a few MB
+const maxSize = 20 << 20
+
+// URL is go2rtc's JPEG frame endpoint for a stream
+func URL(apiURL, streamKey string) string {
+	return strings.TrimRight(apiURL, "/") + "/api/frame.jpeg?src=" + url.QueryEscape(streamKey)
+}
+
+// Fetch returns the current frame of a stream as JPEG, asking the go2rtc
+// at apiURL through client
+func Fetch(ctx context.Context, client *http.Client, apiURL, streamKey string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL(apiURL, streamKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("go2rtc returned %s", resp.Status)
+	}
+	frame, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(frame) > maxSize {
+		return nil, fmt.Errorf("frame larger than %d bytes", maxSize)
+	}
+	return frame, nil
+}
@@ -0,0 +1,191 @@
+// Package startlatency measures how long streams take to start: the time
+// from asking go2rtc for a camera's stream to its first byte. A camera
+// whose starts slow down usually has an uplink about to fail, well
+// before it drops offline.
+//
+// Each instance keeps the latest starts of every camera in memory and
+// reports percentiles over them, in camera health and as Prometheus
+// metrics; Watcher alerts when a camera's p95 goes over a threshold.
+package startlatency
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// window is how many of a camera's latest starts are kept
+	window = 100
+
+	// maxAge drops starts older than this from the percentiles, so a
+	// camera nobody watches stops reporting an old slowdown
+	maxAge = time.Hour
+)
+
+// Stats are the percentiles of a camera's recent stream starts
+type Stats struct {
+	Samples int       `json:"samples"`
+	P50Ms   int64     `json:"p50_ms"`
+	P95Ms   int64     `json:"p95_ms"`
+	P99Ms   int64     `json:"p99_ms"`
+	LastMs  int64     `json:"last_ms"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+type sample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// series is a camera's latest starts, oldest first, and its totals
+// since the process started
+type series struct {
+	samples []sample
+	count   uint64
+	sum     time.Duration
+}
+
+// Tracker records stream starts; it is safe for concurrent use
+type Tracker struct {
+	mu      sync.Mutex
+	cameras map[int]*series
+	now     func() time.Time
+}
+
+func New() *Tracker {
+	return &Tracker{cameras: map[int]*series{}, now: time.Now}
+}
+
+var shared = New()
+
+// Shared returns the process-wide tracker the stream proxy records to
+func Shared() *Tracker {
+	return shared
+}
+
+// Record adds a stream start of cameraID that took d
+func (t *Tracker) Record(cameraID int, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.cameras[cameraID]
+	if s == nil {
+		s = &series{}
+		t.cameras[cameraID] = s
+	}
+	if len(s.samples) == window {
+		s.samples = append(s.samples[:0], s.samples[1:]...)
+	}
+	s.samples = append(s.samples, sample{at: t.now(), d: d})
+	s.count++
+	s.sum += d
+}
+
+// Stats returns the percentiles of cameraID's starts in the last hour;
+// ok is false when there were none
+func (t *Tracker) Stats(cameraID int) (stats Stats, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.cameras[cameraID]
+	if s == nil {
+		return Stats{}, false
+	}
+	return s.stats(t.now())
+}
+
+// All returns the percentiles of every camera with starts in the last
+// hour
+func (t *Tracker) All() map[int]Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	all := make(map[int]Stats, len(t.cameras))
+	for id, s := range t.cameras {
+		if stats, ok := s.stats(now); ok {
+			all[id] = stats
+		}
+	}
+	return all
+}
+
+func (s *series) stats(now time.Time) (Stats, bool) {
+	var recent []time.Duration
+	for _, smp := range s.samples {
+		if now.Sub(smp.at) <= maxAge {
+			recent = append(recent, smp.d)
+		}
+	}
+	if len(recent) == 0 {
+		return Stats{}, false
+	}
+	last := s.samples[len(s.samples)-1]
+	sort.Slice(recent, func(i, j int) bool { return recent[i] < recent[j] })
+	return Stats{
+		Samples: len(recent),
+		P50Ms:   percentile(recent, 50).Milliseconds(),
+		P95Ms:   percentile(recent, 95).Milliseconds(),
+		P99Ms:   percentile(recent, 99).Milliseconds(),
+		LastMs:  last.d.Milliseconds(),
+		LastAt:  last.at.UTC(),
+	}, true
+}
+
+// percentile is the nearest-rank percentile p of sorted
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// WritePrometheus writes the starts of every camera as the summary
+// cctv_stream_start_seconds in the Prometheus text format. The
+// quantiles cover the last hour; _sum and _count every start since the
+// process started.
+func (t *Tracker) WritePrometheus(w io.Writer) error {
+	t.mu.Lock()
+	now := t.now()
+	type row struct {
+		id    int
+		stats Stats
+		ok    bool
+		count uint64
+		sum   time.Duration
+	}
+	rows := make([]row, 0, len(t.cameras))
+	for id, s := range t.cameras {
+		stats, ok := s.stats(now)
+		rows = append(rows, row{id, stats, ok, s.count, s.sum})
+	}
+	t.mu.Unlock()
+	sort.Slice(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+
+	if _, err := io.WriteString(w, "# HELP cctv_stream_start_seconds Time from a stream start to go2rtc's first byte.\n"+
+		"# TYPE cctv_stream_start_seconds summary\n"); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if r.ok {
+			for _, q := range []struct {
+				label string
+				ms    int64
+			}{{"0.5", r.stats.P50Ms}, {"0.95", r.stats.P95Ms}, {"0.99", r.stats.P99Ms}} {
+				if _, err := fmt.Fprintf(w, "cctv_stream_start_seconds{camera_id=\"%d\",quantile=\"%s\"} %g\n",
+					r.id, q.label, float64(q.ms)/1000); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := fmt.Fprintf(w, "cctv_stream_start_seconds_sum{camera_id=\"%d\"} %g\ncctv_stream_start_seconds_count{camera_id=\"%d\"} %d\n",
+			r.id, r.sum.Seconds(), r.id, r.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package startlatency
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/events"
+)
+
+// newTracker returns a tracker whose clock the test moves
+func newTracker() (*Tracker, *time.Time) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	t := New()
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+func TestStats(t *testing.T) {
+	tracker, now := newTracker()
+	if _, ok := tracker.Stats(1); ok {
+		t.Fatal("Expected no stats before any start")
+	}
+
+	for ms := 1; ms <= 100; ms++ {
+		tracker.Record(1, time.Duration(ms*10)*time.Millisecond)
+	}
+	s, _ := tracker.Stats(1)
+	if s.Samples != 100 || s.P50Ms != 500 || s.P95Ms != 950 || s.P99Ms != 990 || s.LastMs != 1000 {
+		t.Errorf("Expected the percentiles of 10ms to 1s, got %+v", s)
+	}
+
+	// The window keeps the latest starts only
+	for i := 0; i < 50; i++ {
+		tracker.Record(1, 5*time.Second)
+	}
+	if s, _ := tracker.Stats(1); s.Samples != 100 || s.P50Ms != 1000 || s.P95Ms != 5000 {
+		t.Errorf("Expected the slow starts to push out the old ones, got %+v", s)
+	}
+
+	// Starts older than an hour are left out
+	*now = now.Add(30 * time.Minute)
+	tracker.Record(1, 100*time.Millisecond)
+	*now = now.Add(45 * time.Minute)
+	if s, _ := tracker.Stats(1); s.Samples != 1 || s.P95Ms != 100 {
+		t.Errorf("Expected only the start of the last hour, got %+v", s)
+	}
+	*now = now.Add(time.Hour)
+	if all := tracker.All(); len(all) != 0 {
+		t.Errorf("Expected no camera with recent starts, got %v", all)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	tracker, now := newTracker()
+	tracker.Record(2, 1500*time.Millisecond)
+	tracker.Record(1, 250*time.Millisecond)
+	tracker.Record(1, 750*time.Millisecond)
+	tracker.Record(3, time.Second)
+	*now = now.Add(2 * time.Hour)
+	tracker.Record(2, 500*time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := tracker.WritePrometheus(&buf); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	want := `# HELP cctv_stream_start_seconds Time from a stream start to go2rtc's first byte.
+# TYPE cctv_stream_start_seconds summary
+cctv_stream_start_seconds_sum{camera_id="1"} 1
+cctv_stream_start_seconds_count{camera_id="1"} 2
+cctv_stream_start_seconds{camera_id="2",quantile="0.5"} 0.5
+cctv_stream_start_seconds{camera_id="2",quantile="0.95"} 0.5
+cctv_stream_start_seconds{camera_id="2",quantile="0.99"} 0.5
+cctv_stream_start_seconds_sum{camera_id="2"} 2
+cctv_stream_start_seconds_count{camera_id="2"} 2
+cctv_stream_start_seconds_sum{camera_id="3"} 1
+cctv_stream_start_seconds_count{camera_id="3"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Unexpected metrics:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	db := dbtest.Open(t)
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	published := make(chan events.Event, 4)
+	events.Subscribe("stream.start_*", "test", func(e events.Event) { published <- e })
+
+	tracker, _ := newTracker()
+	w := NewWatcher(db, tracker, WatchOptions{Threshold: 2 * time.Second, MinSamples: 3})
+	next := func() *events.Event {
+		t.Helper()
+		w.check(context.Background())
+		select {
+		case e := <-published:
+			return &e
+		case <-time.After(100 * time.Millisecond):
+			return nil
+		}
+	}
+
+	tracker.Record(1, 3*time.Second)
+	tracker.Record(1, 3*time.Second)
+	if e := next(); e != nil {
+		t.Fatalf("Expected no alert before enough starts, got %v", e)
+	}
+
+	tracker.Record(1, 3*time.Second)
+	e := next()
+	if e == nil || e.Type != events.StreamStartSlow || e.Data["camera"] != "Gate" || e.Data["p95_ms"] != int64(3000) {
+		t.Fatalf("Expected the camera reported slow, got %v", e)
+	}
+	if e := next(); e != nil {
+		t.Fatalf("Expected one alert while it stays slow, got %v", e)
+	}
+
+	for i := 0; i < 100; i++ {
+		tracker.Record(1, time.Second)
+	}
+	if e := next(); e == nil || e.Type != events.StreamStartRecovered {
+		t.Fatalf("Expected the camera reported recovered, got %v", e)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3}
+	for p, want := range map[int]time.Duration{0: 1, 33: 1, 34: 2, 50: 2, 95: 3, 100: 3} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%d: expected %d, got %d", p, want, got)
+		}
+	}
+}
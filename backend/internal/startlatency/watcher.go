@@ -0,0 +1,102 @@
+package startlatency
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// checkInterval is how often Watcher compares the percentiles with the
+// threshold
+const checkInterval = time.Minute
+
+// recoverRatio is how far under the threshold a slow camera's p95 must
+// fall before it counts as recovered, so one hovering around the
+// threshold is not reported on every check
+const recoverRatio = 0.8
+
+// WatchOptions configure a Watcher
+type WatchOptions struct {
+	Threshold  time.Duration // p95 over which a camera is slow
+	MinSamples int           // starts in the last hour before judging a camera
+}
+
+// Watcher publishes events.StreamStartSlow when a camera's p95 start
+// latency goes over the threshold, and events.StreamStartRecovered once
+// it is back well under
+type Watcher struct {
+	db      *sql.DB
+	tracker *Tracker
+	opts    WatchOptions
+	slow    map[int]bool
+	now     func() time.Time
+}
+
+func NewWatcher(db *sql.DB, tracker *Tracker, opts WatchOptions) *Watcher {
+	return &Watcher{db: db, tracker: tracker, opts: opts, slow: map[int]bool{}, now: time.Now}
+}
+
+// Run checks every minute until ctx is cancelled. Every instance runs
+// its own, since each one sees only the streams it proxies.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.check(ctx)
+	}
+}
+
+func (w *Watcher) check(ctx context.Context) {
+	all := w.tracker.All()
+	for id := range w.slow {
+		if _, ok := all[id]; !ok {
+			// No starts in the last hour; nothing left to judge it by
+			delete(w.slow, id)
+		}
+	}
+
+	for id, s := range all {
+		p95 := time.Duration(s.P95Ms) * time.Millisecond
+		switch {
+		case !w.slow[id] && s.Samples >= w.opts.MinSamples && p95 > w.opts.Threshold:
+			w.slow[id] = true
+			logger.Warn("Stream starts are slow", "camera_id", id, "p95_ms", s.P95Ms, "samples", s.Samples)
+			w.publish(ctx, events.StreamStartSlow, id, s)
+		case w.slow[id] && float64(p95) <= float64(w.opts.Threshold)*recoverRatio:
+			delete(w.slow, id)
+			logger.Info("Stream starts are fast again", "camera_id", id, "p95_ms", s.P95Ms)
+			w.publish(ctx, events.StreamStartRecovered, id, s)
+		}
+	}
+}
+
+func (w *Watcher) publish(ctx context.Context, eventType string, cameraID int, s Stats) {
+	var name string
+	if err := w.db.QueryRowContext(ctx, `SELECT name FROM cameras WHERE id = ?`, cameraID).Scan(&name); err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Failed to look up camera", "camera_id", cameraID, "error", err)
+		}
+		return
+	}
+	events.Publish(events.Event{
+		Type:     eventType,
+		Time:     w.now().UTC(),
+		Resource: "camera",
+		Data: map[string]interface{}{
+			"camera_id":    cameraID,
+			"camera":       name,
+			"p95_ms":       s.P95Ms,
+			"threshold_ms": w.opts.Threshold.Milliseconds(),
+			"samples":      s.Samples,
+		},
+	})
+}
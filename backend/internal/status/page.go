@@ -0,0 +1,96 @@
+package status
+
+import (
+	"html/template"
+	"io"
+	"strconv"
+)
+
+// pageData is what the HTML page renders
+type pageData struct {
+	Title string
+	Report
+}
+
+var page = template.Must(template.New("status").Funcs(template.FuncMap{
+	"pct": func(p *float64) string {
+		if p == nil {
+			return "no data"
+		}
+		return strconv.FormatFloat(*p, 'f', -1, 64) + "%"
+	},
+	"level": func(p *float64) string {
+		switch {
+		case p == nil:
+			return "none"
+		case *p >= 99:
+			return "up"
+		case *p >= 90:
+			return "degraded"
+		default:
+			return "down"
+		}
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - Status</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 960px; margin: 2rem auto; padding: 0 1rem; color: #1f2937; }
+h1 { font-size: 1.5rem; }
+h2 { font-size: 1.1rem; margin-top: 2rem; }
+h3 { font-size: 1rem; margin-bottom: .25rem; }
+.incident { border-left: 3px solid #d97706; padding-left: .75rem; margin-bottom: 1rem; }
+.banner { padding: 1rem; border-radius: .5rem; color: #fff; font-weight: 600; }
+.operational { background: #16a34a; } .partial_outage { background: #d97706; } .major_outage { background: #dc2626; }
+table { width: 100%; border-collapse: collapse; }
+th, td { text-align: left; padding: .4rem; border-bottom: 1px solid #e5e7eb; }
+.bars { display: flex; gap: 1px; height: 2rem; }
+.bars span { flex: 1; border-radius: 1px; }
+.up { background: #16a34a; } .degraded { background: #d97706; } .down { background: #dc2626; } .none { background: #e5e7eb; }
+.muted { color: #6b7280; font-size: .875rem; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="banner {{.Status}}">
+{{if eq .Status "operational"}}All cameras are online{{else if eq .Status "major_outage"}}All cameras are offline{{else}}Some cameras are offline{{end}}
+({{.Cameras.Online}} of {{.Cameras.Total}} online)
+</div>
+
+<h2>Areas</h2>
+<table>
+<tr><th>Area</th><th>Online</th><th>Offline</th></tr>
+{{range .Areas}}<tr><td>{{.Name}}</td><td>{{.Online}}</td><td>{{.Offline}}</td></tr>
+{{else}}<tr><td colspan="3" class="muted">No cameras</td></tr>
+{{end}}</table>
+
+<h2>Incidents</h2>
+{{range .Incidents}}<div class="incident">
+<h3>{{.Title}} <span class="muted">{{.Status}}, {{.Severity}}</span></h3>
+{{with .Cameras}}<p class="muted">Affects {{range $i, $c := .}}{{if $i}}, {{end}}{{$c}}{{end}}</p>{{end}}
+{{range .Updates}}<p><span class="muted">{{.CreatedAt.Format "2006-01-02 15:04 MST"}}{{with .Status}} - {{.}}{{end}}</span>{{with .Body}}<br>{{.}}{{end}}</p>
+{{end}}</div>
+{{else}}<p class="muted">No incidents reported</p>
+{{end}}
+<h2>Cameras offline</h2>
+{{if .Outages}}<table>
+<tr><th>Camera</th><th>Area</th><th>Offline since</th></tr>
+{{range .Outages}}<tr><td>{{.Camera}}</td><td>{{with .Area}}{{.}}{{end}}</td><td>{{with .Since}}{{.Format "2006-01-02 15:04 MST"}}{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p class="muted">No cameras offline</p>{{end}}
+
+<h2>Uptime, last 90 days: {{pct .Uptime.Percent}}</h2>
+<div class="bars">{{range .Uptime.Days}}<span class="{{level .Percent}}" title="{{.Date}}: {{pct .Percent}}"></span>{{end}}</div>
+
+<p class="muted">Updated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}</p>
+</body>
+</html>
+`))
+
+// Render writes r as an HTML page headed by title
+func Render(w io.Writer, title string, r Report) error {
+	return page.Execute(w, pageData{Title: title, Report: r})
+}
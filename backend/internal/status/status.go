@@ -0,0 +1,286 @@
+// Package status builds the public status page of the camera network:
+// how many enabled cameras are up in each area, the cameras that are
+// down now, published incidents, and daily uptime over the last 90
+// days. A camera is up unless its last health check (camera_health)
+// found it offline. The Sampler records that every few minutes into
+// camera_uptime, which is where uptime comes from; when a camera went
+// down comes from its outage timeline (internal/outages).
+package status
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/incidents"
+	"github.com/abcdefak87/cctv/internal/outages"
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// HistoryDays is how far back uptime is reported and kept
+const HistoryDays = 90
+
+// SampleInterval is how often the Sampler records which cameras are up
+const SampleInterval = 5 * time.Minute
+
+// dayLayout is the format of camera_uptime.day
+const dayLayout = "2006-01-02"
+
+// Overall states of the network
+const (
+	Operational   = "operational"    // every camera is up
+	PartialOutage = "partial_outage" // some cameras are down
+	MajorOutage   = "major_outage"   // every camera is down
+)
+
+// Report is the public status of one organization's cameras
+type Report struct {
+	Status      string                     `json:"status"`
+	Cameras     Counts                     `json:"cameras"`
+	Areas       []AreaStatus               `json:"areas"`
+	Outages     []Outage                   `json:"outages"`
+	Incidents   []incidents.PublicIncident `json:"incidents"`
+	Uptime      Uptime                     `json:"uptime"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+}
+
+// Counts are enabled cameras by state; disabled cameras are left out, as
+// they are on the public map
+type Counts struct {
+	Total   int `json:"total"`
+	Online  int `json:"online"`
+	Offline int `json:"offline"`
+}
+
+// AreaStatus counts the cameras of one area. ID is nil for cameras
+// without an area.
+type AreaStatus struct {
+	ID   *int   `json:"id"`
+	Name string `json:"name"`
+	Counts
+}
+
+// Outage is an enabled camera that is down now
+type Outage struct {
+	CameraID int        `json:"camera_id"`
+	Camera   string     `json:"camera"`
+	Area     *string    `json:"area"`
+	Since    *time.Time `json:"since"` // when its outage began
+}
+
+// Uptime is the share of samples that found cameras up, in percent.
+// Percent is nil when nothing was sampled.
+type Uptime struct {
+	Percent *float64 `json:"percent"`
+	Days    []Day    `json:"days"` // oldest first, today last
+}
+
+// Day is the uptime of one UTC day
+type Day struct {
+	Date    string   `json:"date"`
+	Percent *float64 `json:"percent"`
+}
+
+// Build reports on the cameras of the organization in ctx
+func Build(ctx context.Context, db *sql.DB, now time.Time) (Report, error) {
+	orgID := tenant.OrgID(ctx)
+	r := Report{Areas: []AreaStatus{}, Outages: []Outage{}, GeneratedAt: now.UTC()}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.area_id, a.name,
+		       SUM(CASE WHEN h.status = 'offline' THEN 0 ELSE 1 END),
+		       SUM(CASE WHEN h.status = 'offline' THEN 1 ELSE 0 END)
+		FROM cameras c
+		LEFT JOIN areas a ON a.id = c.area_id
+		LEFT JOIN camera_health h ON h.camera_id = c.id
+		WHERE c.enabled = TRUE AND c.organization_id = ?
+		GROUP BY c.area_id, a.name
+		ORDER BY c.area_id IS NULL, a.name ASC
+	`, orgID)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var area AreaStatus
+		var name sql.NullString
+		if err := rows.Scan(&area.ID, &name, &area.Online, &area.Offline); err != nil {
+			return r, err
+		}
+		area.Name = name.String
+		if area.ID == nil {
+			area.Name = "Other"
+		}
+		area.Total = area.Online + area.Offline
+		r.Areas = append(r.Areas, area)
+
+		r.Cameras.Online += area.Online
+		r.Cameras.Offline += area.Offline
+	}
+	if err := rows.Err(); err != nil {
+		return r, err
+	}
+	r.Cameras.Total = r.Cameras.Online + r.Cameras.Offline
+
+	switch {
+	case r.Cameras.Offline == 0:
+		r.Status = Operational
+	case r.Cameras.Online == 0:
+		r.Status = MajorOutage
+	default:
+		r.Status = PartialOutage
+	}
+
+	if r.Outages, err = down(ctx, db, orgID); err != nil {
+		return r, err
+	}
+	if r.Incidents, err = incidents.Published(ctx, db, now); err != nil {
+		return r, err
+	}
+	if r.Uptime, err = uptime(ctx, db, orgID, now); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// down lists the enabled cameras offline now
+func down(ctx context.Context, db *sql.DB, orgID int) ([]Outage, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.id, c.name, a.name, o.started_at, h.updated_at
+		FROM cameras c
+		JOIN camera_health h ON h.camera_id = c.id
+		LEFT JOIN outages o ON o.camera_id = c.id AND o.ended_at IS NULL
+		LEFT JOIN areas a ON a.id = c.area_id
+		WHERE c.enabled = TRUE AND c.organization_id = ? AND h.status = 'offline'
+		ORDER BY c.id ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Outage{}
+	for rows.Next() {
+		var o Outage
+		var started, updated sql.NullTime
+		if err := rows.Scan(&o.CameraID, &o.Camera, &o.Area, &started, &updated); err != nil {
+			return nil, err
+		}
+		switch {
+		case started.Valid:
+			o.Since = &started.Time
+		case updated.Valid:
+			o.Since = &updated.Time
+		}
+		list = append(list, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Down longest first
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Since != nil && (list[j].Since == nil || list[i].Since.Before(*list[j].Since))
+	})
+	return list, nil
+}
+
+func uptime(ctx context.Context, db *sql.DB, orgID int, now time.Time) (Uptime, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	first := today.AddDate(0, 0, -(HistoryDays - 1))
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.day, SUM(u.samples), SUM(u.online_samples)
+		FROM camera_uptime u
+		JOIN cameras c ON c.id = u.camera_id
+		WHERE c.organization_id = ? AND u.day >= ?
+		GROUP BY u.day
+	`, orgID, first.Format(dayLayout))
+	if err != nil {
+		return Uptime{}, err
+	}
+	defer rows.Close()
+
+	type counts struct{ samples, online int }
+	byDay := map[string]counts{}
+	var total counts
+	for rows.Next() {
+		var day string
+		var c counts
+		if err := rows.Scan(&day, &c.samples, &c.online); err != nil {
+			return Uptime{}, err
+		}
+		byDay[day] = c
+		total.samples += c.samples
+		total.online += c.online
+	}
+	if err := rows.Err(); err != nil {
+		return Uptime{}, err
+	}
+
+	u := Uptime{Percent: percent(total.online, total.samples), Days: make([]Day, 0, HistoryDays)}
+	for d := first; !d.After(today); d = d.AddDate(0, 0, 1) {
+		date := d.Format(dayLayout)
+		c := byDay[date]
+		u.Days = append(u.Days, Day{Date: date, Percent: percent(c.online, c.samples)})
+	}
+	return u, nil
+}
+
+// percent is part of whole to two decimals, or nil when whole is 0
+func percent(part, whole int) *float64 {
+	if whole == 0 {
+		return nil
+	}
+	p := math.Round(float64(part)/float64(whole)*10000) / 100
+	return &p
+}
+
+// Sample adds one sample for every enabled camera, in every
+// organization, to today's uptime and deletes days, and outages, past
+// HistoryDays
+func Sample(ctx context.Context, db *sql.DB, now time.Time) error {
+	now = now.UTC()
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO camera_uptime (camera_id, day, samples, online_samples)
+		SELECT c.id, ?, 1, CASE WHEN h.status = 'offline' THEN 0 ELSE 1 END
+		FROM cameras c
+		LEFT JOIN camera_health h ON h.camera_id = c.id
+		WHERE c.enabled = TRUE
+		ON CONFLICT (camera_id, day) DO UPDATE
+		SET samples = camera_uptime.samples + 1,
+		    online_samples = camera_uptime.online_samples + excluded.online_samples
+	`, now.Format(dayLayout))
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Truncate(24*time.Hour).AddDate(0, 0, -(HistoryDays - 1))
+	if _, err := db.ExecContext(ctx, `DELETE FROM camera_uptime WHERE day < ?`, cutoff.Format(dayLayout)); err != nil {
+		return err
+	}
+	return outages.Prune(ctx, db, cutoff)
+}
+
+// Sampler calls Sample every SampleInterval until ctx is cancelled.
+// Start it with shutdown.Coordinator.Go.
+func Sampler(db *sql.DB) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(SampleInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := Sample(ctx, db, time.Now()); err != nil && ctx.Err() == nil {
+				logger.Error("Failed to sample camera uptime", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/outages"
+	"github.com/abcdefak87/cctv/internal/tenant"
+)
+
+func TestStatus(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	for _, stmt := range []string{
+		`INSERT INTO organizations (id, name, slug) VALUES (2, 'Dander', 'dander')`,
+		`INSERT INTO areas (id, name) VALUES (1, 'RT 01'), (2, 'RT 02')`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, area_id, enabled) VALUES
+			(1, 'Gate', 'rtsp://a', 1, TRUE),
+			(2, 'Market', 'rtsp://b', 1, TRUE),
+			(3, 'Mosque', 'rtsp://c', 2, TRUE),
+			(4, 'Field', 'rtsp://d', NULL, TRUE),
+			(5, 'Spare', 'rtsp://e', 2, FALSE)`,
+		`INSERT INTO cameras (id, name, private_rtsp_url, enabled, organization_id) VALUES (6, 'Elsewhere', 'rtsp://f', TRUE, 2)`,
+		`INSERT INTO camera_health (camera_id, status) VALUES (1, 'online'), (2, 'offline'), (5, 'offline'), (6, 'offline')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+	if err := outages.Record(ctx, db, 1, false, "tcp: connection refused", now.AddDate(0, 0, -101)); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	outages.Record(ctx, db, 1, true, "", now.AddDate(0, 0, -100))
+	outages.Record(ctx, db, 2, false, "rtsp: 401 Unauthorized", now.Add(-3*time.Hour))
+
+	t.Run("Sample", func(t *testing.T) {
+		for _, at := range []time.Time{now.AddDate(0, 0, -100), now.AddDate(0, 0, -1), now, now} {
+			if err := Sample(ctx, db, at); err != nil {
+				t.Fatalf("Sample failed: %v", err)
+			}
+		}
+		var samples, online int
+		db.QueryRow(`SELECT samples, online_samples FROM camera_uptime WHERE camera_id = 2 AND day = '2026-03-10'`).Scan(&samples, &online)
+		if samples != 2 || online != 0 {
+			t.Errorf("Expected 2 samples, none online, got %d and %d", samples, online)
+		}
+		var old, disabled int
+		db.QueryRow(`SELECT COUNT(*) FROM camera_uptime WHERE day < '2026-01-01'`).Scan(&old)
+		db.QueryRow(`SELECT COUNT(*) FROM camera_uptime WHERE camera_id = 5`).Scan(&disabled)
+		if old != 0 || disabled != 0 {
+			t.Errorf("Expected old days and disabled cameras left out, got %d and %d", old, disabled)
+		}
+		var oldOutages int
+		db.QueryRow(`SELECT COUNT(*) FROM outages WHERE camera_id = 1`).Scan(&oldOutages)
+		if oldOutages != 0 {
+			t.Errorf("Expected outages past %d days deleted, got %d", HistoryDays, oldOutages)
+		}
+	})
+
+	r, err := Build(ctx, db, now)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	t.Run("Counts", func(t *testing.T) {
+		if r.Status != PartialOutage || r.Cameras != (Counts{Total: 4, Online: 3, Offline: 1}) {
+			t.Errorf("Expected a partial outage with 3 of 4 online, got %s %+v", r.Status, r.Cameras)
+		}
+		if len(r.Areas) != 3 || r.Areas[0].Name != "RT 01" || r.Areas[0].Offline != 1 || r.Areas[2].Name != "Other" || r.Areas[2].ID != nil {
+			t.Errorf("Expected RT 01, RT 02 and Other, got %+v", r.Areas)
+		}
+	})
+
+	t.Run("Outages", func(t *testing.T) {
+		if len(r.Outages) != 1 || r.Outages[0].Camera != "Market" || *r.Outages[0].Area != "RT 01" {
+			t.Errorf("Expected the market camera to be down, got %+v", r.Outages)
+		}
+		if len(r.Outages) == 1 {
+			if since := r.Outages[0].Since; since == nil || !since.Equal(now.Add(-3*time.Hour)) {
+				t.Errorf("Expected the market camera down since its outage began, got %v", since)
+			}
+		}
+	})
+
+	t.Run("Uptime", func(t *testing.T) {
+		days := r.Uptime.Days
+		if len(days) != HistoryDays || days[HistoryDays-1].Date != "2026-03-10" || days[0].Percent != nil {
+			t.Fatalf("Expected 90 days ending today, got %d ending %+v", len(days), days[len(days)-1])
+		}
+		// 3 samples for each of 4 cameras, 3 of which were up
+		if p := r.Uptime.Percent; p == nil || *p != 75 {
+			t.Errorf("Expected 75%% uptime, got %v", p)
+		}
+	})
+
+	t.Run("Other organization", func(t *testing.T) {
+		r, err := Build(tenant.WithOrg(ctx, 2), db, now)
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		if r.Status != MajorOutage || r.Cameras.Total != 1 || len(r.Outages) != 1 {
+			t.Errorf("Expected only the organization's camera, got %s %+v", r.Status, r.Cameras)
+		}
+	})
+
+	t.Run("Render", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := Render(&buf, "Desa <Dander>", r); err != nil {
+			t.Fatalf("Render failed: %v", err)
+		}
+		page := buf.String()
+		if !strings.Contains(page, "Desa &lt;Dander&gt;") || !strings.Contains(page, "Market") || !strings.Contains(page, "75%") {
+			t.Errorf("Expected the escaped title, the outage and the uptime, got %s", page)
+		}
+	})
+}
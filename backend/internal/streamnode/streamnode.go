@@ -0,0 +1,72 @@
+// Package streamnode picks the go2rtc that serves a camera: the local
+// one at GO2RTC_API_URL, or the secondary node from STREAM_NODES that
+// the camera's stream_node names. Requests to a node with credentials
+// carry them as basic auth, so the URLs handed to other services never
+// do.
+package streamnode
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+)
+
+// ErrUnknown is a stream_node no longer in STREAM_NODES
+var ErrUnknown = errors.New("stream node is not configured")
+
+// Upstream is a go2rtc to send requests to
+type Upstream struct {
+	Node   string // "" for the local go2rtc
+	APIURL string // without a trailing slash
+	Client *http.Client
+}
+
+// Lookup returns the go2rtc called node in stream; "" is the local one
+func Lookup(stream config.Go2RTCConfig, node string) (Upstream, error) {
+	if node == "" {
+		return Upstream{APIURL: strings.TrimRight(stream.APIURL, "/"), Client: httpclient.Shared()}, nil
+	}
+	n, ok := stream.Node(node)
+	if !ok {
+		return Upstream{}, ErrUnknown
+	}
+	up := Upstream{Node: n.Name, APIURL: strings.TrimRight(n.APIURL, "/"), Client: httpclient.Shared()}
+	if n.Username != "" {
+		client := *up.Client
+		next := client.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		client.Transport = basicAuth{username: n.Username, password: n.Password, next: next}
+		up.Client = &client
+	}
+	return up, nil
+}
+
+// ForStream returns the go2rtc serving the camera with streamKey; a
+// stream key no camera has is looked for locally
+func ForStream(ctx context.Context, db *sql.DB, stream config.Go2RTCConfig, streamKey string) (Upstream, error) {
+	var node sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT stream_node FROM cameras WHERE stream_key = ?`, streamKey).Scan(&node)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Upstream{}, err
+	}
+	return Lookup(stream, node.String)
+}
+
+// basicAuth adds a node's credentials to each request
+type basicAuth struct {
+	username, password string
+	next               http.RoundTripper
+}
+
+func (t basicAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, t.password)
+	return t.next.RoundTrip(req)
+}
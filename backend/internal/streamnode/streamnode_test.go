@@ -0,0 +1,83 @@
+package streamnode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestLookup(t *testing.T) {
+	var user, pass string
+	var withAuth bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, withAuth = r.BasicAuth()
+	}))
+	defer srv.Close()
+
+	stream := config.Go2RTCConfig{
+		APIURL: "http://localhost:1984/",
+		Nodes: []config.StreamNode{
+			{Name: "north", APIURL: srv.URL + "/", Username: "admin", Password: "secret"},
+			{Name: "south", APIURL: srv.URL},
+		},
+	}
+
+	local, err := Lookup(stream, "")
+	if err != nil || local.Node != "" || local.APIURL != "http://localhost:1984" {
+		t.Errorf("Local = %+v, %v", local, err)
+	}
+	if _, err := Lookup(stream, "west"); !errors.Is(err, ErrUnknown) {
+		t.Errorf("Expected ErrUnknown, got %v", err)
+	}
+
+	north, err := Lookup(stream, "north")
+	if err != nil || north.APIURL != srv.URL {
+		t.Fatalf("North = %+v, %v", north, err)
+	}
+	resp, err := north.Client.Get(north.APIURL + "/api/streams")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if !withAuth || user != "admin" || pass != "secret" {
+		t.Errorf("Expected the node's credentials, got %q:%q (%v)", user, pass, withAuth)
+	}
+
+	south, _ := Lookup(stream, "south")
+	resp, err = south.Client.Get(south.APIURL + "/api/streams")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if withAuth {
+		t.Error("Expected no credentials for a node without them")
+	}
+}
+
+func TestForStream(t *testing.T) {
+	db := dbtest.Open(t)
+	if _, err := db.Exec(`INSERT INTO cameras (name, private_rtsp_url, stream_key, stream_node)
+		VALUES ('Gate', 'rtsp://a', 'gate', 'north'), ('Yard', 'rtsp://b', 'yard', NULL), ('Dock', 'rtsp://c', 'dock', 'gone')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	ctx := context.Background()
+	stream := config.Go2RTCConfig{
+		APIURL: "http://localhost:1984",
+		Nodes:  []config.StreamNode{{Name: "north", APIURL: "http://10.0.0.2:1984"}},
+	}
+	for key, want := range map[string]string{"gate": "http://10.0.0.2:1984", "yard": "http://localhost:1984", "nobody": "http://localhost:1984"} {
+		up, err := ForStream(ctx, db, stream, key)
+		if err != nil || up.APIURL != want {
+			t.Errorf("%s = %+v, %v; want %s", key, up, err, want)
+		}
+	}
+	if _, err := ForStream(ctx, db, stream, "dock"); !errors.Is(err, ErrUnknown) {
+		t.Errorf("Expected ErrUnknown for a removed node, got %v", err)
+	}
+}
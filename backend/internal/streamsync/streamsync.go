@@ -0,0 +1,281 @@
+// Package streamsync reads the streams of a go2rtc or MediaMTX that is
+// already running, from its config file or its API, and creates a camera
+// for each one, so an existing setup can be brought under management
+// without retyping it.
+package streamsync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abcdefak87/cctv/internal/models"
+	"github.com/abcdefak87/cctv/internal/repository"
+	"github.com/abcdefak87/cctv/internal/tenant"
+)
+
+// Streamers a setup can be read from
+const (
+	KindGo2RTC   = "go2rtc"
+	KindMediaMTX = "mediamtx"
+)
+
+// maxNameLength is the longest camera name the API accepts
+const maxNameLength = 100
+
+// Stream is one stream of the streamer: its name, which becomes the
+// camera's name and stream key, and where it pulls from
+type Stream struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// ParseConfig reads the streams of a go2rtc.yaml ("streams:") or
+// mediamtx.yml ("paths:"). Only the block YAML those files are written
+// in is understood, not YAML as a whole.
+func ParseConfig(kind string, r io.Reader) ([]Stream, error) {
+	switch kind {
+	case KindGo2RTC:
+		entries, err := readSection(r, "streams")
+		if err != nil {
+			return nil, err
+		}
+		streams := make([]Stream, 0, len(entries))
+		for _, e := range entries {
+			sources := e.items
+			if e.value != "" {
+				sources = append([]string{e.value}, sources...)
+			}
+			streams = append(streams, Stream{Name: e.name, Source: pickSource(sources)})
+		}
+		return streams, nil
+
+	case KindMediaMTX:
+		entries, err := readSection(r, "paths")
+		if err != nil {
+			return nil, err
+		}
+		streams := make([]Stream, 0, len(entries))
+		for _, e := range entries {
+			if skipPath(e.name) {
+				continue
+			}
+			streams = append(streams, Stream{Name: e.name, Source: e.fields["source"]})
+		}
+		return streams, nil
+	}
+	return nil, fmt.Errorf("unknown streamer %q", kind)
+}
+
+// Fetch asks a running streamer for its streams: go2rtc's /api/streams
+// or MediaMTX's /v3/config/paths/list
+func Fetch(ctx context.Context, client *http.Client, kind, apiURL string) ([]Stream, error) {
+	base := strings.TrimRight(apiURL, "/")
+	switch kind {
+	case KindGo2RTC:
+		var list map[string]struct {
+			Producers []struct {
+				URL string `json:"url"`
+			} `json:"producers"`
+		}
+		if err := getJSON(ctx, client, base+"/api/streams", &list); err != nil {
+			return nil, err
+		}
+		streams := make([]Stream, 0, len(list))
+		for name, s := range list {
+			var sources []string
+			for _, p := range s.Producers {
+				sources = append(sources, p.URL)
+			}
+			streams = append(streams, Stream{Name: name, Source: pickSource(sources)})
+		}
+		sort.Slice(streams, func(i, j int) bool { return streams[i].Name < streams[j].Name })
+		return streams, nil
+
+	case KindMediaMTX:
+		var streams []Stream
+		for page := 0; ; page++ {
+			var list struct {
+				PageCount int `json:"pageCount"`
+				Items     []struct {
+					Name   string `json:"name"`
+					Source string `json:"source"`
+				} `json:"items"`
+			}
+			query := url.Values{"page": {strconv.Itoa(page)}, "itemsPerPage": {"500"}}
+			if err := getJSON(ctx, client, base+"/v3/config/paths/list?"+query.Encode(), &list); err != nil {
+				return nil, err
+			}
+			for _, p := range list.Items {
+				if !skipPath(p.Name) {
+					streams = append(streams, Stream{Name: p.Name, Source: p.Source})
+				}
+			}
+			if page+1 >= list.PageCount {
+				return streams, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown streamer %q", kind)
+}
+
+func getJSON(ctx context.Context, client *http.Client, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", target, err)
+	}
+	return nil
+}
+
+// pickSource returns the first RTSP source of a go2rtc stream without its
+// #options, else the first source of any kind
+func pickSource(sources []string) string {
+	for _, s := range sources {
+		if isRTSP(s) {
+			source, _, _ := strings.Cut(s, "#")
+			return source
+		}
+	}
+	if len(sources) > 0 {
+		return sources[0]
+	}
+	return ""
+}
+
+func isRTSP(source string) bool {
+	return strings.HasPrefix(source, "rtsp://") || strings.HasPrefix(source, "rtsps://")
+}
+
+// skipPath leaves out MediaMTX's catch-all and regular expression paths,
+// which are not one camera
+func skipPath(name string) bool {
+	return name == "all" || name == "all_others" || strings.HasPrefix(name, "~")
+}
+
+// Result is what Sync did, or would do on a dry run
+type Result struct {
+	DryRun    bool       `json:"dry_run"`
+	Created   []Created  `json:"created"`
+	Unchanged []string   `json:"unchanged"` // streams that already are cameras with the same source
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+// Created is a camera made from a stream; ID is 0 on a dry run
+type Created struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	StreamKey string `json:"stream_key"`
+}
+
+// Conflict is a stream that was not imported, and why
+type Conflict struct {
+	Stream   string `json:"stream"`
+	Reason   string `json:"reason"`
+	CameraID int    `json:"camera_id,omitempty"` // the camera it clashes with
+}
+
+// Sync creates a camera in the organization of ctx for each stream that
+// is not one yet. The stream name is kept as the stream key, so players
+// and the streamer keep using the same path. Streams whose key or source
+// a camera already has, and those without an RTSP source, are reported
+// as conflicts instead.
+func Sync(ctx context.Context, db *sql.DB, streams []Stream, dryRun bool) (*Result, error) {
+	result := &Result{DryRun: dryRun, Created: []Created{}, Unchanged: []string{}, Conflicts: []Conflict{}}
+	cameras := repository.NewCameraRepository(db)
+	orgID := tenant.OrgID(ctx)
+	seen := map[string]bool{}
+
+	for _, s := range streams {
+		conflict := func(reason string, cameraID int) {
+			result.Conflicts = append(result.Conflicts, Conflict{Stream: s.Name, Reason: reason, CameraID: cameraID})
+		}
+		switch {
+		case s.Name == "":
+			conflict("the stream has no name", 0)
+			continue
+		case utf8.RuneCountInString(s.Name) > maxNameLength:
+			conflict(fmt.Sprintf("the name is longer than %d characters", maxNameLength), 0)
+			continue
+		case s.Source == "":
+			conflict("the stream has no source", 0)
+			continue
+		case !isRTSP(s.Source):
+			conflict(fmt.Sprintf("the source %q is not an RTSP URL", sourceScheme(s.Source)), 0)
+			continue
+		case seen[s.Source]:
+			conflict("another stream of the list has the same source", 0)
+			continue
+		}
+		seen[s.Source] = true
+
+		var id, cameraOrg int
+		var source string
+		err := db.QueryRowContext(ctx, `
+			SELECT id, organization_id, COALESCE(private_rtsp_url, '') FROM cameras WHERE stream_key = ? ORDER BY id ASC LIMIT 1
+		`, s.Name).Scan(&id, &cameraOrg, &source)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return nil, err
+		case cameraOrg != orgID:
+			conflict("the stream key belongs to a camera of another organization", 0)
+			continue
+		case source == s.Source:
+			result.Unchanged = append(result.Unchanged, s.Name)
+			continue
+		default:
+			conflict("camera "+strconv.Itoa(id)+" has this stream key with another source", id)
+			continue
+		}
+
+		var key string
+		err = db.QueryRowContext(ctx, `
+			SELECT id, COALESCE(stream_key, '') FROM cameras WHERE private_rtsp_url = ? AND organization_id = ? ORDER BY id ASC LIMIT 1
+		`, s.Source, orgID).Scan(&id, &key)
+		if err == nil {
+			conflict("camera "+strconv.Itoa(id)+" ("+key+") already pulls this source", id)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		created := Created{Name: s.Name, StreamKey: s.Name}
+		if !dryRun {
+			camera := &models.Camera{Name: s.Name, PrivateRTSPURL: s.Source, Enabled: true, StreamKey: s.Name}
+			if created.ID, err = cameras.Create(ctx, camera); err != nil {
+				return nil, err
+			}
+		}
+		result.Created = append(result.Created, created)
+	}
+	return result, nil
+}
+
+// sourceScheme shortens a source to what it is, so that a conflict does
+// not echo credentials: "ffmpeg", "publisher", "rtmp"...
+func sourceScheme(source string) string {
+	if scheme, _, ok := strings.Cut(source, ":"); ok {
+		return scheme
+	}
+	return source
+}
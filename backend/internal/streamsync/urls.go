@@ -0,0 +1,249 @@
+package streamsync
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/tenant"
+)
+
+// What became of a line of an RTSP URL list
+const (
+	StatusPending     = ""
+	StatusCreated     = "created"
+	StatusExists      = "exists"      // a camera of the organization already pulls the URL
+	StatusDuplicate   = "duplicate"   // an earlier line has the same URL
+	StatusInvalid     = "invalid"     // not an RTSP URL
+	StatusUnreachable = "unreachable" // the probe failed
+)
+
+// MaxURLs is the longest list one import takes
+const MaxURLs = 250
+
+// Import is one line of an RTSP URL list. Host is the camera's address
+// without the credentials of the URL, so the summary can be shown and
+// logged.
+type Import struct {
+	Line        int    `json:"line"`
+	Host        string `json:"host,omitempty"`
+	Status      string `json:"status"`
+	CameraID    int64  `json:"camera_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	StreamKey   string `json:"stream_key,omitempty"`
+	Provisioned bool   `json:"provisioned"` // the stream was added to go2rtc
+	Error       string `json:"error,omitempty"`
+
+	URL string `json:"-"`
+}
+
+// ParseURLs reads one RTSP URL per line; blank lines and lines starting
+// with # are skipped. Lines that are not RTSP URLs, or repeat an earlier
+// one, are returned with that status; the others are pending.
+func ParseURLs(text string) []*Import {
+	var list []*Import
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		imp := &Import{Line: n, URL: line}
+		list = append(list, imp)
+
+		u, err := url.Parse(line)
+		switch {
+		case err != nil || u.Hostname() == "":
+			imp.Status, imp.Error = StatusInvalid, "not a URL"
+		case !isRTSP(line):
+			imp.Status, imp.Error = StatusInvalid, "the scheme "+strconv.Quote(u.Scheme)+" is not rtsp or rtsps"
+		case seen[line]:
+			imp.Host = hostPort(u)
+			imp.Status = StatusDuplicate
+		default:
+			imp.Host = hostPort(u)
+			seen[line] = true
+		}
+	}
+	return list
+}
+
+// hostPort is the address of u with the RTSP port filled in
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "554"
+		if u.Scheme == "rtsps" {
+			port = "322"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// MarkExisting marks the pending imports whose URL a camera of the
+// organization of ctx already pulls as existing, so they are neither
+// probed nor created again
+func MarkExisting(ctx context.Context, db *sql.DB, list []*Import) error {
+	orgID := tenant.OrgID(ctx)
+	for _, imp := range list {
+		if imp.Status != StatusPending {
+			continue
+		}
+		var id int64
+		var key string
+		err := db.QueryRowContext(ctx, `
+			SELECT id, COALESCE(stream_key, '') FROM cameras WHERE private_rtsp_url = ? AND organization_id = ? ORDER BY id ASC LIMIT 1
+		`, imp.URL, orgID).Scan(&id, &key)
+		if err == nil {
+			imp.Status, imp.CameraID, imp.StreamKey = StatusExists, id, key
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportURLs creates an enabled camera in the organization of ctx for
+// each pending import, on the go2rtc that node names (nil for the local
+// one), after MarkExisting. A camera is named after its address,
+// "10.0.0.12:554", with " #2" and so on for further channels of the
+// same device, and gets the stream key "cam-10-0-0-12-554", made
+// unique. The cameras are created in one transaction: on an error none
+// are, and the imports are left pending.
+func ImportURLs(ctx context.Context, db *sql.DB, list []*Import, node *string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type created struct {
+		imp       *Import
+		id        int64
+		name, key string
+	}
+	var done []created
+	orgID := tenant.OrgID(ctx)
+	names := map[string]int{}
+	keys := map[string]bool{}
+	now := time.Now()
+
+	for _, imp := range list {
+		if imp.Status != StatusPending {
+			continue
+		}
+		c := created{imp: imp, name: imp.Host}
+		names[imp.Host]++
+		if n := names[imp.Host]; n > 1 {
+			c.name += " #" + strconv.Itoa(n)
+		}
+		if c.key, err = freeStreamKey(ctx, tx, keys, streamKeyFor(imp.Host)); err != nil {
+			return err
+		}
+		keys[c.key] = true
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO cameras (name, private_rtsp_url, enabled, stream_key, stream_node, organization_id, updated_at)
+			VALUES (?, ?, TRUE, ?, ?, ?, ?)
+			RETURNING id
+		`, c.name, imp.URL, c.key, node, orgID, now).Scan(&c.id)
+		if err != nil {
+			return err
+		}
+		done = append(done, c)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, c := range done {
+		c.imp.Status, c.imp.CameraID, c.imp.Name, c.imp.StreamKey = StatusCreated, c.id, c.name, c.key
+	}
+	return nil
+}
+
+// streamKeyFor turns an address into a stream key: "cam-" and its
+// letters and digits, the rest as dashes
+func streamKeyFor(host string) string {
+	var b strings.Builder
+	b.WriteString("cam-")
+	dash := true
+	for _, r := range strings.ToLower(host) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// freeStreamKey returns base, or base-2, base-3... when a camera of any
+// organization, or an earlier line, has it
+func freeStreamKey(ctx context.Context, tx *sql.Tx, taken map[string]bool, base string) (string, error) {
+	for n := 1; ; n++ {
+		key := base
+		if n > 1 {
+			key += "-" + strconv.Itoa(n)
+		}
+		if taken[key] {
+			continue
+		}
+		var exists int
+		err := tx.QueryRowContext(ctx, `SELECT 1 FROM cameras WHERE stream_key = ? LIMIT 1`, key).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return key, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// Provision adds the stream of each created import to the go2rtc at
+// apiURL, under its stream key, so it plays without editing go2rtc.yaml.
+// A stream go2rtc refuses is left to be added by hand; its error is
+// kept on the import.
+func Provision(ctx context.Context, client *http.Client, apiURL string, list []*Import) {
+	for _, imp := range list {
+		if imp.Status != StatusCreated {
+			continue
+		}
+		if err := addStream(ctx, client, apiURL, imp.StreamKey, imp.URL); err != nil {
+			imp.Error = "go2rtc: " + err.Error()
+			continue
+		}
+		imp.Provisioned = true
+	}
+}
+
+func addStream(ctx context.Context, client *http.Client, apiURL, name, source string) error {
+	query := url.Values{"name": {name}, "src": {source}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		strings.TrimRight(apiURL, "/")+"/api/streams?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("go2rtc returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package streamsync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// entry is one key of a top-level YAML section, such as a stream under
+// "streams:"
+type entry struct {
+	name   string
+	value  string            // "name: value"
+	items  []string          // "- item" lines below the key, or "name: [a, b]"
+	fields map[string]string // "key: value" lines below the key
+}
+
+// readSection returns the keys of the top-level mapping section, in file
+// order. Anything nested deeper than one level below a key is ignored.
+func readSection(r io.Reader, section string) ([]entry, error) {
+	var entries []entry
+	inSection, indent := false, 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := stripComment(scanner.Text())
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", line)
+		}
+		depth := len(text) - len(trimmed)
+
+		if depth == 0 {
+			key, _, _ := splitKey(trimmed)
+			inSection, indent = key == section, 0
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if indent == 0 {
+			indent = depth
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			// A list may sit at the same indent as its key
+			if depth < indent || len(entries) == 0 {
+				return nil, fmt.Errorf("line %d: list item outside a %s entry", line, section)
+			}
+			last := &entries[len(entries)-1]
+			last.items = append(last.items, unquote(strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))))
+			continue
+		}
+
+		key, value, ok := splitKey(trimmed)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line)
+		}
+		switch {
+		case depth == indent:
+			e := entry{name: key, fields: map[string]string{}}
+			if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+				for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+					if item = unquote(strings.TrimSpace(item)); item != "" {
+						e.items = append(e.items, item)
+					}
+				}
+			} else {
+				e.value = value
+			}
+			entries = append(entries, e)
+		case depth > indent && len(entries) > 0:
+			entries[len(entries)-1].fields[key] = value
+		default:
+			return nil, fmt.Errorf("line %d: unexpected indentation", line)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// splitKey splits "key: value" and unquotes both sides
+func splitKey(s string) (key, value string, ok bool) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		end := strings.Index(s[1:], s[:1])
+		if end < 0 {
+			return "", "", false
+		}
+		key, s = s[1:end+1], s[end+2:]
+		if !strings.HasPrefix(s, ":") {
+			return "", "", false
+		}
+		return key, unquote(strings.TrimSpace(s[1:])), true
+	}
+	// A colon only ends a key when followed by a space or the line end,
+	// so "rtsp://host:554" is not split
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' && (i+1 == len(s) || s[i+1] == ' ') {
+			return strings.TrimSpace(s[:i]), unquote(strings.TrimSpace(s[i+1:])), true
+		}
+	}
+	return "", "", false
+}
+
+// stripComment drops a " # comment"; a # inside a value, as in go2rtc's
+// "rtsp://host/1#backchannel=0", is kept
+func stripComment(s string) string {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" [,", s[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimRight(s[:i], " \t")
+		}
+	}
+	return strings.TrimRight(s, " \t")
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package sysmon
+
+import "syscall"
+
+// statDisk reports the size of the filesystem holding path, its free
+// space and the part of it available to unprivileged users
+func statDisk(path string) (total, free, available uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, 0, err
+	}
+	size := uint64(stat.Bsize)
+	return stat.Blocks * size, stat.Bfree * size, stat.Bavail * size, nil
+}
@@ -0,0 +1,199 @@
+package sysmon
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procRoot is where the proc filesystem is mounted; tests point it at
+// a fake one
+var procRoot = "/proc"
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc. It is 100 on
+// every Linux architecture Go supports.
+const clockTicks = 100
+
+// cpuTimes are the cumulative CPU times of all cores, in ticks
+type cpuTimes struct {
+	total, idle uint64
+}
+
+// readCPUTimes reads the aggregate line of /proc/stat; idle includes
+// time waiting for I/O
+func readCPUTimes() (cpuTimes, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) < 6 || fields[0] != "cpu" {
+		return cpuTimes{}, errors.New("unexpected /proc/stat format")
+	}
+	var t cpuTimes
+	// user nice system idle iowait irq softirq steal; guest time is
+	// already counted in user
+	for i, f := range fields[1:min(len(fields), 9)] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return cpuTimes{}, fmt.Errorf("invalid /proc/stat field %q: %w", f, err)
+		}
+		t.total += v
+		if i == 3 || i == 4 {
+			t.idle += v
+		}
+	}
+	return t, nil
+}
+
+// readLoadAverage reads /proc/loadavg
+func readLoadAverage() (load1, load5, load15 float64, err error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "loadavg"))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if _, err := fmt.Sscan(string(data), &load1, &load5, &load15); err != nil {
+		return 0, 0, 0, fmt.Errorf("unexpected /proc/loadavg format: %w", err)
+	}
+	return load1, load5, load15, nil
+}
+
+// readMemInfo reads the memory of the host from /proc/meminfo
+func readMemInfo() (total, available uint64, err error) {
+	f, err := os.Open(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	var haveTotal, haveAvailable bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "MemTotal":
+			total, haveTotal = kilobytes(value), true
+		case "MemAvailable":
+			available, haveAvailable = kilobytes(value), true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	if !haveTotal || !haveAvailable {
+		return 0, 0, errors.New("MemTotal or MemAvailable missing from /proc/meminfo")
+	}
+	return total, available, nil
+}
+
+// readProcess reads the resident memory of a process and the CPU ticks
+// it has used, user and system
+func readProcess(pid int) (rss, ticks uint64, err error) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	status, err := os.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			rss = kilobytes(value)
+			break
+		}
+	}
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name may hold spaces and parentheses, so the fields
+	// are counted from the last ")": state is field 3, utime 14 and
+	// stime 15
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, 0, fmt.Errorf("unexpected format of %s/stat", dir)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("unexpected format of %s/stat", dir)
+	}
+	for _, f := range fields[11:13] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid CPU time in %s/stat: %w", dir, err)
+		}
+		ticks += v
+	}
+	return rss, ticks, nil
+}
+
+// findProcess returns the process named name, the lowest PID when
+// several are
+func findProcess(name string) (int, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return 0, err
+	}
+	found := 0
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(procRoot, e.Name(), "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != name {
+			continue
+		}
+		if found == 0 || pid < found {
+			found = pid
+		}
+	}
+	if found == 0 {
+		return 0, fmt.Errorf("no process named %s", name)
+	}
+	return found, nil
+}
+
+// readNetwork sums the bytes received and sent by every interface but
+// loopback from /proc/net/dev
+func readNetwork() (rx, tx uint64, err error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "net", "dev"))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		// Receive bytes is the first field, transmit bytes the ninth
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		r, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		t, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			continue
+		}
+		rx += r
+		tx += t
+	}
+	return rx, tx, nil
+}
+
+// kilobytes parses a "1234 kB" value of /proc into bytes
+func kilobytes(value string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+	return n * 1024
+}
@@ -0,0 +1,101 @@
+package sysmon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeProc points procRoot at a directory holding the files read by the
+// monitor and returns a function that rewrites them
+func fakeProc(t *testing.T) func(cpuBusy, cpuIdle, selfTicks, go2rtcTicks, rx, tx uint64) {
+	t.Helper()
+	root := t.TempDir()
+	old := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = old })
+
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	write("loadavg", "0.52 0.41 0.30 2/311 4242\n")
+	write("meminfo", "MemTotal:        8000000 kB\nMemFree:         1000000 kB\nMemAvailable:    3000000 kB\n")
+	write("77/comm", "go2rtc\n")
+	write("77/status", "Name:\tgo2rtc\nVmRSS:\t   51200 kB\n")
+	write("90/comm", "sshd\n")
+	self := strconv.Itoa(os.Getpid())
+	write(self+"/status", "Name:\tserver\nVmRSS:\t   20480 kB\n")
+
+	return func(cpuBusy, cpuIdle, selfTicks, go2rtcTicks, rx, tx uint64) {
+		// busy split across user and system, idle across idle and iowait
+		write("stat", fmt.Sprintf("cpu  %d 0 %d %d %d 0 0 0 0 0\ncpu0 1 2 3 4 5 6 7 8 0 0\n",
+			cpuBusy/2, cpuBusy-cpuBusy/2, cpuIdle/2, cpuIdle-cpuIdle/2))
+		write(self+"/stat", fmt.Sprintf("%s (my (server)) S 1 1 1 0 -1 0 0 0 0 0 %d 0 0 0 20 0\n", self, selfTicks))
+		write("77/stat", fmt.Sprintf("77 (go2rtc) S 1 1 1 0 -1 0 0 0 0 0 %d %d 0 0 20 0\n", go2rtcTicks/2, go2rtcTicks-go2rtcTicks/2))
+		write("net/dev", fmt.Sprintf(`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 999999 10 0 0 0 0 0 0 999999 10 0 0 0 0 0 0
+  eth0: %d 10 0 0 0 0 0 0 %d 10 0 0 0 0 0 0
+ wlan0: 1000 10 0 0 0 0 0 0 500 10 0 0 0 0 0 0
+`, rx, tx))
+	}
+}
+
+func TestSampleProc(t *testing.T) {
+	update := fakeProc(t)
+	m := New(Options{Go2RTCURL: func() string { return "http://127.0.0.1:1984" }})
+	at := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return at }
+
+	update(1000, 3000, 500, 200, 10_000, 4_000)
+	first := m.Sample()
+	if first.CPU == nil || first.CPU.Load1 != 0.52 || first.CPU.Load15 != 0.30 || first.CPU.Percent != 0 {
+		t.Errorf("Expected the load average without a CPU rate, got %+v", first.CPU)
+	}
+	if first.Memory == nil || first.Memory.TotalBytes != 8000000*1024 || first.Memory.AvailableBytes != 3000000*1024 {
+		t.Errorf("Expected the host memory, got %+v", first.Memory)
+	}
+	if first.Process.RSSBytes != 20480*1024 || first.Process.CPUPercent != nil {
+		t.Errorf("Expected this process' RSS without a CPU rate, got %+v", first.Process)
+	}
+	if first.Go2RTC == nil || first.Go2RTC.PID != 77 || first.Go2RTC.RSSBytes != 51200*1024 {
+		t.Errorf("Expected go2rtc found, got %+v", first.Go2RTC)
+	}
+	if first.Network != nil {
+		t.Errorf("Expected no network rate on the first sample, got %+v", first.Network)
+	}
+
+	// 10 seconds later: 400 of 1000 ticks busy, this process used 50
+	// ticks (5% of a core) and go2rtc 250 (25%)
+	at = at.Add(10 * time.Second)
+	update(1400, 3600, 550, 450, 30_000, 9_000)
+	second := m.Sample()
+	if second.CPU == nil || second.CPU.Percent != 40 {
+		t.Errorf("Expected 40%% CPU, got %+v", second.CPU)
+	}
+	if p := second.Process.CPUPercent; p == nil || *p != 5 {
+		t.Errorf("Expected this process at 5%% of a core, got %v", p)
+	}
+	if second.Go2RTC == nil || second.Go2RTC.CPUPercent == nil || *second.Go2RTC.CPUPercent != 25 {
+		t.Errorf("Expected go2rtc at 25%% of a core, got %+v", second.Go2RTC)
+	}
+	if n := second.Network; n == nil || n.RxBytesPerSec != 2000 || n.TxBytesPerSec != 500 {
+		t.Errorf("Expected 2000 B/s in and 500 B/s out, got %+v", n)
+	}
+
+	// go2rtc elsewhere is not looked for
+	m.opts.Go2RTCURL = func() string { return "http://go2rtc:1984" }
+	if s := m.Sample(); s.Go2RTC != nil {
+		t.Errorf("Expected no go2rtc when it runs on another host, got %+v", s.Go2RTC)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !linux
+
+package sysmon
+
+import "errors"
+
+// clockTicks is unused off Linux
+const clockTicks = 100
+
+// errUnsupported is returned for figures that come from /proc
+var errUnsupported = errors.New("not available on this platform")
+
+type cpuTimes struct {
+	total, idle uint64
+}
+
+func readCPUTimes() (cpuTimes, error) {
+	return cpuTimes{}, errUnsupported
+}
+
+func readLoadAverage() (load1, load5, load15 float64, err error) {
+	return 0, 0, 0, errUnsupported
+}
+
+func readMemInfo() (total, available uint64, err error) {
+	return 0, 0, errUnsupported
+}
+
+func readProcess(pid int) (rss, ticks uint64, err error) {
+	return 0, 0, errUnsupported
+}
+
+func findProcess(name string) (int, error) {
+	return 0, errUnsupported
+}
+
+func readNetwork() (rx, tx uint64, err error) {
+	return 0, 0, errUnsupported
+}
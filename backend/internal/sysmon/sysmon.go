@@ -0,0 +1,291 @@
+// Package sysmon samples the resources of this instance for the admin
+// dashboard: CPU load, the memory of the Go process and of go2rtc when
+// it runs on the same host, the disks holding the database and the
+// recordings, and network throughput. Monitor takes a sample every
+// interval and keeps a short history for sparklines.
+//
+// CPU, memory and network figures come from /proc, so they are only
+// reported on Linux; elsewhere those fields are left out. CPU and
+// network rates are the change since the previous sample, so the first
+// sample has none.
+package sysmon
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInterval = 5 * time.Second
+	defaultHistory  = 120
+)
+
+// Sample is the state of the instance at one time. Pointer fields are
+// nil when the platform or the first sample cannot tell.
+type Sample struct {
+	At      time.Time `json:"at"`
+	CPU     *CPU      `json:"cpu"`
+	Memory  *Memory   `json:"memory"`
+	Process Server    `json:"process"`
+	Go2RTC  *Process  `json:"go2rtc"` // nil unless go2rtc runs on this host
+	Disks   []Disk    `json:"disks"`
+	Network *Network  `json:"network"`
+}
+
+// CPU is the load of the host
+type CPU struct {
+	Percent float64 `json:"percent"` // busy time of all cores since the last sample
+	Load1   float64 `json:"load1"`
+	Load5   float64 `json:"load5"`
+	Load15  float64 `json:"load15"`
+	Cores   int     `json:"cores"`
+}
+
+// Memory is the memory of the host
+type Memory struct {
+	TotalBytes     uint64 `json:"total_bytes"`
+	AvailableBytes uint64 `json:"available_bytes"`
+}
+
+// Process is a process on the host, such as go2rtc
+type Process struct {
+	PID        int      `json:"pid"`
+	RSSBytes   uint64   `json:"rss_bytes"`
+	CPUPercent *float64 `json:"cpu_percent"` // of one core
+}
+
+// Server is this process, with the Go runtime's view of its memory
+type Server struct {
+	Process
+	HeapBytes  uint64 `json:"heap_bytes"`
+	SysBytes   uint64 `json:"sys_bytes"` // obtained from the OS by the runtime
+	Goroutines int    `json:"goroutines"`
+}
+
+// Disk is the filesystem holding one of the server's paths
+type Disk struct {
+	Name        string  `json:"name"`
+	Path        string  `json:"path"`
+	TotalBytes  uint64  `json:"total_bytes"`
+	UsedBytes   uint64  `json:"used_bytes"`
+	FreeBytes   uint64  `json:"free_bytes"` // available to unprivileged users
+	UsedPercent float64 `json:"used_percent"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// Network is the throughput of the host's interfaces but loopback
+type Network struct {
+	RxBytesPerSec float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec float64 `json:"tx_bytes_per_sec"`
+}
+
+// DiskPath names a path whose filesystem is sampled
+type DiskPath struct {
+	Name string
+	Path string
+}
+
+// Options tune a Monitor; zero values use the defaults
+type Options struct {
+	Interval time.Duration // between samples
+	History  int           // samples kept
+	Disks    []DiskPath
+
+	// Go2RTCURL is go2rtc's API; when it is on this host, the process
+	// named go2rtc is sampled too
+	Go2RTCURL func() string
+}
+
+// counters are the cumulative figures rates are taken from; the ok
+// fields say whether each was read
+type counters struct {
+	at        time.Time
+	cpu       cpuTimes
+	cpuOK     bool
+	self      uint64 // CPU ticks of this process
+	selfOK    bool
+	go2rtc    uint64
+	go2rtcPID int // 0 when not read
+	rx, tx    uint64
+	networkOK bool
+}
+
+// Monitor samples the instance; it is safe for concurrent use
+type Monitor struct {
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	samples []Sample // oldest first
+	prev    counters
+}
+
+func New(opts Options) *Monitor {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.History <= 0 {
+		opts.History = defaultHistory
+	}
+	return &Monitor{opts: opts, now: time.Now}
+}
+
+// Interval is the time between samples
+func (m *Monitor) Interval() time.Duration {
+	return m.opts.Interval
+}
+
+// Run takes a sample every interval until ctx is cancelled. Every
+// instance runs its own; start it with shutdown.Coordinator.Go.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+	for {
+		m.Sample()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Latest returns the newest sample, or false before the first
+func (m *Monitor) Latest() (Sample, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) == 0 {
+		return Sample{}, false
+	}
+	return m.samples[len(m.samples)-1], true
+}
+
+// History returns the samples kept, oldest first
+func (m *Monitor) History() []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Sample{}, m.samples...)
+}
+
+// Sample takes a sample now, adds it to the history and returns it
+func (m *Monitor) Sample() Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	s := Sample{At: now.UTC(), Disks: []Disk{}}
+	cur := counters{at: now}
+	elapsed := now.Sub(m.prev.at).Seconds()
+	rate := func(prevOK bool, cur, prev uint64) (float64, bool) {
+		if !prevOK || elapsed <= 0 || cur < prev {
+			return 0, false
+		}
+		return float64(cur-prev) / elapsed, true
+	}
+
+	// CPU
+	var err error
+	if cur.cpu, err = readCPUTimes(); err == nil {
+		cur.cpuOK = true
+		cpu := &CPU{Cores: runtime.NumCPU()}
+		cpu.Load1, cpu.Load5, cpu.Load15, _ = readLoadAverage()
+		if m.prev.cpuOK && cur.cpu.total > m.prev.cpu.total {
+			busy := float64((cur.cpu.total - cur.cpu.idle) - (m.prev.cpu.total - m.prev.cpu.idle))
+			cpu.Percent = round(100 * busy / float64(cur.cpu.total-m.prev.cpu.total))
+		}
+		s.CPU = cpu
+	}
+
+	if total, available, err := readMemInfo(); err == nil {
+		s.Memory = &Memory{TotalBytes: total, AvailableBytes: available}
+	}
+
+	// This process; the RSS is the runtime's figure where /proc is missing
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	s.Process = Server{
+		Process:    Process{PID: os.Getpid(), RSSBytes: stats.Sys},
+		HeapBytes:  stats.HeapAlloc,
+		SysBytes:   stats.Sys,
+		Goroutines: runtime.NumGoroutine(),
+	}
+	if rss, ticks, err := readProcess(s.Process.PID); err == nil {
+		s.Process.RSSBytes = rss
+		cur.self, cur.selfOK = ticks, true
+		if r, ok := rate(m.prev.selfOK, ticks, m.prev.self); ok {
+			p := round(100 * r / clockTicks)
+			s.Process.CPUPercent = &p
+		}
+	}
+
+	// go2rtc, when it runs here
+	if m.opts.Go2RTCURL != nil && local(m.opts.Go2RTCURL()) {
+		if pid, err := findProcess("go2rtc"); err == nil {
+			if rss, ticks, err := readProcess(pid); err == nil {
+				proc := &Process{PID: pid, RSSBytes: rss}
+				cur.go2rtc, cur.go2rtcPID = ticks, pid
+				if r, ok := rate(m.prev.go2rtcPID == pid, ticks, m.prev.go2rtc); ok {
+					p := round(100 * r / clockTicks)
+					proc.CPUPercent = &p
+				}
+				s.Go2RTC = proc
+			}
+		}
+	}
+
+	// Disks
+	for _, d := range m.opts.Disks {
+		disk := Disk{Name: d.Name, Path: d.Path}
+		if total, free, avail, err := statDisk(d.Path); err != nil {
+			disk.Error = err.Error()
+		} else {
+			disk.TotalBytes, disk.FreeBytes = total, avail
+			disk.UsedBytes = total - free
+			if total > 0 {
+				disk.UsedPercent = round(100 * float64(disk.UsedBytes) / float64(total))
+			}
+		}
+		s.Disks = append(s.Disks, disk)
+	}
+
+	// Network
+	if cur.rx, cur.tx, err = readNetwork(); err == nil {
+		cur.networkOK = true
+		rx, rxOK := rate(m.prev.networkOK, cur.rx, m.prev.rx)
+		tx, txOK := rate(m.prev.networkOK, cur.tx, m.prev.tx)
+		if rxOK && txOK {
+			s.Network = &Network{RxBytesPerSec: round(rx), TxBytesPerSec: round(tx)}
+		}
+	}
+
+	m.prev = cur
+	if len(m.samples) == m.opts.History {
+		m.samples = append(m.samples[:0], m.samples[1:]...)
+	}
+	m.samples = append(m.samples, s)
+	return s
+}
+
+// local reports whether the service at rawURL runs on this host
+func local(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// round keeps two decimals
+func round(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
@@ -0,0 +1,51 @@
+package sysmon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	m := New(Options{History: 3, Disks: []DiskPath{{Name: "recordings", Path: dir}, {Name: "gone", Path: dir + "/missing"}}})
+	if _, ok := m.Latest(); ok {
+		t.Error("Expected no sample before the first")
+	}
+
+	at := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return at }
+	for i := 0; i < 5; i++ {
+		m.Sample()
+		at = at.Add(time.Second)
+	}
+	history := m.History()
+	if len(history) != 3 || !history[0].At.Equal(time.Date(2026, 5, 1, 10, 0, 2, 0, time.UTC)) {
+		t.Fatalf("Expected the newest 3 samples from 10:00:02, got %d from %v", len(history), history[0].At)
+	}
+	latest, _ := m.Latest()
+	if !latest.At.Equal(history[2].At) {
+		t.Errorf("Expected the latest sample to end the history, got %v", latest.At)
+	}
+	if latest.Process.PID == 0 || latest.Process.Goroutines == 0 || latest.Process.HeapBytes == 0 {
+		t.Errorf("Expected this process sampled, got %+v", latest.Process)
+	}
+	if len(latest.Disks) != 2 || latest.Disks[1].Error == "" {
+		t.Errorf("Expected the missing path reported as an error, got %+v", latest.Disks)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	for url, want := range map[string]bool{
+		"http://localhost:1984":  true,
+		"http://127.0.0.1:1984":  true,
+		"http://[::1]:1984":      true,
+		"http://go2rtc:1984":     false,
+		"http://10.0.0.5:1984":   false,
+		"://not a url":           false,
+		"http://localhost.evil/": false,
+	} {
+		if got := local(url); got != want {
+			t.Errorf("local(%q) = %v, expected %v", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Package tenant carries the organization a request works in. One
+// instance can serve several desa or kecamatan deployments; cameras,
+// areas, users and settings belong to one organization each and queries
+// are scoped to the organization in the context. Data from before
+// organizations existed belongs to the default one.
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOrgID is the organization contexts without one work in
+const DefaultOrgID = 1
+
+type orgKey struct{}
+
+// WithOrg returns a copy of ctx scoped to organization id
+func WithOrg(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, orgKey{}, id)
+}
+
+// OrgID returns the organization ctx is scoped to, or DefaultOrgID
+func OrgID(ctx context.Context) int {
+	if id, ok := ctx.Value(orgKey{}).(int); ok && id > 0 {
+		return id
+	}
+	return DefaultOrgID
+}
+
+// resolverTTL is how long the slug and domain lookup is trusted before
+// it is read again, so changes made by another instance apply
+const resolverTTL = time.Minute
+
+// Resolver maps organization slugs and domains to IDs for requests made
+// without a token
+type Resolver struct {
+	db *sql.DB
+
+	mu       sync.Mutex
+	loaded   time.Time
+	bySlug   map[string]int
+	byDomain map[string]int
+}
+
+func NewResolver(db *sql.DB) *Resolver {
+	return &Resolver{db: db}
+}
+
+// Slug returns the organization with slug; ok is false when there is none
+func (r *Resolver) Slug(ctx context.Context, slug string) (id int, ok bool, err error) {
+	if err := r.load(ctx); err != nil {
+		return 0, false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok = r.bySlug[strings.ToLower(slug)]
+	return id, ok, nil
+}
+
+// Domain returns the organization served on host (a port is ignored); ok
+// is false when there is none
+func (r *Resolver) Domain(ctx context.Context, host string) (id int, ok bool, err error) {
+	if err := r.load(ctx); err != nil {
+		return 0, false, err
+	}
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok = r.byDomain[strings.ToLower(host)]
+	return id, ok, nil
+}
+
+// Invalidate drops the lookup so the next request reads it again; call
+// it after an organization is created, changed or deleted
+func (r *Resolver) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loaded = time.Time{}
+}
+
+func (r *Resolver) load(ctx context.Context) error {
+	r.mu.Lock()
+	fresh := time.Since(r.loaded) < resolverTTL
+	r.mu.Unlock()
+	if fresh {
+		return nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, slug, COALESCE(domain, '') FROM organizations`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	bySlug := map[string]int{}
+	byDomain := map[string]int{}
+	for rows.Next() {
+		var id int
+		var slug, domain string
+		if err := rows.Scan(&id, &slug, &domain); err != nil {
+			return err
+		}
+		bySlug[strings.ToLower(slug)] = id
+		if domain != "" {
+			byDomain[strings.ToLower(domain)] = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bySlug, r.byDomain, r.loaded = bySlug, byDomain, time.Now()
+	return nil
+}
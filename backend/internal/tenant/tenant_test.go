@@ -0,0 +1,26 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOrgID(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		if id := OrgID(context.Background()); id != DefaultOrgID {
+			t.Errorf("Expected %d, got %d", DefaultOrgID, id)
+		}
+	})
+
+	t.Run("Scoped", func(t *testing.T) {
+		if id := OrgID(WithOrg(context.Background(), 3)); id != 3 {
+			t.Errorf("Expected 3, got %d", id)
+		}
+	})
+
+	t.Run("Invalid ID", func(t *testing.T) {
+		if id := OrgID(WithOrg(context.Background(), 0)); id != DefaultOrgID {
+			t.Errorf("Expected %d, got %d", DefaultOrgID, id)
+		}
+	})
+}
@@ -0,0 +1,596 @@
+// Package ticketing hands cameras that stay offline to field
+// maintenance. Once a camera has been offline for longer than a
+// threshold, the Manager opens a ticket in an external system, a
+// webhook receiver, Jira or a mailbox, with the camera's details and
+// recent health; the ticket's ID in that system is kept with the
+// camera. When the camera is back, or is disabled or deleted, the
+// ticket is closed there.
+//
+// A ticket is recorded as pending before the system is asked to open
+// it, so a failed request is retried, with backoff, under the same
+// ticket ID instead of opening a second one.
+package ticketing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Ticket statuses
+const (
+	StatusPending = "pending" // not yet accepted by the external system
+	StatusOpen    = "open"
+	StatusClosed  = "closed"
+)
+
+// Reasons a ticket is closed
+const (
+	ReasonOnline   = "camera is back online"
+	ReasonDisabled = "camera was disabled"
+	ReasonDeleted  = "camera was deleted"
+)
+
+const (
+	checkInterval = time.Minute
+
+	// dbTimeout bounds the queries of one check
+	dbTimeout = 10 * time.Second
+
+	// requestTimeout bounds one request to the external system
+	requestTimeout = 30 * time.Second
+
+	// maxBackoff is the longest wait between retries of a failed request
+	maxBackoff = time.Hour
+
+	// uptimeDays and noteCount are how much history a ticket carries
+	uptimeDays = 7
+	noteCount  = 5
+)
+
+// Ticket is a maintenance ticket of a camera
+type Ticket struct {
+	ID           int64      `json:"id"`
+	CameraID     *int       `json:"camera_id"` // nil once the camera is deleted
+	Camera       string     `json:"camera"`
+	Provider     string     `json:"provider"`
+	ExternalID   string     `json:"external_id"` // the ticket's ID in the external system
+	URL          string     `json:"url"`
+	Status       string     `json:"status"`
+	OfflineSince time.Time  `json:"offline_since"`
+	Attempts     int        `json:"attempts"` // failed requests since the last success
+	Error        string     `json:"error"`    // of the last failed request
+	CreatedAt    time.Time  `json:"created_at"`
+	OpenedAt     *time.Time `json:"opened_at"`
+	ClosedAt     *time.Time `json:"closed_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Issue is what a ticket tells field maintenance about a camera
+type Issue struct {
+	TicketID     int64         `json:"ticket_id"`
+	CameraID     int           `json:"camera_id"`
+	Camera       string        `json:"camera"`
+	Description  string        `json:"description"`
+	Area         string        `json:"area"`
+	Location     string        `json:"location"`
+	Latitude     *float64      `json:"latitude"`
+	Longitude    *float64      `json:"longitude"`
+	Host         string        `json:"host"` // of the RTSP URL, without credentials
+	OfflineSince time.Time     `json:"offline_since"`
+	Error        string        `json:"error"` // of the last health check
+	Probes       []ProbeResult `json:"probes"`
+	Uptime       []DayUptime   `json:"uptime"` // last days, oldest first
+	Notes        []string      `json:"notes"`  // maintenance notes, newest first
+}
+
+// ProbeResult is the last outcome of one health probe of the camera
+type ProbeResult struct {
+	Type      string     `json:"type"`
+	OK        *bool      `json:"ok"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at"`
+}
+
+// DayUptime is the share of health samples a camera was up on one day
+type DayUptime struct {
+	Day     string  `json:"day"`
+	Percent float64 `json:"percent"`
+}
+
+// Summary is the one-line title of the ticket
+func (i Issue) Summary() string {
+	return fmt.Sprintf("Camera %s offline since %s", i.Camera, i.OfflineSince.UTC().Format("2006-01-02 15:04 MST"))
+}
+
+// Text describes the issue in plain text, for systems that take a
+// ticket body rather than structured fields
+func (i Issue) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Camera %s (ID %d) has been offline since %s.\n", i.Camera, i.CameraID, i.OfflineSince.UTC().Format(time.RFC1123))
+	if i.Error != "" {
+		fmt.Fprintf(&b, "Last error: %s\n", i.Error)
+	}
+	b.WriteString("\n")
+	for _, f := range []struct{ label, value string }{
+		{"Description", i.Description},
+		{"Area", i.Area},
+		{"Location", i.Location},
+		{"Host", i.Host},
+	} {
+		if f.value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", f.label, f.value)
+		}
+	}
+	if i.Latitude != nil && i.Longitude != nil {
+		fmt.Fprintf(&b, "Coordinates: %.6f, %.6f\n", *i.Latitude, *i.Longitude)
+	}
+	if len(i.Probes) > 0 {
+		b.WriteString("\nHealth probes:\n")
+		for _, p := range i.Probes {
+			result := "not run yet"
+			switch {
+			case p.OK != nil && *p.OK:
+				result = "ok"
+			case p.OK != nil:
+				result = "failed: " + p.Error
+			}
+			fmt.Fprintf(&b, "- %s: %s\n", p.Type, result)
+		}
+	}
+	if len(i.Uptime) > 0 {
+		b.WriteString("\nUptime:\n")
+		for _, d := range i.Uptime {
+			fmt.Fprintf(&b, "- %s: %.1f%%\n", d.Day, d.Percent)
+		}
+	}
+	if len(i.Notes) > 0 {
+		b.WriteString("\nMaintenance notes:\n")
+		for _, n := range i.Notes {
+			fmt.Fprintf(&b, "- %s\n", strings.ReplaceAll(n, "\n", "\n  "))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Resolution is why and when a ticket is closed
+type Resolution struct {
+	Reason   string
+	At       time.Time
+	Downtime time.Duration // since the camera went offline
+}
+
+// Text describes the resolution in plain text
+func (r Resolution) Text(camera string) string {
+	return fmt.Sprintf("Camera %s: %s at %s, after %s offline.", camera, r.Reason,
+		r.At.UTC().Format(time.RFC1123), r.Downtime.Truncate(time.Second))
+}
+
+// Tracker is an external ticketing system
+type Tracker interface {
+	// Open creates the ticket of an issue and returns its ID in the
+	// system and a link to it, empty when there is none. A retried
+	// request has the same Issue.TicketID.
+	Open(ctx context.Context, issue Issue) (externalID, link string, err error)
+
+	// Close closes a ticket Open created
+	Close(ctx context.Context, t Ticket, r Resolution) error
+}
+
+// Manager opens and closes the tickets of offline cameras
+type Manager struct {
+	db       *sql.DB
+	tracker  Tracker
+	provider string
+	after    time.Duration
+	now      func() time.Time
+}
+
+// New returns a manager opening tickets in tracker, which provider
+// names, for cameras offline longer than after
+func New(db *sql.DB, tracker Tracker, provider string, after time.Duration) *Manager {
+	return &Manager{db: db, tracker: tracker, provider: provider, after: after, now: time.Now}
+}
+
+// Run checks the cameras every minute until ctx is cancelled. Run it on
+// one instance only; see cluster.Node.Lead.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.Check(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to check camera tickets", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check records a pending ticket for each camera offline past the
+// threshold that has none, asks the tracker to open the pending tickets
+// that are due and closes those of cameras that are back
+func (m *Manager) Check(ctx context.Context) error {
+	now := m.now().UTC()
+	if err := m.record(ctx, now); err != nil {
+		return err
+	}
+	if err := m.close(ctx, now); err != nil {
+		return err
+	}
+	return m.open(ctx, now)
+}
+
+// record adds a pending ticket for each camera offline longer than the
+// threshold without one. The outage starts when the alerter saw the
+// camera go offline.
+func (m *Manager) record(ctx context.Context, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT c.id, c.name, c.organization_id, s.since
+		FROM cameras c
+		JOIN camera_health h ON h.camera_id = c.id
+		JOIN camera_alerts s ON s.camera_id = c.id
+		WHERE c.enabled = TRUE AND h.status = 'offline' AND s.status = 'offline'
+		  AND NOT EXISTS (SELECT 1 FROM camera_tickets t WHERE t.camera_id = c.id AND t.status IN (?, ?))
+	`, StatusPending, StatusOpen)
+	if err != nil {
+		return err
+	}
+	type offline struct {
+		id, orgID int
+		name      string
+		since     time.Time
+	}
+	var due []offline
+	for rows.Next() {
+		var o offline
+		if err := rows.Scan(&o.id, &o.name, &o.orgID, &o.since); err != nil {
+			rows.Close()
+			return err
+		}
+		if now.Sub(o.since) >= m.after {
+			due = append(due, o)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range due {
+		if _, err := m.db.ExecContext(ctx, `
+			INSERT INTO camera_tickets (organization_id, camera_id, camera_name, provider, status, offline_since, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, o.orgID, o.id, o.name, m.provider, StatusPending, o.since, now, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open asks the tracker to open the pending tickets whose backoff has
+// passed. A failure is recorded on the ticket and retried later.
+func (m *Manager) open(ctx context.Context, now time.Time) error {
+	pending, err := m.tickets(ctx, `WHERE status = ? AND camera_id IS NOT NULL ORDER BY id`, StatusPending)
+	if err != nil {
+		return err
+	}
+	for _, t := range pending {
+		if t.Attempts > 0 && now.Before(t.UpdatedAt.Add(backoff(t.Attempts))) {
+			continue
+		}
+		issue, err := m.issue(ctx, t)
+		if err != nil {
+			return err
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		externalID, link, err := m.tracker.Open(reqCtx, issue)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Warn("Failed to open camera ticket", "ticket_id", t.ID, "camera_id", *t.CameraID, "provider", t.Provider, "error", err)
+			if err := m.failed(ctx, t.ID, err, now); err != nil {
+				return err
+			}
+			continue
+		}
+
+		dbCtx, cancel := context.WithTimeout(ctx, dbTimeout)
+		_, err = m.db.ExecContext(dbCtx, `
+			UPDATE camera_tickets SET status = ?, external_id = ?, url = ?, attempts = 0, error_message = '',
+				opened_at = ?, updated_at = ?
+			WHERE id = ?
+		`, StatusOpen, externalID, link, now, now, t.ID)
+		cancel()
+		if err != nil {
+			return err
+		}
+		logger.Info("Opened camera ticket", "ticket_id", t.ID, "camera_id", *t.CameraID, "provider", t.Provider, "external_id", externalID)
+	}
+	return nil
+}
+
+// close closes the tickets of cameras that are no longer offline, or
+// are disabled or deleted. A pending ticket the tracker never accepted
+// is closed here only.
+func (m *Manager) close(ctx context.Context, now time.Time) error {
+	reasons, err := m.reasons(ctx)
+	if err != nil || len(reasons) == 0 {
+		return err
+	}
+
+	tickets, err := m.tickets(ctx, `WHERE status IN (?, ?) ORDER BY id`, StatusPending, StatusOpen)
+	if err != nil {
+		return err
+	}
+	for _, t := range tickets {
+		reason, ok := reasons[t.ID]
+		if !ok {
+			continue
+		}
+		if t.Status == StatusOpen {
+			if t.Attempts > 0 && now.Before(t.UpdatedAt.Add(backoff(t.Attempts))) {
+				continue
+			}
+			r := Resolution{Reason: reason, At: now, Downtime: now.Sub(t.OfflineSince)}
+			reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+			err := m.tracker.Close(reqCtx, t, r)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				logger.Warn("Failed to close camera ticket", "ticket_id", t.ID, "external_id", t.ExternalID, "provider", t.Provider, "error", err)
+				if err := m.failed(ctx, t.ID, err, now); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		dbCtx, cancel := context.WithTimeout(ctx, dbTimeout)
+		_, err := m.db.ExecContext(dbCtx, `
+			UPDATE camera_tickets SET status = ?, attempts = 0, error_message = '', closed_at = ?, updated_at = ?
+			WHERE id = ?
+		`, StatusClosed, now, now, t.ID)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if t.Status == StatusOpen {
+			logger.Info("Closed camera ticket", "ticket_id", t.ID, "external_id", t.ExternalID, "reason", reason)
+		}
+	}
+	return nil
+}
+
+// reasons returns why each pending or open ticket whose camera is no
+// longer offline should be closed, by ticket ID
+func (m *Manager) reasons(ctx context.Context) (map[int64]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT t.id, c.id IS NULL, COALESCE(c.enabled, FALSE), COALESCE(h.status, '')
+		FROM camera_tickets t
+		LEFT JOIN cameras c ON c.id = t.camera_id
+		LEFT JOIN camera_health h ON h.camera_id = t.camera_id
+		WHERE t.status IN (?, ?)
+	`, StatusPending, StatusOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reasons := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var deleted, enabled bool
+		var status string
+		if err := rows.Scan(&id, &deleted, &enabled, &status); err != nil {
+			return nil, err
+		}
+		switch {
+		case deleted:
+			reasons[id] = ReasonDeleted
+		case !enabled:
+			reasons[id] = ReasonDisabled
+		case status != "offline":
+			reasons[id] = ReasonOnline
+		}
+	}
+	return reasons, rows.Err()
+}
+
+// failed records a failed request to the tracker
+func (m *Manager) failed(ctx context.Context, id int64, cause error, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE camera_tickets SET attempts = attempts + 1, error_message = ?, updated_at = ? WHERE id = ?
+	`, cause.Error(), now, id)
+	return err
+}
+
+// backoff is the wait after attempts failed requests: a minute,
+// doubling up to an hour
+func backoff(attempts int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// issue gathers what a ticket tells of its camera
+func (m *Manager) issue(ctx context.Context, t Ticket) (Issue, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	issue := Issue{
+		TicketID:     t.ID,
+		CameraID:     *t.CameraID,
+		OfflineSince: t.OfflineSince,
+		Probes:       []ProbeResult{},
+		Uptime:       []DayUptime{},
+		Notes:        []string{},
+	}
+	var rtspURL string
+	var lat, lng sql.NullFloat64
+	err := m.db.QueryRowContext(ctx, `
+		SELECT c.name, COALESCE(c.description, ''), COALESCE(c.location, ''), COALESCE(a.name, ''),
+			c.latitude, c.longitude, c.private_rtsp_url, COALESCE(h.error_message, '')
+		FROM cameras c
+		LEFT JOIN areas a ON a.id = c.area_id
+		LEFT JOIN camera_health h ON h.camera_id = c.id
+		WHERE c.id = ?
+	`, issue.CameraID).Scan(&issue.Camera, &issue.Description, &issue.Location, &issue.Area,
+		&lat, &lng, &rtspURL, &issue.Error)
+	if err != nil {
+		return issue, err
+	}
+	if lat.Valid && lng.Valid {
+		issue.Latitude, issue.Longitude = &lat.Float64, &lng.Float64
+	}
+	if u, err := url.Parse(rtspURL); err == nil {
+		issue.Host = u.Hostname()
+	}
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT type, last_ok, last_error, last_checked_at FROM camera_probes WHERE camera_id = ? ORDER BY type
+	`, issue.CameraID)
+	if err != nil {
+		return issue, err
+	}
+	for rows.Next() {
+		var p ProbeResult
+		var ok sql.NullBool
+		var checked sql.NullTime
+		if err := rows.Scan(&p.Type, &ok, &p.Error, &checked); err != nil {
+			rows.Close()
+			return issue, err
+		}
+		if ok.Valid {
+			p.OK = &ok.Bool
+		}
+		if checked.Valid {
+			p.CheckedAt = &checked.Time
+		}
+		issue.Probes = append(issue.Probes, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return issue, err
+	}
+
+	rows, err = m.db.QueryContext(ctx, `
+		SELECT day, samples, online_samples FROM camera_uptime
+		WHERE camera_id = ? AND day >= ?
+		ORDER BY day
+	`, issue.CameraID, m.now().UTC().AddDate(0, 0, 1-uptimeDays).Format("2006-01-02"))
+	if err != nil {
+		return issue, err
+	}
+	for rows.Next() {
+		var d DayUptime
+		var samples, online int
+		if err := rows.Scan(&d.Day, &samples, &online); err != nil {
+			rows.Close()
+			return issue, err
+		}
+		if samples > 0 {
+			d.Percent = float64(int(1000*float64(online)/float64(samples)+0.5)) / 10
+			issue.Uptime = append(issue.Uptime, d)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return issue, err
+	}
+
+	rows, err = m.db.QueryContext(ctx, `
+		SELECT body FROM camera_notes WHERE camera_id = ? ORDER BY created_at DESC, id DESC LIMIT ?
+	`, issue.CameraID, noteCount)
+	if err != nil {
+		return issue, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return issue, err
+		}
+		issue.Notes = append(issue.Notes, body)
+	}
+	return issue, rows.Err()
+}
+
+const ticketColumns = `
+	SELECT id, camera_id, camera_name, provider, external_id, url, status, offline_since, attempts,
+		error_message, created_at, opened_at, closed_at, updated_at
+	FROM camera_tickets `
+
+func (m *Manager) tickets(ctx context.Context, where string, args ...interface{}) ([]Ticket, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+	return query(ctx, m.db, where, args...)
+}
+
+// List returns the tickets of an organization, newest first: those of
+// one camera when cameraID is not 0, those with status when it is not
+// empty, at most limit
+func List(ctx context.Context, db *sql.DB, orgID, cameraID int, status string, limit int) ([]Ticket, error) {
+	where := `WHERE organization_id = ?`
+	args := []interface{}{orgID}
+	if cameraID != 0 {
+		where += ` AND camera_id = ?`
+		args = append(args, cameraID)
+	}
+	if status != "" {
+		where += ` AND status = ?`
+		args = append(args, status)
+	}
+	return query(ctx, db, where+` ORDER BY id DESC LIMIT ?`, append(args, limit)...)
+}
+
+func query(ctx context.Context, db *sql.DB, where string, args ...interface{}) ([]Ticket, error) {
+	rows, err := db.QueryContext(ctx, ticketColumns+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Ticket{}
+	for rows.Next() {
+		var t Ticket
+		var cameraID sql.NullInt64
+		var opened, closed sql.NullTime
+		if err := rows.Scan(&t.ID, &cameraID, &t.Camera, &t.Provider, &t.ExternalID, &t.URL, &t.Status,
+			&t.OfflineSince, &t.Attempts, &t.Error, &t.CreatedAt, &opened, &closed, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if cameraID.Valid {
+			id := int(cameraID.Int64)
+			t.CameraID = &id
+		}
+		if opened.Valid {
+			t.OpenedAt = &opened.Time
+		}
+		if closed.Valid {
+			t.ClosedAt = &closed.Time
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
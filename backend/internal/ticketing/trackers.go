@@ -0,0 +1,287 @@
+package ticketing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/alerting"
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/recordings"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+)
+
+// Providers a TicketConfig may name
+const (
+	ProviderWebhook = "webhook"
+	ProviderJira    = "jira"
+	ProviderEmail   = "email"
+)
+
+// Webhook events
+const (
+	EventOpened = "ticket.opened"
+	EventClosed = "ticket.closed"
+)
+
+// FromConfig returns the tracker cfg configures, or nil when tickets
+// are off
+func FromConfig(cfg *config.Config) Tracker {
+	t := cfg.Tickets
+	switch t.Provider {
+	case ProviderWebhook:
+		return &WebhookTracker{URL: t.WebhookURL, Secret: t.WebhookSecret}
+	case ProviderJira:
+		return &JiraTracker{
+			URL:            t.JiraURL,
+			Email:          t.JiraEmail,
+			Token:          t.JiraToken,
+			Project:        t.JiraProject,
+			IssueType:      t.JiraIssueType,
+			DoneTransition: t.JiraDoneTransition,
+		}
+	case ProviderEmail:
+		a := cfg.Alerting
+		return &EmailTracker{
+			Sender: &alerting.EmailSender{
+				Addr:     net.JoinHostPort(a.SMTPHost, strconv.Itoa(a.SMTPPort)),
+				Username: a.SMTPUsername,
+				Password: a.SMTPPassword,
+				From:     a.SMTPFrom,
+			},
+			To: t.EmailTo,
+		}
+	}
+	return nil
+}
+
+// WebhookTracker posts tickets as JSON, signed like the recording
+// webhooks. The receiver may answer an opened ticket with {"id", "url"}
+// of its own; without an id the ticket is known as cctv-<ticket_id>.
+type WebhookTracker struct {
+	URL    string
+	Secret string
+}
+
+// WebhookPayload is the body of a ticket webhook
+type WebhookPayload struct {
+	Event      string `json:"event"`
+	TicketID   int64  `json:"ticket_id"`
+	ExternalID string `json:"external_id,omitempty"` // on ticket.closed
+	Summary    string `json:"summary"`
+	Text       string `json:"text"`
+	Issue      *Issue `json:"issue,omitempty"` // on ticket.opened
+	CameraID   *int   `json:"camera_id"`
+	Camera     string `json:"camera"`
+	Reason     string `json:"reason,omitempty"` // on ticket.closed
+}
+
+func (w *WebhookTracker) Open(ctx context.Context, issue Issue) (string, string, error) {
+	camera := issue.CameraID
+	body, err := w.post(ctx, WebhookPayload{
+		Event:    EventOpened,
+		TicketID: issue.TicketID,
+		Summary:  issue.Summary(),
+		Text:     issue.Text(),
+		Issue:    &issue,
+		CameraID: &camera,
+		Camera:   issue.Camera,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	var reply struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	json.Unmarshal(body, &reply)
+	if reply.ID == "" {
+		reply.ID = "cctv-" + strconv.FormatInt(issue.TicketID, 10)
+	}
+	return reply.ID, reply.URL, nil
+}
+
+func (w *WebhookTracker) Close(ctx context.Context, t Ticket, r Resolution) error {
+	_, err := w.post(ctx, WebhookPayload{
+		Event:      EventClosed,
+		TicketID:   t.ID,
+		ExternalID: t.ExternalID,
+		Summary:    "Camera " + t.Camera + ": " + r.Reason,
+		Text:       r.Text(t.Camera),
+		CameraID:   t.CameraID,
+		Camera:     t.Camera,
+		Reason:     r.Reason,
+	})
+	return err
+}
+
+// post sends p and returns the response body
+func (w *WebhookTracker) post(ctx context.Context, p WebhookPayload) ([]byte, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CCTV-Event", p.Event)
+	req.Header.Set("X-CCTV-Delivery", p.Event+"-"+strconv.FormatInt(p.TicketID, 10))
+	req.Header.Set("X-CCTV-Timestamp", timestamp)
+	req.Header.Set("X-CCTV-Signature", recordings.Signature(w.Secret, timestamp, body))
+	return do(req)
+}
+
+// JiraTracker opens issues through the Jira REST API, authenticated
+// with an account's email and API token. Closing an issue comments the
+// resolution on it and applies DoneTransition; an issue without that
+// transition, such as one closed by hand, is left as it is.
+type JiraTracker struct {
+	URL            string // the site, such as https://example.atlassian.net
+	Email          string
+	Token          string
+	Project        string // project key
+	IssueType      string
+	DoneTransition string
+}
+
+func (j *JiraTracker) Open(ctx context.Context, issue Issue) (string, string, error) {
+	body, err := j.request(ctx, http.MethodPost, "/rest/api/2/issue", map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": j.Project},
+			"issuetype":   map[string]string{"name": j.IssueType},
+			"summary":     issue.Summary(),
+			"description": issue.Text(),
+			"labels":      []string{"cctv", "cctv-camera-" + strconv.Itoa(issue.CameraID)},
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil || created.Key == "" {
+		return "", "", fmt.Errorf("unexpected response from Jira: %s", truncate(body))
+	}
+	return created.Key, j.URL + "/browse/" + created.Key, nil
+}
+
+func (j *JiraTracker) Close(ctx context.Context, t Ticket, r Resolution) error {
+	path := "/rest/api/2/issue/" + t.ExternalID
+	if _, err := j.request(ctx, http.MethodPost, path+"/comment", map[string]string{"body": r.Text(t.Camera)}); err != nil {
+		return err
+	}
+
+	body, err := j.request(ctx, http.MethodGet, path+"/transitions", nil)
+	if err != nil {
+		return err
+	}
+	var list struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return fmt.Errorf("unexpected response from Jira: %s", truncate(body))
+	}
+	for _, tr := range list.Transitions {
+		if strings.EqualFold(tr.Name, j.DoneTransition) || strings.EqualFold(tr.To.Name, j.DoneTransition) {
+			_, err := j.request(ctx, http.MethodPost, path+"/transitions", map[string]interface{}{
+				"transition": map[string]string{"id": tr.ID},
+			})
+			return err
+		}
+	}
+	return nil
+}
+
+// request calls the Jira API with body as JSON, nil for none, and
+// returns the response body
+func (j *JiraTracker) request(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, j.URL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(j.Email, j.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return do(req)
+}
+
+// EmailTracker mails tickets to a maintenance mailbox or helpdesk. The
+// subject carries CCTV-<ticket_id>, which is the ticket's ID, so the
+// mail closing it lands in the same thread.
+type EmailTracker struct {
+	Sender alerting.Sender
+	To     string // comma-separated
+}
+
+func (e *EmailTracker) Open(ctx context.Context, issue Issue) (string, string, error) {
+	id := "CCTV-" + strconv.FormatInt(issue.TicketID, 10)
+	err := e.Sender.Send(ctx, e.To, alerting.Message{
+		Subject: "[" + id + "] " + issue.Summary(),
+		Text:    issue.Text(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return id, "", nil
+}
+
+func (e *EmailTracker) Close(ctx context.Context, t Ticket, r Resolution) error {
+	return e.Sender.Send(ctx, e.To, alerting.Message{
+		Subject: "[" + t.ExternalID + "] Resolved: camera " + t.Camera + " " + strings.TrimPrefix(r.Reason, "camera "),
+		Text:    r.Text(t.Camera),
+	})
+}
+
+// do sends req and returns the response body, failing on anything but
+// a 2xx response
+func do(req *http.Request) ([]byte, error) {
+	resp, err := httpclient.Shared().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, truncate(body))
+	}
+	return body, nil
+}
+
+// truncate shortens a response body for an error message
+func truncate(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if len(s) > 200 {
+		s = s[:200] + "…"
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package ticketing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/recordings"
+)
+
+func TestWebhookTracker(t *testing.T) {
+	var events []WebhookPayload
+	reply := `{"id":"HD-42","url":"https://helpdesk.example/42"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-CCTV-Signature"); got != recordings.Signature("s3cret", r.Header.Get("X-CCTV-Timestamp"), body) {
+			t.Errorf("Signature %q does not match the body", got)
+		}
+		var p WebhookPayload
+		json.Unmarshal(body, &p)
+		events = append(events, p)
+		io.WriteString(w, reply)
+	}))
+	defer srv.Close()
+
+	w := &WebhookTracker{URL: srv.URL, Secret: "s3cret"}
+	ctx := context.Background()
+	issue := Issue{TicketID: 7, CameraID: 1, Camera: "Gate", OfflineSince: time.Now()}
+
+	id, link, err := w.Open(ctx, issue)
+	if err != nil || id != "HD-42" || link != "https://helpdesk.example/42" {
+		t.Fatalf("Open = %q, %q, %v", id, link, err)
+	}
+	reply = ""
+	if id, _, _ := w.Open(ctx, issue); id != "cctv-7" {
+		t.Errorf("Open without a reply = %q, want cctv-7", id)
+	}
+
+	cameraID := 1
+	err = w.Close(ctx, Ticket{ID: 7, CameraID: &cameraID, Camera: "Gate", ExternalID: "HD-42"}, Resolution{Reason: ReasonOnline, At: time.Now()})
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(events) != 3 || events[0].Event != EventOpened || events[0].Issue == nil ||
+		events[2].Event != EventClosed || events[2].ExternalID != "HD-42" || events[2].Reason != ReasonOnline {
+		t.Errorf("Events = %+v", events)
+	}
+}
+
+func TestJiraTracker(t *testing.T) {
+	var calls []string
+	var created, transition map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ops@example.com" || pass != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /rest/api/2/issue":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id":"10001","key":"OPS-12","self":"x"}`)
+		case "POST /rest/api/2/issue/OPS-12/comment":
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{}`)
+		case "GET /rest/api/2/issue/OPS-12/transitions":
+			io.WriteString(w, `{"transitions":[{"id":"11","name":"Start","to":{"name":"In Progress"}},{"id":"31","name":"Resolve","to":{"name":"Done"}}]}`)
+		case "POST /rest/api/2/issue/OPS-12/transitions":
+			json.NewDecoder(r.Body).Decode(&transition)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	j := &JiraTracker{URL: srv.URL, Email: "ops@example.com", Token: "token", Project: "OPS", IssueType: "Task", DoneTransition: "done"}
+	ctx := context.Background()
+
+	id, link, err := j.Open(ctx, Issue{TicketID: 1, CameraID: 1, Camera: "Gate", OfflineSince: time.Now()})
+	if err != nil || id != "OPS-12" || link != srv.URL+"/browse/OPS-12" {
+		t.Fatalf("Open = %q, %q, %v", id, link, err)
+	}
+	fields, _ := created["fields"].(map[string]interface{})
+	if project, _ := fields["project"].(map[string]interface{}); project["key"] != "OPS" {
+		t.Errorf("Issue fields = %v", fields)
+	}
+
+	if err := j.Close(ctx, Ticket{ExternalID: "OPS-12", Camera: "Gate"}, Resolution{Reason: ReasonOnline, At: time.Now()}); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if tr, _ := transition["transition"].(map[string]interface{}); tr["id"] != "31" {
+		t.Errorf("Transition = %v, want the one to Done", transition)
+	}
+	if len(calls) != 4 {
+		t.Errorf("Calls = %v", calls)
+	}
+
+	j.Token = "wrong"
+	if _, _, err := j.Open(ctx, Issue{Camera: "Gate"}); err == nil {
+		t.Error("Open succeeded with a rejected token")
+	}
+}
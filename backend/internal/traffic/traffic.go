@@ -0,0 +1,232 @@
+// Package traffic counts what the stream proxy serves: requests, bytes
+// and time spent per camera, hour and kind of request, kept in
+// stream_traffic. Each instance adds up its requests in memory and adds
+// them to the table every minute, so the table holds the sum of every
+// instance.
+//
+// Watcher compares each hour that ended with the same hour on the days
+// before and alerts on a camera serving far more than usual, often
+// another site hotlinking its stream, or nothing at all when it usually
+// has viewers, often a broken player.
+package traffic
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Kinds of stream request
+const (
+	HLS   = "hls"   // playlists and segments
+	MSE   = "mse"   // fMP4 over one long request
+	Audio = "audio" // AAC over one long request
+)
+
+const (
+	// flushInterval is how often the counts are added to the table
+	flushInterval = time.Minute
+
+	// flushTimeout bounds one flush
+	flushTimeout = 10 * time.Second
+)
+
+// Retention is how long hourly counts are kept
+const Retention = 90 * 24 * time.Hour
+
+type key struct {
+	cameraID int
+	hour     time.Time
+	kind     string
+}
+
+type counts struct {
+	requests int64
+	bytes    int64
+	duration time.Duration
+}
+
+// Meter adds up stream requests until they are flushed; it is safe for
+// concurrent use
+type Meter struct {
+	mu      sync.Mutex
+	pending map[key]*counts
+	now     func() time.Time
+}
+
+func New() *Meter {
+	return &Meter{pending: map[key]*counts{}, now: time.Now}
+}
+
+var shared = New()
+
+// Shared returns the process-wide meter the stream proxy records to
+func Shared() *Meter {
+	return shared
+}
+
+// Record counts a request of kind for cameraID that ended after
+// sending bytes and taking d
+func (m *Meter) Record(cameraID int, kind string, bytes int64, d time.Duration) {
+	m.add(cameraID, kind, 1, bytes, d)
+}
+
+// Sent counts bytes sent by a long request of kind that is still
+// running, in the hour they are sent; Record counts the request itself
+// once it ends
+func (m *Meter) Sent(cameraID int, kind string, bytes int64) {
+	m.add(cameraID, kind, 0, bytes, 0)
+}
+
+func (m *Meter) add(cameraID int, kind string, requests, bytes int64, d time.Duration) {
+	k := key{cameraID, m.now().UTC().Truncate(time.Hour), kind}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.pending[k]
+	if !ok {
+		c = &counts{}
+		m.pending[k] = c
+	}
+	c.requests += requests
+	c.bytes += bytes
+	c.duration += d
+}
+
+// Flush adds the counts to stream_traffic. Counts that fail to be
+// written are kept for the next flush.
+func (m *Meter) Flush(ctx context.Context, db *sql.DB) error {
+	m.mu.Lock()
+	batch := m.pending
+	m.pending = map[key]*counts{}
+	m.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := write(ctx, db, batch)
+	if err == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, c := range batch {
+		if later, ok := m.pending[k]; ok {
+			c.requests += later.requests
+			c.bytes += later.bytes
+			c.duration += later.duration
+		}
+		m.pending[k] = c
+	}
+	return err
+}
+
+func write(ctx context.Context, db *sql.DB, batch map[key]*counts) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for k, c := range batch {
+		// A camera deleted since is skipped rather than failing the
+		// batch on the foreign key
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO stream_traffic (camera_id, hour, kind, requests, bytes, duration_ms)
+			SELECT id, ?, ?, ?, ?, ? FROM cameras WHERE id = ?
+			ON CONFLICT(camera_id, hour, kind) DO UPDATE SET
+				requests = stream_traffic.requests + excluded.requests,
+				bytes = stream_traffic.bytes + excluded.bytes,
+				duration_ms = stream_traffic.duration_ms + excluded.duration_ms
+		`, k.hour, k.kind, c.requests, c.bytes, c.duration.Milliseconds(), k.cameraID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Writer returns a loop that flushes m to db every minute until ctx is
+// cancelled, then once more. Every instance runs its own.
+func Writer(db *sql.DB, m *Meter) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+				defer cancel()
+				if err := m.Flush(ctx, db); err != nil {
+					logger.Warn("Failed to write stream traffic", "error", err)
+				}
+				return
+			case <-ticker.C:
+			}
+			flushCtx, cancel := context.WithTimeout(ctx, flushTimeout)
+			if err := m.Flush(flushCtx, db); err != nil {
+				logger.Warn("Failed to write stream traffic", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Hour is what the streams of a camera served in one hour
+type Hour struct {
+	CameraID   int       `json:"camera_id"`
+	Camera     string    `json:"camera"`
+	Hour       time.Time `json:"hour"`
+	Kind       string    `json:"kind"`
+	Requests   int64     `json:"requests"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// Filter picks the hours Hours returns. Zero values match every camera
+// and kind.
+type Filter struct {
+	CameraID int
+	Kind     string
+	From, To time.Time // From inclusive, To exclusive
+	Limit    int
+}
+
+// Hours returns the traffic of the cameras of the organization of ctx
+// matching f, oldest hour first
+func Hours(ctx context.Context, db *sql.DB, f Filter) ([]Hour, error) {
+	where, args := "c.organization_id = ? AND t.hour >= ? AND t.hour < ?", []interface{}{tenant.OrgID(ctx), f.From.UTC(), f.To.UTC()}
+	if f.CameraID > 0 {
+		where += " AND t.camera_id = ?"
+		args = append(args, f.CameraID)
+	}
+	if f.Kind != "" {
+		where += " AND t.kind = ?"
+		args = append(args, f.Kind)
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.camera_id, c.name, t.hour, t.kind, t.requests, t.bytes, t.duration_ms
+		FROM stream_traffic t JOIN cameras c ON c.id = t.camera_id
+		WHERE `+where+`
+		ORDER BY t.hour ASC, t.camera_id ASC, t.kind ASC
+		LIMIT ?
+	`, append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Hour{}
+	for rows.Next() {
+		var h Hour
+		if err := rows.Scan(&h.CameraID, &h.Camera, &h.Hour, &h.Kind, &h.Requests, &h.Bytes, &h.DurationMs); err != nil {
+			return nil, err
+		}
+		h.Hour = h.Hour.UTC()
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,146 @@
+package traffic
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/events"
+)
+
+func TestMeter(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+	m := New()
+	m.now = func() time.Time { return now }
+
+	m.Record(1, HLS, 100, 2*time.Second)
+	m.Sent(1, MSE, 500)
+	m.Record(1, MSE, 0, time.Minute)
+	// A deleted camera does not fail the batch
+	m.Record(99, HLS, 100, time.Second)
+	if err := m.Flush(ctx, db); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	// Other instances, or later flushes, add to the same hour
+	m.Record(1, HLS, 50, time.Second)
+	if err := m.Flush(ctx, db); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	now = now.Add(time.Hour)
+	m.Record(1, HLS, 10, time.Second)
+	if err := m.Flush(ctx, db); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	hour := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	list, err := Hours(ctx, db, Filter{From: hour, To: hour.Add(time.Hour), Limit: 10})
+	if err != nil {
+		t.Fatalf("Hours failed: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Expected the hls and mse traffic of one hour, got %+v", list)
+	}
+	if h := list[0]; h.Kind != HLS || h.Camera != "Gate" || !h.Hour.Equal(hour) || h.Requests != 2 || h.Bytes != 150 || h.DurationMs != 3000 {
+		t.Errorf("Expected the hls requests added up, got %+v", h)
+	}
+	if h := list[1]; h.Kind != MSE || h.Requests != 1 || h.Bytes != 500 || h.DurationMs != 60000 {
+		t.Errorf("Expected the mse request with its bytes, got %+v", h)
+	}
+
+	list, err = Hours(ctx, db, Filter{Kind: HLS, From: hour, To: hour.Add(2 * time.Hour), Limit: 10})
+	if err != nil || len(list) != 2 || list[1].Bytes != 10 {
+		t.Errorf("Expected the hls traffic of both hours, got %+v (%v)", list, err)
+	}
+	if list, _ := Hours(ctx, db, Filter{CameraID: 2, From: hour, To: hour.Add(2 * time.Hour), Limit: 10}); len(list) != 0 {
+		t.Errorf("Expected nothing for another camera, got %+v", list)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	db := dbtest.Open(t)
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES
+		(1, 'Gate', 'rtsp://a', 'gate'), (2, 'Market', 'rtsp://b', 'market'), (3, 'Yard', 'rtsp://c', 'yard'),
+		(4, 'Quiet', 'rtsp://d', 'quiet'), (5, 'Square', 'rtsp://e', 'square')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO camera_health (camera_id, status) VALUES (3, 'offline')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	// The hour judged at 12:30 is 11:00; each camera but Quiet usually
+	// serves 1000 bytes then
+	hour := time.Date(2026, 3, 10, 11, 0, 0, 0, time.UTC)
+	add := func(cameraID int, at time.Time, bytes int64) {
+		t.Helper()
+		if _, err := db.Exec(`INSERT INTO stream_traffic (camera_id, hour, kind, requests, bytes) VALUES (?, ?, ?, 1, ?)`,
+			cameraID, at, HLS, bytes); err != nil {
+			t.Fatalf("Failed to add traffic: %v", err)
+		}
+	}
+	for day := 1; day <= 3; day++ {
+		for _, id := range []int{1, 2, 3, 5} {
+			add(id, hour.AddDate(0, 0, -day), 1000)
+		}
+	}
+	add(1, hour, 10000)
+	add(4, hour, 50)
+	add(5, hour, 1200)
+
+	published := make(chan events.Event, 8)
+	events.Subscribe("stream.traffic_*", "test", func(e events.Event) { published <- e })
+	check := func(w *Watcher, at time.Time) []string {
+		t.Helper()
+		w.now = func() time.Time { return at }
+		if err := w.check(context.Background()); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		var got []string
+		for {
+			select {
+			case e := <-published:
+				got = append(got, e.Type+" "+e.Data["camera"].(string))
+			case <-time.After(100 * time.Millisecond):
+				sort.Strings(got)
+				return got
+			}
+		}
+	}
+
+	opts := WatchOptions{SpikeFactor: 5, Drops: true, MinBytes: 100, BaselineDays: 7}
+	if got := check(NewWatcher(db, opts), hour.Add(90*time.Minute)); len(got) != 0 {
+		t.Errorf("Expected no alerts without a week of traffic, got %v", got)
+	}
+
+	opts.BaselineDays = 3
+	w := NewWatcher(db, opts)
+	got := check(w, hour.Add(90*time.Minute))
+	if len(got) != 2 || got[0] != events.StreamTrafficDropped+" Market" || got[1] != events.StreamTrafficSpike+" Gate" {
+		t.Fatalf("Expected Gate spiking and Market dropped, got %v", got)
+	}
+	if got := check(w, hour.Add(100*time.Minute)); len(got) != 0 {
+		t.Errorf("Expected each hour judged once, got %v", got)
+	}
+
+	// A camera still spiking is not alerted on again
+	add(1, hour.Add(time.Hour), 10000)
+	if got := check(w, hour.Add(150*time.Minute)); len(got) != 0 {
+		t.Errorf("Expected no repeat alerts, got %v", got)
+	}
+
+	// Counts past the retention are removed
+	add(5, hour.Add(-Retention-time.Hour), 1)
+	check(w, hour.Add(210*time.Minute))
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM stream_traffic WHERE camera_id = 5`).Scan(&n)
+	if n != 4 {
+		t.Errorf("Expected the old count removed, %d left", n)
+	}
+}
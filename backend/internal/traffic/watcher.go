@@ -0,0 +1,210 @@
+package traffic
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/events"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+const (
+	// checkInterval is how often Watcher looks for an hour to judge
+	checkInterval = time.Minute
+
+	// settle is how long after an hour ends it is judged, so the last
+	// flush of every instance is in
+	settle = 3 * flushInterval
+
+	// checkTimeout bounds the queries of one check
+	checkTimeout = 30 * time.Second
+)
+
+// WatchOptions configure a Watcher
+type WatchOptions struct {
+	SpikeFactor  float64 // times the usual traffic that is a spike; 0 turns spike alerts off
+	Drops        bool    // alert on cameras serving nothing when they usually do
+	MinBytes     int64   // traffic of an hour, or its usual traffic for drops, before either alert
+	BaselineDays int     // days whose same hour make the usual traffic
+}
+
+// Watcher publishes events.StreamTrafficSpike and
+// events.StreamTrafficDropped when an hour's traffic of a camera is far
+// from the average of the same hour on the BaselineDays before, days
+// without traffic counting as nothing. Hours are judged once the table
+// holds BaselineDays of traffic. A camera is alerted on once, then
+// again after an hour back to normal. Drops are not alerted on for
+// disabled cameras or offline ones, which have their own alert.
+type Watcher struct {
+	db      *sql.DB
+	opts    WatchOptions
+	now     func() time.Time
+	judged  time.Time
+	flagged map[int]string // event type of the cameras last alerted on
+}
+
+func NewWatcher(db *sql.DB, opts WatchOptions) *Watcher {
+	return &Watcher{db: db, opts: opts, now: time.Now, flagged: map[int]string{}}
+}
+
+// Run judges each hour once it ended, and removes counts older than
+// Retention, until ctx is cancelled. The counts are those of every
+// instance, so it runs on the leader only.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.check(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to check stream traffic", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check judges the latest hour that ended and settled, unless it
+// already did
+func (w *Watcher) check(ctx context.Context) error {
+	now := w.now().UTC()
+	hour := now.Add(-settle).Truncate(time.Hour).Add(-time.Hour)
+	if !hour.After(w.judged) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	if _, err := w.db.ExecContext(ctx, `DELETE FROM stream_traffic WHERE hour < ?`, now.Add(-Retention)); err != nil {
+		return err
+	}
+	if w.opts.SpikeFactor <= 0 && !w.opts.Drops {
+		w.judged = hour
+		return nil
+	}
+
+	first, err := w.firstHour(ctx)
+	if err != nil {
+		return err
+	}
+	if first.IsZero() || first.After(hour.AddDate(0, 0, -w.opts.BaselineDays)) {
+		// Too little history to tell what is usual
+		w.judged = hour
+		return nil
+	}
+
+	current, err := w.bytes(ctx, []time.Time{hour})
+	if err != nil {
+		return err
+	}
+	before := make([]time.Time, 0, w.opts.BaselineDays)
+	for day := 1; day <= w.opts.BaselineDays; day++ {
+		before = append(before, hour.AddDate(0, 0, -day))
+	}
+	baseline, err := w.bytes(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	rows, err := w.db.QueryContext(ctx, `
+		SELECT c.id, c.name, COALESCE(h.status, '')
+		FROM cameras c LEFT JOIN camera_health h ON h.camera_id = c.id
+		WHERE c.enabled = ?
+	`, true)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	seen := map[int]bool{}
+	for rows.Next() {
+		var id int
+		var name, status string
+		if err := rows.Scan(&id, &name, &status); err != nil {
+			return err
+		}
+		seen[id] = true
+
+		bytes, usual := current[id], baseline[id]/int64(w.opts.BaselineDays)
+		var eventType string
+		switch {
+		case w.opts.SpikeFactor > 0 && bytes >= w.opts.MinBytes && float64(bytes) > w.opts.SpikeFactor*float64(usual):
+			eventType = events.StreamTrafficSpike
+		case w.opts.Drops && bytes == 0 && usual >= w.opts.MinBytes && status != "offline":
+			eventType = events.StreamTrafficDropped
+		}
+		if eventType == "" {
+			delete(w.flagged, id)
+			continue
+		}
+		if w.flagged[id] == eventType {
+			continue
+		}
+		w.flagged[id] = eventType
+		logger.Warn("Unusual stream traffic", "camera_id", id, "event", eventType, "bytes", bytes, "baseline_bytes", usual)
+		events.Publish(events.Event{
+			Type:     eventType,
+			Time:     now,
+			Resource: "camera",
+			Data: map[string]interface{}{
+				"camera_id":      id,
+				"camera":         name,
+				"hour":           hour,
+				"bytes":          bytes,
+				"baseline_bytes": usual,
+			},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id := range w.flagged {
+		if !seen[id] {
+			delete(w.flagged, id)
+		}
+	}
+	w.judged = hour
+	return nil
+}
+
+// firstHour is the oldest hour with traffic, or the zero time
+func (w *Watcher) firstHour(ctx context.Context) (time.Time, error) {
+	var first time.Time
+	err := w.db.QueryRowContext(ctx, `SELECT hour FROM stream_traffic ORDER BY hour ASC LIMIT 1`).Scan(&first)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return first, err
+}
+
+// bytes sums the traffic of each camera over hours
+func (w *Watcher) bytes(ctx context.Context, hours []time.Time) (map[int]int64, error) {
+	args := make([]interface{}, len(hours))
+	for i, h := range hours {
+		args[i] = h
+	}
+	rows, err := w.db.QueryContext(ctx, `
+		SELECT camera_id, SUM(bytes) FROM stream_traffic
+		WHERE hour IN (?`+strings.Repeat(", ?", len(hours)-1)+`)
+		GROUP BY camera_id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := map[int]int64{}
+	for rows.Next() {
+		var id int
+		var sum int64
+		if err := rows.Scan(&id, &sum); err != nil {
+			return nil, err
+		}
+		sums[id] = sum
+	}
+	return sums, rows.Err()
+}
@@ -0,0 +1,144 @@
+package uploads
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxSize bounds an uploaded file; with the multipart overhead it must
+// fit in the server's 1 MB body limit
+const MaxSize = 768 << 10
+
+// maxPixels bounds the decoded size of an image, so a small file cannot
+// claim a huge canvas
+const maxPixels = 40_000_000
+
+// jpegQuality is used when re-encoding JPEGs
+const jpegQuality = 85
+
+// Errors of Process, worded for the person uploading
+var (
+	ErrTooLarge    = errors.New("must be at most 768 KB")
+	ErrUnsupported = errors.New("must be a JPEG or PNG image")
+	ErrCorrupt     = errors.New("is not a readable image")
+	ErrTooManyPx   = errors.New("has too many pixels")
+)
+
+// Image is a processed upload, ready to store
+type Image struct {
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+}
+
+// ext is the file extension of the image's type
+func (img Image) ext() string {
+	if img.ContentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// Process checks data is a JPEG or PNG within the limits of spec and
+// re-encodes it: cropped to a square when spec asks for one, scaled
+// down to fit MaxSide, and without the metadata (such as the GPS
+// position of a phone photo) the original carried. PNGs stay PNG to
+// keep their transparency.
+func Process(spec Spec, data []byte) (Image, error) {
+	if len(data) > MaxSize {
+		return Image{}, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return Image{}, ErrUnsupported
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrCorrupt
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return Image{}, ErrTooManyPx
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrCorrupt
+	}
+
+	bounds := src.Bounds()
+	if spec.Square {
+		bounds = centerSquare(bounds)
+	}
+	w, h := fit(bounds.Dx(), bounds.Dy(), spec.MaxSide)
+	out := scale(src, bounds, w, h)
+
+	var buf bytes.Buffer
+	if contentType == "image/png" {
+		err = png.Encode(&buf, out)
+	} else {
+		err = jpeg.Encode(&buf, out, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return Image{}, fmt.Errorf("encode image: %w", err)
+	}
+	return Image{ContentType: contentType, Data: buf.Bytes(), Width: w, Height: h}, nil
+}
+
+// centerSquare is the largest square in the middle of r
+func centerSquare(r image.Rectangle) image.Rectangle {
+	side := r.Dx()
+	if r.Dy() < side {
+		side = r.Dy()
+	}
+	x := r.Min.X + (r.Dx()-side)/2
+	y := r.Min.Y + (r.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
+
+// fit scales w×h down to fit in maxSide×maxSide, keeping the aspect
+// ratio; images already small enough keep their size
+func fit(w, h, maxSide int) (int, int) {
+	if maxSide <= 0 || (w <= maxSide && h <= maxSide) {
+		return w, h
+	}
+	if w >= h {
+		return maxSide, max(1, h*maxSide/w)
+	}
+	return max(1, w*maxSide/h), maxSide
+}
+
+// scale copies the r part of src to a w×h image, averaging the source
+// pixels under each destination pixel so downscaled photos stay smooth
+func scale(src image.Image, r image.Rectangle, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := r.Dx(), r.Dy()
+	for y := 0; y < h; y++ {
+		y0 := r.Min.Y + y*sh/h
+		y1 := max(r.Min.Y+(y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := r.Min.X + x*sw/w
+			x1 := max(r.Min.X+(x+1)*sw/w, x0+1)
+
+			var rs, gs, bs, as, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					rs, gs, bs, as = rs+uint64(cr), gs+uint64(cg), bs+uint64(cb), as+uint64(ca)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(rs / n >> 8)
+			dst.Pix[i+1] = uint8(gs / n >> 8)
+			dst.Pix[i+2] = uint8(bs / n >> 8)
+			dst.Pix[i+3] = uint8(as / n >> 8)
+		}
+	}
+	return dst
+}
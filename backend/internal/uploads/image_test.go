@@ -0,0 +1,93 @@
+package uploads
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testPNG is a w×h PNG, red on the left half and blue on the right
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	t.Run("Scaled down to fit", func(t *testing.T) {
+		img, err := Process(Spec{MaxSide: 100}, testPNG(t, 400, 200))
+		if err != nil {
+			t.Fatalf("Failed to process: %v", err)
+		}
+		if img.ContentType != "image/png" || img.Width != 100 || img.Height != 50 {
+			t.Fatalf("Expected a 100x50 PNG, got %s %dx%d", img.ContentType, img.Width, img.Height)
+		}
+		out, err := png.Decode(bytes.NewReader(img.Data))
+		if err != nil || out.Bounds().Dx() != 100 || out.Bounds().Dy() != 50 {
+			t.Fatalf("Expected the data to be the 100x50 PNG, got %v, %v", out.Bounds(), err)
+		}
+		if r, _, b, _ := out.At(10, 25).RGBA(); r>>8 != 255 || b != 0 {
+			t.Errorf("Expected the left side to stay red, got %v", out.At(10, 25))
+		}
+	})
+
+	t.Run("Cropped square", func(t *testing.T) {
+		img, err := Process(Spec{MaxSide: 64, Square: true}, testPNG(t, 300, 100))
+		if err != nil {
+			t.Fatalf("Failed to process: %v", err)
+		}
+		if img.Width != 64 || img.Height != 64 {
+			t.Errorf("Expected 64x64, got %dx%d", img.Width, img.Height)
+		}
+	})
+
+	t.Run("Small images keep their size", func(t *testing.T) {
+		img, err := Process(Spec{MaxSide: 256}, testPNG(t, 40, 30))
+		if err != nil || img.Width != 40 || img.Height != 30 {
+			t.Errorf("Expected 40x30, got %dx%d, %v", img.Width, img.Height, err)
+		}
+	})
+
+	t.Run("JPEG stays JPEG", func(t *testing.T) {
+		var buf bytes.Buffer
+		jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 20, 20)), nil)
+		img, err := Process(Spec{MaxSide: 10}, buf.Bytes())
+		if err != nil || img.ContentType != "image/jpeg" || img.ext() != ".jpg" {
+			t.Errorf("Expected a JPEG, got %q, %v", img.ContentType, err)
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"Too large", make([]byte, MaxSize+1), ErrTooLarge},
+		{"Not an image", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), ErrUnsupported},
+		{"GIF", []byte("GIF89a\x01\x00\x01\x00"), ErrUnsupported},
+		{"Truncated PNG", testPNG(t, 10, 10)[:40], ErrCorrupt},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Process(Spec{MaxSide: 100}, tc.data); !errors.Is(err, tc.err) {
+				t.Errorf("Expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
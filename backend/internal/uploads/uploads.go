@@ -0,0 +1,249 @@
+// Package uploads stores the images people upload: user avatars,
+// sponsor logos, branding images and photos attached to cameras. Each
+// is checked, resized for its kind and re-encoded (see Process), then
+// kept in a Storage under a key made from its content, so the same
+// image uploaded twice is stored once and a key's file never changes,
+// letting it be cached for good.
+//
+// The uploads table records every stored file. An upload nothing refers
+// to any more, such as a replaced avatar, is removed by Store.Run once
+// it is older than a day; see references.
+package uploads
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Kinds of upload
+const (
+	KindAvatar      = "avatar"
+	KindSponsorLogo = "sponsor_logo"
+	KindBranding    = "branding"
+	KindAttachment  = "camera_attachment"
+)
+
+// Spec is how the images of a kind are processed
+type Spec struct {
+	MaxSide int  // scaled down to fit a square of this side
+	Square  bool // cropped to the square in the middle first
+}
+
+// Specs of the kinds
+var Specs = map[string]Spec{
+	KindAvatar:      {MaxSide: 256, Square: true},
+	KindSponsorLogo: {MaxSide: 512},
+	KindBranding:    {MaxSide: 1920},
+	KindAttachment:  {MaxSide: 1920},
+}
+
+// CacheControl is sent with every file: a key's content never changes
+const CacheControl = "public, max-age=31536000, immutable"
+
+// ErrUnknownKind is returned by Save for a kind not in Specs
+var ErrUnknownKind = errors.New("unknown upload kind")
+
+const (
+	gcInterval = time.Hour
+
+	// gcGrace keeps a new upload that nothing refers to yet, such as a
+	// logo uploaded before the settings naming it are saved
+	gcGrace = 24 * time.Hour
+)
+
+// keyPattern matches the keys Save makes; anything else is not a file
+// of ours
+var keyPattern = regexp.MustCompile(`^[a-z_]+-[0-9a-f]{32}\.(jpg|png)$`)
+
+// ValidKey reports whether key could name an upload
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// references are the places an upload is used from, as conditions on
+// the uploads row; an upload matching none of them is an orphan
+var references = []string{
+	`EXISTS (SELECT 1 FROM users WHERE avatar = uploads.key)`,
+	`EXISTS (SELECT 1 FROM settings WHERE value LIKE '%' || uploads.key || '%')`,
+	`EXISTS (SELECT 1 FROM camera_attachments WHERE upload_key = uploads.key)`,
+}
+
+// Upload is a stored file
+type Upload struct {
+	Key         string    `json:"key"`
+	URL         string    `json:"url"`
+	Kind        string    `json:"kind"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Store saves uploads to a Storage and records them in the database
+type Store struct {
+	db        *sql.DB
+	storage   Storage
+	publicURL string
+	now       func() time.Time
+}
+
+// New returns a store keeping files in storage. Their URLs start with
+// publicURL, or the server's own /api/public/uploads when it is empty.
+func New(db *sql.DB, storage Storage, publicURL string) *Store {
+	if publicURL == "" {
+		publicURL = "/api/public/uploads"
+	}
+	return &Store{db: db, storage: storage, publicURL: strings.TrimSuffix(publicURL, "/"), now: time.Now}
+}
+
+// FromConfig returns a store on the storage cfg.Uploads names
+func FromConfig(db *sql.DB, cfg *config.Config) *Store {
+	var storage Storage = NewDirStorage(cfg.Uploads.Path)
+	if cfg.Uploads.Storage == "s3" {
+		storage = NewS3Storage(S3Options{
+			Endpoint:  cfg.Uploads.S3Endpoint,
+			Region:    cfg.Uploads.S3Region,
+			Bucket:    cfg.Uploads.S3Bucket,
+			AccessKey: cfg.Uploads.S3AccessKey,
+			SecretKey: cfg.Uploads.S3SecretKey,
+		})
+	}
+	return New(db, storage, cfg.Uploads.PublicURL)
+}
+
+// URL is where the file of key is served
+func (s *Store) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return s.publicURL + "/" + key
+}
+
+// Save processes data as an image of kind and stores it for orgID. The
+// errors of Process are returned as they are, for the uploader to see.
+func (s *Store) Save(ctx context.Context, kind string, orgID int, userID *int, data []byte) (Upload, error) {
+	spec, ok := Specs[kind]
+	if !ok {
+		return Upload{}, ErrUnknownKind
+	}
+	img, err := Process(spec, data)
+	if err != nil {
+		return Upload{}, err
+	}
+	sum := sha256.Sum256(img.Data)
+	u := Upload{
+		Key:         kind + "-" + hex.EncodeToString(sum[:16]) + img.ext(),
+		Kind:        kind,
+		ContentType: img.ContentType,
+		Size:        len(img.Data),
+		Width:       img.Width,
+		Height:      img.Height,
+		CreatedAt:   s.now().UTC(),
+	}
+	u.URL = s.URL(u.Key)
+
+	// Recorded before it is stored: if the server stops in between, the
+	// collector removes the row, while a file without one would stay
+	// forever. A second upload of the same image renews its grace.
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO uploads (key, kind, content_type, size, width, height, organization_id, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET created_at = excluded.created_at
+	`, u.Key, u.Kind, u.ContentType, u.Size, u.Width, u.Height, orgID, userID, u.CreatedAt)
+	if err != nil {
+		return Upload{}, err
+	}
+	if err := s.storage.Put(ctx, u.Key, u.ContentType, img.Data); err != nil {
+		return Upload{}, err
+	}
+	return u, nil
+}
+
+// Open returns the file of key and its content type
+func (s *Store) Open(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	if !ValidKey(key) {
+		return nil, "", ErrNotFound
+	}
+	var contentType string
+	err := s.db.QueryRowContext(ctx, `SELECT content_type FROM uploads WHERE key = ?`, key).Scan(&contentType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := s.storage.Open(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, contentType, nil
+}
+
+// Collect removes the uploads older than the grace period that nothing
+// refers to, and returns how many
+func (s *Store) Collect(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT key FROM uploads WHERE created_at < ? AND NOT (`+strings.Join(references, " OR ")+`)
+	`, s.now().UTC().Add(-gcGrace))
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			return removed, err
+		}
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM uploads WHERE key = ?`, key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Run collects orphaned uploads every hour until ctx is cancelled. Run
+// it on one instance only; see cluster.Node.Lead.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.Collect(ctx); err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Failed to collect orphaned uploads", "error", err)
+			}
+		} else if n > 0 {
+			logger.Info("Removed orphaned uploads", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func TestSave(t *testing.T) {
+	db := dbtest.Open(t)
+	s := New(db, NewDirStorage(t.TempDir()), "https://cdn.example.com/")
+	ctx := context.Background()
+
+	if _, err := s.Save(ctx, "banner", 1, nil, testPNG(t, 10, 10)); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("Expected ErrUnknownKind, got %v", err)
+	}
+
+	u, err := s.Save(ctx, KindAvatar, 1, nil, testPNG(t, 600, 400))
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if !ValidKey(u.Key) || u.Width != 256 || u.Height != 256 || u.URL != "https://cdn.example.com/"+u.Key {
+		t.Fatalf("Expected a 256px square avatar, got %+v", u)
+	}
+	again, err := s.Save(ctx, KindAvatar, 1, nil, testPNG(t, 600, 400))
+	if err != nil || again.Key != u.Key {
+		t.Errorf("Expected the same image to get the same key, got %q, %v", again.Key, err)
+	}
+
+	f, contentType, err := s.Open(ctx, u.Key)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if contentType != "image/png" || len(data) != u.Size {
+		t.Errorf("Expected the %d byte PNG, got %s of %d bytes", u.Size, contentType, len(data))
+	}
+	for _, key := range []string{"../cctv.db", "avatar-0123456789abcdef0123456789abcdef.png"} {
+		if _, _, err := s.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for %q, got %v", key, err)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	db := dbtest.Open(t)
+	storage := NewDirStorage(t.TempDir())
+	s := New(db, storage, "")
+	ctx := context.Background()
+
+	save := func(kind string, w int) Upload {
+		t.Helper()
+		u, err := s.Save(ctx, kind, 1, nil, testPNG(t, w, 10))
+		if err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		return u
+	}
+	avatar := save(KindAvatar, 20)
+	logo := save(KindSponsorLogo, 30)
+	orphan := save(KindBranding, 40)
+	fresh := save(KindBranding, 50)
+
+	if _, err := db.Exec(`INSERT INTO users (username, password_hash, role, avatar) VALUES ('ana', 'x', 'admin', ?)`, avatar.Key); err != nil {
+		t.Fatalf("Failed to seed user: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO settings (key, value) VALUES ('sponsor_logo_url', ?)`, logo.URL); err != nil {
+		t.Fatalf("Failed to seed setting: %v", err)
+	}
+	old := time.Now().UTC().Add(-2 * gcGrace)
+	if _, err := db.Exec(`UPDATE uploads SET created_at = ? WHERE key <> ?`, old, fresh.Key); err != nil {
+		t.Fatalf("Failed to age uploads: %v", err)
+	}
+
+	n, err := s.Collect(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected one upload collected, got %d, %v", n, err)
+	}
+	if _, err := storage.Open(ctx, orphan.Key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the orphan's file removed, got %v", err)
+	}
+	for _, u := range []Upload{avatar, logo, fresh} {
+		f, _, err := s.Open(ctx, u.Key)
+		if err != nil {
+			t.Errorf("Expected %s kept, got %v", u.Kind, err)
+			continue
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,312 @@
+// Package viewers records viewer sessions in viewer_sessions without a
+// database write per request. Players report a session starting, every
+// few seconds that it is still watched, and stopping; a traffic spike
+// turns those into a stream of small writes that SQLite serialises.
+// The recorder keeps the latest change of each session in memory and
+// writes them together in one transaction every FlushInterval, or
+// sooner once MaxPending sessions are waiting.
+//
+// Session counts and stats therefore lag by up to FlushInterval. On
+// shutdown the buffer is written out, and changes reported while the
+// last requests drain are written as they come.
+//
+// A player may send a viewer ID it generated and keeps. A start with
+// one carries on that viewer's latest session of the camera when it is
+// open or stopped in the last 30 seconds, rather than adding a row, so a
+// player falling back from WebRTC to MSE is one session and one viewer
+// even when it lost its session token on the way.
+//
+// A start made with a login token records the user watching, so staff
+// can be told apart from the public. A session carried on without one
+// keeps the user it had.
+package viewers
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+const (
+	defaultFlushInterval = 5 * time.Second
+	defaultMaxPending    = 1000
+
+	// flushTimeout bounds one batch write
+	flushTimeout = 10 * time.Second
+
+	// stitchWindow is how long after stopping a session its viewer can
+	// start again and carry it on
+	stitchWindow = 30 * time.Second
+)
+
+// Recorder buffers viewer session changes. It is safe for concurrent
+// use.
+type Recorder struct {
+	db         *sql.DB
+	interval   time.Duration
+	maxPending int
+	now        func() time.Time
+	full       chan struct{} // signalled when maxPending is reached
+
+	mu      sync.Mutex
+	pending map[session]*change
+	stopped bool // Run has returned; changes are written at once
+}
+
+type session struct {
+	cameraID int
+	id       string
+}
+
+// Viewer is who starts a session: the client, as much of it as the
+// viewer privacy mode keeps, and when the player says, the host of the
+// page it is on, the transport it plays with and the viewer ID it
+// generated. UserID is the logged-in user watching, or 0 for the
+// public.
+type Viewer struct {
+	IP        string
+	Agent     string
+	Referrer  string
+	Transport string
+	ID        string
+	UserID    int
+}
+
+// change is what happened to a session since the last flush
+type change struct {
+	started   bool
+	viewer    Viewer
+	startedAt time.Time
+	seenAt    time.Time
+	stopped   bool
+	endedAt   time.Time
+}
+
+// then folds a later change of the same session into c
+func (c *change) then(next *change) {
+	if next.started {
+		// A new start replaces the row, so what came before is moot
+		*c = *next
+		return
+	}
+	if next.seenAt.After(c.seenAt) {
+		c.seenAt = next.seenAt
+	}
+	if next.stopped {
+		c.stopped, c.endedAt = true, next.endedAt
+	}
+}
+
+// New returns a recorder for cfg; zero values use the defaults
+func New(db *sql.DB, cfg config.ViewersConfig) *Recorder {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = defaultMaxPending
+	}
+	return &Recorder{
+		db:         db,
+		interval:   cfg.FlushInterval,
+		maxPending: cfg.MaxPending,
+		now:        time.Now,
+		full:       make(chan struct{}, 1),
+		pending:    map[session]*change{},
+	}
+}
+
+// Start records session id of v starting to watch the camera. A session
+// that is open starts over; one that was stopped gets a new row, so the
+// earlier visit stays in the history.
+func (r *Recorder) Start(cameraID int, id string, v Viewer) {
+	now := r.now().UTC()
+	r.record(session{cameraID, id}, &change{started: true, viewer: v, startedAt: now, seenAt: now})
+}
+
+// Heartbeat records that the session is still watching
+func (r *Recorder) Heartbeat(cameraID int, id string) {
+	r.record(session{cameraID, id}, &change{seenAt: r.now().UTC()})
+}
+
+// Stop records the session leaving
+func (r *Recorder) Stop(cameraID int, id string) {
+	now := r.now().UTC()
+	r.record(session{cameraID, id}, &change{seenAt: now, stopped: true, endedAt: now})
+}
+
+func (r *Recorder) record(s session, c *change) {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := r.write(ctx, map[session]*change{s: c}); err != nil {
+			logger.Warn("Failed to record viewer session", "error", err)
+		}
+		return
+	}
+	defer r.mu.Unlock()
+
+	if prev, ok := r.pending[s]; ok {
+		prev.then(c)
+	} else {
+		r.pending[s] = c
+	}
+	if len(r.pending) >= r.maxPending {
+		select {
+		case r.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run flushes the buffer every interval until ctx is cancelled, then
+// writes what is left. Start it with shutdown.Coordinator.Go.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.mu.Lock()
+			r.stopped = true
+			r.mu.Unlock()
+			r.Flush(context.Background())
+			return
+		case <-ticker.C:
+		case <-r.full:
+		}
+		r.Flush(ctx)
+	}
+}
+
+// Flush writes the buffered changes. A batch that fails is kept for the
+// next flush, merged with the changes made meanwhile.
+func (r *Recorder) Flush(ctx context.Context) {
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = map[session]*change{}
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, flushTimeout)
+	defer cancel()
+	err := r.write(ctx, batch)
+	if err == nil {
+		return
+	}
+	logger.Warn("Failed to write viewer sessions", "sessions", len(batch), "error", err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for s, c := range batch {
+		if later, ok := r.pending[s]; ok {
+			c.then(later)
+		}
+		r.pending[s] = c
+	}
+}
+
+func (r *Recorder) write(ctx context.Context, batch map[session]*change) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for s, c := range batch {
+		stitched := false
+		if c.started && c.viewer.ID != "" {
+			if stitched, err = stitch(ctx, tx, s, c); err != nil {
+				return err
+			}
+		}
+		switch {
+		case stitched:
+		case c.started:
+			// A camera deleted since is skipped rather than failing the
+			// batch on the foreign key
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO viewer_sessions (camera_id, session_id, viewer_id, ip_address, user_agent, referrer_host, transport,
+					user_id, started_at, last_seen_at)
+				SELECT id, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM cameras WHERE id = ?
+				ON CONFLICT(camera_id, session_id) WHERE ended_at IS NULL DO UPDATE SET
+					referrer_host = excluded.referrer_host, transport = excluded.transport,
+					user_id = COALESCE(excluded.user_id, viewer_sessions.user_id),
+					transport_switches = viewer_sessions.transport_switches +
+						CASE WHEN viewer_sessions.transport IN ('', excluded.transport) THEN 0 ELSE 1 END,
+					started_at = excluded.started_at, last_seen_at = excluded.last_seen_at
+			`, s.id, c.viewer.ID, nullable(c.viewer.IP), nullable(c.viewer.Agent), c.viewer.Referrer, c.viewer.Transport,
+				nullableUser(c.viewer.UserID), c.startedAt, c.seenAt, s.cameraID)
+		default:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE viewer_sessions SET last_seen_at = ?
+				WHERE camera_id = ? AND session_id = ? AND ended_at IS NULL
+			`, c.seenAt, s.cameraID, s.id)
+		}
+		if err != nil {
+			return err
+		}
+
+		if c.stopped {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE viewer_sessions SET ended_at = ?
+				WHERE camera_id = ? AND session_id = ? AND ended_at IS NULL
+			`, c.endedAt, s.cameraID, s.id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// nullable is NULL for a value the viewer privacy mode, or the client,
+// left empty
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullableUser is NULL for a public viewer
+func nullableUser(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// stitch carries on the latest session of the viewer of c on the camera,
+// open or stopped within stitchWindow, under the session token of s: a
+// player switching transports keeps its start time and counts the
+// switch. It reports false when there is no such session, or when the
+// token already has another open session of the camera.
+func stitch(ctx context.Context, tx *sql.Tx, s session, c *change) (bool, error) {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE viewer_sessions SET session_id = ?, referrer_host = ?, transport = ?, last_seen_at = ?, ended_at = NULL,
+			user_id = COALESCE(?, user_id), transport_switches = transport_switches + CASE WHEN transport IN ('', ?) THEN 0 ELSE 1 END
+		WHERE id = (
+			SELECT id FROM viewer_sessions
+			WHERE camera_id = ? AND viewer_id = ? AND (ended_at IS NULL OR ended_at >= ?)
+			ORDER BY CASE WHEN ended_at IS NULL THEN 0 ELSE 1 END, id DESC
+			LIMIT 1
+		) AND NOT EXISTS (
+			SELECT 1 FROM viewer_sessions o
+			WHERE o.camera_id = ? AND o.session_id = ? AND o.ended_at IS NULL AND o.id <> viewer_sessions.id
+		)
+	`, s.id, c.viewer.Referrer, c.viewer.Transport, c.seenAt, nullableUser(c.viewer.UserID), c.viewer.Transport,
+		s.cameraID, c.viewer.ID, c.startedAt.Add(-stitchWindow), s.cameraID, s.id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
@@ -0,0 +1,233 @@
+package viewers
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/config"
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+// openSeededDB is dbtest.Open with the camera the tests watch
+func openSeededDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := dbtest.Open(t)
+	if _, err := db.Exec(`INSERT INTO cameras (id, name, private_rtsp_url, stream_key) VALUES (1, 'Gate', 'rtsp://gate', 'gate')`); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	return db
+}
+
+type row struct {
+	open     bool
+	lastSeen time.Time
+}
+
+func sessionRow(t *testing.T, db *sql.DB, id string) (row, bool) {
+	t.Helper()
+	var r row
+	var ended sql.NullTime
+	err := db.QueryRow(`
+		SELECT ended_at, last_seen_at FROM viewer_sessions WHERE camera_id = 1 AND session_id = ? ORDER BY id DESC LIMIT 1
+	`, id).Scan(&ended, &r.lastSeen)
+	if err == sql.ErrNoRows {
+		return r, false
+	}
+	if err != nil {
+		t.Fatalf("Failed to read session: %v", err)
+	}
+	r.open = !ended.Valid
+	return r, true
+}
+
+func TestRecorder(t *testing.T) {
+	db := openSeededDB(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	r := New(db, config.ViewersConfig{FlushInterval: time.Hour, MaxPending: 3})
+	r.now = func() time.Time { return now }
+
+	t.Run("Changes wait for a flush", func(t *testing.T) {
+		r.Start(1, "alice", Viewer{IP: "10.0.0.1", Agent: "Firefox"})
+		now = now.Add(5 * time.Second)
+		r.Heartbeat(1, "alice")
+		if _, ok := sessionRow(t, db, "alice"); ok {
+			t.Fatal("Expected nothing written before the flush")
+		}
+
+		r.Flush(ctx)
+		got, ok := sessionRow(t, db, "alice")
+		if !ok || !got.open || !got.lastSeen.Equal(now) {
+			t.Errorf("Expected an open session last seen at the heartbeat, got %+v (%v)", got, ok)
+		}
+	})
+
+	t.Run("Stop and restart in one batch", func(t *testing.T) {
+		r.Start(1, "bob", Viewer{IP: "10.0.0.2", Agent: "Chrome"})
+		r.Stop(1, "bob")
+		r.Stop(1, "alice")
+		r.Flush(ctx)
+		if got, _ := sessionRow(t, db, "bob"); got.open {
+			t.Error("Expected bob stopped")
+		}
+		if got, _ := sessionRow(t, db, "alice"); got.open {
+			t.Error("Expected alice stopped")
+		}
+
+		r.Stop(1, "alice")
+		r.Start(1, "alice", Viewer{IP: "10.0.0.1", Agent: "Firefox"})
+		r.Flush(ctx)
+		if got, _ := sessionRow(t, db, "alice"); !got.open {
+			t.Error("Expected alice watching again")
+		}
+		var visits int
+		db.QueryRow(`SELECT COUNT(*) FROM viewer_sessions WHERE session_id = 'alice'`).Scan(&visits)
+		if visits != 2 {
+			t.Errorf("Expected the stopped visit kept next to the new one, got %d rows", visits)
+		}
+	})
+
+	t.Run("Sources", func(t *testing.T) {
+		r.Start(1, "erin", Viewer{IP: "10.0.0.4", Agent: "Chrome", Referrer: "news.example", Transport: "webrtc"})
+		r.Flush(ctx)
+		// The player fell back to HLS and started again
+		r.Start(1, "erin", Viewer{IP: "10.0.0.4", Agent: "Chrome", Referrer: "news.example", Transport: "hls"})
+		r.Flush(ctx)
+		var referrer, transport string
+		db.QueryRow(`SELECT referrer_host, transport FROM viewer_sessions WHERE session_id = 'erin'`).Scan(&referrer, &transport)
+		if referrer != "news.example" || transport != "hls" {
+			t.Errorf("Expected the referrer and the last transport, got %q %q", referrer, transport)
+		}
+	})
+
+	t.Run("Transport switches carry on the session", func(t *testing.T) {
+		started := now
+		r.Start(1, "frank-1", Viewer{IP: "10.0.0.5", Agent: "Chrome", Transport: "webrtc", ID: "viewer-f"})
+		r.Flush(ctx)
+		r.Stop(1, "frank-1")
+		r.Flush(ctx)
+
+		// WebRTC failed; the player lost its token and came back on MSE
+		now = now.Add(5 * time.Second)
+		r.Start(1, "frank-2", Viewer{IP: "10.0.0.5", Agent: "Chrome", Transport: "mse", ID: "viewer-f"})
+		r.Flush(ctx)
+
+		var rows, switches int
+		var session, transport string
+		var startedAt time.Time
+		var ended sql.NullTime
+		db.QueryRow(`SELECT COUNT(*) FROM viewer_sessions WHERE viewer_id = 'viewer-f'`).Scan(&rows)
+		db.QueryRow(`SELECT session_id, transport, transport_switches, started_at, ended_at FROM viewer_sessions WHERE viewer_id = 'viewer-f'`).
+			Scan(&session, &transport, &switches, &startedAt, &ended)
+		if rows != 1 || session != "frank-2" || transport != "mse" || switches != 1 || !startedAt.Equal(started) || ended.Valid {
+			t.Errorf("Expected one open MSE session since the first start, got %d rows: %s %s %d %v %v",
+				rows, session, transport, switches, startedAt, ended)
+		}
+		r.Heartbeat(1, "frank-2")
+		r.Stop(1, "frank-2")
+		r.Flush(ctx)
+		if got, _ := sessionRow(t, db, "frank-2"); got.open {
+			t.Error("Expected the stitched session stopped under its new token")
+		}
+
+		// A visit later on is a new session
+		now = now.Add(time.Minute)
+		r.Start(1, "frank-2", Viewer{IP: "10.0.0.5", Agent: "Chrome", Transport: "mse", ID: "viewer-f"})
+		r.Flush(ctx)
+		db.QueryRow(`SELECT COUNT(*) FROM viewer_sessions WHERE viewer_id = 'viewer-f'`).Scan(&rows)
+		if rows != 2 {
+			t.Errorf("Expected a new session after the stitch window, got %d rows", rows)
+		}
+	})
+
+	t.Run("Logged-in users", func(t *testing.T) {
+		if _, err := db.Exec(`INSERT INTO users (id, username, password_hash, role) VALUES (7, 'operator', 'x', 'operator')`); err != nil {
+			t.Fatalf("Failed to seed user: %v", err)
+		}
+		r.Start(1, "gina-1", Viewer{Transport: "webrtc", ID: "viewer-g", UserID: 7})
+		r.Flush(ctx)
+		// Falling back without the login token keeps the user
+		r.Start(1, "gina-2", Viewer{Transport: "hls", ID: "viewer-g"})
+		r.Start(1, "hank", Viewer{Transport: "hls"})
+		r.Flush(ctx)
+
+		var user sql.NullInt64
+		db.QueryRow(`SELECT user_id FROM viewer_sessions WHERE viewer_id = 'viewer-g'`).Scan(&user)
+		if user.Int64 != 7 {
+			t.Errorf("Expected the operator on the carried on session, got %v", user)
+		}
+		db.QueryRow(`SELECT user_id FROM viewer_sessions WHERE session_id = 'hank'`).Scan(&user)
+		if user.Valid {
+			t.Errorf("Expected no user for a public viewer, got %v", user)
+		}
+	})
+
+	t.Run("Deleted cameras are skipped", func(t *testing.T) {
+		r.Start(2, "carol", Viewer{IP: "10.0.0.3", Agent: "Safari"})
+		r.Heartbeat(1, "alice")
+		r.Flush(ctx)
+		var n int
+		db.QueryRow(`SELECT COUNT(*) FROM viewer_sessions WHERE camera_id = 2`).Scan(&n)
+		if n != 0 {
+			t.Errorf("Expected no session for a missing camera, got %d", n)
+		}
+	})
+
+	t.Run("A full buffer asks for a flush", func(t *testing.T) {
+		for _, id := range []string{"d1", "d2", "d3"} {
+			r.Heartbeat(1, id)
+		}
+		select {
+		case <-r.full:
+		default:
+			t.Error("Expected a flush to be requested")
+		}
+		r.Flush(ctx)
+	})
+}
+
+func TestRecorder_Shutdown(t *testing.T) {
+	db := openSeededDB(t)
+	r := New(db, config.ViewersConfig{FlushInterval: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	r.Start(1, "alice", Viewer{IP: "10.0.0.1", Agent: "Firefox"})
+	cancel()
+	<-done
+	if _, ok := sessionRow(t, db, "alice"); !ok {
+		t.Fatal("Expected the buffer written on shutdown")
+	}
+
+	// Requests still draining are written at once
+	r.Start(1, "bob", Viewer{IP: "10.0.0.2", Agent: "Chrome"})
+	if _, ok := sessionRow(t, db, "bob"); !ok {
+		t.Error("Expected a session after shutdown written at once")
+	}
+}
+
+func TestRecorder_FailedFlush(t *testing.T) {
+	db := openSeededDB(t)
+	ctx := context.Background()
+	r := New(db, config.ViewersConfig{FlushInterval: time.Hour})
+
+	r.Start(1, "alice", Viewer{IP: "10.0.0.1", Agent: "Firefox"})
+	db.Exec(`ALTER TABLE viewer_sessions RENAME TO viewer_sessions_moved`)
+	r.Flush(ctx)
+	r.Stop(1, "alice")
+	db.Exec(`ALTER TABLE viewer_sessions_moved RENAME TO viewer_sessions`)
+
+	r.Flush(ctx)
+	got, ok := sessionRow(t, db, "alice")
+	if !ok || got.open {
+		t.Errorf("Expected the failed start kept and merged with the stop, got %+v (%v)", got, ok)
+	}
+}
@@ -0,0 +1,77 @@
+package watchdog
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// authorize answers the challenges of a 401, digest over basic, with
+// user's credentials. Cameras ask for either over RTSP and HTTP.
+func authorize(challenges []string, user *url.Userinfo, method, uri string) (string, bool) {
+	password, _ := user.Password()
+	basic := false
+	for _, challenge := range challenges {
+		scheme, params, _ := strings.Cut(challenge, " ")
+		switch strings.ToLower(scheme) {
+		case "digest":
+			return digest(parseChallenge(params), user.Username(), password, method, uri), true
+		case "basic":
+			basic = true
+		}
+	}
+	if basic {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)), true
+	}
+	return "", false
+}
+
+// parseChallenge splits `realm="x", nonce="y", qop="auth"`
+func parseChallenge(params string) map[string]string {
+	values := map[string]string{}
+	for len(params) > 0 {
+		params = strings.TrimLeft(params, " ,")
+		key, rest, ok := strings.Cut(params, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		params = rest
+	}
+	return values
+}
+
+// digest is the Authorization header of RFC 2617 digest auth with MD5
+func digest(c map[string]string, username, password, method, uri string) string {
+	hash := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := hash(username + ":" + c["realm"] + ":" + password)
+	ha2 := hash(method + ":" + uri)
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, username, c["realm"], c["nonce"], uri)
+	if qop := c["qop"]; qop != "" {
+		cnonce := make([]byte, 8)
+		rand.Read(cnonce)
+		cn := hex.EncodeToString(cnonce)
+		header += fmt.Sprintf(`, qop=auth, nc=00000001, cnonce="%s", response="%s"`,
+			cn, hash(ha1+":"+c["nonce"]+":00000001:"+cn+":auth:"+ha2))
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, hash(ha1+":"+c["nonce"]+":"+ha2))
+	}
+	if opaque := c["opaque"]; opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return header
+}
@@ -0,0 +1,316 @@
+package watchdog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/internal/outages"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// JobType runs a health check queued by Enqueue
+const JobType = "camera_health_check"
+
+// Health check states
+const (
+	CheckPending = "pending"
+	CheckRunning = "running"
+	CheckDone    = "done"
+	CheckFailed  = "failed"
+)
+
+// Skipped is the result of a camera the watchdog does not probe: one
+// disabled, behind an edge node or deleted since the check was queued
+const Skipped = "skipped"
+
+// checkTTL is how long finished health checks are kept
+const checkTTL = 24 * time.Hour
+
+// ErrCheckNotFound is returned by GetCheck for a check that does not
+// exist in the organization
+var ErrCheckNotFound = errors.New("health check not found")
+
+// HealthCheck is a batch of probes run on demand, with the outcome of
+// each camera once it is done
+type HealthCheck struct {
+	ID          int64         `json:"id"`
+	JobID       int64         `json:"job_id"`
+	Status      string        `json:"status"`
+	CameraIDs   []int         `json:"camera_ids"`
+	Error       string        `json:"error,omitempty"`
+	Results     []CheckResult `json:"results"`
+	CreatedAt   time.Time     `json:"created_at"`
+	FinishedAt  *time.Time    `json:"finished_at"`
+	RequestedBy *int          `json:"requested_by"`
+}
+
+// CheckResult is the health of one camera after a check
+type CheckResult struct {
+	CameraID  int       `json:"camera_id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// checkJob is the payload of a JobType job
+type checkJob struct {
+	CheckID int64 `json:"check_id"`
+}
+
+// Enqueue records a check of cameraIDs, all of them in the organization
+// and listed by the caller, and queues the job that runs it ahead of
+// other work. Checks finished over a day ago are dropped on the way.
+func Enqueue(ctx context.Context, db *sql.DB, queue *jobs.Queue, orgID int, cameraIDs []int, requestedBy *int) (*HealthCheck, error) {
+	cutoff := time.Now().UTC().Add(-checkTTL)
+	if _, err := db.ExecContext(ctx, `
+		DELETE FROM health_check_results WHERE check_id IN (SELECT id FROM health_checks WHERE created_at < ?)
+	`, cutoff); err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM health_checks WHERE created_at < ?`, cutoff); err != nil {
+		return nil, err
+	}
+
+	ids, err := json.Marshal(cameraIDs)
+	if err != nil {
+		return nil, err
+	}
+	check := &HealthCheck{
+		Status:      CheckPending,
+		CameraIDs:   cameraIDs,
+		Results:     []CheckResult{},
+		CreatedAt:   time.Now().UTC(),
+		RequestedBy: requestedBy,
+	}
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO health_checks (organization_id, camera_ids, status, requested_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, orgID, string(ids), CheckPending, requestedBy, check.CreatedAt).Scan(&check.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	check.JobID, err = queue.Enqueue(ctx, JobType, checkJob{CheckID: check.ID},
+		jobs.EnqueueOptions{Priority: jobs.PriorityHigh, MaxAttempts: 3})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE health_checks SET job_id = ? WHERE id = ?`, check.JobID, check.ID); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// GetCheck returns a check of the organization with its results, in
+// camera order
+func GetCheck(ctx context.Context, db *sql.DB, orgID int, id int64) (*HealthCheck, error) {
+	check := &HealthCheck{ID: id, Results: []CheckResult{}}
+	var ids string
+	var finished sql.NullTime
+	var requestedBy sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+		SELECT job_id, status, camera_ids, error_message, created_at, finished_at, requested_by
+		FROM health_checks WHERE id = ? AND organization_id = ?
+	`, id, orgID).Scan(&check.JobID, &check.Status, &ids, &check.Error, &check.CreatedAt, &finished, &requestedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCheckNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(ids), &check.CameraIDs); err != nil {
+		return nil, fmt.Errorf("invalid camera_ids of health check %d: %w", id, err)
+	}
+	if finished.Valid {
+		check.FinishedAt = &finished.Time
+	}
+	if requestedBy.Valid {
+		by := int(requestedBy.Int64)
+		check.RequestedBy = &by
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.camera_id, COALESCE(c.name, ''), r.status, r.error_message, r.checked_at
+		FROM health_check_results r
+		LEFT JOIN cameras c ON c.id = r.camera_id
+		WHERE r.check_id = ?
+		ORDER BY r.camera_id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r CheckResult
+		if err := rows.Scan(&r.CameraID, &r.Name, &r.Status, &r.Error, &r.CheckedAt); err != nil {
+			return nil, err
+		}
+		check.Results = append(check.Results, r)
+	}
+	return check, rows.Err()
+}
+
+// RunCheck is the jobs.Handler of JobType. It runs every probe of the
+// check's cameras at once, sharing the watchdog's concurrency limit,
+// and writes their health as the scheduled probes do; cameras the
+// watchdog leaves alone are recorded as skipped.
+func (w *Watchdog) RunCheck(ctx context.Context, payload json.RawMessage) error {
+	var job checkJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, dbTimeout)
+	var raw string
+	err := w.db.QueryRowContext(dbCtx, `SELECT camera_ids FROM health_checks WHERE id = ?`, job.CheckID).Scan(&raw)
+	if err == nil {
+		_, err = w.db.ExecContext(dbCtx, `UPDATE health_checks SET status = ? WHERE id = ?`, CheckRunning, job.CheckID)
+	}
+	cancel()
+	if errors.Is(err, sql.ErrNoRows) {
+		// Dropped with the checks of a day ago
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cameraIDs []int
+	if err := json.Unmarshal([]byte(raw), &cameraIDs); err != nil {
+		w.finishCheck(job.CheckID, CheckFailed, err.Error())
+		return jobs.Permanent(err)
+	}
+
+	results, err := w.CheckNow(ctx, cameraIDs)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.finishCheck(job.CheckID, CheckFailed, err.Error())
+		}
+		return err
+	}
+
+	dbCtx, cancel = context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	for _, r := range results {
+		if _, err := w.db.ExecContext(dbCtx, `
+			INSERT INTO health_check_results (check_id, camera_id, status, error_message, checked_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (check_id, camera_id) DO UPDATE SET status = excluded.status,
+				error_message = excluded.error_message, checked_at = excluded.checked_at
+		`, job.CheckID, r.CameraID, r.Status, r.Error, r.CheckedAt); err != nil {
+			return err
+		}
+	}
+	w.finishCheck(job.CheckID, CheckDone, "")
+	return nil
+}
+
+// finishCheck records the end of a check. It runs after the probes,
+// possibly during shutdown, so it uses its own context.
+func (w *Watchdog) finishCheck(id int64, status, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	if _, err := w.db.ExecContext(ctx, `
+		UPDATE health_checks SET status = ?, error_message = ?, finished_at = ? WHERE id = ?
+	`, status, message, w.now().UTC(), id); err != nil {
+		logger.Warn("Failed to record health check", "check_id", id, "error", err)
+	}
+}
+
+// CheckNow runs every probe of cameraIDs now, without waiting for their
+// interval, writes the health of each camera and returns it in camera
+// order. The cameras are trusted to exist; those the watchdog does not
+// probe come back skipped.
+func (w *Watchdog) CheckNow(ctx context.Context, cameraIDs []int) ([]CheckResult, error) {
+	if len(cameraIDs) == 0 {
+		return []CheckResult{}, nil
+	}
+	checks, err := w.checks(ctx, cameraIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		select {
+		case w.sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			defer func() { <-w.sem }()
+			errs[i] = probe(ctx, ch)
+		}(i, ch)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := w.now().UTC()
+	byCamera := map[int]map[string]result{}
+	for i, ch := range checks {
+		if byCamera[ch.cameraID] == nil {
+			byCamera[ch.cameraID] = map[string]result{}
+		}
+		byCamera[ch.cameraID][ch.kind] = result{at: now, err: errs[i]}
+	}
+
+	ids := append([]int(nil), cameraIDs...)
+	sort.Ints(ids)
+	results := make([]CheckResult, 0, len(ids))
+	verdicts := map[int]CheckResult{}
+	for _, id := range ids {
+		if _, seen := verdicts[id]; seen {
+			continue
+		}
+		r := CheckResult{CameraID: id, Status: Skipped, CheckedAt: now}
+		if probed, ok := byCamera[id]; ok {
+			r.Status, r.Error = verdict(probed)
+
+			// The scheduled probes carry on from these results, on the
+			// instance running them
+			w.mu.Lock()
+			if st := w.cameras[id]; st != nil {
+				for kind, res := range probed {
+					st.results[kind] = res
+				}
+				st.status, st.reason = r.Status, r.Error
+			}
+			w.mu.Unlock()
+		}
+		verdicts[id] = r
+		results = append(results, r)
+	}
+
+	for i, ch := range checks {
+		v := verdicts[ch.cameraID]
+		if err := w.write(ctx, ch, errs[i], v.Status, v.Error, now); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range results {
+		if r.Status == Skipped {
+			continue
+		}
+		dbCtx, cancel := context.WithTimeout(ctx, dbTimeout)
+		err := outages.Record(dbCtx, w.db, r.CameraID, r.Status == "online", r.Error, now)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
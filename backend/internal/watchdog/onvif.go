@@ -0,0 +1,127 @@
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+)
+
+// onvifResponse holds what the probe reads of a device service answer
+type onvifResponse struct {
+	Body struct {
+		Fault *struct {
+			Code struct {
+				Subcode struct {
+					Value string `xml:"Value"`
+				} `xml:"Subcode"`
+			} `xml:"Code"`
+			Reason struct {
+				Text string `xml:"Text"`
+			} `xml:"Reason"`
+		} `xml:"Fault"`
+		Info *struct {
+			Manufacturer string `xml:"Manufacturer"`
+			Model        string `xml:"Model"`
+		} `xml:"GetDeviceInformationResponse"`
+	} `xml:"Body"`
+}
+
+// onvifProbe asks the device service for GetDeviceInformation, signed
+// with a WS-Security UsernameToken when there are credentials. The
+// device service is the target URL, else /onvif/device_service on port
+// 80 of the RTSP host; credentials come from the URL used.
+func onvifProbe(ctx context.Context, t Target) error {
+	var u *url.URL
+	if t.Target != "" {
+		var err error
+		if u, err = url.Parse(t.Target); err != nil || u.Host == "" {
+			return errors.New("invalid ONVIF URL")
+		}
+	} else {
+		rtsp, err := url.Parse(t.RTSPURL)
+		if err != nil || rtsp.Hostname() == "" {
+			return errors.New("invalid RTSP URL")
+		}
+		u = &url.URL{Scheme: "http", Host: rtsp.Hostname(), Path: "/onvif/device_service", User: rtsp.User}
+	}
+	user := u.User
+	u.User = nil
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(onvifEnvelope(user, time.Now())))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `application/soap+xml; charset=utf-8; action="http://www.onvif.org/ver10/device/wsdl/GetDeviceInformation"`)
+	resp, err := httpclient.Shared().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var env onvifResponse
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&env); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return answered("%s%s", resp.Status, hint(resp.StatusCode))
+		}
+		return answered("not an ONVIF device service")
+	}
+	if f := env.Body.Fault; f != nil {
+		reason := strings.TrimSpace(f.Reason.Text)
+		if reason == "" {
+			reason = f.Code.Subcode.Value
+		}
+		if strings.Contains(f.Code.Subcode.Value, "NotAuthorized") {
+			reason += hint(http.StatusUnauthorized)
+		}
+		return answered("fault: %s", reason)
+	}
+	if resp.StatusCode != http.StatusOK || env.Body.Info == nil {
+		return answered("%s%s", resp.Status, hint(resp.StatusCode))
+	}
+	return nil
+}
+
+// onvifEnvelope is the GetDeviceInformation request, with a password
+// digest of the credentials: base64(SHA-1(nonce + created + password))
+func onvifEnvelope(user *url.Userinfo, now time.Time) string {
+	security := ""
+	if user != nil {
+		password, _ := user.Password()
+		nonce := make([]byte, 16)
+		rand.Read(nonce)
+		created := now.UTC().Format(time.RFC3339)
+		sum := sha1.Sum(append(append(append([]byte{}, nonce...), created...), password...))
+		security = fmt.Sprintf(`<s:Header><Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">`+
+			`<UsernameToken><Username>%s</Username>`+
+			`<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%s</Password>`+
+			`<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">%s</Nonce>`+
+			`<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%s</Created>`+
+			`</UsernameToken></Security></s:Header>`,
+			xmlEscape(user.Username()), base64.StdEncoding.EncodeToString(sum[:]), base64.StdEncoding.EncodeToString(nonce), created)
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">` + security +
+		`<s:Body><GetDeviceInformation xmlns="http://www.onvif.org/ver10/device/wsdl"/></s:Body></s:Envelope>`
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// pingSeq numbers the echo requests, so replies to a probe that timed
+// out do not pass for later ones
+var pingSeq atomic.Uint32
+
+// pingProbe sends one ICMP echo request to the camera's host, or the
+// target, and waits for the reply. It needs a raw socket (root or
+// CAP_NET_RAW) or, on Linux, a group allowed unprivileged ICMP by
+// net.ipv4.ping_group_range.
+func pingProbe(ctx context.Context, t Target) error {
+	host, err := t.host()
+	if err != nil {
+		return err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	ip := addrs[0].IP
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			ip = a.IP
+			break
+		}
+	}
+
+	v4 := ip.To4() != nil
+	raw, unprivileged, proto := "ip6:ipv6-icmp", "udp6", 58
+	var echo, reply icmp.Type = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	if v4 {
+		raw, unprivileged, proto = "ip4:icmp", "udp4", 1
+		echo, reply = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	}
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	conn, err := icmp.ListenPacket(raw, "")
+	if err != nil {
+		if conn, err = icmp.ListenPacket(unprivileged, ""); err != nil {
+			return errors.New("ICMP not permitted: " + err.Error())
+		}
+		dst = &net.UDPAddr{IP: ip}
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	// Unprivileged sockets get their ID from the kernel, which also
+	// filters the replies to them
+	id, seq := os.Getpid()&0xffff, int(pingSeq.Add(1)&0xffff)
+	msg := icmp.Message{Type: echo, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("cctv-watchdog")}}
+	packet, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(packet, dst); err != nil {
+		return err
+	}
+
+	_, udp := dst.(*net.UDPAddr)
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		switch body := m.Body.(type) {
+		case *icmp.Echo:
+			if m.Type == reply && sameIP(peer, ip) && body.Seq == seq && (udp || body.ID == id) {
+				return nil
+			}
+		case *icmp.DstUnreach:
+			// Sent by a router on the way, quoting the request
+			if quotedSeq(body.Data, v4) == seq {
+				return errors.New("destination unreachable")
+			}
+		}
+	}
+}
+
+// quotedSeq is the sequence number of the echo request quoted by an
+// ICMP error: the request's IP header, then its first 8 bytes
+func quotedSeq(data []byte, v4 bool) int {
+	header := 40
+	if v4 && len(data) > 0 {
+		header = int(data[0]&0x0f) * 4
+	}
+	if len(data) < header+8 {
+		return -1
+	}
+	return int(data[header+6])<<8 | int(data[header+7])
+}
+
+func sameIP(addr net.Addr, ip net.IP) bool {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP.Equal(ip)
+	case *net.UDPAddr:
+		return a.IP.Equal(ip)
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+)
+
+// host returns the target, else the host of the RTSP URL
+func (t Target) host() (string, error) {
+	if t.Target != "" {
+		return t.Target, nil
+	}
+	u, err := url.Parse(t.RTSPURL)
+	if err != nil || u.Hostname() == "" {
+		return "", errors.New("invalid RTSP URL")
+	}
+	return u.Hostname(), nil
+}
+
+// addr returns the target as host:port, else the RTSP URL's, port 554
+// when it names none
+func (t Target) addr() (string, error) {
+	if t.Target != "" {
+		return t.Target, nil
+	}
+	u, err := url.Parse(t.RTSPURL)
+	if err != nil || u.Hostname() == "" {
+		return "", errors.New("invalid RTSP URL")
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	return net.JoinHostPort(u.Hostname(), "554"), nil
+}
+
+// tcpProbe connects to the camera's RTSP port, or the target host:port.
+// It is cheap, and what it catches is the network.
+func tcpProbe(ctx context.Context, t Target) error {
+	addr, err := t.addr()
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// httpProbe fetches the snapshot URL in the target and expects an
+// image. Credentials in the URL are sent with basic or digest auth.
+func httpProbe(ctx context.Context, t Target) error {
+	if t.Target == "" {
+		return errors.New("no snapshot URL set")
+	}
+	u, err := url.Parse(t.Target)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid snapshot URL")
+	}
+	user := u.User
+	u.User = nil
+
+	get := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		} else if user != nil {
+			password, _ := user.Password()
+			req.SetBasicAuth(user.Username(), password)
+		}
+		return httpclient.Shared().Do(req)
+	}
+
+	resp, err := get("")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && user != nil {
+		if auth, ok := authorize(resp.Header.Values("WWW-Authenticate"), user, http.MethodGet, u.RequestURI()); ok {
+			drain(resp)
+			if resp, err = get(auth); err != nil {
+				return err
+			}
+		}
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return answered("%s%s", resp.Status, hint(resp.StatusCode))
+	}
+	media, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(media, "image/") {
+		return answered("not an image (%s)", resp.Header.Get("Content-Type"))
+	}
+	return nil
+}
+
+// hint says what a status code most likely means for a camera
+func hint(code int) string {
+	switch code {
+	case 401, 403:
+		return ", check the camera's user and password"
+	case 404:
+		return ", check the path"
+	}
+	return ""
+}
+
+// drain reads a little of an unread body so the connection is reused
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// Check returns the field of p and a message when p cannot run: an
+// unknown type, a timeout longer than the interval, or a target that
+// does not fit the type. The interval and timeout are in seconds; 0
+// uses the defaults.
+func Check(p Probe) (field, msg string) {
+	if _, ok := lookup(p.Type); !ok {
+		return "type", "must be one of " + strings.Join(Types(), ", ")
+	}
+	switch {
+	case p.IntervalSeconds < 0 || p.IntervalSeconds > 86400:
+		return "interval_seconds", "must be between 0 and 86400"
+	case p.TimeoutSeconds < 0 || p.TimeoutSeconds > 60:
+		return "timeout_seconds", "must be between 0 and 60"
+	case p.IntervalSeconds > 0 && p.TimeoutSeconds > p.IntervalSeconds:
+		return "timeout_seconds", "must not be longer than the interval"
+	case len(p.Target) > 500:
+		return "target", "must be at most 500 characters"
+	}
+
+	target := p.Target
+	switch p.Type {
+	case TCP:
+		if _, _, err := net.SplitHostPort(target); target != "" && err != nil {
+			return "target", "must be host:port"
+		}
+	case Ping:
+		if strings.ContainsAny(target, ":/") && net.ParseIP(target) == nil {
+			return "target", "must be a host name or IP address"
+		}
+	case HTTP:
+		if target == "" {
+			return "target", "must be the snapshot URL"
+		}
+		fallthrough
+	case RTSP, ONVIF:
+		if target == "" {
+			break
+		}
+		u, err := url.Parse(target)
+		schemes := map[string]string{RTSP: "rtsp", ONVIF: "http", HTTP: "http"}
+		if err != nil || u.Host == "" || strings.TrimSuffix(u.Scheme, "s") != schemes[p.Type] {
+			return "target", fmt.Sprintf("must be a %s:// or %ss:// URL", schemes[p.Type], schemes[p.Type])
+		}
+	}
+	return "", ""
+}
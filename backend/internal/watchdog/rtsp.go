@@ -0,0 +1,103 @@
+package watchdog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// rtspProbe sends DESCRIBE for the stream, as a player opening it does,
+// and expects 200. A 401 is answered once with the URL's credentials.
+// It catches a wrong path or password that a TCP connect cannot.
+func rtspProbe(ctx context.Context, t Target) error {
+	raw := t.Target
+	if raw == "" {
+		raw = t.RTSPURL
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "rtsp" && u.Scheme != "rtsps") {
+		return errors.New("invalid RTSP URL")
+	}
+	user := u.User
+	u.User = nil
+	addr := u.Host
+	if u.Port() == "" {
+		port := "554"
+		if u.Scheme == "rtsps" {
+			port = "322"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if u.Scheme == "rtsps" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: true}) // cameras sign their own
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	r := textproto.NewReader(bufio.NewReader(conn))
+	uri := u.String()
+	code, status, header, err := describe(conn, r, uri, 1, "")
+	if err != nil {
+		return err
+	}
+	if code == 401 && user != nil {
+		if auth, ok := authorize(header.Values("Www-Authenticate"), user, "DESCRIBE", uri); ok {
+			if code, status, _, err = describe(conn, r, uri, 2, auth); err != nil {
+				return err
+			}
+		}
+	}
+	if code != 200 {
+		return answered("%s%s", status, hint(code))
+	}
+	return nil
+}
+
+// describe sends one DESCRIBE on conn and reads the response, skipping
+// its body
+func describe(conn net.Conn, r *textproto.Reader, uri string, cseq int, authorization string) (int, string, textproto.MIMEHeader, error) {
+	req := fmt.Sprintf("DESCRIBE %s RTSP/1.0\r\nCSeq: %d\r\nAccept: application/sdp\r\nUser-Agent: cctv-watchdog\r\n", uri, cseq)
+	if authorization != "" {
+		req += "Authorization: " + authorization + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		return 0, "", nil, err
+	}
+
+	line, err := r.ReadLine()
+	if err != nil {
+		return 0, "", nil, err
+	}
+	proto, status, ok := strings.Cut(line, " ")
+	code, _, _ := strings.Cut(status, " ")
+	n, convErr := strconv.Atoi(code)
+	if !ok || !strings.HasPrefix(proto, "RTSP/") || convErr != nil {
+		return 0, "", nil, fmt.Errorf("not an RTSP server (%.40q)", line)
+	}
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if length, _ := strconv.Atoi(header.Get("Content-Length")); length > 0 {
+		if _, err := io.CopyN(io.Discard, r.R, int64(length)); err != nil {
+			return 0, "", nil, err
+		}
+	}
+	return n, status, header, nil
+}
@@ -0,0 +1,89 @@
+package watchdog
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Probe is one health probe of a camera, with its latest result
+type Probe struct {
+	ID              int64      `json:"id"`
+	CameraID        int        `json:"camera_id"`
+	Type            string     `json:"type"`
+	IntervalSeconds int        `json:"interval_seconds"` // 0: HEALTH_CHECK_INTERVAL_SECONDS
+	TimeoutSeconds  int        `json:"timeout_seconds"`  // 0: HEALTH_CHECK_TIMEOUT_SECONDS
+	Target          string     `json:"target"`           // empty: from the RTSP URL
+	LastOK          *bool      `json:"last_ok"`
+	LastError       string     `json:"last_error"`
+	LastCheckedAt   *time.Time `json:"last_checked_at"`
+}
+
+// Probes lists a camera's probes in the order they were added. An empty
+// list means the default TCP connect.
+func Probes(ctx context.Context, db *sql.DB, cameraID int) ([]Probe, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, camera_id, type, interval_seconds, timeout_seconds, target, last_ok, last_error, last_checked_at
+		FROM camera_probes WHERE camera_id = ?
+		ORDER BY id ASC
+	`, cameraID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Probe{}
+	for rows.Next() {
+		var p Probe
+		var ok sql.NullBool
+		var checked sql.NullTime
+		if err := rows.Scan(&p.ID, &p.CameraID, &p.Type, &p.IntervalSeconds, &p.TimeoutSeconds, &p.Target,
+			&ok, &p.LastError, &checked); err != nil {
+			return nil, err
+		}
+		if ok.Valid {
+			p.LastOK = &ok.Bool
+		}
+		if checked.Valid {
+			p.LastCheckedAt = &checked.Time
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// SaveProbes replaces a camera's probes. A probe of a type the camera
+// already had keeps its latest result.
+func SaveProbes(ctx context.Context, db *sql.DB, cameraID int, probes []Probe) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM camera_probes WHERE camera_id = ?"
+	keep := []interface{}{cameraID}
+	if len(probes) > 0 {
+		query += " AND type NOT IN (?" + strings.Repeat(", ?", len(probes)-1) + ")"
+		for _, p := range probes {
+			keep = append(keep, p.Type)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, query, keep...); err != nil {
+		return err
+	}
+
+	for _, p := range probes {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO camera_probes (camera_id, type, interval_seconds, timeout_seconds, target)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (camera_id, type) DO UPDATE SET interval_seconds = excluded.interval_seconds,
+				timeout_seconds = excluded.timeout_seconds, target = excluded.target
+		`, cameraID, p.Type, p.IntervalSeconds, p.TimeoutSeconds, p.Target)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
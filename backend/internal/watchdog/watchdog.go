@@ -0,0 +1,456 @@
+// Package watchdog checks that the cameras answer and records what it
+// finds in camera_health, which the alerts, the status page and the
+// players read. Each camera has one or more probes (camera_probes):
+// ping, a TCP connect, an RTSP DESCRIBE, an ONVIF GetDeviceInformation
+// or an HTTP snapshot, each run on its own interval and timeout. A
+// camera without probes gets a TCP connect to its RTSP port, as edge
+// agents check theirs; cameras behind an edge node are left to it.
+//
+// A camera is offline while any of its probes fails. Its error message
+// is the most informative failure: the device answering with an error
+// (an RTSP 401, an ONVIF fault, an HTTP 404) over a network error, over
+// a timeout; between equals, the probe that got further into the device.
+// Each change of a camera's health is added to its outage timeline
+// (internal/outages), with that message as the cause.
+package watchdog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/outages"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// Probe types
+const (
+	Ping  = "ping"
+	TCP   = "tcp"
+	RTSP  = "rtsp"
+	ONVIF = "onvif"
+	HTTP  = "http"
+)
+
+const (
+	defaultInterval    = 30 * time.Second
+	defaultTimeout     = 5 * time.Second
+	defaultConcurrency = 8
+
+	// tickInterval is how often due probes are started
+	tickInterval = time.Second
+
+	// dbTimeout bounds each watchdog query
+	dbTimeout = 5 * time.Second
+)
+
+// Target is what a probe checks: the camera's RTSP URL, unless the
+// probe sets a target of its own
+type Target struct {
+	RTSPURL string
+	Target  string
+}
+
+// ProbeFunc checks one way a camera answers, within ctx's deadline. It
+// returns nil when the camera passes.
+type ProbeFunc func(ctx context.Context, t Target) error
+
+type probeType struct {
+	fn    ProbeFunc
+	depth int // how far into the device a pass gets
+}
+
+var (
+	typesMu sync.RWMutex
+	types   = map[string]probeType{
+		Ping:  {pingProbe, 0},
+		TCP:   {tcpProbe, 1},
+		RTSP:  {rtspProbe, 2},
+		ONVIF: {onvifProbe, 2},
+		HTTP:  {httpProbe, 2},
+	}
+)
+
+// Register adds or replaces a probe type. depth ranks its failures
+// against those of other probes of equal weight: ping is 0, a TCP
+// connect 1 and the protocol probes 2.
+func Register(name string, depth int, fn ProbeFunc) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	types[name] = probeType{fn, depth}
+}
+
+// Types lists the probe types, by name
+func Types() []string {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (probeType, bool) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	t, ok := types[name]
+	return t, ok
+}
+
+// RunProbe runs one probe of type name against t, within ctx's
+// deadline, outside the schedule
+func RunProbe(ctx context.Context, name string, t Target) error {
+	p, ok := lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown probe type %q", name)
+	}
+	return p.fn(ctx, t)
+}
+
+// answerError is the device answering with an error: it is up, but not
+// the way it should be, which says the most about what is wrong
+type answerError struct {
+	msg string
+}
+
+func (e *answerError) Error() string { return e.msg }
+
+func answered(format string, args ...interface{}) error {
+	return &answerError{fmt.Sprintf(format, args...)}
+}
+
+// weight ranks how much a failure tells: the device answering with an
+// error, a network error such as a refused connection, or a timeout
+func weight(err error) int {
+	var answer *answerError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &answer):
+		return 2
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return 0
+	}
+	return 1
+}
+
+// Options tune a Watchdog; zero values use the defaults
+type Options struct {
+	Interval    time.Duration // of probes that set none
+	Timeout     time.Duration // of probes that set none
+	Concurrency int           // probes run at once
+}
+
+// Watchdog runs the probes of the enabled cameras and writes their
+// health
+type Watchdog struct {
+	db   *sql.DB
+	opts Options
+	now  func() time.Time
+	sem  chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	cameras map[int]*cameraState
+}
+
+type cameraState struct {
+	results map[string]result // latest result by probe type
+	running map[string]bool
+	status  string
+	reason  string
+}
+
+type result struct {
+	at  time.Time
+	err error
+}
+
+// check is one probe of a camera; probeID is 0 for the default probe
+type check struct {
+	cameraID int
+	probeID  int64
+	kind     string
+	interval time.Duration
+	timeout  time.Duration
+	target   Target
+}
+
+func New(db *sql.DB, opts Options) *Watchdog {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	return &Watchdog{
+		db:      db,
+		opts:    opts,
+		now:     time.Now,
+		sem:     make(chan struct{}, opts.Concurrency),
+		cameras: map[int]*cameraState{},
+	}
+}
+
+// Run starts the probes that are due every second until ctx is
+// cancelled, then waits for those running. Start it with
+// shutdown.Coordinator.Go.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	defer w.wg.Wait()
+
+	for {
+		w.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick starts the probes that are due, as long as a slot is free; the
+// others wait for the next tick
+func (w *Watchdog) tick(ctx context.Context) {
+	checks, err := w.checks(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to load camera probes", "error", err)
+		}
+		return
+	}
+	w.forget(checks)
+
+	now := w.now()
+	for _, ch := range checks {
+		w.mu.Lock()
+		st := w.cameras[ch.cameraID]
+		last, ran := st.results[ch.kind]
+		due := !st.running[ch.kind] && (!ran || now.Sub(last.at) >= ch.interval)
+		w.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		select {
+		case w.sem <- struct{}{}:
+		default:
+			return
+		}
+		w.mu.Lock()
+		st.running[ch.kind] = true
+		w.mu.Unlock()
+		w.wg.Add(1)
+		go func(ch check) {
+			defer w.wg.Done()
+			defer func() { <-w.sem }()
+			w.run(ctx, ch)
+		}(ch)
+	}
+}
+
+// checks lists the probes of the enabled cameras not behind an edge
+// node, in camera order; only those of cameraIDs when any are given
+func (w *Watchdog) checks(ctx context.Context, cameraIDs ...int) ([]check, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	filter := ""
+	args := make([]interface{}, len(cameraIDs))
+	if len(cameraIDs) > 0 {
+		filter = " AND c.id IN (?" + strings.Repeat(", ?", len(cameraIDs)-1) + ")"
+		for i, id := range cameraIDs {
+			args[i] = id
+		}
+	}
+	rows, err := w.db.QueryContext(ctx, `
+		SELECT c.id, c.private_rtsp_url, COALESCE(p.id, 0), COALESCE(p.type, ''),
+		       COALESCE(p.interval_seconds, 0), COALESCE(p.timeout_seconds, 0), COALESCE(p.target, '')
+		FROM cameras c
+		LEFT JOIN camera_probes p ON p.camera_id = c.id
+		WHERE c.enabled = TRUE AND c.edge_node_id IS NULL`+filter+`
+		ORDER BY c.id ASC, p.id ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []check
+	for rows.Next() {
+		var ch check
+		var interval, timeout int
+		if err := rows.Scan(&ch.cameraID, &ch.target.RTSPURL, &ch.probeID, &ch.kind, &interval, &timeout, &ch.target.Target); err != nil {
+			return nil, err
+		}
+		if ch.kind == "" {
+			ch.kind = TCP
+		}
+		ch.interval, ch.timeout = w.opts.Interval, w.opts.Timeout
+		if interval > 0 {
+			ch.interval = time.Duration(interval) * time.Second
+		}
+		if timeout > 0 {
+			ch.timeout = time.Duration(timeout) * time.Second
+		}
+		checks = append(checks, ch)
+	}
+	return checks, rows.Err()
+}
+
+// forget drops the state of cameras and probes no longer checked, so a
+// removed probe stops counting towards its camera's health
+func (w *Watchdog) forget(checks []check) {
+	kinds := map[int]map[string]bool{}
+	for _, ch := range checks {
+		if kinds[ch.cameraID] == nil {
+			kinds[ch.cameraID] = map[string]bool{}
+		}
+		kinds[ch.cameraID][ch.kind] = true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, st := range w.cameras {
+		if kinds[id] == nil {
+			delete(w.cameras, id)
+			continue
+		}
+		for kind := range st.results {
+			if !kinds[id][kind] {
+				delete(st.results, kind)
+			}
+		}
+	}
+	for id := range kinds {
+		if w.cameras[id] == nil {
+			w.cameras[id] = &cameraState{results: map[string]result{}, running: map[string]bool{}}
+		}
+	}
+}
+
+// probe runs the probe of ch within its timeout
+func probe(ctx context.Context, ch check) error {
+	t, ok := lookup(ch.kind)
+	if !ok {
+		return errors.New("unknown probe type " + ch.kind)
+	}
+	ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+	defer cancel()
+	return t.fn(ctx, ch.target)
+}
+
+// run probes ch and writes the result and its camera's health
+func (w *Watchdog) run(ctx context.Context, ch check) {
+	err := probe(ctx, ch)
+	if ctx.Err() != nil {
+		// Shutting down; the result says nothing of the camera
+		w.mu.Lock()
+		if st := w.cameras[ch.cameraID]; st != nil {
+			delete(st.running, ch.kind)
+		}
+		w.mu.Unlock()
+		return
+	}
+
+	now := w.now().UTC()
+	w.mu.Lock()
+	st := w.cameras[ch.cameraID]
+	if st == nil {
+		// The camera was disabled or deleted meanwhile
+		w.mu.Unlock()
+		return
+	}
+	delete(st.running, ch.kind)
+	st.results[ch.kind] = result{at: now, err: err}
+	status, reason := verdict(st.results)
+	changed := status != st.status || reason != st.reason
+	st.status, st.reason = status, reason
+	w.mu.Unlock()
+
+	if changed {
+		logger.Info("Camera health changed", "camera_id", ch.cameraID, "status", status, "reason", reason)
+	}
+	if err := w.write(ctx, ch, err, status, reason, now); err != nil {
+		logger.Warn("Failed to record camera health", "camera_id", ch.cameraID, "error", err)
+	}
+	if changed {
+		recordCtx, cancel := context.WithTimeout(ctx, dbTimeout)
+		defer cancel()
+		if err := outages.Record(recordCtx, w.db, ch.cameraID, status == "online", reason, now); err != nil {
+			logger.Warn("Failed to record camera outage", "camera_id", ch.cameraID, "error", err)
+		}
+	}
+}
+
+// verdict is a camera's status from the latest result of each of its
+// probes and, when offline, its most informative failure
+func verdict(results map[string]result) (status, reason string) {
+	var worst error
+	var worstKind string
+	for kind, r := range results {
+		if r.err == nil {
+			continue
+		}
+		if worst == nil || moreInformative(kind, r.err, worstKind, worst) {
+			worst, worstKind = r.err, kind
+		}
+	}
+	if worst == nil {
+		return "online", ""
+	}
+	return "offline", worstKind + ": " + worst.Error()
+}
+
+func moreInformative(kind string, err error, thanKind string, than error) bool {
+	if w, t := weight(err), weight(than); w != t {
+		return w > t
+	}
+	d, _ := lookup(kind)
+	td, _ := lookup(thanKind)
+	if d.depth != td.depth {
+		return d.depth > td.depth
+	}
+	// Stable between equals
+	return kind < thanKind
+}
+
+func (w *Watchdog) write(ctx context.Context, ch check, probeErr error, status, reason string, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	if ch.probeID != 0 {
+		message := ""
+		if probeErr != nil {
+			message = probeErr.Error()
+		}
+		_, err := w.db.ExecContext(ctx, `
+			UPDATE camera_probes SET last_ok = ?, last_error = ?, last_checked_at = ? WHERE id = ?
+		`, probeErr == nil, message, now, ch.probeID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A camera deleted since is skipped
+	_, err := w.db.ExecContext(ctx, `
+		INSERT INTO camera_health (camera_id, status, last_check, error_message, updated_at)
+		SELECT id, ?, ?, ?, ? FROM cameras WHERE id = ?
+		ON CONFLICT (camera_id) DO UPDATE SET status = excluded.status, last_check = excluded.last_check,
+			error_message = excluded.error_message, updated_at = excluded.updated_at
+	`, status, now, reason, now, ch.cameraID)
+	return err
+}
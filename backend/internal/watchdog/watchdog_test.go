@@ -0,0 +1,450 @@
+package watchdog
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+	"github.com/abcdefak87/cctv/internal/jobs"
+	"github.com/abcdefak87/cctv/internal/outages"
+)
+
+func probeContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// rtspServer answers DESCRIBE on a local port, asking for digest auth
+// unless the request carries a valid answer for user:secret
+func rtspServer(t *testing.T, path string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := textproto.NewReader(bufio.NewReader(conn))
+				for {
+					line, err := r.ReadLine()
+					if err != nil {
+						return
+					}
+					header, err := r.ReadMIMEHeader()
+					if err != nil {
+						return
+					}
+					uri := strings.Fields(line)[1]
+					cseq := header.Get("Cseq")
+					challenge := parseChallenge(`realm="cam", nonce="abc", qop="auth"`)
+					auth := parseChallenge(strings.TrimPrefix(header.Get("Authorization"), "Digest "))
+
+					switch {
+					case !strings.HasSuffix(uri, path):
+						fmt.Fprintf(conn, "RTSP/1.0 404 Not Found\r\nCSeq: %s\r\n\r\n", cseq)
+					case auth["response"] == "":
+						fmt.Fprintf(conn, "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\nWWW-Authenticate: Digest realm=\"cam\", nonce=\"abc\", qop=\"auth\"\r\n\r\n", cseq)
+					case digestResponse(challenge, auth, "user", "secret", "DESCRIBE", uri) != auth["response"]:
+						fmt.Fprintf(conn, "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\n\r\n", cseq)
+					default:
+						sdp := "v=0\r\n"
+						fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s", cseq, len(sdp), sdp)
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// digestResponse is the response a client should send to challenge,
+// hashed with the nonce count and cnonce it chose
+func digestResponse(challenge, auth map[string]string, user, password, method, uri string) string {
+	hash := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := hash(user + ":" + challenge["realm"] + ":" + password)
+	ha2 := hash(method + ":" + uri)
+	return hash(ha1 + ":" + challenge["nonce"] + ":" + auth["nc"] + ":" + auth["cnonce"] + ":auth:" + ha2)
+}
+
+func TestVerdict(t *testing.T) {
+	timeout := fmt.Errorf("dial: %w", context.DeadlineExceeded)
+	refused := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		results map[string]result
+		status  string
+		reason  string
+	}{
+		{"All pass", map[string]result{Ping: {}, RTSP: {}}, "online", ""},
+		{"Answer over network error", map[string]result{
+			TCP:  {err: refused},
+			RTSP: {err: answered("401 Unauthorized")},
+		}, "offline", "rtsp: 401 Unauthorized"},
+		{"Network error over timeout", map[string]result{
+			Ping: {err: refused},
+			RTSP: {err: timeout},
+		}, "offline", "ping: connection refused"},
+		{"Deeper probe between equals", map[string]result{
+			Ping: {err: timeout},
+			TCP:  {err: timeout},
+			HTTP: {},
+		}, "offline", "tcp: dial: context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, reason := verdict(tt.results)
+			if status != tt.status || reason != tt.reason {
+				t.Errorf("Expected %s %q, got %s %q", tt.status, tt.reason, status, reason)
+			}
+		})
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+
+	if err := tcpProbe(probeContext(t), Target{RTSPURL: "rtsp://" + addr + "/live"}); err != nil {
+		t.Errorf("Expected a pass, got %v", err)
+	}
+
+	ln.Close()
+	err = tcpProbe(probeContext(t), Target{Target: addr})
+	if err == nil {
+		t.Fatal("Expected a closed port to fail")
+	}
+	if w := weight(err); w != 1 {
+		t.Errorf("Expected a network error, got weight %d: %v", w, err)
+	}
+}
+
+func TestRTSPProbe(t *testing.T) {
+	addr := rtspServer(t, "/live")
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"Digest auth", "rtsp://user:secret@" + addr + "/live", ""},
+		{"Wrong password", "rtsp://user:wrong@" + addr + "/live", "401 Unauthorized, check the camera's user and password"},
+		{"Wrong path", "rtsp://user:secret@" + addr + "/other", "404 Not Found, check the path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rtspProbe(probeContext(t), Target{RTSPURL: tt.url})
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Expected a pass, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want || weight(err) != 2 {
+				t.Errorf("Expected the device's answer %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cam"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/snapshot.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte{0xff, 0xd8, 0xff, 0xd9})
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		}
+	}))
+	defer srv.Close()
+	base := strings.Replace(srv.URL, "http://", "http://admin:secret@", 1)
+
+	if err := httpProbe(probeContext(t), Target{Target: base + "/snapshot.jpg"}); err != nil {
+		t.Errorf("Expected a pass, got %v", err)
+	}
+	if err := httpProbe(probeContext(t), Target{Target: base + "/login"}); err == nil || !strings.HasPrefix(err.Error(), "not an image") {
+		t.Errorf("Expected a page to fail as not an image, got %v", err)
+	}
+	if err := httpProbe(probeContext(t), Target{Target: srv.URL + "/snapshot.jpg"}); err == nil || !strings.HasPrefix(err.Error(), "401") {
+		t.Errorf("Expected 401 without credentials, got %v", err)
+	}
+}
+
+func TestONVIFProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make([]byte, 4096)
+		n, _ := r.Body.Read(body)
+		w.Header().Set("Content-Type", "application/soap+xml")
+		if !strings.Contains(string(body[:n]), "<Username>admin</Username>") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:ter="http://www.onvif.org/ver10/error"><s:Body><s:Fault>`+
+				`<s:Code><s:Value>s:Sender</s:Value><s:Subcode><s:Value>ter:NotAuthorized</s:Value></s:Subcode></s:Code>`+
+				`<s:Reason><s:Text xml:lang="en">Sender not Authorized</s:Text></s:Reason></s:Fault></s:Body></s:Envelope>`)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl"><s:Body>`+
+			`<tds:GetDeviceInformationResponse><tds:Manufacturer>Acme</tds:Manufacturer><tds:Model>Cam</tds:Model></tds:GetDeviceInformationResponse></s:Body></s:Envelope>`)
+	}))
+	defer srv.Close()
+
+	if err := onvifProbe(probeContext(t), Target{Target: strings.Replace(srv.URL, "http://", "http://admin:secret@", 1)}); err != nil {
+		t.Errorf("Expected a pass, got %v", err)
+	}
+	err := onvifProbe(probeContext(t), Target{Target: srv.URL})
+	if err == nil || err.Error() != "fault: Sender not Authorized, check the camera's user and password" {
+		t.Errorf("Expected the fault's reason, got %v", err)
+	}
+}
+
+func TestPingProbe(t *testing.T) {
+	err := pingProbe(probeContext(t), Target{Target: "127.0.0.1"})
+	if err != nil && strings.HasPrefix(err.Error(), "ICMP not permitted") {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Errorf("Expected loopback to answer, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		probe Probe
+		field string
+	}{
+		{Probe{Type: RTSP}, ""},
+		{Probe{Type: TCP, Target: "10.0.0.5:8554", IntervalSeconds: 60, TimeoutSeconds: 10}, ""},
+		{Probe{Type: HTTP, Target: "https://10.0.0.5/snapshot.jpg"}, ""},
+		{Probe{Type: "smtp"}, "type"},
+		{Probe{Type: TCP, IntervalSeconds: 5, TimeoutSeconds: 10}, "timeout_seconds"},
+		{Probe{Type: TCP, Target: "10.0.0.5"}, "target"},
+		{Probe{Type: HTTP}, "target"},
+		{Probe{Type: ONVIF, Target: "rtsp://10.0.0.5/onvif"}, "target"},
+	}
+	for _, tt := range tests {
+		if field, msg := Check(tt.probe); field != tt.field {
+			t.Errorf("%+v: expected field %q, got %q (%s)", tt.probe, tt.field, field, msg)
+		}
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	open := "rtsp://" + ln.Addr().String() + "/live"
+
+	if _, err := db.Exec(`
+		INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled) VALUES
+			(1, 'Gate', ?, 'gate', TRUE),
+			(2, 'Yard', ?, 'yard', TRUE),
+			(3, 'Shed', ?, 'shed', FALSE)
+	`, open, open, open); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+
+	var failing error = answered("401 Unauthorized")
+	Register("fake", 2, func(ctx context.Context, t Target) error { return failing })
+	t.Cleanup(func() {
+		typesMu.Lock()
+		delete(types, "fake")
+		typesMu.Unlock()
+	})
+	if err := SaveProbes(ctx, db, 2, []Probe{{Type: TCP}, {Type: "fake", IntervalSeconds: 60}}); err != nil {
+		t.Fatalf("SaveProbes failed: %v", err)
+	}
+
+	w := New(db, Options{})
+	now := time.Now()
+	w.now = func() time.Time { return now }
+
+	health := func(id int) (status, message string) {
+		db.QueryRow(`SELECT status, COALESCE(error_message, '') FROM camera_health WHERE camera_id = ?`, id).Scan(&status, &message)
+		return
+	}
+	run := func() {
+		w.tick(ctx)
+		w.wg.Wait()
+	}
+
+	t.Run("Default TCP probe", func(t *testing.T) {
+		run()
+		if status, _ := health(1); status != "online" {
+			t.Errorf("Expected camera 1 online, got %q", status)
+		}
+		if status, _ := health(3); status != "" {
+			t.Errorf("Expected disabled camera 3 unchecked, got %q", status)
+		}
+	})
+
+	t.Run("Failing probe takes the camera offline", func(t *testing.T) {
+		status, message := health(2)
+		if status != "offline" || message != "fake: 401 Unauthorized" {
+			t.Errorf("Expected camera 2 offline with the probe's error, got %q %q", status, message)
+		}
+		probes, err := Probes(ctx, db, 2)
+		if err != nil || len(probes) != 2 {
+			t.Fatalf("Expected 2 probes, got %v, %v", probes, err)
+		}
+		if p := probes[1]; p.LastOK == nil || *p.LastOK || p.LastError != "401 Unauthorized" || p.LastCheckedAt == nil {
+			t.Errorf("Expected the fake probe's failure recorded, got %+v", p)
+		}
+	})
+
+	t.Run("Probes wait for their interval", func(t *testing.T) {
+		failing = nil
+		now = now.Add(45 * time.Second)
+		run()
+		if status, _ := health(2); status != "offline" {
+			t.Errorf("Expected the 60s probe not rerun after 45s, got %q", status)
+		}
+
+		now = now.Add(30 * time.Second)
+		run()
+		if status, message := health(2); status != "online" {
+			t.Errorf("Expected camera 2 back online, got %q %q", status, message)
+		}
+		list, err := outages.List(ctx, db, 2, now.Add(-time.Hour), now, now)
+		if err != nil || len(list) != 1 {
+			t.Fatalf("Expected one outage, got %+v, %v", list, err)
+		}
+		if o := list[0]; o.Ongoing || o.Duration != 75 || o.Cause != "fake: 401 Unauthorized" {
+			t.Errorf("Expected a 75s outage caused by the fake probe, got %+v", o)
+		}
+	})
+
+	t.Run("Removed probes stop counting", func(t *testing.T) {
+		failing = errors.New("down")
+		now = now.Add(time.Hour)
+		run()
+		if status, _ := health(2); status != "offline" {
+			t.Fatalf("Expected camera 2 offline, got %q", status)
+		}
+
+		if err := SaveProbes(ctx, db, 2, []Probe{{Type: TCP}}); err != nil {
+			t.Fatalf("SaveProbes failed: %v", err)
+		}
+		now = now.Add(time.Hour)
+		run()
+		if status, _ := health(2); status != "online" {
+			t.Errorf("Expected camera 2 online without the failing probe, got %q", status)
+		}
+		if list, _ := outages.List(ctx, db, 2, now.Add(-3*time.Hour), now, now); len(list) != 2 || list[1].Ongoing {
+			t.Errorf("Expected the second outage ended, got %+v", list)
+		}
+	})
+}
+
+func TestHealthCheck(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	open := "rtsp://" + ln.Addr().String() + "/live"
+
+	if _, err := db.Exec(`
+		INSERT INTO cameras (id, name, private_rtsp_url, stream_key, enabled) VALUES
+			(1, 'Gate', ?, 'gate', TRUE),
+			(2, 'Yard', ?, 'yard', TRUE),
+			(3, 'Shed', ?, 'shed', FALSE)
+	`, open, open, open); err != nil {
+		t.Fatalf("Failed to seed: %v", err)
+	}
+	Register("fake", 2, func(ctx context.Context, t Target) error { return answered("401 Unauthorized") })
+	t.Cleanup(func() {
+		typesMu.Lock()
+		delete(types, "fake")
+		typesMu.Unlock()
+	})
+	if err := SaveProbes(ctx, db, 2, []Probe{{Type: TCP}, {Type: "fake", IntervalSeconds: 3600}}); err != nil {
+		t.Fatalf("SaveProbes failed: %v", err)
+	}
+
+	queue := jobs.New(db, jobs.Options{})
+	userID := 7
+	check, err := Enqueue(ctx, db, queue, 1, []int{1, 2, 3}, &userID)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if check.ID == 0 || check.JobID == 0 || check.Status != CheckPending {
+		t.Fatalf("Expected a pending check with its job, got %+v", check)
+	}
+	if _, err := GetCheck(ctx, db, 2, check.ID); err != ErrCheckNotFound {
+		t.Errorf("Expected the check hidden from other organizations, got %v", err)
+	}
+
+	var payload string
+	if err := db.QueryRow(`SELECT payload FROM jobs WHERE id = ? AND type = ?`, check.JobID, JobType).Scan(&payload); err != nil {
+		t.Fatalf("Expected the job queued: %v", err)
+	}
+	w := New(db, Options{})
+	if err := w.RunCheck(ctx, json.RawMessage(payload)); err != nil {
+		t.Fatalf("RunCheck failed: %v", err)
+	}
+
+	got, err := GetCheck(ctx, db, 1, check.ID)
+	if err != nil {
+		t.Fatalf("GetCheck failed: %v", err)
+	}
+	if got.Status != CheckDone || got.FinishedAt == nil || got.RequestedBy == nil || *got.RequestedBy != 7 || len(got.Results) != 3 {
+		t.Fatalf("Expected the check done with 3 results, got %+v", got)
+	}
+	for i, want := range []CheckResult{
+		{CameraID: 1, Name: "Gate", Status: "online"},
+		{CameraID: 2, Name: "Yard", Status: "offline", Error: "fake: 401 Unauthorized"},
+		{CameraID: 3, Name: "Shed", Status: Skipped},
+	} {
+		if r := got.Results[i]; r.CameraID != want.CameraID || r.Name != want.Name || r.Status != want.Status || r.Error != want.Error {
+			t.Errorf("Result %d: expected %+v, got %+v", i, want, r)
+		}
+	}
+
+	var status string
+	db.QueryRow(`SELECT status FROM camera_health WHERE camera_id = 2`).Scan(&status)
+	if status != "offline" {
+		t.Errorf("Expected the camera's health written, got %q", status)
+	}
+}
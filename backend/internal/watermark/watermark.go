@@ -0,0 +1,117 @@
+// Package watermark burns branding text and the current time into the
+// public output of a camera, to discourage rebroadcasting the feeds.
+// go2rtc does the work: for each watermarked camera it is given a second
+// stream that transcodes the camera's stream through ffmpeg's drawtext
+// filter, and the stream proxy plays that one instead.
+package watermark
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix names the watermarked copy of a stream in go2rtc
+const Suffix = "_watermarked"
+
+// maxTextLen bounds the branding text drawn on the picture
+const maxTextLen = 48
+
+// refreshInterval is how often a registered stream is sent to go2rtc
+// again, so a restarted go2rtc gets it back
+const refreshInterval = 5 * time.Minute
+
+// Name returns the go2rtc name of the watermarked copy of streamKey
+func Name(streamKey string) string {
+	return streamKey + Suffix
+}
+
+// Source returns the go2rtc source that draws text and the time over
+// streamKey. The text is reduced to characters that need no escaping in
+// a go2rtc source or an ffmpeg filter.
+func Source(streamKey, text string) string {
+	filter := "drawtext=text='" + clean(text) + `  %{localtime\:%Y-%m-%d %H\:%M\:%S}'` +
+		":x=w-tw-16:y=h-th-16:fontsize=h/28:fontcolor=white@0.8:box=1:boxcolor=black@0.4:boxborderw=6"
+	return "ffmpeg:" + streamKey + `#video=h264#raw=-vf "` + filter + `"`
+}
+
+func clean(text string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range text {
+		if n == maxTextLen {
+			break
+		}
+		switch {
+		case r < ' ' || r == 0x7f:
+			continue
+		case strings.ContainsRune(`'"\#%:;,[]=`, r):
+			r = ' '
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Registrar keeps go2rtc's watermarked streams in step with the branding
+type Registrar struct {
+	mu         sync.Mutex
+	registered map[string]registration // go2rtc address and name -> what was sent
+	now        func() time.Time
+}
+
+type registration struct {
+	source string
+	at     time.Time
+}
+
+func NewRegistrar() *Registrar {
+	return &Registrar{registered: map[string]registration{}, now: time.Now}
+}
+
+// Ensure makes sure the go2rtc at apiURL, reached with client, has the
+// watermarked copy of streamKey with text, and returns its name
+func (r *Registrar) Ensure(ctx context.Context, client *http.Client, apiURL, streamKey, text string) (string, error) {
+	return r.Register(ctx, client, apiURL, Name(streamKey), Source(streamKey, text))
+}
+
+// Register makes sure the go2rtc at apiURL has a stream called name
+// playing source, and returns name. Besides the watermarked copies it
+// keeps other streams derived through ffmpeg, such as the audio-only
+// ones. go2rtc is only called when the source changed or the last call
+// is older than refreshInterval.
+func (r *Registrar) Register(ctx context.Context, client *http.Client, apiURL, name, source string) (string, error) {
+	key := apiURL + " " + name
+
+	r.mu.Lock()
+	reg, ok := r.registered[key]
+	r.mu.Unlock()
+	if ok && reg.source == source && r.now().Sub(reg.at) < refreshInterval {
+		return name, nil
+	}
+
+	query := url.Values{"name": {name}, "src": {source}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		strings.TrimRight(apiURL, "/")+"/api/streams?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("go2rtc returned %s", resp.Status)
+	}
+
+	r.mu.Lock()
+	r.registered[key] = registration{source: source, at: r.now()}
+	r.mu.Unlock()
+	return name, nil
+}
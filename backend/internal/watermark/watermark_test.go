@@ -0,0 +1,72 @@
+package watermark
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSource(t *testing.T) {
+	src := Source("gate", `RAF NET: "Desa" #1 'x'`)
+	if !strings.HasPrefix(src, "ffmpeg:gate#video=h264#raw=-vf ") {
+		t.Errorf("Expected an ffmpeg source over the camera stream, got %q", src)
+	}
+	if !strings.Contains(src, "text='RAF NET   Desa   1  x  %{localtime") {
+		t.Errorf("Expected the text with special characters blanked, got %q", src)
+	}
+	if strings.Count(src, "#") != 2 {
+		t.Errorf("Expected no # beyond the source options, got %q", src)
+	}
+
+	long := Source("gate", strings.Repeat("a", 100))
+	if !strings.Contains(long, "'"+strings.Repeat("a", maxTextLen)+"  %") {
+		t.Errorf("Expected the text cut at %d characters, got %q", maxTextLen, long)
+	}
+}
+
+func TestRegistrar(t *testing.T) {
+	var puts []string
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/api/streams" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		puts = append(puts, r.URL.Query().Get("name")+" "+r.URL.Query().Get("src"))
+	}))
+	defer go2rtc.Close()
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	r := NewRegistrar()
+	r.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	t.Run("Registers once", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			name, err := r.Ensure(ctx, http.DefaultClient, go2rtc.URL, "gate", "RAF NET")
+			if err != nil || name != "gate_watermarked" {
+				t.Fatalf("Expected gate_watermarked, got %q %v", name, err)
+			}
+		}
+		if len(puts) != 1 || puts[0] != "gate_watermarked "+Source("gate", "RAF NET") {
+			t.Errorf("Expected one registration, got %q", puts)
+		}
+	})
+
+	t.Run("Registers again", func(t *testing.T) {
+		r.Ensure(ctx, http.DefaultClient, go2rtc.URL, "gate", "Desa Dander")
+		now = now.Add(refreshInterval)
+		r.Ensure(ctx, http.DefaultClient, go2rtc.URL, "gate", "Desa Dander")
+		if len(puts) != 3 {
+			t.Errorf("Expected new branding and the refresh to register again, got %d registrations", len(puts))
+		}
+	})
+
+	t.Run("go2rtc error", func(t *testing.T) {
+		if _, err := r.Ensure(ctx, http.DefaultClient, go2rtc.URL+"/missing", "market", "RAF NET"); err == nil {
+			t.Error("Expected an error when go2rtc refuses the stream")
+		}
+	})
+}
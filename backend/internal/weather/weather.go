@@ -0,0 +1,285 @@
+// Package weather looks up current conditions for the public map's
+// weather overlay: at the map center and at each area, placed at the
+// middle of its boundary or, without one, at the average position of
+// its cameras. Conditions come from OpenWeatherMap and are cached per
+// grid cell, so neighbouring RTs share one lookup.
+package weather
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/tenant"
+	"github.com/abcdefak87/cctv/pkg/geo"
+	"github.com/abcdefak87/cctv/pkg/httpclient"
+	"github.com/abcdefak87/cctv/pkg/logger"
+)
+
+// GridDegrees is the size of a cache cell, about 5.5 km at the equator.
+// Weather does not change much within one.
+const GridDegrees = 0.05
+
+// DefaultCenter is used when the organization has not set
+// map_default_center, as GET /api/settings/map-center does
+var DefaultCenter = Location{Name: "Bojonegoro", Latitude: -7.150370, Longitude: 112.034990}
+
+// Conditions is the current weather at a place
+type Conditions struct {
+	Condition   string    `json:"condition"` // OpenWeatherMap's group, e.g. Clear, Clouds, Rain
+	Description string    `json:"description"`
+	Icon        string    `json:"icon"`        // OpenWeatherMap icon code, e.g. 10d
+	Temperature float64   `json:"temperature"` // °C
+	FeelsLike   float64   `json:"feels_like"`  // °C
+	Humidity    int       `json:"humidity"`    // percent
+	WindSpeed   float64   `json:"wind_speed"`  // m/s
+	Rain1h      *float64  `json:"rain_1h"`     // mm in the last hour, when it rained
+	ObservedAt  time.Time `json:"observed_at"`
+}
+
+// Location is a place on the map with its weather. AreaID is nil for the
+// map center. Conditions is nil when they could not be fetched, or the
+// request went past WEATHER_MAX_LOCATIONS.
+type Location struct {
+	AreaID     *int        `json:"area_id"`
+	Name       string      `json:"name"`
+	Latitude   float64     `json:"latitude"`
+	Longitude  float64     `json:"longitude"`
+	Conditions *Conditions `json:"conditions"`
+}
+
+// Report is the weather overlay of one organization's map
+type Report struct {
+	Enabled   bool       `json:"enabled"`
+	Locations []Location `json:"locations"` // map center first
+}
+
+// Provider fetches current conditions
+type Provider interface {
+	Current(ctx context.Context, lat, lng float64) (*Conditions, error)
+}
+
+// OpenWeatherMap calls the OpenWeatherMap current weather API
+type OpenWeatherMap struct {
+	URL    string
+	APIKey string
+}
+
+type owmResponse struct {
+	Weather []struct {
+		Main        string `json:"main"`
+		Description string `json:"description"`
+		Icon        string `json:"icon"`
+	} `json:"weather"`
+	Main struct {
+		Temp      float64 `json:"temp"`
+		FeelsLike float64 `json:"feels_like"`
+		Humidity  int     `json:"humidity"`
+	} `json:"main"`
+	Wind struct {
+		Speed float64 `json:"speed"`
+	} `json:"wind"`
+	Rain *struct {
+		OneHour *float64 `json:"1h"`
+	} `json:"rain"`
+	Dt int64 `json:"dt"`
+}
+
+// maxResponse bounds the response read; answers are under 1 KB
+const maxResponse = 64 << 10
+
+func (o *OpenWeatherMap) Current(ctx context.Context, lat, lng float64) (*Conditions, error) {
+	q := url.Values{}
+	q.Set("lat", strconv.FormatFloat(lat, 'f', 4, 64))
+	q.Set("lon", strconv.FormatFloat(lng, 'f', 4, 64))
+	q.Set("units", "metric")
+	q.Set("appid", o.APIKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.URL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpclient.Shared().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("weather provider returned %s", resp.Status)
+	}
+
+	var result owmResponse
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid weather response: %w", err)
+	}
+	c := &Conditions{
+		Temperature: result.Main.Temp,
+		FeelsLike:   result.Main.FeelsLike,
+		Humidity:    result.Main.Humidity,
+		WindSpeed:   result.Wind.Speed,
+		ObservedAt:  time.Unix(result.Dt, 0).UTC(),
+	}
+	if len(result.Weather) > 0 {
+		c.Condition = result.Weather[0].Main
+		c.Description = result.Weather[0].Description
+		c.Icon = result.Weather[0].Icon
+	}
+	if result.Rain != nil {
+		c.Rain1h = result.Rain.OneHour
+	}
+	return c, nil
+}
+
+// cell is a GridDegrees square, by its south-west corner in grid steps
+type cell struct{ lat, lng int }
+
+func cellOf(lat, lng float64) cell {
+	return cell{int(math.Floor(lat / GridDegrees)), int(math.Floor(lng / GridDegrees))}
+}
+
+type entry struct {
+	conditions *Conditions
+	fetched    time.Time
+}
+
+// Cache keeps conditions from a Provider for a while per grid cell. It
+// is safe for concurrent use.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[cell]entry
+	now     func() time.Time
+}
+
+func NewCache(provider Provider, ttl time.Duration) *Cache {
+	return &Cache{provider: provider, ttl: ttl, entries: map[cell]entry{}, now: time.Now}
+}
+
+// Current returns the conditions of the cell lat, lng lies in, fetching
+// them for the middle of the cell when the cache has none or they are
+// older than the TTL
+func (c *Cache) Current(ctx context.Context, lat, lng float64) (*Conditions, error) {
+	key := cellOf(lat, lng)
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Sub(e.fetched) < c.ttl {
+		return e.conditions, nil
+	}
+
+	midLat := (float64(key.lat) + 0.5) * GridDegrees
+	midLng := (float64(key.lng) + 0.5) * GridDegrees
+	conditions, err := c.provider.Current(ctx, midLat, midLng)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if now.Sub(e.fetched) >= c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry{conditions: conditions, fetched: now}
+	return conditions, nil
+}
+
+// Locations returns the map center and the areas of the organization in
+// ctx that have a boundary or cameras with coordinates, by name
+func Locations(ctx context.Context, db *sql.DB) ([]Location, error) {
+	orgID := tenant.OrgID(ctx)
+
+	center := DefaultCenter
+	var value string
+	err := db.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = 'map_default_center' AND organization_id = ?`,
+		orgID).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		var set struct {
+			Name      string   `json:"name"`
+			Latitude  *float64 `json:"latitude"`
+			Longitude *float64 `json:"longitude"`
+		}
+		if json.Unmarshal([]byte(value), &set) == nil && set.Latitude != nil && set.Longitude != nil {
+			center = Location{Name: set.Name, Latitude: *set.Latitude, Longitude: *set.Longitude}
+		}
+	}
+	list := []Location{center}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT a.id, a.name, a.boundary,
+		       (SELECT AVG(c.latitude) FROM cameras c
+		        WHERE c.area_id = a.id AND c.latitude IS NOT NULL AND c.longitude IS NOT NULL),
+		       (SELECT AVG(c.longitude) FROM cameras c
+		        WHERE c.area_id = a.id AND c.latitude IS NOT NULL AND c.longitude IS NOT NULL)
+		FROM areas a
+		WHERE a.organization_id = ?
+		ORDER BY a.name ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		var boundary sql.NullString
+		var lat, lng sql.NullFloat64
+		if err := rows.Scan(&id, &name, &boundary, &lat, &lng); err != nil {
+			return nil, err
+		}
+
+		l := Location{AreaID: &id, Name: name, Latitude: lat.Float64, Longitude: lng.Float64}
+		if boundary.Valid && boundary.String != "" {
+			if b, err := geo.ParseBoundary([]byte(boundary.String)); err == nil {
+				l.Latitude, l.Longitude = b.Center()
+				list = append(list, l)
+				continue
+			}
+		}
+		if lat.Valid && lng.Valid {
+			list = append(list, l)
+		}
+	}
+	return list, rows.Err()
+}
+
+// Fill looks up the conditions of the first limit locations. Locations
+// that fail are logged and left without conditions.
+func Fill(ctx context.Context, cache *Cache, list []Location, limit int) {
+	for i := range list {
+		if i >= limit {
+			return
+		}
+		conditions, err := cache.Current(ctx, list[i].Latitude, list[i].Longitude)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.FromContext(ctx).Warn("Failed to fetch weather", "location", list[i].Name, "error", err)
+			}
+			continue
+		}
+		list[i].Conditions = conditions
+	}
+}
@@ -0,0 +1,125 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcdefak87/cctv/internal/database/dbtest"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+type fakeProvider struct {
+	calls int
+	err   error
+}
+
+func (f *fakeProvider) Current(ctx context.Context, lat, lng float64) (*Conditions, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &Conditions{Condition: "Rain", Temperature: 26.5}, nil
+}
+
+func TestOpenWeatherMap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("appid") != "key" || r.URL.Query().Get("lat") != "-7.1500" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"weather":[{"main":"Rain","description":"light rain","icon":"10d"}],
+			"main":{"temp":26.5,"feels_like":28,"humidity":84},"wind":{"speed":2.1},"rain":{"1h":0.4},"dt":1773144000}`))
+	}))
+	defer server.Close()
+
+	c, err := (&OpenWeatherMap{URL: server.URL, APIKey: "key"}).Current(context.Background(), -7.15, 112.03)
+	if err != nil {
+		t.Fatalf("Current failed: %v", err)
+	}
+	if c.Condition != "Rain" || c.Humidity != 84 || c.Rain1h == nil || *c.Rain1h != 0.4 {
+		t.Errorf("Expected light rain, got %+v", c)
+	}
+
+	if _, err := (&OpenWeatherMap{URL: server.URL, APIKey: "wrong"}).Current(context.Background(), -7.15, 112.03); err == nil {
+		t.Error("Expected an error for a rejected key")
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	provider := &fakeProvider{}
+	cache := NewCache(provider, 10*time.Minute)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	cache.Current(ctx, -7.151, 112.031)
+	cache.Current(ctx, -7.152, 112.032)
+	if provider.calls != 1 {
+		t.Errorf("Expected nearby places to share a lookup, got %d calls", provider.calls)
+	}
+
+	cache.Current(ctx, -7.4, 112.031)
+	if provider.calls != 2 {
+		t.Errorf("Expected a lookup for another cell, got %d calls", provider.calls)
+	}
+
+	now = now.Add(10 * time.Minute)
+	cache.Current(ctx, -7.151, 112.031)
+	if provider.calls != 3 {
+		t.Errorf("Expected a lookup once the TTL passed, got %d calls", provider.calls)
+	}
+}
+
+func TestLocations(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+
+	for _, stmt := range []string{
+		`INSERT INTO settings (key, value) VALUES ('map_default_center', '{"name":"Dander","latitude":-7.2,"longitude":111.9,"zoom":14}')`,
+		`INSERT INTO areas (id, name, boundary) VALUES
+			(1, 'RT 01', '{"type":"Polygon","coordinates":[[[112.0,-7.2],[112.1,-7.2],[112.1,-7.1],[112.0,-7.1],[112.0,-7.2]]]}'),
+			(2, 'RT 02', NULL),
+			(3, 'RT 03', NULL)`,
+		`INSERT INTO cameras (name, private_rtsp_url, area_id, latitude, longitude) VALUES
+			('Gate', 'rtsp://a', 2, -7.10, 112.00),
+			('Market', 'rtsp://b', 2, -7.12, 112.02)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+	}
+
+	list, err := Locations(ctx, db)
+	if err != nil {
+		t.Fatalf("Locations failed: %v", err)
+	}
+	if len(list) != 3 || list[0].Name != "Dander" || list[0].AreaID != nil {
+		t.Fatalf("Expected the map center and 2 areas, got %+v", list)
+	}
+	if list[1].Name != "RT 01" || !near(list[1].Latitude, -7.15) || !near(list[1].Longitude, 112.05) {
+		t.Errorf("Expected RT 01 at the middle of its boundary, got %+v", list[1])
+	}
+	if list[2].Name != "RT 02" || !near(list[2].Latitude, -7.11) || !near(list[2].Longitude, 112.01) {
+		t.Errorf("Expected RT 02 between its cameras, got %+v", list[2])
+	}
+
+	t.Run("Fill", func(t *testing.T) {
+		provider := &fakeProvider{}
+		Fill(ctx, NewCache(provider, time.Minute), list, 2)
+		if list[0].Conditions == nil || list[1].Conditions == nil || list[2].Conditions != nil {
+			t.Errorf("Expected conditions for the first 2 locations only, got %+v", list)
+		}
+
+		failing := []Location{{Name: "Dander"}}
+		Fill(ctx, NewCache(&fakeProvider{err: errors.New("timeout")}, time.Minute), failing, 5)
+		if failing[0].Conditions != nil {
+			t.Errorf("Expected no conditions after a failed lookup, got %+v", failing[0].Conditions)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Package breaker is a circuit breaker for calls to an upstream service.
+// After enough consecutive failures it opens and calls fail at once
+// instead of each waiting out a dial timeout; after a cooldown one call
+// is let through to probe whether the upstream has recovered.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State of a breaker
+type State int
+
+const (
+	Closed   State = iota // calls go through
+	Open                  // calls fail fast
+	HalfOpen              // one probe call is in flight
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// ErrOpen is returned by Allow while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+const (
+	defaultFailures = 5
+	defaultCooldown = 10 * time.Second
+)
+
+// Options configure a breaker; zero values use the defaults
+type Options struct {
+	// Failures is how many consecutive failures open the breaker
+	Failures int
+
+	// Cooldown is how long the breaker stays open before a probe
+	Cooldown time.Duration
+
+	// OnStateChange is called, outside the breaker's lock, whenever the
+	// state changes
+	OnStateChange func(name string, from, to State)
+}
+
+// Breaker guards one upstream route. It is safe for concurrent use.
+type Breaker struct {
+	name string
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+
+	// changes holds state changes until the lock is released, so
+	// OnStateChange may call back into the breaker
+	changes []change
+}
+
+type change struct{ from, to State }
+
+func New(name string, opts Options) *Breaker {
+	if opts.Failures <= 0 {
+		opts.Failures = defaultFailures
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = defaultCooldown
+	}
+	return &Breaker{name: name, opts: opts, now: time.Now}
+}
+
+// Name identifies the breaker in events and logs
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Allow asks to make a call. It returns ErrOpen while the breaker is
+// open, or while another call is probing a half-open breaker. Otherwise
+// the caller must report the outcome through done exactly once; a call
+// that ended for reasons unrelated to the upstream (the client went
+// away) should report success.
+func (b *Breaker) Allow() (done func(ok bool), err error) {
+	b.mu.Lock()
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.opts.Cooldown {
+			b.mu.Unlock()
+			return nil, ErrOpen
+		}
+		b.setState(HalfOpen)
+	case HalfOpen:
+		b.mu.Unlock()
+		return nil, ErrOpen
+	}
+	b.mu.Unlock()
+	b.notify()
+
+	var once sync.Once
+	return func(ok bool) {
+		once.Do(func() { b.record(ok) })
+	}, nil
+}
+
+func (b *Breaker) record(ok bool) {
+	b.mu.Lock()
+	if ok {
+		b.failures = 0
+		if b.state == HalfOpen {
+			b.setState(Closed)
+		}
+	} else {
+		b.failures++
+		if b.state == HalfOpen || b.failures >= b.opts.Failures {
+			b.openedAt = b.now()
+			if b.state != Open {
+				b.setState(Open)
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.notify()
+}
+
+// State reports the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// RetryAfter is how long until an open breaker lets a probe through,
+// zero when it is not open
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != Open {
+		return 0
+	}
+	if wait := b.opts.Cooldown - b.now().Sub(b.openedAt); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// setState must be called with the lock held
+func (b *Breaker) setState(to State) {
+	b.changes = append(b.changes, change{b.state, to})
+	b.state = to
+}
+
+// notify reports the changes made under the lock, which it must not hold
+func (b *Breaker) notify() {
+	b.mu.Lock()
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	if b.opts.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.opts.OnStateChange(b.name, c.from, c.to)
+	}
+}
@@ -0,0 +1,129 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+// testBreaker returns a breaker on a clock the test moves by hand
+func testBreaker(opts Options) (*Breaker, *time.Time) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := New("test", opts)
+	b.now = func() time.Time { return clock }
+	return b, &clock
+}
+
+func fail(t *testing.T, b *Breaker, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		done, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Expected call %d to be allowed, got %v", i+1, err)
+		}
+		done(false)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	t.Run("Opens after consecutive failures", func(t *testing.T) {
+		b, _ := testBreaker(Options{Failures: 3, Cooldown: time.Minute})
+
+		fail(t, b, 2)
+		if b.State() != Closed {
+			t.Fatalf("Expected closed after 2 failures, got %s", b.State())
+		}
+		fail(t, b, 1)
+		if b.State() != Open {
+			t.Fatalf("Expected open after 3 failures, got %s", b.State())
+		}
+		if _, err := b.Allow(); err != ErrOpen {
+			t.Errorf("Expected ErrOpen, got %v", err)
+		}
+		if wait := b.RetryAfter(); wait != time.Minute {
+			t.Errorf("Expected RetryAfter 1m, got %s", wait)
+		}
+	})
+
+	t.Run("Success resets the count", func(t *testing.T) {
+		b, _ := testBreaker(Options{Failures: 2})
+
+		fail(t, b, 1)
+		done, _ := b.Allow()
+		done(true)
+		fail(t, b, 1)
+		if b.State() != Closed {
+			t.Errorf("Expected closed, got %s", b.State())
+		}
+	})
+
+	t.Run("Half-open lets one probe through", func(t *testing.T) {
+		b, clock := testBreaker(Options{Failures: 1, Cooldown: time.Minute})
+		fail(t, b, 1)
+
+		*clock = clock.Add(time.Minute)
+		probe, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Expected the probe to be allowed, got %v", err)
+		}
+		if b.State() != HalfOpen {
+			t.Errorf("Expected half_open, got %s", b.State())
+		}
+		if _, err := b.Allow(); err != ErrOpen {
+			t.Errorf("Expected ErrOpen during the probe, got %v", err)
+		}
+
+		probe(true)
+		if b.State() != Closed {
+			t.Errorf("Expected closed after a good probe, got %s", b.State())
+		}
+	})
+
+	t.Run("Failed probe reopens", func(t *testing.T) {
+		b, clock := testBreaker(Options{Failures: 3, Cooldown: time.Minute})
+		fail(t, b, 3)
+
+		*clock = clock.Add(time.Minute)
+		fail(t, b, 1)
+		if b.State() != Open {
+			t.Errorf("Expected open after a failed probe, got %s", b.State())
+		}
+		if wait := b.RetryAfter(); wait != time.Minute {
+			t.Errorf("Expected the cooldown to restart, got %s", wait)
+		}
+	})
+
+	t.Run("Done counts once", func(t *testing.T) {
+		b, _ := testBreaker(Options{Failures: 2})
+
+		done, _ := b.Allow()
+		done(false)
+		done(false)
+		if b.State() != Closed {
+			t.Errorf("Expected closed, got %s", b.State())
+		}
+	})
+
+	t.Run("Reports state changes", func(t *testing.T) {
+		var changes []string
+		b, clock := testBreaker(Options{Failures: 1, Cooldown: time.Second,
+			OnStateChange: func(name string, from, to State) {
+				changes = append(changes, name+":"+from.String()+">"+to.String())
+			}})
+
+		fail(t, b, 1)
+		*clock = clock.Add(time.Second)
+		done, _ := b.Allow()
+		done(true)
+
+		expected := []string{"test:closed>open", "test:open>half_open", "test:half_open>closed"}
+		if len(changes) != len(expected) {
+			t.Fatalf("Expected %v, got %v", expected, changes)
+		}
+		for i := range expected {
+			if changes[i] != expected[i] {
+				t.Errorf("Expected %v, got %v", expected, changes)
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Position is a GeoJSON position in [longitude, latitude] order
+type Position [2]float64
+
+// Ring is a closed linear ring; the first ring of a polygon is the
+// exterior and any following rings are holes
+type Ring []Position
+
+type Polygon []Ring
+
+// Boundary is a validated Polygon or MultiPolygon
+type Boundary struct {
+	Polygons []Polygon
+}
+
+type rawGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    json.RawMessage `json:"geometry"`
+}
+
+// ParseBoundary parses and validates a GeoJSON Polygon or MultiPolygon.
+// A Feature wrapping one of those is unwrapped.
+func ParseBoundary(data []byte) (*Boundary, error) {
+	var raw rawGeometry
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	if raw.Type == "Feature" {
+		if len(raw.Geometry) == 0 || string(raw.Geometry) == "null" {
+			return nil, errors.New("feature has no geometry")
+		}
+		return ParseBoundary(raw.Geometry)
+	}
+
+	var polygons []Polygon
+	switch raw.Type {
+	case "Polygon":
+		var p Polygon
+		if err := json.Unmarshal(raw.Coordinates, &p); err != nil {
+			return nil, fmt.Errorf("invalid polygon coordinates: %w", err)
+		}
+		polygons = []Polygon{p}
+	case "MultiPolygon":
+		if err := json.Unmarshal(raw.Coordinates, &polygons); err != nil {
+			return nil, fmt.Errorf("invalid multipolygon coordinates: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q, expected Polygon or MultiPolygon", raw.Type)
+	}
+
+	if len(polygons) == 0 {
+		return nil, errors.New("geometry has no polygons")
+	}
+
+	for i, polygon := range polygons {
+		if err := validatePolygon(polygon); err != nil {
+			return nil, fmt.Errorf("polygon %d: %w", i, err)
+		}
+	}
+
+	return &Boundary{Polygons: polygons}, nil
+}
+
+func validatePolygon(p Polygon) error {
+	if len(p) == 0 {
+		return errors.New("polygon has no rings")
+	}
+
+	for i, ring := range p {
+		if len(ring) < 4 {
+			return fmt.Errorf("ring %d needs at least 4 positions", i)
+		}
+		if ring[0] != ring[len(ring)-1] {
+			return fmt.Errorf("ring %d is not closed", i)
+		}
+		for _, pos := range ring {
+			if pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+				return fmt.Errorf("ring %d has position %v out of range", i, pos)
+			}
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes the boundary as a Polygon or MultiPolygon geometry
+func (b *Boundary) MarshalJSON() ([]byte, error) {
+	if len(b.Polygons) == 1 {
+		return json.Marshal(map[string]interface{}{
+			"type":        "Polygon",
+			"coordinates": b.Polygons[0],
+		})
+	}
+	return json.Marshal(map[string]interface{}{
+		"type":        "MultiPolygon",
+		"coordinates": b.Polygons,
+	})
+}
+
+// Contains reports whether the point lies inside any polygon, outside
+// of that polygon's holes
+func (b *Boundary) Contains(lat, lng float64) bool {
+	for _, polygon := range b.Polygons {
+		if !ringContains(polygon[0], lng, lat) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringContains(hole, lng, lat) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// Area returns the planar area in square degrees. It is only meant for
+// ranking boundaries by size, e.g. to prefer an RT over its kelurahan.
+func (b *Boundary) Area() float64 {
+	total := 0.0
+	for _, polygon := range b.Polygons {
+		total += ringArea(polygon[0])
+		for _, hole := range polygon[1:] {
+			total -= ringArea(hole)
+		}
+	}
+	return total
+}
+
+// Center returns the middle of the boundary's bounding box as latitude
+// and longitude. It is close enough for looking up things that vary over
+// kilometres, such as the weather.
+func (b *Boundary) Center() (lat, lng float64) {
+	minLng, minLat := math.Inf(1), math.Inf(1)
+	maxLng, maxLat := math.Inf(-1), math.Inf(-1)
+	for _, polygon := range b.Polygons {
+		for _, p := range polygon[0] {
+			minLng, maxLng = math.Min(minLng, p[0]), math.Max(maxLng, p[0])
+			minLat, maxLat = math.Min(minLat, p[1]), math.Max(maxLat, p[1])
+		}
+	}
+	return (minLat + maxLat) / 2, (minLng + maxLng) / 2
+}
+
+// ringContains uses ray casting on a [lng, lat] plane
+func ringContains(ring Ring, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func ringArea(ring Ring) float64 {
+	sum := 0.0
+	for i := 0; i < len(ring)-1; i++ {
+		sum += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return math.Abs(sum) / 2
+}
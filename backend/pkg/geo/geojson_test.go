@@ -0,0 +1,100 @@
+package geo
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+const squareWithHole = `{
+	"type": "Polygon",
+	"coordinates": [
+		[[112.0, -7.2], [112.1, -7.2], [112.1, -7.1], [112.0, -7.1], [112.0, -7.2]],
+		[[112.04, -7.16], [112.06, -7.16], [112.06, -7.14], [112.04, -7.14], [112.04, -7.16]]
+	]
+}`
+
+func TestParseBoundary(t *testing.T) {
+	t.Run("Valid polygon", func(t *testing.T) {
+		b, err := ParseBoundary([]byte(squareWithHole))
+		if err != nil {
+			t.Fatalf("Expected valid polygon, got error: %v", err)
+		}
+
+		if len(b.Polygons) != 1 {
+			t.Errorf("Expected 1 polygon, got %d", len(b.Polygons))
+		}
+	})
+
+	t.Run("Feature is unwrapped", func(t *testing.T) {
+		feature := `{"type": "Feature", "properties": {}, "geometry": ` + squareWithHole + `}`
+		if _, err := ParseBoundary([]byte(feature)); err != nil {
+			t.Errorf("Expected feature to parse, got error: %v", err)
+		}
+	})
+
+	t.Run("Invalid geometries", func(t *testing.T) {
+		cases := map[string]string{
+			"point":        `{"type": "Point", "coordinates": [112.0, -7.1]}`,
+			"open ring":    `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1]]]}`,
+			"too short":    `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [0, 0]]]}`,
+			"out of range": `{"type": "Polygon", "coordinates": [[[0, 0], [200, 0], [1, 1], [0, 0]]]}`,
+			"not json":     `polygon`,
+		}
+
+		for name, input := range cases {
+			if _, err := ParseBoundary([]byte(input)); err == nil {
+				t.Errorf("Expected error for %s", name)
+			}
+		}
+	})
+}
+
+func TestBoundaryContains(t *testing.T) {
+	b, err := ParseBoundary([]byte(squareWithHole))
+	if err != nil {
+		t.Fatalf("Failed to parse boundary: %v", err)
+	}
+
+	if !b.Contains(-7.18, 112.02) {
+		t.Error("Expected point inside exterior ring to be contained")
+	}
+
+	if b.Contains(-7.15, 112.05) {
+		t.Error("Expected point inside hole to be excluded")
+	}
+
+	if b.Contains(-7.3, 112.05) {
+		t.Error("Expected point outside polygon to be excluded")
+	}
+}
+
+func TestBoundaryCenter(t *testing.T) {
+	b, err := ParseBoundary([]byte(squareWithHole))
+	if err != nil {
+		t.Fatalf("Failed to parse boundary: %v", err)
+	}
+
+	lat, lng := b.Center()
+	if math.Abs(lat-(-7.15)) > 1e-9 || math.Abs(lng-112.05) > 1e-9 {
+		t.Errorf("Expected -7.15, 112.05, got %v, %v", lat, lng)
+	}
+}
+
+func TestBoundaryMarshal(t *testing.T) {
+	b, _ := ParseBoundary([]byte(squareWithHole))
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	if !strings.Contains(string(data), `"type":"Polygon"`) {
+		t.Errorf("Expected Polygon type, got %s", data)
+	}
+
+	if b.Area() <= 0 {
+		t.Errorf("Expected positive area, got %f", b.Area())
+	}
+}
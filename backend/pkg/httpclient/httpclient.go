@@ -0,0 +1,96 @@
+// Package httpclient builds the HTTP client used for outbound requests:
+// go2rtc/MediaMTX, webhooks and Telegram. One shared client keeps
+// connections to the stream server alive between HLS segments instead
+// of dialling for each one.
+package httpclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultMaxIdleConns = 100
+)
+
+// Options configure a client; zero values use the defaults
+type Options struct {
+	// Timeout bounds connecting, the TLS handshake and waiting for
+	// response headers. Bodies are not bounded, since a proxied stream
+	// runs as long as its viewer; callers set a context deadline for
+	// requests that should end.
+	Timeout time.Duration
+
+	// MaxIdleConns is the number of keep-alive connections kept, per
+	// host and in total
+	MaxIdleConns int
+
+	// Proxy is the URL requests are sent through. Empty uses
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY from the environment.
+	Proxy string
+
+	// InsecureSkipVerify accepts any server certificate, for cameras and
+	// NVRs with self-signed web UIs
+	InsecureSkipVerify bool
+}
+
+// New returns a client for opts. It fails only on a malformed proxy URL.
+func New(opts Options) (*http.Client, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = defaultMaxIdleConns
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		u, err := url.Parse(opts.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   opts.Timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConns,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify},
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+var shared atomic.Pointer[http.Client]
+
+func init() {
+	c, _ := New(Options{})
+	shared.Store(c)
+}
+
+// Shared returns the process-wide client. Until SetShared is called it
+// uses the default options.
+func Shared() *http.Client {
+	return shared.Load()
+}
+
+// SetShared replaces the process-wide client; serve calls it once the
+// configuration is loaded
+func SetShared(c *http.Client) {
+	shared.Store(c)
+}
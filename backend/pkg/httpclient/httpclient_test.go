@@ -0,0 +1,93 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("Invalid proxy", func(t *testing.T) {
+		for _, proxy := range []string{"::not a url", "localhost"} {
+			if _, err := New(Options{Proxy: proxy}); err == nil {
+				t.Errorf("Expected an error for proxy %q", proxy)
+			}
+		}
+	})
+
+	t.Run("Requests go through the proxy", func(t *testing.T) {
+		var requested string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = r.URL.String()
+			w.Write([]byte("proxied"))
+		}))
+		defer proxy.Close()
+
+		client, err := New(Options{Proxy: proxy.URL})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		resp, err := client.Get("http://camera.invalid/snapshot.jpg")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if requested != "http://camera.invalid/snapshot.jpg" || string(body) != "proxied" {
+			t.Errorf("Expected the proxy to get the request, got %q (%s)", requested, body)
+		}
+	})
+
+	t.Run("Self-signed certificates", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		strict, _ := New(Options{})
+		if _, err := strict.Get(server.URL); err == nil {
+			t.Error("Expected an unknown certificate to be rejected")
+		}
+
+		insecure, _ := New(Options{InsecureSkipVerify: true})
+		resp, err := insecure.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Expected skip-verify to accept the certificate, got %v", err)
+		}
+		resp.Body.Close()
+	})
+
+	t.Run("Slow response headers time out", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		client, _ := New(Options{Timeout: 50 * time.Millisecond})
+		start := time.Now()
+		if _, err := client.Get(server.URL); err == nil {
+			t.Fatal("Expected a timeout")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected the request to give up after the timeout, took %v", elapsed)
+		}
+	})
+}
+
+func TestShared(t *testing.T) {
+	if Shared() == nil {
+		t.Fatal("Expected a default shared client")
+	}
+
+	old := Shared()
+	defer SetShared(old)
+
+	c, _ := New(Options{MaxIdleConns: 5})
+	SetShared(c)
+	if Shared() != c {
+		t.Error("Expected SetShared to replace the client")
+	}
+}
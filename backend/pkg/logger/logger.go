@@ -1,24 +1,122 @@
 package logger
 
 import (
-	"log"
+	"context"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
 )
 
+// The package keeps one process-wide slog logger. Production writes JSON
+// lines, everything else human-readable text. Request-scoped loggers
+// carry the request ID and travel in the request context.
+
 var (
-	infoLogger  *log.Logger
-	errorLogger *log.Logger
+	base  = slog.New(slog.NewTextHandler(os.Stdout, nil))
+	level = new(slog.LevelVar)
 )
 
-func Init(env string) {
-	infoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	errorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+type contextKey struct{}
+
+// Init configures the logger for env. lvl is debug, info, warn or
+// error; empty picks debug in development and info elsewhere. SetLevel
+// changes it later without replacing the logger.
+func Init(env, lvl string) {
+	level.Set(ParseLevel(lvl, env))
+	Set(newLogger(os.Stdout, env, level))
+	slog.SetDefault(base)
+}
+
+// SetLevel changes the level of the logger set up by Init
+func SetLevel(env, lvl string) {
+	level.Set(ParseLevel(lvl, env))
+}
+
+// New builds a logger writing to w with the same rules as Init
+func New(w io.Writer, env, lvl string) *slog.Logger {
+	return newLogger(w, env, ParseLevel(lvl, env))
+}
+
+func newLogger(w io.Writer, env string, leveler slog.Leveler) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: leveler}
+
+	if env == "production" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// ParseLevel maps a LOG_LEVEL value to a slog level
+func ParseLevel(level, env string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "info":
+		return slog.LevelInfo
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+
+	if env == "development" {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// Tag adds attributes to every line the process logger writes from now
+// on, such as the instance ID in cluster mode
+func Tag(args ...interface{}) {
+	base = base.With(args...)
+	slog.SetDefault(base)
+}
+
+// Set replaces the process logger
+func Set(l *slog.Logger) {
+	base = l
+}
+
+// L returns the process logger
+func L() *slog.Logger {
+	return base
+}
+
+// WithContext stores a request-scoped logger in ctx
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored by WithContext, or the process
+// logger when there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return l
+		}
+	}
+	return base
+}
+
+func Debug(msg string, args ...interface{}) {
+	base.Debug(msg, args...)
+}
+
+func Info(msg string, args ...interface{}) {
+	base.Info(msg, args...)
+}
+
+func Warn(msg string, args ...interface{}) {
+	base.Warn(msg, args...)
 }
 
-func Info(v ...interface{}) {
-	infoLogger.Println(v...)
+func Error(msg string, args ...interface{}) {
+	base.Error(msg, args...)
 }
 
-func Error(v ...interface{}) {
-	errorLogger.Println(v...)
+// Fatal logs at error level and exits
+func Fatal(msg string, args ...interface{}) {
+	base.Error(msg, args...)
+	os.Exit(1)
 }
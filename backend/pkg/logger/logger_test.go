@@ -2,169 +2,119 @@ package logger
 
 import (
 	"bytes"
-	"log"
-	"os"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"strings"
 	"testing"
 )
 
-func TestLoggerInit(t *testing.T) {
-	t.Run("Initialize logger", func(t *testing.T) {
-		Init("development")
-
-		if infoLogger == nil {
-			t.Error("infoLogger should be initialized")
-		}
-
-		if errorLogger == nil {
-			t.Error("errorLogger should be initialized")
-		}
-	})
-
-	t.Run("Initialize logger for production", func(t *testing.T) {
-		Init("production")
-
-		if infoLogger == nil {
-			t.Error("infoLogger should be initialized")
-		}
-
-		if errorLogger == nil {
-			t.Error("errorLogger should be initialized")
-		}
-	})
-}
-
-func TestInfo(t *testing.T) {
-	t.Run("Log info message", func(t *testing.T) {
-		// Capture stdout
+func TestNew(t *testing.T) {
+	t.Run("Production writes JSON", func(t *testing.T) {
 		var buf bytes.Buffer
-		infoLogger = log.New(&buf, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-
-		Info("Test info message")
+		New(&buf, "production", "").Info("Server starting", "addr", ":3000")
 
-		output := buf.String()
-		if !strings.Contains(output, "Test info message") {
-			t.Errorf("Expected log to contain 'Test info message', got: %s", output)
+		var line map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatalf("Expected JSON log line, got: %s", buf.String())
 		}
-
-		if !strings.Contains(output, "INFO:") {
-			t.Errorf("Expected log to contain 'INFO:', got: %s", output)
+		if line["msg"] != "Server starting" {
+			t.Errorf("Expected msg 'Server starting', got %v", line["msg"])
 		}
-	})
-
-	t.Run("Log multiple info messages", func(t *testing.T) {
-		var buf bytes.Buffer
-		infoLogger = log.New(&buf, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-
-		Info("Message 1", "Message 2", "Message 3")
-
-		output := buf.String()
-		if !strings.Contains(output, "Message 1") {
-			t.Error("Expected log to contain 'Message 1'")
+		if line["level"] != "INFO" {
+			t.Errorf("Expected level INFO, got %v", line["level"])
 		}
-		if !strings.Contains(output, "Message 2") {
-			t.Error("Expected log to contain 'Message 2'")
-		}
-		if !strings.Contains(output, "Message 3") {
-			t.Error("Expected log to contain 'Message 3'")
+		if line["addr"] != ":3000" {
+			t.Errorf("Expected addr ':3000', got %v", line["addr"])
 		}
 	})
-}
 
-func TestError(t *testing.T) {
-	t.Run("Log error message", func(t *testing.T) {
-		// Capture stderr
+	t.Run("Development writes text", func(t *testing.T) {
 		var buf bytes.Buffer
-		errorLogger = log.New(&buf, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-
-		Error("Test error message")
+		New(&buf, "development", "").Info("Test info message")
 
 		output := buf.String()
-		if !strings.Contains(output, "Test error message") {
-			t.Errorf("Expected log to contain 'Test error message', got: %s", output)
+		if !strings.Contains(output, `msg="Test info message"`) {
+			t.Errorf("Expected text log line, got: %s", output)
 		}
-
-		if !strings.Contains(output, "ERROR:") {
-			t.Errorf("Expected log to contain 'ERROR:', got: %s", output)
+		if strings.HasPrefix(output, "{") {
+			t.Errorf("Expected non-JSON output in development, got: %s", output)
 		}
 	})
 
-	t.Run("Log multiple error messages", func(t *testing.T) {
+	t.Run("Level filters lower messages", func(t *testing.T) {
 		var buf bytes.Buffer
-		errorLogger = log.New(&buf, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-
-		Error("Error 1", "Error 2")
+		l := New(&buf, "production", "warn")
+		l.Info("hidden")
+		l.Error("shown")
 
 		output := buf.String()
-		if !strings.Contains(output, "Error 1") {
-			t.Error("Expected log to contain 'Error 1'")
+		if strings.Contains(output, "hidden") {
+			t.Error("Expected info message to be filtered")
 		}
-		if !strings.Contains(output, "Error 2") {
-			t.Error("Expected log to contain 'Error 2'")
+		if !strings.Contains(output, "shown") {
+			t.Error("Expected error message to be logged")
 		}
 	})
 }
 
-func TestLoggerOutput(t *testing.T) {
-	t.Run("Info logger writes to stdout", func(t *testing.T) {
-		Init("test")
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		level string
+		env   string
+		want  slog.Level
+	}{
+		{"debug", "production", slog.LevelDebug},
+		{"INFO", "development", slog.LevelInfo},
+		{"warning", "", slog.LevelWarn},
+		{"error", "", slog.LevelError},
+		{"", "development", slog.LevelDebug},
+		{"", "production", slog.LevelInfo},
+		{"verbose", "test", slog.LevelInfo},
+	}
+
+	for _, tt := range tests {
+		if got := ParseLevel(tt.level, tt.env); got != tt.want {
+			t.Errorf("ParseLevel(%q, %q): expected %v, got %v", tt.level, tt.env, tt.want, got)
+		}
+	}
+}
 
-		// Verify infoLogger is configured
-		if infoLogger == nil {
-			t.Fatal("infoLogger should not be nil")
-		}
+func TestSetLevel(t *testing.T) {
+	previous := L()
+	defer Set(previous)
 
-		// Check that it's writing to stdout
-		if infoLogger.Writer() != os.Stdout {
-			t.Error("infoLogger should write to stdout")
-		}
-	})
+	Init("production", "error")
+	ctx := context.Background()
 
-	t.Run("Error logger writes to stderr", func(t *testing.T) {
-		Init("test")
+	if L().Enabled(ctx, slog.LevelInfo) {
+		t.Error("Expected info to be disabled at level error")
+	}
 
-		// Verify errorLogger is configured
-		if errorLogger == nil {
-			t.Fatal("errorLogger should not be nil")
-		}
+	// Request loggers derive from L(), so they follow the change too
+	requestLogger := L().With("request_id", "abc")
+	SetLevel("production", "debug")
 
-		// Check that it's writing to stderr
-		if errorLogger.Writer() != os.Stderr {
-			t.Error("errorLogger should write to stderr")
-		}
-	})
+	if !L().Enabled(ctx, slog.LevelDebug) || !requestLogger.Enabled(ctx, slog.LevelDebug) {
+		t.Error("Expected debug to be enabled after SetLevel")
+	}
 }
 
-func TestLoggerFlags(t *testing.T) {
-	t.Run("Logger has correct flags", func(t *testing.T) {
-		Init("test")
-
-		expectedFlags := log.Ldate | log.Ltime | log.Lshortfile
-
-		if infoLogger.Flags() != expectedFlags {
-			t.Errorf("infoLogger flags mismatch. Expected %d, got %d", expectedFlags, infoLogger.Flags())
-		}
-
-		if errorLogger.Flags() != expectedFlags {
-			t.Errorf("errorLogger flags mismatch. Expected %d, got %d", expectedFlags, errorLogger.Flags())
+func TestFromContext(t *testing.T) {
+	t.Run("Falls back to process logger", func(t *testing.T) {
+		if FromContext(context.Background()) != L() {
+			t.Error("Expected process logger without a request logger")
 		}
 	})
-}
-
-func TestLoggerPrefix(t *testing.T) {
-	t.Run("Info logger has correct prefix", func(t *testing.T) {
-		Init("test")
 
-		if infoLogger.Prefix() != "INFO: " {
-			t.Errorf("Expected prefix 'INFO: ', got '%s'", infoLogger.Prefix())
-		}
-	})
+	t.Run("Returns request logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		l := New(&buf, "production", "").With("request_id", "abc")
 
-	t.Run("Error logger has correct prefix", func(t *testing.T) {
-		Init("test")
+		FromContext(WithContext(context.Background(), l)).Info("handled")
 
-		if errorLogger.Prefix() != "ERROR: " {
-			t.Errorf("Expected prefix 'ERROR: ', got '%s'", errorLogger.Prefix())
+		if !strings.Contains(buf.String(), `"request_id":"abc"`) {
+			t.Errorf("Expected request_id in log line, got: %s", buf.String())
 		}
 	})
 }
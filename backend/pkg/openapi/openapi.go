@@ -0,0 +1,457 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI release the documents target
+const Version = "3.0.3"
+
+// Document is the subset of an OpenAPI 3 document this API uses
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Tags       []Tag                           `json:"tags,omitempty"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON schema; Ref points at a component instead
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Query describes a query string parameter
+type Query struct {
+	Name        string
+	Type        string // string, integer, number or boolean
+	Description string
+}
+
+// Route documents one endpoint. Body and Data are sample values whose
+// types are reflected into schemas; Data is wrapped in the standard
+// response envelope.
+type Route struct {
+	Summary   string
+	Tag       string
+	Auth      bool
+	Query     []Query
+	Body      interface{}
+	Data      interface{}
+	Paginated bool
+	Cursor    bool // also takes ?cursor= for keyset pages
+	Created   bool // responds 201
+	// Upload names the file field of a multipart/form-data body
+	Upload string
+
+	// Raw documents a response body that is not wrapped in the
+	// envelope; ContentType alone marks a binary or HTML response.
+	Raw         interface{}
+	ContentType string
+}
+
+// Builder assembles a Document from documented routes
+type Builder struct {
+	doc  *Document
+	tags map[string]bool
+}
+
+// New starts a document with the shared envelope schemas and the JWT
+// security schemes registered
+func New(info Info) *Builder {
+	b := &Builder{
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   map[string]map[string]Operation{},
+			Components: Components{
+				Schemas: map[string]*Schema{},
+				SecuritySchemes: map[string]SecurityScheme{
+					"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+					"cookieAuth": {Type: "apiKey", In: "cookie", Name: "token"},
+				},
+			},
+		},
+		tags: map[string]bool{},
+	}
+
+	b.doc.Components.Schemas["Meta"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"page":        {Type: "integer"},
+			"limit":       {Type: "integer"},
+			"total":       {Type: "integer"},
+			"total_pages": {Type: "integer"},
+			"has_more":    {Type: "boolean", Description: "Keyset pages only"},
+			"next_cursor": {Type: "string", Nullable: true, Description: "Keyset pages only; pass as cursor for the next page, null on the last"},
+		},
+	}
+	b.doc.Components.Schemas["ErrorResponse"] = &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"success": {Type: "boolean"},
+			"message": {Type: "string"},
+			"error": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"code":    {Type: "string"},
+					"message": {Type: "string"},
+					"fields":  {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+				},
+			},
+		},
+	}
+
+	return b
+}
+
+// Add documents a route. path uses Fiber syntax (:param, *).
+func (b *Builder) Add(method, path string, r Route) {
+	path, params := convertPath(path)
+	method = strings.ToLower(method)
+
+	op := Operation{
+		Summary:     r.Summary,
+		OperationID: operationID(method, path),
+		Parameters:  params,
+		Responses: map[string]Response{
+			"default": jsonResponse("Error", &Schema{Ref: "#/components/schemas/ErrorResponse"}),
+		},
+	}
+
+	if r.Tag != "" {
+		op.Tags = []string{r.Tag}
+		if !b.tags[r.Tag] {
+			b.tags[r.Tag] = true
+			b.doc.Tags = append(b.doc.Tags, Tag{Name: r.Tag})
+		}
+	}
+
+	for _, q := range r.Query {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: q.Name, In: "query", Description: q.Description, Schema: &Schema{Type: q.Type},
+		})
+	}
+	if r.Paginated {
+		op.Parameters = append(op.Parameters,
+			Parameter{Name: "page", In: "query", Schema: &Schema{Type: "integer"}},
+			Parameter{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}},
+		)
+	}
+	if r.Cursor {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: "cursor", In: "query", Schema: &Schema{Type: "string"},
+			Description: "Keyset pagination: empty for the first page, then the previous next_cursor; page and totals are omitted",
+		})
+	}
+
+	switch {
+	case r.Body != nil:
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: b.SchemaOf(r.Body)}},
+		}
+	case r.Upload != "":
+		form := &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{r.Upload: {Type: "string", Format: "binary"}},
+			Required:   []string{r.Upload},
+		}
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"multipart/form-data": {Schema: form}},
+		}
+	}
+	if op.RequestBody != nil {
+		op.Responses["422"] = jsonResponse("Validation failed; error.fields lists the invalid fields",
+			&Schema{Ref: "#/components/schemas/ErrorResponse"})
+	}
+
+	status := "200"
+	if r.Created {
+		status = "201"
+	}
+
+	switch {
+	case r.Raw != nil:
+		contentType := r.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		op.Responses[status] = Response{
+			Description: "OK",
+			Content:     map[string]MediaType{contentType: {Schema: b.SchemaOf(r.Raw)}},
+		}
+	case r.ContentType != "":
+		op.Responses[status] = Response{
+			Description: "OK",
+			Content:     map[string]MediaType{r.ContentType: {Schema: &Schema{Type: "string", Format: "binary"}}},
+		}
+	default:
+		op.Responses[status] = jsonResponse("OK", b.envelope(r))
+	}
+
+	if r.Auth {
+		op.Security = []map[string][]string{{"bearerAuth": {}}, {"cookieAuth": {}}}
+		op.Responses["401"] = jsonResponse("Missing or invalid token", &Schema{Ref: "#/components/schemas/ErrorResponse"})
+	}
+
+	if b.doc.Paths[path] == nil {
+		b.doc.Paths[path] = map[string]Operation{}
+	}
+	b.doc.Paths[path][method] = op
+}
+
+// Document returns the assembled document
+func (b *Builder) Document() *Document {
+	sort.Slice(b.doc.Tags, func(i, j int) bool {
+		return b.doc.Tags[i].Name < b.doc.Tags[j].Name
+	})
+	return b.doc
+}
+
+func (b *Builder) envelope(r Route) *Schema {
+	s := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"success": {Type: "boolean"},
+			"message": {Type: "string"},
+		},
+	}
+	if r.Data != nil {
+		s.Properties["data"] = b.SchemaOf(r.Data)
+	}
+	if r.Paginated {
+		s.Properties["meta"] = &Schema{Ref: "#/components/schemas/Meta"}
+	}
+	return s
+}
+
+func jsonResponse(description string, schema *Schema) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	describerType = reflect.TypeOf((*Describer)(nil)).Elem()
+)
+
+// Describer is implemented by types whose JSON form differs from their
+// Go structure, such as the validate.Flexible request fields
+type Describer interface {
+	OpenAPISchema() *Schema
+}
+
+// SchemaOf reflects a Go value into a schema. Named structs become
+// components referenced by $ref; fields follow their json tags.
+func (b *Builder) SchemaOf(v interface{}) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+	return b.schemaFor(reflect.TypeOf(v))
+}
+
+func (b *Builder) schemaFor(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	if t.Kind() != reflect.Ptr && t.Implements(describerType) {
+		return reflect.Zero(t).Interface().(Describer).OpenAPISchema()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawType:
+		return &Schema{Description: "Any JSON value"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := b.schemaFor(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := b.doc.Components.Schemas[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			b.doc.Components.Schemas[name] = &Schema{}
+			*b.doc.Components.Schemas[name] = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	// interface{} and anything else accepts any value
+	return &Schema{}
+}
+
+func (b *Builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := b.structSchema(field.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = b.schemaFor(field.Type)
+
+		// Mirror the `validate:"required"` rule checked by pkg/validate
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			if strings.TrimSpace(rule) == "required" {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+
+	return s
+}
+
+// convertPath turns /cameras/:id into /cameras/{id} and lists the path
+// parameters. A trailing wildcard becomes {path}.
+func convertPath(path string) (string, []Parameter) {
+	if len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+	}
+
+	var params []Parameter
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var name string
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name = strings.TrimSuffix(strings.TrimPrefix(segment, ":"), "?")
+		case segment == "*":
+			name = "path"
+		default:
+			continue
+		}
+
+		segments[i] = "{" + name + "}"
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives a stable id like getApiCamerasId
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(method)
+
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '_'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	return b.String()
+}
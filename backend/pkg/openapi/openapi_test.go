@@ -0,0 +1,126 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// flexibleInt stands in for validate.FlexibleInt, a struct that
+// describes its own JSON form
+type flexibleInt struct {
+	Int int
+	Set bool
+}
+
+func (flexibleInt) OpenAPISchema() *Schema {
+	return &Schema{Type: "integer", Nullable: true}
+}
+
+type camera struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name" validate:"required,max=100"`
+	AreaID    *int        `json:"area_id"`
+	GroupID   flexibleInt `json:"group_id"`
+	Secret    string      `json:"-"`
+	CreatedAt time.Time   `json:"created_at"`
+	Children  []*camera   `json:"children,omitempty"`
+}
+
+func TestConvertPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		params int
+	}{
+		{"/api/cameras/", "/api/cameras", 0},
+		{"/api/cameras/:id", "/api/cameras/{id}", 1},
+		{"/api/stream/hls/:streamKey/*", "/api/stream/hls/{streamKey}/{path}", 2},
+		{"/", "/", 0},
+	}
+
+	for _, tt := range tests {
+		got, params := convertPath(tt.path)
+		if got != tt.want || len(params) != tt.params {
+			t.Errorf("convertPath(%q): expected %q with %d params, got %q with %d", tt.path, tt.want, tt.params, got, len(params))
+		}
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	b := New(Info{Title: "test", Version: "1"})
+
+	ref := b.SchemaOf([]camera{})
+	if ref.Type != "array" || ref.Items.Ref != "#/components/schemas/Camera" {
+		t.Fatalf("Expected array of Camera refs, got %+v", ref)
+	}
+
+	s := b.doc.Components.Schemas["Camera"]
+	if s == nil {
+		t.Fatal("Expected Camera component")
+	}
+	if _, ok := s.Properties["Secret"]; ok {
+		t.Error("Expected json:\"-\" field to be skipped")
+	}
+	if !s.Properties["area_id"].Nullable || s.Properties["area_id"].Type != "integer" {
+		t.Errorf("Expected nullable integer area_id, got %+v", s.Properties["area_id"])
+	}
+	if g := s.Properties["group_id"]; g.Type != "integer" || g.Ref != "" {
+		t.Errorf("Expected group_id to use its own schema, got %+v", g)
+	}
+	if s.Properties["created_at"].Format != "date-time" {
+		t.Errorf("Expected date-time created_at, got %+v", s.Properties["created_at"])
+	}
+	if s.Properties["children"].Items.Ref != "#/components/schemas/Camera" {
+		t.Errorf("Expected recursive ref, got %+v", s.Properties["children"].Items)
+	}
+	if len(s.Required) != 1 || s.Required[0] != "name" {
+		t.Errorf("Expected name to be required, got %v", s.Required)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	b := New(Info{Title: "test", Version: "1"})
+	b.Add("GET", "/api/cameras/", Route{Summary: "List", Tag: "Cameras", Auth: true, Paginated: true, Data: []camera{}})
+	b.Add("POST", "/api/cameras", Route{Tag: "Cameras", Created: true, Body: camera{}})
+	b.Add("PUT", "/api/cameras/:id/image", Route{Tag: "Cameras", Upload: "image"})
+
+	doc := b.Document()
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatalf("Expected document to marshal, got %v", err)
+	}
+
+	list := doc.Paths["/api/cameras"]["get"]
+	if list.OperationID != "getApiCameras" {
+		t.Errorf("Expected operationId getApiCameras, got %s", list.OperationID)
+	}
+	if len(list.Security) == 0 || list.Responses["401"].Description == "" {
+		t.Error("Expected auth route to declare security and a 401")
+	}
+	if len(list.Parameters) != 2 {
+		t.Errorf("Expected page and limit parameters, got %d", len(list.Parameters))
+	}
+	envelope := list.Responses["200"].Content["application/json"].Schema
+	if envelope.Properties["meta"] == nil || envelope.Properties["data"].Type != "array" {
+		t.Errorf("Expected paginated envelope, got %+v", envelope)
+	}
+
+	create := doc.Paths["/api/cameras"]["post"]
+	if create.RequestBody == nil {
+		t.Error("Expected request body")
+	}
+	if _, ok := create.Responses["201"]; !ok {
+		t.Error("Expected 201 response")
+	}
+	if _, ok := create.Responses["422"]; !ok {
+		t.Error("Expected a 422 response for a route with a body")
+	}
+
+	upload := doc.Paths["/api/cameras/{id}/image"]["put"]
+	if form := upload.RequestBody.Content["multipart/form-data"].Schema; form == nil || form.Properties["image"].Format != "binary" {
+		t.Errorf("Expected a multipart body with an image file, got %+v", upload.RequestBody)
+	}
+	if len(doc.Tags) != 1 {
+		t.Errorf("Expected one tag, got %d", len(doc.Tags))
+	}
+}
@@ -0,0 +1,324 @@
+// Package redis is a small Redis client speaking RESP2 over a pool of
+// connections. It covers what the server needs from Redis, plain
+// commands and Lua scripts, and nothing of pub/sub or cluster topology.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	defaultPool    = 10
+)
+
+// ErrNil is returned for a nil reply, such as GET of a missing key
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Options configure a client
+type Options struct {
+	Addr     string // host:port
+	Username string // ACL user; empty uses the default user
+	Password string
+	DB       int
+	TLS      *tls.Config // nil for a plain connection
+
+	// Timeout bounds dialling and each command without a context
+	// deadline
+	Timeout time.Duration
+
+	// PoolSize is the number of idle connections kept
+	PoolSize int
+}
+
+// ParseURL reads redis://[[user]:password@]host[:port][/db] into
+// Options; the rediss scheme connects with TLS
+func ParseURL(rawURL string) (Options, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Options{}, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	var opts Options
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		opts.TLS = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return Options{}, fmt.Errorf("invalid redis URL %q: scheme must be redis or rediss", rawURL)
+	}
+	if u.Hostname() == "" {
+		return Options{}, fmt.Errorf("invalid redis URL %q: missing host", rawURL)
+	}
+
+	opts.Addr = u.Host
+	if u.Port() == "" {
+		opts.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		opts.DB, err = strconv.Atoi(db)
+		if err != nil || opts.DB < 0 {
+			return Options{}, fmt.Errorf("invalid redis URL %q: bad database %q", rawURL, db)
+		}
+	}
+	return opts, nil
+}
+
+// Client sends commands over pooled connections. It is safe for
+// concurrent use.
+type Client struct {
+	opts Options
+	idle chan *conn
+}
+
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaultPool
+	}
+	return &Client{opts: opts, idle: make(chan *conn, opts.PoolSize)}
+}
+
+// Close closes the idle connections; commands in flight close theirs
+// when they finish
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Ping checks that the server answers
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Do sends one command and returns its reply: a string for a status,
+// int64 for an integer, []byte for a bulk string and []interface{} for
+// an array. A nil reply is ErrNil and an error reply an Error.
+func (c *Client) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.opts.Timeout)
+	}
+	cn.SetDeadline(deadline)
+
+	reply, err := cn.do(args)
+	if err != nil {
+		var replyErr Error
+		if !errors.As(err, &replyErr) && err != ErrNil {
+			// The connection may hold half a reply
+			cn.Close()
+			return nil, err
+		}
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Int runs Do and reads an integer reply
+func (c *Client) Int(ctx context.Context, args ...interface{}) (int64, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %T, expected an integer", reply)
+	}
+	return n, nil
+}
+
+// Bytes runs Do and reads a bulk string reply
+func (c *Client) Bytes(ctx context.Context, args ...interface{}) ([]byte, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	switch v := reply.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %T, expected a string", reply)
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// dial connects and authenticates a new connection
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	var nc net.Conn
+	var err error
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+	if c.opts.TLS != nil {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: c.opts.TLS}).DialContext(ctx, "tcp", c.opts.Addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	deadline, _ := ctx.Deadline()
+	cn.SetDeadline(deadline)
+
+	var setup [][]interface{}
+	if c.opts.Password != "" {
+		if c.opts.Username != "" {
+			setup = append(setup, []interface{}{"AUTH", c.opts.Username, c.opts.Password})
+		} else {
+			setup = append(setup, []interface{}{"AUTH", c.opts.Password})
+		}
+	}
+	if c.opts.DB != 0 {
+		setup = append(setup, []interface{}{"SELECT", c.opts.DB})
+	}
+	for _, args := range setup {
+		if _, err := cn.do(args); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis %s: %w", args[0], err)
+		}
+	}
+	return cn, nil
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (cn *conn) do(args []interface{}) (interface{}, error) {
+	if err := cn.write(args); err != nil {
+		return nil, err
+	}
+	return cn.read()
+}
+
+// write sends args as an array of bulk strings
+func (cn *conn) write(args []interface{}) error {
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	return cn.w.Flush()
+}
+
+func (cn *conn) read() (interface{}, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i], err = cn.read()
+			if err != nil && err != ErrNil {
+				// An error reply inside an array is a value, not a
+				// failure of the connection
+				if e, ok := err.(Error); ok {
+					items[i] = e
+					continue
+				}
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: malformed reply %q", line)
+}
@@ -0,0 +1,247 @@
+// Package redistest runs an in-memory stand-in for a Redis server in
+// tests. It understands the commands the server sends: PING, AUTH,
+// SELECT, GET, SET with NX and PX, DEL, EXISTS, INCR and PTTL.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server is a fake Redis listening on a local port
+type Server struct {
+	Addr string
+
+	// password, when set, must be sent with AUTH before other commands.
+	// It is fixed before the server accepts connections.
+	password string
+
+	ln   net.Listener
+	mu   sync.Mutex
+	data map[string]entry
+	down bool
+}
+
+type entry struct {
+	value   string
+	expires time.Time // zero for no expiry
+}
+
+// NewServer starts a server that is closed with the test
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	return NewServerWithPassword(t, "")
+}
+
+// NewServerWithPassword starts a server that wants password sent with
+// AUTH before other commands
+func NewServerWithPassword(t testing.TB, password string) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &Server{Addr: ln.Addr().String(), password: password, ln: ln, data: map[string]entry{}}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+// URL is a redis:// URL for the server
+func (s *Server) URL() string {
+	if s.password != "" {
+		return "redis://:" + s.password + "@" + s.Addr
+	}
+	return "redis://" + s.Addr
+}
+
+// Keys lists the keys stored, expired ones excluded
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k, e := range s.data {
+		if e.live() {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// SetDown makes the server answer every command with an error, as one
+// that is loading or out of memory would
+func (s *Server) SetDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (e entry) live() bool {
+	return e.expires.IsZero() || time.Now().Before(e.expires)
+}
+
+func (s *Server) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(nc)
+	}
+}
+
+func (s *Server) handle(nc net.Conn) {
+	defer nc.Close()
+	r, w := bufio.NewReader(nc), bufio.NewWriter(nc)
+	authed := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		switch {
+		case cmd == "AUTH":
+			if args[len(args)-1] != s.password {
+				fmt.Fprint(w, "-WRONGPASS invalid password\r\n")
+				break
+			}
+			authed = true
+			fmt.Fprint(w, "+OK\r\n")
+		case !authed:
+			fmt.Fprint(w, "-NOAUTH Authentication required.\r\n")
+		default:
+			s.exec(w, cmd, args[1:])
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) exec(w io.Writer, cmd string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		fmt.Fprint(w, "-LOADING Redis is loading the dataset in memory\r\n")
+		return
+	}
+
+	get := func(key string) (entry, bool) {
+		e, ok := s.data[key]
+		if ok && !e.live() {
+			delete(s.data, key)
+			return entry{}, false
+		}
+		return e, ok
+	}
+
+	switch cmd {
+	case "PING":
+		fmt.Fprint(w, "+PONG\r\n")
+	case "SELECT":
+		fmt.Fprint(w, "+OK\r\n")
+	case "GET":
+		e, ok := get(args[0])
+		if !ok {
+			fmt.Fprint(w, "$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(e.value), e.value)
+	case "SET":
+		e := entry{value: args[1]}
+		nx := false
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX":
+				i++
+				ms, _ := strconv.Atoi(args[i])
+				e.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+		}
+		if _, ok := get(args[0]); ok && nx {
+			fmt.Fprint(w, "$-1\r\n")
+			return
+		}
+		s.data[args[0]] = e
+		fmt.Fprint(w, "+OK\r\n")
+	case "DEL", "EXISTS":
+		n := 0
+		for _, key := range args {
+			if _, ok := get(key); ok {
+				n++
+				if cmd == "DEL" {
+					delete(s.data, key)
+				}
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case "INCR":
+		e, _ := get(args[0])
+		n, err := strconv.Atoi(orZero(e.value))
+		if err != nil {
+			fmt.Fprint(w, "-ERR value is not an integer or out of range\r\n")
+			return
+		}
+		e.value = strconv.Itoa(n + 1)
+		s.data[args[0]] = e
+		fmt.Fprintf(w, ":%d\r\n", n+1)
+	case "PTTL":
+		e, ok := get(args[0])
+		switch {
+		case !ok:
+			fmt.Fprint(w, ":-2\r\n")
+		case e.expires.IsZero():
+			fmt.Fprint(w, ":-1\r\n")
+		default:
+			fmt.Fprintf(w, ":%d\r\n", time.Until(e.expires).Milliseconds())
+		}
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", cmd)
+	}
+}
+
+func orZero(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+// readCommand reads one command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad argument %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
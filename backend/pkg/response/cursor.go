@@ -0,0 +1,94 @@
+package response
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrInvalidCursor is returned by ParseKeyset for a cursor it did not
+// issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorPrefix versions the cursor format so it can change later
+const cursorPrefix = "id:"
+
+// EncodeCursor returns the opaque cursor for rows after id
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(id, 10)))
+}
+
+// DecodeCursor returns the id encoded by EncodeCursor
+func DecodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	digits, ok := strings.CutPrefix(string(raw), cursorPrefix)
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// ParseKeyset reads a page like ParsePage, switching to keyset
+// pagination when the query string has a cursor parameter. An empty
+// cursor asks for the first page; later pages pass the next_cursor of
+// the previous one.
+func ParseKeyset(c *fiber.Ctx, defaultLimit int) (Page, error) {
+	page := ParsePage(c, defaultLimit)
+	if !c.Context().QueryArgs().Has("cursor") {
+		return page, nil
+	}
+
+	page.Keyset = true
+	page.Page = 1
+	if page.Limit == 0 {
+		page.Limit = 20
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		page.After = after
+	}
+	return page, nil
+}
+
+// CursorMeta builds response metadata for a keyset page. next is the id
+// of the last row returned, or 0 when no rows follow it.
+func (p Page) CursorMeta(next int64) *Meta {
+	meta := &Meta{Limit: p.Limit, Keyset: true}
+	if next > 0 {
+		meta.NextCursor = EncodeCursor(next)
+	}
+	return meta
+}
+
+// MarshalJSON leaves the page number and totals out of keyset pages,
+// which do not count rows
+func (m Meta) MarshalJSON() ([]byte, error) {
+	if !m.Keyset {
+		type offsetMeta Meta
+		return json.Marshal(offsetMeta(m))
+	}
+
+	var next *string
+	if m.NextCursor != "" {
+		next = &m.NextCursor
+	}
+	return json.Marshal(struct {
+		Limit      int     `json:"limit"`
+		HasMore    bool    `json:"has_more"`
+		NextCursor *string `json:"next_cursor"`
+	}{m.Limit, next != nil, next})
+}
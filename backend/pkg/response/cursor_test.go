@@ -0,0 +1,99 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func parseKeyset(t *testing.T, query string) (Page, error) {
+	t.Helper()
+
+	app := fiber.New()
+	var page Page
+	var err error
+	app.Get("/", func(c *fiber.Ctx) error {
+		page, err = ParseKeyset(c, 0)
+		return nil
+	})
+
+	if _, reqErr := app.Test(httptest.NewRequest("GET", "/"+query, nil)); reqErr != nil {
+		t.Fatalf("Request failed: %v", reqErr)
+	}
+	return page, err
+}
+
+func TestCursor(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		id, err := DecodeCursor(EncodeCursor(1234))
+		if err != nil || id != 1234 {
+			t.Errorf("Expected 1234, got %d (%v)", id, err)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, cursor := range []string{"!!", "MTIz", EncodeCursor(0), "aWQ6eA"} {
+			if _, err := DecodeCursor(cursor); err != ErrInvalidCursor {
+				t.Errorf("%q: expected ErrInvalidCursor, got %v", cursor, err)
+			}
+		}
+	})
+}
+
+func TestParseKeyset(t *testing.T) {
+	t.Run("Offset without cursor", func(t *testing.T) {
+		page, _ := parseKeyset(t, "?page=2&limit=10")
+		if page.Keyset || page.Offset() != 10 {
+			t.Errorf("Expected an offset page, got %+v", page)
+		}
+	})
+
+	t.Run("Empty cursor is the first page", func(t *testing.T) {
+		page, err := parseKeyset(t, "?cursor=")
+		if err != nil || !page.Keyset || page.After != 0 || page.Limit != 20 {
+			t.Errorf("Expected a first keyset page of 20, got %+v (%v)", page, err)
+		}
+	})
+
+	t.Run("Cursor", func(t *testing.T) {
+		page, err := parseKeyset(t, "?page=5&limit=30&cursor="+EncodeCursor(77))
+		if err != nil || page.After != 77 || page.Limit != 30 || page.Offset() != 0 {
+			t.Errorf("Expected rows after 77, got %+v (%v)", page, err)
+		}
+	})
+
+	t.Run("Invalid cursor", func(t *testing.T) {
+		if _, err := parseKeyset(t, "?cursor=nope"); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor, got %v", err)
+		}
+	})
+}
+
+func TestMetaJSON(t *testing.T) {
+	encode := func(meta *Meta) string {
+		body, err := json.Marshal(meta)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		return string(body)
+	}
+
+	t.Run("Offset", func(t *testing.T) {
+		got := encode(Page{Page: 1, Limit: 10}.Meta(0))
+		if want := `{"page":1,"limit":10,"total":0,"total_pages":1}`; got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	})
+
+	t.Run("Keyset", func(t *testing.T) {
+		page := Page{Page: 1, Limit: 10, Keyset: true}
+		if got, want := encode(page.CursorMeta(0)), `{"limit":10,"has_more":false,"next_cursor":null}`; got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if got, want := encode(page.CursorMeta(5)), `{"limit":10,"has_more":true,"next_cursor":"`+EncodeCursor(5)+`"}`; got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	})
+}
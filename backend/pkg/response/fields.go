@@ -0,0 +1,157 @@
+package response
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Fields is a parsed ?fields= list of JSON field names. A nil Fields
+// selects every field.
+type Fields []string
+
+// ParseFields reads ?fields=id,name,... and checks each name against the
+// JSON fields of item, a sample of the listed struct. The error names the
+// unknown fields and the allowed ones.
+func ParseFields(c *fiber.Ctx, item interface{}) (Fields, error) {
+	raw := c.Query("fields")
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	known := map[string]bool{}
+	for _, f := range jsonFields(reflect.TypeOf(item)) {
+		known[f.name] = true
+	}
+
+	var fields Fields
+	var unknown []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if !known[name] {
+			unknown = append(unknown, name)
+			continue
+		}
+		fields = append(fields, name)
+	}
+
+	if len(unknown) > 0 {
+		allowed := make([]string, 0, len(known))
+		for name := range known {
+			allowed = append(allowed, name)
+		}
+		sort.Strings(allowed)
+		return nil, fmt.Errorf("unknown %s (allowed: %s)",
+			strings.Join(unknown, ", "), strings.Join(allowed, ", "))
+	}
+	return fields, nil
+}
+
+// Select trims data, a slice of structs, to the selected fields. Fields
+// that are empty and tagged omitempty are left out, as in the full
+// response. Without a selection data is returned unchanged.
+func (f Fields) Select(data interface{}) interface{} {
+	if f == nil {
+		return data
+	}
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice {
+		return data
+	}
+
+	want := map[string]bool{}
+	for _, name := range f {
+		want[name] = true
+	}
+
+	items := make([]map[string]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(v.Index(i))
+		out := map[string]interface{}{}
+		if item.Kind() == reflect.Struct {
+			for _, field := range jsonFields(item.Type()) {
+				value := item.FieldByIndex(field.index)
+				if !want[field.name] || (field.omitEmpty && isEmptyJSON(value)) {
+					continue
+				}
+				out[field.name] = value.Interface()
+			}
+		}
+		items = append(items, out)
+	}
+	return items
+}
+
+type jsonField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// jsonFields lists the fields of a struct type as encoding/json names
+// them, including promoted fields of embedded structs
+func jsonFields(t reflect.Type) []jsonField {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, inner := range jsonFields(sf.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, jsonField{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+	return fields
+}
+
+// isEmptyJSON matches what encoding/json leaves out under omitempty
+func isEmptyJSON(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
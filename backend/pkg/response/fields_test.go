@@ -0,0 +1,89 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type fieldsCamera struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	StreamKey string   `json:"stream_key"`
+	secret    string
+}
+
+func parseFields(t *testing.T, query string) (Fields, error) {
+	t.Helper()
+
+	app := fiber.New()
+	var fields Fields
+	var err error
+	app.Get("/", func(c *fiber.Ctx) error {
+		fields, err = ParseFields(c, fieldsCamera{})
+		return nil
+	})
+
+	if _, reqErr := app.Test(httptest.NewRequest("GET", "/"+query, nil)); reqErr != nil {
+		t.Fatalf("Request failed: %v", reqErr)
+	}
+	return fields, err
+}
+
+func TestParseFields(t *testing.T) {
+	t.Run("No selection", func(t *testing.T) {
+		fields, err := parseFields(t, "")
+		if fields != nil || err != nil {
+			t.Errorf("Expected no selection, got %v (%v)", fields, err)
+		}
+	})
+
+	t.Run("Selection", func(t *testing.T) {
+		fields, err := parseFields(t, "?fields=id,%20name,,id")
+		if err != nil || strings.Join(fields, ",") != "id,name" {
+			t.Errorf("Expected id,name, got %v (%v)", fields, err)
+		}
+	})
+
+	t.Run("Unknown field", func(t *testing.T) {
+		_, err := parseFields(t, "?fields=id,secret,rtsp")
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+		if !strings.Contains(err.Error(), "unknown secret, rtsp") || !strings.Contains(err.Error(), "allowed: id, latitude, name, stream_key") {
+			t.Errorf("Expected the unknown and allowed fields, got %q", err)
+		}
+	})
+}
+
+func TestFieldsSelect(t *testing.T) {
+	lat := -6.2
+	cameras := []fieldsCamera{
+		{ID: 1, Name: "Gate", Latitude: &lat, StreamKey: "gate"},
+		{ID: 2, Name: "Yard", StreamKey: "yard"},
+	}
+
+	t.Run("Unchanged without a selection", func(t *testing.T) {
+		if _, ok := Fields(nil).Select(cameras).([]fieldsCamera); !ok {
+			t.Error("Expected the original slice")
+		}
+	})
+
+	t.Run("Trims each item", func(t *testing.T) {
+		body, _ := json.Marshal(Fields{"id", "latitude"}.Select(cameras))
+		if want := `[{"id":1,"latitude":-6.2},{"id":2}]`; string(body) != want {
+			t.Errorf("Expected %s, got %s", want, body)
+		}
+	})
+
+	t.Run("Empty list", func(t *testing.T) {
+		body, _ := json.Marshal(Fields{"id"}.Select([]fieldsCamera{}))
+		if string(body) != "[]" {
+			t.Errorf("Expected [], got %s", body)
+		}
+	})
+}
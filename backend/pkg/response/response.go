@@ -0,0 +1,185 @@
+package response
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// MaxLimit caps the page size a client can request
+	MaxLimit = 100
+)
+
+// Envelope is the JSON shape shared by every API response
+type Envelope struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Meta    *Meta       `json:"meta,omitempty"`
+	Error   *Error      `json:"error,omitempty"`
+}
+
+// Meta describes the page returned by a list endpoint
+type Meta struct {
+	Page       int `json:"page"`
+	Limit      int `json:"limit"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+
+	// Keyset pages report only limit, has_more and next_cursor; see
+	// MarshalJSON
+	Keyset     bool   `json:"-"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Error carries a machine-readable code next to the human message.
+// Fields maps request field names to validation messages.
+type Error struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// codes maps HTTP statuses to error codes
+var codes = map[int]string{
+	fiber.StatusBadRequest:            "bad_request",
+	fiber.StatusUnauthorized:          "unauthorized",
+	fiber.StatusForbidden:             "forbidden",
+	fiber.StatusNotFound:              "not_found",
+	fiber.StatusConflict:              "conflict",
+	fiber.StatusRequestEntityTooLarge: "payload_too_large",
+	fiber.StatusUnprocessableEntity:   "validation_failed",
+	fiber.StatusTooManyRequests:       "rate_limited",
+	fiber.StatusInternalServerError:   "internal_error",
+	fiber.StatusBadGateway:            "bad_gateway",
+	fiber.StatusServiceUnavailable:    "service_unavailable",
+	fiber.StatusGatewayTimeout:        "gateway_timeout",
+}
+
+// CodeFor returns the error code for an HTTP status
+func CodeFor(status int) string {
+	if code, ok := codes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "error"
+}
+
+// NewError builds an Error with the code derived from status
+func NewError(status int, message string) *Error {
+	return &Error{Code: CodeFor(status), Message: message}
+}
+
+// OK writes a 200 response with data
+func OK(c *fiber.Ctx, data interface{}) error {
+	return c.JSON(Envelope{Success: true, Data: data})
+}
+
+// Message writes a 200 response with only a message
+func Message(c *fiber.Ctx, message string) error {
+	return c.JSON(Envelope{Success: true, Message: message})
+}
+
+// Created writes a 201 response with a message and data
+func Created(c *fiber.Ctx, message string, data interface{}) error {
+	return c.Status(fiber.StatusCreated).JSON(Envelope{Success: true, Message: message, Data: data})
+}
+
+// Paginated writes a list response with page metadata
+func Paginated(c *fiber.Ctx, data interface{}, meta *Meta) error {
+	return c.JSON(Envelope{Success: true, Data: data, Meta: meta})
+}
+
+// Fail writes an error response. The message is repeated at the top level
+// for clients that predate the error object.
+func Fail(c *fiber.Ctx, status int, message string) error {
+	return c.Status(status).JSON(Envelope{
+		Success: false,
+		Message: message,
+		Error:   NewError(status, message),
+	})
+}
+
+// FailFields writes an error response listing invalid request fields
+func FailFields(c *fiber.Ctx, status int, message string, fields map[string]string) error {
+	err := NewError(status, message)
+	err.Fields = fields
+	return c.Status(status).JSON(Envelope{
+		Success: false,
+		Message: message,
+		Error:   err,
+	})
+}
+
+// Page is a parsed ?page=&limit= pair. Limit 0 means unpaginated.
+type Page struct {
+	Page  int
+	Limit int
+
+	// Keyset is set by ParseKeyset for ?cursor= requests, which return
+	// rows with ids below After (0 for the first page)
+	Keyset bool
+	After  int64
+}
+
+// ParsePage reads page and limit from the query string. With
+// defaultLimit 0 the list stays unpaginated unless the client asks for
+// a page, which keeps existing map and selector clients working.
+func ParsePage(c *fiber.Ctx, defaultLimit int) Page {
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	if limit <= 0 {
+		limit = defaultLimit
+		if limit == 0 && page > 0 {
+			limit = 20
+		}
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	return Page{Page: page, Limit: limit}
+}
+
+// Paged reports whether a LIMIT should be applied
+func (p Page) Paged() bool {
+	return p.Limit > 0
+}
+
+// Offset returns the row offset for the page
+func (p Page) Offset() int {
+	if !p.Paged() {
+		return 0
+	}
+	return (p.Page - 1) * p.Limit
+}
+
+// Meta builds response metadata for total matching rows
+func (p Page) Meta(total int) *Meta {
+	limit := p.Limit
+	if !p.Paged() {
+		limit = total
+	}
+
+	totalPages := 1
+	if limit > 0 {
+		totalPages = (total + limit - 1) / limit
+	}
+	if totalPages < 1 {
+		totalPages = 1
+	}
+
+	return &Meta{
+		Page:       p.Page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: totalPages,
+	}
+}
@@ -0,0 +1,138 @@
+package response
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func parsePage(t *testing.T, query string, defaultLimit int) Page {
+	t.Helper()
+
+	app := fiber.New()
+	var page Page
+	app.Get("/", func(c *fiber.Ctx) error {
+		page = ParsePage(c, defaultLimit)
+		return nil
+	})
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/"+query, nil)); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return page
+}
+
+func TestParsePage(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		page := parsePage(t, "", 20)
+		if page.Page != 1 || page.Limit != 20 {
+			t.Errorf("Expected page 1 limit 20, got page %d limit %d", page.Page, page.Limit)
+		}
+	})
+
+	t.Run("Unpaginated by default", func(t *testing.T) {
+		page := parsePage(t, "", 0)
+		if page.Paged() {
+			t.Errorf("Expected unpaginated request, got limit %d", page.Limit)
+		}
+	})
+
+	t.Run("Page without limit", func(t *testing.T) {
+		page := parsePage(t, "?page=3", 0)
+		if page.Limit != 20 {
+			t.Errorf("Expected limit 20, got %d", page.Limit)
+		}
+		if page.Offset() != 40 {
+			t.Errorf("Expected offset 40, got %d", page.Offset())
+		}
+	})
+
+	t.Run("Limit is capped", func(t *testing.T) {
+		page := parsePage(t, "?limit=5000", 20)
+		if page.Limit != MaxLimit {
+			t.Errorf("Expected limit %d, got %d", MaxLimit, page.Limit)
+		}
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		page := parsePage(t, "?page=-2&limit=abc", 10)
+		if page.Page != 1 || page.Limit != 10 {
+			t.Errorf("Expected page 1 limit 10, got page %d limit %d", page.Page, page.Limit)
+		}
+	})
+}
+
+func TestPageMeta(t *testing.T) {
+	t.Run("Paged", func(t *testing.T) {
+		meta := Page{Page: 2, Limit: 20}.Meta(45)
+		if meta.TotalPages != 3 {
+			t.Errorf("Expected 3 total pages, got %d", meta.TotalPages)
+		}
+		if meta.Total != 45 {
+			t.Errorf("Expected total 45, got %d", meta.Total)
+		}
+	})
+
+	t.Run("Unpaged", func(t *testing.T) {
+		meta := Page{Page: 1}.Meta(7)
+		if meta.Limit != 7 || meta.TotalPages != 1 {
+			t.Errorf("Expected limit 7 and 1 page, got limit %d and %d pages", meta.Limit, meta.TotalPages)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		meta := Page{Page: 1, Limit: 20}.Meta(0)
+		if meta.TotalPages != 1 {
+			t.Errorf("Expected 1 total page, got %d", meta.TotalPages)
+		}
+	})
+}
+
+func TestCodeFor(t *testing.T) {
+	tests := map[int]string{
+		fiber.StatusBadRequest:          "bad_request",
+		fiber.StatusNotFound:            "not_found",
+		fiber.StatusInternalServerError: "internal_error",
+		fiber.StatusTeapot:              "error",
+		599:                             "internal_error",
+	}
+
+	for status, want := range tests {
+		if got := CodeFor(status); got != want {
+			t.Errorf("Expected %s for %d, got %s", want, status, got)
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return Fail(c, fiber.StatusNotFound, "Camera not found")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if env.Success {
+		t.Error("Expected success to be false")
+	}
+	if env.Message != "Camera not found" {
+		t.Errorf("Expected message 'Camera not found', got '%s'", env.Message)
+	}
+	if env.Error == nil || env.Error.Code != "not_found" {
+		t.Errorf("Expected error code not_found, got %+v", env.Error)
+	}
+}
@@ -0,0 +1,87 @@
+package validate
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The admin panel sends IDs, coordinates and flags as numbers, strings
+// or null depending on the form control. These convert such loosely
+// typed JSON values (as decoded into interface{}) in one place, for the
+// Flexible types and for query parameters.
+
+var (
+	errNotNumber = errors.New("not a number")
+	errNotID     = errors.New("not a valid ID")
+	errNotBool   = errors.New("not a boolean")
+)
+
+// Float converts a number or numeric string. nil and "" give nil.
+func Float(v interface{}) (*float64, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		return &v, nil
+	case int:
+		f := float64(v)
+		return &f, nil
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return nil, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errNotNumber
+		}
+		return &f, nil
+	}
+	return nil, errNotNumber
+}
+
+// ID converts a whole number or numeric string. nil, "" and zero mean
+// "none" and give nil; negative or fractional values are errors.
+func ID(v interface{}) (*int, error) {
+	f, err := Float(v)
+	if err != nil {
+		return nil, errNotID
+	}
+	if f == nil || *f == 0 {
+		return nil, nil
+	}
+	if *f < 0 || *f != math.Trunc(*f) || *f > math.MaxInt32 {
+		return nil, errNotID
+	}
+	id := int(*f)
+	return &id, nil
+}
+
+// Bool converts true/false, 1/0 and their string forms. nil and "" are
+// false.
+func Bool(v interface{}) (bool, error) {
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case float64:
+		if v == 0 || v == 1 {
+			return v == 1, nil
+		}
+	case int:
+		if v == 0 || v == 1 {
+			return v == 1, nil
+		}
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "", "0", "false":
+			return false, nil
+		case "1", "true":
+			return true, nil
+		}
+	}
+	return false, errNotBool
+}
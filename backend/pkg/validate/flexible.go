@@ -0,0 +1,160 @@
+package validate
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/abcdefak87/cctv/pkg/openapi"
+)
+
+// The Flexible types are request fields the admin panel sends as
+// numbers, strings or null depending on the form control. Decoding never
+// fails: a value that does not convert is remembered, and Struct reports
+// it as a field error alongside the others instead of rejecting the
+// whole body.
+
+// flexible lets Struct see through the Flexible types
+type flexible interface {
+	isSet() bool
+	problem() string // why the sent value did not convert, or ""
+}
+
+// FlexibleInt is an optional whole number: 3, "3" or null
+type FlexibleInt struct {
+	Int int
+	Set bool // false for null, "" and an omitted field
+
+	bad bool
+}
+
+func (f *FlexibleInt) UnmarshalJSON(data []byte) error {
+	*f = FlexibleInt{}
+	n, err := Float(loose(data))
+	switch {
+	case err != nil || (n != nil && (*n != math.Trunc(*n) || math.Abs(*n) > math.MaxInt32)):
+		f.bad = true
+	case n != nil:
+		f.Int, f.Set = int(*n), true
+	}
+	return nil
+}
+
+func (f FlexibleInt) MarshalJSON() ([]byte, error) {
+	if !f.Set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(f.Int)
+}
+
+// ID returns the value as an optional reference: nil when unset or 0
+func (f FlexibleInt) ID() *int {
+	if !f.Set || f.Int == 0 {
+		return nil
+	}
+	id := f.Int
+	return &id
+}
+
+func (f FlexibleInt) isSet() bool { return f.Set }
+
+func (f FlexibleInt) problem() string {
+	if f.bad {
+		return "must be a whole number"
+	}
+	return ""
+}
+
+func (FlexibleInt) OpenAPISchema() *openapi.Schema {
+	return &openapi.Schema{Type: "integer", Nullable: true, Description: "A number or numeric string"}
+}
+
+// FlexibleFloat is an optional number: -6.2, "-6.2" or null
+type FlexibleFloat struct {
+	Float float64
+	Set   bool // false for null, "" and an omitted field
+
+	bad bool
+}
+
+func (f *FlexibleFloat) UnmarshalJSON(data []byte) error {
+	*f = FlexibleFloat{}
+	n, err := Float(loose(data))
+	switch {
+	case err != nil:
+		f.bad = true
+	case n != nil:
+		f.Float, f.Set = *n, true
+	}
+	return nil
+}
+
+func (f FlexibleFloat) MarshalJSON() ([]byte, error) {
+	if !f.Set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(f.Float)
+}
+
+// Ptr returns the value, or nil when it is unset
+func (f FlexibleFloat) Ptr() *float64 {
+	if !f.Set {
+		return nil
+	}
+	v := f.Float
+	return &v
+}
+
+func (f FlexibleFloat) isSet() bool { return f.Set }
+
+func (f FlexibleFloat) problem() string {
+	if f.bad {
+		return "must be a number"
+	}
+	return ""
+}
+
+func (FlexibleFloat) OpenAPISchema() *openapi.Schema {
+	return &openapi.Schema{Type: "number", Nullable: true, Description: "A number or numeric string"}
+}
+
+// FlexibleBool is a flag: true/false, 1/0 or their string forms. null
+// and "" are false.
+type FlexibleBool struct {
+	Bool bool
+
+	set bool
+	bad bool
+}
+
+func (f *FlexibleBool) UnmarshalJSON(data []byte) error {
+	v := loose(data)
+	b, err := Bool(v)
+	*f = FlexibleBool{Bool: b, set: v != nil && v != "", bad: err != nil}
+	return nil
+}
+
+func (f FlexibleBool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Bool)
+}
+
+func (f FlexibleBool) isSet() bool { return f.set }
+
+func (f FlexibleBool) problem() string {
+	if f.bad {
+		return "must be true or false"
+	}
+	return ""
+}
+
+func (FlexibleBool) OpenAPISchema() *openapi.Schema {
+	return &openapi.Schema{Type: "boolean", Description: "Also accepts 1/0 and \"true\"/\"false\""}
+}
+
+// loose decodes a JSON value for Float and Bool. The decoder has already
+// checked data is valid JSON, so an object or array is the only thing
+// that comes back as something they reject.
+func loose(data []byte) interface{} {
+	var v interface{}
+	json.Unmarshal(data, &v)
+	return v
+}
@@ -0,0 +1,130 @@
+package validate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlexibleInt(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+		set  bool
+		bad  bool
+	}{
+		{`null`, 0, false, false},
+		{`""`, 0, false, false},
+		{`"  "`, 0, false, false},
+		{`0`, 0, true, false},
+		{`7`, 7, true, false},
+		{`"7"`, 7, true, false},
+		{`" 12 "`, 12, true, false},
+		{`-3`, -3, true, false},
+		{`7.0`, 7, true, false},
+		{`2.5`, 0, false, true},
+		{`"12abc"`, 0, false, true},
+		{`true`, 0, false, true},
+		{`[1]`, 0, false, true},
+		{`1e12`, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			var f FlexibleInt
+			if err := json.Unmarshal([]byte(tt.body), &f); err != nil {
+				t.Fatalf("Expected decoding to succeed, got %v", err)
+			}
+			if f.Int != tt.want || f.Set != tt.set || (f.problem() != "") != tt.bad {
+				t.Errorf("Expected %d (set=%v, bad=%v), got %+v", tt.want, tt.set, tt.bad, f)
+			}
+		})
+	}
+
+	t.Run("ID", func(t *testing.T) {
+		if id := (FlexibleInt{Int: 0, Set: true}).ID(); id != nil {
+			t.Errorf("Expected 0 to mean no ID, got %d", *id)
+		}
+		if id := (FlexibleInt{Int: 4, Set: true}).ID(); id == nil || *id != 4 {
+			t.Errorf("Expected 4, got %v", id)
+		}
+	})
+}
+
+func TestFlexibleFloat(t *testing.T) {
+	tests := []struct {
+		body string
+		want float64
+		set  bool
+		bad  bool
+	}{
+		{`null`, 0, false, false},
+		{`""`, 0, false, false},
+		{`-6.25`, -6.25, true, false},
+		{`"-6.25"`, -6.25, true, false},
+		{`"106"`, 106, true, false},
+		{`"north"`, 0, false, true},
+		{`"NaN"`, 0, false, true},
+		{`false`, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			var f FlexibleFloat
+			if err := json.Unmarshal([]byte(tt.body), &f); err != nil {
+				t.Fatalf("Expected decoding to succeed, got %v", err)
+			}
+			if f.Float != tt.want || f.Set != tt.set || (f.problem() != "") != tt.bad {
+				t.Errorf("Expected %v (set=%v, bad=%v), got %+v", tt.want, tt.set, tt.bad, f)
+			}
+			if (f.Ptr() != nil) != tt.set {
+				t.Errorf("Expected Ptr to be set=%v, got %v", tt.set, f.Ptr())
+			}
+		})
+	}
+}
+
+func TestFlexibleBool(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+		bad  bool
+	}{
+		{`null`, false, false},
+		{`true`, true, false},
+		{`false`, false, false},
+		{`1`, true, false},
+		{`0`, false, false},
+		{`"1"`, true, false},
+		{`"true"`, true, false},
+		{`"FALSE"`, false, false},
+		{`""`, false, false},
+		{`2`, false, true},
+		{`"yes"`, false, true},
+		{`{}`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			var f FlexibleBool
+			if err := json.Unmarshal([]byte(tt.body), &f); err != nil {
+				t.Fatalf("Expected decoding to succeed, got %v", err)
+			}
+			if f.Bool != tt.want || (f.problem() != "") != tt.bad {
+				t.Errorf("Expected %v (bad=%v), got %+v", tt.want, tt.bad, f)
+			}
+		})
+	}
+}
+
+func TestFlexibleMarshal(t *testing.T) {
+	body, _ := json.Marshal(struct {
+		A FlexibleInt   `json:"a"`
+		B FlexibleInt   `json:"b"`
+		C FlexibleFloat `json:"c"`
+		D FlexibleBool  `json:"d"`
+	}{A: FlexibleInt{Int: 3, Set: true}, C: FlexibleFloat{Float: 1.5, Set: true}, D: FlexibleBool{Bool: true}})
+
+	if want := `{"a":3,"b":null,"c":1.5,"d":true}`; string(body) != want {
+		t.Errorf("Expected %s, got %s", want, body)
+	}
+}
@@ -0,0 +1,216 @@
+// Package validate checks request structs against `validate` struct
+// tags and reports problems per JSON field.
+//
+// Rules are comma separated, as in go-playground/validator:
+//
+//	required       must be present and not blank
+//	min=N, max=N   length for strings and slices, value for numbers
+//	oneof=a b c    one of the space separated values
+//	email          an e-mail address
+//	id             a non-negative whole number
+//
+// Every rule except required passes on an empty value, so optional
+// fields only need the rules for when they are set. Fields the client
+// may send as numbers or strings use the Flexible types, which Struct
+// also reports on when the sent value did not convert.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors maps JSON field names to a message for each invalid field
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field, msg := range e {
+		fields = append(fields, field+" "+msg)
+	}
+	sort.Strings(fields)
+	return "validation failed: " + strings.Join(fields, "; ")
+}
+
+// Struct validates the tagged fields of v, a struct or pointer to one.
+// It returns nil when every field is valid.
+func Struct(v interface{}) Errors {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	errs := Errors{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		// Flexible fields are checked even untagged, for a value that
+		// did not convert
+		var rules []string
+		if tag != "" {
+			rules = strings.Split(tag, ",")
+		} else if _, ok := flexibleOf(rv.Field(i)); !ok {
+			continue
+		}
+		if msg := check(rv.Field(i), rules); msg != "" {
+			errs[jsonName(field)] = msg
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// check applies rules to one field and returns the first failure
+func check(v reflect.Value, rules []string) string {
+	// Look through pointers and interfaces to the value itself
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+
+	empty := isEmpty(v)
+	if f, ok := flexibleOf(v); ok {
+		if msg := f.problem(); msg != "" {
+			return msg
+		}
+		empty = !f.isSet()
+	}
+
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "required" {
+			if empty {
+				return "is required"
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+
+		if msg := apply(v, name, param); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func apply(v reflect.Value, rule, param string) string {
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: bad %s parameter %q", rule, param))
+		}
+		size, unit, ok := measure(v)
+		if !ok {
+			return ""
+		}
+		if rule == "min" && size < limit {
+			return strings.TrimSpace("must be at least " + param + " " + unit)
+		}
+		if rule == "max" && size > limit {
+			return strings.TrimSpace("must be at most " + param + " " + unit)
+		}
+
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, allowed := range strings.Fields(param) {
+			if s == allowed {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(strings.Fields(param), ", ")
+
+	case "email":
+		s, _ := v.Interface().(string)
+		if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+			return "must be a valid email address"
+		}
+
+	case "id":
+		value := v.Interface()
+		if f, ok := value.(FlexibleInt); ok {
+			value = f.Int
+		}
+		if _, err := ID(value); err != nil {
+			return "must be a valid ID"
+		}
+
+	default:
+		panic("validate: unknown rule " + rule)
+	}
+	return ""
+}
+
+// measure returns what min/max compare and its unit for messages: a
+// length for strings and collections, a value for numbers. ok is false
+// for other kinds.
+func measure(v reflect.Value) (size float64, unit string, ok bool) {
+	switch f := v.Interface().(type) {
+	case FlexibleInt:
+		return float64(f.Int), "", true
+	case FlexibleFloat:
+		return f.Float, "", true
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "characters", true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), "items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+	return 0, "", false
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return false
+}
+
+func flexibleOf(v reflect.Value) (flexible, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+	f, ok := v.Interface().(flexible)
+	return f, ok
+}
+
+// jsonName is the field's name in the request body
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,115 @@
+package validate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type cameraRequest struct {
+	Name      string        `json:"name" validate:"required,max=10"`
+	Email     string        `json:"email" validate:"email"`
+	Role      string        `json:"role" validate:"oneof=admin viewer"`
+	AreaID    FlexibleInt   `json:"area_id" validate:"id"`
+	Latitude  FlexibleFloat `json:"latitude" validate:"min=-90,max=90"`
+	Enabled   FlexibleBool  `json:"enabled"`
+	Required  FlexibleInt   `json:"required" validate:"required"`
+	Tags      []string      `json:"tags" validate:"max=2"`
+	Untouched string        `json:"untouched"`
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		fields map[string]string
+	}{
+		{"Valid", `{"name":"Gate","email":"a@b.co","role":"admin","area_id":"3","latitude":"-6.2","enabled":1,"required":0}`, nil},
+		{"Optional fields empty", `{"name":"Gate","area_id":null,"latitude":"","enabled":null,"required":1}`, nil},
+		{"Missing required", `{"name":"  ","required":""}`, map[string]string{"name": "is required", "required": "is required"}},
+		{"Too long", `{"name":"Main gate north","required":1}`, map[string]string{"name": "must be at most 10 characters"}},
+		{"Bad email", `{"name":"Gate","email":"nope","required":1}`, map[string]string{"email": "must be a valid email address"}},
+		{"Not in oneof", `{"name":"Gate","role":"root","required":1}`, map[string]string{"role": "must be one of: admin, viewer"}},
+		{"Bad ID", `{"name":"Gate","area_id":"abc","required":1}`, map[string]string{"area_id": "must be a whole number"}},
+		{"Fractional ID", `{"name":"Gate","area_id":1.5,"required":1}`, map[string]string{"area_id": "must be a whole number"}},
+		{"Negative ID", `{"name":"Gate","area_id":"-2","required":1}`, map[string]string{"area_id": "must be a valid ID"}},
+		{"Not numeric", `{"name":"Gate","latitude":"north","required":1}`, map[string]string{"latitude": "must be a number"}},
+		{"Numeric string out of range", `{"name":"Gate","latitude":"91","required":1}`, map[string]string{"latitude": "must be at most 90"}},
+		{"Number out of range", `{"name":"Gate","latitude":-100,"required":1}`, map[string]string{"latitude": "must be at least -90"}},
+		{"Bad bool", `{"name":"Gate","enabled":"yes","required":1}`, map[string]string{"enabled": "must be true or false"}},
+		{"Slice too long", `{"name":"Gate","tags":["a","b","c"],"required":1}`, map[string]string{"tags": "must be at most 2 items"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req cameraRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("Bad test body: %v", err)
+			}
+
+			errs := Struct(&req)
+			if len(errs) != len(tt.fields) {
+				t.Fatalf("Expected %v, got %v", tt.fields, errs)
+			}
+			for field, msg := range tt.fields {
+				if errs[field] != msg {
+					t.Errorf("Expected %s '%s', got '%s'", field, msg, errs[field])
+				}
+			}
+		})
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	t.Run("ID", func(t *testing.T) {
+		tests := []struct {
+			in   interface{}
+			want int // 0 means nil
+			ok   bool
+		}{
+			{nil, 0, true}, {"", 0, true}, {float64(0), 0, true}, {"0", 0, true},
+			{float64(7), 7, true}, {"7", 7, true}, {" 12 ", 12, true},
+			{"12abc", 0, false}, {float64(-1), 0, false}, {2.5, 0, false}, {true, 0, false},
+		}
+		for _, tt := range tests {
+			got, err := ID(tt.in)
+			if (err == nil) != tt.ok {
+				t.Errorf("ID(%#v): expected ok=%v, got %v", tt.in, tt.ok, err)
+				continue
+			}
+			if (got == nil && tt.want != 0) || (got != nil && *got != tt.want) {
+				t.Errorf("ID(%#v): expected %d, got %v", tt.in, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("Bool", func(t *testing.T) {
+		tests := []struct {
+			in   interface{}
+			want bool
+			ok   bool
+		}{
+			{nil, false, true}, {true, true, true}, {false, false, true},
+			{float64(1), true, true}, {float64(0), false, true}, {"1", true, true},
+			{"true", true, true}, {"FALSE", false, true}, {"", false, true},
+			{float64(2), false, false}, {"yes", false, false},
+		}
+		for _, tt := range tests {
+			got, err := Bool(tt.in)
+			if (err == nil) != tt.ok || got != tt.want {
+				t.Errorf("Bool(%#v): expected %v (ok=%v), got %v (%v)", tt.in, tt.want, tt.ok, got, err)
+			}
+		}
+	})
+
+	t.Run("Float", func(t *testing.T) {
+		if f, err := Float("-6.25"); err != nil || *f != -6.25 {
+			t.Errorf("Expected -6.25, got %v (%v)", f, err)
+		}
+		if f, err := Float(""); err != nil || f != nil {
+			t.Errorf("Expected nil for empty string, got %v (%v)", f, err)
+		}
+		if _, err := Float("NaN"); err == nil {
+			t.Error("Expected NaN to be rejected")
+		}
+	})
+}
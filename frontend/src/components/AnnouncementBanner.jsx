@@ -0,0 +1,80 @@
+import { useEffect, useState } from 'react';
+import { getApiUrl } from '../config/config.js';
+
+// Colours per severity, most severe first as the API orders them
+const severityStyles = {
+    critical: 'bg-red-50 dark:bg-red-500/10 border-red-200 dark:border-red-500/30 text-red-700 dark:text-red-400',
+    warning: 'bg-amber-50 dark:bg-amber-500/10 border-amber-200 dark:border-amber-500/30 text-amber-700 dark:text-amber-400',
+    info: 'bg-sky-50 dark:bg-sky-500/10 border-sky-200 dark:border-sky-500/30 text-sky-700 dark:text-sky-400',
+};
+
+/**
+ * AnnouncementBanner Component
+ * Menampilkan pengumuman aktif (mis. gangguan kamera) dari GET /api/announcements/active.
+ * Pengumuman yang ditutup tidak muncul lagi di browser yang sama.
+ */
+export default function AnnouncementBanner() {
+    const [announcements, setAnnouncements] = useState([]);
+    const [dismissed, setDismissed] = useState(() => {
+        try {
+            return JSON.parse(localStorage.getItem('dismissed_announcements') || '[]');
+        } catch {
+            return [];
+        }
+    });
+
+    useEffect(() => {
+        fetch(`${getApiUrl()}/api/announcements/active`)
+            .then(res => res.json())
+            .then(res => {
+                if (res && res.success && Array.isArray(res.data)) {
+                    setAnnouncements(res.data);
+                }
+            })
+            .catch(() => {});
+    }, []);
+
+    const dismiss = (id) => {
+        const next = [...dismissed, id];
+        setDismissed(next);
+        try {
+            localStorage.setItem('dismissed_announcements', JSON.stringify(next));
+        } catch (err) {
+            console.warn('Failed to save to localStorage:', err);
+        }
+    };
+
+    const visible = announcements.filter(a => !dismissed.includes(a.id));
+    if (visible.length === 0) {
+        return null;
+    }
+
+    return (
+        <div className="max-w-7xl mx-auto w-full px-4 sm:px-6 lg:px-8 pt-4 space-y-2">
+            {visible.map(a => (
+                <div
+                    key={a.id}
+                    role={a.severity === 'critical' ? 'alert' : 'status'}
+                    className={`flex items-start gap-3 px-4 py-3 rounded-xl border ${severityStyles[a.severity] || severityStyles.info}`}
+                >
+                    <svg className="w-5 h-5 mt-0.5 shrink-0" fill="none" viewBox="0 0 24 24" stroke="currentColor" strokeWidth={2}>
+                        <path strokeLinecap="round" strokeLinejoin="round" d="M13 16h-1v-4h-1m1-4h.01M21 12a9 9 0 11-18 0 9 9 0 0118 0z" />
+                    </svg>
+                    <div className="flex-1 text-sm">
+                        <p className="font-semibold">{a.title}</p>
+                        {a.body && <p className="mt-0.5 opacity-90 whitespace-pre-line">{a.body}</p>}
+                    </div>
+                    <button
+                        onClick={() => dismiss(a.id)}
+                        className="shrink-0 opacity-60 hover:opacity-100"
+                        aria-label="Tutup pengumuman"
+                    >
+                        <svg className="w-4 h-4" fill="none" viewBox="0 0 24 24" stroke="currentColor" strokeWidth={2}>
+                            <path strokeLinecap="round" strokeLinejoin="round" d="M6 18L18 6M6 6l12 12" />
+                        </svg>
+                    </button>
+                </div>
+            ))}
+        </div>
+    );
+}
@@ -4,6 +4,7 @@ import { useBranding } from '../contexts/BrandingContext';
 import { shouldDisableAnimations } from '../utils/animationControl';
 import FeedbackWidget from './FeedbackWidget';
 import SaweriaSupport from './SaweriaSupport';
+import AnnouncementBanner from './AnnouncementBanner';
 
 // ============================================
 // ICONS
@@ -132,6 +133,8 @@ export default function LandingPageSimple({
                 onLayoutToggle={onLayoutToggle}
             />
             
+            <AnnouncementBanner />
+            
             {/* Main Content - CamerasSection handles all view modes */}
             <main className="flex-1 min-h-0">
                 {CamerasSection && (
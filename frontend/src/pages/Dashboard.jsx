@@ -604,7 +604,7 @@ export default function Dashboard() {
                     <div className="w-full h-2 bg-gray-100 dark:bg-gray-700/50 rounded-full overflow-hidden">
                         <div className="h-full bg-gradient-to-r from-amber-400 to-orange-500 rounded-full transition-all" style={{ width: `${cpuLoad}%` }}></div>
                     </div>
-                    <p className="text-xs text-gray-400 dark:text-gray-500 mt-2 truncate" title={stats?.system.cpuModel}>{stats?.system.cpuModel || 'Unknown'}</p>
+                    <p className="text-xs text-gray-400 dark:text-gray-500 mt-2 truncate">{stats?.system?.cpuCores ? `${stats.system.cpuCores} cores` : 'Not sampled yet'}</p>
                 </div>
             </div>
 
@@ -37,7 +37,9 @@ export default function FeedbackManagement() {
 
             const response = await feedbackService.getAll(params);
             setFeedbacks(response.data);
-            setPagination(prev => ({ ...prev, ...response.pagination }));
+            if (response.meta) {
+                setPagination(prev => ({ ...prev, total: response.meta.total, totalPages: response.meta.total_pages }));
+            }
         } catch (error) {
             console.error('Failed to fetch feedbacks:', error);
         } finally {
@@ -1,9 +1,8 @@
 import { useEffect, useState, useCallback, useRef, memo, lazy, Suspense, useMemo } from 'react';
 import { useSearchParams } from 'react-router-dom';
 import { streamService } from '../services/streamService';
-import { areaService } from '../services/areaService';
+import { settingsService } from '../services/settingsService';
 import { viewerService } from '../services/viewerService';
-import { getPublicSaweriaConfig } from '../services/saweriaService';
 import { useTheme } from '../contexts/ThemeContext';
 import { useBranding } from '../contexts/BrandingContext';
 import { updateMetaTags } from '../utils/metaUpdater';
@@ -36,6 +35,7 @@ import CodecBadge from '../components/CodecBadge';
 import { canPlayCodec } from '../utils/codecSupport';
 import CameraThumbnail from '../components/CameraThumbnail';
 import LandingPageSimple from '../components/LandingPageSimple';
+import AnnouncementBanner from '../components/AnnouncementBanner';
 // Map view - lazy loaded for performance
 const MapView = lazy(() => import('../components/MapView'));
 // Playback - lazy loaded for performance
@@ -3728,36 +3728,39 @@ export default function LandingPage() {
     useEffect(() => {
         const fetchData = async () => {
             try {
-                // Fetch cameras, areas, Saweria config, and landing settings in parallel
-                const [camsRes, areasRes, saweriaRes, landingRes] = await Promise.all([
+                // Fetch cameras and the public page's settings in parallel
+                const [camsRes, bootstrapRes] = await Promise.all([
                     streamService.getAllActiveStreams(),
-                    areaService.getPublicAreas().catch(() => ({ success: false, data: [] })),
-                    getPublicSaweriaConfig().catch((err) => {
-                        console.warn('Saweria config fetch failed, using defaults:', err);
-                        return { success: true, data: { enabled: true, saweria_link: 'https://saweria.co/raflialdi' } };
+                    settingsService.getPublicBootstrap().catch((err) => {
+                        console.warn('Bootstrap fetch failed, using defaults:', err);
+                        return { success: false, data: {} };
                     }),
-                    fetch(`${getApiUrl()}/api/settings/landing-page`)
-                        .then(res => res.json())
-                        .catch(() => ({ success: false }))
                 ]);
+                const bootstrap = bootstrapRes.data || {};
                 
                 setCameras(camsRes.data || []);
-                setAreas(areasRes.data || []);
+                setAreas(bootstrap.areas || []);
+                
+                // A share link (?camera=<id>) opens its camera straight away
+                const sharedId = Number(searchParams.get('camera'));
+                const shared = sharedId && (camsRes.data || []).find(c => c.id === sharedId);
+                if (shared) {
+                    setPopup(shared);
+                }
                 
                 // Set Saweria config - with safe defaults
-                if (saweriaRes && saweriaRes.data) {
-                    setSaweriaEnabled(saweriaRes.data.enabled !== false);
-                    if (saweriaRes.data.saweria_link) {
-                        setSaweriaLink(saweriaRes.data.saweria_link);
-                    }
-                    if (saweriaRes.data.leaderboard_link) {
-                        setSaweriaLeaderboardLink(saweriaRes.data.leaderboard_link);
-                    }
+                const saweria = bootstrap.saweria || { enabled: true, saweria_link: 'https://saweria.co/raflialdi' };
+                setSaweriaEnabled(saweria.enabled !== false);
+                if (saweria.saweria_link) {
+                    setSaweriaLink(saweria.saweria_link);
+                }
+                if (saweria.leaderboard_link) {
+                    setSaweriaLeaderboardLink(saweria.leaderboard_link);
                 }
                 
                 // Set landing page settings
-                if (landingRes && landingRes.success && landingRes.data) {
-                    setLandingSettings(landingRes.data);
+                if (bootstrap.landing_page) {
+                    setLandingSettings(bootstrap.landing_page);
                 }
                 
                 // Show welcome toast if cameras loaded
@@ -3894,6 +3897,9 @@ export default function LandingPage() {
         <>
             <div className="min-h-screen bg-gray-50 dark:bg-gray-950 flex flex-col">
                 <Navbar cameraCount={cameras.length} branding={branding} layoutMode={layoutMode} onLayoutToggle={toggleLayoutMode} />
+
+                {/* Outage notices and other announcements */}
+                <AnnouncementBanner />
                 
                 {/* Hero Section - SEO optimized with Indonesian content */}
                 <header className="relative overflow-hidden bg-gradient-to-br from-sky-500/10 via-transparent to-purple-500/10 dark:from-sky-500/5 dark:to-purple-500/5">
@@ -91,11 +91,16 @@ export const getSegmentStreamUrl = (cameraId, filename) => {
 };
 
 /**
- * Get HLS playlist URL untuk seamless playback
+ * Get HLS playlist URL untuk seamless playback antara from dan to
+ * (Date atau string RFC 3339, maksimal 1 hari)
  */
-export const getPlaylistUrl = (cameraId) => {
+export const getPlaylistUrl = (cameraId, from, to) => {
     const baseUrl = getApiBaseUrl();
-    return `${baseUrl}/api/recordings/${cameraId}/playlist.m3u8`;
+    const params = new URLSearchParams({
+        from: new Date(from).toISOString(),
+        to: new Date(to).toISOString(),
+    });
+    return `${baseUrl}/api/recordings/${cameraId}/playlist.m3u8?${params}`;
 };
 
 export default {
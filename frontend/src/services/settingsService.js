@@ -1,6 +1,13 @@
 import apiClient from './apiClient';
 
 export const settingsService = {
+    // Public - branding, landing page, map center, areas, announcements
+    // and feature flags in one request, for the public page's first load
+    getPublicBootstrap: async () => {
+        const response = await apiClient.get('/api/public/bootstrap');
+        return response.data;
+    },
+
     // Public - get map default center
     getMapCenter: async () => {
         const response = await apiClient.get('/api/settings/map-center');
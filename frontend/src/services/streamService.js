@@ -102,6 +102,18 @@ export const streamService = {
             throw error;
         }
     },
+
+    // Signed URLs for every tile of a grid view in one request; unknown
+    // or disabled cameras come back with an error instead of URLs
+    async getMultiviewUrls(streamKeys) {
+        try {
+            const response = await apiClient.post('/api/stream/multiview', { stream_keys: streamKeys });
+            return response.data;
+        } catch (error) {
+            console.error('Get multiview URLs error:', error);
+            throw error;
+        }
+    },
 };
 
 export default streamService;
@@ -3,6 +3,10 @@
  * Handles viewer session tracking for CCTV streams
  * 
  * Supports multiple concurrent sessions (for multi-view)
+ *
+ * The server issues one viewer token per browser and sends it back as
+ * session_id; it is sent in X-Session-ID with every later call, so all
+ * cameras watched count as one viewer.
  * 
  * Timing Configuration:
  * - Heartbeat interval: 5 seconds
@@ -10,7 +14,7 @@
  * - This ensures sessions stay active with 3 heartbeats before timeout
  * 
  * Usage:
- * 1. Call startSession(cameraId) when user starts watching - returns sessionId
+ * 1. Call startSession(cameraId) when user starts watching - returns a session handle
  * 2. Service automatically sends heartbeats every 5 seconds for all active sessions
  * 3. Call stopSession(sessionId) when user stops watching
  * 4. Call stopAllSessions() on component unmount
@@ -24,22 +28,31 @@ const HEARTBEAT_INTERVAL = 5000; // 5 seconds
 
 class ViewerService {
     constructor() {
-        // Map of sessionId -> session data
+        // Map of session handle -> session data
         this.sessions = new Map();
         this.heartbeatInterval = null;
+        // Viewer token issued by the server on the first start
+        this.viewerToken = null;
+        this.nextHandle = 1;
     }
 
     /**
      * Start a new viewer session for a camera
      * @param {string} streamKey - The camera stream key
-     * @returns {Promise<string>} Session ID
+     * @param {string} transport - What the player plays with: hls, mse or webrtc
+     * @returns {Promise<string>} Session handle
      */
-    async startSession(streamKey) {
+    async startSession(streamKey, transport = 'hls') {
         try {
-            const response = await apiClient.post(`/api/stream/${streamKey}/start`);
+            // Inside an embed iframe the page embedding it is the referrer
+            const response = await apiClient.post(`/api/stream/${streamKey}/start`, {
+                transport,
+                referrer: window.self !== window.top ? document.referrer : window.location.href,
+            }, { headers: this.sessionHeaders() });
             
             if (response.data.success) {
-                const sessionId = response.data.session_id;
+                this.viewerToken = response.data.session_id;
+                const sessionId = `${streamKey}#${this.nextHandle++}`;
                 
                 this.sessions.set(sessionId, {
                     sessionId,
@@ -61,20 +74,24 @@ class ViewerService {
         }
     }
 
+    /**
+     * Headers naming the viewer to the server, once it issued a token
+     */
+    sessionHeaders() {
+        return this.viewerToken ? { 'X-Session-ID': this.viewerToken } : {};
+    }
+
     /**
      * Send heartbeat for all active sessions
      */
     async sendHeartbeats() {
-        // Heartbeat disabled - backend doesn't have this endpoint yet
-        return;
-        
         if (this.sessions.size === 0) return;
 
         const promises = [];
         
-        for (const [sessionId] of this.sessions) {
+        for (const [sessionId, session] of this.sessions) {
             promises.push(
-                apiClient.post('/api/viewer/heartbeat', { sessionId })
+                apiClient.post(`/api/stream/${session.streamKey}/heartbeat`, null, { headers: this.sessionHeaders() })
                     .catch(error => {
                         console.error(`[ViewerService] Heartbeat failed for ${sessionId}:`, error.message);
                         // Don't remove session here, let server handle cleanup
@@ -116,7 +133,7 @@ class ViewerService {
         const session = this.sessions.get(sessionId);
         
         try {
-            await apiClient.post(`/api/stream/${session.streamKey}/stop`);
+            await apiClient.post(`/api/stream/${session.streamKey}/stop`, null, { headers: this.sessionHeaders() });
             console.log(`[ViewerService] Session stopped: ${sessionId}`);
         } catch (error) {
             console.error('[ViewerService] Error stopping session:', error);